@@ -0,0 +1,322 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/contracts"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const abiCmdHTTPTimeout = 60 * time.Second
+
+type abiCmdConf struct {
+	Solidity        string
+	Compiled        string
+	ContractName    string
+	CompilerVersion string
+	EVMVersion      string
+	Output          string
+	URL             string
+	Username        string
+	Password        string
+	StoragePath     string
+	BaseURL         string
+	Address         string
+	RegisterAs      string
+}
+
+var abiCmdConfig abiCmdConf
+
+// compiledContract is the output of 'abi compile', which can be stored by a CI pipeline
+// and later supplied to 'abi register'
+type compiledContract struct {
+	ContractName    string                   `json:"contractName"`
+	ABI             ethbinding.ABIMarshaling `json:"abi"`
+	Bytecode        string                   `json:"bytecode"`
+	RuntimeBytecode string                   `json:"runtimeBytecode,omitempty"`
+	DevDoc          string                   `json:"devdoc,omitempty"`
+	CompilerVersion string                   `json:"compilerVersion,omitempty"`
+}
+
+// abiRegistration is the output of 'abi register'
+type abiRegistration struct {
+	ABI          string `json:"abi"`
+	Address      string `json:"address,omitempty"`
+	RegisteredAs string `json:"registeredAs,omitempty"`
+}
+
+func initABI() (abiCmd *cobra.Command) {
+	abiCmd = &cobra.Command{
+		Use:   "abi",
+		Short: "Compile Solidity and register ABIs and contract instances, without running a gateway",
+	}
+
+	compileCmd := &cobra.Command{
+		Use:   "compile",
+		Short: "Compile a Solidity source file to an ABI and bytecode, for use with 'abi register'",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			compiled, err := loadCompiledContract()
+			if err != nil {
+				return err
+			}
+			return writeABICmdOutput(compiled)
+		},
+	}
+	initABIInputFlags(compileCmd)
+	abiCmd.AddCommand(compileCmd)
+
+	registerCmd := &cobra.Command{
+		Use:   "register",
+		Short: "Register an ABI, and optionally a contract instance, with a running gateway or directly in its contract store",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if (abiCmdConfig.URL == "") == (abiCmdConfig.StoragePath == "") {
+				return errors.Errorf(errors.CLIABIRegisterTarget)
+			}
+			if abiCmdConfig.Address != "" {
+				addrHexNo0x := strings.TrimPrefix(strings.ToLower(abiCmdConfig.Address), "0x")
+				if !regexp.MustCompile("^[0-9a-f]{40}$").MatchString(addrHexNo0x) {
+					return errors.Errorf(errors.CLIABIRegisterInvalidAddress, abiCmdConfig.Address)
+				}
+				abiCmdConfig.Address = addrHexNo0x
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			compiled, err := loadCompiledContract()
+			if err != nil {
+				return err
+			}
+			var registration *abiRegistration
+			if abiCmdConfig.URL != "" {
+				registration, err = registerWithGateway(compiled)
+			} else {
+				registration, err = registerInContractStore(compiled)
+			}
+			if err != nil {
+				return err
+			}
+			return writeABICmdOutput(registration)
+		},
+	}
+	initABIInputFlags(registerCmd)
+	registerCmd.Flags().StringVarP(&abiCmdConfig.URL, "url", "u", "", "URL of a running gateway to register with")
+	registerCmd.Flags().StringVar(&abiCmdConfig.Username, "username", os.Getenv("ETHCONNECT_USERNAME"), "Username for basic auth to the gateway")
+	registerCmd.Flags().StringVar(&abiCmdConfig.Password, "password", os.Getenv("ETHCONNECT_PASSWORD"), "Password for basic auth to the gateway")
+	registerCmd.Flags().StringVarP(&abiCmdConfig.StoragePath, "openapi-path", "I", "", "Path of the contract store of a gateway to write to directly, when it is not running")
+	registerCmd.Flags().StringVarP(&abiCmdConfig.BaseURL, "openapi-baseurl", "U", "", "Base URL the gateway is configured with, when writing to its contract store directly")
+	registerCmd.Flags().StringVarP(&abiCmdConfig.Address, "address", "a", "", "Address of an existing contract instance to register against the ABI")
+	registerCmd.Flags().StringVarP(&abiCmdConfig.RegisterAs, "name", "n", "", "Friendly name to register the contract instance under")
+	abiCmd.AddCommand(registerCmd)
+
+	return
+}
+
+func initABIInputFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&abiCmdConfig.Solidity, "solidity", "s", "", "Solidity source file to compile")
+	cmd.Flags().StringVarP(&abiCmdConfig.Compiled, "compiled", "j", "", "JSON output of a previous 'abi compile', instead of Solidity source")
+	cmd.Flags().StringVarP(&abiCmdConfig.ContractName, "contract", "c", "", "Contract to use, when the Solidity source contains more than one")
+	cmd.Flags().StringVar(&abiCmdConfig.CompilerVersion, "compiler", "", "Solidity compiler version to use")
+	cmd.Flags().StringVar(&abiCmdConfig.EVMVersion, "evm", "", "EVM version to compile for")
+	cmd.Flags().StringVarP(&abiCmdConfig.Output, "output", "o", "", "File to write the JSON output to, instead of stdout")
+}
+
+func loadCompiledContract() (*compiledContract, error) {
+	if abiCmdConfig.Compiled != "" {
+		b, err := ioutil.ReadFile(abiCmdConfig.Compiled)
+		if err != nil {
+			return nil, errors.Errorf(errors.ConfigFileReadFailed, abiCmdConfig.Compiled, err)
+		}
+		var compiled compiledContract
+		if err = json.Unmarshal(b, &compiled); err != nil {
+			return nil, errors.Errorf(errors.CLIABIInputParseFailed, abiCmdConfig.Compiled, err)
+		}
+		if compiled.ABI == nil || compiled.Bytecode == "" {
+			return nil, errors.Errorf(errors.CLIABIInputParseFailed, abiCmdConfig.Compiled, "missing abi or bytecode")
+		}
+		return &compiled, nil
+	}
+	if abiCmdConfig.Solidity == "" {
+		return nil, errors.Errorf(errors.CLIABINoInput)
+	}
+	b, err := ioutil.ReadFile(abiCmdConfig.Solidity)
+	if err != nil {
+		return nil, errors.Errorf(errors.ConfigFileReadFailed, abiCmdConfig.Solidity, err)
+	}
+	solc, err := eth.CompileContract(string(b), abiCmdConfig.ContractName, abiCmdConfig.CompilerVersion, abiCmdConfig.EVMVersion)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &compiledContract{
+		ContractName: solc.ContractName,
+		ABI:          solc.ABI,
+		Bytecode:     "0x" + hex.EncodeToString(solc.Compiled),
+		DevDoc:       solc.DevDoc,
+	}
+	if len(solc.RuntimeCompiled) > 0 {
+		compiled.RuntimeBytecode = "0x" + hex.EncodeToString(solc.RuntimeCompiled)
+	}
+	if solc.ContractInfo != nil {
+		compiled.CompilerVersion = solc.ContractInfo.CompilerVersion
+	}
+	return compiled, nil
+}
+
+func writeABICmdOutput(result interface{}) error {
+	b, _ := json.MarshalIndent(result, "", "  ")
+	if abiCmdConfig.Output == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	if err := ioutil.WriteFile(abiCmdConfig.Output, b, 0664); err != nil {
+		return errors.Errorf(errors.CLIABIOutputWriteFailed, abiCmdConfig.Output, err)
+	}
+	return nil
+}
+
+func registerInContractStore(compiled *compiledContract) (*abiRegistration, error) {
+	store, err := contracts.NewContractStore(&contracts.SmartContractGatewayConf{
+		StoragePath: abiCmdConfig.StoragePath,
+		BaseURL:     abiCmdConfig.BaseURL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg := &messages.DeployContract{
+		ContractName:    compiled.ContractName,
+		ABI:             compiled.ABI,
+		DevDoc:          compiled.DevDoc,
+		CompilerVersion: compiled.CompilerVersion,
+	}
+	msg.Headers.MsgType = messages.MsgTypeDeployContract
+	if msg.Compiled, err = decodeCompiledHex(compiled.Bytecode); err != nil {
+		return nil, err
+	}
+	if msg.CompiledRuntime, err = decodeCompiledHex(compiled.RuntimeBytecode); err != nil {
+		return nil, err
+	}
+	abiID, err := store.AddABI(msg)
+	if err != nil {
+		return nil, err
+	}
+	registration := &abiRegistration{ABI: abiID}
+	if abiCmdConfig.Address != "" {
+		if err = store.RegisterContractInstance(abiID, abiCmdConfig.Address, abiCmdConfig.RegisterAs); err != nil {
+			return nil, err
+		}
+		registration.Address = abiCmdConfig.Address
+		registration.RegisteredAs = abiCmdConfig.RegisterAs
+	}
+	return registration, nil
+}
+
+func decodeCompiledHex(s string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, errors.Errorf(errors.CompilerBytecodeInvalid, err)
+	}
+	return b, nil
+}
+
+func registerWithGateway(compiled *compiledContract) (*abiRegistration, error) {
+	baseURL := strings.TrimSuffix(abiCmdConfig.URL, "/")
+	abiJSON, _ := json.Marshal(compiled.ABI)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("abi", string(abiJSON))
+	form.WriteField("bytecode", strings.TrimPrefix(compiled.Bytecode, "0x"))
+	if compiled.RuntimeBytecode != "" {
+		form.WriteField("runtimebytecode", strings.TrimPrefix(compiled.RuntimeBytecode, "0x"))
+	}
+	form.Close()
+
+	var abiInfo struct {
+		ID string `json:"id"`
+	}
+	if err := gatewayRequest(baseURL+"/abis", form.FormDataContentType(), &body, &abiInfo); err != nil {
+		return nil, err
+	}
+	registration := &abiRegistration{ABI: abiInfo.ID}
+
+	if abiCmdConfig.Address != "" {
+		registerURL := fmt.Sprintf("%s/abis/%s/%s", baseURL, url.PathEscape(abiInfo.ID), abiCmdConfig.Address)
+		if abiCmdConfig.RegisterAs != "" {
+			registerURL += fmt.Sprintf("?%s-register=%s", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), url.QueryEscape(abiCmdConfig.RegisterAs))
+		}
+		var contractInfo struct {
+			Address      string `json:"address"`
+			RegisteredAs string `json:"registeredAs"`
+		}
+		if err := gatewayRequest(registerURL, "application/json", nil, &contractInfo); err != nil {
+			return nil, err
+		}
+		registration.Address = contractInfo.Address
+		registration.RegisteredAs = contractInfo.RegisteredAs
+	}
+	return registration, nil
+}
+
+func gatewayRequest(requestURL, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, requestURL, body)
+	if err != nil {
+		return errors.Errorf(errors.CLIABIRegisterRequestFailed, requestURL, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if abiCmdConfig.Username != "" {
+		req.SetBasicAuth(abiCmdConfig.Username, abiCmdConfig.Password)
+	}
+	log.Infof("--> POST %s", requestURL)
+	client := &http.Client{Timeout: abiCmdHTTPTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Errorf(errors.CLIABIRegisterRequestFailed, requestURL, err)
+	}
+	defer res.Body.Close()
+	resBytes, _ := ioutil.ReadAll(res.Body)
+	log.Infof("<-- POST %s [%d]", requestURL, res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var errBody struct {
+			Message string `json:"error"`
+		}
+		if json.Unmarshal(resBytes, &errBody) != nil || errBody.Message == "" {
+			errBody.Message = string(resBytes)
+		}
+		return errors.Errorf(errors.CLIABIRegisterErrorResponse, requestURL, res.StatusCode, errBody.Message)
+	}
+	if err = json.Unmarshal(resBytes, result); err != nil {
+		return errors.Errorf(errors.CLIABIRegisterRequestFailed, requestURL, err)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCompiledContract = `{
+	"contractName": "SimpleStorage",
+	"abi": [{"type":"function","name":"get","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}],
+	"bytecode": "0x6080604052",
+	"runtimeBytecode": "0x60806040"
+}`
+
+func newTestABICmd(t *testing.T) (string, string) {
+	abiCmdConfig = abiCmdConf{}
+	dir, err := ioutil.TempDir("", "abicmd")
+	assert.NoError(t, err)
+	compiledFile := path.Join(dir, "compiled.json")
+	ioutil.WriteFile(compiledFile, []byte(testCompiledContract), 0644)
+	return dir, compiledFile
+}
+
+func TestABIRegisterContractStore(t *testing.T) {
+	assert := assert.New(t)
+	dir, compiledFile := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+	storeDir := path.Join(dir, "store")
+	os.Mkdir(storeDir, 0755)
+	outFile := path.Join(dir, "out.json")
+
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile, "-I", storeDir, "-o", outFile,
+		"-a", "0x0123456789ABCDEF0123456789abcdef01234567", "-n", "storage1"})
+	assert.Equal(0, Execute())
+
+	var registration abiRegistration
+	b, err := ioutil.ReadFile(outFile)
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(b, &registration))
+	assert.NotEmpty(registration.ABI)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", registration.Address)
+	assert.Equal("storage1", registration.RegisteredAs)
+	assert.FileExists(path.Join(storeDir, "abi_"+registration.ABI+".deploy.json"))
+	assert.FileExists(path.Join(storeDir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+
+	// The name is already taken by the first instance
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile, "-I", storeDir,
+		"-a", "0x89abcdef0123456789abcdef0123456789abcdef", "-n", "storage1"})
+	assert.Equal(1, Execute())
+}
+
+func TestABIRegisterGateway(t *testing.T) {
+	assert := assert.New(t)
+	dir, compiledFile := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+	outFile := path.Join(dir, "out.json")
+
+	var registerQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		user, pass, _ := req.BasicAuth()
+		assert.Equal("user1", user)
+		assert.Equal("pass1", pass)
+		switch req.URL.Path {
+		case "/abis":
+			assert.NoError(req.ParseMultipartForm(1024 * 1024))
+			assert.Equal("6080604052", req.FormValue("bytecode"))
+			assert.Equal("60806040", req.FormValue("runtimebytecode"))
+			assert.Contains(req.FormValue("abi"), `"name":"get"`)
+			res.Write([]byte(`{"id":"abi1"}`))
+		case "/abis/abi1/0123456789abcdef0123456789abcdef01234567":
+			registerQuery = req.URL.RawQuery
+			res.WriteHeader(201)
+			res.Write([]byte(`{"address":"0123456789abcdef0123456789abcdef01234567","registeredAs":"storage1"}`))
+		default:
+			res.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile, "-u", server.URL + "/", "-o", outFile,
+		"--username", "user1", "--password", "pass1",
+		"-a", "0123456789abcdef0123456789abcdef01234567", "-n", "storage1"})
+	assert.Equal(0, Execute())
+
+	assert.Equal("fly-register=storage1", registerQuery)
+	var registration abiRegistration
+	b, err := ioutil.ReadFile(outFile)
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(b, &registration))
+	assert.Equal(abiRegistration{ABI: "abi1", Address: "0123456789abcdef0123456789abcdef01234567", RegisteredAs: "storage1"}, registration)
+}
+
+func TestABIRegisterGatewayErrorResponse(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(400)
+		res.Write([]byte(`{"error":"pop"}`))
+	}))
+	defer server.Close()
+
+	abiCmdConfig.URL = server.URL
+	_, err := registerWithGateway(&compiledContract{Bytecode: "0x00"})
+	assert.Regexp("failed \\[400\\]: pop", err)
+}
+
+func TestABIRegisterGatewayBadURL(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+
+	abiCmdConfig.URL = "http://localhost:0"
+	_, err := registerWithGateway(&compiledContract{Bytecode: "0x00"})
+	assert.Regexp("Request to http://localhost:0/abis failed", err)
+}
+
+func TestABIRegisterBadArgs(t *testing.T) {
+	assert := assert.New(t)
+	dir, compiledFile := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile})
+	assert.Equal(1, Execute())
+
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile, "-u", "http://localhost:0", "-I", dir})
+	assert.Equal(1, Execute())
+
+	abiCmdConfig = abiCmdConf{}
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile, "-I", dir, "-a", "badness"})
+	assert.Equal(1, Execute())
+
+	abiCmdConfig = abiCmdConf{}
+	rootCmd.SetArgs([]string{"abi", "register", "-j", compiledFile, "-I", path.Join(dir, "missing")})
+	assert.Equal(1, Execute())
+	assert.NoFileExists(path.Join(dir, "missing"))
+}
+
+func TestABICompileInputErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+
+	_, err := loadCompiledContract()
+	assert.Regexp("Must supply either a Solidity source file", err)
+
+	abiCmdConfig.Solidity = path.Join(dir, "missing.sol")
+	_, err = loadCompiledContract()
+	assert.Regexp("Failed to read", err)
+
+	abiCmdConfig.Compiled = path.Join(dir, "missing.json")
+	_, err = loadCompiledContract()
+	assert.Regexp("Failed to read", err)
+
+	badFile := path.Join(dir, "bad.json")
+	ioutil.WriteFile(badFile, []byte(`{"abi":[]}`), 0644)
+	abiCmdConfig.Compiled = badFile
+	_, err = loadCompiledContract()
+	assert.Regexp("missing abi or bytecode", err)
+
+	ioutil.WriteFile(badFile, []byte(`!json`), 0644)
+	_, err = loadCompiledContract()
+	assert.Regexp("Failed to parse compiled contract", err)
+}
+
+func TestABICompileOutput(t *testing.T) {
+	assert := assert.New(t)
+	dir, compiledFile := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+	outFile := path.Join(dir, "out.json")
+
+	rootCmd.SetArgs([]string{"abi", "compile", "-j", compiledFile, "-o", outFile})
+	assert.Equal(0, Execute())
+	var compiled compiledContract
+	b, _ := ioutil.ReadFile(outFile)
+	assert.NoError(json.Unmarshal(b, &compiled))
+	assert.Equal("SimpleStorage", compiled.ContractName)
+
+	rootCmd.SetArgs([]string{"abi", "compile", "-j", compiledFile, "-o", dir})
+	assert.Equal(1, Execute())
+}
+
+func TestABIRegisterBadBytecode(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := newTestABICmd(t)
+	defer os.RemoveAll(dir)
+
+	abiCmdConfig.StoragePath = dir
+	_, err := registerInContractStore(&compiledContract{Bytecode: "0xzz"})
+	assert.Regexp("Decoding bytecode", err)
+	_, err = registerInContractStore(&compiledContract{Bytecode: "0x00", RuntimeBytecode: "0xzz"})
+	assert.Regexp("Decoding bytecode", err)
+	_, err = registerInContractStore(&compiledContract{Bytecode: "0x00"})
+	assert.Regexp("Must supply ABI", err)
+}
@@ -25,8 +25,10 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/icza/dyno"
+	"github.com/kaleido-io/ethconnect/internal/chaos"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/kafka"
+	"github.com/kaleido-io/ethconnect/internal/recorder"
 	"github.com/kaleido-io/ethconnect/internal/rest"
 	"github.com/kaleido-io/ethconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
@@ -44,9 +46,12 @@ type ServerConfig struct {
 	Webhooks     map[string]*rest.RESTGatewayConf  `json:"webhooks"`
 	RESTGateways map[string]*rest.RESTGatewayConf  `json:"rest"`
 	Plugins      PluginConfig                      `json:"plugins"`
+	LogSampling  utils.LogSamplingConf             `json:"logSampling"`
+	Recording    recorder.RecorderConf             `json:"recording"`
+	Chaos        chaos.ChaosConf                   `json:"chaos"`
 }
 
-func initLogging(debugLevel int) {
+func initLogging(debugLevel int) error {
 	log.SetFormatter(&prefixed.TextFormatter{
 		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
 		DisableSorting:  true,
@@ -70,13 +75,34 @@ func initLogging(debugLevel int) {
 		log.SetLevel(log.DebugLevel)
 		break
 	}
+	utils.CaptureRecentLogs()
 	log.Debugf("Log level set to %d", debugLevel)
+	return initLogSampling(nil)
+}
+
+// initLogSampling applies the log sampling rules from the command line, and any from the server config
+func initLogSampling(conf *utils.LogSamplingConf) error {
+	rules := []*utils.LogSamplingRule{}
+	for _, s := range rootConfig.LogSample {
+		rule, err := utils.ParseLogSamplingRule(s)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	if conf != nil {
+		rules = append(rules, conf.Rules...)
+	}
+	return utils.SetLogSampling(&utils.LogSamplingConf{Rules: rules})
 }
 
 var rootConfig struct {
 	DebugLevel int
 	DebugPort  int
 	PrintYAML  bool
+	LogSample  []string
+	RecordFile string
+	Chaos      chaos.ChaosConf
 }
 
 var serverCmdConfig struct {
@@ -87,14 +113,27 @@ var serverCmdConfig struct {
 var rootCmd = &cobra.Command{
 	Use:   "ethconnect [sub]",
 	Short: "Connectivity Bridge for Ethereum permissioned chains",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		initLogging(rootConfig.DebugLevel)
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := initLogging(rootConfig.DebugLevel); err != nil {
+			return err
+		}
+		if rootConfig.RecordFile != "" {
+			if err := recorder.Start(&recorder.RecorderConf{File: rootConfig.RecordFile}); err != nil {
+				return err
+			}
+		}
+		if rootConfig.Chaos.IsSet() {
+			if err := chaos.Start(&rootConfig.Chaos); err != nil {
+				return err
+			}
+		}
 
 		if rootConfig.DebugPort > 0 {
 			go func() {
 				log.Debugf("Debug HTTP endpoint listening on localhost:%d: %s", rootConfig.DebugPort, http.ListenAndServe(fmt.Sprintf("localhost:%d", rootConfig.DebugPort), nil))
 			}()
 		}
+		return nil
 	},
 }
 
@@ -160,6 +199,24 @@ func startServer() (err error) {
 		return
 	}
 
+	if len(serverConfig.LogSampling.Rules) > 0 {
+		if err = initLogSampling(&serverConfig.LogSampling); err != nil {
+			return
+		}
+	}
+
+	if serverConfig.Recording.File != "" && rootConfig.RecordFile == "" {
+		if err = recorder.Start(&serverConfig.Recording); err != nil {
+			return
+		}
+	}
+
+	if serverConfig.Chaos.IsSet() && !rootConfig.Chaos.IsSet() {
+		if err = chaos.Start(&serverConfig.Chaos); err != nil {
+			return
+		}
+	}
+
 	if rootConfig.PrintYAML {
 		b, err := utils.MarshalToYAML(&serverConfig)
 		print("# Full YAML configuration processed from supplied file\n" + string(b))
@@ -214,6 +271,13 @@ func init() {
 	rootCmd.PersistentFlags().IntVarP(&rootConfig.DebugLevel, "debug", "d", 1, "0=error, 1=info, 2=debug")
 	rootCmd.PersistentFlags().IntVarP(&rootConfig.DebugPort, "debugPort", "Z", 6060, "Port for pprof HTTP endpoints (localhost only)")
 	rootCmd.PersistentFlags().BoolVarP(&rootConfig.PrintYAML, "print-yaml-confg", "Y", false, "Print YAML config snippet and exit")
+	rootCmd.PersistentFlags().StringArrayVar(&rootConfig.LogSample, "log-sample", utils.DefStringArray("ETHCONNECT_LOG_SAMPLE"), "Log 1 in N entries from a module, that match a regexp - module[:match]=N, 0 drops them all")
+	rootCmd.PersistentFlags().StringVar(&rootConfig.RecordFile, "record-file", os.Getenv("ETHCONNECT_RECORD_FILE"), "Record the requests received, and the JSON/RPC calls made to the node, to a file for replay")
+	rootCmd.PersistentFlags().IntVar(&rootConfig.Chaos.MaxDelayMS, "chaos-max-delay-ms", utils.DefInt("ETHCONNECT_CHAOS_MAX_DELAY_MS", 0), "Test only: delay each JSON/RPC call and event delivery by a random time up to this (ms)")
+	rootCmd.PersistentFlags().IntVar(&rootConfig.Chaos.WebhookDropPercent, "chaos-webhook-drop-percent", utils.DefInt("ETHCONNECT_CHAOS_WEBHOOK_DROP_PERCENT", 0), "Test only: percentage of webhook deliveries to drop, as if the receiver was down")
+	rootCmd.PersistentFlags().IntVar(&rootConfig.Chaos.DuplicateEventPercent, "chaos-duplicate-event-percent", utils.DefInt("ETHCONNECT_CHAOS_DUPLICATE_EVENT_PERCENT", 0), "Test only: percentage of event batches to deliver twice")
+	rootCmd.PersistentFlags().IntVar(&rootConfig.Chaos.RPCErrorPercent, "chaos-rpc-error-percent", utils.DefInt("ETHCONNECT_CHAOS_RPC_ERROR_PERCENT", 0), "Test only: percentage of JSON/RPC calls to fail with a transient error")
+	rootCmd.PersistentFlags().Int64Var(&rootConfig.Chaos.Seed, "chaos-seed", 0, "Test only: seed for a repeatable sequence of injected faults")
 
 	serverCmd := initServer()
 	rootCmd.AddCommand(serverCmd)
@@ -224,6 +288,9 @@ func init() {
 	restGateway := rest.NewRESTGateway(&rootConfig.PrintYAML)
 	rootCmd.AddCommand(restGateway.CobraInit("webhooks")) // for backwards compatibility
 	rootCmd.AddCommand(restGateway.CobraInit("rest"))
+
+	rootCmd.AddCommand(initABI())
+	rootCmd.AddCommand(initReplay())
 }
 
 // Execute is called by the main method of the package
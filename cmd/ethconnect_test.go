@@ -65,6 +65,23 @@ func TestExecuteSetDebug(t *testing.T) {
 
 }
 
+func TestExecuteLogSample(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { rootConfig.LogSample = nil }()
+
+	utCmd := &cobra.Command{
+		Use:  "testExecuteLogSample",
+		RunE: func(cmd *cobra.Command, args []string) (err error) { return },
+	}
+	rootCmd.AddCommand(utCmd)
+
+	rootCmd.SetArgs([]string{"testExecuteLogSample", "--log-sample", "eth:eth_getTransactionReceipt=100"})
+	assert.Equal(0, Execute())
+
+	rootCmd.SetArgs([]string{"testExecuteLogSample", "--log-sample", "eth"})
+	assert.Equal(1, Execute())
+}
+
 func TestExecuteFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -18,6 +18,7 @@ import (
 	"plugin"
 
 	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/contracts"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/pkg/plugins"
 	log "github.com/sirupsen/logrus"
@@ -25,13 +26,17 @@ import (
 
 // PluginConfig is the JSON configuration for loading plugins
 type PluginConfig struct {
-	SecurityModulePlugin string `json:"securityModule"`
+	SecurityModulePlugin   string `json:"securityModule"`
+	ParamTransformerPlugin string `json:"paramTransformer"`
 }
 
 func loadPlugins(conf *PluginConfig) error {
 	if err := loadSecurityModulePlugin(conf); err != nil {
 		return err
 	}
+	if err := loadParamTransformerPlugin(conf); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -56,3 +61,25 @@ func loadSecurityModulePlugin(conf *PluginConfig) error {
 	auth.RegisterSecurityModule(*smSymbol.(*plugins.SecurityModule))
 	return nil
 }
+
+func loadParamTransformerPlugin(conf *PluginConfig) error {
+
+	modulePath := conf.ParamTransformerPlugin
+	if modulePath == "" {
+		return nil
+	}
+
+	log.Debugf("Loading ParamTransformer plugin '%s'", modulePath)
+	ptPlugin, err := plugin.Open(modulePath)
+	if err != nil {
+		return errors.Errorf(errors.SecurityModulePluginLoad, err)
+	}
+
+	ptSymbol, err := ptPlugin.Lookup("ParamTransformer")
+	if err != nil || ptSymbol == nil {
+		return errors.Errorf(errors.ParamTransformerPluginSymbol, modulePath, err)
+	}
+
+	contracts.RegisterParamTransformer(*ptSymbol.(*plugins.ParamTransformer))
+	return nil
+}
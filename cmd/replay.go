@@ -0,0 +1,78 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/recorder"
+	"github.com/spf13/cobra"
+)
+
+const replayCmdHTTPTimeout = 120 * time.Second
+
+var replayCmdConfig struct {
+	Filename string
+	URL      string
+	Headers  []string
+	Ignore   []string
+}
+
+func initReplay() (replayCmd *cobra.Command) {
+	replayCmd = &cobra.Command{
+		Use:   "replay",
+		Short: "Replay the requests in a recording against a running gateway, and report any responses that differ",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf := &recorder.ReplayConf{
+				URL:     replayCmdConfig.URL,
+				Headers: make(map[string]string),
+				Ignore:  append(recorder.DefaultReplayIgnore, replayCmdConfig.Ignore...),
+				Client:  &http.Client{Timeout: replayCmdHTTPTimeout},
+			}
+			for _, h := range replayCmdConfig.Headers {
+				nameValue := strings.SplitN(h, ":", 2)
+				if len(nameValue) != 2 || strings.TrimSpace(nameValue[0]) == "" {
+					return errors.Errorf(errors.CLIReplayBadHeader, h)
+				}
+				conf.Headers[strings.TrimSpace(nameValue[0])] = strings.TrimSpace(nameValue[1])
+			}
+			records, err := recorder.ReadRecords(replayCmdConfig.Filename)
+			if err != nil {
+				return err
+			}
+			report, err := recorder.Replay(records, conf)
+			if err != nil {
+				return err
+			}
+			b, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(b))
+			if report.Mismatched > 0 {
+				return errors.Errorf(errors.CLIReplayMismatched, report.Mismatched, report.Replayed)
+			}
+			return nil
+		},
+	}
+	replayCmd.Flags().StringVarP(&replayCmdConfig.Filename, "filename", "f", "", "Recording to replay, written by a gateway with --record-file")
+	replayCmd.Flags().StringVarP(&replayCmdConfig.URL, "url", "u", "http://localhost:8080", "URL of the gateway to replay the requests against")
+	replayCmd.Flags().StringArrayVarP(&replayCmdConfig.Headers, "header", "H", []string{}, "Header to add to every request, such as credentials that are not recorded - 'Name: value'")
+	replayCmd.Flags().StringArrayVar(&replayCmdConfig.Ignore, "ignore", []string{}, "Dot separated path of a field in JSON responses to ignore when comparing, in addition to generated IDs and timestamps")
+	replayCmd.MarkFlagRequired("filename")
+	return
+}
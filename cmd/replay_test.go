@@ -0,0 +1,72 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayCmd(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "replaycmd")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("Bearer token1", req.Header.Get("Authorization"))
+		res.Write([]byte(`{"headers":{"id":"new-id"},"output":"1"}`))
+	}))
+	defer server.Close()
+
+	matchFile := path.Join(dir, "match.jsonl")
+	ioutil.WriteFile(matchFile, []byte(
+		`{"seq":1,"type":"rest","method":"GET","path":"/contracts/c1/get","status":200,"response":"{\"headers\":{\"id\":\"old-id\"},\"output\":\"1\"}"}`+"\n"+
+			`{"seq":2,"type":"rpc","method":"eth_call","params":[],"result":"0x01"}`+"\n"), 0644)
+	rootCmd.SetArgs([]string{"replay", "-f", matchFile, "-u", server.URL, "-H", "Authorization: Bearer token1"})
+	assert.Equal(0, Execute())
+
+	mismatchFile := path.Join(dir, "mismatch.jsonl")
+	ioutil.WriteFile(mismatchFile, []byte(
+		`{"seq":1,"type":"rest","method":"GET","path":"/contracts/c1/get","status":200,"response":"{\"output\":\"2\"}"}`+"\n"), 0644)
+	rootCmd.SetArgs([]string{"replay", "-f", mismatchFile, "-u", server.URL})
+	assert.Equal(1, Execute())
+	rootCmd.SetArgs([]string{"replay", "--ignore", "output", "-f", mismatchFile, "-u", server.URL})
+	assert.Equal(0, Execute())
+
+	rootCmd.SetArgs([]string{"replay", "-f", path.Join(dir, "missing.jsonl"), "-u", server.URL})
+	assert.Equal(1, Execute())
+	rootCmd.SetArgs([]string{"replay", "-f", matchFile, "-u", "http://localhost:0"})
+	assert.Equal(1, Execute())
+	rootCmd.SetArgs([]string{"replay", "-f", matchFile, "-u", server.URL, "-H", "no-colon"})
+	assert.Equal(1, Execute())
+}
+
+func TestRecordFileFlag(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "recordflag")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	defer func() { rootConfig.RecordFile = "" }()
+
+	rootCmd.SetArgs([]string{"replay", "--record-file", path.Join(dir, "missing", "recording.jsonl"), "-f", "any"})
+	assert.Equal(1, Execute())
+}
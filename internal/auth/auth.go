@@ -36,6 +36,12 @@ func RegisterSecurityModule(sm plugins.SecurityModule) {
 	securityModule = sm
 }
 
+// SecurityModuleEnabled returns true if a security module is registered, so requests
+// must carry an access token
+func SecurityModuleEnabled() bool {
+	return securityModule != nil
+}
+
 // NewSystemAuthContext creates a system background context
 func NewSystemAuthContext() context.Context {
 	return context.WithValue(context.Background(), ContextKeySystemAuth, true)
@@ -134,3 +140,34 @@ func AuthReadAsyncReplyByUUID(ctx context.Context) error {
 	}
 	return nil
 }
+
+// AuthReloadConfig authorize a reload of the configuration of the security module
+func AuthReloadConfig(ctx context.Context) error {
+	if securityModule != nil && !IsSystemContext(ctx) {
+		authCtx := GetAuthContext(ctx)
+		if authCtx == nil {
+			return errors.Errorf(errors.SecurityModuleNoAuthContext)
+		}
+		if reloadable, ok := securityModule.(plugins.ReloadableSecurityModule); ok {
+			return reloadable.AuthReloadConfig(authCtx)
+		}
+	}
+	return nil
+}
+
+// ReloadSecurityModule asks the security module to refresh its configuration. Access tokens
+// verified after the reload, including the periodic revalidation of WebSocket connections,
+// are checked against the new configuration
+func ReloadSecurityModule() error {
+	if securityModule == nil {
+		return errors.Errorf(errors.SecurityModuleNotRegistered)
+	}
+	reloadable, ok := securityModule.(plugins.ReloadableSecurityModule)
+	if !ok {
+		return errors.Errorf(errors.SecurityModuleNotReloadable)
+	}
+	if err := reloadable.ReloadConfig(); err != nil {
+		return errors.Errorf(errors.SecurityModuleReloadFailed, err)
+	}
+	return nil
+}
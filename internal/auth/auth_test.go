@@ -16,6 +16,7 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
@@ -147,3 +148,42 @@ func TestAuthReadAsyncReplyByUUID(t *testing.T) {
 	RegisterSecurityModule(nil)
 
 }
+
+func TestAuthReloadConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(AuthReloadConfig(context.Background()))
+
+	RegisterSecurityModule(&authtest.TestReloadableSecurityModule{})
+
+	assert.EqualError(AuthReloadConfig(context.Background()), "No auth context")
+
+	assert.NoError(AuthReloadConfig(NewSystemAuthContext()))
+
+	ctx, _ := WithAuthContext(context.Background(), "testat")
+	assert.NoError(AuthReloadConfig(ctx))
+
+	RegisterSecurityModule(nil)
+
+}
+
+func TestReloadSecurityModule(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.EqualError(ReloadSecurityModule(), "No security module is registered")
+
+	RegisterSecurityModule(&authtest.TestSecurityModule{})
+	assert.EqualError(ReloadSecurityModule(), "The security module does not support reloading its configuration")
+
+	sm := &authtest.TestReloadableSecurityModule{}
+	RegisterSecurityModule(sm)
+	assert.NoError(ReloadSecurityModule())
+	assert.Equal(1, sm.Reloads)
+
+	sm.ReloadErr = fmt.Errorf("pop")
+	assert.EqualError(ReloadSecurityModule(), "Failed to reload the security module configuration: pop")
+	assert.Equal(1, sm.Reloads)
+
+	RegisterSecurityModule(nil)
+
+}
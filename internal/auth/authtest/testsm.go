@@ -77,3 +77,28 @@ func (sm *TestSecurityModule) AuthReadAsyncReplyByUUID(authCtx interface{}) erro
 	}
 	return fmt.Errorf("badness")
 }
+
+// TestReloadableSecurityModule designed for unit testing - counts reloads of its configuration
+type TestReloadableSecurityModule struct {
+	TestSecurityModule
+	Reloads   int
+	ReloadErr error
+}
+
+// AuthReloadConfig of TEST MODULE returns true if there is an auth context
+func (sm *TestReloadableSecurityModule) AuthReloadConfig(authCtx interface{}) error {
+	switch authCtx.(type) {
+	case string:
+		return nil
+	}
+	return fmt.Errorf("badness")
+}
+
+// ReloadConfig of TEST MODULE counts the reload, or returns the configured error
+func (sm *TestReloadableSecurityModule) ReloadConfig() error {
+	if sm.ReloadErr != nil {
+		return sm.ReloadErr
+	}
+	sm.Reloads++
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// ChaosConf configures fault injection, so the consumers of ethconnect can be tested against
+// the at-least-once delivery and retry behaviour they will see in production. It is for test
+// environments only. Each rate is the percentage of calls or deliveries that are affected
+type ChaosConf struct {
+	MaxDelayMS            int   `json:"maxDelayMS,omitempty"`
+	WebhookDropPercent    int   `json:"webhookDropPercent,omitempty"`
+	DuplicateEventPercent int   `json:"duplicateEventPercent,omitempty"`
+	RPCErrorPercent       int   `json:"rpcErrorPercent,omitempty"`
+	Seed                  int64 `json:"seed,omitempty"`
+}
+
+// IsSet returns true if the configuration injects any faults
+func (c *ChaosConf) IsSet() bool {
+	return c.MaxDelayMS > 0 || c.WebhookDropPercent > 0 || c.DuplicateEventPercent > 0 || c.RPCErrorPercent > 0
+}
+
+type chaos struct {
+	conf ChaosConf
+	mux  sync.Mutex
+	rand *rand.Rand
+}
+
+// active is the fault injection for the process, shared by every gateway, bridge and stream
+var active struct {
+	sync.RWMutex
+	c *chaos
+}
+
+// Start starts injecting faults as configured, replacing any configuration already applied.
+// A seed gives the same sequence of faults on each run
+func Start(conf *ChaosConf) error {
+	for name, percent := range map[string]int{
+		"webhookDropPercent":    conf.WebhookDropPercent,
+		"duplicateEventPercent": conf.DuplicateEventPercent,
+		"rpcErrorPercent":       conf.RPCErrorPercent,
+	} {
+		if percent < 0 || percent > 100 {
+			return errors.Errorf(errors.ChaosInvalidPercent, name, percent)
+		}
+	}
+	seed := conf.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	active.Lock()
+	defer active.Unlock()
+	active.c = &chaos{conf: *conf, rand: rand.New(rand.NewSource(seed))}
+	log.Warnf("CHAOS MODE ENABLED - injecting faults for testing. Never use in production: maxDelayMS=%d webhookDropPercent=%d duplicateEventPercent=%d rpcErrorPercent=%d seed=%d",
+		conf.MaxDelayMS, conf.WebhookDropPercent, conf.DuplicateEventPercent, conf.RPCErrorPercent, seed)
+	return nil
+}
+
+// Stop stops injecting faults
+func Stop() {
+	active.Lock()
+	defer active.Unlock()
+	active.c = nil
+}
+
+// Enabled returns true if faults are being injected
+func Enabled() bool {
+	active.RLock()
+	defer active.RUnlock()
+	return active.c != nil
+}
+
+func current() *chaos {
+	active.RLock()
+	defer active.RUnlock()
+	return active.c
+}
+
+// roll returns true for the configured percentage of calls
+func (c *chaos) roll(percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.rand.Intn(100) < percent
+}
+
+// Delay sleeps for a random time up to the configured maximum
+func Delay() {
+	c := current()
+	if c == nil || c.conf.MaxDelayMS <= 0 {
+		return
+	}
+	c.mux.Lock()
+	delay := time.Duration(c.rand.Intn(c.conf.MaxDelayMS+1)) * time.Millisecond
+	c.mux.Unlock()
+	time.Sleep(delay)
+}
+
+// RPCError returns a transient error for the configured percentage of JSON/RPC calls, after
+// any delay. The error is treated like a dropped connection, so read-only calls are retried
+func RPCError(method string) error {
+	c := current()
+	if c == nil {
+		return nil
+	}
+	Delay()
+	if c.roll(c.conf.RPCErrorPercent) {
+		log.Warnf("Chaos: failing JSON/RPC call %s", method)
+		return errors.Errorf(errors.ChaosRPCError, method)
+	}
+	return nil
+}
+
+// DropWebhook returns an error for the configured percentage of webhook deliveries, which
+// are then not sent, so the stream handles the failure like a receiver that is down
+func DropWebhook(url string) error {
+	c := current()
+	if c == nil || !c.roll(c.conf.WebhookDropPercent) {
+		return nil
+	}
+	log.Warnf("Chaos: dropping webhook delivery to %s", url)
+	return errors.Errorf(errors.ChaosWebhookDropped, url)
+}
+
+// DuplicateEvents returns true for the configured percentage of event batches, which are
+// then delivered a second time
+func DuplicateEvents() bool {
+	c := current()
+	return c != nil && c.roll(c.conf.DuplicateEventPercent)
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisabledByDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(Enabled())
+	assert.NoError(RPCError("eth_call"))
+	assert.NoError(DropWebhook("http://example.com"))
+	assert.False(DuplicateEvents())
+	Delay()
+}
+
+func TestAlwaysInject(t *testing.T) {
+	assert := assert.New(t)
+
+	err := Start(&ChaosConf{
+		WebhookDropPercent:    100,
+		DuplicateEventPercent: 100,
+		RPCErrorPercent:       100,
+	})
+	assert.NoError(err)
+	defer Stop()
+	assert.True(Enabled())
+
+	assert.EqualError(RPCError("eth_call"), "Injected JSON/RPC failure calling eth_call (chaos mode): connection reset by peer")
+	assert.EqualError(DropWebhook("http://example.com"), "Dropped webhook delivery to http://example.com (chaos mode)")
+	assert.True(DuplicateEvents())
+}
+
+func TestNeverInjectAtZeroPercent(t *testing.T) {
+	assert := assert.New(t)
+
+	err := Start(&ChaosConf{MaxDelayMS: 1})
+	assert.NoError(err)
+	defer Stop()
+
+	for i := 0; i < 100; i++ {
+		assert.NoError(RPCError("eth_call"))
+		assert.NoError(DropWebhook("http://example.com"))
+		assert.False(DuplicateEvents())
+	}
+}
+
+func TestSeedRepeatsFaults(t *testing.T) {
+	assert := assert.New(t)
+
+	sequence := func() []bool {
+		Start(&ChaosConf{DuplicateEventPercent: 50, Seed: 12345})
+		defer Stop()
+		results := make([]bool, 50)
+		for i := range results {
+			results[i] = DuplicateEvents()
+		}
+		return results
+	}
+	first := sequence()
+	assert.Equal(first, sequence())
+	assert.Contains(first, true)
+	assert.Contains(first, false)
+}
+
+func TestDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	Start(&ChaosConf{MaxDelayMS: 20, Seed: 1})
+	defer Stop()
+
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		Delay()
+	}
+	assert.True(time.Since(started) < 200*time.Millisecond)
+}
+
+func TestInvalidPercent(t *testing.T) {
+	assert := assert.New(t)
+
+	err := Start(&ChaosConf{RPCErrorPercent: 101})
+	assert.EqualError(err, "Invalid chaos mode rpcErrorPercent '101'. Must be a percentage between 0 and 100")
+	err = Start(&ChaosConf{WebhookDropPercent: -1})
+	assert.Regexp("webhookDropPercent", err)
+	assert.False(Enabled())
+}
+
+func TestIsSet(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False((&ChaosConf{Seed: 1}).IsSet())
+	assert.True((&ChaosConf{MaxDelayMS: 1}).IsSet())
+	assert.True((&ChaosConf{RPCErrorPercent: 1}).IsSet())
+}
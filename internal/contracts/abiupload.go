@@ -0,0 +1,120 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// abiUpload is a JSON body for POST /abis, for contracts compiled outside of the gateway. The
+// fields match those of the artifacts written by Truffle and Hardhat, so an artifact can be
+// posted as-is. Only the ABI is required - without bytecode the ABI cannot be deployed, but
+// can be registered against existing contracts
+type abiUpload struct {
+	ContractName     string                   `json:"contractName,omitempty"`
+	ABI              ethbinding.ABIMarshaling `json:"abi"`
+	Bytecode         string                   `json:"bytecode,omitempty"`
+	DeployedBytecode string                   `json:"deployedBytecode,omitempty"`
+	DevDoc           json.RawMessage          `json:"devdoc,omitempty"`
+	UserDoc          json.RawMessage          `json:"userdoc,omitempty"`
+	CompilerVersion  string                   `json:"compilerVersion,omitempty"`
+}
+
+// isJSONUpload checks whether a POST /abis is a JSON ABI upload, rather than a multipart form
+func isJSONUpload(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return strings.ToLower(mediaType) == "application/json"
+}
+
+// decodeUploadBytecode decodes the hex bytecode of an upload. An empty string, or just the
+// 0x prefix as output for interfaces and abstract contracts, returns nil
+func decodeUploadBytecode(field, s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	if s == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayABIUploadBadBytecode, field, err)
+	}
+	return b, nil
+}
+
+// uploadDocString returns the JSON of a NatSpec doc in an upload, or an empty string if there is none
+func uploadDocString(doc json.RawMessage) string {
+	if len(doc) == 0 || string(doc) == "null" {
+		return ""
+	}
+	return string(doc)
+}
+
+// addABIFromJSON stores an ABI and optional bytecode that were compiled elsewhere, without
+// compiling any Solidity. The OpenAPI is generated in the same way as for uploaded Solidity
+func (g *smartContractGW) addABIFromJSON(res http.ResponseWriter, req *http.Request) {
+	var upload abiUpload
+	if err := json.NewDecoder(req.Body).Decode(&upload); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayABIUploadInvalid, err), 400)
+		return
+	}
+	if len(upload.ABI) == 0 {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreMissingABI), 400)
+		return
+	}
+	if _, err := eth.RuntimeABI(upload.ABI); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidABI, err), 400)
+		return
+	}
+
+	msg := &messages.DeployContract{
+		ABI:             upload.ABI,
+		ContractName:    upload.ContractName,
+		CompilerVersion: upload.CompilerVersion,
+		DevDoc:          uploadDocString(upload.DevDoc),
+		UserDoc:         uploadDocString(upload.UserDoc),
+	}
+	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.Headers.ID = utils.UUIDv4()
+	var err error
+	if msg.Compiled, err = decodeUploadBytecode("bytecode", upload.Bytecode); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	if msg.CompiledRuntime, err = decodeUploadBytecode("deployedBytecode", upload.DeployedBytecode); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	info, err := g.storeDeployableABI(msg, nil)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	json.NewEncoder(res).Encode(info)
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestABIUploadRouter(t *testing.T, dir string) *httprouter.Router {
+	scgw, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.NoError(t, err)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	return router
+}
+
+func postTestABIUpload(router *httprouter.Router, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/abis", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	return res, reply
+}
+
+func TestAddABIFromJSONArtifact(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	router := newTestABIUploadRouter(t, dir)
+
+	b, _ := ioutil.ReadFile(path.Join("..", "..", "test", "simpleevents.solc.output.json"))
+	var contract SolcJson
+	json.Unmarshal(b, &contract)
+	artifact, _ := json.Marshal(map[string]interface{}{
+		"contractName":     "SimpleEvents",
+		"abi":              json.RawMessage(contract.ABI),
+		"bytecode":         "0x" + contract.Bin,
+		"deployedBytecode": "0x",
+		"devdoc":           map[string]interface{}{"details": "Stores values"},
+		"userdoc":          map[string]interface{}{"notice": "Simple storage with events"},
+	})
+
+	res, info := postTestABIUpload(router, string(artifact))
+	assert.Equal(200, res.Code)
+	assert.Equal("SimpleEvents", info["name"])
+	assert.Equal("Simple storage with events\n\nStores values", info["description"])
+	assert.Equal(true, info["deployable"])
+
+	req := httptest.NewRequest("GET", "/abis/"+info["id"].(string)+"?swagger", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var swagger map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&swagger)
+	assert.Contains(swagger["paths"], "/{address}/set")
+}
+
+func TestAddABIFromJSONNoBytecode(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	router := newTestABIUploadRouter(t, dir)
+
+	res, info := postTestABIUpload(router, `{"abi":[{"type":"function","name":"get","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}]}`)
+	assert.Equal(200, res.Code)
+	assert.Equal(false, info["deployable"])
+}
+
+func TestAddABIMultipartNoBytecode(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	router := newTestABIUploadRouter(t, dir)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("abi", `[{"type":"function","name":"get","inputs":[],"outputs":[{"name":"","type":"uint256"}],"stateMutability":"view"}]`)
+	writer.WriteField("contract", "Getter")
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Code)
+	var info map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&info)
+	assert.Equal("Getter", info["name"])
+	assert.Equal(false, info["deployable"])
+}
+
+func TestAddABIFromJSONErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	router := newTestABIUploadRouter(t, dir)
+
+	res, reply := postTestABIUpload(router, `!json`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid ABI upload", reply["error"])
+
+	res, reply = postTestABIUpload(router, `{"contractName":"NoABI"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Must supply ABI", reply["error"])
+
+	res, reply = postTestABIUpload(router, `{"abi":[{"type":"function","name":"get","inputs":[{"name":"a","type":"badtype"}]}]}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid ABI", reply["error"])
+
+	res, reply = postTestABIUpload(router, `{"abi":[{"type":"function","name":"get","inputs":[]}],"bytecode":"0x__$lib$__"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid hex in 'bytecode' of ABI upload", reply["error"])
+
+	res, reply = postTestABIUpload(router, `{"abi":[{"type":"function","name":"get","inputs":[]}],"deployedBytecode":"0xZZ"}`)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid hex in 'deployedBytecode' of ABI upload", reply["error"])
+}
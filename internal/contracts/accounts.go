@@ -0,0 +1,118 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+)
+
+// accountInfo is an address or HD wallet reference that can be used as the from address
+// of a request. Managed accounts are those the node can sign for, and the others are the
+// targets of signer aliases. The balance is in wei, and is not available for HD wallets.
+// A failed balance lookup is reported on the account, rather than failing the whole list
+type accountInfo struct {
+	From         string   `json:"from"`
+	Managed      bool     `json:"managed"`
+	Aliases      []string `json:"aliases,omitempty"`
+	Balance      string   `json:"balance,omitempty"`
+	BalanceError string   `json:"balanceError,omitempty"`
+}
+
+// maxBalanceLookups is the number of balances looked up in parallel for an account listing
+const maxBalanceLookups = 10
+
+// listAccounts lists the accounts managed by the node, followed by those only reachable
+// through a signer alias. Balances are looked up in parallel unless fly-balance=false is set
+func (g *smartContractGW) listAccounts(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.rpc == nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayAccountsUnavailable), 500)
+		return
+	}
+	nodeAccounts, err := eth.GetAccounts(req.Context(), g.rpc)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	accounts := make([]*accountInfo, 0, len(nodeAccounts))
+	byFrom := make(map[string]*accountInfo)
+	for _, addr := range nodeAccounts {
+		addrHexNo0x, ok := normalizeAddress(addr)
+		if !ok {
+			log.Warnf("Ignoring invalid address '%s' returned by eth_accounts", addr)
+			continue
+		}
+		from := "0x" + addrHexNo0x
+		if _, exists := byFrom[from]; !exists {
+			byFrom[from] = &accountInfo{From: from, Managed: true}
+			accounts = append(accounts, byFrom[from])
+		}
+	}
+
+	aliasOnly := []*accountInfo{}
+	g.idxLock.Lock()
+	for _, alias := range g.signerAliases {
+		account, exists := byFrom[alias.From]
+		if !exists {
+			account = &accountInfo{From: alias.From}
+			byFrom[alias.From] = account
+			aliasOnly = append(aliasOnly, account)
+		}
+		account.Aliases = append(account.Aliases, alias.Alias)
+	}
+	g.idxLock.Unlock()
+	sort.Slice(aliasOnly, func(i, j int) bool { return aliasOnly[i].From < aliasOnly[j].From })
+	accounts = append(accounts, aliasOnly...)
+
+	fetchBalances := strings.ToLower(getFlyParam("balance", req, true)) != "false"
+	var wg sync.WaitGroup
+	slots := make(chan bool, maxBalanceLookups)
+	for _, account := range accounts {
+		sort.Strings(account.Aliases)
+		if _, isAddress := normalizeAddress(account.From); !isAddress || !fetchBalances {
+			continue
+		}
+		wg.Add(1)
+		slots <- true
+		go func(account *accountInfo) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			addr := ethbind.API.HexToAddress(account.From)
+			balance, err := eth.GetBalance(req.Context(), g.rpc, &addr, "latest")
+			if err != nil {
+				log.Warnf("Failed to get the balance of %s: %s", account.From, err)
+				account.BalanceError = err.Error()
+				return
+			}
+			account.Balance = balance.String()
+		}(account)
+	}
+	wg.Wait()
+
+	g.signerAliasReply(res, req, accounts, 200)
+}
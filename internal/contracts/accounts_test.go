@@ -0,0 +1,223 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAccountsRPC struct {
+	mux         sync.Mutex
+	accounts    []string
+	accountsErr error
+	balanceErr  error
+	balanceOf   map[string]int64
+	balances    []string
+}
+
+func (m *mockAccountsRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_accounts":
+		if m.accountsErr != nil {
+			return m.accountsErr
+		}
+		*(result.(*[]string)) = m.accounts
+	case "eth_getBalance":
+		addr := args[0].(*ethbinding.Address)
+		m.mux.Lock()
+		m.balances = append(m.balances, addr.Hex())
+		m.mux.Unlock()
+		balance, exists := m.balanceOf[strings.ToLower(addr.Hex())]
+		if m.balanceErr != nil || !exists {
+			return m.balanceErr
+		}
+		*(result.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*big.NewInt(balance))
+	default:
+		return fmt.Errorf("unexpected call %s", method)
+	}
+	return nil
+}
+
+func TestListAccounts(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	rpc := &mockAccountsRPC{
+		accounts: []string{
+			"0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C",
+			"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c",
+			"not an address",
+			"0x2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+		},
+		balanceOf: map[string]int64{
+			"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c": 1000,
+			"0x2b8c0ecc76d0759a8f50b2e14a6881367d805832": 2000,
+			"0x0123456789abcdef0123456789abcdef01234567": 3000,
+		},
+	}
+	scgw.rpc = rpc
+
+	for _, body := range []string{
+		`{"alias":"alice","from":"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c"}`,
+		`{"alias":"admin","from":"0xD50CE736021D9F7B0B2566A3D2FA7FA3136C003C"}`,
+		`{"alias":"bob","from":"0x0123456789abcdef0123456789abcdef01234567"}`,
+		`{"alias":"carol","from":"hd-wallet1-path1-3"}`,
+	} {
+		res := testSignerAliasPath(router, "POST", "/signers", body, nil)
+		assert.Equal(200, res.Code)
+	}
+
+	var accounts []*accountInfo
+	res := testSignerAliasPath(router, "GET", "/accounts", "", &accounts)
+	assert.Equal(200, res.Code)
+	assert.Equal([]*accountInfo{
+		{From: "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", Managed: true, Aliases: []string{"admin", "alice"}, Balance: "1000"},
+		{From: "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", Managed: true, Balance: "2000"},
+		{From: "0x0123456789abcdef0123456789abcdef01234567", Aliases: []string{"bob"}, Balance: "3000"},
+		{From: "hd-wallet1-path1-3", Aliases: []string{"carol"}},
+	}, accounts)
+	assert.Len(rpc.balances, 3)
+}
+
+func TestListAccountsNoBalances(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	rpc := &mockAccountsRPC{
+		accounts:   []string{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c"},
+		balanceErr: fmt.Errorf("pop"),
+	}
+	scgw.rpc = rpc
+
+	var accounts []*accountInfo
+	res := testSignerAliasPath(router, "GET", "/accounts?fly-balance=false", "", &accounts)
+	assert.Equal(200, res.Code)
+	assert.Equal([]*accountInfo{
+		{From: "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", Managed: true},
+	}, accounts)
+	assert.Empty(rpc.balances)
+}
+
+func TestListAccountsNoneManaged(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	scgw.rpc = &mockAccountsRPC{}
+
+	req := httptest.NewRequest("GET", "/accounts", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.JSONEq("[]", res.Body.String())
+}
+
+func TestListAccountsNoRPC(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestSignerAliasGW(dir)
+
+	var resBody map[string]interface{}
+	res := testSignerAliasPath(router, "GET", "/accounts", "", &resBody)
+	assert.Equal(500, res.Code)
+	assert.Equal("Account listing is not available without a JSON/RPC connection", resBody["error"])
+}
+
+func TestListAccountsRPCFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	scgw.rpc = &mockAccountsRPC{accountsErr: fmt.Errorf("pop")}
+
+	var resBody map[string]interface{}
+	res := testSignerAliasPath(router, "GET", "/accounts", "", &resBody)
+	assert.Equal(500, res.Code)
+	assert.Equal("eth_accounts returned: pop", resBody["error"])
+}
+
+func TestListAccountsBalanceFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	scgw.rpc = &mockAccountsRPC{
+		accounts: []string{
+			"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c",
+			"0x2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+		},
+		balanceErr: fmt.Errorf("pop"),
+	}
+
+	var accounts []*accountInfo
+	res := testSignerAliasPath(router, "GET", "/accounts", "", &accounts)
+	assert.Equal(200, res.Code)
+	assert.Equal([]*accountInfo{
+		{From: "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", Managed: true, BalanceError: "eth_getBalance returned: pop"},
+		{From: "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", Managed: true, BalanceError: "eth_getBalance returned: pop"},
+	}, accounts)
+}
+
+func TestListAccountsManyBalances(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	rpc := &mockAccountsRPC{balanceOf: map[string]int64{}}
+	for i := 0; i < maxBalanceLookups*3; i++ {
+		addr := fmt.Sprintf("0x%040x", i+1)
+		rpc.accounts = append(rpc.accounts, addr)
+		rpc.balanceOf[addr] = int64(i + 1)
+	}
+	scgw.rpc = rpc
+
+	var accounts []*accountInfo
+	res := testSignerAliasPath(router, "GET", "/accounts", "", &accounts)
+	assert.Equal(200, res.Code)
+	assert.Len(accounts, maxBalanceLookups*3)
+	for i, account := range accounts {
+		assert.Equal(rpc.accounts[i], account.From)
+		assert.Equal(fmt.Sprintf("%d", i+1), account.Balance)
+	}
+	assert.Len(rpc.balances, maxBalanceLookups*3)
+}
+
+func TestListAccountsRequiresAuth(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+	scgw.rpc = &mockAccountsRPC{}
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	res := testSignerAliasPath(router, "GET", "/accounts", "", nil)
+	assert.Equal(401, res.Code)
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxBulkCallAddresses   = 1000
+	bulkCallBatchSize      = 100
+	bulkCallResultErrorKey = "error"
+)
+
+// bulkCallRequest is the body of a POST to /bulk/:method
+type bulkCallRequest struct {
+	Addresses []string               `json:"addresses"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+}
+
+// bulkCallTarget is a single contract instance resolved from the list of addresses
+type bulkCallTarget struct {
+	key       string
+	addr      string
+	abiMethod *ethbinding.ABIMethod
+	msgParams []interface{}
+	err       error
+}
+
+// bulkCallHandler invokes the same view method against many registered contract instances,
+// returning a map of each supplied address (or registered name) to its decoded result.
+// The calls are sent to the node in JSON/RPC batches, and a failure on one instance is
+// reported against that instance without failing the whole request.
+func (r *rest2eth) bulkCallHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	batchRPC, ok := r.rpc.(eth.RPCClientBatch)
+	if !ok {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RPCBatchUnsupported), 500)
+		return
+	}
+
+	methodName := params.ByName("method")
+	var body bulkCallRequest
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBulkCallBadRequest, err), 400)
+		return
+	}
+	if len(body.Addresses) == 0 {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBulkCallNoAddresses), 400)
+		return
+	}
+	if len(body.Addresses) > maxBulkCallAddresses {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBulkCallTooManyAddresses, len(body.Addresses), maxBulkCallAddresses), 400)
+		return
+	}
+
+	from, err := r.resolveFrom(getFlyParam("from", req, false))
+	if err != nil {
+		r.restErrReply(res, req, err, 404)
+		return
+	}
+	if from, err = r.processor.ResolveAddress(from); err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+
+	rpcTimeout, err := r.rpcTimeout(req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if rpcTimeout > 0 {
+		req = req.WithContext(eth.WithRPCTimeout(req.Context(), rpcTimeout))
+	}
+	numbers, err := numberFormat(req, nil)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+
+	// Resolve all the targets up front, as the lookups hit the local filesystem
+	targets := make([]*bulkCallTarget, len(body.Addresses))
+	for i, addrParam := range body.Addresses {
+		targets[i] = r.resolveBulkCallTarget(addrParam, methodName, body.Params)
+	}
+
+	rpc, release, err := r.readRPC(req.Context())
+	if err != nil {
+		r.restErrReply(res, req, err, 503)
+		return
+	}
+	defer release()
+	if poolBatchRPC, ok := rpc.(eth.RPCClientBatch); ok {
+		batchRPC = poolBatchRPC
+	}
+
+	blocknumber, err := eth.BlockNumberForCall(req.Context(), rpc, getFlyParam("blocknumber", req, false))
+	if err != nil {
+		r.restErrReply(res, req, err, callBlockErrStatus(err))
+		return
+	}
+	value := json.Number(getFlyParam("ethvalue", req, false))
+	results := make(map[string]interface{}, len(targets))
+	calls := make([]*eth.MethodCall, 0, len(targets))
+	callKeys := make([]string, 0, len(targets))
+	for _, target := range targets {
+		if target.err != nil {
+			results[target.key] = map[string]interface{}{bulkCallResultErrorKey: target.err.Error()}
+			continue
+		}
+		calls = append(calls, &eth.MethodCall{
+			Addr:      target.addr,
+			MethodABI: target.abiMethod,
+			Params:    target.msgParams,
+		})
+		callKeys = append(callKeys, target.key)
+	}
+	for start := 0; start < len(calls); start += bulkCallBatchSize {
+		end := start + bulkCallBatchSize
+		if end > len(calls) {
+			end = len(calls)
+		}
+		batchErr := eth.CallMethods(req.Context(), batchRPC, from, value, calls[start:end], blocknumber, r.strictAddrs)
+		for i, call := range calls[start:end] {
+			err := batchErr
+			if call.Err != nil {
+				err = call.Err
+			}
+			if err != nil {
+				log.Warnf("Bulk call of '%s' on %s failed: %s", methodName, call.Addr, err)
+				results[callKeys[start+i]] = map[string]interface{}{bulkCallResultErrorKey: err.Error()}
+			} else {
+				eth.FormatNumbers(call.MethodABI.Outputs, call.Result, numbers)
+				results[callKeys[start+i]] = call.Result
+			}
+		}
+	}
+
+	resBytes, _ := json.MarshalIndent(&results, "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
+
+// resolveBulkCallTarget looks up the ABI registered for an individual contract address
+// or friendly name, and builds the parameters for the method from the shared inputs
+func (r *rest2eth) resolveBulkCallTarget(addrParam, methodName string, inputs map[string]interface{}) (target *bulkCallTarget) {
+	target = &bulkCallTarget{key: addrParam}
+	addr, ok := normalizeAddress(addrParam)
+	if !ok {
+		if addr, target.err = r.gw.resolveContractAddr(addrParam); target.err != nil {
+			return
+		}
+	}
+	target.addr = "0x" + addr
+
+	deployMsg, _, err := r.gw.loadDeployMsgForInstance(addr)
+	if err != nil {
+		target.err = err
+		return
+	}
+	for _, element := range deployMsg.ABI {
+		if element.Type == "function" && element.Name == methodName {
+			if target.abiMethod, err = eth.ABIMethodFor(&element); err != nil {
+				target.err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodABIInvalid, methodName, err)
+				return
+			}
+			break
+		}
+	}
+	if target.abiMethod == nil {
+		target.err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodNotDeclared, url.QueryEscape(methodName), target.addr)
+		return
+	}
+	if target.err = r.gw.methodFilterFor(addr).check(methodName, target.addr); target.err != nil {
+		return
+	}
+	if !target.abiMethod.IsConstant() {
+		target.err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBulkCallNotView, methodName)
+		return
+	}
+
+	target.msgParams = make([]interface{}, len(target.abiMethod.Inputs))
+	for i, abiParam := range target.abiMethod.Inputs {
+		argName := abiInputName(i, abiParam)
+		v, exists := inputs[argName]
+		if !exists {
+			target.err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMissingParameter, argName, methodName)
+			return
+		}
+		target.msgParams[i] = v
+	}
+	return
+}
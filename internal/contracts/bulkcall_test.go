@@ -0,0 +1,344 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockBulkRPC struct {
+	calls      int
+	batches    int
+	result     string
+	failMethod string
+	batchErr   error
+}
+
+func (m *mockBulkRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return fmt.Errorf("unexpected individual call")
+}
+
+func (m *mockBulkRPC) BatchCallContext(ctx context.Context, b []eth.RPCBatchElem) error {
+	m.batches++
+	if m.batchErr != nil {
+		return m.batchErr
+	}
+	for i := range b {
+		m.calls++
+		if b[i].Method == m.failMethod {
+			b[i].Error = fmt.Errorf("pop")
+			continue
+		}
+		reflect.ValueOf(b[i].Result).Elem().Set(reflect.ValueOf(m.result))
+	}
+	return nil
+}
+
+func newTestBulkCallABILoader() *mockABILoader {
+	return &mockABILoader{
+		deployMsg: &messages.DeployContract{
+			ABI: ethbinding.ABIMarshaling{
+				{
+					Type:            "function",
+					Name:            "balanceOf",
+					StateMutability: "view",
+					Constant:        true,
+					Inputs: []ethbinding.ABIArgumentMarshaling{
+						{Name: "owner", Type: "address"},
+					},
+					Outputs: []ethbinding.ABIArgumentMarshaling{
+						{Name: "balance", Type: "uint256"},
+					},
+				},
+				{
+					Type:            "function",
+					Name:            "transfer",
+					StateMutability: "nonpayable",
+					Inputs: []ethbinding.ABIArgumentMarshaling{
+						{Name: "to", Type: "address"},
+					},
+				},
+			},
+		},
+		registeredContractAddr: "2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+	}
+}
+
+func newTestBulkCall(t *testing.T, rpc eth.RPCClient, abiLoader *mockABILoader, path string, body interface{}) *httptest.ResponseRecorder {
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	r.rpc = rpc
+	bodyBytes, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestBulkCall(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &mockBulkRPC{
+		result: "0x000000000000000000000000000000000000000000000000000000000001e240",
+	}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{
+			"0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+			"0x0123456789abcdef0123456789abcdef01234567",
+			"myToken",
+		},
+		"params": map[string]interface{}{
+			"owner": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c",
+		},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(3, rpc.calls)
+	assert.Equal(1, rpc.batches)
+	assert.Len(reply, 3)
+	assert.Equal("123456", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["balance"])
+	assert.Equal("123456", reply["0x0123456789abcdef0123456789abcdef01234567"]["balance"])
+	assert.Equal("123456", reply["myToken"]["balance"])
+}
+
+func TestBulkCallPartialFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.resolveContractErr = fmt.Errorf("not found")
+	rpc := &mockBulkRPC{
+		result: "0x000000000000000000000000000000000000000000000000000000000001e240",
+	}
+	res := newTestBulkCall(t, rpc, abiLoader, "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{
+			"0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+			"unknown",
+		},
+		"params": map[string]interface{}{
+			"owner": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c",
+		},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(1, rpc.calls)
+	assert.Equal("123456", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["balance"])
+	assert.Equal("not found", reply["unknown"]["error"])
+}
+
+func TestBulkCallRPCFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &mockBulkRPC{failMethod: "eth_call"}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+		"params":    map[string]interface{}{"owner": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("pop", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+}
+
+func TestBulkCallMissingParam(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &mockBulkRPC{}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(0, rpc.calls)
+	assert.Regexp("Parameter 'owner' of method 'balanceOf' was not specified", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+}
+
+func TestBulkCallNotView(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &mockBulkRPC{}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/transfer", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+		"params":    map[string]interface{}{"to": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(0, rpc.calls)
+	assert.Regexp("Method 'transfer' is not a view or pure function", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+}
+
+func TestBulkCallMethodNotDeclared(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &mockBulkRPC{}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/missing", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("Method or Event 'missing' is not declared", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+}
+
+func TestBulkCallLoadABIFail(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.loadABIError = fmt.Errorf("pop")
+	res := newTestBulkCall(t, &mockBulkRPC{}, abiLoader, "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal("pop", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+}
+
+func TestBulkCallBadBody(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestBulkCall(t, &mockBulkRPC{}, newTestBulkCallABILoader(), "/bulk/balanceOf", "not an object")
+
+	assert.Equal(400, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("Invalid bulk call request", reply.Message)
+}
+
+func TestBulkCallNoAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestBulkCall(t, &mockBulkRPC{}, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{})
+
+	assert.Equal(400, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("Must supply at least one contract address", reply.Message)
+}
+
+func TestBulkCallTooManyAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	addresses := make([]string, maxBulkCallAddresses+1)
+	for i := range addresses {
+		addresses[i] = "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	}
+	res := newTestBulkCall(t, &mockBulkRPC{}, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": addresses,
+	})
+
+	assert.Equal(400, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("Too many addresses in bulk call request", reply.Message)
+}
+
+func TestBulkCallBadFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestBulkCall(t, &mockBulkRPC{}, newTestBulkCallABILoader(), "/bulk/balanceOf?fly-from=bad", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+	})
+
+	assert.Equal(404, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.True(strings.HasPrefix(reply.Message, "From Address must be"))
+}
+
+func TestBulkCallBadRPCTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestBulkCall(t, &mockBulkRPC{}, newTestBulkCallABILoader(), "/bulk/balanceOf?fly-rpctimeout=-1", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+	})
+
+	assert.Equal(400, res.Result().StatusCode)
+}
+
+func TestBulkCallMultipleBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	addresses := make([]string, bulkCallBatchSize+1)
+	for i := range addresses {
+		addresses[i] = fmt.Sprintf("0x%040x", i+1)
+	}
+	rpc := &mockBulkRPC{
+		result: "0x000000000000000000000000000000000000000000000000000000000001e240",
+	}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": addresses,
+		"params":    map[string]interface{}{"owner": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(2, rpc.batches)
+	assert.Equal(bulkCallBatchSize+1, rpc.calls)
+	assert.Len(reply, bulkCallBatchSize+1)
+	assert.Equal("123456", reply[addresses[bulkCallBatchSize]]["balance"])
+}
+
+func TestBulkCallBatchFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &mockBulkRPC{batchErr: fmt.Errorf("pop")}
+	res := newTestBulkCall(t, rpc, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "0x0123456789abcdef0123456789abcdef01234567"},
+		"params":    map[string]interface{}{"owner": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("pop", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+	assert.Regexp("pop", reply["0x0123456789abcdef0123456789abcdef01234567"]["error"])
+}
+
+func TestBulkCallBatchUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestBulkCall(t, &mockRPC{}, newTestBulkCallABILoader(), "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+	})
+
+	assert.Equal(500, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal("JSON/RPC batch requests are not supported by the client", reply.Message)
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"net/http"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+)
+
+// bytesBase64Requested checks the fly-bytesencoding hint, which sets the encoding of every
+// bytes parameter in the request. Individual values can instead use the base64: prefix
+func bytesBase64Requested(req *http.Request) (bool, error) {
+	switch encoding := getFlyParam("bytesencoding", req, false); strings.ToLower(encoding) {
+	case "", "hex":
+		return false, nil
+	case "base64":
+		return true, nil
+	default:
+		return false, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidBytesEncoding, encoding)
+	}
+}
+
+// markBase64Bytes adds the base64 prefix to the string values of bytes parameters, including
+// those nested in arrays and tuples, so they are decoded as base64 rather than hex
+func markBase64Bytes(t *ethbinding.ABIType, v interface{}) interface{} {
+	switch t.T {
+	case ethbinding.BytesTy, ethbinding.FixedBytesTy:
+		if s, ok := v.(string); ok && !strings.HasPrefix(s, eth.Base64BytesPrefix) {
+			return eth.Base64BytesPrefix + s
+		}
+	case ethbinding.SliceTy, ethbinding.ArrayTy:
+		if a, ok := v.([]interface{}); ok {
+			marked := make([]interface{}, len(a))
+			for i, elem := range a {
+				marked[i] = markBase64Bytes(t.Elem, elem)
+			}
+			return marked
+		}
+	case ethbinding.TupleTy:
+		if m, ok := v.(map[string]interface{}); ok {
+			marked := make(map[string]interface{}, len(m))
+			for k, elem := range m {
+				marked[k] = elem
+			}
+			for i, name := range t.TupleRawNames {
+				if elem, exists := m[name]; exists {
+					marked[name] = markBase64Bytes(t.TupleElems[i], elem)
+				}
+			}
+			return marked
+		}
+	}
+	return v
+}
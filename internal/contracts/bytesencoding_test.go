@@ -0,0 +1,103 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBytesABILoader() *mockABILoader {
+	return &mockABILoader{
+		deployMsg: &messages.DeployContract{
+			ABI: ethbinding.ABIMarshaling{
+				{
+					Type:            "function",
+					Name:            "store",
+					StateMutability: "nonpayable",
+					Inputs: []ethbinding.ABIArgumentMarshaling{
+						{Name: "id", Type: "uint256"},
+						{Name: "payload", Type: "bytes"},
+					},
+				},
+			},
+		},
+		registeredContractAddr: "2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+	}
+}
+
+func TestMarkBase64Bytes(t *testing.T) {
+	assert := assert.New(t)
+
+	runtimeABI, err := eth.RuntimeABI(ethbinding.ABIMarshaling{
+		{
+			Type: "function",
+			Name: "set",
+			Inputs: []ethbinding.ABIArgumentMarshaling{
+				{Name: "list", Type: "bytes32[]"},
+				{Name: "order", Type: "tuple", Components: []ethbinding.ABIArgumentMarshaling{
+					{Name: "id", Type: "string"},
+					{Name: "data", Type: "bytes"},
+				}},
+			},
+		},
+	})
+	assert.NoError(err)
+	inputs := runtimeABI.Methods["set"].Inputs
+
+	list := markBase64Bytes(&inputs[0].Type, []interface{}{"AQ==", "base64:Ag=="})
+	assert.Equal([]interface{}{"base64:AQ==", "base64:Ag=="}, list)
+
+	order := map[string]interface{}{"id": "abc", "data": "AQ=="}
+	marked := markBase64Bytes(&inputs[1].Type, order)
+	assert.Equal(map[string]interface{}{"id": "abc", "data": "base64:AQ=="}, marked)
+	assert.Equal("AQ==", order["data"])
+}
+
+func TestBytesEncodingBase64Hint(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBytesABILoader())
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/store?fly-bytesencoding=base64&id=1", bytes.NewReader([]byte(`{"payload":"aGVsbG8="}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	assert.Equal([]interface{}{"1", "base64:aGVsbG8="}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestBytesEncodingInvalidHint(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBytesABILoader())
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/store?fly-bytesencoding=base32", bytes.NewReader([]byte(`{"id":1,"payload":"00"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid bytes encoding 'base32'", res.Body.String())
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// contractFiles stores the deployment details of ABIs, contract instances, signer aliases and
+// transaction policies for the gateway. Each is a file in the storage path, or is held in memory
+// for ephemeral environments such as CI, where nothing should outlive the process
+type contractFiles interface {
+	path(name string) string
+	readFile(filePath string) ([]byte, error)
+	writeFile(filePath string, data []byte) error
+	removeFile(filePath string) error
+	listFiles() ([]storedFile, error)
+}
+
+// storedFile is the name and the modification time of a stored file
+type storedFile struct {
+	name    string
+	modTime time.Time
+}
+
+func newContractFiles(conf *SmartContractGatewayConf) contractFiles {
+	if conf.InMemory {
+		return &memoryContractFiles{files: make(map[string]*memoryContractFile)}
+	}
+	return &dirContractFiles{dir: conf.StoragePath}
+}
+
+type dirContractFiles struct {
+	dir string
+}
+
+func (d *dirContractFiles) path(name string) string {
+	return path.Join(d.dir, name)
+}
+
+func (d *dirContractFiles) readFile(filePath string) ([]byte, error) {
+	return ioutil.ReadFile(filePath)
+}
+
+func (d *dirContractFiles) writeFile(filePath string, data []byte) error {
+	return ioutil.WriteFile(filePath, data, 0664)
+}
+
+// removeFile removes a file, and does not fail if it does not exist
+func (d *dirContractFiles) removeFile(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (d *dirContractFiles) listFiles() ([]storedFile, error) {
+	infos, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]storedFile, len(infos))
+	for i, info := range infos {
+		files[i] = storedFile{name: info.Name(), modTime: info.ModTime()}
+	}
+	return files, nil
+}
+
+type memoryContractFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// memoryContractFiles holds the files in memory, with the same not-exist errors as the file system
+type memoryContractFiles struct {
+	mux   sync.Mutex
+	files map[string]*memoryContractFile
+}
+
+func (m *memoryContractFiles) path(name string) string {
+	return name
+}
+
+func (m *memoryContractFiles) readFile(filePath string) ([]byte, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	f, exists := m.files[filePath]
+	if !exists {
+		return nil, &os.PathError{Op: "open", Path: filePath, Err: os.ErrNotExist}
+	}
+	return append([]byte{}, f.data...), nil
+}
+
+func (m *memoryContractFiles) writeFile(filePath string, data []byte) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.files[filePath] = &memoryContractFile{
+		data:    append([]byte{}, data...),
+		modTime: time.Now().UTC(),
+	}
+	return nil
+}
+
+func (m *memoryContractFiles) removeFile(filePath string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.files, filePath)
+	return nil
+}
+
+func (m *memoryContractFiles) listFiles() ([]storedFile, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	files := make([]storedFile, 0, len(m.files))
+	for name, f := range m.files {
+		files = append(files, storedFile{name: name, modTime: f.modTime})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
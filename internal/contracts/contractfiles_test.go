@@ -0,0 +1,105 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryContractFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	files := newContractFiles(&SmartContractGatewayConf{InMemory: true, StoragePath: "/unused"})
+	p := files.path("abi_1.deploy.json")
+	assert.Equal("abi_1.deploy.json", p)
+	_, err := files.readFile(p)
+	assert.True(os.IsNotExist(err))
+
+	err = files.writeFile(p, []byte("{}"))
+	assert.NoError(err)
+	err = files.writeFile(files.path("abi_0.deploy.json"), []byte("[]"))
+	assert.NoError(err)
+	b, err := files.readFile(p)
+	assert.NoError(err)
+	assert.Equal("{}", string(b))
+
+	list, err := files.listFiles()
+	assert.NoError(err)
+	assert.Len(list, 2)
+	assert.Equal("abi_0.deploy.json", list[0].name)
+	assert.False(list[0].modTime.IsZero())
+
+	assert.NoError(files.removeFile(p))
+	assert.NoError(files.removeFile(p))
+	_, err = files.readFile(p)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestDirContractFilesRemoveMissing(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	files := newContractFiles(&SmartContractGatewayConf{StoragePath: dir})
+	assert.Equal(path.Join(dir, "abi_1.deploy.json"), files.path("abi_1.deploy.json"))
+	assert.NoError(files.removeFile(files.path("abi_1.deploy.json")))
+}
+
+func TestNewSmartContractGatewayInMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL:  "http://localhost/api/v1",
+			InMemory: true,
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.NoError(err)
+	scgw := s.(*smartContractGW)
+	assert.True(scgw.conf.Enabled())
+	assert.True(scgw.conf.EventsInMemory)
+	assert.NotNil(scgw.sm)
+	assert.Empty(scgw.conf.Solc.Git.CacheDir)
+	defer scgw.Shutdown()
+
+	deployMsg := &messages.DeployContract{ContractName: "SimpleEvents"}
+	err = scgw.writeAbiInfo("abi1", deployMsg)
+	assert.NoError(err)
+	scgw.addToABIIndex("abi1", deployMsg, time.Now().UTC())
+	err = scgw.storeContractInfo(&contractInfo{
+		Address: "0123456789abcdef0123456789abcdef01234567",
+		ABI:     "abi1",
+	})
+	assert.NoError(err)
+
+	// The index is rebuilt from the same memory store
+	scgw.contractIndex = make(map[string]messages.TimeSortable)
+	scgw.abiIndex = make(map[string]messages.TimeSortable)
+	scgw.buildIndex()
+	assert.Len(scgw.contractIndex, 1)
+	assert.Len(scgw.abiIndex, 1)
+	loaded, _, err := scgw.loadDeployMsgByID("abi1")
+	assert.NoError(err)
+	assert.Equal("SimpleEvents", loaded.ContractName)
+}
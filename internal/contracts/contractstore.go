@@ -0,0 +1,62 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"os"
+
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+// ContractStore writes ABIs and contract instances directly into the storage path of a
+// gateway, without the gateway running. The gateway picks them up when it next builds
+// its index on startup
+type ContractStore interface {
+	AddABI(msg *messages.DeployContract) (string, error)
+	RegisterContractInstance(abiID, addrHexNo0x, registerAs string) error
+}
+
+// NewContractStore constructor, loading the index of the existing contents of the storage path
+func NewContractStore(conf *SmartContractGatewayConf) (ContractStore, error) {
+	if fi, err := os.Stat(conf.StoragePath); err != nil || !fi.IsDir() {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractStorePathInvalid, conf.StoragePath)
+	}
+	gw := &smartContractGW{
+		conf:                  conf,
+		files:                 newContractFiles(conf),
+		contractIndex:         make(map[string]messages.TimeSortable),
+		contractRegistrations: make(map[string]*contractInfo),
+		signerAliases:         make(map[string]*signerAlias),
+		abiIndex:              make(map[string]messages.TimeSortable),
+		baseSwaggerConf:       baseSwaggerConfFor(conf, false),
+	}
+	gw.buildIndex()
+	return gw, nil
+}
+
+// AddABI stores a pre-compiled ABI and bytecode, returning the ID it can be deployed
+// or registered against
+func (g *smartContractGW) AddABI(msg *messages.DeployContract) (string, error) {
+	if msg.Headers.ID == "" {
+		msg.Headers.ID = utils.UUIDv4()
+	}
+	info, err := g.storeDeployableABI(msg, nil)
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
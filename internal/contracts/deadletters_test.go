@@ -0,0 +1,77 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDeadLetters(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := &mockSubMgr{
+		deadLetters: []*events.DeadLetter{{ID: "dl1", Stream: "es-1", Error: "pop"}},
+	}
+	var result []*events.DeadLetter
+	res := testGWPath("GET", events.StreamPathPrefix+"/es-1/deadletters", &result, sm)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Len(result, 1)
+	assert.Equal("dl1", result[0].ID)
+	assert.Equal("pop", result[0].Error)
+
+	res = testGWPath("GET", events.StreamPathPrefix+"/es-1/deadletters", nil, &mockSubMgr{err: fmt.Errorf("not found")})
+	assert.Equal(404, res.Result().StatusCode)
+
+	res = testGWPath("GET", events.StreamPathPrefix+"/es-1/deadletters", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := &mockSubMgr{
+		deadLetters: []*events.DeadLetter{{ID: "dl1", Stream: "es-1"}},
+	}
+	var result events.DeadLetter
+	res := testGWPath("POST", events.StreamPathPrefix+"/es-1/deadletters/dl1/replay", &result, sm)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("dl1", sm.capturedLetterID)
+	assert.Equal("dl1", result.ID)
+
+	res = testGWPath("POST", events.StreamPathPrefix+"/es-1/deadletters/dl1/replay", nil, &mockSubMgr{err: fmt.Errorf("suspended")})
+	assert.Equal(400, res.Result().StatusCode)
+
+	res = testGWPath("POST", events.StreamPathPrefix+"/es-1/deadletters/dl1/replay", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestDeleteDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := &mockSubMgr{}
+	res := testGWPath("DELETE", events.StreamPathPrefix+"/es-1/deadletters/dl1", nil, sm)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal("dl1", sm.capturedLetterID)
+
+	res = testGWPath("DELETE", events.StreamPathPrefix+"/es-1/deadletters/dl1", nil, &mockSubMgr{err: fmt.Errorf("not found")})
+	assert.Equal(404, res.Result().StatusCode)
+
+	res = testGWPath("DELETE", events.StreamPathPrefix+"/es-1/deadletters/dl1", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+// decodeRequest is the body of a POST to /decode
+type decodeRequest struct {
+	Data    string `json:"data"`
+	Address string `json:"address,omitempty"`
+	ABI     string `json:"abi,omitempty"`
+}
+
+// decodedCall is the method and arguments matched for the calldata of a decode request
+type decodedCall struct {
+	ABI      string                 `json:"abi,omitempty"`
+	Address  string                 `json:"address,omitempty"`
+	Method   string                 `json:"method"`
+	Selector string                 `json:"selector"`
+	Inputs   map[string]interface{} `json:"inputs"`
+}
+
+// decodeHandler decodes arbitrary calldata into the method it invokes and the arguments
+// passed, using the ABI of a registered contract address or name, or of a stored ABI ID.
+// If neither is supplied, all locally stored ABIs are searched for a matching selector
+func (r *rest2eth) decodeHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var body decodeRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayDecodeBadRequest, err), 400)
+		return
+	}
+	data, err := hex.DecodeString(strings.TrimPrefix(body.Data, "0x"))
+	if err != nil || len(data) < 4 {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayDecodeInvalidData), 400)
+		return
+	}
+	selector := ethbind.API.HexEncode(data[0:4])
+
+	result := &decodedCall{
+		ABI:      body.ABI,
+		Selector: selector,
+	}
+	var method *ethbinding.ABIMethod
+	if body.ABI != "" || body.Address != "" {
+		var abi ethbinding.ABIMarshaling
+		if abi, result.Address, err = r.resolveDecodeABI(body); err != nil {
+			r.restErrReply(res, req, err, 404)
+			return
+		}
+		method = matchMethodSelector(abi, data[0:4])
+	} else {
+		for _, abiID := range r.gw.listABIIDs() {
+			deployMsg, _, err := r.gw.loadDeployMsgByID(abiID)
+			if err != nil {
+				log.Warnf("Skipping ABI %s when decoding: %s", abiID, err)
+				continue
+			}
+			if method = matchMethodSelector(deployMsg.ABI, data[0:4]); method != nil {
+				result.ABI = abiID
+				break
+			}
+		}
+	}
+	if method == nil {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayDecodeMethodNotFound, selector), 404)
+		return
+	}
+	result.Method = method.Sig
+
+	if result.Inputs, err = eth.DecodeMethodInputs(method, data); err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+
+	resBytes, _ := json.MarshalIndent(result, "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
+
+// resolveDecodeABI loads the ABI identified in a decode request, returning the resolved
+// contract address if one was supplied
+func (r *rest2eth) resolveDecodeABI(body decodeRequest) (abi ethbinding.ABIMarshaling, addr string, err error) {
+	if body.Address != "" {
+		var ok bool
+		if addr, ok = normalizeAddress(body.Address); !ok {
+			if addr, err = r.gw.resolveContractAddr(body.Address); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	var deployMsg *messages.DeployContract
+	if body.ABI != "" {
+		deployMsg, _, err = r.gw.loadDeployMsgByID(body.ABI)
+	} else {
+		deployMsg, _, err = r.gw.loadDeployMsgForInstance(addr)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if addr != "" {
+		addr = "0x" + addr
+	}
+	return deployMsg.ABI, addr, nil
+}
+
+// matchMethodSelector returns the function in the ABI with the supplied selector, or nil
+func matchMethodSelector(abi ethbinding.ABIMarshaling, selector []byte) *ethbinding.ABIMethod {
+	for _, element := range abi {
+		if element.Type != "function" {
+			continue
+		}
+		method, err := ethbind.API.ABIElementMarshalingToABIMethod(&element)
+		if err != nil {
+			log.Warnf("Skipping invalid ABI function '%s': %s", element.Name, err)
+			continue
+		}
+		if bytes.Equal(method.ID, selector) {
+			return method
+		}
+	}
+	return nil
+}
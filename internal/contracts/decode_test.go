@@ -0,0 +1,233 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTransferCalldata = "0x1a695230000000000000000000000000aa983ad2a0e0ed8ac639277f37be42f2a5d2618c"
+
+func newTestDecode(abiLoader *mockABILoader, body interface{}) *httptest.ResponseRecorder {
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	bodyBytes, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", "/decode", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestDecodeByAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data:    testTransferCalldata,
+		Address: "0x567A417717cb6c59ddc1035705f02c0fd1ab1872",
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply decodedCall
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal(decodedCall{
+		Address:  "0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+		Method:   "transfer(address)",
+		Selector: "0x1a695230",
+		Inputs: map[string]interface{}{
+			"to": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c",
+		},
+	}, reply)
+	assert.Equal("567a417717cb6c59ddc1035705f02c0fd1ab1872", abiLoader.capturedAddr)
+}
+
+func TestDecodeByRegisteredName(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data:    testTransferCalldata,
+		Address: "myToken",
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply decodedCall
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", reply.Address)
+	assert.Equal("2b8c0ecc76d0759a8f50b2e14a6881367d805832", abiLoader.capturedAddr)
+}
+
+func TestDecodeByABIID(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestDecode(newTestBulkCallABILoader(), &decodeRequest{
+		Data: testTransferCalldata,
+		ABI:  "abi1",
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply decodedCall
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("abi1", reply.ABI)
+	assert.Empty(reply.Address)
+	assert.Equal("transfer(address)", reply.Method)
+}
+
+func TestDecodeSearchABIs(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.abiIDs = []string{"abi1", "abi2"}
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data: testTransferCalldata,
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply decodedCall
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("abi1", reply.ABI)
+	assert.Equal("transfer(address)", reply.Method)
+}
+
+func TestDecodeSearchABIsNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.abiIDs = []string{"abi1"}
+	abiLoader.loadABIError = fmt.Errorf("pop")
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data: testTransferCalldata,
+	})
+
+	assert.Equal(404, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("No method found matching selector 0x1a695230", reply.Message)
+}
+
+func TestDecodeSelectorNotInABI(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestDecode(newTestBulkCallABILoader(), &decodeRequest{
+		Data:    "0xfeedbeef",
+		Address: "0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+	})
+
+	assert.Equal(404, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("No method found matching selector 0xfeedbeef", reply.Message)
+}
+
+func TestDecodeSkipsInvalidABIFunctions(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.deployMsg.ABI = append(ethbinding.ABIMarshaling{
+		{
+			Type: "function",
+			Name: "badness",
+			Inputs: []ethbinding.ABIArgumentMarshaling{
+				{Name: "x", Type: "badness"},
+			},
+		},
+	}, abiLoader.deployMsg.ABI...)
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data:    testTransferCalldata,
+		Address: "0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+}
+
+func TestDecodeLoadABIFail(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.loadABIError = fmt.Errorf("pop")
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data: testTransferCalldata,
+		ABI:  "abi1",
+	})
+
+	assert.Equal(404, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("pop", reply.Message)
+}
+
+func TestDecodeResolveNameFail(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.resolveContractErr = fmt.Errorf("pop")
+	res := newTestDecode(abiLoader, &decodeRequest{
+		Data:    testTransferCalldata,
+		Address: "unknown",
+	})
+
+	assert.Equal(404, res.Result().StatusCode)
+}
+
+func TestDecodeBadRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	req := httptest.NewRequest("POST", "/decode", bytes.NewReader([]byte("!json")))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Invalid decode request", reply.Message)
+}
+
+func TestDecodeInvalidData(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, data := range []string{"", "0x1a6952", "badness"} {
+		res := newTestDecode(newTestBulkCallABILoader(), &decodeRequest{
+			Data:    data,
+			Address: "0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+		})
+		assert.Equal(400, res.Result().StatusCode)
+		var reply restErrMsg
+		json.NewDecoder(res.Body).Decode(&reply)
+		assert.Regexp("Must supply hex encoded calldata", reply.Message)
+	}
+}
+
+func TestDecodeTruncatedInputs(t *testing.T) {
+	assert := assert.New(t)
+
+	res := newTestDecode(newTestBulkCallABILoader(), &decodeRequest{
+		Data:    testTransferCalldata[0:20],
+		Address: "0x567a417717cb6c59ddc1035705f02c0fd1ab1872",
+	})
+
+	assert.Equal(400, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Failed to unpack values", reply.Message)
+}
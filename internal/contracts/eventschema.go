@@ -0,0 +1,53 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/events"
+	log "github.com/sirupsen/logrus"
+)
+
+// eventSchemaHandler replies with the JSON schema of the payload delivered on event streams
+// for an event of the contract, so consumers can generate their deserialization code from it
+func (r *rest2eth) eventSchemaHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if subcommand := params.ByName("subcommand"); strings.ToLower(subcommand) != "schema" {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUnknownGetOperation, subcommand), 404)
+		return
+	}
+
+	c, err := r.resolveParams(res, req, params, false)
+	if err != nil {
+		return
+	}
+	if c.abiEvent == nil {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventNotDeclared, params.ByName("method")), 404)
+		return
+	}
+
+	resBytes, _ := json.MarshalIndent(events.EventSchema(c.abiEvent), "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/schema+json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
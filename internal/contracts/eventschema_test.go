@@ -0,0 +1,74 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventSchemaHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFactoryABILoader())
+
+	req := httptest.NewRequest("GET", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/ContractCreated/schema", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("application/schema+json", res.Header().Get("Content-Type"))
+	var schema spec.Schema
+	err := json.NewDecoder(res.Body).Decode(&schema)
+	assert.NoError(err)
+	assert.Equal("ContractCreated", schema.Title)
+	data := schema.Properties["data"]
+	assert.Equal([]string{"child", "name"}, data.Required)
+	assert.Equal([]string{"string"}, []string(data.Properties["name"].Type))
+}
+
+func TestEventSchemaHandlerNotEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBytesABILoader())
+
+	req := httptest.NewRequest("GET", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/store/schema", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("Event 'store' is not declared in the ABI", reply.Message)
+}
+
+func TestEventSchemaHandlerUnknownOperation(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFactoryABILoader())
+
+	req := httptest.NewRequest("GET", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/ContractCreated/subscribe", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Unknown operation 'subscribe'", reply.Message)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// fingerprintEnabled checks whether requests to unregistered addresses should be matched
+// to an ABI by bytecode fingerprint, which can be overridden per-request with fly-fingerprint
+func (r *rest2eth) fingerprintEnabled(req *http.Request) bool {
+	switch strings.ToLower(getFlyParam("fingerprint", req, true)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return r.fingerprint
+	}
+}
+
+// bindByFingerprint reads the code deployed at an address that has no registered ABI,
+// and looks for an ABI compiled to the same metadata hash. First in the local store, then
+// in the remote registry if one is configured. A match is registered against the address
+func (g *smartContractGW) bindByFingerprint(ctx context.Context, addrHexNo0x string) (*messages.DeployContract, error) {
+	if g.rpc == nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFingerprintUnavailable)
+	}
+	addr := ethbind.API.HexToAddress("0x" + addrHexNo0x)
+	code, err := eth.GetCode(ctx, g.rpc, &addr, "latest")
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationNoCode, addrHexNo0x)
+	}
+	fingerprint := eth.BytecodeFingerprint(code)
+	if fingerprint == "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFingerprintNoMetadata, addrHexNo0x)
+	}
+
+	abiID := g.findABIByFingerprint(fingerprint)
+	if abiID == "" {
+		if abiID, err = g.importABIByFingerprint(fingerprint); err != nil {
+			return nil, err
+		}
+	}
+	if abiID == "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFingerprintNoMatch, addrHexNo0x)
+	}
+
+	log.Infof("Binding contract 0x%s to ABI %s with bytecode fingerprint %s", addrHexNo0x, abiID, fingerprint)
+	if _, err = g.storeNewContractInfo(addrHexNo0x, abiID, addrHexNo0x, "", methodFilter{}); err != nil {
+		return nil, err
+	}
+	deployMsg, _, err := g.loadDeployMsgByID(abiID)
+	return deployMsg, err
+}
+
+// findABIByFingerprint returns the first stored ABI, in listing order, with the fingerprint
+func (g *smartContractGW) findABIByFingerprint(fingerprint string) string {
+	for _, id := range g.listABIIDs() {
+		g.idxLock.Lock()
+		ts, exists := g.abiIndex[id]
+		g.idxLock.Unlock()
+		if exists && ts.(*abiInfo).fingerprint == fingerprint {
+			return id
+		}
+	}
+	return ""
+}
+
+// importABIByFingerprint looks up the fingerprint in the remote registry, and stores the
+// ABI it returns locally so the instance can be registered against it
+func (g *smartContractGW) importABIByFingerprint(fingerprint string) (string, error) {
+	msg, err := g.rr.loadFactoryForFingerprint(fingerprint, false)
+	if err != nil || msg == nil {
+		return "", err
+	}
+	msg.Headers.CommonHeaders = messages.CommonHeaders{
+		ID:      utils.UUIDv4(),
+		MsgType: messages.MsgTypeDeployContract,
+	}
+	info, err := g.storeDeployableABI(msg, nil)
+	if err != nil {
+		return "", err
+	}
+	return info.ID, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+const (
+	formURLEncoded = "application/x-www-form-urlencoded"
+	formMultipart  = "multipart/form-data"
+)
+
+// methodPayload parses the body of a request for the parameters of a method, or the details of
+// an event subscription. HTML forms are accepted, URL encoded or multipart, as well as JSON/YAML
+func methodPayload(req *http.Request, inputs ethbinding.ABIArguments) (map[string]interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch strings.ToLower(mediaType) {
+	case formURLEncoded:
+		if err := req.ParseForm(); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFormBodyParseFailed, err)
+		}
+		return formBody(req.PostForm, nil, inputs)
+	case formMultipart:
+		if err := req.ParseMultipartForm(maxFormParsingMemory); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFormBodyParseFailed, err)
+		}
+		return formBody(req.MultipartForm.Value, req.MultipartForm.File, inputs)
+	default:
+		return utils.YAMLorJSONPayload(req)
+	}
+}
+
+// formBody converts the fields of a form into a body, using the ABI to decide how each is parsed.
+// Fields with the fly- prefix are special parameters read from the form, so are not included
+func formBody(values url.Values, files map[string][]*multipart.FileHeader, inputs ethbinding.ABIArguments) (map[string]interface{}, error) {
+	types := make(map[string]*ethbinding.ABIType)
+	for i, input := range inputs {
+		t := input.Type
+		types[abiInputName(i, input)] = &t
+	}
+	flyPrefix := utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly") + "-"
+
+	body := make(map[string]interface{})
+	for name, vs := range values {
+		if len(vs) == 0 || strings.HasPrefix(strings.ToLower(name), flyPrefix) {
+			continue
+		}
+		v, err := formValue(name, vs, types[name])
+		if err != nil {
+			return nil, err
+		}
+		body[name] = v
+	}
+	for name, fhs := range files {
+		if len(fhs) == 0 || strings.HasPrefix(strings.ToLower(name), flyPrefix) {
+			continue
+		}
+		v, err := formFileValue(name, fhs[0], types[name])
+		if err != nil {
+			return nil, err
+		}
+		body[name] = v
+	}
+	return body, nil
+}
+
+// formValue converts the values of a form field. Arrays can be supplied by repeating the field,
+// or as a single JSON array. Tuples must be supplied as a JSON object
+func formValue(name string, vs []string, t *ethbinding.ABIType) (interface{}, error) {
+	if t != nil {
+		switch t.T {
+		case ethbinding.SliceTy, ethbinding.ArrayTy:
+			if len(vs) == 1 && strings.HasPrefix(strings.TrimSpace(vs[0]), "[") {
+				return formJSONValue(name, vs[0], t)
+			}
+			return formList(vs, t.Elem), nil
+		case ethbinding.TupleTy:
+			return formJSONValue(name, vs[0], t)
+		}
+	}
+	if len(vs) > 1 {
+		return formList(vs, nil), nil
+	}
+	return formScalar(vs[0], t), nil
+}
+
+// formScalar converts the text of a form field to a bool for bool parameters, so that the
+// value passes strict validation. All other types are accepted as strings
+func formScalar(s string, t *ethbinding.ABIType) interface{} {
+	if t != nil && t.T == ethbinding.BoolTy {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	}
+	return s
+}
+
+func formJSONValue(name, s string, t *ethbinding.ABIType) (interface{}, error) {
+	var v interface{}
+	if err := utils.UnmarshalJSONNumbers([]byte(s), &v); err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFormBodyFieldNotJSON, name, t.String(), err)
+	}
+	return v, nil
+}
+
+func formList(vs []string, elem *ethbinding.ABIType) []interface{} {
+	a := make([]interface{}, len(vs))
+	for i, v := range vs {
+		a[i] = formScalar(v, elem)
+	}
+	return a
+}
+
+// formFileValue reads a file uploaded in a multipart form. The content of a file for a bytes
+// parameter is passed as-is, and for any other parameter is parsed in the same way as a field
+func formFileValue(name string, fh *multipart.FileHeader, t *ethbinding.ABIType) (interface{}, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFormBodyFileReadFailed, name, err)
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFormBodyFileReadFailed, name, err)
+	}
+	if t != nil && (t.T == ethbinding.BytesTy || t.T == ethbinding.FixedBytesTy) {
+		// Binary content is base64 encoded, as the prefix means it is decoded whatever
+		// the fly-bytesencoding of the request
+		return eth.Base64BytesPrefix + base64.StdEncoding.EncodeToString(content), nil
+	}
+	return formValue(name, []string{string(content)}, t)
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendTransactionURLEncodedForm(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	_, _, router := newTestREST2Eth(t, dispatcher)
+
+	form := url.Values{
+		"i":        {"12345"},
+		"s":        {"testing"},
+		"fly-from": {"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"},
+	}
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?fly-strict", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Code)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.asyncDispatchMsg["from"])
+	assert.Equal([]interface{}{"12345", "testing"}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestSendTransactionMultipartForm(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBytesABILoader())
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("id", "123456789012345678901234567890")
+	writer.WriteField("fly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	part, _ := writer.CreateFormFile("payload", "payload.bin")
+	part.Write([]byte{0x01, 0x02, 0xff})
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/store", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Code)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.asyncDispatchMsg["from"])
+	assert.Equal([]interface{}{
+		"123456789012345678901234567890",
+		eth.Base64BytesPrefix + "AQL/",
+	}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestSendTransactionFormBadBody(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBytesABILoader())
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/store", strings.NewReader("not multipart"))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=xyz")
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Code)
+	var errReply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&errReply)
+	assert.Regexp("Unable to parse form data", errReply["error"])
+}
+
+func TestFormValueTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	runtimeABI, err := eth.RuntimeABI(ethbinding.ABIMarshaling{
+		{
+			Type: "function",
+			Name: "set",
+			Inputs: []ethbinding.ABIArgumentMarshaling{
+				{Name: "flag", Type: "bool"},
+				{Name: "list", Type: "uint256[]"},
+				{Name: "flags", Type: "bool[2]"},
+				{Name: "order", Type: "tuple", Components: []ethbinding.ABIArgumentMarshaling{
+					{Name: "id", Type: "string"},
+				}},
+				{Name: "", Type: "string"},
+			},
+		},
+	})
+	assert.NoError(err)
+
+	body, err := formBody(url.Values{
+		"flag":     {"true"},
+		"list":     {"[1, 2]"},
+		"flags":    {"true", "false"},
+		"order":    {`{"id":"abc"}`},
+		"input4":   {"x"},
+		"other":    {"a", "b"},
+		"FLY-SYNC": {"true"},
+	}, nil, runtimeABI.ABI.Methods["set"].Inputs)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"flag":   true,
+		"list":   []interface{}{json.Number("1"), json.Number("2")},
+		"flags":  []interface{}{true, false},
+		"order":  map[string]interface{}{"id": "abc"},
+		"input4": "x",
+		"other":  []interface{}{"a", "b"},
+	}, body)
+
+	_, err = formBody(url.Values{"order": {"abc"}}, nil, runtimeABI.ABI.Methods["set"].Inputs)
+	assert.Regexp("Form field 'order' for type .* must be a JSON value", err)
+}
@@ -0,0 +1,73 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"path"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// compileGitSource fetches the commit a deployment refers to in git, and compiles the contract
+// at its path. The commit is recorded on the message, so the stored ABI ties the deployment to
+// the exact revision of the source
+func (g *smartContractGW) compileGitSource(msg *messages.DeployContract) (*eth.CompiledSolidity, error) {
+	if msg.Solidity != "" {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.CompilerGitSourceConflict)
+	}
+	dir, commit, err := g.conf.Solc.Git.Fetch(msg.Git)
+	if err != nil {
+		return nil, err
+	}
+	// The commit is recorded, and the URL stored without any credentials it was fetched with
+	msg.Git.Commit = commit
+	msg.Git.URL = utils.StripCredentials(msg.Git.URL)
+	if err := g.conf.Solc.CheckSourceSize(dir); err != nil {
+		return nil, err
+	}
+
+	sourcePath := path.Clean(msg.Git.Path)
+	log.Infof("Compiling %s from %s@%s", sourcePath, msg.Git.URL, commit)
+	preCompiled, warnings, err := g.compileSolidityDir(dir, msg.CompilerVersion, msg.EVMVersion, nil, []string{sourcePath})
+	if err != nil {
+		return nil, err
+	}
+
+	// The contract is one declared in the source file, rather than any it imports
+	contractName := msg.ContractName
+	candidates := preCompiled
+	if contractName != "" && !strings.Contains(contractName, ":") {
+		contractName = sourcePath + ":" + contractName
+	} else if contractName == "" {
+		candidates = make(map[string]*ethbinding.Contract)
+		for name, contract := range preCompiled {
+			if strings.HasPrefix(name, sourcePath+":") {
+				candidates[name] = contract
+			}
+		}
+	}
+	compiled, err := eth.ProcessCompiled(candidates, contractName, false)
+	if err != nil {
+		return nil, err
+	}
+	compiled.Warnings = warnings
+	return compiled, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"io/ioutil"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestGitSourceServer serves a repository containing the simple events contract, over the
+// smart HTTP protocol of git http-backend, and returns the commit of its main branch
+func newTestGitSourceServer(t *testing.T, dir string) (*httptest.Server, string) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := path.Join(dir, "repos", "contracts.git")
+	os.MkdirAll(path.Join(repo, "contracts"), 0755)
+	ioutil.WriteFile(path.Join(repo, "contracts", "SimpleEvents.sol"), []byte(simpleEventsSource()), 0644)
+	var head string
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "."},
+		{"commit", "-q", "-m", "simple events"},
+		{"rev-parse", "HEAD"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		)
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		head = strings.TrimSpace(string(out))
+	}
+	server := httptest.NewServer(&cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + path.Join(dir, "repos"), "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	return server, head
+}
+
+func newTestGitSourceGateway(dir string, allowedHosts ...string) *smartContractGW {
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+			Solc: eth.SolcConf{
+				Git: eth.SolcGitConf{AllowedHosts: allowedHosts},
+			},
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	return scgw.(*smartContractGW)
+}
+
+func TestPreDeployGitSource(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	server, head := newTestGitSourceServer(t, dir)
+	defer server.Close()
+	scgw := newTestGitSourceGateway(dir, "127.0.0.1")
+	assert.Equal(path.Join(dir, "solc-git"), scgw.conf.Solc.Git.CacheDir)
+
+	msg := &messages.DeployContract{
+		Git: &messages.GitSource{
+			URL:  strings.Replace(server.URL, "http://", "http://user:secret@", 1) + "/contracts.git",
+			Ref:  "main",
+			Path: "contracts/SimpleEvents.sol",
+		},
+	}
+	msg.Headers.ID = "message1"
+	err := scgw.PreDeploy(msg)
+	assert.NoError(err)
+	assert.Equal(head, msg.Git.Commit)
+	assert.Equal(server.URL+"/contracts.git", msg.Git.URL)
+	assert.Equal("SimpleEvents", msg.ContractName)
+	assert.NotEmpty(msg.Compiled)
+
+	deployMsg, info, err := scgw.loadDeployMsgByID("message1")
+	assert.NoError(err)
+	assert.Equal(head, deployMsg.Git.Commit)
+	assert.Equal(head, info.Git.Commit)
+	assert.Equal(server.URL+"/contracts.git", info.Git.URL)
+	checkouts, _ := filepath.Glob(path.Join(dir, "solc-git", "*", head, "contracts", "SimpleEvents.sol"))
+	assert.Len(checkouts, 1)
+}
+
+func TestPreDeployGitSourceContractName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	server, _ := newTestGitSourceServer(t, dir)
+	defer server.Close()
+	scgw := newTestGitSourceGateway(dir, "127.0.0.1")
+
+	msg := &messages.DeployContract{
+		ContractName: "Missing",
+		Git: &messages.GitSource{
+			URL:  server.URL + "/contracts.git",
+			Ref:  "main",
+			Path: "./contracts/SimpleEvents.sol",
+		},
+	}
+	err := scgw.PreDeploy(msg)
+	assert.Regexp("contracts/SimpleEvents.sol:Missing", err)
+}
+
+func TestPreDeployGitSourceNotEnabled(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestGitSourceGateway(dir)
+	err := scgw.PreDeploy(&messages.DeployContract{
+		Git: &messages.GitSource{URL: "https://github.com/org/repo.git", Ref: "main", Path: "Token.sol"},
+	})
+	assert.Regexp("Deploying from git is not enabled", err)
+}
+
+func TestPreDeployGitSourceConflict(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestGitSourceGateway(dir, "github.com")
+	err := scgw.PreDeploy(&messages.DeployContract{
+		Solidity: simpleEventsSource(),
+		Git:      &messages.GitSource{URL: "https://github.com/org/repo.git", Ref: "main", Path: "Token.sol"},
+	})
+	assert.Regexp("Supply either the solidity source or a git source", err)
+}
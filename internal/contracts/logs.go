@@ -0,0 +1,116 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+// logsHandler queries the historical logs over a range of blocks, optionally filtered by
+// the address (or registered name) of a contract and by topics. Large ranges are queried
+// from the node in chunks of blocks, and returned in pages with a cursor for the next page
+func (r *rest2eth) logsHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	limit, err := logsQueryNumber(req, "limit", eth.DefaultLogsPageLimit)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+
+	rpcTimeout, err := r.rpcTimeout(req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if rpcTimeout > 0 {
+		req = req.WithContext(eth.WithRPCTimeout(req.Context(), rpcTimeout))
+	}
+
+	var q *eth.LogsQuery
+	if cursor := getFlyParam("cursor", req, false); cursor != "" {
+		// The cursor contains the whole query, so the other parameters are ignored
+		if q, err = eth.ParseLogsCursor(cursor); err != nil {
+			r.restErrReply(res, req, err, 400)
+			return
+		}
+	} else {
+		var addr string
+		if addrParam := getFlyParam("address", req, false); addrParam != "" {
+			var ok bool
+			if addr, ok = normalizeAddress(addrParam); !ok {
+				if addr, err = r.gw.resolveContractAddr(addrParam); err != nil {
+					r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayStorageInvalidAddress, addrParam), 404)
+					return
+				}
+			}
+			addr = "0x" + addr
+		}
+		chunkSize, err := logsQueryNumber(req, "chunksize", eth.DefaultLogsChunkSize)
+		if err != nil {
+			r.restErrReply(res, req, err, 400)
+			return
+		}
+		// The end block is resolved on the first page, so later pages query the same range
+		toBlock := getFlyParam("toblock", req, false)
+		if toBlock == "" || toBlock == "latest" {
+			blockNumber, err := eth.GetBlockNumber(req.Context(), r.rpc)
+			if err != nil {
+				r.restErrReply(res, req, err, 500)
+				return
+			}
+			toBlock = strconv.FormatUint(blockNumber, 10)
+		}
+		q, err = eth.NewLogsQuery(addr, getFlyParamMulti("topic", req), getFlyParam("fromblock", req, false), toBlock)
+		if err != nil {
+			r.restErrReply(res, req, err, 400)
+			return
+		}
+		q.ChunkSize = uint64(chunkSize)
+	}
+
+	page, err := eth.GetLogs(req.Context(), r.rpc, q, limit)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+
+	resBytes, _ := json.MarshalIndent(page, "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
+
+func logsQueryNumber(req *http.Request, name string, defValue int) (int, error) {
+	valStr := getFlyParam(name, req, false)
+	if valStr == "" {
+		return defValue, nil
+	}
+	val, err := strconv.Atoi(valStr)
+	if err != nil || val <= 0 {
+		return 0, ethconnecterrors.Errorf(ethconnecterrors.LogsQueryInvalidLimit, name, valStr)
+	}
+	return val, nil
+}
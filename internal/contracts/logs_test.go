@@ -0,0 +1,114 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogsQuery(abiLoader *mockABILoader, rpcResult interface{}, rpcErr error, path string) (*mockRPC, *httptest.ResponseRecorder) {
+	dispatcher := &mockREST2EthDispatcher{}
+	_, mockRPC, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	mockRPC.result = rpcResult
+	mockRPC.mockError = rpcErr
+	req := httptest.NewRequest("GET", path, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return mockRPC, res
+}
+
+func TestLogsQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	topic := "0x" + strings.Repeat("ab", 32)
+	mockRPC, res := newTestLogsQuery(&mockABILoader{
+		registeredContractAddr: "2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+	}, []json.RawMessage{json.RawMessage(`{"logIndex":"0x0"}`)}, nil,
+		"/logs?fly-address=myContract&fly-topic="+topic+"&fly-fromblock=100&fly-toblock=200")
+
+	assert.Equal(200, res.Result().StatusCode)
+	var page eth.LogsPage
+	json.NewDecoder(res.Body).Decode(&page)
+	assert.Equal("100", page.FromBlock)
+	assert.Equal("200", page.ToBlock)
+	assert.Len(page.Logs, 1)
+	assert.Empty(page.Cursor)
+	assert.Equal("eth_getLogs", mockRPC.capturedMethod)
+	filterJSON, _ := json.Marshal(mockRPC.capturedArgs[0])
+	assert.JSONEq(`{"address":"0x2b8c0ecc76d0759a8f50b2e14a6881367d805832","topics":["`+topic+`"],"fromBlock":"0x64","toBlock":"0xc8"}`, string(filterJSON))
+}
+
+func TestLogsQueryCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	_, res := newTestLogsQuery(&mockABILoader{}, []json.RawMessage{json.RawMessage(`{}`)}, nil,
+		"/logs?fly-fromblock=0&fly-toblock=100&fly-chunksize=10&fly-limit=1")
+	assert.Equal(200, res.Result().StatusCode)
+	var page eth.LogsPage
+	json.NewDecoder(res.Body).Decode(&page)
+	assert.Equal("9", page.ToBlock)
+	assert.NotEmpty(page.Cursor)
+
+	mockRPC, res := newTestLogsQuery(&mockABILoader{}, []json.RawMessage{}, nil, "/logs?fly-cursor="+page.Cursor)
+	assert.Equal(200, res.Result().StatusCode)
+	json.NewDecoder(res.Body).Decode(&page)
+	assert.Equal("10", page.FromBlock)
+	assert.Equal("100", page.ToBlock)
+	assert.Empty(page.Cursor)
+	filterJSON, _ := json.Marshal(mockRPC.capturedArgs[0])
+	assert.JSONEq(`{"fromBlock":"0x64","toBlock":"0x64"}`, string(filterJSON))
+}
+
+func TestLogsQueryLatestBlockFail(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC, res := newTestLogsQuery(&mockABILoader{}, ethbinding.HexBigInt{}, fmt.Errorf("pop"), "/logs")
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("eth_blockNumber", mockRPC.capturedMethod)
+}
+
+func TestLogsQueryBadParams(t *testing.T) {
+	assert := assert.New(t)
+
+	_, res := newTestLogsQuery(&mockABILoader{}, nil, nil, "/logs?fly-limit=-1")
+	assert.Equal(400, res.Result().StatusCode)
+	_, res = newTestLogsQuery(&mockABILoader{}, nil, nil, "/logs?fly-chunksize=abc&fly-toblock=1")
+	assert.Equal(400, res.Result().StatusCode)
+	_, res = newTestLogsQuery(&mockABILoader{}, nil, nil, "/logs?fly-topic=0x12&fly-toblock=1")
+	assert.Equal(400, res.Result().StatusCode)
+	_, res = newTestLogsQuery(&mockABILoader{}, nil, nil, "/logs?fly-cursor=!!!")
+	assert.Equal(400, res.Result().StatusCode)
+	_, res = newTestLogsQuery(&mockABILoader{}, nil, nil, "/logs?fly-rpctimeout=abc")
+	assert.Equal(400, res.Result().StatusCode)
+	_, res = newTestLogsQuery(&mockABILoader{
+		resolveContractErr: fmt.Errorf("pop"),
+	}, nil, nil, "/logs?fly-address=unknown&fly-toblock=1")
+	assert.Equal(404, res.Result().StatusCode)
+}
+
+func TestLogsQueryFail(t *testing.T) {
+	assert := assert.New(t)
+
+	_, res := newTestLogsQuery(&mockABILoader{}, []json.RawMessage{}, fmt.Errorf("pop"), "/logs?fly-toblock=1")
+	assert.Equal(500, res.Result().StatusCode)
+}
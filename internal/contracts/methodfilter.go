@@ -0,0 +1,287 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	log "github.com/sirupsen/logrus"
+)
+
+// methodFilter restricts the methods that can be invoked on a contract instance through the
+// gateway, so admin functions on a shared contract can be blocked even though they are in the ABI.
+// Only one of the lists can be set
+type methodFilter struct {
+	AllowMethods []string `json:"allowMethods,omitempty"`
+	DenyMethods  []string `json:"denyMethods,omitempty"`
+}
+
+func (f *methodFilter) isEmpty() bool {
+	return f == nil || (len(f.AllowMethods) == 0 && len(f.DenyMethods) == 0)
+}
+
+// validate checks only one list is set, and each method in it is declared in the ABI.
+// The receive and fallback functions are referred to by those names
+func (f *methodFilter) validate(abi ethbinding.ABIMarshaling) error {
+	if len(f.AllowMethods) > 0 && len(f.DenyMethods) > 0 {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodFilterBothLists)
+	}
+	methods := f.AllowMethods
+	if len(methods) == 0 {
+		methods = f.DenyMethods
+	}
+	for _, method := range methods {
+		declared := false
+		for _, element := range abi {
+			if (element.Type == "function" && element.Name == method) ||
+				((method == "receive" || method == "fallback") && element.Type == method) {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodFilterUnknownMethod, method)
+		}
+	}
+	return nil
+}
+
+// check returns an error if the method is not in the allow list, or is in the deny list
+func (f *methodFilter) check(method, addr string) error {
+	if f.isEmpty() {
+		return nil
+	}
+	allowed := len(f.AllowMethods) == 0
+	for _, m := range f.AllowMethods {
+		if m == method {
+			allowed = true
+		}
+	}
+	for _, m := range f.DenyMethods {
+		if m == method {
+			allowed = false
+		}
+	}
+	if !allowed {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodNotAllowed, method, addr)
+	}
+	return nil
+}
+
+// checkCalldata checks the function that raw calldata invokes, found by matching its 4-byte
+// selector against the ABI, so calldata sent to the fallback function or in the data of a
+// message cannot invoke a function that is not allowed by name
+func (f *methodFilter) checkCalldata(abi ethbinding.ABIMarshaling, data []byte, addr string) error {
+	if f.isEmpty() {
+		return nil
+	}
+	return f.check(calldataMethod(abi, data), addr)
+}
+
+// calldataMethod returns the name of the function calldata invokes. Calldata that does not select
+// a function in the ABI reaches the fallback function, as does empty calldata when the contract
+// has no receive function
+func calldataMethod(abi ethbinding.ABIMarshaling, data []byte) string {
+	if len(data) >= 4 {
+		if method := matchMethodSelector(abi, data[0:4]); method != nil {
+			return method.Name
+		}
+	} else if len(data) == 0 {
+		for _, element := range abi {
+			if element.Type == "receive" {
+				return "receive"
+			}
+		}
+	}
+	return "fallback"
+}
+
+// CheckMethod checks a transaction to a registered contract instance is allowed by its method
+// lists, using the calldata of the transaction. The transaction processor calls this for every
+// transaction it sends, whichever path it was submitted through
+func (g *smartContractGW) CheckMethod(to string, data []byte) error {
+	addrHexNo0x, ok := normalizeAddress(to)
+	if !ok {
+		return nil
+	}
+	filter := g.methodFilterFor(addrHexNo0x)
+	if filter == nil {
+		return nil
+	}
+	deployMsg, _, err := g.loadDeployMsgForInstance(addrHexNo0x)
+	if err != nil {
+		return err
+	}
+	return filter.checkCalldata(deployMsg.ABI, data, addrHexNo0x)
+}
+
+// CheckSendTransaction checks a SendTransaction message is allowed by the method lists of the
+// contract it is sent to, before it is dispatched. The method is taken from the calldata when
+// the message has a data payload, and otherwise from the method it names
+func (g *smartContractGW) CheckSendTransaction(msg *messages.SendTransaction) error {
+	if msg.Data != "" {
+		data, err := hex.DecodeString(strings.TrimPrefix(msg.Data, "0x"))
+		if err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.TransactionSendBadCalldata, err)
+		}
+		return g.CheckMethod(msg.To, data)
+	}
+	method := msg.MethodName
+	if msg.Method != nil {
+		method = msg.Method.Name
+		if msg.Method.Type == "receive" || msg.Method.Type == "fallback" {
+			method = msg.Method.Type
+		}
+	}
+	addrHexNo0x, ok := normalizeAddress(msg.To)
+	if !ok || method == "" {
+		return nil
+	}
+	return g.methodFilterFor(addrHexNo0x).check(method, addrHexNo0x)
+}
+
+// storedMethodChecker applies the method lists of the contract instances in the storage path of
+// a gateway, for a Kafka bridge that consumes transactions without them passing through the
+// gateway. The instance is read for each check, so lists changed on the gateway apply immediately
+type storedMethodChecker struct {
+	files contractFiles
+}
+
+// NewStoredMethodChecker returns a check of the method lists of the contracts registered in the
+// storage path of a gateway
+func NewStoredMethodChecker(storagePath string) (tx.MethodChecker, error) {
+	if fi, err := os.Stat(storagePath); err != nil || !fi.IsDir() {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.ContractStorePathInvalid, storagePath)
+	}
+	return &storedMethodChecker{files: &dirContractFiles{dir: storagePath}}, nil
+}
+
+func (c *storedMethodChecker) CheckMethod(to string, data []byte) error {
+	addrHexNo0x, ok := normalizeAddress(to)
+	if !ok {
+		return nil
+	}
+	infoBytes, err := c.files.readFile(c.files.path("contract_" + addrHexNo0x + ".instance.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	var info contractInfo
+	if err == nil {
+		err = json.Unmarshal(infoBytes, &info)
+	}
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractLoad, addrHexNo0x)
+	}
+	if info.methodFilter.isEmpty() {
+		return nil
+	}
+	deployBytes, err := c.files.readFile(c.files.path("abi_" + info.ABI + ".deploy.json"))
+	var deployMsg messages.DeployContract
+	if err == nil {
+		err = json.Unmarshal(deployBytes, &deployMsg)
+	}
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABILoad, info.ABI, err)
+	}
+	return info.methodFilter.checkCalldata(deployMsg.ABI, data, addrHexNo0x)
+}
+
+// methodFilterFor returns the method lists of a registered contract instance, if it has any
+func (g *smartContractGW) methodFilterFor(addrHexNo0x string) *methodFilter {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	if ts, exists := g.contractIndex[addrHexNo0x]; exists {
+		info := ts.(*contractInfo)
+		if !info.methodFilter.isEmpty() {
+			filter := info.methodFilter
+			return &filter
+		}
+	}
+	return nil
+}
+
+// setMethodFilter replaces the allow or deny list of methods of a registered contract instance.
+// Empty lists remove the restriction
+func (g *smartContractGW) setMethodFilter(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var filter methodFilter
+	if err := json.NewDecoder(req.Body).Decode(&filter); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodFilterInvalid, err), 400)
+		return
+	}
+
+	id := params.ByName("address")
+	addrHexNo0x, ok := normalizeAddress(id)
+	var err error
+	if !ok {
+		if addrHexNo0x, err = g.resolveContractAddr(id); err != nil {
+			g.gatewayErrReply(res, req, err, 404)
+			return
+		}
+	}
+	deployMsg, _, err := g.loadDeployMsgForInstance(addrHexNo0x)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	if err = filter.validate(deployMsg.ABI); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	updated, status, err := g.setContractMethodFilter(addrHexNo0x, filter)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, status)
+		return
+	}
+
+	status = 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(updated)
+}
+
+// setContractMethodFilter stores the method lists of a contract instance in its instance file
+func (g *smartContractGW) setContractMethodFilter(addrHexNo0x string, filter methodFilter) (*contractInfo, int, error) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	ts, exists := g.contractIndex[addrHexNo0x]
+	if !exists {
+		return nil, 404, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x)
+	}
+	updated := *ts.(*contractInfo)
+	updated.methodFilter = filter
+	if err := g.writeContractInfo(&updated); err != nil {
+		return nil, 500, err
+	}
+	if updated.RegisteredAs != "" {
+		g.contractRegistrations[updated.RegisteredAs] = &updated
+	}
+	g.contractIndex[addrHexNo0x] = &updated
+	return &updated, 200, nil
+}
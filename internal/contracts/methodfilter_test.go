@@ -0,0 +1,312 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMethodFilterABI = ethbinding.ABIMarshaling{
+	{Type: "function", Name: "get", StateMutability: "view", Constant: true},
+	{Type: "function", Name: "set", StateMutability: "nonpayable"},
+	{Type: "function", Name: "kill", StateMutability: "nonpayable"},
+	{Type: "receive", StateMutability: "payable"},
+}
+
+// newTestMethodFilterGW stores abi1 with a real deploy file, so the contracts registered
+// against it by newTestRenameGW can be loaded
+func newTestMethodFilterGW(t *testing.T, dir string) (*smartContractGW, *httprouter.Router) {
+	scgw, router := newTestRenameGW(dir)
+	deployMsg := &messages.DeployContract{ABI: testMethodFilterABI}
+	deployBytes, _ := json.Marshal(deployMsg)
+	err := ioutil.WriteFile(path.Join(dir, "abi_abi1.deploy.json"), deployBytes, 0664)
+	assert.NoError(t, err)
+	scgw.addToABIIndex("abi1", deployMsg, time.Now().UTC())
+	return scgw, router
+}
+
+func testMethodsPath(router *httprouter.Router, method, path, body string, results interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(results)
+	return res
+}
+
+func TestMethodFilterValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&methodFilter{}).validate(testMethodFilterABI))
+	assert.NoError((&methodFilter{AllowMethods: []string{"get", "receive"}}).validate(testMethodFilterABI))
+	assert.NoError((&methodFilter{DenyMethods: []string{"kill"}}).validate(testMethodFilterABI))
+
+	err := (&methodFilter{AllowMethods: []string{"get"}, DenyMethods: []string{"kill"}}).validate(testMethodFilterABI)
+	assert.EqualError(err, "Only one of an allow list or a deny list of methods can be set on a contract")
+
+	err = (&methodFilter{DenyMethods: []string{"fallback"}}).validate(testMethodFilterABI)
+	assert.EqualError(err, "Method 'fallback' is not declared in the ABI of the contract")
+}
+
+func TestMethodFilterCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	var nilFilter *methodFilter
+	assert.NoError(nilFilter.check("kill", "0123456789abcdef0123456789abcdef01234567"))
+
+	allow := &methodFilter{AllowMethods: []string{"get", "set"}}
+	assert.NoError(allow.check("set", "0123456789abcdef0123456789abcdef01234567"))
+	err := allow.check("kill", "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "Method 'kill' is not allowed on contract 0123456789abcdef0123456789abcdef01234567")
+
+	deny := &methodFilter{DenyMethods: []string{"kill"}}
+	assert.NoError(deny.check("set", "0123456789abcdef0123456789abcdef01234567"))
+	assert.Error(deny.check("kill", "0123456789abcdef0123456789abcdef01234567"))
+}
+
+func TestSetMethodFilterByName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestMethodFilterGW(t, dir)
+
+	var info contractInfo
+	res := testMethodsPath(router, "PUT", "/contracts/lobster/methods", `{"denyMethods":["kill"]}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Equal([]string{"kill"}, info.DenyMethods)
+	assert.Equal("lobster", info.RegisteredAs)
+
+	var stored contractInfo
+	b, err := ioutil.ReadFile(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	assert.NoError(err)
+	json.Unmarshal(b, &stored)
+	assert.Equal([]string{"kill"}, stored.DenyMethods)
+	assert.Equal(&methodFilter{DenyMethods: []string{"kill"}}, scgw.methodFilterFor("0123456789abcdef0123456789abcdef01234567"))
+	assert.Nil(scgw.methodFilterFor("123456789abcdef0123456789abcdef012345678"))
+
+	info = contractInfo{}
+	res = testMethodsPath(router, "PUT", "/contracts/0x0123456789abcdef0123456789abcdef01234567/methods", `{}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Empty(info.DenyMethods)
+	assert.Nil(scgw.methodFilterFor("0123456789abcdef0123456789abcdef01234567"))
+}
+
+func TestSetMethodFilterBadRequests(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestMethodFilterGW(t, dir)
+
+	var errReply restErrMsg
+	res := testMethodsPath(router, "PUT", "/contracts/lobster/methods", `!json`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid method lists", errReply.Message)
+
+	res = testMethodsPath(router, "PUT", "/contracts/lobster/methods", `{"allowMethods":["get"],"denyMethods":["kill"]}`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Only one of an allow list or a deny list", errReply.Message)
+
+	res = testMethodsPath(router, "PUT", "/contracts/lobster/methods", `{"allowMethods":["destroy"]}`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Method 'destroy' is not declared", errReply.Message)
+
+	res = testMethodsPath(router, "PUT", "/contracts/shrimp/methods", `{"allowMethods":["get"]}`, &errReply)
+	assert.Equal(404, res.Code)
+}
+
+func TestSetMethodFilterRequiresAdmin(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestMethodFilterGW(t, dir)
+
+	testAdminAuthRequired(t, router, "PUT", "/contracts/lobster/methods", `{}`)
+	assert.Nil(scgw.methodFilterFor("0123456789abcdef0123456789abcdef01234567"))
+}
+
+func TestRegisterContractWithMethodFilter(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestMethodFilterGW(t, dir)
+
+	var info contractInfo
+	res := testMethodsPath(router, "POST", "/abis/abi1/0x23456789abcdef0123456789abcdef0123456789?fly-allowmethods=get,set&fly-register=crab", ``, &info)
+	assert.Equal(201, res.Code)
+	assert.Equal([]string{"get", "set"}, info.AllowMethods)
+	assert.Equal(&methodFilter{AllowMethods: []string{"get", "set"}}, scgw.methodFilterFor("23456789abcdef0123456789abcdef0123456789"))
+
+	var errReply restErrMsg
+	res = testMethodsPath(router, "POST", "/abis/abi1/0x3456789abcdef0123456789abcdef0123456789a?fly-denymethods=destroy", ``, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Method 'destroy' is not declared", errReply.Message)
+}
+
+func TestSendTransactionMethodNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.methodFilter = &methodFilter{AllowMethods: []string{"balanceOf"}}
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(403, res.Code)
+	var errReply restErrMsg
+	json.NewDecoder(res.Body).Decode(&errReply)
+	assert.Equal("Method 'transfer' is not allowed on contract 2b8c0ecc76d0759a8f50b2e14a6881367d805832", errReply.Message)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestBulkCallMethodNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.methodFilter = &methodFilter{DenyMethods: []string{"balanceOf"}}
+	rpc := &mockBulkRPC{
+		result: "0x000000000000000000000000000000000000000000000000000000000001e240",
+	}
+	res := newTestBulkCall(t, rpc, abiLoader, "/bulk/balanceOf", map[string]interface{}{
+		"addresses": []string{"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"},
+		"params":    map[string]interface{}{"owner": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"},
+	})
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]map[string]interface{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal(0, rpc.calls)
+	assert.Regexp("Method 'balanceOf' is not allowed", reply["0x567a417717cb6c59ddc1035705f02c0fd1ab1872"]["error"])
+}
+
+func testMethodSelector(t *testing.T, abi ethbinding.ABIMarshaling, name string) []byte {
+	for _, element := range abi {
+		if element.Type == "function" && element.Name == name {
+			method, err := ethbind.API.ABIElementMarshalingToABIMethod(&element)
+			assert.NoError(t, err)
+			return method.ID
+		}
+	}
+	t.Fatalf("No method %s", name)
+	return nil
+}
+
+func TestMethodFilterCheckCalldata(t *testing.T) {
+	assert := assert.New(t)
+
+	kill := testMethodSelector(t, testMethodFilterABI, "kill")
+	get := testMethodSelector(t, testMethodFilterABI, "get")
+
+	var nilFilter *methodFilter
+	assert.NoError(nilFilter.checkCalldata(testMethodFilterABI, kill, "0123456789abcdef0123456789abcdef01234567"))
+
+	deny := &methodFilter{DenyMethods: []string{"kill"}}
+	assert.NoError(deny.checkCalldata(testMethodFilterABI, get, "0123456789abcdef0123456789abcdef01234567"))
+	err := deny.checkCalldata(testMethodFilterABI, append(kill, 0x01, 0x02), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "Method 'kill' is not allowed on contract 0123456789abcdef0123456789abcdef01234567")
+
+	allow := &methodFilter{AllowMethods: []string{"get"}}
+	assert.NoError(allow.checkCalldata(testMethodFilterABI, get, "0123456789abcdef0123456789abcdef01234567"))
+	err = allow.checkCalldata(testMethodFilterABI, []byte{}, "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "Method 'receive' is not allowed on contract 0123456789abcdef0123456789abcdef01234567")
+	err = allow.checkCalldata(testMethodFilterABI, []byte{0xfe, 0xed, 0xbe, 0xef}, "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "Method 'fallback' is not allowed on contract 0123456789abcdef0123456789abcdef01234567")
+}
+
+func TestGatewayCheckMethod(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestMethodFilterGW(t, dir)
+
+	kill := testMethodSelector(t, testMethodFilterABI, "kill")
+	set := testMethodSelector(t, testMethodFilterABI, "set")
+
+	assert.NoError(scgw.CheckMethod("0x0123456789abcdef0123456789abcdef01234567", kill))
+
+	var info contractInfo
+	res := testMethodsPath(router, "PUT", "/contracts/lobster/methods", `{"denyMethods":["kill"]}`, &info)
+	assert.Equal(200, res.Code)
+
+	assert.NoError(scgw.CheckMethod("0x0123456789abcdef0123456789abcdef01234567", set))
+	assert.Regexp("Method 'kill' is not allowed", scgw.CheckMethod("0x0123456789ABCDEF0123456789abcdef01234567", kill))
+	assert.NoError(scgw.CheckMethod("0x23456789abcdef0123456789abcdef0123456789", kill))
+	assert.NoError(scgw.CheckMethod("not an address", kill))
+
+	assert.Regexp("Method 'kill' is not allowed", scgw.CheckSendTransaction(&messages.SendTransaction{
+		To:   "0x0123456789abcdef0123456789abcdef01234567",
+		Data: "0x" + hex.EncodeToString(kill),
+	}))
+	assert.Regexp("Method 'kill' is not allowed", scgw.CheckSendTransaction(&messages.SendTransaction{
+		To:         "0x0123456789abcdef0123456789abcdef01234567",
+		MethodName: "kill",
+	}))
+	assert.NoError(scgw.CheckSendTransaction(&messages.SendTransaction{
+		To:     "0x0123456789abcdef0123456789abcdef01234567",
+		Method: &ethbinding.ABIElementMarshaling{Type: "function", Name: "set"},
+	}))
+	assert.Regexp("Converting supplied 'data' to bytes", scgw.CheckSendTransaction(&messages.SendTransaction{
+		To:   "0x0123456789abcdef0123456789abcdef01234567",
+		Data: "0xnothex",
+	}))
+
+	checker, err := NewStoredMethodChecker(dir)
+	assert.NoError(err)
+	assert.NoError(checker.CheckMethod("0x0123456789abcdef0123456789abcdef01234567", set))
+	assert.Regexp("Method 'kill' is not allowed", checker.CheckMethod("0x0123456789abcdef0123456789abcdef01234567", kill))
+	assert.NoError(checker.CheckMethod("0x3456789abcdef0123456789abcdef0123456789a", kill))
+}
+
+func TestNewStoredMethodCheckerBadPath(t *testing.T) {
+	_, err := NewStoredMethodChecker("/does/not/exist")
+	assert.Regexp(t, "does/not/exist", err)
+}
+
+func TestSendTransactionFallbackCalldataNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	abi := append(ethbinding.ABIMarshaling{{Type: "fallback", StateMutability: "payable"}}, testMethodFilterABI...)
+	abiLoader := &mockABILoader{
+		deployMsg:    &messages.DeployContract{ABI: abi},
+		methodFilter: &methodFilter{DenyMethods: []string{"kill"}},
+	}
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	body, _ := json.Marshal(map[string]interface{}{"data": "0x" + hex.EncodeToString(testMethodSelector(t, abi, "kill"))})
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/fallback", bytes.NewReader(body))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(403, res.Code)
+	var errReply restErrMsg
+	json.NewDecoder(res.Body).Decode(&errReply)
+	assert.Equal("Method 'kill' is not allowed on contract 567a417717cb6c59ddc1035705f02c0fd1ab1872", errReply.Message)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const contractsPathPrefix = "/contracts/"
+
+type registeredNameKey struct{}
+
+// checkRegisteredName validates a friendly name for a contract. Names can be hierarchical,
+// such as payments/escrow/v2, in which case none of the segments can be empty
+func checkRegisteredName(registerAs string) error {
+	if !strings.Contains(registerAs, "/") {
+		return nil
+	}
+	for _, segment := range strings.Split(registerAs, "/") {
+		if segment == "" {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegisteredNameInvalid, registerAs)
+		}
+	}
+	return nil
+}
+
+// registeredNamePath escapes each segment of a friendly name, for use in a URL path
+func registeredNamePath(registerAs string) string {
+	segments := strings.Split(registerAs, "/")
+	for i, segment := range segments {
+		segments[i] = url.QueryEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// inRegisteredNamePrefix checks if a friendly name is under a prefix. A prefix ending
+// in '/' only matches the names below it, otherwise the name itself matches too
+func inRegisteredNamePrefix(registerAs, prefix string) bool {
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(registerAs, prefix)
+	}
+	return registerAs == prefix || strings.HasPrefix(registerAs, prefix+"/")
+}
+
+// WithHierarchicalNames resolves requests for contracts registered under hierarchical names,
+// such as /contracts/payments/escrow/v2/transfer, to the address of the contract before they
+// are routed. The longest registered name matching the start of the path is used
+func (g *smartContractGW) WithHierarchicalNames(parent http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if registerAs, addrPath := g.resolveHierarchicalName(req.URL.Path); addrPath != "" {
+			log.Debugf("Contract '%s' -> %s", registerAs, addrPath)
+			req.URL.Path = addrPath
+			req.URL.RawPath = ""
+			req = req.WithContext(context.WithValue(req.Context(), registeredNameKey{}, registerAs))
+		}
+		parent.ServeHTTP(res, req)
+	})
+}
+
+func (g *smartContractGW) resolveHierarchicalName(path string) (string, string) {
+	if !strings.HasPrefix(path, contractsPathPrefix) {
+		return "", ""
+	}
+	segments := strings.Split(strings.TrimPrefix(path, contractsPathPrefix), "/")
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	for i := len(segments); i > 1; i-- {
+		registerAs := strings.Join(segments[:i], "/")
+		if info, exists := g.contractRegistrations[registerAs]; exists {
+			return registerAs, contractsPathPrefix + strings.Join(append([]string{info.Address}, segments[i:]...), "/")
+		}
+	}
+	return "", ""
+}
+
+// hierarchicalNameFor returns the hierarchical name a request was resolved from, if any
+func hierarchicalNameFor(req *http.Request) (string, bool) {
+	registerAs, ok := req.Context().Value(registeredNameKey{}).(string)
+	return registerAs, ok
+}
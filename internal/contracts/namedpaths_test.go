@@ -0,0 +1,176 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHierarchicalNamesGW(t *testing.T, dir string) (*smartContractGW, http.Handler, string) {
+	scgw, router, abiID := newTestVerifyCodeGateway(t, dir, nil, false, "")
+	for _, reg := range []struct{ addr, name string }{
+		{"0123456789abcdef0123456789abcdef01234567", "payments/escrow"},
+		{"123456789abcdef0123456789abcdef012345678", "payments/escrow/v2"},
+		{"23456789abcdef0123456789abcdef0123456789", "treasury"},
+	} {
+		req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x"+reg.addr+"?fly-register="+reg.name, bytes.NewReader([]byte{}))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, 201, res.Code)
+	}
+	return scgw, scgw.WithHierarchicalNames(router), abiID
+}
+
+func TestCheckRegisteredName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(checkRegisteredName(""))
+	assert.NoError(checkRegisteredName("escrow"))
+	assert.NoError(checkRegisteredName("payments/escrow/v2"))
+	assert.EqualError(checkRegisteredName("payments//v2"), "Invalid registered name 'payments//v2' - the segments of the name separated by '/' cannot be empty")
+	assert.Error(checkRegisteredName("/payments"))
+	assert.Error(checkRegisteredName("payments/"))
+}
+
+func TestInRegisteredNamePrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(inRegisteredNamePrefix("payments/escrow", "payments"))
+	assert.True(inRegisteredNamePrefix("payments", "payments"))
+	assert.True(inRegisteredNamePrefix("payments/escrow", "payments/"))
+	assert.False(inRegisteredNamePrefix("payments", "payments/"))
+	assert.False(inRegisteredNamePrefix("paymentsv2", "payments"))
+	assert.False(inRegisteredNamePrefix("", "payments"))
+}
+
+func TestRegisteredNamePath(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("payments/escrow/v2", registeredNamePath("payments/escrow/v2"))
+	assert.Equal("my+token/v1", registeredNamePath("my token/v1"))
+}
+
+func TestResolveHierarchicalNameLongestMatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _, _ := newTestHierarchicalNamesGW(t, dir)
+
+	name, path := scgw.resolveHierarchicalName("/contracts/payments/escrow/v2/transfer")
+	assert.Equal("payments/escrow/v2", name)
+	assert.Equal("/contracts/123456789abcdef0123456789abcdef012345678/transfer", path)
+
+	name, path = scgw.resolveHierarchicalName("/contracts/payments/escrow/transfer")
+	assert.Equal("payments/escrow", name)
+	assert.Equal("/contracts/0123456789abcdef0123456789abcdef01234567/transfer", path)
+
+	_, path = scgw.resolveHierarchicalName("/contracts/payments/other")
+	assert.Empty(path)
+	_, path = scgw.resolveHierarchicalName("/contracts/treasury/transfer")
+	assert.Empty(path)
+	_, path = scgw.resolveHierarchicalName("/abis/payments/escrow")
+	assert.Empty(path)
+}
+
+func TestGetContractByHierarchicalName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	_, handler, _ := newTestHierarchicalNamesGW(t, dir)
+
+	req := httptest.NewRequest("GET", "/contracts/payments/escrow/v2", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var info contractInfo
+	json.NewDecoder(res.Body).Decode(&info)
+	assert.Equal("123456789abcdef0123456789abcdef012345678", info.Address)
+	assert.Equal("/contracts/payments/escrow/v2", info.Path)
+
+	req = httptest.NewRequest("GET", "/contracts/payments/escrow/v2?swagger", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var swagger spec.Swagger
+	json.NewDecoder(res.Body).Decode(&swagger)
+	assert.Equal("/api/v1/contracts/payments/escrow/v2", swagger.BasePath)
+}
+
+func TestRenameContractByHierarchicalName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, handler, _ := newTestHierarchicalNamesGW(t, dir)
+
+	req := httptest.NewRequest("PATCH", "/contracts/payments/escrow/v2", bytes.NewReader([]byte(`{"registeredAs":"payments/escrow/v3"}`)))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("123456789abcdef0123456789abcdef012345678", scgw.contractRegistrations["payments/escrow/v3"].Address)
+
+	req = httptest.NewRequest("PATCH", "/contracts/payments/escrow/v3", bytes.NewReader([]byte(`{"registeredAs":"payments//v3"}`)))
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+}
+
+func TestRegisterContractInvalidHierarchicalName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, nil, false, "")
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-register=payments/", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+}
+
+func TestListContractsByPrefix(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	_, handler, _ := newTestHierarchicalNamesGW(t, dir)
+
+	list := func(query string) []string {
+		req := httptest.NewRequest("GET", "/contracts"+query, nil)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		assert.Equal(200, res.Code)
+		var infos []contractInfo
+		json.NewDecoder(res.Body).Decode(&infos)
+		names := []string{}
+		for _, info := range infos {
+			names = append(names, info.RegisteredAs)
+		}
+		return names
+	}
+
+	assert.Len(list(""), 3)
+	assert.ElementsMatch([]string{"payments/escrow", "payments/escrow/v2"}, list("?prefix=payments"))
+	assert.ElementsMatch([]string{"payments/escrow/v2"}, list("?prefix=payments/escrow/"))
+	assert.Empty(list("?prefix=pay"))
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOversizedEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := &mockSubMgr{
+		oversizedEvent: &events.OversizedEvent{ID: "ev1", Stream: "es-1", Size: 2048},
+	}
+	var result events.OversizedEvent
+	res := testGWPath("GET", events.StreamPathPrefix+"/es-1/oversized/ev1", &result, sm)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("ev1", sm.capturedEventID)
+	assert.Equal("ev1", result.ID)
+	assert.Equal(2048, result.Size)
+
+	res = testGWPath("GET", events.StreamPathPrefix+"/es-1/oversized/ev1", nil, &mockSubMgr{err: fmt.Errorf("not found")})
+	assert.Equal(404, res.Result().StatusCode)
+
+	res = testGWPath("GET", events.StreamPathPrefix+"/es-1/oversized/ev1", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestDeleteOversizedEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := &mockSubMgr{}
+	res := testGWPath("DELETE", events.StreamPathPrefix+"/es-1/oversized/ev1", nil, sm)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal("ev1", sm.capturedEventID)
+
+	res = testGWPath("DELETE", events.StreamPathPrefix+"/es-1/oversized/ev1", nil, &mockSubMgr{err: fmt.Errorf("not found")})
+	assert.Equal(404, res.Result().StatusCode)
+
+	res = testGWPath("DELETE", events.StreamPathPrefix+"/es-1/oversized/ev1", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
@@ -0,0 +1,273 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	"github.com/kaleido-io/ethconnect/pkg/plugins"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultParamTransformHookTimeout = 10 * time.Second
+)
+
+// defaultParamTransformForwardHeaders are the request headers sent to a webhook when it does
+// not configure forwardHeaders. Credentials such as the Authorization header are never sent
+// unless they are listed explicitly
+var defaultParamTransformForwardHeaders = []string{"x-firefly-*"}
+
+var paramTransformer plugins.ParamTransformer
+
+// RegisterParamTransformer is the plug point to register a parameter transformer
+func RegisterParamTransformer(pt plugins.ParamTransformer) {
+	paramTransformer = pt
+}
+
+// ParamTransformHookConf configures a webhook that can rewrite the parameters and headers of
+// requests to invoke methods, or deploy contracts, before they are encoded. The webhook is sent
+// a POST of the request, and returns it with any changes, or a 204 to leave it unchanged.
+// Only the request headers matching ForwardHeaders are sent, and can be changed
+type ParamTransformHookConf struct {
+	Name           string            `json:"name,omitempty"`
+	URL            string            `json:"url,omitempty"`
+	Headers        utils.HTTPHeaders `json:"headers,omitempty"`
+	ForwardHeaders []string          `json:"forwardHeaders,omitempty"`
+	Methods        []string          `json:"methods,omitempty"`
+	TimeoutSec     int               `json:"timeoutSec,omitempty"`
+}
+
+// paramTransformError carries the status to return to the caller for a failed transform
+type paramTransformError struct {
+	status int
+	err    error
+}
+
+func (e *paramTransformError) Error() string {
+	return e.err.Error()
+}
+
+// validateParamTransformHooks checks each hook has a webhook URL
+func validateParamTransformHooks(hooks []ParamTransformHookConf) error {
+	for i, hook := range hooks {
+		if hook.URL == "" {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayParamTransformHookInvalid, i)
+		}
+	}
+	return nil
+}
+
+func (hook *ParamTransformHookConf) String() string {
+	if hook.Name != "" {
+		return hook.Name
+	}
+	return hook.URL
+}
+
+// appliesTo returns true if the hook has no method list, or the method is in the list
+func (hook *ParamTransformHookConf) appliesTo(method string) bool {
+	if len(hook.Methods) == 0 {
+		return true
+	}
+	for _, m := range hook.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwards returns true if a request header is sent to the webhook. Entries ending with
+// a * match a prefix, and all are case insensitive
+func (hook *ParamTransformHookConf) forwards(header string) bool {
+	allowed := hook.ForwardHeaders
+	if len(allowed) == 0 {
+		allowed = defaultParamTransformForwardHeaders
+	}
+	header = strings.ToLower(header)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if strings.HasSuffix(a, "*") {
+			if strings.HasPrefix(header, strings.TrimSuffix(a, "*")) {
+				return true
+			}
+		} else if header == a {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHeaders returns the request headers that are sent to the webhook
+func (hook *ParamTransformHookConf) forwardedHeaders(headers map[string][]string) map[string][]string {
+	forwarded := make(map[string][]string)
+	for name, values := range headers {
+		if hook.forwards(name) {
+			forwarded[name] = values
+		}
+	}
+	return forwarded
+}
+
+// applyParamTransforms runs the transforms for a method invocation or deployment, before the
+// fly- parameters are read and the inputs are encoded. Inputs passed on the query string are
+// included in the params, so the transforms see every input the same way
+func (r *rest2eth) applyParamTransforms(req *http.Request, c *restCmd) error {
+	method := c.abiMethod.Name
+	if c.isDeploy {
+		method = "constructor"
+	} else if c.isFallback() {
+		method = c.abiMethodElem.Type
+	}
+	ptr := &plugins.ParamTransformRequest{
+		Address: c.addr,
+		Method:  method,
+		Params:  make(map[string]interface{}, len(c.body)),
+		Headers: req.Header.Clone(),
+	}
+	for k, v := range c.body {
+		ptr.Params[k] = v
+	}
+	req.ParseForm()
+	for i, abiParam := range c.abiMethod.Inputs {
+		argName := abiInputName(i, abiParam)
+		if _, exists := ptr.Params[argName]; !exists {
+			if vs := req.Form[argName]; len(vs) > 0 {
+				ptr.Params[argName] = vs[0]
+			}
+		}
+	}
+	if err := r.transformParams(req.Context(), ptr); err != nil {
+		return err
+	}
+	c.body = ptr.Params
+	req.Header = http.Header{}
+	for name, values := range ptr.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	return nil
+}
+
+// transformParams passes the request through the registered plugin, then each of the
+// configured webhooks in order. Each sees the changes made by those before it
+func (r *rest2eth) transformParams(ctx context.Context, ptr *plugins.ParamTransformRequest) error {
+	if paramTransformer != nil {
+		if err := paramTransformer.TransformParams(ptr); err != nil {
+			return &paramTransformError{
+				status: 400,
+				err:    ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayParamTransformFailed, "plugin", err),
+			}
+		}
+	}
+	for i := range r.paramTransformHooks {
+		hook := &r.paramTransformHooks[i]
+		if !hook.appliesTo(ptr.Method) {
+			continue
+		}
+		if status, err := hook.run(ctx, ptr); err != nil {
+			log.Errorf("Parameter transform '%s' failed for method '%s': %s", hook, ptr.Method, err)
+			return &paramTransformError{
+				status: status,
+				err:    ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayParamTransformFailed, hook, err),
+			}
+		}
+	}
+	if ptr.Params == nil {
+		ptr.Params = make(map[string]interface{})
+	}
+	return nil
+}
+
+// run sends the request to the webhook, and updates it from the response. A 4xx from the
+// webhook rejects the request with a 400, while any other failure is reported as a 502.
+// The call is abandoned if the caller disconnects
+func (hook *ParamTransformHookConf) run(ctx context.Context, ptr *plugins.ParamTransformRequest) (int, error) {
+	timeout := defaultParamTransformHookTimeout
+	if hook.TimeoutSec > 0 {
+		timeout = time.Duration(hook.TimeoutSec) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	payload, _ := json.Marshal(&plugins.ParamTransformRequest{
+		Address: ptr.Address,
+		Method:  ptr.Method,
+		Params:  ptr.Params,
+		Headers: hook.forwardedHeaders(ptr.Headers),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 502, err
+	}
+	for name, values := range hook.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: timeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return 502, err
+	}
+	defer res.Body.Close()
+	resBody, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode == 204 {
+		return 0, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		status := 502
+		if res.StatusCode >= 400 && res.StatusCode < 500 {
+			status = 400
+		}
+		return status, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayParamTransformStatus, res.StatusCode, strings.TrimSpace(string(resBody)))
+	}
+	var transformed plugins.ParamTransformRequest
+	if err := utils.UnmarshalJSONNumbers(resBody, &transformed); err != nil {
+		return 502, err
+	}
+	// Only the parameters and forwarded headers can be changed, and each is only replaced if returned
+	if transformed.Params != nil {
+		ptr.Params = transformed.Params
+	}
+	if transformed.Headers != nil {
+		headers := make(map[string][]string, len(ptr.Headers))
+		for name, values := range ptr.Headers {
+			if !hook.forwards(name) {
+				headers[name] = values
+			}
+		}
+		for name, values := range transformed.Headers {
+			if hook.forwards(name) {
+				headers[name] = values
+			} else {
+				log.Warnf("Parameter transform '%s' returned header '%s', which is not forwarded to it", hook, name)
+			}
+		}
+		ptr.Headers = headers
+	}
+	return 0, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/kaleido-io/ethconnect/pkg/plugins"
+	"github.com/stretchr/testify/assert"
+)
+
+type testParamTransformer struct {
+	calls []*plugins.ParamTransformRequest
+	err   error
+}
+
+func (pt *testParamTransformer) TransformParams(req *plugins.ParamTransformRequest) error {
+	pt.calls = append(pt.calls, req)
+	if pt.err != nil {
+		return pt.err
+	}
+	req.Params["s"] = strings.ToUpper(req.Params["s"].(string))
+	req.Headers["X-Firefly-From"] = []string{"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}
+	return nil
+}
+
+func testParamTransformRequest(t *testing.T, url string, hooks []ParamTransformHookConf) (*mockREST2EthDispatcher, *httptest.ResponseRecorder, *http.Request) {
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	r, _, router := newTestREST2Eth(t, dispatcher)
+	r.paramTransformHooks = hooks
+	req := httptest.NewRequest("POST", url, bytes.NewReader([]byte(`{"s":"testing"}`)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return dispatcher, res, req
+}
+
+func TestParamTransformPlugin(t *testing.T) {
+	assert := assert.New(t)
+
+	pt := &testParamTransformer{}
+	RegisterParamTransformer(pt)
+	defer RegisterParamTransformer(nil)
+
+	dispatcher, res, req := testParamTransformRequest(t, "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=12345", nil)
+
+	assert.Equal(202, res.Code)
+	assert.Equal(1, len(pt.calls))
+	assert.Equal("set", pt.calls[0].Method)
+	assert.Equal("0x567a417717cb6c59ddc1035705f02c0fd1ab1872", pt.calls[0].Address)
+	assert.Equal("12345", pt.calls[0].Params["i"])
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", req.Header.Get("x-firefly-from"))
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.asyncDispatchMsg["from"])
+	assert.Equal([]interface{}{"12345", "TESTING"}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestParamTransformPluginError(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterParamTransformer(&testParamTransformer{err: fmt.Errorf("pop")})
+	defer RegisterParamTransformer(nil)
+
+	dispatcher, res, _ := testParamTransformRequest(t, "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=12345", nil)
+
+	assert.Equal(400, res.Code)
+	assert.Regexp("Parameter transform 'plugin' failed: pop", res.Body.String())
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestParamTransformWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	var received plugins.ParamTransformRequest
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("abc", req.Header.Get("x-api-key"))
+		json.NewDecoder(req.Body).Decode(&received)
+		res.Write([]byte(`{"params":{"i":123456789012345678901234567890,"s":"transformed"},"headers":{"x-firefly-from":["0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"]}}`))
+	}))
+	defer svr.Close()
+
+	dispatcher, res, _ := testParamTransformRequest(t, "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=1", []ParamTransformHookConf{
+		{Name: "skipped", URL: "http://localhost:0", Methods: []string{"other"}},
+		{URL: svr.URL, Headers: map[string][]string{"x-api-key": {"abc"}}, Methods: []string{"SET"}},
+	})
+
+	assert.Equal(202, res.Code)
+	assert.Equal("set", received.Method)
+	assert.Equal(map[string]interface{}{"i": "1", "s": "testing"}, received.Params)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.asyncDispatchMsg["from"])
+	assert.Equal([]interface{}{json.Number("123456789012345678901234567890"), "transformed"}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestParamTransformWebhookForwardHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	var received plugins.ParamTransformRequest
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		json.NewDecoder(req.Body).Decode(&received)
+		res.Write([]byte(`{"headers":{"x-firefly-from":["0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"],"Authorization":["Bearer changed"]}}`))
+	}))
+	defer svr.Close()
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	r, _, router := newTestREST2Eth(t, dispatcher)
+	r.paramTransformHooks = []ParamTransformHookConf{{URL: svr.URL}}
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=1", bytes.NewReader([]byte(`{"s":"testing"}`)))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("X-Firefly-Gas", "12345")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Code)
+	assert.Equal(map[string][]string{"X-Firefly-Gas": {"12345"}}, received.Headers)
+	assert.Equal("Bearer secret", req.Header.Get("Authorization"))
+	assert.Equal("session=secret", req.Header.Get("Cookie"))
+	assert.Equal("", req.Header.Get("X-Firefly-Gas"))
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", dispatcher.asyncDispatchMsg["from"])
+
+	hook := &ParamTransformHookConf{ForwardHeaders: []string{"Authorization", "x-custom-*"}}
+	assert.True(hook.forwards("authorization"))
+	assert.True(hook.forwards("X-Custom-Id"))
+	assert.False(hook.forwards("X-Firefly-From"))
+}
+
+func TestParamTransformWebhookNoContent(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(204)
+	}))
+	defer svr.Close()
+
+	dispatcher, res, _ := testParamTransformRequest(t, "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=1", []ParamTransformHookConf{
+		{URL: svr.URL},
+	})
+	assert.Equal(202, res.Code)
+	assert.Equal([]interface{}{"1", "testing"}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestParamTransformWebhookRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(422)
+		res.Write([]byte(`unknown customer`))
+	}))
+	defer svr.Close()
+
+	_, res, _ := testParamTransformRequest(t, "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=1", []ParamTransformHookConf{
+		{Name: "lookup", URL: svr.URL},
+	})
+	assert.Equal(400, res.Code)
+	assert.Regexp("Parameter transform 'lookup' failed: Parameter transform webhook returned status 422: unknown customer", res.Body.String())
+}
+
+func TestParamTransformWebhookFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(`!json`))
+	}))
+	defer svr.Close()
+
+	_, res, _ := testParamTransformRequest(t, "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?i=1", []ParamTransformHookConf{
+		{URL: svr.URL, TimeoutSec: 1},
+	})
+	assert.Equal(502, res.Code)
+	assert.Regexp("Parameter transform '"+svr.URL+"' failed", res.Body.String())
+}
+
+func TestParamTransformHooksInvalid(t *testing.T) {
+	_, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			ParamTransformHooks: []ParamTransformHookConf{
+				{Name: "missing"},
+			},
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.Regexp(t, "Parameter transform hook 0 must have a url", err)
+}
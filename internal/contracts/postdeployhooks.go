@@ -0,0 +1,166 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"time"
+
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPostDeployHookTimeout = 30 * time.Second
+)
+
+// PostDeployHookConf configures a hook that is run after each successful deployment. A hook
+// is either a webhook, which is sent a POST of the deployment details, or a script, which
+// is run with the deployment details as JSON on stdin
+type PostDeployHookConf struct {
+	Name       string            `json:"name,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	Headers    utils.HTTPHeaders `json:"headers,omitempty"`
+	Script     []string          `json:"script,omitempty"`
+	TimeoutSec int               `json:"timeoutSec,omitempty"`
+}
+
+// postDeployDetails are passed to each hook
+type postDeployDetails struct {
+	Address         string `json:"address"`
+	ABI             string `json:"abi"`
+	RegisteredAs    string `json:"registeredAs,omitempty"`
+	Deployer        string `json:"deployer,omitempty"`
+	TransactionHash string `json:"transactionHash,omitempty"`
+	BlockNumber     string `json:"blockNumber,omitempty"`
+	RequestID       string `json:"requestId,omitempty"`
+	OpenAPI         string `json:"openapi,omitempty"`
+}
+
+// validatePostDeployHooks checks each hook is either a webhook or a script, but not both
+func validatePostDeployHooks(hooks []PostDeployHookConf) error {
+	for i, hook := range hooks {
+		if (hook.URL == "") == (len(hook.Script) == 0) {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayPostDeployHookInvalid, i)
+		}
+	}
+	return nil
+}
+
+func (hook *PostDeployHookConf) String() string {
+	if hook.Name != "" {
+		return hook.Name
+	}
+	if hook.URL != "" {
+		return hook.URL
+	}
+	return hook.Script[0]
+}
+
+// runPostDeployHooks runs the configured hooks in order, in the background so they do not delay
+// the processing of the receipt. A failing hook is logged, and does not stop those that follow.
+// Hooks still running on shutdown are cancelled, and the shutdown waits for them to exit
+func (g *smartContractGW) runPostDeployHooks(msg *messages.TransactionReceipt, abiID, addrHexNo0x, registeredName string) {
+	if len(g.conf.PostDeployHooks) == 0 {
+		return
+	}
+	details := &postDeployDetails{
+		Address:      "0x" + addrHexNo0x,
+		ABI:          abiID,
+		RegisteredAs: registeredName,
+		BlockNumber:  msg.BlockNumberStr,
+		RequestID:    msg.Headers.ReqID,
+		OpenAPI:      msg.ContractSwagger,
+	}
+	if msg.From != nil {
+		details.Deployer = msg.From.Hex()
+	}
+	if msg.TransactionHash != nil {
+		details.TransactionHash = msg.TransactionHash.String()
+	}
+	payload, _ := json.Marshal(details)
+	g.hooksWG.Add(1)
+	go func() {
+		defer g.hooksWG.Done()
+		for i := range g.conf.PostDeployHooks {
+			if g.hooksCtx.Err() != nil {
+				log.Warnf("Post-deploy hooks for %s cancelled by shutdown", details.Address)
+				return
+			}
+			hook := &g.conf.PostDeployHooks[i]
+			if err := hook.run(g.hooksCtx, payload); err != nil {
+				log.Errorf("Post-deploy hook '%s' failed for %s: %s", hook, details.Address, err)
+			} else {
+				log.Infof("Post-deploy hook '%s' completed for %s", hook, details.Address)
+			}
+		}
+	}()
+}
+
+func (hook *PostDeployHookConf) run(ctx context.Context, payload []byte) error {
+	timeout := defaultPostDeployHookTimeout
+	if hook.TimeoutSec > 0 {
+		timeout = time.Duration(hook.TimeoutSec) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if hook.URL != "" {
+		return hook.sendWebhook(ctx, payload)
+	}
+	return hook.runScript(ctx, payload)
+}
+
+func (hook *PostDeployHookConf) sendWebhook(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	for name, values := range hook.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayPostDeployHookStatus, res.StatusCode)
+	}
+	return nil
+}
+
+func (hook *PostDeployHookConf) runScript(ctx context.Context, payload []byte) error {
+	cmd := exec.CommandContext(ctx, hook.Script[0], hook.Script[1:]...)
+	var output bytes.Buffer
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayPostDeployHookScript, err, output.String())
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPostDeployHooksGW(t *testing.T, dir string, hooks []PostDeployHookConf) *smartContractGW {
+	s, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath:     dir,
+			BaseURL:         "http://localhost/api/v1",
+			PostDeployHooks: hooks,
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.NoError(t, err)
+	return s.(*smartContractGW)
+}
+
+func TestPostDeployHooksInvalid(t *testing.T) {
+	_, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			PostDeployHooks: []PostDeployHookConf{
+				{URL: "http://localhost:12345"},
+				{URL: "http://localhost:12345", Script: []string{"true"}},
+			},
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.Regexp(t, "Post-deploy hook 1 must have either a url or a script", err)
+}
+
+func TestPostDeployHooksWebhookAndScript(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	received := make(chan map[string]interface{}, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("secret", req.Header.Get("x-api-key"))
+		var details map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&details)
+		received <- details
+		res.WriteHeader(204)
+	}))
+	defer svr.Close()
+
+	scriptOutput := path.Join(dir, "hook.json")
+	scgw := newTestPostDeployHooksGW(t, dir, []PostDeployHookConf{
+		{Name: "explorer", URL: svr.URL, Headers: map[string][]string{"x-api-key": {"secret"}}},
+		{Script: []string{"sh", "-c", "cat > " + scriptOutput}},
+	})
+
+	receipt := newTestDeployReceipt("message1")
+	from := ethbind.API.HexToAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	receipt.From = &from
+	err := scgw.PostDeploy(receipt)
+	assert.NoError(err)
+
+	details := <-received
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", details["address"])
+	assert.Equal("message1", details["abi"])
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", strings.ToLower(details["deployer"].(string)))
+	assert.Equal("message1", details["requestId"])
+
+	// Shutdown waits for the script to complete
+	scgw.Shutdown()
+	var scriptDetails map[string]interface{}
+	b, err := ioutil.ReadFile(scriptOutput)
+	assert.NoError(err)
+	json.Unmarshal(b, &scriptDetails)
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", scriptDetails["address"])
+}
+
+func TestPostDeployHooksCancelledOnShutdown(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	started := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-req.Context().Done()
+	}))
+	defer svr.Close()
+
+	nextHook := path.Join(dir, "next.json")
+	scgw := newTestPostDeployHooksGW(t, dir, []PostDeployHookConf{
+		{URL: svr.URL},
+		{Script: []string{"sh", "-c", "cat > " + nextHook}},
+	})
+	err := scgw.PostDeploy(newTestDeployReceipt("message1"))
+	assert.NoError(err)
+
+	// The blocked webhook is cancelled, and the hooks after it are not run
+	<-started
+	scgw.Shutdown()
+	_, err = os.Stat(nextHook)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestPostDeployHooksNotRunForFailure(t *testing.T) {
+	dir := tempdir()
+	defer cleanup(dir)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Fail(t, "Hook should not be called")
+	}))
+	defer svr.Close()
+
+	scgw := newTestPostDeployHooksGW(t, dir, []PostDeployHookConf{{URL: svr.URL}})
+	receipt := newTestDeployReceipt("message1")
+	receipt.Headers.MsgType = messages.MsgTypeTransactionFailure
+	err := scgw.PostDeploy(receipt)
+	assert.NoError(t, err)
+	scgw.Shutdown()
+}
+
+func TestPostDeployHookErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer svr.Close()
+
+	hook := &PostDeployHookConf{URL: svr.URL}
+	assert.Regexp("Post-deploy webhook returned status 500", hook.run(context.Background(), []byte(`{}`)))
+	assert.Equal(svr.URL, hook.String())
+
+	hook = &PostDeployHookConf{Script: []string{"sh", "-c", "echo pop >&2; exit 1"}, TimeoutSec: 5}
+	assert.Regexp("Post-deploy script failed: exit status 1: pop", hook.run(context.Background(), []byte(`{}`)))
+	assert.Equal("sh", hook.String())
+}
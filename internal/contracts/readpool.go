@@ -0,0 +1,96 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReadPoolConnections     = 2
+	defaultReadPoolQueueTimeoutSec = 10
+)
+
+// ReadPoolConf configures a dedicated pool of workers and JSON/RPC connections for read-only
+// eth_call requests, so they are not queued behind transactions on the same connection
+type ReadPoolConf struct {
+	Workers         int             `json:"workers"` // 0=disabled
+	Connections     int             `json:"connections"`
+	QueueTimeoutSec int             `json:"queueTimeoutSec"`
+	RPC             eth.RPCConnOpts `json:"rpc"` // defaults to the rpc connection of the gateway
+}
+
+// readPool limits the read-only calls in progress to the number of workers, and spreads
+// them across its own JSON/RPC connections
+type readPool struct {
+	workers      chan bool
+	conns        []eth.RPCClientAll
+	next         uint32
+	queueTimeout time.Duration
+}
+
+var readPoolConnect = eth.RPCConnect
+
+func newReadPool(conf *ReadPoolConf) (*readPool, error) {
+	if conf.Connections <= 0 {
+		conf.Connections = defaultReadPoolConnections
+	}
+	if conf.QueueTimeoutSec <= 0 {
+		conf.QueueTimeoutSec = defaultReadPoolQueueTimeoutSec
+	}
+	p := &readPool{
+		workers:      make(chan bool, conf.Workers),
+		conns:        make([]eth.RPCClientAll, 0, conf.Connections),
+		queueTimeout: time.Duration(conf.QueueTimeoutSec) * time.Second,
+	}
+	for i := 0; i < conf.Connections; i++ {
+		conn, err := readPoolConnect(&conf.RPC)
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	log.Infof("Read-only calls served by %d workers, over %d JSON/RPC connections", conf.Workers, conf.Connections)
+	return p, nil
+}
+
+// acquire waits for a free worker, returning the connection to make the call on, and the
+// function to release the worker once the call is complete
+func (p *readPool) acquire(ctx context.Context) (eth.RPCClient, func(), error) {
+	timer := time.NewTimer(p.queueTimeout)
+	defer timer.Stop()
+	select {
+	case p.workers <- true:
+	case <-timer.C:
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayReadPoolBusy, cap(p.workers), p.queueTimeout)
+	case <-ctx.Done():
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayReadPoolBusy, cap(p.workers), p.queueTimeout)
+	}
+	i := atomic.AddUint32(&p.next, 1)
+	return p.conns[int(i)%len(p.conns)], func() { <-p.workers }, nil
+}
+
+func (p *readPool) close() {
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+}
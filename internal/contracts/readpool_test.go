@@ -0,0 +1,155 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockReadConn struct {
+	mockRPC
+	closed bool
+}
+
+func (m *mockReadConn) Close() {
+	m.closed = true
+}
+
+func (m *mockReadConn) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (eth.RPCClientSubscription, error) {
+	return nil, fmt.Errorf("not supported")
+}
+
+func TestReadPoolRoundRobinAndBusy(t *testing.T) {
+	assert := assert.New(t)
+
+	var conns []*mockReadConn
+	readPoolConnect = func(conf *eth.RPCConnOpts) (eth.RPCClientAll, error) {
+		conn := &mockReadConn{}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	defer func() { readPoolConnect = eth.RPCConnect }()
+
+	conf := &ReadPoolConf{Workers: 2}
+	p, err := newReadPool(conf)
+	assert.NoError(err)
+	assert.Equal(defaultReadPoolConnections, conf.Connections)
+	assert.Equal(defaultReadPoolQueueTimeoutSec, conf.QueueTimeoutSec)
+	assert.Len(conns, 2)
+	p.queueTimeout = 10 * time.Millisecond
+
+	rpc1, release1, err := p.acquire(context.Background())
+	assert.NoError(err)
+	rpc2, release2, err := p.acquire(context.Background())
+	assert.NoError(err)
+	assert.NotSame(rpc1, rpc2)
+
+	_, _, err = p.acquire(context.Background())
+	assert.EqualError(err, "All 2 read-only call workers remained busy for 10ms")
+
+	release1()
+	_, release3, err := p.acquire(context.Background())
+	assert.NoError(err)
+	release2()
+	release3()
+
+	p.close()
+	assert.True(conns[0].closed)
+	assert.True(conns[1].closed)
+}
+
+func TestReadPoolCancelledWhileQueued(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &readPool{
+		workers:      make(chan bool, 1),
+		conns:        []eth.RPCClientAll{&mockReadConn{}},
+		queueTimeout: 10 * time.Second,
+	}
+	p.workers <- true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := p.acquire(ctx)
+	assert.Regexp("read-only call workers remained busy", err)
+}
+
+func TestReadPoolConnectFail(t *testing.T) {
+	assert := assert.New(t)
+
+	var conns []*mockReadConn
+	readPoolConnect = func(conf *eth.RPCConnOpts) (eth.RPCClientAll, error) {
+		if len(conns) > 0 {
+			return nil, fmt.Errorf("pop")
+		}
+		conn := &mockReadConn{}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+	defer func() { readPoolConnect = eth.RPCConnect }()
+
+	_, err := newReadPool(&ReadPoolConf{Workers: 1, Connections: 3})
+	assert.EqualError(err, "pop")
+	assert.True(conns[0].closed)
+}
+
+func TestCallMethodReadPool(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, mockRPC, router, res, _ := newTestREST2EthAndMsg(t, &mockREST2EthDispatcher{}, "", to, map[string]interface{}{})
+	poolConn := &mockReadConn{}
+	poolConn.result = "0x000000000000000000000000000000000000000000000000000000000001e2400000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000000774657374696e6700000000000000000000000000000000000000000000000000"
+	r.readPool = &readPool{
+		workers:      make(chan bool, 1),
+		conns:        []eth.RPCClientAll{poolConn},
+		queueTimeout: 10 * time.Millisecond,
+	}
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/get", bytes.NewReader([]byte{}))
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("eth_call", poolConn.capturedMethod)
+	assert.Equal("", mockRPC.capturedMethod)
+	assert.Empty(r.readPool.workers)
+}
+
+func TestCallMethodReadPoolBusy(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	r, _, router, res, _ := newTestREST2EthAndMsg(t, &mockREST2EthDispatcher{}, "", to, map[string]interface{}{})
+	r.readPool = &readPool{
+		workers:      make(chan bool, 1),
+		conns:        []eth.RPCClientAll{&mockReadConn{}},
+		queueTimeout: 10 * time.Millisecond,
+	}
+	r.readPool.workers <- true
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/get", bytes.NewReader([]byte{}))
+	router.ServeHTTP(res, req)
+
+	assert.Equal(503, res.Result().StatusCode)
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/openapi"
+	log "github.com/sirupsen/logrus"
+)
+
+// regenerateSwagger rebuilds the details stored for an ABI or a contract instance when the
+// OpenAPI definition was generated, using the current configuration. This picks up changes
+// such as a new base URL, without the Solidity being uploaded again. Regenerating an instance
+// also regenerates the ABI it was registered against
+func (g *smartContractGW) regenerateSwagger(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var updated interface{}
+	var err error
+	status := 404
+	if abiID := params.ByName("abi"); abiID != "" {
+		g.idxLock.Lock()
+		updated, status, err = g.regenerateABI(strings.ToLower(abiID))
+		g.idxLock.Unlock()
+	} else {
+		id := params.ByName("address")
+		addrHexNo0x, _ := normalizeAddress(id)
+		g.idxLock.Lock()
+		if _, exists := g.contractIndex[addrHexNo0x]; !exists {
+			addrHexNo0x, err = g.resolveContractAddr(id)
+		}
+		g.idxLock.Unlock()
+		if err == nil {
+			updated, status, err = g.regenerateContract(addrHexNo0x)
+		}
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, status)
+		return
+	}
+
+	status = 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(updated)
+}
+
+// regenerateABI generates the OpenAPI definition of an ABI again, storing the description parsed
+// from its devdoc and updating its URL. The caller must hold the index lock
+func (g *smartContractGW) regenerateABI(abiID string) (*abiInfo, int, error) {
+	deployMsg, info, err := g.loadDeployMsgByID(abiID)
+	if err != nil {
+		if _, exists := g.abiIndex[abiID]; !exists {
+			return nil, 404, err
+		}
+		return nil, 500, err
+	}
+	runtimeABI, err := eth.RuntimeABI(deployMsg.ABI)
+	if err != nil {
+		return nil, 500, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidABI, err)
+	}
+	swagger := g.swaggerForABI(openapi.NewABI2Swagger(g.baseSwaggerConf), abiID, deployMsg.ContractName, false, runtimeABI, deployMsg.DevDoc, deployMsg.UserDoc, "", "")
+	deployMsg.Description = swagger.Info.Description
+	if err := g.writeAbiInfo(abiID, deployMsg); err != nil {
+		return nil, 500, err
+	}
+	updated := *info
+	updated.Description = deployMsg.Description
+	updated.Path = "/abis/" + abiID
+	updated.SwaggerURL = g.conf.BaseURL + "/abis/" + abiID + "?swagger"
+	g.abiIndex[abiID] = &updated
+	log.Infof("%s: Regenerated OpenAPI definition of ABI", abiID)
+	return &updated, 200, nil
+}
+
+// regenerateContract regenerates the ABI of a contract instance, then rewrites its instance file
+// with the path and URL of its OpenAPI definition under the current configuration
+func (g *smartContractGW) regenerateContract(addrHexNo0x string) (*contractInfo, int, error) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	ts, exists := g.contractIndex[addrHexNo0x]
+	if !exists {
+		return nil, 404, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x)
+	}
+	info := ts.(*contractInfo)
+	if _, status, err := g.regenerateABI(info.ABI); err != nil {
+		return nil, status, err
+	}
+	updated := g.withContractName(info, info.RegisteredAs)
+	if err := g.writeContractInfo(updated); err != nil {
+		return nil, 500, err
+	}
+	if updated.RegisteredAs != "" {
+		g.contractRegistrations[updated.RegisteredAs] = updated
+	}
+	g.contractIndex[addrHexNo0x] = updated
+	log.Infof("%s: Regenerated OpenAPI definition of contract instance", addrHexNo0x)
+	return updated, 200, nil
+}
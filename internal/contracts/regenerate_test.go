@@ -0,0 +1,144 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRegeneratePath(router *httprouter.Router, path string, results interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", path, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(results)
+	return res
+}
+
+func newTestRegenerateGW(dir string) (*smartContractGW, *httprouter.Router) {
+	scgw, router := newTestRenameGW(dir)
+	deployMsg := &messages.DeployContract{
+		ContractName: "Lobster",
+		ABI:          ethbinding.ABIMarshaling{},
+		DevDoc:       `{"details":"Claws"}`,
+	}
+	scgw.writeAbiInfo("abi1", deployMsg)
+	scgw.addToABIIndex("abi1", deployMsg, time.Now().UTC())
+	return scgw, router
+}
+
+func TestRegenerateABI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRegenerateGW(dir)
+	scgw.conf.BaseURL = "https://gateway.example.com/api/v1"
+
+	var info abiInfo
+	res := testRegeneratePath(router, "/abis/ABI1/regenerate", &info)
+	assert.Equal(200, res.Code)
+	assert.Equal("https://gateway.example.com/api/v1/abis/abi1?swagger", info.SwaggerURL)
+	assert.Equal("Claws", info.Description)
+	assert.Equal("Claws", scgw.abiIndex["abi1"].(*abiInfo).Description)
+
+	var stored messages.DeployContract
+	b, err := ioutil.ReadFile(path.Join(dir, "abi_abi1.deploy.json"))
+	assert.NoError(err)
+	json.Unmarshal(b, &stored)
+	assert.Equal("Claws", stored.Description)
+}
+
+func TestRegenerateContract(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRegenerateGW(dir)
+	scgw.conf.BaseURL = "https://gateway.example.com/api/v1"
+
+	var info contractInfo
+	res := testRegeneratePath(router, "/contracts/lobster/regenerate", &info)
+	assert.Equal(200, res.Code)
+	assert.Equal("https://gateway.example.com/api/v1/contracts/lobster?swagger", info.SwaggerURL)
+	assert.Equal("lobster", info.RegisteredAs)
+	assert.Equal(info.SwaggerURL, scgw.contractRegistrations["lobster"].SwaggerURL)
+	assert.Equal("https://gateway.example.com/api/v1/abis/abi1?swagger", scgw.abiIndex["abi1"].(*abiInfo).SwaggerURL)
+
+	var stored contractInfo
+	b, err := ioutil.ReadFile(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	assert.NoError(err)
+	json.Unmarshal(b, &stored)
+	assert.Equal(info.SwaggerURL, stored.SwaggerURL)
+
+	info = contractInfo{}
+	res = testRegeneratePath(router, "/contracts/0x123456789abcdef0123456789abcdef012345678/regenerate", &info)
+	assert.Equal(200, res.Code)
+	assert.Equal("https://gateway.example.com/api/v1/contracts/123456789abcdef0123456789abcdef012345678?swagger", info.SwaggerURL)
+}
+
+func TestRegenerateNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRegenerateGW(dir)
+
+	var errReply restErrMsg
+	res := testRegeneratePath(router, "/abis/abi2/regenerate", &errReply)
+	assert.Equal(404, res.Code)
+	res = testRegeneratePath(router, "/contracts/shrimp/regenerate", &errReply)
+	assert.Equal(404, res.Code)
+}
+
+func TestRegenerateRequiresAdmin(t *testing.T) {
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRegenerateGW(dir)
+
+	testAdminAuthRequired(t, router, "PUT", "/abis/abi1/regenerate", "")
+	testAdminAuthRequired(t, router, "PUT", "/contracts/lobster/regenerate", "")
+}
+
+func TestRegenerateContractMissingABI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var errReply restErrMsg
+	res := testRegeneratePath(router, "/contracts/lobster/regenerate", &errReply)
+	assert.Equal(404, res.Code)
+	assert.Equal("No ABI found with ID abi1", errReply.Message)
+}
+
+func TestRegenerateABILoadFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRegenerateGW(dir)
+	scgw.abiIndex["abi2"] = scgw.abiIndex["abi1"]
+
+	var errReply restErrMsg
+	res := testRegeneratePath(router, "/abis/abi2/regenerate", &errReply)
+	assert.Equal(500, res.Code)
+	assert.Regexp("abi2", errReply.Message)
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"net/url"
 	"strings"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/errors"
@@ -37,6 +38,10 @@ const (
 	defaultDevdocProp     = "devdoc"
 	defaultDeployableProp = "deployable"
 	defaultAddressProp    = "address"
+
+	defaultRemoteRegistryTimeoutSec       = 30
+	defaultRemoteRegistryMaxResponseBytes = 16 * 1024 * 1024
+	defaultRemoteRegistryMaxFetches       = 10
 )
 
 type deployContractWithAddress struct {
@@ -48,6 +53,7 @@ type deployContractWithAddress struct {
 type RemoteRegistry interface {
 	loadFactoryForGateway(lookupStr string, refresh bool) (*messages.DeployContract, error)
 	loadFactoryForInstance(lookupStr string, refresh bool) (*deployContractWithAddress, error)
+	loadFactoryForFingerprint(fingerprint string, refresh bool) (*messages.DeployContract, error)
 	registerInstance(lookupStr, address string) error
 	init() error
 	close()
@@ -56,10 +62,14 @@ type RemoteRegistry interface {
 // RemoteRegistryConf configuration
 type RemoteRegistryConf struct {
 	utils.HTTPRequesterConf
-	CacheDB           string                      `json:"cacheDB"`
-	GatewayURLPrefix  string                      `json:"gatewayURLPrefix"`
-	InstanceURLPrefix string                      `json:"instanceURLPrefix"`
-	PropNames         RemoteRegistryPropNamesConf `json:"propNames"`
+	CacheDB              string                      `json:"cacheDB"`
+	GatewayURLPrefix     string                      `json:"gatewayURLPrefix"`
+	InstanceURLPrefix    string                      `json:"instanceURLPrefix"`
+	FingerprintURLPrefix string                      `json:"fingerprintURLPrefix"`
+	PropNames            RemoteRegistryPropNamesConf `json:"propNames"`
+	TimeoutSec           int                         `json:"timeoutSec,omitempty"`
+	MaxResponseBytes     int64                       `json:"maxResponseBytes,omitempty"`
+	MaxConcurrentFetches int                         `json:"maxConcurrentFetches,omitempty"`
 }
 
 // RemoteRegistryPropNamesConf configures the JSON property names to extract from the GET response on the API
@@ -73,11 +83,25 @@ type RemoteRegistryPropNamesConf struct {
 	Address    string `json:"address"`
 }
 
-// NewRemoteRegistry construtor
+// NewRemoteRegistry construtor. Each call to the registry is limited in time and response size,
+// and in the number made at once, so a slow registry fails requests rather than stalling them
 func NewRemoteRegistry(conf *RemoteRegistryConf) RemoteRegistry {
+	if conf.TimeoutSec <= 0 {
+		conf.TimeoutSec = defaultRemoteRegistryTimeoutSec
+	}
+	if conf.MaxResponseBytes <= 0 {
+		conf.MaxResponseBytes = defaultRemoteRegistryMaxResponseBytes
+	}
+	if conf.MaxConcurrentFetches <= 0 {
+		conf.MaxConcurrentFetches = defaultRemoteRegistryMaxFetches
+	}
 	rr := &remoteRegistry{
 		conf: conf,
-		hr:   utils.NewHTTPRequester("Contract registry", &conf.HTTPRequesterConf),
+		hr: utils.NewHTTPRequesterWithLimits("Contract registry", &conf.HTTPRequesterConf, utils.HTTPRequesterLimits{
+			Timeout:          time.Duration(conf.TimeoutSec) * time.Second,
+			MaxResponseBytes: conf.MaxResponseBytes,
+			MaxConcurrent:    conf.MaxConcurrentFetches,
+		}),
 	}
 	propNames := &conf.PropNames
 	if propNames.ID == "" {
@@ -107,6 +131,9 @@ func NewRemoteRegistry(conf *RemoteRegistryConf) RemoteRegistry {
 	if rr.conf.InstanceURLPrefix != "" && !strings.HasSuffix(rr.conf.InstanceURLPrefix, "/") {
 		rr.conf.InstanceURLPrefix += "/"
 	}
+	if rr.conf.FingerprintURLPrefix != "" && !strings.HasSuffix(rr.conf.FingerprintURLPrefix, "/") {
+		rr.conf.FingerprintURLPrefix += "/"
+	}
 	return rr
 }
 
@@ -117,6 +144,9 @@ type remoteRegistry struct {
 }
 
 func (rr *remoteRegistry) init() (err error) {
+	if err = rr.conf.HTTPRequesterConf.ValidateConf(); err != nil {
+		return err
+	}
 	if rr.conf.CacheDB != "" {
 		if rr.db, err = kvstore.NewLDBKeyValueStore(rr.conf.CacheDB); err != nil {
 			return errors.Errorf(errors.RemoteRegistryCacheInit, err)
@@ -166,6 +196,7 @@ func (rr *remoteRegistry) loadFactoryFromURL(baseURL, ns, lookupStr string, refr
 		return nil, errors.Errorf(errors.RemoteRegistryLookupGenericProcessingFailed)
 	}
 	addr, _ := rr.hr.GetResponseString(jsonRes, rr.conf.PropNames.Address, false)
+	addrHexNo0x, _ := normalizeAddress(addr)
 	msg = &deployContractWithAddress{
 		DeployContract: messages.DeployContract{
 			TransactionCommon: messages.TransactionCommon{
@@ -184,7 +215,7 @@ func (rr *remoteRegistry) loadFactoryFromURL(baseURL, ns, lookupStr string, refr
 			DevDoc:   devdoc,
 			Compiled: bytecode,
 		},
-		Address: strings.ToLower(strings.TrimPrefix(addr, "0x")),
+		Address: addrHexNo0x,
 	}
 	rr.storeFactoryToCacheDB(ns+"/"+safeLookupStr, msg)
 	return msg, nil
@@ -237,6 +268,17 @@ func (rr *remoteRegistry) loadFactoryForInstance(lookupStr string, refresh bool)
 	return rr.loadFactoryFromURL(rr.conf.InstanceURLPrefix, "instances", lookupStr, refresh)
 }
 
+func (rr *remoteRegistry) loadFactoryForFingerprint(fingerprint string, refresh bool) (*messages.DeployContract, error) {
+	if rr.conf.FingerprintURLPrefix == "" {
+		return nil, nil
+	}
+	msg, err := rr.loadFactoryFromURL(rr.conf.FingerprintURLPrefix, "fingerprints", fingerprint, refresh)
+	if msg != nil {
+		return &msg.DeployContract, err
+	}
+	return nil, err
+}
+
 func (rr *remoteRegistry) registerInstance(lookupStr, address string) error {
 	if rr.conf.InstanceURLPrefix == "" {
 		return errors.Errorf(errors.RemoteRegistryNotConfigured)
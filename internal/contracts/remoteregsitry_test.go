@@ -27,6 +27,7 @@ import (
 	"github.com/kaleido-io/ethconnect/internal/ethbind"
 	"github.com/kaleido-io/ethconnect/internal/kvstore"
 	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,6 +37,7 @@ type mockRR struct {
 	lookupCapture  string
 	refreshCapture bool
 	deployMsg      *deployContractWithAddress
+	noInstance     bool
 	err            error
 }
 
@@ -50,8 +52,19 @@ func (rr *mockRR) loadFactoryForGateway(id string, refresh bool) (*messages.Depl
 func (rr *mockRR) loadFactoryForInstance(id string, refresh bool) (*deployContractWithAddress, error) {
 	rr.addrCapture = id
 	rr.refreshCapture = refresh
+	if rr.noInstance {
+		return nil, rr.err
+	}
 	return rr.deployMsg, rr.err
 }
+func (rr *mockRR) loadFactoryForFingerprint(fingerprint string, refresh bool) (*messages.DeployContract, error) {
+	rr.lookupCapture = fingerprint
+	rr.refreshCapture = refresh
+	if rr.deployMsg == nil {
+		return nil, rr.err
+	}
+	return &rr.deployMsg.DeployContract, rr.err
+}
 func (rr *mockRR) registerInstance(lookupStr, address string) error {
 	rr.lookupCapture = lookupStr
 	rr.addrCapture = address
@@ -77,6 +90,9 @@ func TestNewRemoteRegistryDefaultPropNames(t *testing.T) {
 	assert.Equal(defaultDevdocProp, rr.conf.PropNames.Devdoc)
 	assert.Equal(defaultDeployableProp, rr.conf.PropNames.Deployable)
 	assert.Equal(defaultAddressProp, rr.conf.PropNames.Address)
+	assert.Equal(defaultRemoteRegistryTimeoutSec, rr.conf.TimeoutSec)
+	assert.Equal(int64(defaultRemoteRegistryMaxResponseBytes), rr.conf.MaxResponseBytes)
+	assert.Equal(defaultRemoteRegistryMaxFetches, rr.conf.MaxConcurrentFetches)
 }
 
 func TestNewRemoteRegistryCustomPropNames(t *testing.T) {
@@ -141,6 +157,20 @@ func TestRemoteRegistryInitBadDB(t *testing.T) {
 	rr.close()
 }
 
+func TestRemoteRegistryInitBadProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	r := NewRemoteRegistry(&RemoteRegistryConf{
+		HTTPRequesterConf: utils.HTTPRequesterConf{
+			ProxyURL: "://bad",
+		},
+	})
+	rr := r.(*remoteRegistry)
+
+	err := rr.init()
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+}
+
 func TestRemoteRegistryloadFactoryForGatewaySuccess(t *testing.T) {
 	assert := assert.New(t)
 
@@ -587,7 +617,7 @@ func TestRemoteRegistryloadFactoryForInstanceSuccess(t *testing.T) {
 		res.WriteHeader(200)
 		res.Write([]byte(`
       {
-        "address": "0x35344E187D669D930C9d513AaC63Ae204fC03C18",
+        "address": " 0X35344E187D669D930C9d513AaC63Ae204fC03C18 ",
         "id": "12345",
         "abi": "[]",
         "devdoc": "",
@@ -0,0 +1,185 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReplayWindow = 600
+)
+
+// replayEntry is the reply recorded for a request ID supplied by the client.
+// An entry that is not complete is a request still being processed
+type replayEntry struct {
+	hash        string
+	expiry      time.Time
+	complete    bool
+	status      int
+	contentType string
+	body        []byte
+}
+
+// replayCache remembers the replies to transactions submitted with a client supplied ID
+// for a window of time, so a client retrying a request gets the original ack or receipt
+// back rather than submitting the transaction again
+type replayCache struct {
+	window    time.Duration
+	mux       sync.Mutex
+	entries   map[string]*replayEntry
+	lastSweep time.Time
+}
+
+func newReplayCache(window time.Duration) *replayCache {
+	return &replayCache{
+		window:    window,
+		entries:   make(map[string]*replayEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// reserve returns the entry for a request ID seen within the window, or reserves the ID
+// for a new request with the supplied hash if there is none
+func (c *replayCache) reserve(id, hash string) (*replayEntry, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) > c.window {
+		for entryID, entry := range c.entries {
+			if entry.complete && now.After(entry.expiry) {
+				delete(c.entries, entryID)
+			}
+		}
+		c.lastSweep = now
+	}
+	if entry, exists := c.entries[id]; exists && (!entry.complete || now.Before(entry.expiry)) {
+		found := *entry
+		return &found, true
+	}
+	c.entries[id] = &replayEntry{hash: hash}
+	return nil, false
+}
+
+// complete records the reply for a request ID. Requests rejected before anything was
+// submitted are forgotten, so the client can retry them. Once submitted, the reply is
+// kept even if it is an error, such as a timeout waiting for the receipt
+func (c *replayCache) complete(id string, rec *replayRecorder) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry := c.entries[id]
+	if !rec.submitted || rec.status == 0 || entry == nil {
+		delete(c.entries, id)
+		return
+	}
+	c.entries[id] = &replayEntry{
+		hash:        entry.hash,
+		expiry:      time.Now().Add(c.window),
+		complete:    true,
+		status:      rec.status,
+		contentType: rec.Header().Get("Content-Type"),
+		body:        rec.body,
+	}
+}
+
+// replayRecorder captures the reply written for a request, while passing it through
+type replayRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      []byte
+	submitted bool
+}
+
+func (rec *replayRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *replayRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = 200
+	}
+	rec.body = append(rec.body, b...)
+	return rec.ResponseWriter.Write(b)
+}
+
+// markSubmitted records that a transaction has been handed on for submission, so its reply
+// is replayed from then on rather than allowing the transaction to be submitted again
+func markSubmitted(res http.ResponseWriter) {
+	if rec, ok := res.(*replayRecorder); ok {
+		rec.submitted = true
+	}
+}
+
+// replayKey scopes a client supplied request ID to the caller, so one caller cannot collide
+// with, or read, the replies recorded for another
+func replayKey(req *http.Request, msgID string) string {
+	caller := sha256.Sum256([]byte(auth.GetAccessToken(req.Context())))
+	return hex.EncodeToString(caller[:]) + "/" + msgID
+}
+
+// replayHash fingerprints the transaction a request asks for, so a retry can be told apart
+// from a different transaction that reuses the request ID
+func replayHash(req *http.Request, c *restCmd) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n", req.Method, req.URL.Path, req.URL.Query().Encode(), c.from, c.value)
+	body, _ := json.Marshal(c.body)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// withReplayProtection invokes the submission of a transaction, unless a request with the
+// same client supplied ID has been submitted by the same caller within the replay window.
+// In which case the recorded reply is returned, or a conflict if the original request is
+// still in flight or was for a different transaction
+func (r *rest2eth) withReplayProtection(res http.ResponseWriter, req *http.Request, c *restCmd, submit func(res http.ResponseWriter)) {
+	msgID := getFlyParam("id", req, false)
+	if r.replay == nil || msgID == "" {
+		submit(res)
+		return
+	}
+
+	key := replayKey(req, msgID)
+	entry, seen := r.replay.reserve(key, replayHash(req, c))
+	if seen {
+		if entry.hash != replayHash(req, c) {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayReplayMismatch, msgID), 409)
+			return
+		}
+		if !entry.complete {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayReplayInFlight, msgID), 409)
+			return
+		}
+		log.Infof("<-- %s %s [%d]: Replaying reply recorded for request ID %s", req.Method, req.URL, entry.status, msgID)
+		res.Header().Set("Content-Type", entry.contentType)
+		res.WriteHeader(entry.status)
+		res.Write(entry.body)
+		return
+	}
+
+	rec := &replayRecorder{ResponseWriter: res}
+	defer r.replay.complete(key, rec)
+	submit(rec)
+}
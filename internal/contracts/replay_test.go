@@ -0,0 +1,236 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReplaySend(router *httprouter.Router, msgID string) *httptest.ResponseRecorder {
+	return testReplaySendTo(router, msgID, "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "")
+}
+
+func testReplaySendTo(router *httprouter.Router, msgID, to, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer", bytes.NewReader([]byte(`{"to":"`+to+`"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	if token != "" {
+		req = req.WithContext(context.WithValue(req.Context(), auth.ContextKeyAccessToken, token))
+	}
+	if msgID != "" {
+		req.Header.Set("x-firefly-id", msgID)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestReplayCacheReserveAndComplete(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newReplayCache(1 * time.Minute)
+	entry, seen := c.reserve("id1", "hash1")
+	assert.False(seen)
+	assert.Nil(entry)
+
+	entry, seen = c.reserve("id1", "hash1")
+	assert.True(seen)
+	assert.False(entry.complete)
+	assert.Equal("hash1", entry.hash)
+
+	rec := &replayRecorder{ResponseWriter: httptest.NewRecorder(), submitted: true}
+	rec.Header().Set("Content-Type", "application/json")
+	rec.WriteHeader(202)
+	rec.Write([]byte(`{"sent":true}`))
+	c.complete("id1", rec)
+
+	entry, seen = c.reserve("id1", "hash1")
+	assert.True(seen)
+	assert.True(entry.complete)
+	assert.Equal("hash1", entry.hash)
+	assert.Equal(202, entry.status)
+	assert.Equal("application/json", entry.contentType)
+	assert.Equal(`{"sent":true}`, string(entry.body))
+
+	// A request rejected before submission is forgotten, so it can be retried
+	c.reserve("id2", "hash2")
+	c.complete("id2", &replayRecorder{ResponseWriter: httptest.NewRecorder(), status: 400})
+	_, seen = c.reserve("id2", "hash2")
+	assert.False(seen)
+
+	// An error after submission is kept, so the transaction is not submitted again
+	c.reserve("id3", "hash3")
+	c.complete("id3", &replayRecorder{ResponseWriter: httptest.NewRecorder(), status: 408, submitted: true})
+	entry, seen = c.reserve("id3", "hash3")
+	assert.True(seen)
+	assert.Equal(408, entry.status)
+}
+
+func TestReplayCacheExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newReplayCache(1 * time.Minute)
+	c.entries["id1"] = &replayEntry{complete: true, expiry: time.Now().Add(-1 * time.Second)}
+	c.entries["id2"] = &replayEntry{complete: true, expiry: time.Now().Add(-1 * time.Second)}
+	c.lastSweep = time.Now().Add(-2 * time.Minute)
+
+	_, seen := c.reserve("id1", "hash1")
+	assert.False(seen)
+	assert.NotContains(c.entries, "id2")
+}
+
+func TestSendTransactionReplayReturnsRecordedAck(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "client-id-1",
+		},
+	}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	r.replay = newReplayCache(1 * time.Minute)
+
+	res := testReplaySend(router, "client-id-1")
+	assert.Equal(202, res.Code)
+	assert.Equal("client-id-1", dispatcher.asyncDispatchMsg["headers"].(map[string]interface{})["id"])
+	firstReply := res.Body.String()
+
+	dispatcher.asyncDispatchMsg = nil
+	res = testReplaySend(router, "client-id-1")
+	assert.Equal(202, res.Code)
+	assert.Equal(firstReply, res.Body.String())
+	assert.Nil(dispatcher.asyncDispatchMsg)
+
+	// Requests without an ID are never de-duplicated
+	testReplaySend(router, "")
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
+
+func TestSendTransactionReplayAllowsRetryAfterError(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchError: fmt.Errorf("pop"),
+	}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	r.replay = newReplayCache(1 * time.Minute)
+
+	res := testReplaySend(router, "client-id-1")
+	assert.Equal(500, res.Code)
+
+	dispatcher.asyncDispatchError = nil
+	dispatcher.asyncDispatchReply = &messages.AsyncSentMsg{Sent: true, Request: "client-id-1"}
+	dispatcher.asyncDispatchMsg = nil
+	res = testReplaySend(router, "client-id-1")
+	assert.Equal(202, res.Code)
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
+
+func TestSendTransactionReplayInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	r.replay = newReplayCache(1 * time.Minute)
+	req := httptest.NewRequest("POST", "/", nil)
+	r.replay.reserve(replayKey(req, "client-id-1"), "")
+
+	res := testReplaySend(router, "client-id-1")
+	assert.Equal(409, res.Code)
+	assert.Regexp("A request with ID 'client-id-1' is already being processed", res.Body.String())
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestSendTransactionReplayKeepsErrorAfterSubmission(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncError: fmt.Errorf("Timed out waiting for transaction receipt"),
+	}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	r.replay = newReplayCache(1 * time.Minute)
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer?fly-sync", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	req.Header.Set("x-firefly-id", "client-id-1")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+	assert.NotNil(dispatcher.sendTransactionMsg)
+
+	dispatcher.sendTransactionMsg = nil
+	req = httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer?fly-sync", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	req.Header.Set("x-firefly-id", "client-id-1")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+	assert.Regexp("Timed out waiting for transaction receipt", res.Body.String())
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestSendTransactionReplayDifferentRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "client-id-1",
+		},
+	}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	r.replay = newReplayCache(1 * time.Minute)
+
+	res := testReplaySend(router, "client-id-1")
+	assert.Equal(202, res.Code)
+
+	dispatcher.asyncDispatchMsg = nil
+	res = testReplaySendTo(router, "client-id-1", "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "")
+	assert.Equal(409, res.Code)
+	assert.Regexp("A different request was already submitted with ID 'client-id-1'", res.Body.String())
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestSendTransactionReplayScopedToCaller(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "client-id-1",
+		},
+	}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	r.replay = newReplayCache(1 * time.Minute)
+
+	res := testReplaySendTo(router, "client-id-1", "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "token1")
+	assert.Equal(202, res.Code)
+
+	// The same ID from another caller is a separate request
+	dispatcher.asyncDispatchMsg = nil
+	res = testReplaySendTo(router, "client-id-1", "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "token2")
+	assert.Equal(202, res.Code)
+	assert.NotNil(dispatcher.asyncDispatchMsg)
+}
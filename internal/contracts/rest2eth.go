@@ -16,15 +16,16 @@ package contracts
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/url"
-	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
@@ -40,6 +41,10 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	defaultMaxRPCTimeout = 120 // seconds
+)
+
 // REST2EthAsyncDispatcher is passed in to process messages over a streaming system with
 // a receipt store. Only used for POST methods, when fly-sync is not set to true
 type REST2EthAsyncDispatcher interface {
@@ -62,17 +67,35 @@ type rest2EthReplyProcessor interface {
 
 // rest2eth provides the HTTP <-> messages translation and dispatches for processing
 type rest2eth struct {
-	gw              smartContractGatewayInt
-	rpc             eth.RPCClient
-	processor       tx.TxnProcessor
-	asyncDispatcher REST2EthAsyncDispatcher
-	syncDispatcher  rest2EthSyncDispatcher
-	subMgr          events.SubscriptionManager
-	rr              RemoteRegistry
+	gw                  smartContractGatewayInt
+	rpc                 eth.RPCClient
+	processor           tx.TxnProcessor
+	asyncDispatcher     REST2EthAsyncDispatcher
+	syncDispatcher      rest2EthSyncDispatcher
+	subMgr              events.SubscriptionManager
+	rr                  RemoteRegistry
+	maxRPCTimeout       time.Duration
+	strictAddrs         bool
+	fingerprint         bool
+	strictBodies        bool
+	replay              *replayCache
+	readPool            *readPool
+	paramTransformHooks []ParamTransformHookConf
+	safe                *safeService
 }
 
 type restErrMsg struct {
-	Message string `json:"error"`
+	Message          string `json:"error"`
+	Retryable        bool   `json:"retryable"`
+	AlreadySubmitted bool   `json:"alreadySubmitted,omitempty"`
+}
+
+func newRESTErrMsg(err error, status int) *restErrMsg {
+	return &restErrMsg{
+		Message:          err.Error(),
+		Retryable:        ethconnecterrors.IsRetryableHTTP(err, status),
+		AlreadySubmitted: ethconnecterrors.IsAlreadySubmitted(err),
+	}
 }
 
 type restAsyncMsg struct {
@@ -80,20 +103,31 @@ type restAsyncMsg struct {
 }
 
 type restReceiptAndError struct {
-	Message string `json:"error"`
+	Message          string `json:"error"`
+	Retryable        bool   `json:"retryable"`
+	AlreadySubmitted bool   `json:"alreadySubmitted,omitempty"`
 	messages.ReplyWithHeaders
 }
 
 // rest2EthInflight is instantiated for each async reply in flight
 type rest2EthSyncResponder struct {
-	r      *rest2eth
-	res    http.ResponseWriter
-	req    *http.Request
-	done   bool
-	waiter *sync.Cond
+	r         *rest2eth
+	res       http.ResponseWriter
+	req       *http.Request
+	done      bool
+	waiter    *sync.Cond
+	abiID     string
+	deployMsg *messages.DeployContract
 }
 
-var addrCheck = regexp.MustCompile("^(0x)?[0-9a-z]{40}$")
+var addrCheck = regexp.MustCompile("^[0-9a-f]{40}$")
+
+// normalizeAddress returns an address in the form used as the key of the contract store, which
+// is lower case hex without a 0x prefix. Any case is accepted, with or without the 0x prefix
+func normalizeAddress(addr string) (string, bool) {
+	addrHexNo0x := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(addr)), "0x")
+	return addrHexNo0x, addrCheck.MatchString(addrHexNo0x)
+}
 
 func (i *rest2EthSyncResponder) ReplyWithError(err error) {
 	i.r.restErrReply(i.res, i.req, err, 500)
@@ -104,7 +138,7 @@ func (i *rest2EthSyncResponder) ReplyWithError(err error) {
 
 func (i *rest2EthSyncResponder) ReplyWithReceiptAndError(receipt messages.ReplyWithHeaders, err error) {
 	status := 500
-	reply, _ := json.MarshalIndent(&restReceiptAndError{err.Error(), receipt}, "", "  ")
+	reply, _ := json.MarshalIndent(&restReceiptAndError{err.Error(), ethconnecterrors.IsRetryableHTTP(err, status), ethconnecterrors.IsAlreadySubmitted(err), receipt}, "", "  ")
 	log.Infof("<-- %s %s [%d]", i.req.Method, i.req.URL, status)
 	log.Debugf("<-- %s", reply)
 	i.res.Header().Set("Content-Type", "application/json")
@@ -118,14 +152,14 @@ func (i *rest2EthSyncResponder) ReplyWithReceiptAndError(receipt messages.ReplyW
 func (i *rest2EthSyncResponder) ReplyWithReceipt(receipt messages.ReplyWithHeaders) {
 	txReceiptMsg := receipt.IsReceipt()
 	if txReceiptMsg != nil && txReceiptMsg.ContractAddress != nil {
-		if err := i.r.gw.PostDeploy(txReceiptMsg); err != nil {
+		if err := i.r.gw.postDeployInstance(txReceiptMsg, i.abiID, i.deployMsg); err != nil {
 			log.Warnf("Failed to perform post-deploy processing: %s", err)
 			i.ReplyWithReceiptAndError(receipt, err)
 			return
 		}
 	}
 	status := 200
-	if receipt.ReplyHeaders().MsgType != messages.MsgTypeTransactionSuccess {
+	if msgType := receipt.ReplyHeaders().MsgType; msgType != messages.MsgTypeTransactionSuccess && msgType != messages.MsgTypeDeployContractDryRun {
 		status = 500
 	}
 	reply, _ := json.MarshalIndent(receipt, "", "  ")
@@ -156,30 +190,44 @@ func (r *rest2eth) addRoutes(router *httprouter.Router) {
 	router.POST("/contracts/:address/:method", r.restHandler)
 	router.GET("/contracts/:address/:method", r.restHandler)
 	router.POST("/contracts/:address/:method/:subcommand", r.restHandler)
+	router.GET("/contracts/:address/:method/:subcommand", r.eventSchemaHandler)
 
 	router.POST("/abis/:abi", r.restHandler)
 	router.POST("/abis/:abi/:address/:method", r.restHandler)
 	router.GET("/abis/:abi/:address/:method", r.restHandler)
 	router.POST("/abis/:abi/:address/:method/:subcommand", r.restHandler)
+	router.GET("/abis/:abi/:address/:method/:subcommand", r.eventSchemaHandler)
 
 	// Remote registry managed address routes, with long and short names
 	router.POST("/instances/:instance_lookup/:method", r.restHandler)
 	router.GET("/instances/:instance_lookup/:method", r.restHandler)
 	router.POST("/instances/:instance_lookup/:method/:subcommand", r.restHandler)
+	router.GET("/instances/:instance_lookup/:method/:subcommand", r.eventSchemaHandler)
 
 	router.POST("/i/:instance_lookup/:method", r.restHandler)
 	router.GET("/i/:instance_lookup/:method", r.restHandler)
 	router.POST("/i/:instance_lookup/:method/:subcommand", r.restHandler)
+	router.GET("/i/:instance_lookup/:method/:subcommand", r.eventSchemaHandler)
 
 	router.POST("/gateways/:gateway_lookup", r.restHandler)
 	router.POST("/gateways/:gateway_lookup/:address/:method", r.restHandler)
 	router.GET("/gateways/:gateway_lookup/:address/:method", r.restHandler)
 	router.POST("/gateways/:gateway_lookup/:address/:method/:subcommand", r.restHandler)
+	router.GET("/gateways/:gateway_lookup/:address/:method/:subcommand", r.eventSchemaHandler)
 
 	router.POST("/g/:gateway_lookup", r.restHandler)
 	router.POST("/g/:gateway_lookup/:address/:method", r.restHandler)
 	router.GET("/g/:gateway_lookup/:address/:method", r.restHandler)
 	router.POST("/g/:gateway_lookup/:address/:method/:subcommand", r.restHandler)
+	router.GET("/g/:gateway_lookup/:address/:method/:subcommand", r.eventSchemaHandler)
+
+	router.POST("/bulk/:method", r.bulkCallHandler)
+
+	router.GET("/storage/:address/:slot", r.storageHandler)
+	router.GET("/logs", r.logsHandler)
+	router.GET("/safes/:safe/transactions/:safetxhash", r.safeTransactionHandler)
+
+	router.POST("/decode", r.decodeHandler)
 }
 
 type restCmd struct {
@@ -194,12 +242,36 @@ type restCmd struct {
 	deployMsg     *messages.DeployContract
 	body          map[string]interface{}
 	msgParams     []interface{}
+	data          string
 	blocknumber   string
+	policy        *txPolicy
+	methods       *methodFilter
+}
+
+// encodedCall is the reply to a request to encode the calldata of a method invocation
+type encodedCall struct {
+	To       string `json:"to,omitempty"`
+	Method   string `json:"method"`
+	Selector string `json:"selector"`
+	Data     string `json:"data"`
+}
+
+// errorABI returns the custom errors declared in the ABI of the contract, so the revert
+// reason of a failed transaction can be decoded
+func (c *restCmd) errorABI() ethbinding.ABIMarshaling {
+	if c.deployMsg == nil {
+		return nil
+	}
+	return eth.ErrorEntries(c.deployMsg.ABI)
+}
+
+// isFallback returns true if the command invokes the receive or fallback function of the contract
+func (c *restCmd) isFallback() bool {
+	return c.abiMethodElem != nil && (c.abiMethodElem.Type == "receive" || c.abiMethodElem.Type == "fallback")
 }
 
 func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params httprouter.Params, c *restCmd, addrParam string, refresh bool) (a ethbinding.ABIMarshaling, validAddress bool, err error) {
-	c.addr = strings.ToLower(strings.TrimPrefix(addrParam, "0x"))
-	validAddress = addrCheck.MatchString(c.addr)
+	c.addr, validAddress = normalizeAddress(addrParam)
 
 	// There are multiple ways we resolve the path into an ABI
 	// 1. we lookup it up remotely in a REST attached contract registry (the newer option)
@@ -241,6 +313,8 @@ func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params
 				r.restErrReply(res, req, err, 404)
 				return
 			}
+			c.policy = r.gw.txPolicyFor(abiID, c.addr)
+			c.methods = r.gw.methodFilterFor(c.addr)
 		} else {
 			if !validAddress {
 				// Resolve the address as a registered name, to an actual contract address
@@ -252,10 +326,15 @@ func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params
 				addrParam = c.addr
 			}
 			c.deployMsg, _, err = r.gw.loadDeployMsgForInstance(addrParam)
+			if err != nil && r.fingerprintEnabled(req) {
+				c.deployMsg, err = r.gw.bindByFingerprint(req.Context(), c.addr)
+			}
 			if err != nil {
 				r.restErrReply(res, req, err, 404)
 				return
 			}
+			c.policy = r.gw.txPolicyFor("", c.addr)
+			c.methods = r.gw.methodFilterFor(c.addr)
 		}
 	}
 	a = c.deployMsg.ABI
@@ -263,10 +342,13 @@ func (r *rest2eth) resolveABI(res http.ResponseWriter, req *http.Request, params
 }
 
 func (r *rest2eth) resolveMethod(res http.ResponseWriter, req *http.Request, c *restCmd, a ethbinding.ABIMarshaling, methodParam string) (err error) {
+	// The receive and fallback functions are unnamed in the ABI, but as the names are
+	// reserved keywords in Solidity they cannot clash with a named function
+	isFallback := methodParam == "receive" || methodParam == "fallback"
 	for _, element := range a {
-		if element.Type == "function" && element.Name == methodParam {
+		if (element.Type == "function" && element.Name == methodParam) || (isFallback && element.Type == methodParam) {
 			c.abiMethodElem = &element
-			if c.abiMethod, err = ethbind.API.ABIElementMarshalingToABIMethod(&element); err != nil {
+			if c.abiMethod, err = eth.ABIMethodFor(&element); err != nil {
 				err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodABIInvalid, methodParam, err)
 				r.restErrReply(res, req, err, 400)
 				return
@@ -281,7 +363,7 @@ func (r *rest2eth) resolveConstructor(res http.ResponseWriter, req *http.Request
 	for _, element := range a {
 		if element.Type == "constructor" {
 			c.abiMethodElem = &element
-			if c.abiMethod, err = ethbind.API.ABIElementMarshalingToABIMethod(&element); err != nil {
+			if c.abiMethod, err = eth.ABIMethodFor(&element); err != nil {
 				err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodABIInvalid, "constructor", err)
 				r.restErrReply(res, req, err, 400)
 				return
@@ -348,6 +430,12 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 		if err = r.resolveMethod(res, req, &c, a, methodParam); err != nil {
 			return
 		}
+		if c.abiMethod != nil {
+			if err = c.methods.check(methodParam, c.addr); err != nil {
+				r.restErrReply(res, req, err, 403)
+				return
+			}
+		}
 	}
 
 	// Then if we don't have a method in :method param, we might have
@@ -389,49 +477,87 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 		c.addr = "0x" + c.addr
 	}
 
-	// If we have a from, it needs to be a valid address
-	From := getFlyParam("from", req, false)
-	fromNo0xPrefix := strings.ToLower(strings.TrimPrefix(getFlyParam("from", req, false), "0x"))
-	if fromNo0xPrefix != "" {
-		if addrCheck.MatchString(fromNo0xPrefix) {
-			c.from = "0x" + fromNo0xPrefix
-		} else if tx.IsHDWalletRequest(fromNo0xPrefix) != nil {
-			c.from = fromNo0xPrefix
-		} else {
-			log.Errorf("Invalid from address: '%s'", From)
-			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidFromAddress)
-			r.restErrReply(res, req, err, 404)
+	// The body is parsed before any fly- parameters are read, as they can be fields of a multipart form
+	var inputs ethbinding.ABIArguments
+	if c.abiMethod != nil {
+		inputs = c.abiMethod.Inputs
+	}
+	c.body, err = methodPayload(req, inputs)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if c.abiMethod != nil && (paramTransformer != nil || len(r.paramTransformHooks) > 0) {
+		if err = r.applyParamTransforms(req, &c); err != nil {
+			r.restErrReply(res, req, err, err.(*paramTransformError).status)
 			return
 		}
 	}
+
+	// If we have a from, it needs to be a valid address or signer alias
+	if c.from, err = r.resolveFrom(getFlyParam("from", req, false)); err != nil {
+		r.restErrReply(res, req, err, 404)
+		return
+	}
 	c.value = json.Number(getFlyParam("ethvalue", req, false))
 
-	c.body, err = utils.YAMLorJSONPayload(req)
+	if c.abiEvent != nil {
+		return
+	}
+
+	if c.isFallback() {
+		// Raw calldata can be passed to a fallback function, so the function it selects is checked
+		c.data = r.fromBodyOrForm(req, c.body, "data")
+		if c.data != "" && !c.methods.isEmpty() {
+			data, decodeErr := hex.DecodeString(strings.TrimPrefix(c.data, "0x"))
+			if decodeErr == nil {
+				err = c.methods.checkCalldata(c.deployMsg.ABI, data, strings.TrimPrefix(c.addr, "0x"))
+			}
+			if err != nil {
+				r.restErrReply(res, req, err, 403)
+				return
+			}
+		}
+	}
+
+	base64Bytes, err := bytesBase64Requested(req)
 	if err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
 	}
+	if base64Bytes {
+		for i, abiParam := range c.abiMethod.Inputs {
+			argName := abiInputName(i, abiParam)
+			if bv, exists := c.body[argName]; exists {
+				c.body[argName] = markBase64Bytes(&abiParam.Type, bv)
+			}
+		}
+	}
 
-	if c.abiEvent != nil {
-		return
+	if r.strictBodiesEnabled(req) {
+		methodName, extraFields := c.abiMethod.Name, []string{}
+		if c.isDeploy {
+			methodName = "constructor"
+		} else if c.isFallback() {
+			methodName, extraFields = c.abiMethodElem.Type, []string{"data"}
+		}
+		if errs := validateBody(c.abiMethod.Inputs, c.body, extraFields...); len(errs) > 0 {
+			err = r.restValidationErrReply(res, req, methodName, errs)
+			return
+		}
 	}
 
 	c.msgParams = make([]interface{}, len(c.abiMethod.Inputs))
 	queryParams := req.Form
 	for i, abiParam := range c.abiMethod.Inputs {
-		argName := abiParam.Name
-		// If the ABI input has one or more un-named parameters, look for default names that are passed in.
-		// Unnamed Input params should be named: input, input1, input2...
-		if argName == "" {
-			argName = "input"
-			if i != 0 {
-				argName += strconv.Itoa(i)
-			}
-		}
+		argName := abiInputName(i, abiParam)
 		if bv, exists := c.body[argName]; exists {
 			c.msgParams[i] = bv
 		} else if vs := queryParams[argName]; len(vs) > 0 {
 			c.msgParams[i] = vs[0]
+			if base64Bytes {
+				c.msgParams[i] = markBase64Bytes(&abiParam.Type, vs[0])
+			}
 		} else {
 			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMissingParameter, argName, c.abiMethod.Name)
 			r.restErrReply(res, req, err, 400)
@@ -444,6 +570,36 @@ func (r *rest2eth) resolveParams(res http.ResponseWriter, req *http.Request, par
 	return
 }
 
+// resolveFrom validates the from address of a request, which can be an address, an HD wallet
+// reference, or the name of a signer alias registered for one of those
+func (r *rest2eth) resolveFrom(from string) (string, error) {
+	if from == "" {
+		return "", nil
+	}
+	if resolved, ok := normalizeFrom(from); ok {
+		return resolved, nil
+	}
+	if resolved, ok := r.gw.resolveSignerAlias(from); ok {
+		return resolved, nil
+	}
+	log.Errorf("Invalid from address: '%s'", from)
+	return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidFromAddress)
+}
+
+// abiInputName returns the name of an ABI input parameter. If the ABI input has one or more
+// un-named parameters, look for default names that are passed in.
+// Unnamed Input params should be named: input, input1, input2...
+func abiInputName(i int, abiParam ethbinding.ABIArgument) string {
+	argName := abiParam.Name
+	if argName == "" {
+		argName = "input"
+		if i != 0 {
+			argName += strconv.Itoa(i)
+		}
+	}
+	return argName
+}
+
 func (r *rest2eth) restHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
@@ -452,31 +608,144 @@ func (r *rest2eth) restHandler(res http.ResponseWriter, req *http.Request, param
 		return
 	}
 
+	rpcTimeout, err := r.rpcTimeout(req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if rpcTimeout > 0 {
+		req = req.WithContext(eth.WithRPCTimeout(req.Context(), rpcTimeout))
+	}
+
 	if c.abiEvent != nil {
 		r.subscribeEvent(res, req, c.addr, c.abiEventElem, c.body)
+	} else if strings.ToLower(params.ByName("subcommand")) == "encode" {
+		r.encodeCall(res, req, &c)
+	} else if c.isFallback() && (req.Method != http.MethodPost || strings.ToLower(getFlyParam("call", req, true)) == "true") {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFallbackCallUnsupported, c.abiMethodElem.Type), 405)
 	} else if (req.Method == http.MethodPost && !c.abiMethod.IsConstant()) && strings.ToLower(getFlyParam("call", req, true)) != "true" {
 		if c.from == "" {
 			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMissingFromAddress, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly"))
 			r.restErrReply(res, req, err, 400)
+		} else if safe := safeForRequest(req, &c); safe != "" {
+			// Contracts owned by a multisig have the transaction proposed to the Safe, rather than submitted
+			r.proposeSafeTransaction(res, req, &c, safe)
+		} else if rpcTimeout > 0 && strings.ToLower(getFlyParam("sync", req, true)) != "true" {
+			// Async transactions are submitted later by the transaction processor, outside of this request
+			err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRPCTimeoutAsyncUnsupported, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"))
+			r.restErrReply(res, req, err, 400)
 		} else if c.isDeploy {
-			r.deployContract(res, req, c.from, c.value, c.abiMethodElem, c.deployMsg, c.msgParams)
+			r.withReplayProtection(res, req, &c, func(res http.ResponseWriter) {
+				r.deployContract(res, req, c.from, c.value, c.abiMethodElem, c.deployMsg, c.msgParams, c.policy)
+			})
 		} else {
-			r.sendTransaction(res, req, c.from, c.addr, c.value, c.abiMethodElem, c.msgParams)
+			r.withReplayProtection(res, req, &c, func(res http.ResponseWriter) {
+				r.sendTransaction(res, req, c.from, c.addr, c.value, c.abiMethodElem, c.msgParams, c.data, c.policy, c.errorABI())
+			})
 		}
 	} else {
-		r.callContract(res, req, c.from, c.addr, c.value, c.abiMethod, c.msgParams, c.blocknumber)
+		numbers, err := numberFormat(req, c.policy)
+		if err != nil {
+			r.restErrReply(res, req, err, 400)
+			return
+		}
+		r.callContract(res, req, c.from, c.addr, c.value, c.abiMethod, c.msgParams, c.blocknumber, numbers)
+	}
+}
+
+// numberFormat returns the format for the integer outputs of a call, supplied on the request,
+// or set in the policy of the ABI or contract instance
+func numberFormat(req *http.Request, policy *txPolicy) (string, error) {
+	numbers := strings.ToLower(getFlyParam("numbers", req, false))
+	if numbers == "" && policy != nil {
+		numbers = policy.Numbers
+	}
+	if err := eth.ValidateNumberFormat(numbers); err != nil {
+		return "", err
+	}
+	return numbers, nil
+}
+
+// rpcTimeout parses the optional per-request timeout for the JSON/RPC calls made on behalf
+// of the request. Accepts a number of seconds, or a Go duration string. Capped by config
+func (r *rest2eth) rpcTimeout(req *http.Request) (time.Duration, error) {
+	timeoutStr := getFlyParam("rpctimeout", req, false)
+	if timeoutStr == "" {
+		return 0, nil
 	}
+	var timeout time.Duration
+	if secs, err := strconv.ParseFloat(timeoutStr, 64); err == nil {
+		timeout = time.Duration(secs * float64(time.Second))
+	} else if timeout, err = time.ParseDuration(timeoutStr); err != nil {
+		timeout = 0
+	}
+	if timeout <= 0 {
+		return 0, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidRPCTimeout, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), timeoutStr)
+	}
+	maxTimeout := r.maxRPCTimeout
+	if maxTimeout <= 0 {
+		maxTimeout = defaultMaxRPCTimeout * time.Second
+	}
+	if timeout > maxTimeout {
+		log.Debugf("Requested RPC timeout %s capped to %s", timeout, maxTimeout)
+		timeout = maxTimeout
+	}
+	return timeout, nil
 }
 
 func (r *rest2eth) fromBodyOrForm(req *http.Request, body map[string]interface{}, param string) string {
-	val := body[param]
-	valType := reflect.TypeOf(val)
-	if valType != nil && valType.Kind() == reflect.String && len(val.(string)) > 0 {
-		return val.(string)
+	switch val := body[param].(type) {
+	case string:
+		if len(val) > 0 {
+			return val
+		}
+	case json.Number:
+		return val.String()
 	}
 	return req.FormValue(param)
 }
 
+// eventOverride returns the ABI fragment supplied in the 'event' field of a subscription, to
+// decode the events of a contract whose emitted events diverge from the ABI in the registry.
+// The fragment can be a JSON ABI event, or a signature such as "Changed(address indexed,uint256)",
+// and must be for the event named in the path
+func (r *rest2eth) eventOverride(body map[string]interface{}, abiEvent *ethbinding.ABIElementMarshaling) (*ethbinding.ABIElementMarshaling, error) {
+	var override *ethbinding.ABIElementMarshaling
+	switch v := body["event"].(type) {
+	case nil:
+		return abiEvent, nil
+	case string:
+		event, err := events.ParseEventSignature(v)
+		if err != nil {
+			return nil, err
+		}
+		override = event
+	default:
+		override = &ethbinding.ABIElementMarshaling{}
+		eventBytes, _ := json.Marshal(v)
+		if err := json.Unmarshal(eventBytes, override); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscribeBadEventOverride, err)
+		}
+		if override.Type == "" {
+			override.Type = "event"
+		}
+		if override.Type != "event" {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscribeBadEventOverride, "type must be 'event'")
+		}
+		if _, err := ethbind.API.ABIElementMarshalingToABIEvent(override); err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscribeBadEventOverride, err)
+		}
+	}
+	if override.Name == "" {
+		override.Name = abiEvent.Name
+	}
+	if override.Name != abiEvent.Name {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscribeEventOverrideName, override.Name, abiEvent.Name)
+	}
+	log.Infof("Subscription to '%s' decodes events with the supplied ABI fragment", abiEvent.Name)
+	return override, nil
+}
+
 func (r *rest2eth) subscribeEvent(res http.ResponseWriter, req *http.Request, addrStr string, abiEvent *ethbinding.ABIElementMarshaling, body map[string]interface{}) {
 
 	err := auth.AuthEventStreams(req.Context())
@@ -504,7 +773,29 @@ func (r *rest2eth) subscribeEvent(res http.ResponseWriter, req *http.Request, ad
 	// if the end user provided a name for the subscription, use it
 	// If not provided, it will be set to a system-generated summary
 	name := r.fromBodyOrForm(req, body, "name")
-	sub, err := r.subMgr.AddSubscription(req.Context(), addr, abiEvent, streamID, fromBlock, name)
+	// optionally register contract instances announced by a factory event
+	var autoRegister *events.AutoRegisterSpec
+	if autoRegisterBody, ok := body["autoRegister"]; ok && autoRegisterBody != nil {
+		autoRegister = &events.AutoRegisterSpec{}
+		autoRegisterBytes, _ := json.Marshal(autoRegisterBody)
+		if err := json.Unmarshal(autoRegisterBytes, autoRegister); err != nil {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscribeBadAutoRegister, err), 400)
+			return
+		}
+		if autoRegister.ABI != "" {
+			if _, _, err := r.gw.loadDeployMsgByID(autoRegister.ABI); err != nil {
+				r.restErrReply(res, req, err, 400)
+				return
+			}
+		}
+	}
+	// optionally decode with a supplied ABI fragment, rather than the one in the registry
+	abiEvent, err = r.eventOverride(body, abiEvent)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	sub, err := r.subMgr.AddSubscription(req.Context(), addr, abiEvent, streamID, fromBlock, name, autoRegister)
 	if err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
@@ -540,19 +831,44 @@ func (r *rest2eth) addPrivateTx(msg *messages.TransactionCommon, req *http.Reque
 	return nil
 }
 
-func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, from string, value json.Number, abiMethodElem *ethbinding.ABIElementMarshaling, deployMsg *messages.DeployContract, msgParams []interface{}) {
+func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, from string, value json.Number, abiMethodElem *ethbinding.ABIElementMarshaling, deployMsg *messages.DeployContract, msgParams []interface{}, policy *txPolicy) {
 
+	// The stored deploy message carries the ID of its ABI
+	abiID := deployMsg.Headers.ID
 	deployMsg.Headers.MsgType = messages.MsgTypeDeployContract
+	if !isRemote(deployMsg.Headers.CommonHeaders) {
+		// PostDeploy needs the ABI ID once the request takes its own ID
+		msgCtx := map[string]interface{}{abiIDContextKey: abiID}
+		for k, v := range deployMsg.Headers.Context {
+			msgCtx[k] = v
+		}
+		deployMsg.Headers.Context = msgCtx
+	}
+	deployMsg.Headers.ID = getFlyParam("id", req, false)
+	deployMsg.CompiledRuntime = nil // not required to deploy, so not worth sending
+	deployMsg.CompilerWarnings = nil
 	deployMsg.From = from
 	deployMsg.Gas = json.Number(getFlyParam("gas", req, false))
 	deployMsg.GasPrice = json.Number(getFlyParam("gasprice", req, false))
 	deployMsg.Value = value
 	deployMsg.Parameters = msgParams
+	deployMsg.Signer = strings.ToLower(getFlyParam("signer", req, false))
+	if err := policy.apply(&deployMsg.TransactionCommon); err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
 	if err := r.addPrivateTx(&deployMsg.TransactionCommon, req, res); err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
 	}
+	deployMsg.DryRun = strings.ToLower(getFlyParam("dryrun", req, true)) == "true"
+	deployMsg.SingletonFactory = strings.ToLower(getFlyParam("singletonfactory", req, true)) == "true"
+	deployMsg.Salt = getFlyParam("salt", req, false)
 	deployMsg.RegisterAs = getFlyParam("register", req, false)
+	if err := checkRegisteredName(deployMsg.RegisterAs); err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
 	if deployMsg.RegisterAs != "" {
 		if err := r.gw.checkNameAvailable(deployMsg.RegisterAs, isRemote(deployMsg.Headers.CommonHeaders)); err != nil {
 			r.restErrReply(res, req, err, 409)
@@ -561,12 +877,15 @@ func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, fr
 	}
 	if strings.ToLower(getFlyParam("sync", req, true)) == "true" {
 		responder := &rest2EthSyncResponder{
-			r:      r,
-			res:    res,
-			req:    req,
-			done:   false,
-			waiter: sync.NewCond(&sync.Mutex{}),
+			r:         r,
+			res:       res,
+			req:       req,
+			done:      false,
+			waiter:    sync.NewCond(&sync.Mutex{}),
+			abiID:     abiID,
+			deployMsg: deployMsg,
 		}
+		markSubmitted(res)
 		r.syncDispatcher.DispatchDeployContractSync(req.Context(), deployMsg, responder)
 		responder.waiter.L.Lock()
 		for !responder.done {
@@ -579,20 +898,22 @@ func (r *rest2eth) deployContract(res http.ResponseWriter, req *http.Request, fr
 		// We are confident in the re-serialization here as we've deserialized from JSON then built our own structure
 		msgBytes, _ := json.Marshal(deployMsg)
 		var mapMsg map[string]interface{}
-		json.Unmarshal(msgBytes, &mapMsg)
+		utils.UnmarshalJSONNumbers(msgBytes, &mapMsg)
 		if asyncResponse, err := r.asyncDispatcher.DispatchMsgAsync(req.Context(), mapMsg, ack); err != nil {
 			r.restErrReply(res, req, err, 500)
 		} else {
+			markSubmitted(res)
 			r.restAsyncReply(res, req, asyncResponse)
 		}
 	}
 	return
 }
 
-func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethodElem *ethbinding.ABIElementMarshaling, msgParams []interface{}) {
+func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethodElem *ethbinding.ABIElementMarshaling, msgParams []interface{}, data string, policy *txPolicy, errorABI ethbinding.ABIMarshaling) {
 
 	msg := &messages.SendTransaction{}
 	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.Headers.ID = getFlyParam("id", req, false)
 	msg.Method = abiMethodElem
 	msg.To = addr
 	msg.From = from
@@ -600,6 +921,15 @@ func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, f
 	msg.GasPrice = json.Number(getFlyParam("gasprice", req, false))
 	msg.Value = value
 	msg.Parameters = msgParams
+	msg.Data = data
+	msg.Errors = errorABI
+	msg.BlobVersionedHashes = getFlyParamMulti("blobversionedhashes", req)
+	msg.MaxFeePerBlobGas = json.Number(getFlyParam("maxfeeperblobgas", req, false))
+	msg.Signer = strings.ToLower(getFlyParam("signer", req, false))
+	if err := policy.apply(&msg.TransactionCommon); err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
 	if err := r.addPrivateTx(&msg.TransactionCommon, req, res); err != nil {
 		r.restErrReply(res, req, err, 400)
 		return
@@ -613,6 +943,7 @@ func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, f
 			done:   false,
 			waiter: sync.NewCond(&sync.Mutex{}),
 		}
+		markSubmitted(res)
 		r.syncDispatcher.DispatchSendTransactionSync(req.Context(), msg, responder)
 		responder.waiter.L.Lock()
 		for !responder.done {
@@ -625,28 +956,51 @@ func (r *rest2eth) sendTransaction(res http.ResponseWriter, req *http.Request, f
 		// We are confident in the re-serialization here as we've deserialized from JSON then built our own structure
 		msgBytes, _ := json.Marshal(msg)
 		var mapMsg map[string]interface{}
-		json.Unmarshal(msgBytes, &mapMsg)
+		utils.UnmarshalJSONNumbers(msgBytes, &mapMsg)
 		if asyncResponse, err := r.asyncDispatcher.DispatchMsgAsync(req.Context(), mapMsg, ack); err != nil {
 			r.restErrReply(res, req, err, 500)
 		} else {
+			markSubmitted(res)
 			r.restAsyncReply(res, req, asyncResponse)
 		}
 	}
 	return
 }
 
-func (r *rest2eth) callContract(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethod *ethbinding.ABIMethod, msgParams []interface{}, blocknumber string) {
+// callBlockErrStatus is the status for a failure to resolve the block for a call, which is
+// a bad request when the block supplied is invalid or before the first block
+func callBlockErrStatus(err error) int {
+	if ethconnecterrors.IsInvalidCallBlock(err) {
+		return 400
+	}
+	return 500
+}
+
+func (r *rest2eth) callContract(res http.ResponseWriter, req *http.Request, from, addr string, value json.Number, abiMethod *ethbinding.ABIMethod, msgParams []interface{}, blocknumber, numbers string) {
 	var err error
 	if from, err = r.processor.ResolveAddress(from); err != nil {
 		r.restErrReply(res, req, err, 500)
 		return
 	}
 
-	resBody, err := eth.CallMethod(req.Context(), r.rpc, nil, from, addr, value, abiMethod, msgParams, blocknumber)
+	rpc, release, err := r.readRPC(req.Context())
+	if err != nil {
+		r.restErrReply(res, req, err, 503)
+		return
+	}
+	defer release()
+
+	if blocknumber, err = eth.BlockNumberForCall(req.Context(), rpc, blocknumber); err != nil {
+		r.restErrReply(res, req, err, callBlockErrStatus(err))
+		return
+	}
+
+	resBody, err := eth.CallMethod(req.Context(), rpc, nil, from, addr, value, abiMethod, msgParams, blocknumber, r.strictAddrs)
 	if err != nil {
 		r.restErrReply(res, req, err, 500)
 		return
 	}
+	eth.FormatNumbers(abiMethod.Outputs, resBody, numbers)
 	resBytes, _ := json.MarshalIndent(&resBody, "", "  ")
 	status := 200
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
@@ -657,6 +1011,42 @@ func (r *rest2eth) callContract(res http.ResponseWriter, req *http.Request, from
 	return
 }
 
+// readRPC returns the JSON/RPC connection for a read-only call, waiting for a free worker when
+// a read pool is configured. The returned function must be called once the call is complete
+func (r *rest2eth) readRPC(ctx context.Context) (eth.RPCClient, func(), error) {
+	if r.readPool == nil {
+		return r.rpc, func() {}, nil
+	}
+	return r.readPool.acquire(ctx)
+}
+
+// encodeCall replies with the ABI encoded calldata for a method invocation, without sending
+// anything to the node. So external signers can build their own transactions
+func (r *rest2eth) encodeCall(res http.ResponseWriter, req *http.Request, c *restCmd) {
+	if c.isFallback() {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEncodeUnsupported, c.abiMethodElem.Type), 400)
+		return
+	}
+
+	data, err := eth.EncodeMethodCall(c.abiMethod, c.msgParams, r.strictAddrs)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	resBytes, _ := json.MarshalIndent(&encodedCall{
+		To:       c.addr,
+		Method:   c.abiMethod.Sig,
+		Selector: ethbind.API.HexEncode(c.abiMethod.ID),
+		Data:     ethbind.API.HexEncode(data),
+	}, "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
+
 func (r *rest2eth) restAsyncReply(res http.ResponseWriter, req *http.Request, asyncResponse *messages.AsyncSentMsg) {
 	resBytes, _ := json.Marshal(asyncResponse)
 	status := 202 // accepted
@@ -669,7 +1059,7 @@ func (r *rest2eth) restAsyncReply(res http.ResponseWriter, req *http.Request, as
 
 func (r *rest2eth) restErrReply(res http.ResponseWriter, req *http.Request, err error, status int) {
 	log.Errorf("<-- %s %s [%d]: %s", req.Method, req.URL, status, err)
-	reply, _ := json.Marshal(&restErrMsg{Message: err.Error()})
+	reply, _ := json.Marshal(newRESTErrMsg(err, status))
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(status)
 	res.Write(reply)
@@ -19,11 +19,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
@@ -46,7 +49,7 @@ type mockREST2EthDispatcher struct {
 	sendTransactionSyncReceipt *messages.TransactionReceipt
 	sendTransactionSyncError   error
 	deployContractMsg          *messages.DeployContract
-	deployContractSyncReceipt  *messages.TransactionReceipt
+	deployContractSyncReceipt  messages.ReplyWithHeaders
 	deployContractSyncError    error
 }
 
@@ -84,6 +87,15 @@ type mockABILoader struct {
 	nameAvailableError     error
 	capturedAddr           string
 	postDeployError        error
+	postDeployABIID        string
+	signerAliases          map[string]string
+	abiIDs                 []string
+	txPolicy               *txPolicy
+	methodFilter           *methodFilter
+	fingerprintAddr        string
+	fingerprintMsg         *messages.DeployContract
+	fingerprintErr         error
+	checkMethodErr         error
 }
 
 func (m *mockABILoader) SendReply(message interface{}) {
@@ -95,6 +107,19 @@ func (m *mockABILoader) loadDeployMsgForInstance(addrHexNo0x string) (*messages.
 	return m.deployMsg, m.contractInfo, m.loadABIError
 }
 
+func (m *mockABILoader) txPolicyFor(abiID, addrHexNo0x string) *txPolicy {
+	return m.txPolicy
+}
+
+func (m *mockABILoader) methodFilterFor(addrHexNo0x string) *methodFilter {
+	return m.methodFilter
+}
+
+func (m *mockABILoader) bindByFingerprint(ctx context.Context, addrHexNo0x string) (*messages.DeployContract, error) {
+	m.fingerprintAddr = addrHexNo0x
+	return m.fingerprintMsg, m.fingerprintErr
+}
+
 func (m *mockABILoader) resolveContractAddr(registeredName string) (string, error) {
 	return m.registeredContractAddr, m.resolveContractErr
 }
@@ -103,16 +128,39 @@ func (m *mockABILoader) loadDeployMsgByID(addrHexNo0x string) (*messages.DeployC
 	return m.deployMsg, m.abiInfo, m.loadABIError
 }
 
+func (m *mockABILoader) listABIIDs() []string {
+	return m.abiIDs
+}
+
 func (m *mockABILoader) checkNameAvailable(name string, isRemote bool) error {
 	return m.nameAvailableError
 }
 
+func (m *mockABILoader) resolveSignerAlias(alias string) (string, bool) {
+	from, ok := m.signerAliases[alias]
+	return from, ok
+}
+
 func (m *mockABILoader) PreDeploy(msg *messages.DeployContract) error { return nil }
 func (m *mockABILoader) PostDeploy(msg *messages.TransactionReceipt) error {
 	return m.postDeployError
 }
+func (m *mockABILoader) postDeployInstance(msg *messages.TransactionReceipt, abiID string, deployMsg *messages.DeployContract) error {
+	m.postDeployABIID = abiID
+	return m.postDeployError
+}
 func (m *mockABILoader) AddRoutes(router *httprouter.Router) { return }
 func (m *mockABILoader) Shutdown()                           { return }
+func (m *mockABILoader) SubscriptionManager() events.SubscriptionManager {
+	return nil
+}
+func (m *mockABILoader) WithHierarchicalNames(parent http.Handler) http.Handler {
+	return parent
+}
+func (m *mockABILoader) CheckMethod(to string, data []byte) error { return m.checkMethodErr }
+func (m *mockABILoader) CheckSendTransaction(msg *messages.SendTransaction) error {
+	return nil
+}
 
 type mockRPC struct {
 	capturedMethod string
@@ -130,15 +178,32 @@ func (m *mockRPC) CallContext(ctx context.Context, result interface{}, method st
 }
 
 type mockSubMgr struct {
-	err             error
-	updateStreamErr error
-	sub             *events.SubscriptionInfo
-	stream          *events.StreamInfo
-	subs            []*events.SubscriptionInfo
-	streams         []*events.StreamInfo
-	suspended       bool
-	resumed         bool
-	capturedAddr    *ethbinding.Address
+	err                error
+	updateStreamErr    error
+	sub                *events.SubscriptionInfo
+	stream             *events.StreamInfo
+	subs               []*events.SubscriptionInfo
+	streams            []*events.StreamInfo
+	suspended          bool
+	resumed            bool
+	autoResume         *events.AutoResumeSpec
+	capturedAddr       *ethbinding.Address
+	capturedEvent      *ethbinding.ABIElementMarshaling
+	capturedDeleteOpts *events.SubscriptionDeleteOpts
+	autoRegister       *events.AutoRegisterSpec
+	defs               *events.BootstrapConf
+	includeHeaders     bool
+	importedDefs       *events.BootstrapConf
+	idleSubs           []*events.IdleSubscriptionInfo
+	idleTimeout        time.Duration
+	migration          *events.StreamMigration
+	subStatus          *events.SubscriptionStatus
+	exportTimeout      time.Duration
+	deadLetters        []*events.DeadLetter
+	capturedLetterID   string
+	oversizedEvent     *events.OversizedEvent
+	capturedEventID    string
+	webhookSLA         []*events.WebhookSLA
 }
 
 func (m *mockSubMgr) Init() error { return m.err }
@@ -156,13 +221,20 @@ func (m *mockSubMgr) SuspendStream(ctx context.Context, id string) error {
 	m.suspended = true
 	return m.err
 }
+func (m *mockSubMgr) SuspendStreamUntil(ctx context.Context, id string, until *events.AutoResumeSpec) error {
+	m.suspended = true
+	m.autoResume = until
+	return m.err
+}
 func (m *mockSubMgr) ResumeStream(ctx context.Context, id string) error {
 	m.resumed = true
 	return m.err
 }
 func (m *mockSubMgr) DeleteStream(ctx context.Context, id string) error { return m.err }
-func (m *mockSubMgr) AddSubscription(ctx context.Context, addr *ethbinding.Address, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string) (*events.SubscriptionInfo, error) {
+func (m *mockSubMgr) AddSubscription(ctx context.Context, addr *ethbinding.Address, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string, autoRegister *events.AutoRegisterSpec) (*events.SubscriptionInfo, error) {
 	m.capturedAddr = addr
+	m.capturedEvent = event
+	m.autoRegister = autoRegister
 	return m.sub, m.err
 }
 func (m *mockSubMgr) Subscriptions(ctx context.Context) []*events.SubscriptionInfo { return m.subs }
@@ -170,9 +242,61 @@ func (m *mockSubMgr) SubscriptionByID(ctx context.Context, id string) (*events.S
 	return m.sub, m.err
 }
 func (m *mockSubMgr) DeleteSubscription(ctx context.Context, id string) error { return m.err }
+func (m *mockSubMgr) DeleteSubscriptionWithOpts(ctx context.Context, id string, opts *events.SubscriptionDeleteOpts) error {
+	m.capturedDeleteOpts = opts
+	return m.err
+}
 func (m *mockSubMgr) ResetSubscription(ctx context.Context, id, initialBlock string) error {
 	return m.err
 }
+func (m *mockSubMgr) ExportDefinitions(ctx context.Context, includeHeaders bool) *events.BootstrapConf {
+	m.includeHeaders = includeHeaders
+	return m.defs
+}
+func (m *mockSubMgr) ImportDefinitions(ctx context.Context, defs *events.BootstrapConf) error {
+	m.importedDefs = defs
+	return m.err
+}
+func (m *mockSubMgr) SubscriptionStatus(ctx context.Context, id string) (*events.SubscriptionStatus, error) {
+	return m.subStatus, m.err
+}
+func (m *mockSubMgr) ExportStream(ctx context.Context, id string, timeout time.Duration) (*events.StreamMigration, error) {
+	m.exportTimeout = timeout
+	return m.migration, m.err
+}
+func (m *mockSubMgr) ImportStream(ctx context.Context, migration *events.StreamMigration) (*events.StreamInfo, error) {
+	m.migration = migration
+	return migration.Stream, m.err
+}
+func (m *mockSubMgr) IdleSubscriptions(ctx context.Context, idleTimeout time.Duration) ([]*events.IdleSubscriptionInfo, error) {
+	m.idleTimeout = idleTimeout
+	return m.idleSubs, m.err
+}
+func (m *mockSubMgr) DeadLetters(ctx context.Context, streamID string) ([]*events.DeadLetter, error) {
+	return m.deadLetters, m.err
+}
+func (m *mockSubMgr) ReplayDeadLetter(ctx context.Context, streamID, id string) (*events.DeadLetter, error) {
+	m.capturedLetterID = id
+	if len(m.deadLetters) > 0 {
+		return m.deadLetters[0], m.err
+	}
+	return nil, m.err
+}
+func (m *mockSubMgr) DeleteDeadLetter(ctx context.Context, streamID, id string) error {
+	m.capturedLetterID = id
+	return m.err
+}
+func (m *mockSubMgr) OversizedEvent(ctx context.Context, streamID, id string) (*events.OversizedEvent, error) {
+	m.capturedEventID = id
+	return m.oversizedEvent, m.err
+}
+func (m *mockSubMgr) DeleteOversizedEvent(ctx context.Context, streamID, id string) error {
+	m.capturedEventID = id
+	return m.err
+}
+func (m *mockSubMgr) WebhookSLA(ctx context.Context) []*events.WebhookSLA {
+	return m.webhookSLA
+}
 func (m *mockSubMgr) Close() {}
 
 func newTestDeployMsg(t *testing.T, addr string) *deployContractWithAddress {
@@ -306,6 +430,30 @@ func TestDeployContractAsyncSuccess(t *testing.T) {
 	assert.Equal("0xB92F8CebA52fFb5F08f870bd355B1d32f0fd9f7C", dispatcher.asyncDispatchMsg["privateFor"].([]interface{})[1])
 }
 
+func TestDeployContractAsyncRequestIDKeepsABIID(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	deployMsg := newTestDeployMsg(t, "")
+	deployMsg.Headers.ID = "abi1"
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, &mockABILoader{deployMsg: &deployMsg.DeployContract})
+	body, _ := json.Marshal(map[string]interface{}{"i": 12345, "s": "testing"})
+	req := httptest.NewRequest("POST", "/abis/abi1?fly-id=request1", bytes.NewReader(body))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	headers := dispatcher.asyncDispatchMsg["headers"].(map[string]interface{})
+	assert.Equal("request1", headers["id"])
+	assert.Equal("abi1", headers["ctx"].(map[string]interface{})[abiIDContextKey])
+}
+
 func TestDeployContractAsyncHDWallet(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -403,6 +551,38 @@ func TestSendTransactionSyncSuccess(t *testing.T) {
 	assert.Equal(to, dispatcher.sendTransactionMsg.To)
 }
 
+func TestSendTransactionSyncSelectSigner(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	bodyMap := make(map[string]interface{})
+	bodyMap["i"] = 12345
+	bodyMap["s"] = "testing"
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	receipt := &messages.TransactionReceipt{
+		ReplyCommon: messages.ReplyCommon{
+			Headers: messages.ReplyHeaders{
+				CommonHeaders: messages.CommonHeaders{
+					MsgType: messages.MsgTypeTransactionSuccess,
+				},
+			},
+		},
+	}
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: receipt,
+	}
+	_, _, router, res, _ := newTestREST2EthAndMsg(t, dispatcher, from, to, bodyMap)
+	body, _ := json.Marshal(&bodyMap)
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/set?fly-sync&fly-signer=Node", bytes.NewReader(body))
+	req.Header.Add("x-firefly-from", from)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("node", dispatcher.sendTransactionMsg.Signer)
+}
+
 func TestSendTransactionSyncFailure(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -543,6 +723,97 @@ func TestDeployContractSyncSuccess(t *testing.T) {
 	assert.Equal(from, dispatcher.deployContractMsg.From)
 }
 
+func TestDeployContractSyncRegistersAgainstABI(t *testing.T) {
+	assert := assert.New(t)
+
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	contractAddr := ethbind.API.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+	dispatcher := &mockREST2EthDispatcher{
+		deployContractSyncReceipt: &messages.TransactionReceipt{
+			ReplyCommon: messages.ReplyCommon{
+				Headers: messages.ReplyHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeTransactionSuccess,
+					},
+				},
+			},
+			ContractAddress: &contractAddr,
+		},
+	}
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.deployMsg.Headers.ID = "abi1"
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	req := httptest.NewRequest("POST", "/abis/abi1?fly-sync&fly-id=request1", bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("request1", dispatcher.deployContractMsg.Headers.ID)
+	assert.Equal("abi1", abiLoader.postDeployABIID)
+}
+
+func TestDeployContractSyncDryRun(t *testing.T) {
+	assert := assert.New(t)
+
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	contractAddr := ethbind.API.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+	dryRun := &messages.DeployContractDryRun{
+		ContractAddress: &contractAddr,
+		GasStr:          "12345",
+	}
+	dryRun.Headers.MsgType = messages.MsgTypeDeployContractDryRun
+	dispatcher := &mockREST2EthDispatcher{
+		deployContractSyncReceipt: dryRun,
+	}
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.deployMsg.Headers.ID = "abi1"
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	req := httptest.NewRequest("POST", "/abis/abi1?fly-sync&fly-dryrun", bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.True(dispatcher.deployContractMsg.DryRun)
+	assert.Equal("", abiLoader.postDeployABIID)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", reply["contractAddress"])
+	assert.Equal("12345", reply["gas"])
+}
+
+func TestDeployContractSyncSingletonFactory(t *testing.T) {
+	assert := assert.New(t)
+
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	contractAddr := ethbind.API.HexToAddress("0x0123456789abcdef0123456789abcdef01234567")
+	receipt := &messages.TransactionReceipt{
+		ContractAddress: &contractAddr,
+		AlreadyDeployed: true,
+	}
+	receipt.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	dispatcher := &mockREST2EthDispatcher{
+		deployContractSyncReceipt: receipt,
+	}
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.deployMsg.Headers.ID = "abi1"
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	salt := "0x000000000000000000000000000000000000000000000000000000000000002a"
+	req := httptest.NewRequest("POST", "/abis/abi1?fly-sync&fly-singletonfactory&fly-salt="+salt, bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.True(dispatcher.deployContractMsg.SingletonFactory)
+	assert.Equal(salt, dispatcher.deployContractMsg.Salt)
+	assert.Equal("abi1", abiLoader.postDeployABIID)
+	var reply map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal(true, reply["alreadyDeployed"])
+}
+
 func TestDeployContractSyncRemoteRegitryInstance(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -704,6 +975,31 @@ func TestSendTransactionSyncFail(t *testing.T) {
 	err := json.NewDecoder(res.Result().Body).Decode(&reply)
 	assert.NoError(err)
 	assert.Equal("pop", reply.Message)
+	assert.False(reply.Retryable)
+}
+
+func TestSendTransactionSyncFailRetryable(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	bodyMap := make(map[string]interface{})
+	bodyMap["i"] = 12345
+	bodyMap["s"] = "testing"
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncError: fmt.Errorf("transaction underpriced"),
+	}
+	_, _, router, res, req := newTestREST2EthAndMsg(t, dispatcher, from, to, bodyMap)
+	req.Header.Set("x-firefly-sync", "true")
+	router.ServeHTTP(res, req)
+
+	assert.Equal(500, res.Result().StatusCode)
+	reply := restErrMsg{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.True(reply.Retryable)
 }
 
 func TestSendTransactionAsyncFail(t *testing.T) {
@@ -1024,6 +1320,29 @@ func TestSendTransactionBadFrom(t *testing.T) {
 	assert.Equal("From Address must be a 40 character hex string (0x prefix is optional)", reply.Message)
 }
 
+func TestSendTransactionSignerAlias(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.signerAliases = map[string]string{
+		"treasury": "hd-wallet1-path1-3",
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	body, _ := json.Marshal(map[string]interface{}{"to": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"})
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/transfer?fly-from=treasury", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal("hd-wallet1-path1-3", dispatcher.asyncDispatchMsg["from"])
+}
+
 func TestSendTransactionInvalidContract(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -1051,6 +1370,72 @@ func TestSendTransactionInvalidContract(t *testing.T) {
 	assert.Equal("pop", reply.Message)
 }
 
+func TestSendTransactionUnregisteredContractBoundByFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.fingerprintMsg = abiLoader.deployMsg
+	abiLoader.loadABIError = fmt.Errorf("pop")
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	r.fingerprint = true
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/transfer", bytes.NewReader([]byte(`{"to":"`+from+`"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal("567a417717cb6c59ddc1035705f02c0fd1ab1872", abiLoader.fingerprintAddr)
+	assert.Equal(to, dispatcher.asyncDispatchMsg["to"])
+}
+
+func TestSendTransactionUnregisteredContractFingerprintPerRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.loadABIError = fmt.Errorf("pop")
+	abiLoader.fingerprintErr = fmt.Errorf("no match")
+	_, _, router := newTestREST2EthCustomAbiLoader(&mockREST2EthDispatcher{}, abiLoader)
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/transfer?fly-fingerprint", bytes.NewReader([]byte(`{"to":"`+from+`"}`)))
+	req.Header.Set("x-firefly-from", from)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(404, res.Result().StatusCode)
+	reply := restErrMsg{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal("no match", reply.Message)
+}
+
+func TestSendTransactionUnregisteredContractFingerprintDisabledPerRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	from := "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.loadABIError = fmt.Errorf("pop")
+	r, _, router := newTestREST2EthCustomAbiLoader(&mockREST2EthDispatcher{}, abiLoader)
+	r.fingerprint = true
+	req := httptest.NewRequest("POST", "/contracts/"+to+"/transfer", bytes.NewReader([]byte(`{"to":"`+from+`"}`)))
+	req.Header.Set("x-firefly-from", from)
+	req.Header.Set("x-firefly-fingerprint", "false")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Empty(abiLoader.fingerprintAddr)
+}
+
 func TestDeployContractInvalidABI(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -1229,6 +1614,41 @@ func TestCallMethodSuccess(t *testing.T) {
 	assert.Equal("testing", reply["s"])
 }
 
+func TestCallMethodNumbersParam(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{}
+	_, mockRPC, router, res, _ := newTestREST2EthAndMsg(t, dispatcher, "", to, map[string]interface{}{})
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/get?fly-numbers=number", bytes.NewReader([]byte{}))
+	mockRPC.result = "0x000000000000000000000000000000000000000000000000000000000001e2400000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000000774657374696e6700000000000000000000000000000000000000000000000000"
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply map[string]interface{}
+	err := json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.NoError(err)
+	assert.Equal(float64(123456), reply["i"])
+	assert.Equal("testing", reply["s"])
+}
+
+func TestCallMethodNumbersParamBad(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{}
+	_, mockRPC, router, res, _ := newTestREST2EthAndMsg(t, dispatcher, "", to, map[string]interface{}{})
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/get?fly-numbers=float", bytes.NewReader([]byte{}))
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Equal("", mockRPC.capturedMethod)
+}
+
 func TestCallMethodHDWalletSuccess(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	assert := assert.New(t)
@@ -1323,6 +1743,51 @@ func TestCallReadOnlyMethodViaPOSTSuccess(t *testing.T) {
 	assert.Equal("pending", mockRPC.capturedArgs[1])
 }
 
+// mockTimeTravelRPC has a block mined every 10 seconds from the start of 2021
+type mockTimeTravelRPC struct {
+	mockRPC
+}
+
+func (m *mockTimeTravelRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_blockNumber":
+		*(result.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*big.NewInt(100000))
+		return nil
+	case "eth_getBlockByNumber":
+		n, _ := strconv.ParseUint(strings.TrimPrefix(args[0].(string), "0x"), 16, 64)
+		result.(*ethbinding.Header).Time = 1609459200 + n*10
+		return nil
+	}
+	return m.mockRPC.CallContext(ctx, result, method, args...)
+}
+
+func TestCallReadOnlyMethodAtTimestamp(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	to := "0x567a417717cb6c59ddc1035705f02c0fd1ab1872"
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router, res, _ := newTestREST2EthAndMsg(t, dispatcher, "", to, map[string]interface{}{})
+	rpc := &mockTimeTravelRPC{}
+	rpc.result = "0x000000000000000000000000000000000000000000000000000000000001e2400000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000000774657374696e6700000000000000000000000000000000000000000000000000"
+	r.rpc = rpc
+	req := httptest.NewRequest("GET", "/contracts/"+to+"/get?fly-blocknumber=2021-01-01T01:00:05Z", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("eth_call", rpc.capturedMethod)
+	assert.Equal("0x168", rpc.capturedArgs[1])
+
+	res = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/contracts/"+to+"/get?fly-blocknumber=2020-12-31", nil)
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Equal("No block was mined at or before 2020-12-31T00:00:00Z", reply.Message)
+}
+
 func TestCallMethodFail(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -1348,7 +1813,8 @@ func TestCallMethodFail(t *testing.T) {
 	req = httptest.NewRequest("POST", "/contracts/"+to+"/get?fly-blocknumber=ab1234", bytes.NewReader([]byte{}))
 	mockRPC.result = "0x000000000000000000000000000000000000000000000000000000000001e2400000000000000000000000000000000000000000000000000000000000000040000000000000000000000000000000000000000000000000000000000000000774657374696e6700000000000000000000000000000000000000000000000000"
 	router.ServeHTTP(res, req)
-	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Equal("", mockRPC.capturedMethod)
 }
 
 func TestCallMethodViaABIBadAddress(t *testing.T) {
@@ -1558,3 +2024,425 @@ func TestSubscribeWithAddressSubmgrFailure(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal("pop", reply.Message)
 }
+
+func TestSubscribeWithEventOverride(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router := newTestREST2Eth(t, dispatcher)
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
+	}
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(&map[string]interface{}{
+		"stream": "stream1",
+		"event": map[string]interface{}{
+			"inputs": []map[string]interface{}{
+				{"name": "from", "type": "address", "indexed": true},
+				{"name": "value", "type": "uint256"},
+			},
+		},
+	})
+	req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("event", sm.capturedEvent.Type)
+	assert.Equal("Changed", sm.capturedEvent.Name)
+	assert.Len(sm.capturedEvent.Inputs, 2)
+	assert.True(sm.capturedEvent.Inputs[0].Indexed)
+	assert.Equal("uint256", sm.capturedEvent.Inputs[1].Type)
+
+	bodyBytes, _ = json.Marshal(&map[string]interface{}{
+		"stream": "stream1",
+		"event":  "Changed(address indexed from, bytes32 value)",
+	})
+	req = httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("bytes32", sm.capturedEvent.Inputs[1].Type)
+}
+
+func TestSubscribeWithEventOverrideBad(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router := newTestREST2Eth(t, dispatcher)
+	r.subMgr = &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
+	}
+	for event, errMsg := range map[string]string{
+		"Other(uint256)":            "The 'event' ABI fragment is for event 'Other' not 'Changed'",
+		"Changed(":                  "Invalid event signature",
+		`{"type":"function"}`:       "Invalid 'event' ABI fragment: type must be 'event'",
+		`{"inputs":[{"type":"x"}]}`: "Invalid 'event' ABI fragment",
+		`{"inputs":"wrong"}`:        "Invalid 'event' ABI fragment",
+	} {
+		var eventBody interface{} = event
+		if strings.HasPrefix(event, "{") {
+			json.Unmarshal([]byte(event), &eventBody)
+		}
+		bodyBytes, _ := json.Marshal(&map[string]interface{}{
+			"stream": "stream1",
+			"event":  eventBody,
+		})
+		req := httptest.NewRequest("POST", "/contracts/0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8/Changed/subscribe", bytes.NewReader(bodyBytes))
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+
+		assert.Equal(400, res.Result().StatusCode)
+		reply := restErrMsg{}
+		json.NewDecoder(res.Result().Body).Decode(&reply)
+		assert.Regexp(errMsg, reply.Message)
+	}
+}
+
+func newTestFallbackABILoader() *mockABILoader {
+	return &mockABILoader{
+		deployMsg: &messages.DeployContract{
+			ABI: ethbinding.ABIMarshaling{
+				{Type: "receive", StateMutability: "payable"},
+				{Type: "fallback", StateMutability: "payable"},
+			},
+		},
+	}
+}
+
+func TestSendTransactionFallbackSyncSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: &messages.TransactionReceipt{},
+	}
+	dispatcher.sendTransactionSyncReceipt.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	body, _ := json.Marshal(map[string]interface{}{"data": "0xfeedbeef"})
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/fallback?fly-sync&fly-ethvalue=100", bytes.NewReader(body))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("fallback", dispatcher.sendTransactionMsg.Method.Type)
+	assert.Equal("0xfeedbeef", dispatcher.sendTransactionMsg.Data)
+	assert.Equal(json.Number("100"), dispatcher.sendTransactionMsg.Value)
+	assert.Equal("0x567a417717cb6c59ddc1035705f02c0fd1ab1872", dispatcher.sendTransactionMsg.To)
+}
+
+func TestSendTransactionReceiveAsyncSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/receive?fly-ethvalue=100", bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Result().StatusCode)
+	assert.Equal("receive", dispatcher.asyncDispatchMsg["method"].(map[string]interface{})["type"])
+	assert.Nil(dispatcher.asyncDispatchMsg["data"])
+}
+
+func TestCallFallbackUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	req := httptest.NewRequest("GET", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/fallback", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(405, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("The 'fallback' function can only be invoked with a POST to send a transaction", reply.Message)
+}
+
+func TestEncodeCall(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	body, _ := json.Marshal(map[string]interface{}{"to": "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"})
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/transfer/encode", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply encodedCall
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("0x567a417717cb6c59ddc1035705f02c0fd1ab1872", reply.To)
+	assert.Equal("transfer(address)", reply.Method)
+	assert.Equal("0x1a695230", reply.Selector)
+	assert.Equal("0x1a695230000000000000000000000000aa983ad2a0e0ed8ac639277f37be42f2a5d2618c", reply.Data)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestEncodeCallBadParam(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBulkCallABILoader())
+	body, _ := json.Marshal(map[string]interface{}{"to": "badness"})
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/transfer/encode", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Could not be converted to a hex address", reply.Message)
+}
+
+func TestEncodeCallFallbackUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/fallback/encode", bytes.NewReader([]byte("{}")))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("Calldata cannot be encoded for the 'fallback' function", reply.Message)
+}
+
+func TestRPCTimeoutParam(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &rest2eth{maxRPCTimeout: 10 * time.Second}
+	timeout, err := r.rpcTimeout(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(err)
+	assert.Equal(time.Duration(0), timeout)
+
+	timeout, err = r.rpcTimeout(httptest.NewRequest("GET", "/?fly-rpctimeout=2.5", nil))
+	assert.NoError(err)
+	assert.Equal(2500*time.Millisecond, timeout)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("x-firefly-rpctimeout", "500ms")
+	timeout, err = r.rpcTimeout(req)
+	assert.NoError(err)
+	assert.Equal(500*time.Millisecond, timeout)
+
+	timeout, err = r.rpcTimeout(httptest.NewRequest("GET", "/?fly-rpctimeout=1h", nil))
+	assert.NoError(err)
+	assert.Equal(10*time.Second, timeout)
+
+	_, err = r.rpcTimeout(httptest.NewRequest("GET", "/?fly-rpctimeout=-1", nil))
+	assert.EqualError(err, "Invalid fly-rpctimeout '-1' - must be a number of seconds, or a duration such as '500ms'")
+
+	_, err = r.rpcTimeout(httptest.NewRequest("GET", "/?fly-rpctimeout=soon", nil))
+	assert.Regexp("Invalid fly-rpctimeout 'soon'", err)
+}
+
+func TestRPCTimeoutParamDefaultCap(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &rest2eth{}
+	timeout, err := r.rpcTimeout(httptest.NewRequest("GET", "/?fly-rpctimeout=86400", nil))
+	assert.NoError(err)
+	assert.Equal(defaultMaxRPCTimeout*time.Second, timeout)
+}
+
+func TestSendTransactionBadRPCTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/receive?fly-rpctimeout=0", bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Nil(dispatcher.sendTransactionMsg)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func newTestFactoryABILoader() *mockABILoader {
+	return &mockABILoader{
+		deployMsg: &messages.DeployContract{
+			ABI: ethbinding.ABIMarshaling{
+				{
+					Type: "event",
+					Name: "ContractCreated",
+					Inputs: []ethbinding.ABIArgumentMarshaling{
+						{Name: "child", Type: "address", Indexed: true},
+						{Name: "name", Type: "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestSubscribeAutoRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFactoryABILoader())
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "sub1"},
+	}
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"stream": "stream1",
+		"autoRegister": map[string]string{
+			"abi":          "childABI",
+			"addressField": "child",
+			"nameField":    "name",
+		},
+	})
+	req := httptest.NewRequest("POST", "/abis/ABI1/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/ContractCreated/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(&events.AutoRegisterSpec{
+		ABI:          "childABI",
+		AddressField: "child",
+		NameField:    "name",
+	}, sm.autoRegister)
+}
+
+func TestSubscribeAutoRegisterBadSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFactoryABILoader())
+	sm := &mockSubMgr{}
+	r.subMgr = sm
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"stream":       "stream1",
+		"autoRegister": "not an object",
+	})
+	req := httptest.NewRequest("POST", "/abis/ABI1/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/ContractCreated/subscribe", bytes.NewReader(bodyBytes))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Result().Body).Decode(&reply)
+	assert.Regexp("Invalid 'autoRegister' options", reply.Message)
+	assert.Nil(sm.autoRegister)
+}
+
+func TestSendTransactionAsyncRPCTimeoutUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/receive?fly-rpctimeout=5", bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Result().StatusCode)
+	reply := restErrMsg{}
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("fly-rpctimeout is only supported for calls and synchronous transactions", reply.Message)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
+
+func TestSendTransactionSyncRPCTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncReceipt: &messages.TransactionReceipt{
+			ReplyCommon: messages.ReplyCommon{
+				Headers: messages.ReplyHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeTransactionSuccess,
+					},
+				},
+			},
+		},
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestFallbackABILoader())
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/receive?fly-rpctimeout=5&fly-sync", bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Result().StatusCode)
+	assert.NotNil(dispatcher.sendTransactionMsg)
+}
+
+func TestSendTransactionIncludesCustomErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	errorEntry := ethbinding.ABIElementMarshaling{
+		Type: "error",
+		Name: "Unauthorized",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "caller", Type: "address"},
+		},
+	}
+	abiLoader.deployMsg.ABI = append(abiLoader.deployMsg.ABI, errorEntry)
+	dispatcher := &mockREST2EthDispatcher{
+		sendTransactionSyncError: fmt.Errorf("pop"),
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer?fly-sync", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(ethbinding.ABIMarshaling{errorEntry}, dispatcher.sendTransactionMsg.Errors)
+}
+
+func TestSendTransactionLargeIntegerBody(t *testing.T) {
+	assert := assert.New(t)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, newTestBytesABILoader())
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/store", bytes.NewReader([]byte(`{"id":123456789012345678901234567890,"payload":[1,2]}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+	assert.Equal([]interface{}{
+		json.Number("123456789012345678901234567890"),
+		[]interface{}{json.Number("1"), json.Number("2")},
+	}, dispatcher.asyncDispatchMsg["params"])
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, addr := range []string{
+		"0123456789abcdef0123456789abcdef01234567",
+		"0x0123456789abcdef0123456789abcdef01234567",
+		"0X0123456789ABCDEF0123456789ABCDEF01234567",
+		" 0x0123456789ABCDEF0123456789abcdef01234567 ",
+	} {
+		addrHexNo0x, ok := normalizeAddress(addr)
+		assert.True(ok, addr)
+		assert.Equal("0123456789abcdef0123456789abcdef01234567", addrHexNo0x)
+	}
+	for _, addr := range []string{"", "0x", "myContract", "0x0123456789abcdef0123456789abcdef0123456g", "0x0x0123456789abcdef0123456789abcdef01234567"} {
+		_, ok := normalizeAddress(addr)
+		assert.False(ok, addr)
+	}
+}
@@ -0,0 +1,613 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	safeStatusPending  = "pending"
+	safeStatusExecuted = "executed"
+	safeStatusFailed   = "failed"
+
+	safeZeroAddress           = "0x0000000000000000000000000000000000000000"
+	safeOrigin                = "ethconnect"
+	defaultSafeServiceTimeout = 30 * time.Second
+)
+
+var safeTxHashCheck = regexp.MustCompile("^0x[0-9a-f]{64}$")
+
+// SafeConf configures proposing transactions to Safe (formerly Gnosis Safe) multisig contracts,
+// through the Safe transaction service API, instead of submitting them to the node
+type SafeConf struct {
+	utils.HTTPRequesterConf
+	ServiceURL string `json:"serviceURL,omitempty"`
+}
+
+// safeABI is the subset of the Safe contract (v1.3.0 onwards) used to propose and track transactions
+var safeABI = ethbinding.ABIMarshaling{
+	{
+		Type: "function", Name: "nonce", StateMutability: "view",
+		Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "nonce", Type: "uint256"}},
+	},
+	{
+		Type: "function", Name: "isOwner", StateMutability: "view",
+		Inputs:  []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address"}},
+		Outputs: []ethbinding.ABIArgumentMarshaling{{Name: "isOwner", Type: "bool"}},
+	},
+	{
+		Type: "event", Name: "ExecutionSuccess",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "txHash", Type: "bytes32"}, {Name: "payment", Type: "uint256"}},
+	},
+	{
+		Type: "event", Name: "ExecutionFailure",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "txHash", Type: "bytes32"}, {Name: "payment", Type: "uint256"}},
+	},
+}
+
+// safeTxFields are the EIP-712 fields of a Safe transaction, which the owners sign
+var safeTxFields = []eth.TypedDataField{
+	{Name: "to", Type: "address"},
+	{Name: "value", Type: "uint256"},
+	{Name: "data", Type: "bytes"},
+	{Name: "operation", Type: "uint8"},
+	{Name: "safeTxGas", Type: "uint256"},
+	{Name: "baseGas", Type: "uint256"},
+	{Name: "gasPrice", Type: "uint256"},
+	{Name: "gasToken", Type: "address"},
+	{Name: "refundReceiver", Type: "address"},
+	{Name: "nonce", Type: "uint256"},
+}
+
+func safeABIElement(name string) *ethbinding.ABIElementMarshaling {
+	for i := range safeABI {
+		if safeABI[i].Name == name {
+			return &safeABI[i]
+		}
+	}
+	return nil
+}
+
+// safeProposal is the reply to a transaction that is proposed to a Safe, rather than submitted
+type safeProposal struct {
+	Safe        string `json:"safe"`
+	SafeTxHash  string `json:"safeTxHash"`
+	Nonce       string `json:"nonce"`
+	To          string `json:"to"`
+	Value       string `json:"value"`
+	Data        string `json:"data"`
+	Proposer    string `json:"proposer"`
+	BlockNumber string `json:"blockNumber"`
+}
+
+// safeTransactionStatus is the reply to a GET of /safes/:safe/transactions/:safetxhash
+type safeTransactionStatus struct {
+	Safe            string `json:"safe"`
+	SafeTxHash      string `json:"safeTxHash"`
+	Status          string `json:"status"`
+	TransactionHash string `json:"transactionHash,omitempty"`
+	BlockNumber     string `json:"blockNumber,omitempty"`
+}
+
+// safeServiceTransaction is the body POSTed to the Safe transaction service to propose a
+// transaction, and the fields read back when listing the queued transactions of a Safe
+type safeServiceTransaction struct {
+	To                      string      `json:"to"`
+	Value                   string      `json:"value"`
+	Data                    string      `json:"data"`
+	Operation               int         `json:"operation"`
+	SafeTxGas               string      `json:"safeTxGas"`
+	BaseGas                 string      `json:"baseGas"`
+	GasPrice                string      `json:"gasPrice"`
+	GasToken                string      `json:"gasToken"`
+	RefundReceiver          string      `json:"refundReceiver"`
+	Nonce                   json.Number `json:"nonce"`
+	ContractTransactionHash string      `json:"contractTransactionHash"`
+	Sender                  string      `json:"sender"`
+	Signature               string      `json:"signature"`
+	Origin                  string      `json:"origin"`
+}
+
+type safeServiceList struct {
+	Results []*safeServiceTransaction `json:"results"`
+}
+
+// safeService is a client for the Safe transaction service API
+type safeService struct {
+	conf    *SafeConf
+	client  *http.Client
+	mux     sync.Mutex
+	nonceMu map[string]*sync.Mutex
+}
+
+func newSafeService(conf *SafeConf) *safeService {
+	proxy, err := utils.ProxyFunc(conf.ProxyURL)
+	if err != nil {
+		log.Errorf("Safe transaction service: %s", err)
+	}
+	return &safeService{
+		conf: conf,
+		client: &http.Client{
+			Transport: &http.Transport{Proxy: proxy},
+			Timeout:   defaultSafeServiceTimeout,
+		},
+		nonceMu: make(map[string]*sync.Mutex),
+	}
+}
+
+// lockNonce serializes proposals to a Safe, from choosing the nonce until the proposal is
+// queued in the service, so concurrent proposals are not given the same nonce
+func (s *safeService) lockNonce(safe string) func() {
+	s.mux.Lock()
+	l, ok := s.nonceMu[safe]
+	if !ok {
+		l = &sync.Mutex{}
+		s.nonceMu[safe] = l
+	}
+	s.mux.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func (s *safeService) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		reqBody, _ = json.Marshal(body)
+	}
+	url := strings.TrimSuffix(s.conf.ServiceURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeServiceFailed, err)
+	}
+	for name, values := range s.conf.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	log.Infof("%s %s -->", method, url)
+	res, err := s.client.Do(req)
+	if err != nil {
+		log.Errorf("%s %s <-- !Failed: %s", method, url, err)
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeServiceFailed, err)
+	}
+	defer res.Body.Close()
+	resBody, _ := ioutil.ReadAll(res.Body)
+	log.Infof("%s %s <-- [%d]", method, url, res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeServiceStatus, res.StatusCode, strings.TrimSpace(string(resBody)))
+	}
+	if result != nil {
+		if err := json.Unmarshal(resBody, result); err != nil {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeServiceFailed, err)
+		}
+	}
+	return nil
+}
+
+// safeForRequest returns the Safe a transaction should be proposed to, supplied on the request
+// or set in the policy of the ABI or contract instance. The policy of an ABI does not apply
+// to deployments, which cannot be proposed to a Safe
+func safeForRequest(req *http.Request, c *restCmd) string {
+	safe := getFlyParam("safe", req, false)
+	if safe == "" && c.policy != nil && !c.isDeploy {
+		safe = c.policy.Safe
+	}
+	return safe
+}
+
+// callSafe performs an eth_call of a view method of the Safe contract
+func (r *rest2eth) callSafe(ctx context.Context, safe, method string, params []interface{}) (map[string]interface{}, error) {
+	methodABI, err := ethbind.API.ABIElementMarshalingToABIMethod(safeABIElement(method))
+	if err == nil {
+		var result map[string]interface{}
+		if result, err = eth.CallMethod(ctx, r.rpc, nil, "", safe, "", methodABI, params, "latest", false); err == nil {
+			return result, nil
+		}
+	}
+	return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeCallFailed, method, safe, err)
+}
+
+// safeIsOwner checks whether the proposer is an owner of the Safe. Proposals are only
+// accepted from owners, so the node is not asked to sign for a Safe the account cannot act for
+func (r *rest2eth) safeIsOwner(ctx context.Context, safe, proposer string) (bool, error) {
+	result, err := r.callSafe(ctx, safe, "isOwner", []interface{}{proposer})
+	if err != nil {
+		return false, err
+	}
+	return fmt.Sprintf("%v", result["isOwner"]) == "true", nil
+}
+
+// safeValue returns the value of a Safe transaction as a decimal, from a decimal or 0x hex value
+func safeValue(v json.Number) (string, error) {
+	if v == "" {
+		return "0", nil
+	}
+	value, ok := new(big.Int), false
+	if strings.HasPrefix(v.String(), "0x") {
+		value, ok = value.SetString(v.String()[2:], 16)
+	} else {
+		value, ok = value.SetString(v.String(), 10)
+	}
+	if !ok || value.Sign() < 0 {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.TransactionSendBadValue, v)
+	}
+	return value.String(), nil
+}
+
+// safeTransactionHash computes the EIP-712 hash of a Safe transaction (v1.3.0 onwards), which
+// is signed by the proposer. It is computed here rather than read from the Safe, so the hash
+// the node is asked to sign is known to be for the transaction being proposed
+func safeTransactionHash(chainID *big.Int, safe, to, value, data string, nonce *big.Int) (string, error) {
+	hash, err := eth.HashTypedData(&eth.TypedData{
+		Types:       map[string][]eth.TypedDataField{"SafeTx": safeTxFields},
+		PrimaryType: "SafeTx",
+		Domain: map[string]interface{}{
+			"chainId":           chainID.String(),
+			"verifyingContract": safe,
+		},
+		Message: map[string]interface{}{
+			"to":             to,
+			"value":          value,
+			"data":           data,
+			"operation":      "0",
+			"safeTxGas":      "0",
+			"baseGas":        "0",
+			"gasPrice":       "0",
+			"gasToken":       safeZeroAddress,
+			"refundReceiver": safeZeroAddress,
+			"nonce":          nonce.String(),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return ethbind.API.HexEncode(hash), nil
+}
+
+// safeChainID returns the chain ID of the node, which is part of the EIP-712 domain of a Safe
+func (r *rest2eth) safeChainID(ctx context.Context) (*big.Int, error) {
+	chainID := ethbinding.HexBigInt{}
+	if err := r.rpc.CallContext(ctx, &chainID, "eth_chainId"); err != nil {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RPCCallReturnedError, "eth_chainId", err)
+	}
+	return chainID.ToInt(), nil
+}
+
+// safeNonceOverride returns the nonce supplied on the request, such as to replace a transaction
+// that is already queued, or nil if none is supplied
+func safeNonceOverride(req *http.Request) (*big.Int, error) {
+	nonceStr := getFlyParam("safenonce", req, false)
+	if nonceStr == "" {
+		return nil, nil
+	}
+	nonce, ok := new(big.Int).SetString(nonceStr, 10)
+	if !ok || nonce.Sign() < 0 {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeInvalidNonce, nonceStr)
+	}
+	return nonce, nil
+}
+
+// safeNonce returns the nonce for a new Safe transaction. This is the next nonce after any
+// transactions already queued in the service, so proposals do not replace each other
+func (r *rest2eth) safeNonce(ctx context.Context, safe string) (*big.Int, error) {
+	result, err := r.callSafe(ctx, safe, "nonce", []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	nonce, ok := new(big.Int).SetString(fmt.Sprintf("%v", result["nonce"]), 10)
+	if !ok {
+		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeCallFailed, "nonce", safe, result)
+	}
+	var queued safeServiceList
+	path := fmt.Sprintf("/api/v1/safes/%s/multisig-transactions/?executed=false&nonce__gte=%s&ordering=-nonce&limit=1", safe, nonce)
+	if err := r.safe.do(ctx, http.MethodGet, path, nil, &queued); err != nil {
+		return nil, err
+	}
+	if len(queued.Results) > 0 {
+		if last, ok := new(big.Int).SetString(queued.Results[0].Nonce.String(), 10); ok && last.Cmp(nonce) >= 0 {
+			nonce = last.Add(last, big.NewInt(1))
+		}
+	}
+	return nonce, nil
+}
+
+// safeSign signs the Safe transaction hash with eth_sign on the node, so the proposer must be
+// an account the node holds the key for. The Safe contract identifies an eth_sign signature by
+// a v value that is 4 greater than usual
+func (r *rest2eth) safeSign(ctx context.Context, from, safeTxHash string) (string, error) {
+	var sigHex string
+	if err := r.rpc.CallContext(ctx, &sigHex, "eth_sign", from, safeTxHash); err != nil {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeSignFailed, from, err)
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(sigHex, "0x"))
+	if err != nil || len(sig) != 65 {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeSignFailed, from, sigHex)
+	}
+	if sig[64] < 27 {
+		sig[64] += 27
+	}
+	sig[64] += 4
+	return "0x" + hex.EncodeToString(sig), nil
+}
+
+// proposeSafeTransaction encodes a transaction to a contract that is owned by a Safe multisig,
+// and proposes it to the Safe through the transaction service, signed by the from address.
+// It is executed once enough owners have confirmed it, which can be tracked with
+// safeTransactionHandler, or by subscribing to the ExecutionSuccess event of the Safe
+func (r *rest2eth) proposeSafeTransaction(res http.ResponseWriter, req *http.Request, c *restCmd, safeParam string) {
+	if r.safe == nil {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeNotConfigured), 400)
+		return
+	}
+	safeHexNo0x, ok := normalizeAddress(safeParam)
+	if !ok {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeInvalidAddress, safeParam), 400)
+		return
+	}
+	if c.isDeploy {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeDeployUnsupported), 400)
+		return
+	}
+	if !ethbind.API.IsHexAddress(c.from) {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeProposerInvalid, c.from), 400)
+		return
+	}
+
+	var dataBytes []byte
+	var err error
+	if c.isFallback() {
+		if dataBytes, err = hex.DecodeString(strings.TrimPrefix(c.data, "0x")); err != nil {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.TransactionSendBadCalldata, err), 400)
+			return
+		}
+	} else if dataBytes, err = eth.EncodeMethodCall(c.abiMethod, c.msgParams, r.strictAddrs); err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	data := ethbind.API.HexEncode(dataBytes)
+	// The same checks apply as to a transaction submitted to the node
+	if err := r.gw.CheckMethod(c.addr, dataBytes); err != nil {
+		r.restErrReply(res, req, err, 403)
+		return
+	}
+	tx := &messages.TransactionCommon{
+		From:   c.from,
+		Value:  c.value,
+		Signer: strings.ToLower(getFlyParam("signer", req, false)),
+	}
+	if err := c.policy.apply(tx); err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	value, err := safeValue(tx.Value)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	nonce, err := safeNonceOverride(req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+
+	ctx := req.Context()
+	safe := ethbind.API.HexToAddress("0x" + safeHexNo0x).Hex()
+	to := ethbind.API.HexToAddress(c.addr).Hex()
+	proposer := ethbind.API.HexToAddress(c.from).Hex()
+	isOwner, err := r.safeIsOwner(ctx, safe, proposer)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	} else if !isOwner {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeProposerNotOwner, proposer, safe), 403)
+		return
+	}
+	chainID, err := r.safeChainID(ctx)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+	blockNumber, err := eth.GetBlockNumber(ctx, r.rpc)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+
+	unlock := r.safe.lockNonce(safe)
+	defer unlock()
+	if nonce == nil {
+		if nonce, err = r.safeNonce(ctx, safe); err != nil {
+			r.restErrReply(res, req, err, 500)
+			return
+		}
+	}
+	safeTxHash, err := safeTransactionHash(chainID, safe, to, value, data, nonce)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+	signature, err := r.safeSign(ctx, proposer, safeTxHash)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+	err = r.safe.do(ctx, http.MethodPost, fmt.Sprintf("/api/v1/safes/%s/multisig-transactions/", safe), &safeServiceTransaction{
+		To:                      to,
+		Value:                   value,
+		Data:                    data,
+		SafeTxGas:               "0",
+		BaseGas:                 "0",
+		GasPrice:                "0",
+		GasToken:                safeZeroAddress,
+		RefundReceiver:          safeZeroAddress,
+		Nonce:                   json.Number(nonce.String()),
+		ContractTransactionHash: safeTxHash,
+		Sender:                  proposer,
+		Signature:               signature,
+		Origin:                  safeOrigin,
+	}, nil)
+	if err != nil {
+		r.restErrReply(res, req, err, 502)
+		return
+	}
+	log.Infof("Proposed Safe transaction %s to %s with nonce %s", safeTxHash, safe, nonce)
+
+	resBytes, _ := json.MarshalIndent(&safeProposal{
+		Safe:        safe,
+		SafeTxHash:  safeTxHash,
+		Nonce:       nonce.String(),
+		To:          to,
+		Value:       value,
+		Data:        data,
+		Proposer:    proposer,
+		BlockNumber: strconv.FormatUint(blockNumber, 10),
+	}, "", "  ")
+	status := 202
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
+
+// safeExecutionLog is the part of a log emitted by a Safe that identifies an execution
+type safeExecutionLog struct {
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	TransactionHash string   `json:"transactionHash"`
+	BlockNumber     string   `json:"blockNumber"`
+}
+
+// safeTransactionHandler reports whether a proposed Safe transaction has been executed, by
+// searching the ExecutionSuccess and ExecutionFailure events of the Safe from a block
+func (r *rest2eth) safeTransactionHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	safeParam := params.ByName("safe")
+	safeHexNo0x, ok := normalizeAddress(safeParam)
+	if !ok {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeInvalidAddress, safeParam), 404)
+		return
+	}
+	safeTxHash := strings.ToLower(params.ByName("safetxhash"))
+	if !safeTxHashCheck.MatchString(safeTxHash) {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeInvalidTxHash, params.ByName("safetxhash")), 400)
+		return
+	}
+	fromBlock := getFlyParam("fromblock", req, false)
+	if fromBlock == "" {
+		r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeFromBlockRequired, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")), 400)
+		return
+	}
+	chunkSize, err := logsQueryNumber(req, "chunksize", eth.DefaultLogsChunkSize)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+
+	rpcTimeout, err := r.rpcTimeout(req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if rpcTimeout > 0 {
+		req = req.WithContext(eth.WithRPCTimeout(req.Context(), rpcTimeout))
+	}
+
+	blockNumber, err := eth.GetBlockNumber(req.Context(), r.rpc)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+	q, err := eth.NewLogsQuery("0x"+safeHexNo0x, nil, fromBlock, strconv.FormatUint(blockNumber, 10))
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	q.ChunkSize = uint64(chunkSize)
+
+	topics := make(map[string]string)
+	for status, name := range map[string]string{safeStatusExecuted: "ExecutionSuccess", safeStatusFailed: "ExecutionFailure"} {
+		event, err := ethbind.API.ABIElementMarshalingToABIEvent(safeABIElement(name))
+		if err != nil {
+			r.restErrReply(res, req, err, 500)
+			return
+		}
+		topics[strings.ToLower(event.ID.Hex())] = status
+	}
+
+	reply := &safeTransactionStatus{
+		Safe:       ethbind.API.HexToAddress("0x" + safeHexNo0x).Hex(),
+		SafeTxHash: safeTxHash,
+		Status:     safeStatusPending,
+	}
+	for q != nil && reply.Status == safeStatusPending {
+		page, err := eth.GetLogs(req.Context(), r.rpc, q, eth.DefaultLogsPageLimit)
+		if err != nil {
+			r.restErrReply(res, req, err, 500)
+			return
+		}
+		for _, raw := range page.Logs {
+			var l safeExecutionLog
+			if err := json.Unmarshal(raw, &l); err != nil || len(l.Topics) == 0 {
+				continue
+			}
+			// The Safe transaction hash is the first (non-indexed) field of the event data
+			if status, ok := topics[strings.ToLower(l.Topics[0])]; ok && len(l.Data) >= 66 && strings.EqualFold(l.Data[2:66], safeTxHash[2:]) {
+				reply.Status = status
+				reply.TransactionHash = l.TransactionHash
+				if n, err := strconv.ParseUint(strings.TrimPrefix(l.BlockNumber, "0x"), 16, 64); err == nil {
+					reply.BlockNumber = strconv.FormatUint(n, 10)
+				}
+				break
+			}
+		}
+		q = nil
+		if page.Cursor != "" {
+			q, _ = eth.ParseLogsCursor(page.Cursor)
+		}
+	}
+
+	resBytes, _ := json.MarshalIndent(reply, "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
@@ -0,0 +1,367 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testSafe       = "0x5afe5afe5afe5afe5afe5afe5afe5afe5afe5afe"
+	testSafeTxHash = "0x3a1ff2fa32b04b58db3b0bd62c2f1a9b1c0a4a78f44e7c8c3b52ab1e3e42f1d7"
+	testSafeOwner  = `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+)
+
+// safeMockRPC returns the JSON results queued for each method, in order
+type safeMockRPC struct {
+	results map[string][]string
+	errs    map[string]error
+	args    map[string][]interface{}
+}
+
+func (m *safeMockRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if m.args == nil {
+		m.args = make(map[string][]interface{})
+	}
+	m.args[method] = args
+	if err := m.errs[method]; err != nil {
+		return err
+	}
+	rs := m.results[method]
+	if len(rs) == 0 {
+		return fmt.Errorf("unexpected call to %s", method)
+	}
+	m.results[method] = rs[1:]
+	return json.Unmarshal([]byte(rs[0]), result)
+}
+
+func checksumAddress(addr string) string {
+	return ethbind.API.HexToAddress(addr).Hex()
+}
+
+func newTestSafeREST2Eth(t *testing.T, mockRPC *safeMockRPC, serviceURL string) *httprouter.Router {
+	_, router := newTestSafeREST2EthWithLoader(t, mockRPC, serviceURL)
+	return router
+}
+
+func newTestSafeREST2EthWithLoader(t *testing.T, mockRPC *safeMockRPC, serviceURL string) (*mockABILoader, *httprouter.Router) {
+	r, _, router := newTestREST2Eth(t, &mockREST2EthDispatcher{})
+	r.rpc = mockRPC
+	if serviceURL != "" {
+		r.safe = newSafeService(&SafeConf{ServiceURL: serviceURL})
+	}
+	return r.gw.(*mockABILoader), router
+}
+
+func newTestSafeProposal(query string) *http.Request {
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set?"+query, bytes.NewReader([]byte(`{"i":12345,"s":"testing"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	return req
+}
+
+func safeProposalRPC(nonceCalls ...string) *safeMockRPC {
+	return &safeMockRPC{
+		results: map[string][]string{
+			"eth_chainId":     {`"0x539"`},
+			"eth_blockNumber": {`"0x3039"`},
+			"eth_call":        append([]string{testSafeOwner}, nonceCalls...),
+			"eth_sign":        {`"0x` + strings.Repeat("ab", 64) + `1b"`},
+		},
+	}
+}
+
+func TestSafeTransactionHash(t *testing.T) {
+	hash, err := safeTransactionHash(big.NewInt(1337), checksumAddress(testSafe), "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", "1000", "0x12345678", big.NewInt(7))
+	assert.NoError(t, err)
+	assert.Equal(t, "0x9cdd92985874a25c9aa7c8949d51fba48cf284097f27a16237438750dcec1e8d", hash)
+}
+
+func TestSafeProposeTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	var proposed map[string]interface{}
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("/api/v1/safes/"+checksumAddress(testSafe)+"/multisig-transactions/", req.URL.Path)
+		if req.Method == http.MethodGet {
+			assert.Equal("5", req.URL.Query().Get("nonce__gte"))
+			res.Write([]byte(`{"results":[{"nonce":6}]}`))
+			return
+		}
+		json.NewDecoder(req.Body).Decode(&proposed)
+		res.WriteHeader(201)
+	}))
+	defer svr.Close()
+
+	mockRPC := safeProposalRPC(`"0x` + fmt.Sprintf("%064x", 5) + `"`)
+	router := newTestSafeREST2Eth(t, mockRPC, svr.URL)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe))
+
+	assert.Equal(202, res.Code)
+	var reply safeProposal
+	json.NewDecoder(res.Body).Decode(&reply)
+	expectedHash, err := safeTransactionHash(big.NewInt(1337), checksumAddress(testSafe), reply.To, "0", reply.Data, big.NewInt(7))
+	assert.NoError(err)
+	assert.Equal(expectedHash, reply.SafeTxHash)
+	assert.Equal("7", reply.Nonce)
+	assert.Equal("12345", reply.BlockNumber)
+	assert.Equal("0", reply.Value)
+	assert.Equal(checksumAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"), reply.Proposer)
+	assert.Equal(checksumAddress("0x567a417717cb6c59ddc1035705f02c0fd1ab1872"), reply.To)
+	assert.True(strings.HasPrefix(reply.Data, "0x"))
+
+	assert.Equal(reply.SafeTxHash, proposed["contractTransactionHash"])
+	assert.Equal("0x"+strings.Repeat("ab", 64)+"1f", proposed["signature"])
+	assert.Equal(float64(7), proposed["nonce"])
+	assert.Equal(reply.Data, proposed["data"])
+	assert.Equal(reply.Proposer, proposed["sender"])
+	assert.Equal(float64(0), proposed["operation"])
+	assert.Equal([]interface{}{reply.Proposer, reply.SafeTxHash}, mockRPC.args["eth_sign"])
+}
+
+func TestSafeProposeTransactionNotOwner(t *testing.T) {
+	mockRPC := safeProposalRPC()
+	mockRPC.results["eth_call"] = []string{`"0x` + strings.Repeat("0", 64) + `"`}
+	router := newTestSafeREST2Eth(t, mockRPC, "http://localhost:0")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe+"&fly-safenonce=3"))
+
+	assert.Equal(t, 403, res.Code)
+	assert.Regexp(t, "The proposer "+checksumAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")+" is not an owner of Safe", res.Body.String())
+	assert.Nil(t, mockRPC.args["eth_sign"])
+}
+
+func TestSafeProposeTransactionMethodNotAllowed(t *testing.T) {
+	mockRPC := safeProposalRPC()
+	abiLoader, router := newTestSafeREST2EthWithLoader(t, mockRPC, "http://localhost:0")
+	abiLoader.checkMethodErr = fmt.Errorf("Method 'set' is not allowed")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe))
+
+	assert.Equal(t, 403, res.Code)
+	assert.Regexp(t, "Method 'set' is not allowed", res.Body.String())
+	assert.Nil(t, mockRPC.args["eth_sign"])
+}
+
+func TestSafeProposeTransactionPolicyMaxValue(t *testing.T) {
+	mockRPC := safeProposalRPC()
+	abiLoader, router := newTestSafeREST2EthWithLoader(t, mockRPC, "http://localhost:0")
+	abiLoader.txPolicy = &txPolicy{MaxValue: "10"}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe+"&fly-ethvalue=100"))
+
+	assert.Equal(t, 400, res.Code)
+	assert.Regexp(t, "The value of 100 exceeds the maximum of 10 allowed by the transaction policy", res.Body.String())
+}
+
+func TestSafeProposeTransactionSerializesNonces(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSafeService(&SafeConf{})
+	unlock := s.lockNonce(testSafe)
+	locked := make(chan struct{})
+	go func() {
+		defer s.lockNonce(testSafe)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		assert.Fail("second proposal was not held")
+	case <-time.After(10 * time.Millisecond):
+	}
+	// Other Safes are not held
+	s.lockNonce("0x0000000000000000000000000000000000000001")()
+	unlock()
+	<-locked
+}
+
+func TestSafeProposeTransactionNonceOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(http.MethodPost, req.Method)
+		res.WriteHeader(422)
+		res.Write([]byte(`{"nonRequiredParams":["Nonce already executed"]}`))
+	}))
+	defer svr.Close()
+
+	router := newTestSafeREST2Eth(t, safeProposalRPC(), svr.URL)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe+"&fly-safenonce=3"))
+
+	assert.Equal(502, res.Code)
+	assert.Regexp("Safe transaction service returned status 422: .*Nonce already executed", res.Body.String())
+}
+
+func TestSafeProposeTransactionBadNonce(t *testing.T) {
+	router := newTestSafeREST2Eth(t, safeProposalRPC(), "http://localhost:0")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe+"&fly-safenonce=-1"))
+
+	assert.Equal(t, 400, res.Code)
+	assert.Regexp(t, "Invalid Safe nonce '-1'", res.Body.String())
+}
+
+func TestSafeProposeTransactionSignFail(t *testing.T) {
+	mockRPC := safeProposalRPC()
+	mockRPC.errs = map[string]error{"eth_sign": fmt.Errorf("unknown account")}
+	router := newTestSafeREST2Eth(t, mockRPC, "http://localhost:0")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe+"&fly-safenonce=3"))
+
+	assert.Equal(t, 500, res.Code)
+	assert.Regexp(t, "Failed to sign the Safe transaction hash with "+checksumAddress("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")+": unknown account", res.Body.String())
+}
+
+func TestSafeProposeTransactionNonceCallFail(t *testing.T) {
+	// Only the isOwner call succeeds
+	mockRPC := safeProposalRPC()
+	router := newTestSafeREST2Eth(t, mockRPC, "http://localhost:0")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe))
+
+	assert.Equal(t, 500, res.Code)
+	assert.Regexp(t, "Failed to call 'nonce' on Safe", res.Body.String())
+}
+
+func TestSafeProposeTransactionNotConfigured(t *testing.T) {
+	router := newTestSafeREST2Eth(t, &safeMockRPC{}, "")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe="+testSafe))
+
+	assert.Equal(t, 400, res.Code)
+	assert.Regexp(t, "requires the Safe transaction service URL", res.Body.String())
+}
+
+func TestSafeProposeTransactionBadSafe(t *testing.T) {
+	router := newTestSafeREST2Eth(t, &safeMockRPC{}, "http://localhost:0")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, newTestSafeProposal("fly-safe=bad"))
+
+	assert.Equal(t, 400, res.Code)
+	assert.Regexp(t, "Invalid Safe address 'bad'", res.Body.String())
+}
+
+func TestSafeProposeTransactionHDWalletProposer(t *testing.T) {
+	router := newTestSafeREST2Eth(t, &safeMockRPC{}, "http://localhost:0")
+	res := httptest.NewRecorder()
+	req := newTestSafeProposal("fly-safe=" + testSafe)
+	req.Header.Set("x-firefly-from", "hd-wallet1-path1-3")
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, 400, res.Code)
+	assert.Regexp(t, "must be an account the node can sign with", res.Body.String())
+}
+
+func TestSafeForRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("POST", "/contracts/0x567a417717cb6c59ddc1035705f02c0fd1ab1872/set", nil)
+	assert.Equal("", safeForRequest(req, &restCmd{}))
+	assert.Equal(testSafe, safeForRequest(req, &restCmd{policy: &txPolicy{Safe: testSafe}}))
+	assert.Equal("", safeForRequest(req, &restCmd{policy: &txPolicy{Safe: testSafe}, isDeploy: true}))
+
+	req.Header.Set("x-firefly-safe", "0x0000000000000000000000000000000000000001")
+	assert.Equal("0x0000000000000000000000000000000000000001", safeForRequest(req, &restCmd{policy: &txPolicy{Safe: testSafe}}))
+}
+
+func safeExecutionLogJSON(t *testing.T, eventName, safeTxHash string) string {
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(safeABIElement(eventName))
+	assert.NoError(t, err)
+	return `[{"topics":["` + event.ID.Hex() + `"],"data":"` + safeTxHash + strings.Repeat("0", 64) + `","transactionHash":"0x1234","blockNumber":"0x3040"}]`
+}
+
+func TestSafeTransactionExecuted(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC := &safeMockRPC{
+		results: map[string][]string{
+			"eth_blockNumber": {`"0x3050"`},
+			"eth_getLogs":     {safeExecutionLogJSON(t, "ExecutionSuccess", "0x"+strings.Repeat("11", 32)), safeExecutionLogJSON(t, "ExecutionSuccess", testSafeTxHash)},
+		},
+	}
+	router := newTestSafeREST2Eth(t, mockRPC, "")
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/safes/"+testSafe+"/transactions/"+testSafeTxHash+"?fly-fromblock=12345&fly-chunksize=16", nil)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Code)
+	var reply safeTransactionStatus
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal(safeStatusExecuted, reply.Status)
+	assert.Equal("0x1234", reply.TransactionHash)
+	assert.Equal("12352", reply.BlockNumber)
+	assert.Equal(checksumAddress(testSafe), reply.Safe)
+}
+
+func TestSafeTransactionFailed(t *testing.T) {
+	mockRPC := &safeMockRPC{
+		results: map[string][]string{
+			"eth_blockNumber": {`"0x3040"`},
+			"eth_getLogs":     {safeExecutionLogJSON(t, "ExecutionFailure", testSafeTxHash)},
+		},
+	}
+	router := newTestSafeREST2Eth(t, mockRPC, "")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/safes/"+testSafe+"/transactions/"+testSafeTxHash+"?fly-fromblock=12345", nil))
+
+	assert.Equal(t, 200, res.Code)
+	assert.Regexp(t, `"status": "failed"`, res.Body.String())
+}
+
+func TestSafeTransactionPending(t *testing.T) {
+	mockRPC := &safeMockRPC{
+		results: map[string][]string{
+			"eth_blockNumber": {`"0x3040"`},
+			"eth_getLogs":     {`[]`},
+		},
+	}
+	router := newTestSafeREST2Eth(t, mockRPC, "")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest("GET", "/safes/"+testSafe+"/transactions/"+testSafeTxHash+"?fly-fromblock=12345", nil))
+
+	assert.Equal(t, 200, res.Code)
+	assert.Regexp(t, `"status": "pending"`, res.Body.String())
+}
+
+func TestSafeTransactionBadRequests(t *testing.T) {
+	assert := assert.New(t)
+	router := newTestSafeREST2Eth(t, &safeMockRPC{errs: map[string]error{"eth_blockNumber": fmt.Errorf("pop")}}, "")
+
+	for path, expected := range map[string]string{
+		"/safes/bad/transactions/" + testSafeTxHash + "?fly-fromblock=1":              "Invalid Safe address 'bad'",
+		"/safes/" + testSafe + "/transactions/0x1234?fly-fromblock=1":                 "Invalid Safe transaction hash '0x1234'",
+		"/safes/" + testSafe + "/transactions/" + testSafeTxHash:                      "fly-fromblock is required",
+		"/safes/" + testSafe + "/transactions/" + testSafeTxHash + "?fly-fromblock=1": "pop",
+	} {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest("GET", path, nil))
+		assert.NotEqual(200, res.Code)
+		assert.Regexp(expected, res.Body.String())
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	log "github.com/sirupsen/logrus"
+)
+
+var signerAliasCheck = regexp.MustCompile("^[a-zA-Z0-9._-]+$")
+
+// signerAlias maps a friendly name, that can be passed as the from address of
+// a request, to an address or HD wallet reference
+type signerAlias struct {
+	messages.TimeSorted
+	Alias string `json:"alias"`
+	From  string `json:"from"`
+}
+
+// GetID returns the alias
+func (s *signerAlias) GetID() string {
+	return s.Alias
+}
+
+// normalizeFrom validates an address or HD wallet reference, returning it in the
+// form used to sign transactions
+func normalizeFrom(from string) (string, bool) {
+	fromNo0xPrefix, ok := normalizeAddress(from)
+	if ok {
+		return "0x" + fromNo0xPrefix, true
+	} else if tx.IsHDWalletRequest(fromNo0xPrefix) != nil {
+		return fromNo0xPrefix, true
+	}
+	return "", false
+}
+
+// resolveSignerAlias returns the address or HD wallet reference registered for an alias
+func (g *smartContractGW) resolveSignerAlias(alias string) (string, bool) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	info, exists := g.signerAliases[alias]
+	if !exists {
+		return "", false
+	}
+	log.Infof("%s -> %s", alias, info.From)
+	return info.From, true
+}
+
+func (g *smartContractGW) signerAliasFile(alias string) string {
+	return g.files.path("signer_" + alias + ".alias.json")
+}
+
+func (g *smartContractGW) addFileToSignerAliasIndex(alias, fileName string) {
+	aliasBytes, err := g.files.readFile(fileName)
+	if err != nil {
+		log.Errorf("Failed to load signer alias file %s: %s", fileName, err)
+		return
+	}
+	var info signerAlias
+	err = json.Unmarshal(aliasBytes, &info)
+	if err != nil {
+		log.Errorf("Failed to parse signer alias file %s: %s", fileName, err)
+		return
+	}
+	if info.Alias != alias {
+		log.Errorf("Signer alias file %s contains mismatched alias '%s'", fileName, info.Alias)
+		return
+	}
+	g.idxLock.Lock()
+	g.signerAliases[info.Alias] = &info
+	g.idxLock.Unlock()
+}
+
+func (g *smartContractGW) listSignerAliases(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	g.idxLock.Lock()
+	retval := make([]*signerAlias, 0, len(g.signerAliases))
+	for _, info := range g.signerAliases {
+		retval = append(retval, info)
+	}
+	g.idxLock.Unlock()
+
+	sort.Slice(retval, func(i, j int) bool {
+		return retval[i].IsLessThan(retval[i], retval[j])
+	})
+
+	g.signerAliasReply(res, req, retval, 200)
+}
+
+func (g *smartContractGW) getSignerAlias(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	alias := params.ByName("alias")
+	g.idxLock.Lock()
+	info, exists := g.signerAliases[alias]
+	g.idxLock.Unlock()
+	if !exists {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasNotFound, alias), 404)
+		return
+	}
+
+	g.signerAliasReply(res, req, info, 200)
+}
+
+// storeSignerAlias creates an alias, or re-points an existing one
+func (g *smartContractGW) storeSignerAlias(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var body signerAlias
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasFromInvalid), 400)
+		return
+	}
+	// An alias that could be mistaken for an address or HD wallet reference would never be used
+	if _, isFrom := normalizeFrom(body.Alias); isFrom || !signerAliasCheck.MatchString(body.Alias) {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasInvalid, body.Alias), 400)
+		return
+	}
+	from, ok := normalizeFrom(body.From)
+	if !ok {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasFromInvalid), 400)
+		return
+	}
+
+	info := &signerAlias{
+		TimeSorted: messages.TimeSorted{
+			CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
+		},
+		Alias: body.Alias,
+		From:  from,
+	}
+	infoBytes, _ := json.MarshalIndent(info, "", "  ")
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	log.Infof("Storing signer alias '%s' -> %s", info.Alias, info.From)
+	if err := g.files.writeFile(g.signerAliasFile(info.Alias), infoBytes); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasSave, err), 500)
+		return
+	}
+	g.signerAliases[info.Alias] = info
+
+	g.signerAliasReply(res, req, info, 200)
+}
+
+func (g *smartContractGW) deleteSignerAlias(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	alias := params.ByName("alias")
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	if _, exists := g.signerAliases[alias]; !exists {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasNotFound, alias), 404)
+		return
+	}
+	if err := g.files.removeFile(g.signerAliasFile(alias)); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySignerAliasDelete, err), 500)
+		return
+	}
+	delete(g.signerAliases, alias)
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.WriteHeader(status)
+}
+
+func (g *smartContractGW) signerAliasReply(res http.ResponseWriter, req *http.Request, reply interface{}, status int) {
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(reply)
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSignerAliasGW(dir string) (*smartContractGW, *httprouter.Router) {
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL:     "http://localhost/api/v1",
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	return scgw, router
+}
+
+func testSignerAliasPath(router *httprouter.Router, method, path, body string, results interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if results != nil {
+		json.NewDecoder(res.Body).Decode(results)
+	}
+	return res
+}
+
+func TestSignerAliasLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestSignerAliasGW(dir)
+
+	var info signerAlias
+	res := testSignerAliasPath(router, "POST", "/signers", `{"alias":"treasury","from":"0x66C5FE653E7A9EBB628A6D40F0452D1E358BAEE8"}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("treasury", info.Alias)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", info.From)
+	assert.NotEmpty(info.CreatedISO8601)
+
+	res = testSignerAliasPath(router, "POST", "/signers", `{"alias":"payroll","from":"HD-wallet1-path1-3"}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("hd-wallet1-path1-3", info.From)
+
+	var list []*signerAlias
+	res = testSignerAliasPath(router, "GET", "/signers", "", &list)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Len(list, 2)
+
+	res = testSignerAliasPath(router, "GET", "/signers/treasury", "", &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", info.From)
+
+	// Re-point an existing alias
+	res = testSignerAliasPath(router, "POST", "/signers", `{"alias":"treasury","from":"567a417717cb6c59ddc1035705f02c0fd1ab1872"}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	from, ok := scgw.resolveSignerAlias("treasury")
+	assert.True(ok)
+	assert.Equal("0x567a417717cb6c59ddc1035705f02c0fd1ab1872", from)
+
+	// A new gateway picks the aliases up from the storage path
+	scgw2, _ := newTestSignerAliasGW(dir)
+	from, ok = scgw2.resolveSignerAlias("payroll")
+	assert.True(ok)
+	assert.Equal("hd-wallet1-path1-3", from)
+
+	res = testSignerAliasPath(router, "DELETE", "/signers/treasury", "", nil)
+	assert.Equal(204, res.Result().StatusCode)
+	_, err := os.Stat(path.Join(dir, "signer_treasury.alias.json"))
+	assert.True(os.IsNotExist(err))
+	_, ok = scgw.resolveSignerAlias("treasury")
+	assert.False(ok)
+
+	var errInfo restErrMsg
+	res = testSignerAliasPath(router, "GET", "/signers/treasury", "", &errInfo)
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Equal("No signer alias registered with name 'treasury'", errInfo.Message)
+
+	res = testSignerAliasPath(router, "DELETE", "/signers/treasury", "", &errInfo)
+	assert.Equal(404, res.Result().StatusCode)
+}
+
+func TestStoreSignerAliasInvalid(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestSignerAliasGW(dir)
+
+	var errInfo restErrMsg
+	res := testSignerAliasPath(router, "POST", "/signers", `!json`, &errInfo)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Must supply a 'from' address", errInfo.Message)
+
+	for _, alias := range []string{"", "../treasury", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8", "hd-wallet1-path1-3"} {
+		body, _ := json.Marshal(&signerAlias{Alias: alias, From: "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"})
+		res = testSignerAliasPath(router, "POST", "/signers", string(body), &errInfo)
+		assert.Equal(400, res.Result().StatusCode)
+		assert.Regexp("Signer alias '.*' is invalid", errInfo.Message)
+	}
+
+	res = testSignerAliasPath(router, "POST", "/signers", `{"alias":"treasury","from":"badness"}`, &errInfo)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Must supply a 'from' address", errInfo.Message)
+}
+
+func TestStoreSignerAliasWriteFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestSignerAliasGW(path.Join(dir, "missing"))
+
+	var errInfo restErrMsg
+	res := testSignerAliasPath(router, "POST", "/signers", `{"alias":"treasury","from":"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}`, &errInfo)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Regexp("Failed to write signer alias", errInfo.Message)
+}
+
+func TestSignerAliasRequiresAuth(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestSignerAliasGW(dir)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	for _, method := range []string{"GET", "POST"} {
+		res := testSignerAliasPath(router, method, "/signers", `{"alias":"treasury","from":"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}`, nil)
+		assert.Equal(401, res.Result().StatusCode)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		res := testSignerAliasPath(router, method, "/signers/treasury", "", nil)
+		assert.Equal(401, res.Result().StatusCode)
+	}
+
+	ctx, _ := auth.WithAuthContext(context.Background(), "testat")
+	req := httptest.NewRequest("POST", "/signers", bytes.NewReader([]byte(`{"alias":"treasury","from":"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}`))).WithContext(ctx)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Result().StatusCode)
+}
+
+func TestBuildIndexSignerAliasBadFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	ioutil.WriteFile(path.Join(dir, "signer_bad.alias.json"), []byte("!json"), 0664)
+	ioutil.WriteFile(path.Join(dir, "signer_mismatch.alias.json"), []byte(`{"alias":"other","from":"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}`), 0664)
+	scgw, _ := newTestSignerAliasGW(dir)
+	assert.Empty(scgw.signerAliases)
+
+	scgw.addFileToSignerAliasIndex("missing", path.Join(dir, "signer_missing.alias.json"))
+	assert.Empty(scgw.signerAliases)
+}
@@ -15,22 +15,22 @@
 package contracts
 
 import (
-	"bufio"
-	"bytes"
+	"archive/tar"
+	"archive/zip"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -58,6 +58,9 @@ const (
 	maxFormParsingMemory     = 32 << 20 // 32 MB
 	errEventSupportMissing   = "Event support is not configured on this gateway"
 	remoteRegistryContextKey = "isRemoteRegistry"
+	abiIDContextKey          = "abiId"
+	// SystemAPIPath is the path of the OpenAPI definition for the built-in (non-contract) APIs
+	SystemAPIPath = "/api"
 )
 
 // SmartContractGateway provides gateway functions for OpenAPI 2.0 processing of Solidity contracts
@@ -65,7 +68,11 @@ type SmartContractGateway interface {
 	PreDeploy(msg *messages.DeployContract) error
 	PostDeploy(msg *messages.TransactionReceipt) error
 	AddRoutes(router *httprouter.Router)
+	WithHierarchicalNames(parent http.Handler) http.Handler
 	SendReply(message interface{})
+	SubscriptionManager() events.SubscriptionManager
+	CheckMethod(to string, data []byte) error
+	CheckSendTransaction(msg *messages.SendTransaction) error
 	Shutdown()
 }
 
@@ -74,21 +81,64 @@ type smartContractGatewayInt interface {
 	resolveContractAddr(registeredName string) (string, error)
 	loadDeployMsgForInstance(addrHexNo0x string) (*messages.DeployContract, *contractInfo, error)
 	loadDeployMsgByID(abi string) (*messages.DeployContract, *abiInfo, error)
+	listABIIDs() []string
 	checkNameAvailable(name string, isRemote bool) error
+	resolveSignerAlias(alias string) (string, bool)
+	txPolicyFor(abiID, addrHexNo0x string) *txPolicy
+	methodFilterFor(addrHexNo0x string) *methodFilter
+	postDeployInstance(msg *messages.TransactionReceipt, abiID string, deployMsg *messages.DeployContract) error
+	bindByFingerprint(ctx context.Context, addrHexNo0x string) (*messages.DeployContract, error)
 }
 
 // SmartContractGatewayConf configuration
 type SmartContractGatewayConf struct {
 	events.SubscriptionManagerConf
-	StoragePath    string             `json:"storagePath"`
-	BaseURL        string             `json:"baseURL"`
-	RemoteRegistry RemoteRegistryConf `json:"registry,omitempty"` // JSON only config - no commandline
+	StoragePath         string                   `json:"storagePath"`
+	InMemory            bool                     `json:"inMemory,omitempty"`
+	BaseURL             string                   `json:"baseURL"`
+	OpenAPIHost         string                   `json:"openapiHost,omitempty"`
+	OpenAPIBasePath     string                   `json:"openapiBasePath,omitempty"`
+	MaxRPCTimeout       int                      `json:"maxRPCTimeout"`
+	ReplayWindow        int                      `json:"replayWindowSec"`
+	VerifyCode          bool                     `json:"verifyCode"`
+	FingerprintABIs     bool                     `json:"fingerprintABIs"`
+	StrictBodies        bool                     `json:"strictBodies"`
+	RemoteRegistry      RemoteRegistryConf       `json:"registry,omitempty"` // JSON only config - no commandline
+	Solc                eth.SolcConf             `json:"solc,omitempty"`
+	PostDeployHooks     []PostDeployHookConf     `json:"postDeployHooks,omitempty"`     // JSON only config - no commandline
+	ParamTransformHooks []ParamTransformHookConf `json:"paramTransformHooks,omitempty"` // JSON only config - no commandline
+	ReadPool            ReadPoolConf             `json:"readPool"`
+	Safe                SafeConf                 `json:"safe,omitempty"`
+}
+
+// Enabled returns true if the gateway is configured to store contracts, in a directory or in memory
+func (conf *SmartContractGatewayConf) Enabled() bool {
+	return conf.StoragePath != "" || conf.InMemory
 }
 
 // CobraInitContractGateway standard naming for contract gateway command params
 func CobraInitContractGateway(cmd *cobra.Command, conf *SmartContractGatewayConf) {
 	cmd.Flags().StringVarP(&conf.StoragePath, "openapi-path", "I", "", "Path containing ABI + generated OpenAPI/Swagger 2.0 contact definitions")
+	cmd.Flags().BoolVar(&conf.InMemory, "openapi-memory", strings.ToLower(os.Getenv("OPENAPI_MEMORY")) == "true", "Store ABIs, contract instances and event streams in memory, instead of the openapi-path and events-db, for ephemeral test environments")
 	cmd.Flags().StringVarP(&conf.BaseURL, "openapi-baseurl", "U", "", "Base URL for generated OpenAPI/Swagger 2.0 contact definitions")
+	cmd.Flags().StringVar(&conf.OpenAPIHost, "openapi-host", os.Getenv("OPENAPI_HOST"), "Host (and optional port) to advertise in generated OpenAPI/Swagger 2.0 definitions, when different to the base URL (override per-request with host)")
+	cmd.Flags().StringVar(&conf.OpenAPIBasePath, "openapi-basepath", os.Getenv("OPENAPI_BASEPATH"), "Base path to advertise in generated OpenAPI/Swagger 2.0 definitions, when different to the base URL (override per-request with basepath)")
+	cmd.Flags().BoolVar(&conf.VerifyCode, "verify-code", false, "Verify contract code exists at an address when registering it (override per-request with fly-verify)")
+	cmd.Flags().BoolVar(&conf.FingerprintABIs, "fingerprint-abis", false, "Bind unregistered contract addresses to a stored ABI with a matching bytecode fingerprint (override per-request with fly-fingerprint)")
+	cmd.Flags().BoolVar(&conf.StrictBodies, "strict-bodies", false, "Reject request bodies with unknown fields, or values that do not match the type of the parameter, with a 400 listing each problem (override per-request with fly-strict)")
+	cmd.Flags().IntVar(&conf.MaxRPCTimeout, "max-rpc-timeout", utils.DefInt("ETH_MAX_RPC_TIMEOUT", defaultMaxRPCTimeout), "Maximum value accepted for the per-request RPC timeout override (seconds)")
+	cmd.Flags().IntVar(&conf.ReplayWindow, "replay-window", utils.DefInt("ETH_REPLAY_WINDOW", defaultReplayWindow), "Window in which a transaction submitted again with the same fly-id returns the recorded reply (seconds, 0 to disable)")
+	cmd.Flags().StringArrayVar(&conf.Solc.Remappings, "solc-remapping", utils.DefStringArray("SOLC_REMAPPINGS"), "Import remapping for compiling uploaded Solidity, as [context:]prefix=target (such as @openzeppelin/=/opt/openzeppelin/)")
+	cmd.Flags().StringArrayVar(&conf.Solc.AllowedPaths, "solc-allow-path", utils.DefStringArray("SOLC_ALLOW_PATHS"), "Additional path solc is allowed to import from when compiling uploaded Solidity")
+	cmd.Flags().Int64Var(&conf.Solc.MaxSourceSize, "solc-max-source-size", int64(utils.DefInt("SOLC_MAX_SOURCE_SIZE", eth.DefaultSolcMaxSourceSize)), "Maximum total size in bytes of the files uploaded to compile, after extracting archives")
+	cmd.Flags().Int64Var(&conf.Solc.MaxOutputSize, "solc-max-output-size", int64(utils.DefInt("SOLC_MAX_OUTPUT_SIZE", eth.DefaultSolcMaxOutputSize)), "Maximum size in bytes of the output of solc, beyond which the compile is stopped")
+	cmd.Flags().IntVar(&conf.ReadPool.Workers, "read-workers", utils.DefInt("ETH_READ_WORKERS", 0), "Workers dedicated to read-only calls, on their own JSON/RPC connections, so transactions cannot starve them (0=disabled)")
+	cmd.Flags().IntVar(&conf.ReadPool.Connections, "read-connections", utils.DefInt("ETH_READ_CONNECTIONS", defaultReadPoolConnections), "JSON/RPC connections the read-only call workers share")
+	cmd.Flags().IntVar(&conf.ReadPool.QueueTimeoutSec, "read-queue-timeout", utils.DefInt("ETH_READ_QUEUE_TIMEOUT", defaultReadPoolQueueTimeoutSec), "Maximum time a read-only call waits for a free worker, before a 503 is returned (seconds)")
+	cmd.Flags().StringVar(&conf.ReadPool.RPC.URL, "read-rpc-url", os.Getenv("ETH_READ_RPC_URL"), "JSON/RPC URL for read-only calls, such as a replica node (default is the rpc-url)")
+	cmd.Flags().StringVar(&conf.Safe.ServiceURL, "safe-service-url", os.Getenv("ETH_SAFE_SERVICE_URL"), "URL of the Safe transaction service, to propose transactions to Safe multisig contracts with fly-safe")
+	cmd.Flags().StringArrayVar(&conf.Solc.Git.AllowedHosts, "solc-git-host", utils.DefStringArray("SOLC_GIT_HOSTS"), "Host that DeployContract messages can fetch Solidity from with a git URL, ref and path (default none)")
+	cmd.Flags().IntVar(&conf.Solc.TimeoutSec, "solc-timeout", utils.DefInt("SOLC_TIMEOUT", eth.DefaultSolcTimeoutSec), "Maximum time solc is allowed to run when compiling uploaded Solidity, before it is killed (seconds)")
 	events.CobraInitSubscriptionManager(cmd, &conf.SubscriptionManagerConf)
 }
 
@@ -104,29 +154,77 @@ func (g *smartContractGW) withEventsAuth(handler httprouter.Handle) httprouter.H
 	}
 }
 
+// withAdminAuth requires the caller to be authorized to list replies, as for the other
+// administrative APIs of the gateway
+func (g *smartContractGW) withAdminAuth(handler httprouter.Handle) httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		err := auth.AuthListAsyncReplies(req.Context())
+		if err != nil && auth.GetAuthContext(req.Context()) != nil {
+			// The caller is authenticated, but not allowed to administer the gateway
+			log.Errorf("Forbidden: %s", err)
+			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.Forbidden), 403)
+			return
+		}
+		if err != nil {
+			log.Errorf("Unauthorized: %s", err)
+			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.Unauthorized), 401)
+			return
+		}
+		handler(res, req, params)
+	}
+}
+
 func (g *smartContractGW) AddRoutes(router *httprouter.Router) {
 	g.r2e.addRoutes(router)
+	router.GET(SystemAPIPath, g.getSystemAPI)
 	router.GET("/contracts", g.listContractsOrABIs)
 	router.GET("/contracts/:address", g.getContractOrABI)
+	router.PATCH("/contracts/:address", g.withAdminAuth(g.updateContractName))
+	router.PUT("/contracts/:address/policy", g.withAdminAuth(g.setTxPolicy))
+	router.PUT("/contracts/:address/methods", g.withAdminAuth(g.setMethodFilter))
+	router.PUT("/contracts/:address/regenerate", g.withAdminAuth(g.regenerateSwagger))
+	router.PUT("/contracts/:address/upgrade", g.withAdminAuth(g.upgradeContract))
 	router.POST("/abis", g.addABI)
 	router.GET("/abis", g.listContractsOrABIs)
 	router.GET("/abis/:abi", g.getContractOrABI)
 	router.POST("/abis/:abi/:address", g.registerContract)
+	router.PUT("/abis/:abi/policy", g.withAdminAuth(g.setTxPolicy))
+	router.PUT("/abis/:abi/regenerate", g.withAdminAuth(g.regenerateSwagger))
 	router.GET("/instances/:instance_lookup", g.getRemoteRegistrySwaggerOrABI)
 	router.GET("/i/:instance_lookup", g.getRemoteRegistrySwaggerOrABI)
 	router.GET("/gateways/:gateway_lookup", g.getRemoteRegistrySwaggerOrABI)
 	router.GET("/g/:gateway_lookup", g.getRemoteRegistrySwaggerOrABI)
+	router.POST("/gateways/:gateway_lookup/:address", g.registerGatewayInstance)
+	router.POST("/g/:gateway_lookup/:address", g.registerGatewayInstance)
+	router.GET("/signers", g.withAdminAuth(g.listSignerAliases))
+	router.POST("/signers", g.withAdminAuth(g.storeSignerAlias))
+	router.GET("/signers/:alias", g.withAdminAuth(g.getSignerAlias))
+	router.DELETE("/signers/:alias", g.withAdminAuth(g.deleteSignerAlias))
+	router.GET("/accounts", g.withAdminAuth(g.listAccounts))
 	router.POST(events.StreamPathPrefix, g.withEventsAuth(g.createStream))
 	router.PATCH(events.StreamPathPrefix+"/:id", g.withEventsAuth(g.updateStream))
 	router.GET(events.StreamPathPrefix, g.withEventsAuth(g.listStreamsOrSubs))
 	router.GET(events.SubPathPrefix, g.withEventsAuth(g.listStreamsOrSubs))
+	router.POST(events.SubPathPrefix, g.withEventsAuth(g.createSubscription))
 	router.GET(events.StreamPathPrefix+"/:id", g.withEventsAuth(g.getStreamOrSub))
 	router.GET(events.SubPathPrefix+"/:id", g.withEventsAuth(g.getStreamOrSub))
+	router.GET(events.SubPathPrefix+"/:id/:subcommand", g.withEventsAuth(g.getSubResource))
+	router.GET(events.IdleSubscriptionsPath, g.withEventsAuth(g.listIdleSubs))
+	router.GET(events.WebhookStatusPath, g.withEventsAuth(g.getWebhookSLA))
 	router.DELETE(events.StreamPathPrefix+"/:id", g.withEventsAuth(g.deleteStreamOrSub))
 	router.DELETE(events.SubPathPrefix+"/:id", g.withEventsAuth(g.deleteStreamOrSub))
 	router.POST(events.SubPathPrefix+"/:id/reset", g.withEventsAuth(g.resetSub))
 	router.POST(events.StreamPathPrefix+"/:id/suspend", g.withEventsAuth(g.suspendOrResumeStream))
 	router.POST(events.StreamPathPrefix+"/:id/resume", g.withEventsAuth(g.suspendOrResumeStream))
+	router.POST(events.StreamPathPrefix+"/:id/export", g.withEventsAuth(g.exportStream))
+	router.GET(events.StreamPathPrefix+"/:id/deadletters", g.withEventsAuth(g.listDeadLetters))
+	router.POST(events.StreamPathPrefix+"/:id/deadletters/:letter/replay", g.withEventsAuth(g.replayDeadLetter))
+	router.DELETE(events.StreamPathPrefix+"/:id/deadletters/:letter", g.withEventsAuth(g.deleteDeadLetter))
+	router.GET(events.StreamPathPrefix+"/:id/oversized/:event", g.withEventsAuth(g.getOversizedEvent))
+	router.DELETE(events.StreamPathPrefix+"/:id/oversized/:event", g.withEventsAuth(g.deleteOversizedEvent))
+	router.POST(events.MigrationPath, g.withEventsAuth(g.importStream))
+	router.GET(events.DefinitionsPath, g.withEventsAuth(g.exportDefinitions))
+	router.POST(events.DefinitionsPath, g.withEventsAuth(g.importDefinitions))
 }
 
 func (g *smartContractGW) SendReply(message interface{}) {
@@ -135,82 +233,163 @@ func (g *smartContractGW) SendReply(message interface{}) {
 
 // NewSmartContractGateway constructor
 func NewSmartContractGateway(conf *SmartContractGatewayConf, txnConf *tx.TxnProcessorConf, rpc eth.RPCClient, processor tx.TxnProcessor, asyncDispatcher REST2EthAsyncDispatcher, ws ws.WebSocketChannels) (SmartContractGateway, error) {
-	var baseURL *url.URL
 	var err error
-	if conf.BaseURL != "" {
-		if baseURL, err = url.Parse(conf.BaseURL); err != nil {
-			log.Warnf("Unable to parse smart contract gateway base URL '%s': %s", conf.BaseURL, err)
-		}
+	if err = eth.ValidateRemappings(conf.Solc.Remappings); err != nil {
+		return nil, err
 	}
-	if baseURL == nil {
-		baseURL, _ = url.Parse("http://localhost:8080")
+	if err = conf.Solc.Dependencies.Validate(); err != nil {
+		return nil, err
+	}
+	if err = validatePostDeployHooks(conf.PostDeployHooks); err != nil {
+		return nil, err
+	}
+	if err = validateParamTransformHooks(conf.ParamTransformHooks); err != nil {
+		return nil, err
+	}
+	if err = conf.Safe.HTTPRequesterConf.ValidateConf(); err != nil {
+		return nil, err
+	}
+	conf.Solc.SetLimitDefaults()
+	if conf.Solc.Dependencies.CacheDir == "" && conf.StoragePath != "" {
+		conf.Solc.Dependencies.CacheDir = path.Join(conf.StoragePath, "solc-dependencies")
+	}
+	if conf.Solc.Git.CacheDir == "" && conf.StoragePath != "" {
+		conf.Solc.Git.CacheDir = path.Join(conf.StoragePath, "solc-git")
+	}
+	if conf.InMemory && conf.EventLevelDBPath == "" {
+		conf.EventsInMemory = true
 	}
-	log.Infof("OpenAPI Smart Contract Gateway configured with base URL '%s'", baseURL.String())
 	gw := &smartContractGW{
 		conf:                  conf,
+		files:                 newContractFiles(conf),
+		rpc:                   rpc,
 		rr:                    NewRemoteRegistry(&conf.RemoteRegistry),
 		contractIndex:         make(map[string]messages.TimeSortable),
 		contractRegistrations: make(map[string]*contractInfo),
+		signerAliases:         make(map[string]*signerAlias),
 		abiIndex:              make(map[string]messages.TimeSortable),
-		baseSwaggerConf: &openapi.ABI2SwaggerConf{
-			ExternalHost:     baseURL.Host,
-			ExternalRootPath: baseURL.Path,
-			ExternalSchemes:  []string{baseURL.Scheme},
-			OrionPrivateAPI:  txnConf.OrionPrivateAPIS,
-			BasicAuth:        true,
-		},
-		ws: ws,
+		baseSwaggerConf:       baseSwaggerConfFor(conf, txnConf.OrionPrivateAPIS),
+		ws:                    ws,
 	}
+	gw.hooksCtx, gw.hooksCancel = context.WithCancel(context.Background())
 	if err = gw.rr.init(); err != nil {
 		return nil, err
 	}
 	syncDispatcher := newSyncDispatcher(processor)
-	if conf.EventLevelDBPath != "" {
-		gw.sm = events.NewSubscriptionManager(&conf.SubscriptionManagerConf, rpc, gw.ws)
+	if conf.EventLevelDBPath != "" || conf.EventsInMemory {
+		gw.sm = events.NewSubscriptionManager(&conf.SubscriptionManagerConf, rpc, gw.ws, events.WithContractRegistrar(gw))
 		err = gw.sm.Init()
 		if err != nil {
 			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventManagerInitFailed, err)
 		}
 	}
 	gw.r2e = newREST2eth(gw, rpc, gw.sm, gw.rr, processor, asyncDispatcher, syncDispatcher)
+	gw.r2e.maxRPCTimeout = time.Duration(conf.MaxRPCTimeout) * time.Second
+	gw.r2e.strictAddrs = txnConf.StrictAddresses
+	gw.r2e.fingerprint = conf.FingerprintABIs
+	gw.r2e.strictBodies = conf.StrictBodies
+	gw.r2e.paramTransformHooks = conf.ParamTransformHooks
+	if conf.Safe.ServiceURL != "" {
+		gw.r2e.safe = newSafeService(&conf.Safe)
+	}
+	if conf.ReplayWindow > 0 {
+		gw.r2e.replay = newReplayCache(time.Duration(conf.ReplayWindow) * time.Second)
+	}
+	if conf.ReadPool.Workers > 0 {
+		if gw.r2e.readPool, err = newReadPool(&conf.ReadPool); err != nil {
+			return nil, err
+		}
+	}
 	gw.buildIndex()
+	if processor != nil {
+		processor.SetAddressNameResolver(gw)
+		processor.SetMethodChecker(gw)
+		processor.SetSignerPolicy(gw)
+	}
 	return gw, nil
 }
 
+// baseSwaggerConfFor builds the OpenAPI generation config for the base URL of the gateway
+func baseSwaggerConfFor(conf *SmartContractGatewayConf, orionPrivateAPI bool) *openapi.ABI2SwaggerConf {
+	var baseURL *url.URL
+	var err error
+	if conf.BaseURL != "" {
+		if baseURL, err = url.Parse(conf.BaseURL); err != nil {
+			log.Warnf("Unable to parse smart contract gateway base URL '%s': %s", conf.BaseURL, err)
+		}
+	}
+	if baseURL == nil {
+		baseURL, _ = url.Parse("http://localhost:8080")
+	}
+	log.Infof("OpenAPI Smart Contract Gateway configured with base URL '%s'", baseURL.String())
+	swaggerConf := &openapi.ABI2SwaggerConf{
+		ExternalHost:     baseURL.Host,
+		ExternalRootPath: baseURL.Path,
+		ExternalSchemes:  []string{baseURL.Scheme},
+		OrionPrivateAPI:  orionPrivateAPI,
+		BasicAuth:        true,
+		BearerAuth:       auth.SecurityModuleEnabled(),
+	}
+	// Gateways behind a reverse proxy can advertise the external address in the generated
+	// definitions, while still using the base URL for everything else
+	if conf.OpenAPIHost != "" {
+		swaggerConf.ExternalHost = conf.OpenAPIHost
+	}
+	if conf.OpenAPIBasePath != "" {
+		swaggerConf.ExternalRootPath = strings.TrimSuffix(conf.OpenAPIBasePath, "/")
+	}
+	return swaggerConf
+}
+
 type smartContractGW struct {
 	conf                  *SmartContractGatewayConf
+	rpc                   eth.RPCClient
 	sm                    events.SubscriptionManager
 	rr                    RemoteRegistry
 	r2e                   *rest2eth
 	ws                    ws.WebSocketChannels
+	files                 contractFiles
 	contractIndex         map[string]messages.TimeSortable
 	contractRegistrations map[string]*contractInfo
+	signerAliases         map[string]*signerAlias
 	idxLock               sync.Mutex
 	abiIndex              map[string]messages.TimeSortable
 	baseSwaggerConf       *openapi.ABI2SwaggerConf
+	hooksCtx              context.Context
+	hooksCancel           context.CancelFunc
+	hooksWG               sync.WaitGroup
 }
 
 // contractInfo is the minimal data structure we keep in memory, indexed by address
 // ONLY used for local registry. Remote registry handles its own storage/caching
 type contractInfo struct {
 	messages.TimeSorted
-	Address      string `json:"address"`
-	Path         string `json:"path"`
-	ABI          string `json:"abi"`
-	SwaggerURL   string `json:"openapi"`
-	RegisteredAs string `json:"registeredAs"`
+	Address         string             `json:"address"`
+	Path            string             `json:"path"`
+	ABI             string             `json:"abi"`
+	SwaggerURL      string             `json:"openapi"`
+	RegisteredAs    string             `json:"registeredAs"`
+	Policy          *txPolicy          `json:"policy,omitempty"`
+	ConstructorArgs []interface{}      `json:"constructorArgs,omitempty"`
+	ConstructorData string             `json:"constructorData,omitempty"`
+	Upgrades        []*contractUpgrade `json:"upgrades,omitempty"`
+	methodFilter
 }
 
 // abiInfo is the minimal data structure we keep in memory, indexed by our own UUID
 type abiInfo struct {
 	messages.TimeSorted
-	ID              string `json:"id"`
-	Name            string `json:"name"`
-	Description     string `json:"description"`
-	Path            string `json:"path"`
-	Deployable      bool   `json:"deployable"`
-	SwaggerURL      string `json:"openapi"`
-	CompilerVersion string `json:"compilerVersion"`
+	ID               string              `json:"id"`
+	Name             string              `json:"name"`
+	Description      string              `json:"description"`
+	Path             string              `json:"path"`
+	Deployable       bool                `json:"deployable"`
+	SwaggerURL       string              `json:"openapi"`
+	CompilerVersion  string              `json:"compilerVersion"`
+	Policy           *txPolicy           `json:"policy,omitempty"`
+	CompilerWarnings []string            `json:"compilerWarnings,omitempty"`
+	Git              *messages.GitSource `json:"git,omitempty"` // the revision the source was compiled from
+	fingerprint      string
 }
 
 // remoteContractInfo is the ABI raw data back out of the REST API gateway with bytecode
@@ -228,8 +407,17 @@ func (i *abiInfo) GetID() string {
 	return i.ID
 }
 
-func (g *smartContractGW) storeNewContractInfo(addrHexNo0x, abiID, pathName, registerAs string) (*contractInfo, error) {
-	contractInfo := &contractInfo{
+func (g *smartContractGW) storeNewContractInfo(addrHexNo0x, abiID, pathName, registerAs string, methods methodFilter) (*contractInfo, error) {
+	contractInfo := g.newContractInfo(addrHexNo0x, abiID, pathName, registerAs, methods)
+	if err := g.storeContractInfo(contractInfo); err != nil {
+		return nil, err
+	}
+	return contractInfo, nil
+}
+
+func (g *smartContractGW) newContractInfo(addrHexNo0x, abiID, pathName, registerAs string, methods methodFilter) *contractInfo {
+	return &contractInfo{
+		methodFilter: methods,
 		Address:      addrHexNo0x,
 		ABI:          abiID,
 		Path:         "/contracts/" + pathName,
@@ -239,10 +427,133 @@ func (g *smartContractGW) storeNewContractInfo(addrHexNo0x, abiID, pathName, reg
 			CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
 		},
 	}
-	if err := g.storeContractInfo(contractInfo); err != nil {
-		return nil, err
+}
+
+// RegisterContractInstance registers a contract instance against a stored ABI. Used by event
+// subscriptions on factory contracts to register the instances they create. Re-registering
+// the same address under the same name is a no-op, so events can safely be replayed
+func (g *smartContractGW) RegisterContractInstance(abiID, addrHexNo0x, registerAs string) error {
+	addrHexNo0x, ok := normalizeAddress(addrHexNo0x)
+	if !ok {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationSuppliedInvalidAddress)
 	}
-	return contractInfo, nil
+	if _, _, err := g.loadDeployMsgByID(abiID); err != nil {
+		return err
+	}
+	g.idxLock.Lock()
+	var existing *contractInfo
+	if registerAs != "" {
+		existing = g.contractRegistrations[registerAs]
+	} else if ts, exists := g.contractIndex[addrHexNo0x]; exists {
+		existing = ts.(*contractInfo)
+	}
+	g.idxLock.Unlock()
+	if existing != nil && existing.Address == addrHexNo0x && existing.ABI == abiID {
+		log.Debugf("Contract 0x%s already registered with ABI %s", addrHexNo0x, abiID)
+		return nil
+	}
+	pathName := registerAs
+	if pathName == "" {
+		pathName = addrHexNo0x
+	}
+	_, err := g.storeNewContractInfo(addrHexNo0x, abiID, pathName, registerAs, methodFilter{})
+	return err
+}
+
+// resolveInvocationContract returns the address of a contract of an invocation rule, which is
+// either an address or the registered name of an instance
+func (g *smartContractGW) resolveInvocationContract(contract string) (string, error) {
+	if addrHexNo0x, ok := normalizeAddress(contract); ok {
+		return addrHexNo0x, nil
+	}
+	g.idxLock.Lock()
+	info, exists := g.contractRegistrations[contract]
+	g.idxLock.Unlock()
+	if !exists {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractLoad, contract)
+	}
+	return info.Address, nil
+}
+
+// AuthorizeInvocation checks the caller is authorized by the security module to send transactions
+// from the signing address or alias of an invocation rule to its contract, as it would be to send
+// them directly. The transactions are submitted later without the context of the caller
+func (g *smartContractGW) AuthorizeInvocation(ctx context.Context, contract, from string) error {
+	addrHexNo0x, err := g.resolveInvocationContract(contract)
+	if err != nil {
+		return err
+	}
+	if from, err = g.r2e.resolveFrom(from); err != nil {
+		return err
+	}
+	return auth.AuthRPC(ctx, "eth_sendTransaction", map[string]interface{}{
+		"from": from,
+		"to":   "0x" + addrHexNo0x,
+	})
+}
+
+// InvokeContractMethod submits a transaction to a locally registered contract instance, for the
+// invocation rules of event streams. The params are keyed by the input names of the method, and
+// the policy and method filter of the instance apply as they do to a REST request
+func (g *smartContractGW) InvokeContractMethod(ctx context.Context, contract, method, from string, params map[string]interface{}) (string, error) {
+	addrHexNo0x, err := g.resolveInvocationContract(contract)
+	if err != nil {
+		return "", err
+	}
+	deployMsg, _, err := g.loadDeployMsgForInstance(addrHexNo0x)
+	if err != nil {
+		return "", err
+	}
+	var methodElem *ethbinding.ABIElementMarshaling
+	for _, element := range deployMsg.ABI {
+		if element.Type == "function" && element.Name == method {
+			methodElem = &element
+			break
+		}
+	}
+	if methodElem == nil {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodNotDeclared, method, addrHexNo0x)
+	}
+	abiMethod, err := eth.ABIMethodFor(methodElem)
+	if err != nil {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodABIInvalid, method, err)
+	}
+	if abiMethod.IsConstant() {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvokeNotTransaction, method, addrHexNo0x)
+	}
+	if err := g.methodFilterFor(addrHexNo0x).check(method, addrHexNo0x); err != nil {
+		return "", err
+	}
+	if from, err = g.r2e.resolveFrom(from); err != nil {
+		return "", err
+	}
+	msgParams := make([]interface{}, len(abiMethod.Inputs))
+	for i, input := range abiMethod.Inputs {
+		name := abiInputName(i, input)
+		v, exists := params[name]
+		if !exists {
+			return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMissingParameter, name, method)
+		}
+		msgParams[i] = v
+	}
+
+	msg := &messages.SendTransaction{}
+	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.Method = methodElem
+	msg.To = "0x" + addrHexNo0x
+	msg.From = from
+	msg.Parameters = msgParams
+	if err := g.txPolicyFor("", addrHexNo0x).apply(&msg.TransactionCommon); err != nil {
+		return "", err
+	}
+	msgBytes, _ := json.Marshal(msg)
+	var mapMsg map[string]interface{}
+	utils.UnmarshalJSONNumbers(msgBytes, &mapMsg)
+	asyncResponse, err := g.r2e.asyncDispatcher.DispatchMsgAsync(ctx, mapMsg, true)
+	if err != nil {
+		return "", err
+	}
+	return asyncResponse.Request, nil
 }
 
 func isRemote(msg messages.CommonHeaders) bool {
@@ -255,8 +566,25 @@ func isRemote(msg messages.CommonHeaders) bool {
 	return false
 }
 
+// deployABIID returns the ID of the ABI a contract was deployed from. A REST deployment
+// carries its own request ID, so the ABI ID travels in the message context instead
+func deployABIID(msg *messages.TransactionReceipt) string {
+	if abiID, ok := msg.Headers.Context[abiIDContextKey].(string); ok && abiID != "" {
+		return abiID
+	}
+	return msg.Headers.ReqID
+}
+
 // PostDeploy callback processes the transaction receipt and generates the Swagger
 func (g *smartContractGW) PostDeploy(msg *messages.TransactionReceipt) error {
+	// The ABI was stored along with the constructor parameters
+	return g.postDeployInstance(msg, deployABIID(msg), nil)
+}
+
+// postDeployInstance registers the contract created by a deployment against the ABI it was
+// deployed from, recording the constructor parameters from the deploy message. When the
+// deploy message is not supplied, it is loaded from the ABI
+func (g *smartContractGW) postDeployInstance(msg *messages.TransactionReceipt, abiID string, deployMsg *messages.DeployContract) error {
 
 	requestID := msg.Headers.ReqID
 
@@ -288,13 +616,37 @@ func (g *smartContractGW) PostDeploy(msg *messages.TransactionReceipt) error {
 				err = g.rr.registerInstance(msg.RegisterAs, "0x"+addrHexNo0x)
 			}
 		} else {
-			_, err = g.storeNewContractInfo(addrHexNo0x, requestID, registeredName, msg.RegisterAs)
+			info := g.newContractInfo(addrHexNo0x, abiID, registeredName, msg.RegisterAs, methodFilter{})
+			if deployMsg == nil {
+				deployMsg, _, _ = g.loadDeployMsgByID(abiID)
+			}
+			if deployMsg != nil {
+				g.recordConstructorArgs(info, deployMsg)
+			}
+			err = g.storeContractInfo(info)
+		}
+		if err == nil {
+			g.runPostDeployHooks(msg, abiID, addrHexNo0x, registeredName)
 		}
 		return err
 	}
 	return nil
 }
 
+// recordConstructorArgs keeps the parameters a contract was constructed with, and their ABI
+// encoding, which is needed to verify the source of the contract on a block explorer
+func (g *smartContractGW) recordConstructorArgs(info *contractInfo, deployMsg *messages.DeployContract) {
+	info.ConstructorArgs = deployMsg.Parameters
+	packed, err := eth.PackConstructorArgs(deployMsg.ABI, deployMsg.Parameters)
+	if err != nil {
+		log.Warnf("Failed to encode constructor parameters of contract 0x%s: %s", info.Address, err)
+		return
+	}
+	if len(packed) > 0 {
+		info.ConstructorData = "0x" + hex.EncodeToString(packed)
+	}
+}
+
 func (g *smartContractGW) swaggerForRemoteRegistry(swaggerGen *openapi.ABI2Swagger, apiName, addr string, factoryOnly bool, abi *ethbinding.RuntimeABI, devdoc, path string) *spec.Swagger {
 	var swagger *spec.Swagger
 	if addr == "" {
@@ -305,15 +657,17 @@ func (g *smartContractGW) swaggerForRemoteRegistry(swaggerGen *openapi.ABI2Swagg
 	return swagger
 }
 
-func (g *smartContractGW) swaggerForABI(swaggerGen *openapi.ABI2Swagger, abiID, apiName string, factoryOnly bool, abi *ethbinding.RuntimeABI, devdoc string, addrHexNo0x, registerAs string) *spec.Swagger {
+func (g *smartContractGW) swaggerForABI(swaggerGen *openapi.ABI2Swagger, abiID, apiName string, factoryOnly bool, abi *ethbinding.RuntimeABI, devdoc, userdoc string, addrHexNo0x, registerAs string) *spec.Swagger {
 	// Ensure we have a contract name in all cases, as the Swagger
 	// won't be valid without a title
 	if apiName == "" {
 		apiName = abiID
 	}
+	// The notices for users in the userdoc are described alongside the devdoc
+	devdoc = openapi.MergeUserDoc(devdoc, userdoc)
 	var swagger *spec.Swagger
 	if addrHexNo0x != "" {
-		pathSuffix := url.QueryEscape(registerAs)
+		pathSuffix := registeredNamePath(registerAs)
 		if pathSuffix == "" {
 			pathSuffix = addrHexNo0x
 		}
@@ -337,10 +691,14 @@ func (g *smartContractGW) storeContractInfo(info *contractInfo) error {
 	if err := g.addToContractIndex(info); err != nil {
 		return err
 	}
-	infoFile := path.Join(g.conf.StoragePath, "contract_"+info.Address+".instance.json")
+	return g.writeContractInfo(info)
+}
+
+func (g *smartContractGW) writeContractInfo(info *contractInfo) error {
+	infoFile := g.files.path("contract_" + info.Address + ".instance.json")
 	instanceBytes, _ := json.MarshalIndent(info, "", "  ")
 	log.Infof("%s: Storing contract instance JSON to '%s'", info.ABI, infoFile)
-	if err := ioutil.WriteFile(infoFile, instanceBytes, 0664); err != nil {
+	if err := g.files.writeFile(infoFile, instanceBytes); err != nil {
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractSave, err)
 	}
 	return nil
@@ -356,8 +714,33 @@ func (g *smartContractGW) resolveContractAddr(registeredName string) (string, er
 	return info.Address, nil
 }
 
+// ResolveAddressName resolves a name in the address policy of the transaction processor. Names
+// are those of registered contract instances, either local or in the remote registry, and
+// signer aliases
+func (g *smartContractGW) ResolveAddressName(name string) (string, bool) {
+	g.idxLock.Lock()
+	info, isContract := g.contractRegistrations[name]
+	alias, isAlias := g.signerAliases[name]
+	g.idxLock.Unlock()
+	if isContract {
+		return "0x" + info.Address, true
+	}
+	if isAlias {
+		return alias.From, true
+	}
+	instance, err := g.rr.loadFactoryForInstance(name, false)
+	if err != nil {
+		log.Errorf("Failed to resolve '%s' in the remote registry: %s", name, err)
+		return "", false
+	}
+	if instance == nil {
+		return "", false
+	}
+	return instance.Address, true
+}
+
 func (g *smartContractGW) loadDeployMsgForInstance(addrHex string) (*messages.DeployContract, *contractInfo, error) {
-	addrHexNo0x := strings.TrimPrefix(strings.ToLower(addrHex), "0x")
+	addrHexNo0x, _ := normalizeAddress(addrHex)
 	info, exists := g.contractIndex[addrHexNo0x]
 	if !exists {
 		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x)
@@ -374,8 +757,8 @@ func (g *smartContractGW) loadDeployMsgByID(id string) (*messages.DeployContract
 		log.Infof("ABI with ID %s not found locally", id)
 		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABINotFound, id)
 	}
-	deployFile := path.Join(g.conf.StoragePath, "abi_"+id+".deploy.json")
-	deployBytes, err := ioutil.ReadFile(deployFile)
+	deployFile := g.files.path("abi_" + id + ".deploy.json")
+	deployBytes, err := g.files.readFile(deployFile)
 	if err != nil {
 		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABILoad, id, err)
 	}
@@ -387,6 +770,25 @@ func (g *smartContractGW) loadDeployMsgByID(id string) (*messages.DeployContract
 	return msg, info, nil
 }
 
+// listABIIDs returns the IDs of all the locally stored ABIs, in the same order they are listed
+func (g *smartContractGW) listABIIDs() []string {
+	g.idxLock.Lock()
+	infos := make([]messages.TimeSortable, 0, len(g.abiIndex))
+	for _, info := range g.abiIndex {
+		infos = append(infos, info)
+	}
+	g.idxLock.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].IsLessThan(infos[i], infos[j])
+	})
+	ids := make([]string, len(infos))
+	for i, info := range infos {
+		ids[i] = info.GetID()
+	}
+	return ids
+}
+
 // PreDeploy
 // - compiles the Solidity (if not precomplied),
 // - puts the code into the message to avoid a recompile later
@@ -395,7 +797,11 @@ func (g *smartContractGW) loadDeployMsgByID(id string) (*messages.DeployContract
 func (g *smartContractGW) PreDeploy(msg *messages.DeployContract) (err error) {
 	solidity := msg.Solidity
 	var compiled *eth.CompiledSolidity
-	if solidity != "" {
+	if msg.Git != nil {
+		if compiled, err = g.compileGitSource(msg); err != nil {
+			return err
+		}
+	} else if solidity != "" {
 		if compiled, err = eth.CompileContract(solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion); err != nil {
 			return err
 		}
@@ -410,15 +816,18 @@ func (g *smartContractGW) storeDeployableABI(msg *messages.DeployContract, compi
 
 	if compiled != nil {
 		msg.Compiled = compiled.Compiled
+		msg.CompiledRuntime = compiled.RuntimeCompiled
 		msg.ABI = compiled.ABI
 		msg.DevDoc = compiled.DevDoc
+		msg.UserDoc = compiled.UserDoc
 		msg.ContractName = compiled.ContractName
 		msg.CompilerVersion = compiled.ContractInfo.CompilerVersion
+		msg.CompilerWarnings = compiled.Warnings
 	} else if msg.ABI == nil {
 		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreMissingABI)
 	}
 
-	runtimeABI, err := ethbind.API.ABIMarshalingToABIRuntime(msg.ABI)
+	runtimeABI, err := eth.RuntimeABI(msg.ABI)
 	if err != nil {
 		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidABI, err)
 	}
@@ -427,16 +836,19 @@ func (g *smartContractGW) storeDeployableABI(msg *messages.DeployContract, compi
 	// We store the swagger in a generic format that can be used to deploy
 	// additional instances, or generically call other instances
 	// Generate and store the swagger
-	swagger := g.swaggerForABI(openapi.NewABI2Swagger(g.baseSwaggerConf), requestID, msg.ContractName, false, runtimeABI, msg.DevDoc, "", "")
+	swagger := g.swaggerForABI(openapi.NewABI2Swagger(g.baseSwaggerConf), requestID, msg.ContractName, false, runtimeABI, msg.DevDoc, msg.UserDoc, "", "")
 	msg.Description = swagger.Info.Description // Swagger generation parses the devdoc
+	if err := g.writeAbiInfo(requestID, msg); err != nil {
+		return nil, err
+	}
 	info := g.addToABIIndex(requestID, msg, time.Now().UTC())
 
-	g.writeAbiInfo(requestID, msg)
-
 	// We remove the solidity payload from the message, as we've consumed
 	// it by compiling and there is no need to serialize it again.
 	// The messages should contain compiled bytes at this
 	msg.Solidity = ""
+	// The runtime bytecode is only needed to verify registrations, from the stored copy
+	msg.CompiledRuntime = nil
 
 	return info, nil
 
@@ -444,7 +856,7 @@ func (g *smartContractGW) storeDeployableABI(msg *messages.DeployContract, compi
 
 func (g *smartContractGW) gatewayErrReply(res http.ResponseWriter, req *http.Request, err error, status int) {
 	log.Errorf("<-- %s %s [%d]: %s", req.Method, req.URL, status, err)
-	reply, _ := json.Marshal(&restErrMsg{Message: err.Error()})
+	reply, _ := json.Marshal(newRESTErrMsg(err, status))
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(status)
 	res.Write(reply)
@@ -454,10 +866,10 @@ func (g *smartContractGW) gatewayErrReply(res http.ResponseWriter, req *http.Req
 func (g *smartContractGW) writeAbiInfo(requestID string, msg *messages.DeployContract) error {
 	// We store all the details from our compile, or the user-supplied
 	// details, in a file under the message ID.
-	infoFile := path.Join(g.conf.StoragePath, "abi_"+requestID+".deploy.json")
+	infoFile := g.files.path("abi_" + requestID + ".deploy.json")
 	infoBytes, _ := json.MarshalIndent(msg, "", "  ")
 	log.Infof("%s: Stashing deployment details to '%s'", requestID, infoFile)
-	if err := ioutil.WriteFile(infoFile, infoBytes, 0664); err != nil {
+	if err := g.files.writeFile(infoFile, infoBytes); err != nil {
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractSavePostDeploy, requestID, err)
 	}
 	return nil
@@ -468,36 +880,39 @@ func (g *smartContractGW) buildIndex() {
 	legacyContractMatcher, _ := regexp.Compile("^contract_([0-9a-z]{40})\\.swagger\\.json$")
 	instanceMatcher, _ := regexp.Compile("^contract_([0-9a-z]{40})\\.instance\\.json$")
 	abiMatcher, _ := regexp.Compile("^abi_([0-9a-z-]+)\\.deploy.json$")
-	files, err := ioutil.ReadDir(g.conf.StoragePath)
+	signerAliasMatcher, _ := regexp.Compile("^signer_([a-zA-Z0-9._-]+)\\.alias\\.json$")
+	files, err := g.files.listFiles()
 	if err != nil {
 		log.Errorf("Failed to read directory %s: %s", g.conf.StoragePath, err)
 		return
 	}
 	for _, file := range files {
-		fileName := file.Name()
+		fileName := file.name
 		legacyContractGroups := legacyContractMatcher.FindStringSubmatch(fileName)
 		abiGroups := abiMatcher.FindStringSubmatch(fileName)
 		instanceGroups := instanceMatcher.FindStringSubmatch(fileName)
+		signerAliasGroups := signerAliasMatcher.FindStringSubmatch(fileName)
 		if legacyContractGroups != nil {
-			g.migrateLegacyContract(legacyContractGroups[1], path.Join(g.conf.StoragePath, fileName), file.ModTime())
+			g.migrateLegacyContract(legacyContractGroups[1], g.files.path(fileName), file.modTime)
 		} else if instanceGroups != nil {
-			g.addFileToContractIndex(instanceGroups[1], path.Join(g.conf.StoragePath, fileName))
+			g.addFileToContractIndex(instanceGroups[1], g.files.path(fileName))
 		} else if abiGroups != nil {
-			g.addFileToABIIndex(abiGroups[1], path.Join(g.conf.StoragePath, fileName), file.ModTime())
+			g.addFileToABIIndex(abiGroups[1], g.files.path(fileName), file.modTime)
+		} else if signerAliasGroups != nil {
+			g.addFileToSignerAliasIndex(signerAliasGroups[1], g.files.path(fileName))
 		}
 	}
 	log.Infof("Smart contract index built. %d entries", len(g.contractIndex))
 }
 
 func (g *smartContractGW) migrateLegacyContract(address, fileName string, createdTime time.Time) {
-	swaggerFile, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+	swaggerBytes, err := g.files.readFile(fileName)
 	if err != nil {
 		log.Errorf("Failed to load Swagger file %s: %s", fileName, err)
 		return
 	}
-	defer swaggerFile.Close()
 	var swagger spec.Swagger
-	err = json.NewDecoder(bufio.NewReader(swaggerFile)).Decode(&swagger)
+	err = json.Unmarshal(swaggerBytes, &swagger)
 	if err != nil {
 		log.Errorf("Failed to parse Swagger file %s: %s", fileName, err)
 		return
@@ -511,13 +926,13 @@ func (g *smartContractGW) migrateLegacyContract(address, fileName string, create
 		registeredAs = ext.(string)
 	}
 	if ext, exists := swagger.Info.Extensions["x-firefly-deployment-id"]; exists {
-		_, err := g.storeNewContractInfo(address, ext.(string), address, registeredAs)
+		_, err := g.storeNewContractInfo(address, ext.(string), address, registeredAs, methodFilter{})
 		if err != nil {
 			log.Errorf("Failed to write migrated instance file: %s", err)
 			return
 		}
 
-		if err := os.Remove(fileName); err != nil {
+		if err := g.files.removeFile(fileName); err != nil {
 			log.Errorf("Failed to clean-up migrated file %s: %s", fileName, err)
 		}
 
@@ -528,14 +943,13 @@ func (g *smartContractGW) migrateLegacyContract(address, fileName string, create
 }
 
 func (g *smartContractGW) addFileToContractIndex(address, fileName string) {
-	contractFile, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+	contractBytes, err := g.files.readFile(fileName)
 	if err != nil {
 		log.Errorf("Failed to load contract instance file %s: %s", fileName, err)
 		return
 	}
-	defer contractFile.Close()
 	var contractInfo contractInfo
-	err = json.NewDecoder(bufio.NewReader(contractFile)).Decode(&contractInfo)
+	err = json.Unmarshal(contractBytes, &contractInfo)
 	if err != nil {
 		log.Errorf("Failed to parse contract instnace deployment file %s: %s", fileName, err)
 		return
@@ -544,19 +958,19 @@ func (g *smartContractGW) addFileToContractIndex(address, fileName string) {
 }
 
 func (g *smartContractGW) addFileToABIIndex(id, fileName string, createdTime time.Time) {
-	deployFile, err := os.OpenFile(fileName, os.O_RDONLY, 0)
+	deployBytes, err := g.files.readFile(fileName)
 	if err != nil {
 		log.Errorf("Failed to load ABI deployment file %s: %s", fileName, err)
 		return
 	}
-	defer deployFile.Close()
 	var deployMsg messages.DeployContract
-	err = json.NewDecoder(bufio.NewReader(deployFile)).Decode(&deployMsg)
+	err = json.Unmarshal(deployBytes, &deployMsg)
 	if err != nil {
 		log.Errorf("Failed to parse ABI deployment file %s: %s", fileName, err)
 		return
 	}
-	g.addToABIIndex(id, &deployMsg, createdTime)
+	info := g.addToABIIndex(id, &deployMsg, createdTime)
+	g.loadABITxPolicy(info)
 }
 
 func (g *smartContractGW) checkNameAvailable(registerAs string, isRemote bool) error {
@@ -576,6 +990,9 @@ func (g *smartContractGW) checkNameAvailable(registerAs string, isRemote bool) e
 }
 
 func (g *smartContractGW) addToContractIndex(info *contractInfo) error {
+	// Instances written by earlier versions, or registered programmatically, might not use the
+	// lower case form the index is keyed by
+	info.Address, _ = normalizeAddress(info.Address)
 	g.idxLock.Lock()
 	defer g.idxLock.Unlock()
 	if info.RegisteredAs != "" {
@@ -590,19 +1007,83 @@ func (g *smartContractGW) addToContractIndex(info *contractInfo) error {
 	return nil
 }
 
+// renameContract changes (or with an empty name removes) the friendly name of a registered contract
+// instance. A name held by another instance can only be taken with force, in which case the
+// other instance is left registered by its address alone. The HTTP status is returned with any
+// error, as a name clash is a conflict but a storage failure is not
+func (g *smartContractGW) renameContract(info *contractInfo, registerAs string, force bool) (*contractInfo, int, error) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	// Pick up any concurrent update since the caller resolved the instance
+	info = g.contractIndex[info.Address].(*contractInfo)
+	if info.RegisteredAs == registerAs {
+		return info, 200, nil
+	}
+
+	existing, exists := g.contractRegistrations[registerAs]
+	if exists && registerAs != "" && !force {
+		return nil, 409, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayFriendlyNameClash, existing.Address, registerAs)
+	}
+
+	// Write the new registration first, so a failure part way through never leaves the name unassigned
+	updated := g.withContractName(info, registerAs)
+	if err := g.writeContractInfo(updated); err != nil {
+		return nil, 500, err
+	}
+	if exists && registerAs != "" {
+		log.Infof("Re-pointing '%s' from %s to %s", registerAs, existing.Address, info.Address)
+		unnamed := g.withContractName(existing, "")
+		if err := g.writeContractInfo(unnamed); err != nil {
+			if rollbackErr := g.writeContractInfo(info); rollbackErr != nil {
+				log.Errorf("Failed to restore contract %s as '%s': %s", info.Address, info.RegisteredAs, rollbackErr)
+			}
+			return nil, 500, err
+		}
+		g.contractIndex[existing.Address] = unnamed
+	}
+	if info.RegisteredAs != "" {
+		delete(g.contractRegistrations, info.RegisteredAs)
+	}
+	if registerAs != "" {
+		g.contractRegistrations[registerAs] = updated
+	}
+	g.contractIndex[info.Address] = updated
+	log.Infof("Contract %s registered as '%s' (previously '%s')", info.Address, registerAs, info.RegisteredAs)
+	return updated, 200, nil
+}
+
+// withContractName returns a copy of the info for a contract, using the new name
+func (g *smartContractGW) withContractName(info *contractInfo, registerAs string) *contractInfo {
+	pathName := registerAs
+	if pathName == "" {
+		pathName = info.Address
+	}
+	updated := *info
+	updated.RegisteredAs = registerAs
+	updated.Path = "/contracts/" + pathName
+	updated.SwaggerURL = g.conf.BaseURL + "/contracts/" + pathName + "?swagger"
+	return &updated
+}
+
 func (g *smartContractGW) addToABIIndex(id string, deployMsg *messages.DeployContract, createdTime time.Time) *abiInfo {
 	g.idxLock.Lock()
 	info := &abiInfo{
-		ID:              id,
-		Name:            deployMsg.ContractName,
-		Description:     deployMsg.Description,
-		Deployable:      len(deployMsg.Compiled) > 0,
-		CompilerVersion: deployMsg.CompilerVersion,
-		Path:            "/abis/" + id,
-		SwaggerURL:      g.conf.BaseURL + "/abis/" + id + "?swagger",
+		ID:               id,
+		Name:             deployMsg.ContractName,
+		Description:      deployMsg.Description,
+		Deployable:       len(deployMsg.Compiled) > 0,
+		CompilerVersion:  deployMsg.CompilerVersion,
+		CompilerWarnings: deployMsg.CompilerWarnings,
+		Git:              deployMsg.Git,
+		Path:             "/abis/" + id,
+		SwaggerURL:       g.conf.BaseURL + "/abis/" + id + "?swagger",
 		TimeSorted: messages.TimeSorted{
 			CreatedISO8601: createdTime.UTC().Format(time.RFC3339),
 		},
+		fingerprint: eth.BytecodeFingerprint(deployMsg.CompiledRuntime),
+	}
+	if info.fingerprint == "" {
+		info.fingerprint = eth.BytecodeFingerprint(deployMsg.Compiled)
 	}
 	g.abiIndex[id] = info
 	g.idxLock.Unlock()
@@ -614,8 +1095,11 @@ func (g *smartContractGW) listContractsOrABIs(res http.ResponseWriter, req *http
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	var index map[string]messages.TimeSortable
+	var prefix string
 	if strings.HasSuffix(req.URL.Path, "contracts") {
 		index = g.contractIndex
+		// Contracts registered under hierarchical names can be listed by directory
+		prefix = strings.TrimPrefix(req.URL.Query().Get("prefix"), "/")
 	} else {
 		index = g.abiIndex
 	}
@@ -624,7 +1108,9 @@ func (g *smartContractGW) listContractsOrABIs(res http.ResponseWriter, req *http
 	g.idxLock.Lock()
 	retval := make([]messages.TimeSortable, 0, len(index))
 	for _, info := range index {
-		retval = append(retval, info)
+		if prefix == "" || inRegisteredNamePrefix(info.(*contractInfo).RegisteredAs, prefix) {
+			retval = append(retval, info)
+		}
 	}
 	g.idxLock.Unlock()
 
@@ -672,6 +1158,68 @@ func (g *smartContractGW) createStream(res http.ResponseWriter, req *http.Reques
 	enc.Encode(&newSpec)
 }
 
+// signatureSubscription is the body of a POST to /subscriptions, which subscribes to an
+// event by its signature rather than through a registered ABI
+type signatureSubscription struct {
+	Stream    string `json:"stream"`
+	Signature string `json:"signature"`
+	Address   string `json:"address,omitempty"`
+	FromBlock string `json:"fromBlock,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// createSubscription subscribes to an event from its signature, for contracts that are
+// not in the registry. The address is optional, to match the event on any contract
+func (g *smartContractGW) createSubscription(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var body signatureSubscription
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscriptionInvalid, err), 400)
+		return
+	}
+	if body.Stream == "" {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscribeMissingStreamParameter), 400)
+		return
+	}
+	event, err := events.ParseEventSignature(body.Signature)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	var addr *ethbinding.Address
+	if body.Address != "" {
+		addrHexNo0x, ok := normalizeAddress(body.Address)
+		if !ok {
+			if addrHexNo0x, err = g.resolveContractAddr(body.Address); err != nil {
+				g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscriptionInvalidAddress, body.Address), 404)
+				return
+			}
+		}
+		address := ethbind.API.HexToAddress("0x" + addrHexNo0x)
+		addr = &address
+	}
+
+	sub, err := g.sm.AddSubscription(req.Context(), addr, event, body.Stream, body.FromBlock, body.Name, nil)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(sub)
+}
+
 // updateStream updates a stream
 func (g *smartContractGW) updateStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
@@ -718,7 +1266,8 @@ func (g *smartContractGW) listStreamsOrSubs(res http.ResponseWriter, req *http.R
 
 	var results []messages.TimeSortable
 	if strings.HasPrefix(req.URL.Path, events.SubPathPrefix) {
-		subs := g.sm.Subscriptions(req.Context())
+		query := req.URL.Query()
+		subs := filterSubscriptions(g.sm.Subscriptions(req.Context()), query.Get("stream"), query.Get("address"), query.Get("name"))
 		results = make([]messages.TimeSortable, len(subs))
 		for i := range subs {
 			results[i] = subs[i]
@@ -745,7 +1294,8 @@ func (g *smartContractGW) listStreamsOrSubs(res http.ResponseWriter, req *http.R
 	enc.Encode(&results)
 }
 
-// getStreamOrSub returns stream over REST
+// getStreamOrSub returns stream over REST. Subscriptions can also be looked up by name,
+// qualified with a stream query parameter as names are only unique within a stream
 func (g *smartContractGW) getStreamOrSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
@@ -756,13 +1306,14 @@ func (g *smartContractGW) getStreamOrSub(res http.ResponseWriter, req *http.Requ
 
 	var retval interface{}
 	var err error
+	errStatus := 404
 	if strings.HasPrefix(req.URL.Path, events.SubPathPrefix) {
-		retval, err = g.sm.SubscriptionByID(req.Context(), params.ByName("id"))
+		retval, errStatus, err = g.subscriptionByIDOrName(req, params.ByName("id"))
 	} else {
 		retval, err = g.sm.StreamByID(req.Context(), params.ByName("id"))
 	}
 	if err != nil {
-		g.gatewayErrReply(res, req, err, 404)
+		g.gatewayErrReply(res, req, err, errStatus)
 		return
 	}
 
@@ -775,8 +1326,8 @@ func (g *smartContractGW) getStreamOrSub(res http.ResponseWriter, req *http.Requ
 	enc.Encode(retval)
 }
 
-// deleteStreamOrSub deletes stream over REST
-func (g *smartContractGW) deleteStreamOrSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+// getSubStatus returns the progress of a subscription, looked up by ID or name
+func (g *smartContractGW) getSubStatus(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	if g.sm == nil {
@@ -784,25 +1335,44 @@ func (g *smartContractGW) deleteStreamOrSub(res http.ResponseWriter, req *http.R
 		return
 	}
 
-	var err error
-	if strings.HasPrefix(req.URL.Path, events.SubPathPrefix) {
-		err = g.sm.DeleteSubscription(req.Context(), params.ByName("id"))
-	} else {
-		err = g.sm.DeleteStream(req.Context(), params.ByName("id"))
+	sub, errStatus, err := g.subscriptionByIDOrName(req, params.ByName("id"))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, errStatus)
+		return
 	}
+	subStatus, err := g.sm.SubscriptionStatus(req.Context(), sub.ID)
 	if err != nil {
-		g.gatewayErrReply(res, req, err, 500)
+		g.gatewayErrReply(res, req, err, 404)
 		return
 	}
 
-	status := 204
+	status := 200
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(subStatus)
 }
 
-// resetSub resets subscription over REST
-func (g *smartContractGW) resetSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+// getSubResource serves the GETs under a subscription path. The router cannot mix a static
+// segment with the :id parameter, so the status of a subscription and the lookup of a
+// subscription by name share a route, and are told apart here
+func (g *smartContractGW) getSubResource(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	switch {
+	case params.ByName("id") == "name":
+		g.getSubByName(res, req, params)
+	case params.ByName("subcommand") == "status":
+		g.getSubStatus(res, req, params)
+	default:
+		log.Infof("--> %s %s", req.Method, req.URL)
+		g.gatewayErrReply(res, req, errors.New("Not found"), 404)
+	}
+}
+
+// getSubByName returns a subscription over REST, looked up by its name.
+// The name can be qualified with a stream query parameter, as names are only unique within a stream
+func (g *smartContractGW) getSubByName(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	if g.sm == nil {
@@ -810,26 +1380,47 @@ func (g *smartContractGW) resetSub(res http.ResponseWriter, req *http.Request, p
 		return
 	}
 
-	var body struct {
-		FromBlock string `json:"fromBlock"`
-	}
-	err := json.NewDecoder(req.Body).Decode(&body)
-	if err == nil {
-		err = g.sm.ResetSubscription(req.Context(), params.ByName("id"), body.FromBlock)
+	name := params.ByName("subcommand")
+	subs := filterSubscriptions(g.sm.Subscriptions(req.Context()), req.URL.Query().Get("stream"), "", name)
+	if len(subs) == 0 {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscriptionNameNotFound, name), 404)
+		return
 	}
-	if err != nil {
-		g.gatewayErrReply(res, req, err, 500)
+	if len(subs) > 1 {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscriptionNameAmbiguous, name), 409)
 		return
 	}
 
-	status := 204
+	status := 200
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(subs[0])
 }
 
-// suspendOrResumeStream suspends or resumes a stream
-func (g *smartContractGW) suspendOrResumeStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+// subscriptionByIDOrName falls back to a lookup by name, if no subscription has the ID.
+// The name must match a single subscription, after filtering by any stream query parameter
+func (g *smartContractGW) subscriptionByIDOrName(req *http.Request, id string) (*events.SubscriptionInfo, int, error) {
+	sub, err := g.sm.SubscriptionByID(req.Context(), id)
+	if err == nil {
+		return sub, 200, nil
+	}
+	subs := filterSubscriptions(g.sm.Subscriptions(req.Context()), req.URL.Query().Get("stream"), "", id)
+	switch len(subs) {
+	case 0:
+		return nil, 404, err
+	case 1:
+		return subs[0], 200, nil
+	default:
+		return nil, 409, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySubscriptionNameAmbiguous, id)
+	}
+}
+
+// listIdleSubs reports the subscriptions on streams that have been suspended or unreachable
+// for longer than the idle timeout, without changing anything
+func (g *smartContractGW) listIdleSubs(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	if g.sm == nil {
@@ -837,28 +1428,301 @@ func (g *smartContractGW) suspendOrResumeStream(res http.ResponseWriter, req *ht
 		return
 	}
 
-	var err error
-	if strings.HasSuffix(req.URL.Path, "resume") {
-		err = g.sm.ResumeStream(req.Context(), params.ByName("id"))
-	} else {
-		err = g.sm.SuspendStream(req.Context(), params.ByName("id"))
+	var idleTimeout time.Duration
+	if idleTimeoutStr := req.URL.Query().Get("idleTimeoutSec"); idleTimeoutStr != "" {
+		idleTimeoutSec, err := strconv.ParseUint(idleTimeoutStr, 10, 64)
+		if err != nil || idleTimeoutSec == 0 {
+			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayIdleTimeoutInvalid, idleTimeoutStr), 400)
+			return
+		}
+		idleTimeout = time.Duration(idleTimeoutSec) * time.Second
 	}
+	idle, err := g.sm.IdleSubscriptions(req.Context(), idleTimeout)
 	if err != nil {
-		g.gatewayErrReply(res, req, err, 500)
+		g.gatewayErrReply(res, req, err, 400)
 		return
 	}
 
-	status := 204
+	status := 200
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(idle)
 }
 
-func (g *smartContractGW) resolveAddressOrName(id string) (deployMsg *messages.DeployContract, registeredName string, info *contractInfo, err error) {
-	deployMsg, info, err = g.loadDeployMsgForInstance(id)
-	if err != nil {
-		var origErr = err
-		registeredName = id
+// getWebhookSLA reports the delivery success rate and latency of each webhook receiver
+func (g *smartContractGW) getWebhookSLA(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(g.sm.WebhookSLA(req.Context()))
+}
+
+// filterSubscriptions returns the subscriptions matching all the supplied (non-empty) filters.
+// Addresses are compared case-insensitively, with or without the 0x prefix
+func filterSubscriptions(subs []*events.SubscriptionInfo, stream, address, name string) []*events.SubscriptionInfo {
+	address, _ = normalizeAddress(address)
+	filtered := make([]*events.SubscriptionInfo, 0, len(subs))
+	for _, sub := range subs {
+		if stream != "" && sub.Stream != stream {
+			continue
+		}
+		if name != "" && sub.Name != name {
+			continue
+		}
+		if address != "" {
+			matched := false
+			for _, addr := range sub.Filter.Addresses {
+				if strings.ToLower(strings.TrimPrefix(addr.Hex(), "0x")) == address {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		filtered = append(filtered, sub)
+	}
+	return filtered
+}
+
+// deleteStreamOrSub deletes stream over REST
+func (g *smartContractGW) deleteStreamOrSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var err error
+	if strings.HasPrefix(req.URL.Path, events.SubPathPrefix) {
+		query := req.URL.Query()
+		opts := &events.SubscriptionDeleteOpts{
+			Drain: strings.ToLower(query.Get("drain")) == "true",
+			Purge: strings.ToLower(query.Get("purge")) == "true",
+		}
+		if drainTimeoutStr := query.Get("drainTimeoutSec"); drainTimeoutStr != "" {
+			drainTimeoutSec, err := strconv.ParseUint(drainTimeoutStr, 10, 64)
+			if err != nil {
+				g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.EventStreamsSubscriptionDrainBadTimeout, drainTimeoutStr), 400)
+				return
+			}
+			opts.DrainTimeout = time.Duration(drainTimeoutSec) * time.Second
+		}
+		if opts.Drain && opts.Purge {
+			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.EventStreamsSubscriptionDeleteDrainAndPurge), 400)
+			return
+		}
+		err = g.sm.DeleteSubscriptionWithOpts(req.Context(), params.ByName("id"), opts)
+	} else {
+		err = g.sm.DeleteStream(req.Context(), params.ByName("id"))
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+}
+
+// resetSub resets subscription over REST
+func (g *smartContractGW) resetSub(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var body struct {
+		FromBlock string `json:"fromBlock"`
+	}
+	err := json.NewDecoder(req.Body).Decode(&body)
+	if err == nil {
+		err = g.sm.ResetSubscription(req.Context(), params.ByName("id"), body.FromBlock)
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+}
+
+// suspendOrResumeStream suspends or resumes a stream. A suspend can supply ?untilBlock or
+// ?untilTime, to have the stream resumed automatically once that block or time is reached
+func (g *smartContractGW) suspendOrResumeStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var err error
+	query := req.URL.Query()
+	if strings.HasSuffix(req.URL.Path, "resume") {
+		err = g.sm.ResumeStream(req.Context(), params.ByName("id"))
+	} else if query.Get("untilBlock") != "" || query.Get("untilTime") != "" {
+		until := &events.AutoResumeSpec{
+			Block: query.Get("untilBlock"),
+			Time:  query.Get("untilTime"),
+		}
+		if err = until.Validate(); err != nil {
+			g.gatewayErrReply(res, req, err, 400)
+			return
+		}
+		err = g.sm.SuspendStreamUntil(req.Context(), params.ByName("id"), until)
+	} else {
+		err = g.sm.SuspendStream(req.Context(), params.ByName("id"))
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+}
+
+// exportDefinitions returns the definitions of all streams and subscriptions, without checkpoints.
+// Webhook headers are redacted unless includeHeaders=true is set
+func (g *smartContractGW) exportDefinitions(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	defs := g.sm.ExportDefinitions(req.Context(), strings.ToLower(req.URL.Query().Get("includeHeaders")) == "true")
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(defs)
+}
+
+// importDefinitions creates or updates streams and subscriptions from a previously exported document
+func (g *smartContractGW) importDefinitions(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var defs events.BootstrapConf
+	if err := json.NewDecoder(req.Body).Decode(&defs); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventDefinitionsInvalid, err), 400)
+		return
+	}
+	if err := g.sm.ImportDefinitions(req.Context(), &defs); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(g.sm.ExportDefinitions(req.Context(), false))
+}
+
+// exportStream suspends a stream, and returns it with its subscriptions and checkpoint for import on another instance
+func (g *smartContractGW) exportStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var timeout time.Duration
+	if timeoutStr := req.URL.Query().Get("timeoutSec"); timeoutStr != "" {
+		timeoutSec, err := strconv.ParseUint(timeoutStr, 10, 64)
+		if err != nil {
+			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventExportBadTimeout, timeoutStr), 400)
+			return
+		}
+		timeout = time.Duration(timeoutSec) * time.Second
+	}
+	m, err := g.sm.ExportStream(req.Context(), params.ByName("id"), timeout)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(m)
+}
+
+// importStream creates a stream exported from another instance, in the suspended state
+func (g *smartContractGW) importStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if g.sm == nil {
+		g.gatewayErrReply(res, req, errors.New(errEventSupportMissing), 405)
+		return
+	}
+
+	var m events.StreamMigration
+	if err := json.NewDecoder(req.Body).Decode(&m); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayEventMigrationInvalid, err), 400)
+		return
+	}
+	stream, err := g.sm.ImportStream(req.Context(), &m)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(stream)
+}
+
+func (g *smartContractGW) resolveAddressOrName(id string) (deployMsg *messages.DeployContract, registeredName string, info *contractInfo, err error) {
+	deployMsg, info, err = g.loadDeployMsgForInstance(id)
+	if err != nil {
+		var origErr = err
+		registeredName = id
 		if id, err = g.resolveContractAddr(registeredName); err != nil {
 			log.Infof("%s is not a friendly name: %s", registeredName, err)
 			return nil, "", nil, origErr
@@ -893,28 +1757,57 @@ func (g *smartContractGW) isSwaggerRequest(req *http.Request) (swaggerGen *opena
 	}
 	from = req.FormValue("from")
 	if swaggerRequest {
-		var conf = *g.baseSwaggerConf
-		if vs := req.Form["noauth"]; len(vs) > 0 {
-			conf.BasicAuth = strings.ToLower(vs[0]) == "false"
-		}
-		if vs := req.Form["schemes"]; len(vs) > 0 {
-			requested := strings.Split(vs[0], ",")
-			conf.ExternalSchemes = []string{}
-			for _, scheme := range requested {
-				// Only allow http and https
-				if scheme == "http" || scheme == "https" {
-					conf.ExternalSchemes = append(conf.ExternalSchemes, scheme)
-				} else {
-					log.Warnf("Excluded unknown scheme: %s", scheme)
-				}
+		swaggerGen = openapi.NewABI2Swagger(g.swaggerConfForRequest(req))
+	}
+	return
+}
+
+// swaggerConfForRequest applies any per-request overrides to the base OpenAPI generation config
+func (g *smartContractGW) swaggerConfForRequest(req *http.Request) *openapi.ABI2SwaggerConf {
+	req.ParseForm()
+	var conf = *g.baseSwaggerConf
+	if vs := req.Form["noauth"]; len(vs) > 0 {
+		conf.BasicAuth = strings.ToLower(vs[0]) == "false"
+		conf.BearerAuth = conf.BearerAuth && conf.BasicAuth
+	}
+	if vs := req.Form["schemes"]; len(vs) > 0 {
+		requested := strings.Split(vs[0], ",")
+		conf.ExternalSchemes = []string{}
+		for _, scheme := range requested {
+			// Only allow http and https
+			if scheme == "http" || scheme == "https" {
+				conf.ExternalSchemes = append(conf.ExternalSchemes, scheme)
+			} else {
+				log.Warnf("Excluded unknown scheme: %s", scheme)
 			}
 		}
-		swaggerGen = openapi.NewABI2Swagger(&conf)
 	}
-	return
+	if vs := req.Form["host"]; len(vs) > 0 {
+		if vs[0] != "" && !strings.ContainsAny(vs[0], "/?# ") {
+			conf.ExternalHost = vs[0]
+		} else {
+			log.Warnf("Ignored invalid host: %s", vs[0])
+		}
+	}
+	if vs := req.Form["basepath"]; len(vs) > 0 {
+		if strings.HasPrefix(vs[0], "/") && !strings.ContainsAny(vs[0], "?# ") {
+			conf.ExternalRootPath = strings.TrimSuffix(vs[0], "/")
+		} else {
+			log.Warnf("Ignored invalid base path: %s", vs[0])
+		}
+	}
+	return &conf
 }
 
-func (g *smartContractGW) replyWithSwagger(res http.ResponseWriter, req *http.Request, swagger *spec.Swagger, id, from string) {
+// getSystemAPI returns the OpenAPI definition of the built-in admin, event stream and receipt APIs
+func (g *smartContractGW) getSystemAPI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	swagger := openapi.NewABI2Swagger(g.swaggerConfForRequest(req)).GenSystemAPI()
+	g.replyWithSwagger(res, req, swagger, "ethconnect", "")
+}
+
+// setSwaggerFromDefault sets the default of the from parameter of the generated OpenAPI
+func setSwaggerFromDefault(swagger *spec.Swagger, from string) {
 	if from != "" {
 		if swagger.Parameters != nil {
 			if param, exists := swagger.Parameters["fromParam"]; exists {
@@ -923,6 +1816,10 @@ func (g *smartContractGW) replyWithSwagger(res http.ResponseWriter, req *http.Re
 			}
 		}
 	}
+}
+
+func (g *smartContractGW) replyWithSwagger(res http.ResponseWriter, req *http.Request, swagger *spec.Swagger, id, from string) {
+	setSwaggerFromDefault(swagger, from)
 	swaggerBytes, _ := json.MarshalIndent(&swagger, "", "  ")
 
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
@@ -934,10 +1831,38 @@ func (g *smartContractGW) replyWithSwagger(res http.ResponseWriter, req *http.Re
 	res.Write(swaggerBytes)
 }
 
+// isPostmanRequest checks for a request for a Postman collection, rather than the OpenAPI definition
+func isPostmanRequest(req *http.Request) bool {
+	req.ParseForm()
+	if vs := req.Form["postman"]; len(vs) > 0 {
+		return strings.ToLower(vs[0]) != "false"
+	}
+	return false
+}
+
+// replyWithPostman converts the OpenAPI generated for a contract to a Postman collection, with
+// a sample body for each method built from the ABI
+func (g *smartContractGW) replyWithPostman(res http.ResponseWriter, req *http.Request, swagger *spec.Swagger, abi *ethbinding.ABI, id, from string) {
+	setSwaggerFromDefault(swagger, from)
+	collectionBytes, _ := json.MarshalIndent(openapi.GenPostman(swagger, abi), "", "  ")
+
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	if vs := req.Form["download"]; len(vs) > 0 {
+		res.Header().Set("Content-Disposition", "attachment; filename=\""+id+".postman_collection.json\"")
+	}
+	res.WriteHeader(200)
+	res.Write(collectionBytes)
+}
+
 func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	swaggerGen, uiRequest, factoryOnly, abiRequest, _, from := g.isSwaggerRequest(req)
-	id := strings.TrimPrefix(strings.ToLower(params.ByName("address")), "0x")
+	postmanRequest := isPostmanRequest(req)
+	if postmanRequest && swaggerGen == nil {
+		swaggerGen = openapi.NewABI2Swagger(g.swaggerConfForRequest(req))
+	}
+	id, _ := normalizeAddress(params.ByName("address"))
 	prefix := "contract"
 	if id == "" {
 		id = strings.ToLower(params.ByName("abi"))
@@ -954,6 +1879,9 @@ func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Re
 			g.gatewayErrReply(res, req, err, 404)
 			return
 		}
+		if hierarchicalName, ok := hierarchicalNameFor(req); ok {
+			registeredName = hierarchicalName
+		}
 	} else {
 		abiID = id
 		deployMsg, info, err = g.loadDeployMsgByID(abiID)
@@ -966,13 +1894,17 @@ func (g *smartContractGW) getContractOrABI(res http.ResponseWriter, req *http.Re
 		g.writeHTMLForUI(prefix, id, from, (prefix == "abi"), factoryOnly, res)
 	} else if swaggerGen != nil {
 		addr := params.ByName("address")
-		runtimeABI, err := ethbind.API.ABIMarshalingToABIRuntime(deployMsg.ABI)
+		runtimeABI, err := eth.RuntimeABI(deployMsg.ABI)
 		if err != nil {
 			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidABI, err), 404)
 			return
 		}
-		swagger := g.swaggerForABI(swaggerGen, abiID, deployMsg.ContractName, factoryOnly, runtimeABI, deployMsg.DevDoc, addr, registeredName)
-		g.replyWithSwagger(res, req, swagger, id, from)
+		swagger := g.swaggerForABI(swaggerGen, abiID, deployMsg.ContractName, factoryOnly, runtimeABI, deployMsg.DevDoc, deployMsg.UserDoc, addr, registeredName)
+		if postmanRequest {
+			g.replyWithPostman(res, req, swagger, &runtimeABI.ABI, id, from)
+		} else {
+			g.replyWithSwagger(res, req, swagger, id, from)
+		}
 	} else if abiRequest {
 		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
 		res.Header().Set("Content-Type", "application/json")
@@ -994,6 +1926,10 @@ func (g *smartContractGW) getRemoteRegistrySwaggerOrABI(res http.ResponseWriter,
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	swaggerGen, uiRequest, factoryOnly, abiRequest, refreshABI, from := g.isSwaggerRequest(req)
+	postmanRequest := isPostmanRequest(req)
+	if postmanRequest && swaggerGen == nil {
+		swaggerGen = openapi.NewABI2Swagger(g.swaggerConfForRequest(req))
+	}
 
 	var deployMsg *messages.DeployContract
 	var err error
@@ -1032,13 +1968,17 @@ func (g *smartContractGW) getRemoteRegistrySwaggerOrABI(res http.ResponseWriter,
 	if uiRequest {
 		g.writeHTMLForUI(prefix, id, from, isGateway, factoryOnly, res)
 	} else if swaggerGen != nil {
-		runtimeABI, err := ethbind.API.ABIMarshalingToABIRuntime(deployMsg.ABI)
+		runtimeABI, err := eth.RuntimeABI(deployMsg.ABI)
 		if err != nil {
 			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayInvalidABI, err), 400)
 			return
 		}
 		swagger := g.swaggerForRemoteRegistry(swaggerGen, id, addr, factoryOnly, runtimeABI, deployMsg.DevDoc, req.URL.Path)
-		g.replyWithSwagger(res, req, swagger, id, from)
+		if postmanRequest {
+			g.replyWithPostman(res, req, swagger, &runtimeABI.ABI, id, from)
+		} else {
+			g.replyWithSwagger(res, req, swagger, id, from)
+		}
 	} else if abiRequest {
 		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
 		res.Header().Set("Content-Type", "application/json")
@@ -1064,9 +2004,8 @@ func (g *smartContractGW) getRemoteRegistrySwaggerOrABI(res http.ResponseWriter,
 func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
-	addrHexNo0x := strings.ToLower(strings.TrimPrefix(params.ByName("address"), "0x"))
-	addrCheck, _ := regexp.Compile("^[0-9a-z]{40}$")
-	if !addrCheck.MatchString(addrHexNo0x) {
+	addrHexNo0x, ok := normalizeAddress(params.ByName("address"))
+	if !ok {
 		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationSuppliedInvalidAddress), 404)
 		return
 	}
@@ -1074,19 +2013,37 @@ func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Re
 	// Note: there is currently no body payload required for the POST
 
 	abiID := params.ByName("abi")
-	_, _, err := g.loadDeployMsgByID(abiID)
+	deployMsg, _, err := g.loadDeployMsgByID(abiID)
 	if err != nil {
 		g.gatewayErrReply(res, req, err, 404)
 		return
 	}
 
+	if err = g.verifyContractCode(req, addrHexNo0x, abiID, deployMsg); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	methods := methodFilter{
+		AllowMethods: getFlyParamMulti("allowmethods", req),
+		DenyMethods:  getFlyParamMulti("denymethods", req),
+	}
+	if err = methods.validate(deployMsg.ABI); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
 	registerAs := getFlyParam("register", req, false)
+	if err = checkRegisteredName(registerAs); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
 	registeredName := registerAs
 	if registeredName == "" {
 		registeredName = addrHexNo0x
 	}
 
-	contractInfo, err := g.storeNewContractInfo(addrHexNo0x, abiID, registeredName, registerAs)
+	contractInfo, err := g.storeNewContractInfo(addrHexNo0x, abiID, registeredName, registerAs, methods)
 	if err != nil {
 		g.gatewayErrReply(res, req, err, 409)
 		return
@@ -1099,6 +2056,142 @@ func (g *smartContractGW) registerContract(res http.ResponseWriter, req *http.Re
 	json.NewEncoder(res).Encode(&contractInfo)
 }
 
+// registerGatewayInstance registers an existing instance of a gateway's contract in the remote registry,
+// so it can be invoked via /instances. A name for the instance must be supplied with fly-register
+func (g *smartContractGW) registerGatewayInstance(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	addrHexNo0x, ok := normalizeAddress(params.ByName("address"))
+	if !ok {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationSuppliedInvalidAddress), 404)
+		return
+	}
+
+	registerAs := getFlyParam("register", req, false)
+	if registerAs == "" {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationMissingName, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")), 400)
+		return
+	}
+
+	gatewayID := params.ByName("gateway_lookup")
+	deployMsg, err := g.rr.loadFactoryForGateway(gatewayID, false)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	} else if deployMsg == nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RemoteRegistryLookupGatewayNotFound), 404)
+		return
+	}
+
+	if err = g.verifyContractCode(req, addrHexNo0x, gatewayID, deployMsg); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	if err = g.checkNameAvailable(registerAs, true); err != nil {
+		g.gatewayErrReply(res, req, err, 409)
+		return
+	}
+
+	if err = g.rr.registerInstance(registerAs, "0x"+addrHexNo0x); err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+
+	ci := &remoteContractInfo{
+		ID:      registerAs,
+		ABI:     deployMsg.ABI,
+		Address: "0x" + addrHexNo0x,
+	}
+	status := 201
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(ci)
+}
+
+// updateContractName updates or removes the friendly name of a registered contract instance.
+// The instance can be referred to by address or by its current name
+func (g *smartContractGW) updateContractName(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var body struct {
+		RegisteredAs *string `json:"registeredAs"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.RegisteredAs == nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayContractNameUpdateInvalid), 400)
+		return
+	}
+
+	if err := checkRegisteredName(*body.RegisteredAs); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	id := params.ByName("address")
+	addrHexNo0x, _ := normalizeAddress(id)
+	g.idxLock.Lock()
+	if _, exists := g.contractIndex[addrHexNo0x]; !exists {
+		var err error
+		if addrHexNo0x, err = g.resolveContractAddr(id); err != nil {
+			g.idxLock.Unlock()
+			g.gatewayErrReply(res, req, err, 404)
+			return
+		}
+	}
+	info := g.contractIndex[addrHexNo0x].(*contractInfo)
+	g.idxLock.Unlock()
+
+	force := strings.ToLower(getFlyParam("force", req, true)) == "true"
+	updated, errStatus, err := g.renameContract(info, *body.RegisteredAs, force)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, errStatus)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(updated)
+}
+
+// verifyContractCode optionally checks there is contract code deployed at the address being registered,
+// to catch registration of an EOA or a mistyped address. With fly-verify=bytecode the deployed code must
+// also match the runtime bytecode from compiling the contract
+func (g *smartContractGW) verifyContractCode(req *http.Request, addrHexNo0x, abiID string, deployMsg *messages.DeployContract) error {
+	verify := strings.ToLower(getFlyParam("verify", req, true))
+	if verify == "" && g.conf.VerifyCode {
+		verify = "true"
+	}
+	if verify == "" || verify == "false" {
+		return nil
+	}
+	if g.rpc == nil {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationVerifyUnavailable)
+	}
+	matchBytecode := verify == "bytecode"
+	if matchBytecode && len(deployMsg.CompiledRuntime) == 0 {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationNoRuntimeBytecode, abiID)
+	}
+	addr := ethbind.API.HexToAddress("0x" + addrHexNo0x)
+	code, err := eth.GetCode(req.Context(), g.rpc, &addr, "latest")
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationNoCode, addrHexNo0x)
+	}
+	if matchBytecode && !eth.RuntimeBytecodeMatches(code, deployMsg.CompiledRuntime) {
+		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationCodeMismatch, addrHexNo0x, abiID)
+	}
+	return nil
+}
+
 func tempdir() string {
 	dir, _ := ioutil.TempDir("", "fly")
 	log.Infof("tmpdir/create: %s", dir)
@@ -1113,6 +2206,11 @@ func cleanup(dir string) {
 func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	if isJSONUpload(req) {
+		g.addABIFromJSON(res, req)
+		return
+	}
+
 	if err := req.ParseMultipartForm(maxFormParsingMemory); err != nil {
 		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractInvalidFormData, err), 400)
 		return
@@ -1120,11 +2218,16 @@ func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, par
 
 	tempdir := tempdir()
 	defer cleanup(tempdir)
+	limit := g.conf.Solc.NewSourceLimit()
 	for name, files := range req.MultipartForm.File {
 		log.Debugf("multi-part form entry '%s'", name)
 		for _, fileHeader := range files {
-			if err := g.extractMultiPartFile(tempdir, fileHeader); err != nil {
-				g.gatewayErrReply(res, req, err, 400)
+			if err := g.extractMultiPartFile(tempdir, fileHeader, limit); err != nil {
+				status := 400
+				if limit.Exceeded() {
+					status = 413
+				}
+				g.gatewayErrReply(res, req, err, status)
 				return
 			}
 		}
@@ -1153,16 +2256,24 @@ func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, par
 		return
 	}
 
-	bytecode, err := g.parseBytecode(req.Form)
+	bytecode, err := g.parseBytecode(req.Form, "bytecode")
 	if err != nil {
 		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractInvalidFormData, err), 400)
 		return
 	}
 
+	runtimeBytecode, err := g.parseBytecode(req.Form, "runtimebytecode")
+	if err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractInvalidFormData, err), 400)
+		return
+	}
+
+	// An ABI can be uploaded without bytecode, in which case there is nothing to compile
 	var preCompiled map[string]*ethbinding.Contract
-	if bytecode == nil {
+	var warnings []string
+	if bytecode == nil && abi == nil {
 		var err error
-		preCompiled, err = g.compileMultipartFormSolidity(tempdir, req)
+		preCompiled, warnings, err = g.compileMultipartFormSolidity(tempdir, req)
 		if err != nil {
 			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractCompileFailed, err), 400)
 			return
@@ -1192,9 +2303,12 @@ func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, par
 			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractPostCompileFailed, err), 400)
 			return
 		}
+		compiled.Warnings = warnings
 	} else {
 		msg.ABI = abi
 		msg.Compiled = bytecode
+		msg.CompiledRuntime = runtimeBytecode
+		msg.ContractName = req.FormValue("contract")
 	}
 
 	info, err := g.storeDeployableABI(msg, compiled)
@@ -1209,8 +2323,8 @@ func (g *smartContractGW) addABI(res http.ResponseWriter, req *http.Request, par
 	json.NewEncoder(res).Encode(info)
 }
 
-func (g *smartContractGW) parseBytecode(form url.Values) ([]byte, error) {
-	v := form["bytecode"]
+func (g *smartContractGW) parseBytecode(form url.Values, field string) ([]byte, error) {
+	v := form[field]
 	if len(v) > 0 {
 		b := strings.TrimLeft(v[0], "0x")
 		if bytecode, err := hex.DecodeString(b); err != nil {
@@ -1238,12 +2352,12 @@ func (g *smartContractGW) parseABI(form url.Values) (ethbinding.ABIMarshaling, e
 	return nil, nil
 }
 
-func (g *smartContractGW) compileMultipartFormSolidity(dir string, req *http.Request) (map[string]*ethbinding.Contract, error) {
+func (g *smartContractGW) compileMultipartFormSolidity(dir string, req *http.Request) (map[string]*ethbinding.Contract, []string, error) {
 	solFiles := []string{}
 	rootFiles, err := ioutil.ReadDir(dir)
 	if err != nil {
 		log.Errorf("Failed to read dir '%s': %s", dir, err)
-		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractExtractedReadFailed)
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractExtractedReadFailed)
 	}
 	for _, file := range rootFiles {
 		log.Debugf("multi-part: '%s' [dir=%t]", file.Name(), file.IsDir())
@@ -1252,41 +2366,56 @@ func (g *smartContractGW) compileMultipartFormSolidity(dir string, req *http.Req
 		}
 	}
 
-	evmVersion := req.FormValue("evm")
-	solcArgs := eth.GetSolcArgs(evmVersion)
-	if sourceFiles := req.Form["source"]; len(sourceFiles) > 0 {
-		solcArgs = append(solcArgs, sourceFiles...)
-	} else if len(solFiles) > 0 {
-		solcArgs = append(solcArgs, solFiles...)
-	} else {
-		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractNoSOL)
+	reqRemappings := req.Form["remapping"]
+	if err := eth.ValidateRemappings(reqRemappings); err != nil {
+		return nil, nil, err
+	}
+	sourceFiles := req.Form["source"]
+	if len(sourceFiles) == 0 {
+		sourceFiles = solFiles
+	}
+	if len(sourceFiles) == 0 {
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractNoSOL)
+	}
+	return g.compileSolidityDir(dir, req.FormValue("compiler"), req.FormValue("evm"), reqRemappings, sourceFiles)
+}
+
+// compileSolidityDir compiles source files in a directory, with the configured remappings and
+// those of any configured dependencies the source imports, followed by the remappings supplied
+func (g *smartContractGW) compileSolidityDir(dir, compiler, evmVersion string, reqRemappings, sourceFiles []string) (map[string]*ethbinding.Contract, []string, error) {
+	// Configured npm/GitHub dependencies imported by the source are remapped to the local cache
+	depRemappings, err := g.conf.Solc.Dependencies.Resolve(dir)
+	if err != nil {
+		return nil, nil, err
 	}
+	solcConf := g.conf.Solc
+	solcConf.Remappings = append(append([]string{}, g.conf.Solc.Remappings...), depRemappings...)
+	solcArgs := append(solcConf.SolcArgs(evmVersion, reqRemappings), sourceFiles...)
 
-	solcVer, err := eth.GetSolc(req.FormValue("compiler"))
+	solcVer, err := eth.GetSolc(compiler)
 	if err != nil {
-		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractSolcVerFail, err)
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractSolcVerFail, err)
 	}
 	solOptionsString := strings.Join(append([]string{solcVer.Path}, solcArgs...), " ")
 	log.Infof("Compiling: %s", solOptionsString)
-	cmd := exec.Command(solcVer.Path, solcArgs...)
-
-	var stderr, stdout bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	cmd.Dir = dir
-	if err := cmd.Run(); err != nil {
-		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractCompileFailDetails, err, stderr.String())
+	stdout, stderr, err := solcConf.RunSolc(dir, solcVer.Path, solcArgs)
+	if err != nil {
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractCompileFailDetails, err, stderr)
 	}
 
-	compiled, err := ethbind.API.ParseCombinedJSON(stdout.Bytes(), "", solcVer.Version, solcVer.Version, solOptionsString)
+	compiled, err := ethbind.API.ParseCombinedJSON(stdout, "", solcVer.Version, solcVer.Version, solOptionsString)
 	if err != nil {
-		return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractSolcOutputProcessFail, err)
+		return nil, nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractSolcOutputProcessFail, err)
 	}
 
-	return compiled, nil
+	warnings := eth.SolcWarnings(stderr)
+	if len(warnings) > 0 {
+		log.Infof("Compiled with %d warnings", len(warnings))
+	}
+	return compiled, warnings, nil
 }
 
-func (g *smartContractGW) extractMultiPartFile(dir string, file *multipart.FileHeader) error {
+func (g *smartContractGW) extractMultiPartFile(dir string, file *multipart.FileHeader, limit *eth.SourceLimit) error {
 	fileName := file.Filename
 	if strings.ContainsAny(fileName, "/\\") {
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractSlashes)
@@ -1303,28 +2432,77 @@ func (g *smartContractGW) extractMultiPartFile(dir string, file *multipart.FileH
 		log.Errorf("Failed opening '%s' for writing: %s", fileName, err)
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractUnzipWrite)
 	}
-	written, err := io.Copy(out, in)
+	written, err := limit.Copy(out, in)
+	out.Close()
 	if err != nil {
+		if limit.Exceeded() {
+			return limit.Err()
+		}
 		log.Errorf("Failed writing '%s' from multi-part form: %s", fileName, err)
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractUnzipCopy)
 	}
 	log.Debugf("multi-part: '%s' [%dKb]", fileName, written/1024)
-	return g.processIfArchive(dir, outFileName)
+	return g.processIfArchive(dir, outFileName, limit)
 }
 
-func (g *smartContractGW) processIfArchive(dir, fileName string) error {
+// processIfArchive extracts an uploaded archive into the directory. Each file is written through
+// the source limit, as the sizes in the headers of an archive cannot be trusted
+func (g *smartContractGW) processIfArchive(dir, fileName string, limit *eth.SourceLimit) error {
 	z, err := archiver.ByExtension(fileName)
 	if err != nil {
 		log.Debugf("multi-part: '%s' not an archive: %s", fileName, err)
 		return nil
 	}
-	err = z.(archiver.Unarchiver).Unarchive(fileName, dir)
+	walker, ok := z.(archiver.Walker)
+	if !ok {
+		log.Debugf("multi-part: '%s' not an archive", fileName)
+		return nil
+	}
+	err = walker.Walk(fileName, func(f archiver.File) error {
+		return extractArchiveFile(dir, f, limit)
+	})
 	if err != nil {
+		if limit.Exceeded() {
+			return limit.Err()
+		}
 		return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayCompileContractUnzip, err)
 	}
 	return nil
 }
 
+func extractArchiveFile(dir string, f archiver.File, limit *eth.SourceLimit) error {
+	name := f.Name()
+	switch h := f.Header.(type) {
+	case zip.FileHeader:
+		name = h.Name
+	case *zip.FileHeader:
+		name = h.Name
+	case *tar.Header:
+		name = h.Name
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+		return errors.New("invalid path '" + name + "'")
+	}
+	if f.IsDir() {
+		return os.MkdirAll(target, 0755)
+	}
+	if !f.Mode().IsRegular() {
+		// Links and other special files are not needed to compile Solidity
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = limit.Copy(out, f)
+	return err
+}
+
 // Write out a nice little UI for exercising the Swagger
 func (g *smartContractGW) writeHTMLForUI(prefix, id, from string, isGateway, factoryOnly bool, res http.ResponseWriter) {
 	fromQuery := ""
@@ -1433,12 +2611,25 @@ func (g *smartContractGW) writeHTMLForUI(prefix, id, from string, isGateway, fac
 	res.Write([]byte(html))
 }
 
+// SubscriptionManager returns the event subscription manager, or nil if events are not configured
+func (g *smartContractGW) SubscriptionManager() events.SubscriptionManager {
+	return g.sm
+}
+
 // Shutdown performs a clean shutdown
 func (g *smartContractGW) Shutdown() {
+	if g.hooksCancel != nil {
+		// Stop any post-deploy hooks still running, and wait for them to exit
+		g.hooksCancel()
+		g.hooksWG.Wait()
+	}
 	if g.sm != nil {
 		g.sm.Close()
 	}
 	if g.rr != nil {
 		g.rr.close()
 	}
+	if g.r2e != nil && g.r2e.readPool != nil {
+		g.r2e.readPool.close()
+	}
 }
@@ -17,6 +17,7 @@ package contracts
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -26,6 +27,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,9 +36,11 @@ import (
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/auth"
 	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/eth"
 	"github.com/kaleido-io/ethconnect/internal/ethbind"
 	"github.com/kaleido-io/ethconnect/internal/events"
 	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/openapi"
 	"github.com/kaleido-io/ethconnect/internal/tx"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -77,6 +81,77 @@ func TestCobraInitContractGateway(t *testing.T) {
 	CobraInitContractGateway(&cmd, conf)
 	assert.NotNil(cmd.Flag("openapi-path"))
 	assert.NotNil(cmd.Flag("openapi-baseurl"))
+	assert.NotNil(cmd.Flag("openapi-host"))
+	assert.NotNil(cmd.Flag("openapi-basepath"))
+}
+
+func TestNewSmartContractGatewayOpenAPIOverrides(t *testing.T) {
+	assert := assert.New(t)
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL:         "http://10.0.0.1:8080/api/v1",
+			OpenAPIHost:     "ethconnect.example.com",
+			OpenAPIBasePath: "/proxy/api/v1/",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	assert.Equal("ethconnect.example.com", scgw.baseSwaggerConf.ExternalHost)
+	assert.Equal("/proxy/api/v1", scgw.baseSwaggerConf.ExternalRootPath)
+}
+
+func TestSwaggerRequestHostOverrides(t *testing.T) {
+	assert := assert.New(t)
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://10.0.0.1:8080/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+
+	req := httptest.NewRequest("GET", "/abis/abi1?swagger&host=ethconnect.example.com:443&basepath=/proxy/&schemes=https", nil)
+	swaggerGen, _, _, _, _, _ := scgw.isSwaggerRequest(req)
+	swagger := swaggerGen.Gen4Instance("/contracts/lobster", "lobster", &ethbinding.ABI{}, "")
+	assert.Equal("ethconnect.example.com:443", swagger.Host)
+	assert.Equal("/proxy/contracts/lobster", swagger.BasePath)
+	assert.Equal([]string{"https"}, swagger.Schemes)
+
+	req = httptest.NewRequest("GET", "/abis/abi1?swagger&host=bad/host&basepath=nope", nil)
+	swaggerGen, _, _, _, _, _ = scgw.isSwaggerRequest(req)
+	swagger = swaggerGen.Gen4Instance("/contracts/lobster", "lobster", &ethbinding.ABI{}, "")
+	assert.Equal("10.0.0.1:8080", swagger.Host)
+	assert.Equal("/api/v1/contracts/lobster", swagger.BasePath)
+
+	// Defaults are untouched by per-request overrides
+	assert.Equal("10.0.0.1:8080", scgw.baseSwaggerConf.ExternalHost)
+}
+
+func TestGetSystemAPI(t *testing.T) {
+	assert := assert.New(t)
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://10.0.0.1:8080/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	s.AddRoutes(router)
+
+	req := httptest.NewRequest("GET", SystemAPIPath+"?host=ethconnect.example.com&download", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("attachment; filename=\"ethconnect.swagger.json\"", res.Result().Header.Get("Content-Disposition"))
+	var swagger spec.Swagger
+	err := json.NewDecoder(res.Body).Decode(&swagger)
+	assert.NoError(err)
+	assert.Equal("ethconnect.example.com", swagger.Host)
+	assert.Equal("/api/v1/", swagger.BasePath)
+	assert.Contains(swagger.Paths.Paths, "/eventstreams")
 }
 
 func TestNewSmartContractGatewayBadURL(t *testing.T) {
@@ -283,6 +358,19 @@ func TestPreDeployCompileAndPostDeploy(t *testing.T) {
 	assert.Equal("attachment; filename=\"0123456789abcdef0123456789abcdef01234567.swagger.json\"", res.HeaderMap.Get("Content-Disposition"))
 	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", swagger.Parameters["fromParam"].SimpleSchema.Default)
 	assert.Equal("/api/v1/contracts/0123456789abcdef0123456789abcdef01234567", swagger.BasePath)
+
+	// Check we can get a Postman collection for the contract, for download
+	req = httptest.NewRequest("GET", "/contracts/0123456789abcdef0123456789abcdef01234567?postman&download", bytes.NewReader([]byte{}))
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Result().StatusCode)
+	var collection openapi.PostmanCollection
+	err = json.NewDecoder(res.Body).Decode(&collection)
+	assert.NoError(err)
+	assert.Equal("SimpleEvents", collection.Info.Name)
+	assert.Equal("http://localhost/api/v1/contracts/0123456789abcdef0123456789abcdef01234567", collection.Variable[0].Value)
+	assert.NotEmpty(collection.Item)
+	assert.Equal("attachment; filename=\"0123456789abcdef0123456789abcdef01234567.postman_collection.json\"", res.HeaderMap.Get("Content-Disposition"))
 }
 
 func TestRegisterExistingContract(t *testing.T) {
@@ -758,6 +846,117 @@ func TestPostDeployNoRegisteredName(t *testing.T) {
 	assert.Equal("/contracts/0123456789abcdef0123456789abcdef01234567", contractInfo.Path)
 }
 
+func newTestConstructorArgsGW(t *testing.T, dir string, params []interface{}) *smartContractGW {
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	deployMsg := &messages.DeployContract{
+		Compiled: []byte{0x60, 0x80},
+	}
+	deployMsg.Headers.ID = "message1"
+	deployMsg.Parameters = params
+	json.Unmarshal([]byte(`[{"type":"constructor","inputs":[{"name":"supply","type":"uint256"},{"name":"owner","type":"address"}]}]`), &deployMsg.ABI)
+	_, err := scgw.storeDeployableABI(deployMsg, nil)
+	assert.NoError(t, err)
+	return scgw
+}
+
+func newTestDeployReceipt(reqID string) *messages.TransactionReceipt {
+	contractAddr := ethbind.API.HexToAddress("0x0123456789AbcdeF0123456789abCdef01234567")
+	return &messages.TransactionReceipt{
+		ReplyCommon: messages.ReplyCommon{
+			Headers: messages.ReplyHeaders{
+				CommonHeaders: messages.CommonHeaders{
+					MsgType: messages.MsgTypeTransactionSuccess,
+				},
+				ReqID: reqID,
+			},
+		},
+		ContractAddress: &contractAddr,
+	}
+}
+
+func TestPostDeployRecordsConstructorArgs(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestConstructorArgsGW(t, dir, []interface{}{"1000", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"})
+	err := scgw.PostDeploy(newTestDeployReceipt("message1"))
+	assert.NoError(err)
+
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	req := httptest.NewRequest("GET", "/contracts/0123456789abcdef0123456789abcdef01234567", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var info map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&info)
+	assert.Equal("message1", info["abi"])
+	assert.Equal([]interface{}{"1000", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}, info["constructorArgs"])
+	assert.Equal("0x00000000000000000000000000000000000000000000000000000000000003e8"+
+		"00000000000000000000000066c5fe653e7a9ebb628a6d40f0452d1e358baee8", info["constructorData"])
+}
+
+func TestPostDeployInstanceSuppliedDeployMsg(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestConstructorArgsGW(t, dir, nil)
+	deployMsg, _, _ := scgw.loadDeployMsgByID("message1")
+	deployMsg.Parameters = []interface{}{"1", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}
+	err := scgw.postDeployInstance(newTestDeployReceipt("request1"), "message1", deployMsg)
+	assert.NoError(err)
+
+	info := scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.Equal("message1", info.ABI)
+	assert.Equal([]interface{}{"1", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"}, info.ConstructorArgs)
+	assert.Equal(130, len(info.ConstructorData))
+
+	// Recorded in the instance file, so still available after a restart
+	scgw.contractIndex = make(map[string]messages.TimeSortable)
+	scgw.addFileToContractIndex("0123456789abcdef0123456789abcdef01234567", path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	info = scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.Equal(130, len(info.ConstructorData))
+}
+
+func TestPostDeployConstructorArgsNotEncodable(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestConstructorArgsGW(t, dir, []interface{}{"not a number"})
+	err := scgw.PostDeploy(newTestDeployReceipt("message1"))
+	assert.NoError(err)
+
+	info := scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.Equal([]interface{}{"not a number"}, info.ConstructorArgs)
+	assert.Empty(info.ConstructorData)
+}
+
+func TestPostDeployABIIDFromContext(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestConstructorArgsGW(t, dir, []interface{}{"1000", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"})
+	receipt := newTestDeployReceipt("request1")
+	receipt.Headers.Context = map[string]interface{}{abiIDContextKey: "message1"}
+	err := scgw.PostDeploy(receipt)
+	assert.NoError(err)
+
+	contractInfo := scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.Equal("message1", contractInfo.ABI)
+}
+
 func TestPostDeployRemoteRegisteredName(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir()
@@ -1186,6 +1385,38 @@ func TestAddABISingleSolidity(t *testing.T) {
 	assert.Equal("SimpleEvents", info.Name)
 }
 
+func TestAddABISourceTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	conf := &SmartContractGatewayConf{
+		StoragePath: dir,
+	}
+	conf.Solc.MaxSourceSize = 100
+	s, _ := NewSmartContractGateway(conf, &tx.TxnProcessorConf{}, nil, nil, nil, nil)
+	scgw := s.(*smartContractGW)
+	assert.Equal(eth.DefaultSolcTimeoutSec, scgw.conf.Solc.TimeoutSec)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("files", "SimpleEvents.sol")
+	part.Write([]byte(simpleEventsSource()))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/abis", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(413, res.Result().StatusCode)
+	var errInfo restErrMsg
+	json.NewDecoder(res.Body).Decode(&errInfo)
+	assert.Regexp("Solidity source of [0-9]+ bytes exceeds the maximum of 100 bytes", errInfo.Message)
+}
+
 func TestAddABISingleSolidityBadContractName(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	assert := assert.New(t)
@@ -1420,6 +1651,79 @@ func TestAddABIZipNestedNoSource(t *testing.T) {
 	assert.Equal("Failed to compile solidity: No .sol files found in root. Please set a 'source' query param or form field to the relative path of your solidity", errInfo.Message)
 }
 
+func TestAddABIZipBomb(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	conf := &SmartContractGatewayConf{
+		StoragePath: dir,
+	}
+	conf.Solc.MaxSourceSize = 5000
+	s, _ := NewSmartContractGateway(conf, &tx.TxnProcessorConf{}, nil, nil, nil, nil)
+	scgw := s.(*smartContractGW)
+
+	// A small archive that expands to far more than the limit
+	zipBuf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(zipBuf)
+	solWriter, _ := zipWriter.Create("solfiles/Bomb.sol")
+	solWriter.Write(make([]byte, 10000000))
+	zipWriter.Close()
+	assert.Less(zipBuf.Len(), 5000)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("files", "bomb.zip")
+	part.Write(zipBuf.Bytes())
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	router.ServeHTTP(res, req)
+
+	assert.Equal(413, res.Result().StatusCode)
+	errInfo := &restErrMsg{}
+	json.NewDecoder(res.Body).Decode(errInfo)
+	assert.Regexp("Solidity source of 5001 bytes exceeds the maximum of 5000 bytes", errInfo.Message)
+
+	// Extraction stops at the limit
+	extractDir := tempdir()
+	defer cleanup(extractDir)
+	zipFile := path.Join(extractDir, "bomb.zip")
+	ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644)
+	err := scgw.processIfArchive(extractDir, zipFile, scgw.conf.Solc.NewSourceLimit())
+	assert.Regexp("exceeds the maximum of 5000 bytes", err)
+	info, err := os.Stat(path.Join(extractDir, "solfiles", "Bomb.sol"))
+	assert.NoError(err)
+	assert.LessOrEqual(info.Size(), int64(5001))
+}
+
+func TestAddABIZipBadPath(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(&SmartContractGatewayConf{StoragePath: dir}, &tx.TxnProcessorConf{}, nil, nil, nil, nil)
+	scgw := s.(*smartContractGW)
+
+	extractDir := path.Join(dir, "extract")
+	os.Mkdir(extractDir, 0755)
+	zipBuf := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(zipBuf)
+	solWriter, _ := zipWriter.Create("../Escape.sol")
+	solWriter.Write([]byte(simpleEventsSource()))
+	zipWriter.Close()
+	zipFile := path.Join(extractDir, "escape.zip")
+	ioutil.WriteFile(zipFile, zipBuf.Bytes(), 0644)
+
+	err := scgw.processIfArchive(extractDir, zipFile, scgw.conf.Solc.NewSourceLimit())
+	assert.Regexp("Error unarchiving supplied zip file.*invalid path '../Escape.sol'", err)
+	_, err = os.Stat(path.Join(dir, "Escape.sol"))
+	assert.True(os.IsNotExist(err))
+}
+
 func TestAddABIZiNotMultipart(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	assert := assert.New(t)
@@ -1467,7 +1771,7 @@ func TestCompileMultipartFormSolidityBadDir(t *testing.T) {
 	)
 	scgw := s.(*smartContractGW)
 
-	_, err := scgw.compileMultipartFormSolidity(path.Join(dir, "baddir"), nil)
+	_, _, err := scgw.compileMultipartFormSolidity(path.Join(dir, "baddir"), nil)
 	assert.EqualError(err, "Failed to read extracted multi-part form data")
 }
 
@@ -1491,7 +1795,7 @@ func TestCompileMultipartFormSolidityBadSolc(t *testing.T) {
 
 	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte(simpleEventsSource()), 0644)
 	req := httptest.NewRequest("POST", "/abis?compiler=0.99", bytes.NewReader([]byte{}))
-	_, err := scgw.compileMultipartFormSolidity(dir, req)
+	_, _, err := scgw.compileMultipartFormSolidity(dir, req)
 	assert.Regexp("Failed checking solc version", err.Error())
 	os.Unsetenv("FLY_SOLC_0_99")
 }
@@ -1515,7 +1819,7 @@ func TestCompileMultipartFormSolidityBadCompilerVerReq(t *testing.T) {
 
 	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte(simpleEventsSource()), 0644)
 	req := httptest.NewRequest("POST", "/abis?compiler=0.99", bytes.NewReader([]byte{}))
-	_, err := scgw.compileMultipartFormSolidity(dir, req)
+	_, _, err := scgw.compileMultipartFormSolidity(dir, req)
 	assert.EqualError(err, "Failed checking solc version: Could not find a configured compiler for requested Solidity major version 0.99")
 }
 
@@ -1538,10 +1842,92 @@ func TestCompileMultipartFormSolidityBadSolidity(t *testing.T) {
 
 	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte("this is not the solidity you are looking for"), 0644)
 	req := httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte{}))
-	_, err := scgw.compileMultipartFormSolidity(dir, req)
+	_, _, err := scgw.compileMultipartFormSolidity(dir, req)
 	assert.Regexp("Failed to compile", err.Error())
 }
 
+func TestCompileMultipartFormSolidityBadRemapping(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+
+	ioutil.WriteFile(path.Join(dir, "solidity.sol"), []byte(simpleEventsSource()), 0644)
+	req := httptest.NewRequest("POST", "/abis?remapping=nope", bytes.NewReader([]byte{}))
+	_, _, err := scgw.compileMultipartFormSolidity(dir, req)
+	assert.EqualError(err, "Invalid solc remapping 'nope'. Use the format [context:]prefix=target")
+}
+
+func TestNewSmartContractGatewayBadRemapping(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	_, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			Solc:        eth.SolcConf{Remappings: []string{"nope"}},
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.Regexp("Invalid solc remapping 'nope'", err)
+}
+
+func TestNewSmartContractGatewayBadDependency(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	_, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			Solc: eth.SolcConf{Dependencies: eth.SolcDependenciesConf{
+				Packages: []eth.SolcDependency{{Prefix: "@openzeppelin/contracts/", NPM: "@openzeppelin/contracts"}},
+			}},
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.Regexp("Invalid Solidity dependency for prefix '@openzeppelin/contracts/'", err)
+}
+
+func TestCompileMultipartFormSolidityDependencyFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			Solc: eth.SolcConf{Dependencies: eth.SolcDependenciesConf{
+				NPMRegistry: "http://localhost:0",
+				Packages: []eth.SolcDependency{
+					{Prefix: "@openzeppelin/contracts/", NPM: "@openzeppelin/contracts@4.3.2", SHA256: strings.Repeat("a", 64)},
+				},
+			}},
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	assert.NoError(err)
+	scgw := s.(*smartContractGW)
+	assert.Equal(path.Join(dir, "solc-dependencies"), scgw.conf.Solc.Dependencies.CacheDir)
+
+	ioutil.WriteFile(path.Join(dir, "token.sol"), []byte(`import "@openzeppelin/contracts/token/ERC20/ERC20.sol";`), 0644)
+	req := httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte{}))
+	_, _, err = scgw.compileMultipartFormSolidity(dir, req)
+	assert.Regexp("Failed to fetch Solidity dependency npm:@openzeppelin/contracts@4.3.2", err)
+}
+
 func TestExtractMultiPartFileBadFile(t *testing.T) {
 	log.SetLevel(log.DebugLevel)
 	assert := assert.New(t)
@@ -1561,7 +1947,7 @@ func TestExtractMultiPartFileBadFile(t *testing.T) {
 
 	err := scgw.extractMultiPartFile(dir, &multipart.FileHeader{
 		Filename: "/stuff.zip",
-	})
+	}, scgw.conf.Solc.NewSourceLimit())
 	assert.EqualError(err, "Filenames cannot contain slashes. Use a zip file to upload a directory structure")
 }
 
@@ -1584,7 +1970,7 @@ func TestExtractMultiPartFileBadInput(t *testing.T) {
 
 	err := scgw.extractMultiPartFile(dir, &multipart.FileHeader{
 		Filename: "stuff.zip",
-	})
+	}, scgw.conf.Solc.NewSourceLimit())
 	assert.EqualError(err, "Failed to read archive")
 }
 
@@ -1609,6 +1995,38 @@ func TestStoreDeployableABIMissingABI(t *testing.T) {
 	assert.EqualError(err, "Must supply ABI to install an existing ABI into the REST Gateway")
 }
 
+func TestStoreDeployableABIKeepsCompilerWarnings(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	conf := &SmartContractGatewayConf{
+		StoragePath: dir,
+	}
+	s, _ := NewSmartContractGateway(conf, &tx.TxnProcessorConf{}, nil, nil, nil, nil)
+	scgw := s.(*smartContractGW)
+
+	var abi ethbinding.ABIMarshaling
+	json.Unmarshal([]byte(`[{"type":"function","name":"get","inputs":[],"outputs":[]}]`), &abi)
+	msg := &messages.DeployContract{}
+	msg.Headers.ID = "abi1"
+	info, err := scgw.storeDeployableABI(msg, &eth.CompiledSolidity{
+		ContractName: "simple",
+		Compiled:     []byte{0x60, 0x80},
+		ABI:          abi,
+		ContractInfo: &ethbinding.ContractInfo{CompilerVersion: "0.8.4"},
+		Warnings:     []string{"Warning: SPDX license identifier not provided in source file."},
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"Warning: SPDX license identifier not provided in source file."}, info.CompilerWarnings)
+
+	// The warnings are still on the ABI when the index is rebuilt from storage
+	s, _ = NewSmartContractGateway(conf, &tx.TxnProcessorConf{}, nil, nil, nil, nil)
+	_, info, err = s.(*smartContractGW).loadDeployMsgByID("abi1")
+	assert.NoError(err)
+	assert.Equal([]string{"Warning: SPDX license identifier not provided in source file."}, info.CompilerWarnings)
+}
+
 func TestAddFileToContractIndexBadFileSwallowsError(t *testing.T) {
 	dir := tempdir()
 	defer cleanup(dir)
@@ -1900,35 +2318,216 @@ func TestListSubs(t *testing.T) {
 	assert.Equal("earlier", results[1].ID)
 }
 
-func TestGetSub(t *testing.T) {
-	assert := assert.New(t)
-
-	mockSubMgr := &mockSubMgr{
-		sub: &events.SubscriptionInfo{ID: "123"},
+func newTestFilterSubs() []*events.SubscriptionInfo {
+	subs := []*events.SubscriptionInfo{
+		{ID: "sub1", Name: "transfers", Stream: "es-1"},
+		{ID: "sub2", Name: "approvals", Stream: "es-1"},
+		{ID: "sub3", Name: "transfers", Stream: "es-2"},
 	}
-	var result events.SubscriptionInfo
-	res := testGWPath("GET", events.SubPathPrefix+"/123", &result, mockSubMgr)
-	assert.Equal(200, res.Result().StatusCode)
-	assert.Equal("123", result.ID)
+	subs[0].Filter.Addresses = []ethbinding.Address{ethbind.API.HexToAddress("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832")}
+	subs[1].Filter.Addresses = []ethbinding.Address{ethbind.API.HexToAddress("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832")}
+	return subs
 }
 
-func TestGetStream(t *testing.T) {
+func TestListSubsFiltered(t *testing.T) {
 	assert := assert.New(t)
 
-	mockSubMgr := &mockSubMgr{
-		stream: &events.StreamInfo{ID: "123"},
-	}
-	var result events.StreamInfo
-	res := testGWPath("GET", events.StreamPathPrefix+"/123", &result, mockSubMgr)
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs()}
+
+	var results []*events.SubscriptionInfo
+	res := testGWPath("GET", events.SubPathPrefix+"?stream=es-1", &results, mockSubMgr)
 	assert.Equal(200, res.Result().StatusCode)
-	assert.Equal("123", result.ID)
+	assert.Equal(2, len(results))
+
+	results = nil
+	res = testGWPath("GET", events.SubPathPrefix+"?address=2b8c0ecc76d0759a8f50b2e14a6881367d805832&name=transfers", &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(1, len(results))
+	assert.Equal("sub1", results[0].ID)
+
+	results = nil
+	res = testGWPath("GET", events.SubPathPrefix+"?name=transfers&stream=es-2", &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(1, len(results))
+	assert.Equal("sub3", results[0].ID)
+
+	results = nil
+	res = testGWPath("GET", events.SubPathPrefix+"?address=0x567a417717cb6c59ddc1035705f02c0fd1ab1872", &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(0, len(results))
 }
 
-func TestGetSubNoSubMgr(t *testing.T) {
+func TestGetSubByName(t *testing.T) {
 	assert := assert.New(t)
 
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs()}
 	var result events.SubscriptionInfo
-	res := testGWPath("GET", events.SubPathPrefix+"/123", &result, nil)
+	res := testGWPath("GET", events.SubPathPrefix+"/name/approvals", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("sub2", result.ID)
+
+	res = testGWPath("GET", events.SubPathPrefix+"/name/transfers?stream=es-2", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("sub3", result.ID)
+}
+
+func TestGetSubByNameAmbiguous(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs()}
+	var result restErrMsg
+	res := testGWPath("GET", events.SubPathPrefix+"/name/transfers", &result, mockSubMgr)
+	assert.Equal(409, res.Result().StatusCode)
+	assert.Regexp("Multiple subscriptions have the name 'transfers'", result.Message)
+}
+
+func TestGetSubByNameNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs()}
+	var result restErrMsg
+	res := testGWPath("GET", events.SubPathPrefix+"/name/unknown", &result, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Regexp("Subscription with name 'unknown' not found", result.Message)
+
+	res = testGWPath("GET", events.SubPathPrefix+"/sub1/transfers", &result, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+}
+
+func TestGetSubByNameNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
+
+	var result events.SubscriptionInfo
+	res := testGWPath("GET", events.SubPathPrefix+"/name/transfers", &result, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestGetSubByIDOrName(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs(), err: fmt.Errorf("not found")}
+	var result events.SubscriptionInfo
+	res := testGWPath("GET", events.SubPathPrefix+"/approvals", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("sub2", result.ID)
+
+	res = testGWPath("GET", events.SubPathPrefix+"/transfers?stream=es-2", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("sub3", result.ID)
+}
+
+func TestGetSubByIDOrNameAmbiguous(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs(), err: fmt.Errorf("not found")}
+	var result restErrMsg
+	res := testGWPath("GET", events.SubPathPrefix+"/transfers", &result, mockSubMgr)
+	assert.Equal(409, res.Result().StatusCode)
+	assert.Regexp("Multiple subscriptions have the name 'transfers'", result.Message)
+}
+
+func TestGetSubByIDOrNameNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{subs: newTestFilterSubs(), err: fmt.Errorf("not found")}
+	var result restErrMsg
+	res := testGWPath("GET", events.SubPathPrefix+"/unknown", &result, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Equal("not found", result.Message)
+}
+
+func TestListIdleSubs(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		idleSubs: []*events.IdleSubscriptionInfo{
+			{ID: "sub1", Name: "transfers", Stream: "es-1", Reason: events.IdleReasonSuspended},
+		},
+	}
+	var results []*events.IdleSubscriptionInfo
+	res := testGWPath("GET", events.IdleSubscriptionsPath+"?idleTimeoutSec=3600", &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(1, len(results))
+	assert.Equal("sub1", results[0].ID)
+	assert.Equal(time.Hour, mockSubMgr.idleTimeout)
+
+	res = testGWPath("GET", events.IdleSubscriptionsPath, &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(time.Duration(0), mockSubMgr.idleTimeout)
+}
+
+func TestListIdleSubsBadTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var result restErrMsg
+	res := testGWPath("GET", events.IdleSubscriptionsPath+"?idleTimeoutSec=0", &result, &mockSubMgr{})
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Invalid idle timeout '0'", result.Message)
+}
+
+func TestListIdleSubsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	var result restErrMsg
+	res := testGWPath("GET", events.IdleSubscriptionsPath, &result, &mockSubMgr{err: fmt.Errorf("pop")})
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Equal("pop", result.Message)
+}
+
+func TestListIdleSubsNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
+
+	res := testGWPath("GET", events.IdleSubscriptionsPath, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestGetWebhookSLA(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		webhookSLA: []*events.WebhookSLA{
+			{URL: "https://consumer.example.com/events", Streams: []string{"es-1"}},
+		},
+	}
+	var results []*events.WebhookSLA
+	res := testGWPath("GET", events.WebhookStatusPath, &results, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal(1, len(results))
+	assert.Equal("https://consumer.example.com/events", results[0].URL)
+
+	res = testGWPath("GET", events.WebhookStatusPath, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestGetSub(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		sub: &events.SubscriptionInfo{ID: "123"},
+	}
+	var result events.SubscriptionInfo
+	res := testGWPath("GET", events.SubPathPrefix+"/123", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("123", result.ID)
+}
+
+func TestGetStream(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		stream: &events.StreamInfo{ID: "123"},
+	}
+	var result events.StreamInfo
+	res := testGWPath("GET", events.StreamPathPrefix+"/123", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("123", result.ID)
+}
+
+func TestGetSubNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
+
+	var result events.SubscriptionInfo
+	res := testGWPath("GET", events.SubPathPrefix+"/123", &result, nil)
 	assert.Equal(405, res.Result().StatusCode)
 }
 
@@ -1941,12 +2540,63 @@ func TestGetSubNotFound(t *testing.T) {
 	assert.Equal(404, res.Result().StatusCode)
 }
 
+func TestGetSubStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{
+		sub:       &events.SubscriptionInfo{ID: "123"},
+		subStatus: &events.SubscriptionStatus{ID: "123", LatestMatchedBlock: "12", DecodeFailures: 1},
+	}
+	var result events.SubscriptionStatus
+	res := testGWPath("GET", events.SubPathPrefix+"/123/status", &result, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("12", result.LatestMatchedBlock)
+	assert.Equal(uint64(1), result.DecodeFailures)
+}
+
+func TestGetSubStatusNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{err: fmt.Errorf("not found")}
+	res := testGWPath("GET", events.SubPathPrefix+"/123/status", nil, mockSubMgr)
+	assert.Equal(404, res.Result().StatusCode)
+
+	res = testGWPath("GET", events.SubPathPrefix+"/123/status", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
 func TestDeleteSub(t *testing.T) {
 	assert := assert.New(t)
 
 	mockSubMgr := &mockSubMgr{}
 	res := testGWPath("DELETE", events.SubPathPrefix+"/123", nil, mockSubMgr)
 	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal(&events.SubscriptionDeleteOpts{}, mockSubMgr.capturedDeleteOpts)
+}
+
+func TestDeleteSubDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPath("DELETE", events.SubPathPrefix+"/123?drain=true&drainTimeoutSec=5", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal(&events.SubscriptionDeleteOpts{Drain: true, DrainTimeout: 5 * time.Second}, mockSubMgr.capturedDeleteOpts)
+
+	res = testGWPath("DELETE", events.SubPathPrefix+"/123?purge=true", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal(&events.SubscriptionDeleteOpts{Purge: true}, mockSubMgr.capturedDeleteOpts)
+}
+
+func TestDeleteSubDrainBadOpts(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPath("DELETE", events.SubPathPrefix+"/123?drain=true&drainTimeoutSec=soon", nil, mockSubMgr)
+	assert.Equal(400, res.Result().StatusCode)
+
+	res = testGWPath("DELETE", events.SubPathPrefix+"/123?drain=true&purge=true", nil, mockSubMgr)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Nil(mockSubMgr.capturedDeleteOpts)
 }
 
 func TestResetSub(t *testing.T) {
@@ -2015,6 +2665,36 @@ func TestSuspendStream(t *testing.T) {
 	assert.True(mockSubMgr.suspended)
 }
 
+func TestSuspendStreamUntilBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPath("POST", events.StreamPathPrefix+"/123/suspend?untilBlock=0x10", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.True(mockSubMgr.suspended)
+	assert.Equal(&events.AutoResumeSpec{Block: "16"}, mockSubMgr.autoResume)
+}
+
+func TestSuspendStreamUntilTime(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	res := testGWPath("POST", events.StreamPathPrefix+"/123/suspend?untilTime=2021-06-01T10:00:00%2B01:00", nil, mockSubMgr)
+	assert.Equal(204, res.Result().StatusCode)
+	assert.Equal(&events.AutoResumeSpec{Time: "2021-06-01T09:00:00Z"}, mockSubMgr.autoResume)
+}
+
+func TestSuspendStreamUntilBad(t *testing.T) {
+	assert := assert.New(t)
+
+	mockSubMgr := &mockSubMgr{}
+	var errInfo = restErrMsg{}
+	res := testGWPath("POST", events.StreamPathPrefix+"/123/suspend?untilBlock=1&untilTime=2021-06-01T10:00:00Z", &errInfo, mockSubMgr)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Equal("Supply one of a block number or a time to suspend the stream until", errInfo.Message)
+	assert.False(mockSubMgr.suspended)
+}
+
 func TestResumeStream(t *testing.T) {
 	assert := assert.New(t)
 
@@ -2041,86 +2721,448 @@ func TestSuspendNoSubMgr(t *testing.T) {
 	assert.Equal(405, res.Result().StatusCode)
 }
 
-func TestCheckNameAvailableRRDuplicate(t *testing.T) {
+func TestExportDefinitions(t *testing.T) {
 	assert := assert.New(t)
 
-	scgw, _ := NewSmartContractGateway(
-		&SmartContractGatewayConf{
-			BaseURL: "http://localhost/api/v1",
-		},
-		&tx.TxnProcessorConf{
-			OrionPrivateAPIS: false,
+	mockSubMgr := &mockSubMgr{
+		defs: &events.BootstrapConf{
+			Streams: []*events.BootstrapStream{
+				{StreamInfo: events.StreamInfo{Name: "stream1", Type: "websocket"}},
+			},
 		},
-		nil, nil, nil, nil,
-	)
-	rr := &mockRR{
-		deployMsg: newTestDeployMsg(t, "12345"),
 	}
-	s := scgw.(*smartContractGW)
-	s.rr = rr
+	var defs events.BootstrapConf
+	res := testGWPath("GET", events.DefinitionsPath, &defs, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("stream1", defs.Streams[0].Name)
+	assert.False(mockSubMgr.includeHeaders)
 
-	err := s.checkNameAvailable("lobster", true)
-	assert.EqualError(err, "Contract address 12345 is already registered for name 'lobster'")
+	res = testGWPath("GET", events.DefinitionsPath+"?includeHeaders=true", &defs, mockSubMgr)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.True(mockSubMgr.includeHeaders)
 }
 
-func TestCheckNameAvailableRRFail(t *testing.T) {
+func TestExportDefinitionsNoSubMgr(t *testing.T) {
 	assert := assert.New(t)
 
-	scgw, _ := NewSmartContractGateway(
-		&SmartContractGatewayConf{
-			BaseURL: "http://localhost/api/v1",
-		},
-		&tx.TxnProcessorConf{
-			OrionPrivateAPIS: false,
+	res := testGWPath("GET", events.DefinitionsPath, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestImportDefinitions(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := json.Marshal(&events.BootstrapConf{
+		Streams: []*events.BootstrapStream{
+			{StreamInfo: events.StreamInfo{Name: "stream1", Type: "websocket"}},
 		},
-		nil, nil, nil, nil,
-	)
-	rr := &mockRR{
-		err: fmt.Errorf("pop"),
+	})
+	req := httptest.NewRequest("POST", events.DefinitionsPath, bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	mockSubMgr := &mockSubMgr{
+		defs: &events.BootstrapConf{},
 	}
-	s := scgw.(*smartContractGW)
-	s.rr = rr
+	s := &smartContractGW{}
+	s.sm = mockSubMgr
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("stream1", mockSubMgr.importedDefs.Streams[0].Name)
+}
 
-	err := s.checkNameAvailable("lobster", true)
-	assert.EqualError(err, "pop")
+func TestImportDefinitionsBadData(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("POST", events.DefinitionsPath, bytes.NewReader([]byte(":bad json")))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var resError restErrMsg
+	json.NewDecoder(res.Body).Decode(&resError)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Invalid event stream definitions", resError.Message)
 }
 
-func TestWithEventsAuthRequiresAuth(t *testing.T) {
+func TestImportDefinitionsFail(t *testing.T) {
 	assert := assert.New(t)
+	req := httptest.NewRequest("POST", events.DefinitionsPath, bytes.NewReader([]byte(`{"streams":[]}`)))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{err: fmt.Errorf("pop")}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var resError restErrMsg
+	json.NewDecoder(res.Body).Decode(&resError)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Equal("pop", resError.Message)
+}
 
-	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+func TestImportDefinitionsNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
 
-	scgw, _ := NewSmartContractGateway(
-		&SmartContractGatewayConf{
-			BaseURL: "http://localhost/api/v1",
-		},
-		&tx.TxnProcessorConf{
-			OrionPrivateAPIS: false,
-		},
-		nil, nil, nil, nil,
-	)
+	res := testGWPath("POST", events.DefinitionsPath, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
 
-	router := &httprouter.Router{}
+func TestExportStream(t *testing.T) {
+	assert := assert.New(t)
 
-	router.GET("/", scgw.(*smartContractGW).withEventsAuth(
-		func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
-			res.WriteHeader(200)
-		}))
+	sm := &mockSubMgr{
+		migration: &events.StreamMigration{
+			Stream: &events.StreamInfo{ID: "es-123", Suspended: true},
+		},
+	}
+	var m events.StreamMigration
+	res := testGWPath("POST", events.StreamPathPrefix+"/es-123/export?timeoutSec=5", &m, sm)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("es-123", m.Stream.ID)
+	assert.Equal(5*time.Second, sm.exportTimeout)
 
-	req := httptest.NewRequest("GET", "/", bytes.NewReader([]byte{}))
-	res := httptest.NewRecorder()
-	router.ServeHTTP(res, req)
+	res = testGWPath("POST", events.StreamPathPrefix+"/es-123/export?timeoutSec=abc", nil, sm)
+	assert.Equal(400, res.Result().StatusCode)
 
-	assert.Equal(res.Code, 401)
+	res = testGWPath("POST", events.StreamPathPrefix+"/es-123/export", nil, &mockSubMgr{err: fmt.Errorf("pop")})
+	assert.Equal(500, res.Result().StatusCode)
 
-	auth.RegisterSecurityModule(nil)
+	res = testGWPath("POST", events.StreamPathPrefix+"/es-123/export", nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
 }
 
-func TestSendReplyBroadcast(t *testing.T) {
+func TestImportStream(t *testing.T) {
 	assert := assert.New(t)
-	testMessage := "hello world"
-
-	ws := &mockWebSocketServer{
+	b, _ := json.Marshal(&events.StreamMigration{
+		Stream: &events.StreamInfo{ID: "es-123", Type: "websocket"},
+	})
+	req := httptest.NewRequest("POST", events.MigrationPath, bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	mockSubMgr := &mockSubMgr{}
+	s := &smartContractGW{}
+	s.sm = mockSubMgr
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("es-123", mockSubMgr.migration.Stream.ID)
+}
+
+func TestImportStreamBadData(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("POST", events.MigrationPath, bytes.NewReader([]byte(":bad json")))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	var resError restErrMsg
+	json.NewDecoder(res.Body).Decode(&resError)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Invalid event stream migration", resError.Message)
+}
+
+func TestImportStreamFail(t *testing.T) {
+	assert := assert.New(t)
+	req := httptest.NewRequest("POST", events.MigrationPath, bytes.NewReader([]byte(`{"stream":{}}`)))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{}
+	s.sm = &mockSubMgr{err: fmt.Errorf("pop")}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	assert.Equal(400, res.Result().StatusCode)
+
+	res = testGWPath("POST", events.MigrationPath, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestCheckNameAvailableRRDuplicate(t *testing.T) {
+	assert := assert.New(t)
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{
+			OrionPrivateAPIS: false,
+		},
+		nil, nil, nil, nil,
+	)
+	rr := &mockRR{
+		deployMsg: newTestDeployMsg(t, "12345"),
+	}
+	s := scgw.(*smartContractGW)
+	s.rr = rr
+
+	err := s.checkNameAvailable("lobster", true)
+	assert.EqualError(err, "Contract address 12345 is already registered for name 'lobster'")
+}
+
+func TestCheckNameAvailableRRFail(t *testing.T) {
+	assert := assert.New(t)
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{
+			OrionPrivateAPIS: false,
+		},
+		nil, nil, nil, nil,
+	)
+	rr := &mockRR{
+		err: fmt.Errorf("pop"),
+	}
+	s := scgw.(*smartContractGW)
+	s.rr = rr
+
+	err := s.checkNameAvailable("lobster", true)
+	assert.EqualError(err, "pop")
+}
+
+func newTestRenameGW(dir string) (*smartContractGW, *httprouter.Router) {
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL:     "http://localhost/api/v1",
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	scgw.storeContractInfo(&contractInfo{
+		Address:      "0123456789abcdef0123456789abcdef01234567",
+		ABI:          "abi1",
+		Path:         "/contracts/lobster",
+		RegisteredAs: "lobster",
+	})
+	scgw.storeContractInfo(&contractInfo{
+		Address: "123456789abcdef0123456789abcdef012345678",
+		ABI:     "abi1",
+		Path:    "/contracts/123456789abcdef0123456789abcdef012345678",
+	})
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+	return scgw, router
+}
+
+func testRenamePath(router *httprouter.Router, path, body string, results interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", path, bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(results)
+	return res
+}
+
+func TestUpdateContractNameByName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	var info contractInfo
+	res := testRenamePath(router, "/contracts/lobster", `{"registeredAs":"crab"}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("crab", info.RegisteredAs)
+	assert.Equal("/contracts/crab", info.Path)
+	assert.Equal("http://localhost/api/v1/contracts/crab?swagger", info.SwaggerURL)
+	assert.Equal("abi1", info.ABI)
+
+	_, exists := scgw.contractRegistrations["lobster"]
+	assert.False(exists)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", scgw.contractRegistrations["crab"].Address)
+
+	b, err := ioutil.ReadFile(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	assert.NoError(err)
+	var stored contractInfo
+	json.Unmarshal(b, &stored)
+	assert.Equal("crab", stored.RegisteredAs)
+}
+
+func TestUpdateContractNameRemove(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	var info contractInfo
+	res := testRenamePath(router, "/contracts/0x0123456789ABCDEF0123456789ABCDEF01234567", `{"registeredAs":""}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("", info.RegisteredAs)
+	assert.Equal("/contracts/0123456789abcdef0123456789abcdef01234567", info.Path)
+	assert.Empty(scgw.contractRegistrations)
+}
+
+func TestUpdateContractNameUnchanged(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var info contractInfo
+	res := testRenamePath(router, "/contracts/lobster", `{"registeredAs":"lobster"}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("/contracts/lobster", info.Path)
+}
+
+func TestUpdateContractNameClash(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	var errInfo restErrMsg
+	res := testRenamePath(router, "/contracts/123456789abcdef0123456789abcdef012345678", `{"registeredAs":"lobster"}`, &errInfo)
+	assert.Equal(409, res.Result().StatusCode)
+	assert.Equal("Contract address 0123456789abcdef0123456789abcdef01234567 is already registered for name 'lobster'", errInfo.Message)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", scgw.contractRegistrations["lobster"].Address)
+}
+
+func TestUpdateContractNameForce(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	var info contractInfo
+	res := testRenamePath(router, "/contracts/123456789abcdef0123456789abcdef012345678?fly-force", `{"registeredAs":"lobster"}`, &info)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("lobster", info.RegisteredAs)
+	assert.Equal("123456789abcdef0123456789abcdef012345678", scgw.contractRegistrations["lobster"].Address)
+
+	previous := scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.Equal("", previous.RegisteredAs)
+	assert.Equal("/contracts/0123456789abcdef0123456789abcdef01234567", previous.Path)
+	assert.Len(scgw.contractRegistrations, 1)
+}
+
+func TestUpdateContractNameRequiresAdmin(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	testAdminAuthRequired(t, router, "PATCH", "/contracts/lobster", `{"registeredAs":"crab"}`)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", scgw.contractRegistrations["lobster"].Address)
+	assert.NotContains(scgw.contractRegistrations, "crab")
+}
+
+func TestUpdateContractNameNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var errInfo restErrMsg
+	res := testRenamePath(router, "/contracts/unknown", `{"registeredAs":"crab"}`, &errInfo)
+	assert.Equal(404, res.Result().StatusCode)
+}
+
+func TestUpdateContractNameBadBody(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var errInfo restErrMsg
+	res := testRenamePath(router, "/contracts/lobster", `{}`, &errInfo)
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Must supply a 'registeredAs' name", errInfo.Message)
+}
+
+func TestUpdateContractNameWriteFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	scgw, router := newTestRenameGW(dir)
+	cleanup(dir)
+
+	var errInfo restErrMsg
+	res := testRenamePath(router, "/contracts/lobster", `{"registeredAs":"crab"}`, &errInfo)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", scgw.contractRegistrations["lobster"].Address)
+}
+
+func TestUpdateContractNameForceRollback(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	// Writing the un-named version of the current holder of the name will fail
+	previousFile := path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json")
+	os.Remove(previousFile)
+	os.Mkdir(previousFile, 0755)
+
+	var errInfo restErrMsg
+	res := testRenamePath(router, "/contracts/123456789abcdef0123456789abcdef012345678?fly-force", `{"registeredAs":"lobster"}`, &errInfo)
+	assert.Equal(500, res.Result().StatusCode)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", scgw.contractRegistrations["lobster"].Address)
+	assert.Equal("", scgw.contractIndex["123456789abcdef0123456789abcdef012345678"].(*contractInfo).RegisteredAs)
+
+	b, err := ioutil.ReadFile(path.Join(dir, "contract_123456789abcdef0123456789abcdef012345678.instance.json"))
+	assert.NoError(err)
+	var stored contractInfo
+	json.Unmarshal(b, &stored)
+	assert.Equal("", stored.RegisteredAs)
+}
+
+// testAdminAuthRequired checks an admin route rejects a caller without an access token with a 401,
+// and an authenticated caller the security module does not allow to administer the gateway with a 403
+func testAdminAuthRequired(t *testing.T, router *httprouter.Router, method, path, body string) {
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, 401, res.Code, path)
+
+	// The test security module only allows contexts verified from its token
+	ctx := context.WithValue(context.Background(), auth.ContextKeyAuthContext, 12345)
+	req = httptest.NewRequest(method, path, bytes.NewReader([]byte(body))).WithContext(ctx)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, 403, res.Code, path)
+}
+
+func TestWithEventsAuthRequiresAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL: "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{
+			OrionPrivateAPIS: false,
+		},
+		nil, nil, nil, nil,
+	)
+
+	router := &httprouter.Router{}
+
+	router.GET("/", scgw.(*smartContractGW).withEventsAuth(
+		func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+			res.WriteHeader(200)
+		}))
+
+	req := httptest.NewRequest("GET", "/", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(res.Code, 401)
+
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestSendReplyBroadcast(t *testing.T) {
+	assert := assert.New(t)
+	testMessage := "hello world"
+
+	ws := &mockWebSocketServer{
 		testChan: make(chan interface{}),
 	}
 
@@ -2256,3 +3298,877 @@ func TestPublishPreCompiled(t *testing.T) {
 	assert.NotEmpty(deployStash.ABI)
 	assert.NotEmpty(deployStash.Compiled)
 }
+
+func TestPublishPreCompiledErrorFallbackReceive(t *testing.T) {
+	// writes real files and tests end to end
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormField("abi")
+	io.Copy(fw, bytes.NewReader([]byte(`[
+		{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]},
+		{"type":"function","name":"get","inputs":[],"outputs":[],"stateMutability":"view"},
+		{"type":"fallback","stateMutability":"payable"},
+		{"type":"receive","stateMutability":"payable"}
+	]`)))
+	fw, _ = writer.CreateFormField("bytecode")
+	io.Copy(fw, bytes.NewReader([]byte("0x60806040")))
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis", bytes.NewReader(body.Bytes()))
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var info abiInfo
+	json.NewDecoder(res.Body).Decode(&info)
+
+	// The stored ABI round-trips with all of the entries
+	req = httptest.NewRequest("GET", "/abis/"+info.ID+"?abi", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var abi ethbinding.ABIMarshaling
+	json.NewDecoder(res.Body).Decode(&abi)
+	assert.Len(abi, 4)
+	assert.Equal("error", abi[0].Type)
+	assert.Equal("InsufficientBalance", abi[0].Name)
+	assert.Len(abi[0].Inputs, 2)
+	assert.Equal("fallback", abi[2].Type)
+	assert.Equal("receive", abi[3].Type)
+
+	req = httptest.NewRequest("GET", "/abis/"+info.ID+"?swagger", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	var swagger spec.Swagger
+	json.NewDecoder(res.Body).Decode(&swagger)
+	assert.NotNil(swagger.Paths.Paths["/{address}/get"].Get)
+	assert.NotNil(swagger.Paths.Paths["/{address}/fallback"].Post)
+	assert.Nil(swagger.Paths.Paths["/{address}/fallback"].Get)
+	assert.NotNil(swagger.Paths.Paths["/{address}/receive"].Post)
+}
+
+func newTestVerifyCodeGateway(t *testing.T, dir string, rpc eth.RPCClient, verifyCode bool, runtimeBytecode string) (*smartContractGW, *httprouter.Router, string) {
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+			VerifyCode:  verifyCode,
+		},
+		&tx.TxnProcessorConf{},
+		rpc, nil, nil, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormField("abi")
+	io.Copy(fw, bytes.NewReader([]byte(`[{"type":"function","name":"get","inputs":[],"outputs":[]}]`)))
+	fw, _ = writer.CreateFormField("bytecode")
+	io.Copy(fw, bytes.NewReader([]byte("0x60806040")))
+	if runtimeBytecode != "" {
+		fw, _ = writer.CreateFormField("runtimebytecode")
+		io.Copy(fw, bytes.NewReader([]byte(runtimeBytecode)))
+	}
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis", bytes.NewReader(body.Bytes()))
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, 200, res.Code)
+
+	var abi abiInfo
+	json.NewDecoder(res.Body).Decode(&abi)
+	return scgw.(*smartContractGW), router, abi.ID
+}
+
+func TestRegisterContractVerifyCodeOK(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, false, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-verify", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	assert.Equal("eth_getCode", rpc.capturedMethod)
+	assert.Equal("latest", rpc.capturedArgs[1])
+}
+
+func TestRegisterContractVerifyCodeNoCode(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, true, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("No contract code found at address 0x0123456789abcdef0123456789abcdef01234567", resBody["error"])
+}
+
+func TestRegisterContractVerifyCodeDisabledPerRequest(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, true, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-verify=false", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	assert.Empty(rpc.capturedMethod)
+}
+
+func TestRegisterContractVerifyCodeRPCFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{}, mockError: fmt.Errorf("pop")}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, true, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("eth_getCode returned: pop", resBody["error"])
+}
+
+func TestRegisterContractVerifyBytecodeMatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6080")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-verify=bytecode", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+}
+
+func TestRegisterContractVerifyBytecodeMismatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6090")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-verify=bytecode", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("Contract code at address 0x0123456789abcdef0123456789abcdef01234567 does not match the runtime bytecode for ABI '"+abiID+"'", resBody["error"])
+}
+
+func TestRegisterContractVerifyBytecodeNoRuntime(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, false, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-verify=bytecode", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	assert.Empty(rpc.capturedMethod)
+}
+
+func TestRegisterContractVerifyCodeNoRPC(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, nil, true, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+}
+
+func TestRegisterContractInstance(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, router, abiID := newTestVerifyCodeGateway(t, dir, nil, false, "")
+
+	err := scgw.RegisterContractInstance(abiID, "0123456789abcdef0123456789abcdef01234567", "child1")
+	assert.NoError(err)
+
+	// Replaying the same event is a no-op
+	err = scgw.RegisterContractInstance(abiID, "0123456789abcdef0123456789abcdef01234567", "child1")
+	assert.NoError(err)
+
+	// A different address cannot take the same name
+	err = scgw.RegisterContractInstance(abiID, "76543210abcdef0123456789abcdef0123456789", "child1")
+	assert.Regexp("is already registered", err)
+
+	err = scgw.RegisterContractInstance(abiID, "76543210abcdef0123456789abcdef0123456789", "")
+	assert.NoError(err)
+	err = scgw.RegisterContractInstance(abiID, "76543210abcdef0123456789abcdef0123456789", "")
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "/contracts/child1?swagger", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+}
+
+func TestRegisterContractInstanceUnknownABI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, nil, false, "")
+
+	err := scgw.RegisterContractInstance("unknown", "0123456789abcdef0123456789abcdef01234567", "child1")
+	assert.Regexp("No ABI found with ID unknown", err)
+}
+
+func TestRegisterContractMixedCaseAddress(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, router, abiID := newTestVerifyCodeGateway(t, dir, nil, false, "")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0X0123456789ABCDEF0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	var contract contractInfo
+	json.NewDecoder(res.Body).Decode(&contract)
+	assert.Equal("0123456789abcdef0123456789abcdef01234567", contract.Address)
+	_, err := os.Stat(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	assert.NoError(err)
+
+	for _, addr := range []string{"0123456789abcdef0123456789abcdef01234567", "0x0123456789ABCDEF0123456789ABCDEF01234567"} {
+		req = httptest.NewRequest("GET", "/contracts/"+addr+"?swagger", nil)
+		res = httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(200, res.Code)
+	}
+
+	// Programmatic registration of the same address in another form is a no-op
+	err = scgw.RegisterContractInstance(abiID, "0x0123456789ABCDEF0123456789ABCDEF01234567", "")
+	assert.NoError(err)
+	assert.Len(scgw.contractIndex, 1)
+
+	err = scgw.RegisterContractInstance(abiID, "0x0123456789abcdef0123456789abcdef0123456g", "")
+	assert.Regexp("Invalid address", err)
+}
+
+func TestAddToContractIndexNormalizesAddress(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _, abiID := newTestVerifyCodeGateway(t, dir, nil, false, "")
+
+	err := scgw.addToContractIndex(&contractInfo{Address: "0xABCDEF0123456789abcdef0123456789ABCDEF01", ABI: abiID})
+	assert.NoError(err)
+	_, info, err := scgw.loadDeployMsgForInstance("abcdef0123456789abcdef0123456789abcdef01")
+	assert.NoError(err)
+	assert.Equal("abcdef0123456789abcdef0123456789abcdef01", info.Address)
+}
+
+func TestRegisterContractVerifyBytecodeIgnoresMetadata(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80, 0xa1, 0x64, 0x69, 0x70, 0x66, 0x73, 0x02, 0x00, 0x07}}
+	_, router, abiID := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6080a16469706673010007")
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID+"/0x0123456789abcdef0123456789abcdef01234567?fly-verify=bytecode", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+}
+
+func TestBindByFingerprintLocalABI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x90, 0xa1, 0x64, 0x69, 0x70, 0x66, 0x73, 0x01, 0x00, 0x07}}
+	scgw, _, abiID := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6080a16469706673010007")
+
+	deployMsg, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal("get", deployMsg.ABI[0].Name)
+	assert.Equal("eth_getCode", rpc.capturedMethod)
+
+	info := scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.Equal(abiID, info.ABI)
+	_, err = os.Stat(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	assert.NoError(err)
+}
+
+func TestBindByFingerprintNoMatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80, 0xa1, 0x64, 0x69, 0x70, 0x66, 0x73, 0x02, 0x00, 0x07}}
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6080a16469706673010007")
+	scgw.rr = &mockRR{}
+
+	_, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "No contract instance registered with address 0123456789abcdef0123456789abcdef01234567, and no stored ABI matches its bytecode fingerprint")
+	assert.Empty(scgw.contractIndex)
+}
+
+func TestBindByFingerprintRemoteRegistry(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80, 0xa1, 0x64, 0x69, 0x70, 0x66, 0x73, 0x02, 0x00, 0x07}}
+	scgw, _, localABI := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6080a16469706673010007")
+	var abi ethbinding.ABIMarshaling
+	json.Unmarshal([]byte(`[{"type":"function","name":"remote","inputs":[],"outputs":[]}]`), &abi)
+	rr := &mockRR{
+		deployMsg: &deployContractWithAddress{
+			DeployContract: messages.DeployContract{
+				ContractName: "remote",
+				ABI:          abi,
+			},
+		},
+	}
+	scgw.rr = rr
+
+	deployMsg, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.NoError(err)
+	assert.Equal("remote", deployMsg.ABI[0].Name)
+	assert.Equal("a1646970667302", rr.lookupCapture)
+
+	info := scgw.contractIndex["0123456789abcdef0123456789abcdef01234567"].(*contractInfo)
+	assert.NotEqual(localABI, info.ABI)
+	assert.Len(scgw.listABIIDs(), 2)
+}
+
+func TestBindByFingerprintRemoteRegistryFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80, 0xa1, 0x64, 0x69, 0x70, 0x66, 0x73, 0x02, 0x00, 0x07}}
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, rpc, false, "")
+	scgw.rr = &mockRR{err: fmt.Errorf("pop")}
+
+	_, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "pop")
+}
+
+func TestBindByFingerprintNoMetadata(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, rpc, false, "0x6080")
+
+	_, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "No contract instance registered with address 0123456789abcdef0123456789abcdef01234567, and the contract code has no compiler metadata to fingerprint")
+}
+
+func TestBindByFingerprintNoCode(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{}}
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, rpc, false, "")
+
+	_, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "No contract code found at address 0x0123456789abcdef0123456789abcdef01234567")
+}
+
+func TestBindByFingerprintRPCFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{}, mockError: fmt.Errorf("pop")}
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, rpc, false, "")
+
+	_, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "eth_getCode returned: pop")
+}
+
+func TestBindByFingerprintNoRPC(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, _, _ := newTestVerifyCodeGateway(t, dir, nil, false, "")
+
+	_, err := scgw.bindByFingerprint(context.Background(), "0123456789abcdef0123456789abcdef01234567")
+	assert.EqualError(err, "Bytecode fingerprinting is not available without a JSON/RPC connection")
+}
+
+func TestDeployContractAsyncOmitsRuntimeBytecode(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw, router, abiID := newTestVerifyCodeGateway(t, dir, nil, false, "0x6080")
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	scgw.r2e.asyncDispatcher = dispatcher
+
+	req := httptest.NewRequest("POST", "/abis/"+abiID, bytes.NewReader([]byte("{}")))
+	req.Header.Add("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Code)
+	assert.NotEmpty(dispatcher.asyncDispatchMsg["compiled"])
+	assert.NotContains(dispatcher.asyncDispatchMsg, "compiledRuntime")
+
+	// The stored copy still has the runtime bytecode for verification
+	deployMsg, _, err := scgw.loadDeployMsgByID(abiID)
+	assert.NoError(err)
+	assert.Equal([]byte{0x60, 0x80}, deployMsg.CompiledRuntime)
+}
+
+func newTestGatewayRegistration(t *testing.T, dir string, rpc eth.RPCClient, rr *mockRR) *httprouter.Router {
+	scgw, router, _ := newTestVerifyCodeGateway(t, dir, rpc, false, "")
+	scgw.rr = rr
+	return router
+}
+
+func TestRegisterGatewayInstance(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	rr := &mockRR{
+		deployMsg:  &deployContractWithAddress{},
+		noInstance: true,
+	}
+	router := newTestGatewayRegistration(t, dir, rpc, rr)
+
+	req := httptest.NewRequest("POST", "/gateways/gw1/0x0123456789ABCDEF0123456789abcdef01234567?fly-register=inst1&fly-verify", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(201, res.Code)
+	assert.Equal("gw1", rr.idCapture)
+	assert.Equal("inst1", rr.lookupCapture)
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", rr.addrCapture)
+	assert.Equal("eth_getCode", rpc.capturedMethod)
+	var ci remoteContractInfo
+	json.NewDecoder(res.Body).Decode(&ci)
+	assert.Equal("inst1", ci.ID)
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", ci.Address)
+}
+
+func TestRegisterGatewayInstanceVerifyNoCode(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{}}
+	rr := &mockRR{
+		deployMsg:  &deployContractWithAddress{},
+		noInstance: true,
+	}
+	router := newTestGatewayRegistration(t, dir, rpc, rr)
+
+	req := httptest.NewRequest("POST", "/g/gw1/0x0123456789abcdef0123456789abcdef01234567?fly-register=inst1&fly-verify", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	assert.Empty(rr.lookupCapture)
+}
+
+func TestRegisterGatewayInstanceVerifyBytecodeUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rpc := &mockRPC{result: ethbinding.HexBytes{0x60, 0x80}}
+	rr := &mockRR{
+		deployMsg:  &deployContractWithAddress{},
+		noInstance: true,
+	}
+	router := newTestGatewayRegistration(t, dir, rpc, rr)
+
+	req := httptest.NewRequest("POST", "/g/gw1/0x0123456789abcdef0123456789abcdef01234567?fly-register=inst1&fly-verify=bytecode", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("Runtime bytecode is not available for ABI 'gw1' to verify against", resBody["error"])
+}
+
+func TestRegisterGatewayInstanceMissingName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rr := &mockRR{deployMsg: &deployContractWithAddress{}}
+	router := newTestGatewayRegistration(t, dir, nil, rr)
+
+	req := httptest.NewRequest("POST", "/gateways/gw1/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var resBody map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("Must supply a fly-register name for the instance when registering with a gateway", resBody["error"])
+}
+
+func TestRegisterGatewayInstanceBadAddress(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	router := newTestGatewayRegistration(t, dir, nil, &mockRR{})
+
+	req := httptest.NewRequest("POST", "/gateways/gw1/badness?fly-register=inst1", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+}
+
+func TestRegisterGatewayInstanceGatewayNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	router := newTestGatewayRegistration(t, dir, nil, &mockRR{})
+
+	req := httptest.NewRequest("POST", "/gateways/gw1/0x0123456789abcdef0123456789abcdef01234567?fly-register=inst1", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+}
+
+func TestRegisterGatewayInstanceGatewayLookupFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	router := newTestGatewayRegistration(t, dir, nil, &mockRR{err: fmt.Errorf("pop")})
+
+	req := httptest.NewRequest("POST", "/gateways/gw1/0x0123456789abcdef0123456789abcdef01234567?fly-register=inst1", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(500, res.Code)
+}
+
+func TestRegisterGatewayInstanceNameClash(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	rr := &mockRR{deployMsg: &deployContractWithAddress{Address: "0x76543210abcdef0123456789abcdef0123456789"}}
+	router := newTestGatewayRegistration(t, dir, nil, rr)
+
+	req := httptest.NewRequest("POST", "/gateways/gw1/0x0123456789abcdef0123456789abcdef01234567?fly-register=inst1", bytes.NewReader([]byte{}))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(409, res.Code)
+	assert.Empty(rr.lookupCapture)
+}
+
+func TestCreateSubscriptionNoSubMgr(t *testing.T) {
+	assert := assert.New(t)
+	res := testGWPath("POST", events.SubPathPrefix, nil, nil)
+	assert.Equal(405, res.Result().StatusCode)
+}
+
+func TestCreateSubscriptionBySignature(t *testing.T) {
+	assert := assert.New(t)
+	sm := &mockSubMgr{
+		sub: &events.SubscriptionInfo{Name: "transfers"},
+	}
+	b, _ := json.Marshal(&signatureSubscription{
+		Stream:    "stream1",
+		Signature: "Transfer(address,address,uint256)",
+		Address:   "0x567A417717cb6c59ddc1035705f02c0fd1ab1872",
+		FromBlock: "0",
+		Name:      "transfers",
+	})
+	var sub events.SubscriptionInfo
+	res := testGWPathBody("POST", events.SubPathPrefix, &sub, sm, bytes.NewReader(b))
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("transfers", sub.Name)
+	assert.Equal("0x567A417717cb6C59DdC1035705f02c0fD1ab1872", sm.capturedAddr.Hex())
+	assert.Equal("Transfer", sm.capturedEvent.Name)
+	assert.Len(sm.capturedEvent.Inputs, 3)
+}
+
+func TestCreateSubscriptionAnyAddress(t *testing.T) {
+	assert := assert.New(t)
+	sm := &mockSubMgr{}
+	b, _ := json.Marshal(&signatureSubscription{
+		Stream:    "stream1",
+		Signature: "event Approval(address indexed owner, address indexed spender, uint256 value)",
+	})
+	res := testGWPathBody("POST", events.SubPathPrefix, nil, sm, bytes.NewReader(b))
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Nil(sm.capturedAddr)
+	assert.True(sm.capturedEvent.Inputs[0].Indexed)
+	assert.Equal("spender", sm.capturedEvent.Inputs[1].Name)
+}
+
+func TestCreateSubscriptionRegisteredName(t *testing.T) {
+	assert := assert.New(t)
+	sm := &mockSubMgr{}
+	b, _ := json.Marshal(&signatureSubscription{
+		Stream:    "stream1",
+		Signature: "Transfer(address,address,uint256)",
+		Address:   "myToken",
+	})
+	req := httptest.NewRequest("POST", events.SubPathPrefix, bytes.NewReader(b))
+	res := httptest.NewRecorder()
+	s := &smartContractGW{
+		sm: sm,
+		contractRegistrations: map[string]*contractInfo{
+			"myToken": {Address: "2b8c0ecc76d0759a8f50b2e14a6881367d805832"},
+		},
+	}
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	r.ServeHTTP(res, req)
+	assert.Equal(200, res.Result().StatusCode)
+	assert.Equal("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", sm.capturedAddr.Hex())
+}
+
+func TestCreateSubscriptionBadAddress(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := json.Marshal(&signatureSubscription{
+		Stream:    "stream1",
+		Signature: "Transfer(address,address,uint256)",
+		Address:   "unknown",
+	})
+	var resError restErrMsg
+	res := testGWPathBody("POST", events.SubPathPrefix, &resError, &mockSubMgr{}, bytes.NewReader(b))
+	assert.Equal(404, res.Result().StatusCode)
+	assert.Equal("Invalid contract address or registered name 'unknown'", resError.Message)
+}
+
+func TestCreateSubscriptionBadData(t *testing.T) {
+	assert := assert.New(t)
+	var resError restErrMsg
+	res := testGWPathBody("POST", events.SubPathPrefix, &resError, &mockSubMgr{}, bytes.NewReader([]byte(":bad json")))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Invalid subscription request", resError.Message)
+}
+
+func TestCreateSubscriptionMissingStream(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := json.Marshal(&signatureSubscription{
+		Signature: "Transfer(address,address,uint256)",
+	})
+	var resError restErrMsg
+	res := testGWPathBody("POST", events.SubPathPrefix, &resError, &mockSubMgr{}, bytes.NewReader(b))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("stream", resError.Message)
+}
+
+func TestCreateSubscriptionBadSignature(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := json.Marshal(&signatureSubscription{
+		Stream:    "stream1",
+		Signature: "Transfer",
+	})
+	var resError restErrMsg
+	res := testGWPathBody("POST", events.SubPathPrefix, &resError, &mockSubMgr{}, bytes.NewReader(b))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Regexp("Invalid event signature 'Transfer'", resError.Message)
+}
+
+func TestCreateSubscriptionSubMgrError(t *testing.T) {
+	assert := assert.New(t)
+	b, _ := json.Marshal(&signatureSubscription{
+		Stream:    "stream1",
+		Signature: "Transfer(address,address,uint256)",
+	})
+	var resError restErrMsg
+	res := testGWPathBody("POST", events.SubPathPrefix, &resError, &mockSubMgr{err: fmt.Errorf("pop")}, bytes.NewReader(b))
+	assert.Equal(400, res.Result().StatusCode)
+	assert.Equal("pop", resError.Message)
+}
+
+func TestResolveAddressName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	s, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, nil, nil,
+	)
+	scgw := s.(*smartContractGW)
+	scgw.contractRegistrations["lobster"] = &contractInfo{Address: "0123456789abcdef0123456789abcdef01234567"}
+	scgw.signerAliases["treasury"] = &signerAlias{Alias: "treasury", From: "hd-treasury-0"}
+
+	addr, ok := scgw.ResolveAddressName("lobster")
+	assert.True(ok)
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", addr)
+	addr, ok = scgw.ResolveAddressName("treasury")
+	assert.True(ok)
+	assert.Equal("hd-treasury-0", addr)
+	_, ok = scgw.ResolveAddressName("crab")
+	assert.False(ok)
+}
+
+func newTestInvokeGateway(t *testing.T, dir string, dispatcher *mockREST2EthDispatcher) *smartContractGW {
+	scgw, _ := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			StoragePath: dir,
+			BaseURL:     "http://localhost/api/v1",
+		},
+		&tx.TxnProcessorConf{},
+		nil, nil, dispatcher, nil,
+	)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fw, _ := writer.CreateFormField("abi")
+	io.Copy(fw, bytes.NewReader([]byte(`[
+		{"type":"function","name":"set","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[]},
+		{"type":"function","name":"get","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]}
+	]`)))
+	fw, _ = writer.CreateFormField("bytecode")
+	io.Copy(fw, bytes.NewReader([]byte("0x60806040")))
+	writer.Close()
+	req := httptest.NewRequest("POST", "/abis", bytes.NewReader(body.Bytes()))
+	req.Header.Add("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, 200, res.Code)
+
+	var abi abiInfo
+	json.NewDecoder(res.Body).Decode(&abi)
+	err := scgw.(*smartContractGW).RegisterContractInstance(abi.ID, "0123456789abcdef0123456789abcdef01234567", "target1")
+	assert.NoError(t, err)
+	return scgw.(*smartContractGW)
+}
+
+func TestInvokeContractMethod(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "req1"},
+	}
+	scgw := newTestInvokeGateway(t, dir, dispatcher)
+
+	requestID, err := scgw.InvokeContractMethod(context.Background(), "target1", "set", "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c", map[string]interface{}{
+		"to":     "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c",
+		"amount": json.Number("12345"),
+	})
+	assert.NoError(err)
+	assert.Equal("req1", requestID)
+	assert.True(dispatcher.asyncDispatchAck)
+	assert.Equal("SendTransaction", dispatcher.asyncDispatchMsg["headers"].(map[string]interface{})["type"])
+	assert.Equal("0x0123456789abcdef0123456789abcdef01234567", dispatcher.asyncDispatchMsg["to"])
+	assert.Equal("0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c", dispatcher.asyncDispatchMsg["from"])
+	assert.Equal([]interface{}{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", json.Number("12345")}, dispatcher.asyncDispatchMsg["params"])
+
+	_, err = scgw.InvokeContractMethod(context.Background(), "0x0123456789ABCDEF0123456789abcdef01234567", "set", "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c", map[string]interface{}{
+		"to":     "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c",
+		"amount": 1,
+	})
+	assert.NoError(err)
+}
+
+func TestAuthorizeInvocation(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	scgw := newTestInvokeGateway(t, dir, &mockREST2EthDispatcher{})
+	from := "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"
+
+	assert.NoError(scgw.AuthorizeInvocation(context.Background(), "target1", from))
+	assert.Regexp("unknown", scgw.AuthorizeInvocation(context.Background(), "unknown", from))
+	assert.Regexp("From Address must be a 40 character hex string", scgw.AuthorizeInvocation(context.Background(), "target1", "badfrom"))
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	ctx, _ := auth.WithAuthContext(context.Background(), "testat")
+	assert.EqualError(scgw.AuthorizeInvocation(ctx, "target1", from), "badness")
+	assert.Regexp("No auth context", scgw.AuthorizeInvocation(context.Background(), "target1", from))
+	assert.NoError(scgw.AuthorizeInvocation(auth.NewSystemAuthContext(), "target1", from))
+}
+
+func TestInvokeContractMethodErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchError: fmt.Errorf("pop"),
+	}
+	scgw := newTestInvokeGateway(t, dir, dispatcher)
+	from := "0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c"
+	params := map[string]interface{}{"to": from, "amount": 1}
+
+	_, err := scgw.InvokeContractMethod(context.Background(), "unknown", "set", from, params)
+	assert.Regexp("unknown", err)
+	_, err = scgw.InvokeContractMethod(context.Background(), "target1", "missing", from, params)
+	assert.Regexp("Method or Event 'missing' is not declared", err)
+	_, err = scgw.InvokeContractMethod(context.Background(), "target1", "get", from, params)
+	assert.Regexp("view or pure method", err)
+	_, err = scgw.InvokeContractMethod(context.Background(), "target1", "set", "badfrom", params)
+	assert.Regexp("From Address must be a 40 character hex string", err)
+	_, err = scgw.InvokeContractMethod(context.Background(), "target1", "set", from, map[string]interface{}{"to": from})
+	assert.Regexp("Parameter 'amount' of method 'set' was not specified", err)
+	_, err = scgw.InvokeContractMethod(context.Background(), "target1", "set", from, params)
+	assert.EqualError(err, "pop")
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+)
+
+// storageReadResult is the response to a GET of /storage/:address/:slot
+type storageReadResult struct {
+	Address     string `json:"address"`
+	Slot        string `json:"slot"`
+	BlockNumber string `json:"blockNumber"`
+	Value       string `json:"value"`
+}
+
+// storageHandler reads the raw value of a storage slot of a contract, for inspecting
+// contracts that do not have a getter for the value - such as the implementation
+// address of a proxy. The address can also be the registered name of a contract
+func (r *rest2eth) storageHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	addrParam := params.ByName("address")
+	addr, ok := normalizeAddress(addrParam)
+	if !ok {
+		var err error
+		if addr, err = r.gw.resolveContractAddr(addrParam); err != nil {
+			r.restErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayStorageInvalidAddress, addrParam), 404)
+			return
+		}
+	}
+
+	slot, err := eth.StorageSlot(params.ByName("slot"))
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+
+	rpcTimeout, err := r.rpcTimeout(req)
+	if err != nil {
+		r.restErrReply(res, req, err, 400)
+		return
+	}
+	if rpcTimeout > 0 {
+		req = req.WithContext(eth.WithRPCTimeout(req.Context(), rpcTimeout))
+	}
+
+	blocknumber, err := eth.BlockNumberForCall(req.Context(), r.rpc, getFlyParam("blocknumber", req, false))
+	if err != nil {
+		r.restErrReply(res, req, err, callBlockErrStatus(err))
+		return
+	}
+	if blocknumber == "" {
+		blocknumber = "latest"
+	}
+	ethAddr := ethbind.API.HexToAddress("0x" + addr)
+	value, err := eth.GetStorageAt(req.Context(), r.rpc, &ethAddr, slot, blocknumber)
+	if err != nil {
+		r.restErrReply(res, req, err, 500)
+		return
+	}
+
+	resBytes, _ := json.MarshalIndent(&storageReadResult{
+		Address:     "0x" + addr,
+		Slot:        slot,
+		BlockNumber: blocknumber,
+		Value:       value,
+	}, "", "  ")
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	log.Debugf("<-- %s", resBytes)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(resBytes)
+}
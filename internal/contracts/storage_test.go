@@ -0,0 +1,122 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStorageValue = "0x000000000000000000000000567a417717cb6c59ddc1035705f02c0fd1ab1872"
+
+func newTestStorageRead(abiLoader *mockABILoader, rpcResult interface{}, rpcErr error, path string) (*mockRPC, *httptest.ResponseRecorder) {
+	dispatcher := &mockREST2EthDispatcher{}
+	_, mockRPC, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	mockRPC.result = rpcResult
+	mockRPC.mockError = rpcErr
+	req := httptest.NewRequest("GET", path, nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return mockRPC, res
+}
+
+func TestStorageRead(t *testing.T) {
+	assert := assert.New(t)
+
+	slot := "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"
+	mockRPC, res := newTestStorageRead(&mockABILoader{}, testStorageValue, nil,
+		"/storage/0x2B8c0ECc76d0759a8F50b2E14A6881367D805832/"+slot+"?fly-blocknumber=12345")
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply storageReadResult
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal(storageReadResult{
+		Address:     "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+		Slot:        slot,
+		BlockNumber: "12345",
+		Value:       testStorageValue,
+	}, reply)
+	assert.Equal("eth_getStorageAt", mockRPC.capturedMethod)
+	assert.Equal(slot, mockRPC.capturedArgs[1])
+	assert.Equal("0x3039", mockRPC.capturedArgs[2])
+}
+
+func TestStorageReadRegisteredName(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC, res := newTestStorageRead(&mockABILoader{
+		registeredContractAddr: "2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+	}, testStorageValue, nil, "/storage/myProxy/1")
+
+	assert.Equal(200, res.Result().StatusCode)
+	var reply storageReadResult
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", reply.Address)
+	assert.Equal("0x1", reply.Slot)
+	assert.Equal("latest", reply.BlockNumber)
+	assert.Equal("latest", mockRPC.capturedArgs[2])
+}
+
+func TestStorageReadUnknownName(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC, res := newTestStorageRead(&mockABILoader{
+		resolveContractErr: fmt.Errorf("pop"),
+	}, testStorageValue, nil, "/storage/myProxy/1")
+
+	assert.Equal(404, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("Invalid contract address or registered name 'myProxy'", reply.Message)
+	assert.Empty(mockRPC.capturedMethod)
+}
+
+func TestStorageReadBadSlot(t *testing.T) {
+	assert := assert.New(t)
+
+	mockRPC, res := newTestStorageRead(&mockABILoader{}, testStorageValue, nil,
+		"/storage/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/badness")
+
+	assert.Equal(400, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Regexp("Invalid storage slot 'badness'", reply.Message)
+	assert.Empty(mockRPC.capturedMethod)
+}
+
+func TestStorageReadBadRPCTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	_, res := newTestStorageRead(&mockABILoader{}, testStorageValue, nil,
+		"/storage/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/0?fly-rpctimeout=-1")
+
+	assert.Equal(400, res.Result().StatusCode)
+}
+
+func TestStorageReadRPCError(t *testing.T) {
+	assert := assert.New(t)
+
+	_, res := newTestStorageRead(&mockABILoader{}, testStorageValue, fmt.Errorf("pop"),
+		"/storage/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/0?fly-rpctimeout=5")
+
+	assert.Equal(500, res.Result().StatusCode)
+	var reply restErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("eth_getStorageAt returned: pop", reply.Message)
+}
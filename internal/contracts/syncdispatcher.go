@@ -91,6 +91,7 @@ func (t *syncTxInflight) Reply(replyMessage messages.ReplyWithHeaders) {
 	replyHeaders.ID = utils.UUIDv4()
 	replyHeaders.Context = headers.Context
 	replyHeaders.ReqID = headers.ID
+	replyHeaders.SchemaVersion = messages.ReplySchemaVersion
 	replyHeaders.Received = t.timeReceived.UTC().Format(time.RFC3339Nano)
 	replyTime := time.Now().UTC()
 	replyHeaders.Elapsed = replyTime.Sub(t.timeReceived).Seconds()
@@ -39,6 +39,18 @@ func (p *mockProcessor) ResolveAddress(from string) (resolvedFrom string, err er
 	return p.resolvedFrom, p.err
 }
 
+func (p *mockProcessor) InFlightStatus() map[string][]*tx.InFlightTxnStatus {
+	return nil
+}
+func (p *mockProcessor) NonceReport(ctx context.Context, addresses []string) ([]*tx.NonceReport, error) {
+	return nil, nil
+}
+func (p *mockProcessor) ResumeTransaction(txnContext tx.TxnContext, txHash string, nonce int64) {}
+func (p *mockProcessor) SetAddressNameResolver(resolver tx.AddressNameResolver)                 {}
+func (p *mockProcessor) SetMethodChecker(checker tx.MethodChecker)                              {}
+func (p *mockProcessor) SetSignerPolicy(policy tx.SignerPolicy)                                 {}
+func (p *mockProcessor) Close()                                                                 {}
+
 func (p *mockProcessor) OnMessage(c tx.TxnContext) {
 	p.headers = c.Headers()
 	ctx := c.(*syncTxInflight)
@@ -0,0 +1,381 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	log "github.com/sirupsen/logrus"
+)
+
+// txPolicy is the governance of gas, gas price and value for the transactions sent to a
+// stored ABI, or a registered contract instance. Defaults are used when a request omits the
+// field, and maximums are enforced when it supplies one. It also sets the default format of
+// the integer outputs of calls, for consumers that expect JSON numbers, the Safe multisig
+// that transactions are proposed to, for contracts owned by one, and the signer backends that
+// transactions can select, the first of which is used when a request selects none
+type txPolicy struct {
+	DefaultGas      json.Number `json:"defaultGas,omitempty"`
+	MaxGas          json.Number `json:"maxGas,omitempty"`
+	DefaultGasPrice json.Number `json:"defaultGasPrice,omitempty"`
+	MaxGasPrice     json.Number `json:"maxGasPrice,omitempty"`
+	DefaultValue    json.Number `json:"defaultValue,omitempty"`
+	MaxValue        json.Number `json:"maxValue,omitempty"`
+	Numbers         string      `json:"numbers,omitempty"` // string, number or hex
+	Safe            string      `json:"safe,omitempty"`
+	Signers         []string    `json:"signers,omitempty"`
+}
+
+// txPolicyField is one of the governed fields, with its default and maximum
+type txPolicyField struct {
+	name    string
+	val     *json.Number
+	def     json.Number
+	max     json.Number
+	defName string
+	maxName string
+}
+
+func (p *txPolicy) fields(msg *messages.TransactionCommon) []txPolicyField {
+	if msg == nil {
+		msg = &messages.TransactionCommon{}
+	}
+	return []txPolicyField{
+		{"gas", &msg.Gas, p.DefaultGas, p.MaxGas, "defaultGas", "maxGas"},
+		{"gasPrice", &msg.GasPrice, p.DefaultGasPrice, p.MaxGasPrice, "defaultGasPrice", "maxGasPrice"},
+		{"value", &msg.Value, p.DefaultValue, p.MaxValue, "defaultValue", "maxValue"},
+	}
+}
+
+func parsePolicyNumber(n json.Number) (*big.Int, bool) {
+	i, ok := new(big.Int).SetString(n.String(), 10)
+	return i, ok && i.Sign() >= 0
+}
+
+// validate checks each default and maximum is an integer, that no default exceeds its maximum,
+// that the number format is supported, that the Safe is an address, and the signers exist
+func (p *txPolicy) validate() error {
+	for _, f := range p.fields(nil) {
+		var def, max *big.Int
+		var ok bool
+		if f.def != "" {
+			if def, ok = parsePolicyNumber(f.def); !ok {
+				return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicyBadNumber, f.defName, f.def)
+			}
+		}
+		if f.max != "" {
+			if max, ok = parsePolicyNumber(f.max); !ok {
+				return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicyBadNumber, f.maxName, f.max)
+			}
+		}
+		if def != nil && max != nil && def.Cmp(max) > 0 {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicyDefaultExceedsMax, f.name, f.def, f.max)
+		}
+	}
+	if p.Safe != "" {
+		if _, ok := normalizeAddress(p.Safe); !ok {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySafeInvalidAddress, p.Safe)
+		}
+	}
+	for _, signer := range p.Signers {
+		if !tx.IsSignerBackend(signer) {
+			return ethconnecterrors.Errorf(ethconnecterrors.SignerBackendUnknown, signer, strings.Join(tx.SignerBackends, ", "))
+		}
+	}
+	return eth.ValidateNumberFormat(p.Numbers)
+}
+
+// overriddenBy returns the policy with any fields set in the override replacing its own,
+// so a contract instance can tighten or relax individual fields of the policy of its ABI
+func (p *txPolicy) overriddenBy(override *txPolicy) *txPolicy {
+	if p == nil {
+		return override
+	}
+	if override == nil {
+		return p
+	}
+	merged := *p
+	for _, f := range []struct{ to, from *json.Number }{
+		{&merged.DefaultGas, &override.DefaultGas},
+		{&merged.MaxGas, &override.MaxGas},
+		{&merged.DefaultGasPrice, &override.DefaultGasPrice},
+		{&merged.MaxGasPrice, &override.MaxGasPrice},
+		{&merged.DefaultValue, &override.DefaultValue},
+		{&merged.MaxValue, &override.MaxValue},
+	} {
+		if *f.from != "" {
+			*f.to = *f.from
+		}
+	}
+	if override.Numbers != "" {
+		merged.Numbers = override.Numbers
+	}
+	if override.Safe != "" {
+		merged.Safe = override.Safe
+	}
+	if len(override.Signers) > 0 {
+		merged.Signers = override.Signers
+	}
+	return &merged
+}
+
+// apply sets the defaults on a transaction for any fields it omits, then checks the maximums.
+// Values that are not valid integers are left for the transaction processing to reject
+func (p *txPolicy) apply(msg *messages.TransactionCommon) error {
+	if p == nil {
+		return nil
+	}
+	for _, f := range p.fields(msg) {
+		if *f.val == "" {
+			*f.val = f.def
+		}
+		if f.max == "" || *f.val == "" {
+			continue
+		}
+		val, ok := new(big.Int).SetString(f.val.String(), 10)
+		max, _ := new(big.Int).SetString(f.max.String(), 10)
+		if ok && max != nil && val.Cmp(max) > 0 {
+			return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicyMaxExceeded, f.name, *f.val, f.max)
+		}
+	}
+	if err := p.applySigner(msg); err != nil {
+		return err
+	}
+	// Gas that is estimated when the transaction is sent is also capped at the maximum,
+	// unless the message already has a lower cap of its own
+	if p.MaxGas != "" {
+		msgMax, ok := new(big.Int).SetString(msg.MaxGas.String(), 10)
+		max, _ := new(big.Int).SetString(p.MaxGas.String(), 10)
+		if !ok || (max != nil && msgMax.Cmp(max) > 0) {
+			msg.MaxGas = p.MaxGas
+		}
+	}
+	return nil
+}
+
+// applySigner selects the first signer backend of the policy for a transaction that does not
+// select one, and checks the one selected is allowed
+func (p *txPolicy) applySigner(msg *messages.TransactionCommon) error {
+	if p == nil || len(p.Signers) == 0 {
+		return nil
+	}
+	if msg.Signer == "" {
+		msg.Signer = p.Signers[0]
+		return nil
+	}
+	for _, signer := range p.Signers {
+		if msg.Signer == signer {
+			return nil
+		}
+	}
+	return ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicySignerNotAllowed, msg.Signer, strings.Join(p.Signers, ", "))
+}
+
+// checkSigner returns the signer backend a transaction that selected the one supplied uses under
+// the policy, or an error if the policy does not allow it
+func (p *txPolicy) checkSigner(signer string) (string, error) {
+	msg := &messages.TransactionCommon{Signer: signer}
+	err := p.applySigner(msg)
+	return msg.Signer, err
+}
+
+// CheckSigner selects the signer backend of a transaction to a contract from its policy, and checks
+// the one it selected is allowed. The transaction processor calls this for every transaction it
+// sends to a contract, whichever path it was submitted through
+func (g *smartContractGW) CheckSigner(to, signer string) (string, error) {
+	addrHexNo0x, ok := normalizeAddress(to)
+	if !ok {
+		return signer, nil
+	}
+	return g.txPolicyFor("", addrHexNo0x).checkSigner(signer)
+}
+
+// CheckSigner applies the signer backends of the policies of the contract instances and ABIs in
+// the storage path of a gateway, for a Kafka bridge that consumes transactions without them passing
+// through the gateway. The policies are read for each check, so changes on the gateway apply immediately
+func (c *storedMethodChecker) CheckSigner(to, signer string) (string, error) {
+	addrHexNo0x, ok := normalizeAddress(to)
+	if !ok {
+		return signer, nil
+	}
+	infoBytes, err := c.files.readFile(c.files.path("contract_" + addrHexNo0x + ".instance.json"))
+	if os.IsNotExist(err) {
+		return signer, nil
+	}
+	var info contractInfo
+	if err == nil {
+		err = json.Unmarshal(infoBytes, &info)
+	}
+	if err != nil {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractLoad, addrHexNo0x)
+	}
+	var abiPolicy *txPolicy
+	policyBytes, err := c.files.readFile(c.files.path("abi_" + info.ABI + ".policy.json"))
+	if err == nil {
+		abiPolicy = &txPolicy{}
+		err = json.Unmarshal(policyBytes, abiPolicy)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicyLoad, info.ABI, err)
+	}
+	return abiPolicy.overriddenBy(info.Policy).checkSigner(signer)
+}
+
+// txPolicyFor returns the policy for a transaction to a contract, combining the policy of its
+// ABI with that of the instance. The ABI of a registered instance is used if none is supplied
+func (g *smartContractGW) txPolicyFor(abiID, addrHexNo0x string) *txPolicy {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	var instancePolicy *txPolicy
+	if ts, exists := g.contractIndex[addrHexNo0x]; exists {
+		info := ts.(*contractInfo)
+		instancePolicy = info.Policy
+		if abiID == "" {
+			abiID = info.ABI
+		}
+	}
+	var policy *txPolicy
+	if ts, exists := g.abiIndex[abiID]; exists {
+		policy = ts.(*abiInfo).Policy
+	}
+	return policy.overriddenBy(instancePolicy)
+}
+
+// setTxPolicy sets the gas, gas price and value policy of a stored ABI or a registered
+// contract instance, replacing any existing policy. An empty policy removes it
+func (g *smartContractGW) setTxPolicy(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var policy txPolicy
+	if err := json.NewDecoder(req.Body).Decode(&policy); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicyInvalid, err), 400)
+		return
+	}
+	if err := policy.validate(); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	if len(policy.Signers) == 0 {
+		policy.Signers = nil
+	}
+	newPolicy := &policy
+	if reflect.DeepEqual(policy, txPolicy{}) {
+		newPolicy = nil
+	}
+
+	var updated interface{}
+	var err error
+	status := 404
+	if abiID := params.ByName("abi"); abiID != "" {
+		updated, status, err = g.setABITxPolicy(strings.ToLower(abiID), newPolicy)
+	} else {
+		id := params.ByName("address")
+		addrHexNo0x, _ := normalizeAddress(id)
+		g.idxLock.Lock()
+		if _, exists := g.contractIndex[addrHexNo0x]; !exists {
+			addrHexNo0x, err = g.resolveContractAddr(id)
+		}
+		g.idxLock.Unlock()
+		if err == nil {
+			updated, status, err = g.setContractTxPolicy(addrHexNo0x, newPolicy)
+		}
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, err, status)
+		return
+	}
+
+	status = 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(updated)
+}
+
+// setABITxPolicy stores the policy of an ABI alongside its deployment details
+func (g *smartContractGW) setABITxPolicy(abiID string, policy *txPolicy) (*abiInfo, int, error) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	ts, exists := g.abiIndex[abiID]
+	if !exists {
+		return nil, 404, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreABINotFound, abiID)
+	}
+	policyFile := g.files.path("abi_" + abiID + ".policy.json")
+	if policy == nil {
+		if err := g.files.removeFile(policyFile); err != nil {
+			return nil, 500, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicySave, err)
+		}
+	} else {
+		policyBytes, _ := json.MarshalIndent(policy, "", "  ")
+		log.Infof("%s: Storing transaction policy to '%s'", abiID, policyFile)
+		if err := g.files.writeFile(policyFile, policyBytes); err != nil {
+			return nil, 500, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayTxPolicySave, err)
+		}
+	}
+	updated := *ts.(*abiInfo)
+	updated.Policy = policy
+	g.abiIndex[abiID] = &updated
+	return &updated, 200, nil
+}
+
+// setContractTxPolicy stores the policy of a contract instance in its instance file
+func (g *smartContractGW) setContractTxPolicy(addrHexNo0x string, policy *txPolicy) (*contractInfo, int, error) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	ts, exists := g.contractIndex[addrHexNo0x]
+	if !exists {
+		return nil, 404, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x)
+	}
+	updated := *ts.(*contractInfo)
+	updated.Policy = policy
+	if err := g.writeContractInfo(&updated); err != nil {
+		return nil, 500, err
+	}
+	if updated.RegisteredAs != "" {
+		g.contractRegistrations[updated.RegisteredAs] = &updated
+	}
+	g.contractIndex[addrHexNo0x] = &updated
+	return &updated, 200, nil
+}
+
+// loadABITxPolicy loads any policy stored alongside the deployment details of an ABI
+func (g *smartContractGW) loadABITxPolicy(info *abiInfo) {
+	policyFile := g.files.path("abi_" + info.ID + ".policy.json")
+	policyBytes, err := g.files.readFile(policyFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Failed to load transaction policy file %s: %s", policyFile, err)
+		}
+		return
+	}
+	var policy txPolicy
+	if err = json.Unmarshal(policyBytes, &policy); err != nil {
+		log.Errorf("Failed to parse transaction policy file %s: %s", policyFile, err)
+		return
+	}
+	info.Policy = &policy
+}
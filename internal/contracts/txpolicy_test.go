@@ -0,0 +1,380 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPolicyPath(router *httprouter.Router, path, body string, results interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", path, bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(results)
+	return res
+}
+
+func TestTxPolicyValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&txPolicy{}).validate())
+	assert.NoError((&txPolicy{DefaultGas: "100000", MaxGas: "100000", MaxValue: "0"}).validate())
+
+	err := (&txPolicy{DefaultGas: "lots"}).validate()
+	assert.EqualError(err, "The defaultGas of the transaction policy must be a non-negative integer: 'lots'")
+
+	err = (&txPolicy{MaxGasPrice: "-1"}).validate()
+	assert.EqualError(err, "The maxGasPrice of the transaction policy must be a non-negative integer: '-1'")
+
+	err = (&txPolicy{DefaultValue: "11", MaxValue: "10"}).validate()
+	assert.EqualError(err, "The default value of 11 exceeds the maximum of 10")
+
+	assert.NoError((&txPolicy{Numbers: "number"}).validate())
+	err = (&txPolicy{Numbers: "float"}).validate()
+	assert.EqualError(err, "Invalid number format 'float'. Must be 'string', 'number' or 'hex'")
+
+	assert.NoError((&txPolicy{Safe: "0x5afe5afe5afe5afe5afe5afe5afe5afe5afe5afe"}).validate())
+	err = (&txPolicy{Safe: "0x5afe"}).validate()
+	assert.EqualError(err, "Invalid Safe address '0x5afe'")
+
+	assert.NoError((&txPolicy{Signers: []string{"hdwallet", "node"}}).validate())
+	err = (&txPolicy{Signers: []string{"kms"}}).validate()
+	assert.EqualError(err, "Unknown signer 'kms'. Must be one of: node, hdwallet")
+}
+
+func TestTxPolicyOverriddenBy(t *testing.T) {
+	assert := assert.New(t)
+
+	var nilPolicy *txPolicy
+	assert.Nil(nilPolicy.overriddenBy(nil))
+
+	abiPolicy := &txPolicy{DefaultGas: "100000", MaxGas: "200000"}
+	assert.Equal(abiPolicy, abiPolicy.overriddenBy(nil))
+	assert.Equal(abiPolicy, nilPolicy.overriddenBy(abiPolicy))
+
+	merged := abiPolicy.overriddenBy(&txPolicy{MaxGas: "300000", MaxValue: "0", Numbers: "hex", Safe: "0x5afe5afe5afe5afe5afe5afe5afe5afe5afe5afe"})
+	assert.Equal(&txPolicy{DefaultGas: "100000", MaxGas: "300000", MaxValue: "0", Numbers: "hex", Safe: "0x5afe5afe5afe5afe5afe5afe5afe5afe5afe5afe"}, merged)
+	assert.Equal(json.Number("200000"), abiPolicy.MaxGas)
+}
+
+func TestTxPolicyApply(t *testing.T) {
+	assert := assert.New(t)
+
+	var nilPolicy *txPolicy
+	msg := &messages.TransactionCommon{}
+	assert.NoError(nilPolicy.apply(msg))
+	assert.Equal(json.Number(""), msg.Gas)
+
+	policy := &txPolicy{
+		DefaultGas:      "100000",
+		MaxGas:          "200000",
+		DefaultGasPrice: "0",
+		MaxValue:        "1000",
+	}
+	msg = &messages.TransactionCommon{Value: "10"}
+	assert.NoError(policy.apply(msg))
+	assert.Equal(json.Number("100000"), msg.Gas)
+	assert.Equal(json.Number("0"), msg.GasPrice)
+	assert.Equal(json.Number("10"), msg.Value)
+	assert.Equal(json.Number("200000"), msg.MaxGas)
+
+	msg = &messages.TransactionCommon{MaxGas: "150000"}
+	assert.NoError(policy.apply(msg))
+	assert.Equal(json.Number("150000"), msg.MaxGas)
+
+	msg = &messages.TransactionCommon{Gas: "200001"}
+	err := policy.apply(msg)
+	assert.EqualError(err, "The gas of 200001 exceeds the maximum of 200000 allowed by the transaction policy")
+
+	msg = &messages.TransactionCommon{Value: "1001"}
+	err = policy.apply(msg)
+	assert.EqualError(err, "The value of 1001 exceeds the maximum of 1000 allowed by the transaction policy")
+
+	msg = &messages.TransactionCommon{Gas: "0x1"}
+	assert.NoError(policy.apply(msg))
+	assert.Equal(json.Number("0x1"), msg.Gas)
+}
+
+func TestTxPolicyApplySigner(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := &messages.TransactionCommon{Signer: "node"}
+	assert.NoError((&txPolicy{}).apply(msg))
+	assert.Equal("node", msg.Signer)
+
+	policy := &txPolicy{Signers: []string{"hdwallet", "node"}}
+	msg = &messages.TransactionCommon{}
+	assert.NoError(policy.apply(msg))
+	assert.Equal("hdwallet", msg.Signer)
+
+	msg = &messages.TransactionCommon{Signer: "node"}
+	assert.NoError(policy.apply(msg))
+	assert.Equal("node", msg.Signer)
+
+	policy = &txPolicy{Signers: []string{"hdwallet"}}
+	msg = &messages.TransactionCommon{Signer: "node"}
+	err := policy.apply(msg)
+	assert.EqualError(err, "The 'node' signer is not allowed by the transaction policy. Allowed: hdwallet")
+
+	merged := (&txPolicy{Signers: []string{"node"}}).overriddenBy(&txPolicy{MaxGas: "1"})
+	assert.Equal([]string{"node"}, merged.Signers)
+	merged = merged.overriddenBy(&txPolicy{Signers: []string{"hdwallet"}})
+	assert.Equal([]string{"hdwallet"}, merged.Signers)
+}
+
+func TestCheckSigner(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+	scgw.addToABIIndex("abi1", &messages.DeployContract{}, time.Now().UTC())
+
+	var info abiInfo
+	res := testPolicyPath(router, "/abis/abi1/policy", `{"signers":["kms","keystore"]}`, &info)
+	assert.Equal(200, res.Code)
+	var instance contractInfo
+	res = testPolicyPath(router, "/contracts/123456789abcdef0123456789abcdef012345678/policy", `{"signers":["hdwallet"]}`, &instance)
+	assert.Equal(200, res.Code)
+
+	checker, err := NewStoredMethodChecker(dir)
+	assert.NoError(err)
+	stored, ok := checker.(tx.SignerPolicy)
+	assert.True(ok)
+
+	// The gateway and a Kafka bridge using its storage path apply the same policies
+	for _, policy := range []tx.SignerPolicy{scgw, stored} {
+		signer, err := policy.CheckSigner("0x0123456789abcdef0123456789abcdef01234567", "")
+		assert.NoError(err)
+		assert.Equal("kms", signer)
+
+		signer, err = policy.CheckSigner("0x0123456789ABCDEF0123456789abcdef01234567", "keystore")
+		assert.NoError(err)
+		assert.Equal("keystore", signer)
+
+		_, err = policy.CheckSigner("0x0123456789abcdef0123456789abcdef01234567", "node")
+		assert.EqualError(err, "The 'node' signer is not allowed by the transaction policy. Allowed: kms, keystore")
+
+		signer, err = policy.CheckSigner("0x123456789abcdef0123456789abcdef012345678", "")
+		assert.NoError(err)
+		assert.Equal("hdwallet", signer)
+
+		signer, err = policy.CheckSigner("0x23456789abcdef0123456789abcdef0123456789", "node")
+		assert.NoError(err)
+		assert.Equal("node", signer)
+
+		signer, err = policy.CheckSigner("", "")
+		assert.NoError(err)
+		assert.Equal("", signer)
+	}
+}
+
+func TestStoredCheckSignerBadFiles(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	newTestRenameGW(dir)
+
+	checker, err := NewStoredMethodChecker(dir)
+	assert.NoError(err)
+	stored := checker.(tx.SignerPolicy)
+
+	ioutil.WriteFile(path.Join(dir, "abi_abi1.policy.json"), []byte("!json"), 0644)
+	_, err = stored.CheckSigner("0x0123456789abcdef0123456789abcdef01234567", "")
+	assert.Regexp("Failed to load transaction policy of ABI abi1", err)
+
+	ioutil.WriteFile(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"), []byte("!json"), 0644)
+	_, err = stored.CheckSigner("0x0123456789abcdef0123456789abcdef01234567", "")
+	assert.Error(err)
+}
+
+func TestSetContractTxPolicyByName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+
+	var info contractInfo
+	res := testPolicyPath(router, "/contracts/lobster/policy", `{"defaultGas":"100000","maxValue":"0"}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Equal(&txPolicy{DefaultGas: "100000", MaxValue: "0"}, info.Policy)
+	assert.Equal("lobster", info.RegisteredAs)
+
+	var stored contractInfo
+	b, err := ioutil.ReadFile(path.Join(dir, "contract_0123456789abcdef0123456789abcdef01234567.instance.json"))
+	assert.NoError(err)
+	json.Unmarshal(b, &stored)
+	assert.Equal(info.Policy, stored.Policy)
+	assert.Equal(info.Policy, scgw.contractRegistrations["lobster"].Policy)
+	assert.Equal(info.Policy, scgw.txPolicyFor("", "0123456789abcdef0123456789abcdef01234567"))
+
+	info = contractInfo{}
+	res = testPolicyPath(router, "/contracts/0x0123456789abcdef0123456789abcdef01234567/policy", `{}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Nil(info.Policy)
+	assert.Nil(scgw.txPolicyFor("", "0123456789abcdef0123456789abcdef01234567"))
+}
+
+func TestSetContractTxPolicyNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var errReply restErrMsg
+	res := testPolicyPath(router, "/contracts/shrimp/policy", `{"maxGas":"1"}`, &errReply)
+	assert.Equal(404, res.Code)
+}
+
+func TestSetContractTxPolicyBadData(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var errReply restErrMsg
+	res := testPolicyPath(router, "/contracts/lobster/policy", `!json`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid transaction policy", errReply.Message)
+
+	res = testPolicyPath(router, "/contracts/lobster/policy", `{"defaultGas":"10","maxGas":"1"}`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Equal("The default gas of 10 exceeds the maximum of 1", errReply.Message)
+}
+
+func TestSetABITxPolicy(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+	scgw.addToABIIndex("abi1", &messages.DeployContract{}, time.Now().UTC())
+
+	var info abiInfo
+	res := testPolicyPath(router, "/abis/ABI1/policy", `{"defaultGas":"100000","maxGas":"200000"}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Equal(&txPolicy{DefaultGas: "100000", MaxGas: "200000"}, info.Policy)
+
+	policyFile := path.Join(dir, "abi_abi1.policy.json")
+	_, err := os.Stat(policyFile)
+	assert.NoError(err)
+
+	loaded := &abiInfo{}
+	loaded.ID = "abi1"
+	scgw.loadABITxPolicy(loaded)
+	assert.Equal(info.Policy, loaded.Policy)
+
+	// The instance policy overrides individual fields of the ABI policy
+	scgw.setContractTxPolicy("0123456789abcdef0123456789abcdef01234567", &txPolicy{MaxGas: "300000"})
+	assert.Equal(&txPolicy{DefaultGas: "100000", MaxGas: "300000"}, scgw.txPolicyFor("", "0123456789abcdef0123456789abcdef01234567"))
+	assert.Equal(info.Policy, scgw.txPolicyFor("", "123456789abcdef0123456789abcdef012345678"))
+	assert.Equal(info.Policy, scgw.txPolicyFor("abi1", ""))
+
+	info = abiInfo{}
+	res = testPolicyPath(router, "/abis/abi1/policy", `{}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Nil(info.Policy)
+	_, err = os.Stat(policyFile)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestSetTxPolicyRequiresAdmin(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+	scgw.addToABIIndex("abi1", &messages.DeployContract{}, time.Now().UTC())
+
+	testAdminAuthRequired(t, router, "PUT", "/contracts/lobster/policy", `{"maxValue":"1000"}`)
+	testAdminAuthRequired(t, router, "PUT", "/abis/abi1/policy", `{"maxGas":"1"}`)
+	assert.Nil(scgw.txPolicyFor("abi1", "0123456789abcdef0123456789abcdef01234567"))
+}
+
+func TestSetABITxPolicyNotFound(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router := newTestRenameGW(dir)
+
+	var errReply restErrMsg
+	res := testPolicyPath(router, "/abis/abi2/policy", `{"maxGas":"1"}`, &errReply)
+	assert.Equal(404, res.Code)
+}
+
+func TestSetABITxPolicyWriteFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	scgw, router := newTestRenameGW(dir)
+	scgw.addToABIIndex("abi1", &messages.DeployContract{}, time.Now().UTC())
+	scgw.conf.StoragePath = path.Join(dir, "badpath")
+
+	var errReply restErrMsg
+	res := testPolicyPath(router, "/abis/abi1/policy", `{"maxGas":"1"}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Regexp("Failed to write transaction policy", errReply.Message)
+}
+
+func TestSendTransactionTxPolicyDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.txPolicy = &txPolicy{DefaultGas: "100000", DefaultGasPrice: "0"}
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{
+			Sent:    true,
+			Request: "request1",
+		},
+	}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(202, res.Code)
+	assert.Equal(json.Number("100000"), dispatcher.asyncDispatchMsg["gas"])
+	assert.Equal(json.Number("0"), dispatcher.asyncDispatchMsg["gasPrice"])
+}
+
+func TestSendTransactionTxPolicyMaxExceeded(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	abiLoader.txPolicy = &txPolicy{MaxGas: "100000"}
+	dispatcher := &mockREST2EthDispatcher{}
+	_, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872"}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	req.Header.Set("x-firefly-gas", "100001")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(400, res.Code)
+	var errReply restErrMsg
+	json.NewDecoder(res.Body).Decode(&errReply)
+	assert.Equal("The gas of 100001 exceeds the maximum of 100000 allowed by the transaction policy", errReply.Message)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+}
@@ -0,0 +1,412 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// erc1967ImplementationSlot is the storage slot an ERC-1967 proxy holds the address of its implementation in
+const erc1967ImplementationSlot = "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"
+
+// upgradeABI is the upgrade function of a UUPS (ERC-1822) implementation, invoked through the proxy.
+// OpenZeppelin 5.x only has upgradeToAndCall, which is used when data is supplied - even if empty
+var upgradeABI = ethbinding.ABIMarshaling{
+	{
+		Type: "function", Name: "upgradeTo", StateMutability: "nonpayable",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "newImplementation", Type: "address"}},
+	},
+	{
+		Type: "function", Name: "upgradeToAndCall", StateMutability: "payable",
+		Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "newImplementation", Type: "address"}, {Name: "data", Type: "bytes"}},
+	},
+}
+
+// contractUpgradeRequest is the body of a PUT to /contracts/:address/upgrade. Params are the
+// constructor parameters of the new implementation, by name. Data is the calldata of a call
+// the proxy makes to the new implementation as part of the upgrade, such as to a reinitializer
+type contractUpgradeRequest struct {
+	ABI    string                 `json:"abi"`
+	Params map[string]interface{} `json:"params,omitempty"`
+	Data   *string                `json:"data,omitempty"`
+}
+
+// contractUpgrade is the audit record of an upgrade, kept with the contract instance
+type contractUpgrade struct {
+	Time                   string `json:"time"`
+	From                   string `json:"from"`
+	PreviousABI            string `json:"previousABI"`
+	ABI                    string `json:"abi"`
+	PreviousImplementation string `json:"previousImplementation"`
+	Implementation         string `json:"implementation"`
+	DeployTransactionHash  string `json:"deployTransactionHash"`
+	UpgradeTransactionHash string `json:"upgradeTransactionHash"`
+	Partial                bool   `json:"partial,omitempty"`
+	Error                  string `json:"error,omitempty"`
+}
+
+// detachedContext keeps the values of the request context, such as the auth context, but is
+// not cancelled when the caller disconnects
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+// upgradeReply is the result of a transaction submitted during an upgrade
+type upgradeReply struct {
+	receipt *messages.TransactionReceipt
+	msgType string
+	err     error
+}
+
+// upgradeReplyWaiter receives the reply to each transaction of an upgrade, which are submitted
+// in turn. It is buffered so a reply arriving after the request has gone away is dropped
+type upgradeReplyWaiter chan *upgradeReply
+
+func (w upgradeReplyWaiter) ReplyWithError(err error) {
+	w <- &upgradeReply{err: err}
+}
+
+func (w upgradeReplyWaiter) ReplyWithReceipt(receipt messages.ReplyWithHeaders) {
+	w <- &upgradeReply{receipt: receipt.IsReceipt(), msgType: receipt.ReplyHeaders().MsgType}
+}
+
+func (w upgradeReplyWaiter) ReplyWithReceiptAndError(receipt messages.ReplyWithHeaders, err error) {
+	w <- &upgradeReply{receipt: receipt.IsReceipt(), msgType: receipt.ReplyHeaders().MsgType, err: err}
+}
+
+// wait returns the receipt of a successful transaction, or an error describing why it failed
+func (w upgradeReplyWaiter) wait(ctx context.Context) (*messages.TransactionReceipt, error) {
+	select {
+	case reply := <-w:
+		if reply.err != nil {
+			return nil, reply.err
+		}
+		if reply.receipt == nil || reply.receipt.TransactionHash == nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeUnexpectedReply, reply.msgType)
+		}
+		if reply.msgType != messages.MsgTypeTransactionSuccess {
+			detail := reply.msgType
+			if reply.receipt.RevertReason != "" {
+				detail = reply.receipt.RevertReason
+			}
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewaySyncWrapErrorWithTXDetail, reply.receipt.TransactionHash.Hex(), detail)
+		}
+		return reply.receipt, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// implementationFromSlot returns the address held in the ERC-1967 implementation slot, or an
+// empty string if the slot is empty
+func implementationFromSlot(value string) string {
+	v := strings.TrimPrefix(strings.ToLower(value), "0x")
+	if len(v) < 40 || strings.Trim(v, "0") == "" {
+		return ""
+	}
+	return "0x" + v[len(v)-40:]
+}
+
+func (g *smartContractGW) readImplementation(ctx context.Context, addrHexNo0x string) (string, error) {
+	addr := ethbind.API.HexToAddress("0x" + addrHexNo0x)
+	value, err := eth.GetStorageAt(ctx, g.rpc, &addr, erc1967ImplementationSlot, "latest")
+	if err != nil {
+		return "", err
+	}
+	return implementationFromSlot(value), nil
+}
+
+// upgradeConstructorParams orders the named constructor parameters of the new implementation
+func upgradeConstructorParams(deployMsg *messages.DeployContract, params map[string]interface{}) ([]interface{}, error) {
+	for _, element := range deployMsg.ABI {
+		if element.Type != "constructor" {
+			continue
+		}
+		method, err := eth.ABIMethodFor(&element)
+		if err != nil {
+			return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMethodABIInvalid, "constructor", err)
+		}
+		msgParams := make([]interface{}, len(method.Inputs))
+		for i, input := range method.Inputs {
+			argName := abiInputName(i, input)
+			v, exists := params[argName]
+			if !exists {
+				return nil, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayMissingParameter, argName, "constructor")
+			}
+			msgParams[i] = v
+		}
+		return msgParams, nil
+	}
+	return []interface{}{}, nil
+}
+
+// upgradeContract upgrades an ERC-1967 proxy that is registered with the gateway to a new
+// implementation, as a single operation. The implementation is deployed from a stored ABI,
+// the upgrade function of the proxy is invoked, and the implementation slot of the proxy is
+// read back to verify it. The proxy is then bound to the new ABI, and the upgrade recorded
+// in the audit trail of the contract instance. The transactions are submitted synchronously
+func (g *smartContractGW) upgradeContract(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	var upgradeReq contractUpgradeRequest
+	if err := json.NewDecoder(req.Body).Decode(&upgradeReq); err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeInvalid, err), 400)
+		return
+	}
+	if upgradeReq.ABI == "" {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeABIRequired), 400)
+		return
+	}
+	abiID := strings.ToLower(upgradeReq.ABI)
+	var upgradeData string
+	if upgradeReq.Data != nil {
+		if _, err := hex.DecodeString(strings.TrimPrefix(*upgradeReq.Data, "0x")); err != nil {
+			g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.TransactionSendBadCalldata, err), 400)
+			return
+		}
+		upgradeData = "0x" + strings.TrimPrefix(*upgradeReq.Data, "0x")
+	}
+
+	id := params.ByName("address")
+	addrHexNo0x, ok := normalizeAddress(id)
+	var err error
+	if !ok {
+		if addrHexNo0x, err = g.resolveContractAddr(id); err != nil {
+			g.gatewayErrReply(res, req, err, 404)
+			return
+		}
+	}
+	_, info, err := g.loadDeployMsgForInstance(addrHexNo0x)
+	if info == nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	deployMsg, _, err := g.loadDeployMsgByID(abiID)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	if len(deployMsg.Compiled) == 0 {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeNotDeployable, abiID), 400)
+		return
+	}
+	msgParams, err := upgradeConstructorParams(deployMsg, upgradeReq.Params)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+	from, err := g.r2e.resolveFrom(getFlyParam("from", req, false))
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 404)
+		return
+	}
+	if from == "" {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeFromRequired, utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")), 400)
+		return
+	}
+	if g.rpc == nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeUnavailable), 500)
+		return
+	}
+
+	// The upgrade function is checked against the method filter and Safe policy of the proxy,
+	// and the policy is applied to the upgrade transaction, before anything is deployed
+	msg := &messages.SendTransaction{}
+	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.To = "0x" + addrHexNo0x
+	msg.From = from
+	msg.Gas = json.Number(getFlyParam("gas", req, false))
+	msg.GasPrice = json.Number(getFlyParam("gasprice", req, false))
+	msg.Value = json.Number(getFlyParam("ethvalue", req, false))
+	msg.Signer = strings.ToLower(getFlyParam("signer", req, false))
+	if upgradeReq.Data != nil {
+		msg.Method = &upgradeABI[1]
+	} else {
+		msg.Method = &upgradeABI[0]
+	}
+	if err := g.methodFilterFor(addrHexNo0x).check(msg.Method.Name, addrHexNo0x); err != nil {
+		g.gatewayErrReply(res, req, err, 403)
+		return
+	}
+	proxyPolicy := g.txPolicyFor("", addrHexNo0x)
+	safe := getFlyParam("safe", req, false)
+	if safe == "" && proxyPolicy != nil {
+		safe = proxyPolicy.Safe
+	}
+	if safe != "" {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeSafe, addrHexNo0x, safe, msg.Method.Name), 400)
+		return
+	}
+	if err := proxyPolicy.apply(&msg.TransactionCommon); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	previousImpl, err := g.readImplementation(req.Context(), addrHexNo0x)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, 500)
+		return
+	}
+	if previousImpl == "" {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeNotProxy, addrHexNo0x), 400)
+		return
+	}
+
+	// Deploy the new implementation, keeping the runtime bytecode to verify against
+	compiledRuntime := deployMsg.CompiledRuntime
+	deployMsg.Headers.MsgType = messages.MsgTypeDeployContract
+	deployMsg.Headers.ID = ""
+	deployMsg.CompiledRuntime = nil
+	deployMsg.CompilerWarnings = nil
+	deployMsg.From = from
+	deployMsg.GasPrice = json.Number(getFlyParam("gasprice", req, false))
+	deployMsg.Parameters = msgParams
+	deployMsg.Signer = strings.ToLower(getFlyParam("signer", req, false))
+	if err := g.txPolicyFor(abiID, "").apply(&deployMsg.TransactionCommon); err != nil {
+		g.gatewayErrReply(res, req, err, 400)
+		return
+	}
+
+	// Once the first transaction is submitted the upgrade runs to completion, and is recorded,
+	// even if the caller disconnects
+	ctx := detachedContext{req.Context()}
+	waiter := make(upgradeReplyWaiter, 1)
+	g.r2e.syncDispatcher.DispatchDeployContractSync(ctx, deployMsg, waiter)
+	deployReceipt, err := waiter.wait(ctx)
+	if err == nil && deployReceipt.ContractAddress == nil {
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayPostDeployMissingAddress, deployReceipt.Headers.ReqID)
+	}
+	if err != nil {
+		g.gatewayErrReply(res, req, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeDeployFailed, err), 500)
+		return
+	}
+	newImpl := strings.ToLower(deployReceipt.ContractAddress.Hex())
+	upgrade := &contractUpgrade{
+		Time:                   time.Now().UTC().Format(time.RFC3339),
+		From:                   from,
+		PreviousABI:            info.ABI,
+		ABI:                    abiID,
+		PreviousImplementation: previousImpl,
+		Implementation:         newImpl,
+		DeployTransactionHash:  deployReceipt.TransactionHash.Hex(),
+	}
+	code, err := eth.GetCode(ctx, g.rpc, deployReceipt.ContractAddress, "latest")
+	if err == nil && len(code) == 0 {
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationNoCode, newImpl[2:])
+	}
+	if err == nil && len(compiledRuntime) > 0 && !eth.RuntimeBytecodeMatches(code, compiledRuntime) {
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayRegistrationCodeMismatch, newImpl[2:], abiID)
+	}
+	if err != nil {
+		g.upgradeFailed(res, req, addrHexNo0x, upgrade, err)
+		return
+	}
+	log.Infof("Deployed implementation %s of ABI %s to upgrade proxy 0x%s", newImpl, abiID, addrHexNo0x)
+
+	// Point the proxy at the new implementation
+	if upgradeReq.Data != nil {
+		msg.Parameters = []interface{}{newImpl, upgradeData}
+	} else {
+		msg.Parameters = []interface{}{newImpl}
+	}
+	waiter = make(upgradeReplyWaiter, 1)
+	g.r2e.syncDispatcher.DispatchSendTransactionSync(ctx, msg, waiter)
+	upgradeReceipt, err := waiter.wait(ctx)
+	if err != nil {
+		g.upgradeFailed(res, req, addrHexNo0x, upgrade, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeTxFailed, addrHexNo0x, newImpl, err))
+		return
+	}
+	upgrade.UpgradeTransactionHash = upgradeReceipt.TransactionHash.Hex()
+	currentImpl, err := g.readImplementation(ctx, addrHexNo0x)
+	if err == nil && currentImpl != newImpl {
+		err = ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayUpgradeNotVerified, addrHexNo0x, currentImpl, newImpl)
+	}
+	if err != nil {
+		g.upgradeFailed(res, req, addrHexNo0x, upgrade, err)
+		return
+	}
+
+	updated, status, err := g.bindUpgradedContract(addrHexNo0x, upgrade)
+	if err != nil {
+		g.gatewayErrReply(res, req, err, status)
+		return
+	}
+	log.Infof("Upgraded proxy 0x%s from implementation %s (ABI %s) to %s (ABI %s) in transaction %s",
+		addrHexNo0x, previousImpl, upgrade.PreviousABI, newImpl, abiID, upgrade.UpgradeTransactionHash)
+
+	status = 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	enc := json.NewEncoder(res)
+	enc.SetIndent("", "  ")
+	enc.Encode(updated)
+}
+
+// upgradeFailed records an upgrade that failed after the new implementation was deployed as a
+// partial upgrade, so the audit trail has every implementation deployed and transaction sent
+func (g *smartContractGW) upgradeFailed(res http.ResponseWriter, req *http.Request, addrHexNo0x string, upgrade *contractUpgrade, err error) {
+	upgrade.Partial = true
+	upgrade.Error = err.Error()
+	if _, _, recordErr := g.bindUpgradedContract(addrHexNo0x, upgrade); recordErr != nil {
+		log.Errorf("Failed to record partial upgrade of proxy 0x%s: %s", addrHexNo0x, recordErr)
+	}
+	g.gatewayErrReply(res, req, err, 500)
+}
+
+// bindUpgradedContract binds a contract instance to the ABI of its new implementation, and adds
+// the upgrade to the audit trail in its instance file. A partial upgrade is only added to the
+// audit trail, leaving the instance bound to its previous ABI
+func (g *smartContractGW) bindUpgradedContract(addrHexNo0x string, upgrade *contractUpgrade) (*contractInfo, int, error) {
+	g.idxLock.Lock()
+	defer g.idxLock.Unlock()
+	ts, exists := g.contractIndex[addrHexNo0x]
+	if !exists {
+		return nil, 404, ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayLocalStoreContractNotFound, addrHexNo0x)
+	}
+	updated := *ts.(*contractInfo)
+	if !upgrade.Partial {
+		updated.ABI = upgrade.ABI
+	}
+	updated.Upgrades = append(append([]*contractUpgrade{}, updated.Upgrades...), upgrade)
+	if err := g.writeContractInfo(&updated); err != nil {
+		return nil, 500, err
+	}
+	if updated.RegisteredAs != "" {
+		g.contractRegistrations[updated.RegisteredAs] = &updated
+	}
+	g.contractIndex[addrHexNo0x] = &updated
+	return &updated, 200, nil
+}
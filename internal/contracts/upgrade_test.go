@@ -0,0 +1,404 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testUpgradeProxy    = "0123456789abcdef0123456789abcdef01234567"
+	testUpgradeOldImpl  = "0x1111111111111111111111111111111111111111"
+	testUpgradeNewImpl  = "0x2222222222222222222222222222222222222222"
+	testUpgradeFrom     = "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"
+	testUpgradeDeployTx = "0x02587104e9879911bea3d5bf6ccd7e1a6cb9a03145b8a1141804cebd6aa67c5c"
+	testUpgradeTx       = "0x7dd3d3a3e7e7bcd4cbfd6c1f1f0b1e6a3b0d84dd7c69dbb2f1e7e4d3a7f8c9b0"
+)
+
+// mockUpgradeRPC returns the implementation slot values in turn, and the same code for any address
+type mockUpgradeRPC struct {
+	slots []string
+	code  ethbinding.HexBytes
+	err   error
+	calls []string
+}
+
+func (m *mockUpgradeRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	m.calls = append(m.calls, method)
+	if m.err != nil {
+		return m.err
+	}
+	switch method {
+	case "eth_getStorageAt":
+		*(result.(*string)) = m.slots[0]
+		if len(m.slots) > 1 {
+			m.slots = m.slots[1:]
+		}
+	case "eth_getCode":
+		*(result.(*ethbinding.HexBytes)) = m.code
+	}
+	return nil
+}
+
+func testUpgradeSlot(addr string) string {
+	return "0x000000000000000000000000" + addr[2:]
+}
+
+func testUpgradeReceipt(msgType, txHash string, contractAddr *ethbinding.Address) *messages.TransactionReceipt {
+	hash := ethbind.API.HexToHash(txHash)
+	receipt := &messages.TransactionReceipt{
+		ContractAddress: contractAddr,
+		TransactionHash: &hash,
+	}
+	receipt.Headers.MsgType = msgType
+	return receipt
+}
+
+func newTestUpgradeGW(t *testing.T, dir string, rpc eth.RPCClient) (*smartContractGW, *httprouter.Router, *mockREST2EthDispatcher) {
+	s, err := NewSmartContractGateway(
+		&SmartContractGatewayConf{
+			BaseURL:     "http://localhost/api/v1",
+			StoragePath: dir,
+		},
+		&tx.TxnProcessorConf{},
+		rpc, nil, nil, nil,
+	)
+	assert.NoError(t, err)
+	scgw := s.(*smartContractGW)
+	router := &httprouter.Router{}
+	scgw.AddRoutes(router)
+
+	for abiID, deployMsg := range map[string]*messages.DeployContract{
+		"abi1": {ContractName: "LobsterV1", ABI: ethbinding.ABIMarshaling{}, Compiled: []byte{0x60, 0x80}},
+		"abi2": {
+			ContractName: "LobsterV2",
+			ABI: ethbinding.ABIMarshaling{
+				{Type: "constructor", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "owner", Type: "address"}}},
+			},
+			Compiled:        []byte{0x60, 0x80},
+			CompiledRuntime: []byte{0x60, 0x80},
+		},
+		"abi3": {ContractName: "Interface", ABI: ethbinding.ABIMarshaling{}},
+	} {
+		scgw.writeAbiInfo(abiID, deployMsg)
+		scgw.addToABIIndex(abiID, deployMsg, time.Now().UTC())
+	}
+	_, err = scgw.storeNewContractInfo(testUpgradeProxy, "abi1", "lobster", "lobster", methodFilter{})
+	assert.NoError(t, err)
+
+	newImpl := ethbind.API.HexToAddress(testUpgradeNewImpl)
+	dispatcher := &mockREST2EthDispatcher{
+		deployContractSyncReceipt:  testUpgradeReceipt(messages.MsgTypeTransactionSuccess, testUpgradeDeployTx, &newImpl),
+		sendTransactionSyncReceipt: testUpgradeReceipt(messages.MsgTypeTransactionSuccess, testUpgradeTx, nil),
+	}
+	scgw.r2e.syncDispatcher = dispatcher
+	return scgw, router, dispatcher
+}
+
+func testUpgradePath(router *httprouter.Router, path, body string, results interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", path, bytes.NewReader([]byte(body)))
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	json.NewDecoder(res.Body).Decode(results)
+	return res
+}
+
+func TestUpgradeContract(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{
+		slots: []string{testUpgradeSlot(testUpgradeOldImpl), testUpgradeSlot(testUpgradeNewImpl)},
+		code:  ethbinding.HexBytes{0x60, 0x80},
+	}
+	scgw, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+
+	var info contractInfo
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom,
+		`{"abi":"ABI2","params":{"owner":"`+testUpgradeFrom+`"}}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Equal("abi2", info.ABI)
+	assert.Equal("lobster", info.RegisteredAs)
+	assert.Len(info.Upgrades, 1)
+	upgrade := info.Upgrades[0]
+	assert.Equal(testUpgradeFrom, upgrade.From)
+	assert.Equal("abi1", upgrade.PreviousABI)
+	assert.Equal("abi2", upgrade.ABI)
+	assert.Equal(testUpgradeOldImpl, upgrade.PreviousImplementation)
+	assert.Equal(testUpgradeNewImpl, upgrade.Implementation)
+	assert.Equal(testUpgradeDeployTx, upgrade.DeployTransactionHash)
+	assert.Equal(testUpgradeTx, upgrade.UpgradeTransactionHash)
+	assert.Equal([]string{"eth_getStorageAt", "eth_getCode", "eth_getStorageAt"}, rpc.calls)
+
+	assert.Equal(messages.MsgTypeDeployContract, dispatcher.deployContractMsg.Headers.MsgType)
+	assert.Equal(testUpgradeFrom, dispatcher.deployContractMsg.From)
+	assert.Equal([]interface{}{testUpgradeFrom}, dispatcher.deployContractMsg.Parameters)
+	assert.Nil(dispatcher.deployContractMsg.CompiledRuntime)
+	assert.Equal("upgradeTo", dispatcher.sendTransactionMsg.Method.Name)
+	assert.Equal("0x"+testUpgradeProxy, dispatcher.sendTransactionMsg.To)
+	assert.Equal([]interface{}{testUpgradeNewImpl}, dispatcher.sendTransactionMsg.Parameters)
+
+	// The proxy is bound to the new ABI, with the upgrade in its instance file
+	_, bound, err := scgw.loadDeployMsgForInstance(testUpgradeProxy)
+	assert.NoError(err)
+	assert.Equal("abi2", bound.ABI)
+	var stored contractInfo
+	b, err := ioutil.ReadFile(path.Join(dir, "contract_"+testUpgradeProxy+".instance.json"))
+	assert.NoError(err)
+	json.Unmarshal(b, &stored)
+	assert.Equal("abi2", stored.ABI)
+	assert.Equal(upgrade, stored.Upgrades[0])
+}
+
+func TestUpgradeContractAndCall(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{
+		slots: []string{testUpgradeSlot(testUpgradeOldImpl), testUpgradeSlot(testUpgradeNewImpl)},
+		code:  ethbinding.HexBytes{0x60, 0x80},
+	}
+	_, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+
+	var info contractInfo
+	res := testUpgradePath(router, "/contracts/0x"+testUpgradeProxy+"/upgrade?fly-from="+testUpgradeFrom+"&fly-ethvalue=10",
+		`{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"},"data":"8129fc1c"}`, &info)
+	assert.Equal(200, res.Code)
+	assert.Equal("upgradeToAndCall", dispatcher.sendTransactionMsg.Method.Name)
+	assert.Equal([]interface{}{testUpgradeNewImpl, "0x8129fc1c"}, dispatcher.sendTransactionMsg.Parameters)
+	assert.Equal(json.Number("10"), dispatcher.sendTransactionMsg.Value)
+}
+
+func TestUpgradeContractNotProxy(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{slots: []string{"0x0000000000000000000000000000000000000000000000000000000000000000"}}
+	_, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("is not an ERC-1967 proxy", errReply.Message)
+	assert.Nil(dispatcher.deployContractMsg)
+}
+
+func TestUpgradeContractRequiresAdmin(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{
+		slots: []string{testUpgradeSlot(testUpgradeOldImpl), testUpgradeSlot(testUpgradeNewImpl)},
+		code:  ethbinding.HexBytes{0x60, 0x80},
+	}
+	_, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+
+	testAdminAuthRequired(t, router, "PUT", "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`)
+	assert.Nil(dispatcher.deployContractMsg)
+	assert.Nil(dispatcher.sendTransactionMsg)
+	assert.Empty(rpc.calls)
+}
+
+func TestUpgradeContractDeployFailed(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{slots: []string{testUpgradeSlot(testUpgradeOldImpl)}}
+	scgw, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+	dispatcher.deployContractSyncError = fmt.Errorf("pop")
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Equal("Failed to deploy the new implementation: pop", errReply.Message)
+	assert.Nil(dispatcher.sendTransactionMsg)
+	_, bound, _ := scgw.loadDeployMsgForInstance(testUpgradeProxy)
+	assert.Equal("abi1", bound.ABI)
+}
+
+func TestUpgradeContractCodeMismatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{
+		slots: []string{testUpgradeSlot(testUpgradeOldImpl)},
+		code:  ethbinding.HexBytes{0x60, 0x60},
+	}
+	_, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Regexp("does not match", errReply.Message)
+	assert.Nil(dispatcher.sendTransactionMsg)
+}
+
+func TestUpgradeContractUpgradeReverted(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{
+		slots: []string{testUpgradeSlot(testUpgradeOldImpl)},
+		code:  ethbinding.HexBytes{0x60, 0x80},
+	}
+	scgw, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+	dispatcher.sendTransactionSyncReceipt = testUpgradeReceipt(messages.MsgTypeTransactionFailure, testUpgradeTx, nil)
+	dispatcher.sendTransactionSyncReceipt.RevertReason = "Ownable: caller is not the owner"
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Equal("Failed to upgrade proxy 0x"+testUpgradeProxy+" to the new implementation "+testUpgradeNewImpl+": TX "+testUpgradeTx+": Ownable: caller is not the owner", errReply.Message)
+	_, bound, _ := scgw.loadDeployMsgForInstance(testUpgradeProxy)
+	assert.Equal("abi1", bound.ABI)
+
+	// The implementation that was deployed is recorded as a partial upgrade
+	assert.Len(bound.Upgrades, 1)
+	assert.True(bound.Upgrades[0].Partial)
+	assert.Equal(testUpgradeNewImpl, bound.Upgrades[0].Implementation)
+	assert.Equal(testUpgradeDeployTx, bound.Upgrades[0].DeployTransactionHash)
+	assert.Equal("", bound.Upgrades[0].UpgradeTransactionHash)
+	assert.Equal(errReply.Message, bound.Upgrades[0].Error)
+}
+
+func TestUpgradeContractNotVerified(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{
+		slots: []string{testUpgradeSlot(testUpgradeOldImpl)},
+		code:  ethbinding.HexBytes{0x60, 0x80},
+	}
+	scgw, router, _ := newTestUpgradeGW(t, dir, rpc)
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Regexp("has implementation "+testUpgradeOldImpl+" after the upgrade", errReply.Message)
+	_, bound, _ := scgw.loadDeployMsgForInstance(testUpgradeProxy)
+	assert.Equal("abi1", bound.ABI)
+	assert.Len(bound.Upgrades, 1)
+	assert.True(bound.Upgrades[0].Partial)
+	assert.Equal(testUpgradeTx, bound.Upgrades[0].UpgradeTransactionHash)
+}
+
+func TestUpgradeContractMethodNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{slots: []string{testUpgradeSlot(testUpgradeOldImpl)}}
+	scgw, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+	scgw.contractIndex[testUpgradeProxy].(*contractInfo).methodFilter = methodFilter{DenyMethods: []string{"upgradeTo"}}
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(403, res.Code)
+	assert.Equal("Method 'upgradeTo' is not allowed on contract "+testUpgradeProxy, errReply.Message)
+	assert.Nil(dispatcher.deployContractMsg)
+	assert.Empty(rpc.calls)
+}
+
+func TestUpgradeContractSafe(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{slots: []string{testUpgradeSlot(testUpgradeOldImpl)}}
+	_, router, dispatcher := newTestUpgradeGW(t, dir, rpc)
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-safe=0x3333333333333333333333333333333333333333&fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(400, res.Code)
+	assert.Regexp("is governed by Safe 0x3333333333333333333333333333333333333333", errReply.Message)
+	assert.Nil(dispatcher.deployContractMsg)
+}
+
+func TestUpgradeContractRPCFailure(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	rpc := &mockUpgradeRPC{err: fmt.Errorf("pop")}
+	_, router, _ := newTestUpgradeGW(t, dir, rpc)
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Equal("eth_getStorageAt returned: pop", errReply.Message)
+}
+
+func TestUpgradeContractNoRPC(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router, _ := newTestUpgradeGW(t, dir, nil)
+
+	var errReply restErrMsg
+	res := testUpgradePath(router, "/contracts/lobster/upgrade?fly-from="+testUpgradeFrom, `{"abi":"abi2","params":{"owner":"`+testUpgradeFrom+`"}}`, &errReply)
+	assert.Equal(500, res.Code)
+	assert.Regexp("not available without a JSON/RPC connection", errReply.Message)
+}
+
+func TestUpgradeContractBadRequests(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir()
+	defer cleanup(dir)
+	_, router, dispatcher := newTestUpgradeGW(t, dir, &mockUpgradeRPC{})
+
+	for _, tc := range []struct {
+		path, body string
+		status     int
+		message    string
+	}{
+		{"/contracts/lobster/upgrade", `!json`, 400, "Invalid upgrade request"},
+		{"/contracts/lobster/upgrade", `{}`, 400, "Must supply the 'abi'"},
+		{"/contracts/lobster/upgrade", `{"abi":"abi2","data":"zz"}`, 400, "invalid byte"},
+		{"/contracts/shrimp/upgrade", `{"abi":"abi2"}`, 404, "shrimp"},
+		{"/contracts/0x23456789abcdef0123456789abcdef0123456789/upgrade", `{"abi":"abi2"}`, 404, "23456789abcdef0123456789abcdef0123456789"},
+		{"/contracts/lobster/upgrade", `{"abi":"abi9"}`, 404, "abi9"},
+		{"/contracts/lobster/upgrade", `{"abi":"abi3"}`, 400, "stored without bytecode"},
+		{"/contracts/lobster/upgrade", `{"abi":"abi2"}`, 400, "Parameter 'owner'"},
+		{"/contracts/lobster/upgrade", `{"abi":"abi2","params":{"owner":"` + testUpgradeFrom + `"}}`, 400, "fly-from is required"},
+		{"/contracts/lobster/upgrade?fly-from=nobody", `{"abi":"abi2","params":{"owner":"` + testUpgradeFrom + `"}}`, 404, "From Address"},
+	} {
+		var errReply restErrMsg
+		res := testUpgradePath(router, tc.path, tc.body, &errReply)
+		assert.Equal(tc.status, res.Code, tc.body)
+		assert.Regexp(tc.message, errReply.Message)
+	}
+	assert.Nil(dispatcher.deployContractMsg)
+}
+
+func TestImplementationFromSlot(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(testUpgradeOldImpl, implementationFromSlot(testUpgradeSlot(testUpgradeOldImpl)))
+	assert.Equal("0xabcdef0123456789abcdef0123456789abcdef01", implementationFromSlot("0x000000000000000000000000ABCDEF0123456789ABCDEF0123456789ABCDEF01"))
+	assert.Equal("", implementationFromSlot("0x0000000000000000000000000000000000000000000000000000000000000000"))
+	assert.Equal("", implementationFromSlot("0x"))
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	ethconnecterrors "github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	strictIntCheck     = regexp.MustCompile("^-?(0x[0-9a-fA-F]+|[0-9]+)$")
+	strictAddressCheck = regexp.MustCompile("^(0x)?[0-9a-fA-F]{40}$")
+	strictBytesCheck   = regexp.MustCompile("^(0x)?([0-9a-fA-F]{2})*$")
+)
+
+// validationError is a single problem found validating a request body
+type validationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// restValidationErrMsg is the reply to a request with a body that failed strict validation,
+// listing every problem found rather than just the first
+type restValidationErrMsg struct {
+	restErrMsg
+	Errors []*validationError `json:"errors"`
+}
+
+// strictBodiesEnabled checks whether request bodies should be validated strictly against the
+// parameters of the method, which can be overridden per-request with fly-strict
+func (r *rest2eth) strictBodiesEnabled(req *http.Request) bool {
+	switch strings.ToLower(getFlyParam("strict", req, true)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	default:
+		return r.strictBodies
+	}
+}
+
+// validateBody checks a request body against the inputs of a method in the same way as the
+// generated OpenAPI schema. Fields that are not inputs are rejected, along with values that
+// would otherwise be coerced - such as a bool supplied as a string, or a number with a fraction
+func validateBody(inputs ethbinding.ABIArguments, body map[string]interface{}, extraFields ...string) []*validationError {
+	errs := []*validationError{}
+	known := make(map[string]bool)
+	for _, f := range extraFields {
+		known[f] = true
+	}
+	for i, input := range inputs {
+		argName := abiInputName(i, input)
+		known[argName] = true
+		if v, exists := body[argName]; exists {
+			t := input.Type
+			errs = append(errs, validateValue(argName, &t, v)...)
+		}
+	}
+	errs = append(errs, unknownFields("", body, known)...)
+	return errs
+}
+
+func unknownFields(prefix string, m map[string]interface{}, known map[string]bool) []*validationError {
+	errs := []*validationError{}
+	for name := range m {
+		if !known[name] {
+			errs = append(errs, &validationError{
+				Field:   prefix + name,
+				Message: ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBodyUnknownField).Error(),
+			})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+func invalidValue(path string, t *ethbinding.ABIType) []*validationError {
+	return []*validationError{{
+		Field:   path,
+		Message: ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBodyInvalidValue, t.String()).Error(),
+	}}
+}
+
+func validateValue(path string, t *ethbinding.ABIType, v interface{}) []*validationError {
+	switch t.T {
+	case ethbinding.IntTy, ethbinding.UintTy:
+		i, ok := strictInteger(v)
+		if !ok || !integerInRange(i, t) {
+			return invalidValue(path, t)
+		}
+	case ethbinding.BoolTy:
+		if _, ok := v.(bool); !ok {
+			return invalidValue(path, t)
+		}
+	case ethbinding.StringTy:
+		if _, ok := v.(string); !ok {
+			return invalidValue(path, t)
+		}
+	case ethbinding.AddressTy:
+		if s, ok := v.(string); !ok || !strictAddressCheck.MatchString(s) {
+			return invalidValue(path, t)
+		}
+	case ethbinding.BytesTy, ethbinding.FixedBytesTy:
+		s, ok := v.(string)
+		if !ok || !strictBytes(s, t) {
+			return invalidValue(path, t)
+		}
+	case ethbinding.SliceTy, ethbinding.ArrayTy:
+		a, ok := v.([]interface{})
+		if !ok || (t.T == ethbinding.ArrayTy && len(a) != t.Size) {
+			return invalidValue(path, t)
+		}
+		errs := []*validationError{}
+		for i, elem := range a {
+			errs = append(errs, validateValue(fmt.Sprintf("%s[%d]", path, i), t.Elem, elem)...)
+		}
+		return errs
+	case ethbinding.TupleTy:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return invalidValue(path, t)
+		}
+		errs := []*validationError{}
+		known := make(map[string]bool)
+		for i, name := range t.TupleRawNames {
+			known[name] = true
+			if elem, exists := m[name]; exists {
+				errs = append(errs, validateValue(path+"."+name, t.TupleElems[i], elem)...)
+			} else {
+				errs = append(errs, &validationError{
+					Field:   path + "." + name,
+					Message: ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBodyMissingField).Error(),
+				})
+			}
+		}
+		return append(errs, unknownFields(path+".", m, known)...)
+	}
+	return nil
+}
+
+// strictBytes accepts a hex string with an even number of digits, or a base64 string with the
+// prefix, which must be the exact length of fixed size bytes
+func strictBytes(s string, t *ethbinding.ABIType) bool {
+	var length int
+	if strings.HasPrefix(s, eth.Base64BytesPrefix) {
+		b, err := eth.DecodeBytesString(s)
+		if err != nil {
+			return false
+		}
+		length = len(b)
+	} else if strictBytesCheck.MatchString(s) {
+		length = len(strings.TrimPrefix(s, "0x")) / 2
+	} else {
+		return false
+	}
+	return t.T != ethbinding.FixedBytesTy || length == t.Size
+}
+
+// strictInteger accepts a JSON number with no fraction, or a decimal or 0x prefixed hex string
+func strictInteger(v interface{}) (*big.Int, bool) {
+	switch vt := v.(type) {
+	case float64:
+		if vt != math.Trunc(vt) || math.IsInf(vt, 0) {
+			return nil, false
+		}
+		i, _ := big.NewFloat(vt).Int(nil)
+		return i, true
+	case json.Number:
+		return new(big.Int).SetString(string(vt), 10)
+	case int:
+		return big.NewInt(int64(vt)), true
+	case int64:
+		return big.NewInt(vt), true
+	case uint64:
+		return new(big.Int).SetUint64(vt), true
+	case string:
+		if !strictIntCheck.MatchString(vt) {
+			return nil, false
+		}
+		neg := strings.HasPrefix(vt, "-")
+		s := strings.TrimPrefix(vt, "-")
+		base := 10
+		if strings.HasPrefix(s, "0x") {
+			s, base = s[2:], 16
+		}
+		i, ok := new(big.Int).SetString(s, base)
+		if ok && neg {
+			i.Neg(i)
+		}
+		return i, ok
+	}
+	return nil, false
+}
+
+func integerInRange(i *big.Int, t *ethbinding.ABIType) bool {
+	if t.T == ethbinding.UintTy {
+		return i.Sign() >= 0 && i.BitLen() <= t.Size
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+	return i.Cmp(limit) < 0 && i.Cmp(new(big.Int).Neg(limit)) >= 0
+}
+
+// restValidationErrReply sends a 400 with the problems found validating a body, returning the summary error
+func (r *rest2eth) restValidationErrReply(res http.ResponseWriter, req *http.Request, method string, errs []*validationError) error {
+	err := ethconnecterrors.Errorf(ethconnecterrors.RESTGatewayBodyValidationFailed, method, len(errs))
+	log.Errorf("<-- %s %s [%d]: %s", req.Method, req.URL, 400, err)
+	reply, _ := json.Marshal(&restValidationErrMsg{
+		restErrMsg: restErrMsg{Message: err.Error()},
+		Errors:     errs,
+	})
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(400)
+	res.Write(reply)
+	return err
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contracts
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func testValidateInputs(t *testing.T) ethbinding.ABIArguments {
+	runtimeABI, err := eth.RuntimeABI(ethbinding.ABIMarshaling{
+		{
+			Type: "function",
+			Name: "set",
+			Inputs: []ethbinding.ABIArgumentMarshaling{
+				{Name: "amount", Type: "uint8"},
+				{Name: "delta", Type: "int16"},
+				{Name: "enabled", Type: "bool"},
+				{Name: "owner", Type: "address"},
+				{Name: "hash", Type: "bytes4"},
+				{Name: "values", Type: "uint256[2]"},
+				{Name: "order", Type: "tuple", Components: []ethbinding.ABIArgumentMarshaling{
+					{Name: "id", Type: "string"},
+					{Name: "data", Type: "bytes"},
+				}},
+			},
+		},
+	})
+	assert.NoError(t, err)
+	return runtimeABI.Methods["set"].Inputs
+}
+
+func TestValidateBodyValid(t *testing.T) {
+	assert := assert.New(t)
+
+	errs := validateBody(testValidateInputs(t), map[string]interface{}{
+		"amount":  float64(255),
+		"delta":   "-32768",
+		"enabled": true,
+		"owner":   "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+		"hash":    "0x01020304",
+		"values":  []interface{}{"0xff", json.Number("12345678901234567890")},
+		"order":   map[string]interface{}{"id": "order1", "data": "0x"},
+	})
+	assert.Empty(errs)
+}
+
+func TestValidateBodyInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	errs := validateBody(testValidateInputs(t), map[string]interface{}{
+		"amount":  float64(256),
+		"delta":   float64(1.5),
+		"enabled": "true",
+		"owner":   "0x1234",
+		"hash":    "0x0102",
+		"values":  []interface{}{"1"},
+		"order":   map[string]interface{}{"id": float64(1), "extra": "x"},
+		"other":   "x",
+	})
+	fields := make(map[string]string)
+	for _, e := range errs {
+		fields[e.Field] = e.Message
+	}
+	assert.Equal(map[string]string{
+		"amount":      "Value is not a valid uint8",
+		"delta":       "Value is not a valid int16",
+		"enabled":     "Value is not a valid bool",
+		"owner":       "Value is not a valid address",
+		"hash":        "Value is not a valid bytes4",
+		"values":      "Value is not a valid uint256[2]",
+		"order.id":    "Value is not a valid string",
+		"order.data":  "Missing field",
+		"order.extra": "Unknown field",
+		"other":       "Unknown field",
+	}, fields)
+}
+
+func TestStrictInteger(t *testing.T) {
+	assert := assert.New(t)
+
+	i, ok := strictInteger("-0x10")
+	assert.True(ok)
+	assert.Equal(int64(-16), i.Int64())
+	i, ok = strictInteger(int(7))
+	assert.True(ok)
+	assert.Equal(int64(7), i.Int64())
+	_, ok = strictInteger("1e3")
+	assert.False(ok)
+	_, ok = strictInteger(true)
+	assert.False(ok)
+}
+
+func TestStrictBodiesREST(t *testing.T) {
+	assert := assert.New(t)
+
+	abiLoader := newTestBulkCallABILoader()
+	dispatcher := &mockREST2EthDispatcher{
+		asyncDispatchReply: &messages.AsyncSentMsg{Sent: true, Request: "request1"},
+	}
+	r, _, router := newTestREST2EthCustomAbiLoader(dispatcher, abiLoader)
+	r.strictBodies = true
+
+	req := httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872","amount":10}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+	var reply restValidationErrMsg
+	json.NewDecoder(res.Body).Decode(&reply)
+	assert.Equal("Request body is invalid for 'transfer' (1 errors)", reply.Message)
+	assert.Equal([]*validationError{{Field: "amount", Message: "Unknown field"}}, reply.Errors)
+	assert.Nil(dispatcher.asyncDispatchMsg)
+
+	// Override per-request
+	req = httptest.NewRequest("POST", "/contracts/0x2b8c0ecc76d0759a8f50b2e14a6881367d805832/transfer?fly-strict=false", bytes.NewReader([]byte(`{"to":"0x567a417717cb6c59ddc1035705f02c0fd1ab1872","amount":10}`)))
+	req.Header.Set("x-firefly-from", "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(202, res.Code)
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"strings"
+)
+
+// submittedErrors are substrings of errors where the node might already have accepted the
+// transaction. Re-submitting could send it twice, so the transaction must be queried by hash
+// (or the nonce checked) before trying again
+var submittedErrors = []string{
+	// the node already has a transaction with this nonce, or this exact transaction
+	"nonce too low",
+	"already known",
+	"known transaction",
+	"already imported",
+	// timeouts after the transaction was sent to the node
+	"transaction submission did not complete",
+	"transaction submission might have reached the node",
+	"timed out waiting for transaction receipt",
+	"confirmations of the transaction",
+}
+
+// uncertainErrors are substrings of connectivity errors where a request might have reached
+// the node before the connection failed
+var uncertainErrors = []string{
+	"connection reset",
+	"i/o timeout",
+	"context deadline exceeded",
+	"client.timeout exceeded",
+	"unexpected eof",
+}
+
+// retryableErrors are substrings of errors (from ethconnect, or passed through from the node)
+// where re-submitting the same request might succeed. Everything else, such as ABI and
+// parameter validation failures, is permanent and will fail again in exactly the same way
+var retryableErrors = append([]string{
+	// nonce issues where the node rejected the transaction - a new nonce is assigned on re-submission
+	"nonce too high",
+	"replacement transaction underpriced",
+	// gas pricing - the network gas price can change between submissions
+	"transaction underpriced",
+	"gas price too low",
+	"max fee per gas less than block base fee",
+	// connectivity to the node, and to Kafka
+	"connection refused",
+	"no such host",
+	"json/rpc node unavailable",
+	"failed to deliver message to kafka",
+	// back-pressure within ethconnect
+	"too many in-flight",
+}, uncertainErrors...)
+
+// invalidCallBlockErrors are substrings of errors where the block requested for a call is
+// invalid, or is a time before the first block, so the request cannot succeed on any node
+var invalidCallBlockErrors = []string{
+	"invalid blocknumber",
+	"no block was mined at or before",
+}
+
+func containsAny(err error, substrs []string) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, substr := range substrs {
+		if strings.Contains(msg, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAlreadySubmitted classifies an error as one where the transaction might have been
+// accepted by the node, so it must be queried by hash rather than retried
+func IsAlreadySubmitted(err error) bool {
+	return containsAny(err, submittedErrors)
+}
+
+// IsUncertain classifies a connectivity error as one where the request might have reached the node
+func IsUncertain(err error) bool {
+	return containsAny(err, uncertainErrors)
+}
+
+// IsRetryable classifies an error as retryable, or permanent. Only failures before the
+// transaction could have reached the node are retryable
+func IsRetryable(err error) bool {
+	return !IsAlreadySubmitted(err) && containsAny(err, retryableErrors)
+}
+
+// IsInvalidCallBlock classifies an error resolving the block for a call as a client error
+func IsInvalidCallBlock(err error) bool {
+	return containsAny(err, invalidCallBlockErrors)
+}
+
+// IsRetryableHTTP classifies an error returned with an HTTP status. Client errors are
+// permanent (other than too many requests), and server errors are classified by the error
+func IsRetryableHTTP(err error, status int) bool {
+	switch {
+	case IsAlreadySubmitted(err):
+		return false
+	case status == 429 || status == 503:
+		return true
+	case status < 500:
+		return false
+	default:
+		return IsRetryable(err)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(IsRetryable(nil))
+	assert.False(IsRetryable(fmt.Errorf("Nonce too low")))
+	assert.True(IsRetryable(fmt.Errorf("nonce too high")))
+	assert.True(IsRetryable(fmt.Errorf("replacement transaction underpriced")))
+	assert.True(IsRetryable(fmt.Errorf("dial tcp 127.0.0.1:8545: connect: connection refused")))
+	assert.True(IsRetryable(Errorf(RPCCircuitBreakerOpen, 5, 30.0)))
+	assert.True(IsRetryable(Errorf(WebhooksKafkaErr, "broker down")))
+	assert.True(IsRetryable(Errorf(WebhooksDirectTooManyInflight)))
+	assert.False(IsRetryable(fmt.Errorf("insufficient funds for gas * price + value")))
+	assert.False(IsRetryable(Errorf(TransactionSendMissingMethod)))
+	assert.True(IsRetryable(fmt.Errorf("read tcp: i/o timeout")))
+	assert.False(IsRetryable(Errorf(TransactionSendSubmitUncertain, "read tcp: i/o timeout")))
+}
+
+func TestIsAlreadySubmitted(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(IsAlreadySubmitted(nil))
+	assert.True(IsAlreadySubmitted(fmt.Errorf("nonce too low")))
+	assert.True(IsAlreadySubmitted(fmt.Errorf("already known")))
+	assert.True(IsAlreadySubmitted(fmt.Errorf("known transaction: 0x1234")))
+	assert.True(IsAlreadySubmitted(Errorf(TransactionSendStageTimeout, "submission", "10s")))
+	assert.True(IsAlreadySubmitted(Errorf(TransactionSendSubmitUncertain, "unexpected EOF")))
+	assert.True(IsAlreadySubmitted(Errorf(TransactionSendReceiptCheckTimeout)))
+	assert.True(IsAlreadySubmitted(Errorf(TransactionConfirmationTimeout, 12)))
+	assert.False(IsAlreadySubmitted(Errorf(TransactionSendStageTimeout, "gas estimation", "10s")))
+	assert.False(IsAlreadySubmitted(fmt.Errorf("connection refused")))
+}
+
+func TestIsInvalidCallBlock(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(IsInvalidCallBlock(nil))
+	assert.True(IsInvalidCallBlock(Errorf(TransactionCallInvalidBlockNumber)))
+	assert.True(IsInvalidCallBlock(Errorf(TransactionCallBlockBeforeGenesis, "2020-12-31T00:00:00Z")))
+	assert.False(IsInvalidCallBlock(fmt.Errorf("eth_getBlockByNumber returned: pop")))
+}
+
+func TestIsRetryableHTTP(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsRetryableHTTP(fmt.Errorf("pop"), 429))
+	assert.True(IsRetryableHTTP(fmt.Errorf("pop"), 503))
+	assert.False(IsRetryableHTTP(fmt.Errorf("connection refused"), 400))
+	assert.True(IsRetryableHTTP(fmt.Errorf("connection refused"), 500))
+	assert.False(IsRetryableHTTP(fmt.Errorf("pop"), 500))
+	assert.False(IsRetryableHTTP(fmt.Errorf("already known"), 503))
+}
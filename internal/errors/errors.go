@@ -32,8 +32,29 @@ const (
 	// AddressBookLookupNotFound remote addressbook says no
 	AddressBookLookupNotFound = "Unknown address"
 
+	// CLIABINoInput neither Solidity source or compiled output was supplied to an abi command
+	CLIABINoInput = "Must supply either a Solidity source file, or the compiled output of 'abi compile'"
+	// CLIABIInputParseFailed the compiled output file supplied to an abi command could not be parsed
+	CLIABIInputParseFailed = "Failed to parse compiled contract from %s: %s"
+	// CLIABIRegisterTarget an abi register command needs exactly one of a gateway URL or a storage path
+	CLIABIRegisterTarget = "Must supply one of a gateway URL, or the storage path of the contract store"
+	// CLIABIRegisterInvalidAddress the contract address to register is not a valid address
+	CLIABIRegisterInvalidAddress = "Invalid contract address '%s'"
+	// CLIABIRegisterRequestFailed the request to register with a running gateway failed
+	CLIABIRegisterRequestFailed = "Request to %s failed: %s"
+	// CLIABIRegisterErrorResponse a running gateway returned an error from a register request
+	CLIABIRegisterErrorResponse = "Request to %s failed [%d]: %s"
+	// CLIABIOutputWriteFailed the output of an abi command could not be written
+	CLIABIOutputWriteFailed = "Failed to write %s: %s"
+	// CLIReplayBadHeader a header to add to replayed requests is not in the format of an HTTP header
+	CLIReplayBadHeader = "Invalid header '%s' - must be in the format 'Name: value'"
+	// CLIReplayMismatched responses from the gateway differed from the recording during a replay
+	CLIReplayMismatched = "%d of %d replayed requests did not match the recording"
+
 	// ConfigFileReadFailed failed to read the server config file
 	ConfigFileReadFailed = "Failed to read %s: %s"
+	// ConfigLogSamplingBadRule a log sampling rule is incomplete or invalid
+	ConfigLogSamplingBadRule = "Invalid log sampling rule '%s'. Supply a module and/or a regular expression to match, and the number of entries to keep 1 in (0 to drop them all), such as eth:eth_getTransactionReceipt=100"
 	// CompilerVersionNotFound the runtime context of ethconnect has not been configured with a compiler for the requested version
 	CompilerVersionNotFound = "Could not find a configured compiler for requested Solidity major version %s.%s"
 	// CompilerVersionBadRequest the user requested a bad semver
@@ -54,6 +75,40 @@ const (
 	CompilerABIReRead = "Parsing ABI: %s"
 	// CompilerSerializeDevDocs could not serialize the dev docs output from solc
 	CompilerSerializeDevDocs = "Serializing DevDoc: %s"
+	// CompilerSerializeUserDocs could not serialize the user docs output from solc
+	CompilerSerializeUserDocs = "Serializing UserDoc: %s"
+	// CompilerRemappingInvalid a solc import remapping is not in the expected format
+	CompilerRemappingInvalid = "Invalid solc remapping '%s'. Use the format [context:]prefix=target"
+	// CompilerTimeout solc was killed as it did not complete within the configured time
+	CompilerTimeout = "Solidity compilation did not complete within %s"
+	// CompilerOutputTooLarge solc was killed as its output exceeded the configured size
+	CompilerOutputTooLarge = "Solidity compilation output exceeded the maximum of %d bytes"
+	// CompilerSourceTooLarge the source uploaded for compilation exceeded the configured size
+	CompilerSourceTooLarge = "Solidity source of %d bytes exceeds the maximum of %d bytes"
+	// CompilerDependencyInvalid a configured Solidity dependency is incomplete, or has an invalid source or checksum
+	CompilerDependencyInvalid = "Invalid Solidity dependency for prefix '%s'. Configure one of npm (name@version) or github (owner/repo@ref), and the sha256 of the archive"
+	// CompilerDependencyFetchFailed the archive for a Solidity dependency could not be downloaded
+	CompilerDependencyFetchFailed = "Failed to fetch Solidity dependency %s: %s"
+	// CompilerDependencyChecksum the archive downloaded for a Solidity dependency does not match the pinned checksum
+	CompilerDependencyChecksum = "Checksum of Solidity dependency %s was '%s' rather than the pinned '%s'"
+	// CompilerDependencyExtractFailed the archive for a Solidity dependency could not be extracted into the cache
+	CompilerDependencyExtractFailed = "Failed to extract Solidity dependency %s: %s"
+	// CompilerGitNotEnabled a deployment named a git source, but no git hosts are allowed
+	CompilerGitNotEnabled = "Deploying from git is not enabled. Configure the hosts that repositories can be fetched from"
+	// CompilerGitURLInvalid the git URL of a deployment could not be parsed, or uses an unsupported scheme
+	CompilerGitURLInvalid = "Invalid git URL '%s'. Must be an https, http or ssh URL"
+	// CompilerGitHostNotAllowed the git URL of a deployment is not on an allowed host
+	CompilerGitHostNotAllowed = "Git host '%s' is not allowed"
+	// CompilerGitRefInvalid the git ref of a deployment is missing or invalid
+	CompilerGitRefInvalid = "Invalid git ref '%s'. Must be a branch, tag or commit"
+	// CompilerGitPathInvalid the path of the Solidity in the git repository is missing or invalid
+	CompilerGitPathInvalid = "Invalid path '%s'. Must be the relative path of a .sol file in the repository"
+	// CompilerGitRefNotFound the git ref of a deployment does not exist in the repository
+	CompilerGitRefNotFound = "Git ref '%s' was not found in %s"
+	// CompilerGitFetchFailed failed to fetch the commit of a deployment from the git repository
+	CompilerGitFetchFailed = "Failed to fetch %s from %s: %s"
+	// CompilerGitSourceConflict a deployment supplied both Solidity source and a git source
+	CompilerGitSourceConflict = "Supply either the solidity source or a git source to deploy, not both"
 	// ConfigNoRPC missing config for JSON/RPC
 	ConfigNoRPC = "No JSON/RPC URL set for ethereum node"
 	// ConfigKafkaMissingOutputTopic response topic missing
@@ -66,10 +121,20 @@ const (
 	ConfigKafkaMissingBadSASL = "Username and Password must both be provided for SASL"
 	// ConfigKafkaMissingBrokers missing/empty brokers
 	ConfigKafkaMissingBrokers = "No Kafka brokers configured"
+	// KafkaBridgeDuplicateNoReply a request was re-delivered after the original was submitted, but before its reply was recorded
+	KafkaBridgeDuplicateNoReply = "Request %s has already been submitted, and the outcome is unknown. Check the transaction receipt"
 	// ConfigRESTGatewayRequiredReceiptStore need to enable params for REST Gatewya
 	ConfigRESTGatewayRequiredReceiptStore = "MongoDB URL, Database and Collection name must be specified to enable the receipt store"
+	// ConfigRESTGatewayReceiptStorePartition invalid time partitioning for the receipt store
+	ConfigRESTGatewayReceiptStorePartition = "Invalid receipt store partition '%s'. Must be daily or weekly"
+	// ConfigRESTGatewayReceiptStoreIntegrity invalid integrity chaining mode for the receipt store
+	ConfigRESTGatewayReceiptStoreIntegrity = "Invalid receipt store integrity '%s'. Must be global or address"
 	// ConfigRESTGatewayRequiredRPC and RPC stuff
 	ConfigRESTGatewayRequiredRPC = "RPC URL and Storage Path must be supplied to enable the Open API REST Gateway"
+	// ConfigRESTGatewayRPCProxyRequiresRPC the JSON/RPC proxy requires a node to proxy to
+	ConfigRESTGatewayRPCProxyRequiresRPC = "RPC URL must be supplied to enable the JSON/RPC proxy"
+	// ConfigRESTGatewayPeersRequireSecret replies are only forwarded between peers that share a secret
+	ConfigRESTGatewayPeersRequireSecret = "A peer secret must be supplied to forward replies between peers"
 	// ConfigWebhooksDirectRPC for webhooks direct
 	ConfigWebhooksDirectRPC = "No JSON/RPC URL set for ethereum node"
 	// ConfigTLSCertOrKey incomplete TLS config
@@ -82,8 +147,21 @@ const (
 	// ConfigYAMLPostParseFile failed to process YAML as JSON after parsing
 	ConfigYAMLPostParseFile = "Failed to process YAML config from %s: %s"
 
+	// ContractStorePathInvalid the storage path of a contract store is not a directory
+	ContractStorePathInvalid = "Contract store path '%s' is not a directory"
+
 	// DeployTransactionMissingCode a DeployTransaction message, without code to deploy
 	DeployTransactionMissingCode = "Missing Compiled Code + ABI, or Solidity"
+	// DeploySingletonFactoryBadSalt the salt for a deployment through the singleton factory is not 32 bytes
+	DeploySingletonFactoryBadSalt = "Invalid salt '%s' for a deployment through the singleton factory. Must be 32 bytes of hex"
+	// DeploySingletonFactoryValue value was supplied with a deployment through the singleton factory, which cannot forward it
+	DeploySingletonFactoryValue = "Value cannot be sent with a deployment through the singleton factory"
+	// DeploySingletonFactoryCodeCheckFailed the check for a contract already deployed at the address the singleton factory would create it at failed
+	DeploySingletonFactoryCodeCheckFailed = "Failed to check for an existing contract at %s: %s"
+	// DeploySingletonFactoryMissing the singleton factory is not deployed on the chain
+	DeploySingletonFactoryMissing = "The ERC-2470 singleton factory is not deployed at %s on this chain"
+	// DeploySingletonFactoryNotCreated the transaction to the singleton factory succeeded, but no contract was created
+	DeploySingletonFactoryNotCreated = "The singleton factory did not create a contract at %s"
 
 	// EventStreamsDBLoad failed to init DB
 	EventStreamsDBLoad = "Failed to open DB at %s: %s"
@@ -101,12 +179,42 @@ const (
 	EventStreamsWebhookProhibitedAddress = "Cannot send Webhook POST to address: %s"
 	// EventStreamsWebhookFailedHTTPStatus server at the other end of a webhook returned a non-OK response
 	EventStreamsWebhookFailedHTTPStatus = "%s: Failed with status=%d"
+	// EventStreamsWebhookProbeFailedHTTPStatus server at the other end of a webhook returned a non-OK response to a probe while the stream is paused
+	EventStreamsWebhookProbeFailedHTTPStatus = "%s: Probe failed with status=%d"
+	// EventStreamsWebhookInvalidProbeURL attempt to create a Webhook event stream with an invalid probe URL
+	EventStreamsWebhookInvalidProbeURL = "Invalid probeURL in webhook action"
+	// EventStreamsPayloadRenameInvalid a rename in the payload mapping of a stream is missing a field name
+	EventStreamsPayloadRenameInvalid = "Invalid payload rename from '%s' to '%s'. Both field names are required"
+	// EventStreamsFormatUnknown the delivery format of a stream is not one that is supported
+	EventStreamsFormatUnknown = "Unknown delivery format '%s'. Must be 'native' or 'firefly'"
+	// EventStreamsFormatWithPayload a payload mapping was set on a stream that delivers in a fixed format
+	EventStreamsFormatWithPayload = "A payload mapping cannot be combined with the '%s' delivery format"
+	// EventStreamsWebhookAuthConflict both a bearer token and OAuth2 were configured to authenticate a webhook
+	EventStreamsWebhookAuthConflict = "Specify only one of webhook.auth.bearerToken and webhook.auth.oauth2"
+	// EventStreamsWebhookOAuth2Invalid the OAuth2 client credentials configuration of a webhook is incomplete
+	EventStreamsWebhookOAuth2Invalid = "Must specify an absolute tokenURL and a clientId for webhook.auth.oauth2"
+	// EventStreamsWebhookOAuth2TokenFailed the token endpoint did not return an access token
+	EventStreamsWebhookOAuth2TokenFailed = "%s: Failed to get an OAuth2 access token from %s: %s"
 	// EventStreamsSubscribeBadBlock the starting block for a subscription request is invalid
 	EventStreamsSubscribeBadBlock = "FromBlock cannot be parsed as a BigInt"
 	// EventStreamsSubscribeStoreFailed problem saving a subscription to our DB
 	EventStreamsSubscribeStoreFailed = "Failed to store subscription: %s"
 	// EventStreamsSubscribeNoEvent missing event
 	EventStreamsSubscribeNoEvent = "Solidity event name must be specified"
+	// EventStreamsDeadLetterNotFound the dead letter requested does not exist on the stream
+	EventStreamsDeadLetterNotFound = "Dead letter %s not found"
+	// EventStreamsDeadLetterStreamSuspended dead letters cannot be replayed on a suspended stream
+	EventStreamsDeadLetterStreamSuspended = "Event stream %s is suspended. Resume it to replay dead letters"
+	// EventStreamsOversizedEventsUnknown the policy for events over the maximum size of a stream is not one that is supported
+	EventStreamsOversizedEventsUnknown = "Unknown oversized events policy '%s'. Must be 'truncate' or 'deadletter'"
+	// EventStreamsEventTooLarge events were skipped into a dead letter, as they are larger than the stream allows
+	EventStreamsEventTooLarge = "Events exceed the maximum event size of %d bytes for the stream"
+	// EventStreamsOversizedEventNotFound the full content of a truncated event is not stored for the stream
+	EventStreamsOversizedEventNotFound = "Oversized event %s not found"
+	// EventStreamsSubscribeBadSignature the event signature supplied for a subscription could not be parsed
+	EventStreamsSubscribeBadSignature = "Invalid event signature '%s': %s"
+	// EventStreamsSubscribeBadSignatureParams the parameter list of an event signature is malformed
+	EventStreamsSubscribeBadSignatureParams = "malformed parameter list"
 	// EventStreamsSubscriptionNotFound sub not found
 	EventStreamsSubscriptionNotFound = "Subscription with ID '%s' not found"
 	// EventStreamsCreateStreamStoreFailed problem saving a subscription to our DB
@@ -131,8 +239,94 @@ const (
 	EventStreamsWebSocketErrorFromClient = "Error received from WebSocket client: %s"
 	// EventStreamsCannotUpdateType cannot change tyep
 	EventStreamsCannotUpdateType = "The type of an event stream cannot be changed"
+	// EventStreamsAutoRegisterUnavailable auto-registration requested where there is no contract registry
+	EventStreamsAutoRegisterUnavailable = "Contract auto-registration is not available without the contract gateway"
+	// EventStreamsAutoRegisterMissingField auto-registration requested without the required fields
+	EventStreamsAutoRegisterMissingField = "Contract auto-registration requires an 'abi' and an 'addressField'"
+	// EventStreamsAutoRegisterBadAddressField the configured address field is not an address on the event
+	EventStreamsAutoRegisterBadAddressField = "Auto-registration address field '%s' is not an address input of event '%s'"
+	// EventStreamsAutoRegisterBadNameField the configured name field is not a non-indexed string on the event
+	EventStreamsAutoRegisterBadNameField = "Auto-registration name field '%s' is not a non-indexed string input of event '%s'"
+	// EventStreamsAutoRegisterClosed a contract registration was requested after the subscription manager closed
+	EventStreamsAutoRegisterClosed = "Contract auto-registration stopped as the subscription manager is closing"
+	// EventStreamsTransactionUnavailable a transaction stream requested where there is no contract gateway
+	EventStreamsTransactionUnavailable = "Event streams of type 'transaction' are not available without the contract gateway"
+	// EventStreamsTransactionNoRules a transaction stream was created without any invocation rules
+	EventStreamsTransactionNoRules = "Must specify transaction.rules for action type 'transaction'"
+	// EventStreamsTransactionRuleMissingField an invocation rule is missing a required field
+	EventStreamsTransactionRuleMissingField = "Invocation rule %d must specify a 'contract', 'method' and 'from'"
+	// EventStreamsTransactionParamInvalid a parameter mapping of an invocation rule is missing the input or path
+	EventStreamsTransactionParamInvalid = "Invalid parameter mapping from '%s' to '%s'. Both the input name and event field are required"
+	// EventStreamsTransactionParamNotFound the event field mapped to a method input is not in the event
+	EventStreamsTransactionParamNotFound = "Field '%s' for parameter '%s' is not in the event"
+	// EventStreamsTransactionInvokeFailed the transaction of an invocation rule could not be submitted
+	EventStreamsTransactionInvokeFailed = "Invocation rule '%s' failed: %s"
+	// EventStreamsTransactionNotAuthorized the creator of an invocation rule is not authorized to send transactions from its signer
+	EventStreamsTransactionNotAuthorized = "Not authorized to send transactions from '%s' for invocation rule '%s': %s"
+	// EventStreamsWarehouseNoTable a warehouse stream was created without a table
+	EventStreamsWarehouseNoTable = "Must specify warehouse.table for action type 'warehouse'"
+	// EventStreamsWarehouseUnknownWriter the writer of a warehouse stream is not registered
+	EventStreamsWarehouseUnknownWriter = "Unknown warehouse writer '%s'"
+	// EventStreamsWarehouseInvalidURL the endpoint of a warehouse stream is not an absolute URL
+	EventStreamsWarehouseInvalidURL = "Invalid warehouse URL '%s'"
+	// EventStreamsWarehouseBigQueryIncomplete the BigQuery writer needs the project and dataset of the table
+	EventStreamsWarehouseBigQueryIncomplete = "Must specify warehouse.project and warehouse.dataset for the bigquery writer"
+	// EventStreamsWarehouseBigQueryAuth the BigQuery API does not accept webhook style authentication
+	EventStreamsWarehouseBigQueryAuth = "The bigquery writer does not support warehouse.auth. Specify warehouse.serviceAccount, or use the Application Default Credentials of the gateway"
+	// EventStreamsWarehouseServiceAccountInvalid the service account key of a warehouse stream cannot be used
+	EventStreamsWarehouseServiceAccountInvalid = "Invalid warehouse.serviceAccount key: %s"
+	// EventStreamsWarehouseGoogleAuthFailed an access token for the Google Cloud API could not be obtained
+	EventStreamsWarehouseGoogleAuthFailed = "Failed to get a Google Cloud access token: %s"
+	// EventStreamsWarehouseWriteFailed a batch could not be loaded into the warehouse
+	EventStreamsWarehouseWriteFailed = "%s: Loading %d events into warehouse table '%s' failed: %s"
+	// EventStreamsWarehouseHTTPStatus the warehouse returned a failure status
+	EventStreamsWarehouseHTTPStatus = "Warehouse returned status %d: %s"
+	// EventStreamsWarehouseBadResponse the response of the warehouse could not be parsed
+	EventStreamsWarehouseBadResponse = "Invalid response from warehouse: %s"
+	// EventStreamsWarehouseRowsRejected the warehouse rejected some of the rows of a batch
+	EventStreamsWarehouseRowsRejected = "Warehouse rejected %d of %d rows. First error %s"
+	// EventStreamsBootstrapRead failed to read the bootstrap file for event streams and subscriptions
+	EventStreamsBootstrapRead = "Failed to read event streams bootstrap file '%s': %s"
+	// EventStreamsBootstrapParse failed to parse the bootstrap file for event streams and subscriptions
+	EventStreamsBootstrapParse = "Failed to parse event streams bootstrap file '%s': %s"
+	// EventStreamsBootstrapNoName streams and subscriptions are matched by name during bootstrap, so must have one
+	EventStreamsBootstrapNoName = "Every event stream and subscription declared for bootstrap must have a name"
+	// EventStreamsBootstrapDuplicateName streams, and subscriptions within a stream, are matched by name so must be unique
+	EventStreamsBootstrapDuplicateName = "Duplicate %s name '%s' in event stream definitions"
+	// EventStreamsBootstrapTypeChanged the type of a declared stream differs from the existing stream of the same name
+	EventStreamsBootstrapTypeChanged = "Cannot change the type of event stream '%s' from '%s' to '%s' - delete the existing stream first"
+	// EventStreamsBootstrapBadAddress invalid contract address on a declared subscription
+	EventStreamsBootstrapBadAddress = "Invalid address '%s' for subscription '%s'"
+	// EventStreamsBootstrapFailed failed to create or update a declared stream or subscription
+	EventStreamsBootstrapFailed = "Failed to bootstrap %s '%s': %s"
+	// EventStreamsIdleTimeoutNotSet no idle timeout was supplied on the request, or configured for the policy
+	EventStreamsIdleTimeoutNotSet = "An idle timeout must be supplied, as no idle subscription policy is configured"
+	// EventStreamsMaxInFlightBatchesUnsupported concurrent delivery of batches was requested on a stream that does not acknowledge each batch
+	EventStreamsMaxInFlightBatchesUnsupported = "Concurrent delivery of batches with maxInFlightBatches is only supported for webhook event streams, and websocket event streams that do not broadcast"
+	// EventStreamsSubscriptionDeleteDrainAndPurge both drain and purge were requested when deleting a subscription
+	EventStreamsSubscriptionDeleteDrainAndPurge = "Only one of drain or purge can be requested when deleting a subscription"
+	// EventStreamsSubscriptionDrainSuspended a subscription cannot be drained while its stream is not delivering events
+	EventStreamsSubscriptionDrainSuspended = "Cannot drain subscription '%s' as event stream '%s' is suspended"
+	// EventStreamsSubscriptionDrainTimeout the captured events of a subscription were not delivered in time to delete it
+	EventStreamsSubscriptionDrainTimeout = "Timed out after %s waiting for subscription '%s' to deliver its captured events. The subscription has not been deleted"
+	// EventStreamsSubscriptionDrainBadTimeout the timeout to drain a subscription is not a number of seconds
+	EventStreamsSubscriptionDrainBadTimeout = "Invalid drain timeout '%s'. Supply a number of seconds"
+	// EventStreamsSuspendUntilInvalid a suspend request did not supply exactly one of a block or time to resume at
+	EventStreamsSuspendUntilInvalid = "Supply one of a block number or a time to suspend the stream until"
+	// EventStreamsSuspendUntilBadBlock the block to suspend a stream until is not a number
+	EventStreamsSuspendUntilBadBlock = "Invalid block number '%s' to suspend the stream until"
+	// EventStreamsSuspendUntilBadTime the time to suspend a stream until is not in RFC3339 format
+	EventStreamsSuspendUntilBadTime = "Invalid time '%s' to suspend the stream until. Use RFC3339 format"
+	// EventStreamsAlertInvalidURL the alert webhook URL is invalid
+	EventStreamsAlertInvalidURL = "Invalid URL '%s' for the event stream alert webhook"
 	// EventStreamsInvalidDistributionMode unknown distribution mode
 	EventStreamsInvalidDistributionMode = "Invalid distribution mode '%s'. Valid distribution modes are: 'workloadDistribution' and 'broadcast'."
+	// EventStreamsMigrateExportTimeout the stream did not stop delivering batches in time to be exported
+	EventStreamsMigrateExportTimeout = "Timed out after %s waiting for event stream '%s' to stop. The stream has been suspended, but not exported"
+	// EventStreamsMigrateExists the stream or subscription being imported already exists on this instance
+	EventStreamsMigrateExists = "Cannot import %s '%s' as it already exists"
+	// EventStreamsMigrateSubscriptionStream a subscription being imported is not on the stream being imported
+	EventStreamsMigrateSubscriptionStream = "Subscription '%s' is not on the imported event stream '%s'"
 
 	// KakfaProducerConfirmMsgUnknown we received a confirmation callback, but we aren't expecting it
 	KakfaProducerConfirmMsgUnknown = "Received confirmation for message not in in-flight map: %s"
@@ -148,6 +342,30 @@ const (
 	HDWalletSigningBadData = "Unexpected response from HDWallet"
 	// HDWalletSigningNoConfig we had a request for HD Wallet signing, but we don't have the required config
 	HDWalletSigningNoConfig = "No HD Wallet Configuration"
+	// SignerBackendUnknown a request selected a signer backend that does not exist
+	SignerBackendUnknown = "Unknown signer '%s'. Must be one of: %s"
+	// SignerBackendNotConfigured a request selected a signer backend that is not configured on this gateway
+	SignerBackendNotConfigured = "The '%s' signer is not configured"
+	// SignerBackendFromMismatch the from address of a request cannot be signed by the signer backend it selected
+	SignerBackendFromMismatch = "The '%s' signer cannot sign for from address '%s'"
+	// KMSSigningNoKey the KMS signer has no key configured for the from address of a request
+	KMSSigningNoKey = "No KMS key is configured for address '%s'"
+	// KMSSigningFailed problem returned from the remote KMS signing API
+	KMSSigningFailed = "KMS signing failed"
+	// KMSSigningBadData we got a response from the KMS, but not with a signature of the transaction
+	KMSSigningBadData = "Unexpected response from KMS"
+	// KMSBadURLTemplate the configured URL template of the KMS is not a valid go template
+	KMSBadURLTemplate = "Invalid KMS URL template: %s"
+	// KMSBadChainID the configured chain ID of the KMS is not an integer
+	KMSBadChainID = "Invalid KMS chain ID '%s'. Must be a decimal or 0x prefixed hex integer"
+	// KeystoreNoKey the keystore has no key file for the from address of a request
+	KeystoreNoKey = "No key for address '%s' in the keystore"
+	// KeystoreLoadFailed a key file in the keystore could not be read or decrypted
+	KeystoreLoadFailed = "Failed to load key for address '%s' from the keystore: %s"
+	// KeystoreUnsupported a key file in the keystore uses a cipher or key derivation that is not supported
+	KeystoreUnsupported = "Unsupported keystore %s '%s'"
+	// KeystoreBadPassword the MAC of a key file in the keystore did not match, so the password is wrong
+	KeystoreBadPassword = "Could not decrypt the key with the keystore password"
 
 	// HelperStrToAddressRequiredField re-usable error for missing fields
 	HelperStrToAddressRequiredField = "'%s' must be supplied"
@@ -159,6 +377,8 @@ const (
 	HelperYAMLorJSONPayloadReadFailed = "Unable to read input data: %s"
 	// HelperYAMLorJSONPayloadParseFailed input message got error parsing
 	HelperYAMLorJSONPayloadParseFailed = "Unable to parse as YAML or JSON: %s"
+	// HelperJSONTrailingData there was more content after the JSON value
+	HelperJSONTrailingData = "Invalid JSON: unexpected data after the end of the value"
 
 	// HTTPRequesterSerializeFailed common HTTP request utility for extensions, failed to serialize request
 	HTTPRequesterSerializeFailed = "Failed to serialize request payload: %s"
@@ -174,8 +394,29 @@ const (
 	HTTPRequesterResponseMissingField = "'%s' missing in %s response"
 	// HTTPRequesterResponseNonStringField common HTTP request utility for extensions, expected string for field in response
 	HTTPRequesterResponseNonStringField = "'%s' not a string in %s response"
+	// HTTPRequesterInvalidHeader a configured header for HTTP requests is not a string, or array of strings
+	HTTPRequesterInvalidHeader = "Header '%s' must be a string, or an array of strings"
+	// HTTPRequesterInvalidProxyURL the configured outbound HTTP proxy URL could not be parsed
+	HTTPRequesterInvalidProxyURL = "Invalid proxy URL '%s'"
 	// HTTPRequesterResponseNullField common HTTP request utility for extensions, expected non-empty response field
 	HTTPRequesterResponseNullField = "'%s' empty (or null) in %s response"
+	// HTTPRequesterTimeout common HTTP request utility for extensions, the request did not complete within the configured timeout
+	HTTPRequesterTimeout = "%s did not respond within %s"
+	// HTTPRequesterResponseTooLarge common HTTP request utility for extensions, the response was larger than the configured limit
+	HTTPRequesterResponseTooLarge = "%s response exceeded the maximum size of %d bytes"
+	// HTTPRequesterBusy common HTTP request utility for extensions, no slot became free for a request within the timeout
+	HTTPRequesterBusy = "Timed out waiting for one of the %[2]d concurrent requests to %[1]s to complete"
+
+	// LogsQueryInvalidBlock a block number of a historical log query is not a number, or latest
+	LogsQueryInvalidBlock = "Invalid block number '%s'. Must be a decimal or 0x prefixed hex number, or latest"
+	// LogsQueryInvalidBlockRange the start block of a historical log query is after the end block
+	LogsQueryInvalidBlockRange = "Invalid block range. From block %d is after to block %d"
+	// LogsQueryInvalidTopic a topic filter of a historical log query is not a 32 byte hex value
+	LogsQueryInvalidTopic = "Invalid topic '%s'. Must be a 0x prefixed 32 byte hex value, or empty to match any topic"
+	// LogsQueryInvalidCursor the continuation cursor of a historical log query could not be parsed
+	LogsQueryInvalidCursor = "Invalid cursor '%s'"
+	// LogsQueryInvalidLimit the page limit or chunk size of a historical log query is not a positive number
+	LogsQueryInvalidLimit = "Invalid %s '%s'. Must be a positive number"
 
 	// ReceiptStoreDisabled not configured
 	ReceiptStoreDisabled = "Receipt store not enabled"
@@ -185,6 +426,8 @@ const (
 	ReceiptStoreMongoDBConnect = "Unable to connect to MongoDB: %s"
 	// ReceiptStoreMongoDBIndex couldn't create MongoDB index
 	ReceiptStoreMongoDBIndex = "Unable to create index: %s"
+	// ReceiptStoreMongoDBPartitions couldn't list the existing time partitions of the receipt store
+	ReceiptStoreMongoDBPartitions = "Unable to list the receipt store partitions: %s"
 	// ReceiptStoreSerializeResponse problem sending a receipt stored back over the REST API
 	ReceiptStoreSerializeResponse = "Error serializing response"
 	// ReceiptStoreInvalidRequestID bad ID query
@@ -197,12 +440,34 @@ const (
 	ReceiptStoreInvalidRequestBadSkip = "Invalid 'skip' query parameter"
 	// ReceiptStoreInvalidRequestBadSince bad since
 	ReceiptStoreInvalidRequestBadSince = "since cannot be parsed as RFC3339 or millisecond timestamp"
+	// ReplySchemaVersionUnsupported replies cannot be translated to the schema version requested
+	ReplySchemaVersionUnsupported = "Unsupported reply schema version '%s'. Supported versions are %d to %d"
+	// ReceiptStoreInvalidRequestBadUntil bad until
+	ReceiptStoreInvalidRequestBadUntil = "until cannot be parsed as RFC3339 or millisecond timestamp"
+	// ReceiptStoreInvalidFeeReportGroupBy the fee report cannot be grouped by the requested field
+	ReceiptStoreInvalidFeeReportGroupBy = "Invalid 'groupBy' query parameter '%s'. Must be day, from or contract"
 	// ReceiptStoreFailedQuery wrapper over detailed error
 	ReceiptStoreFailedQuery = "Error querying replies: %s"
+	// ReceiptStoreResponseTooLarge the serialized receipts are larger than the configured maximum response size
+	ReceiptStoreResponseTooLarge = "Response of %d bytes exceeds the maximum size of %d bytes. Use a smaller limit"
 	// ReceiptStoreFailedQuerySingle wrapper over detailed error
 	ReceiptStoreFailedQuerySingle = "Error querying reply: %s"
 	// ReceiptStoreFailedNotFound receipt isn't in the store
 	ReceiptStoreFailedNotFound = "Receipt not available"
+	// ReceiptStoreIntegrityDisabled verification was requested, but receipts are not being chained
+	ReceiptStoreIntegrityDisabled = "Receipt integrity chaining is not enabled"
+	// ReceiptStoreIntegrityBadDepth the number of records to verify is not a positive number within the query limit
+	ReceiptStoreIntegrityBadDepth = "Invalid 'depth' query parameter. Must be between 1 and %d"
+	// ReceiptStoreIntegrityChainHead the newest record of a chain could not be loaded to link the next receipt to
+	ReceiptStoreIntegrityChainHead = "Failed to load the newest receipt of the integrity chain: %s"
+	// ReceiptStoreIntegrityUnchained the receipt was stored before integrity chaining was enabled
+	ReceiptStoreIntegrityUnchained = "Receipt was not stored with an integrity hash"
+	// ReceiptStoreIntegrityHashMismatch the content of a receipt does not match its hash
+	ReceiptStoreIntegrityHashMismatch = "Receipt content does not match its integrity hash"
+	// ReceiptStoreIntegrityMissingPrev the previous record of the chain is not in the store
+	ReceiptStoreIntegrityMissingPrev = "Previous receipt '%s' in the chain is not available"
+	// ReceiptStoreIntegrityBrokenLink the previous record of the chain does not match the hash recorded for it
+	ReceiptStoreIntegrityBrokenLink = "Previous receipt '%s' does not match the hash and sequence recorded for it"
 
 	// RemoteRegistryCacheInit initialzation issue for remote contract registry
 	RemoteRegistryCacheInit = "Failed to initialize cache for remote registry: %s"
@@ -223,10 +488,14 @@ const (
 	RESTGatewayInstanceNotFound = "Instance not found"
 	// RESTGatewayEventNotDeclared attempt to subscribe to an event on an instance that does not exist
 	RESTGatewayEventNotDeclared = "Event '%s' is not declared in the ABI"
+	// RESTGatewayUnknownGetOperation a GET request on a method or event path with an operation other than schema
+	RESTGatewayUnknownGetOperation = "Unknown operation '%s'. Use GET on 'schema' of an event for the JSON schema of its payload"
 	// RESTGatewayMethodNotDeclared attempt to invoke a method name that does not exist in the ABI, or register globally for an event that doesn't exist
 	RESTGatewayMethodNotDeclared = "Method or Event '%s' is not declared in the ABI of contract '%s'"
 	// RESTGatewayInvalidToAddress failed to parse a 'to' address supplied on a path
 	RESTGatewayInvalidToAddress = "To Address must be a 40 character hex string (0x prefix is optional)"
+	// RESTGatewayRequestTooLarge the body of a request is larger than the configured maximum
+	RESTGatewayRequestTooLarge = "Request body exceeds the maximum size of %d bytes"
 	// RESTGatewayInvalidFromAddress failed to parse a 'from' address supplied on a path
 	RESTGatewayInvalidFromAddress = "From Address must be a 40 character hex string (0x prefix is optional)"
 	// RESTGatewayMissingParameter did not supply a parameter required by the method
@@ -235,16 +504,68 @@ const (
 	RESTGatewayMissingFromAddress = "Please specify a valid address in the '%[1]s-from' query string parameter or x-%[2]s-from HTTP header"
 	// RESTGatewaySubscribeMissingStreamParameter missed the ID of the stream when registering
 	RESTGatewaySubscribeMissingStreamParameter = "Must supply a 'stream' parameter in the body or query"
+	// RESTGatewaySubscribeBadAutoRegister the auto-registration options on a subscription could not be parsed
+	RESTGatewaySubscribeBadAutoRegister = "Invalid 'autoRegister' options: %s"
+	// RESTGatewaySubscribeBadEventOverride the ABI fragment supplied to decode the events of a subscription is invalid
+	RESTGatewaySubscribeBadEventOverride = "Invalid 'event' ABI fragment: %s"
+	// RESTGatewaySubscribeEventOverrideName the ABI fragment supplied to decode the events of a subscription is for a different event
+	RESTGatewaySubscribeEventOverrideName = "The 'event' ABI fragment is for event '%s' not '%s'"
 	// RESTGatewayMixedPrivateForAndGroupID confused privacy group info, using simple/Tessera style as well as pre-defined/Orion style
 	RESTGatewayMixedPrivateForAndGroupID = "%[1]s-privatefor and %[1]s-privacygroupid are mutually exclusive"
 	// RESTGatewayEventManagerInitFailed constructor failure for event manager
 	RESTGatewayEventManagerInitFailed = "Event-stream subscription manager: %s"
 	// RESTGatewayEventStreamInvalid attempt to create an event stream with invalid parameters
 	RESTGatewayEventStreamInvalid = "Invalid event stream specification: %s"
+	// RESTGatewaySubscriptionInvalid attempt to create a subscription with an invalid request body
+	RESTGatewaySubscriptionInvalid = "Invalid subscription request: %s"
+	// RESTGatewaySubscriptionInvalidAddress the address of a subscription is not an address, or a registered contract name
+	RESTGatewaySubscriptionInvalidAddress = "Invalid contract address or registered name '%s'"
+	// RESTGatewayEventDefinitionsInvalid attempt to import stream and subscription definitions that could not be parsed
+	RESTGatewayEventDefinitionsInvalid = "Invalid event stream definitions: %s"
+	// RESTGatewayEventMigrationInvalid attempt to import an exported event stream that could not be parsed
+	RESTGatewayEventMigrationInvalid = "Invalid event stream migration: %s"
+	// RESTGatewayEventExportBadTimeout the timeout for an event stream export is not a number
+	RESTGatewayEventExportBadTimeout = "Invalid export timeout '%s'. Supply a number of seconds"
+	// RESTGatewayIdleTimeoutInvalid the idle timeout query parameter could not be parsed
+	RESTGatewayIdleTimeoutInvalid = "Invalid idle timeout '%s'. Must be a positive number of seconds"
+	// RESTGatewaySubscriptionNameNotFound no subscription has the requested name
+	RESTGatewaySubscriptionNameNotFound = "Subscription with name '%s' not found"
+	// RESTGatewaySubscriptionNameAmbiguous the name is used by subscriptions on more than one stream
+	RESTGatewaySubscriptionNameAmbiguous = "Multiple subscriptions have the name '%s'. Specify a stream to select one"
 	// RESTGatewayPostDeployMissingAddress after deployment the receipt did not contain a contract address
 	RESTGatewayPostDeployMissingAddress = "%s: Missing contract address in receipt"
+	// RESTGatewayPostDeployHookInvalid a post-deploy hook must be either a webhook or a script
+	RESTGatewayPostDeployHookInvalid = "Post-deploy hook %d must have either a url or a script"
+	// RESTGatewayPostDeployHookStatus a post-deploy webhook returned a non-success status
+	RESTGatewayPostDeployHookStatus = "Post-deploy webhook returned status %d"
+	// RESTGatewayPostDeployHookScript a post-deploy script exited with an error
+	RESTGatewayPostDeployHookScript = "Post-deploy script failed: %s: %s"
+	// RESTGatewayParamTransformHookInvalid a parameter transform hook must have a webhook URL
+	RESTGatewayParamTransformHookInvalid = "Parameter transform hook %d must have a url"
+	// RESTGatewayParamTransformFailed a parameter transform plugin or webhook rejected, or failed to process, the request
+	RESTGatewayParamTransformFailed = "Parameter transform '%s' failed: %s"
+	// RESTGatewayParamTransformStatus a parameter transform webhook returned a non-success status
+	RESTGatewayParamTransformStatus = "Parameter transform webhook returned status %d: %s"
+	// RESTGatewayInvokeNotTransaction an invocation rule targets a method that does not change state
+	RESTGatewayInvokeNotTransaction = "Method '%s' of contract '%s' is a view or pure method, so cannot be invoked by a rule"
 	// RESTGatewayRegistrationSuppliedInvalidAddress invalid address when registering an existing instance of a contract
 	RESTGatewayRegistrationSuppliedInvalidAddress = "Invalid address in path - must be a 40 character hex string with optional 0x prefix"
+	// RESTGatewayRegistrationNoCode verification of an address being registered found no contract deployed there
+	RESTGatewayRegistrationNoCode = "No contract code found at address 0x%s"
+	// RESTGatewayRegistrationCodeMismatch verification of an address being registered found different code deployed
+	RESTGatewayRegistrationCodeMismatch = "Contract code at address 0x%s does not match the runtime bytecode for ABI '%s'"
+	// RESTGatewayRegistrationNoRuntimeBytecode bytecode verification was requested, but the ABI was stored without runtime bytecode
+	RESTGatewayRegistrationNoRuntimeBytecode = "Runtime bytecode is not available for ABI '%s' to verify against"
+	// RESTGatewayRegistrationMissingName registering an instance with a gateway requires a name to look it up by
+	RESTGatewayRegistrationMissingName = "Must supply a %s-register name for the instance when registering with a gateway"
+	// RESTGatewayRegistrationVerifyUnavailable code verification requires a JSON/RPC connection
+	RESTGatewayRegistrationVerifyUnavailable = "Contract code verification is not available without a JSON/RPC connection"
+	// RESTGatewayFingerprintUnavailable matching an ABI by bytecode fingerprint requires a JSON/RPC connection
+	RESTGatewayFingerprintUnavailable = "Bytecode fingerprinting is not available without a JSON/RPC connection"
+	// RESTGatewayFingerprintNoMetadata the code deployed at an address has no compiler metadata to fingerprint
+	RESTGatewayFingerprintNoMetadata = "No contract instance registered with address %s, and the contract code has no compiler metadata to fingerprint"
+	// RESTGatewayFingerprintNoMatch no stored ABI was compiled to the same metadata as the code deployed at an address
+	RESTGatewayFingerprintNoMatch = "No contract instance registered with address %s, and no stored ABI matches its bytecode fingerprint"
 	// RESTGatewaySyncMsgTypeMismatch sync-invoke code paths in REST API Gateway should be maintained such that this cannot happen
 	RESTGatewaySyncMsgTypeMismatch = "Unexpected condition (message types do not match when processing)"
 	// RESTGatewaySyncWrapErrorWithTXDetail wraps a low level error with transaction hash context on sync APIs before returning
@@ -255,6 +576,56 @@ const (
 	RESTGatewayMethodABIInvalid = "Invalid method '%s' in ABI: %s"
 	// RESTGatewayEventABIInvalid error processing method from ABI
 	RESTGatewayEventABIInvalid = "Invalid event '%s' in ABI: %s"
+	// RESTGatewayFallbackCallUnsupported the receive and fallback functions can only be invoked by sending a transaction
+	RESTGatewayFallbackCallUnsupported = "The '%s' function can only be invoked with a POST to send a transaction"
+	// RESTGatewayEncodeUnsupported the receive and fallback functions take raw calldata, so there is nothing to encode
+	RESTGatewayEncodeUnsupported = "Calldata cannot be encoded for the '%s' function"
+	// RESTGatewayInvalidRPCTimeout the per-request RPC timeout could not be parsed
+	RESTGatewayInvalidRPCTimeout = "Invalid %s-rpctimeout '%s' - must be a number of seconds, or a duration such as '500ms'"
+	// RESTGatewayReadPoolBusy no worker in the read-only call pool became free before the queue timeout
+	RESTGatewayReadPoolBusy = "All %d read-only call workers remained busy for %s"
+	// RESTGatewayRPCTimeoutAsyncUnsupported the per-request RPC timeout cannot be applied to transactions submitted asynchronously
+	RESTGatewayRPCTimeoutAsyncUnsupported = "%s-rpctimeout is only supported for calls and synchronous transactions"
+	// RESTGatewayBulkCallBadRequest the body of a bulk call request could not be parsed
+	RESTGatewayBulkCallBadRequest = "Invalid bulk call request: %s"
+	// RESTGatewayBulkCallNoAddresses a bulk call was made without any contract addresses
+	RESTGatewayBulkCallNoAddresses = "Must supply at least one contract address or registered name in 'addresses'"
+	// RESTGatewayBulkCallTooManyAddresses a bulk call exceeded the maximum number of contract addresses
+	RESTGatewayBulkCallTooManyAddresses = "Too many addresses in bulk call request: %d (maximum %d)"
+	// RESTGatewayBulkCallNotView a bulk call was attempted on a method that changes state
+	RESTGatewayBulkCallNotView = "Method '%s' is not a view or pure function, so cannot be called in bulk"
+	// RESTGatewayStorageInvalidAddress the address for a storage read is not an address, or a registered contract name
+	RESTGatewayStorageInvalidAddress = "Invalid contract address or registered name '%s'"
+	// RESTGatewayDecodeBadRequest the body of a decode request could not be parsed
+	RESTGatewayDecodeBadRequest = "Invalid decode request: %s"
+	// RESTGatewayDecodeInvalidData the data of a decode request is not hex encoded calldata
+	RESTGatewayDecodeInvalidData = "Must supply hex encoded calldata in 'data', including the 4 byte method selector"
+	// RESTGatewayDecodeMethodNotFound no method in the ABIs searched matched the selector of the calldata
+	RESTGatewayDecodeMethodNotFound = "No method found matching selector %s"
+	// RESTGatewaySafeNotConfigured a transaction was to be proposed to a Safe, but no Safe transaction service is configured
+	RESTGatewaySafeNotConfigured = "Proposing transactions to a Safe requires the Safe transaction service URL to be configured"
+	// RESTGatewaySafeInvalidAddress the address of the Safe multisig contract is not valid
+	RESTGatewaySafeInvalidAddress = "Invalid Safe address '%s'"
+	// RESTGatewaySafeDeployUnsupported deployments cannot be proposed to a Safe
+	RESTGatewaySafeDeployUnsupported = "Contract deployments cannot be proposed to a Safe"
+	// RESTGatewaySafeInvalidNonce the nonce supplied for a Safe transaction is not a valid integer
+	RESTGatewaySafeInvalidNonce = "Invalid Safe nonce '%s'"
+	// RESTGatewaySafeInvalidTxHash the Safe transaction hash to track is not a 32 byte hex value
+	RESTGatewaySafeInvalidTxHash = "Invalid Safe transaction hash '%s'"
+	// RESTGatewaySafeFromBlockRequired the block to search for the execution of a Safe transaction from must be supplied
+	RESTGatewaySafeFromBlockRequired = "%s-fromblock is required, such as the blockNumber returned when the transaction was proposed"
+	// RESTGatewaySafeCallFailed reading the nonce or transaction hash from the Safe contract failed
+	RESTGatewaySafeCallFailed = "Failed to call '%s' on Safe %s: %s"
+	// RESTGatewaySafeProposerInvalid the proposer of a Safe transaction must sign with eth_sign, so must be an address the node holds the key for
+	RESTGatewaySafeProposerInvalid = "The proposer of a Safe transaction must be an account the node can sign with, not '%s'"
+	// RESTGatewaySafeProposerNotOwner the proposer of a Safe transaction is not one of the owners of the Safe
+	RESTGatewaySafeProposerNotOwner = "The proposer %s is not an owner of Safe %s"
+	// RESTGatewaySafeSignFailed the node failed to sign the Safe transaction hash with the proposer's account
+	RESTGatewaySafeSignFailed = "Failed to sign the Safe transaction hash with %s: %s"
+	// RESTGatewaySafeServiceFailed the Safe transaction service returned an error, or could not be reached
+	RESTGatewaySafeServiceFailed = "Safe transaction service request failed: %s"
+	// RESTGatewaySafeServiceStatus the Safe transaction service returned a non-success status
+	RESTGatewaySafeServiceStatus = "Safe transaction service returned status %d: %s"
 
 	// RESTGatewayCompileContractInvalidFormData invalid form data when requesting a compilation to generate an ABI/bytecode
 	RESTGatewayCompileContractInvalidFormData = "Could not parse supplied multi-part form data: %s"
@@ -297,24 +668,148 @@ const (
 	RESTGatewayLocalStoreABIParse = "Failed to parse ABI with ID %s: %s"
 	// RESTGatewayLocalStoreMissingABI did not supply ABI JSON when attempting to install ABI (non-registry code flow)
 	RESTGatewayLocalStoreMissingABI = "Must supply ABI to install an existing ABI into the REST Gateway"
+	// RESTGatewayABIUploadInvalid the JSON body of an ABI upload could not be parsed
+	RESTGatewayABIUploadInvalid = "Invalid ABI upload: %s"
+	// RESTGatewayABIUploadBadBytecode the bytecode of an ABI upload is not valid hex
+	RESTGatewayABIUploadBadBytecode = "Invalid hex in '%s' of ABI upload: %s"
+	// RESTGatewayInvalidBytesEncoding the encoding requested for bytes parameters is not supported
+	RESTGatewayInvalidBytesEncoding = "Invalid bytes encoding '%s'. Supported encodings are 'hex' and 'base64'"
+	// RESTGatewayFormBodyParseFailed a form-encoded or multipart body could not be parsed
+	RESTGatewayFormBodyParseFailed = "Unable to parse form data: %s"
+	// RESTGatewayFormBodyFileReadFailed a file in a multipart body could not be read
+	RESTGatewayFormBodyFileReadFailed = "Unable to read file for form field '%s': %s"
+	// RESTGatewayFormBodyFieldNotJSON a form field for an array or tuple parameter could not be parsed as JSON
+	RESTGatewayFormBodyFieldNotJSON = "Form field '%s' for type %s must be a JSON value: %s"
+	// RESTGatewayBodyValidationFailed the request body failed strict validation against the parameters of the method
+	RESTGatewayBodyValidationFailed = "Request body is invalid for '%s' (%d errors)"
+	// RESTGatewayBodyUnknownField strict validation found a field in the body that is not a parameter of the method
+	RESTGatewayBodyUnknownField = "Unknown field"
+	// RESTGatewayBodyMissingField strict validation found a tuple in the body without one of its components
+	RESTGatewayBodyMissingField = "Missing field"
+	// RESTGatewayBodyInvalidValue strict validation found a value in the body that does not match the type of the parameter
+	RESTGatewayBodyInvalidValue = "Value is not a valid %s"
 	// RESTGatewayInvalidABI invalid serialized ABI in msg
 	RESTGatewayInvalidABI = "Invalid ABI: %s"
 	// RESTGatewayLocalStoreContractSavePostDeploy local filesystem storage failure for contract instance post deploy (non-registry code flow)
 	RESTGatewayLocalStoreContractSavePostDeploy = "%s: Failed to write deployment details: %s"
+	// RESTGatewayRegisteredNameInvalid hierarchical friendly name with an empty path segment
+	RESTGatewayRegisteredNameInvalid = "Invalid registered name '%s' - the segments of the name separated by '/' cannot be empty"
 	// RESTGatewayFriendlyNameClash duplicate friendly name when reigstering
 	RESTGatewayFriendlyNameClash = "Contract address %s is already registered for name '%s'"
+	// RESTGatewayContractNameUpdateInvalid the body of a request to change the friendly name of a contract is invalid
+	RESTGatewayContractNameUpdateInvalid = "Must supply a 'registeredAs' name for the contract, or an empty string to remove the name"
+	// RESTGatewayTxPolicyInvalid the body of a request to set the transaction policy of an ABI or contract is invalid
+	RESTGatewayTxPolicyInvalid = "Invalid transaction policy: %s"
+	// RESTGatewayTxPolicyBadNumber a default or maximum in a transaction policy is not a non-negative integer
+	RESTGatewayTxPolicyBadNumber = "The %s of the transaction policy must be a non-negative integer: '%s'"
+	// RESTGatewayTxPolicyDefaultExceedsMax the default of a field in a transaction policy is above its maximum
+	RESTGatewayTxPolicyDefaultExceedsMax = "The default %s of %s exceeds the maximum of %s"
+	// RESTGatewayTxPolicyMaxExceeded a request exceeded a maximum in the transaction policy of the ABI or contract
+	RESTGatewayTxPolicyMaxExceeded = "The %s of %s exceeds the maximum of %s allowed by the transaction policy"
+	// RESTGatewayTxPolicySignerNotAllowed a request selected a signer backend that the transaction policy does not allow
+	RESTGatewayTxPolicySignerNotAllowed = "The '%s' signer is not allowed by the transaction policy. Allowed: %s"
+	// RESTGatewayTxPolicyLoad local filesystem failure reading the stored transaction policy of an ABI
+	RESTGatewayTxPolicyLoad = "Failed to load transaction policy of ABI %s: %s"
+	// RESTGatewayTxPolicySave local filesystem storage failure for the transaction policy of an ABI
+	RESTGatewayTxPolicySave = "Failed to write transaction policy: %s"
+	// RESTGatewayMethodNotAllowed the method is blocked by the allow or deny list of the contract instance
+	RESTGatewayMethodNotAllowed = "Method '%s' is not allowed on contract %s"
+	// RESTGatewayMethodFilterBothLists both an allow list and a deny list were supplied for a contract instance
+	RESTGatewayMethodFilterBothLists = "Only one of an allow list or a deny list of methods can be set on a contract"
+	// RESTGatewayMethodFilterUnknownMethod a method in an allow or deny list is not in the ABI of the contract
+	RESTGatewayMethodFilterUnknownMethod = "Method '%s' is not declared in the ABI of the contract"
+	// RESTGatewayMethodFilterInvalid the body of a request to set the method lists of a contract could not be parsed
+	RESTGatewayMethodFilterInvalid = "Invalid method lists: %s"
+	// RESTGatewayReplayInFlight a request was submitted with the ID of a request that is still being processed
+	RESTGatewayReplayInFlight = "A request with ID '%s' is already being processed"
+	// RESTGatewayReplayMismatch a request was submitted with the ID of an earlier request for a different transaction
+	RESTGatewayReplayMismatch = "A different request was already submitted with ID '%s'"
+	// RESTGatewaySignerAliasInvalid the name supplied for a signer alias cannot be used
+	RESTGatewaySignerAliasInvalid = "Signer alias '%s' is invalid. Must contain only letters, numbers, '.', '_' or '-', and must not be an address or HD wallet reference"
+	// RESTGatewaySignerAliasFromInvalid the target of a signer alias is not an address or HD wallet reference
+	RESTGatewaySignerAliasFromInvalid = "Must supply a 'from' address, or HD wallet reference, for the signer alias"
+	// RESTGatewaySignerAliasNotFound no signer alias exists with the supplied name
+	RESTGatewaySignerAliasNotFound = "No signer alias registered with name '%s'"
+	// RESTGatewaySignerAliasSave local filesystem storage failure for a signer alias
+	RESTGatewaySignerAliasSave = "Failed to write signer alias: %s"
+	// RESTGatewaySignerAliasDelete local filesystem failure removing a signer alias
+	RESTGatewaySignerAliasDelete = "Failed to delete signer alias: %s"
+	// RESTGatewayAccountsUnavailable listing accounts requires a JSON/RPC connection
+	RESTGatewayAccountsUnavailable = "Account listing is not available without a JSON/RPC connection"
+	// RESTGatewayUpgradeInvalid the body of a request to upgrade a proxy contract could not be parsed
+	RESTGatewayUpgradeInvalid = "Invalid upgrade request: %s"
+	// RESTGatewayUpgradeABIRequired the ABI of the new implementation was not supplied on an upgrade request
+	RESTGatewayUpgradeABIRequired = "Must supply the 'abi' of the new implementation to deploy"
+	// RESTGatewayUpgradeFromRequired an upgrade request did not supply the address to submit the transactions from
+	RESTGatewayUpgradeFromRequired = "%s-from is required, to deploy the new implementation and upgrade the proxy"
+	// RESTGatewayUpgradeUnavailable upgrading a proxy contract requires a JSON/RPC connection
+	RESTGatewayUpgradeUnavailable = "Upgrading contracts is not available without a JSON/RPC connection"
+	// RESTGatewayUpgradeNotDeployable the ABI of the new implementation was stored without bytecode
+	RESTGatewayUpgradeNotDeployable = "ABI '%s' was stored without bytecode, so cannot be deployed as the new implementation"
+	// RESTGatewayUpgradeNotProxy the contract to upgrade has no implementation address in the ERC-1967 slot
+	RESTGatewayUpgradeNotProxy = "Contract 0x%s is not an ERC-1967 proxy, as its implementation slot is empty"
+	// RESTGatewayUpgradeSafe the proxy to upgrade is governed by a Safe, so the upgrade must be proposed to the Safe
+	RESTGatewayUpgradeSafe = "Proxy 0x%s is governed by Safe %s. Deploy the new implementation, then propose '%s' to the Safe"
+	// RESTGatewayUpgradeDeployFailed the transaction deploying the new implementation did not succeed
+	RESTGatewayUpgradeDeployFailed = "Failed to deploy the new implementation: %s"
+	// RESTGatewayUpgradeTxFailed the transaction upgrading the proxy did not succeed, after the implementation was deployed
+	RESTGatewayUpgradeTxFailed = "Failed to upgrade proxy 0x%s to the new implementation %s: %s"
+	// RESTGatewayUpgradeUnexpectedReply the reply to a transaction submitted during an upgrade was not a receipt
+	RESTGatewayUpgradeUnexpectedReply = "Unexpected reply of type '%s' to a transaction of the upgrade"
+	// RESTGatewayUpgradeNotVerified the ERC-1967 slot of the proxy does not hold the new implementation after the upgrade
+	RESTGatewayUpgradeNotVerified = "Proxy 0x%s has implementation %s after the upgrade, rather than the new implementation %s"
 
 	// RPCCallReturnedError specified RPC call returned error
 	RPCCallReturnedError = "%s returned: %s"
 	// RPCConnectFailed error connecting to back-end server over JSON/RPC
 	RPCConnectFailed = "JSON/RPC connection to %s failed: %s"
+	// RPCBatchUnsupported the JSON/RPC client does not support batch requests
+	RPCBatchUnsupported = "JSON/RPC batch requests are not supported by the client"
+	// RPCProxyParseFailed a message received by the JSON/RPC proxy is not valid JSON
+	RPCProxyParseFailed = "Parse error"
+	// RPCProxyInvalidRequest a message received by the JSON/RPC proxy is not a JSON/RPC request
+	RPCProxyInvalidRequest = "Invalid request: method is required"
+	// RPCProxyMethodNotAllowed the method is not in the allow list of the JSON/RPC proxy
+	RPCProxyMethodNotAllowed = "Method '%s' is not allowed by the proxy"
+	// RPCProxyRateLimited the connection to the JSON/RPC proxy has exceeded its rate limit
+	RPCProxyRateLimited = "Rate limit exceeded"
+	// RPCCircuitBreakerOpen the node has failed repeatedly, so we are failing fast until the reset timeout
+	RPCCircuitBreakerOpen = "JSON/RPC node unavailable after %d consecutive failures. Failing fast for %.0fs"
+	// RPCPoolBadErrorPercent the error rate that quarantines a JSON/RPC endpoint is not a percentage
+	RPCPoolBadErrorPercent = "Invalid JSON/RPC endpoint quarantine error rate %d%%. Must be between 1 and 100"
+	// RPCReplayLoadFailed the recording to replay JSON/RPC responses from could not be read
+	RPCReplayLoadFailed = "Failed to load JSON/RPC responses to replay from '%s': %s"
+	// RPCReplayNoResponse no response was recorded for a JSON/RPC call made in replay mode
+	RPCReplayNoResponse = "No JSON/RPC response recorded for %s %s"
+
+	// ChaosInvalidPercent a chaos mode fault injection rate was not a percentage
+	ChaosInvalidPercent = "Invalid chaos mode %s '%d'. Must be a percentage between 0 and 100"
+	// ChaosRPCError a transient JSON/RPC error injected by chaos mode
+	ChaosRPCError = "Injected JSON/RPC failure calling %s (chaos mode): connection reset by peer"
+	// ChaosWebhookDropped a webhook delivery dropped by chaos mode
+	ChaosWebhookDropped = "Dropped webhook delivery to %s (chaos mode)"
+
+	// RecorderOpenFailed the file to record requests to could not be opened
+	RecorderOpenFailed = "Failed to open recording file '%s': %s"
+	// RecorderReadFailed a recording could not be read
+	RecorderReadFailed = "Failed to read recording file '%s': %s"
+	// ReplayRequestFailed a recorded request could not be sent to the gateway during a replay
+	ReplayRequestFailed = "Failed to replay request %d to %s: %s"
 
 	// SecurityModulePluginLoad failed to load .so
 	SecurityModulePluginLoad = "Failed to load plugin: %s"
 	// SecurityModulePluginSymbol missing symbol in plugin
 	SecurityModulePluginSymbol = "Failed to load 'SecurityModule' symbol from '%s': %s"
+	// ParamTransformerPluginSymbol missing symbol in plugin
+	ParamTransformerPluginSymbol = "Failed to load 'ParamTransformer' symbol from '%s': %s"
 	// SecurityModuleNoAuthContext missing auth context in context object at point security module is invoked
 	SecurityModuleNoAuthContext = "No auth context"
+	// SecurityModuleNotRegistered a reload of the security module was requested, but no module is registered
+	SecurityModuleNotRegistered = "No security module is registered"
+	// SecurityModuleNotReloadable the registered security module does not support reloading its configuration
+	SecurityModuleNotReloadable = "The security module does not support reloading its configuration"
+	// SecurityModuleReloadFailed the security module failed to reload its configuration, and continues with the previous one
+	SecurityModuleReloadFailed = "Failed to reload the security module configuration: %s"
 
 	// TransactionSendConstructorPackArgs RLP encoding failure for a constructor
 	TransactionSendConstructorPackArgs = "Packing arguments for constructor: %s"
@@ -326,24 +821,98 @@ const (
 	TransactionSendOutputTypeUnknown = "ABI output %d: Unable to map %s to etherueum type: %s"
 	// TransactionSendGasEstimateFailed gas estimation failed prior to sending TX
 	TransactionSendGasEstimateFailed = "Failed to calculate gas for transaction: %s"
+	// TransactionSendSubmitUncertain the connection to the node failed while submitting, so the transaction might have been accepted
+	TransactionSendSubmitUncertain = "Transaction submission might have reached the node before the connection failed. Query the transaction before retrying: %s"
+	// TransactionSendStageTimeout a stage of sending the transaction did not complete within its configured timeout
+	TransactionSendStageTimeout = "Transaction %s did not complete within %s"
+	// TransactionSendStoreRawRequiresSigner private payloads stored with storeraw need a signer that can sign the private transaction
+	TransactionSendStoreRawRequiresSigner = "Private transactions sent with storeraw must be signed by a HD wallet signer"
+	// TransactionSendPrivateSignFailed signing a private transaction failed
+	TransactionSendPrivateSignFailed = "Failed to sign private transaction: %s"
+	// TransactionSendRemoteSignBadSignature a remote signer returned a signature that is not R and S, with an optional V
+	TransactionSendRemoteSignBadSignature = "Signature of %d bytes returned by the remote signer. Must be 64 or 65 bytes"
+	// TransactionSendRemoteSignWrongSigner a remote signer returned a signature that does not recover to the from address
+	TransactionSendRemoteSignWrongSigner = "Signature returned by the remote signer does not recover to address '%s'"
+	// TransactionSendRemoteSignUnsupportedType a remote signer can only sign legacy EIP-155 transactions
+	TransactionSendRemoteSignUnsupportedType = "Transactions of type %d cannot be signed by a remote signer. Only legacy transactions are supported"
+	// TransactionSendRemoteSignFailed the signature of a remote signer could not be applied to the transaction
+	TransactionSendRemoteSignFailed = "Failed to apply the signature of the remote signer: %s"
+	// TesseraStoreRawFailed the private payload could not be stored with Tessera
+	TesseraStoreRawFailed = "Failed to store private payload with Tessera: %s"
+	// TransactionSendNodeSyncing the node is syncing, so transactions are not dispatched to it
+	TransactionSendNodeSyncing = "Node is syncing with the chain (block %v of %v)"
+	// TransactionSendNodeIsolated the node has too few peers, so transactions are not dispatched to it
+	TransactionSendNodeIsolated = "Node has %d peers. At least %d are required to dispatch transactions"
+	// TransactionSendNodeHealthCheckFailed the calls to check the health of the node failed
+	TransactionSendNodeHealthCheckFailed = "Failed to check the node is ready for transactions: %s"
+	// TransactionSendGasExceedsMax the gas supplied for a transaction is above the configured maximum
+	TransactionSendGasExceedsMax = "Gas %d exceeds the maximum of %d"
+	// TransactionSendGasEstimateExceedsMax the gas estimated for a transaction is above the configured maximum
+	TransactionSendGasEstimateExceedsMax = "Estimated gas %d exceeds the maximum of %d"
+	// TransactionSendCalldataExceedsBlockGasLimit the data of a transaction costs more gas than a whole block allows, so it can never be mined
+	TransactionSendCalldataExceedsBlockGasLimit = "Transaction data of %d bytes requires at least %d gas, which exceeds the block gas limit of %d"
+	// TransactionSendGasExceedsBlockGasLimit the gas supplied for a transaction is above the gas limit of a block, so it can never be mined
+	TransactionSendGasExceedsBlockGasLimit = "Gas %d exceeds the block gas limit of %d"
+	// TransactionSendAddressDenied the from or to address of a transaction matches the deny list of the address policy
+	TransactionSendAddressDenied = "The %s address '%s' is denied by the address policy"
+	// TransactionSendAddressNotAllowed the from or to address of a transaction does not match the allow list of the address policy
+	TransactionSendAddressNotAllowed = "The %s address '%s' is not allowed by the address policy"
+	// TransactionSendAddressPolicyBadPattern an entry in the address policy is not a valid wildcard pattern
+	TransactionSendAddressPolicyBadPattern = "Invalid address policy entry '%s': %s"
+	// TransactionSendSpendLimitBadValue a value limit in the spend limits is not a valid integer
+	TransactionSendSpendLimitBadValue = "Invalid spend limit maxValue '%s'. Must be an integer amount in wei"
+	// TransactionSendSpendLimitBadSigner an entry in the spend limits has no signer, or an invalid wildcard pattern
+	TransactionSendSpendLimitBadSigner = "Invalid spend limit signer '%s'"
+	// TransactionSendSpendLimitValueExceeded the value of a transaction would take its signer over the limit for the window
+	TransactionSendSpendLimitValueExceeded = "Transaction value of %s wei from %s exceeds the spend limit of %s wei per %s (%s wei already transferred)"
+	// TransactionSendSpendLimitGasExceeded the gas of a transaction would take its signer over the limit for the window
+	TransactionSendSpendLimitGasExceeded = "Transaction gas of %d from %s exceeds the spend limit of %d gas per %s (%d gas already spent)"
+	// TransactionSendBadMaxGas the maximum gas on a message is not a valid integer
+	TransactionSendBadMaxGas = "Invalid maxGas '%s'. Must be an integer"
 	// TransactionSendCallFailedNoRevert failed to perform an eth_call with a JSON/RPC error (not a revert)
 	TransactionSendCallFailedNoRevert = "Call failed: %s"
 	// TransactionSendCallFailedRevertMessage directly passes the revert message from the EVM
 	TransactionSendCallFailedRevertMessage = "%s"
 	// TransactionSendCallFailedRevertNoMessage when we couldn't process the EVM revert message
 	TransactionSendCallFailedRevertNoMessage = "EVM reverted. Failed to decode error message"
+	// TransactionSendCallFailedPanic the EVM reverted with a Panic(uint256) code, which we describe
+	TransactionSendCallFailedPanic = "EVM panic (code 0x%s): %s"
+	// TransactionSendCallFailedPanicUnknown the panic code is not one we recognize
+	TransactionSendCallFailedPanicUnknown = "Unknown panic code"
+	// TransactionSendCallFailedCustomError the EVM reverted with one of the custom errors declared in the ABI
+	TransactionSendCallFailedCustomError = "Custom error %s: %s"
+	// TransactionSendCallFailedCustomErrorNoArgs the arguments of a custom error could not be decoded
+	TransactionSendCallFailedCustomErrorNoArgs = "Custom error %s (failed to decode arguments: %s)"
 	// TransactionSendMissingPrivateFromOrion there is no default privateFrom in Orion, so the user must always supply it
 	TransactionSendMissingPrivateFromOrion = "private-from is required when submitting private transactions via Orion"
 	// TransactionSendPrivateTXWithExternalSigner we don't allow private transactions to be combined with a HD Wallet or other external signer currently
 	TransactionSendPrivateTXWithExternalSigner = "Signing with %s is not currently supported with private transactions"
+	// TransactionSendBlobWithExternalSigner blob transactions must be signed by the node
+	TransactionSendBlobWithExternalSigner = "Signing with %s is not currently supported with blob transactions"
+	// TransactionSendBlobPrivate blob transactions cannot be private
+	TransactionSendBlobPrivate = "Blob transactions cannot be private transactions"
+	// TransactionSendBlobLegacyGasPrice a blob transaction was supplied with a legacy gas price
+	TransactionSendBlobLegacyGasPrice = "Blob transactions use EIP-1559 fees set by the node, and cannot have a gasPrice (%s)"
+	// TransactionSendBlobMissingHashes a maxFeePerBlobGas was supplied without any blob hashes
+	TransactionSendBlobMissingHashes = "A maxFeePerBlobGas requires blobVersionedHashes"
+	// TransactionSendBadBlobVersionedHash a blob hash is not a 32 byte hex hash with the 0x01 version
+	TransactionSendBadBlobVersionedHash = "Invalid blob versioned hash '%s'. Must be a 32 byte 0x prefixed hex hash starting 0x01"
+	// TransactionSendBadMaxFeePerBlobGas a maxFeePerBlobGas is not a valid integer
+	TransactionSendBadMaxFeePerBlobGas = "Invalid maxFeePerBlobGas '%s'. Must be an integer"
 	// TransactionSendPrivateForAndPrivacyGroup mixed both params
 	TransactionSendPrivateForAndPrivacyGroup = "privacyGroupId and privateFor are mutually exclusive"
 	// TransactionSendNonceFailWithPrivacyGroup when we successfully lookup the privacy group, but cannot get the nonce
 	TransactionSendNonceFailWithPrivacyGroup = "priv_getTransactionCount for privacy group '%s' returned: %s"
 	// TransactionSendMissingMethod a request to send a transaction was received (webhook/Kafka) that was missing method details (unexpected when using REST APIs that validate this)
 	TransactionSendMissingMethod = "Method missing - must provide inline 'param' type/value pairs with a 'methodName', or an ABI in 'method'"
+	// TransactionSendReceiveWithData calldata was supplied for a receive function, which only accepts plain value transfers
+	TransactionSendReceiveWithData = "The receive function cannot be invoked with calldata - use the fallback function"
+	// TransactionSendBadCalldata the raw calldata supplied for a fallback function invocation was not valid hex
+	TransactionSendBadCalldata = "Converting supplied 'data' to bytes: %s"
 	// TransactionSendBadNonce a user-supplied nonce string in the JSON input cannot be processed
 	TransactionSendBadNonce = "Converting supplied 'nonce' to integer: %s"
+	// TransactionNonceReportUnavailable the nonce report requires transactions to be processed by the gateway itself
+	TransactionNonceReportUnavailable = "Nonce report is not available, as transactions are not processed by this gateway"
 	// TransactionSendBadValue a user-supplied value (eth amount to transfer) string in the JSON input cannot be processed
 	TransactionSendBadValue = "Converting supplied 'value' to big integer: %s"
 	// TransactionSendBadGas a user-supplied gas (maximum gas to spend on the TX) string in the JSON input cannot be processed
@@ -356,6 +925,10 @@ const (
 	TransactionSendInputTypeBadJSONTypeForNumber = "Method '%s' param %s is a %s: Must supply a number or a string (supplied=%s)"
 	// TransactionSendInputTypeBadJSONTypeForArray the input JSON value supplied for a method parameter was not compatible with coercion to an array
 	TransactionSendInputTypeBadJSONTypeForArray = "Method '%s' param %s is a %s: Must supply an array (supplied=%s)"
+	// TransactionSendInputTypeBadArrayLength the input JSON array supplied for a fixed size array parameter had the wrong number of entries
+	TransactionSendInputTypeBadArrayLength = "Method '%s' param %s is a %s: Must supply an array of %d entries (supplied=%d)"
+	// TransactionSendInputTypeBadArrayEntry an entry in an input JSON array converted to a value that does not fit the element type of the array
+	TransactionSendInputTypeBadArrayEntry = "Method '%s' param %s is a %s: Value cannot be used as an array entry (converted=%s)"
 	// TransactionSendInputTypeBadNull the input JSON value supplied was null
 	TransactionSendInputTypeBadNull = "Method '%s' param %s: Cannot supply a null value"
 	// TransactionSendInputTypeBadJSONTypeForBoolean the input JSON value supplied for a method parameter was not compatible with coercion to a boolean
@@ -364,12 +937,16 @@ const (
 	TransactionSendInputTypeBadJSONTypeForString = "Method '%s' param %s: Must supply a string (supplied=%s)"
 	// TransactionSendInputTypeAddress the input JSON value supplied for a method parameter couldn't be parsed as an eth address
 	TransactionSendInputTypeAddress = "Method '%s' param %s: Could not be converted to a hex address (supplied=%s)"
+	// TransactionSendInputTypeAddressChecksum a mixed-case address was supplied that failed EIP-55 checksum validation
+	TransactionSendInputTypeAddressChecksum = "Method '%s' param %s: Mixed-case address failed EIP-55 checksum validation (supplied=%s)"
 	// TransactionSendInputTypeBadJSONTypeForAddress the input JSON value supplied for a method parameter was not compatible with coercion to an eth address
 	TransactionSendInputTypeBadJSONTypeForAddress = "Method '%s' param %s is a %s: Must supply a hex address string (supplied=%s)"
 	// TransactionSendInputTypeBadJSONTypeInNumericArray one of the entries inside of a numeric array, is not valid as a number
 	TransactionSendInputTypeBadJSONTypeInNumericArray = "Method '%s' param %s is a %s: Invalid entry in number array at index %d (%s)"
 	// TransactionSendInputTypeBadByteOutsideRange one of the entries inside of a byte array, is a number outside the range for bytes
 	TransactionSendInputTypeBadByteOutsideRange = "Method '%s' param %s is a %s: Invalid number - outside of range for byte"
+	// TransactionSendInputTypeBadBase64 a bytes parameter marked as base64 could not be decoded
+	TransactionSendInputTypeBadBase64 = "Method '%s' param %s is a %s: Invalid base64: %s"
 	// TransactionSendInputTypeBadJSONTypeForBytes one of the entries inside of a byte array, is a number outside the range for bytes
 	TransactionSendInputTypeBadJSONTypeForBytes = "Method '%s' param %s is a %s: Must supply a hex string, or number array"
 	// TransactionSendInputTypeBadJSONTypeForTuple if we are provided a non object input on the JSON for a struct (tuple)
@@ -395,12 +972,29 @@ const (
 	TransactionSendReceiptCheckError = "Error obtaining transaction receipt (%d retries): %s"
 	// TransactionSendReceiptCheckTimeout we didn't have a problem asking the node for a receipt, but the transaction wasn't mined at the end of the timeout
 	TransactionSendReceiptCheckTimeout = "Timed out waiting for transaction receipt"
+	// TransactionConfirmationTimeout the transaction was mined, but the chain did not reach the required number of confirmations before the timeout
+	TransactionConfirmationTimeout = "Timed out waiting for %d confirmations of the transaction"
 
 	// TransactionCallInvalidBlockNumber on "eth_call" the optional parameter for the target blocknumber failed to parse to a big integer
 	TransactionCallInvalidBlockNumber = "Invalid blocknumber. Failed to parse into big integer"
+	// TransactionCallBlockBeforeGenesis the timestamp supplied as the blocknumber for a call is before the first block
+	TransactionCallBlockBeforeGenesis = "No block was mined at or before %s"
+	// TransactionRPCCallMissingMethod an RPCCall message did not name the JSON/RPC method to invoke
+	TransactionRPCCallMissingMethod = "RPCCall message must have a 'method'"
+	// TransactionRPCCallMethodNotAllowed the method of an RPCCall message is not in the rpc-call-methods allow list
+	TransactionRPCCallMethodNotAllowed = "JSON/RPC method '%s' is not allowed for RPCCall messages"
+	// TransactionRPCCallFailed the node returned an error for the method of an RPCCall message
+	TransactionRPCCallFailed = "JSON/RPC method '%s' failed: %s"
+	// StorageSlotInvalid the slot for an "eth_getStorageAt" read is not a decimal or hex number of up to 32 bytes
+	StorageSlotInvalid = "Invalid storage slot '%s'. Must be a decimal or 0x prefixed hex number of up to 32 bytes"
+
+	// NumberFormatInvalid the format requested for the numbers in the outputs of a call is not supported
+	NumberFormatInvalid = "Invalid number format '%s'. Must be 'string', 'number' or 'hex'"
 
 	// UnpackOutputsFailed RLP decoding of outputs, logs, or events failed
 	UnpackOutputsFailed = "Failed to unpack values: %s"
+	// UnpackInputsSelectorMismatch calldata was decoded against a method with a different selector
+	UnpackInputsSelectorMismatch = "Calldata does not match the selector of method '%s'"
 	// UnpackOutputsMismatch RLP decoding of output gave an unexpected type according to the ABI
 	UnpackOutputsMismatch = "Expected %d type in JSON/RPC response. Received %d: %+v"
 	// UnpackOutputsMismatchCount wrong number of arguments
@@ -418,6 +1012,8 @@ const (
 
 	// Unauthorized (401 error)
 	Unauthorized = "Unauthorized"
+	// Forbidden (403 error) the caller is authenticated, but not allowed to perform the operation
+	Forbidden = "Forbidden"
 
 	// WebhooksInvalidMsgHeaders missing headers section in the JSON/YAML posted
 	WebhooksInvalidMsgHeaders = "Invalid message - missing 'headers' (or not an object)"
@@ -425,6 +1021,8 @@ const (
 	WebhooksInvalidMsgTypeMissing = "Invalid message - missing 'headers.type' (or not a string)"
 	// WebhooksInvalidMsgFromMissing need to specify a msg type in the header
 	WebhooksInvalidMsgFromMissing = "Invalid message - missing 'from' (or not a string)"
+	// WebhooksInvalidMsgMethodMissing need to specify the JSON/RPC method of an RPCCall message
+	WebhooksInvalidMsgMethodMissing = "Invalid message - missing 'method' (or not a string)"
 	// WebhooksInvalidMsgType need to specify a valid msg type in the header
 	WebhooksInvalidMsgType = "Invalid message type: %s"
 	// WebhooksKafkaUnexpectedErrFmt problem processing an error that came back from Kafka, so do a deep dump
@@ -433,13 +1031,47 @@ const (
 	WebhooksKafkaDeliveryReportNoMeta = "Sent message did not contain metadata: %+v"
 	// WebhooksKafkaYAMLtoJSON re-serialization of webhook message into JSON failed
 	WebhooksKafkaYAMLtoJSON = "Unable to reserialize YAML payload as JSON: %s"
+	// SignatureVerifyBadRequest the body of a signature verification request could not be parsed
+	SignatureVerifyBadRequest = "Unable to parse signature verification request: %s"
+	// SignatureBadLength a signature to verify is not 65 bytes
+	SignatureBadLength = "Signature is %d bytes. Must be %d bytes of r, s and v"
+	// SignatureBadRecoveryID the v of a signature is not a valid recovery id
+	SignatureBadRecoveryID = "Invalid signature recovery id %d"
+	// SignatureBadRS the r or s of a signature is outside the range allowed by the curve
+	SignatureBadRS = "Signature r and s values must be between 1 and the order of the secp256k1 curve"
+	// SignatureRecoverFailed the public key could not be recovered from a signature
+	SignatureRecoverFailed = "Unable to recover the signer from the signature: %s"
+	// SignatureVerifyBadSignature the signature supplied to verify is not valid hex
+	SignatureVerifyBadSignature = "Signature must be a 0x prefixed hex string"
+	// SignatureVerifyBadData the data supplied to verify is not valid hex
+	SignatureVerifyBadData = "Data must be a 0x prefixed hex string"
+	// SignatureVerifyBadAddress the expected signer address is not valid
+	SignatureVerifyBadAddress = "Invalid address '%s'"
+	// SignatureVerifyMissingMessage exactly one of the message, data and typedData must be supplied
+	SignatureVerifyMissingMessage = "Exactly one of 'message', 'data' or 'typedData' must be supplied"
+	// TypedDataUnknownType the primary type, or a referenced type, is not defined in the types of EIP-712 typed data
+	TypedDataUnknownType = "Type '%s' is not defined in the typed data"
+	// TypedDataBadValue a value in EIP-712 typed data does not match its type
+	TypedDataBadValue = "Value of '%s' is not a valid %s"
+
 	// WebhooksKafkaErr wrapper on detailed error from Kafka itself
 	WebhooksKafkaErr = "Failed to deliver message to Kafka: %s"
+	// WebhooksKafkaQueueFull Kafka is unavailable, and the local queue cannot hold any more messages
+	WebhooksKafkaQueueFull = "Kafka is unavailable, and the local queue is full with %d messages"
+	// WebhooksKafkaQueueWrite a message could not be written to the local queue
+	WebhooksKafkaQueueWrite = "Failed to queue message for Kafka: %s"
 
 	// WebhooksDirectTooManyInflight when we're not using a buffered store (Kafka) we have to reject
 	WebhooksDirectTooManyInflight = "Too many in-flight transactions"
 	// WebhooksDirectBadHeaders problem processing for in-memory operation
 	WebhooksDirectBadHeaders = "Failed to process headers in message"
+
+	// WebhooksSyncTimeout no reply was received for a sync request in time
+	WebhooksSyncTimeout = "Timed out waiting for the reply to request '%s'. The reply will be available from the receipt store"
+	// WebhooksPeerNoWaiter a reply forwarded by a peer is not for a sync request waiting on this gateway
+	WebhooksPeerNoWaiter = "No sync request is waiting for the reply to request '%s'"
+	// WebhooksPeerBadReply a reply forwarded by a peer could not be parsed
+	WebhooksPeerBadReply = "Invalid reply forwarded by peer: %s"
 )
 
 type Error string
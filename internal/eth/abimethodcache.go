@@ -0,0 +1,51 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+
+	lru "github.com/hashicorp/golang-lru"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+const (
+	// DefaultABIMethodCacheSize is the number of parsed ABI methods held in the LRU cache
+	DefaultABIMethodCacheSize = 1000
+)
+
+// abiMethodCache holds the methods parsed from ABI elements, keyed on the JSON of the
+// element, so the argument types of methods that are invoked often are only parsed once
+var abiMethodCache, _ = lru.New(DefaultABIMethodCacheSize)
+
+// ABIMethodFor returns the method for an ABI element, with the types of its arguments parsed.
+// The method is shared with every other caller for the same element, so must not be modified
+func ABIMethodFor(element *ethbinding.ABIElementMarshaling) (*ethbinding.ABIMethod, error) {
+	keyBytes, err := json.Marshal(element)
+	if err != nil {
+		return ethbind.API.ABIElementMarshalingToABIMethod(element)
+	}
+	key := string(keyBytes)
+	if cached, ok := abiMethodCache.Get(key); ok {
+		return cached.(*ethbinding.ABIMethod), nil
+	}
+	method, err := ethbind.API.ABIElementMarshalingToABIMethod(element)
+	if err != nil {
+		return nil, err
+	}
+	abiMethodCache.Add(key, method)
+	return method, nil
+}
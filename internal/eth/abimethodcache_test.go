@@ -0,0 +1,79 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestABIMethodForCached(t *testing.T) {
+	assert := assert.New(t)
+
+	element := &ethbinding.ABIElementMarshaling{
+		Type: "function",
+		Name: "set",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "x", Type: "uint256"},
+		},
+	}
+	method1, err := ABIMethodFor(element)
+	assert.NoError(err)
+	assert.Equal("set", method1.Name)
+
+	copied := *element
+	method2, err := ABIMethodFor(&copied)
+	assert.NoError(err)
+	assert.True(method1 == method2)
+
+	copied.Name = "get"
+	method3, err := ABIMethodFor(&copied)
+	assert.NoError(err)
+	assert.Equal("get", method3.Name)
+}
+
+func TestABIMethodForBadType(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ABIMethodFor(&ethbinding.ABIElementMarshaling{
+		Type: "function",
+		Name: "set",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "x", Type: "badness"},
+		},
+	})
+	assert.Error(err)
+}
+
+func TestEncodeCallInLineTypesNotCached(t *testing.T) {
+	assert := assert.New(t)
+
+	method, err := ABIMethodFor(&ethbinding.ABIElementMarshaling{
+		Type: "function",
+		Name: "lazy",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "x", Type: "uint256"},
+		},
+	})
+	assert.NoError(err)
+
+	_, err = EncodeMethodCall(method, []interface{}{
+		map[string]interface{}{"value": "abc", "type": "string"},
+	}, false)
+	assert.NoError(err)
+	assert.Equal("uint256", method.Inputs[0].Type.String())
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+// GetAccounts gets the addresses of the accounts managed by the node, that it can
+// sign transactions for. Nodes without managed accounts return an empty list
+func GetAccounts(ctx context.Context, rpc RPCClient) ([]string, error) {
+	start := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	accounts := []string{}
+	if err := rpc.CallContext(ctx, &accounts, "eth_accounts"); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, "eth_accounts", err)
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("eth_accounts()=%d accounts [%.2fs]", len(accounts), callTime.Seconds())
+	return accounts, nil
+}
+
+// GetBalance gets the balance of an address in wei
+func GetBalance(ctx context.Context, rpc RPCClient, addr *ethbinding.Address, blockNumber string) (*big.Int, error) {
+	start := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	balance := ethbinding.HexBigInt{}
+	if err := rpc.CallContext(ctx, &balance, "eth_getBalance", addr, blockNumber); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, "eth_getBalance", err)
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("eth_getBalance(%x,%s)=%s [%.2fs]", addr, blockNumber, balance.ToInt(), callTime.Seconds())
+	return balance.ToInt(), nil
+}
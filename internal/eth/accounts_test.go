@@ -0,0 +1,85 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAccounts(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*[]string)) = []string{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c"}
+		},
+	}
+
+	accounts, err := GetAccounts(context.Background(), &r)
+
+	assert.NoError(err)
+	assert.Equal([]string{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c"}, accounts)
+	assert.Equal("eth_accounts", r.capturedMethod)
+}
+
+func TestGetAccountsErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	_, err := GetAccounts(context.Background(), &r)
+
+	assert.EqualError(err, "eth_accounts returned: pop")
+}
+
+func TestGetBalance(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*big.NewInt(1000000000000000000))
+		},
+	}
+
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	balance, err := GetBalance(context.Background(), &r, &addr, "latest")
+
+	assert.NoError(err)
+	assert.Equal("1000000000000000000", balance.String())
+	assert.Equal("eth_getBalance", r.capturedMethod)
+	assert.Equal("latest", r.capturedArgs[1])
+}
+
+func TestGetBalanceErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	_, err := GetBalance(context.Background(), &r, &addr, "latest")
+
+	assert.EqualError(err, "eth_getBalance returned: pop")
+}
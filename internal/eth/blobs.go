@@ -0,0 +1,87 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"math/big"
+	"regexp"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+const (
+	// blobTxType is the EIP-2718 type of an EIP-4844 blob-carrying transaction
+	blobTxType = "0x3"
+)
+
+// blobVersionedHash is a 32 byte hash, with the KZG commitment version 0x01 as its first byte
+var blobVersionedHash = regexp.MustCompile(`^0x01[0-9a-f]{62}$`)
+
+// setBlobFields validates and retains the EIP-4844 fields of a transaction. The blobs themselves
+// are not handled by the bridge - the hashes must be of blobs the node has been supplied with
+// out of band, and the node must support signing and submitting type 3 transactions
+func (tx *Txn) setBlobFields(hashes []string, maxFeePerBlobGas json.Number) error {
+	if len(hashes) == 0 {
+		if maxFeePerBlobGas != "" {
+			return errors.Errorf(errors.TransactionSendBlobMissingHashes)
+		}
+		return nil
+	}
+	tx.BlobVersionedHashes = make([]string, len(hashes))
+	for i, hash := range hashes {
+		hash = strings.ToLower(hash)
+		if !blobVersionedHash.MatchString(hash) {
+			return errors.Errorf(errors.TransactionSendBadBlobVersionedHash, hashes[i])
+		}
+		tx.BlobVersionedHashes[i] = hash
+	}
+	if maxFeePerBlobGas != "" {
+		fee, ok := new(big.Int).SetString(maxFeePerBlobGas.String(), 10)
+		if !ok || fee.Sign() < 0 {
+			return errors.Errorf(errors.TransactionSendBadMaxFeePerBlobGas, maxFeePerBlobGas)
+		}
+		tx.MaxFeePerBlobGas = fee
+	}
+	return nil
+}
+
+// addBlobArgs adds the EIP-4844 fields to the arguments of a transaction that carries blobs
+func (tx *Txn) addBlobArgs(txArgs *SendTXArgs, isPrivate bool) error {
+	if len(tx.BlobVersionedHashes) == 0 {
+		return nil
+	}
+	if tx.Signer != nil {
+		return errors.Errorf(errors.TransactionSendBlobWithExternalSigner, tx.Signer.Type())
+	}
+	if isPrivate {
+		return errors.Errorf(errors.TransactionSendBlobPrivate)
+	}
+	// A type 3 transaction has EIP-1559 fees, which the node sets, so a legacy gasPrice is rejected
+	// rather than being silently dropped
+	if tx.EthTX.GasPrice().Sign() != 0 {
+		return errors.Errorf(errors.TransactionSendBlobLegacyGasPrice, tx.EthTX.GasPrice())
+	}
+	txArgs.GasPrice = nil
+	txArgs.Type = blobTxType
+	txArgs.BlobVersionedHashes = tx.BlobVersionedHashes
+	if tx.MaxFeePerBlobGas != nil {
+		maxFee := ethbinding.HexBigInt(*tx.MaxFeePerBlobGas)
+		txArgs.MaxFeePerBlobGas = &maxFee
+	}
+	return nil
+}
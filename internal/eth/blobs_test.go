@@ -0,0 +1,139 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+const testBlobHash = "0x01AB000000000000000000000000000000000000000000000000000000000001"
+
+func newTestBlobSendTxnMsg() *messages.SendTransaction {
+	var msg messages.SendTransaction
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Nonce = "123"
+	msg.Gas = "456"
+	msg.BlobVersionedHashes = []string{testBlobHash}
+	msg.MaxFeePerBlobGas = "1000"
+	return &msg
+}
+
+func TestSendTxnBlobFields(t *testing.T) {
+	assert := assert.New(t)
+
+	tx, err := NewSendTxn(newTestBlobSendTxnMsg(), nil, false)
+	assert.NoError(err)
+	rpc := testRPCClient{}
+
+	err = tx.Send(context.Background(), &rpc)
+	assert.NoError(err)
+
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+	jsonBytesSent, _ := json.Marshal(rpc.capturedArgs[0])
+	var jsonSent map[string]interface{}
+	json.Unmarshal(jsonBytesSent, &jsonSent)
+	assert.Equal("0x3", jsonSent["type"])
+	assert.Equal([]interface{}{"0x01ab000000000000000000000000000000000000000000000000000000000001"}, jsonSent["blobVersionedHashes"])
+	assert.Equal("0x3e8", jsonSent["maxFeePerBlobGas"])
+	_, hasGasPrice := jsonSent["gasPrice"]
+	assert.False(hasGasPrice)
+}
+
+func TestSendTxnBlobFieldsLegacyGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := newTestBlobSendTxnMsg()
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(msg, nil, false)
+	assert.NoError(err)
+	rpc := testRPCClient{}
+
+	err = tx.Send(context.Background(), &rpc)
+	assert.EqualError(err, "Blob transactions use EIP-1559 fees set by the node, and cannot have a gasPrice (789)")
+	assert.Equal("", rpc.capturedMethod)
+}
+
+func TestSendTxnNoBlobFields(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := newTestBlobSendTxnMsg()
+	msg.BlobVersionedHashes = nil
+	msg.MaxFeePerBlobGas = ""
+	tx, err := NewSendTxn(msg, nil, false)
+	assert.NoError(err)
+	rpc := testRPCClient{}
+
+	err = tx.Send(context.Background(), &rpc)
+	assert.NoError(err)
+
+	jsonBytesSent, _ := json.Marshal(rpc.capturedArgs[0])
+	var jsonSent map[string]interface{}
+	json.Unmarshal(jsonBytesSent, &jsonSent)
+	assert.Nil(jsonSent["type"])
+	assert.Nil(jsonSent["blobVersionedHashes"])
+	assert.Nil(jsonSent["maxFeePerBlobGas"])
+	assert.Equal("0x0", jsonSent["gasPrice"])
+}
+
+func TestSendTxnBlobFieldsInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := newTestBlobSendTxnMsg()
+	msg.BlobVersionedHashes = []string{"0x02ab000000000000000000000000000000000000000000000000000000000001"}
+	_, err := NewSendTxn(msg, nil, false)
+	assert.Regexp("Invalid blob versioned hash '0x02ab", err)
+
+	msg = newTestBlobSendTxnMsg()
+	msg.MaxFeePerBlobGas = "lots"
+	_, err = NewSendTxn(msg, nil, false)
+	assert.Regexp("Invalid maxFeePerBlobGas 'lots'", err)
+
+	msg = newTestBlobSendTxnMsg()
+	msg.BlobVersionedHashes = nil
+	_, err = NewSendTxn(msg, nil, false)
+	assert.Regexp("A maxFeePerBlobGas requires blobVersionedHashes", err)
+}
+
+func TestSendTxnBlobFieldsExternalSigner(t *testing.T) {
+	signer := &mockTXSigner{
+		signed: []byte("testbytes"),
+		from:   "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	}
+	tx, err := NewSendTxn(newTestBlobSendTxnMsg(), signer, false)
+	assert.NoError(t, err)
+	rpc := testRPCClient{}
+
+	err = tx.Send(context.Background(), &rpc)
+	assert.Regexp(t, "not currently supported with blob transactions", err)
+	assert.Equal(t, "", rpc.capturedMethod)
+}
+
+func TestSendTxnBlobFieldsPrivate(t *testing.T) {
+	msg := newTestBlobSendTxnMsg()
+	msg.PrivateFor = []string{"s6a3mQ8I+rI2ZgHqHZlJaELiJs10HxlZNIwNd669FH4="}
+	tx, err := NewSendTxn(msg, nil, false)
+	assert.NoError(t, err)
+	rpc := testRPCClient{}
+
+	err = tx.Send(context.Background(), &rpc)
+	assert.EqualError(t, err, "Blob transactions cannot be private transactions")
+}
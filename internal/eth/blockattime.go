@@ -0,0 +1,111 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// parseBlockTime parses a block option that is a point in time, rather than a block number.
+// RFC3339 timestamps are accepted, or a date alone for the start of that day in UTC
+func parseBlockTime(blocknumber string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, blocknumber); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", blocknumber); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// BlockNumberForCall resolves a timestamp passed as the block to perform a call against to
+// the newest block mined at or before that time, returned as a decimal number. Any other
+// value is validated, and returned unchanged
+func BlockNumberForCall(ctx context.Context, rpc RPCClient, blocknumber string) (string, error) {
+	t, isTime := parseBlockTime(blocknumber)
+	if !isTime {
+		if _, err := callBlockOption(blocknumber); err != nil {
+			return "", err
+		}
+		return blocknumber, nil
+	}
+	timestamps, err := BlockTimestampCacheFor(rpc, DefaultBlockTimestampCacheSize)
+	if err != nil {
+		return "", err
+	}
+	n, err := timestamps.BlockAtTime(ctx, rpc, t)
+	if err != nil {
+		return "", err
+	}
+	log.Infof("Resolved block %d at %s", n, blocknumber)
+	return strconv.FormatUint(n, 10), nil
+}
+
+// BlockAtTime returns the number of the newest block with a timestamp at or before the supplied
+// time, by binary search over the block headers. Headers are held in the timestamp cache, and
+// times before the current head block are cached as their block can no longer change
+func (c *BlockTimestampCache) BlockAtTime(ctx context.Context, rpc RPCClient, t time.Time) (uint64, error) {
+	target := uint64(t.Unix())
+	if t.Unix() < 0 {
+		target = 0
+	}
+	if n, ok := c.resolved.Get(target); ok {
+		return n.(uint64), nil
+	}
+
+	timestampOf := func(n uint64) (uint64, error) {
+		return c.GetBlockTimestamp(ctx, rpc, fmt.Sprintf("0x%x", n))
+	}
+	head, err := GetBlockNumber(ctx, rpc)
+	if err != nil {
+		return 0, err
+	}
+	ts, err := timestampOf(head)
+	if err != nil {
+		return 0, err
+	}
+	if ts <= target {
+		// A block mined later could still be at or before the time
+		return head, nil
+	}
+	if ts, err = timestampOf(0); err != nil {
+		return 0, err
+	}
+	if ts > target {
+		return 0, errors.Errorf(errors.TransactionCallBlockBeforeGenesis, t.UTC().Format(time.RFC3339))
+	}
+
+	// The block at low is at or before the time, and the block at high is after it
+	low, high := uint64(0), head
+	for high-low > 1 {
+		mid := low + (high-low)/2
+		if ts, err = timestampOf(mid); err != nil {
+			return 0, err
+		}
+		if ts <= target {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	c.resolved.Add(target, low)
+	return low, nil
+}
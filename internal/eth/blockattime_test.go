@@ -0,0 +1,158 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockTimesRPC is a chain of blocks mined every 10 seconds from a start time
+type blockTimesRPC struct {
+	head         uint64
+	start        uint64
+	headerCalls  int
+	headerErrAt  string
+	blockNumErr  error
+	blocksLooked []string
+}
+
+func (r *blockTimesRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_blockNumber":
+		*(result.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*new(big.Int).SetUint64(r.head))
+		return r.blockNumErr
+	case "eth_getBlockByNumber":
+		r.headerCalls++
+		blockHex := args[0].(string)
+		r.blocksLooked = append(r.blocksLooked, blockHex)
+		if blockHex == r.headerErrAt {
+			return fmt.Errorf("pop")
+		}
+		n, _ := strconv.ParseUint(strings.TrimPrefix(blockHex, "0x"), 16, 64)
+		result.(*ethbinding.Header).Time = r.start + n*10
+		return nil
+	}
+	return fmt.Errorf("unexpected method %s", method)
+}
+
+func TestBlockAtTime(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &blockTimesRPC{head: 1000, start: 1620000000}
+	c, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+
+	n, err := c.BlockAtTime(context.Background(), rpc, time.Unix(1620000000+4235, 0))
+	assert.NoError(err)
+	assert.Equal(uint64(423), n)
+
+	// Exactly on a block
+	n, err = c.BlockAtTime(context.Background(), rpc, time.Unix(1620000000+4240, 0))
+	assert.NoError(err)
+	assert.Equal(uint64(424), n)
+
+	// The resolved block is cached
+	calls := rpc.headerCalls
+	n, err = c.BlockAtTime(context.Background(), rpc, time.Unix(1620000000+4235, 0))
+	assert.NoError(err)
+	assert.Equal(uint64(423), n)
+	assert.Equal(calls, rpc.headerCalls)
+
+	// Genesis
+	n, err = c.BlockAtTime(context.Background(), rpc, time.Unix(1620000005, 0))
+	assert.NoError(err)
+	assert.Equal(uint64(0), n)
+}
+
+func TestBlockAtTimeAfterHead(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &blockTimesRPC{head: 1000, start: 1620000000}
+	c, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+
+	n, err := c.BlockAtTime(context.Background(), rpc, time.Unix(1630000000, 0))
+	assert.NoError(err)
+	assert.Equal(uint64(1000), n)
+
+	// Not cached, as later blocks can still be mined before the time
+	rpc.head = 1001
+	n, err = c.BlockAtTime(context.Background(), rpc, time.Unix(1630000000, 0))
+	assert.NoError(err)
+	assert.Equal(uint64(1001), n)
+}
+
+func TestBlockAtTimeBeforeGenesis(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &blockTimesRPC{head: 1000, start: 1620000000}
+	c, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+
+	_, err := c.BlockAtTime(context.Background(), rpc, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.EqualError(err, "No block was mined at or before 2021-01-01T00:00:00Z")
+}
+
+func TestBlockAtTimeErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	target := time.Unix(1620000000+4235, 0)
+	c, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+	_, err := c.BlockAtTime(context.Background(), &blockTimesRPC{head: 1000, blockNumErr: fmt.Errorf("pop")}, target)
+	assert.EqualError(err, "eth_blockNumber returned: pop")
+
+	for _, errAt := range []string{"0x3e8", "0x0", "0x1f4"} {
+		c, _ = NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+		_, err = c.BlockAtTime(context.Background(), &blockTimesRPC{head: 1000, start: 1620000000, headerErrAt: errAt}, target)
+		assert.EqualError(err, "eth_getBlockByNumber returned: pop", errAt)
+	}
+}
+
+func TestBlockNumberForCall(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &blockTimesRPC{head: 100000, start: 1609459200}
+
+	for _, blocknumber := range []string{"", "latest", "12345", "0x3039", "pending"} {
+		resolved, err := BlockNumberForCall(context.Background(), rpc, blocknumber)
+		assert.NoError(err)
+		assert.Equal(blocknumber, resolved)
+	}
+	assert.Equal(0, rpc.headerCalls)
+
+	resolved, err := BlockNumberForCall(context.Background(), rpc, "2021-01-01T01:00:05Z")
+	assert.NoError(err)
+	assert.Equal("360", resolved)
+
+	resolved, err = BlockNumberForCall(context.Background(), rpc, "2021-01-01T02:00:00+01:00")
+	assert.NoError(err)
+	assert.Equal("360", resolved)
+
+	resolved, err = BlockNumberForCall(context.Background(), rpc, "2021-01-02")
+	assert.NoError(err)
+	assert.Equal("8640", resolved)
+
+	_, err = BlockNumberForCall(context.Background(), rpc, "2020-12-31")
+	assert.Regexp("No block was mined at or before 2020-12-31T00:00:00Z", err)
+
+	_, err = BlockNumberForCall(context.Background(), rpc, "yesterday")
+	assert.Regexp("Invalid blocknumber", err)
+}
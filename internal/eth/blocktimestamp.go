@@ -0,0 +1,85 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+const (
+	// DefaultBlockTimestampCacheSize is the number of block timestamps held in the LRU cache
+	DefaultBlockTimestampCacheSize = 1000
+)
+
+// BlockTimestampCache looks up the timestamp of blocks from their headers, holding
+// recent results in an LRU cache so many events or receipts in the same block
+// only result in a single call to the node
+type BlockTimestampCache struct {
+	cache *lru.Cache
+	// blocks at or before a time, resolved by BlockAtTime
+	resolved *lru.Cache
+}
+
+// RPCClientBlockTimestamps is implemented by clients returned from RPCConnect, which hold
+// a cache of block timestamps shared by everything using the connection
+type RPCClientBlockTimestamps interface {
+	BlockTimestamps() *BlockTimestampCache
+}
+
+// NewBlockTimestampCache constructor
+func NewBlockTimestampCache(size int) (*BlockTimestampCache, error) {
+	cache, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockTimestampCache{cache: cache, resolved: resolved}, nil
+}
+
+// BlockTimestampCacheFor returns the cache shared by all users of the RPC client, so
+// receipts and events in the same block only look up the block once. A new cache of
+// the supplied size is returned if the client does not hold one
+func BlockTimestampCacheFor(rpc RPCClient, size int) (*BlockTimestampCache, error) {
+	if shared, ok := rpc.(RPCClientBlockTimestamps); ok && shared.BlockTimestamps() != nil {
+		return shared.BlockTimestamps(), nil
+	}
+	return NewBlockTimestampCache(size)
+}
+
+// GetBlockTimestamp returns the timestamp of the block, with the block number in the hex
+// format used on the JSON/RPC interface
+func (c *BlockTimestampCache) GetBlockTimestamp(ctx context.Context, rpc RPCClient, blockNumber string) (uint64, error) {
+	if ts, ok := c.cache.Get(blockNumber); ok {
+		return ts.(uint64), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var hdr ethbinding.Header
+	// 2nd parameter (false) indicates it is sufficient to retrieve only hashes of tx objects
+	if err := rpc.CallContext(ctx, &hdr, "eth_getBlockByNumber", blockNumber, false); err != nil {
+		return 0, errors.Errorf(errors.RPCCallReturnedError, "eth_getBlockByNumber", err)
+	}
+	c.cache.Add(blockNumber, hdr.Time)
+	return hdr.Time, nil
+}
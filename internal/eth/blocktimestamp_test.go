@@ -0,0 +1,95 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBlockTimestampCached(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			calls++
+			result.(*ethbinding.Header).Time = 1620000000
+		},
+	}
+
+	c, err := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+	assert.NoError(err)
+	ts, err := c.GetBlockTimestamp(context.Background(), &r, "0x3039")
+	assert.NoError(err)
+	assert.Equal(uint64(1620000000), ts)
+	assert.Equal("eth_getBlockByNumber", r.capturedMethod)
+	assert.Equal("0x3039", r.capturedArgs[0])
+
+	ts, err = c.GetBlockTimestamp(context.Background(), &r, "0x3039")
+	assert.NoError(err)
+	assert.Equal(uint64(1620000000), ts)
+	assert.Equal(1, calls)
+}
+
+func TestGetBlockTimestampErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	c, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+	_, err := c.GetBlockTimestamp(context.Background(), &r, "0x3039")
+	assert.EqualError(err, "eth_getBlockByNumber returned: pop")
+}
+
+func TestNewBlockTimestampCacheBadSize(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewBlockTimestampCache(0)
+	assert.Regexp("must provide a positive size", err)
+}
+
+type testSharedTimestampsRPC struct {
+	testRPCClient
+	timestamps *BlockTimestampCache
+}
+
+func (r *testSharedTimestampsRPC) BlockTimestamps() *BlockTimestampCache {
+	return r.timestamps
+}
+
+func TestBlockTimestampCacheForShared(t *testing.T) {
+	assert := assert.New(t)
+
+	shared, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+	c, err := BlockTimestampCacheFor(&testSharedTimestampsRPC{timestamps: shared}, 10)
+	assert.NoError(err)
+	assert.Equal(shared, c)
+
+	c, err = BlockTimestampCacheFor(&testRPCClient{}, 10)
+	assert.NoError(err)
+	assert.NotEqual(shared, c)
+
+	w := &rpcWrapper{timestamps: shared}
+	c, err = BlockTimestampCacheFor(w, 10)
+	assert.NoError(err)
+	assert.Equal(shared, c)
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// intrinsic gas charged for every transaction, and additionally for contract creation
+	txGas               = 21000
+	txGasContractCreate = 32000
+	// gas per byte of calldata, per EIP-2028
+	txDataZeroGas    = 4
+	txDataNonZeroGas = 16
+	// blockGasLimitCacheTime is how long the gas limit of the latest block is reused, as it only changes slowly
+	blockGasLimitCacheTime = 1 * time.Minute
+)
+
+// RPCClientBlockGasLimit is implemented by clients returned from RPCConnect, which cache
+// the gas limit of the latest block for everything using the connection
+type RPCClientBlockGasLimit interface {
+	BlockGasLimit(ctx context.Context) (uint64, error)
+}
+
+// blockGasLimitCache holds the gas limit of the latest block, looked up at most once per blockGasLimitCacheTime
+type blockGasLimitCache struct {
+	lock    sync.Mutex
+	limit   uint64
+	fetched time.Time
+}
+
+// get returns the cached block gas limit, or looks it up with eth_getBlockByNumber when it has expired.
+// The lock is not held during the lookup, so a slow node does not block every submission behind it
+func (c *blockGasLimitCache) get(ctx context.Context, rpc RPCClient) (uint64, error) {
+	c.lock.Lock()
+	limit, fetched := c.limit, c.fetched
+	c.lock.Unlock()
+	if !fetched.IsZero() && time.Since(fetched) < blockGasLimitCacheTime {
+		return limit, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	var block struct {
+		GasLimit ethbinding.HexUint64 `json:"gasLimit"`
+	}
+	if err := rpc.CallContext(ctx, &block, "eth_getBlockByNumber", "latest", false); err != nil {
+		return 0, errors.Errorf(errors.RPCCallReturnedError, "eth_getBlockByNumber", err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.limit = uint64(block.GasLimit)
+	c.fetched = time.Now()
+	return c.limit, nil
+}
+
+// IntrinsicGas returns the gas charged for a transaction before any code runs, for its
+// data and for contract creation. The EIP-3860 charge for init code is not included, so
+// on any chain this is a lower bound of the gas the transaction needs
+func IntrinsicGas(data []byte, isCreate bool) uint64 {
+	gas := uint64(txGas)
+	if isCreate {
+		gas += txGasContractCreate
+	}
+	for _, b := range data {
+		if b == 0 {
+			gas += txDataZeroGas
+		} else {
+			gas += txDataNonZeroGas
+		}
+	}
+	return gas
+}
+
+// checkBlockGasLimit rejects a transaction that can never fit in a block, because its data
+// alone costs more gas than the block gas limit, or the gas supplied exceeds that limit.
+// The check is skipped when the connection does not provide the limit, or it cannot be found,
+// leaving the node to reject the transaction
+func (tx *Txn) checkBlockGasLimit(ctx context.Context, rpc RPCClient, gas uint64) error {
+	limiter, ok := rpc.(RPCClientBlockGasLimit)
+	if !ok {
+		return nil
+	}
+	blockGasLimit, err := limiter.BlockGasLimit(ctx)
+	if err != nil || blockGasLimit == 0 {
+		log.Warnf("Unable to check the transaction against the block gas limit: %v", err)
+		return nil
+	}
+	data := tx.EthTX.Data()
+	if intrinsic := IntrinsicGas(data, tx.EthTX.To() == nil); intrinsic > blockGasLimit {
+		return errors.Errorf(errors.TransactionSendCalldataExceedsBlockGasLimit, len(data), intrinsic, blockGasLimit)
+	}
+	if gas > blockGasLimit {
+		return errors.Errorf(errors.TransactionSendGasExceedsBlockGasLimit, gas, blockGasLimit)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+type testGasLimitRPC struct {
+	testRPCClient
+	limit    uint64
+	limitErr error
+}
+
+func (r *testGasLimitRPC) BlockGasLimit(ctx context.Context) (uint64, error) {
+	return r.limit, r.limitErr
+}
+
+// testBlockingGasLimitRPC holds each lookup of the block gas limit until it is released
+type testBlockingGasLimitRPC struct {
+	entered chan bool
+	release chan struct{}
+}
+
+func (r *testBlockingGasLimitRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	r.entered <- true
+	<-r.release
+	return json.Unmarshal([]byte(`{"gasLimit":"0x1c9c380"}`), result)
+}
+
+func testGasLimitTxn(gas uint64, data []byte) *Txn {
+	to := ethbind.API.HexToAddress("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832")
+	return &Txn{
+		From:  ethbind.API.HexToAddress("0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"),
+		EthTX: ethbind.API.NewTransaction(0, to, big.NewInt(0), gas, big.NewInt(0), data),
+	}
+}
+
+func TestIntrinsicGas(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(uint64(21000), IntrinsicGas(nil, false))
+	assert.Equal(uint64(53000), IntrinsicGas(nil, true))
+	assert.Equal(uint64(21000+4+16+16), IntrinsicGas([]byte{0x00, 0x01, 0xff}, false))
+}
+
+func TestSendTxnCalldataExceedsBlockGasLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testGasLimitRPC{limit: 24000}
+	tx := testGasLimitTxn(0, make([]byte, 1000))
+	err := tx.Send(context.Background(), rpc)
+	assert.EqualError(err, "Transaction data of 1000 bytes requires at least 25000 gas, which exceeds the block gas limit of 24000")
+	assert.Equal("", rpc.capturedMethod)
+}
+
+func TestSendTxnGasExceedsBlockGasLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testGasLimitRPC{limit: 30000000}
+	tx := testGasLimitTxn(40000000, []byte{0x3c, 0xcf, 0xd6, 0x0b})
+	err := tx.Send(context.Background(), rpc)
+	assert.EqualError(err, "Gas 40000000 exceeds the block gas limit of 30000000")
+	assert.Equal("", rpc.capturedMethod)
+}
+
+func TestSendTxnWithinBlockGasLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testGasLimitRPC{limit: 30000000}
+	tx := testGasLimitTxn(100000, []byte{0x3c, 0xcf, 0xd6, 0x0b})
+	err := tx.Send(context.Background(), rpc)
+	assert.NoError(err)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+}
+
+func TestSendTxnBlockGasLimitUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testGasLimitRPC{limitErr: fmt.Errorf("pop")}
+	tx := testGasLimitTxn(100000, make([]byte, 1000))
+	err := tx.Send(context.Background(), rpc)
+	assert.NoError(err)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+}
+
+func TestBlockGasLimitCache(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	rpc := &testRPCClient{
+		resultWrangler: func(result interface{}) {
+			calls++
+			json.Unmarshal([]byte(`{"gasLimit":"0x1c9c380"}`), result)
+		},
+	}
+	c := &blockGasLimitCache{}
+	limit, err := c.get(context.Background(), rpc)
+	assert.NoError(err)
+	assert.Equal(uint64(30000000), limit)
+	assert.Equal("eth_getBlockByNumber", rpc.capturedMethod)
+	assert.Equal([]interface{}{"latest", false}, rpc.capturedArgs)
+
+	limit, err = c.get(context.Background(), rpc)
+	assert.NoError(err)
+	assert.Equal(uint64(30000000), limit)
+	assert.Equal(1, calls)
+}
+
+func TestBlockGasLimitCacheLookupUnlocked(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBlockingGasLimitRPC{entered: make(chan bool, 2), release: make(chan struct{})}
+	c := &blockGasLimitCache{}
+	limits := make(chan uint64, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			limit, _ := c.get(context.Background(), rpc)
+			limits <- limit
+		}()
+	}
+
+	// Both lookups reach the node at once, as neither holds the lock while it waits
+	<-rpc.entered
+	<-rpc.entered
+	close(rpc.release)
+	assert.Equal(uint64(30000000), <-limits)
+	assert.Equal(uint64(30000000), <-limits)
+}
+
+func TestBlockGasLimitCacheFail(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &blockGasLimitCache{}
+	_, err := c.get(context.Background(), &testRPCClient{mockError: fmt.Errorf("pop")})
+	assert.EqualError(err, "eth_getBlockByNumber returned: pop")
+
+	// The connection looks up the limit for all of its users
+	w := &rpcWrapper{rpc: &mockEthClient{}}
+	limit, err := w.BlockGasLimit(context.Background())
+	assert.NoError(err)
+	assert.Equal(uint64(0), limit)
+}
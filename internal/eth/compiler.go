@@ -16,12 +16,16 @@ package eth
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/errors"
@@ -31,17 +35,27 @@ import (
 )
 
 const (
+	// DefaultSolcMaxSourceSize is the default limit on the size of uploaded source, in bytes
+	DefaultSolcMaxSourceSize = 10 * 1024 * 1024
+	// DefaultSolcMaxOutputSize is the default limit on the size of the output of solc, in bytes
+	DefaultSolcMaxOutputSize = 64 * 1024 * 1024
+	// DefaultSolcTimeoutSec is the default time solc is allowed to run for
+	DefaultSolcTimeoutSec = 120
+
 	// DefaultEVMVersion is the EVMVersion to be used when not specified explicitly
 	defaultEVMVersion = "byzantium"
 )
 
 // CompiledSolidity wraps solc compilation of solidity and ABI generation
 type CompiledSolidity struct {
-	ContractName string
-	Compiled     []byte
-	DevDoc       string
-	ABI          ethbinding.ABIMarshaling
-	ContractInfo *ethbinding.ContractInfo
+	ContractName    string
+	Compiled        []byte
+	RuntimeCompiled []byte
+	DevDoc          string
+	UserDoc         string
+	ABI             ethbinding.ABIMarshaling
+	ContractInfo    *ethbinding.ContractInfo
+	Warnings        []string
 }
 
 var solcVerChecker *regexp.Regexp
@@ -91,25 +105,224 @@ func GetSolcArgs(evmVersion string) []string {
 	}
 }
 
+// SolcConf configures the import remappings and allowed paths used when compiling
+// uploaded source, so contracts can import libraries vendored on the server, and the
+// limits that stop a single upload tying up the gateway
+type SolcConf struct {
+	Remappings    []string             `json:"remappings,omitempty"`
+	AllowedPaths  []string             `json:"allowedPaths,omitempty"`
+	Dependencies  SolcDependenciesConf `json:"dependencies,omitempty"` // JSON only config - no commandline
+	Git           SolcGitConf          `json:"git,omitempty"`
+	MaxSourceSize int64                `json:"maxSourceSize,omitempty"`
+	MaxOutputSize int64                `json:"maxOutputSize,omitempty"`
+	TimeoutSec    int                  `json:"timeoutSec,omitempty"`
+}
+
+var remappingCheck = regexp.MustCompile("^([^:=]+:)?[^:=]+=[^=]*$")
+
+// ValidateRemappings checks remappings are in the [context:]prefix=target format solc accepts
+func ValidateRemappings(remappings []string) error {
+	for _, remapping := range remappings {
+		if !remappingCheck.MatchString(remapping) {
+			return errors.Errorf(errors.CompilerRemappingInvalid, remapping)
+		}
+	}
+	return nil
+}
+
+// SolcArgs returns the solc args for a compile with the configured remappings and allowed paths,
+// followed by any remappings supplied with the request. The directories of configured remappings
+// with absolute targets are allowed automatically. Those of request remappings are not, so a
+// request can only read outside of its upload where the configuration allows it
+func (c *SolcConf) SolcArgs(evmVersion string, reqRemappings []string) []string {
+	args := GetSolcArgs(evmVersion)
+	allowed := append([]string{"."}, c.AllowedPaths...)
+	for _, remapping := range c.Remappings {
+		target := remapping[strings.Index(remapping, "=")+1:]
+		if filepath.IsAbs(target) {
+			allowed = append(allowed, target)
+		}
+	}
+	for i := range args {
+		if args[i] == "--allow-paths" && i+1 < len(args) {
+			args[i+1] = strings.Join(allowed, ",")
+		}
+	}
+	args = append(args, c.Remappings...)
+	return append(args, reqRemappings...)
+}
+
+// SetLimitDefaults applies the default limits where none are configured
+func (c *SolcConf) SetLimitDefaults() {
+	if c.MaxSourceSize <= 0 {
+		c.MaxSourceSize = DefaultSolcMaxSourceSize
+	}
+	if c.MaxOutputSize <= 0 {
+		c.MaxOutputSize = DefaultSolcMaxOutputSize
+	}
+	if c.TimeoutSec <= 0 {
+		c.TimeoutSec = DefaultSolcTimeoutSec
+	}
+}
+
+// CheckSourceSize returns an error if the total size of the files in a directory of
+// uploaded source exceeds the configured maximum
+func (c *SolcConf) CheckSourceSize(dir string) error {
+	if c.MaxSourceSize <= 0 {
+		return nil
+	}
+	var total int64
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if total > c.MaxSourceSize {
+		return errors.Errorf(errors.CompilerSourceTooLarge, total, c.MaxSourceSize)
+	}
+	return nil
+}
+
+// SourceLimit counts the bytes of uploaded source as they are written to disk, so an upload,
+// or an archive that expands to far more than its own size, fails as soon as it exceeds the
+// maximum rather than after filling the disk
+type SourceLimit struct {
+	max   int64
+	total int64
+}
+
+// NewSourceLimit returns the limit for the source files of one upload
+func (c *SolcConf) NewSourceLimit() *SourceLimit {
+	return &SourceLimit{max: c.MaxSourceSize}
+}
+
+// Copy copies to the writer, failing once the total copied through the limit exceeds the maximum
+func (l *SourceLimit) Copy(w io.Writer, r io.Reader) (int64, error) {
+	if l.max <= 0 {
+		n, err := io.Copy(w, r)
+		l.total += n
+		return n, err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, l.max-l.total+1))
+	l.total += n
+	if err == nil && l.Exceeded() {
+		err = l.Err()
+	}
+	return n, err
+}
+
+// Exceeded returns true once more than the maximum has been copied
+func (l *SourceLimit) Exceeded() bool {
+	return l.max > 0 && l.total > l.max
+}
+
+// Err returns the error for source that exceeds the maximum
+func (l *SourceLimit) Err() error {
+	return errors.Errorf(errors.CompilerSourceTooLarge, l.total, l.max)
+}
+
+// limitedOutput is a buffer for the output of solc, which cancels the compile when the
+// output grows beyond its limit, rather than letting solc fill the memory of the gateway
+type limitedOutput struct {
+	bytes.Buffer
+	limit    int64
+	exceeded bool
+	cancel   context.CancelFunc
+}
+
+func (o *limitedOutput) Write(p []byte) (int, error) {
+	if o.limit > 0 && int64(o.Len()+len(p)) > o.limit {
+		o.exceeded = true
+		o.cancel()
+		return 0, errors.Errorf(errors.CompilerOutputTooLarge, o.limit)
+	}
+	return o.Buffer.Write(p)
+}
+
+// RunSolc runs solc in a directory and returns its stdout and stderr. Solc is killed if it
+// runs for longer than the configured timeout, or its output exceeds the configured size
+func (c *SolcConf) RunSolc(dir, solcPath string, args []string) ([]byte, string, error) {
+	timeout := time.Duration(c.TimeoutSec) * time.Second
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+	cmd := exec.CommandContext(ctx, solcPath, args...)
+	stdout := &limitedOutput{limit: c.MaxOutputSize, cancel: cancel}
+	stderr := &limitedOutput{limit: c.MaxOutputSize, cancel: cancel}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Dir = dir
+	err := cmd.Run()
+	switch {
+	case stdout.exceeded || stderr.exceeded:
+		return nil, "", errors.Errorf(errors.CompilerOutputTooLarge, c.MaxOutputSize)
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, "", errors.Errorf(errors.CompilerTimeout, timeout)
+	case err != nil:
+		return nil, stderr.String(), err
+	}
+	return stdout.Bytes(), stderr.String(), nil
+}
+
 // CompileContract uses solc to compile the Solidity source and
 func CompileContract(soliditySource, contractName, requestedVersion, evmVersion string) (*CompiledSolidity, error) {
+	return CompileContractWithTimeout(soliditySource, contractName, requestedVersion, evmVersion, 0)
+}
+
+// CompileContractWithTimeout compiles the Solidity source as CompileContract, killing solc
+// if it does not complete within the timeout, when non-zero
+func CompileContractWithTimeout(soliditySource, contractName, requestedVersion, evmVersion string, timeout time.Duration) (*CompiledSolidity, error) {
 	// Compile the solidity
 	s, err := GetSolc(requestedVersion)
 	if err != nil {
 		return nil, err
 	}
 
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
 	solcArgs := GetSolcArgs(evmVersion)
-	cmd := exec.Command(s.Path, append(solcArgs, "--", "-")...)
+	cmd := exec.CommandContext(ctx, s.Path, append(solcArgs, "--", "-")...)
 	cmd.Stdin = strings.NewReader(soliditySource)
 	var stderr, stdout bytes.Buffer
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.Errorf(errors.CompilerTimeout, timeout)
+		}
 		return nil, errors.Errorf(errors.CompilerFailedSolc, err, stderr.String())
 	}
 	c, _ := ethbind.API.ParseCombinedJSON(stdout.Bytes(), soliditySource, s.Version, s.Version, strings.Join(solcArgs, " "))
-	return ProcessCompiled(c, contractName, true)
+	compiled, err := ProcessCompiled(c, contractName, true)
+	if err != nil {
+		return nil, err
+	}
+	compiled.Warnings = SolcWarnings(stderr.String())
+	return compiled, nil
+}
+
+// SolcWarnings splits the output solc writes to stderr on a successful compile into the
+// individual warnings, each with the source location lines that follow it
+func SolcWarnings(stderr string) []string {
+	var warnings []string
+	for _, block := range strings.Split(strings.ReplaceAll(stderr, "\r\n", "\n"), "\n\n") {
+		if block = strings.TrimSpace(block); block != "" {
+			warnings = append(warnings, block)
+		}
+	}
+	return warnings
 }
 
 // ProcessCompiled takes solc output and packs it into our CompiledSolidity structure
@@ -152,6 +365,11 @@ func packContract(contractName string, contract *ethbinding.Contract) (c *Compil
 	if len(c.Compiled) == 0 {
 		return nil, errors.Errorf(errors.CompilerBytecodeEmpty, contractName)
 	}
+	if contract.RuntimeCode != "" {
+		if c.RuntimeCompiled, err = ethbind.API.HexDecode(contract.RuntimeCode); err != nil {
+			return nil, errors.Errorf(errors.CompilerBytecodeInvalid, err)
+		}
+	}
 	// Pack the arguments for calling the contract
 	abiJSON, err := json.Marshal(contract.Info.AbiDefinition)
 	if err != nil {
@@ -168,5 +386,10 @@ func packContract(contractName string, contract *ethbinding.Contract) (c *Compil
 		return nil, errors.Errorf(errors.CompilerSerializeDevDocs, err)
 	}
 	c.DevDoc = string(devdocBytes)
+	userdocBytes, err := json.Marshal(contract.Info.UserDoc)
+	if err != nil {
+		return nil, errors.Errorf(errors.CompilerSerializeUserDocs, err)
+	}
+	c.UserDoc = string(userdocBytes)
 	return c, nil
 }
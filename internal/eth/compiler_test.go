@@ -15,7 +15,10 @@
 package eth
 
 import (
+	"bytes"
+	"io/ioutil"
 	"os"
+	"path"
 	"testing"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
@@ -42,6 +45,27 @@ func TestPackContractNoPrefix(t *testing.T) {
 	assert.Equal("thingymobob", compiled.ContractName)
 }
 
+func TestPackContractRuntimeCode(t *testing.T) {
+	assert := assert.New(t)
+	contract := &ethbinding.Contract{
+		Code:        "0x0001",
+		RuntimeCode: "0x01",
+	}
+	compiled, err := packContract("thingymobob", contract)
+	assert.NoError(err)
+	assert.Equal([]byte{0x01}, compiled.RuntimeCompiled)
+}
+
+func TestPackContractFailBadHexRuntimeCode(t *testing.T) {
+	assert := assert.New(t)
+	contract := &ethbinding.Contract{
+		Code:        "0x00",
+		RuntimeCode: "Not Hex",
+	}
+	_, err := packContract("", contract)
+	assert.EqualError(err, "Decoding bytecode: hex string without 0x prefix")
+}
+
 func TestPackContractFailBadHexCode(t *testing.T) {
 	assert := assert.New(t)
 	contract := &ethbinding.Contract{
@@ -98,6 +122,32 @@ func TestPackContractFailSerializingDevDoc(t *testing.T) {
 	assert.Regexp("Serializing DevDoc", err.Error())
 }
 
+func TestPackContractFailSerializingUserDoc(t *testing.T) {
+	assert := assert.New(t)
+	contract := &ethbinding.Contract{
+		Code: "0x00",
+		Info: ethbinding.ContractInfo{
+			UserDoc: make(map[bool]bool),
+		},
+	}
+	_, err := packContract("", contract)
+	assert.Regexp("Serializing UserDoc", err.Error())
+}
+
+func TestSolcWarnings(t *testing.T) {
+	assert := assert.New(t)
+
+	stderr := "Warning: SPDX license identifier not provided in source file.\n--> simple.sol\n\n\n" +
+		"Warning: Source file does not specify required compiler version!\r\n--> simple.sol\r\n\r\n"
+	assert.Equal([]string{
+		"Warning: SPDX license identifier not provided in source file.\n--> simple.sol",
+		"Warning: Source file does not specify required compiler version!\n--> simple.sol",
+	}, SolcWarnings(stderr))
+
+	assert.Nil(SolcWarnings(""))
+	assert.Nil(SolcWarnings("\n  \n"))
+}
+
 func TestSolcDefaultVersion(t *testing.T) {
 	assert := assert.New(t)
 	os.Setenv("FLY_SOLC_DEFAULT", "")
@@ -156,3 +206,98 @@ func TestSolcCompileInvalidVersion(t *testing.T) {
 	_, err := CompileContract("", "", "zero.four", "")
 	assert.EqualError(err, "Invalid Solidity version requested for compiler. Ensure the string starts with two dot separated numbers, such as 0.5")
 }
+
+func TestValidateRemappings(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateRemappings([]string{"@openzeppelin/=/opt/openzeppelin/", "ctx:lib/=vendor/lib/", "empty="}))
+	assert.Regexp("Invalid solc remapping 'nope'", ValidateRemappings([]string{"nope"}))
+	assert.Regexp("Invalid solc remapping '=target'", ValidateRemappings([]string{"=target"}))
+	assert.Regexp("Invalid solc remapping 'a=b=c'", ValidateRemappings([]string{"a=b=c"}))
+}
+
+func TestSolcConfArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &SolcConf{
+		Remappings:   []string{"@openzeppelin/=/opt/openzeppelin/", "lib/=vendor/lib/"},
+		AllowedPaths: []string{"/opt/libs"},
+	}
+	args := c.SolcArgs("", []string{"@mylib/=/etc/"})
+	assert.Equal([]string{
+		"--combined-json", "bin,bin-runtime,srcmap,srcmap-runtime,abi,userdoc,devdoc,metadata",
+		"--optimize",
+		"--evm-version", "byzantium",
+		"--allow-paths", ".,/opt/libs,/opt/openzeppelin/",
+		"@openzeppelin/=/opt/openzeppelin/", "lib/=vendor/lib/",
+		"@mylib/=/etc/",
+	}, args)
+
+	c = &SolcConf{}
+	assert.Equal(GetSolcArgs("istanbul"), c.SolcArgs("istanbul", nil))
+}
+
+func TestRunSolcTimeout(t *testing.T) {
+	conf := &SolcConf{TimeoutSec: 1}
+	_, _, err := conf.RunSolc(".", "sleep", []string{"10"})
+	assert.Regexp(t, "Solidity compilation did not complete within 1s", err)
+}
+
+func TestRunSolcOutputTooLarge(t *testing.T) {
+	conf := &SolcConf{MaxOutputSize: 1024, TimeoutSec: 10}
+	_, _, err := conf.RunSolc(".", "yes", []string{})
+	assert.Regexp(t, "Solidity compilation output exceeded the maximum of 1024 bytes", err)
+}
+
+func TestRunSolcOK(t *testing.T) {
+	assert := assert.New(t)
+	conf := &SolcConf{}
+	conf.SetLimitDefaults()
+	stdout, stderr, err := conf.RunSolc(".", "sh", []string{"-c", "echo out; echo err >&2"})
+	assert.NoError(err)
+	assert.Equal("out\n", string(stdout))
+	assert.Equal("err\n", stderr)
+
+	_, stderr, err = conf.RunSolc(".", "sh", []string{"-c", "echo pop >&2; exit 1"})
+	assert.Regexp("exit status 1", err)
+	assert.Equal("pop\n", stderr)
+}
+
+func TestCheckSourceSize(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "solc")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, "a.sol"), make([]byte, 60), 0644)
+	os.Mkdir(path.Join(dir, "lib"), 0755)
+	ioutil.WriteFile(path.Join(dir, "lib", "b.sol"), make([]byte, 60), 0644)
+
+	conf := &SolcConf{MaxSourceSize: 200}
+	assert.NoError(conf.CheckSourceSize(dir))
+	conf.MaxSourceSize = 100
+	assert.Regexp("Solidity source of 120 bytes exceeds the maximum of 100 bytes", conf.CheckSourceSize(dir))
+}
+
+func TestSourceLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	limit := (&SolcConf{MaxSourceSize: 100}).NewSourceLimit()
+	out := &bytes.Buffer{}
+	n, err := limit.Copy(out, bytes.NewReader(make([]byte, 60)))
+	assert.NoError(err)
+	assert.Equal(int64(60), n)
+	assert.False(limit.Exceeded())
+
+	// Stops reading just beyond the limit, however much more there is
+	n, err = limit.Copy(out, bytes.NewReader(make([]byte, 1000000)))
+	assert.Regexp("Solidity source of 101 bytes exceeds the maximum of 100 bytes", err)
+	assert.Equal(int64(41), n)
+	assert.True(limit.Exceeded())
+	_, err = limit.Copy(out, bytes.NewReader(make([]byte, 1)))
+	assert.Regexp("exceeds the maximum of 100 bytes", err)
+
+	limit = (&SolcConf{}).NewSourceLimit()
+	n, err = limit.Copy(out, bytes.NewReader(make([]byte, 1000)))
+	assert.NoError(err)
+	assert.Equal(int64(1000), n)
+	assert.False(limit.Exceeded())
+}
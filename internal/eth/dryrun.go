@@ -0,0 +1,65 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+)
+
+// DryRunResult describes the unsigned transaction that Send would have submitted
+type DryRunResult struct {
+	Gas      uint64
+	GasPrice *big.Int
+	Data     []byte
+}
+
+// ContractAddress predicts the address of a contract deployed from an address with a nonce,
+// which is the last 20 bytes of the keccak256 hash of the RLP encoded [from, nonce]
+func ContractAddress(from ethbinding.Address, nonce uint64) ethbinding.Address {
+	hash := ethbind.API.Keccak256(rlpEncodeList(
+		rlpEncodeBytes(from.Bytes()),
+		rlpEncodeUint(new(big.Int).SetUint64(nonce)),
+	))
+	var addr ethbinding.Address
+	copy(addr[:], hash[12:])
+	return addr
+}
+
+// DryRun prepares the transaction as Send would, estimating the gas, but does not sign it or
+// submit it to the node. A signed transaction is never returned, as anyone who could make a
+// dry run could then broadcast it, bypassing any policy applied when it is submitted
+func (tx *Txn) DryRun(ctx context.Context, rpc RPCClient) (*DryRunResult, error) {
+	txArgs, err := tx.prepareSend(ctx, rpc)
+	if err != nil {
+		return nil, err
+	}
+	result := &DryRunResult{
+		Gas:      uint64(*txArgs.Gas),
+		GasPrice: tx.EthTX.GasPrice(),
+		Data:     tx.EthTX.Data(),
+	}
+	isPrivate := tx.PrivacyGroupID != "" || len(tx.PrivateFor) > 0
+	if tx.Signer != nil && isPrivate && tx.PrivatePayloadStore == nil {
+		return nil, errors.Errorf(errors.TransactionSendPrivateTXWithExternalSigner, tx.Signer.Type())
+	}
+	log.Infof("TX dry run OK. gas=%d", result.Gas)
+	return result, nil
+}
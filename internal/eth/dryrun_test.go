@@ -0,0 +1,106 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContractAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	from := ethbind.API.HexToAddress("0x6ac7ea33f8831ea9dcc53393aaa88b25a785dbf0")
+	assert.Equal("0xcd234a471b72ba2f1ccf0a70fcaba648a5eecd8d", hexAddr(ContractAddress(from, 0)))
+	assert.Equal("0x343c43a37d37dff08ae8c4a11544c718abb4fcf8", hexAddr(ContractAddress(from, 1)))
+}
+
+func hexAddr(addr ethbinding.Address) string {
+	return fmt.Sprintf("0x%x", addr.Bytes())
+}
+
+func newDryRunTestTxn(assert *assert.Assertions, signer TXSigner) *Txn {
+	var msg messages.DeployContract
+	msg.Compiled = []byte{0x60, 0x80}
+	msg.ABI = ethbinding.ABIMarshaling{}
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Nonce = "5"
+	msg.Value = "0"
+	msg.GasPrice = "1000000000"
+	tx, err := NewContractDeployTxn(&msg, signer, false, 0)
+	assert.NoError(err)
+	return tx
+}
+
+func TestDryRunEstimatesWithoutSending(t *testing.T) {
+	assert := assert.New(t)
+
+	tx := newDryRunTestTxn(assert, nil)
+	rpc := testRPCClient{resultWrangler: estimateGasWrangler(100000)}
+	result, err := tx.DryRun(context.Background(), &rpc)
+	assert.NoError(err)
+	assert.Equal("eth_estimateGas", rpc.capturedMethod)
+	assert.Equal("", rpc.capturedMethod2)
+	assert.Equal(uint64(120000), result.Gas)
+	assert.Equal(int64(1000000000), result.GasPrice.Int64())
+	assert.Equal([]byte{0x60, 0x80}, result.Data)
+	assert.Equal("", tx.Hash)
+}
+
+func TestDryRunDoesNotSign(t *testing.T) {
+	assert := assert.New(t)
+
+	signer := &mockTXSigner{
+		signed: []byte("testbytes"),
+		from:   "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	}
+	tx := newDryRunTestTxn(assert, signer)
+	rpc := testRPCClient{}
+	result, err := tx.DryRun(context.Background(), &rpc)
+	assert.NoError(err)
+	assert.Equal([]byte{0x60, 0x80}, result.Data)
+	assert.Equal("", rpc.capturedMethod2)
+	assert.Nil(signer.capturedTX)
+	assert.Equal(float64(0), tx.StageTimes.Sign)
+}
+
+func TestDryRunPrivateWithSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	signer := &mockTXSigner{
+		from: "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	}
+	tx := newDryRunTestTxn(assert, signer)
+	tx.PrivateFor = []string{"member1"}
+	_, err := tx.DryRun(context.Background(), &testRPCClient{})
+	assert.Regexp("Signing with mock signer is not currently supported with private transactions", err)
+}
+
+func TestDryRunGasEstimateFails(t *testing.T) {
+	assert := assert.New(t)
+
+	tx := newDryRunTestTxn(assert, nil)
+	_, err := tx.DryRun(context.Background(), &testRPCClient{
+		mockError:  fmt.Errorf("pop"),
+		mockError2: fmt.Errorf("reverted"),
+	})
+	assert.EqualError(err, "reverted")
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+// GetCode gets the deployed bytecode at an address. An empty result means
+// there is no contract at the address (it is an externally owned account, or unused)
+func GetCode(ctx context.Context, rpc RPCClient, addr *ethbinding.Address, blockNumber string) ([]byte, error) {
+	start := time.Now().UTC()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var code ethbinding.HexBytes
+	if err := rpc.CallContext(ctx, &code, "eth_getCode", addr, blockNumber); err != nil {
+		return nil, errors.Errorf(errors.RPCCallReturnedError, "eth_getCode", err)
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("eth_getCode(%x,%s)=%d bytes [%.2fs]", addr, blockNumber, len(code), callTime.Seconds())
+	return code, nil
+}
+
+// stripBytecodeMetadata removes the CBOR encoded metadata that solc appends to runtime bytecode,
+// which includes a hash of the source and compiler settings. The final two bytes are its length
+func stripBytecodeMetadata(code []byte) []byte {
+	if len(code) < 2 {
+		return code
+	}
+	metadataLen := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	if metadataLen == 0 || metadataLen+2 > len(code) {
+		return code
+	}
+	// The metadata is a CBOR map, so the first byte has major type 5
+	if code[len(code)-2-metadataLen]&0xe0 != 0xa0 {
+		return code
+	}
+	return code[:len(code)-2-metadataLen]
+}
+
+// BytecodeFingerprint returns the hex encoded CBOR metadata that solc appends to bytecode, which
+// includes a hash of the metadata of the contract (the ABI, source and compiler settings), so
+// identifies the contract the code was compiled from. An empty string is returned if there is none
+func BytecodeFingerprint(code []byte) string {
+	stripped := stripBytecodeMetadata(code)
+	if len(stripped) == len(code) {
+		return ""
+	}
+	return hex.EncodeToString(code[len(stripped) : len(code)-2])
+}
+
+// RuntimeBytecodeMatches compares the code deployed at an address with the runtime bytecode from
+// compiling a contract. The metadata is ignored, as is the value of any immutable variables -
+// which solc leaves as zero-filled PUSH32 placeholders in the compiled runtime bytecode
+func RuntimeBytecodeMatches(deployed, compiled []byte) bool {
+	deployed = stripBytecodeMetadata(deployed)
+	compiled = stripBytecodeMetadata(compiled)
+	if len(deployed) != len(compiled) {
+		return false
+	}
+	zeroWord := make([]byte, 32)
+	for i := 0; i < len(compiled); i++ {
+		op := compiled[i]
+		if deployed[i] != op {
+			return false
+		}
+		if op < 0x60 || op > 0x7f {
+			continue
+		}
+		// PUSH1 to PUSH32 are followed by 1-32 bytes of data
+		end := i + 1 + int(op-0x5f)
+		if end > len(compiled) {
+			end = len(compiled)
+		}
+		operand := compiled[i+1 : end]
+		if !(op == 0x7f && bytes.Equal(operand, zeroWord)) && !bytes.Equal(operand, deployed[i+1:end]) {
+			return false
+		}
+		i = end - 1
+	}
+	return true
+}
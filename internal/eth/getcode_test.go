@@ -0,0 +1,110 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCode(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*ethbinding.HexBytes)) = []byte{0x60, 0x80}
+		},
+	}
+
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	code, err := GetCode(context.Background(), &r, &addr, "latest")
+
+	assert.NoError(err)
+	assert.Equal([]byte{0x60, 0x80}, code)
+	assert.Equal("eth_getCode", r.capturedMethod)
+	assert.Equal("latest", r.capturedArgs[1])
+}
+
+func TestGetCodeErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	_, err := GetCode(context.Background(), &r, &addr, "latest")
+
+	assert.EqualError(err, "eth_getCode returned: pop")
+}
+
+func TestStripBytecodeMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	code := []byte{0x60, 0x80, 0x60, 0x40}
+	metadata := []byte{0xa2, 0x64, 0x69, 0x70, 0x66, 0x73}
+	withMetadata := append(append(append([]byte{}, code...), metadata...), 0x00, byte(len(metadata)))
+	assert.Equal(code, stripBytecodeMetadata(withMetadata))
+
+	assert.Equal(code, stripBytecodeMetadata(code))
+	assert.Equal([]byte{0x01}, stripBytecodeMetadata([]byte{0x01}))
+	assert.Equal([]byte{0x60, 0x00, 0x00}, stripBytecodeMetadata([]byte{0x60, 0x00, 0x00}))
+	assert.Equal([]byte{0x60, 0x80, 0xff, 0x00, 0x02}, stripBytecodeMetadata([]byte{0x60, 0x80, 0xff, 0x00, 0x02}))
+}
+
+func TestBytecodeFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	code := []byte{0x60, 0x80, 0x60, 0x40}
+	metadata := []byte{0xa2, 0x64, 0x69, 0x70, 0x66, 0x73}
+	withMetadata := append(append(append([]byte{}, code...), metadata...), 0x00, byte(len(metadata)))
+	assert.Equal("a26469706673", BytecodeFingerprint(withMetadata))
+
+	assert.Equal("", BytecodeFingerprint(code))
+	assert.Equal("", BytecodeFingerprint(nil))
+}
+
+func TestRuntimeBytecodeMatches(t *testing.T) {
+	assert := assert.New(t)
+
+	withMetadata := func(code []byte, hash byte) []byte {
+		metadata := []byte{0xa1, 0x64, 0x69, 0x70, 0x66, 0x73, hash}
+		return append(append(append([]byte{}, code...), metadata...), 0x00, byte(len(metadata)))
+	}
+	immutable := make([]byte, 32)
+	for i := range immutable {
+		immutable[i] = 0xee
+	}
+	placeholder := append(append([]byte{0x60, 0x80, 0x7f}, make([]byte, 32)...), 0x55)
+	deployed := append(append([]byte{0x60, 0x80, 0x7f}, immutable...), 0x55)
+
+	// Different metadata, and an immutable filled in at deployment
+	assert.True(RuntimeBytecodeMatches(withMetadata(deployed, 0x01), withMetadata(placeholder, 0x02)))
+	assert.True(RuntimeBytecodeMatches(deployed, deployed))
+
+	// Code differences
+	assert.False(RuntimeBytecodeMatches([]byte{0x60, 0x81}, []byte{0x60, 0x80}))
+	assert.False(RuntimeBytecodeMatches([]byte{0x61, 0x80}, []byte{0x60, 0x80}))
+	assert.False(RuntimeBytecodeMatches([]byte{0x60, 0x80, 0x00}, []byte{0x60, 0x80}))
+	assert.False(RuntimeBytecodeMatches(placeholder, deployed))
+
+	// Truncated push data
+	assert.True(RuntimeBytecodeMatches([]byte{0x61, 0x01}, []byte{0x61, 0x01}))
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLogsChunkSize is the number of blocks queried with each eth_getLogs call
+	DefaultLogsChunkSize = 1000
+	// DefaultLogsPageLimit is the number of logs after which a page is returned to the client
+	DefaultLogsPageLimit = 1000
+)
+
+var topicCheck = regexp.MustCompile("^0x[0-9a-fA-F]{64}$")
+
+// logsLimitErrors are substrings of errors returned by nodes (and hosted node providers)
+// when the result of an eth_getLogs call would be too large, where querying a smaller
+// range of blocks will succeed
+var logsLimitErrors = []string{
+	"query returned more than",
+	"response size exceeded",
+	"response size should not",
+	"block range",
+	"limit exceeded",
+	"too many",
+}
+
+// LogsQuery is a query for the historical logs in a range of blocks, which is paged
+// through in chunks of blocks. The query of the next page is returned to the client
+// as an opaque cursor
+type LogsQuery struct {
+	Address   string    `json:"address,omitempty"`
+	Topics    []*string `json:"topics,omitempty"`
+	FromBlock uint64    `json:"fromBlock"`
+	ToBlock   uint64    `json:"toBlock"`
+	ChunkSize uint64    `json:"chunkSize"`
+}
+
+// LogsPage is a page of the results of a historical log query. The cursor is
+// only set if there are more blocks to query
+type LogsPage struct {
+	FromBlock string            `json:"fromBlock"`
+	ToBlock   string            `json:"toBlock"`
+	Logs      []json.RawMessage `json:"logs"`
+	Cursor    string            `json:"cursor,omitempty"`
+}
+
+type logsFilter struct {
+	Address   string    `json:"address,omitempty"`
+	Topics    []*string `json:"topics,omitempty"`
+	FromBlock string    `json:"fromBlock"`
+	ToBlock   string    `json:"toBlock"`
+}
+
+// GetBlockNumber returns the current block height of the node
+func GetBlockNumber(ctx context.Context, rpc RPCClient) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	blockHeight := ethbinding.HexBigInt{}
+	if err := rpc.CallContext(ctx, &blockHeight, "eth_blockNumber"); err != nil {
+		return 0, errors.Errorf(errors.RPCCallReturnedError, "eth_blockNumber", err)
+	}
+	return blockHeight.ToInt().Uint64(), nil
+}
+
+// NewLogsQuery builds a historical log query for an optional contract address and
+// positional topics, where an empty topic matches any value. The blocks can be decimal
+// or hex numbers, and the start block defaults to zero
+func NewLogsQuery(address string, topics []string, fromBlock, toBlock string) (*LogsQuery, error) {
+	q := &LogsQuery{
+		Address:   address,
+		ChunkSize: DefaultLogsChunkSize,
+	}
+	for _, topic := range topics {
+		if topic == "" {
+			q.Topics = append(q.Topics, nil)
+			continue
+		}
+		if !topicCheck.MatchString(topic) {
+			return nil, errors.Errorf(errors.LogsQueryInvalidTopic, topic)
+		}
+		t := strings.ToLower(topic)
+		q.Topics = append(q.Topics, &t)
+	}
+	var err error
+	if fromBlock != "" {
+		if q.FromBlock, err = parseLogsBlock(fromBlock); err != nil {
+			return nil, err
+		}
+	}
+	if q.ToBlock, err = parseLogsBlock(toBlock); err != nil {
+		return nil, err
+	}
+	if q.FromBlock > q.ToBlock {
+		return nil, errors.Errorf(errors.LogsQueryInvalidBlockRange, q.FromBlock, q.ToBlock)
+	}
+	return q, nil
+}
+
+// ParseLogsCursor returns the query for the next page of a historical log query
+func ParseLogsCursor(cursor string) (*LogsQuery, error) {
+	var q LogsQuery
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(b, &q)
+	}
+	if err != nil || q.ChunkSize == 0 || q.FromBlock > q.ToBlock {
+		return nil, errors.Errorf(errors.LogsQueryInvalidCursor, cursor)
+	}
+	return &q, nil
+}
+
+func parseLogsBlock(block string) (uint64, error) {
+	var n uint64
+	var err error
+	if strings.HasPrefix(block, "0x") {
+		n, err = strconv.ParseUint(block[2:], 16, 64)
+	} else {
+		n, err = strconv.ParseUint(block, 10, 64)
+	}
+	if err != nil {
+		return 0, errors.Errorf(errors.LogsQueryInvalidBlock, block)
+	}
+	return n, nil
+}
+
+func isLogsLimitError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, limitErr := range logsLimitErrors {
+		if strings.Contains(msg, limitErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Cursor returns the opaque continuation cursor for the query
+func (q *LogsQuery) Cursor() string {
+	b, _ := json.Marshal(q)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// GetLogs queries the logs for a page of the block range, calling eth_getLogs for chunks
+// of blocks until at least the limit number of logs have been returned, or the end of the range.
+// Pages always end on a chunk boundary, so can contain more logs than the limit.
+// If the node rejects a chunk as too large, the chunk size is halved for the rest of the query
+func GetLogs(ctx context.Context, rpc RPCClient, q *LogsQuery, limit int) (*LogsPage, error) {
+	start := time.Now().UTC()
+
+	page := &LogsPage{
+		FromBlock: strconv.FormatUint(q.FromBlock, 10),
+		Logs:      []json.RawMessage{},
+	}
+	next := *q
+	for next.FromBlock <= q.ToBlock && len(page.Logs) < limit {
+		to := next.FromBlock + next.ChunkSize - 1
+		if to > q.ToBlock || to < next.FromBlock {
+			to = q.ToBlock
+		}
+		filter := &logsFilter{
+			Address:   q.Address,
+			Topics:    q.Topics,
+			FromBlock: "0x" + strconv.FormatUint(next.FromBlock, 16),
+			ToBlock:   "0x" + strconv.FormatUint(to, 16),
+		}
+		var logs []json.RawMessage
+		callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err := rpc.CallContext(callCtx, &logs, "eth_getLogs", filter)
+		cancel()
+		if err != nil {
+			if isLogsLimitError(err) && to > next.FromBlock {
+				next.ChunkSize = (to - next.FromBlock + 1) / 2
+				log.Infof("eth_getLogs(%d-%d) too large. Reduced chunk size to %d: %s", next.FromBlock, to, next.ChunkSize, err)
+				continue
+			}
+			return nil, errors.Errorf(errors.RPCCallReturnedError, "eth_getLogs", err)
+		}
+		page.Logs = append(page.Logs, logs...)
+		page.ToBlock = strconv.FormatUint(to, 10)
+		if to == q.ToBlock {
+			break
+		}
+		next.FromBlock = to + 1
+	}
+	if page.ToBlock != strconv.FormatUint(q.ToBlock, 10) {
+		page.Cursor = next.Cursor()
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("eth_getLogs(%s,%s-%s)=%d logs [%.2fs]", q.Address, page.FromBlock, page.ToBlock, len(page.Logs), callTime.Seconds())
+	return page, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+type testLogsRPC struct {
+	ranges    [][2]uint64
+	logsEach  int
+	failAbove uint64
+	err       error
+}
+
+func (r *testLogsRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	switch method {
+	case "eth_blockNumber":
+		*(result.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*big.NewInt(2500))
+		return nil
+	case "eth_getLogs":
+		filter := args[0].(*logsFilter)
+		from, _ := strconv.ParseUint(strings.TrimPrefix(filter.FromBlock, "0x"), 16, 64)
+		to, _ := strconv.ParseUint(strings.TrimPrefix(filter.ToBlock, "0x"), 16, 64)
+		if r.err != nil {
+			return r.err
+		}
+		if r.failAbove > 0 && to-from+1 > r.failAbove {
+			return fmt.Errorf("query returned more than 10000 results")
+		}
+		r.ranges = append(r.ranges, [2]uint64{from, to})
+		logs := result.(*[]json.RawMessage)
+		for i := 0; i < r.logsEach; i++ {
+			*logs = append(*logs, json.RawMessage(fmt.Sprintf(`{"blockNumber":"0x%x"}`, from)))
+		}
+	}
+	return nil
+}
+
+func TestNewLogsQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	topic := "0x" + strings.Repeat("AB", 32)
+	q, err := NewLogsQuery("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", []string{topic, ""}, "0x10", "2500")
+	assert.NoError(err)
+	assert.Equal(uint64(16), q.FromBlock)
+	assert.Equal(uint64(2500), q.ToBlock)
+	assert.Equal(uint64(DefaultLogsChunkSize), q.ChunkSize)
+	assert.Equal(strings.ToLower(topic), *q.Topics[0])
+	assert.Nil(q.Topics[1])
+
+	_, err = NewLogsQuery("", []string{"0x1234"}, "", "1")
+	assert.Regexp("Invalid topic", err)
+	_, err = NewLogsQuery("", nil, "abc", "1")
+	assert.Regexp("Invalid block number 'abc'", err)
+	_, err = NewLogsQuery("", nil, "0", "0xzz")
+	assert.Regexp("Invalid block number '0xzz'", err)
+	_, err = NewLogsQuery("", nil, "100", "99")
+	assert.Regexp("Invalid block range", err)
+}
+
+func TestGetBlockNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	blockNumber, err := GetBlockNumber(context.Background(), &testLogsRPC{})
+	assert.NoError(err)
+	assert.Equal(uint64(2500), blockNumber)
+
+	_, err = GetBlockNumber(context.Background(), NewMockRPCClientForSync(fmt.Errorf("pop"), nil))
+	assert.EqualError(err, "eth_blockNumber returned: pop")
+}
+
+func TestGetLogsPagesWithCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &testLogsRPC{logsEach: 2}
+	q := &LogsQuery{FromBlock: 0, ToBlock: 2500, ChunkSize: 1000}
+	page, err := GetLogs(context.Background(), r, q, 3)
+	assert.NoError(err)
+	assert.Equal("0", page.FromBlock)
+	assert.Equal("1999", page.ToBlock)
+	assert.Len(page.Logs, 4)
+	assert.NotEmpty(page.Cursor)
+
+	q, err = ParseLogsCursor(page.Cursor)
+	assert.NoError(err)
+	assert.Equal(uint64(2000), q.FromBlock)
+	page, err = GetLogs(context.Background(), r, q, 3)
+	assert.NoError(err)
+	assert.Equal("2000", page.FromBlock)
+	assert.Equal("2500", page.ToBlock)
+	assert.Len(page.Logs, 2)
+	assert.Empty(page.Cursor)
+
+	assert.Equal([][2]uint64{{0, 999}, {1000, 1999}, {2000, 2500}}, r.ranges)
+}
+
+func TestGetLogsReducesChunkSize(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &testLogsRPC{failAbove: 300}
+	q := &LogsQuery{FromBlock: 100, ToBlock: 1099, ChunkSize: 1000}
+	page, err := GetLogs(context.Background(), r, q, DefaultLogsPageLimit)
+	assert.NoError(err)
+	assert.Equal("1099", page.ToBlock)
+	assert.Empty(page.Cursor)
+	assert.Equal([2]uint64{100, 349}, r.ranges[0])
+	assert.Len(r.ranges, 4)
+}
+
+func TestGetLogsFail(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &testLogsRPC{err: fmt.Errorf("pop")}
+	_, err := GetLogs(context.Background(), r, &LogsQuery{ToBlock: 10, ChunkSize: 1000}, 1)
+	assert.EqualError(err, "eth_getLogs returned: pop")
+
+	r = &testLogsRPC{failAbove: 1}
+	_, err = GetLogs(context.Background(), r, &LogsQuery{ToBlock: 10, ChunkSize: 1}, 1)
+	assert.NoError(err)
+	r = &testLogsRPC{err: fmt.Errorf("query returned more than 10000 results")}
+	_, err = GetLogs(context.Background(), r, &LogsQuery{FromBlock: 5, ToBlock: 5, ChunkSize: 1000}, 1)
+	assert.Regexp("query returned more than", err)
+}
+
+func TestParseLogsCursorBad(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseLogsCursor("!!!")
+	assert.Regexp("Invalid cursor", err)
+	_, err = ParseLogsCursor((&LogsQuery{FromBlock: 10, ToBlock: 5, ChunkSize: 1}).Cursor())
+	assert.Regexp("Invalid cursor", err)
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+// StorageSlot parses a storage slot supplied as a decimal, or 0x prefixed hex, number
+// into the hex quantity expected by the node
+func StorageSlot(slot string) (string, error) {
+	n, ok := new(big.Int), false
+	if strings.HasPrefix(slot, "0x") || strings.HasPrefix(slot, "0X") {
+		_, ok = n.SetString(slot[2:], 16)
+	} else {
+		_, ok = n.SetString(slot, 10)
+	}
+	if !ok || n.Sign() < 0 || n.BitLen() > 256 {
+		return "", errors.Errorf(errors.StorageSlotInvalid, slot)
+	}
+	return ethbind.API.EncodeBig(n), nil
+}
+
+// GetStorageAt reads the raw 32 byte value of a storage slot of a contract, at the
+// supplied block number, or tag. See CallMethod for the allowed block numbers
+func GetStorageAt(ctx context.Context, rpc RPCClient, addr *ethbinding.Address, slot, blocknumber string) (string, error) {
+	start := time.Now().UTC()
+
+	slotHex, err := StorageSlot(slot)
+	if err != nil {
+		return "", err
+	}
+	blockOption, err := callBlockOption(blocknumber)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var value string
+	if err := rpc.CallContext(ctx, &value, "eth_getStorageAt", addr, slotHex, blockOption); err != nil {
+		return "", errors.Errorf(errors.RPCCallReturnedError, "eth_getStorageAt", err)
+	}
+	callTime := time.Now().UTC().Sub(start)
+	log.Debugf("eth_getStorageAt(%x,%s,%s)=%s [%.2fs]", addr, slotHex, blockOption, value, callTime.Seconds())
+	return value, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageSlot(t *testing.T) {
+	assert := assert.New(t)
+
+	slot, err := StorageSlot("0")
+	assert.NoError(err)
+	assert.Equal("0x0", slot)
+
+	slot, err = StorageSlot("10")
+	assert.NoError(err)
+	assert.Equal("0xa", slot)
+
+	slot, err = StorageSlot("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc")
+	assert.NoError(err)
+	assert.Equal("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc", slot)
+
+	_, err = StorageSlot("0x1" + strings.Repeat("0", 64))
+	assert.Regexp("Invalid storage slot", err)
+	_, err = StorageSlot("-1")
+	assert.Regexp("Invalid storage slot", err)
+	_, err = StorageSlot("0xzz")
+	assert.Regexp("Invalid storage slot", err)
+	_, err = StorageSlot("")
+	assert.Regexp("Invalid storage slot", err)
+}
+
+func TestGetStorageAt(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*string)) = "0x000000000000000000000000000000000000000000000000000000000000002a"
+		},
+	}
+
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	value, err := GetStorageAt(context.Background(), &r, &addr, "1", "12345")
+
+	assert.NoError(err)
+	assert.Equal("0x000000000000000000000000000000000000000000000000000000000000002a", value)
+	assert.Equal("eth_getStorageAt", r.capturedMethod)
+	assert.Equal("0x1", r.capturedArgs[1])
+	assert.Equal("0x3039", r.capturedArgs[2])
+}
+
+func TestGetStorageAtBadArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{}
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+
+	_, err := GetStorageAt(context.Background(), &r, &addr, "badness", "latest")
+	assert.Regexp("Invalid storage slot", err)
+
+	_, err = GetStorageAt(context.Background(), &r, &addr, "0", "badness")
+	assert.Regexp("Invalid blocknumber", err)
+	assert.Empty(r.capturedMethod)
+}
+
+func TestGetStorageAtErr(t *testing.T) {
+	assert := assert.New(t)
+
+	r := testRPCClient{
+		mockError: fmt.Errorf("pop"),
+	}
+
+	addr := ethbind.API.HexToAddress("0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C")
+	_, err := GetStorageAt(context.Background(), &r, &addr, "0", "latest")
+
+	assert.EqualError(err, "eth_getStorageAt returned: pop")
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"math/big"
+	"strconv"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+const (
+	// NumberFormatString returns integer outputs as decimal strings (the default)
+	NumberFormatString = "string"
+	// NumberFormatNumber returns integer outputs as JSON numbers, when they can be represented
+	// exactly by a JSON parser using double precision floats, and as decimal strings otherwise
+	NumberFormatNumber = "number"
+	// NumberFormatHex returns integer outputs as decimal strings, with the 0x prefixed hex value
+	// alongside in a field with the Hex suffix
+	NumberFormatHex = "hex"
+)
+
+// maxSafeJSONInteger is the largest integer a double precision float represents exactly (2^53-1)
+var maxSafeJSONInteger = big.NewInt(9007199254740991)
+
+// ValidateNumberFormat checks the format is one of the supported formats, or empty for the default
+func ValidateNumberFormat(format string) error {
+	switch format {
+	case "", NumberFormatString, NumberFormatNumber, NumberFormatHex:
+		return nil
+	default:
+		return errors.Errorf(errors.NumberFormatInvalid, format)
+	}
+}
+
+// FormatNumbers re-formats the integer outputs in the result of a call, returned by
+// ProcessRLPBytes, to the requested format. Outputs nested in arrays and tuples are included
+func FormatNumbers(args ethbinding.ABIArguments, retval map[string]interface{}, format string) {
+	if format == "" || format == NumberFormatString {
+		return
+	}
+	for idx, output := range args {
+		argName := output.Name
+		if argName == "" {
+			argName = "output"
+			if idx != 0 {
+				argName += strconv.Itoa(idx)
+			}
+		}
+		formatField(retval, argName, &output.Type, format)
+	}
+}
+
+func formatField(m map[string]interface{}, name string, t *ethbinding.ABIType, format string) {
+	v, exists := m[name]
+	if !exists {
+		return
+	}
+	formatted, hex := formatValue(t, v, format)
+	m[name] = formatted
+	if hex != nil {
+		m[name+"Hex"] = hex
+	}
+}
+
+// formatValue returns the value in the requested format, and for the hex format the hex form
+// of integers and arrays of integers. Tuples have the hex forms added to their own fields
+func formatValue(t *ethbinding.ABIType, v interface{}, format string) (formatted interface{}, hex interface{}) {
+	switch t.T {
+	case ethbinding.IntTy, ethbinding.UintTy:
+		s, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return v, nil
+		}
+		if format == NumberFormatHex {
+			return s, ethbind.API.EncodeBig(i)
+		}
+		if new(big.Int).Abs(i).Cmp(maxSafeJSONInteger) <= 0 {
+			return json.Number(s), nil
+		}
+		return s, nil
+	case ethbinding.SliceTy, ethbinding.ArrayTy:
+		a, ok := v.([]interface{})
+		if !ok {
+			return v, nil
+		}
+		hexArray := make([]interface{}, len(a))
+		hasHex := false
+		for i, elem := range a {
+			a[i], hexArray[i] = formatValue(t.Elem, elem, format)
+			hasHex = hasHex || hexArray[i] != nil
+		}
+		if hasHex {
+			return a, hexArray
+		}
+		return a, nil
+	case ethbinding.TupleTy:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v, nil
+		}
+		for i, fieldName := range t.TupleRawNames {
+			if fieldName == "" {
+				fieldName = t.TupleType.Field(i).Name
+			}
+			formatField(m, fieldName, t.TupleElems[i], format)
+		}
+		return m, nil
+	default:
+		return v, nil
+	}
+}
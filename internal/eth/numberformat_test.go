@@ -0,0 +1,129 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNumberFormatOutputs(t *testing.T) ethbinding.ABIArguments {
+	method, err := ethbind.API.ABIElementMarshalingToABIMethod(&ethbinding.ABIElementMarshaling{
+		Type: "function",
+		Name: "get",
+		Outputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "small", Type: "uint256"},
+			{Name: "", Type: "int256"},
+			{Name: "big", Type: "uint256"},
+			{Name: "arr", Type: "uint8[]"},
+			{Name: "t", Type: "tuple", Components: []ethbinding.ABIArgumentMarshaling{
+				{Name: "a", Type: "uint64"},
+				{Name: "s", Type: "string"},
+			}},
+			{Name: "name", Type: "string"},
+		},
+	})
+	assert.NoError(t, err)
+	return method.Outputs
+}
+
+func testNumberFormatResult() map[string]interface{} {
+	return map[string]interface{}{
+		"small":   "123456",
+		"output1": "-9007199254740991",
+		"big":     "9007199254740992",
+		"arr":     []interface{}{"1", "255"},
+		"t":       map[string]interface{}{"a": "10", "s": "12"},
+		"name":    "42",
+	}
+}
+
+func TestValidateNumberFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateNumberFormat(""))
+	assert.NoError(ValidateNumberFormat(NumberFormatString))
+	assert.NoError(ValidateNumberFormat(NumberFormatNumber))
+	assert.NoError(ValidateNumberFormat(NumberFormatHex))
+	assert.EqualError(ValidateNumberFormat("float"), "Invalid number format 'float'. Must be 'string', 'number' or 'hex'")
+}
+
+func TestFormatNumbersString(t *testing.T) {
+	assert := assert.New(t)
+
+	retval := testNumberFormatResult()
+	FormatNumbers(testNumberFormatOutputs(t), retval, NumberFormatString)
+	assert.Equal(testNumberFormatResult(), retval)
+}
+
+func TestFormatNumbersNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	retval := testNumberFormatResult()
+	FormatNumbers(testNumberFormatOutputs(t), retval, NumberFormatNumber)
+	b, _ := json.Marshal(retval)
+	assert.JSONEq(`{
+		"small": 123456,
+		"output1": -9007199254740991,
+		"big": "9007199254740992",
+		"arr": [1, 255],
+		"t": {"a": 10, "s": "12"},
+		"name": "42"
+	}`, string(b))
+}
+
+func TestFormatNumbersHex(t *testing.T) {
+	assert := assert.New(t)
+
+	retval := testNumberFormatResult()
+	FormatNumbers(testNumberFormatOutputs(t), retval, NumberFormatHex)
+	b, _ := json.Marshal(retval)
+	assert.JSONEq(`{
+		"small": "123456",
+		"smallHex": "0x1e240",
+		"output1": "-9007199254740991",
+		"output1Hex": "-0x1fffffffffffff",
+		"big": "9007199254740992",
+		"bigHex": "0x20000000000000",
+		"arr": ["1", "255"],
+		"arrHex": ["0x1", "0xff"],
+		"t": {"a": "10", "aHex": "0xa", "s": "12"},
+		"name": "42"
+	}`, string(b))
+}
+
+func TestFormatNumbersUnexpectedValues(t *testing.T) {
+	assert := assert.New(t)
+
+	retval := map[string]interface{}{
+		"small": 12345,
+		"big":   "not a number",
+		"arr":   "not an array",
+		"t":     "not a map",
+		"error": "Failed to unpack values",
+	}
+	FormatNumbers(testNumberFormatOutputs(t), retval, NumberFormatHex)
+	assert.Equal(map[string]interface{}{
+		"small": 12345,
+		"big":   "not a number",
+		"arr":   "not an array",
+		"t":     "not a map",
+		"error": "Failed to unpack values",
+	}, retval)
+}
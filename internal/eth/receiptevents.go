@@ -0,0 +1,132 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+// TxnLog is a log emitted by a transaction, as returned in its receipt
+type TxnLog struct {
+	Address *ethbinding.Address `json:"address"`
+	Data    string              `json:"data"`
+	Topics  []*ethbinding.Hash  `json:"topics"`
+}
+
+// DecodeReceiptEvents decodes the logs in a receipt that were emitted by a contract, using its ABI.
+// For a deployment these are the events emitted by the constructor. Logs emitted by other contracts,
+// or of events that are not in the ABI, cannot be decoded so are skipped
+func DecodeReceiptEvents(abiMarshaling ethbinding.ABIMarshaling, contractAddress *ethbinding.Address, logs []*TxnLog) []*messages.ReceiptEvent {
+	if len(abiMarshaling) == 0 || contractAddress == nil || len(logs) == 0 {
+		return nil
+	}
+	abi, err := RuntimeABI(abiMarshaling)
+	if err != nil {
+		log.Warnf("Unable to decode the events of %s: %s", contractAddress.Hex(), err)
+		return nil
+	}
+	eventsByTopic := make(map[ethbinding.Hash]*ethbinding.ABIEvent)
+	for _, event := range abi.Events {
+		if !event.Anonymous {
+			e := event
+			eventsByTopic[e.ID] = &e
+		}
+	}
+
+	var events []*messages.ReceiptEvent
+	for i, l := range logs {
+		if l == nil || l.Address == nil || *l.Address != *contractAddress || len(l.Topics) == 0 || l.Topics[0] == nil {
+			continue
+		}
+		event, ok := eventsByTopic[*l.Topics[0]]
+		if !ok {
+			continue
+		}
+		decoded, err := decodeLog(event, l)
+		if err != nil {
+			log.Warnf("Unable to decode log %d emitted by %s: %s", i, contractAddress.Hex(), err)
+			continue
+		}
+		events = append(events, decoded)
+	}
+	return events
+}
+
+func decodeLog(event *ethbinding.ABIEvent, l *TxnLog) (*messages.ReceiptEvent, error) {
+	var data []byte
+	if strings.HasPrefix(l.Data, "0x") {
+		var err error
+		if data, err = ethbind.API.HexDecode(l.Data); err != nil {
+			return nil, err
+		}
+	}
+	decoded := &messages.ReceiptEvent{
+		Address:   l.Address.Hex(),
+		Signature: ethbind.API.ABIEventSignature(event),
+		Data:      make(map[string]interface{}),
+	}
+	topicIdx := 1 // the first topic is the hash of the event signature
+	dataArgs := make(ethbinding.ABIArguments, 0, len(event.Inputs))
+	for _, input := range event.Inputs {
+		if !input.Indexed {
+			dataArgs = append(dataArgs, input)
+			continue
+		}
+		var val interface{}
+		if topicIdx < len(l.Topics) && l.Topics[topicIdx] != nil {
+			val = TopicToValue(l.Topics[topicIdx], &input)
+		}
+		topicIdx++
+		decoded.Data[input.Name] = val
+	}
+	if len(dataArgs) > 0 {
+		for k, v := range ProcessRLPBytes(dataArgs, data) {
+			decoded.Data[k] = v
+		}
+	}
+	return decoded, nil
+}
+
+// TopicToValue returns the value of an indexed parameter of an event, from its topic
+func TopicToValue(topic *ethbinding.Hash, input *ethbinding.ABIArgument) interface{} {
+	switch input.Type.T {
+	case ethbinding.IntTy, ethbinding.UintTy, ethbinding.BoolTy:
+		h := ethbinding.HexBigInt{}
+		h.UnmarshalText([]byte(topic.Hex()))
+		bI, _ := ethbind.API.ParseBig256(topic.Hex())
+		if input.Type.T == ethbinding.IntTy {
+			// It will be a two's complement number, so needs to be interpretted
+			bI = ethbind.API.S256(bI)
+			return bI.String()
+		} else if input.Type.T == ethbinding.BoolTy {
+			return (bI.Uint64() != 0)
+		}
+		return bI.String()
+	case ethbinding.AddressTy:
+		topicBytes := topic.Bytes()
+		addrBytes := topicBytes[len(topicBytes)-20:]
+		return ethbind.API.BytesToAddress(addrBytes)
+	default:
+		// For all other types it is just a hash of the output for indexing, so we can only
+		// logically return it as a hex string. The Solidity developer has to include
+		// the same data a second type non-indexed to get the real value.
+		return topic.String()
+	}
+}
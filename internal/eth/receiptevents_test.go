@@ -0,0 +1,118 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConstructorEventsABI = `[
+	{"type":"constructor","inputs":[{"name":"value","type":"uint256"}]},
+	{"type":"event","name":"Initialized","anonymous":false,"inputs":[
+		{"name":"owner","type":"address","indexed":true},
+		{"name":"value","type":"uint256","indexed":false}
+	]}
+]`
+
+func testConstructorEventLogs(contractAddress ethbinding.Address) (ethbinding.ABIMarshaling, []*TxnLog) {
+	var abi ethbinding.ABIMarshaling
+	json.Unmarshal([]byte(testConstructorEventsABI), &abi)
+	runtimeABI, _ := RuntimeABI(abi)
+	eventTopic := runtimeABI.Events["Initialized"].ID
+	ownerTopic := ethbind.API.HexToHash("0x0000000000000000000000003924d1d6423f88148a4fcc0417a33b27a61d595f")
+	otherTopic := ethbind.API.HexToHash("0x1111111111111111111111111111111111111111111111111111111111111111")
+	otherAddress := ethbind.API.HexToAddress("0xd7fac2bce408ed7c6ded07a32038b1f79c2b27d3")
+	value := "0x000000000000000000000000000000000000000000000000000000000000002a"
+	return abi, []*TxnLog{
+		{Address: &contractAddress, Data: value, Topics: []*ethbinding.Hash{&eventTopic, &ownerTopic}},
+		{Address: &otherAddress, Data: value, Topics: []*ethbinding.Hash{&eventTopic, &ownerTopic}},
+		{Address: &contractAddress, Data: value, Topics: []*ethbinding.Hash{&otherTopic}},
+		{Address: &contractAddress, Data: "0xzz", Topics: []*ethbinding.Hash{&eventTopic, &ownerTopic}},
+		{Address: &contractAddress, Data: "0x"},
+		nil,
+	}
+}
+
+func TestDecodeReceiptEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	contractAddress := ethbind.API.HexToAddress("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37")
+	abi, logs := testConstructorEventLogs(contractAddress)
+	events := DecodeReceiptEvents(abi, &contractAddress, logs)
+	assert.Equal(1, len(events))
+	assert.Equal(contractAddress.Hex(), events[0].Address)
+	assert.Equal("Initialized(address,uint256)", events[0].Signature)
+	assert.Equal(ethbind.API.HexToAddress("0x3924d1D6423F88148A4fcc0417A33B27a61d595f"), events[0].Data["owner"])
+	assert.Equal("42", events[0].Data["value"])
+}
+
+func TestDecodeReceiptEventsMissingTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	contractAddress := ethbind.API.HexToAddress("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37")
+	abi, logs := testConstructorEventLogs(contractAddress)
+	logs[0].Topics = logs[0].Topics[0:1]
+	events := DecodeReceiptEvents(abi, &contractAddress, logs[0:1])
+	assert.Equal(1, len(events))
+	assert.Nil(events[0].Data["owner"])
+	assert.Equal("42", events[0].Data["value"])
+}
+
+func TestDecodeReceiptEventsNothingToDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	contractAddress := ethbind.API.HexToAddress("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37")
+	abi, logs := testConstructorEventLogs(contractAddress)
+	assert.Nil(DecodeReceiptEvents(nil, &contractAddress, logs))
+	assert.Nil(DecodeReceiptEvents(abi, nil, logs))
+	assert.Nil(DecodeReceiptEvents(abi, &contractAddress, nil))
+
+	badABI := ethbinding.ABIMarshaling{{Type: "event", Name: "Bad", Inputs: []ethbinding.ABIArgumentMarshaling{{Name: "a", Type: "badness"}}}}
+	assert.Nil(DecodeReceiptEvents(badABI, &contractAddress, logs))
+}
+
+func TestTopicToValue(t *testing.T) {
+	assert := assert.New(t)
+
+	h := ethbind.API.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffcfc7")
+	v := TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("int64")})
+	assert.Equal("-12345", v)
+
+	h = ethbind.API.HexToHash("0x000000000000000000000000000000000000000001d2d490d572353317a01f8d")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("uint256")})
+	assert.Equal("564363245346346345353453453", v)
+
+	h = ethbind.API.HexToHash("0x0000000000000000000000003924d1d6423f88148a4fcc0417a33b27a61d595f")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("address")})
+	assert.Equal(ethbind.API.HexToAddress("0x3924d1D6423F88148A4fcc0417A33B27a61d595f"), v)
+
+	h = ethbind.API.HexToHash("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("string")})
+	assert.Equal("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19", v)
+
+	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
+	assert.Equal(false, v)
+
+	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000001")
+	v = TopicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
+	assert.Equal(true, v)
+
+}
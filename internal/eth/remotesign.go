@@ -0,0 +1,87 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+// legacyTxType is the type of the pre-EIP-2718 transactions an EIP-155 signer produces
+const legacyTxType = 0
+
+// secp256k1N is the order of the secp256k1 curve
+var secp256k1N, _ = new(big.Int).SetString("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141", 16)
+
+// SignHashFunc signs the hash of a transaction with a key held elsewhere, such as in a key
+// management service, returning R and S optionally followed by V
+type SignHashFunc func(hash []byte) ([]byte, error)
+
+// SignEIP155TX signs a transaction with EIP-155 replay protection, using a remote signer that only
+// signs its hash. Remote signers do not always return the recovery ID, and might not return the
+// low S value Ethereum requires, so S is normalized and the recovery ID found by recovering the
+// from address, which also checks the remote signer used the right key
+func SignEIP155TX(tx *ethbinding.Transaction, chainID *big.Int, from string, signHash SignHashFunc) ([]byte, error) {
+	if tx.Type() != legacyTxType {
+		return nil, errors.Errorf(errors.TransactionSendRemoteSignUnsupportedType, tx.Type())
+	}
+	ethSigner := ethbind.API.NewEIP155Signer(chainID)
+	hash := ethSigner.Hash(tx)
+	sig, err := signHash(hash.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != 64 && len(sig) != 65 {
+		return nil, errors.Errorf(errors.TransactionSendRemoteSignBadSignature, len(sig))
+	}
+	// The signer expects R, S and a recovery ID of 0 or 1, and applies the chain ID to V itself
+	rsv, ok := recoverableSignature(hash.Bytes(), new(big.Int).SetBytes(sig[0:32]), new(big.Int).SetBytes(sig[32:64]), from)
+	if !ok {
+		return nil, errors.Errorf(errors.TransactionSendRemoteSignWrongSigner, from)
+	}
+	signedTX, err := tx.WithSignature(ethSigner, rsv)
+	if err != nil {
+		return nil, errors.Errorf(errors.TransactionSendRemoteSignFailed, err)
+	}
+	signedRLP := new(bytes.Buffer)
+	signedTX.EncodeRLP(signedRLP)
+	return signedRLP.Bytes(), nil
+}
+
+// recoverableSignature returns the 65 byte R, S, V signature of a hash by an address, with the
+// low S value and the recovery ID of 0 or 1 that Ethereum requires. The recovery ID is found by
+// recovering the address, as signers that return only R and S do not supply it. False is returned
+// if neither recovery ID recovers the address, as the hash was signed with another key
+func recoverableSignature(hash []byte, r, s *big.Int, address string) ([]byte, bool) {
+	if s.Cmp(new(big.Int).Rsh(secp256k1N, 1)) > 0 {
+		s = new(big.Int).Sub(secp256k1N, s)
+	}
+	rsv := make([]byte, 65)
+	r.FillBytes(rsv[0:32])
+	s.FillBytes(rsv[32:64])
+	for id := byte(0); id < 2; id++ {
+		rsv[64] = id
+		pubKey, err := ethbind.API.SigToPub(hash, rsv)
+		if err == nil && strings.EqualFold(ethbind.API.PubkeyToAddress(*pubKey).Hex(), address) {
+			return rsv, true
+		}
+	}
+	return nil, false
+}
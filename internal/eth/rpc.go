@@ -16,13 +16,18 @@ package eth
 
 import (
 	"context"
-	"net/url"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/chaos"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/recorder"
+	"github.com/kaleido-io/ethconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -38,27 +43,71 @@ type RPCConf struct {
 
 // RPCConnOpts configuration params
 type RPCConnOpts struct {
-	URL string `json:"url"`
+	URL            string                `json:"url"`
+	Retry          RPCRetryConf          `json:"retry"`
+	CircuitBreaker RPCCircuitBreakerConf `json:"circuitBreaker"`
+	Shadow         RPCShadowConf         `json:"shadow"`
+	Pool           RPCPoolConf           `json:"pool"`
 }
 
-// RPCConnect wraps rpc.Dial with useful logging, avoiding logging username/password
+// RPCConnect wraps rpc.Dial with useful logging, avoiding logging username/password.
+// A replay:// URL replays the JSON/RPC responses in a recording, rather than connecting to a node
 func RPCConnect(conf *RPCConnOpts) (RPCClientAll, error) {
-	u, _ := url.Parse(conf.URL)
-	if u.User != nil {
-		u.User = url.UserPassword(u.User.Username(), "xxxxxx")
-	}
-	rpcClient, err := ethbind.API.Dial(conf.URL)
-	if err != nil {
+	u := utils.RedactURL(conf.URL)
+	var rpcClient rcpClient
+	var err error
+	if len(conf.Pool.URLs) > 0 {
+		if rpcClient, err = newRPCPool(conf, dialRPC); err != nil {
+			return nil, err
+		}
+	} else if rpcClient, err = dialRPC(conf.URL); err != nil {
 		return nil, errors.Errorf(errors.RPCConnectFailed, u, err)
 	}
 	log.Infof("New JSON/RPC connection established")
 	log.Debugf("JSON/RPC connected to %s", u)
-	return &rpcWrapper{rpc: rpcClient}, nil
+	timestamps, _ := NewBlockTimestampCache(DefaultBlockTimestampCacheSize)
+	w := &rpcWrapper{
+		rpc:        rpcClient,
+		retrier:    newRPCRetrier(&conf.Retry, &conf.CircuitBreaker),
+		timestamps: timestamps,
+	}
+	if conf.Shadow.URL != "" {
+		// Shadow mode must never prevent the primary connection being used
+		if w.shadow, err = rpcShadowFor(&conf.Shadow); err != nil {
+			log.Errorf("JSON/RPC shadow mode disabled, as connecting to %s failed: %s", utils.RedactURL(conf.Shadow.URL), err)
+		}
+	}
+	return w, nil
+}
+
+// dialRPC connects to a single JSON/RPC endpoint, or loads a recording to replay for a replay:// URL
+func dialRPC(url string) (rcpClient, error) {
+	if strings.HasPrefix(url, rpcReplayScheme) {
+		return newRPCReplay(strings.TrimPrefix(url, rpcReplayScheme))
+	}
+	return ethbind.API.Dial(url)
+}
+
+// BlockTimestamps returns the block timestamp cache shared by all users of the connection
+func (w *rpcWrapper) BlockTimestamps() *BlockTimestampCache {
+	return w.timestamps
+}
+
+// BlockGasLimit returns the gas limit of the latest block, cached for all users of the connection
+func (w *rpcWrapper) BlockGasLimit(ctx context.Context) (uint64, error) {
+	return w.gasLimit.get(ctx, w)
 }
 
 // CobraInitRPC sets the standard command-line parameters for RPC
 func CobraInitRPC(cmd *cobra.Command, rconf *RPCConf) {
 	cmd.Flags().StringVarP(&rconf.RPC.URL, "rpc-url", "r", os.Getenv("ETH_RPC_URL"), "JSON/RPC URL for Ethereum node")
+	cmd.Flags().IntVar(&rconf.RPC.Retry.MaxAttempts, "rpc-retry-max", utils.DefInt("ETH_RPC_RETRY_MAX", 0), "Maximum attempts for read-only JSON/RPC calls, and raw transaction sends, that fail with transient errors")
+	cmd.Flags().IntVar(&rconf.RPC.CircuitBreaker.FailureThreshold, "rpc-breaker-threshold", utils.DefInt("ETH_RPC_BREAKER_THRESHOLD", 0), "Consecutive JSON/RPC failures before failing fast (0=disabled)")
+	cmd.Flags().IntVar(&rconf.RPC.CircuitBreaker.ResetTimeoutMS, "rpc-breaker-reset-ms", utils.DefInt("ETH_RPC_BREAKER_RESET_MS", defaultRPCBreakerResetMS), "Time to fail fast before retrying the JSON/RPC node (ms)")
+	cmd.Flags().StringVar(&rconf.RPC.Shadow.URL, "rpc-shadow-url", os.Getenv("ETH_RPC_SHADOW_URL"), "JSON/RPC URL of a secondary node to mirror read-only calls to, logging any results that differ from the primary")
+	cmd.Flags().StringArrayVar(&rconf.RPC.Pool.URLs, "rpc-endpoint", utils.DefStringArray("ETH_RPC_ENDPOINTS"), "Additional JSON/RPC URL for the same chain. Traffic is weighted across all the endpoints by their error rate and latency")
+	cmd.Flags().IntVar(&rconf.RPC.Pool.QuarantineErrorPercent, "rpc-quarantine-error-percent", utils.DefInt("ETH_RPC_QUARANTINE_ERROR_PERCENT", defaultRPCQuarantineErrorPercent), "Error rate of a JSON/RPC endpoint that stops traffic being sent to it, when there are multiple endpoints")
+	cmd.Flags().IntVar(&rconf.RPC.Pool.QuarantineMS, "rpc-quarantine-ms", utils.DefInt("ETH_RPC_QUARANTINE_MS", defaultRPCQuarantineMS), "Time a JSON/RPC endpoint receives no traffic after reaching the quarantine error rate (ms)")
 	return
 }
 
@@ -70,8 +119,27 @@ type rcpClient interface {
 	Close()
 }
 
+type rpcTimeoutKey struct{}
+
+// WithRPCTimeout returns a context that bounds each individual JSON/RPC call made
+// with it to the supplied timeout. Any earlier deadline on the parent context still
+// applies, so the timeout can only shorten the time allowed for each call
+func WithRPCTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, rpcTimeoutKey{}, timeout)
+}
+
+// rpcTimeout returns the timeout set on a context with WithRPCTimeout, or zero if there is none
+func rpcTimeout(ctx context.Context) time.Duration {
+	timeout, _ := ctx.Value(rpcTimeoutKey{}).(time.Duration)
+	return timeout
+}
+
 type rpcWrapper struct {
-	rpc rcpClient
+	rpc        rcpClient
+	retrier    *rpcRetrier
+	timestamps *BlockTimestampCache
+	gasLimit   blockGasLimitCache
+	shadow     *rpcShadow
 }
 
 // RPCClientSubscription local alias type for ClientSubscription
@@ -97,12 +165,114 @@ func (w *rpcWrapper) CallContext(ctx context.Context, result interface{}, method
 		log.Errorf("JSON/RPC %s - not authorized: %s", method, err)
 		return errors.Errorf(errors.Unauthorized)
 	}
+	if timeout := rpcTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	log.Tracef("RPC [%s] --> %+v", method, args)
-	err := w.rpc.CallContext(ctx, result, method, args...)
+	var err error
+	if w.retrier != nil {
+		attempt := 0
+		err = w.retrier.do(ctx, method, func() error {
+			attempt++
+			if err := chaos.RPCError(method); err != nil {
+				return err
+			}
+			err := w.rpc.CallContext(ctx, result, method, args...)
+			return knownTransactionOnRetry(attempt, method, err, result, args)
+		})
+	} else if err = chaos.RPCError(method); err == nil {
+		err = w.rpc.CallContext(ctx, result, method, args...)
+	}
 	log.Tracef("RPC [%s] <-- %+v", method, result)
+	if w.shadow != nil {
+		w.shadow.mirror(method, args, result, err)
+	}
+	recorder.RecordRPC(method, args, result, err)
 	return err
 }
 
+// BatchCallContext sends all the supplied calls to the node in a single JSON/RPC batch request
+func (w *rpcWrapper) BatchCallContext(ctx context.Context, b []RPCBatchElem) error {
+	for _, elem := range b {
+		if err := auth.AuthRPC(ctx, elem.Method, elem.Args...); err != nil {
+			log.Errorf("JSON/RPC %s - not authorized: %s", elem.Method, err)
+			return errors.Errorf(errors.Unauthorized)
+		}
+	}
+	batchFn := rpcBatchFn(w.rpc)
+	if batchFn == nil {
+		return errors.Errorf(errors.RPCBatchUnsupported)
+	}
+	if timeout := rpcTimeout(ctx); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	doBatch := func() error {
+		if err := chaos.RPCError(batchMethod(b)); err != nil {
+			return err
+		}
+		return batchFn(ctx, b)
+	}
+	log.Tracef("RPC batch --> %d calls", len(b))
+	var err error
+	if w.retrier != nil {
+		err = w.retrier.do(ctx, batchMethod(b), doBatch)
+	} else {
+		err = doBatch()
+	}
+	if err == nil {
+		for i := range b {
+			recorder.RecordRPC(b[i].Method, b[i].Args, b[i].Result, b[i].Error)
+		}
+	}
+	log.Tracef("RPC batch <-- %d calls", len(b))
+	return err
+}
+
+// rpcBatchFn returns a function that sends a batch with the BatchCallContext function of the client.
+// The client takes a slice of its own batch element type, which has the same shape as RPCBatchElem,
+// so we convert to and from that type via reflection. Nil is returned if the client does not support batches
+func rpcBatchFn(client interface{}) func(ctx context.Context, b []RPCBatchElem) error {
+	batchFn := reflect.ValueOf(client).MethodByName("BatchCallContext")
+	elemType := reflect.TypeOf(RPCBatchElem{})
+	if !batchFn.IsValid() || batchFn.Type().NumIn() != 2 || batchFn.Type().In(1).Kind() != reflect.Slice ||
+		!elemType.ConvertibleTo(batchFn.Type().In(1).Elem()) {
+		return nil
+	}
+	batchType := batchFn.Type().In(1)
+	return func(ctx context.Context, b []RPCBatchElem) error {
+		elems := reflect.MakeSlice(batchType, len(b), len(b))
+		for i := range b {
+			elems.Index(i).Set(reflect.ValueOf(b[i]).Convert(batchType.Elem()))
+		}
+		ret := batchFn.Call([]reflect.Value{reflect.ValueOf(ctx), elems})
+		for i := range b {
+			b[i] = elems.Index(i).Convert(elemType).Interface().(RPCBatchElem)
+		}
+		if err, _ := ret[0].Interface().(error); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// batchMethod returns the method of all the calls in a batch, if they are the same, so that
+// the batch can be retried like the individual method
+func batchMethod(b []RPCBatchElem) string {
+	if len(b) == 0 {
+		return ""
+	}
+	for _, elem := range b[1:] {
+		if elem.Method != b[0].Method {
+			return ""
+		}
+	}
+	return b[0].Method
+}
+
 func (w *rpcWrapper) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (RPCClientSubscription, error) {
 	if err := auth.AuthRPCSubscribe(ctx, namespace, channel, args...); err != nil {
 		log.Errorf("JSON/RPC Subscribe - not authorized: %s", err)
@@ -133,6 +303,19 @@ type RPCClient interface {
 	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
 }
 
+// RPCBatchElem is a single call in a JSON/RPC batch request. Error is set if the individual call fails
+type RPCBatchElem struct {
+	Method string
+	Args   []interface{}
+	Result interface{}
+	Error  error
+}
+
+// RPCClientBatch refers to the batch function from the ethereum RPC client that we use
+type RPCClientBatch interface {
+	BatchCallContext(ctx context.Context, b []RPCBatchElem) error
+}
+
 // RPCClientAsync refers to the async functions from the ethereum RPC client that we use
 type RPCClientAsync interface {
 	Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (RPCClientSubscription, error)
@@ -16,9 +16,13 @@ package eth
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/spf13/cobra"
@@ -26,6 +30,7 @@ import (
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/auth"
 	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/chaos"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,6 +92,35 @@ func TestRPCConnectAuthOK(t *testing.T) {
 	assert.NotNil(rpc)
 }
 
+func TestRPCConnectBatchCall(t *testing.T) {
+	assert := assert.New(t)
+	router := &httprouter.Router{}
+	router.POST("/", func(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		var batch []map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&batch)
+		replies := make([]map[string]interface{}, len(batch))
+		for i, call := range batch {
+			replies[i] = map[string]interface{}{"jsonrpc": "2.0", "id": call["id"], "result": call["method"]}
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(&replies)
+	})
+	testSvr := httptest.NewServer(router)
+	defer testSvr.Close()
+
+	rpc, err := RPCConnect(&RPCConnOpts{URL: testSvr.URL})
+	assert.NoError(err)
+	var result1, result2 string
+	batch := []RPCBatchElem{
+		{Method: "eth_call", Result: &result1},
+		{Method: "eth_blockNumber", Result: &result2},
+	}
+	err = rpc.(RPCClientBatch).BatchCallContext(context.Background(), batch)
+	assert.NoError(err)
+	assert.Equal("eth_call", result1)
+	assert.Equal("eth_blockNumber", result2)
+}
+
 func TestRPCConnectFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -142,3 +176,149 @@ func TestCallContextWrapperAuth(t *testing.T) {
 
 	auth.RegisterSecurityModule(nil)
 }
+
+type deadlineEthClient struct {
+	mockEthClient
+	deadline    time.Time
+	hasDeadline bool
+}
+
+func (w *deadlineEthClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	w.deadline, w.hasDeadline = ctx.Deadline()
+	return nil
+}
+
+func TestCallContextWithRPCTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &deadlineEthClient{}
+	w := &rpcWrapper{rpc: c}
+	err := w.CallContext(context.Background(), nil, "eth_call")
+	assert.NoError(err)
+	assert.False(c.hasDeadline)
+
+	before := time.Now()
+	err = w.CallContext(WithRPCTimeout(context.Background(), 5*time.Second), nil, "eth_call")
+	assert.NoError(err)
+	assert.True(c.hasDeadline)
+	assert.True(c.deadline.After(before.Add(4 * time.Second)))
+	assert.True(c.deadline.Before(time.Now().Add(5 * time.Second)))
+}
+
+// testRPCBatchElem has the same shape as the batch element of the real client, but is a different type
+type testRPCBatchElem struct {
+	Method string
+	Args   []interface{}
+	Result interface{}
+	Error  error
+}
+
+type mockBatchEthClient struct {
+	mockEthClient
+	batch    []testRPCBatchElem
+	batchErr error
+}
+
+func (w *mockBatchEthClient) BatchCallContext(ctx context.Context, b []testRPCBatchElem) error {
+	w.batch = b
+	for i := range b {
+		if i == 0 {
+			*(b[i].Result.(*string)) = "result"
+		} else {
+			b[i].Error = fmt.Errorf("pop")
+		}
+	}
+	return w.batchErr
+}
+
+func TestRPCWrapperBatchCallContext(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockBatchEthClient{}
+	w := &rpcWrapper{
+		rpc:     client,
+		retrier: newRPCRetrier(&RPCRetryConf{}, &RPCCircuitBreakerConf{}),
+	}
+	var result1, result2 string
+	batch := []RPCBatchElem{
+		{Method: "eth_call", Args: []interface{}{"arg1"}, Result: &result1},
+		{Method: "eth_call", Args: []interface{}{"arg2"}, Result: &result2},
+	}
+	err := w.BatchCallContext(WithRPCTimeout(context.Background(), time.Second), batch)
+	assert.NoError(err)
+	assert.Len(client.batch, 2)
+	assert.Equal("arg2", client.batch[1].Args[0])
+	assert.Equal("result", result1)
+	assert.NoError(batch[0].Error)
+	assert.EqualError(batch[1].Error, "pop")
+}
+
+func TestRPCWrapperBatchCallContextFail(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &mockBatchEthClient{batchErr: fmt.Errorf("pop")}
+	w := &rpcWrapper{rpc: client}
+	var result string
+	err := w.BatchCallContext(context.Background(), []RPCBatchElem{{Method: "eth_call", Result: &result}})
+	assert.EqualError(err, "pop")
+}
+
+func TestRPCWrapperBatchCallContextUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &rpcWrapper{rpc: &mockEthClient{}}
+	err := w.BatchCallContext(context.Background(), []RPCBatchElem{{Method: "eth_call"}})
+	assert.EqualError(err, "JSON/RPC batch requests are not supported by the client")
+}
+
+func TestRPCWrapperBatchCallContextUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	client := &mockBatchEthClient{}
+	w := &rpcWrapper{rpc: client}
+	err := w.BatchCallContext(context.Background(), []RPCBatchElem{{Method: "eth_call"}})
+	assert.EqualError(err, "Unauthorized")
+	assert.Nil(client.batch)
+}
+
+func TestBatchMethod(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", batchMethod([]RPCBatchElem{}))
+	assert.Equal("eth_call", batchMethod([]RPCBatchElem{{Method: "eth_call"}, {Method: "eth_call"}}))
+	assert.Equal("", batchMethod([]RPCBatchElem{{Method: "eth_call"}, {Method: "eth_sendTransaction"}}))
+}
+
+func TestRPCWrapperChaosErrors(t *testing.T) {
+	assert := assert.New(t)
+	chaos.Start(&chaos.ChaosConf{RPCErrorPercent: 100})
+	defer chaos.Stop()
+
+	flaky := &flakyEthClient{}
+	w := &rpcWrapper{
+		rpc:     flaky,
+		retrier: newRPCRetrier(&RPCRetryConf{MaxAttempts: 3, InitialDelayMS: 1}, &RPCCircuitBreakerConf{}),
+	}
+	err := w.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.Regexp("Injected JSON/RPC failure calling eth_blockNumber", err)
+	assert.True(isTransientRPCError(err))
+	assert.Equal(0, flaky.attempts)
+
+	w.retrier = nil
+	err = w.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.Regexp("Injected JSON/RPC failure", err)
+	assert.Equal(0, flaky.attempts)
+
+	client := &mockBatchEthClient{}
+	w.rpc = client
+	var result string
+	err = w.BatchCallContext(context.Background(), []RPCBatchElem{{Method: "eth_call", Result: &result}})
+	assert.Regexp("Injected JSON/RPC failure calling eth_call", err)
+	assert.Nil(client.batch)
+
+	chaos.Stop()
+	err = w.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.NoError(err)
+}
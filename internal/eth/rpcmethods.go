@@ -0,0 +1,66 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import "strings"
+
+// rpcDeniedMethods can never be allowed, as they send transactions or sign with the keys of
+// the node, bypassing the nonce management, policies and audit of transactions submitted
+// through the gateway. An entry with a trailing * matches every method with that prefix
+var rpcDeniedMethods = []string{
+	"eth_sendTransaction",
+	"eth_sendRawTransaction",
+	"eth_sign*",
+	"personal_*",
+}
+
+// RPCMethodAllowList is a set of JSON/RPC methods that callers are allowed to invoke directly
+// on the node. An entry with a trailing * matches every method with that prefix, such as debug_*
+type RPCMethodAllowList struct {
+	exact  map[string]bool
+	prefix []string
+}
+
+// NewRPCMethodAllowList builds an allow list from method names and prefixes
+func NewRPCMethodAllowList(methods []string) *RPCMethodAllowList {
+	l := &RPCMethodAllowList{exact: make(map[string]bool)}
+	for _, m := range methods {
+		if strings.HasSuffix(m, "*") {
+			l.prefix = append(l.prefix, strings.TrimSuffix(m, "*"))
+		} else {
+			l.exact[m] = true
+		}
+	}
+	return l
+}
+
+func (l *RPCMethodAllowList) matches(method string) bool {
+	if l.exact[method] {
+		return true
+	}
+	for _, prefix := range l.prefix {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns true if the method is in the allow list, and is not one that is always denied
+func (l *RPCMethodAllowList) Allowed(method string) bool {
+	return l.matches(method) && !rpcDenyList.matches(method)
+}
+
+var rpcDenyList = NewRPCMethodAllowList(rpcDeniedMethods)
@@ -0,0 +1,51 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCMethodAllowList(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewRPCMethodAllowList([]string{"admin_peers", "debug_*"})
+	assert.True(l.Allowed("admin_peers"))
+	assert.False(l.Allowed("admin_nodeInfo"))
+	assert.True(l.Allowed("debug_traceTransaction"))
+	assert.False(l.Allowed("eth_sendRawTransaction"))
+
+	assert.False(NewRPCMethodAllowList(nil).Allowed("admin_peers"))
+}
+
+func TestRPCMethodAllowListAlwaysDenied(t *testing.T) {
+	assert := assert.New(t)
+
+	l := NewRPCMethodAllowList([]string{"eth_*", "personal_*", "eth_sendRawTransaction", "personal_unlockAccount"})
+	assert.True(l.Allowed("eth_getBalance"))
+	for _, method := range []string{
+		"eth_sendTransaction",
+		"eth_sendRawTransaction",
+		"eth_sign",
+		"eth_signTransaction",
+		"eth_signTypedData_v4",
+		"personal_unlockAccount",
+		"personal_sign",
+	} {
+		assert.False(l.Allowed(method), method)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRPCQuarantineErrorPercent = 50
+	defaultRPCQuarantineMS           = 30000
+	// rpcPoolMinSamples is the number of calls to an endpoint before its error rate can quarantine it
+	rpcPoolMinSamples = 5
+	// rpcPoolDecay is the weight of each new call in the moving averages of error rate and latency
+	rpcPoolDecay = 0.1
+	// rpcPoolMinLatency stops an endpoint that has only served very fast calls taking all the traffic
+	rpcPoolMinLatency = 1 * time.Millisecond
+	// rpcPoolAffinitySize bounds the filters, transactions and from addresses pinned to an endpoint
+	rpcPoolAffinitySize = 10000
+)
+
+// rpcMethodClass groups methods with similar latency, so slow log queries do not make an
+// endpoint look slow for the calls that are quick on every node
+type rpcMethodClass int
+
+const (
+	rpcClassCall rpcMethodClass = iota
+	rpcClassLogs
+	rpcClassSend
+	rpcMethodClasses
+)
+
+var rpcMethodClassNames = [rpcMethodClasses]string{"call", "logs", "send"}
+
+func rpcMethodClassFor(method string) rpcMethodClass {
+	switch method {
+	case "eth_getLogs", "eth_getFilterLogs", "eth_getFilterChanges":
+		return rpcClassLogs
+	case "eth_sendTransaction", "eth_sendRawTransaction", "eth_estimateGas":
+		return rpcClassSend
+	default:
+		return rpcClassCall
+	}
+}
+
+type rpcAffinityKey struct{}
+
+// WithRPCAffinity returns a context that sends every JSON/RPC call made with it to the same
+// endpoint of a pool as other calls with the same key, while that endpoint is healthy. The
+// transaction processor uses the from address, so the nonce it queries and the transactions it
+// sends are on the same node
+func WithRPCAffinity(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, rpcAffinityKey{}, strings.ToLower(key))
+}
+
+// RPCPoolConf configures additional JSON/RPC endpoints for the same chain. Traffic is weighted across
+// all the endpoints by their recent error rate and latency. An endpoint whose error rate reaches
+// QuarantineErrorPercent receives no traffic for QuarantineMS, after which it is trialled again
+type RPCPoolConf struct {
+	URLs                   []string `json:"urls,omitempty"`
+	QuarantineErrorPercent int      `json:"quarantineErrorPercent,omitempty"`
+	QuarantineMS           int      `json:"quarantineMS,omitempty"`
+}
+
+// rpcPoolRand is replaced in tests, to choose endpoints predictably
+var rpcPoolRand = rand.Float64
+
+// RPCEndpointStats describes the recent health of a JSON/RPC endpoint, which decides its share of traffic
+type RPCEndpointStats struct {
+	URL              string             `json:"url"`
+	Calls            int64              `json:"calls"`
+	ErrorPercent     float64            `json:"errorPercent"`
+	LatencyMS        map[string]float64 `json:"latencyMS"`
+	QuarantinedUntil *time.Time         `json:"quarantinedUntil,omitempty"`
+}
+
+// rpcEndpointHealth tracks moving averages of the error rate of an endpoint, and of its latency
+// for each class of method
+type rpcEndpointHealth struct {
+	url              string // redacted
+	mux              sync.Mutex
+	errorRate        float64
+	latency          [rpcMethodClasses]time.Duration
+	classSamples     [rpcMethodClasses]int64
+	samples          int64
+	quarantinedUntil time.Time
+	recovering       bool
+}
+
+type rpcEndpoint struct {
+	client rcpClient
+	health *rpcEndpointHealth
+}
+
+type rpcPool struct {
+	conf      RPCPoolConf
+	endpoints []*rpcEndpoint
+	// pinned maps a filter, transaction hash or affinity key to the endpoint its calls go to,
+	// as a filter only exists on the node that created it, and a node might not know about
+	// a transaction that was sent to another one until it is mined
+	pinned *lru.Cache
+}
+
+// rpcEndpointHealths are shared by all connections to the same endpoint, so the health
+// of the endpoint reflects every call made to it
+var rpcEndpointHealths = struct {
+	sync.Mutex
+	byURL map[string]*rpcEndpointHealth
+}{byURL: make(map[string]*rpcEndpointHealth)}
+
+func rpcEndpointHealthFor(url string) *rpcEndpointHealth {
+	rpcEndpointHealths.Lock()
+	defer rpcEndpointHealths.Unlock()
+	h, exists := rpcEndpointHealths.byURL[url]
+	if !exists {
+		h = &rpcEndpointHealth{url: utils.RedactURL(url)}
+		rpcEndpointHealths.byURL[url] = h
+	}
+	return h
+}
+
+// RPCEndpointStatus returns the health of each JSON/RPC endpoint that traffic is weighted across
+func RPCEndpointStatus() []*RPCEndpointStats {
+	rpcEndpointHealths.Lock()
+	defer rpcEndpointHealths.Unlock()
+	status := make([]*RPCEndpointStats, 0, len(rpcEndpointHealths.byURL))
+	for _, h := range rpcEndpointHealths.byURL {
+		status = append(status, h.stats())
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].URL < status[j].URL })
+	return status
+}
+
+func newRPCPool(conf *RPCConnOpts, dial func(string) (rcpClient, error)) (*rpcPool, error) {
+	p := &rpcPool{conf: conf.Pool, pinned: newRPCPoolPinned()}
+	if p.conf.QuarantineErrorPercent == 0 {
+		p.conf.QuarantineErrorPercent = defaultRPCQuarantineErrorPercent
+	}
+	if p.conf.QuarantineErrorPercent < 0 || p.conf.QuarantineErrorPercent > 100 {
+		return nil, errors.Errorf(errors.RPCPoolBadErrorPercent, p.conf.QuarantineErrorPercent)
+	}
+	if p.conf.QuarantineMS <= 0 {
+		p.conf.QuarantineMS = defaultRPCQuarantineMS
+	}
+	for _, u := range append([]string{conf.URL}, conf.Pool.URLs...) {
+		client, err := dial(u)
+		if err != nil {
+			p.Close()
+			return nil, errors.Errorf(errors.RPCConnectFailed, utils.RedactURL(u), err)
+		}
+		p.endpoints = append(p.endpoints, &rpcEndpoint{client: client, health: rpcEndpointHealthFor(u)})
+	}
+	log.Infof("JSON/RPC traffic weighted across %d endpoints", len(p.endpoints))
+	return p, nil
+}
+
+func newRPCPoolPinned() *lru.Cache {
+	pinned, _ := lru.New(rpcPoolAffinitySize)
+	return pinned
+}
+
+func (h *rpcEndpointHealth) stats() *RPCEndpointStats {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	s := &RPCEndpointStats{
+		URL:          h.url,
+		Calls:        h.samples,
+		ErrorPercent: h.errorRate * 100,
+		LatencyMS:    make(map[string]float64),
+	}
+	for class, latency := range h.latency {
+		if h.classSamples[class] > 0 {
+			s.LatencyMS[rpcMethodClassNames[class]] = float64(latency) / float64(time.Millisecond)
+		}
+	}
+	if time.Now().Before(h.quarantinedUntil) {
+		until := h.quarantinedUntil
+		s.QuarantinedUntil = &until
+	}
+	return s
+}
+
+// weight is the share of traffic of a class of method the endpoint should receive, which is zero while
+// it is quarantined. Once the quarantine has passed, the endpoint starts afresh, but returns to quarantine
+// if its next call fails. An endpoint that has not served the class yet is weighted as fast, to trial it
+func (h *rpcEndpointHealth) weight(now time.Time, class rpcMethodClass) float64 {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if !h.quarantinedUntil.IsZero() {
+		if now.Before(h.quarantinedUntil) {
+			return 0
+		}
+		log.Infof("JSON/RPC endpoint %s leaving quarantine", h.url)
+		h.quarantinedUntil = time.Time{}
+		h.errorRate = 0
+		h.samples = 0
+		h.recovering = true
+	}
+	latency := h.latency[class]
+	if latency < rpcPoolMinLatency {
+		latency = rpcPoolMinLatency
+	}
+	// A small weight remains for an endpoint that is failing, but not yet quarantined
+	return (1.01 - h.errorRate) / latency.Seconds()
+}
+
+// record updates the moving averages of the endpoint with the outcome of a call, quarantining it when
+// its error rate reaches the threshold. Only failures of the node count, not errors it returns for the request
+func (h *rpcEndpointHealth) record(err error, class rpcMethodClass, elapsed time.Duration, conf *RPCPoolConf) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	failed := isRPCNodeFailure(err)
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	if h.samples == 0 {
+		h.errorRate = sample
+	} else {
+		h.errorRate = h.errorRate*(1-rpcPoolDecay) + sample*rpcPoolDecay
+	}
+	if h.classSamples[class] == 0 {
+		h.latency[class] = elapsed
+	} else {
+		h.latency[class] = time.Duration(float64(h.latency[class])*(1-rpcPoolDecay) + float64(elapsed)*rpcPoolDecay)
+	}
+	h.samples++
+	h.classSamples[class]++
+	if !failed {
+		if h.recovering {
+			log.Infof("JSON/RPC endpoint %s recovered", h.url)
+			h.recovering = false
+		}
+		return
+	}
+	if h.recovering || (h.samples >= rpcPoolMinSamples && h.errorRate*100 >= float64(conf.QuarantineErrorPercent)) {
+		quarantine := time.Duration(conf.QuarantineMS) * time.Millisecond
+		log.Warnf("JSON/RPC endpoint %s quarantined for %.0fs, with an error rate of %.0f%%: %s", h.url, quarantine.Seconds(), h.errorRate*100, err)
+		h.quarantinedUntil = time.Now().Add(quarantine)
+		h.recovering = false
+	}
+}
+
+// pick chooses an endpoint at random, weighted by health for the class of method. If every endpoint
+// is quarantined, the one that leaves quarantine soonest is used, rather than failing the call
+func (p *rpcPool) pick(class rpcMethodClass) *rpcEndpoint {
+	now := time.Now()
+	weights := make([]float64, len(p.endpoints))
+	total := 0.0
+	var soonest *rpcEndpoint
+	var soonestUntil time.Time
+	for i, ep := range p.endpoints {
+		weights[i] = ep.health.weight(now, class)
+		total += weights[i]
+		ep.health.mux.Lock()
+		until := ep.health.quarantinedUntil
+		ep.health.mux.Unlock()
+		if soonest == nil || until.Before(soonestUntil) {
+			soonest, soonestUntil = ep, until
+		}
+	}
+	if total == 0 {
+		return soonest
+	}
+	r := rpcPoolRand() * total
+	for i, ep := range p.endpoints {
+		if r < weights[i] {
+			return ep
+		}
+		r -= weights[i]
+	}
+	return p.endpoints[len(p.endpoints)-1]
+}
+
+// rpcPoolKey returns the string form of a filter id, transaction hash or address passed to,
+// or returned by, a JSON/RPC call. They are all sent as hex strings on the wire
+func rpcPoolKey(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	var key string
+	if err := json.Unmarshal(b, &key); err != nil {
+		return ""
+	}
+	return strings.ToLower(key)
+}
+
+// affinityFor returns the key of the endpoint a call must go to, if any. Calls on a filter go
+// to the node that created it, and calls for a transaction to the node it was sent to. Nonce
+// queries and sends go to one node for each from address, so the nonce reflects the pending
+// transactions the node knows about
+func (p *rpcPool) affinityFor(ctx context.Context, method string, args []interface{}) string {
+	switch method {
+	case "eth_getFilterChanges", "eth_getFilterLogs", "eth_uninstallFilter":
+		if len(args) > 0 {
+			return "filter:" + rpcPoolKey(args[0])
+		}
+	case "eth_getTransactionReceipt", "eth_getTransactionByHash":
+		if len(args) > 0 {
+			if key := "tx:" + rpcPoolKey(args[0]); p.pinned.Contains(key) {
+				return key
+			}
+		}
+	case "eth_getTransactionCount":
+		if len(args) > 0 {
+			return "from:" + rpcPoolKey(args[0])
+		}
+	case "eth_sendTransaction":
+		if len(args) > 0 {
+			var txArgs struct {
+				From string `json:"from"`
+			}
+			b, _ := json.Marshal(args[0])
+			if json.Unmarshal(b, &txArgs) == nil && txArgs.From != "" {
+				return "from:" + strings.ToLower(txArgs.From)
+			}
+		}
+	}
+	if key, ok := ctx.Value(rpcAffinityKey{}).(string); ok && key != "" {
+		return "from:" + key
+	}
+	return ""
+}
+
+// pickFor returns the endpoint pinned to the key, while it is not quarantined. Otherwise an endpoint
+// is picked by weight, and pinned. A filter on a node that has been quarantined is lost, and the
+// error from the node it moves to is handled like any other expired filter
+func (p *rpcPool) pickFor(key string, class rpcMethodClass) *rpcEndpoint {
+	if key == "" {
+		return p.pick(class)
+	}
+	if pinned, ok := p.pinned.Get(key); ok {
+		ep := pinned.(*rpcEndpoint)
+		if ep.health.weight(time.Now(), class) > 0 {
+			return ep
+		}
+	}
+	ep := p.pick(class)
+	p.pinned.Add(key, ep)
+	return ep
+}
+
+// pinResult pins a new filter, or transaction, to the endpoint that created it
+func (p *rpcPool) pinResult(ep *rpcEndpoint, method string, result interface{}) {
+	switch method {
+	case "eth_newFilter", "eth_newBlockFilter", "eth_newPendingTransactionFilter":
+		if id := rpcPoolKey(result); id != "" {
+			p.pinned.Add("filter:"+id, ep)
+		}
+	case "eth_sendTransaction", "eth_sendRawTransaction":
+		if hash := rpcPoolKey(result); hash != "" {
+			p.pinned.Add("tx:"+hash, ep)
+		}
+	}
+}
+
+func (p *rpcPool) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	class := rpcMethodClassFor(method)
+	key := p.affinityFor(ctx, method, args)
+	ep := p.pickFor(key, class)
+	start := time.Now()
+	err := ep.client.CallContext(ctx, result, method, args...)
+	ep.health.record(err, class, time.Since(start), &p.conf)
+	if err == nil {
+		p.pinResult(ep, method, result)
+	}
+	if method == "eth_uninstallFilter" {
+		p.pinned.Remove(key)
+	}
+	return err
+}
+
+// BatchCallContext sends the whole batch to a single endpoint
+func (p *rpcPool) BatchCallContext(ctx context.Context, b []RPCBatchElem) error {
+	class := rpcClassCall
+	if len(b) > 0 {
+		class = rpcMethodClassFor(b[0].Method)
+	}
+	ep := p.pickFor(p.affinityFor(ctx, "", nil), class)
+	batchFn := rpcBatchFn(ep.client)
+	if batchFn == nil {
+		return errors.Errorf(errors.RPCBatchUnsupported)
+	}
+	start := time.Now()
+	err := batchFn(ctx, b)
+	ep.health.record(err, class, time.Since(start), &p.conf)
+	return err
+}
+
+// Subscribe subscribes on a single endpoint, which the subscription stays with until it is closed
+func (p *rpcPool) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*ethbinding.ClientSubscription, error) {
+	ep := p.pick(rpcClassCall)
+	start := time.Now()
+	sub, err := ep.client.Subscribe(ctx, namespace, channel, args...)
+	ep.health.record(err, rpcClassCall, time.Since(start), &p.conf)
+	return sub, err
+}
+
+func (p *rpcPool) Close() {
+	for _, ep := range p.endpoints {
+		ep.client.Close()
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+type poolTestClient struct {
+	mockEthClient
+	err    error
+	result string
+	calls  int
+	closed bool
+}
+
+func (c *poolTestClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	c.calls++
+	if c.result != "" && result != nil {
+		json.Unmarshal([]byte(`"`+c.result+`"`), result)
+	}
+	return c.err
+}
+
+func (c *poolTestClient) Close() {
+	c.closed = true
+}
+
+func newTestRPCPool(clients ...*poolTestClient) *rpcPool {
+	p := &rpcPool{conf: RPCPoolConf{QuarantineErrorPercent: 50, QuarantineMS: 60000}, pinned: newRPCPoolPinned()}
+	for i, c := range clients {
+		p.endpoints = append(p.endpoints, &rpcEndpoint{client: c, health: &rpcEndpointHealth{url: fmt.Sprintf("endpoint%d", i)}})
+	}
+	return p
+}
+
+func setRPCPoolRand(r float64) func() {
+	rpcPoolRand = func() float64 { return r }
+	return func() { rpcPoolRand = rand.Float64 }
+}
+
+func testRPCNodeServer(name string) *httptest.Server {
+	router := &httprouter.Router{}
+	router.POST("/", func(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+		var call map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&call)
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": call["id"], "result": name})
+	})
+	return httptest.NewServer(router)
+}
+
+func TestRPCConnectPool(t *testing.T) {
+	assert := assert.New(t)
+	svr1 := testRPCNodeServer("node1")
+	defer svr1.Close()
+	svr2 := testRPCNodeServer("node2")
+	defer svr2.Close()
+
+	rpc, err := RPCConnect(&RPCConnOpts{URL: svr1.URL, Pool: RPCPoolConf{URLs: []string{svr2.URL}}})
+	assert.NoError(err)
+	defer rpc.Close()
+
+	var result string
+	reset := setRPCPoolRand(0)
+	err = rpc.CallContext(context.Background(), &result, "eth_blockNumber")
+	assert.NoError(err)
+	assert.Equal("node1", result)
+
+	setRPCPoolRand(0.9999)
+	err = rpc.CallContext(context.Background(), &result, "eth_blockNumber")
+	assert.NoError(err)
+	assert.Equal("node2", result)
+	reset()
+
+	status := RPCEndpointStatus()
+	var urls []string
+	for _, s := range status {
+		if s.URL == svr1.URL || s.URL == svr2.URL {
+			urls = append(urls, s.URL)
+			assert.Equal(int64(1), s.Calls)
+			assert.Equal(float64(0), s.ErrorPercent)
+			assert.Nil(s.QuarantinedUntil)
+		}
+	}
+	assert.Len(urls, 2)
+}
+
+func TestRPCConnectPoolFail(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := RPCConnect(&RPCConnOpts{URL: "http://localhost:8545", Pool: RPCPoolConf{URLs: []string{""}}})
+	assert.Regexp("JSON/RPC connection to .* failed", err)
+
+	_, err = RPCConnect(&RPCConnOpts{URL: "http://localhost:8545", Pool: RPCPoolConf{URLs: []string{"http://localhost:8546"}, QuarantineErrorPercent: 101}})
+	assert.EqualError(err, "Invalid JSON/RPC endpoint quarantine error rate 101%. Must be between 1 and 100")
+}
+
+func TestRPCPoolDialFailClosesEndpoints(t *testing.T) {
+	assert := assert.New(t)
+
+	opened := &poolTestClient{}
+	dial := func(u string) (rcpClient, error) {
+		if u == "bad" {
+			return nil, fmt.Errorf("pop")
+		}
+		return opened, nil
+	}
+	_, err := newRPCPool(&RPCConnOpts{URL: "good", Pool: RPCPoolConf{URLs: []string{"bad"}}}, dial)
+	assert.Regexp("pop", err)
+	assert.True(opened.closed)
+}
+
+func TestRPCPoolQuarantineAndRecovery(t *testing.T) {
+	assert := assert.New(t)
+	defer setRPCPoolRand(0)()
+
+	failing := &poolTestClient{err: fmt.Errorf("connection refused")}
+	healthy := &poolTestClient{}
+	p := newTestRPCPool(failing, healthy)
+
+	// The failing endpoint is picked first, until it has failed enough to be quarantined
+	for i := 0; i < rpcPoolMinSamples; i++ {
+		err := p.CallContext(context.Background(), nil, "eth_blockNumber")
+		assert.Regexp("connection refused", err)
+	}
+	assert.Equal(rpcPoolMinSamples, failing.calls)
+	assert.False(p.endpoints[0].health.quarantinedUntil.IsZero())
+
+	err := p.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.NoError(err)
+	assert.Equal(rpcPoolMinSamples, failing.calls)
+	assert.Equal(1, healthy.calls)
+
+	// Once the quarantine has passed, a single failure quarantines it again
+	p.endpoints[0].health.quarantinedUntil = time.Now().Add(-1 * time.Second)
+	p.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.Equal(rpcPoolMinSamples+1, failing.calls)
+	assert.True(p.endpoints[0].health.quarantinedUntil.After(time.Now()))
+	assert.NotNil(p.endpoints[0].health.stats().QuarantinedUntil)
+
+	// ... and a success takes it out of recovery
+	p.endpoints[0].health.quarantinedUntil = time.Now().Add(-1 * time.Second)
+	failing.err = nil
+	err = p.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.NoError(err)
+	assert.Equal(rpcPoolMinSamples+2, failing.calls)
+	assert.False(p.endpoints[0].health.recovering)
+	assert.True(p.endpoints[0].health.quarantinedUntil.IsZero())
+}
+
+func TestRPCPoolNodeErrorsDoNotQuarantine(t *testing.T) {
+	assert := assert.New(t)
+	defer setRPCPoolRand(0)()
+
+	rejecting := &poolTestClient{err: &testRPCCodeError{}}
+	p := newTestRPCPool(rejecting, &poolTestClient{})
+	for i := 0; i < rpcPoolMinSamples*2; i++ {
+		p.CallContext(context.Background(), nil, "eth_sendTransaction")
+	}
+	assert.Equal(rpcPoolMinSamples*2, rejecting.calls)
+	assert.True(p.endpoints[0].health.quarantinedUntil.IsZero())
+	assert.Equal(float64(0), p.endpoints[0].health.errorRate)
+}
+
+func TestRPCPoolWeightsByLatencyAndErrors(t *testing.T) {
+	assert := assert.New(t)
+	defer setRPCPoolRand(0.5)()
+
+	p := newTestRPCPool(&poolTestClient{}, &poolTestClient{})
+	p.endpoints[0].health.record(nil, rpcClassCall, 100*time.Millisecond, &p.conf)
+	p.endpoints[1].health.record(nil, rpcClassCall, 10*time.Millisecond, &p.conf)
+	assert.Equal(p.endpoints[1], p.pick(rpcClassCall))
+
+	// Errors reduce the weight of the faster endpoint below the slower one
+	for i := 0; i < 40; i++ {
+		p.endpoints[1].health.record(fmt.Errorf("EOF"), rpcClassCall, 10*time.Millisecond, &p.conf)
+		p.endpoints[1].health.quarantinedUntil = time.Time{}
+	}
+	assert.Equal(p.endpoints[0], p.pick(rpcClassCall))
+
+	// Latency is a moving average
+	p.endpoints[0].health.record(nil, rpcClassCall, 200*time.Millisecond, &p.conf)
+	assert.InDelta(float64(110*time.Millisecond), float64(p.endpoints[0].health.latency[rpcClassCall]), float64(time.Microsecond))
+}
+
+func TestRPCPoolAllQuarantined(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestRPCPool(&poolTestClient{}, &poolTestClient{})
+	p.endpoints[0].health.quarantinedUntil = time.Now().Add(10 * time.Second)
+	p.endpoints[1].health.quarantinedUntil = time.Now().Add(5 * time.Second)
+	assert.Equal(p.endpoints[1], p.pick(rpcClassCall))
+}
+
+func TestRPCPoolBatchAndSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	batchClient := &mockBatchEthClient{}
+	p := &rpcPool{conf: RPCPoolConf{QuarantineErrorPercent: 50, QuarantineMS: 60000}, pinned: newRPCPoolPinned()}
+	p.endpoints = []*rpcEndpoint{{client: batchClient, health: &rpcEndpointHealth{url: "endpoint0"}}}
+	w := &rpcWrapper{rpc: p}
+
+	var result string
+	err := w.BatchCallContext(context.Background(), []RPCBatchElem{{Method: "eth_call", Result: &result}})
+	assert.NoError(err)
+	assert.Equal("result", result)
+	assert.Equal(int64(1), p.endpoints[0].health.samples)
+
+	_, err = w.Subscribe(context.Background(), "eth", nil, "newHeads")
+	assert.NoError(err)
+	assert.Equal(int64(2), p.endpoints[0].health.samples)
+
+	p.endpoints = []*rpcEndpoint{{client: &poolTestClient{}, health: &rpcEndpointHealth{url: "endpoint0"}}}
+	err = w.BatchCallContext(context.Background(), []RPCBatchElem{{Method: "eth_call", Result: &result}})
+	assert.Regexp("JSON/RPC batch requests are not supported", err)
+}
+
+func TestRPCPoolFilterAffinity(t *testing.T) {
+	assert := assert.New(t)
+	reset := setRPCPoolRand(0)
+	defer reset()
+
+	creator := &poolTestClient{result: "0x1A"}
+	other := &poolTestClient{}
+	p := newTestRPCPool(creator, other)
+
+	var filterID ethbinding.HexBigInt
+	err := p.CallContext(context.Background(), &filterID, "eth_newFilter", map[string]interface{}{})
+	assert.NoError(err)
+	assert.Equal(1, creator.calls)
+
+	// Calls on the filter stay with the node that created it, while other calls are weighted
+	setRPCPoolRand(0.9999)
+	p.CallContext(context.Background(), nil, "eth_getFilterChanges", filterID)
+	p.CallContext(context.Background(), nil, "eth_getFilterLogs", "0x1a")
+	assert.Equal(3, creator.calls)
+	p.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.Equal(1, other.calls)
+
+	// Uninstalling the filter releases it
+	p.CallContext(context.Background(), nil, "eth_uninstallFilter", filterID)
+	assert.Equal(4, creator.calls)
+	assert.False(p.pinned.Contains("filter:0x1a"))
+}
+
+func TestRPCPoolFromAddressAffinity(t *testing.T) {
+	assert := assert.New(t)
+	reset := setRPCPoolRand(0)
+	defer reset()
+
+	first := &poolTestClient{result: "0xAbCd"}
+	second := &poolTestClient{}
+	p := newTestRPCPool(first, second)
+	from := "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1"
+
+	p.CallContext(context.Background(), nil, "eth_getTransactionCount", from, "pending")
+	assert.Equal(1, first.calls)
+
+	// The send of a raw transaction follows the nonce query, by the affinity on the context
+	setRPCPoolRand(0.9999)
+	var txHash string
+	err := p.CallContext(WithRPCAffinity(context.Background(), from), &txHash, "eth_sendRawTransaction", "0x00")
+	assert.NoError(err)
+	assert.Equal(2, first.calls)
+	p.CallContext(context.Background(), nil, "eth_sendTransaction", &SendTXArgs{From: strings.ToLower(from)})
+	assert.Equal(3, first.calls)
+
+	// ... and polling for the receipt follows the send
+	p.CallContext(context.Background(), nil, "eth_getTransactionReceipt", "0xabcd")
+	assert.Equal(4, first.calls)
+	p.CallContext(context.Background(), nil, "eth_getTransactionReceipt", "0x1234")
+	assert.Equal(1, second.calls)
+
+	// A quarantined node loses its affinity
+	p.endpoints[0].health.quarantinedUntil = time.Now().Add(10 * time.Second)
+	p.CallContext(context.Background(), nil, "eth_getTransactionCount", from, "pending")
+	assert.Equal(2, second.calls)
+	p.endpoints[0].health.quarantinedUntil = time.Time{}
+	p.CallContext(context.Background(), nil, "eth_getTransactionCount", from, "pending")
+	assert.Equal(3, second.calls)
+}
+
+func TestRPCPoolLatencyByMethodClass(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestRPCPool(&poolTestClient{}, &poolTestClient{})
+	p.endpoints[0].health.record(nil, rpcClassLogs, 5*time.Second, &p.conf)
+	p.endpoints[0].health.record(nil, rpcClassCall, 5*time.Millisecond, &p.conf)
+	p.endpoints[1].health.record(nil, rpcClassCall, 10*time.Millisecond, &p.conf)
+
+	// Slow log queries do not reduce the share of other calls
+	now := time.Now()
+	assert.Greater(p.endpoints[0].health.weight(now, rpcClassCall), p.endpoints[1].health.weight(now, rpcClassCall))
+	assert.Less(p.endpoints[0].health.weight(now, rpcClassLogs), p.endpoints[1].health.weight(now, rpcClassLogs))
+
+	stats := p.endpoints[0].health.stats()
+	assert.Equal(map[string]float64{"call": 5, "logs": 5000}, stats.LatencyMS)
+	assert.Equal(rpcClassLogs, rpcMethodClassFor("eth_getLogs"))
+	assert.Equal(rpcClassSend, rpcMethodClassFor("eth_sendRawTransaction"))
+	assert.Equal(rpcClassCall, rpcMethodClassFor("eth_call"))
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/recorder"
+	log "github.com/sirupsen/logrus"
+)
+
+const rpcReplayScheme = "replay://"
+
+// rpcReplay is a mock node, that answers each JSON/RPC call with the response recorded for the
+// same method and params. Calls made more times than recorded, such as polling for a receipt,
+// get the last response recorded for them
+type rpcReplay struct {
+	mux       sync.Mutex
+	responses map[string][]*recorder.Record
+}
+
+// rpcReplayError is an error returned by the node in the recording
+type rpcReplayError struct {
+	message string
+	code    int
+}
+
+func (e *rpcReplayError) Error() string {
+	return e.message
+}
+
+func (e *rpcReplayError) ErrorCode() int {
+	return e.code
+}
+
+func newRPCReplay(file string) (*rpcReplay, error) {
+	records, err := recorder.ReadRecords(file)
+	if err != nil {
+		return nil, errors.Errorf(errors.RPCReplayLoadFailed, file, err)
+	}
+	r := &rpcReplay{responses: make(map[string][]*recorder.Record)}
+	count := 0
+	for _, record := range records {
+		if record.Type != recorder.RecordTypeRPC {
+			continue
+		}
+		key, err := rpcReplayKey(record.Method, record.Params)
+		if err != nil {
+			return nil, errors.Errorf(errors.RPCReplayLoadFailed, file, err)
+		}
+		r.responses[key] = append(r.responses[key], record)
+		count++
+	}
+	log.Infof("Replaying %d recorded JSON/RPC responses from '%s'", count, file)
+	return r, nil
+}
+
+// rpcReplayKey identifies a call by its method and params, regardless of the order of keys in any objects
+func rpcReplayKey(method string, params interface{}) (string, error) {
+	b, err := normalizedJSON(params)
+	if err != nil {
+		return "", err
+	}
+	return method + string(b), nil
+}
+
+func (r *rpcReplay) nextResponse(method string, args []interface{}) (*recorder.Record, string, error) {
+	// Calls are recorded with any passphrase redacted, so are looked up in the same way
+	key, err := rpcReplayKey(method, recorder.RedactRPCParams(method, args))
+	if err != nil {
+		return nil, "", err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	queue := r.responses[key]
+	if len(queue) == 0 {
+		return nil, key, nil
+	}
+	if len(queue) > 1 {
+		r.responses[key] = queue[1:]
+	}
+	return queue[0], key, nil
+}
+
+func (r *rpcReplay) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	record, key, err := r.nextResponse(method, args)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		log.Warnf("JSON/RPC replay has no recorded response for %s", key)
+		return errors.Errorf(errors.RPCReplayNoResponse, method, key[len(method):])
+	}
+	if record.Error != "" {
+		return &rpcReplayError{message: record.Error, code: record.ErrorCode}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(record.Result, result)
+}
+
+// BatchCallContext replays each call in the batch individually
+func (r *rpcReplay) BatchCallContext(ctx context.Context, b []RPCBatchElem) error {
+	for i := range b {
+		b[i].Error = r.CallContext(ctx, b[i].Result, b[i].Method, b[i].Args...)
+	}
+	return nil
+}
+
+func (r *rpcReplay) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*ethbinding.ClientSubscription, error) {
+	return nil, errors.Errorf(errors.RPCReplayNoResponse, namespace+"_subscribe", "")
+}
+
+func (r *rpcReplay) Close() {}
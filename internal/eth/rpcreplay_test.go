@@ -0,0 +1,105 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/recorder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCRecordAndReplay(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "rpcreplay")
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "recording.jsonl")
+
+	svr := newTestJSONRPCServer(map[string]string{
+		"eth_getBalance":         `"0x10"`,
+		"eth_blockNumber":        `"0x100"`,
+		"personal_unlockAccount": `true`,
+	})
+	defer svr.Close()
+	rpc, err := RPCConnect(&RPCConnOpts{URL: svr.URL})
+	assert.NoError(err)
+
+	err = recorder.Start(&recorder.RecorderConf{File: file})
+	assert.NoError(err)
+	var balance, blockNumber string
+	err = rpc.CallContext(context.Background(), &balance, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.NoError(err)
+	err = rpc.CallContext(context.Background(), &blockNumber, "eth_blockNumber")
+	assert.NoError(err)
+	err = rpc.CallContext(context.Background(), &balance, "eth_getCode", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.Regexp("pop", err)
+	var unlocked bool
+	err = rpc.CallContext(context.Background(), &unlocked, "personal_unlockAccount", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "passphrase", 0)
+	assert.NoError(err)
+	recorder.Stop()
+
+	replay, err := RPCConnect(&RPCConnOpts{URL: "replay://" + file})
+	assert.NoError(err)
+	defer replay.Close()
+
+	balance = ""
+	err = replay.CallContext(context.Background(), &balance, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.NoError(err)
+	assert.Equal("0x10", balance)
+
+	// The last response is repeated once those recorded are used up
+	for i := 0; i < 2; i++ {
+		blockNumber = ""
+		err = replay.CallContext(context.Background(), &blockNumber, "eth_blockNumber")
+		assert.NoError(err)
+		assert.Equal("0x100", blockNumber)
+	}
+
+	// Calls with a passphrase are recorded redacted, and still answered
+	unlocked = false
+	err = replay.CallContext(context.Background(), &unlocked, "personal_unlockAccount", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "passphrase", 0)
+	assert.NoError(err)
+	assert.True(unlocked)
+
+	// Errors are returned as errors from the node
+	err = replay.CallContext(context.Background(), &balance, "eth_getCode", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.Regexp("pop", err)
+	assert.Implements((*rpcErrorWithCode)(nil), err)
+	assert.Equal(-32000, err.(rpcErrorWithCode).ErrorCode())
+
+	err = replay.CallContext(context.Background(), &balance, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "0x1")
+	assert.Regexp("No JSON/RPC response recorded for eth_getBalance", err)
+
+	batch := []RPCBatchElem{
+		{Method: "eth_blockNumber", Result: &blockNumber},
+		{Method: "eth_chainId", Result: &balance},
+	}
+	err = replay.(RPCClientBatch).BatchCallContext(context.Background(), batch)
+	assert.NoError(err)
+	assert.NoError(batch[0].Error)
+	assert.Regexp("No JSON/RPC response recorded for eth_chainId", batch[1].Error)
+
+	_, err = replay.Subscribe(context.Background(), "eth", make(chan interface{}), "newHeads")
+	assert.Regexp("No JSON/RPC response recorded for eth_subscribe", err)
+}
+
+func TestRPCReplayBadFile(t *testing.T) {
+	_, err := RPCConnect(&RPCConnOpts{URL: "replay:///does/not/exist.jsonl"})
+	assert.Regexp(t, "Failed to load JSON/RPC responses to replay", err)
+}
@@ -0,0 +1,314 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRPCRetryInitialDelayMS = 250
+	defaultRPCRetryMaxDelayMS     = 5000
+	defaultRPCRetryFactor         = 2.0
+	defaultRPCBreakerResetMS      = 30000
+)
+
+// RPCRetryConf configures retry of JSON/RPC calls that fail with transient errors
+type RPCRetryConf struct {
+	MaxAttempts    int     `json:"maxAttempts"`
+	InitialDelayMS int     `json:"initialDelayMS"`
+	MaxDelayMS     int     `json:"maxDelayMS"`
+	Factor         float64 `json:"factor"`
+}
+
+// RPCCircuitBreakerConf configures a circuit breaker that fails fast when the node is down
+type RPCCircuitBreakerConf struct {
+	FailureThreshold int `json:"failureThreshold"`
+	ResetTimeoutMS   int `json:"resetTimeoutMS"`
+}
+
+// transientRPCErrors are substrings of errors that indicate a retry might succeed
+var transientRPCErrors = []string{
+	"connection refused",
+	"connection reset",
+	"no such host",
+	"i/o timeout",
+}
+
+// transientHTTPStatuses are HTTP status codes returned by the node (or a proxy in front of it)
+// that indicate a retry might succeed. The RPC client reports these with the status as a prefix
+var transientHTTPStatuses = []string{
+	"429 ",
+	"502 ",
+	"503 ",
+	"504 ",
+}
+
+// clientTimeoutRPCErrors are substrings of errors that indicate the node did not respond in time.
+// These count as failures for the circuit breaker, but are not retried as the caller's deadline
+// has already been used up
+var clientTimeoutRPCErrors = []string{
+	"context deadline exceeded",
+	"client.timeout exceeded",
+}
+
+// idempotentRPCMethods are the read-only methods that are safe to retry after a transient error,
+// as the node might have processed the original request before the connection failed.
+// Other methods that create state on the node are never retried, apart from retryableSendMethods
+var idempotentRPCMethods = map[string]bool{
+	"eth_blockNumber":            true,
+	"eth_call":                   true,
+	"eth_chainId":                true,
+	"eth_estimateGas":            true,
+	"eth_gasPrice":               true,
+	"eth_getBalance":             true,
+	"eth_getBlockByHash":         true,
+	"eth_getBlockByNumber":       true,
+	"eth_getCode":                true,
+	"eth_getFilterLogs":          true,
+	"eth_getLogs":                true,
+	"eth_getTransactionByHash":   true,
+	"eth_getTransactionCount":    true,
+	"eth_getTransactionReceipt":  true,
+	"net_version":                true,
+	"priv_findPrivacyGroup":      true,
+	"priv_getTransactionCount":   true,
+	"priv_getTransactionReceipt": true,
+}
+
+// retryableSendMethods submit a signed transaction, which the node identifies by its hash.
+// Sending the same bytes again cannot create a second transaction, so these are retried
+// after a transient error. eth_sendTransaction is not, as the node signs it with a new hash
+var retryableSendMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+}
+
+// knownTransactionErrors are substrings of errors the node returns (with code -32000) for a
+// transaction it already has. After a retried send, they mean an earlier attempt reached the node
+var knownTransactionErrors = []string{
+	"known transaction",
+	"already known",
+	"already imported",
+}
+
+// rpcErrorWithCode is implemented by JSON/RPC errors returned by the node
+type rpcErrorWithCode interface {
+	ErrorCode() int
+}
+
+// isTransientRPCError determines whether an error is worth retrying
+func isTransientRPCError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(rpcErrorWithCode); ok {
+		// The node processed the request and rejected it, so retrying will not help
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, transient := range transientRPCErrors {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	for _, status := range transientHTTPStatuses {
+		if strings.HasPrefix(msg, status) {
+			return true
+		}
+	}
+	return strings.HasSuffix(msg, "eof")
+}
+
+// isKnownTransactionError determines whether the node rejected a transaction it already has
+func isKnownTransactionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, known := range knownTransactionErrors {
+		if strings.Contains(msg, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownTransactionOnRetry treats a "known transaction" error on a retried raw transaction send
+// as success, as the node accepted the transaction on an earlier attempt whose response was lost.
+// The result is set to the hash of the signed transaction, which is what the node would have returned
+func knownTransactionOnRetry(attempt int, method string, err error, result interface{}, args []interface{}) error {
+	if attempt <= 1 || !retryableSendMethods[method] || !isKnownTransactionError(err) || len(args) == 0 {
+		return err
+	}
+	rawHex, ok := args[0].(string)
+	if !ok {
+		return err
+	}
+	raw, decodeErr := hex.DecodeString(strings.TrimPrefix(rawHex, "0x"))
+	if decodeErr != nil {
+		return err
+	}
+	txHash := "0x" + hex.EncodeToString(ethbind.API.Keccak256(raw))
+	if strResult, ok := result.(*string); ok {
+		*strResult = txHash
+	}
+	log.Infof("JSON/RPC %s retry found transaction %s already known to the node: %s", method, txHash, err)
+	return nil
+}
+
+// isRPCNodeFailure determines whether an error counts against the health of the node
+func isRPCNodeFailure(err error) bool {
+	if isTransientRPCError(err) {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	if _, ok := err.(rpcErrorWithCode); ok {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, timeout := range clientTimeoutRPCErrors {
+		if strings.Contains(msg, timeout) {
+			return true
+		}
+	}
+	return false
+}
+
+type rpcCircuitBreaker struct {
+	conf                *RPCCircuitBreakerConf
+	mux                 sync.Mutex
+	consecutiveFailures int
+	openUntil           time.Time
+	trialInProgress     bool
+}
+
+// allow returns an error if the breaker is open, and tracks the single trial call
+// permitted once the reset timeout has passed (half-open)
+func (cb *rpcCircuitBreaker) allow() error {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if cb.consecutiveFailures < cb.conf.FailureThreshold {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(cb.openUntil) || cb.trialInProgress {
+		return errors.Errorf(errors.RPCCircuitBreakerOpen, cb.consecutiveFailures, cb.openUntil.Sub(now).Seconds())
+	}
+	cb.trialInProgress = true
+	return nil
+}
+
+// release ends a trial call without recording a result, for calls the caller cancelled
+func (cb *rpcCircuitBreaker) release() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.trialInProgress = false
+}
+
+func (cb *rpcCircuitBreaker) record(err error) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.trialInProgress = false
+	if !isRPCNodeFailure(err) {
+		if cb.consecutiveFailures >= cb.conf.FailureThreshold {
+			log.Infof("JSON/RPC circuit breaker closed")
+		}
+		cb.consecutiveFailures = 0
+		return
+	}
+	cb.consecutiveFailures++
+	if cb.consecutiveFailures >= cb.conf.FailureThreshold {
+		cb.openUntil = time.Now().Add(time.Duration(cb.conf.ResetTimeoutMS) * time.Millisecond)
+		log.Warnf("JSON/RPC circuit breaker open after %d consecutive failures: %s", cb.consecutiveFailures, err)
+	}
+}
+
+type rpcRetrier struct {
+	conf    *RPCRetryConf
+	breaker *rpcCircuitBreaker
+}
+
+func newRPCRetrier(suppliedRetryConf *RPCRetryConf, suppliedBreakerConf *RPCCircuitBreakerConf) *rpcRetrier {
+	// Apply defaults to copies, so the supplied config is not modified
+	retryConf := *suppliedRetryConf
+	breakerConf := *suppliedBreakerConf
+	if retryConf.InitialDelayMS <= 0 {
+		retryConf.InitialDelayMS = defaultRPCRetryInitialDelayMS
+	}
+	if retryConf.MaxDelayMS <= 0 {
+		retryConf.MaxDelayMS = defaultRPCRetryMaxDelayMS
+	}
+	if retryConf.Factor < 1 {
+		retryConf.Factor = defaultRPCRetryFactor
+	}
+	r := &rpcRetrier{conf: &retryConf}
+	if breakerConf.FailureThreshold > 0 {
+		if breakerConf.ResetTimeoutMS <= 0 {
+			breakerConf.ResetTimeoutMS = defaultRPCBreakerResetMS
+		}
+		r.breaker = &rpcCircuitBreaker{conf: &breakerConf}
+	}
+	return r
+}
+
+// do invokes the supplied function, retrying transient errors with a backoff
+// for methods that are safe to retry. A call cancelled by the caller is not
+// counted by the circuit breaker, as it says nothing about the health of the node
+func (r *rpcRetrier) do(ctx context.Context, method string, fn func() error) (err error) {
+	maxAttempts := r.conf.MaxAttempts
+	if !idempotentRPCMethods[method] && !retryableSendMethods[method] {
+		maxAttempts = 1
+	}
+	delay := time.Duration(r.conf.InitialDelayMS) * time.Millisecond
+	maxDelay := time.Duration(r.conf.MaxDelayMS) * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		if r.breaker != nil {
+			if err = r.breaker.allow(); err != nil {
+				return err
+			}
+		}
+		err = fn()
+		if r.breaker != nil {
+			if ctx.Err() == context.Canceled {
+				r.breaker.release()
+			} else {
+				r.breaker.record(err)
+			}
+		}
+		if err == nil || attempt >= maxAttempts || !isTransientRPCError(err) {
+			return err
+		}
+		log.Warnf("JSON/RPC %s failed (attempt=%d): %s - retrying in %.2fs", method, attempt, err, delay.Seconds())
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = time.Duration(float64(delay) * r.conf.Factor)
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRPCCodeError struct{}
+
+func (e *testRPCCodeError) Error() string  { return "connection refused by the miner" }
+func (e *testRPCCodeError) ErrorCode() int { return -32000 }
+
+func TestIsTransientRPCError(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(isTransientRPCError(nil))
+	assert.True(isTransientRPCError(fmt.Errorf("dial tcp 127.0.0.1:8545: connect: connection refused")))
+	assert.True(isTransientRPCError(fmt.Errorf("read tcp: i/o timeout")))
+	assert.True(isTransientRPCError(fmt.Errorf("503 Service Unavailable: ")))
+	assert.True(isTransientRPCError(fmt.Errorf("Post \"http://localhost:8545\": %s", io.EOF)))
+	assert.False(isTransientRPCError(fmt.Errorf("execution reverted")))
+	assert.False(isTransientRPCError(fmt.Errorf("gas 503 too low")))
+	assert.False(isTransientRPCError(&testRPCCodeError{}))
+	assert.False(isTransientRPCError(context.DeadlineExceeded))
+	assert.True(isRPCNodeFailure(context.DeadlineExceeded))
+	assert.True(isRPCNodeFailure(fmt.Errorf("Post \"http://localhost:8545\": net/http: request canceled (Client.Timeout exceeded while awaiting headers)")))
+	assert.True(isRPCNodeFailure(fmt.Errorf("connection refused")))
+	assert.False(isRPCNodeFailure(nil))
+	assert.False(isRPCNodeFailure(context.Canceled))
+	assert.False(isRPCNodeFailure(&testRPCCodeError{}))
+}
+
+func TestRPCRetrySucceedsAfterTransientFailures(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 3, InitialDelayMS: 1}, &RPCCircuitBreakerConf{})
+	attempts := 0
+	err := r.do(context.Background(), "eth_blockNumber", func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("connection reset by peer")
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(3, attempts)
+}
+
+func TestRPCRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 2, InitialDelayMS: 1}, &RPCCircuitBreakerConf{})
+	attempts := 0
+	err := r.do(context.Background(), "eth_blockNumber", func() error {
+		attempts++
+		return fmt.Errorf("connection refused")
+	})
+	assert.EqualError(err, "connection refused")
+	assert.Equal(2, attempts)
+}
+
+func TestRPCRetryNoRetryForNonTransient(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 5, InitialDelayMS: 1}, &RPCCircuitBreakerConf{})
+	attempts := 0
+	err := r.do(context.Background(), "eth_sendTransaction", func() error {
+		attempts++
+		return fmt.Errorf("nonce too low")
+	})
+	assert.EqualError(err, "nonce too low")
+	assert.Equal(1, attempts)
+}
+
+func TestRPCRetryNoRetryForTransactionSubmission(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 5, InitialDelayMS: 1}, &RPCCircuitBreakerConf{})
+	attempts := 0
+	err := r.do(context.Background(), "eth_sendTransaction", func() error {
+		attempts++
+		return fmt.Errorf("connection reset by peer")
+	})
+	assert.EqualError(err, "connection reset by peer")
+	assert.Equal(1, attempts)
+}
+
+func TestRPCRetryRetriesRawTransactionSubmission(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 5, InitialDelayMS: 1}, &RPCCircuitBreakerConf{})
+	attempts := 0
+	err := r.do(context.Background(), "eth_sendRawTransaction", func() error {
+		attempts++
+		if attempts < 3 {
+			return fmt.Errorf("connection reset by peer")
+		}
+		return nil
+	})
+	assert.NoError(err)
+	assert.Equal(3, attempts)
+}
+
+func TestKnownTransactionOnRetry(t *testing.T) {
+	assert := assert.New(t)
+	known := &testRPCKnownTxError{}
+	args := []interface{}{"0x010203"}
+
+	var txHash string
+	assert.Equal(known, knownTransactionOnRetry(1, "eth_sendRawTransaction", known, &txHash, args))
+	assert.Equal(known, knownTransactionOnRetry(2, "eth_sendTransaction", known, &txHash, args))
+	assert.Equal(known, knownTransactionOnRetry(2, "eth_sendRawTransaction", known, &txHash, []interface{}{"0xzz"}))
+	assert.Equal(known, knownTransactionOnRetry(2, "eth_sendRawTransaction", known, &txHash, []interface{}{12345}))
+	assert.Equal("", txHash)
+
+	nonceErr := fmt.Errorf("nonce too low")
+	assert.Equal(nonceErr, knownTransactionOnRetry(2, "eth_sendRawTransaction", nonceErr, &txHash, args))
+
+	assert.NoError(knownTransactionOnRetry(2, "eth_sendRawTransaction", known, &txHash, args))
+	assert.Equal("0xf1885eda54b7a053318cd41e2093220dab15d65381b1157a3633a83bfd5c9239", txHash)
+}
+
+func TestRPCRetryDoesNotModifySuppliedConf(t *testing.T) {
+	assert := assert.New(t)
+	retryConf := &RPCRetryConf{}
+	breakerConf := &RPCCircuitBreakerConf{FailureThreshold: 1}
+	r := newRPCRetrier(retryConf, breakerConf)
+	assert.Equal(defaultRPCBreakerResetMS, r.breaker.conf.ResetTimeoutMS)
+	assert.Equal(RPCRetryConf{}, *retryConf)
+	assert.Equal(RPCCircuitBreakerConf{FailureThreshold: 1}, *breakerConf)
+}
+
+func TestRPCRetryDefaultsToSingleAttempt(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{}, &RPCCircuitBreakerConf{})
+	assert.Equal(defaultRPCRetryInitialDelayMS, r.conf.InitialDelayMS)
+	assert.Equal(defaultRPCRetryMaxDelayMS, r.conf.MaxDelayMS)
+	assert.Equal(defaultRPCRetryFactor, r.conf.Factor)
+	assert.Nil(r.breaker)
+	attempts := 0
+	r.do(context.Background(), "eth_blockNumber", func() error {
+		attempts++
+		return fmt.Errorf("connection refused")
+	})
+	assert.Equal(1, attempts)
+}
+
+func TestRPCRetryContextCancelled(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 5, InitialDelayMS: 60000}, &RPCCircuitBreakerConf{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts := 0
+	err := r.do(ctx, "eth_blockNumber", func() error {
+		attempts++
+		return fmt.Errorf("connection refused")
+	})
+	assert.EqualError(err, "connection refused")
+	assert.Equal(1, attempts)
+}
+
+func TestRPCCircuitBreakerOpensAndRecovers(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{}, &RPCCircuitBreakerConf{FailureThreshold: 2, ResetTimeoutMS: 50})
+
+	attempts := 0
+	failing := func() error {
+		attempts++
+		return fmt.Errorf("connection refused")
+	}
+	r.do(context.Background(), "eth_blockNumber", failing)
+	r.do(context.Background(), "eth_blockNumber", failing)
+	assert.Equal(2, attempts)
+
+	// Breaker is open, so we fail fast without calling the node
+	err := r.do(context.Background(), "eth_blockNumber", failing)
+	assert.Regexp("JSON/RPC node unavailable after 2 consecutive failures", err)
+	assert.Equal(2, attempts)
+
+	// After the reset timeout a single trial call is allowed
+	time.Sleep(60 * time.Millisecond)
+	err = r.do(context.Background(), "eth_blockNumber", func() error { return nil })
+	assert.NoError(err)
+	assert.Equal(0, r.breaker.consecutiveFailures)
+}
+
+func TestRPCCircuitBreakerTrialFailureReopens(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{}, &RPCCircuitBreakerConf{FailureThreshold: 1, ResetTimeoutMS: 50})
+
+	r.do(context.Background(), "eth_blockNumber", func() error { return fmt.Errorf("connection refused") })
+	time.Sleep(60 * time.Millisecond)
+
+	// Block in the trial call, and check other callers fail fast meanwhile
+	trialStarted := make(chan struct{})
+	trialRelease := make(chan struct{})
+	trialDone := make(chan error)
+	go func() {
+		trialDone <- r.do(context.Background(), "eth_blockNumber", func() error {
+			close(trialStarted)
+			<-trialRelease
+			return fmt.Errorf("connection refused")
+		})
+	}()
+	<-trialStarted
+	err := r.do(context.Background(), "eth_blockNumber", func() error { return nil })
+	assert.Regexp("JSON/RPC node unavailable", err)
+	close(trialRelease)
+	assert.EqualError(<-trialDone, "connection refused")
+
+	err = r.do(context.Background(), "eth_blockNumber", func() error { return nil })
+	assert.Regexp("JSON/RPC node unavailable after 2 consecutive failures", err)
+}
+
+func TestRPCCircuitBreakerIgnoresCancelledCalls(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{}, &RPCCircuitBreakerConf{FailureThreshold: 1, ResetTimeoutMS: 60000})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := r.do(ctx, "eth_blockNumber", func() error {
+		cancel()
+		return fmt.Errorf("post http://localhost:8545: context canceled: i/o timeout")
+	})
+	assert.Regexp("context canceled", err)
+	assert.Equal(0, r.breaker.consecutiveFailures)
+	assert.False(r.breaker.trialInProgress)
+
+	err = r.do(context.Background(), "eth_blockNumber", func() error { return nil })
+	assert.NoError(err)
+}
+
+func TestRPCCircuitBreakerCountsClientTimeouts(t *testing.T) {
+	assert := assert.New(t)
+	r := newRPCRetrier(&RPCRetryConf{MaxAttempts: 5, InitialDelayMS: 1}, &RPCCircuitBreakerConf{FailureThreshold: 2, ResetTimeoutMS: 60000})
+
+	attempts := 0
+	timingOut := func() error {
+		attempts++
+		return context.DeadlineExceeded
+	}
+	r.do(context.Background(), "eth_blockNumber", timingOut)
+	r.do(context.Background(), "eth_blockNumber", timingOut)
+	assert.Equal(2, attempts)
+
+	err := r.do(context.Background(), "eth_blockNumber", timingOut)
+	assert.Regexp("JSON/RPC node unavailable after 2 consecutive failures", err)
+	assert.Equal(2, attempts)
+}
+
+type flakyEthClient struct {
+	mockEthClient
+	failures int
+	attempts int
+}
+
+func (w *flakyEthClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	w.attempts++
+	if w.attempts <= w.failures {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func TestRPCWrapperRetries(t *testing.T) {
+	assert := assert.New(t)
+	flaky := &flakyEthClient{failures: 2}
+	w := &rpcWrapper{
+		rpc:     flaky,
+		retrier: newRPCRetrier(&RPCRetryConf{MaxAttempts: 3, InitialDelayMS: 1}, &RPCCircuitBreakerConf{}),
+	}
+	err := w.CallContext(context.Background(), nil, "eth_blockNumber")
+	assert.NoError(err)
+	assert.Equal(3, flaky.attempts)
+}
+
+type testRPCKnownTxError struct{}
+
+func (e *testRPCKnownTxError) Error() string  { return "known transaction: f1885eda" }
+func (e *testRPCKnownTxError) ErrorCode() int { return -32000 }
+
+type resendEthClient struct {
+	mockEthClient
+	attempts int
+}
+
+func (w *resendEthClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	w.attempts++
+	if w.attempts == 1 {
+		// The node accepted the transaction, but the response was lost
+		return fmt.Errorf("connection reset by peer")
+	}
+	return &testRPCKnownTxError{}
+}
+
+func TestRPCWrapperRetriedSendKnownTransaction(t *testing.T) {
+	assert := assert.New(t)
+	resend := &resendEthClient{}
+	w := &rpcWrapper{
+		rpc:     resend,
+		retrier: newRPCRetrier(&RPCRetryConf{MaxAttempts: 3, InitialDelayMS: 1}, &RPCCircuitBreakerConf{}),
+	}
+	var txHash string
+	err := w.CallContext(context.Background(), &txHash, "eth_sendRawTransaction", "0x010203")
+	assert.NoError(err)
+	assert.Equal(2, resend.attempts)
+	assert.Equal("0xf1885eda54b7a053318cd41e2093220dab15d65381b1157a3633a83bfd5c9239", txHash)
+}
+
+func TestRPCWrapperFirstSendKnownTransactionFails(t *testing.T) {
+	assert := assert.New(t)
+	resend := &resendEthClient{attempts: 1}
+	w := &rpcWrapper{
+		rpc:     resend,
+		retrier: newRPCRetrier(&RPCRetryConf{MaxAttempts: 3, InitialDelayMS: 1}, &RPCCircuitBreakerConf{}),
+	}
+	var txHash string
+	err := w.CallContext(context.Background(), &txHash, "eth_sendRawTransaction", "0x010203")
+	assert.Regexp("known transaction", err)
+	assert.Equal("", txHash)
+}
+
+func TestCobraInitRPCRetry(t *testing.T) {
+	assert := assert.New(t)
+	rconf := &RPCConf{}
+	cmd := &cobra.Command{}
+	CobraInitRPC(cmd, rconf)
+	cmd.ParseFlags([]string{
+		"--rpc-retry-max", "5",
+		"--rpc-breaker-threshold", "10",
+		"--rpc-breaker-reset-ms", "1000",
+	})
+	assert.Equal(5, rconf.RPC.Retry.MaxAttempts)
+	assert.Equal(10, rconf.RPC.CircuitBreaker.FailureThreshold)
+	assert.Equal(1000, rconf.RPC.CircuitBreaker.ResetTimeoutMS)
+}
@@ -0,0 +1,254 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRPCShadowMaxConcurrency = 10
+	defaultRPCShadowTimeoutMS      = 10000
+	rpcShadowLogMaxLen             = 512
+)
+
+// RPCShadowConf configures shadow mode, where read-only JSON/RPC calls are mirrored to a secondary
+// node and the results compared with those of the primary - to de-risk migrating between node
+// vendors or versions. The shadow never affects the result returned to the caller. Mirrored calls
+// are made in the background, and are dropped when MaxConcurrency are already in flight
+type RPCShadowConf struct {
+	URL            string   `json:"url,omitempty"`
+	Methods        []string `json:"methods,omitempty"`
+	MaxConcurrency int      `json:"maxConcurrency,omitempty"`
+	TimeoutMS      int      `json:"timeoutMS,omitempty"`
+}
+
+// defaultRPCShadowMethods are the read-only methods that are mirrored when not configured. Their results
+// only depend on the chain, rather than on the pending transactions or gas price view of the node
+var defaultRPCShadowMethods = []string{
+	"eth_call",
+	"eth_chainId",
+	"eth_getBalance",
+	"eth_getBlockByHash",
+	"eth_getCode",
+	"eth_getLogs",
+	"eth_getStorageAt",
+	"eth_getTransactionByHash",
+	"eth_getTransactionReceipt",
+	"net_version",
+}
+
+// RPCShadowStats counts the calls mirrored to a shadow node, and how they compared with the primary.
+// Failed counts shadow calls that did not get a response from the node, such as on a timeout
+type RPCShadowStats struct {
+	URL        string `json:"url"`
+	Mirrored   int64  `json:"mirrored"`
+	Matched    int64  `json:"matched"`
+	Mismatched int64  `json:"mismatched"`
+	Failed     int64  `json:"failed"`
+	Dropped    int64  `json:"dropped"`
+}
+
+type rpcShadow struct {
+	rpc     rcpClient
+	methods map[string]bool
+	slots   chan bool
+	timeout time.Duration
+	stats   RPCShadowStats
+}
+
+// rpcShadows are shared by all connections that mirror to the same shadow node, so the stats
+// and the limit on concurrency cover every connection to the primary
+var rpcShadows = struct {
+	sync.Mutex
+	byURL map[string]*rpcShadow
+}{byURL: make(map[string]*rpcShadow)}
+
+// rpcShadowFor returns the shadow node for the configuration, connecting to it the first time
+func rpcShadowFor(conf *RPCShadowConf) (*rpcShadow, error) {
+	rpcShadows.Lock()
+	defer rpcShadows.Unlock()
+	if s, exists := rpcShadows.byURL[conf.URL]; exists {
+		return s, nil
+	}
+	rpcClient, err := ethbind.API.Dial(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	methods := conf.Methods
+	if len(methods) == 0 {
+		methods = defaultRPCShadowMethods
+	}
+	maxConcurrency := conf.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = defaultRPCShadowMaxConcurrency
+	}
+	timeoutMS := conf.TimeoutMS
+	if timeoutMS <= 0 {
+		timeoutMS = defaultRPCShadowTimeoutMS
+	}
+	s := &rpcShadow{
+		rpc:     rpcClient,
+		methods: make(map[string]bool, len(methods)),
+		slots:   make(chan bool, maxConcurrency),
+		timeout: time.Duration(timeoutMS) * time.Millisecond,
+		stats:   RPCShadowStats{URL: utils.RedactURL(conf.URL)},
+	}
+	for _, method := range methods {
+		s.methods[method] = true
+	}
+	rpcShadows.byURL[conf.URL] = s
+	log.Infof("JSON/RPC shadow mode enabled for %d methods: %s", len(methods), s.stats.URL)
+	return s, nil
+}
+
+// RPCShadowStatus returns the stats of each shadow node that calls are mirrored to
+func RPCShadowStatus() []*RPCShadowStats {
+	rpcShadows.Lock()
+	defer rpcShadows.Unlock()
+	status := make([]*RPCShadowStats, 0, len(rpcShadows.byURL))
+	for _, s := range rpcShadows.byURL {
+		status = append(status, &RPCShadowStats{
+			URL:        s.stats.URL,
+			Mirrored:   atomic.LoadInt64(&s.stats.Mirrored),
+			Matched:    atomic.LoadInt64(&s.stats.Matched),
+			Mismatched: atomic.LoadInt64(&s.stats.Mismatched),
+			Failed:     atomic.LoadInt64(&s.stats.Failed),
+			Dropped:    atomic.LoadInt64(&s.stats.Dropped),
+		})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].URL < status[j].URL })
+	return status
+}
+
+// mirror sends a call that has completed on the primary to the shadow node in the background, to
+// compare the results. The arguments and result are serialized first, as the caller owns them
+func (s *rpcShadow) mirror(method string, args []interface{}, result interface{}, primaryErr error) {
+	if !s.methods[method] || result == nil {
+		return
+	}
+	// Only errors returned by the primary node are compared, not failures to reach it
+	if _, rejected := primaryErr.(rpcErrorWithCode); primaryErr != nil && !rejected {
+		return
+	}
+	var primary []byte
+	if primaryErr == nil {
+		var err error
+		if primary, err = normalizedJSON(result); err != nil {
+			log.Debugf("JSON/RPC shadow skipped %s, as the result could not be serialized: %s", method, err)
+			return
+		}
+	}
+	jsonArgs := make([]interface{}, len(args))
+	for i, arg := range args {
+		b, err := json.Marshal(arg)
+		if err != nil {
+			log.Debugf("JSON/RPC shadow skipped %s, as the args could not be serialized: %s", method, err)
+			return
+		}
+		jsonArgs[i] = json.RawMessage(b)
+	}
+	select {
+	case s.slots <- true:
+	default:
+		atomic.AddInt64(&s.stats.Dropped, 1)
+		return
+	}
+	go func() {
+		defer func() { <-s.slots }()
+		s.compare(method, jsonArgs, newResultLike(result), primary, primaryErr)
+	}()
+}
+
+// compare makes the call on the shadow node, decoding into the same type as the primary result,
+// so only the fields that are used are compared, and differences in formatting are not reported
+func (s *rpcShadow) compare(method string, args []interface{}, shadowResult interface{}, primary []byte, primaryErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	shadowErr := s.rpc.CallContext(ctx, shadowResult, method, args...)
+	atomic.AddInt64(&s.stats.Mirrored, 1)
+
+	var shadow []byte
+	if shadowErr == nil {
+		shadow, _ = normalizedJSON(shadowResult)
+	}
+	_, shadowRejected := shadowErr.(rpcErrorWithCode)
+	switch {
+	case primaryErr != nil && shadowErr != nil:
+		// The nodes might word their errors differently, so the errors are not compared
+		atomic.AddInt64(&s.stats.Matched, 1)
+	case shadowErr != nil && !shadowRejected:
+		atomic.AddInt64(&s.stats.Failed, 1)
+		log.Debugf("JSON/RPC shadow call %s failed: %s", method, shadowErr)
+	case shadowErr != nil:
+		atomic.AddInt64(&s.stats.Mismatched, 1)
+		log.Warnf("JSON/RPC shadow mismatch for %s %s: primary=%s shadow error: %s", method, truncateForLog(args), truncateForLog(string(primary)), shadowErr)
+	case primaryErr != nil:
+		atomic.AddInt64(&s.stats.Mismatched, 1)
+		log.Warnf("JSON/RPC shadow mismatch for %s %s: primary error: %s shadow=%s", method, truncateForLog(args), primaryErr, truncateForLog(string(shadow)))
+	case !bytes.Equal(primary, shadow):
+		atomic.AddInt64(&s.stats.Mismatched, 1)
+		log.Warnf("JSON/RPC shadow mismatch for %s %s: primary=%s shadow=%s", method, truncateForLog(args), truncateForLog(string(primary)), truncateForLog(string(shadow)))
+	default:
+		atomic.AddInt64(&s.stats.Matched, 1)
+	}
+}
+
+// normalizedJSON serializes a result with the keys of any objects in order, so results decoded
+// into a generic map or raw message are compared regardless of the order the node returned them in
+func normalizedJSON(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// newResultLike returns a new value of the type the result of a call is decoded into
+func newResultLike(result interface{}) interface{} {
+	if t := reflect.TypeOf(result); t != nil && t.Kind() == reflect.Ptr {
+		return reflect.New(t.Elem()).Interface()
+	}
+	return &json.RawMessage{}
+}
+
+func truncateForLog(v interface{}) string {
+	var s string
+	if str, ok := v.(string); ok {
+		s = str
+	} else {
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	if len(s) > rpcShadowLogMaxLen {
+		return s[0:rpcShadowLogMaxLen] + "..."
+	}
+	return s
+}
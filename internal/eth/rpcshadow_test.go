@@ -0,0 +1,197 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestJSONRPCServer replies to each call with the raw result JSON returned for its method,
+// or with a JSON/RPC error if the method is not in the map
+func newTestJSONRPCServer(results map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var call map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&call)
+		reply := map[string]interface{}{"jsonrpc": "2.0", "id": call["id"]}
+		if result, ok := results[call["method"].(string)]; ok {
+			reply["result"] = json.RawMessage(result)
+		} else {
+			reply["error"] = map[string]interface{}{"code": -32000, "message": "pop"}
+		}
+		res.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(res).Encode(&reply)
+	}))
+}
+
+func waitForShadowMirrored(s *rpcShadow, count int64) {
+	for atomic.LoadInt64(&s.stats.Mirrored) < count {
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestRPCShadowCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	primarySvr := newTestJSONRPCServer(map[string]string{
+		"eth_getBalance":            `"0x10"`,
+		"eth_call":                  `"0x01"`,
+		"eth_blockNumber":           `"0x100"`,
+		"eth_getTransactionReceipt": `{"blockNumber":"0x1","status":"0x1"}`,
+	})
+	defer primarySvr.Close()
+	shadowSvr := newTestJSONRPCServer(map[string]string{
+		"eth_getBalance":            `"0x10"`,
+		"eth_call":                  `"0x02"`,
+		"eth_blockNumber":           `"0x101"`,
+		"eth_getTransactionReceipt": `{"status":"0x1","blockNumber":"0x1"}`,
+	})
+	defer shadowSvr.Close()
+
+	rpc, err := RPCConnect(&RPCConnOpts{
+		URL:    primarySvr.URL,
+		Shadow: RPCShadowConf{URL: shadowSvr.URL},
+	})
+	assert.NoError(err)
+	shadow := rpc.(*rpcWrapper).shadow
+
+	var balance, callResult, blockNumber string
+	err = rpc.CallContext(context.Background(), &balance, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.NoError(err)
+	assert.Equal("0x10", balance)
+	err = rpc.CallContext(context.Background(), &callResult, "eth_call", map[string]string{"to": "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1"}, "latest")
+	assert.NoError(err)
+	assert.Equal("0x01", callResult)
+	err = rpc.CallContext(context.Background(), &blockNumber, "eth_blockNumber")
+	assert.NoError(err)
+	var receipt map[string]interface{}
+	err = rpc.CallContext(context.Background(), &receipt, "eth_getTransactionReceipt", "0x12345")
+	assert.NoError(err)
+	waitForShadowMirrored(shadow, 3)
+
+	var stats *RPCShadowStats
+	for _, s := range RPCShadowStatus() {
+		if s.URL == shadowSvr.URL {
+			stats = s
+		}
+	}
+	assert.Equal(int64(3), stats.Mirrored)
+	assert.Equal(int64(2), stats.Matched)
+	assert.Equal(int64(1), stats.Mismatched)
+}
+
+func TestRPCShadowErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	primarySvr := newTestJSONRPCServer(map[string]string{
+		"eth_getBalance": `"0x10"`,
+	})
+	defer primarySvr.Close()
+	shadowSvr := newTestJSONRPCServer(map[string]string{
+		"eth_getCode": `"0x"`,
+	})
+	defer shadowSvr.Close()
+
+	rpc, err := RPCConnect(&RPCConnOpts{
+		URL:    primarySvr.URL,
+		Shadow: RPCShadowConf{URL: shadowSvr.URL, Methods: []string{"eth_getBalance", "eth_getCode", "eth_getStorageAt"}},
+	})
+	assert.NoError(err)
+	shadow := rpc.(*rpcWrapper).shadow
+
+	// The shadow rejecting a call the primary answered is a mismatch
+	var result string
+	err = rpc.CallContext(context.Background(), &result, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.NoError(err)
+	waitForShadowMirrored(shadow, 1)
+	assert.Equal(int64(1), atomic.LoadInt64(&shadow.stats.Mismatched))
+
+	// As is the primary rejecting a call the shadow answered
+	err = rpc.CallContext(context.Background(), &result, "eth_getCode", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.Regexp("pop", err)
+	waitForShadowMirrored(shadow, 2)
+	assert.Equal(int64(2), atomic.LoadInt64(&shadow.stats.Mismatched))
+
+	// Both rejecting a call matches
+	err = rpc.CallContext(context.Background(), &result, "eth_getStorageAt", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "0x0", "latest")
+	assert.Regexp("pop", err)
+	waitForShadowMirrored(shadow, 3)
+	assert.Equal(int64(1), atomic.LoadInt64(&shadow.stats.Matched))
+
+	// The shadow being unavailable is a failure, and does not affect the primary
+	shadowSvr.Close()
+	err = rpc.CallContext(context.Background(), &result, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+	assert.NoError(err)
+	assert.Equal("0x10", result)
+	waitForShadowMirrored(shadow, 4)
+	assert.Equal(int64(1), atomic.LoadInt64(&shadow.stats.Failed))
+	assert.Equal(int64(2), atomic.LoadInt64(&shadow.stats.Mismatched))
+}
+
+func TestRPCShadowDropsWhenBusy(t *testing.T) {
+	assert := assert.New(t)
+
+	primarySvr := newTestJSONRPCServer(map[string]string{"eth_getBalance": `"0x10"`})
+	defer primarySvr.Close()
+	release := make(chan bool)
+	shadowSvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		<-release
+		res.WriteHeader(500)
+	}))
+	defer shadowSvr.Close()
+
+	rpc, err := RPCConnect(&RPCConnOpts{
+		URL:    primarySvr.URL,
+		Shadow: RPCShadowConf{URL: shadowSvr.URL, MaxConcurrency: 1},
+	})
+	assert.NoError(err)
+	shadow := rpc.(*rpcWrapper).shadow
+
+	var result string
+	for i := 0; i < 3; i++ {
+		err = rpc.CallContext(context.Background(), &result, "eth_getBalance", "0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1", "latest")
+		assert.NoError(err)
+	}
+	assert.Equal(int64(2), atomic.LoadInt64(&shadow.stats.Dropped))
+	close(release)
+	waitForShadowMirrored(shadow, 1)
+	assert.Equal(int64(1), atomic.LoadInt64(&shadow.stats.Failed))
+}
+
+func TestRPCShadowSkipsUnreachablePrimary(t *testing.T) {
+	s := &rpcShadow{methods: map[string]bool{"eth_call": true}, slots: make(chan bool, 1)}
+	var result string
+	s.mirror("eth_call", []interface{}{}, &result, context.DeadlineExceeded)
+	s.mirror("eth_call", []interface{}{}, nil, nil)
+	assert.Empty(t, s.slots)
+}
+
+func TestCobraInitRPCShadow(t *testing.T) {
+	rconf := &RPCConf{}
+	cmd := &cobra.Command{}
+	CobraInitRPC(cmd, rconf)
+	cmd.ParseFlags([]string{
+		"--rpc-shadow-url", "http://localhost:8546",
+	})
+	assert.Equal(t, "http://localhost:8546", rconf.RPC.Shadow.URL)
+}
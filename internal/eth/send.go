@@ -15,8 +15,10 @@
 package eth
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"math/big"
 	"strings"
 	"time"
@@ -30,15 +32,55 @@ import (
 
 const (
 	errorFunctionSelector = "0x08c379a0" // per https://solidity.readthedocs.io/en/v0.4.24/control-structures.html the signature of Error(string)
+	panicFunctionSelector = "0x4e487b71" // per https://docs.soliditylang.org/en/v0.8.0/control-structures.html the signature of Panic(uint256)
 )
 
+// panicReasons are the codes Solidity 0.8+ uses for Panic(uint256) reverts
+var panicReasons = map[uint64]string{
+	0x00: "Generic compiler inserted panic",
+	0x01: "Assertion failed",
+	0x11: "Arithmetic operation resulted in underflow or overflow",
+	0x12: "Division or modulo by zero",
+	0x21: "Conversion of a value that is too big or negative into an enum type",
+	0x22: "Access to an incorrectly encoded storage byte array",
+	0x31: "Pop on an empty array",
+	0x32: "Array index out of bounds",
+	0x41: "Too much memory allocated, or an array that is too large",
+	0x51: "Call to a zero-initialized variable of internal function type",
+}
+
+// rpcDataError is implemented by JSON/RPC errors that carry data, such as the revert data
+// returned by some nodes when an eth_call reverts
+type rpcDataError interface {
+	ErrorData() interface{}
+}
+
 // calculateGas uses eth_estimateGas to estimate the gas required, providing a buffer
 // of 20% for variation as the chain changes between estimation and submission.
+// The buffer is reduced if it would take the gas over the maximum for the transaction.
 func (tx *Txn) calculateGas(ctx context.Context, rpc RPCClient, txArgs *SendTXArgs, gas *ethbinding.HexUint64) (err error) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	timeout := stageTimeout(tx.Timeouts.GasEstimate)
+	estimateCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	if err := rpc.CallContext(ctx, &gas, "eth_estimateGas", txArgs); err != nil {
+	estimateArgs := txArgs
+	if tx.FactoryDeployAddress != nil {
+		// The factory does not revert when CREATE2 runs out of gas, so an estimate of the call to it
+		// can be too low to create the contract. The creation is estimated as a plain CREATE instead
+		createArgs := *txArgs
+		initCode := ethbinding.HexBytes(tx.FactoryInitCode)
+		createArgs.To = ""
+		createArgs.Data = &initCode
+		estimateArgs = &createArgs
+	}
+
+	estimateStart := time.Now()
+	err = rpc.CallContext(estimateCtx, &gas, "eth_estimateGas", estimateArgs)
+	tx.StageTimes.GasEstimate = time.Since(estimateStart).Seconds()
+	if err != nil && estimateCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return errors.Errorf(errors.TransactionSendStageTimeout, "gas estimation", timeout)
+	}
+	if err != nil {
 		// Now we attempt a call of the transaction, because that will return us a useful error in the case, of a revert.
 		estError := errors.Errorf(errors.TransactionSendGasEstimateFailed, err)
 		log.Errorf(estError.Error())
@@ -48,16 +90,40 @@ func (tx *Txn) calculateGas(ctx context.Context, rpc RPCClient, txArgs *SendTXAr
 		// If the call succeeds, after estimate completed - we still need to fail with the estimate error
 		return estError
 	}
-	*gas = ethbinding.HexUint64(float64(*gas) * 1.2)
+	estimate := uint64(*gas)
+	if tx.FactoryDeployAddress != nil {
+		estimate = singletonFactoryGas(estimate, len(tx.FactoryInitCode))
+	}
+	*gas = ethbinding.HexUint64(float64(estimate) * 1.2)
+	if tx.MaxGas > 0 && uint64(*gas) > tx.MaxGas {
+		if estimate > tx.MaxGas {
+			return errors.Errorf(errors.TransactionSendGasEstimateExceedsMax, estimate, tx.MaxGas)
+		}
+		// The buffer is limited to the maximum, as the estimate itself is within it
+		*gas = ethbinding.HexUint64(tx.MaxGas)
+	}
 	return nil
 }
 
 // Call synchronously calls the method, without mining a transaction, and returns the result as RLP encoded bytes or nil
 func (tx *Txn) Call(ctx context.Context, rpc RPCClient, blocknumber string) (res []byte, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var hexString string
+	if err = rpc.CallContext(ctx, &hexString, "eth_call", tx.callArgs(), blocknumber); err != nil {
+		return nil, errors.Errorf(errors.TransactionSendCallFailedNoRevert, err)
+	}
+	return processCallResult(hexString)
+}
+
+// callArgs builds the transaction object for an eth_call
+func (tx *Txn) callArgs() *SendTXArgs {
 	data := ethbinding.HexBytes(tx.EthTX.Data())
+	gasPrice := ethbinding.HexBigInt(*tx.EthTX.GasPrice())
 	txArgs := &SendTXArgs{
 		From:     tx.From.Hex(),
-		GasPrice: ethbinding.HexBigInt(*tx.EthTX.GasPrice()),
+		GasPrice: &gasPrice,
 		Value:    ethbinding.HexBigInt(*tx.EthTX.Value()),
 		Data:     &data,
 	}
@@ -65,17 +131,117 @@ func (tx *Txn) Call(ctx context.Context, rpc RPCClient, blocknumber string) (res
 	if to != nil {
 		txArgs.To = to.Hex()
 	}
+	return txArgs
+}
+
+// processCallResult decodes the hex response of an eth_call, returning an error
+// if the call reverted or hit a panic
+func processCallResult(hexString string) (res []byte, err error) {
+	if len(hexString) == 0 || hexString == "0x" {
+		return nil, nil
+	}
+	if err = decodeRevertData(hexString); err != nil {
+		return nil, err
+	}
+	log.Debugf("eth_call response: %s", hexString)
+	res = ethbind.API.FromHex(hexString)
+	return
+}
+
+// DecodeRevertReason describes the hex encoded revert data of a failed transaction.
+// Data that is not an Error(string), a Panic(uint256), or one of the custom errors in
+// the supplied ABI is returned unchanged
+func DecodeRevertReason(hexString string, errorABI ethbinding.ABIMarshaling) string {
+	if err := decodeRevertData(hexString); err != nil {
+		return err.Error()
+	}
+	if err := decodeCustomError(hexString, errorABI); err != nil {
+		return err.Error()
+	}
+	return hexString
+}
 
+// ErrorEntries returns the custom error entries of an ABI, used to decode revert data
+func ErrorEntries(abi ethbinding.ABIMarshaling) ethbinding.ABIMarshaling {
+	var errorABI ethbinding.ABIMarshaling
+	for _, element := range abi {
+		if element.Type == "error" {
+			errorABI = append(errorABI, element)
+		}
+	}
+	return errorABI
+}
+
+// decodeCustomError returns an error describing the revert, if the data matches the
+// selector of one of the custom errors in the ABI. Otherwise nil is returned
+func decodeCustomError(hexString string, errorABI ethbinding.ABIMarshaling) error {
+	data, err := hex.DecodeString(strings.TrimPrefix(hexString, "0x"))
+	if err != nil || len(data) < 4 {
+		return nil
+	}
+	for _, element := range errorABI {
+		if element.Type != "error" {
+			continue
+		}
+		errorMethod, err := ethbind.API.ABIElementMarshalingToABIMethod(&ethbinding.ABIElementMarshaling{
+			Type:   "function",
+			Name:   element.Name,
+			Inputs: element.Inputs,
+		})
+		if err != nil || !bytes.Equal(errorMethod.ID, data[0:4]) {
+			continue
+		}
+		args, err := DecodeMethodInputs(errorMethod, data)
+		if err != nil {
+			return errors.Errorf(errors.TransactionSendCallFailedCustomErrorNoArgs, element.Name, err)
+		}
+		argsJSON, _ := json.Marshal(args)
+		log.Warnf("EVM Reverted. Error=%s Args=%s", element.Name, argsJSON)
+		return errors.Errorf(errors.TransactionSendCallFailedCustomError, element.Name, argsJSON)
+	}
+	return nil
+}
+
+// GetRevertReason replays a mined transaction that failed with eth_call, at the block it was
+// mined in, to obtain the reason it reverted. Nodes return the revert data either in the data
+// of the JSON/RPC error, or as the result of the call. An empty string is returned if there
+// is no revert data, or if it cannot be distinguished from the output of a successful call
+func (tx *Txn) GetRevertReason(ctx context.Context, rpc RPCClient, blockNumber *ethbinding.HexBigInt, errorABI ethbinding.ABIMarshaling) string {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
+	txArgs := tx.callArgs()
+	gas := ethbinding.HexUint64(tx.EthTX.Gas())
+	txArgs.Gas = &gas
+	blockOption := "latest"
+	if blockNumber != nil {
+		blockOption = ethbind.API.EncodeBig(blockNumber.ToInt())
+	}
+
 	var hexString string
-	if err = rpc.CallContext(ctx, &hexString, "eth_call", txArgs, blocknumber); err != nil {
-		return nil, errors.Errorf(errors.TransactionSendCallFailedNoRevert, err)
+	if err := rpc.CallContext(ctx, &hexString, "eth_call", txArgs, blockOption); err != nil {
+		dataErr, ok := err.(rpcDataError)
+		if !ok {
+			log.Warnf("TX:%s Failed to replay to obtain the revert reason: %s", tx.Hash, err)
+			return ""
+		}
+		if hexString, _ = dataErr.ErrorData().(string); hexString == "" || hexString == "0x" {
+			return ""
+		}
+		return DecodeRevertReason(hexString, errorABI)
 	}
-	if len(hexString) == 0 || hexString == "0x" {
-		return nil, nil
+	if err := decodeRevertData(hexString); err != nil {
+		return err.Error()
+	}
+	if err := decodeCustomError(hexString, errorABI); err != nil {
+		return err.Error()
 	}
+	return ""
+}
+
+// decodeRevertData returns an error describing the revert, if the data is an encoded
+// Error(string) or Panic(uint256). Otherwise nil is returned
+func decodeRevertData(hexString string) error {
 	retStrLen := uint64(len(hexString))
 	if strings.HasPrefix(hexString, errorFunctionSelector) && retStrLen > 138 {
 		// The call reverted. Process the error response
@@ -91,24 +257,60 @@ func (tx *Txn) Call(ctx context.Context, rpc RPCClient, blocknumber string) (res
 		errorStringBytes, err := hex.DecodeString(errorStringHex)
 		log.Warnf("EVM Reverted. Message='%s' Offset='%s'", errorStringBytes, dataOffsetHex.Text(10))
 		if err != nil {
-			return nil, errors.Errorf(errors.TransactionSendCallFailedRevertNoMessage)
+			return errors.Errorf(errors.TransactionSendCallFailedRevertNoMessage)
 		}
-		return nil, errors.Errorf(errors.TransactionSendCallFailedRevertMessage, errorStringBytes)
+		return errors.Errorf(errors.TransactionSendCallFailedRevertMessage, errorStringBytes)
 	}
-	log.Debugf("eth_call response: %s", hexString)
-	res = ethbind.API.FromHex(hexString)
-	return
+	if strings.HasPrefix(hexString, panicFunctionSelector) && retStrLen >= 74 {
+		// The call hit a panic (assert, overflow etc.) in Solidity 0.8+. Process the code
+		panicCode, ok := new(big.Int).SetString(hexString[10:74], 16)
+		if !ok {
+			return errors.Errorf(errors.TransactionSendCallFailedRevertNoMessage)
+		}
+		reason, known := panicReasons[panicCode.Uint64()]
+		if !known || !panicCode.IsUint64() {
+			reason = errors.Errorf(errors.TransactionSendCallFailedPanicUnknown).Error()
+		}
+		log.Warnf("EVM Panic. Code=0x%s Reason='%s'", panicCode.Text(16), reason)
+		return errors.Errorf(errors.TransactionSendCallFailedPanic, panicCode.Text(16), reason)
+	}
+	return nil
 }
 
 // Send sends an individual transaction, choosing external or internal signing
 func (tx *Txn) Send(ctx context.Context, rpc RPCClient) (err error) {
 	start := time.Now().UTC()
 
+	txArgs, err := tx.prepareSend(ctx, rpc)
+	if err != nil {
+		return err
+	}
+	if tx.Approve != nil {
+		if err = tx.Approve(); err != nil {
+			return err
+		}
+	}
+
+	tx.Hash, err = tx.submitTXtoNode(ctx, rpc, txArgs)
+
+	callTime := time.Now().UTC().Sub(start)
+	if err != nil {
+		log.Warnf("TX:%s Failed to send: %s [%.2fs]", tx.Hash, err, callTime.Seconds())
+	} else {
+		log.Infof("TX:%s Sent OK [%.2fs]", tx.Hash, callTime.Seconds())
+	}
+	return err
+}
+
+// prepareSend builds the arguments to send the transaction, estimating the gas
+// when it is not supplied, and checking it against the maximum and the block gas limit
+func (tx *Txn) prepareSend(ctx context.Context, rpc RPCClient) (*SendTXArgs, error) {
 	gas := ethbinding.HexUint64(tx.EthTX.Gas())
 	data := ethbinding.HexBytes(tx.EthTX.Data())
+	gasPrice := ethbinding.HexBigInt(*tx.EthTX.GasPrice())
 	txArgs := &SendTXArgs{
 		From:     tx.From.Hex(),
-		GasPrice: ethbinding.HexBigInt(*tx.EthTX.GasPrice()),
+		GasPrice: &gasPrice,
 		Value:    ethbinding.HexBigInt(*tx.EthTX.Value()),
 		Data:     &data,
 	}
@@ -116,9 +318,12 @@ func (tx *Txn) Send(ctx context.Context, rpc RPCClient) (err error) {
 	if to != nil {
 		txArgs.To = to.Hex()
 	}
+	if err := tx.checkBlockGasLimit(ctx, rpc, uint64(gas)); err != nil {
+		return nil, err
+	}
 	if uint64(gas) == uint64(0) {
-		if err = tx.calculateGas(ctx, rpc, txArgs, &gas); err != nil {
-			return err
+		if err := tx.calculateGas(ctx, rpc, txArgs, &gas); err != nil {
+			return nil, err
 		}
 		// Re-encode the EthTX (for external HD Wallet signing)
 		if to != nil {
@@ -126,21 +331,11 @@ func (tx *Txn) Send(ctx context.Context, rpc RPCClient) (err error) {
 		} else {
 			tx.EthTX = ethbind.API.NewContractCreation(tx.EthTX.Nonce(), tx.EthTX.Value(), uint64(gas), tx.EthTX.GasPrice(), tx.EthTX.Data())
 		}
+	} else if tx.MaxGas > 0 && uint64(gas) > tx.MaxGas {
+		return nil, errors.Errorf(errors.TransactionSendGasExceedsMax, uint64(gas), tx.MaxGas)
 	}
 	txArgs.Gas = &gas
-
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
-
-	tx.Hash, err = tx.submitTXtoNode(ctx, rpc, txArgs)
-
-	callTime := time.Now().UTC().Sub(start)
-	if err != nil {
-		log.Warnf("TX:%s Failed to send: %s [%.2fs]", tx.Hash, err, callTime.Seconds())
-	} else {
-		log.Infof("TX:%s Sent OK [%.2fs]", tx.Hash, callTime.Seconds())
-	}
-	return err
+	return txArgs, nil
 }
 
 // SendTXArgs is the JSON arguments that can be passed to an eth_sendTransaction call,
@@ -150,7 +345,7 @@ type SendTXArgs struct {
 	From     string                `json:"from"`
 	To       string                `json:"to,omitempty"`
 	Gas      *ethbinding.HexUint64 `json:"gas,omitempty"`
-	GasPrice ethbinding.HexBigInt  `json:"gasPrice,omitempty"`
+	GasPrice *ethbinding.HexBigInt `json:"gasPrice,omitempty"`
 	Value    ethbinding.HexBigInt  `json:"value,omitempty"`
 	Data     *ethbinding.HexBytes  `json:"data"`
 	// EEA spec extensions
@@ -158,6 +353,10 @@ type SendTXArgs struct {
 	PrivateFor     []string `json:"privateFor,omitempty"`
 	PrivacyGroupID string   `json:"privacyGroupId,omitempty"`
 	Restriction    string   `json:"restriction,omitempty"`
+	// EIP-4844 extensions
+	Type                string                `json:"type,omitempty"`
+	BlobVersionedHashes []string              `json:"blobVersionedHashes,omitempty"`
+	MaxFeePerBlobGas    *ethbinding.HexBigInt `json:"maxFeePerBlobGas,omitempty"`
 }
 
 // submitTXtoNode sends a transaction
@@ -190,6 +389,13 @@ func (tx *Txn) submitTXtoNode(ctx context.Context, rpc RPCClient, txArgs *SendTX
 		txArgs.PrivateFor = tx.PrivateFor
 		isPrivate = true
 	}
+	if err := tx.addBlobArgs(txArgs, isPrivate); err != nil {
+		return "", err
+	}
+
+	if tx.PrivatePayloadStore != nil && tx.PrivacyGroupID == "" && len(tx.PrivateFor) > 0 {
+		return tx.submitStoreRawTX(ctx, rpc)
+	}
 
 	var callParam0 interface{} = txArgs
 	if tx.Signer != nil {
@@ -198,14 +404,55 @@ func (tx *Txn) submitTXtoNode(ctx context.Context, rpc RPCClient, txArgs *SendTX
 		}
 		// Sign the transaction and get the bytes, which we pass to eth_sendRawTransaction
 		jsonRPCMethod = "eth_sendRawTransaction"
-		signed, err := tx.Signer.Sign(tx.EthTX)
+		signed, err := tx.sign(ctx)
 		if err != nil {
 			return "", err
 		}
 		callParam0 = ethbind.API.HexEncode(signed)
+		if tx.Signed != nil {
+			tx.Signed()
+		}
 	}
 
 	var txHash string
-	err := rpc.CallContext(ctx, &txHash, jsonRPCMethod, callParam0)
+	err := tx.submit(ctx, rpc, &txHash, jsonRPCMethod, callParam0)
 	return txHash, err
 }
+
+// sign runs the signer, failing if it does not return within the signing timeout. Only a
+// ContextSigner can be abandoned on the timeout, other signers hold their keys locally
+func (tx *Txn) sign(ctx context.Context) ([]byte, error) {
+	timeout := stageTimeout(tx.Timeouts.Sign)
+	signStart := time.Now()
+	defer func() { tx.StageTimes.Sign = time.Since(signStart).Seconds() }()
+
+	contextSigner, ok := tx.Signer.(ContextSigner)
+	if !ok {
+		return tx.Signer.Sign(tx.EthTX)
+	}
+	signCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	signed, err := contextSigner.SignContext(signCtx, tx.EthTX)
+	if err != nil && signCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, errors.Errorf(errors.TransactionSendStageTimeout, "signing", timeout)
+	}
+	return signed, err
+}
+
+// submit makes the JSON/RPC call that submits the transaction to the node, within the submission timeout
+func (tx *Txn) submit(ctx context.Context, rpc RPCClient, result interface{}, method string, args ...interface{}) error {
+	timeout := stageTimeout(tx.Timeouts.Submit)
+	submitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	submitStart := time.Now()
+	err := rpc.CallContext(submitCtx, result, method, args...)
+	tx.StageTimes.Submit = time.Since(submitStart).Seconds()
+	if err != nil && submitCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return errors.Errorf(errors.TransactionSendStageTimeout, "submission", timeout)
+	}
+	if err != nil && ctx.Err() == nil && errors.IsUncertain(err) {
+		return errors.Errorf(errors.TransactionSendSubmitUncertain, err)
+	}
+	return err
+}
@@ -0,0 +1,285 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+const (
+	eip712DomainType = "EIP712Domain"
+	signatureLength  = 65
+)
+
+// TypedDataField is a member of a struct type in EIP-712 typed data
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// TypedData is the EIP-712 structured data signed with eth_signTypedData_v4
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+var (
+	typedDataArray = regexp.MustCompile(`^(.+)\[([0-9]*)\]$`)
+	typedDataInt   = regexp.MustCompile(`^(u?)int([0-9]*)$`)
+	typedDataBytes = regexp.MustCompile(`^bytes([0-9]+)$`)
+)
+
+// HashPersonalMessage returns the hash signed by personal_sign, which prefixes the message
+// so that it cannot be a valid transaction
+func HashPersonalMessage(message []byte) []byte {
+	return ethbind.API.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))), message)
+}
+
+// HashTypedData returns the EIP-712 hash of typed data, which is what is signed
+func HashTypedData(td *TypedData) ([]byte, error) {
+	if _, ok := td.Types[td.PrimaryType]; !ok || td.PrimaryType == eip712DomainType {
+		return nil, errors.Errorf(errors.TypedDataUnknownType, td.PrimaryType)
+	}
+	if _, ok := td.Types[eip712DomainType]; !ok {
+		td.Types[eip712DomainType] = domainFieldsFor(td.Domain)
+	}
+	domainHash, err := td.hashStruct(eip712DomainType, td.Domain, "domain")
+	if err != nil {
+		return nil, err
+	}
+	messageHash, err := td.hashStruct(td.PrimaryType, td.Message, "message")
+	if err != nil {
+		return nil, err
+	}
+	return ethbind.API.Keccak256([]byte{0x19, 0x01}, domainHash, messageHash), nil
+}
+
+// domainFieldsFor returns the EIP712Domain type for a domain, when the type is omitted from
+// the typed data as libraries such as ethers.js do. Fields are in the order defined by EIP-712
+func domainFieldsFor(domain map[string]interface{}) []TypedDataField {
+	fields := []TypedDataField{}
+	for _, f := range []TypedDataField{
+		{Name: "name", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "chainId", Type: "uint256"},
+		{Name: "verifyingContract", Type: "address"},
+		{Name: "salt", Type: "bytes32"},
+	} {
+		if _, ok := domain[f.Name]; ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// RecoverAddress returns the address of the key that produced a 65 byte r,s,v signature of
+// the hash. The recovery id v can be 0/1, or 27/28 as returned by most wallets
+func RecoverAddress(hash, signature []byte) (string, error) {
+	if len(signature) != signatureLength {
+		return "", errors.Errorf(errors.SignatureBadLength, len(signature), signatureLength)
+	}
+	v := signature[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return "", errors.Errorf(errors.SignatureBadRecoveryID, signature[64])
+	}
+	for _, rs := range [][]byte{signature[0:32], signature[32:64]} {
+		if i := new(big.Int).SetBytes(rs); i.Sign() == 0 || i.Cmp(secp256k1N) >= 0 {
+			return "", errors.Errorf(errors.SignatureBadRS)
+		}
+	}
+	rsv := append(append([]byte{}, signature[0:64]...), v)
+	pubKey, err := ethbind.API.SigToPub(hash, rsv)
+	if err != nil {
+		return "", errors.Errorf(errors.SignatureRecoverFailed, err)
+	}
+	return ethbind.API.PubkeyToAddress(*pubKey).Hex(), nil
+}
+
+// dependencies returns the struct types referenced by a type, including itself
+func (td *TypedData) dependencies(typeName string, found map[string]bool) {
+	if idx := strings.Index(typeName, "["); idx >= 0 {
+		typeName = typeName[:idx]
+	}
+	if found[typeName] {
+		return
+	}
+	fields, ok := td.Types[typeName]
+	if !ok {
+		return
+	}
+	found[typeName] = true
+	for _, f := range fields {
+		td.dependencies(f.Type, found)
+	}
+}
+
+// encodeType returns the signature of a struct type, followed by those of the
+// struct types it references in alphabetical order
+func (td *TypedData) encodeType(typeName string) string {
+	found := make(map[string]bool)
+	td.dependencies(typeName, found)
+	delete(found, typeName)
+	deps := make([]string, 0, len(found))
+	for dep := range found {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	var buff strings.Builder
+	for _, t := range append([]string{typeName}, deps...) {
+		buff.WriteString(t + "(")
+		for i, f := range td.Types[t] {
+			if i > 0 {
+				buff.WriteString(",")
+			}
+			buff.WriteString(f.Type + " " + f.Name)
+		}
+		buff.WriteString(")")
+	}
+	return buff.String()
+}
+
+func (td *TypedData) hashStruct(typeName string, data map[string]interface{}, path string) ([]byte, error) {
+	fields, ok := td.Types[typeName]
+	if !ok {
+		return nil, errors.Errorf(errors.TypedDataUnknownType, typeName)
+	}
+	encoded := ethbind.API.Keccak256([]byte(td.encodeType(typeName)))
+	for _, f := range fields {
+		val, err := td.encodeValue(f.Type, data[f.Name], path+"."+f.Name)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, val...)
+	}
+	return ethbind.API.Keccak256(encoded), nil
+}
+
+// encodeValue returns the 32 byte encoding of a value. Dynamic types, arrays
+// and structs are encoded as the hash of their contents
+func (td *TypedData) encodeValue(typeName string, value interface{}, path string) ([]byte, error) {
+	if m := typedDataArray.FindStringSubmatch(typeName); m != nil {
+		items, ok := value.([]interface{})
+		if !ok || (m[2] != "" && strconv.Itoa(len(items)) != m[2]) {
+			return nil, errors.Errorf(errors.TypedDataBadValue, path, typeName)
+		}
+		var encoded []byte
+		for i, item := range items {
+			val, err := td.encodeValue(m[1], item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, val...)
+		}
+		return ethbind.API.Keccak256(encoded), nil
+	}
+	if _, isStruct := td.Types[typeName]; isStruct {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf(errors.TypedDataBadValue, path, typeName)
+		}
+		return td.hashStruct(typeName, data, path)
+	}
+	encoded, ok := encodeAtomicValue(typeName, value)
+	if !ok {
+		return nil, errors.Errorf(errors.TypedDataBadValue, path, typeName)
+	}
+	return encoded, nil
+}
+
+func encodeAtomicValue(typeName string, value interface{}) ([]byte, bool) {
+	switch {
+	case typeName == "string":
+		s, ok := value.(string)
+		return ethbind.API.Keccak256([]byte(s)), ok
+	case typeName == "bytes":
+		s, _ := value.(string)
+		b, err := ethbind.API.HexDecode(s)
+		return ethbind.API.Keccak256(b), err == nil
+	case typeName == "bool":
+		b, ok := value.(bool)
+		encoded := make([]byte, 32)
+		if b {
+			encoded[31] = 1
+		}
+		return encoded, ok
+	case typeName == "address":
+		s, _ := value.(string)
+		if !ethbind.API.IsHexAddress(s) {
+			return nil, false
+		}
+		return leftPad32(ethbind.API.HexToAddress(s).Bytes()), true
+	}
+	if m := typedDataBytes.FindStringSubmatch(typeName); m != nil {
+		s, _ := value.(string)
+		b, err := ethbind.API.HexDecode(s)
+		size, _ := strconv.Atoi(m[1])
+		if err != nil || len(b) != size || size > 32 {
+			return nil, false
+		}
+		return append(b, make([]byte, 32-len(b))...), true
+	}
+	if m := typedDataInt.FindStringSubmatch(typeName); m != nil {
+		i, ok := typedDataInteger(value)
+		if !ok || (m[1] == "u" && i.Sign() < 0) {
+			return nil, false
+		}
+		if i.Sign() < 0 {
+			// Two's complement in 256 bits
+			i = new(big.Int).Add(i, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		if i.BitLen() > 256 {
+			return nil, false
+		}
+		return leftPad32(i.Bytes()), true
+	}
+	return nil, false
+}
+
+// typedDataInteger parses an integer supplied as a JSON number, or a decimal or 0x hex string
+func typedDataInteger(value interface{}) (*big.Int, bool) {
+	var s string
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, false
+	}
+	if strings.HasPrefix(s, "0x") {
+		return new(big.Int).SetString(s[2:], 16)
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func leftPad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
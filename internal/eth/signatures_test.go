@@ -0,0 +1,156 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The signer of the test signatures is the key keccak256("cow"), as in the example of EIP-712
+const (
+	testCowAddress      = "0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826"
+	testMailTypedData   = `{"types":{"EIP712Domain":[{"name":"name","type":"string"},{"name":"version","type":"string"},{"name":"chainId","type":"uint256"},{"name":"verifyingContract","type":"address"}],"Person":[{"name":"name","type":"string"},{"name":"wallet","type":"address"}],"Mail":[{"name":"from","type":"Person"},{"name":"to","type":"Person"},{"name":"contents","type":"string"}]},"primaryType":"Mail","domain":{"name":"Ether Mail","version":"1","chainId":1,"verifyingContract":"0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"},"message":{"from":{"name":"Cow","wallet":"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},"to":{"name":"Bob","wallet":"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},"contents":"Hello, Bob!"}}`
+	testMailSignature   = "5ad2703f5b4f4b9dea4c28fa30d86d3781d28e09dd51aae1208de80bb6155bee2922d299a8e24c66079e7b9cf8bca9d02543952617567ba14a619bb091c2ec1f1b"
+	testPersonalMessage = "hello world"
+	testPersonalSig     = "08f4f37e2d8f74e18c1b8fde2374d5f28402fb8ab7fd1cc5b786aa40851a70cb1d9761561a39554190cad60eecd319507488fc189cfd9dc1634cb0c87cd30a251b"
+)
+
+func parseTestTypedData(t *testing.T, s string) *TypedData {
+	var td TypedData
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	assert.NoError(t, decoder.Decode(&td))
+	return &td
+}
+
+func TestHashTypedDataMail(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, err := HashTypedData(parseTestTypedData(t, testMailTypedData))
+	assert.NoError(err)
+	assert.Equal("be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", hex.EncodeToString(hash))
+
+	sig, _ := hex.DecodeString(testMailSignature)
+	signer, err := RecoverAddress(hash, sig)
+	assert.NoError(err)
+	assert.Equal(testCowAddress, strings.ToLower(signer))
+}
+
+func TestHashTypedDataDomainTypeOmitted(t *testing.T) {
+	td := parseTestTypedData(t, testMailTypedData)
+	delete(td.Types, "EIP712Domain")
+	hash, err := HashTypedData(td)
+	assert.NoError(t, err)
+	assert.Equal(t, "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", hex.EncodeToString(hash))
+}
+
+func TestHashTypedDataAtomicAndArrayTypes(t *testing.T) {
+	td := parseTestTypedData(t, `{
+		"types": {
+			"Order": [
+				{"name":"maker","type":"address"},
+				{"name":"amounts","type":"uint256[]"},
+				{"name":"delta","type":"int8"},
+				{"name":"active","type":"bool"},
+				{"name":"data","type":"bytes"},
+				{"name":"tag","type":"bytes4"}
+			]
+		},
+		"primaryType": "Order",
+		"domain": {"name":"Test","chainId":5},
+		"message": {
+			"maker": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+			"amounts": [1, "0x2"],
+			"delta": -1,
+			"active": true,
+			"data": "0x1234",
+			"tag": "0xdeadbeef"
+		}
+	}`)
+	hash, err := HashTypedData(td)
+	assert.NoError(t, err)
+	assert.Equal(t, "23f841a1413d325a9db319811e16b5c113cb3b8f2f209e19b7312680668ccf56", hex.EncodeToString(hash))
+}
+
+func TestHashTypedDataErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	td := parseTestTypedData(t, testMailTypedData)
+	td.PrimaryType = "Letter"
+	_, err := HashTypedData(td)
+	assert.EqualError(err, "Type 'Letter' is not defined in the typed data")
+
+	td = parseTestTypedData(t, testMailTypedData)
+	td.Message["to"] = "Bob"
+	_, err = HashTypedData(td)
+	assert.EqualError(err, "Value of 'message.to' is not a valid Person")
+
+	td = parseTestTypedData(t, testMailTypedData)
+	td.Message["from"].(map[string]interface{})["wallet"] = "cow"
+	_, err = HashTypedData(td)
+	assert.EqualError(err, "Value of 'message.from.wallet' is not a valid address")
+
+	td = parseTestTypedData(t, testMailTypedData)
+	td.Domain["chainId"] = json.Number("-1")
+	_, err = HashTypedData(td)
+	assert.EqualError(err, "Value of 'domain.chainId' is not a valid uint256")
+
+	td = parseTestTypedData(t, testMailTypedData)
+	td.Types["Mail"] = append(td.Types["Mail"], TypedDataField{Name: "tags", Type: "string[2]"})
+	td.Message["tags"] = []interface{}{"a"}
+	_, err = HashTypedData(td)
+	assert.EqualError(err, "Value of 'message.tags' is not a valid string[2]")
+}
+
+func TestRecoverPersonalSign(t *testing.T) {
+	assert := assert.New(t)
+
+	sig, _ := hex.DecodeString(testPersonalSig)
+	signer, err := RecoverAddress(HashPersonalMessage([]byte(testPersonalMessage)), sig)
+	assert.NoError(err)
+	assert.Equal(testCowAddress, strings.ToLower(signer))
+
+	// A recovery id of 0/1 is accepted as well as 27/28
+	sig[64] -= 27
+	signer, err = RecoverAddress(HashPersonalMessage([]byte(testPersonalMessage)), sig)
+	assert.NoError(err)
+	assert.Equal(testCowAddress, strings.ToLower(signer))
+
+	// A different message recovers a different signer
+	signer, err = RecoverAddress(HashPersonalMessage([]byte("goodbye world")), sig)
+	assert.NoError(err)
+	assert.NotEqual(testCowAddress, strings.ToLower(signer))
+}
+
+func TestRecoverAddressBadSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	hash := HashPersonalMessage([]byte(testPersonalMessage))
+	_, err := RecoverAddress(hash, []byte{0x01})
+	assert.EqualError(err, "Signature is 1 bytes. Must be 65 bytes of r, s and v")
+
+	sig, _ := hex.DecodeString(testPersonalSig)
+	sig[64] = 30
+	_, err = RecoverAddress(hash, sig)
+	assert.EqualError(err, "Invalid signature recovery id 30")
+
+	_, err = RecoverAddress(hash, make([]byte, 65))
+	assert.EqualError(err, "Signature r and s values must be between 1 and the order of the secp256k1 curve")
+}
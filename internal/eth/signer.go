@@ -3,6 +3,8 @@
 package eth
 
 import (
+	"context"
+
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 )
 
@@ -12,3 +14,9 @@ type TXSigner interface {
 	Address() string
 	Sign(tx *ethbinding.Transaction) ([]byte, error)
 }
+
+// ContextSigner is implemented by signers that call out to a remote service, so that a signing
+// request that exceeds the signing timeout is abandoned rather than left running
+type ContextSigner interface {
+	SignContext(ctx context.Context, tx *ethbinding.Transaction) ([]byte, error)
+}
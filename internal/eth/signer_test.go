@@ -3,6 +3,8 @@
 package eth
 
 import (
+	"context"
+
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 )
 
@@ -25,3 +27,14 @@ func (s *mockTXSigner) Sign(tx *ethbinding.Transaction) ([]byte, error) {
 	s.capturedTX = tx
 	return s.signed, s.signErr
 }
+
+// mockBlockedTXSigner is a remote signer whose requests never complete
+type mockBlockedTXSigner struct {
+	mockTXSigner
+}
+
+func (s *mockBlockedTXSigner) SignContext(ctx context.Context, tx *ethbinding.Transaction) ([]byte, error) {
+	s.capturedTX = tx
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
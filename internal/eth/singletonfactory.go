@@ -0,0 +1,128 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+)
+
+const (
+	// SingletonFactoryAddress is the address of the ERC-2470 singleton factory, which is the same on every chain it is deployed to
+	SingletonFactoryAddress = "0xce0042B868300000d44A59004Da54A005ffdcf9f"
+	// singletonFactoryDeploySelector is the function selector of deploy(bytes,bytes32) on the singleton factory
+	singletonFactoryDeploySelector = "0x4af63f02"
+	// singletonFactoryOverheadGas covers the execution of the factory itself, and the extra calldata to call it
+	singletonFactoryOverheadGas = 5000
+)
+
+// singletonFactoryGas returns the gas to deploy through the singleton factory, from the gas estimated
+// for a plain CREATE of the same init code. On top of the CREATE, the factory copies the init code into
+// memory and hashes it for CREATE2, and can only pass 63/64 of its remaining gas to the constructor
+func singletonFactoryGas(createGas uint64, initCodeLen int) uint64 {
+	words := uint64(initCodeLen+31) / 32
+	memory := 3*words + words*words/512
+	return createGas + createGas/63 + 3*words + 6*words + memory + singletonFactoryOverheadGas
+}
+
+// Create2Address predicts the address of a contract created with CREATE2 by a deployer, which
+// is the last 20 bytes of the keccak256 hash of 0xff, the deployer, the salt and the hash of the init code
+func Create2Address(deployer ethbinding.Address, salt [32]byte, initCode []byte) ethbinding.Address {
+	hash := ethbind.API.Keccak256([]byte{0xff}, deployer.Bytes(), salt[:], ethbind.API.Keccak256(initCode))
+	var addr ethbinding.Address
+	copy(addr[:], hash[12:])
+	return addr
+}
+
+// parseSalt parses the hex salt of a deployment through the singleton factory, which is zero when not supplied
+func parseSalt(s string) (salt [32]byte, err error) {
+	if s == "" {
+		return salt, nil
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(b) != 32 {
+		return salt, errors.Errorf(errors.DeploySingletonFactoryBadSalt, s)
+	}
+	copy(salt[:], b)
+	return salt, nil
+}
+
+// packSingletonFactoryDeploy ABI encodes a call to deploy(bytes _initCode, bytes32 _salt)
+func packSingletonFactoryDeploy(initCode []byte, salt [32]byte) []byte {
+	word := func(n uint64) []byte {
+		w := make([]byte, 32)
+		binary.BigEndian.PutUint64(w[24:], n)
+		return w
+	}
+	data := ethbind.API.FromHex(singletonFactoryDeploySelector)
+	data = append(data, word(64)...)
+	data = append(data, salt[:]...)
+	data = append(data, word(uint64(len(initCode)))...)
+	data = append(data, initCode...)
+	if pad := len(initCode) % 32; pad != 0 {
+		data = append(data, make([]byte, 32-pad)...)
+	}
+	return data
+}
+
+// NewSingletonFactoryDeployTxn builds a transaction that deploys a contract through the
+// ERC-2470 singleton factory with CREATE2, so the contract has the same address on every
+// chain for the same code, constructor arguments and salt. The address is set in the
+// FactoryDeployAddress of the transaction
+func NewSingletonFactoryDeployTxn(msg *messages.DeployContract, signer TXSigner, strictAddresses bool, compileTimeout time.Duration) (tx *Txn, err error) {
+
+	tx = &Txn{Signer: signer, StrictAddresses: strictAddresses}
+
+	salt, err := parseSalt(msg.Salt)
+	if err != nil {
+		return
+	}
+	if value, ok := parseValue(msg.Value); ok && value.Sign() != 0 {
+		err = errors.Errorf(errors.DeploySingletonFactoryValue)
+		return
+	}
+
+	initCode, err := tx.deploymentData(msg, compileTimeout)
+	if err != nil {
+		return
+	}
+
+	factory := ethbind.API.HexToAddress(SingletonFactoryAddress)
+	deployAddress := Create2Address(factory, salt, initCode)
+	tx.FactoryDeployAddress = &deployAddress
+	tx.FactoryInitCode = initCode
+
+	from := msg.From
+	if tx.Signer != nil {
+		from = tx.Signer.Address()
+	}
+
+	if err = tx.genEthTransaction(from, SingletonFactoryAddress, msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, packSingletonFactoryDeploy(initCode, salt)); err != nil {
+		return
+	}
+
+	// retain private transaction fields
+	tx.PrivateFrom = msg.PrivateFrom
+	tx.PrivateFor = msg.PrivateFor
+	tx.PrivacyGroupID = msg.PrivacyGroupID
+	return
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSingletonFactoryDeployMsg() *messages.DeployContract {
+	var msg messages.DeployContract
+	msg.Compiled = []byte{0xde, 0xad, 0xbe, 0xef}
+	msg.ABI = ethbinding.ABIMarshaling{}
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Nonce = "123"
+	msg.Value = "0"
+	msg.Gas = "456"
+	msg.GasPrice = "789"
+	msg.SingletonFactory = true
+	return &msg
+}
+
+func TestCreate2Address(t *testing.T) {
+	assert := assert.New(t)
+
+	// Examples from EIP-1014
+	var salt [32]byte
+	addr := Create2Address(ethbind.API.HexToAddress("0x0000000000000000000000000000000000000000"), salt, []byte{0x00})
+	assert.Equal("0x4D1A2e2bB4F88F0250f26Ffff098B0b30B26BF38", addr.Hex())
+
+	copy(salt[28:], []byte{0xca, 0xfe, 0xba, 0xbe})
+	addr = Create2Address(ethbind.API.HexToAddress("0x00000000000000000000000000000000deadbeef"), salt, []byte{0xde, 0xad, 0xbe, 0xef})
+	assert.Equal("0x60f3f640a8508fC6a86d45DF051962668E1e8AC7", addr.Hex())
+}
+
+func TestPackSingletonFactoryDeploy(t *testing.T) {
+	assert := assert.New(t)
+
+	var salt [32]byte
+	salt[31] = 0x2a
+	data := packSingletonFactoryDeploy([]byte{0xde, 0xad, 0xbe, 0xef}, salt)
+	assert.Equal("0x4af63f02"+
+		"0000000000000000000000000000000000000000000000000000000000000040"+
+		"000000000000000000000000000000000000000000000000000000000000002a"+
+		"0000000000000000000000000000000000000000000000000000000000000004"+
+		"deadbeef00000000000000000000000000000000000000000000000000000000",
+		ethbind.API.HexEncode(data))
+
+	data = packSingletonFactoryDeploy(make([]byte, 64), salt)
+	assert.Len(data, 4+32*3+64)
+}
+
+func TestNewSingletonFactoryDeployTxn(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	msg.Salt = "0x000000000000000000000000000000000000000000000000000000000000002a"
+	tx, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.NoError(err)
+
+	var salt [32]byte
+	salt[31] = 0x2a
+	expected := Create2Address(ethbind.API.HexToAddress(SingletonFactoryAddress), salt, msg.Compiled)
+	assert.Equal(expected, *tx.FactoryDeployAddress)
+
+	rpc := testRPCClient{}
+	tx.Send(context.Background(), &rpc)
+
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+	jsonBytesSent, _ := json.Marshal(rpc.capturedArgs[0])
+	var jsonSent map[string]interface{}
+	json.Unmarshal(jsonBytesSent, &jsonSent)
+	assert.Equal(SingletonFactoryAddress, jsonSent["to"])
+	assert.Equal("0x7b", jsonSent["nonce"])
+	assert.True(strings.HasPrefix(jsonSent["data"].(string), "0x4af63f02"))
+}
+
+func TestNewSingletonFactoryDeployTxnDefaultSalt(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	tx, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.NoError(err)
+	var salt [32]byte
+	assert.Equal(Create2Address(ethbind.API.HexToAddress(SingletonFactoryAddress), salt, msg.Compiled), *tx.FactoryDeployAddress)
+}
+
+func TestNewSingletonFactoryDeployTxnBadSalt(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	msg.Salt = "0x2a"
+	_, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.EqualError(err, "Invalid salt '0x2a' for a deployment through the singleton factory. Must be 32 bytes of hex")
+
+	msg.Salt = "not hex"
+	_, err = NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.Regexp("Invalid salt 'not hex'", err)
+}
+
+func TestNewSingletonFactoryDeployTxnValue(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	msg.Value = "1"
+	_, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.EqualError(err, "Value cannot be sent with a deployment through the singleton factory")
+}
+
+func TestNewSingletonFactoryDeployTxnHexValue(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	msg.Value = "0x10"
+	_, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.EqualError(err, "Value cannot be sent with a deployment through the singleton factory")
+
+	msg.Value = "0x0"
+	_, err = NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.NoError(err)
+}
+
+func TestSingletonFactoryGasEstimatesCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	msg.Gas = ""
+	tx, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.NoError(err)
+
+	rpc := testRPCClient{
+		resultWrangler: func(result interface{}) {
+			if gas, ok := result.(**ethbinding.HexUint64); ok {
+				**gas = 100000
+			}
+		},
+	}
+	tx.Send(context.Background(), &rpc)
+
+	// The estimate is for a plain CREATE of the init code
+	assert.Equal("eth_estimateGas", rpc.capturedMethod)
+	estimateArgs := rpc.capturedArgs[0].(*SendTXArgs)
+	assert.Empty(estimateArgs.To)
+	assert.Equal(ethbinding.HexBytes(msg.Compiled), *estimateArgs.Data)
+
+	// ... with the cost of the factory added, before the usual buffer
+	assert.Equal(uint64(106599), singletonFactoryGas(100000, len(msg.Compiled)))
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod2)
+	jsonBytesSent, _ := json.Marshal(rpc.capturedArgs2[0])
+	var jsonSent map[string]interface{}
+	json.Unmarshal(jsonBytesSent, &jsonSent)
+	assert.Equal(SingletonFactoryAddress, jsonSent["to"])
+	assert.Equal("0x1f3ae", jsonSent["gas"])
+}
+
+func TestNewSingletonFactoryDeployTxnMissingCode(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := testSingletonFactoryDeployMsg()
+	msg.Compiled = nil
+	_, err := NewSingletonFactoryDeployTxn(msg, nil, false, 0)
+	assert.EqualError(err, "Missing Compiled Code + ABI, or Solidity")
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const solcGitFetchTimeout = 2 * time.Minute
+
+var (
+	gitRefCheck    = regexp.MustCompile(`^\w[\w./-]*$`)
+	gitCommitCheck = regexp.MustCompile(`^[0-9a-f]{40}$`)
+)
+
+// solcGitLocks serializes the checkout of each cached repository and commit, so concurrent
+// deployments of the same commit fetch it once, without blocking those of any other
+var solcGitLocks = struct {
+	sync.Mutex
+	locks map[string]*solcGitLock
+}{locks: make(map[string]*solcGitLock)}
+
+type solcGitLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lockSolcGitKey locks a cache key, returning the function to unlock it
+func lockSolcGitKey(key string) func() {
+	solcGitLocks.Lock()
+	l, ok := solcGitLocks.locks[key]
+	if !ok {
+		l = &solcGitLock{}
+		solcGitLocks.locks[key] = l
+	}
+	l.refs++
+	solcGitLocks.Unlock()
+	l.Lock()
+	return func() {
+		l.Unlock()
+		solcGitLocks.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(solcGitLocks.locks, key)
+		}
+		solcGitLocks.Unlock()
+	}
+}
+
+// SolcGitConf configures the git repositories that the Solidity of a deployment can be fetched
+// from, when a DeployContract names a git URL, ref and path rather than supplying the source.
+// Only repositories on the allowed hosts are fetched. Each commit of a repository is checked out
+// into the cache directory the first time it is needed, and reused from there
+type SolcGitConf struct {
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	CacheDir     string   `json:"cacheDir,omitempty"`
+}
+
+// Validate checks the URL, ref and path of a git source, and that the host of the URL is allowed
+func (c *SolcGitConf) Validate(src *messages.GitSource) error {
+	if len(c.AllowedHosts) == 0 {
+		return errors.Errorf(errors.CompilerGitNotEnabled)
+	}
+	u, err := url.Parse(src.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "ssh") || u.Hostname() == "" {
+		return errors.Errorf(errors.CompilerGitURLInvalid, utils.StripCredentials(src.URL))
+	}
+	allowed := false
+	for _, host := range c.AllowedHosts {
+		if strings.EqualFold(host, u.Hostname()) {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return errors.Errorf(errors.CompilerGitHostNotAllowed, u.Hostname())
+	}
+	if !gitRefCheck.MatchString(src.Ref) || strings.Contains(src.Ref, "..") {
+		return errors.Errorf(errors.CompilerGitRefInvalid, src.Ref)
+	}
+	if !strings.HasSuffix(src.Path, ".sol") || filepath.IsAbs(src.Path) || strings.HasPrefix(src.Path, "-") || strings.Contains(src.Path, "..") {
+		return errors.Errorf(errors.CompilerGitPathInvalid, src.Path)
+	}
+	return nil
+}
+
+// Fetch returns the directory of a checkout of the commit a git source refers to, fetching it
+// first if it is not cached. Refs other than full commit hashes are resolved with the remote
+// each time, so a moved branch or tag is picked up. The cache is keyed by the repository as well
+// as the commit, so a commit is only ever served from a checkout of the repository it names
+func (c *SolcGitConf) Fetch(src *messages.GitSource) (dir, commit string, err error) {
+	if err = c.Validate(src); err != nil {
+		return "", "", err
+	}
+	cacheDir, err := filepath.Abs(c.CacheDir)
+	if err != nil {
+		return "", "", err
+	}
+	redactedURL := utils.StripCredentials(src.URL)
+	commit = strings.ToLower(src.Ref)
+	if !gitCommitCheck.MatchString(commit) {
+		out, err := runGit("", "ls-remote", src.URL, src.Ref, src.Ref+"^{}")
+		if err != nil {
+			return "", "", errors.Errorf(errors.CompilerGitFetchFailed, src.Ref, redactedURL, redactGitError(err, src.URL))
+		}
+		if commit = lsRemoteCommit(out, src.Ref); commit == "" {
+			return "", "", errors.Errorf(errors.CompilerGitRefNotFound, src.Ref, redactedURL)
+		}
+	}
+	// Credentials do not change the repository, so are not part of the key
+	repoHash := sha256.Sum256([]byte(redactedURL))
+	repoDir := filepath.Join(cacheDir, hex.EncodeToString(repoHash[:]))
+	dir = filepath.Join(repoDir, commit)
+
+	unlock := lockSolcGitKey(dir)
+	defer unlock()
+	if _, err := os.Stat(dir); err == nil {
+		log.Debugf("Using cached git source %s@%s: %s", redactedURL, commit, dir)
+		return dir, commit, nil
+	}
+
+	// Check out alongside the final location, so it only appears once complete
+	log.Infof("Fetching git source %s@%s (%s)", redactedURL, src.Ref, commit)
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		return "", "", errors.Errorf(errors.CompilerGitFetchFailed, commit, redactedURL, err)
+	}
+	tmpDir, err := ioutil.TempDir(repoDir, "checkout-")
+	if err != nil {
+		return "", "", errors.Errorf(errors.CompilerGitFetchFailed, commit, redactedURL, err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"fetch", "-q", "--depth", "1", src.URL, commit},
+		{"checkout", "-q", "FETCH_HEAD"},
+	} {
+		if _, err := runGit(tmpDir, args...); err != nil {
+			return "", "", errors.Errorf(errors.CompilerGitFetchFailed, commit, redactedURL, redactGitError(err, src.URL))
+		}
+	}
+	// The history is not needed to compile
+	os.RemoveAll(filepath.Join(tmpDir, ".git"))
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return "", "", errors.Errorf(errors.CompilerGitFetchFailed, commit, redactedURL, err)
+	}
+	log.Infof("Cached git source %s@%s: %s", redactedURL, commit, dir)
+	return dir, commit, nil
+}
+
+// lsRemoteCommit finds the commit of a branch or tag in the output of git ls-remote. The commit
+// an annotated tag points to is listed with a ^{} suffix, and is used rather than the tag object
+func lsRemoteCommit(out, ref string) string {
+	var commit string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[1] {
+		case "refs/tags/" + ref + "^{}":
+			return fields[0]
+		case ref, "refs/heads/" + ref, "refs/tags/" + ref:
+			if commit == "" {
+				commit = fields[0]
+			}
+		}
+	}
+	return commit
+}
+
+// redactGitError removes the credentials of a git URL from the output of a failed git command
+func redactGitError(err error, rawURL string) string {
+	return strings.ReplaceAll(err.Error(), rawURL, utils.StripCredentials(rawURL))
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), solcGitFetchTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never prompt for credentials, which would hang until the timeout
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
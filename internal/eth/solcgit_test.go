@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"io/ioutil"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	assert.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// newTestGitServer serves a repository with a v1 tag and a later commit on the default branch,
+// over the smart HTTP protocol of git http-backend
+func newTestGitServer(t *testing.T) (*httptest.Server, string, string, string) {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	root, _ := ioutil.TempDir("", "gitsrc")
+	repo := filepath.Join(root, "contracts.git")
+	os.MkdirAll(filepath.Join(repo, "contracts"), 0755)
+	testGit(t, repo, "init", "-q", "-b", "main")
+	ioutil.WriteFile(filepath.Join(repo, "contracts", "Store.sol"), []byte("contract Store { uint v; }"), 0644)
+	testGit(t, repo, "add", ".")
+	testGit(t, repo, "commit", "-q", "-m", "one")
+	testGit(t, repo, "tag", "-a", "v1", "-m", "v1")
+	v1 := testGit(t, repo, "rev-parse", "HEAD")
+	ioutil.WriteFile(filepath.Join(repo, "contracts", "Store.sol"), []byte("contract Store { uint v2; }"), 0644)
+	testGit(t, repo, "commit", "-q", "-am", "two")
+	head := testGit(t, repo, "rev-parse", "HEAD")
+
+	server := httptest.NewServer(&cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	return server, root, v1, head
+}
+
+func TestSolcGitValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &SolcGitConf{AllowedHosts: []string{"github.com"}}
+	assert.NoError(conf.Validate(&messages.GitSource{URL: "https://GitHub.com/org/repo.git", Ref: "release/v1.2", Path: "contracts/Token.sol"}))
+	assert.NoError(conf.Validate(&messages.GitSource{URL: "ssh://git@github.com/org/repo.git", Ref: "main", Path: "Token.sol"}))
+
+	err := (&SolcGitConf{}).Validate(&messages.GitSource{URL: "https://github.com/org/repo.git", Ref: "main", Path: "Token.sol"})
+	assert.Regexp("Deploying from git is not enabled", err)
+
+	for _, src := range []*messages.GitSource{
+		{URL: "git@github.com:org/repo.git", Ref: "main", Path: "Token.sol"},
+		{URL: "file:///etc/repo", Ref: "main", Path: "Token.sol"},
+		{URL: "https://", Ref: "main", Path: "Token.sol"},
+	} {
+		assert.Regexp("Invalid git URL", conf.Validate(src))
+	}
+	err = conf.Validate(&messages.GitSource{URL: "https://gitlab.com/org/repo.git", Ref: "main", Path: "Token.sol"})
+	assert.Regexp("Git host 'gitlab.com' is not allowed", err)
+	for _, ref := range []string{"", "-upload-pack=evil", "main..other", "main branch"} {
+		err = conf.Validate(&messages.GitSource{URL: "https://github.com/org/repo.git", Ref: ref, Path: "Token.sol"})
+		assert.Regexp("Invalid git ref", err)
+	}
+	for _, path := range []string{"", "Token.txt", "/etc/Token.sol", "../Token.sol", "-Token.sol"} {
+		err = conf.Validate(&messages.GitSource{URL: "https://github.com/org/repo.git", Ref: "main", Path: path})
+		assert.Regexp("Invalid path", err)
+	}
+}
+
+func TestSolcGitFetchRefs(t *testing.T) {
+	assert := assert.New(t)
+
+	server, root, v1, head := newTestGitServer(t)
+	defer os.RemoveAll(root)
+	defer server.Close()
+	cacheDir, _ := ioutil.TempDir("", "gitcache")
+	defer os.RemoveAll(cacheDir)
+
+	conf := &SolcGitConf{AllowedHosts: []string{"127.0.0.1"}, CacheDir: cacheDir}
+	url := server.URL + "/contracts.git"
+
+	dir, commit, err := conf.Fetch(&messages.GitSource{URL: url, Ref: "v1", Path: "contracts/Store.sol"})
+	assert.NoError(err)
+	assert.Equal(v1, commit)
+	assert.Equal(v1, filepath.Base(dir))
+	repoDir := filepath.Dir(dir)
+	assert.Equal(cacheDir, filepath.Dir(repoDir))
+	source, _ := ioutil.ReadFile(filepath.Join(dir, "contracts", "Store.sol"))
+	assert.Equal("contract Store { uint v; }", string(source))
+	_, err = os.Stat(filepath.Join(dir, ".git"))
+	assert.True(os.IsNotExist(err))
+
+	dir, commit, err = conf.Fetch(&messages.GitSource{URL: url, Ref: "main", Path: "contracts/Store.sol"})
+	assert.NoError(err)
+	assert.Equal(head, commit)
+	source, _ = ioutil.ReadFile(filepath.Join(dir, "contracts", "Store.sol"))
+	assert.Equal("contract Store { uint v2; }", string(source))
+
+	// A commit is served from the cache, without contacting the server, including when the URL
+	// names credentials
+	server.Close()
+	dir, commit, err = conf.Fetch(&messages.GitSource{URL: url, Ref: strings.ToUpper(v1), Path: "contracts/Store.sol"})
+	assert.NoError(err)
+	assert.Equal(v1, commit)
+	assert.Equal(filepath.Join(repoDir, v1), dir)
+	credsURL := strings.Replace(url, "http://", "http://user:secret@", 1)
+	dir, _, err = conf.Fetch(&messages.GitSource{URL: credsURL, Ref: v1, Path: "contracts/Store.sol"})
+	assert.NoError(err)
+	assert.Equal(filepath.Join(repoDir, v1), dir)
+
+	// The same commit is not served from the cache of another repository
+	_, _, err = conf.Fetch(&messages.GitSource{URL: strings.Replace(credsURL, "contracts.git", "other.git", 1), Ref: v1, Path: "contracts/Store.sol"})
+	assert.Regexp("Failed to fetch", err)
+	assert.NotContains(err.Error(), "secret")
+}
+
+func TestSolcGitFetchErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	server, root, _, _ := newTestGitServer(t)
+	defer os.RemoveAll(root)
+	defer server.Close()
+	cacheDir, _ := ioutil.TempDir("", "gitcache")
+	defer os.RemoveAll(cacheDir)
+
+	conf := &SolcGitConf{AllowedHosts: []string{"127.0.0.1"}, CacheDir: cacheDir}
+
+	_, _, err := conf.Fetch(&messages.GitSource{URL: server.URL + "/contracts.git", Ref: "v2", Path: "contracts/Store.sol"})
+	assert.Regexp("Git ref 'v2' was not found", err)
+
+	_, _, err = conf.Fetch(&messages.GitSource{URL: server.URL + "/missing.git", Ref: "main", Path: "contracts/Store.sol"})
+	assert.Regexp("Failed to fetch main", err)
+
+	_, _, err = conf.Fetch(&messages.GitSource{URL: server.URL + "/contracts.git", Ref: strings.Repeat("a", 40), Path: "contracts/Store.sol"})
+	assert.Regexp("Failed to fetch a{40}", err)
+	files, _ := ioutil.ReadDir(cacheDir)
+	for _, repoDir := range files {
+		checkouts, _ := ioutil.ReadDir(filepath.Join(cacheDir, repoDir.Name()))
+		assert.Empty(checkouts)
+	}
+
+	_, _, err = conf.Fetch(&messages.GitSource{URL: "https://gitlab.com/org/repo.git", Ref: "main", Path: "Token.sol"})
+	assert.Regexp("not allowed", err)
+}
+
+func TestLsRemoteCommit(t *testing.T) {
+	assert := assert.New(t)
+	out := "1111111111111111111111111111111111111111\trefs/heads/v1\n" +
+		"2222222222222222222222222222222222222222\trefs/tags/v1\n" +
+		"3333333333333333333333333333333333333333\trefs/tags/v1^{}\n"
+	assert.Equal("3333333333333333333333333333333333333333", lsRemoteCommit(out, "v1"))
+	assert.Equal("1111111111111111111111111111111111111111", lsRemoteCommit(strings.Split(out, "\n")[0], "v1"))
+	assert.Equal("", lsRemoteCommit("garbage", "v1"))
+}
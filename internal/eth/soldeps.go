@@ -0,0 +1,313 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultNPMRegistry is the registry npm package tarballs are fetched from
+	DefaultNPMRegistry = "https://registry.npmjs.org"
+	// DefaultGitHubArchiveURL is the URL GitHub repository archives are fetched from
+	DefaultGitHubArchiveURL = "https://codeload.github.com"
+	// DefaultSolcDependencyMaxSize is the largest archive that will be downloaded for a dependency
+	DefaultSolcDependencyMaxSize = 50 * 1024 * 1024
+	solcDependencyFetchTimeout   = 2 * time.Minute
+)
+
+// SolcDependenciesConf configures the packages that can be fetched from npm or GitHub, when
+// uploaded Solidity imports them. Only the listed import prefixes are fetched, and each is
+// pinned to the sha256 checksum of its archive. Archives are extracted into the cache
+// directory the first time they are needed, and reused from there
+type SolcDependenciesConf struct {
+	CacheDir    string           `json:"cacheDir,omitempty"`
+	NPMRegistry string           `json:"npmRegistry,omitempty"`
+	GitHubURL   string           `json:"githubURL,omitempty"`
+	MaxSize     int64            `json:"maxSize,omitempty"`
+	Packages    []SolcDependency `json:"packages,omitempty"`
+}
+
+// SolcDependency is an import prefix, such as @openzeppelin/contracts/, and the npm package
+// (name@version) or GitHub repository (owner/repo@ref) it is fetched from. Path is an optional
+// directory within the archive that the prefix maps to
+type SolcDependency struct {
+	Prefix string `json:"prefix"`
+	NPM    string `json:"npm,omitempty"`
+	GitHub string `json:"github,omitempty"`
+	Path   string `json:"path,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+var (
+	npmPackageCheck  = regexp.MustCompile(`^(@[a-z0-9][\w.-]*/)?[a-z0-9][\w.-]*@[\w.+-]+$`)
+	githubRepoCheck  = regexp.MustCompile(`^[\w.-]+/[\w.-]+@[\w./-]+$`)
+	sha256Check      = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	solcDependencyMu sync.Mutex
+)
+
+// Validate checks each package has a prefix, exactly one valid source, and a pinned checksum
+func (c *SolcDependenciesConf) Validate() error {
+	for _, p := range c.Packages {
+		valid := p.Prefix != "" && !strings.ContainsAny(p.Prefix, ":=") &&
+			sha256Check.MatchString(strings.ToLower(p.SHA256)) &&
+			!strings.Contains(p.Path, "..")
+		switch {
+		case p.NPM != "" && p.GitHub == "":
+			valid = valid && npmPackageCheck.MatchString(p.NPM)
+		case p.GitHub != "" && p.NPM == "":
+			valid = valid && githubRepoCheck.MatchString(p.GitHub)
+		default:
+			valid = false
+		}
+		if !valid {
+			return errors.Errorf(errors.CompilerDependencyInvalid, p.Prefix)
+		}
+	}
+	return nil
+}
+
+// Resolve finds the configured packages imported by the Solidity source in a directory, fetching
+// any that are not yet cached, and returns the remappings that point their prefixes at the cache
+func (c *SolcDependenciesConf) Resolve(dir string) ([]string, error) {
+	if len(c.Packages) == 0 {
+		return nil, nil
+	}
+	imported, err := importedSolcDependencies(dir, c.Packages)
+	if err != nil {
+		return nil, err
+	}
+	remappings := []string{}
+	for _, p := range imported {
+		pkgDir, err := c.fetch(p)
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(pkgDir, filepath.FromSlash(p.Path))
+		if strings.HasSuffix(p.Prefix, "/") {
+			target += string(filepath.Separator)
+		}
+		remappings = append(remappings, p.Prefix+"="+target)
+	}
+	return remappings, nil
+}
+
+func importedSolcDependencies(dir string, packages []SolcDependency) ([]SolcDependency, error) {
+	imported := []SolcDependency{}
+	found := make(map[int]bool)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".sol") {
+			return err
+		}
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for i, p := range packages {
+			if !found[i] && (bytes.Contains(source, []byte(`"`+p.Prefix)) || bytes.Contains(source, []byte(`'`+p.Prefix))) {
+				found[i] = true
+				imported = append(imported, p)
+			}
+		}
+		return nil
+	})
+	return imported, err
+}
+
+func (p *SolcDependency) name() string {
+	if p.NPM != "" {
+		return "npm:" + p.NPM
+	}
+	return "github:" + p.GitHub
+}
+
+func (c *SolcDependenciesConf) archiveURL(p *SolcDependency) string {
+	if p.NPM != "" {
+		registry := c.NPMRegistry
+		if registry == "" {
+			registry = DefaultNPMRegistry
+		}
+		split := strings.LastIndex(p.NPM, "@")
+		pkg, version := p.NPM[0:split], p.NPM[split+1:]
+		basename := pkg[strings.LastIndex(pkg, "/")+1:]
+		return fmt.Sprintf("%s/%s/-/%s-%s.tgz", strings.TrimSuffix(registry, "/"), pkg, basename, version)
+	}
+	githubURL := c.GitHubURL
+	if githubURL == "" {
+		githubURL = DefaultGitHubArchiveURL
+	}
+	split := strings.Index(p.GitHub, "@")
+	return fmt.Sprintf("%s/%s/tar.gz/%s", strings.TrimSuffix(githubURL, "/"), p.GitHub[0:split], p.GitHub[split+1:])
+}
+
+// fetch returns the cache directory for a package, downloading and extracting it first if required.
+// The archive is checked against the pinned checksum before anything is extracted. The download
+// and extraction happen outside the lock, so a slow registry does not block other compilations,
+// and only moving the extracted package into the cache is serialized
+func (c *SolcDependenciesConf) fetch(p SolcDependency) (string, error) {
+	cacheDir, err := filepath.Abs(c.CacheDir)
+	if err != nil {
+		return "", err
+	}
+	checksum := strings.ToLower(p.SHA256)
+	pkgDir := filepath.Join(cacheDir, checksum)
+
+	solcDependencyMu.Lock()
+	_, err = os.Stat(pkgDir)
+	solcDependencyMu.Unlock()
+	if err == nil {
+		log.Debugf("Using cached Solidity dependency %s: %s", p.name(), pkgDir)
+		return pkgDir, nil
+	}
+
+	url := c.archiveURL(&p)
+	log.Infof("Fetching Solidity dependency %s from %s", p.name(), url)
+	archive, err := c.download(url)
+	if err != nil {
+		return "", errors.Errorf(errors.CompilerDependencyFetchFailed, p.name(), err)
+	}
+	hash := sha256.Sum256(archive)
+	if actual := hex.EncodeToString(hash[:]); actual != checksum {
+		return "", errors.Errorf(errors.CompilerDependencyChecksum, p.name(), actual, checksum)
+	}
+
+	// Extract alongside the final location, so it only appears once complete
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", errors.Errorf(errors.CompilerDependencyExtractFailed, p.name(), err)
+	}
+	tmpDir, err := ioutil.TempDir(cacheDir, "extract-")
+	if err != nil {
+		return "", errors.Errorf(errors.CompilerDependencyExtractFailed, p.name(), err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := extractTarGz(archive, tmpDir); err != nil {
+		return "", errors.Errorf(errors.CompilerDependencyExtractFailed, p.name(), err)
+	}
+	solcDependencyMu.Lock()
+	defer solcDependencyMu.Unlock()
+	if _, err := os.Stat(pkgDir); err == nil {
+		// Another compilation fetched the same package while we were downloading it
+		log.Debugf("Using cached Solidity dependency %s: %s", p.name(), pkgDir)
+		return pkgDir, nil
+	}
+	if err := os.Rename(tmpDir, pkgDir); err != nil {
+		return "", errors.Errorf(errors.CompilerDependencyExtractFailed, p.name(), err)
+	}
+	log.Infof("Cached Solidity dependency %s: %s", p.name(), pkgDir)
+	return pkgDir, nil
+}
+
+func (c *SolcDependenciesConf) download(url string) ([]byte, error) {
+	maxSize := c.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultSolcDependencyMaxSize
+	}
+	client := &http.Client{
+		Timeout: solcDependencyFetchTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+		},
+	}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("[%d] %s", res.StatusCode, res.Status)
+	}
+	archive, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(archive)) > maxSize {
+		return nil, fmt.Errorf("exceeds the maximum size of %d bytes", maxSize)
+	}
+	return archive, nil
+}
+
+// extractTarGz writes the files in a gzipped tarball to a directory. The top-level directory
+// of the archive is removed, as both npm (package/) and GitHub (repo-ref/) wrap the contents in one
+func extractTarGz(archive []byte, dir string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(hdr.Name)
+		if slash := strings.Index(name, "/"); slash >= 0 {
+			name = name[slash+1:]
+		} else {
+			continue
+		}
+		if name == "" {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path '%s'", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeTarFile(tr, target)
+		default:
+			// Links and other special files are not needed to compile Solidity
+			log.Debugf("Skipping '%s' in Solidity dependency archive", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeTarFile(r io.Reader, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, r)
+	return err
+}
@@ -0,0 +1,262 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testTarGz(files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func testChecksum(b []byte) string {
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
+
+func newTestDependencyServer(archive []byte) (*httptest.Server, *[]string) {
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		res.Write(archive)
+	}))
+	return server, &paths
+}
+
+func TestSolcDependenciesValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	checksum := strings.Repeat("a", 64)
+	conf := &SolcDependenciesConf{Packages: []SolcDependency{
+		{Prefix: "@openzeppelin/contracts/", NPM: "@openzeppelin/contracts@4.3.2", SHA256: checksum},
+		{Prefix: "solmate/", GitHub: "transmissions11/solmate@v6", Path: "src", SHA256: checksum},
+	}}
+	assert.NoError(conf.Validate())
+
+	for _, p := range []SolcDependency{
+		{Prefix: "", NPM: "pkg@1.0.0", SHA256: checksum},
+		{Prefix: "pkg/", NPM: "pkg", SHA256: checksum},
+		{Prefix: "pkg/", GitHub: "owner@v1", SHA256: checksum},
+		{Prefix: "pkg/", NPM: "pkg@1.0.0", GitHub: "owner/repo@v1", SHA256: checksum},
+		{Prefix: "pkg/", NPM: "pkg@1.0.0"},
+		{Prefix: "pkg/", NPM: "pkg@1.0.0", Path: "../..", SHA256: checksum},
+		{Prefix: "pkg=/", NPM: "pkg@1.0.0", SHA256: checksum},
+	} {
+		conf := &SolcDependenciesConf{Packages: []SolcDependency{p}}
+		assert.Regexp("Invalid Solidity dependency", conf.Validate())
+	}
+}
+
+func TestSolcDependenciesArchiveURL(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &SolcDependenciesConf{}
+	assert.Equal("https://registry.npmjs.org/@openzeppelin/contracts/-/contracts-4.3.2.tgz",
+		conf.archiveURL(&SolcDependency{NPM: "@openzeppelin/contracts@4.3.2"}))
+	assert.Equal("https://registry.npmjs.org/ds-test/-/ds-test-1.0.0.tgz",
+		conf.archiveURL(&SolcDependency{NPM: "ds-test@1.0.0"}))
+	assert.Equal("https://codeload.github.com/transmissions11/solmate/tar.gz/v6",
+		conf.archiveURL(&SolcDependency{GitHub: "transmissions11/solmate@v6"}))
+}
+
+func TestSolcDependenciesResolveAndCache(t *testing.T) {
+	assert := assert.New(t)
+
+	archive := testTarGz(map[string]string{
+		"package/token/ERC20/ERC20.sol": "contract ERC20 {}",
+	})
+	server, paths := newTestDependencyServer(archive)
+	defer server.Close()
+
+	srcDir, _ := ioutil.TempDir("", "soldeps")
+	defer os.RemoveAll(srcDir)
+	cacheDir := filepath.Join(srcDir, "cache")
+	ioutil.WriteFile(filepath.Join(srcDir, "token.sol"), []byte(`import "@openzeppelin/contracts/token/ERC20/ERC20.sol";`), 0644)
+
+	conf := &SolcDependenciesConf{
+		CacheDir:    cacheDir,
+		NPMRegistry: server.URL,
+		Packages: []SolcDependency{
+			{Prefix: "@openzeppelin/contracts/", NPM: "@openzeppelin/contracts@4.3.2", SHA256: testChecksum(archive)},
+			{Prefix: "unused/", NPM: "unused@1.0.0", SHA256: strings.Repeat("a", 64)},
+		},
+	}
+	remappings, err := conf.Resolve(srcDir)
+	assert.NoError(err)
+	pkgDir := filepath.Join(cacheDir, testChecksum(archive))
+	assert.Equal([]string{"@openzeppelin/contracts/=" + pkgDir + string(filepath.Separator)}, remappings)
+	assert.Equal([]string{"/@openzeppelin/contracts/-/contracts-4.3.2.tgz"}, *paths)
+	content, err := ioutil.ReadFile(filepath.Join(pkgDir, "token", "ERC20", "ERC20.sol"))
+	assert.NoError(err)
+	assert.Equal("contract ERC20 {}", string(content))
+
+	// The second compile uses the cache
+	_, err = conf.Resolve(srcDir)
+	assert.NoError(err)
+	assert.Len(*paths, 1)
+}
+
+func TestSolcDependenciesCachedWhileDownloading(t *testing.T) {
+	assert := assert.New(t)
+
+	archive := testTarGz(map[string]string{"package/lib.sol": "contract Lib {}"})
+	requested := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		close(requested)
+		<-release
+		res.Write(archive)
+	}))
+	defer server.Close()
+
+	cacheDir, _ := ioutil.TempDir("", "soldeps")
+	defer os.RemoveAll(cacheDir)
+	cached := strings.Repeat("a", 64)
+	os.MkdirAll(filepath.Join(cacheDir, cached), 0755)
+	conf := &SolcDependenciesConf{CacheDir: cacheDir, NPMRegistry: server.URL}
+
+	fetched := make(chan error)
+	go func() {
+		_, err := conf.fetch(SolcDependency{NPM: "slow@1.0.0", SHA256: testChecksum(archive)})
+		fetched <- err
+	}()
+
+	// A cached package is returned while the other is still downloading
+	<-requested
+	pkgDir, err := conf.fetch(SolcDependency{NPM: "cached@1.0.0", SHA256: cached})
+	assert.NoError(err)
+	assert.Equal(filepath.Join(cacheDir, cached), pkgDir)
+
+	close(release)
+	assert.NoError(<-fetched)
+	_, err = os.Stat(filepath.Join(cacheDir, testChecksum(archive), "lib.sol"))
+	assert.NoError(err)
+}
+
+func TestSolcDependenciesResolveNoPackages(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &SolcDependenciesConf{}
+	remappings, err := conf.Resolve("/does/not/exist")
+	assert.NoError(err)
+	assert.Empty(remappings)
+}
+
+func TestSolcDependenciesChecksumMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	archive := testTarGz(map[string]string{"solmate-6/src/Owned.sol": "contract Owned {}"})
+	server, _ := newTestDependencyServer(archive)
+	defer server.Close()
+
+	srcDir, _ := ioutil.TempDir("", "soldeps")
+	defer os.RemoveAll(srcDir)
+	ioutil.WriteFile(filepath.Join(srcDir, "owned.sol"), []byte(`import {Owned} from 'solmate/Owned.sol';`), 0644)
+
+	conf := &SolcDependenciesConf{
+		CacheDir:  filepath.Join(srcDir, "cache"),
+		GitHubURL: server.URL,
+		Packages: []SolcDependency{
+			{Prefix: "solmate/", GitHub: "transmissions11/solmate@v6", Path: "src", SHA256: strings.Repeat("a", 64)},
+		},
+	}
+	_, err := conf.Resolve(srcDir)
+	assert.Regexp("Checksum of Solidity dependency github:transmissions11/solmate@v6 was", err)
+	_, err = os.Stat(filepath.Join(srcDir, "cache", strings.Repeat("a", 64)))
+	assert.True(os.IsNotExist(err))
+
+	conf.Packages[0].SHA256 = testChecksum(archive)
+	remappings, err := conf.Resolve(srcDir)
+	assert.NoError(err)
+	assert.Equal([]string{"solmate/=" + filepath.Join(srcDir, "cache", testChecksum(archive), "src") + string(filepath.Separator)}, remappings)
+}
+
+func TestSolcDependenciesFetchFail(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(404)
+	}))
+	defer server.Close()
+
+	srcDir, _ := ioutil.TempDir("", "soldeps")
+	defer os.RemoveAll(srcDir)
+	ioutil.WriteFile(filepath.Join(srcDir, "a.sol"), []byte(`import "pkg/A.sol";`), 0644)
+
+	conf := &SolcDependenciesConf{
+		CacheDir:    filepath.Join(srcDir, "cache"),
+		NPMRegistry: server.URL,
+		Packages:    []SolcDependency{{Prefix: "pkg/", NPM: "pkg@1.0.0", SHA256: strings.Repeat("a", 64)}},
+	}
+	_, err := conf.Resolve(srcDir)
+	assert.Regexp("Failed to fetch Solidity dependency npm:pkg@1.0.0: \\[404\\]", err)
+}
+
+func TestSolcDependenciesTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	archive := testTarGz(map[string]string{"package/A.sol": strings.Repeat("x", 1000)})
+	server, _ := newTestDependencyServer(archive)
+	defer server.Close()
+
+	srcDir, _ := ioutil.TempDir("", "soldeps")
+	defer os.RemoveAll(srcDir)
+	ioutil.WriteFile(filepath.Join(srcDir, "a.sol"), []byte(`import "pkg/A.sol";`), 0644)
+
+	conf := &SolcDependenciesConf{
+		CacheDir:    filepath.Join(srcDir, "cache"),
+		NPMRegistry: server.URL,
+		MaxSize:     10,
+		Packages:    []SolcDependency{{Prefix: "pkg/", NPM: "pkg@1.0.0", SHA256: testChecksum(archive)}},
+	}
+	_, err := conf.Resolve(srcDir)
+	assert.Regexp("exceeds the maximum size of 10 bytes", err)
+}
+
+func TestExtractTarGzBadArchive(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "soldeps")
+	defer os.RemoveAll(dir)
+
+	err := extractTarGz([]byte("not gzip"), dir)
+	assert.Error(err)
+
+	err = extractTarGz(testTarGz(map[string]string{"package/../../escape.sol": "x"}), dir)
+	assert.Regexp("invalid path", err)
+}
@@ -0,0 +1,140 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+// quorumPrivateV is added to the recovery ID of the signature of a Quorum private transaction,
+// in place of the 27 of a homestead transaction, to mark it as private
+const quorumPrivateV = 37
+
+// PrivatePayloadStore stores the private payload of a transaction with the privacy manager,
+// such as the third-party storeraw API of Tessera, returning the hash to submit in its place
+type PrivatePayloadStore interface {
+	StoreRaw(payload []byte, privateFrom string) ([]byte, error)
+}
+
+// PrivateTXSigner is implemented by signers that can sign Quorum private transactions
+type PrivateTXSigner interface {
+	SignPrivate(tx *ethbinding.Transaction) ([]byte, error)
+}
+
+// SignQuorumPrivateTX signs a transaction, whose data is the hash of a payload stored with the
+// privacy manager, in the form Quorum expects for eth_sendRawPrivateTransaction. The signature
+// is over the homestead hash of the transaction, with a V of 37 or 38 rather than 27 or 28
+func SignQuorumPrivateTX(tx *ethbinding.Transaction, key *ecdsa.PrivateKey) ([]byte, error) {
+	fields := [][]byte{
+		rlpEncodeUint(new(big.Int).SetUint64(tx.Nonce())),
+		rlpEncodeUint(tx.GasPrice()),
+		rlpEncodeUint(new(big.Int).SetUint64(tx.Gas())),
+		rlpEncodeBytes(nil),
+		rlpEncodeUint(tx.Value()),
+		rlpEncodeBytes(tx.Data()),
+	}
+	if to := tx.To(); to != nil {
+		fields[3] = rlpEncodeBytes(to.Bytes())
+	}
+	hash := ethbind.API.Keccak256(rlpEncodeList(fields...))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash)
+	if err != nil {
+		return nil, errors.Errorf(errors.TransactionSendPrivateSignFailed, err)
+	}
+	sig, ok := recoverableSignature(hash, r, s, ethbind.API.PubkeyToAddress(key.PublicKey).Hex())
+	if !ok {
+		return nil, errors.Errorf(errors.TransactionSendPrivateSignFailed, "signature does not recover to the key")
+	}
+	v := big.NewInt(int64(sig[64]) + quorumPrivateV)
+	fields = append(fields,
+		rlpEncodeUint(v),
+		rlpEncodeUint(new(big.Int).SetBytes(sig[0:32])),
+		rlpEncodeUint(new(big.Int).SetBytes(sig[32:64])),
+	)
+	return rlpEncodeList(fields...), nil
+}
+
+func rlpEncodeLength(length int, offset byte) []byte {
+	if length <= 55 {
+		return []byte{offset + byte(length)}
+	}
+	lengthBytes := new(big.Int).SetInt64(int64(length)).Bytes()
+	return append([]byte{offset + 55 + byte(len(lengthBytes))}, lengthBytes...)
+}
+
+func rlpEncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	return append(rlpEncodeLength(len(b), 0x80), b...)
+}
+
+// rlpEncodeUint encodes an integer as its minimal big-endian bytes, with zero as an empty string
+func rlpEncodeUint(i *big.Int) []byte {
+	if i == nil {
+		return rlpEncodeBytes(nil)
+	}
+	return rlpEncodeBytes(i.Bytes())
+}
+
+func rlpEncodeList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpEncodeLength(len(payload), 0xc0), payload...)
+}
+
+// submitStoreRawTX sends a Quorum private transaction for a node that does not accept privateFor
+// on eth_sendTransaction. The payload is stored with the privacy manager, and the transaction
+// is signed here with the returned hash as its data, then submitted with eth_sendRawPrivateTransaction
+func (tx *Txn) submitStoreRawTX(ctx context.Context, rpc RPCClient) (string, error) {
+	privateSigner, ok := tx.Signer.(PrivateTXSigner)
+	if !ok {
+		return "", errors.Errorf(errors.TransactionSendStoreRawRequiresSigner)
+	}
+	payloadHash, err := tx.PrivatePayloadStore.StoreRaw(tx.EthTX.Data(), tx.PrivateFrom)
+	if err != nil {
+		return "", err
+	}
+	if to := tx.EthTX.To(); to != nil {
+		tx.EthTX = ethbind.API.NewTransaction(tx.EthTX.Nonce(), *to, tx.EthTX.Value(), tx.EthTX.Gas(), tx.EthTX.GasPrice(), payloadHash)
+	} else {
+		tx.EthTX = ethbind.API.NewContractCreation(tx.EthTX.Nonce(), tx.EthTX.Value(), tx.EthTX.Gas(), tx.EthTX.GasPrice(), payloadHash)
+	}
+	// Private transactions are only signed with local keys, so there is no signing timeout
+	signStart := time.Now()
+	signed, err := privateSigner.SignPrivate(tx.EthTX)
+	tx.StageTimes.Sign = time.Since(signStart).Seconds()
+	if err != nil {
+		return "", err
+	}
+	if tx.Signed != nil {
+		tx.Signed()
+	}
+	var txHash string
+	err = tx.submit(ctx, rpc, &txHash, "eth_sendRawPrivateTransaction", ethbind.API.HexEncode(signed), map[string]interface{}{
+		"privateFor": tx.PrivateFor,
+	})
+	return txHash, err
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eth
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPayloadStore struct {
+	hash            []byte
+	err             error
+	capturedPayload []byte
+	capturedFrom    string
+}
+
+func (m *mockPayloadStore) StoreRaw(payload []byte, privateFrom string) ([]byte, error) {
+	m.capturedPayload = payload
+	m.capturedFrom = privateFrom
+	return m.hash, m.err
+}
+
+type mockPrivateTXSigner struct {
+	mockTXSigner
+	capturedPrivateTX *ethbinding.Transaction
+}
+
+func (s *mockPrivateTXSigner) SignPrivate(tx *ethbinding.Transaction) ([]byte, error) {
+	s.capturedPrivateTX = tx
+	return s.signed, s.signErr
+}
+
+// rlpDecodeStrings decodes a list of strings, which is all a signed legacy transaction holds
+func rlpDecodeStrings(t *testing.T, b []byte) [][]byte {
+	readLength := func(b []byte, offset byte) (int, []byte) {
+		if b[0]-offset <= 55 {
+			return int(b[0] - offset), b[1:]
+		}
+		lenLen := int(b[0] - offset - 55)
+		return int(new(big.Int).SetBytes(b[1 : 1+lenLen]).Int64()), b[1+lenLen:]
+	}
+	assert.True(t, b[0] >= 0xc0)
+	length, payload := readLength(b, 0xc0)
+	assert.Len(t, payload, length)
+	var items [][]byte
+	for len(payload) > 0 {
+		if payload[0] < 0x80 {
+			items = append(items, payload[0:1])
+			payload = payload[1:]
+			continue
+		}
+		length, payload = readLength(payload, 0x80)
+		items = append(items, payload[0:length])
+		payload = payload[length:]
+	}
+	return items
+}
+
+func TestRLPEncoding(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("83646f67", ethbind.API.HexEncode(rlpEncodeBytes([]byte("dog")))[2:])
+	assert.Equal("80", ethbind.API.HexEncode(rlpEncodeBytes(nil))[2:])
+	assert.Equal("0f", ethbind.API.HexEncode(rlpEncodeUint(big.NewInt(15)))[2:])
+	assert.Equal("80", ethbind.API.HexEncode(rlpEncodeUint(big.NewInt(0)))[2:])
+	assert.Equal("820400", ethbind.API.HexEncode(rlpEncodeUint(big.NewInt(1024)))[2:])
+	assert.Equal("c88363617483646f67", ethbind.API.HexEncode(rlpEncodeList(rlpEncodeBytes([]byte("cat")), rlpEncodeBytes([]byte("dog"))))[2:])
+	long := []byte(strings.Repeat("a", 56))
+	assert.Equal("b838"+strings.Repeat("61", 56), ethbind.API.HexEncode(rlpEncodeBytes(long))[2:])
+}
+
+func TestSignQuorumPrivateTX(t *testing.T) {
+	assert := assert.New(t)
+
+	key, _ := ethbind.API.GenerateKey()
+	to := ethbind.API.HexToAddress("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832")
+	hash := []byte(strings.Repeat("h", 64))
+	tx := ethbind.API.NewTransaction(12, to, big.NewInt(0), 100000, big.NewInt(0), hash)
+
+	signed, err := SignQuorumPrivateTX(tx, key)
+	assert.NoError(err)
+	fields := rlpDecodeStrings(t, signed)
+	assert.Len(fields, 9)
+	assert.Equal([]byte{12}, fields[0])
+	assert.Equal(to.Bytes(), fields[3])
+	assert.Equal(hash, fields[5])
+	v := fields[6][0]
+	assert.True(v == 37 || v == 38)
+
+	// The signature is over the homestead hash of the unsigned fields
+	unsigned := make([][]byte, 6)
+	for i := range unsigned {
+		unsigned[i] = rlpEncodeBytes(fields[i])
+	}
+	sig := make([]byte, 65)
+	copy(sig[32-len(fields[7]):32], fields[7])
+	copy(sig[64-len(fields[8]):64], fields[8])
+	sig[64] = v - 10
+	addr, err := RecoverAddress(ethbind.API.Keccak256(rlpEncodeList(unsigned...)), sig)
+	assert.NoError(err)
+	assert.Equal(strings.ToLower(ethbind.API.PubkeyToAddress(key.PublicKey).Hex()), strings.ToLower(addr))
+}
+
+func newStoreRawTestTxn(t *testing.T, signer TXSigner) *Txn {
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "hd-u0abcd1234-u0bcde9876-12345"
+	msg.Value = "0"
+	msg.Gas = "456"
+	msg.GasPrice = "0"
+	msg.PrivateFrom = "sender="
+	msg.PrivateFor = []string{"recipient="}
+	tx, err := NewSendTxn(&msg, signer, false)
+	assert.NoError(t, err)
+	return tx
+}
+
+func TestSendStoreRawOK(t *testing.T) {
+	assert := assert.New(t)
+
+	signer := &mockPrivateTXSigner{
+		mockTXSigner: mockTXSigner{
+			signed: []byte("testbytes"),
+			from:   "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+		},
+	}
+	tx := newStoreRawTestTxn(t, signer)
+	payload := tx.EthTX.Data()
+	store := &mockPayloadStore{hash: []byte("payloadhash")}
+	tx.PrivatePayloadStore = store
+
+	rpc := testRPCClient{}
+	err := tx.Send(context.Background(), &rpc)
+	assert.NoError(err)
+	assert.Equal(payload, store.capturedPayload)
+	assert.Equal("sender=", store.capturedFrom)
+	assert.Equal([]byte("payloadhash"), signer.capturedPrivateTX.Data())
+	assert.Equal(uint64(456), signer.capturedPrivateTX.Gas())
+	assert.Nil(signer.capturedTX)
+	assert.Equal("eth_sendRawPrivateTransaction", rpc.capturedMethod)
+	assert.Equal("0x746573746279746573", rpc.capturedArgs[0])
+	assert.Equal(map[string]interface{}{"privateFor": []string{"recipient="}}, rpc.capturedArgs[1])
+}
+
+func TestSendStoreRawNoPrivateSigner(t *testing.T) {
+	tx := newStoreRawTestTxn(t, &mockTXSigner{from: "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"})
+	tx.PrivatePayloadStore = &mockPayloadStore{}
+	err := tx.Send(context.Background(), &testRPCClient{})
+	assert.Regexp(t, "Private transactions sent with storeraw must be signed by a HD wallet signer", err)
+}
+
+func TestSendStoreRawFail(t *testing.T) {
+	signer := &mockPrivateTXSigner{
+		mockTXSigner: mockTXSigner{from: "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"},
+	}
+	tx := newStoreRawTestTxn(t, signer)
+	tx.PrivatePayloadStore = &mockPayloadStore{err: fmt.Errorf("pop")}
+	rpc := testRPCClient{}
+	err := tx.Send(context.Background(), &rpc)
+	assert.EqualError(t, err, "pop")
+	assert.Empty(t, rpc.capturedMethod)
+}
@@ -15,7 +15,9 @@
 package eth
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -24,6 +26,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/errors"
@@ -34,6 +37,37 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// isValidAddressChecksum checks a mixed-case address against its EIP-55 checksum.
+// All-lowercase and all-uppercase addresses are always accepted, as they carry no checksum.
+func isValidAddressChecksum(addr string) bool {
+	hexStr := strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+	if hexStr == strings.ToLower(hexStr) || hexStr == strings.ToUpper(hexStr) {
+		return true
+	}
+	return ethbind.API.HexToAddress(hexStr).Hex() == "0x"+hexStr
+}
+
+// Base64BytesPrefix marks a bytes parameter supplied as base64, rather than hex
+const Base64BytesPrefix = "base64:"
+
+// DecodeBytesString decodes the string value of a bytes parameter. Values are hex, with an optional
+// 0x prefix, unless they start with Base64BytesPrefix. Both the standard and URL safe base64
+// alphabets are accepted, with or without padding
+func DecodeBytesString(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, Base64BytesPrefix) {
+		return ethbind.API.FromHex(s), nil
+	}
+	b64 := strings.TrimPrefix(s, Base64BytesPrefix)
+	var err error
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var b []byte
+		if b, err = enc.DecodeString(b64); err == nil {
+			return b, nil
+		}
+	}
+	return nil, err
+}
+
 // Txn wraps an ethereum transaction, along with the logic to send it over
 // JSON/RPC to a node
 type Txn struct {
@@ -47,6 +81,59 @@ type Txn struct {
 	PrivateFor       []string
 	PrivacyGroupID   string
 	Signer           TXSigner
+	// PrivatePayloadStore, if set, stores the payload of Quorum private transactions before they are signed
+	PrivatePayloadStore PrivatePayloadStore
+	StrictAddresses     bool
+	MaxGas              uint64 // the gas limit of the transaction cannot exceed this, when non-zero
+	// EIP-4844 fields, set when the transaction carries blobs
+	BlobVersionedHashes []string
+	MaxFeePerBlobGas    *big.Int
+	// Signed is called, if set, once the transaction has been signed by the Signer and before it is submitted
+	Signed func()
+	// Approve is called, if set, once the gas limit of the transaction is known and before it is signed.
+	// An error prevents the transaction being submitted
+	Approve func() error
+	// Timeouts limit each stage of sending the transaction
+	Timeouts TxnTimeouts
+	// StageTimes records how long each stage of processing the transaction took
+	StageTimes messages.TransactionStageTimes
+	// ABI of the contract being deployed, used to decode the events emitted by its constructor
+	ABI ethbinding.ABIMarshaling
+	// FactoryDeployAddress is the address a contract deployed through the singleton factory is created at
+	FactoryDeployAddress *ethbinding.Address
+	// FactoryInitCode is the init code passed to the singleton factory, used to estimate the gas to create the contract
+	FactoryInitCode []byte
+}
+
+// parseValue parses the value of a transaction in decimal, or hex with a 0x prefix
+func parseValue(v json.Number) (*big.Int, bool) {
+	s := v.String()
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return new(big.Int).SetString(s[2:], 16)
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+// IsPrivate is true for a private transaction, which the node executes against private state
+func (tx *Txn) IsPrivate() bool {
+	return tx.PrivacyGroupID != "" || len(tx.PrivateFor) > 0
+}
+
+// DefaultTxnStageTimeout is the limit on estimating gas, signing, and submitting a transaction, when not configured
+const DefaultTxnStageTimeout = 30 * time.Second
+
+// TxnTimeouts are the limits on each stage of sending a transaction. Zero uses DefaultTxnStageTimeout
+type TxnTimeouts struct {
+	GasEstimate time.Duration
+	Sign        time.Duration
+	Submit      time.Duration
+}
+
+func stageTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultTxnStageTimeout
+	}
+	return timeout
 }
 
 // TxnReceipt is the receipt obtained over JSON/RPC from the ethereum client
@@ -55,21 +142,65 @@ type TxnReceipt struct {
 	BlockNumber       *ethbinding.HexBigInt `json:"blockNumber"`
 	ContractAddress   *ethbinding.Address   `json:"contractAddress"`
 	CumulativeGasUsed *ethbinding.HexBigInt `json:"cumulativeGasUsed"`
+	EffectiveGasPrice *ethbinding.HexBigInt `json:"effectiveGasPrice"`
 	TransactionHash   *ethbinding.Hash      `json:"transactionHash"`
 	From              *ethbinding.Address   `json:"from"`
 	GasUsed           *ethbinding.HexBigInt `json:"gasUsed"`
 	Status            *ethbinding.HexBigInt `json:"status"`
 	To                *ethbinding.Address   `json:"to"`
 	TransactionIndex  *ethbinding.HexUint   `json:"transactionIndex"`
+	RevertReason      string                `json:"revertReason,omitempty"`
+	Logs              []*TxnLog             `json:"logs,omitempty"`
+}
+
+// RuntimeABI builds a runtime ABI from a serialized one. Custom error entries, output by
+// solc 0.8.4+, are not understood by the runtime so are skipped. They are not needed to
+// invoke the contract, and remain in the serialized ABI that is stored and returned
+func RuntimeABI(abi ethbinding.ABIMarshaling) (*ethbinding.RuntimeABI, error) {
+	supported := make(ethbinding.ABIMarshaling, 0, len(abi))
+	for _, element := range abi {
+		if element.Type != "error" {
+			supported = append(supported, element)
+		}
+	}
+	return ethbind.API.ABIMarshalingToABIRuntime(supported)
 }
 
 // NewContractDeployTxn builds a new ethereum transaction from the supplied
-// SendTranasction message
-func NewContractDeployTxn(msg *messages.DeployContract, signer TXSigner) (tx *Txn, err error) {
+// SendTranasction message. When strictAddresses is set, mixed-case address
+// parameters must carry a valid EIP-55 checksum. Compiling any Solidity source
+// is limited to compileTimeout, when non-zero
+func NewContractDeployTxn(msg *messages.DeployContract, signer TXSigner, strictAddresses bool, compileTimeout time.Duration) (tx *Txn, err error) {
 
-	tx = &Txn{Signer: signer}
+	tx = &Txn{Signer: signer, StrictAddresses: strictAddresses}
 
+	data, err := tx.deploymentData(msg, compileTimeout)
+	if err != nil {
+		return
+	}
+
+	from := msg.From
+	if tx.Signer != nil {
+		from = tx.Signer.Address()
+	}
+
+	// Generate the ethereum transaction
+	if err = tx.genEthTransaction(from, "", msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, data); err != nil {
+		return
+	}
+
+	// retain private transaction fields
+	tx.PrivateFrom = msg.PrivateFrom
+	tx.PrivateFor = msg.PrivateFor
+	tx.PrivacyGroupID = msg.PrivacyGroupID
+	return
+}
+
+// deploymentData compiles the contract if required, and returns the EVM bytecode
+// joined with the packed constructor arguments
+func (tx *Txn) deploymentData(msg *messages.DeployContract, compileTimeout time.Duration) ([]byte, error) {
 	var compiled *CompiledSolidity
+	var err error
 
 	if msg.Compiled != nil && msg.ABI != nil {
 		compiled = &CompiledSolidity{
@@ -78,74 +209,63 @@ func NewContractDeployTxn(msg *messages.DeployContract, signer TXSigner) (tx *Tx
 		}
 	} else if msg.Solidity != "" {
 		// Compile the solidity contract
-		if compiled, err = CompileContract(msg.Solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion); err != nil {
-			return
+		compileStart := time.Now()
+		compiled, err = CompileContractWithTimeout(msg.Solidity, msg.ContractName, msg.CompilerVersion, msg.EVMVersion, compileTimeout)
+		tx.StageTimes.Compile = time.Since(compileStart).Seconds()
+		if err != nil {
+			return nil, err
 		}
 	} else {
-		err = errors.Errorf(errors.DeployTransactionMissingCode)
-		return
+		return nil, errors.Errorf(errors.DeployTransactionMissingCode)
 	}
 
-	// Build a runtime ABI from the serialized one
-	var typedArgs []interface{}
-	abi, err := ethbind.API.ABIMarshalingToABIRuntime(compiled.ABI)
-	if err == nil {
-		// Build correctly typed args for the ethereum call
-		typedArgs, err = tx.generateTypedArgs(msg.Parameters, &abi.Constructor)
-	}
+	packedCall, err := tx.packConstructorArgs(compiled.ABI, msg.Parameters)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	// Pack the arguments
-	packedCall, err := abi.Pack("", typedArgs...)
-	if err != nil {
-		err = errors.Errorf(errors.TransactionSendConstructorPackArgs, err)
-		return
-	}
+	tx.ABI = compiled.ABI
 
 	// Join the EVM bytecode with the packed call
-	data := append(compiled.Compiled, packedCall...)
+	return append(compiled.Compiled, packedCall...), nil
+}
 
-	from := msg.From
-	if tx.Signer != nil {
-		from = tx.Signer.Address()
-	}
+// PackConstructorArgs returns the ABI encoded constructor arguments, that follow the
+// bytecode in the data of the transaction that deploys a contract
+func PackConstructorArgs(abi ethbinding.ABIMarshaling, params []interface{}) ([]byte, error) {
+	tx := &Txn{}
+	return tx.packConstructorArgs(abi, params)
+}
 
-	// Generate the ethereum transaction
-	if err = tx.genEthTransaction(from, "", msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, data); err != nil {
-		return
+func (tx *Txn) packConstructorArgs(abiMarshaling ethbinding.ABIMarshaling, params []interface{}) ([]byte, error) {
+	// Build a runtime ABI from the serialized one
+	abi, err := RuntimeABI(abiMarshaling)
+	if err != nil {
+		return nil, err
 	}
-
-	// retain private transaction fields
-	tx.PrivateFrom = msg.PrivateFrom
-	tx.PrivateFor = msg.PrivateFor
-	tx.PrivacyGroupID = msg.PrivacyGroupID
-	return
+	// Build correctly typed args for the ethereum call
+	typedArgs, err := tx.generateTypedArgs(params, &abi.Constructor)
+	if err != nil {
+		return nil, err
+	}
+	// Pack the arguments
+	packedCall, err := abi.Pack("", typedArgs...)
+	if err != nil {
+		return nil, errors.Errorf(errors.TransactionSendConstructorPackArgs, err)
+	}
+	return packedCall, nil
 }
 
 // CallMethod performs eth_call to return data from the chain
-func CallMethod(ctx context.Context, rpc RPCClient, signer TXSigner, from, addr string, value json.Number, methodABI *ethbinding.ABIMethod, msgParams []interface{}, blocknumber string) (map[string]interface{}, error) {
+func CallMethod(ctx context.Context, rpc RPCClient, signer TXSigner, from, addr string, value json.Number, methodABI *ethbinding.ABIMethod, msgParams []interface{}, blocknumber string, strictAddresses bool) (map[string]interface{}, error) {
 	log.Debugf("Calling method. ABI: %+v Params: %+v", methodABI, msgParams)
-	tx, err := buildTX(signer, from, addr, "", value, "", "", methodABI, msgParams)
+	tx, err := buildTX(signer, strictAddresses, from, addr, "", value, "", "", methodABI, msgParams)
 	if err != nil {
 		return nil, err
 	}
-	callOption := "latest"
-	// only allowed values are "earliest/latest/pending", "", a number string "12345" or a hex number "0xab23"
-	// "latest" and "" (no fly-blocknumber given) are equivalent
-	if blocknumber != "" && blocknumber != "latest" {
-		isHex, _ := regexp.MatchString(`^0x[0-9a-fA-F]+$`, blocknumber)
-		if isHex || blocknumber == "earliest" || blocknumber == "pending" {
-			callOption = blocknumber
-		} else {
-			n := new(big.Int)
-			n, ok := n.SetString(blocknumber, 10)
-			if !ok {
-				return nil, errors.Errorf(errors.TransactionCallInvalidBlockNumber)
-			}
-			callOption = ethbind.API.EncodeBig(n)
-		}
+	callOption, err := callBlockOption(blocknumber)
+	if err != nil {
+		return nil, err
 	}
 
 	retBytes, err := tx.Call(ctx, rpc, callOption)
@@ -155,6 +275,88 @@ func CallMethod(ctx context.Context, rpc RPCClient, signer TXSigner, from, addr
 	return ProcessRLPBytes(methodABI.Outputs, retBytes), nil
 }
 
+// MethodCall is an individual call within a batch performed by CallMethods
+type MethodCall struct {
+	Addr      string
+	MethodABI *ethbinding.ABIMethod
+	Params    []interface{}
+	Result    map[string]interface{}
+	Err       error
+}
+
+// CallMethods performs eth_call for each of the supplied calls, in a single JSON/RPC batch request.
+// The result or error of each call is set on it. An error is only returned if the whole batch fails
+func CallMethods(ctx context.Context, rpc RPCClientBatch, from string, value json.Number, calls []*MethodCall, blocknumber string, strictAddresses bool) error {
+	callOption, err := callBlockOption(blocknumber)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]RPCBatchElem, 0, len(calls))
+	batchCalls := make([]*MethodCall, 0, len(calls))
+	hexResults := make([]string, len(calls))
+	for _, call := range calls {
+		log.Debugf("Calling method in batch. Addr: %s ABI: %+v Params: %+v", call.Addr, call.MethodABI, call.Params)
+		tx, err := buildTX(nil, strictAddresses, from, call.Addr, "", value, "", "", call.MethodABI, call.Params)
+		if err != nil {
+			call.Err = err
+			continue
+		}
+		batch = append(batch, RPCBatchElem{
+			Method: "eth_call",
+			Args:   []interface{}{tx.callArgs(), callOption},
+			Result: &hexResults[len(batch)],
+		})
+		batchCalls = append(batchCalls, call)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	// The batch is bounded by the RPC timeout of the request, such as its fly-rpctimeout, and by
+	// any deadline of the caller. Only when neither is set does the default timeout apply
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline && rpcTimeout(ctx) <= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+	}
+	if err := rpc.BatchCallContext(ctx, batch); err != nil {
+		return errors.Errorf(errors.TransactionSendCallFailedNoRevert, err)
+	}
+
+	for i, call := range batchCalls {
+		if batch[i].Error != nil {
+			call.Err = errors.Errorf(errors.TransactionSendCallFailedNoRevert, batch[i].Error)
+			continue
+		}
+		retBytes, err := processCallResult(hexResults[i])
+		if err != nil {
+			call.Err = err
+		} else if retBytes != nil {
+			call.Result = ProcessRLPBytes(call.MethodABI.Outputs, retBytes)
+		}
+	}
+	return nil
+}
+
+// callBlockOption validates the block to perform a call against.
+// The only allowed values are "earliest/latest/pending", "", a number string "12345" or a hex number "0xab23".
+// "latest" and "" (no fly-blocknumber given) are equivalent
+func callBlockOption(blocknumber string) (string, error) {
+	if blocknumber == "" || blocknumber == "latest" {
+		return "latest", nil
+	}
+	isHex, _ := regexp.MatchString(`^0x[0-9a-fA-F]+$`, blocknumber)
+	if isHex || blocknumber == "earliest" || blocknumber == "pending" {
+		return blocknumber, nil
+	}
+	n, ok := new(big.Int).SetString(blocknumber, 10)
+	if !ok {
+		return "", errors.Errorf(errors.TransactionCallInvalidBlockNumber)
+	}
+	return ethbind.API.EncodeBig(n), nil
+}
+
 func addErrorToRetval(retval map[string]interface{}, retBytes []byte, rawRetval interface{}, err error) {
 	log.Warnf(err.Error())
 	retval["rlp"] = hex.EncodeToString(retBytes)
@@ -179,6 +381,33 @@ func ProcessRLPBytes(args ethbinding.ABIArguments, retBytes []byte) map[string]i
 	return retval
 }
 
+// DecodeMethodInputs decodes the calldata of a method invocation, including the method
+// selector, into a map of the input parameters. Un-named inputs are named input, input1,
+// input2... to match the names accepted when invoking the method over REST
+func DecodeMethodInputs(methodABI *ethbinding.ABIMethod, data []byte) (map[string]interface{}, error) {
+	if len(data) < 4 || !bytes.Equal(data[0:4], methodABI.ID) {
+		return nil, errors.Errorf(errors.UnpackInputsSelectorMismatch, methodABI.Sig)
+	}
+	rawValues, err := methodABI.Inputs.UnpackValues(data[4:])
+	if err != nil {
+		return nil, errors.Errorf(errors.UnpackOutputsFailed, err)
+	}
+	retval := make(map[string]interface{})
+	for idx, input := range methodABI.Inputs {
+		argName := input.Name
+		if argName == "" {
+			argName = "input"
+			if idx != 0 {
+				argName += strconv.Itoa(idx)
+			}
+		}
+		if retval[argName], err = mapOutput(argName, input.Type.String(), &input.Type, rawValues[idx]); err != nil {
+			return nil, err
+		}
+	}
+	return retval, nil
+}
+
 func processOutputs(args ethbinding.ABIArguments, rawRetval []interface{}, retval map[string]interface{}) error {
 	numOutputs := len(args)
 	if numOutputs > 0 {
@@ -256,7 +485,8 @@ func mapOutput(argName, argType string, t *ethbinding.ABIType, rawValue interfac
 		}
 		return ethbind.API.HexEncode(arrayVal), nil
 	case ethbinding.SliceTy, ethbinding.ArrayTy:
-		if rawType.Kind() != reflect.Slice {
+		// Fixed size arrays are returned as Go arrays, including when nested in a slice
+		if rawType.Kind() != reflect.Slice && rawType.Kind() != reflect.Array {
 			return nil, errors.Errorf(errors.UnpackOutputsMismatchType, "slice",
 				argName, argType, rawType.Kind())
 		}
@@ -290,6 +520,11 @@ func genTupleMapOutput(argName, argType string, t *ethbinding.ABIType, rawValue
 	}
 	returnMap := make(map[string]interface{})
 	for i, fieldName := range t.TupleRawNames {
+		// Fall back to the generated struct field name for unnamed components,
+		// so nested tuples never collapse onto an empty key
+		if fieldName == "" {
+			fieldName = reflectValue.Type().Field(i).Name
+		}
 		returnMap[fieldName], err = mapOutput(fmt.Sprintf("%s.%s", argName, fieldName), t.TupleElems[i].String(), t.TupleElems[i], reflectValue.Field(i).Interface())
 		if err != nil {
 			return nil, err
@@ -299,8 +534,13 @@ func genTupleMapOutput(argName, argType string, t *ethbinding.ABIType, rawValue
 }
 
 // NewSendTxn builds a new ethereum transaction from the supplied
-// SendTranasction message
-func NewSendTxn(msg *messages.SendTransaction, signer TXSigner) (tx *Txn, err error) {
+// SendTranasction message. When strictAddresses is set, mixed-case address
+// parameters must carry a valid EIP-55 checksum
+func NewSendTxn(msg *messages.SendTransaction, signer TXSigner, strictAddresses bool) (tx *Txn, err error) {
+
+	if msg.Method != nil && (msg.Method.Type == "receive" || msg.Method.Type == "fallback") {
+		return newFallbackSendTxn(msg, signer)
+	}
 
 	var methodABI *ethbinding.ABIMethod
 	if msg.Method == nil || msg.Method.Name == "" {
@@ -318,13 +558,49 @@ func NewSendTxn(msg *messages.SendTransaction, signer TXSigner) (tx *Txn, err er
 			return
 		}
 	} else {
-		methodABI, err = ethbind.API.ABIElementMarshalingToABIMethod(msg.Method)
+		methodABI, err = ABIMethodFor(msg.Method)
 		if err != nil {
 			return
 		}
 	}
 
-	if tx, err = buildTX(signer, msg.From, msg.To, msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, methodABI, msg.Parameters); err != nil {
+	if tx, err = buildTX(signer, strictAddresses, msg.From, msg.To, msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, methodABI, msg.Parameters); err != nil {
+		return
+	}
+	if err = tx.setBlobFields(msg.BlobVersionedHashes, msg.MaxFeePerBlobGas); err != nil {
+		return
+	}
+
+	// retain private transaction fields
+	tx.PrivateFrom = msg.PrivateFrom
+	tx.PrivateFor = msg.PrivateFor
+	return
+}
+
+// newFallbackSendTxn builds a transaction that invokes the receive or fallback
+// function of a contract, with a plain value transfer or arbitrary calldata
+func newFallbackSendTxn(msg *messages.SendTransaction, signer TXSigner) (tx *Txn, err error) {
+	data := []byte{}
+	if msg.Data != "" {
+		if msg.Method.Type == "receive" {
+			err = errors.Errorf(errors.TransactionSendReceiveWithData)
+			return
+		}
+		if data, err = hex.DecodeString(strings.TrimPrefix(msg.Data, "0x")); err != nil {
+			err = errors.Errorf(errors.TransactionSendBadCalldata, err)
+			return
+		}
+	}
+
+	tx = &Txn{Signer: signer}
+	from := msg.From
+	if tx.Signer != nil {
+		from = tx.Signer.Address()
+	}
+	if err = tx.genEthTransaction(from, msg.To, msg.Nonce, msg.Value, msg.Gas, msg.GasPrice, data); err != nil {
+		return
+	}
+	if err = tx.setBlobFields(msg.BlobVersionedHashes, msg.MaxFeePerBlobGas); err != nil {
 		return
 	}
 
@@ -348,13 +624,42 @@ func NewNilTX(from string, nonce int64, signer TXSigner) (tx *Txn, err error) {
 	return
 }
 
-func buildTX(signer TXSigner, msgFrom, msgTo string, msgNonce, msgValue, msgGas, msgGasPrice json.Number, methodABI *ethbinding.ABIMethod, params []interface{}) (tx *Txn, err error) {
-	tx = &Txn{Signer: signer}
+func buildTX(signer TXSigner, strictAddresses bool, msgFrom, msgTo string, msgNonce, msgValue, msgGas, msgGasPrice json.Number, methodABI *ethbinding.ABIMethod, params []interface{}) (tx *Txn, err error) {
+	tx = &Txn{Signer: signer, StrictAddresses: strictAddresses}
+
+	packedCall, err := tx.encodeCall(methodABI, params)
+	if err != nil {
+		return
+	}
+
+	from := msgFrom
+	if tx.Signer != nil {
+		from = signer.Address()
+	}
+
+	// Generate the ethereum transaction
+	err = tx.genEthTransaction(from, msgTo, msgNonce, msgValue, msgGas, msgGasPrice, packedCall)
+	return
+}
+
+// EncodeMethodCall returns the ABI encoded calldata to invoke a method with the supplied
+// parameters, prefixed with the method selector
+func EncodeMethodCall(methodABI *ethbinding.ABIMethod, params []interface{}, strictAddresses bool) ([]byte, error) {
+	tx := &Txn{StrictAddresses: strictAddresses}
+	return tx.encodeCall(methodABI, params)
+}
+
+func (tx *Txn) encodeCall(cachedMethod *ethbinding.ABIMethod, params []interface{}) ([]byte, error) {
+	// In-line types in the params update the inputs, so they are copied from the method that
+	// might be shared through the cache
+	methodCopy := *cachedMethod
+	methodCopy.Inputs = append(ethbinding.ABIArguments{}, cachedMethod.Inputs...)
+	methodABI := &methodCopy
 
 	// Build correctly typed args for the ethereum call
 	typedArgs, err := tx.generateTypedArgs(params, methodABI)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	// Pack the arguments
@@ -362,20 +667,13 @@ func buildTX(signer TXSigner, msgFrom, msgTo string, msgNonce, msgValue, msgGas,
 	if err != nil {
 		err = errors.Errorf(errors.TransactionSendMethodPackArgs, methodABI.RawName, err)
 		log.Errorf("Attempted to pack args %+v: %s", typedArgs, err)
-		return
+		return nil, err
 	}
 	methodID := methodABI.ID
 	log.Debugf("Method Name=%s ID=%x PackedArgs=%x", methodABI.RawName, methodID, packedArgs)
-	packedCall := append(methodID, packedArgs...)
-
-	from := msgFrom
-	if tx.Signer != nil {
-		from = signer.Address()
-	}
-
-	// Generate the ethereum transaction
-	err = tx.genEthTransaction(from, msgTo, msgNonce, msgValue, msgGas, msgGasPrice, packedCall)
-	return
+	packedCall := make([]byte, 0, len(methodID)+len(packedArgs))
+	packedCall = append(packedCall, methodID...)
+	return append(packedCall, packedArgs...), nil
 }
 
 func (tx *Txn) genEthTransaction(msgFrom, msgTo string, msgNonce, msgValue, msgGas, msgGasPrice json.Number, data []byte) (err error) {
@@ -398,7 +696,8 @@ func (tx *Txn) genEthTransaction(msgFrom, msgTo string, msgNonce, msgValue, msgG
 
 	value := big.NewInt(0)
 	if msgValue.String() != "" {
-		if _, ok := value.SetString(msgValue.String(), 10); !ok {
+		var ok bool
+		if value, ok = parseValue(msgValue); !ok {
 			err = errors.Errorf(errors.TransactionSendBadValue, err)
 			return
 		}
@@ -439,9 +738,37 @@ func (tx *Txn) genEthTransaction(msgFrom, msgTo string, msgNonce, msgValue, msgG
 	return
 }
 
+// numberDigits match the digits of decimal and hex numbers, with underscores only allowed between digits
+var numberDigits = map[int]*regexp.Regexp{
+	10: regexp.MustCompile(`^[0-9]+(_[0-9]+)*$`),
+	16: regexp.MustCompile(`^[0-9a-fA-F]+(_[0-9a-fA-F]+)*$`),
+}
+
+// parseNumberString normalizes a numeric string parameter, supporting 0x prefixed
+// hex strings as well as underscore separated decimals such as "1_000_000".
+// Strings that do not match are returned unchanged, for the parse to reject
+func parseNumberString(s string) (numStr string, base int) {
+	numStr = s
+	sign := ""
+	if strings.HasPrefix(numStr, "-") {
+		sign = "-"
+		numStr = numStr[1:]
+	}
+	base = 10
+	if strings.HasPrefix(numStr, "0x") || strings.HasPrefix(numStr, "0X") {
+		base = 16
+		numStr = numStr[2:]
+	}
+	if !numberDigits[base].MatchString(numStr) {
+		return s, base
+	}
+	return sign + strings.ReplaceAll(numStr, "_", ""), base
+}
+
 func (tx *Txn) getInteger(methodName string, path string, requiredType *ethbinding.ABIType, suppliedType reflect.Type, param interface{}) (val int64, err error) {
 	if suppliedType.Kind() == reflect.String {
-		if val, err = strconv.ParseInt(param.(string), 10, 64); err != nil {
+		numStr, base := parseNumberString(param.(string))
+		if val, err = strconv.ParseInt(numStr, base, 64); err != nil {
 			err = errors.Errorf(errors.TransactionSendInputTypeBadNumber, methodName, path)
 			return
 		}
@@ -455,7 +782,8 @@ func (tx *Txn) getInteger(methodName string, path string, requiredType *ethbindi
 
 func (tx *Txn) getUnsignedInteger(methodName string, path string, requiredType *ethbinding.ABIType, suppliedType reflect.Type, param interface{}) (val uint64, err error) {
 	if suppliedType.Kind() == reflect.String {
-		if val, err = strconv.ParseUint(param.(string), 10, 64); err != nil {
+		numStr, base := parseNumberString(param.(string))
+		if val, err = strconv.ParseUint(numStr, base, 64); err != nil {
 			err = errors.Errorf(errors.TransactionSendInputTypeBadNumber, methodName, path)
 			return
 		}
@@ -470,7 +798,8 @@ func (tx *Txn) getUnsignedInteger(methodName string, path string, requiredType *
 func (tx *Txn) getBigInteger(methodName string, path string, requiredType *ethbinding.ABIType, suppliedType reflect.Type, param interface{}) (bigInt *big.Int, err error) {
 	bigInt = big.NewInt(0)
 	if suppliedType.Kind() == reflect.String {
-		if _, ok := bigInt.SetString(param.(string), 10); !ok {
+		numStr, base := parseNumberString(param.(string))
+		if _, ok := bigInt.SetString(numStr, base); !ok {
 			err = errors.Errorf(errors.TransactionSendInputTypeBadNumber, methodName, path)
 		}
 	} else if suppliedType.Kind() == reflect.Float64 {
@@ -489,19 +818,29 @@ func (tx *Txn) generateTypedArrayOrSlice(methodName string, path string, require
 	var genericSlice reflect.Value
 	var requiredReflectType = requiredType.GetType()
 	if requiredReflectType.Kind() == reflect.Array {
+		if paramV.Len() != requiredType.Size {
+			return nil, errors.Errorf(errors.TransactionSendInputTypeBadArrayLength, methodName, path, requiredType, requiredType.Size, paramV.Len())
+		}
 		arrayType := reflect.ArrayOf(requiredType.Size, requiredType.Elem.GetType())
 		genericSlice = reflect.New(arrayType).Elem()
 	} else {
 		genericSlice = reflect.MakeSlice(requiredReflectType, paramV.Len(), paramV.Len())
 	}
+	// The inner type can itself be an array or slice, for nested arrays such as uint256[][]
 	innerType := requiredType.Elem
 	for i := 0; i < paramV.Len(); i++ {
 		paramInSlice := paramV.Index(i).Interface()
-		val, err := tx.generateTypedArg(innerType, paramInSlice, methodName, fmt.Sprintf("%s[%d]", path, i))
+		entryPath := fmt.Sprintf("%s[%d]", path, i)
+		val, err := tx.generateTypedArg(innerType, paramInSlice, methodName, entryPath)
 		if err != nil {
 			return nil, err
 		}
-		genericSlice.Index(i).Set(reflect.ValueOf(val))
+		valV := reflect.ValueOf(val)
+		if !valV.Type().AssignableTo(genericSlice.Type().Elem()) {
+			// For example a short hex string for a fixed size bytes type
+			return nil, errors.Errorf(errors.TransactionSendInputTypeBadArrayEntry, methodName, entryPath, innerType, valV.Type())
+		}
+		genericSlice.Index(i).Set(valV)
 	}
 	return genericSlice.Interface(), nil
 }
@@ -532,7 +871,25 @@ func (tx *Txn) generateTupleFromMap(methodName string, path string, requiredType
 	return tuple.Interface(), nil
 }
 
+// jsonNumberParam converts a number parsed from JSON with UseNumber, so that integers are parsed
+// from the exact digits supplied rather than via a float64 that cannot hold more than 2^53.
+// Other types see a float64, as they would if the JSON had been parsed without UseNumber
+func jsonNumberParam(requiredType *ethbinding.ABIType, num json.Number) interface{} {
+	if requiredType.T == ethbinding.IntTy || requiredType.T == ethbinding.UintTy {
+		if _, ok := new(big.Int).SetString(num.String(), 10); ok {
+			return num.String()
+		}
+	}
+	if f, err := num.Float64(); err == nil {
+		return f
+	}
+	return num.String()
+}
+
 func (tx *Txn) generateTypedArg(requiredType *ethbinding.ABIType, param interface{}, methodName string, path string) (interface{}, error) {
+	if num, ok := param.(json.Number); ok {
+		param = jsonNumberParam(requiredType, num)
+	}
 	suppliedType := reflect.TypeOf(param)
 	if suppliedType == nil {
 		return nil, errors.Errorf(errors.TransactionSendInputTypeBadNull, methodName, path)
@@ -591,6 +948,9 @@ func (tx *Txn) generateTypedArg(requiredType *ethbinding.ABIType, param interfac
 			if !ethbind.API.IsHexAddress(param.(string)) {
 				return nil, errors.Errorf(errors.TransactionSendInputTypeAddress, methodName, path, suppliedType)
 			}
+			if tx.StrictAddresses && !isValidAddressChecksum(param.(string)) {
+				return nil, errors.Errorf(errors.TransactionSendInputTypeAddressChecksum, methodName, path, param)
+			}
 			return ethbind.API.HexToAddress(param.(string)), nil
 		}
 		return nil, errors.Errorf(errors.TransactionSendInputTypeBadJSONTypeForAddress, methodName, path, requiredType, suppliedType)
@@ -605,6 +965,10 @@ func (tx *Txn) generateTypedArg(requiredType *ethbinding.ABIType, param interfac
 				if valV.Kind() == reflect.Interface {
 					valV = valV.Elem()
 				}
+				if num, ok := valV.Interface().(json.Number); ok {
+					f, _ := num.Float64()
+					valV = reflect.ValueOf(f)
+				}
 				if valV.Kind() != reflect.Float64 {
 					return nil, errors.Errorf(errors.TransactionSendInputTypeBadJSONTypeInNumericArray, methodName, path, requiredType, i, valV.Kind())
 				}
@@ -615,7 +979,10 @@ func (tx *Txn) generateTypedArg(requiredType *ethbinding.ABIType, param interfac
 				bSlice[i] = byte(floatVal)
 			}
 		} else if suppliedType.Kind() == reflect.String {
-			bSlice = ethbind.API.FromHex(param.(string))
+			var err error
+			if bSlice, err = DecodeBytesString(param.(string)); err != nil {
+				return nil, errors.Errorf(errors.TransactionSendInputTypeBadBase64, methodName, path, requiredType, err)
+			}
 		} else {
 			return nil, errors.Errorf(errors.TransactionSendInputTypeBadJSONTypeForBytes, methodName, path, requiredType, suppliedType)
 		}
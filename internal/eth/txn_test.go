@@ -22,8 +22,10 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/ethbind"
 	"github.com/kaleido-io/ethconnect/internal/messages"
 	log "github.com/sirupsen/logrus"
@@ -74,7 +76,7 @@ func TestNewContractDeployTxnSimpleStorage(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -104,7 +106,7 @@ func TestNewContractDeployTxnSimpleStorageCalcGas(t *testing.T) {
 	msg.Nonce = "123"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -125,6 +127,81 @@ func TestNewContractDeployTxnSimpleStorageCalcGas(t *testing.T) {
 
 }
 
+func newMaxGasTestDeployTxn(t *testing.T, gas json.Number) *Txn {
+	var msg messages.DeployContract
+	msg.Solidity = simpleStorage
+	msg.Parameters = []interface{}{float64(999999)}
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Nonce = "123"
+	msg.Gas = gas
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
+	assert.NoError(t, err)
+	tx.MaxGas = 1000
+	return tx
+}
+
+func estimateGasWrangler(estimate uint64) func(interface{}) {
+	return func(result interface{}) {
+		if gas, ok := result.(**ethbinding.HexUint64); ok {
+			**gas = ethbinding.HexUint64(estimate)
+		}
+	}
+}
+
+func TestNewContractDeployTxnMaxGasExceeded(t *testing.T) {
+	tx := newMaxGasTestDeployTxn(t, "1001")
+	rpc := testRPCClient{}
+
+	err := tx.Send(context.Background(), &rpc)
+
+	assert.EqualError(t, err, "Gas 1001 exceeds the maximum of 1000")
+	assert.Equal(t, "", rpc.capturedMethod)
+}
+
+func TestNewContractDeployTxnMaxGasEstimateExceeded(t *testing.T) {
+	tx := newMaxGasTestDeployTxn(t, "")
+	rpc := testRPCClient{resultWrangler: estimateGasWrangler(1001)}
+
+	err := tx.Send(context.Background(), &rpc)
+
+	assert.EqualError(t, err, "Estimated gas 1001 exceeds the maximum of 1000")
+	assert.Equal(t, "eth_estimateGas", rpc.capturedMethod)
+	assert.Equal(t, "", rpc.capturedMethod2)
+}
+
+func TestNewContractDeployTxnMaxGasEstimateBufferLimited(t *testing.T) {
+	assert := assert.New(t)
+	tx := newMaxGasTestDeployTxn(t, "")
+	rpc := testRPCClient{resultWrangler: estimateGasWrangler(900)}
+
+	err := tx.Send(context.Background(), &rpc)
+
+	assert.NoError(err)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod2)
+	jsonBytesSent, _ := json.Marshal(rpc.capturedArgs2[0])
+	var jsonSent map[string]interface{}
+	json.Unmarshal(jsonBytesSent, &jsonSent)
+	assert.Equal("0x3e8", jsonSent["gas"])
+}
+
+func TestNewContractDeployTxnApprove(t *testing.T) {
+	assert := assert.New(t)
+	tx := newMaxGasTestDeployTxn(t, "")
+	rpc := testRPCClient{resultWrangler: estimateGasWrangler(500)}
+	var approvedGas uint64
+	tx.Approve = func() error {
+		approvedGas = tx.EthTX.Gas()
+		return fmt.Errorf("pop")
+	}
+
+	err := tx.Send(context.Background(), &rpc)
+
+	assert.EqualError(err, "pop")
+	assert.Equal(uint64(600), approvedGas)
+	assert.Equal("eth_estimateGas", rpc.capturedMethod)
+	assert.Equal("", rpc.capturedMethod2)
+}
+
 func TestNewContractDeployTxnSimpleStoragePrivate(t *testing.T) {
 	assert := assert.New(t)
 
@@ -137,7 +214,7 @@ func TestNewContractDeployTxnSimpleStoragePrivate(t *testing.T) {
 	msg.GasPrice = "0"
 	msg.PrivateFrom = "oD76ZRgu6py/WKrsXbtF9++Mf1mxVxzqficE1Uiw6S8="
 	msg.PrivateFor = []string{"s6a3mQ8I+rI2ZgHqHZlJaELiJs10HxlZNIwNd669FH4="}
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -167,7 +244,7 @@ func TestNewContractDeployTxnSimpleStoragePrivateOrion(t *testing.T) {
 	msg.Value = "678"
 	msg.GasPrice = "0"
 	msg.PrivateFrom = "oD76ZRgu6py/WKrsXbtF9++Mf1mxVxzqficE1Uiw6S8="
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	tx.PrivacyGroupID = "P8SxRUussJKqZu4+nUkMJpscQeWOR3HqbAXLakatsk8="
 	rpc := testRPCClient{}
@@ -197,7 +274,7 @@ func TestNewContractDeployTxnSimpleStoragePrivateOrionMissingPrivateFrom(t *test
 	msg.Nonce = "123"
 	msg.Value = "678"
 	msg.GasPrice = "0"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	tx.OrionPrivateAPIS = true
 	tx.PrivacyGroupID = "s6a3mQ8I+rI2ZgHqHZlJaELiJs10HxlZNIwNd669FH4="
@@ -216,7 +293,7 @@ func TestNewContractDeployTxnSimpleStorageCalcGasFailAndCallSucceeds(t *testing.
 	msg.Nonce = "123"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -235,7 +312,7 @@ func TestNewContractDeployTxnSimpleStorageCalcGasFailAndCallFailsAsExpected(t *t
 	msg.Nonce = "123"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -255,7 +332,7 @@ func TestNewContractDeployMissingCompiledOrSolidity(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.EqualError(err, "Missing Compiled Code + ABI, or Solidity")
 }
 
@@ -274,7 +351,7 @@ func TestNewContractDeployPrecompiledSimpleStorage(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewContractDeployTxn(&msg, nil)
+	tx, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 	rpc := testRPCClient{}
 
@@ -294,6 +371,23 @@ func TestNewContractDeployPrecompiledSimpleStorage(t *testing.T) {
 
 }
 
+func TestPackConstructorArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	var abi ethbinding.ABIMarshaling
+	json.Unmarshal([]byte(`[{"type":"constructor","inputs":[{"name":"x","type":"uint256"}]}]`), &abi)
+	packed, err := PackConstructorArgs(abi, []interface{}{"10"})
+	assert.NoError(err)
+	assert.Equal(append(make([]byte, 31), 0x0a), packed)
+
+	_, err = PackConstructorArgs(abi, []interface{}{"ten"})
+	assert.Error(err)
+
+	packed, err = PackConstructorArgs(ethbinding.ABIMarshaling{}, nil)
+	assert.NoError(err)
+	assert.Empty(packed)
+}
+
 func TestNewContractDeployTxnBadNonce(t *testing.T) {
 	assert := assert.New(t)
 
@@ -305,7 +399,7 @@ func TestNewContractDeployTxnBadNonce(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Converting supplied 'nonce' to integer", err.Error())
 }
 
@@ -320,7 +414,7 @@ func TestNewContractDeployBadValue(t *testing.T) {
 	msg.Value = "zzz"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Converting supplied 'value' to big integer", err.Error())
 }
 
@@ -335,7 +429,7 @@ func TestNewContractDeployBadGas(t *testing.T) {
 	msg.Value = "111"
 	msg.Gas = "abc"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Converting supplied 'gas' to integer", err.Error())
 }
 
@@ -350,7 +444,7 @@ func TestNewContractDeployBadGasPrice(t *testing.T) {
 	msg.Value = "111"
 	msg.Gas = "456"
 	msg.GasPrice = "abc"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Converting supplied 'gasPrice' to big integer", err.Error())
 }
 
@@ -359,7 +453,7 @@ func TestNewContractDeployTxnBadContract(t *testing.T) {
 
 	var msg messages.DeployContract
 	msg.Solidity = "badness"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Solidity compilation failed", err.Error())
 }
 
@@ -374,7 +468,7 @@ func TestNewContractDeployStringForNumber(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 }
 
@@ -384,7 +478,7 @@ func TestNewContractDeployTxnBadContractName(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.ContractName = "wrongun"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Contract '<stdin>:wrongun' not found in Solidity source", err.Error())
 }
 func TestNewContractDeploySpecificContractName(t *testing.T) {
@@ -399,7 +493,7 @@ func TestNewContractDeploySpecificContractName(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Nil(err)
 }
 
@@ -408,7 +502,7 @@ func TestNewContractDeployMissingNameMultipleContracts(t *testing.T) {
 
 	var msg messages.DeployContract
 	msg.Solidity = twoContracts
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("More than one contract in Solidity file", err.Error())
 }
 
@@ -418,7 +512,7 @@ func TestNewContractDeployBadNumber(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{"ABCD"}
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Could not be converted to a number", err.Error())
 }
 
@@ -428,7 +522,7 @@ func TestNewContractDeployBadTypeForNumber(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{false}
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Must supply a number or a string", err.Error())
 }
 
@@ -438,7 +532,7 @@ func TestNewContractDeployMissingParam(t *testing.T) {
 	var msg messages.DeployContract
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{}
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 	assert.Regexp("Requires 1 args \\(supplied=0\\)", err.Error())
 }
 
@@ -453,7 +547,7 @@ func testComplexParam(t *testing.T, solidityType string, val interface{}, expect
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewContractDeployTxn(&msg, nil)
+	_, err := NewContractDeployTxn(&msg, nil, false, 0)
 
 	if expectedErr == "" {
 		assert.Nil(err)
@@ -499,6 +593,147 @@ func TestSolidityIntParamConversion(t *testing.T) {
 	testComplexParam(t, "int256", "abc", "Could not be converted to a number")
 }
 
+func testTypedArg(t *testing.T, solidityType string, val interface{}, expectedErr string) {
+	testTypedArgTx(t, &Txn{}, solidityType, val, expectedErr)
+}
+
+func testTypedArgTx(t *testing.T, tx *Txn, solidityType string, val interface{}, expectedErr string) {
+	assert := assert.New(t)
+
+	requiredType, err := ethbind.API.NewType(solidityType, "")
+	assert.NoError(err)
+	_, err = tx.generateTypedArg(&requiredType, val, "testFunc", "0")
+
+	if expectedErr == "" {
+		assert.Nil(err)
+	} else if err == nil {
+		assert.Fail("Error expected")
+	} else {
+		assert.Regexp(expectedErr, err.Error())
+	}
+}
+
+func TestJSONNumberParamConversion(t *testing.T) {
+	assert := assert.New(t)
+	tx := &Txn{}
+
+	uint256Type, _ := ethbind.API.NewType("uint256", "")
+	v, err := tx.generateTypedArg(&uint256Type, json.Number("123456789012345678901234567890"), "testFunc", "0")
+	assert.NoError(err)
+	assert.Equal("123456789012345678901234567890", v.(*big.Int).String())
+
+	int64Type, _ := ethbind.API.NewType("int64", "")
+	v, err = tx.generateTypedArg(&int64Type, json.Number("-9007199254740993"), "testFunc", "0")
+	assert.NoError(err)
+	assert.Equal(int64(-9007199254740993), v)
+
+	uint64Type, _ := ethbind.API.NewType("uint64", "")
+	v, err = tx.generateTypedArg(&uint64Type, json.Number("18446744073709551615"), "testFunc", "0")
+	assert.NoError(err)
+	assert.Equal(uint64(18446744073709551615), v)
+
+	v, err = tx.generateTypedArg(&uint64Type, json.Number("1e3"), "testFunc", "0")
+	assert.NoError(err)
+	assert.Equal(uint64(1000), v)
+
+	bytesType, _ := ethbind.API.NewType("bytes", "")
+	v, err = tx.generateTypedArg(&bytesType, []interface{}{json.Number("1"), json.Number("255")}, "testFunc", "0")
+	assert.NoError(err)
+	assert.Equal([]byte{1, 255}, v)
+
+	testTypedArg(t, "bytes", []interface{}{json.Number("256")}, "Invalid number - outside of range for byte")
+	testTypedArg(t, "bool", json.Number("1"), "Must supply a boolean or a string")
+	testTypedArg(t, "string", json.Number("1"), "Must supply a string")
+	testTypedArg(t, "uint256[]", []interface{}{json.Number("1"), json.Number("340282366920938463463374607431768211456")}, "")
+}
+
+func TestHexAndUnderscoreParamConversion(t *testing.T) {
+	testTypedArg(t, "uint8", "0xff", "")
+	testTypedArg(t, "uint64", "0xFFFFFFFFFFFFFFFF", "")
+	testTypedArg(t, "uint64", "1_000_000", "")
+	testTypedArg(t, "uint256", "0x0de0b6b3a7640000", "")
+	testTypedArg(t, "uint256", "1_000_000_000_000_000_000", "")
+	testTypedArg(t, "uint256", "0xzz", "Could not be converted to a number")
+	testTypedArg(t, "uint256", "1__000", "Could not be converted to a number")
+	testTypedArg(t, "uint256", "_1000", "Could not be converted to a number")
+	testTypedArg(t, "int32", "-0x10", "")
+	testTypedArg(t, "int64", "-1_000", "")
+	testTypedArg(t, "int256", "-0x10", "")
+	testTypedArg(t, "int256", "1000_", "Could not be converted to a number")
+	testTypedArg(t, "uint256", "0x_ff", "Could not be converted to a number")
+	testTypedArg(t, "uint64", "0x_ff", "Could not be converted to a number")
+	testTypedArg(t, "int256", "-_1", "Could not be converted to a number")
+	testTypedArg(t, "int64", "-_1", "Could not be converted to a number")
+	testTypedArg(t, "uint256", "0x+ff", "Could not be converted to a number")
+	testTypedArg(t, "uint64", "0x+ff", "Could not be converted to a number")
+	testTypedArg(t, "int256", "0x-ff", "Could not be converted to a number")
+	testTypedArg(t, "uint256", "0xff_ff", "")
+}
+
+func TestStrictAddressChecksums(t *testing.T) {
+	tx := &Txn{StrictAddresses: true}
+	testTypedArgTx(t, tx, "address", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "")
+	testTypedArgTx(t, tx, "address", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "")
+	testTypedArgTx(t, tx, "address", "5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", "")
+	testTypedArgTx(t, tx, "address", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeaED", "failed EIP-55 checksum validation")
+}
+
+func TestSendTxnStrictAddressChecksums(t *testing.T) {
+	assert := assert.New(t)
+
+	newMsg := func() *messages.SendTransaction {
+		var msg messages.SendTransaction
+		msg.MethodName = "test"
+		msg.Parameters = []interface{}{
+			map[string]interface{}{"type": "address", "value": "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeaED"},
+		}
+		msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+		msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+		msg.Nonce = "123"
+		msg.Value = "0"
+		msg.Gas = "456"
+		msg.GasPrice = "789"
+		return &msg
+	}
+
+	_, err := NewSendTxn(newMsg(), nil, true)
+	assert.Regexp("failed EIP-55 checksum validation", err)
+
+	_, err = NewSendTxn(newMsg(), nil, false)
+	assert.NoError(err)
+}
+
+func TestNonStrictAddressChecksums(t *testing.T) {
+	testTypedArg(t, "address", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeaED", "")
+}
+
+func TestParseNumberString(t *testing.T) {
+	assert := assert.New(t)
+
+	numStr, base := parseNumberString("1_000_000")
+	assert.Equal("1000000", numStr)
+	assert.Equal(10, base)
+
+	numStr, base = parseNumberString("0xABCdef")
+	assert.Equal("ABCdef", numStr)
+	assert.Equal(16, base)
+
+	numStr, base = parseNumberString("-0x1_0")
+	assert.Equal("-10", numStr)
+	assert.Equal(16, base)
+
+	numStr, base = parseNumberString("12345")
+	assert.Equal("12345", numStr)
+	assert.Equal(10, base)
+
+	numStr, base = parseNumberString("0x_ff")
+	assert.Equal("0x_ff", numStr)
+	assert.Equal(16, base)
+
+	numStr, _ = parseNumberString("-_1")
+	assert.Equal("-_1", numStr)
+}
+
 func TestSolidityIntSliceParamConversion(t *testing.T) {
 	testComplexParam(t, "int8[] memory", []float64{123, 456, 789}, "")
 	testComplexParam(t, "int8[] memory", []float64{}, "")
@@ -559,6 +794,10 @@ func TestSolidityBytesParamConversion(t *testing.T) {
 	// Below test fails since ethconnect expects bytes32 to be a hex string, should be enhanced to accept plain strings as well
 	testComplexParam(t, "bytes32", "john", "cannot use \\[0\\]uint8 as type \\[32\\]uint8 as argument")
 	testComplexParam(t, "bytes32", "0x223df1450ad1f2fe995df3df25df18fc7e58b86c87f3b799b8911da1b06d4cef", "")
+	testComplexParam(t, "bytes4", "base64:/u2+7w==", "")
+	testComplexParam(t, "bytes4", "base64:_u2-7w", "")
+	testComplexParam(t, "bytes memory", "base64:aGVsbG8=", "")
+	testComplexParam(t, "bytes memory", "base64:!!!", "is a bytes: Invalid base64")
 }
 
 func TestSolidityArrayOfByteArraysParamConversion(t *testing.T) {
@@ -570,6 +809,74 @@ func TestSolidityArrayOfByteArraysParamConversion(t *testing.T) {
 	testComplexParam(t, "bytes1[] memory", []string{"fe", "ed", "be", "ef"}, "")
 }
 
+func testNestedArrayArgs(typeName string, param interface{}) (ethbinding.ABIArguments, []interface{}, error) {
+	nestedType, err := ethbind.API.ABITypeFor(typeName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tx Txn
+	m := &ethbinding.ABIMethod{
+		Name:   "nested",
+		Inputs: ethbinding.ABIArguments{{Name: "p1", Type: nestedType}},
+	}
+	typedArgs, err := tx.generateTypedArgs([]interface{}{param}, m)
+	return m.Inputs, typedArgs, err
+}
+
+func TestSolidityNestedArrayParamConversion(t *testing.T) {
+	assert := assert.New(t)
+
+	args, typedArgs, err := testNestedArrayArgs("uint256[][]", []interface{}{
+		[]interface{}{"1", float64(2)},
+		[]interface{}{},
+		[]interface{}{"0x03"},
+	})
+	assert.NoError(err)
+	assert.Equal([][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {}, {big.NewInt(3)}}, typedArgs[0])
+	_, err = args.Pack(typedArgs...)
+	assert.NoError(err)
+
+	args, typedArgs, err = testNestedArrayArgs("bytes32[2][]", []interface{}{
+		[]interface{}{
+			"0x223df1450ad1f2fe995df3df25df18fc7e58b86c87f3b799b8911da1b06d4cef",
+			"0x6e710868fd2d0ac1f141ba3f0cd569e38ce1999d8f39518ee7633d2b9a7122af",
+		},
+	})
+	assert.NoError(err)
+	assert.Len(typedArgs[0], 1)
+	_, err = args.Pack(typedArgs...)
+	assert.NoError(err)
+
+	args, typedArgs, err = testNestedArrayArgs("int8[2][3]", []interface{}{
+		[]interface{}{float64(-1), float64(2)},
+		[]interface{}{float64(3), "-4"},
+		[]interface{}{float64(5), float64(6)},
+	})
+	assert.NoError(err)
+	assert.Equal([3][2]int8{{-1, 2}, {3, -4}, {5, 6}}, typedArgs[0])
+	_, err = args.Pack(typedArgs...)
+	assert.NoError(err)
+}
+
+func TestSolidityNestedArrayParamConversionErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := testNestedArrayArgs("uint256[][]", []interface{}{"1"})
+	assert.Regexp("param 0\\[0\\] is a uint256\\[\\]: Must supply an array", err)
+
+	_, _, err = testNestedArrayArgs("uint256[][]", []interface{}{[]interface{}{"abc"}})
+	assert.Regexp("param 0\\[0\\]\\[0\\]: Could not be converted to a number", err)
+
+	_, _, err = testNestedArrayArgs("uint8[2][]", []interface{}{[]interface{}{float64(1)}})
+	assert.Regexp("param 0\\[0\\] is a uint8\\[2\\]: Must supply an array of 2 entries \\(supplied=1\\)", err)
+
+	_, _, err = testNestedArrayArgs("uint8[2][]", []interface{}{[]interface{}{float64(1), float64(2), float64(3)}})
+	assert.Regexp("Must supply an array of 2 entries \\(supplied=3\\)", err)
+
+	_, _, err = testNestedArrayArgs("bytes32[2][]", []interface{}{[]interface{}{"0x01", "0x02"}})
+	assert.Regexp("param 0\\[0\\]\\[0\\] is a bytes32: Value cannot be used as an array entry \\(converted=\\[1\\]uint8\\)", err)
+}
+
 func TestTypeNotYetSupported(t *testing.T) {
 	assert := assert.New(t)
 	var tx Txn
@@ -581,6 +888,71 @@ func TestTypeNotYetSupported(t *testing.T) {
 	assert.Regexp("Type '.*' is not yet supported", err)
 }
 
+func TestSendTxnFallbackWithData(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Method = &ethbinding.ABIElementMarshaling{
+		Type:            "fallback",
+		StateMutability: "payable",
+	}
+	msg.Data = "0xfeedbeef"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Nonce = "123"
+	msg.Value = "100"
+	msg.Gas = "456"
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(&msg, nil, false)
+	assert.NoError(err)
+
+	rpc := testRPCClient{}
+
+	tx.Send(context.Background(), &rpc)
+	assert.Equal("eth_sendTransaction", rpc.capturedMethod)
+	jsonBytesSent, _ := json.Marshal(rpc.capturedArgs[0])
+	var jsonSent map[string]interface{}
+	json.Unmarshal(jsonBytesSent, &jsonSent)
+	assert.Equal("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", jsonSent["to"])
+	assert.Equal("0x64", jsonSent["value"])
+	assert.Equal("0xfeedbeef", jsonSent["data"])
+}
+
+func TestSendTxnReceive(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Method = &ethbinding.ABIElementMarshaling{
+		Type:            "receive",
+		StateMutability: "payable",
+	}
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Value = "100"
+	tx, err := NewSendTxn(&msg, nil, false)
+	assert.NoError(err)
+	assert.Empty(tx.EthTX.Data())
+	assert.Equal(int64(100), tx.EthTX.Value().Int64())
+
+	msg.Data = "0xfeedbeef"
+	_, err = NewSendTxn(&msg, nil, false)
+	assert.Regexp("The receive function cannot be invoked with calldata", err)
+}
+
+func TestSendTxnFallbackBadData(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Method = &ethbinding.ABIElementMarshaling{
+		Type: "fallback",
+	}
+	msg.Data = "0xnothex"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	_, err := NewSendTxn(&msg, nil, false)
+	assert.Regexp("Converting supplied 'data' to bytes", err)
+}
+
 func TestSendTxnABIParam(t *testing.T) {
 	assert := assert.New(t)
 
@@ -623,7 +995,7 @@ func TestSendTxnABIParam(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewSendTxn(&msg, nil)
+	tx, err := NewSendTxn(&msg, nil, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -676,7 +1048,7 @@ func TestSendTxnInlineParam(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewSendTxn(&msg, nil)
+	tx, err := NewSendTxn(&msg, nil, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -714,7 +1086,7 @@ func TestSendTxnNilParam(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.EqualError(err, "Method 'testFunc' param 0: Cannot supply a null value")
 
 }
@@ -730,7 +1102,7 @@ func TestNewSendTxnMissingParamTypes(t *testing.T) {
 			},
 		},
 		MethodName: "test",
-	}, nil)
+	}, nil, false)
 	assert.EqualError(err, "Param 0: supplied as an object must have 'type' and 'value' fields")
 }
 
@@ -783,7 +1155,7 @@ func TestCallMethod(t *testing.T) {
 	res, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "")
+		json.Number("12345"), genMethod(params), params, "", false)
 	assert.NoError(err)
 	assert.Equal(map[string]interface{}{
 		"retval1": "1",
@@ -804,7 +1176,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "pending")
+		json.Number("12345"), genMethod(params), params, "pending", false)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("pending", rpc.capturedArgs2[1])
@@ -812,7 +1184,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "earliest")
+		json.Number("12345"), genMethod(params), params, "earliest", false)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("earliest", rpc.capturedArgs2[1])
@@ -820,7 +1192,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "0x1234")
+		json.Number("12345"), genMethod(params), params, "0x1234", false)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("0x1234", rpc.capturedArgs2[1])
@@ -828,7 +1200,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "12345")
+		json.Number("12345"), genMethod(params), params, "12345", false)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("0x3039", rpc.capturedArgs2[1])
@@ -836,7 +1208,7 @@ func TestCallMethod(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), genMethod(params), params, "0")
+		json.Number("12345"), genMethod(params), params, "0", false)
 	assert.NoError(err)
 	assert.Equal("eth_call", rpc.capturedMethod2)
 	assert.Equal("0x0", rpc.capturedArgs2[1])
@@ -857,7 +1229,7 @@ func TestCallMethodFail(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", false)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	assert.EqualError(err, "Call failed: pop")
@@ -865,7 +1237,7 @@ func TestCallMethodFail(t *testing.T) {
 	_, err = CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "ab2345")
+		json.Number("12345"), method, params, "ab2345", false)
 	assert.EqualError(err, "Invalid blocknumber. Failed to parse into big integer")
 }
 
@@ -887,7 +1259,7 @@ func TestCallMethodRevert(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", false)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	assert.EqualError(err, "Muppetry detected")
@@ -911,7 +1283,7 @@ func TestCallMethodRevertBadStrLen(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", false)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	// Should read up to the end of the padding, and not panic
@@ -936,7 +1308,7 @@ func TestCallMethodRevertBadBytes(t *testing.T) {
 	_, err := CallMethod(context.Background(), rpc, nil,
 		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
 		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
-		json.Number("12345"), method, params, "")
+		json.Number("12345"), method, params, "", false)
 
 	assert.Equal("eth_call", rpc.capturedMethod)
 	assert.EqualError(err, "EVM reverted. Failed to decode error message")
@@ -949,7 +1321,7 @@ func TestCallMethodBadArgs(t *testing.T) {
 		mockError: fmt.Errorf("pop"),
 	}
 
-	_, err := CallMethod(context.Background(), rpc, nil, "badness", "", json.Number(""), &ethbinding.ABIMethod{}, []interface{}{}, "")
+	_, err := CallMethod(context.Background(), rpc, nil, "badness", "", json.Number(""), &ethbinding.ABIMethod{}, []interface{}{}, "", false)
 
 	assert.EqualError(err, "Supplied value for 'from' is not a valid hex address")
 }
@@ -986,7 +1358,7 @@ func TestSendTxnNodeAssignNonce(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewSendTxn(&msg, nil)
+	tx, err := NewSendTxn(&msg, nil, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1022,7 +1394,7 @@ func TestSendWithTXSignerContractOK(t *testing.T) {
 	msg.From = "hd-u0abcd1234-u0bcde9876-12345"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewSendTxn(&msg, signer)
+	tx, err := NewSendTxn(&msg, signer, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1051,7 +1423,7 @@ func TestSendWithTXSignerOK(t *testing.T) {
 	msg.From = "hd-u0abcd1234-u0bcde9876-12345"
 	msg.Value = "0"
 	msg.GasPrice = "789"
-	tx, err := NewSendTxn(&msg, signer)
+	tx, err := NewSendTxn(&msg, signer, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1083,7 +1455,7 @@ func TestSendWithTXSignerFail(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	tx, err := NewSendTxn(&msg, signer)
+	tx, err := NewSendTxn(&msg, signer, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1094,6 +1466,157 @@ func TestSendWithTXSignerFail(t *testing.T) {
 	assert.EqualError(err, "pop")
 }
 
+// blockingRPCClient does not return until the context of the call is done
+type blockingRPCClient struct {
+	calls []string
+}
+
+func (r *blockingRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	r.calls = append(r.calls, method)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestSendWithTXSignerTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.Value = "0"
+	msg.Gas = "456"
+	msg.GasPrice = "789"
+	signer := &mockBlockedTXSigner{mockTXSigner{
+		from: "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	}}
+	tx, err := NewSendTxn(&msg, signer, false)
+	assert.Nil(err)
+	tx.Timeouts.Sign = 10 * time.Millisecond
+
+	rpc := testRPCClient{}
+	err = tx.Send(context.Background(), &rpc)
+	assert.EqualError(err, "Transaction signing did not complete within 10ms")
+	assert.Equal("", rpc.capturedMethod)
+	assert.Greater(tx.StageTimes.Sign, float64(0))
+}
+
+func TestSendGasEstimateTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Value = "0"
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(&msg, nil, false)
+	assert.Nil(err)
+	tx.Timeouts.GasEstimate = 10 * time.Millisecond
+
+	rpc := &blockingRPCClient{}
+	err = tx.Send(context.Background(), rpc)
+	assert.EqualError(err, "Transaction gas estimation did not complete within 10ms")
+	assert.Equal([]string{"eth_estimateGas"}, rpc.calls)
+	assert.Greater(tx.StageTimes.GasEstimate, float64(0))
+}
+
+func TestSendSubmitTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Value = "0"
+	msg.Gas = "456"
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(&msg, nil, false)
+	assert.Nil(err)
+	tx.Timeouts.Submit = 10 * time.Millisecond
+
+	rpc := &blockingRPCClient{}
+	err = tx.Send(context.Background(), rpc)
+	assert.EqualError(err, "Transaction submission did not complete within 10ms")
+	assert.Equal([]string{"eth_sendTransaction"}, rpc.calls)
+	assert.Greater(tx.StageTimes.Submit, float64(0))
+	assert.Equal(float64(0), tx.StageTimes.GasEstimate)
+}
+
+type resetRPCClient struct{}
+
+func (r *resetRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return fmt.Errorf("read tcp 127.0.0.1:8545: connection reset by peer")
+}
+
+func TestSendSubmitConnectionReset(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Value = "0"
+	msg.Gas = "456"
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(&msg, nil, false)
+	assert.Nil(err)
+
+	err = tx.Send(context.Background(), &resetRPCClient{})
+	assert.Regexp("Transaction submission might have reached the node.*connection reset by peer", err)
+	assert.True(errors.IsAlreadySubmitted(err))
+	assert.False(errors.IsRetryable(err))
+}
+
+func TestSendCancelledContextNotStageTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.From = "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"
+	msg.Value = "0"
+	msg.Gas = "456"
+	msg.GasPrice = "789"
+	tx, err := NewSendTxn(&msg, nil, false)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = tx.Send(ctx, &blockingRPCClient{})
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+func TestSendWithTXSignerStageTimes(t *testing.T) {
+	assert := assert.New(t)
+
+	var msg messages.SendTransaction
+	msg.Parameters = []interface{}{}
+	msg.MethodName = "testFunc"
+	msg.To = "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"
+	msg.Value = "0"
+	msg.GasPrice = "789"
+	signer := &mockTXSigner{
+		signed: []byte("testbytes"),
+		from:   "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	}
+	tx, err := NewSendTxn(&msg, signer, false)
+	assert.Nil(err)
+
+	rpc := testRPCClient{}
+	err = tx.Send(context.Background(), &rpc)
+	assert.NoError(err)
+	assert.Equal("eth_sendRawTransaction", rpc.capturedMethod2)
+	assert.Greater(tx.StageTimes.GasEstimate, float64(0))
+	assert.Greater(tx.StageTimes.Sign, float64(0))
+	assert.Greater(tx.StageTimes.Submit, float64(0))
+	assert.Equal(float64(0), tx.StageTimes.Compile)
+}
+
 func TestSendWithTXSignerFailPrivate(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1113,7 +1636,7 @@ func TestSendWithTXSignerFailPrivate(t *testing.T) {
 	msg.Gas = "456"
 	msg.GasPrice = "789"
 	msg.PrivateFor = []string{"anything"}
-	tx, err := NewSendTxn(&msg, signer)
+	tx, err := NewSendTxn(&msg, signer, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1141,7 +1664,7 @@ func TestNewContractWithTXSignerOK(t *testing.T) {
 	msg.GasPrice = "789"
 	msg.Solidity = simpleStorage
 	msg.Parameters = []interface{}{"12345"}
-	tx, err := NewContractDeployTxn(&msg, signer)
+	tx, err := NewContractDeployTxn(&msg, signer, false, 0)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1195,7 +1718,7 @@ func TestSendTxnRPFError(t *testing.T) {
 	msg.Gas = "456"
 	msg.GasPrice = "789"
 	msg.Nonce = "12345"
-	tx, err := NewSendTxn(&msg, nil)
+	tx, err := NewSendTxn(&msg, nil, false)
 	assert.Nil(err)
 	msgBytes, _ := json.Marshal(&msg)
 	log.Infof(string(msgBytes))
@@ -1228,7 +1751,7 @@ func TestSendTxnInlineBadParamType(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Param 0: Unable to map badness to etherueum type", err.Error())
 }
 
@@ -1251,7 +1774,7 @@ func TestSendTxnInlineMissingParamType(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Param 0: supplied as an object must have 'type' and 'value' fields", err.Error())
 }
 
@@ -1274,7 +1797,7 @@ func TestSendTxnInlineMissingParamValue(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Param 0: supplied as an object must have 'type' and 'value' fields", err.Error())
 }
 
@@ -1298,7 +1821,7 @@ func TestSendTxnInlineBadTypeType(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Param 0: supplied as an object must be string", err.Error())
 }
 func TestSendTxnBadInputType(t *testing.T) {
@@ -1320,7 +1843,7 @@ func TestSendTxnBadInputType(t *testing.T) {
 			},
 		},
 	}
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("unsupported arg type: badness", err.Error())
 }
 
@@ -1336,7 +1859,7 @@ func TestSendTxnMissingMethod(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Method missing", err.Error())
 }
 func TestSendTxnBadFrom(t *testing.T) {
@@ -1365,7 +1888,7 @@ func TestSendTxnBadFrom(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Supplied value for 'from' is not a valid hex address", err.Error())
 }
 
@@ -1395,7 +1918,7 @@ func TestSendTxnBadTo(t *testing.T) {
 	msg.Value = "0"
 	msg.Gas = "456"
 	msg.GasPrice = "789"
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("Supplied value for 'to' is not a valid hex address", err.Error())
 }
 
@@ -1418,7 +1941,7 @@ func TestSendTxnBadOutputType(t *testing.T) {
 			},
 		},
 	}
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("unsupported arg type: badness", err.Error())
 }
 
@@ -1442,7 +1965,7 @@ func TestSendBadParams(t *testing.T) {
 			},
 		},
 	}
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("param 0: Could not be converted to a number", err.Error())
 }
 
@@ -1466,7 +1989,7 @@ func TestSendTxnPackError(t *testing.T) {
 			},
 		},
 	}
-	_, err := NewSendTxn(&msg, nil)
+	_, err := NewSendTxn(&msg, nil, false)
 	assert.Regexp("cannot use \\[0\\]uint8 as type \\[1\\]uint8 as argument", err.Error())
 }
 
@@ -1527,6 +2050,90 @@ func TestProcessRLPBytesValidTypes(t *testing.T) {
 	assert.Equal("456", res["retval9"].([]interface{})[1])
 }
 
+func TestProcessRLPBytesNestedArrays(t *testing.T) {
+	assert := assert.New(t)
+
+	t1, _ := ethbind.API.ABITypeFor("uint256[][]")
+	t2, _ := ethbind.API.ABITypeFor("bytes4[2][]")
+	t3, _ := ethbind.API.ABITypeFor("int8[2][2]")
+	outputs := ethbinding.ABIArguments{
+		{Name: "retval1", Type: t1},
+		{Name: "retval2", Type: t2},
+		{Name: "retval3", Type: t3},
+	}
+	rlp, err := outputs.Pack(
+		[][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {big.NewInt(3)}},
+		[][2][4]byte{{{0xfe, 0xed, 0xbe, 0xef}, {0x12, 0x34, 0x56, 0x78}}},
+		[2][2]int8{{-1, 2}, {3, -4}},
+	)
+	assert.NoError(err)
+
+	res := ProcessRLPBytes(outputs, rlp)
+	assert.Nil(res["error"])
+	assert.Equal([]interface{}{[]interface{}{"1", "2"}, []interface{}{"3"}}, res["retval1"])
+	assert.Equal([]interface{}{[]interface{}{"0xfeedbeef", "0x12345678"}}, res["retval2"])
+	assert.Equal([]interface{}{[]interface{}{"-1", "2"}, []interface{}{"3", "-4"}}, res["retval3"])
+}
+
+func TestProcessRLPBytesNestedTupleArrays(t *testing.T) {
+	assert := assert.New(t)
+
+	var methodABI ethbinding.ABIElementMarshaling
+	err := json.Unmarshal([]byte(`{
+		"type": "function",
+		"name": "nestedTuples",
+		"inputs": [
+			{"name": "a", "type": "tuple[]", "components": [
+				{"name": "_x", "type": "uint256"},
+				{"name": "inner", "type": "tuple[][]", "components": [
+					{"name": "snake_case", "type": "string"},
+					{"name": "flag", "type": "bool"}
+				]}
+			]},
+			{"name": "b", "type": "tuple[2]", "components": [
+				{"name": "y", "type": "uint8[2][]"},
+				{"name": "z", "type": "address"}
+			]}
+		]
+	}`), &methodABI)
+	assert.NoError(err)
+	method, err := ethbind.API.ABIElementMarshalingToABIMethod(&methodABI)
+	assert.NoError(err)
+
+	a := []interface{}{
+		map[string]interface{}{
+			"_x": "1",
+			"inner": []interface{}{
+				[]interface{}{map[string]interface{}{"snake_case": "hi", "flag": true}},
+			},
+		},
+	}
+	b := []interface{}{
+		map[string]interface{}{"y": []interface{}{[]interface{}{float64(1), float64(2)}}, "z": "0x1212121212121212121212121212121212121212"},
+		map[string]interface{}{"y": []interface{}{}, "z": "0x2121212121212121212121212121212121212121"},
+	}
+	tx := Txn{}
+	args, err := tx.generateTypedArgs([]interface{}{a, b}, method)
+	assert.NoError(err)
+	rlp, err := method.Inputs.Pack(args...)
+	assert.NoError(err)
+
+	res := ProcessRLPBytes(method.Inputs, rlp)
+	assert.Nil(res["error"])
+	assert.Equal([]interface{}{
+		map[string]interface{}{
+			"_x": "1",
+			"inner": []interface{}{
+				[]interface{}{map[string]interface{}{"snake_case": "hi", "flag": true}},
+			},
+		},
+	}, res["a"])
+	assert.Equal([]interface{}{
+		map[string]interface{}{"y": []interface{}{[]interface{}{"1", "2"}}, "z": "0x1212121212121212121212121212121212121212"},
+		map[string]interface{}{"y": []interface{}{}, "z": "0x2121212121212121212121212121212121212121"},
+	}, res["b"])
+}
+
 func TestProcessRLPV2ABIEncodedStructs(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1692,6 +2299,50 @@ func TestGenTupleMapOutputBadTypeValMismatch(t *testing.T) {
 	assert.EqualError(err, "Expected number type in JSON/RPC response for test.field1 (uint256). Received string")
 }
 
+func TestGenTupleMapOutputUnnamedField(t *testing.T) {
+	assert := assert.New(t)
+	type random struct{ Field1 *big.Int }
+	tUint, _ := ethbind.API.ABITypeFor("uint256")
+	res, err := genTupleMapOutput("test", "random", &ethbinding.ABIType{
+		TupleType:     reflect.TypeOf((*random)(nil)).Elem(),
+		TupleRawNames: []string{""},
+		TupleElems:    []*ethbinding.ABIType{&tUint},
+	}, random{Field1: big.NewInt(42)})
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{"Field1": "42"}, res)
+}
+
+func TestDecodeMethodInputs(t *testing.T) {
+	assert := assert.New(t)
+
+	method, err := ethbind.API.ABIElementMarshalingToABIMethod(&ethbinding.ABIElementMarshaling{
+		Type: "function",
+		Name: "set",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "key", Type: "string"},
+			{Name: "", Type: "uint256"},
+			{Name: "", Type: "bool"},
+		},
+	})
+	assert.NoError(err)
+	data, err := EncodeMethodCall(method, []interface{}{"hello", "42", true}, false)
+	assert.NoError(err)
+
+	res, err := DecodeMethodInputs(method, data)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"key":    "hello",
+		"input1": "42",
+		"input2": true,
+	}, res)
+
+	_, err = DecodeMethodInputs(method, []byte{0xfe, 0xed})
+	assert.EqualError(err, "Calldata does not match the selector of method 'set(string,uint256,bool)'")
+
+	_, err = DecodeMethodInputs(method, data[0:40])
+	assert.Regexp("Failed to unpack values", err)
+}
+
 func TestProcessRLPBytesInvalidNumber(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1828,3 +2479,302 @@ func TestProcessOutputsBadArgs(t *testing.T) {
 	err := processOutputs(methodABI.Outputs, []interface{}{"arg1"}, make(map[string]interface{}))
 	assert.EqualError(err, "Expected slice type in JSON/RPC response for retval1 (int32[]). Received string")
 }
+
+func TestCallMethodPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	params := []interface{}{}
+
+	method := &ethbinding.ABIMethod{}
+	method.Name = "testFunc"
+
+	rpc := &testRPCClient{
+		resultWrangler: func(retString interface{}) {
+			retVal := "0x4e487b710000000000000000000000000000000000000000000000000000000000000011"
+			reflect.ValueOf(retString).Elem().Set(reflect.ValueOf(retVal))
+		},
+	}
+
+	_, err := CallMethod(context.Background(), rpc, nil,
+		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
+		json.Number("12345"), method, params, "", false)
+
+	assert.Equal("eth_call", rpc.capturedMethod)
+	assert.EqualError(err, "EVM panic (code 0x11): Arithmetic operation resulted in underflow or overflow")
+}
+
+func TestCallMethodPanicUnknownCode(t *testing.T) {
+	assert := assert.New(t)
+
+	params := []interface{}{}
+
+	method := &ethbinding.ABIMethod{}
+	method.Name = "testFunc"
+
+	rpc := &testRPCClient{
+		resultWrangler: func(retString interface{}) {
+			retVal := "0x4e487b7100000000000000000000000000000000000000000000000000000000000000ff"
+			reflect.ValueOf(retString).Elem().Set(reflect.ValueOf(retVal))
+		},
+	}
+
+	_, err := CallMethod(context.Background(), rpc, nil,
+		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
+		json.Number("12345"), method, params, "", false)
+
+	assert.EqualError(err, "EVM panic (code 0xff): Unknown panic code")
+}
+
+func TestCallMethodPanicBadCode(t *testing.T) {
+	assert := assert.New(t)
+
+	params := []interface{}{}
+
+	method := &ethbinding.ABIMethod{}
+	method.Name = "testFunc"
+
+	rpc := &testRPCClient{
+		resultWrangler: func(retString interface{}) {
+			retVal := "0x4e487b71000000000000000000000000000000000000000000000000000000000000!!!!"
+			reflect.ValueOf(retString).Elem().Set(reflect.ValueOf(retVal))
+		},
+	}
+
+	_, err := CallMethod(context.Background(), rpc, nil,
+		"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+		"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
+		json.Number("12345"), method, params, "", false)
+
+	assert.EqualError(err, "EVM reverted. Failed to decode error message")
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("EVM panic (code 0x12): Division or modulo by zero",
+		DecodeRevertReason("0x4e487b710000000000000000000000000000000000000000000000000000000000000012", nil))
+	assert.Equal("Not enough Ether provided.",
+		DecodeRevertReason("0x08c379a0"+
+			"0000000000000000000000000000000000000000000000000000000000000020"+
+			"000000000000000000000000000000000000000000000000000000000000001a"+
+			"4e6f7420656e6f7567682045746865722070726f76696465642e000000000000", nil))
+	assert.Equal("0x12345678", DecodeRevertReason("0x12345678", nil))
+}
+
+var testErrorABI = ethbinding.ABIMarshaling{
+	{Type: "function", Name: "withdraw"},
+	{Type: "error", Name: "InsufficientBalance", Inputs: []ethbinding.ABIArgumentMarshaling{
+		{Name: "available", Type: "uint256"},
+		{Name: "required", Type: "uint256"},
+	}},
+}
+
+const testInsufficientBalanceData = "0xcf479181" +
+	"0000000000000000000000000000000000000000000000000000000000000064" +
+	"00000000000000000000000000000000000000000000000000000000000000c8"
+
+type testRPCDataError struct {
+	data interface{}
+}
+
+func (e *testRPCDataError) Error() string {
+	return "execution reverted"
+}
+
+func (e *testRPCDataError) ErrorData() interface{} {
+	return e.data
+}
+
+func newTestRevertTxn() *Txn {
+	to := ethbind.API.HexToAddress("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832")
+	return &Txn{
+		Hash:  "0xac18e98664e160305cdb77e75e5eae32e55447e94ad8ceb0123729589ed09f8b",
+		EthTX: ethbind.API.NewTransaction(0, to, big.NewInt(0), 100000, big.NewInt(0), []byte{0x3c, 0xcf, 0xd6, 0x0b}),
+	}
+}
+
+func TestDecodeRevertReasonCustomError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(ethbinding.ABIMarshaling{testErrorABI[1]}, ErrorEntries(testErrorABI))
+	assert.Equal(`Custom error InsufficientBalance: {"available":"100","required":"200"}`,
+		DecodeRevertReason(testInsufficientBalanceData, testErrorABI))
+	assert.Equal(testInsufficientBalanceData, DecodeRevertReason(testInsufficientBalanceData, nil))
+	assert.Regexp("Custom error InsufficientBalance \\(failed to decode arguments",
+		DecodeRevertReason("0xcf47918100", testErrorABI))
+	assert.Equal("0xnothex", DecodeRevertReason("0xnothex", testErrorABI))
+}
+
+func TestGetRevertReasonFromErrorData(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testRPCClient{
+		mockError: &testRPCDataError{data: testInsufficientBalanceData},
+	}
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	reason := newTestRevertTxn().GetRevertReason(context.Background(), rpc, &blockNumber, testErrorABI)
+	assert.Equal(`Custom error InsufficientBalance: {"available":"100","required":"200"}`, reason)
+	assert.Equal("eth_call", rpc.capturedMethod)
+	assert.Equal("0x3039", rpc.capturedArgs[1])
+	assert.Equal(ethbinding.HexUint64(100000), *rpc.capturedArgs[0].(*SendTXArgs).Gas)
+}
+
+func TestGetRevertReasonFromResult(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*string)) = "0x4e487b710000000000000000000000000000000000000000000000000000000000000001"
+		},
+	}
+	reason := newTestRevertTxn().GetRevertReason(context.Background(), rpc, nil, nil)
+	assert.Equal("EVM panic (code 0x1): Assertion failed", reason)
+	assert.Equal("latest", rpc.capturedArgs[1])
+}
+
+func TestGetRevertReasonNoRevertData(t *testing.T) {
+	assert := assert.New(t)
+
+	// The output of a call that succeeds on replay is not a revert reason
+	rpc := &testRPCClient{
+		resultWrangler: func(result interface{}) {
+			*(result.(*string)) = "0x0000000000000000000000000000000000000000000000000000000000000001"
+		},
+	}
+	assert.Equal("", newTestRevertTxn().GetRevertReason(context.Background(), rpc, nil, testErrorABI))
+
+	rpc = &testRPCClient{mockError: &testRPCDataError{data: "0x"}}
+	assert.Equal("", newTestRevertTxn().GetRevertReason(context.Background(), rpc, nil, testErrorABI))
+
+	rpc = &testRPCClient{mockError: fmt.Errorf("pop")}
+	assert.Equal("", newTestRevertTxn().GetRevertReason(context.Background(), rpc, nil, testErrorABI))
+}
+
+type testBatchRPCClient struct {
+	batch    []RPCBatchElem
+	results  []string
+	errors   []error
+	batchErr error
+	deadline time.Time
+}
+
+func (r *testBatchRPCClient) BatchCallContext(ctx context.Context, b []RPCBatchElem) error {
+	r.batch = b
+	r.deadline, _ = ctx.Deadline()
+	for i := range b {
+		if i < len(r.errors) && r.errors[i] != nil {
+			b[i].Error = r.errors[i]
+			continue
+		}
+		reflect.ValueOf(b[i].Result).Elem().Set(reflect.ValueOf(r.results[i]))
+	}
+	return r.batchErr
+}
+
+func testBatchMethod() *ethbinding.ABIMethod {
+	addressType, _ := ethbind.API.ABITypeFor("address")
+	uint256Type, _ := ethbind.API.ABITypeFor("uint256")
+	inputs := ethbinding.ABIArguments{ethbinding.ABIArgument{Name: "owner", Type: addressType}}
+	outputs := ethbinding.ABIArguments{ethbinding.ABIArgument{Name: "balance", Type: uint256Type}}
+	method := ethbind.API.NewMethod("balanceOf", "balanceOf", ethbinding.Function, "view", true, false, inputs, outputs)
+	return &method
+}
+
+func TestCallMethods(t *testing.T) {
+	assert := assert.New(t)
+
+	method := testBatchMethod()
+	rpc := &testBatchRPCClient{
+		results: []string{
+			"0x000000000000000000000000000000000000000000000000000000000001e240",
+			"",
+			"0x4e487b710000000000000000000000000000000000000000000000000000000000000011",
+		},
+		errors: []error{nil, fmt.Errorf("pop")},
+	}
+	calls := []*MethodCall{
+		{Addr: "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", MethodABI: method, Params: []interface{}{"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"}},
+		{Addr: "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", MethodABI: method, Params: []interface{}{"not an address"}},
+		{Addr: "0x567a417717cb6c59ddc1035705f02c0fd1ab1872", MethodABI: method, Params: []interface{}{"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"}},
+		{Addr: "0x0123456789abcdef0123456789abcdef01234567", MethodABI: method, Params: []interface{}{"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"}},
+	}
+	err := CallMethods(context.Background(), rpc, "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c", "", calls, "12345", false)
+	assert.NoError(err)
+
+	assert.Len(rpc.batch, 3)
+	assert.Equal("eth_call", rpc.batch[0].Method)
+	assert.Equal("0x3039", rpc.batch[0].Args[1])
+
+	assert.Equal(map[string]interface{}{"balance": "123456"}, calls[0].Result)
+	assert.Regexp("Could not be converted to a hex address", calls[1].Err)
+	assert.Regexp("pop", calls[2].Err)
+	assert.Regexp("Arithmetic operation resulted in underflow or overflow", calls[3].Err)
+}
+
+func TestCallMethodsTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := func() []*MethodCall {
+		return []*MethodCall{
+			{Addr: "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", MethodABI: testBatchMethod(), Params: []interface{}{"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"}},
+		}
+	}
+
+	// The default applies when the request sets no timeout
+	rpc := &testBatchRPCClient{results: []string{""}}
+	err := CallMethods(context.Background(), rpc, "", "", calls(), "", false)
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().Add(30*time.Second), rpc.deadline, 5*time.Second)
+
+	// An RPC timeout longer than the default is not cut short - the RPC client applies it to the batch
+	rpc = &testBatchRPCClient{results: []string{""}}
+	err = CallMethods(WithRPCTimeout(context.Background(), 90*time.Second), rpc, "", "", calls(), "", false)
+	assert.NoError(err)
+	assert.True(rpc.deadline.IsZero())
+
+	// As is the deadline of the caller
+	rpc = &testBatchRPCClient{results: []string{""}}
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+	err = CallMethods(ctx, rpc, "", "", calls(), "", false)
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().Add(90*time.Second), rpc.deadline, 5*time.Second)
+}
+
+func TestCallMethodsBatchFail(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBatchRPCClient{
+		results:  []string{""},
+		batchErr: fmt.Errorf("pop"),
+	}
+	calls := []*MethodCall{
+		{Addr: "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", MethodABI: testBatchMethod(), Params: []interface{}{"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"}},
+	}
+	err := CallMethods(context.Background(), rpc, "", "", calls, "", false)
+	assert.Regexp("pop", err)
+}
+
+func TestCallMethodsBadBlockNumber(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBatchRPCClient{}
+	err := CallMethods(context.Background(), rpc, "", "", []*MethodCall{}, "bad", false)
+	assert.Regexp("Invalid blocknumber", err)
+	assert.Nil(rpc.batch)
+}
+
+func TestCallMethodsNoValidCalls(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := &testBatchRPCClient{}
+	calls := []*MethodCall{
+		{Addr: "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", MethodABI: testBatchMethod(), Params: []interface{}{}},
+	}
+	err := CallMethods(context.Background(), rpc, "", "", calls, "", false)
+	assert.NoError(err)
+	assert.Error(calls[0].Err)
+	assert.Nil(rpc.batch)
+}
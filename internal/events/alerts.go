@@ -0,0 +1,204 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AlertConditionErrorRate the proportion of failed deliveries on a stream exceeded the threshold
+	AlertConditionErrorRate = "errorRate"
+	// AlertConditionLag a stream fell further behind the head of the chain than the threshold
+	AlertConditionLag = "lag"
+	// AlertStatusFiring the condition has started
+	AlertStatusFiring = "firing"
+	// AlertStatusResolved the condition has cleared
+	AlertStatusResolved = "resolved"
+	// DefaultAlertIntervalSec is how often the streams are checked, when alerting is enabled
+	DefaultAlertIntervalSec = 60
+)
+
+// AlertConf configures a webhook to notify when a stream is failing to deliver events,
+// or falling behind the chain. This is separate to the webhooks that deliver the events,
+// so the operators of the gateway learn about failing consumers
+type AlertConf struct {
+	URL                string            `json:"url,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	RequestTimeoutSec  uint32            `json:"requestTimeoutSec,omitempty"`
+	IntervalSec        uint64            `json:"intervalSec,omitempty"`
+	ErrorRateThreshold float64           `json:"errorRateThreshold,omitempty"` // Proportion of failed deliveries in an interval, from 0 to 1
+	LagThreshold       uint64            `json:"lagThreshold,omitempty"`       // Number of blocks behind the head of the chain
+}
+
+// StreamAlert is the payload posted to the alert webhook, when a condition starts and when it clears
+type StreamAlert struct {
+	Stream    string  `json:"stream"`
+	Name      string  `json:"name,omitempty"`
+	Condition string  `json:"condition"`
+	Status    string  `json:"status"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Timestamp string  `json:"timestamp"`
+}
+
+// startAlerts kicks off the periodic check, if an alert webhook and a threshold are configured
+func (s *subscriptionMGR) startAlerts() error {
+	alertConf := s.conf.Alerts
+	if alertConf == nil || alertConf.URL == "" || (alertConf.ErrorRateThreshold == 0 && alertConf.LagThreshold == 0) {
+		return nil
+	}
+	if u, err := url.Parse(alertConf.URL); err != nil || u.Host == "" {
+		return errors.Errorf(errors.EventStreamsAlertInvalidURL, alertConf.URL)
+	}
+	if alertConf.IntervalSec == 0 {
+		alertConf.IntervalSec = DefaultAlertIntervalSec
+	}
+	if alertConf.RequestTimeoutSec == 0 {
+		alertConf.RequestTimeoutSec = 30
+	}
+	s.alertsFiring = make(map[string]bool)
+	s.alertStop = make(chan struct{})
+	s.alertDone = make(chan struct{})
+	go func() {
+		defer close(s.alertDone)
+		s.alertLoop(time.Duration(alertConf.IntervalSec) * time.Second)
+	}()
+	return nil
+}
+
+func (s *subscriptionMGR) alertLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.alertStop:
+			return
+		case <-ticker.C:
+			s.checkStreamAlerts(context.Background())
+		}
+	}
+}
+
+// checkStreamAlerts compares each stream against the thresholds, and notifies the webhook
+// of any condition that has started or cleared since the last check. Suspended streams are
+// expected to fall behind, so are not checked
+func (s *subscriptionMGR) checkStreamAlerts(ctx context.Context) {
+	alertConf := s.conf.Alerts
+	var blockHeight *big.Int
+	if alertConf.LagThreshold > 0 {
+		hexBlock := ethbinding.HexBigInt{}
+		if err := s.rpc.CallContext(ctx, &hexBlock, "eth_blockNumber"); err != nil {
+			log.Errorf("Failed to query block height to check stream lag: %s", err)
+		} else {
+			blockHeight = hexBlock.ToInt()
+		}
+	}
+	for _, stream := range s.allStreams() {
+		attempts, failures, suspended := stream.deliveryStats()
+		if suspended {
+			continue
+		}
+		if alertConf.ErrorRateThreshold > 0 && attempts > 0 {
+			errorRate := float64(failures) / float64(attempts)
+			s.updateAlert(stream.spec, AlertConditionErrorRate, errorRate, alertConf.ErrorRateThreshold)
+		}
+		if blockHeight != nil {
+			if lag, ok := s.streamLag(stream.spec.ID, blockHeight); ok {
+				s.updateAlert(stream.spec, AlertConditionLag, float64(lag), float64(alertConf.LagThreshold))
+			}
+		}
+	}
+}
+
+// streamLag returns how many blocks the furthest behind subscription on a stream is
+// from the head of the chain. Subscriptions that have not started are ignored
+func (s *subscriptionMGR) streamLag(streamID string, blockHeight *big.Int) (uint64, bool) {
+	var lag uint64
+	found := false
+	for _, sub := range s.subscriptionsForStream(streamID) {
+		hwm := sub.blockHWM()
+		if hwm.Sign() <= 0 {
+			continue
+		}
+		found = true
+		if diff := new(big.Int).Sub(blockHeight, &hwm); diff.Sign() > 0 && diff.Uint64() > lag {
+			lag = diff.Uint64()
+		}
+	}
+	return lag, found
+}
+
+// updateAlert fires an alert when a value exceeds the threshold, and resolves it when it drops back
+func (s *subscriptionMGR) updateAlert(spec *StreamInfo, condition string, value, threshold float64) {
+	key := spec.ID + "/" + condition
+	exceeded := value > threshold
+	if exceeded == s.alertsFiring[key] {
+		return
+	}
+	s.alertsFiring[key] = exceeded
+	alert := &StreamAlert{
+		Stream:    spec.ID,
+		Name:      spec.Name,
+		Condition: condition,
+		Status:    AlertStatusResolved,
+		Value:     value,
+		Threshold: threshold,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if exceeded {
+		alert.Status = AlertStatusFiring
+		log.Warnf("%s: Stream alert %s firing. Value=%v Threshold=%v", spec.ID, condition, value, threshold)
+	} else {
+		log.Infof("%s: Stream alert %s resolved. Value=%v Threshold=%v", spec.ID, condition, value, threshold)
+	}
+	s.postAlert(alert)
+}
+
+// postAlert sends an alert to the webhook. Failures are logged, and not retried
+func (s *subscriptionMGR) postAlert(alert *StreamAlert) {
+	alertConf := s.conf.Alerts
+	netClient := &http.Client{
+		Timeout: time.Duration(alertConf.RequestTimeoutSec) * time.Second,
+	}
+	reqBytes, _ := json.Marshal(alert)
+	req, err := http.NewRequest("POST", alertConf.URL, bytes.NewReader(reqBytes))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		for h, v := range alertConf.Headers {
+			req.Header.Set(h, v)
+		}
+		var res *http.Response
+		if res, err = netClient.Do(req); err == nil {
+			res.Body.Close()
+			if res.StatusCode < 200 || res.StatusCode >= 300 {
+				err = errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, alert.Stream, res.StatusCode)
+			}
+		}
+	}
+	if err != nil {
+		log.Errorf("%s: Failed to post %s alert: %s", alert.Stream, alert.Condition, err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAlertServer(status int) (*httptest.Server, chan *StreamAlert) {
+	alerts := make(chan *StreamAlert, 10)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var alert StreamAlert
+		json.NewDecoder(req.Body).Decode(&alert)
+		alerts <- &alert
+		res.WriteHeader(status)
+	}))
+	return svr, alerts
+}
+
+func TestCheckStreamAlertsErrorRate(t *testing.T) {
+	assert := assert.New(t)
+	svr, alerts := newTestAlertServer(204)
+	defer svr.Close()
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+	sm.conf.Alerts = &AlertConf{URL: svr.URL, ErrorRateThreshold: 0.5}
+	sm.alertsFiring = make(map[string]bool)
+	es := sm.streams[stream.ID]
+
+	es.markDeliveryResult(fmt.Errorf("pop"))
+	es.markDeliveryResult(fmt.Errorf("pop"))
+	es.markDeliveryResult(nil)
+	sm.checkStreamAlerts(ctx)
+	alert := <-alerts
+	assert.Equal(stream.ID, alert.Stream)
+	assert.Equal(AlertConditionErrorRate, alert.Condition)
+	assert.Equal(AlertStatusFiring, alert.Status)
+	assert.InDelta(0.667, alert.Value, 0.001)
+	assert.Equal(0.5, alert.Threshold)
+
+	// Still failing - no repeat
+	es.markDeliveryResult(fmt.Errorf("pop"))
+	sm.checkStreamAlerts(ctx)
+	// No deliveries - no change
+	sm.checkStreamAlerts(ctx)
+	assert.Empty(alerts)
+
+	es.markDeliveryResult(nil)
+	sm.checkStreamAlerts(ctx)
+	alert = <-alerts
+	assert.Equal(AlertStatusResolved, alert.Status)
+	assert.Equal(float64(0), alert.Value)
+}
+
+func TestCheckStreamAlertsLag(t *testing.T) {
+	assert := assert.New(t)
+	svr, alerts := newTestAlertServer(200)
+	defer svr.Close()
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+	sm.conf.Alerts = &AlertConf{URL: svr.URL, LagThreshold: 10, Headers: map[string]string{"x-alert": "test"}}
+	sm.alertsFiring = make(map[string]bool)
+	sm.rpc = eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		*(res.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*big.NewInt(120))
+	})
+
+	// Not started
+	sm.checkStreamAlerts(ctx)
+	assert.Empty(alerts)
+
+	// Wait for the poller to initialize the subscription, before setting its position
+	for sm.subscriptions[sub.ID].filterStale {
+		time.Sleep(1 * time.Millisecond)
+	}
+	sm.subscriptions[sub.ID].lp.initBlockHWM(big.NewInt(100))
+	sm.checkStreamAlerts(ctx)
+	alert := <-alerts
+	assert.Equal(AlertConditionLag, alert.Condition)
+	assert.Equal(AlertStatusFiring, alert.Status)
+	assert.Equal(float64(20), alert.Value)
+	assert.Equal(float64(10), alert.Threshold)
+
+	// Suspended streams are expected to lag
+	err := sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+	sm.checkStreamAlerts(ctx)
+	assert.Empty(alerts)
+}
+
+func TestCheckStreamAlertsLagRPCFail(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	sm.conf.Alerts = &AlertConf{URL: "http://test.invalid", LagThreshold: 10}
+	sm.alertsFiring = make(map[string]bool)
+	sm.rpc = eth.NewMockRPCClientForSync(fmt.Errorf("pop"), nil)
+
+	sm.checkStreamAlerts(context.Background())
+	assert.Empty(sm.alertsFiring)
+}
+
+func TestPostAlertFailures(t *testing.T) {
+	svr, alerts := newTestAlertServer(500)
+	defer svr.Close()
+	sm := newTestSubscriptionManager()
+	sm.conf.Alerts = &AlertConf{URL: svr.URL}
+	sm.postAlert(&StreamAlert{Stream: "es1"})
+	<-alerts
+
+	sm.conf.Alerts.URL = "http://127.0.0.1:1"
+	sm.postAlert(&StreamAlert{Stream: "es1"})
+
+	sm.conf.Alerts.URL = "!!:bad"
+	sm.postAlert(&StreamAlert{Stream: "es1"})
+}
+
+func TestStartAlerts(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	assert.NoError(sm.startAlerts())
+	assert.Nil(sm.alertStop)
+
+	sm.conf.Alerts = &AlertConf{URL: "http://localhost:12345"}
+	assert.NoError(sm.startAlerts())
+	assert.Nil(sm.alertStop)
+
+	sm.conf.Alerts = &AlertConf{URL: "not a url", LagThreshold: 1}
+	assert.Regexp("Invalid URL 'not a url'", sm.startAlerts())
+
+	sm.conf.Alerts = &AlertConf{URL: "http://localhost:12345", LagThreshold: 1}
+	assert.NoError(sm.startAlerts())
+	assert.Equal(uint64(DefaultAlertIntervalSec), sm.conf.Alerts.IntervalSec)
+	assert.Equal(uint32(30), sm.conf.Alerts.RequestTimeoutSec)
+	sm.Close()
+	assert.True(sm.closed)
+}
+
+func TestAlertLoop(t *testing.T) {
+	svr, alerts := newTestAlertServer(200)
+	defer svr.Close()
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	sm.conf.Alerts = &AlertConf{URL: svr.URL, ErrorRateThreshold: 0.1}
+	sm.alertsFiring = make(map[string]bool)
+	sm.streams[stream.ID].markDeliveryResult(fmt.Errorf("pop"))
+
+	sm.alertStop = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sm.alertLoop(time.Millisecond)
+		close(done)
+	}()
+	<-alerts
+	close(sm.alertStop)
+	<-done
+	sm.alertStop = nil
+}
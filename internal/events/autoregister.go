@@ -0,0 +1,153 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// AutoRegisterSpec configures a subscription to an event on a factory contract, so that
+// each new contract instance announced by the event is registered in the contract registry
+type AutoRegisterSpec struct {
+	ABI          string `json:"abi"`
+	AddressField string `json:"addressField"`
+	NameField    string `json:"nameField,omitempty"`
+}
+
+// defaultRegistrationQueueLength is the number of registrations that can be waiting for the
+// worker, before the log processors that request them wait for space
+const defaultRegistrationQueueLength = 100
+
+// ContractRegistrar is implemented by the contract gateway, which owns the contract registry
+type ContractRegistrar interface {
+	RegisterContractInstance(abiID, addrHexNo0x, registerAs string) error
+}
+
+type registrationRequest struct {
+	abiID       string
+	addrHexNo0x string
+	registerAs  string
+}
+
+// registrationQueue registers contract instances on a worker, so that storing the registry
+// entry does not hold up the delivery of events on the stream that announced the instance.
+// Registrations are made one at a time, in the order they were requested
+type registrationQueue struct {
+	registrar ContractRegistrar
+	requests  chan *registrationRequest
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newRegistrationQueue(registrar ContractRegistrar) *registrationQueue {
+	q := &registrationQueue{
+		registrar: registrar,
+		requests:  make(chan *registrationRequest, defaultRegistrationQueueLength),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go q.worker()
+	return q
+}
+
+// RegisterContractInstance queues the registration, returning once it is queued
+func (q *registrationQueue) RegisterContractInstance(abiID, addrHexNo0x, registerAs string) error {
+	select {
+	case q.requests <- &registrationRequest{abiID, addrHexNo0x, registerAs}:
+		return nil
+	case <-q.stop:
+		return errors.Errorf(errors.EventStreamsAutoRegisterClosed)
+	}
+}
+
+func (q *registrationQueue) worker() {
+	defer close(q.done)
+	for {
+		select {
+		case <-q.stop:
+			return
+		case r := <-q.requests:
+			if err := q.registrar.RegisterContractInstance(r.abiID, r.addrHexNo0x, r.registerAs); err != nil {
+				log.Warnf("Failed to auto-register contract 0x%s with ABI %s: %s", r.addrHexNo0x, r.abiID, err)
+				continue
+			}
+			log.Infof("Auto-registered contract 0x%s with ABI %s", r.addrHexNo0x, r.abiID)
+		}
+	}
+}
+
+// close stops the worker, waiting for any registration in progress. Queued registrations
+// are dropped, and are made again when their events are redelivered after a restart
+func (q *registrationQueue) close() {
+	close(q.stop)
+	<-q.done
+}
+
+// validateAutoRegister checks the fields configured for auto-registration exist on the event
+func validateAutoRegister(spec *AutoRegisterSpec, event *ethbinding.ABIEvent, registrar ContractRegistrar) error {
+	if registrar == nil {
+		return errors.Errorf(errors.EventStreamsAutoRegisterUnavailable)
+	}
+	if spec.ABI == "" || spec.AddressField == "" {
+		return errors.Errorf(errors.EventStreamsAutoRegisterMissingField)
+	}
+	addressFieldOK := false
+	nameFieldOK := spec.NameField == ""
+	for _, input := range event.Inputs {
+		if input.Name == spec.AddressField && input.Type.T == ethbinding.AddressTy {
+			addressFieldOK = true
+		}
+		if input.Name == spec.NameField && input.Type.T == ethbinding.StringTy && !input.Indexed {
+			nameFieldOK = true
+		}
+	}
+	if !addressFieldOK {
+		return errors.Errorf(errors.EventStreamsAutoRegisterBadAddressField, spec.AddressField, event.Name)
+	}
+	if !nameFieldOK {
+		return errors.Errorf(errors.EventStreamsAutoRegisterBadNameField, spec.NameField, event.Name)
+	}
+	return nil
+}
+
+// autoRegister requests registration of the contract instance announced by a factory event.
+// Failures are logged rather than blocking delivery of the event
+func (lp *logProcessor) autoRegister(subInfo string, result *eventData) {
+	spec := lp.autoRegisterSpec
+	var addrHexNo0x string
+	switch addr := result.Data[spec.AddressField].(type) {
+	case ethbinding.Address:
+		addrHexNo0x = strings.TrimPrefix(strings.ToLower(addr.Hex()), "0x")
+	case string:
+		addrHexNo0x = strings.TrimPrefix(strings.ToLower(addr), "0x")
+	default:
+		log.Warnf("%s: Unable to auto-register contract - field '%s' is not an address: %v", subInfo, spec.AddressField, addr)
+		return
+	}
+	var registerAs string
+	if spec.NameField != "" {
+		registerAs = fmt.Sprintf("%v", result.Data[spec.NameField])
+	}
+	if err := lp.registrar.RegisterContractInstance(spec.ABI, addrHexNo0x, registerAs); err != nil {
+		log.Warnf("%s: Failed to auto-register contract 0x%s with ABI %s: %s", subInfo, addrHexNo0x, spec.ABI, err)
+		return
+	}
+	log.Debugf("%s: Requested auto-registration of contract 0x%s with ABI %s", subInfo, addrHexNo0x, spec.ABI)
+}
@@ -0,0 +1,251 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleFactoryEventABI = `{
+  "name": "ContractCreated",
+  "inputs": [
+    {"name": "child", "type": "address", "indexed": true},
+    {"name": "name", "type": "string"},
+    {"name": "owner", "type": "address", "indexed": true}
+  ]
+}`
+
+const sampleFactoryEventLog = `{
+  "address": "0x19e75d0d337e17835dc5246f007a1fb17f0bac89",
+  "blockNumber": "0x74082",
+  "data": "0x0000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000777696467657431000000000000000000000000000000000000000000000000",
+  "topics": [
+    "0x0000000000000000000000000000000000000000000000000000000000000000",
+    "0x0000000000000000000000003924d1d6423f88148a4fcc0417a33b27a61d595f",
+    "0x000000000000000000000000d50ce736021d9f7b0b2566a3d2fa7fa3136c003c"
+  ],
+  "transactionHash": "0x23307094299f08a1041de9f1e7ecb67197a5a3c11ce5be775a8147de266b7524",
+  "transactionIndex": "0x0"
+}`
+
+type mockRegistrar struct {
+	abiID       string
+	addrHexNo0x string
+	registerAs  string
+	err         error
+}
+
+func (m *mockRegistrar) RegisterContractInstance(abiID, addrHexNo0x, registerAs string) error {
+	m.abiID = abiID
+	m.addrHexNo0x = addrHexNo0x
+	m.registerAs = registerAs
+	return m.err
+}
+
+func newTestFactoryEvent(t *testing.T) (*ethbinding.ABIElementMarshaling, *ethbinding.ABIEvent) {
+	var marshaling ethbinding.ABIElementMarshaling
+	json.Unmarshal([]byte(sampleFactoryEventABI), &marshaling)
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&marshaling)
+	assert.NoError(t, err)
+	return &marshaling, event
+}
+
+func newTestAutoRegisterLogProcessor(t *testing.T, spec *AutoRegisterSpec, registrar ContractRegistrar) (*logProcessor, *eventStream) {
+	_, event := newTestFactoryEvent(t)
+	stream := &eventStream{
+		spec:        &StreamInfo{},
+		eventStream: make(chan *eventData, 1),
+	}
+	lp := &logProcessor{
+		event:            event,
+		stream:           stream,
+		autoRegisterSpec: spec,
+		registrar:        registrar,
+	}
+	return lp, stream
+}
+
+func TestAutoRegisterFromEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	registrar := &mockRegistrar{}
+	lp, stream := newTestAutoRegisterLogProcessor(t, &AutoRegisterSpec{
+		ABI:          "abi1",
+		AddressField: "child",
+		NameField:    "name",
+	}, registrar)
+	var l logEntry
+	json.Unmarshal([]byte(sampleFactoryEventLog), &l)
+	err := lp.processLogEntry(t.Name(), &l, 0)
+	assert.NoError(err)
+
+	ev := <-stream.eventStream
+	assert.Equal("widget1", ev.Data["name"])
+	assert.Equal("abi1", registrar.abiID)
+	assert.Equal("3924d1d6423f88148a4fcc0417a33b27a61d595f", registrar.addrHexNo0x)
+	assert.Equal("widget1", registrar.registerAs)
+}
+
+func TestAutoRegisterFromEventNoName(t *testing.T) {
+	assert := assert.New(t)
+
+	registrar := &mockRegistrar{}
+	lp, stream := newTestAutoRegisterLogProcessor(t, &AutoRegisterSpec{
+		ABI:          "abi1",
+		AddressField: "owner",
+	}, registrar)
+	var l logEntry
+	json.Unmarshal([]byte(sampleFactoryEventLog), &l)
+	err := lp.processLogEntry(t.Name(), &l, 0)
+	assert.NoError(err)
+
+	<-stream.eventStream
+	assert.Equal("d50ce736021d9f7b0b2566a3d2fa7fa3136c003c", registrar.addrHexNo0x)
+	assert.Equal("", registrar.registerAs)
+}
+
+func TestAutoRegisterFromEventFailureStillDelivers(t *testing.T) {
+	assert := assert.New(t)
+
+	registrar := &mockRegistrar{err: fmt.Errorf("pop")}
+	lp, stream := newTestAutoRegisterLogProcessor(t, &AutoRegisterSpec{
+		ABI:          "abi1",
+		AddressField: "child",
+	}, registrar)
+	var l logEntry
+	json.Unmarshal([]byte(sampleFactoryEventLog), &l)
+	err := lp.processLogEntry(t.Name(), &l, 0)
+	assert.NoError(err)
+
+	ev := <-stream.eventStream
+	assert.Equal("widget1", ev.Data["name"])
+}
+
+func TestAutoRegisterNonAddressValue(t *testing.T) {
+	assert := assert.New(t)
+
+	registrar := &mockRegistrar{}
+	lp, _ := newTestAutoRegisterLogProcessor(t, &AutoRegisterSpec{
+		ABI:          "abi1",
+		AddressField: "child",
+	}, registrar)
+	lp.autoRegister(t.Name(), &eventData{Data: map[string]interface{}{"child": 12345}})
+	assert.Empty(registrar.abiID)
+
+	lp.autoRegister(t.Name(), &eventData{Data: map[string]interface{}{"child": "0x3924D1D6423F88148A4FCC0417A33B27A61D595F"}})
+	assert.Equal("3924d1d6423f88148a4fcc0417a33b27a61d595f", registrar.addrHexNo0x)
+}
+
+func TestCreateSubscriptionAutoRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	marshaling, _ := newTestFactoryEvent(t)
+	registrar := &mockRegistrar{}
+	m := &mockSubMgr{stream: newTestStream(), registrar: registrar}
+	i := testSubInfo(marshaling)
+	i.AutoRegister = &AutoRegisterSpec{ABI: "abi1", AddressField: "child", NameField: "name"}
+	s, err := newSubscription(m, nil, nil, i)
+	assert.NoError(err)
+	assert.Equal(registrar, s.lp.registrar)
+	assert.Equal(i.AutoRegister, s.lp.autoRegisterSpec)
+
+	s, err = restoreSubscription(m, nil, i)
+	assert.NoError(err)
+	assert.Equal(registrar, s.lp.registrar)
+	assert.Equal(i.AutoRegister, s.lp.autoRegisterSpec)
+}
+
+func TestCreateSubscriptionAutoRegisterInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	marshaling, _ := newTestFactoryEvent(t)
+	m := &mockSubMgr{stream: newTestStream()}
+	i := testSubInfo(marshaling)
+	i.AutoRegister = &AutoRegisterSpec{ABI: "abi1", AddressField: "child"}
+	_, err := newSubscription(m, nil, nil, i)
+	assert.EqualError(err, "Contract auto-registration is not available without the contract gateway")
+
+	m.registrar = &mockRegistrar{}
+	i.AutoRegister = &AutoRegisterSpec{AddressField: "child"}
+	_, err = newSubscription(m, nil, nil, i)
+	assert.EqualError(err, "Contract auto-registration requires an 'abi' and an 'addressField'")
+
+	i.AutoRegister = &AutoRegisterSpec{ABI: "abi1", AddressField: "name"}
+	_, err = newSubscription(m, nil, nil, i)
+	assert.EqualError(err, "Auto-registration address field 'name' is not an address input of event 'ContractCreated'")
+
+	i.AutoRegister = &AutoRegisterSpec{ABI: "abi1", AddressField: "child", NameField: "owner"}
+	_, err = newSubscription(m, nil, nil, i)
+	assert.EqualError(err, "Auto-registration name field 'owner' is not a non-indexed string input of event 'ContractCreated'")
+}
+
+type blockingRegistrar struct {
+	registered chan string
+	release    chan struct{}
+}
+
+func (m *blockingRegistrar) RegisterContractInstance(abiID, addrHexNo0x, registerAs string) error {
+	<-m.release
+	m.registered <- addrHexNo0x
+	if addrHexNo0x == "bad" {
+		return fmt.Errorf("pop")
+	}
+	return nil
+}
+
+func TestRegistrationQueueInOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	registrar := &blockingRegistrar{
+		registered: make(chan string, 3),
+		release:    make(chan struct{}),
+	}
+	q := newRegistrationQueue(registrar)
+
+	// Queuing returns straight away, while the worker is blocked on the registry
+	assert.NoError(q.RegisterContractInstance("abi1", "bad", ""))
+	assert.NoError(q.RegisterContractInstance("abi1", "aaa", "widget1"))
+	assert.NoError(q.RegisterContractInstance("abi1", "bbb", "widget2"))
+
+	close(registrar.release)
+	assert.Equal("bad", <-registrar.registered)
+	assert.Equal("aaa", <-registrar.registered)
+	assert.Equal("bbb", <-registrar.registered)
+
+	q.close()
+	err := q.RegisterContractInstance("abi1", "ccc", "")
+	assert.EqualError(err, "Contract auto-registration stopped as the subscription manager is closing")
+}
+
+func TestWithContractRegistrar(t *testing.T) {
+	assert := assert.New(t)
+
+	registrar := &mockRegistrar{}
+	sm := NewSubscriptionManager(&SubscriptionManagerConf{}, nil, nil, WithContractRegistrar(registrar)).(*subscriptionMGR)
+	assert.Equal(registrar, sm.contractRegistrar())
+	assert.Equal(sm.registrations, sm.contractRegistrations())
+	sm.Close()
+
+	sm = NewSubscriptionManager(&SubscriptionManagerConf{}, nil, nil).(*subscriptionMGR)
+	assert.Nil(sm.contractRegistrar())
+	assert.Nil(sm.contractRegistrations())
+	sm.Close()
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// AutoResumeSpec is the block number, or time, at which a suspended stream is resumed.
+// The checkpoint of the stream is kept while it is suspended, so no events are missed.
+// Probe is set on streams paused by ErrorHandlingPause, which resume once their receiver
+// is available again
+type AutoResumeSpec struct {
+	Block string `json:"block,omitempty"`
+	Time  string `json:"time,omitempty"`
+	Probe bool   `json:"probe,omitempty"`
+}
+
+// Validate checks exactly one of the block or time is set, and normalizes it
+func (r *AutoResumeSpec) Validate() error {
+	if r.Probe || (r.Block == "") == (r.Time == "") {
+		return errors.Errorf(errors.EventStreamsSuspendUntilInvalid)
+	}
+	if r.Block != "" {
+		var bi big.Int
+		if _, ok := bi.SetString(r.Block, 0); !ok || bi.Sign() < 0 {
+			return errors.Errorf(errors.EventStreamsSuspendUntilBadBlock, r.Block)
+		}
+		r.Block = bi.Text(10)
+	} else {
+		t, err := time.Parse(time.RFC3339, r.Time)
+		if err != nil {
+			return errors.Errorf(errors.EventStreamsSuspendUntilBadTime, r.Time)
+		}
+		r.Time = t.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// SuspendStreamUntil suspends a stream, and resumes it automatically once the block
+// number or time is reached
+func (s *subscriptionMGR) SuspendStreamUntil(ctx context.Context, id string, until *AutoResumeSpec) error {
+	if err := until.Validate(); err != nil {
+		return err
+	}
+	stream, err := s.streamByID(id)
+	if err != nil {
+		return err
+	}
+	stream.suspendUntil(until)
+	// Persist the state change, so the stream still resumes after a restart
+	_, err = s.storeStream(stream.spec)
+	return err
+}
+
+// startAutoResume kicks off the periodic check for suspended streams that are due to resume
+func (s *subscriptionMGR) startAutoResume() {
+	interval := time.Duration(s.conf.EventPollingIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = time.Second
+	}
+	s.resumeStop = make(chan struct{})
+	s.resumeDone = make(chan struct{})
+	go func() {
+		defer close(s.resumeDone)
+		s.autoResumeLoop(interval)
+	}()
+}
+
+func (s *subscriptionMGR) autoResumeLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.resumeStop:
+			return
+		case <-ticker.C:
+			s.resumeDueStreams(context.Background())
+		}
+	}
+}
+
+// resumeDueStreams resumes each suspended stream whose block or time has been reached, and
+// each paused stream whose receiver responds to a probe. Probes run in the background, so a
+// slow receiver does not hold up the other streams. The block height is only queried when a
+// stream is waiting on a block
+func (s *subscriptionMGR) resumeDueStreams(ctx context.Context) {
+	var blockHeight *big.Int
+	now := time.Now().UTC()
+	for _, stream := range s.allStreams() {
+		until := stream.autoResumeState()
+		if until == nil {
+			continue
+		}
+		if until.Probe {
+			if stream.probeDue(now) {
+				s.probesWG.Add(1)
+				go s.probeAndResume(ctx, stream)
+			}
+			continue
+		}
+		due := false
+		if until.Block != "" {
+			if blockHeight == nil {
+				hexBlock := ethbinding.HexBigInt{}
+				if err := s.rpc.CallContext(ctx, &hexBlock, "eth_blockNumber"); err != nil {
+					log.Errorf("Failed to query block height to resume streams: %s", err)
+					continue
+				}
+				blockHeight = hexBlock.ToInt()
+			}
+			target, _ := new(big.Int).SetString(until.Block, 10)
+			due = target != nil && blockHeight.Cmp(target) >= 0
+		} else {
+			target, err := time.Parse(time.RFC3339, until.Time)
+			due = err == nil && !now.Before(target)
+		}
+		if !due {
+			continue
+		}
+		log.Infof("%s: Resuming stream suspended until %+v", stream.spec.ID, *until)
+		if err := s.ResumeStream(ctx, stream.spec.ID); err != nil {
+			// The processor might not have finished suspending yet, so we try again next time
+			log.Warnf("%s: Failed to resume stream: %s", stream.spec.ID, err)
+		}
+	}
+}
+
+// probeAndResume resumes a paused stream if its receiver responds to a probe
+func (s *subscriptionMGR) probeAndResume(ctx context.Context, stream *eventStream) {
+	defer s.probesWG.Done()
+	defer stream.probeDone()
+	if err := stream.probeReceiver(); err != nil {
+		log.Infof("%s: Receiver of paused stream is still unavailable: %s", stream.spec.ID, err)
+		return
+	}
+	log.Infof("%s: Resuming paused stream, as its receiver is available", stream.spec.ID)
+	if err := s.ResumeStream(ctx, stream.spec.ID); err != nil {
+		// The processor might not have finished suspending yet, so we try again next time
+		log.Warnf("%s: Failed to resume stream: %s", stream.spec.ID, err)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoResumeSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	until := &AutoResumeSpec{Block: "0x64"}
+	assert.NoError(until.Validate())
+	assert.Equal("100", until.Block)
+
+	until = &AutoResumeSpec{Time: "2021-06-01T10:00:00+01:00"}
+	assert.NoError(until.Validate())
+	assert.Equal("2021-06-01T09:00:00Z", until.Time)
+
+	assert.Regexp("Supply one of a block number or a time", (&AutoResumeSpec{}).Validate())
+	assert.Regexp("Supply one of a block number or a time", (&AutoResumeSpec{Block: "1", Time: "2021-06-01T10:00:00Z"}).Validate())
+	assert.Regexp("Invalid block number 'latest'", (&AutoResumeSpec{Block: "latest"}).Validate())
+	assert.Regexp("Invalid block number '-1'", (&AutoResumeSpec{Block: "-1"}).Validate())
+	assert.Regexp("Invalid time 'tomorrow'", (&AutoResumeSpec{Time: "tomorrow"}).Validate())
+}
+
+func waitForAutoResume(sm *subscriptionMGR, id string) {
+	for {
+		// The suspend takes a little time to complete, before the resume can succeed
+		sm.resumeDueStreams(context.Background())
+		if !sm.streams[id].spec.Suspended {
+			return
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestSuspendStreamUntilTime(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	err := sm.SuspendStreamUntil(ctx, stream.ID, &AutoResumeSpec{Time: time.Now().Add(1 * time.Hour).Format(time.RFC3339)})
+	assert.NoError(err)
+	sm.resumeDueStreams(ctx)
+	assert.True(stream.Suspended)
+	assert.NotNil(stream.AutoResume)
+
+	err = sm.SuspendStreamUntil(ctx, stream.ID, &AutoResumeSpec{Time: time.Now().Add(-1 * time.Second).Format(time.RFC3339)})
+	assert.NoError(err)
+	waitForAutoResume(sm, stream.ID)
+	assert.Nil(stream.AutoResume)
+}
+
+func TestSuspendStreamUntilBlock(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	blockHeight := int64(99)
+	sm.rpc = eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		if method == "eth_blockNumber" {
+			*(res.(*ethbinding.HexBigInt)) = ethbinding.HexBigInt(*big.NewInt(blockHeight))
+		}
+	})
+
+	err := sm.SuspendStreamUntil(ctx, stream.ID, &AutoResumeSpec{Block: "100"})
+	assert.NoError(err)
+	sm.resumeDueStreams(ctx)
+	assert.True(stream.Suspended)
+
+	blockHeight = 100
+	waitForAutoResume(sm, stream.ID)
+	assert.Nil(stream.AutoResume)
+}
+
+func TestSuspendStreamUntilBlockRPCFail(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+	sm.rpc = eth.NewMockRPCClientForSync(fmt.Errorf("pop"), nil)
+
+	err := sm.SuspendStreamUntil(ctx, stream.ID, &AutoResumeSpec{Block: "0"})
+	assert.NoError(err)
+	sm.resumeDueStreams(ctx)
+	assert.True(stream.Suspended)
+}
+
+func TestSuspendStreamUntilManualResume(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	err := sm.SuspendStreamUntil(ctx, stream.ID, &AutoResumeSpec{Block: "100"})
+	assert.NoError(err)
+	for sm.ResumeStream(ctx, stream.ID) != nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.False(stream.Suspended)
+	assert.Nil(stream.AutoResume)
+	assert.Nil(sm.streams[stream.ID].autoResumeState())
+}
+
+func TestSuspendStreamUntilErrors(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+
+	err := sm.SuspendStreamUntil(ctx, "nope", &AutoResumeSpec{})
+	assert.Regexp("Supply one of a block number or a time", err)
+
+	err = sm.SuspendStreamUntil(ctx, "nope", &AutoResumeSpec{Block: "1"})
+	assert.Regexp("Stream with ID 'nope' not found", err)
+}
+
+func TestAutoResumeLoop(t *testing.T) {
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	ctx := context.Background()
+	sm.startAutoResume()
+	sm.Close()
+
+	err := sm.SuspendStreamUntil(ctx, stream.ID, &AutoResumeSpec{Block: "0"})
+	assert.NoError(t, err)
+	sm.resumeStop = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sm.autoResumeLoop(time.Millisecond)
+		close(done)
+	}()
+	for sm.streams[stream.ID].autoResumeState() != nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+	close(sm.resumeStop)
+	<-done
+}
@@ -0,0 +1,312 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/icza/dyno"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// BootstrapConf declares event streams and subscriptions that are reconciled at startup.
+// The same format is used to export and import definitions between instances
+type BootstrapConf struct {
+	Streams []*BootstrapStream `json:"streams"`
+}
+
+// BootstrapStream is an event stream declared for bootstrap, along with its subscriptions.
+// Streams are matched by name against those that already exist
+type BootstrapStream struct {
+	StreamInfo
+	Subscriptions []*BootstrapSubscription `json:"subscriptions,omitempty"`
+}
+
+// BootstrapSubscription is a subscription declared for bootstrap.
+// Subscriptions are matched by name against those that already exist on the stream
+type BootstrapSubscription struct {
+	Name         string                           `json:"name"`
+	Address      string                           `json:"address,omitempty"`
+	Event        *ethbinding.ABIElementMarshaling `json:"event"`
+	FromBlock    string                           `json:"fromBlock,omitempty"`
+	AutoRegister *AutoRegisterSpec                `json:"autoRegister,omitempty"`
+}
+
+// streamBootstrapIgnoredFields are system generated, or managed via the API, so never drift
+var streamBootstrapIgnoredFields = []string{"id", "path", "created", "suspended"}
+
+// loadBootstrapFile reads a YAML or JSON file of stream and subscription declarations
+func loadBootstrapFile(filename string) (*BootstrapConf, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsBootstrapRead, filename, err)
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".json") {
+		// Convert YAML to JSON first (JSON is a subset of YAML, so this is safe for all files)
+		yamlGenericPayload := make(map[interface{}]interface{})
+		if err = yaml.Unmarshal(b, &yamlGenericPayload); err != nil {
+			return nil, errors.Errorf(errors.EventStreamsBootstrapParse, filename, err)
+		}
+		b, _ = json.Marshal(dyno.ConvertMapI2MapS(yamlGenericPayload))
+	}
+	var conf BootstrapConf
+	if err = json.Unmarshal(b, &conf); err != nil {
+		return nil, errors.Errorf(errors.EventStreamsBootstrapParse, filename, err)
+	}
+	return &conf, nil
+}
+
+// bootstrap reconciles the declared streams and subscriptions against those recovered
+// from the DB - creating any that are missing, and updating any that have drifted
+func (s *subscriptionMGR) bootstrap(ctx context.Context) error {
+	var streams []*BootstrapStream
+	if s.conf.Bootstrap != nil {
+		streams = append(streams, s.conf.Bootstrap.Streams...)
+	}
+	if s.conf.BootstrapFile != "" {
+		fileConf, err := loadBootstrapFile(s.conf.BootstrapFile)
+		if err != nil {
+			return err
+		}
+		streams = append(streams, fileConf.Streams...)
+	}
+	return s.ImportDefinitions(ctx, &BootstrapConf{Streams: streams})
+}
+
+// ExportDefinitions returns the definitions of all streams and their subscriptions, in the
+// format used for bootstrap. IDs and checkpoints are not included, so the result can be
+// imported into another instance. Streams without a name are exported with their ID as the name.
+// Webhook headers frequently carry credentials, so are only included when requested, and the
+// other secrets of the streams are otherwise masked as they are on the API
+func (s *subscriptionMGR) ExportDefinitions(ctx context.Context, includeHeaders bool) *BootstrapConf {
+	streams := s.allStreams()
+	defs := &BootstrapConf{
+		Streams: make([]*BootstrapStream, 0, len(streams)),
+	}
+	for _, stream := range streams {
+		bs := &BootstrapStream{}
+		b, _ := json.Marshal(stream.spec)
+		json.Unmarshal(b, &bs.StreamInfo)
+		bs.ID = ""
+		bs.Path = ""
+		bs.CreatedISO8601 = ""
+		bs.Suspended = false
+		if !includeHeaders {
+			bs.StreamInfo = *bs.StreamInfo.redacted()
+			if bs.Webhook != nil {
+				bs.Webhook.Headers = nil
+			}
+		}
+		if bs.Name == "" {
+			bs.Name = stream.spec.ID
+		}
+		for _, sub := range s.subscriptionsForStream(stream.spec.ID) {
+			bsub := &BootstrapSubscription{
+				Name:         sub.info.Name,
+				Event:        sub.info.Event,
+				FromBlock:    sub.info.FromBlock,
+				AutoRegister: sub.info.AutoRegister,
+			}
+			if len(sub.info.Filter.Addresses) > 0 {
+				bsub.Address = sub.info.Filter.Addresses[0].String()
+			}
+			bs.Subscriptions = append(bs.Subscriptions, bsub)
+		}
+		sort.Slice(bs.Subscriptions, func(i, j int) bool {
+			return bs.Subscriptions[i].Name < bs.Subscriptions[j].Name
+		})
+		defs.Streams = append(defs.Streams, bs)
+	}
+	sort.Slice(defs.Streams, func(i, j int) bool {
+		return defs.Streams[i].Name < defs.Streams[j].Name
+	})
+	return defs
+}
+
+// ImportDefinitions reconciles the supplied stream and subscription definitions, matching
+// them by name - creating any that are missing, and updating any that have drifted
+func (s *subscriptionMGR) ImportDefinitions(ctx context.Context, defs *BootstrapConf) error {
+	// Check the names up front, so we do not partially apply an invalid document
+	streamNames := make(map[string]bool)
+	for _, bs := range defs.Streams {
+		if bs.Name == "" {
+			return errors.Errorf(errors.EventStreamsBootstrapNoName)
+		}
+		if streamNames[bs.Name] {
+			return errors.Errorf(errors.EventStreamsBootstrapDuplicateName, "event stream", bs.Name)
+		}
+		streamNames[bs.Name] = true
+		subNames := make(map[string]bool)
+		for _, bsub := range bs.Subscriptions {
+			if bsub.Name == "" {
+				return errors.Errorf(errors.EventStreamsBootstrapNoName)
+			}
+			if subNames[bsub.Name] {
+				return errors.Errorf(errors.EventStreamsBootstrapDuplicateName, "subscription", bsub.Name)
+			}
+			subNames[bsub.Name] = true
+		}
+	}
+	for _, bs := range defs.Streams {
+		if err := s.bootstrapStream(ctx, bs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *subscriptionMGR) bootstrapStream(ctx context.Context, bs *BootstrapStream) error {
+	var existing *eventStream
+	for _, stream := range s.allStreams() {
+		if stream.spec.Name == bs.Name {
+			existing = stream
+			break
+		}
+	}
+
+	// Work on a deep copy, as the spec is retained (and defaulted) by the stream
+	var spec StreamInfo
+	b, _ := json.Marshal(&bs.StreamInfo)
+	json.Unmarshal(b, &spec)
+	var streamID string
+	if existing == nil {
+		log.Infof("Bootstrap: creating event stream '%s'", bs.Name)
+		created, err := s.AddStream(ctx, &spec)
+		if err != nil {
+			return errors.Errorf(errors.EventStreamsBootstrapFailed, "event stream", bs.Name, err)
+		}
+		streamID = created.ID
+	} else {
+		streamID = existing.spec.ID
+		if spec.Type != "" && spec.Type != existing.spec.Type {
+			return errors.Errorf(errors.EventStreamsBootstrapTypeChanged, bs.Name, existing.spec.Type, spec.Type)
+		}
+		// Headers are not exported by default, so keep the existing ones if none are declared
+		if spec.Webhook != nil && spec.Webhook.Headers == nil && existing.spec.Webhook != nil {
+			spec.Webhook.Headers = existing.spec.Webhook.Headers
+		}
+		// Secrets are masked in an export, so keep the existing ones where they are
+		if spec.Webhook != nil {
+			spec.Webhook.keepRedactedSecrets(existing.spec.Webhook)
+		}
+		if spec.Warehouse != nil && existing.spec.Warehouse != nil {
+			spec.Warehouse.keepRedactedSecrets(existing.spec.Warehouse)
+		}
+		if streamDrifted(existing.spec, &spec) {
+			log.Infof("Bootstrap: updating event stream '%s' (%s)", bs.Name, streamID)
+			if _, err := s.UpdateStream(ctx, streamID, &spec); err != nil {
+				return errors.Errorf(errors.EventStreamsBootstrapFailed, "event stream", bs.Name, err)
+			}
+		} else {
+			log.Debugf("Bootstrap: event stream '%s' (%s) is up to date", bs.Name, streamID)
+		}
+	}
+
+	for _, bsub := range bs.Subscriptions {
+		if err := s.bootstrapSubscription(ctx, streamID, bsub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *subscriptionMGR) bootstrapSubscription(ctx context.Context, streamID string, bsub *BootstrapSubscription) error {
+	var addr *ethbinding.Address
+	if bsub.Address != "" {
+		if !ethbind.API.IsHexAddress(bsub.Address) {
+			return errors.Errorf(errors.EventStreamsBootstrapBadAddress, bsub.Address, bsub.Name)
+		}
+		a := ethbind.API.HexToAddress(bsub.Address)
+		addr = &a
+	}
+
+	for _, sub := range s.subscriptionsForStream(streamID) {
+		if sub.info.Name != bsub.Name {
+			continue
+		}
+		if !subscriptionDrifted(sub.info, addr, bsub) {
+			log.Debugf("Bootstrap: subscription '%s' (%s) is up to date", bsub.Name, sub.info.ID)
+			return nil
+		}
+		// There is no update for a subscription, as the filter is fixed on creation.
+		// So we replace it, starting again from the declared block
+		log.Infof("Bootstrap: replacing subscription '%s' (%s)", bsub.Name, sub.info.ID)
+		if err := s.deleteSubscription(ctx, sub); err != nil {
+			return errors.Errorf(errors.EventStreamsBootstrapFailed, "subscription", bsub.Name, err)
+		}
+		break
+	}
+
+	log.Infof("Bootstrap: creating subscription '%s' on stream %s", bsub.Name, streamID)
+	if _, err := s.AddSubscription(ctx, addr, bsub.Event, streamID, bsub.FromBlock, bsub.Name, bsub.AutoRegister); err != nil {
+		return errors.Errorf(errors.EventStreamsBootstrapFailed, "subscription", bsub.Name, err)
+	}
+	return nil
+}
+
+// streamDrifted compares only the fields set in the declaration, as defaults are
+// applied to the stored spec on creation. Timestamps is the exception, as it is a
+// boolean that is always applied on update
+func streamDrifted(existing, desired *StreamInfo) bool {
+	var existingMap, desiredMap map[string]interface{}
+	b, _ := json.Marshal(existing)
+	json.Unmarshal(b, &existingMap)
+	b, _ = json.Marshal(desired)
+	json.Unmarshal(b, &desiredMap)
+	for _, field := range streamBootstrapIgnoredFields {
+		delete(desiredMap, field)
+	}
+	return !subsetMatches(desiredMap, existingMap) || existing.Timestamps != desired.Timestamps
+}
+
+// subsetMatches checks every value in the desired map is the same in the existing map
+func subsetMatches(desired, existing interface{}) bool {
+	desiredMap, isMap := desired.(map[string]interface{})
+	if !isMap {
+		return reflect.DeepEqual(desired, existing)
+	}
+	existingMap, isMap := existing.(map[string]interface{})
+	if !isMap {
+		return false
+	}
+	for k, v := range desiredMap {
+		if !subsetMatches(v, existingMap[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+func subscriptionDrifted(existing *SubscriptionInfo, addr *ethbinding.Address, desired *BootstrapSubscription) bool {
+	if addr == nil && len(existing.Filter.Addresses) > 0 ||
+		addr != nil && (len(existing.Filter.Addresses) != 1 || existing.Filter.Addresses[0] != *addr) {
+		return true
+	}
+	existingEvent, _ := json.Marshal(existing.Event)
+	desiredEvent, _ := json.Marshal(desired.Event)
+	if string(existingEvent) != string(desiredEvent) {
+		return true
+	}
+	return !reflect.DeepEqual(existing.AutoRegister, desired.AutoRegister)
+}
@@ -0,0 +1,480 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBootstrapConf() *BootstrapConf {
+	return &BootstrapConf{
+		Streams: []*BootstrapStream{
+			{
+				StreamInfo: StreamInfo{
+					Name:      "stream1",
+					Type:      "webhook",
+					BatchSize: 10,
+					Webhook:   &webhookActionInfo{URL: "http://test.invalid"},
+				},
+				Subscriptions: []*BootstrapSubscription{
+					{
+						Name:    "sub1",
+						Address: "0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca",
+						Event:   &ethbinding.ABIElementMarshaling{Name: "Changed"},
+					},
+					{
+						Name:      "sub2",
+						Event:     &ethbinding.ABIElementMarshaling{Name: "Created"},
+						FromBlock: "0",
+					},
+				},
+			},
+		},
+	}
+}
+
+func newTestBootstrapSubscriptionManager(t *testing.T, dir string, conf *BootstrapConf) *subscriptionMGR {
+	sm := newTestSubscriptionManager()
+	sm.conf.EventLevelDBPath = path.Join(dir, "db")
+	sm.conf.Bootstrap = conf
+	return sm
+}
+
+func TestBootstrapCreateThenNoChange(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, newTestBootstrapConf())
+	err := sm.Init()
+	assert.NoError(err)
+	ctx := context.Background()
+	assert.Equal(1, len(sm.Streams(ctx)))
+	assert.Equal(2, len(sm.Subscriptions(ctx)))
+	stream := sm.Streams(ctx)[0]
+	assert.Equal("stream1", stream.Name)
+	assert.Equal(uint64(10), stream.BatchSize)
+	streamID := stream.ID
+	subIDs := map[string]string{}
+	for _, sub := range sm.Subscriptions(ctx) {
+		assert.Equal(streamID, sub.Stream)
+		subIDs[sub.Name] = sub.ID
+	}
+	sm.Close()
+
+	// Restart with the same config, and check nothing is re-created
+	sm = newTestBootstrapSubscriptionManager(t, dir, newTestBootstrapConf())
+	err = sm.Init()
+	assert.NoError(err)
+	assert.Equal(1, len(sm.Streams(ctx)))
+	assert.Equal(streamID, sm.Streams(ctx)[0].ID)
+	assert.Equal(2, len(sm.Subscriptions(ctx)))
+	for _, sub := range sm.Subscriptions(ctx) {
+		assert.Equal(subIDs[sub.Name], sub.ID)
+	}
+	sm.Close()
+}
+
+func TestBootstrapUpdateDrifted(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, newTestBootstrapConf())
+	err := sm.Init()
+	assert.NoError(err)
+	ctx := context.Background()
+	streamID := sm.Streams(ctx)[0].ID
+	subIDs := map[string]string{}
+	for _, sub := range sm.Subscriptions(ctx) {
+		subIDs[sub.Name] = sub.ID
+	}
+	sm.Close()
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].BatchSize = 50
+	conf.Streams[0].Subscriptions[0].Address = "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832"
+	sm = newTestBootstrapSubscriptionManager(t, dir, conf)
+	err = sm.Init()
+	assert.NoError(err)
+	assert.Equal(1, len(sm.Streams(ctx)))
+	stream := sm.Streams(ctx)[0]
+	assert.Equal(streamID, stream.ID)
+	assert.Equal(uint64(50), stream.BatchSize)
+	assert.Equal(2, len(sm.Subscriptions(ctx)))
+	for _, sub := range sm.Subscriptions(ctx) {
+		if sub.Name == "sub1" {
+			assert.NotEqual(subIDs["sub1"], sub.ID)
+			assert.Equal("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", strings.ToLower(sub.Filter.Addresses[0].String()))
+		} else {
+			assert.Equal(subIDs["sub2"], sub.ID)
+		}
+	}
+	sm.Close()
+}
+
+func TestBootstrapFromFile(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	filename := path.Join(dir, "bootstrap.yaml")
+	ioutil.WriteFile(filename, []byte(`
+streams:
+- name: stream1
+  type: webhook
+  webhook:
+    url: http://test.invalid
+  subscriptions:
+  - name: sub1
+    event:
+      name: Changed
+`), 0644)
+	sm := newTestBootstrapSubscriptionManager(t, dir, nil)
+	sm.conf.BootstrapFile = filename
+	err := sm.Init()
+	assert.NoError(err)
+	ctx := context.Background()
+	assert.Equal(1, len(sm.Streams(ctx)))
+	assert.Equal(1, len(sm.Subscriptions(ctx)))
+	assert.Equal("sub1", sm.Subscriptions(ctx)[0].Name)
+	sm.Close()
+}
+
+func TestBootstrapFromJSONFile(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	filename := path.Join(dir, "bootstrap.json")
+	ioutil.WriteFile(filename, []byte(`{"streams":[{"name":"stream1","type":"webhook","webhook":{"url":"http://test.invalid"}}]}`), 0644)
+	conf, err := loadBootstrapFile(filename)
+	assert.NoError(err)
+	assert.Equal("stream1", conf.Streams[0].Name)
+	assert.Equal("http://test.invalid", conf.Streams[0].Webhook.URL)
+}
+
+func TestBootstrapFileMissing(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, nil)
+	sm.conf.BootstrapFile = path.Join(dir, "missing.yaml")
+	err := sm.Init()
+	assert.Regexp("Failed to read event streams bootstrap file", err)
+	sm.Close()
+}
+
+func TestBootstrapFileBadYAML(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	filename := path.Join(dir, "bootstrap.yaml")
+	ioutil.WriteFile(filename, []byte(`!badness`), 0644)
+	_, err := loadBootstrapFile(filename)
+	assert.Regexp("Failed to parse event streams bootstrap file", err)
+}
+
+func TestBootstrapFileBadJSON(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	filename := path.Join(dir, "bootstrap.json")
+	ioutil.WriteFile(filename, []byte(`{"streams": "not an array"}`), 0644)
+	_, err := loadBootstrapFile(filename)
+	assert.Regexp("Failed to parse event streams bootstrap file", err)
+}
+
+func TestBootstrapStreamNoName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Name = ""
+	sm := newTestBootstrapSubscriptionManager(t, dir, conf)
+	err := sm.Init()
+	assert.Regexp("must have a name", err)
+	sm.Close()
+}
+
+func TestBootstrapSubscriptionNoName(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Subscriptions[1].Name = ""
+	sm := newTestBootstrapSubscriptionManager(t, dir, conf)
+	err := sm.Init()
+	assert.Regexp("must have a name", err)
+	sm.Close()
+}
+
+func TestBootstrapSubscriptionBadAddress(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Subscriptions[0].Address = "badness"
+	sm := newTestBootstrapSubscriptionManager(t, dir, conf)
+	err := sm.Init()
+	assert.Regexp("Invalid address 'badness' for subscription 'sub1'", err)
+	sm.Close()
+}
+
+func TestBootstrapSubscriptionFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Subscriptions[0].FromBlock = "badness"
+	sm := newTestBootstrapSubscriptionManager(t, dir, conf)
+	err := sm.Init()
+	assert.Regexp("Failed to bootstrap subscription 'sub1'", err)
+	sm.Close()
+}
+
+func TestBootstrapStreamCreateFail(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Type = "badness"
+	sm := newTestBootstrapSubscriptionManager(t, dir, conf)
+	err := sm.Init()
+	assert.Regexp("Failed to bootstrap event stream 'stream1'", err)
+	sm.Close()
+}
+
+func TestBootstrapStreamTypeChanged(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, newTestBootstrapConf())
+	err := sm.Init()
+	assert.NoError(err)
+	sm.Close()
+
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Type = "websocket"
+	sm = newTestBootstrapSubscriptionManager(t, dir, conf)
+	err = sm.Init()
+	assert.Regexp("Cannot change the type of event stream 'stream1' from 'webhook' to 'websocket'", err)
+	sm.Close()
+}
+
+func TestStreamDrifted(t *testing.T) {
+	assert := assert.New(t)
+
+	existing := &StreamInfo{
+		ID:             "es-1",
+		Name:           "stream1",
+		Type:           "webhook",
+		BatchSize:      1,
+		BatchTimeoutMS: 5000,
+		ErrorHandling:  ErrorHandlingSkip,
+		Webhook: &webhookActionInfo{
+			URL:               "http://test.invalid",
+			RequestTimeoutSec: 120,
+		},
+	}
+	assert.False(streamDrifted(existing, &StreamInfo{
+		Name:    "stream1",
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}))
+	assert.True(streamDrifted(existing, &StreamInfo{
+		Name:    "stream1",
+		Webhook: &webhookActionInfo{URL: "http://other.invalid"},
+	}))
+	assert.True(streamDrifted(existing, &StreamInfo{
+		Name:       "stream1",
+		Timestamps: true,
+	}))
+	assert.True(streamDrifted(existing, &StreamInfo{
+		Name:      "stream1",
+		WebSocket: &webSocketActionInfo{Topic: "topic1"},
+	}))
+}
+
+func TestSubscriptionDrifted(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := ethbinding.Address{}
+	existing := &SubscriptionInfo{
+		Event: &ethbinding.ABIElementMarshaling{Name: "Changed"},
+	}
+	desired := &BootstrapSubscription{
+		Event: &ethbinding.ABIElementMarshaling{Name: "Changed"},
+	}
+	assert.False(subscriptionDrifted(existing, nil, desired))
+	assert.True(subscriptionDrifted(existing, &addr, desired))
+	existing.Filter.Addresses = []ethbinding.Address{addr}
+	assert.True(subscriptionDrifted(existing, nil, desired))
+	assert.False(subscriptionDrifted(existing, &addr, desired))
+	desired.AutoRegister = &AutoRegisterSpec{ABI: "abi1", AddressField: "child"}
+	assert.True(subscriptionDrifted(existing, &addr, desired))
+	desired.AutoRegister = nil
+	desired.Event = &ethbinding.ABIElementMarshaling{Name: "Created"}
+	assert.True(subscriptionDrifted(existing, &addr, desired))
+}
+
+func TestExportImportDefinitions(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, newTestBootstrapConf())
+	err := sm.Init()
+	assert.NoError(err)
+	ctx := context.Background()
+	_, err = sm.AddStream(ctx, &StreamInfo{
+		Type:      "websocket",
+		WebSocket: &webSocketActionInfo{Topic: "topic1"},
+	})
+	assert.NoError(err)
+	defs := sm.ExportDefinitions(ctx, false)
+	sm.Close()
+
+	assert.Equal(2, len(defs.Streams))
+	var stream1, unnamed *BootstrapStream
+	for _, bs := range defs.Streams {
+		assert.Empty(bs.ID)
+		assert.Empty(bs.Path)
+		assert.Empty(bs.CreatedISO8601)
+		if bs.Name == "stream1" {
+			stream1 = bs
+		} else {
+			unnamed = bs
+		}
+	}
+	assert.Regexp("^es-", unnamed.Name)
+	assert.Equal(2, len(stream1.Subscriptions))
+	assert.Equal("sub1", stream1.Subscriptions[0].Name)
+	assert.Equal("0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca", strings.ToLower(stream1.Subscriptions[0].Address))
+	assert.Equal("sub2", stream1.Subscriptions[1].Name)
+	assert.Equal("0", stream1.Subscriptions[1].FromBlock)
+
+	// Import into a fresh instance, then check a repeat import changes nothing
+	dir2 := tempdir(t)
+	defer cleanup(t, dir2)
+	sm = newTestBootstrapSubscriptionManager(t, dir2, nil)
+	err = sm.Init()
+	assert.NoError(err)
+	err = sm.ImportDefinitions(ctx, defs)
+	assert.NoError(err)
+	assert.Equal(2, len(sm.Streams(ctx)))
+	assert.Equal(2, len(sm.Subscriptions(ctx)))
+	subIDs := map[string]bool{}
+	for _, sub := range sm.Subscriptions(ctx) {
+		subIDs[sub.ID] = true
+	}
+	err = sm.ImportDefinitions(ctx, sm.ExportDefinitions(ctx, false))
+	assert.NoError(err)
+	assert.Equal(2, len(sm.Streams(ctx)))
+	for _, sub := range sm.Subscriptions(ctx) {
+		assert.True(subIDs[sub.ID])
+	}
+	sm.Close()
+}
+
+func TestExportDefinitionsWebhookHeaders(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, nil)
+	err := sm.Init()
+	assert.NoError(err)
+	ctx := context.Background()
+	_, err = sm.AddStream(ctx, &StreamInfo{
+		Name: "stream1",
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:     "http://test.invalid",
+			Headers: map[string]string{"authorization": "Bearer secret"},
+			Auth:    &webhookAuthInfo{BearerToken: "t0ken"},
+		},
+	})
+	assert.NoError(err)
+
+	defs := sm.ExportDefinitions(ctx, false)
+	assert.Nil(defs.Streams[0].Webhook.Headers)
+	assert.Equal("http://test.invalid", defs.Streams[0].Webhook.URL)
+	assert.Equal("******", defs.Streams[0].Webhook.Auth.BearerToken)
+
+	// Importing the redacted document must not wipe the existing headers
+	defs.Streams[0].BatchSize = 5
+	err = sm.ImportDefinitions(ctx, defs)
+	assert.NoError(err)
+	defs = sm.ExportDefinitions(ctx, true)
+	assert.Equal(uint64(5), defs.Streams[0].BatchSize)
+	assert.Equal("Bearer secret", defs.Streams[0].Webhook.Headers["authorization"])
+	assert.Equal("t0ken", defs.Streams[0].Webhook.Auth.BearerToken)
+	sm.Close()
+}
+
+func TestImportDefinitionsDuplicateNames(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, nil)
+	err := sm.Init()
+	assert.NoError(err)
+	conf := newTestBootstrapConf()
+	conf.Streams[0].Subscriptions = append(conf.Streams[0].Subscriptions, conf.Streams[0].Subscriptions[0])
+	err = sm.ImportDefinitions(context.Background(), conf)
+	assert.Regexp("Duplicate subscription name 'sub1'", err)
+	assert.Empty(sm.Streams(context.Background()))
+
+	conf = newTestBootstrapConf()
+	conf.Streams = append(conf.Streams, conf.Streams[0])
+	err = sm.ImportDefinitions(context.Background(), conf)
+	assert.Regexp("Duplicate event stream name 'stream1'", err)
+	assert.Empty(sm.Streams(context.Background()))
+	sm.Close()
+}
+
+func TestImportDefinitionsNoNameAppliesNothing(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestBootstrapSubscriptionManager(t, dir, nil)
+	err := sm.Init()
+	assert.NoError(err)
+	conf := newTestBootstrapConf()
+	conf.Streams = append(conf.Streams, &BootstrapStream{})
+	err = sm.ImportDefinitions(context.Background(), conf)
+	assert.Regexp("must have a name", err)
+	assert.Empty(sm.Streams(context.Background()))
+	sm.Close()
+}
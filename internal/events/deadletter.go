@@ -0,0 +1,167 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	deadLetterIDPrefix = "dl-"
+)
+
+// DeadLetter is a batch of events skipped by a stream, after its delivery failed with all
+// retries, held so it can be reviewed and replayed once the cause of the failure is fixed
+type DeadLetter struct {
+	messages.TimeSorted
+	ID     string       `json:"id"`
+	Stream string       `json:"stream"`
+	Error  string       `json:"error"`
+	Events []*eventData `json:"events"`
+}
+
+func deadLetterKey(streamID, id string) string {
+	return deadLetterIDPrefix + streamID + "/" + id
+}
+
+// storeDeadLetter persists a batch that the stream skipped. A failure is logged, as the
+// stream has already moved on from the batch
+func (s *subscriptionMGR) storeDeadLetter(streamID string, events []*eventData, deliveryErr error) {
+	dl := &DeadLetter{
+		TimeSorted: messages.TimeSorted{
+			CreatedISO8601: time.Now().UTC().Format(time.RFC3339Nano),
+		},
+		ID:     utils.UUIDv4(),
+		Stream: streamID,
+		Error:  deliveryErr.Error(),
+		Events: events,
+	}
+	b, _ := json.Marshal(dl)
+	if err := s.db.Put(deadLetterKey(streamID, dl.ID), b); err != nil {
+		log.Errorf("%s: Failed to store dead letter for %d skipped events: %s", streamID, len(events), err)
+		return
+	}
+	log.Warnf("%s: Stored %d skipped events as dead letter %s", streamID, len(events), dl.ID)
+}
+
+// DeadLetters lists the dead letters of a stream, oldest first
+func (s *subscriptionMGR) DeadLetters(ctx context.Context, streamID string) ([]*DeadLetter, error) {
+	if _, err := s.streamByID(streamID); err != nil {
+		return nil, err
+	}
+	prefix := deadLetterKey(streamID, "")
+	deadLetters := []*DeadLetter{}
+	it := s.db.NewIterator()
+	defer it.Release()
+	for it.Next() {
+		if !strings.HasPrefix(it.Key(), prefix) {
+			continue
+		}
+		var dl DeadLetter
+		if err := json.Unmarshal(it.Value(), &dl); err != nil {
+			log.Errorf("Failed to load dead letter '%s': %s", it.Key(), err)
+			continue
+		}
+		deadLetters = append(deadLetters, &dl)
+	}
+	sort.Slice(deadLetters, func(i, j int) bool { return deadLetters[i].CreatedISO8601 < deadLetters[j].CreatedISO8601 })
+	return deadLetters, nil
+}
+
+func (s *subscriptionMGR) loadDeadLetter(streamID, id string) (*DeadLetter, error) {
+	b, err := s.db.Get(deadLetterKey(streamID, id))
+	if err == leveldb.ErrNotFound {
+		return nil, errors.Errorf(errors.EventStreamsDeadLetterNotFound, id)
+	} else if err != nil {
+		return nil, err
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal(b, &dl); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// ReplayDeadLetter re-delivers the events of a dead letter on its stream, and removes it.
+// If the delivery fails again, the events are stored as a new dead letter
+func (s *subscriptionMGR) ReplayDeadLetter(ctx context.Context, streamID, id string) (*DeadLetter, error) {
+	stream, err := s.streamByID(streamID)
+	if err != nil {
+		return nil, err
+	}
+	dl, err := s.loadDeadLetter(streamID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.replayEvents(dl.Events); err != nil {
+		return nil, err
+	}
+	if err := s.db.Delete(deadLetterKey(streamID, id)); err != nil {
+		log.Errorf("%s: Failed to delete replayed dead letter %s: %s", streamID, id, err)
+	}
+	log.Infof("%s: Replaying %d events from dead letter %s", streamID, len(dl.Events), id)
+	return dl, nil
+}
+
+// DeleteDeadLetter discards a dead letter without replaying it
+func (s *subscriptionMGR) DeleteDeadLetter(ctx context.Context, streamID, id string) error {
+	if _, err := s.loadDeadLetter(streamID, id); err != nil {
+		return err
+	}
+	return s.db.Delete(deadLetterKey(streamID, id))
+}
+
+// deleteDeadLetters removes all the dead letters of a stream, when it is deleted
+func (s *subscriptionMGR) deleteDeadLetters(streamID string) {
+	prefix := deadLetterKey(streamID, "")
+	var keys []string
+	it := s.db.NewIterator()
+	for it.Next() {
+		if strings.HasPrefix(it.Key(), prefix) {
+			keys = append(keys, it.Key())
+		}
+	}
+	it.Release()
+	for _, key := range keys {
+		s.db.Delete(key)
+	}
+}
+
+// replayEvents queues a batch of events that was skipped for delivery again. The checkpoints
+// of the subscriptions have already moved past the events, so they are not updated
+func (a *eventStream) replayEvents(events []*eventData) error {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.suspendOrStop() {
+		return errors.Errorf(errors.EventStreamsDeadLetterStreamSuspended, a.spec.ID)
+	}
+	for _, event := range events {
+		event.batchComplete = func(*eventData) {}
+	}
+	a.inFlight += uint64(len(events))
+	a.batchQueue.PushBack(events)
+	a.batchCond.Broadcast()
+	return nil
+}
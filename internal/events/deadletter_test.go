@@ -0,0 +1,123 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func waitForDeadLetters(sm *subscriptionMGR, streamID string, count int) []*DeadLetter {
+	for i := 0; i < 100; i++ {
+		deadLetters, _ := sm.DeadLetters(context.Background(), streamID)
+		if len(deadLetters) == count {
+			return deadLetters
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestDeadLetterStoreReplayDelete(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:     1,
+			Webhook:       &webhookActionInfo{},
+			ErrorHandling: ErrorHandlingSkip,
+			DeadLetter:    true,
+		}, db, 404, 404, 200)
+	defer svr.Close()
+	defer stream.stop()
+	ctx := context.Background()
+
+	// Two batches fail, and are skipped into dead letters
+	for _, blockNumber := range []string{"1", "2"} {
+		stream.handleEvent(&eventData{SubID: "sub1", BlockNumber: blockNumber, batchComplete: func(*eventData) {}})
+		<-eventStream
+	}
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 2)
+	assert.Len(deadLetters, 2)
+	assert.Equal("1", deadLetters[0].Events[0].BlockNumber)
+	assert.Equal("2", deadLetters[1].Events[0].BlockNumber)
+	assert.Regexp("404", deadLetters[0].Error)
+
+	// Replaying the first delivers it again, and removes it
+	dl, err := sm.ReplayDeadLetter(ctx, stream.spec.ID, deadLetters[0].ID)
+	assert.NoError(err)
+	assert.Equal(deadLetters[0].ID, dl.ID)
+	replayed := <-eventStream
+	assert.Equal("1", replayed[0].BlockNumber)
+	assert.Len(waitForDeadLetters(sm, stream.spec.ID, 1), 1)
+
+	// Deleting the second discards it
+	err = sm.DeleteDeadLetter(ctx, stream.spec.ID, deadLetters[1].ID)
+	assert.NoError(err)
+	remaining, err := sm.DeadLetters(ctx, stream.spec.ID)
+	assert.NoError(err)
+	assert.Empty(remaining)
+
+	_, err = sm.ReplayDeadLetter(ctx, stream.spec.ID, deadLetters[1].ID)
+	assert.Regexp("Dead letter .* not found", err)
+	err = sm.DeleteDeadLetter(ctx, stream.spec.ID, deadLetters[1].ID)
+	assert.Regexp("Dead letter .* not found", err)
+}
+
+func TestDeadLetterReplaySuspended(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:     1,
+			Webhook:       &webhookActionInfo{},
+			ErrorHandling: ErrorHandlingSkip,
+			DeadLetter:    true,
+		}, db, 404)
+	defer svr.Close()
+	defer stream.stop()
+	ctx := context.Background()
+
+	stream.handleEvent(&eventData{SubID: "sub1", batchComplete: func(*eventData) {}})
+	<-eventStream
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 1)
+	assert.Len(deadLetters, 1)
+
+	stream.suspend()
+	_, err := sm.ReplayDeadLetter(ctx, stream.spec.ID, deadLetters[0].ID)
+	assert.Regexp("suspended", err)
+	assert.Len(waitForDeadLetters(sm, stream.spec.ID, 1), 1)
+}
+
+func TestDeadLettersUnknownStream(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+
+	_, err := sm.DeadLetters(ctx, "unknown")
+	assert.Regexp("Stream with ID 'unknown' not found", err)
+	_, err = sm.ReplayDeadLetter(ctx, "unknown", "dl1")
+	assert.Regexp("Stream with ID 'unknown' not found", err)
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+// logIndexValue is the index of a log in its block, which nodes return as a hex string or a number
+type logIndexValue uint64
+
+func (v *logIndexValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n uint64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return err
+		}
+		*v = logIndexValue(n)
+		return nil
+	}
+	n, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return err
+	}
+	*v = logIndexValue(n)
+	return nil
+}
+
+// eventDedupKey identifies the delivery of a log to a subscription. It is the same each time
+// the log is delivered, so consumers can discard the duplicates of at-least-once delivery
+func eventDedupKey(subID string, blockHash ethbinding.Hash, txIndex ethbinding.HexUint, logIndex logIndexValue) string {
+	return fmt.Sprintf("%s-%d-%d-%s", blockHash.Hex(), uint64(txIndex), uint64(logIndex), subID)
+}
+
+type dedupEntry struct {
+	key     string
+	expires time.Time
+}
+
+// dedupWindow remembers the keys of the events a stream has delivered for a period of time,
+// so events delivered again when the stream restarts from its checkpoint after a suspend or
+// update can be dropped. The keys are held in memory, so are not remembered across a restart
+type dedupWindow struct {
+	mux    sync.Mutex
+	keys   map[string]bool
+	expiry *list.List // oldest first
+}
+
+func newDedupWindow() *dedupWindow {
+	return &dedupWindow{
+		keys:   make(map[string]bool),
+		expiry: list.New(),
+	}
+}
+
+func (d *dedupWindow) expire(now time.Time) {
+	for e := d.expiry.Front(); e != nil && !now.Before(e.Value.(*dedupEntry).expires); e = d.expiry.Front() {
+		delete(d.keys, e.Value.(*dedupEntry).key)
+		d.expiry.Remove(e)
+	}
+}
+
+// record remembers the keys of delivered events, until the window passes
+func (d *dedupWindow) record(events []*eventData, window time.Duration) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	now := time.Now()
+	d.expire(now)
+	for _, event := range events {
+		if event.DedupKey != "" && !d.keys[event.DedupKey] {
+			d.keys[event.DedupKey] = true
+			d.expiry.PushBack(&dedupEntry{key: event.DedupKey, expires: now.Add(window)})
+		}
+	}
+}
+
+// filter returns the events that have not been delivered within the window
+func (d *dedupWindow) filter(events []*eventData) []*eventData {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.expire(time.Now())
+	if len(d.keys) == 0 {
+		return events
+	}
+	remaining := make([]*eventData, 0, len(events))
+	for _, event := range events {
+		if !d.keys[event.DedupKey] {
+			remaining = append(remaining, event)
+		}
+	}
+	return remaining
+}
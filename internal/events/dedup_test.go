@@ -0,0 +1,107 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogIndexValueUnmarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	var v logIndexValue
+	assert.NoError(json.Unmarshal([]byte(`"0x1a"`), &v))
+	assert.Equal(logIndexValue(26), v)
+	assert.NoError(json.Unmarshal([]byte(`12`), &v))
+	assert.Equal(logIndexValue(12), v)
+	assert.Error(json.Unmarshal([]byte(`"zz"`), &v))
+	assert.Error(json.Unmarshal([]byte(`{}`), &v))
+}
+
+func TestEventDedupKey(t *testing.T) {
+	assert := assert.New(t)
+
+	blockHash := ethbind.API.HexToHash("0xb6d8a38a89ac35a04ee6ebd5789a4a805dfa26c1b753c311db523ec9bf204384")
+	assert.Equal("0xb6d8a38a89ac35a04ee6ebd5789a4a805dfa26c1b753c311db523ec9bf204384-2-5-sub1", eventDedupKey("sub1", blockHash, 2, 5))
+	assert.NotEqual(eventDedupKey("sub1", blockHash, 2, 5), eventDedupKey("sub2", blockHash, 2, 5))
+}
+
+func TestDedupWindowRecordFilterExpire(t *testing.T) {
+	assert := assert.New(t)
+
+	d := newDedupWindow()
+	e1 := &eventData{DedupKey: "k1"}
+	e2 := &eventData{DedupKey: "k2"}
+	assert.Equal([]*eventData{e1, e2}, d.filter([]*eventData{e1, e2}))
+
+	d.record([]*eventData{e1}, 50*time.Millisecond)
+	d.record([]*eventData{e1}, 50*time.Millisecond)
+	assert.Equal(1, d.expiry.Len())
+	assert.Equal([]*eventData{e2}, d.filter([]*eventData{e1, e2}))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal([]*eventData{e1, e2}, d.filter([]*eventData{e1, e2}))
+	assert.Empty(d.keys)
+}
+
+func TestDedupWindowDropsRedeliveredEvents(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:      1,
+			DedupWindowSec: 60,
+			Webhook:        &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	var delivered [][]*eventData
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		delivered = append(delivered, <-eventStream)
+		delivered = append(delivered, <-eventStream)
+		wg.Done()
+	}()
+	// Duplicates are acknowledged with their batch, so the checkpoint moves past them
+	var completed int32
+	batchComplete := func(*eventData) { atomic.AddInt32(&completed, 1) }
+	e1 := testEvent("sub1")
+	e1.DedupKey = "k1"
+	e1.batchComplete = batchComplete
+	e2 := testEvent("sub1")
+	e2.DedupKey = "k2"
+	e2.batchComplete = batchComplete
+	stream.handleEvent(e1)
+	stream.handleEvent(e1)
+	stream.handleEvent(e2)
+	wg.Wait()
+
+	assert.Equal("k1", delivered[0][0].DedupKey)
+	assert.Equal("k2", delivered[1][0].DedupKey)
+	for i := 0; i < 10 && (stream.inFlight > 0 || atomic.LoadInt32(&completed) < 3); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(uint64(0), stream.inFlight)
+	assert.Equal(int32(3), atomic.LoadInt32(&completed))
+}
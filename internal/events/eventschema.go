@@ -0,0 +1,149 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"strconv"
+
+	"github.com/go-openapi/spec"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+const (
+	// EventSchemaDraft is the JSON Schema draft of the schemas returned by EventSchema
+	EventSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+	decimalPattern  = "^[0-9]+$"
+	integerPattern  = "^-?[0-9]+$"
+	topicPattern    = "^0x[0-9a-f]{64}$"
+	checksumPattern = "^0x[0-9a-fA-F]{40}$"
+)
+
+// EventSchema returns the JSON schema of the events delivered on a stream for a subscription
+// to the event. The parameters under data are described in the form the log processor decodes
+// them - integers as decimal strings, and bytes as 0x prefixed hex. Indexed parameters of a
+// dynamic type, such as a string or an array, are only available as the hash in the topic
+func EventSchema(event *ethbinding.ABIEvent) *spec.Schema {
+	data := objectSchema()
+	outputIdx := 0
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			data.Properties[input.Name] = indexedSchema(&input.Type)
+			data.Required = append(data.Required, input.Name)
+			continue
+		}
+		// Un-named data parameters are named in the same way as the outputs of a method
+		argName := input.Name
+		if argName == "" {
+			argName = "output"
+			if outputIdx != 0 {
+				argName += strconv.Itoa(outputIdx)
+			}
+		}
+		outputIdx++
+		data.Properties[argName] = valueSchema(&input.Type)
+		data.Required = append(data.Required, argName)
+	}
+
+	s := objectSchema()
+	s.Schema = EventSchemaDraft
+	s.Title = event.Name
+	s.Properties["address"] = *stringSchema("Address of the contract that emitted the event", checksumPattern)
+	s.Properties["blockNumber"] = *stringSchema("Block number, as a decimal string", decimalPattern)
+	s.Properties["transactionIndex"] = *stringSchema("Index of the transaction in the block, as a 0x prefixed hex string", "^0x[0-9a-f]+$")
+	s.Properties["transactionHash"] = *stringSchema("Hash of the transaction", topicPattern)
+	s.Properties["logIndex"] = *stringSchema("Index of the event in the logs of the transaction, as a decimal string", decimalPattern)
+	s.Properties["subId"] = *stringSchema("ID of the subscription that delivered the event", "")
+	s.Properties["dedupKey"] = *stringSchema("Key that is the same each time the event is delivered to the subscription, to discard duplicates", "")
+	signature := stringSchema("Signature of the event", "")
+	signature.Enum = []interface{}{ethbind.API.ABIEventSignature(event)}
+	s.Properties["signature"] = *signature
+	s.Properties["timestamp"] = *stringSchema("Timestamp of the block in seconds since the epoch, when enabled on the stream", decimalPattern)
+	s.Properties["data"] = *data
+	s.Required = []string{"address", "blockNumber", "transactionIndex", "transactionHash", "logIndex", "subId", "dedupKey", "signature", "data"}
+	return s
+}
+
+func objectSchema() *spec.Schema {
+	return &spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Type:       []string{"object"},
+			Properties: make(map[string]spec.Schema),
+		},
+	}
+}
+
+func stringSchema(desc, pattern string) *spec.Schema {
+	return &spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Description: desc,
+			Type:        []string{"string"},
+			Pattern:     pattern,
+		},
+	}
+}
+
+// indexedSchema describes a parameter decoded from a topic, which only holds the value
+// itself for integers, booleans and addresses
+func indexedSchema(t *ethbinding.ABIType) spec.Schema {
+	switch t.T {
+	case ethbinding.IntTy, ethbinding.UintTy, ethbinding.BoolTy:
+		return valueSchema(t)
+	case ethbinding.AddressTy:
+		return *stringSchema(t.String(), checksumPattern)
+	default:
+		return *stringSchema(t.String()+": keccak256 hash of the indexed value", topicPattern)
+	}
+}
+
+// valueSchema describes a parameter decoded from the data of a log
+func valueSchema(t *ethbinding.ABIType) spec.Schema {
+	s := stringSchema(t.String(), "")
+	switch t.T {
+	case ethbinding.IntTy:
+		s.Pattern = integerPattern
+	case ethbinding.UintTy:
+		s.Pattern = decimalPattern
+	case ethbinding.BoolTy:
+		s.Type = []string{"boolean"}
+	case ethbinding.AddressTy:
+		s.Pattern = "^0x[0-9a-f]{40}$"
+	case ethbinding.BytesTy:
+		s.Pattern = "^0x([0-9a-f]{2})*$"
+	case ethbinding.FixedBytesTy:
+		s.Pattern = "^0x[0-9a-f]{" + strconv.Itoa(t.Size*2) + "}$"
+	case ethbinding.SliceTy, ethbinding.ArrayTy:
+		s.Type = []string{"array"}
+		items := valueSchema(t.Elem)
+		s.Items = &spec.SchemaOrArray{Schema: &items}
+		if t.T == ethbinding.ArrayTy {
+			size := int64(t.Size)
+			s.MinItems, s.MaxItems = &size, &size
+		}
+	case ethbinding.TupleTy:
+		s.Type = []string{"object"}
+		s.Properties = make(map[string]spec.Schema)
+		for i, name := range t.TupleRawNames {
+			// Un-named components use the field name of the generated struct, as when decoding
+			if name == "" {
+				name = t.TupleType.Field(i).Name
+			}
+			s.Properties[name] = valueSchema(t.TupleElems[i])
+			s.Required = append(s.Required, name)
+		}
+	}
+	return *s
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	event, err := ethbind.API.ABIElementMarshalingToABIEvent(&ethbinding.ABIElementMarshaling{
+		Type: "event",
+		Name: "Changed",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "from", Type: "address", Indexed: true},
+			{Name: "id", Type: "uint256", Indexed: true},
+			{Name: "tag", Type: "string", Indexed: true},
+			{Name: "", Type: "int64"},
+			{Name: "values", Type: "bytes32[2]"},
+			{Name: "order", Type: "tuple", Components: []ethbinding.ABIArgumentMarshaling{
+				{Name: "enabled", Type: "bool"},
+				{Name: "owner", Type: "address"},
+			}},
+		},
+	})
+	assert.NoError(err)
+
+	s := EventSchema(event)
+	assert.Equal(EventSchemaDraft, string(s.Schema))
+	assert.Equal("Changed", s.Title)
+	assert.Equal([]interface{}{"Changed(address,uint256,string,int64,bytes32[2],(bool,address))"}, s.Properties["signature"].Enum)
+	assert.Contains(s.Required, "data")
+	assert.NotContains(s.Required, "timestamp")
+
+	data := s.Properties["data"]
+	assert.ElementsMatch([]string{"from", "id", "tag", "output", "values", "order"}, data.Required)
+	assert.Equal("^0x[0-9a-fA-F]{40}$", data.Properties["from"].Pattern)
+	assert.Equal("^[0-9]+$", data.Properties["id"].Pattern)
+	assert.Equal("^0x[0-9a-f]{64}$", data.Properties["tag"].Pattern)
+	assert.Equal("^-?[0-9]+$", data.Properties["output"].Pattern)
+
+	values := data.Properties["values"]
+	assert.Equal([]string{"array"}, []string(values.Type))
+	assert.Equal(int64(2), *values.MinItems)
+	assert.Equal(int64(2), *values.MaxItems)
+	assert.Equal("^0x[0-9a-f]{64}$", values.Items.Schema.Pattern)
+
+	order := data.Properties["order"]
+	assert.Equal([]string{"object"}, []string(order.Type))
+	assert.Equal([]string{"boolean"}, []string(order.Properties["enabled"].Type))
+	assert.Equal("^0x[0-9a-f]{40}$", order.Properties["owner"].Pattern)
+	assert.Equal([]string{"enabled", "owner"}, order.Required)
+}
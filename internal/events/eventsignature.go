@@ -0,0 +1,169 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+)
+
+var (
+	eventSignatureIdentifier  = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*$`)
+	eventSignatureArraySuffix = regexp.MustCompile(`^(\[[0-9]*\])*$`)
+)
+
+// ParseEventSignature builds the ABI of an event from its signature, so contracts that are
+// not in the registry can be subscribed to. The canonical form, such as
+// "Transfer(address,address,uint256)", can be decorated with the indexed keyword and
+// parameter names as in Solidity - "Transfer(address indexed from, address indexed to, uint256 value)".
+// If no parameter is marked indexed, the indexed parameters are inferred from the number
+// of topics on each log, assuming they are declared first
+func ParseEventSignature(signature string) (*ethbinding.ABIElementMarshaling, error) {
+	sig := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(signature), "event "))
+	openIdx := strings.Index(sig, "(")
+	if openIdx < 0 || !strings.HasSuffix(sig, ")") {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignature, signature, "expected Name(type1,type2,...)")
+	}
+	name := strings.TrimSpace(sig[0:openIdx])
+	if !eventSignatureIdentifier.MatchString(name) {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignature, signature, "invalid event name")
+	}
+	inputs, err := parseSignatureParams(sig[openIdx+1:len(sig)-1], true)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignature, signature, err)
+	}
+	event := &ethbinding.ABIElementMarshaling{
+		Type:   "event",
+		Name:   name,
+		Inputs: inputs,
+	}
+	// Validate the types are understood
+	if _, err := ethbind.API.ABIElementMarshalingToABIEvent(event); err != nil {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignature, signature, err)
+	}
+	return event, nil
+}
+
+// parseSignatureParams parses a comma separated list of parameters, including nested tuples.
+// Un-named parameters are named input, input1, input2... as elsewhere in the REST API
+func parseSignatureParams(paramList string, topLevel bool) ([]ethbinding.ABIArgumentMarshaling, error) {
+	paramStrings, err := splitSignatureParams(paramList)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]ethbinding.ABIArgumentMarshaling, len(paramStrings))
+	for i, paramString := range paramStrings {
+		param := &params[i]
+		rest := paramString
+		if strings.HasPrefix(paramString, "(") {
+			closeIdx := matchingParen(paramString)
+			if closeIdx < 0 {
+				return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+			}
+			if param.Components, err = parseSignatureParams(paramString[1:closeIdx], false); err != nil {
+				return nil, err
+			}
+			rest = strings.TrimPrefix(paramString[closeIdx+1:], "tuple")
+			arraySuffix := rest
+			if spaceIdx := strings.IndexAny(rest, " \t"); spaceIdx >= 0 {
+				arraySuffix = rest[0:spaceIdx]
+			}
+			if !eventSignatureArraySuffix.MatchString(arraySuffix) {
+				return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+			}
+			param.Type = "tuple" + arraySuffix
+			rest = rest[len(arraySuffix):]
+		}
+		fields := strings.Fields(rest)
+		if param.Type == "" {
+			if len(fields) == 0 {
+				return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+			}
+			param.Type = fields[0]
+			fields = fields[1:]
+		}
+		if topLevel && len(fields) > 0 && fields[0] == "indexed" {
+			param.Indexed = true
+			fields = fields[1:]
+		}
+		switch len(fields) {
+		case 0:
+			param.Name = "input"
+			if i != 0 {
+				param.Name += strconv.Itoa(i)
+			}
+		case 1:
+			if !eventSignatureIdentifier.MatchString(fields[0]) {
+				return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+			}
+			param.Name = fields[0]
+		default:
+			return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+		}
+	}
+	return params, nil
+}
+
+// splitSignatureParams splits a parameter list on the commas that are not inside a tuple
+func splitSignatureParams(paramList string) ([]string, error) {
+	paramStrings := []string{}
+	if strings.TrimSpace(paramList) == "" {
+		return paramStrings, nil
+	}
+	depth := 0
+	start := 0
+	for i, c := range paramList {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+			}
+		case ',':
+			if depth == 0 {
+				paramStrings = append(paramStrings, strings.TrimSpace(paramList[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.Errorf(errors.EventStreamsSubscribeBadSignatureParams)
+	}
+	return append(paramStrings, strings.TrimSpace(paramList[start:])), nil
+}
+
+// matchingParen returns the index of the parenthesis that closes the one at the start of the string
+func matchingParen(s string) int {
+	depth := 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
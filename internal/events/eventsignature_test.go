@@ -0,0 +1,104 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEventSignatureCanonical(t *testing.T) {
+	assert := assert.New(t)
+
+	event, err := ParseEventSignature("Transfer(address,address,uint256)")
+	assert.NoError(err)
+	assert.Equal(&ethbinding.ABIElementMarshaling{
+		Type: "event",
+		Name: "Transfer",
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "input", Type: "address"},
+			{Name: "input1", Type: "address"},
+			{Name: "input2", Type: "uint256"},
+		},
+	}, event)
+}
+
+func TestParseEventSignatureIndexedNamed(t *testing.T) {
+	assert := assert.New(t)
+
+	event, err := ParseEventSignature("event Transfer(address indexed from, address indexed to, uint256 value)")
+	assert.NoError(err)
+	assert.Equal([]ethbinding.ABIArgumentMarshaling{
+		{Name: "from", Type: "address", Indexed: true},
+		{Name: "to", Type: "address", Indexed: true},
+		{Name: "value", Type: "uint256"},
+	}, event.Inputs)
+}
+
+func TestParseEventSignatureNoParams(t *testing.T) {
+	assert := assert.New(t)
+
+	event, err := ParseEventSignature("Paused()")
+	assert.NoError(err)
+	assert.Equal("Paused", event.Name)
+	assert.Empty(event.Inputs)
+}
+
+func TestParseEventSignatureTuples(t *testing.T) {
+	assert := assert.New(t)
+
+	event, err := ParseEventSignature("Batch((address,(uint256,bytes32)[])[] items, uint8)")
+	assert.NoError(err)
+	assert.Equal([]ethbinding.ABIArgumentMarshaling{
+		{
+			Name: "items",
+			Type: "tuple[]",
+			Components: []ethbinding.ABIArgumentMarshaling{
+				{Name: "input", Type: "address"},
+				{
+					Name: "input1",
+					Type: "tuple[]",
+					Components: []ethbinding.ABIArgumentMarshaling{
+						{Name: "input", Type: "uint256"},
+						{Name: "input1", Type: "bytes32"},
+					},
+				},
+			},
+		},
+		{Name: "input1", Type: "uint8"},
+	}, event.Inputs)
+}
+
+func TestParseEventSignatureErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for sig, errMsg := range map[string]string{
+		"Transfer":                        "expected Name\\(type1,type2,...\\)",
+		"1Transfer(address)":              "invalid event name",
+		"Transfer(address,,uint256)":      "malformed parameter list",
+		"Transfer(address)),(address)":    "malformed parameter list",
+		"Transfer((address,uint256)":      "malformed parameter list",
+		"Transfer((address)x)":            "malformed parameter list",
+		"Transfer(address indexed a b)":   "malformed parameter list",
+		"Transfer(address 1a)":            "malformed parameter list",
+		"Transfer(((address) indexed a))": "malformed parameter list",
+		"Transfer(badness)":               "unsupported arg type",
+	} {
+		_, err := ParseEventSignature(sig)
+		assert.Regexp("Invalid event signature '.*': "+errMsg, err, sig)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	// OversizedEventsTruncate delivers an event larger than the maximum event size of the stream
+	// without its data, which is stored so it can be fetched over REST
+	OversizedEventsTruncate = "truncate"
+	// OversizedEventsDeadLetter skips an event larger than the maximum event size of the stream into a dead letter
+	OversizedEventsDeadLetter = "deadletter"
+
+	oversizedEventIDPrefix = "oe-"
+)
+
+// truncatedData replaces the data of an event that is larger than the stream allows
+type truncatedData struct {
+	Size int    `json:"size"`           // of the full event as JSON, in bytes
+	Href string `json:"href,omitempty"` // the REST path to fetch the full event
+}
+
+// OversizedEvent is the full content of an event that was truncated for delivery on a stream
+type OversizedEvent struct {
+	messages.TimeSorted
+	ID     string     `json:"id"`
+	Stream string     `json:"stream"`
+	Size   int        `json:"size"`
+	Event  *eventData `json:"event"`
+}
+
+func oversizedEventKey(streamID, id string) string {
+	return oversizedEventIDPrefix + streamID + "/" + id
+}
+
+// OversizedEventPath is the REST path to fetch the full content of a truncated event
+func OversizedEventPath(streamID, id string) string {
+	return StreamPathPrefix + "/" + streamID + "/oversized/" + id
+}
+
+// validateOversizedEvents normalizes the policy for events larger than the maximum event size
+// of a stream, which defaults to truncating them
+func validateOversizedEvents(spec *StreamInfo) error {
+	spec.OversizedEvents = strings.ToLower(spec.OversizedEvents)
+	switch spec.OversizedEvents {
+	case "":
+		if spec.MaxEventSize > 0 {
+			spec.OversizedEvents = OversizedEventsTruncate
+		}
+	case OversizedEventsTruncate, OversizedEventsDeadLetter:
+	default:
+		return errors.Errorf(errors.EventStreamsOversizedEventsUnknown, spec.OversizedEvents)
+	}
+	return nil
+}
+
+// limitEventSize applies the policy of the stream to the events larger than its maximum event
+// size, measured as JSON before any payload mapping. Truncated events are replaced in the batch,
+// and the events to be skipped into a dead letter are returned separately
+func (a *eventStream) limitEventSize(events []*eventData) (deliver, oversized []*eventData) {
+	if a.spec.MaxEventSize == 0 {
+		return events, nil
+	}
+	deliver = make([]*eventData, 0, len(events))
+	for _, event := range events {
+		b, _ := json.Marshal(event)
+		if uint64(len(b)) <= a.spec.MaxEventSize {
+			deliver = append(deliver, event)
+			continue
+		}
+		if a.spec.OversizedEvents == OversizedEventsDeadLetter {
+			log.Warnf("%s: Skipping event of %d bytes in block %s, over the maximum of %d", a.spec.ID, len(b), event.BlockNumber, a.spec.MaxEventSize)
+			oversized = append(oversized, event)
+			continue
+		}
+		deliver = append(deliver, a.truncateEvent(event, len(b)))
+	}
+	return deliver, oversized
+}
+
+// truncateEvent stores the full event, and returns a copy without its data that points to it.
+// The event is stored under its dedup key where it has one, so delivering it again does not
+// store another copy
+func (a *eventStream) truncateEvent(event *eventData, size int) *eventData {
+	id := event.DedupKey
+	if id == "" {
+		id = utils.UUIDv4()
+	}
+	truncated := *event
+	truncated.Data = map[string]interface{}{}
+	truncated.Truncated = &truncatedData{Size: size}
+	if err := a.sm.storeOversizedEvent(a.spec.ID, id, size, event); err != nil {
+		log.Errorf("%s: Failed to store oversized event %s: %s", a.spec.ID, id, err)
+	} else {
+		truncated.Truncated.Href = OversizedEventPath(a.spec.ID, id)
+	}
+	log.Warnf("%s: Truncated event of %d bytes in block %s, over the maximum of %d", a.spec.ID, size, event.BlockNumber, a.spec.MaxEventSize)
+	return &truncated
+}
+
+// storeOversizedEvent persists the full content of an event that is delivered truncated
+func (s *subscriptionMGR) storeOversizedEvent(streamID, id string, size int, event *eventData) error {
+	oe := &OversizedEvent{
+		TimeSorted: messages.TimeSorted{
+			CreatedISO8601: time.Now().UTC().Format(time.RFC3339Nano),
+		},
+		ID:     id,
+		Stream: streamID,
+		Size:   size,
+		Event:  event,
+	}
+	b, _ := json.Marshal(oe)
+	return s.db.Put(oversizedEventKey(streamID, id), b)
+}
+
+// OversizedEvent returns the full content of an event that was truncated for delivery on a stream
+func (s *subscriptionMGR) OversizedEvent(ctx context.Context, streamID, id string) (*OversizedEvent, error) {
+	if _, err := s.streamByID(streamID); err != nil {
+		return nil, err
+	}
+	b, err := s.db.Get(oversizedEventKey(streamID, id))
+	if err == leveldb.ErrNotFound {
+		return nil, errors.Errorf(errors.EventStreamsOversizedEventNotFound, id)
+	} else if err != nil {
+		return nil, err
+	}
+	var oe OversizedEvent
+	if err := json.Unmarshal(b, &oe); err != nil {
+		return nil, err
+	}
+	return &oe, nil
+}
+
+// DeleteOversizedEvent discards the full content of a truncated event, once the consumer has fetched it
+func (s *subscriptionMGR) DeleteOversizedEvent(ctx context.Context, streamID, id string) error {
+	if _, err := s.OversizedEvent(ctx, streamID, id); err != nil {
+		return err
+	}
+	return s.db.Delete(oversizedEventKey(streamID, id))
+}
+
+// deleteOversizedEvents removes the stored content of all the truncated events of a stream, when it is deleted
+func (s *subscriptionMGR) deleteOversizedEvents(streamID string) {
+	prefix := oversizedEventKey(streamID, "")
+	var keys []string
+	it := s.db.NewIterator()
+	for it.Next() {
+		if strings.HasPrefix(it.Key(), prefix) {
+			keys = append(keys, it.Key())
+		}
+	}
+	it.Release()
+	for _, key := range keys {
+		s.db.Delete(key)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func largeTestEvent(subID, dedupKey string) *eventData {
+	return &eventData{
+		SubID:         subID,
+		BlockNumber:   "1",
+		DedupKey:      dedupKey,
+		Data:          map[string]interface{}{"payload": strings.Repeat("a", 1000)},
+		batchComplete: func(*eventData) {},
+	}
+}
+
+func TestOversizedEventsTruncated(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:    2,
+			Webhook:      &webhookActionInfo{},
+			MaxEventSize: 500,
+		}, db, 200)
+	defer svr.Close()
+	defer stream.stop()
+	ctx := context.Background()
+	assert.Equal(OversizedEventsTruncate, stream.spec.OversizedEvents)
+
+	small := testEvent("sub1")
+	small.Data = map[string]interface{}{"payload": "small"}
+	stream.handleEvent(small)
+	stream.handleEvent(largeTestEvent("sub1", "k1"))
+	events := <-eventStream
+	assert.Len(events, 2)
+	assert.Equal("small", events[0].Data["payload"])
+	assert.Nil(events[0].Truncated)
+	assert.Empty(events[1].Data)
+	assert.Greater(events[1].Truncated.Size, 1000)
+	assert.Equal(StreamPathPrefix+"/"+stream.spec.ID+"/oversized/k1", events[1].Truncated.Href)
+
+	oe, err := sm.OversizedEvent(ctx, stream.spec.ID, "k1")
+	assert.NoError(err)
+	assert.Equal(events[1].Truncated.Size, oe.Size)
+	assert.Equal(strings.Repeat("a", 1000), oe.Event.Data["payload"])
+
+	err = sm.DeleteOversizedEvent(ctx, stream.spec.ID, "k1")
+	assert.NoError(err)
+	_, err = sm.OversizedEvent(ctx, stream.spec.ID, "k1")
+	assert.Regexp("Oversized event k1 not found", err)
+	err = sm.DeleteOversizedEvent(ctx, stream.spec.ID, "k1")
+	assert.Regexp("Oversized event k1 not found", err)
+	_, err = sm.OversizedEvent(ctx, "unknown", "k1")
+	assert.Regexp("Stream with ID 'unknown' not found", err)
+}
+
+func TestOversizedEventsDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:       2,
+			Webhook:         &webhookActionInfo{},
+			MaxEventSize:    500,
+			OversizedEvents: "DeadLetter",
+		}, db, 200)
+	defer svr.Close()
+	defer stream.stop()
+
+	completed := make(chan *eventData, 1)
+	small := testEvent("sub1")
+	large := largeTestEvent("sub1", "k1")
+	large.BlockNumber = "2"
+	large.batchComplete = func(e *eventData) { completed <- e }
+	stream.handleEvent(small)
+	stream.handleEvent(large)
+	events := <-eventStream
+	assert.Len(events, 1)
+
+	// The checkpoint moves past the skipped event
+	assert.Equal("2", (<-completed).BlockNumber)
+	deadLetters := waitForDeadLetters(sm, stream.spec.ID, 1)
+	assert.Len(deadLetters, 1)
+	assert.Equal("2", deadLetters[0].Events[0].BlockNumber)
+	assert.Regexp("maximum event size of 500 bytes", deadLetters[0].Error)
+}
+
+func TestOversizedEventsStoreFailure(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream()
+	defer stream.stop()
+	stream.spec.MaxEventSize = 500
+	stream.spec.OversizedEvents = OversizedEventsTruncate
+	stream.sm = &mockSubMgr{err: assert.AnError}
+
+	events, oversized := stream.limitEventSize([]*eventData{largeTestEvent("sub1", "")})
+	assert.Empty(oversized)
+	assert.Len(events, 1)
+	assert.Greater(events[0].Truncated.Size, 1000)
+	assert.Empty(events[0].Truncated.Href)
+}
+
+func TestOversizedEventsValidation(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+
+	_, err := sm.AddStream(ctx, &StreamInfo{
+		Type:            "websocket",
+		WebSocket:       &webSocketActionInfo{Topic: "t1"},
+		OversizedEvents: "drop",
+	})
+	assert.Regexp("Unknown oversized events policy 'drop'", err)
+
+	spec := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{}}
+	assert.NoError(validateOversizedEvents(spec))
+	assert.Empty(spec.OversizedEvents)
+}
+
+func TestOversizedEventsDeletedWithStream(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db, _ := kvstore.NewLDBKeyValueStore(dir)
+	sm, stream, svr, _ := newTestStreamForBatching(
+		&StreamInfo{
+			Webhook:      &webhookActionInfo{},
+			MaxEventSize: 500,
+		}, db, 200)
+	defer svr.Close()
+	ctx := context.Background()
+
+	err := sm.storeOversizedEvent(stream.spec.ID, "k1", 1024, largeTestEvent("sub1", "k1"))
+	assert.NoError(err)
+	err = sm.DeleteStream(ctx, stream.spec.ID)
+	assert.NoError(err)
+	_, err = db.Get(oversizedEventKey(stream.spec.ID, "k1"))
+	assert.Error(err)
+}
@@ -25,11 +25,13 @@ import (
 	"time"
 
 	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/chaos"
 	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
 	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
 	"github.com/kaleido-io/ethconnect/internal/ws"
 
-	lru "github.com/hashicorp/golang-lru"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -47,33 +49,51 @@ const (
 	ErrorHandlingBlock = "block"
 	// ErrorHandlingSkip processes up to the retry behavior on the stream, then skips to the next event
 	ErrorHandlingSkip = "skip"
+	// ErrorHandlingPause blocks like ErrorHandlingBlock, until the batch has failed PauseAfterFailures
+	// times, then pauses the stream until a probe of the receiver succeeds
+	ErrorHandlingPause = "pause"
 	// MaxBatchSize is the maximum that a user can specific for their batch size
 	MaxBatchSize = 1000
+	// MaxInFlightBatches is the maximum number of batches a stream can deliver concurrently
+	MaxInFlightBatches = 100
 	// DefaultExponentialBackoffInitial  is the initial delay for backoff retry
 	DefaultExponentialBackoffInitial = time.Duration(1) * time.Second
 	// DefaultExponentialBackoffFactor is the factor we use between retries
 	DefaultExponentialBackoffFactor = float64(2.0)
-	// DefaultTimestampCacheSize is the number of entries we will hold in a LRU cache for block timestamps
-	DefaultTimestampCacheSize = 1000
+	// DefaultTimestampCacheSize is the number of entries we will hold in a LRU cache for block timestamps.
+	// Streams with the default size share the cache of the JSON/RPC connection
+	DefaultTimestampCacheSize = eth.DefaultBlockTimestampCacheSize
 )
 
 // StreamInfo configures the stream to perform an action for each event
 type StreamInfo struct {
 	messages.TimeSorted
-	ID                   string               `json:"id"`
-	Name                 string               `json:"name,omitempty"`
-	Path                 string               `json:"path"`
-	Suspended            bool                 `json:"suspended"`
-	Type                 string               `json:"type,omitempty"`
-	BatchSize            uint64               `json:"batchSize,omitempty"`
-	BatchTimeoutMS       uint64               `json:"batchTimeoutMS,omitempty"`
-	ErrorHandling        string               `json:"errorHandling,omitempty"`
-	RetryTimeoutSec      uint64               `json:"retryTimeoutSec,omitempty"`
-	BlockedRetryDelaySec uint64               `json:"blockedReryDelaySec,omitempty"`
-	Webhook              *webhookActionInfo   `json:"webhook,omitempty"`
-	WebSocket            *webSocketActionInfo `json:"websocket,omitempty"`
-	Timestamps           bool                 `json:"timestamps,omitempty"` // Include block timestamps in the events generated
-	TimestampCacheSize   int                  `json:"timestampCacheSize,omitempty"`
+	ID                   string                 `json:"id"`
+	Name                 string                 `json:"name,omitempty"`
+	Path                 string                 `json:"path"`
+	Suspended            bool                   `json:"suspended"`
+	Type                 string                 `json:"type,omitempty"`
+	BatchSize            uint64                 `json:"batchSize,omitempty"`
+	BatchTimeoutMS       uint64                 `json:"batchTimeoutMS,omitempty"`
+	MaxInFlightBatches   uint64                 `json:"maxInFlightBatches,omitempty"` // Not for broadcast websockets. Batches are delivered one at a time while failing
+	ErrorHandling        string                 `json:"errorHandling,omitempty"`
+	RetryTimeoutSec      uint64                 `json:"retryTimeoutSec,omitempty"`
+	BlockedRetryDelaySec uint64                 `json:"blockedReryDelaySec,omitempty"`
+	PauseAfterFailures   uint64                 `json:"pauseAfterFailures,omitempty"` // With ErrorHandlingPause
+	ProbeIntervalSec     uint64                 `json:"probeIntervalSec,omitempty"`   // With ErrorHandlingPause
+	Webhook              *webhookActionInfo     `json:"webhook,omitempty"`
+	WebSocket            *webSocketActionInfo   `json:"websocket,omitempty"`
+	Transaction          *transactionActionInfo `json:"transaction,omitempty"`
+	Warehouse            *WarehouseActionInfo   `json:"warehouse,omitempty"`
+	Timestamps           bool                   `json:"timestamps,omitempty"` // Include block timestamps in the events generated
+	TimestampCacheSize   int                    `json:"timestampCacheSize,omitempty"`
+	AutoResume           *AutoResumeSpec        `json:"autoResume,omitempty"`      // Set while suspended until a block or time
+	Payload              *PayloadMapping        `json:"payload,omitempty"`         // Reshapes the delivered events
+	Format               string                 `json:"format,omitempty"`          // Delivers events in the format of another system, such as firefly
+	DeadLetter           bool                   `json:"deadLetter,omitempty"`      // Store batches skipped by ErrorHandlingSkip for replay
+	DedupWindowSec       uint64                 `json:"dedupWindowSec,omitempty"`  // Drop events delivered again within this time (0=disabled)
+	MaxEventSize         uint64                 `json:"maxEventSize,omitempty"`    // Largest event to deliver as is, in bytes of JSON (0=unlimited)
+	OversizedEvents      string                 `json:"oversizedEvents,omitempty"` // Policy for events over MaxEventSize - truncate or deadletter
 }
 
 type webhookActionInfo struct {
@@ -81,6 +101,9 @@ type webhookActionInfo struct {
 	Headers           map[string]string `json:"headers,omitempty"`
 	TLSkipHostVerify  bool              `json:"tlsSkipHostVerify,omitempty"`
 	RequestTimeoutSec uint32            `json:"requestTimeoutSec,omitempty"`
+	ProxyURL          string            `json:"proxyURL,omitempty"` // HTTP_PROXY/HTTPS_PROXY/NO_PROXY are used if not set
+	Auth              *webhookAuthInfo  `json:"auth,omitempty"`
+	ProbeURL          string            `json:"probeURL,omitempty"` // GET to check the receiver of a paused stream. The URL gets a HEAD if not set
 }
 
 type webSocketActionInfo struct {
@@ -101,20 +124,34 @@ type eventStream struct {
 	batchCond           *sync.Cond
 	batchQueue          *list.List
 	batchCount          uint64
+	activeBatches       uint64
+	nextAck             uint64
+	pendingAcks         map[uint64][]*eventData
 	initialRetryDelay   time.Duration
 	backoffFactor       float64
 	updateInProgress    bool
 	updateInterrupt     chan struct{}   // a zero-sized struct used only for signaling (hand rolled alternative to context)
 	updateWG            *sync.WaitGroup // Wait group for the go routines to reply back after they have stopped
-	blockTimestampCache *lru.Cache
+	blockTimestampCache *eth.BlockTimestampCache
 	action              eventStreamAction
 	wsChannels          ws.WebSocketChannels
+	idleSince           time.Time // when the stream was suspended, or started failing to deliver events
+	deliveryAttempts    uint64    // batch deliveries attempted since the last alert check
+	deliveryFailures    uint64    // batch deliveries failed since the last alert check
+	lastProbe           time.Time // when the receiver of a paused stream was last probed
+	probing             bool      // set while a probe of the receiver of a paused stream is in progress
+	dedup               *dedupWindow
 }
 
 type eventStreamAction interface {
 	attemptBatch(batchNumber, attempt uint64, events []*eventData) error
 }
 
+// stoppableAction is implemented by actions with work in progress to cancel when the stream stops
+type stoppableAction interface {
+	stop()
+}
+
 func validateWebSocket(w *webSocketActionInfo) error {
 	if w.DistributionMode != "" && w.DistributionMode != DistributionModeBroadcast && w.DistributionMode != DistributionModeWLD {
 		return errors.Errorf(errors.EventStreamsInvalidDistributionMode, w.DistributionMode)
@@ -139,13 +176,20 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 	if spec.BatchTimeoutMS == 0 {
 		spec.BatchTimeoutMS = 5000
 	}
+	if spec.MaxInFlightBatches == 0 {
+		spec.MaxInFlightBatches = 1
+	} else if spec.MaxInFlightBatches > MaxInFlightBatches {
+		spec.MaxInFlightBatches = MaxInFlightBatches
+	}
 	if spec.BlockedRetryDelaySec == 0 {
 		spec.BlockedRetryDelaySec = 30
 	}
-	if strings.ToLower(spec.ErrorHandling) == ErrorHandlingBlock {
-		spec.ErrorHandling = ErrorHandlingBlock
-	} else {
-		spec.ErrorHandling = ErrorHandlingSkip
+	spec.ErrorHandling = normalizeErrorHandling(spec.ErrorHandling)
+	if spec.PauseAfterFailures == 0 {
+		spec.PauseAfterFailures = DefaultPauseAfterFailures
+	}
+	if spec.ProbeIntervalSec == 0 {
+		spec.ProbeIntervalSec = DefaultProbeIntervalSec
 	}
 	if spec.TimestampCacheSize == 0 {
 		spec.TimestampCacheSize = DefaultTimestampCacheSize
@@ -162,9 +206,21 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		backoffFactor:     DefaultExponentialBackoffFactor,
 		pollingInterval:   time.Duration(sm.config().EventPollingIntervalSec) * time.Second,
 		wsChannels:        wsChannels,
+		dedup:             newDedupWindow(),
+	}
+	a.resetAcks()
+	if spec.Suspended {
+		// We do not persist when the suspension happened, so the clock starts on recovery
+		a.idleSince = time.Now().UTC()
 	}
 
-	if a.blockTimestampCache, err = lru.New(spec.TimestampCacheSize); err != nil {
+	if spec.TimestampCacheSize == DefaultTimestampCacheSize {
+		a.blockTimestampCache = sm.blockTimestamps()
+	}
+	if a.blockTimestampCache == nil {
+		a.blockTimestampCache, err = eth.NewBlockTimestampCache(spec.TimestampCacheSize)
+	}
+	if err != nil {
 		return nil, errors.Errorf(errors.EventStreamsCreateStreamResourceErr, err)
 	}
 	if a.pollingInterval == 0 {
@@ -172,7 +228,19 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		a.pollingInterval = 10 * time.Millisecond
 	}
 
+	if err := validatePayloadMapping(spec.Payload); err != nil {
+		return nil, err
+	}
+	if err := validateFormat(spec); err != nil {
+		return nil, err
+	}
+	if err := validateOversizedEvents(spec); err != nil {
+		return nil, err
+	}
 	spec.Type = strings.ToLower(spec.Type)
+	if spec.MaxInFlightBatches > 1 && !spec.supportsConcurrentBatches() {
+		return nil, errors.Errorf(errors.EventStreamsMaxInFlightBatchesUnsupported)
+	}
 	switch spec.Type {
 	case "webhook":
 		if a.action, err = newWebhookAction(a, spec.Webhook); err != nil {
@@ -189,6 +257,14 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		if a.action, err = newWebSocketAction(a, spec.WebSocket); err != nil {
 			return nil, err
 		}
+	case "transaction":
+		if a.action, err = newTransactionAction(a, spec.Transaction); err != nil {
+			return nil, err
+		}
+	case "warehouse":
+		if a.action, err = newWarehouseAction(a, spec.Warehouse); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.Errorf(errors.EventStreamsInvalidActionType, spec.Type)
 	}
@@ -218,6 +294,21 @@ func (spec *StreamInfo) GetID() string {
 	return spec.ID
 }
 
+// redacted returns the spec with its secrets masked, for the responses of the API
+func (spec *StreamInfo) redacted() *StreamInfo {
+	if spec.Warehouse == nil && spec.Webhook == nil {
+		return spec
+	}
+	r := *spec
+	if spec.Warehouse != nil {
+		r.Warehouse = spec.Warehouse.redacted()
+	}
+	if spec.Webhook != nil {
+		r.Webhook = spec.Webhook.redacted()
+	}
+	return &r
+}
+
 // preUpdateStream sets a flag to indicate updateInProgress and wakes up goroutines waiting on condition variable
 func (a *eventStream) preUpdateStream() {
 	a.batchCond.L.Lock()
@@ -232,6 +323,7 @@ func (a *eventStream) postUpdateStream() {
 	a.pollerDone = false
 	a.processorDone = false
 	a.updateInProgress = false
+	a.resetAcks()
 	a.batchCond.L.Unlock()
 	a.startEventHandlers(false)
 }
@@ -239,6 +331,30 @@ func (a *eventStream) postUpdateStream() {
 // update modifies an existing eventStream
 func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error) {
 	log.Infof("%s: Update event stream", a.spec.ID)
+	// Checked before the handlers are stopped, so an invalid mapping leaves the stream running
+	if err = validatePayloadMapping(newSpec.Payload); err != nil {
+		return nil, err
+	}
+	if err = validateFormat(newSpec); err != nil {
+		return nil, err
+	}
+	if err = validateOversizedEvents(newSpec); err != nil {
+		return nil, err
+	}
+	if newSpec.Format != "" && newSpec.Payload == nil && !a.spec.Payload.isEmpty() {
+		return nil, errors.Errorf(errors.EventStreamsFormatWithPayload, newSpec.Format)
+	}
+	if a.spec.Type == "transaction" && newSpec.Transaction != nil {
+		if err = validateInvocationRules(newSpec.Transaction); err != nil {
+			return nil, err
+		}
+	}
+	if a.spec.Type == "warehouse" && newSpec.Warehouse != nil {
+		newSpec.Warehouse.keepRedactedSecrets(a.spec.Warehouse)
+		if err = validateWarehouse(newSpec.Warehouse); err != nil {
+			return nil, err
+		}
+	}
 	// set a flag to indicate updateInProgress
 	// For any go routines that are Wait() ing on the eventListener, wake them up
 	a.preUpdateStream()
@@ -251,27 +367,52 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 		return nil, errors.Errorf(errors.EventStreamsCannotUpdateType)
 	}
 	if a.spec.Type == "webhook" && newSpec.Webhook != nil {
+		newSpec.Webhook.keepRedactedSecrets(a.spec.Webhook)
 		if newSpec.Webhook.URL == "" {
 			return nil, errors.Errorf(errors.EventStreamsWebhookNoURL)
 		}
 		if _, err = url.Parse(newSpec.Webhook.URL); err != nil {
 			return nil, errors.Errorf(errors.EventStreamsWebhookInvalidURL)
 		}
+		if _, err = url.Parse(newSpec.Webhook.ProbeURL); err != nil {
+			return nil, errors.Errorf(errors.EventStreamsWebhookInvalidProbeURL)
+		}
+		if _, err = utils.ProxyFunc(newSpec.Webhook.ProxyURL); err != nil {
+			return nil, err
+		}
+		if err = validateWebhookAuth(newSpec.Webhook.Auth); err != nil {
+			return nil, err
+		}
 		if newSpec.Webhook.RequestTimeoutSec == 0 {
 			newSpec.Webhook.RequestTimeoutSec = 120
 		}
 		a.spec.Webhook.URL = newSpec.Webhook.URL
+		a.spec.Webhook.ProxyURL = newSpec.Webhook.ProxyURL
 		a.spec.Webhook.RequestTimeoutSec = newSpec.Webhook.RequestTimeoutSec
 		a.spec.Webhook.TLSkipHostVerify = newSpec.Webhook.TLSkipHostVerify
 		a.spec.Webhook.Headers = newSpec.Webhook.Headers
+		a.spec.Webhook.Auth = newSpec.Webhook.Auth
+		a.spec.Webhook.ProbeURL = newSpec.Webhook.ProbeURL
 	}
 	if a.spec.Type == "websocket" && newSpec.WebSocket != nil {
 		a.spec.WebSocket.Topic = newSpec.WebSocket.Topic
 		if err := validateWebSocket(newSpec.WebSocket); err != nil {
 			return nil, err
 		}
+		if newSpec.WebSocket.DistributionMode == DistributionModeBroadcast && a.spec.MaxInFlightBatches > 1 && newSpec.MaxInFlightBatches != 1 {
+			return nil, errors.Errorf(errors.EventStreamsMaxInFlightBatchesUnsupported)
+		}
 		a.spec.WebSocket.DistributionMode = newSpec.WebSocket.DistributionMode
 	}
+	if a.spec.Type == "transaction" && newSpec.Transaction != nil {
+		a.action.(*transactionAction).updateRules(newSpec.Transaction.Rules)
+	}
+	if a.spec.Type == "warehouse" && newSpec.Warehouse != nil {
+		if newSpec.Warehouse.RequestTimeoutSec == 0 {
+			newSpec.Warehouse.RequestTimeoutSec = 120
+		}
+		a.spec.Warehouse = newSpec.Warehouse
+	}
 
 	if a.spec.BatchSize != newSpec.BatchSize && newSpec.BatchSize != 0 && newSpec.BatchSize < MaxBatchSize {
 		a.spec.BatchSize = newSpec.BatchSize
@@ -279,13 +420,21 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 	if a.spec.BatchTimeoutMS != newSpec.BatchTimeoutMS && newSpec.BatchTimeoutMS != 0 {
 		a.spec.BatchTimeoutMS = newSpec.BatchTimeoutMS
 	}
+	if a.spec.MaxInFlightBatches != newSpec.MaxInFlightBatches && newSpec.MaxInFlightBatches != 0 && newSpec.MaxInFlightBatches <= MaxInFlightBatches {
+		if newSpec.MaxInFlightBatches > 1 && !a.spec.supportsConcurrentBatches() {
+			return nil, errors.Errorf(errors.EventStreamsMaxInFlightBatchesUnsupported)
+		}
+		a.spec.MaxInFlightBatches = newSpec.MaxInFlightBatches
+	}
 	if a.spec.BlockedRetryDelaySec != newSpec.BlockedRetryDelaySec && newSpec.BlockedRetryDelaySec != 0 {
 		a.spec.BlockedRetryDelaySec = newSpec.BlockedRetryDelaySec
 	}
-	if strings.ToLower(newSpec.ErrorHandling) == ErrorHandlingBlock {
-		a.spec.ErrorHandling = ErrorHandlingBlock
-	} else {
-		a.spec.ErrorHandling = ErrorHandlingSkip
+	a.spec.ErrorHandling = normalizeErrorHandling(newSpec.ErrorHandling)
+	if newSpec.PauseAfterFailures != 0 {
+		a.spec.PauseAfterFailures = newSpec.PauseAfterFailures
+	}
+	if newSpec.ProbeIntervalSec != 0 {
+		a.spec.ProbeIntervalSec = newSpec.ProbeIntervalSec
 	}
 	if newSpec.Name != "" && a.spec.Name != newSpec.Name {
 		a.spec.Name = newSpec.Name
@@ -293,6 +442,18 @@ func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error)
 	if a.spec.Timestamps != newSpec.Timestamps {
 		a.spec.Timestamps = newSpec.Timestamps
 	}
+	a.spec.DeadLetter = newSpec.DeadLetter
+	a.spec.Format = newSpec.Format
+	a.spec.DedupWindowSec = newSpec.DedupWindowSec
+	a.spec.MaxEventSize = newSpec.MaxEventSize
+	a.spec.OversizedEvents = newSpec.OversizedEvents
+	if newSpec.Payload != nil {
+		// An empty mapping removes it
+		a.spec.Payload = newSpec.Payload
+		if newSpec.Payload.isEmpty() {
+			a.spec.Payload = nil
+		}
+	}
 	a.postUpdateStream()
 	return a.spec, nil
 }
@@ -311,12 +472,24 @@ func (a *eventStream) stop() {
 	close(a.eventStream)
 	a.batchCond.Broadcast()
 	a.batchCond.L.Unlock()
+	if stoppable, ok := a.action.(stoppableAction); ok {
+		stoppable.stop()
+	}
 }
 
 // suspend only stops the dispatcher, pushing back as if we're in blocking mode
 func (a *eventStream) suspend() {
+	a.suspendUntil(nil)
+}
+
+// suspendUntil suspends the dispatcher, recording when it should be automatically resumed
+func (a *eventStream) suspendUntil(until *AutoResumeSpec) {
 	a.batchCond.L.Lock()
 	a.spec.Suspended = true
+	a.spec.AutoResume = until
+	if a.idleSince.IsZero() {
+		a.idleSince = time.Now().UTC()
+	}
 	a.batchCond.Broadcast()
 	a.batchCond.L.Unlock()
 }
@@ -329,14 +502,24 @@ func (a *eventStream) resume() error {
 		return errors.Errorf(errors.EventStreamsWebhookResumeActive, a.spec.Suspended)
 	}
 	a.spec.Suspended = false
+	a.spec.AutoResume = nil
+	a.idleSince = time.Time{}
 	a.processorDone = false
 	a.pollerDone = false
+	a.resetAcks()
 
 	a.startEventHandlers(true)
 	a.batchCond.Broadcast()
 	return nil
 }
 
+// isStopped is true once a suspended or stopped stream has finished polling, and delivering batches
+func (a *eventStream) isStopped() bool {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	return a.processorDone && a.pollerDone
+}
+
 // isBlocked protect us from polling for more events when the stream is blocked.
 // Can happen regardless of whether the error handling is
 // block or skip. It's just with skip we eventually move onto new messages
@@ -344,10 +527,10 @@ func (a *eventStream) resume() error {
 func (a *eventStream) isBlocked() bool {
 	a.batchCond.L.Lock()
 	inFlight := a.inFlight
-	v := inFlight >= a.spec.BatchSize
+	v := inFlight >= a.spec.BatchSize*a.spec.MaxInFlightBatches
 	a.batchCond.L.Unlock()
 	if v {
-		log.Warnf("%s: Is currently blocked. InFlight=%d BatchSize=%d", a.spec.ID, inFlight, a.spec.BatchSize)
+		log.Warnf("%s: Is currently blocked. InFlight=%d BatchSize=%d MaxInFlightBatches=%d", a.spec.ID, inFlight, a.spec.BatchSize, a.spec.MaxInFlightBatches)
 	}
 	return v
 }
@@ -517,6 +700,36 @@ func (a *eventStream) suspendOrStop() bool {
 	return a.spec.Suspended || a.stopped
 }
 
+// supportsConcurrentBatches is true for the actions that acknowledge each batch individually -
+// webhooks, warehouses, and websockets that deliver each batch to a single client
+func (spec *StreamInfo) supportsConcurrentBatches() bool {
+	switch spec.Type {
+	case "webhook", "warehouse":
+		return true
+	case "websocket":
+		return spec.WebSocket == nil || spec.WebSocket.DistributionMode != DistributionModeBroadcast
+	default:
+		return false
+	}
+}
+
+// batchConcurrency is the number of batches that can currently be delivered at once.
+// Delivery falls back to one batch at a time while the stream is failing to deliver,
+// so a receiver that is down is not flooded with retries. Caller must hold the lock
+func (a *eventStream) batchConcurrency() uint64 {
+	if a.spec.MaxInFlightBatches <= 1 || !a.idleSince.IsZero() {
+		return 1
+	}
+	return a.spec.MaxInFlightBatches
+}
+
+// resetAcks restarts the ordering of acknowledgements from the next batch, discarding any
+// pending from before a suspend or update. Caller must hold the lock
+func (a *eventStream) resetAcks() {
+	a.nextAck = a.batchCount + 1
+	a.pendingAcks = make(map[uint64][]*eventData)
+}
+
 // batchProcessor picks up batches from the batchDispatcher, and performs the blocking
 // actions required to perform the action itself.
 // We use a sync.Cond rather than a channel to communicate with this goroutine, as
@@ -526,7 +739,7 @@ func (a *eventStream) batchProcessor() {
 	for {
 		// Wait for the next batch, or to be stopped
 		a.batchCond.L.Lock()
-		for !a.suspendOrStop() && a.batchQueue.Len() == 0 {
+		for !a.suspendOrStop() && (a.batchQueue.Len() == 0 || a.activeBatches >= a.batchConcurrency()) {
 			if a.updateInProgress {
 				select {
 				case <-a.updateInterrupt:
@@ -542,6 +755,10 @@ func (a *eventStream) batchProcessor() {
 		}
 		if a.suspendOrStop() {
 			log.Infof("%s: Suspended, returning exiting batch processor", a.spec.ID)
+			// Do not report we are done until any batches being delivered concurrently have returned
+			for a.activeBatches > 0 {
+				a.batchCond.Wait()
+			}
 			a.batchCond.L.Unlock()
 			return
 		}
@@ -549,15 +766,30 @@ func (a *eventStream) batchProcessor() {
 		a.batchCount++
 		batchNumber := a.batchCount
 		a.batchQueue.Remove(batchElem)
+		a.activeBatches++
+		concurrent := a.spec.MaxInFlightBatches > 1
 		a.batchCond.L.Unlock()
 		// Process the batch - could block for a very long time, particularly if
 		// ErrorHandlingBlock is configured.
 		// Track this as an item in the update wait group
 		a.updateWG.Add(1)
-		a.processBatch(batchNumber, batchElem.Value.([]*eventData))
+		if concurrent {
+			go a.processActiveBatch(batchNumber, batchElem.Value.([]*eventData))
+		} else {
+			a.processActiveBatch(batchNumber, batchElem.Value.([]*eventData))
+		}
 	}
 }
 
+// processActiveBatch processes a batch, and then frees up its slot for the next batch
+func (a *eventStream) processActiveBatch(batchNumber uint64, events []*eventData) {
+	a.processBatch(batchNumber, events)
+	a.batchCond.L.Lock()
+	a.activeBatches--
+	a.batchCond.Broadcast()
+	a.batchCond.L.Unlock()
+}
+
 // processBatch is the blocking function to process a batch of events
 // It never returns an error, and uses the chosen block/skip ErrorHandling
 // behaviour combined with the parameters on the event itself
@@ -566,8 +798,19 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 	if len(events) == 0 {
 		return
 	}
+	events, oversized := a.limitEventSize(events)
+	var duplicates []*eventData
+	// The events still held in-flight by the batch are released on every exit without an ack,
+	// as the stream redelivers them from its checkpoint. Purged events are released as they are dropped
+	acked := false
+	defer func() {
+		if !acked {
+			a.releaseInFlight(len(events) + len(oversized) + len(duplicates))
+		}
+	}()
 	processed := false
 	attempt := 0
+	var err error
 	for !a.suspendOrStop() && !processed {
 		if attempt > 0 {
 			select {
@@ -578,10 +821,19 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 			case <-time.After(time.Duration(a.spec.BlockedRetryDelaySec) * time.Second): //fall through and continue
 			}
 		}
+		var dropped []*eventData
+		events, dropped = a.dropDuplicateEvents(a.dropPurgedEvents(events))
+		duplicates = append(duplicates, dropped...)
+		if len(events) == 0 {
+			log.Infof("%s: Batch %d discarded, as all its events were purged or already delivered", a.spec.ID, batchNumber)
+			processed = true
+			break
+		}
 		attempt++
 		log.Infof("%s: Batch %d initiated with %d events. FirstBlock=%s LastBlock=%s", a.spec.ID, batchNumber, len(events), events[0].BlockNumber, events[len(events)-1].BlockNumber)
 		a.updateWG.Add(1)
-		err := a.performActionWithRetry(batchNumber, events)
+		err = a.performActionWithRetry(batchNumber, events)
+		a.markDeliveryResult(err)
 		// If we got an error after all of the internal retries within the event
 		// handler failed, then the ErrorHandling strategy kicks in
 		processed = (err == nil)
@@ -589,31 +841,167 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 			log.Errorf("%s: Batch %d attempt %d failed. ErrorHandling=%s BlockedRetryDelay=%ds",
 				a.spec.ID, batchNumber, attempt, a.spec.ErrorHandling, a.spec.BlockedRetryDelaySec)
 			processed = (a.spec.ErrorHandling == ErrorHandlingSkip)
+			if a.spec.ErrorHandling == ErrorHandlingPause && uint64(attempt) >= a.spec.PauseAfterFailures {
+				a.pauseOnError(batchNumber, attempt)
+			}
 		}
 	}
-
-	// decrement the in-flight count if we've processed (wouldn't have occurred if we were suspended or stopped)
-	a.batchCond.L.Lock()
-	if processed {
-		a.inFlight -= uint64(len(events))
+	if processed && err != nil && a.spec.DeadLetter {
+		a.sm.storeDeadLetter(a.spec.ID, events, err)
+	}
+	if processed && err == nil && a.spec.DedupWindowSec > 0 {
+		a.dedup.record(events, time.Duration(a.spec.DedupWindowSec)*time.Second)
+	}
+	if processed && len(oversized) > 0 {
+		a.sm.storeDeadLetter(a.spec.ID, oversized, errors.Errorf(errors.EventStreamsEventTooLarge, a.spec.MaxEventSize))
 	}
-	a.batchCond.L.Unlock()
 
 	// If we were suspended, do not ack the batch
 	if a.suspendOrStop() {
 		return
 	}
 
-	// Call all the callbacks on the events, so they can update their high water marks
-	// If there are multiple events from one SubID, we call it only once with the
-	// last message in the batch
-	cbs := make(map[string]*eventData)
+	// The oversized and duplicate events are acknowledged with the batch, so the checkpoint moves past them
+	acked = true
+	ackEvents := make([]*eventData, 0, len(events)+len(oversized)+len(duplicates))
+	ackEvents = append(append(append(ackEvents, events...), oversized...), duplicates...)
+	a.ackBatch(batchNumber, ackEvents)
+}
+
+// releaseInFlight decrements the in-flight count for events that will not be acknowledged
+func (a *eventStream) releaseInFlight(count int) {
+	if count == 0 {
+		return
+	}
+	a.batchCond.L.Lock()
+	a.inFlight -= uint64(count)
+	a.batchCond.L.Unlock()
+}
+
+// dropPurgedEvents removes the events of subscriptions that were deleted with their
+// undelivered events purged, before each attempt to deliver a batch
+func (a *eventStream) dropPurgedEvents(events []*eventData) []*eventData {
+	remaining := make([]*eventData, 0, len(events))
 	for _, event := range events {
-		cbs[event.SubID] = event
+		if event.purged == nil || !event.purged() {
+			remaining = append(remaining, event)
+		}
 	}
-	for _, event := range cbs {
-		event.batchComplete(event)
+	if dropped := len(events) - len(remaining); dropped > 0 {
+		log.Infof("%s: Discarding %d purged events", a.spec.ID, dropped)
+		a.releaseInFlight(dropped)
 	}
+	return remaining
+}
+
+// dropDuplicateEvents removes the events that have already been delivered within the dedup
+// window of the stream, such as those polled again from the checkpoint after a suspend or update.
+// The duplicates are returned to be acknowledged with the batch, so they complete in order
+// with the other events of their subscriptions
+func (a *eventStream) dropDuplicateEvents(events []*eventData) (remaining, duplicates []*eventData) {
+	if a.spec.DedupWindowSec == 0 || len(events) == 0 {
+		return events, nil
+	}
+	remaining = a.dedup.filter(events)
+	if len(remaining) == len(events) {
+		return remaining, nil
+	}
+	kept := make(map[*eventData]bool, len(remaining))
+	for _, event := range remaining {
+		kept[event] = true
+	}
+	for _, event := range events {
+		if !kept[event] {
+			duplicates = append(duplicates, event)
+		}
+	}
+	log.Infof("%s: Discarding %d events already delivered", a.spec.ID, len(duplicates))
+	return remaining, duplicates
+}
+
+// ackBatch calls back to the subscriptions so they can update their high water marks,
+// and decrements the in-flight count. Batches delivered concurrently can complete out
+// of order, so each is held until all the batches before it have been acked, to ensure
+// a checkpoint never moves past an event that has not been delivered
+func (a *eventStream) ackBatch(batchNumber uint64, events []*eventData) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if batchNumber < a.nextAck {
+		// Dispatched before a suspend or update, after which we restart from the checkpoint
+		log.Infof("%s: Discarding ack for batch %d", a.spec.ID, batchNumber)
+		a.inFlight -= uint64(len(events))
+		return
+	}
+	a.pendingAcks[batchNumber] = events
+	for {
+		events, ok := a.pendingAcks[a.nextAck]
+		if !ok {
+			break
+		}
+		delete(a.pendingAcks, a.nextAck)
+		a.nextAck++
+		a.inFlight -= uint64(len(events))
+
+		// If there are multiple events from one SubID, we call it only once with the
+		// last message in the batch
+		cbs := make(map[string]*eventData)
+		for _, event := range events {
+			cbs[event.SubID] = event
+		}
+		for _, event := range cbs {
+			event.batchComplete(event)
+		}
+	}
+}
+
+// markDeliveryResult tracks how long the stream has been unable to deliver events,
+// which is cleared as soon as a batch is delivered successfully
+func (a *eventStream) markDeliveryResult(err error) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	a.deliveryAttempts++
+	if err != nil {
+		a.deliveryFailures++
+	}
+	if err == nil {
+		if !a.spec.Suspended {
+			a.idleSince = time.Time{}
+		}
+	} else if a.idleSince.IsZero() {
+		a.idleSince = time.Now().UTC()
+	}
+}
+
+// deliveryStats returns the delivery attempts and failures since it was last called, and
+// whether the stream is suspended
+func (a *eventStream) deliveryStats() (attempts, failures uint64, suspended bool) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	attempts, failures = a.deliveryAttempts, a.deliveryFailures
+	a.deliveryAttempts, a.deliveryFailures = 0, 0
+	return attempts, failures, a.spec.Suspended
+}
+
+// autoResumeState returns when a suspended stream should be resumed, or nil if it is not
+// suspended until a block or time
+func (a *eventStream) autoResumeState() *AutoResumeSpec {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if !a.spec.Suspended || a.spec.AutoResume == nil {
+		return nil
+	}
+	until := *a.spec.AutoResume
+	return &until
+}
+
+// idleState returns when the stream became idle, and why, or a zero time if it is active
+func (a *eventStream) idleState() (time.Time, string) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.spec.Suspended {
+		return a.idleSince, IdleReasonSuspended
+	}
+	return a.idleSince, IdleReasonUnreachable
 }
 
 // performActionWithRetry performs an action, with exponential backoff retry up
@@ -639,9 +1027,17 @@ func (a *eventStream) performActionWithRetry(batchNumber uint64, events []*event
 			delay = time.Duration(float64(delay) * a.backoffFactor)
 		}
 		attempt++
+		chaos.Delay()
 		err = a.action.attemptBatch(batchNumber, attempt, events)
 		complete = err == nil || endTime.Sub(time.Now()) < 0
 	}
+	if complete && err == nil && (a.spec.Type == "webhook" || a.spec.Type == "websocket") && chaos.DuplicateEvents() {
+		// Consumers must tolerate a batch being delivered again, as they would after a lost ack
+		log.Warnf("%s: Chaos: delivering batch %d again", a.spec.ID, batchNumber)
+		if dupErr := a.action.attemptBatch(batchNumber, attempt+1, events); dupErr != nil {
+			log.Warnf("%s: Chaos: duplicate delivery of batch %d failed: %s", a.spec.ID, batchNumber, dupErr)
+		}
+	}
 	return err
 }
 
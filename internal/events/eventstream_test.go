@@ -22,15 +22,18 @@ import (
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/chaos"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/eth"
 	"github.com/kaleido-io/ethconnect/internal/ethbind"
 	"github.com/kaleido-io/ethconnect/internal/kvstore"
+	"github.com/kaleido-io/ethconnect/internal/ws"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -71,6 +74,19 @@ func TestConstructorBadWebhookURL(t *testing.T) {
 	assert.EqualError(err, "Invalid URL in webhook action")
 }
 
+func TestConstructorBadWebhookProxyURL(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:   "123",
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:      "http://example.com",
+			ProxyURL: "proxy.example.com",
+		},
+	}, nil)
+	assert.EqualError(err, "Invalid proxy URL 'proxy.example.com'")
+}
+
 func TestConstructorBadWebSocketDistributionMode(t *testing.T) {
 	assert := assert.New(t)
 	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
@@ -113,7 +129,6 @@ func newTestStreamForBatching(spec *StreamInfo, db kvstore.KVStore, status ...in
 		spec.Webhook.Headers = map[string]string{"x-my-header": "my-value"}
 	}
 	sm := newTestSubscriptionManager()
-	sm.config().WebhooksAllowPrivateIPs = true
 	sm.config().EventPollingIntervalSec = 0
 	if db != nil {
 		sm.db = db
@@ -399,6 +414,203 @@ func TestBuildup(t *testing.T) {
 
 }
 
+func TestConcurrentBatches(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling:      ErrorHandlingBlock,
+			MaxInFlightBatches: 3,
+			Webhook:            &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	var completeLock sync.Mutex
+	var completed []string
+	for i := 0; i < 3; i++ {
+		subID := fmt.Sprintf("sub%d", i)
+		stream.handleEvent(&eventData{
+			SubID: subID,
+			batchComplete: func(*eventData) {
+				completeLock.Lock()
+				completed = append(completed, subID)
+				completeLock.Unlock()
+			},
+		})
+	}
+
+	// All three batches are delivered before any of them returns
+	received := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		batch := <-eventStream
+		assert.Len(batch, 1)
+		received[batch[0].SubID] = true
+	}
+	assert.Len(received, 3)
+
+	for stream.isBlocked() || stream.inFlight > 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	completeLock.Lock()
+	assert.Equal([]string{"sub0", "sub1", "sub2"}, completed)
+	completeLock.Unlock()
+}
+
+func TestProcessBatchSuspendedReleasesInFlight(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling: ErrorHandlingBlock,
+			Webhook:       &webhookActionInfo{},
+		}, nil, 500)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	stream.suspend()
+	stream.batchCond.L.Lock()
+	stream.inFlight = 2
+	stream.batchCond.L.Unlock()
+
+	// The batch is not delivered or acked, but its events no longer count as in-flight
+	stream.updateWG.Add(1)
+	stream.processBatch(1, []*eventData{testEvent("sub1"), testEvent("sub1")})
+	assert.Equal(uint64(0), stream.inFlight)
+	assert.False(stream.isBlocked())
+}
+
+func TestAckBatchOutOfOrder(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			MaxInFlightBatches: 2,
+			Webhook:            &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	var completed []string
+	newEvent := func(subID string) *eventData {
+		return &eventData{
+			SubID:         subID,
+			batchComplete: func(*eventData) { completed = append(completed, subID) },
+		}
+	}
+	stream.batchCond.L.Lock()
+	stream.inFlight = 3
+	stream.batchCond.L.Unlock()
+
+	stream.ackBatch(2, []*eventData{newEvent("sub2")})
+	assert.Empty(completed)
+	assert.Equal(uint64(3), stream.inFlight)
+
+	stream.ackBatch(1, []*eventData{newEvent("sub1a"), newEvent("sub1b")})
+	assert.ElementsMatch([]string{"sub1a", "sub1b"}, completed[0:2])
+	assert.Equal("sub2", completed[2])
+	assert.Equal(uint64(0), stream.inFlight)
+	assert.Equal(uint64(3), stream.nextAck)
+
+	// Acks from before a reset are discarded, releasing their events
+	stream.batchCond.L.Lock()
+	stream.inFlight = 1
+	stream.batchCond.L.Unlock()
+	stream.ackBatch(1, []*eventData{newEvent("sub1a")})
+	assert.Len(completed, 3)
+	assert.Equal(uint64(0), stream.inFlight)
+}
+
+func TestBatchConcurrencyWhileFailing(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			MaxInFlightBatches: 5000,
+			Webhook:            &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	assert.Equal(uint64(MaxInFlightBatches), stream.spec.MaxInFlightBatches)
+	assert.Equal(uint64(MaxInFlightBatches), stream.batchConcurrency())
+	stream.markDeliveryResult(fmt.Errorf("pop"))
+	assert.Equal(uint64(1), stream.batchConcurrency())
+	stream.markDeliveryResult(nil)
+	assert.Equal(uint64(MaxInFlightBatches), stream.batchConcurrency())
+}
+
+func TestMaxInFlightBatchesWebSocketBroadcast(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	_, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type:               "websocket",
+		MaxInFlightBatches: 2,
+		WebSocket:          &webSocketActionInfo{Topic: "test1", DistributionMode: DistributionModeBroadcast},
+	})
+	assert.EqualError(err, "Concurrent delivery of batches with maxInFlightBatches is only supported for webhook event streams, and websocket event streams that do not broadcast")
+
+	_, stream, _ := newTestStreamForWebSocket(&StreamInfo{
+		Type:      "websocket",
+		WebSocket: &webSocketActionInfo{Topic: "test1", DistributionMode: DistributionModeBroadcast},
+	}, nil)
+	defer stream.stop()
+	_, err = stream.update(&StreamInfo{MaxInFlightBatches: 2})
+	assert.Regexp("only supported for webhook event streams, and websocket event streams that do not broadcast", err)
+
+	_, stream, _ = newTestStreamForWebSocket(&StreamInfo{
+		Type:               "websocket",
+		MaxInFlightBatches: 2,
+		WebSocket:          &webSocketActionInfo{Topic: "test2"},
+	}, nil)
+	defer stream.stop()
+	_, err = stream.update(&StreamInfo{WebSocket: &webSocketActionInfo{Topic: "test2", DistributionMode: DistributionModeBroadcast}})
+	assert.Regexp("only supported for webhook event streams, and websocket event streams that do not broadcast", err)
+}
+
+func TestConcurrentBatchesWebSocket(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, mockWebSocket := newTestStreamForWebSocket(&StreamInfo{
+		Type:               "websocket",
+		ErrorHandling:      ErrorHandlingBlock,
+		MaxInFlightBatches: 2,
+		WebSocket:          &webSocketActionInfo{Topic: "test1"},
+	}, nil)
+	defer stream.stop()
+
+	var completeLock sync.Mutex
+	var completed []string
+	for i := 0; i < 2; i++ {
+		subID := fmt.Sprintf("sub%d", i)
+		stream.handleEvent(&eventData{
+			SubID: subID,
+			batchComplete: func(*eventData) {
+				completeLock.Lock()
+				completed = append(completed, subID)
+				completeLock.Unlock()
+			},
+		})
+	}
+
+	// Both batches are sent before either is acknowledged, and are acknowledged individually
+	batches := make(map[uint64]*ws.WebSocketBatch)
+	for i := 0; i < 2; i++ {
+		batch := (<-mockWebSocket.sender).(*ws.WebSocketBatch)
+		assert.Len(batch.Batch, 1)
+		batches[batch.BatchNumber] = batch
+	}
+	assert.Len(batches, 2)
+	batches[2].Ack <- nil
+	batches[1].Ack <- nil
+
+	for stream.isBlocked() || stream.inFlight > 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	completeLock.Lock()
+	assert.Equal([]string{"sub0", "sub1"}, completed)
+	completeLock.Unlock()
+}
+
 func TestWebSocketUnconfigured(t *testing.T) {
 	assert := assert.New(t)
 	sm := NewSubscriptionManager(&SubscriptionManagerConf{}, nil, nil).(*subscriptionMGR)
@@ -476,7 +688,7 @@ func setupTestSubscription(assert *assert.Assertions, sm *subscriptionMGR, strea
 	}
 	addr := ethbind.API.HexToAddress("0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca")
 	ctx := context.Background()
-	s, _ := sm.AddSubscription(ctx, &addr, event, stream.spec.ID, "", subscriptionName)
+	s, _ := sm.AddSubscription(ctx, &addr, event, stream.spec.ID, "", subscriptionName, nil)
 	return s
 }
 
@@ -529,6 +741,105 @@ func TestProcessEventsEnd2EndWebhook(t *testing.T) {
 	sm.Close()
 }
 
+func TestWebhookViaProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	type proxiedRequest struct {
+		url    string
+		header string
+		events []*eventData
+	}
+	proxied := make(chan proxiedRequest, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var events []*eventData
+		json.NewDecoder(req.Body).Decode(&events)
+		proxied <- proxiedRequest{req.URL.String(), req.Header.Get("x-my-header"), events}
+		res.WriteHeader(200)
+	}))
+	defer proxy.Close()
+
+	sm := newTestSubscriptionManager()
+	// Nothing listens on the target, so the delivery only succeeds through the proxy
+	stream, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:      "http://127.0.0.1:1/hook",
+			ProxyURL: proxy.URL,
+			Headers:  map[string]string{"x-my-header": "my-value"},
+		},
+	})
+	assert.NoError(err)
+	w := sm.streams[stream.ID].action.(*webhookAction)
+
+	err = w.attemptBatch(0, 0, []*eventData{testEvent("sub1")})
+	assert.NoError(err)
+	req := <-proxied
+	assert.Equal("http://127.0.0.1:1/hook", req.url)
+	assert.Equal("my-value", req.header)
+	assert.Len(req.events, 1)
+	assert.Equal("sub1", req.events[0].SubID)
+	sm.Close()
+}
+
+func TestWebhookProxyUpdatedRebuildsClient(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy1 := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	defer proxy1.Close()
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+	stream, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:      "http://127.0.0.1:1/hook",
+			ProxyURL: proxy1.URL,
+		},
+	})
+	assert.NoError(err)
+	w := sm.streams[stream.ID].action.(*webhookAction)
+
+	client := w.httpClient()
+	assert.Equal(client, w.httpClient())
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:1/hook", nil)
+	u, err := client.Transport.(*http.Transport).Proxy(req)
+	assert.NoError(err)
+	assert.Equal(proxy1.URL, u.String())
+
+	w.spec.ProxyURL = "http://proxy2.example.com:3128"
+	client = w.httpClient()
+	u, err = client.Transport.(*http.Transport).Proxy(req)
+	assert.NoError(err)
+	assert.Equal("http://proxy2.example.com:3128", u.String())
+}
+
+func TestWebhookClientReused(t *testing.T) {
+	assert := assert.New(t)
+
+	sm, stream, svr, eventStream := newTestStreamForBatching(&StreamInfo{Webhook: &webhookActionInfo{}}, nil, 200)
+	defer svr.Close()
+	sm.conf.WebhookClient = &WebhookClientConf{MaxIdleConnsPerHost: 5, HTTP2: true}
+
+	w, err := newWebhookAction(stream, &webhookActionInfo{URL: svr.URL})
+	assert.NoError(err)
+	client := w.httpClient()
+	transport := client.Transport.(*http.Transport)
+	assert.Equal(5, transport.MaxIdleConnsPerHost)
+	assert.Equal(DefaultWebhookMaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(time.Duration(DefaultWebhookTLSHandshakeTimeoutSec)*time.Second, transport.TLSHandshakeTimeout)
+	assert.True(transport.ForceAttemptHTTP2)
+
+	go func() { <-eventStream }()
+	err = w.attemptBatch(0, 0, []*eventData{testEvent("sub1")})
+	assert.NoError(err)
+	assert.Equal(client, w.httpClient())
+
+	// Updating the spec of the stream builds a new client
+	w.spec.RequestTimeoutSec = 5
+	updated := w.httpClient()
+	assert.NotEqual(client, updated)
+	assert.Equal(5*time.Second, updated.Timeout)
+}
+
 func TestProcessEventsEnd2EndWebSocket(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -551,19 +862,19 @@ func TestProcessEventsEnd2EndWebSocket(t *testing.T) {
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		e1s := (<-mockWebSocket.sender).([]*eventData)
+		e1s := (<-mockWebSocket.sender).(*ws.WebSocketBatch).Batch.([]*eventData)
 		assert.Equal(1, len(e1s))
 		assert.Equal("42", e1s[0].Data["i"])
 		assert.Equal("But what is the question?", e1s[0].Data["m"])
 		assert.Equal("150665", e1s[0].BlockNumber)
 		mockWebSocket.receiver <- nil
-		e2s := (<-mockWebSocket.sender).([]*eventData)
+		e2s := (<-mockWebSocket.sender).(*ws.WebSocketBatch).Batch.([]*eventData)
 		assert.Equal(1, len(e2s))
 		assert.Equal("1977", e2s[0].Data["i"])
 		assert.Equal("A long time ago in a galaxy far, far away....", e2s[0].Data["m"])
 		assert.Equal("150665", e2s[0].BlockNumber)
 		mockWebSocket.receiver <- nil
-		e3s := (<-mockWebSocket.sender).([]*eventData)
+		e3s := (<-mockWebSocket.sender).(*ws.WebSocketBatch).Batch.([]*eventData)
 		assert.Equal(1, len(e3s))
 		assert.Equal("20151021", e3s[0].Data["i"])
 		assert.Equal("1.21 Gigawatts!", e3s[0].Data["m"])
@@ -1277,3 +1588,95 @@ func TestUpdateStreamInvalidWebhookURL(t *testing.T) {
 	assert.NoError(err)
 	sm.Close()
 }
+
+func TestUpdateStreamInvalidWebhookProxyURL(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:      "http://example.com",
+			ProxyURL: "http://proxy.example.com:3128",
+		},
+	})
+	assert.NoError(err)
+
+	_, err = sm.UpdateStream(ctx, stream.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{
+			URL:      "http://example.com",
+			ProxyURL: "://bad",
+		},
+	})
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+	// The stream keeps delivering through the proxy it had before the update
+	assert.Equal("http://proxy.example.com:3128", sm.streams[stream.ID].spec.Webhook.ProxyURL)
+	sm.Close()
+}
+
+func TestChaosDuplicateEvents(t *testing.T) {
+	assert := assert.New(t)
+	chaos.Start(&chaos.ChaosConf{DuplicateEventPercent: 100})
+	defer chaos.Stop()
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 1,
+			Webhook:   &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	stream.handleEvent(testEvent("sub1"))
+	e1s := <-eventStream
+	e2s := <-eventStream
+	assert.Equal(1, len(e1s))
+	assert.Equal(e1s, e2s)
+}
+
+func TestChaosDroppedWebhook(t *testing.T) {
+	assert := assert.New(t)
+	chaos.Start(&chaos.ChaosConf{WebhookDropPercent: 100})
+	defer chaos.Stop()
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:     1,
+			Webhook:       &webhookActionInfo{},
+			ErrorHandling: ErrorHandlingSkip,
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	completed := make(chan bool, 1)
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		batchComplete: func(*eventData) { completed <- true },
+	})
+	select {
+	case <-eventStream:
+		assert.Fail("delivered a dropped batch")
+	case <-completed:
+	}
+}
+
+func TestChaosDroppedWebhookURLRedacted(t *testing.T) {
+	assert := assert.New(t)
+	chaos.Start(&chaos.ChaosConf{WebhookDropPercent: 100})
+	defer chaos.Stop()
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 1,
+			Webhook:   &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	stream.action.(*webhookAction).spec.URL = strings.Replace(svr.URL, "http://", "http://user:s3cret@", 1) + "?token=t0ken"
+	err := stream.action.attemptBatch(1, 1, []*eventData{testEvent("sub1")})
+	assert.Regexp("Dropped webhook delivery to http://user:\\*\\*\\*@", err)
+	assert.NotContains(err.Error(), "s3cret")
+	assert.NotContains(err.Error(), "t0ken")
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+const (
+	// FormatNative delivers events as decoded by ethconnect
+	FormatNative = "native"
+	// FormatFireFly delivers events in the shape ingested by the ethereum plugin of FireFly core,
+	// such as the BatchPin events of the FireFly multi-party contract
+	FormatFireFly = "firefly"
+)
+
+var fireflyAddressCheck = regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+// fireflyEvent is an event reshaped for FireFly core. Indexes are decimal strings, addresses
+// are lower case, and the protocolId orders events on the chain as a sortable string
+type fireflyEvent struct {
+	Address          string                 `json:"address"`
+	BlockNumber      string                 `json:"blockNumber"`
+	TransactionIndex string                 `json:"transactionIndex"`
+	TransactionHash  string                 `json:"transactionHash"`
+	LogIndex         string                 `json:"logIndex"`
+	Timestamp        string                 `json:"timestamp"`
+	Signature        string                 `json:"signature"`
+	SubID            string                 `json:"subId"`
+	ProtocolID       string                 `json:"protocolId"`
+	Data             map[string]interface{} `json:"data"`
+	Truncated        *truncatedData         `json:"truncated,omitempty"`
+}
+
+// validateFormat normalizes the delivery format of a stream. The FireFly format needs the
+// block timestamp of each event, and a fixed shape, so cannot be combined with a payload mapping
+func validateFormat(spec *StreamInfo) error {
+	spec.Format = strings.ToLower(spec.Format)
+	switch spec.Format {
+	case "", FormatNative:
+		spec.Format = ""
+	case FormatFireFly:
+		if !spec.Payload.isEmpty() {
+			return errors.Errorf(errors.EventStreamsFormatWithPayload, spec.Format)
+		}
+		spec.Timestamps = true
+	default:
+		return errors.Errorf(errors.EventStreamsFormatUnknown, spec.Format)
+	}
+	return nil
+}
+
+func fireflyPayload(events []*eventData) []*fireflyEvent {
+	reshaped := make([]*fireflyEvent, len(events))
+	for i, event := range events {
+		blockNumber, _ := strconv.ParseUint(event.BlockNumber, 10, 64)
+		txIndex, _ := strconv.ParseUint(event.TransactionIndex, 0, 64)
+		logIndex, _ := strconv.ParseUint(event.LogIndex, 10, 64)
+		data := make(map[string]interface{}, len(event.Data))
+		for k, v := range event.Data {
+			data[k] = fireflyValue(v)
+		}
+		reshaped[i] = &fireflyEvent{
+			Address:          strings.ToLower(event.Address),
+			BlockNumber:      strconv.FormatUint(blockNumber, 10),
+			TransactionIndex: strconv.FormatUint(txIndex, 10),
+			TransactionHash:  event.TransactionHash,
+			LogIndex:         strconv.FormatUint(logIndex, 10),
+			Timestamp:        event.Timestamp,
+			Signature:        event.Signature,
+			SubID:            event.SubID,
+			ProtocolID:       fmt.Sprintf("%.12d/%.6d/%.6d", blockNumber, txIndex, logIndex),
+			Data:             data,
+			Truncated:        event.Truncated,
+		}
+	}
+	return reshaped
+}
+
+// fireflyValue lower cases addresses in the decoded parameters, including in arrays and structs
+func fireflyValue(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case string:
+		if fireflyAddressCheck.MatchString(vt) {
+			return strings.ToLower(vt)
+		}
+	case []interface{}:
+		values := make([]interface{}, len(vt))
+		for i, elem := range vt {
+			values[i] = fireflyValue(elem)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(vt))
+		for k, elem := range vt {
+			values[k] = fireflyValue(elem)
+		}
+		return values
+	}
+	return v
+}
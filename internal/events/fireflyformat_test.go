@@ -0,0 +1,164 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBatchPinEvent() *eventData {
+	return &eventData{
+		Address:          "0x167F57A13A9C35FF92F0649D2BE0E52B4F8AC3CA",
+		BlockNumber:      "150665",
+		TransactionIndex: "0x1a",
+		TransactionHash:  "0xc26df2bf1a733e9249372d61eb11bd8662d26c8129df76890b1beb2f6fa72628",
+		LogIndex:         "3",
+		Timestamp:        "1620576488",
+		Signature:        "BatchPin(address,uint256,string,bytes32,bytes32,string,bytes32[])",
+		SubID:            "sub1",
+		Data: map[string]interface{}{
+			"author":     "0x7AD4D5E7C1C1EC5BB3AD30DCBC9D6C6E1F9E2B8A",
+			"timestamp":  "1620576488",
+			"namespace":  "ns1",
+			"uuids":      "0xe19af8b390604051812d7597d19adfb9847d3bfd074249efb65d3fed15f5b0a6",
+			"batchHash":  "0xd71eb138d74c229a388eb0e1abc03f4c7cbb21d4fc4b839fbf0ec73e4263f6be",
+			"payloadRef": "",
+			"contexts":   []interface{}{"0x68e4da79f805bca5b912bcda9c63d03e6e867108dabb9b944109aea541ef522a"},
+		},
+	}
+}
+
+func TestFireFlyPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	b, _ := json.Marshal(fireflyPayload([]*eventData{testBatchPinEvent()}))
+	assert.JSONEq(`[{
+		"address": "0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca",
+		"blockNumber": "150665",
+		"transactionIndex": "26",
+		"transactionHash": "0xc26df2bf1a733e9249372d61eb11bd8662d26c8129df76890b1beb2f6fa72628",
+		"logIndex": "3",
+		"timestamp": "1620576488",
+		"signature": "BatchPin(address,uint256,string,bytes32,bytes32,string,bytes32[])",
+		"subId": "sub1",
+		"protocolId": "000000150665/000026/000003",
+		"data": {
+			"author": "0x7ad4d5e7c1c1ec5bb3ad30dcbc9d6c6e1f9e2b8a",
+			"timestamp": "1620576488",
+			"namespace": "ns1",
+			"uuids": "0xe19af8b390604051812d7597d19adfb9847d3bfd074249efb65d3fed15f5b0a6",
+			"batchHash": "0xd71eb138d74c229a388eb0e1abc03f4c7cbb21d4fc4b839fbf0ec73e4263f6be",
+			"payloadRef": "",
+			"contexts": ["0x68e4da79f805bca5b912bcda9c63d03e6e867108dabb9b944109aea541ef522a"]
+		}
+	}]`, string(b))
+
+	assert.Equal(map[string]interface{}{"owner": "0x7ad4d5e7c1c1ec5bb3ad30dcbc9d6c6e1f9e2b8a", "ok": true},
+		fireflyValue(map[string]interface{}{"owner": "0x7AD4D5E7C1C1EC5BB3AD30DCBC9D6C6E1F9E2B8A", "ok": true}))
+}
+
+func TestFireFlyFormatWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	_, stream, svr, _ := newTestStreamForBatching(&StreamInfo{Webhook: &webhookActionInfo{}}, nil, 200)
+	defer svr.Close()
+	stream.spec.Format = FormatFireFly
+
+	received := make(chan []map[string]interface{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var payload []map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	w, err := newWebhookAction(stream, &webhookActionInfo{URL: receiver.URL})
+	assert.NoError(err)
+	err = w.attemptBatch(0, 0, []*eventData{testBatchPinEvent()})
+	assert.NoError(err)
+	payload := <-received
+	assert.Len(payload, 1)
+	assert.Equal("000000150665/000026/000003", payload[0]["protocolId"])
+}
+
+func TestConstructorBadFormat(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:      "123",
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://example.com"},
+		Format:  "kafka-connect",
+	}, nil)
+	assert.EqualError(err, "Unknown delivery format 'kafka-connect'. Must be 'native' or 'firefly'")
+
+	_, err = newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:      "123",
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://example.com"},
+		Format:  "FireFly",
+		Payload: &PayloadMapping{Drop: []string{"subId"}},
+	}, nil)
+	assert.EqualError(err, "A payload mapping cannot be combined with the 'firefly' delivery format")
+}
+
+func TestFireFlyFormatUpdateStream(t *testing.T) {
+	assert := assert.New(t)
+
+	sm, stream, svr, _ := newTestStreamForBatching(&StreamInfo{Webhook: &webhookActionInfo{}}, nil, 200)
+	defer svr.Close()
+	defer stream.stop()
+
+	updated, err := sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Format:  "firefly",
+	})
+	assert.NoError(err)
+	assert.Equal(FormatFireFly, updated.Format)
+	assert.True(updated.Timestamps)
+
+	_, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Format:  "unknown",
+	})
+	assert.Regexp("Unknown delivery format 'unknown'", err)
+
+	updated, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Format:  "native",
+		Payload: &PayloadMapping{Drop: []string{"subId"}},
+	})
+	assert.NoError(err)
+	assert.Equal("", updated.Format)
+
+	// Switching to the FireFly format requires the payload mapping to be removed
+	_, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Format:  "firefly",
+	})
+	assert.Regexp("A payload mapping cannot be combined with the 'firefly' delivery format", err)
+	updated, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Format:  "firefly",
+		Payload: &PayloadMapping{},
+	})
+	assert.NoError(err)
+	assert.Nil(updated.Payload)
+}
@@ -0,0 +1,276 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+const (
+	defaultGoogleTokenURI   = "https://oauth2.googleapis.com/token"
+	defaultGCEMetadataHost  = "metadata.google.internal"
+	googleJWTBearerGrant    = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	googleAssertionLifetime = time.Hour
+	googleMetadataTimeout   = 30 * time.Second
+	bigQueryScope           = "https://www.googleapis.com/auth/bigquery"
+)
+
+// googleServiceAccountKey is the JSON key of a Google Cloud service account, as downloaded
+// from the console. The other fields of the key file are ignored
+type googleServiceAccountKey struct {
+	Type         string `json:"type,omitempty"`
+	ClientEmail  string `json:"client_email,omitempty"`
+	PrivateKeyID string `json:"private_key_id,omitempty"`
+	PrivateKey   string `json:"private_key,omitempty"`
+	TokenURI     string `json:"token_uri,omitempty"`
+}
+
+// googleCredentialsFile is a file found by Application Default Credentials, holding either the
+// key of a service account, or the refresh token of `gcloud auth application-default login`
+type googleCredentialsFile struct {
+	googleServiceAccountKey
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// googleTokenSource gets and caches the access token for a Google Cloud API, with the key of a
+// service account, or with the Application Default Credentials of the gateway if there is none
+type googleTokenSource struct {
+	lock      sync.Mutex
+	key       *googleServiceAccountKey
+	scope     string
+	token     string
+	expiresAt time.Time
+}
+
+func (k *googleServiceAccountKey) validate() error {
+	if k.ClientEmail == "" {
+		return errors.Errorf(errors.EventStreamsWarehouseServiceAccountInvalid, "client_email is required")
+	}
+	if k.TokenURI != "" {
+		if u, err := url.Parse(k.TokenURI); err != nil || !u.IsAbs() {
+			return errors.Errorf(errors.EventStreamsWarehouseServiceAccountInvalid, "token_uri is not an absolute URL")
+		}
+	}
+	_, err := k.rsaKey()
+	return err
+}
+
+func (k *googleServiceAccountKey) tokenURI() string {
+	if k.TokenURI == "" {
+		return defaultGoogleTokenURI
+	}
+	return k.TokenURI
+}
+
+// rsaKey parses the PEM private key, which is PKCS#8 in the keys from Google Cloud
+func (k *googleServiceAccountKey) rsaKey() (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(k.PrivateKey))
+	if block == nil {
+		return nil, errors.Errorf(errors.EventStreamsWarehouseServiceAccountInvalid, "private_key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWarehouseServiceAccountInvalid, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf(errors.EventStreamsWarehouseServiceAccountInvalid, "private_key is not an RSA key")
+	}
+	return key, nil
+}
+
+// assertion returns the signed JWT the service account exchanges for an access token
+func (k *googleServiceAccountKey) assertion(scope string, now time.Time) (string, error) {
+	key, err := k.rsaKey()
+	if err != nil {
+		return "", err
+	}
+	header, _ := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": k.PrivateKeyID,
+	})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   k.ClientEmail,
+		"scope": scope,
+		"aud":   k.tokenURI(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(googleAssertionLifetime).Unix(),
+	})
+	b64 := base64.RawURLEncoding
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
+
+// invalidate discards the cached token, so the next request gets a new one
+func (g *googleTokenSource) invalidate() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.token = ""
+}
+
+func (g *googleTokenSource) accessToken(ctx context.Context, do WarehouseRequestFunc) (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.token != "" && time.Now().Before(g.expiresAt) {
+		return g.token, nil
+	}
+	var tokenRes oauth2TokenResponse
+	var err error
+	if g.key != nil {
+		err = serviceAccountToken(ctx, do, g.key, g.scope, &tokenRes)
+	} else {
+		err = defaultCredentialsToken(ctx, do, g.scope, &tokenRes)
+	}
+	if err == nil && tokenRes.AccessToken == "" {
+		err = fmt.Errorf("no access_token in response")
+	}
+	if err != nil {
+		return "", errors.Errorf(errors.EventStreamsWarehouseGoogleAuthFailed, err)
+	}
+	expiresIn := time.Duration(tokenRes.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = googleAssertionLifetime
+	}
+	g.token = tokenRes.AccessToken
+	g.expiresAt = time.Now().Add(expiresIn - oauth2ExpiryMargin)
+	return g.token, nil
+}
+
+func serviceAccountToken(ctx context.Context, do WarehouseRequestFunc, key *googleServiceAccountKey, scope string, tokenRes *oauth2TokenResponse) error {
+	assertion, err := key.assertion(scope, time.Now())
+	if err != nil {
+		return err
+	}
+	form := url.Values{}
+	form.Set("grant_type", googleJWTBearerGrant)
+	form.Set("assertion", assertion)
+	return postTokenForm(ctx, do, key.tokenURI(), form, tokenRes)
+}
+
+// defaultCredentialsToken gets a token with the Application Default Credentials of the gateway:
+// the file named by GOOGLE_APPLICATION_CREDENTIALS, then the file written by gcloud, and then
+// the service account of the Compute Engine, GKE or Cloud Run instance the gateway runs on
+func defaultCredentialsToken(ctx context.Context, do WarehouseRequestFunc, scope string, tokenRes *oauth2TokenResponse) error {
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			wellKnown := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+			if _, err := os.Stat(wellKnown); err == nil {
+				path = wellKnown
+			}
+		}
+	}
+	if path == "" {
+		return metadataToken(ctx, tokenRes)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var creds googleCredentialsFile
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return err
+	}
+	switch creds.Type {
+	case "service_account":
+		if err := creds.validate(); err != nil {
+			return err
+		}
+		return serviceAccountToken(ctx, do, &creds.googleServiceAccountKey, scope, tokenRes)
+	case "authorized_user":
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+		return postTokenForm(ctx, do, creds.tokenURI(), form, tokenRes)
+	default:
+		return fmt.Errorf("unsupported credentials type '%s' in %s", creds.Type, path)
+	}
+}
+
+// metadataToken gets the token of the service account of the instance from its metadata server.
+// The server is only reachable from the instance, at a link-local address, so it is called
+// directly rather than with the proxy and address restrictions of the stream
+func metadataToken(ctx context.Context, tokenRes *oauth2TokenResponse) error {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = defaultGCEMetadataHost
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	client := &http.Client{Timeout: googleMetadataTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return readTokenResponse(res, tokenRes)
+}
+
+func postTokenForm(ctx context.Context, do WarehouseRequestFunc, tokenURI string, form url.Values, tokenRes *oauth2TokenResponse) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := do(req)
+	if err != nil {
+		return err
+	}
+	return readTokenResponse(res, tokenRes)
+}
+
+func readTokenResponse(res *http.Response, tokenRes *oauth2TokenResponse) error {
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("status=%d", res.StatusCode)
+	}
+	return json.Unmarshal(body, tokenRes)
+}
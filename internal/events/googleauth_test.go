@@ -0,0 +1,324 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServiceAccount returns a service account key, and a token server that checks the JWT
+// assertions signed with it and counts the tokens it issues
+func newTestServiceAccount(t *testing.T) (*googleServiceAccountKey, *httptest.Server, *int) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	issued := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", req.Form.Get("grant_type"))
+		parts := strings.Split(req.Form.Get("assertion"), ".")
+		assert.Len(t, parts, 3)
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		assert.NoError(t, rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, hash[:], sig))
+		var claims map[string]interface{}
+		claimBytes, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		json.Unmarshal(claimBytes, &claims)
+		assert.Equal(t, "loader@analytics.iam.gserviceaccount.com", claims["iss"])
+		assert.Equal(t, "https://www.googleapis.com/auth/bigquery", claims["scope"])
+		assert.Equal(t, "http://"+req.Host+"/token", claims["aud"])
+		issued++
+		res.WriteHeader(200)
+		res.Write([]byte(`{"access_token":"sa-token","token_type":"Bearer","expires_in":3599}`))
+	}))
+	return &googleServiceAccountKey{
+		Type:         "service_account",
+		ClientEmail:  "loader@analytics.iam.gserviceaccount.com",
+		PrivateKeyID: "key1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})),
+		TokenURI:     ts.URL + "/token",
+	}, ts, &issued
+}
+
+func TestGoogleTokenSourceMetadataServer(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("Google", req.Header.Get("Metadata-Flavor"))
+		assert.Equal("/computeMetadata/v1/instance/service-accounts/default/token", req.URL.Path)
+		res.WriteHeader(200)
+		res.Write([]byte(`{"access_token":"gce-token","expires_in":3599}`))
+	}))
+	defer ts.Close()
+	home, _ := ioutil.TempDir("", "home")
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	defer os.Unsetenv("GCE_METADATA_HOST")
+	os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(ts.URL, "http://"))
+
+	tokens := &googleTokenSource{scope: bigQueryScope}
+	token, err := tokens.accessToken(context.Background(), nil)
+	assert.NoError(err)
+	assert.Equal("gce-token", token)
+}
+
+func TestGoogleTokenSourceCredentialsFile(t *testing.T) {
+	assert := assert.New(t)
+
+	key, tokenServer, _ := newTestServiceAccount(t)
+	defer tokenServer.Close()
+	userServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		assert.Equal("refresh_token", req.Form.Get("grant_type"))
+		assert.Equal("r3fresh", req.Form.Get("refresh_token"))
+		res.WriteHeader(200)
+		res.Write([]byte(`{"access_token":"user-token","expires_in":3599}`))
+	}))
+	defer userServer.Close()
+	dir, _ := ioutil.TempDir("", "adc")
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	saFile, _ := json.Marshal(key)
+	for file, expected := range map[string]string{
+		`{"type":"authorized_user","client_id":"c1","client_secret":"s1","refresh_token":"r3fresh","token_uri":"` + userServer.URL + `"}`: "user-token",
+		string(saFile):                "sa-token",
+		`{"type":"external_account"}`: "unsupported credentials type 'external_account'",
+		`!json`:                       "Failed to get a Google Cloud access token",
+	} {
+		credsFile := path.Join(dir, "credentials.json")
+		ioutil.WriteFile(credsFile, []byte(file), 0600)
+		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsFile)
+		tokens := &googleTokenSource{scope: bigQueryScope}
+		token, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+		if err != nil {
+			assert.Regexp(expected, err)
+		} else {
+			assert.Equal(expected, token)
+		}
+	}
+}
+
+func TestGoogleTokenSourceExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	key, tokenServer, issued := newTestServiceAccount(t)
+	defer tokenServer.Close()
+	tokens := &googleTokenSource{key: key, scope: bigQueryScope}
+
+	// The token is cached until shortly before it expires
+	token, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal("sa-token", token)
+	assert.WithinDuration(time.Now().Add(3599*time.Second-oauth2ExpiryMargin), tokens.expiresAt, 5*time.Second)
+	_, err = tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal(1, *issued)
+
+	// Then a new one is issued
+	tokens.expiresAt = time.Now().Add(-1 * time.Second)
+	_, err = tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal(2, *issued)
+
+	// As it is after the token is invalidated, such as when it is rejected
+	tokens.invalidate()
+	_, err = tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal(3, *issued)
+}
+
+func TestGoogleTokenSourceNoExpiresIn(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		res.Write([]byte(`{"access_token":"no-expiry"}`))
+	}))
+	defer ts.Close()
+	key, tokenServer, _ := newTestServiceAccount(t)
+	tokenServer.Close()
+	key.TokenURI = ts.URL
+
+	tokens := &googleTokenSource{key: key, scope: bigQueryScope}
+	token, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal("no-expiry", token)
+	assert.WithinDuration(time.Now().Add(googleAssertionLifetime-oauth2ExpiryMargin), tokens.expiresAt, 5*time.Second)
+}
+
+func TestGoogleTokenSourceBadTokenResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	status, body := 200, ""
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+		res.Write([]byte(body))
+	}))
+	defer ts.Close()
+	key, tokenServer, _ := newTestServiceAccount(t)
+	tokenServer.Close()
+	key.TokenURI = ts.URL
+
+	for _, tc := range []struct {
+		status   int
+		body     string
+		expected string
+	}{
+		{400, `{"error":"invalid_grant"}`, "status=400"},
+		{200, `{"token_type":"Bearer"}`, "no access_token in response"},
+		{200, `!json`, "invalid character"},
+	} {
+		status, body = tc.status, tc.body
+		tokens := &googleTokenSource{key: key, scope: bigQueryScope}
+		_, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+		assert.Regexp("Failed to get a Google Cloud access token: "+tc.expected, err)
+		assert.Empty(tokens.token)
+	}
+}
+
+func TestGoogleTokenSourceRefreshUserCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	refreshed := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		req.ParseForm()
+		assert.Equal("refresh_token", req.Form.Get("grant_type"))
+		assert.Equal("c1", req.Form.Get("client_id"))
+		assert.Equal("s1", req.Form.Get("client_secret"))
+		assert.Equal("r3fresh", req.Form.Get("refresh_token"))
+		refreshed++
+		res.WriteHeader(200)
+		res.Write([]byte(`{"access_token":"user-token","expires_in":3599}`))
+	}))
+	defer ts.Close()
+	home, _ := ioutil.TempDir("", "home")
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+
+	// The file written by gcloud is used when GOOGLE_APPLICATION_CREDENTIALS is not set
+	gcloudDir := path.Join(home, ".config", "gcloud")
+	os.MkdirAll(gcloudDir, 0700)
+	ioutil.WriteFile(path.Join(gcloudDir, "application_default_credentials.json"),
+		[]byte(`{"type":"authorized_user","client_id":"c1","client_secret":"s1","refresh_token":"r3fresh","token_uri":"`+ts.URL+`"}`), 0600)
+
+	tokens := &googleTokenSource{scope: bigQueryScope}
+	token, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal("user-token", token)
+	assert.Equal(1, refreshed)
+
+	tokens.expiresAt = time.Now().Add(-1 * time.Second)
+	_, err = tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.NoError(err)
+	assert.Equal(2, refreshed)
+}
+
+func TestGoogleTokenSourceMetadataServerFails(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(404)
+	}))
+	home, _ := ioutil.TempDir("", "home")
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	defer os.Unsetenv("GCE_METADATA_HOST")
+	os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(ts.URL, "http://"))
+
+	tokens := &googleTokenSource{scope: bigQueryScope}
+	_, err := tokens.accessToken(context.Background(), nil)
+	assert.Regexp("Failed to get a Google Cloud access token: status=404", err)
+
+	// Off a cloud instance the metadata server cannot be reached
+	ts.Close()
+	_, err = tokens.accessToken(context.Background(), nil)
+	assert.Regexp("Failed to get a Google Cloud access token", err)
+}
+
+func TestGoogleServiceAccountKeyMalformed(t *testing.T) {
+	assert := assert.New(t)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecPKCS8, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	pemKey := func(blockType string, b []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}))
+	}
+
+	for privateKey, expected := range map[string]string{
+		"":                                       "private_key is not PEM encoded",
+		"not a key":                              "private_key is not PEM encoded",
+		pemKey("PRIVATE KEY", []byte("garbage")): "Invalid warehouse.serviceAccount key",
+		pemKey("PRIVATE KEY", ecPKCS8):           "private_key is not an RSA key",
+	} {
+		key := &googleServiceAccountKey{ClientEmail: "loader@analytics.iam.gserviceaccount.com", PrivateKey: privateKey}
+		assert.Regexp(expected, key.validate(), privateKey)
+		_, err := key.assertion(bigQueryScope, time.Now())
+		assert.Regexp(expected, err, privateKey)
+	}
+
+	// The older PKCS#1 encoding is accepted too
+	key := &googleServiceAccountKey{ClientEmail: "loader@analytics.iam.gserviceaccount.com", PrivateKey: pemKey("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))}
+	assert.NoError(key.validate())
+
+	// A malformed key in a credentials file is reported when a token is requested
+	dir, _ := ioutil.TempDir("", "adc")
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+	for file, expected := range map[string]string{
+		`{"type":"service_account","private_key":"not a key"}`:                      "client_email is required",
+		`{"type":"service_account","client_email":"a@b","private_key":"not a key"}`: "private_key is not PEM encoded",
+		`{"type":"service_account","client_email":"a@b","token_uri":"/token"}`:      "token_uri is not an absolute URL",
+	} {
+		credsFile := path.Join(dir, "credentials.json")
+		ioutil.WriteFile(credsFile, []byte(file), 0600)
+		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsFile)
+		tokens := &googleTokenSource{scope: bigQueryScope}
+		_, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+		assert.Regexp(expected, err, file)
+	}
+
+	// As is a credentials file that does not exist
+	os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path.Join(dir, "missing.json"))
+	tokens := &googleTokenSource{scope: bigQueryScope}
+	_, err := tokens.accessToken(context.Background(), http.DefaultClient.Do)
+	assert.Regexp("Failed to get a Google Cloud access token", err)
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// IdleSubscriptionsPath is the path to report subscriptions on idle streams
+	IdleSubscriptionsPath = "/idlesubscriptions"
+	// IdleReasonSuspended the stream has been suspended
+	IdleReasonSuspended = "suspended"
+	// IdleReasonUnreachable the stream has been failing to deliver events
+	IdleReasonUnreachable = "unreachable"
+	// DefaultIdleGCIntervalSec is how often we check for idle subscriptions, when the policy is enabled
+	DefaultIdleGCIntervalSec = 600
+)
+
+// IdleSubscriptionGCConf is the policy for subscriptions on streams that have been suspended,
+// or unable to deliver events, for longer than the timeout. Such subscriptions are flagged
+// in the log, or deleted if Delete is set
+type IdleSubscriptionGCConf struct {
+	IdleTimeoutSec uint64 `json:"idleTimeoutSec,omitempty"`
+	IntervalSec    uint64 `json:"intervalSec,omitempty"`
+	Delete         bool   `json:"delete,omitempty"`
+}
+
+// IdleSubscriptionInfo describes a subscription on a stream that has been idle beyond the timeout
+type IdleSubscriptionInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Stream    string `json:"stream"`
+	Reason    string `json:"reason"`
+	IdleSince string `json:"idleSince"`
+}
+
+// IdleSubscriptions returns the subscriptions on streams that have been suspended, or unable
+// to deliver events, for longer than the supplied timeout (or the configured timeout if zero).
+// Nothing is changed, so this can be used as a dry-run of the garbage collection policy
+func (s *subscriptionMGR) IdleSubscriptions(ctx context.Context, idleTimeout time.Duration) ([]*IdleSubscriptionInfo, error) {
+	if idleTimeout == 0 {
+		if s.conf.IdleSubscriptionGC == nil || s.conf.IdleSubscriptionGC.IdleTimeoutSec == 0 {
+			return nil, errors.Errorf(errors.EventStreamsIdleTimeoutNotSet)
+		}
+		idleTimeout = time.Duration(s.conf.IdleSubscriptionGC.IdleTimeoutSec) * time.Second
+	}
+	idle := []*IdleSubscriptionInfo{}
+	now := time.Now().UTC()
+	for _, stream := range s.allStreams() {
+		idleSince, reason := stream.idleState()
+		if idleSince.IsZero() || now.Sub(idleSince) < idleTimeout {
+			continue
+		}
+		for _, sub := range s.subscriptionsForStream(stream.spec.ID) {
+			idle = append(idle, &IdleSubscriptionInfo{
+				ID:        sub.info.ID,
+				Name:      sub.info.Name,
+				Stream:    stream.spec.ID,
+				Reason:    reason,
+				IdleSince: idleSince.Format(time.RFC3339),
+			})
+		}
+	}
+	sort.Slice(idle, func(i, j int) bool {
+		if idle[i].Stream == idle[j].Stream {
+			return idle[i].Name < idle[j].Name
+		}
+		return idle[i].Stream < idle[j].Stream
+	})
+	return idle, nil
+}
+
+// startIdleSubscriptionGC kicks off the periodic check, if the policy is enabled
+func (s *subscriptionMGR) startIdleSubscriptionGC() {
+	gcConf := s.conf.IdleSubscriptionGC
+	if gcConf == nil || gcConf.IdleTimeoutSec == 0 {
+		return
+	}
+	if gcConf.IntervalSec == 0 {
+		gcConf.IntervalSec = DefaultIdleGCIntervalSec
+	}
+	s.idleGCStop = make(chan struct{})
+	s.idleGCDone = make(chan struct{})
+	go func() {
+		defer close(s.idleGCDone)
+		s.idleSubscriptionGCLoop(time.Duration(gcConf.IntervalSec) * time.Second)
+	}()
+}
+
+func (s *subscriptionMGR) idleSubscriptionGCLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.idleGCStop:
+			return
+		case <-ticker.C:
+			s.collectIdleSubscriptions(context.Background())
+		}
+	}
+}
+
+// collectIdleSubscriptions applies the policy to each idle subscription
+func (s *subscriptionMGR) collectIdleSubscriptions(ctx context.Context) {
+	gcConf := s.conf.IdleSubscriptionGC
+	idleSubs, _ := s.IdleSubscriptions(ctx, time.Duration(gcConf.IdleTimeoutSec)*time.Second)
+	for _, idle := range idleSubs {
+		if !gcConf.Delete {
+			log.Warnf("Subscription '%s' (%s) is idle. Stream %s %s since %s", idle.Name, idle.ID, idle.Stream, idle.Reason, idle.IdleSince)
+			continue
+		}
+		log.Infof("Deleting idle subscription '%s' (%s). Stream %s %s since %s", idle.Name, idle.ID, idle.Stream, idle.Reason, idle.IdleSince)
+		if err := s.DeleteSubscription(ctx, idle.ID); err != nil {
+			log.Errorf("Failed to delete idle subscription %s: %s", idle.ID, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIdleSubscriptionManager(t *testing.T) (*subscriptionMGR, *StreamInfo, *SubscriptionInfo) {
+	sm := newTestSubscriptionManager()
+	ctx := context.Background()
+	stream, err := sm.AddStream(ctx, &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	})
+	assert.NoError(t, err)
+	sub, err := sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "", "sub1", nil)
+	assert.NoError(t, err)
+	return sm, stream, sub
+}
+
+func TestIdleSubscriptionsSuspended(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	idle, err := sm.IdleSubscriptions(ctx, time.Nanosecond)
+	assert.NoError(err)
+	assert.Empty(idle)
+
+	err = sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+
+	idle, err = sm.IdleSubscriptions(ctx, time.Nanosecond)
+	assert.NoError(err)
+	assert.Equal(1, len(idle))
+	assert.Equal(sub.ID, idle[0].ID)
+	assert.Equal("sub1", idle[0].Name)
+	assert.Equal(stream.ID, idle[0].Stream)
+	assert.Equal(IdleReasonSuspended, idle[0].Reason)
+
+	idle, err = sm.IdleSubscriptions(ctx, time.Hour)
+	assert.NoError(err)
+	assert.Empty(idle)
+}
+
+func TestIdleSubscriptionsUnreachable(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	es := sm.streams[stream.ID]
+	es.markDeliveryResult(fmt.Errorf("pop"))
+	firstFailure, _ := es.idleState()
+	es.markDeliveryResult(fmt.Errorf("pop"))
+	idleSince, reason := es.idleState()
+	assert.Equal(firstFailure, idleSince)
+	assert.Equal(IdleReasonUnreachable, reason)
+
+	idle, err := sm.IdleSubscriptions(ctx, time.Nanosecond)
+	assert.NoError(err)
+	assert.Equal(1, len(idle))
+	assert.Equal(IdleReasonUnreachable, idle[0].Reason)
+
+	es.markDeliveryResult(nil)
+	idle, err = sm.IdleSubscriptions(ctx, time.Nanosecond)
+	assert.NoError(err)
+	assert.Empty(idle)
+}
+
+func TestIdleSubscriptionsNoTimeout(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, err := sm.IdleSubscriptions(context.Background(), 0)
+	assert.Regexp("An idle timeout must be supplied", err)
+}
+
+func TestCollectIdleSubscriptionsFlagOnly(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+	sm.conf.IdleSubscriptionGC = &IdleSubscriptionGCConf{IdleTimeoutSec: 1}
+
+	err := sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+	sm.streams[stream.ID].idleSince = time.Now().Add(-1 * time.Minute)
+
+	sm.collectIdleSubscriptions(ctx)
+	assert.Equal(1, len(sm.Subscriptions(ctx)))
+}
+
+func TestCollectIdleSubscriptionsDelete(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+	sm.conf.IdleSubscriptionGC = &IdleSubscriptionGCConf{IdleTimeoutSec: 1, Delete: true}
+
+	err := sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+	sm.streams[stream.ID].idleSince = time.Now().Add(-1 * time.Minute)
+
+	sm.collectIdleSubscriptions(ctx)
+	assert.Empty(sm.Subscriptions(ctx))
+}
+
+func TestIdleSubscriptionGCLoop(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, _ := newTestIdleSubscriptionManager(t)
+	ctx := context.Background()
+	sm.conf.IdleSubscriptionGC = &IdleSubscriptionGCConf{IdleTimeoutSec: 1, Delete: true}
+
+	err := sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+	sm.streams[stream.ID].idleSince = time.Now().Add(-1 * time.Minute)
+
+	sm.startIdleSubscriptionGC()
+	assert.Equal(uint64(DefaultIdleGCIntervalSec), sm.conf.IdleSubscriptionGC.IntervalSec)
+	sm.Close()
+
+	sm.idleGCStop = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sm.idleSubscriptionGCLoop(time.Millisecond)
+		close(done)
+	}()
+	for len(sm.Subscriptions(ctx)) > 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	close(sm.idleGCStop)
+	<-done
+}
+
+func TestCollectIdleSubscriptionsConcurrentDelete(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+	sm.conf.IdleSubscriptionGC = &IdleSubscriptionGCConf{IdleTimeoutSec: 1, Delete: true}
+
+	err := sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+	sm.streams[stream.ID].idleSince = time.Now().Add(-1 * time.Minute)
+	deleted := sm.subscriptions[sub.ID]
+
+	// Delete over the API, while the GC runs and other accessors list the subscriptions
+	done := make(chan error)
+	go func() {
+		done <- sm.DeleteSubscription(ctx, sub.ID)
+	}()
+	go func() {
+		for i := 0; i < 100; i++ {
+			sm.Subscriptions(ctx)
+			sm.Streams(ctx)
+		}
+		done <- nil
+	}()
+	sm.collectIdleSubscriptions(ctx)
+	<-done
+	<-done
+	assert.Empty(sm.Subscriptions(ctx))
+
+	// Only one of the deletes can succeed
+	err = sm.deleteSubscription(ctx, deleted)
+	assert.Regexp("not found", err)
+}
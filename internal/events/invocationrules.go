@@ -0,0 +1,234 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// invocationSentTTL is how long the transactions submitted for a batch that failed part way
+// are remembered, after the last attempt of the batch. A batch that is retried within it does
+// not submit them again
+const invocationSentTTL = 1 * time.Hour
+
+// ContractInvoker is implemented by the contract gateway, to submit the transactions of the
+// invocation rules of a stream to its registered contracts. It returns the request ID.
+// AuthorizeInvocation checks the caller creating or updating a rule is authorized to send
+// transactions from its signing address or alias
+type ContractInvoker interface {
+	InvokeContractMethod(ctx context.Context, contract, method, from string, params map[string]interface{}) (string, error)
+	AuthorizeInvocation(ctx context.Context, contract, from string) error
+}
+
+// InvocationRule sends a transaction to a registered contract for each event that matches it.
+// Params map the inputs of the method to the dotted path of a field in the event, such as
+// data.amount, and Values supplies fixed inputs
+type InvocationRule struct {
+	Name     string                 `json:"name,omitempty"`
+	Event    string                 `json:"event,omitempty"`  // event name or signature to match (default all events)
+	Contract string                 `json:"contract"`         // address or registered name of the contract
+	Method   string                 `json:"method"`           // method of the contract to invoke
+	From     string                 `json:"from"`             // signing address or alias
+	Params   map[string]string      `json:"params,omitempty"` // method input -> path in the event
+	Values   map[string]interface{} `json:"values,omitempty"` // method input -> fixed value
+}
+
+type transactionActionInfo struct {
+	Rules []*InvocationRule `json:"rules"`
+}
+
+func validateInvocationRules(spec *transactionActionInfo) error {
+	if spec == nil || len(spec.Rules) == 0 {
+		return errors.Errorf(errors.EventStreamsTransactionNoRules)
+	}
+	for i, rule := range spec.Rules {
+		if rule == nil || rule.Contract == "" || rule.Method == "" || rule.From == "" {
+			return errors.Errorf(errors.EventStreamsTransactionRuleMissingField, i)
+		}
+		for input, path := range rule.Params {
+			if input == "" || path == "" {
+				return errors.Errorf(errors.EventStreamsTransactionParamInvalid, input, path)
+			}
+		}
+	}
+	return nil
+}
+
+// authorizeInvocationRules checks the caller is authorized to send the transactions of every rule,
+// as they are submitted later by the stream, without the context of the caller
+func (s *subscriptionMGR) authorizeInvocationRules(ctx context.Context, spec *transactionActionInfo) error {
+	if spec == nil {
+		return nil
+	}
+	invoker, ok := s.contractRegistrar().(ContractInvoker)
+	if !ok {
+		return errors.Errorf(errors.EventStreamsTransactionUnavailable)
+	}
+	for i, rule := range spec.Rules {
+		if rule == nil {
+			continue
+		}
+		if err := invoker.AuthorizeInvocation(ctx, rule.Contract, rule.From); err != nil {
+			return errors.Errorf(errors.EventStreamsTransactionNotAuthorized, rule.From, rule.name(i), err)
+		}
+	}
+	return nil
+}
+
+// name identifies the rule in logs and errors
+func (r *InvocationRule) name(i int) string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%d", i)
+}
+
+// matches checks the event name, or full signature, of the rule against an event
+func (r *InvocationRule) matches(event *eventData) bool {
+	if r.Event == "" || r.Event == event.Signature {
+		return true
+	}
+	return strings.SplitN(event.Signature, "(", 2)[0] == r.Event
+}
+
+// params builds the inputs of the method from the fixed values, and the fields of the event
+func (r *InvocationRule) params(fields map[string]interface{}) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(r.Values)+len(r.Params))
+	for input, v := range r.Values {
+		params[input] = v
+	}
+	for input, path := range r.Params {
+		v, ok := getPath(fields, path)
+		if !ok {
+			return nil, errors.Errorf(errors.EventStreamsTransactionParamNotFound, path, input)
+		}
+		params[input] = v
+	}
+	return params, nil
+}
+
+type transactionAction struct {
+	es      *eventStream
+	invoker ContractInvoker
+	ctx     context.Context
+	cancel  func()
+	mux     sync.Mutex
+	sent    map[string]time.Time
+}
+
+func newTransactionAction(es *eventStream, spec *transactionActionInfo) (*transactionAction, error) {
+	invoker, ok := es.sm.contractRegistrar().(ContractInvoker)
+	if !ok {
+		return nil, errors.Errorf(errors.EventStreamsTransactionUnavailable)
+	}
+	if err := validateInvocationRules(spec); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &transactionAction{
+		es:      es,
+		invoker: invoker,
+		ctx:     ctx,
+		cancel:  cancel,
+		sent:    make(map[string]time.Time),
+	}, nil
+}
+
+// stop cancels any submission in progress, as the stream has stopped
+func (t *transactionAction) stop() {
+	t.cancel()
+}
+
+// updateRules replaces the rules, once any batch being submitted with the current rules completes
+func (t *transactionAction) updateRules(rules []*InvocationRule) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.es.spec.Transaction.Rules = rules
+}
+
+// invocationKey identifies the transaction of a rule for an event. Events without a dedup key
+// are identified by their position in the chain
+func invocationKey(event *eventData, rule int) string {
+	if event.DedupKey != "" {
+		return fmt.Sprintf("%s/%d", event.DedupKey, rule)
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%d", event.SubID, event.BlockNumber, event.TransactionIndex, event.LogIndex, rule)
+}
+
+// attemptBatch submits a transaction for each rule matched by each event in the batch. The
+// transactions submitted before a failure are remembered, so retrying the batch does not
+// submit them again
+func (t *transactionAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	rules := t.es.spec.Transaction.Rules
+
+	// Forget the transactions of batches that have not been retried within the TTL, such as those
+	// skipped by the error handling of the stream, and refresh those of this batch
+	now := time.Now()
+	for key, sentTime := range t.sent {
+		if now.Sub(sentTime) > invocationSentTTL {
+			delete(t.sent, key)
+		}
+	}
+	for _, event := range events {
+		for i := range rules {
+			key := invocationKey(event, i)
+			if _, sent := t.sent[key]; sent {
+				t.sent[key] = now
+			}
+		}
+	}
+
+	for _, event := range events {
+		var fields map[string]interface{}
+		b, _ := json.Marshal(event)
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.UseNumber()
+		d.Decode(&fields)
+		for i, rule := range rules {
+			key := invocationKey(event, i)
+			if _, sent := t.sent[key]; sent || !rule.matches(event) {
+				continue
+			}
+			params, err := rule.params(fields)
+			var requestID string
+			if err == nil {
+				requestID, err = t.invoker.InvokeContractMethod(t.ctx, rule.Contract, rule.Method, rule.From, params)
+			}
+			if err != nil {
+				return errors.Errorf(errors.EventStreamsTransactionInvokeFailed, rule.name(i), err)
+			}
+			log.Infof("%s: Invocation rule '%s' submitted %s to %s for batch %d", t.es.spec.ID, rule.name(i), requestID, rule.Contract, batchNumber)
+			t.sent[key] = now
+		}
+	}
+	// The whole batch was submitted, so it will not be retried
+	for _, event := range events {
+		for i := range rules {
+			delete(t.sent, invocationKey(event, i))
+		}
+	}
+	return nil
+}
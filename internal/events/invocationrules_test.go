@@ -0,0 +1,356 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockInvocation struct {
+	contract string
+	method   string
+	from     string
+	params   map[string]interface{}
+}
+
+type mockInvoker struct {
+	mockRegistrar
+	invocations []*mockInvocation
+	errs        []error
+	authErr     error
+	ctx         context.Context
+}
+
+func (m *mockInvoker) AuthorizeInvocation(ctx context.Context, contract, from string) error {
+	return m.authErr
+}
+
+func (m *mockInvoker) InvokeContractMethod(ctx context.Context, contract, method, from string, params map[string]interface{}) (string, error) {
+	var err error
+	if len(m.errs) > 0 {
+		err = m.errs[0]
+		m.errs = m.errs[1:]
+	}
+	if err != nil {
+		return "", err
+	}
+	m.ctx = ctx
+	m.invocations = append(m.invocations, &mockInvocation{contract, method, from, params})
+	return fmt.Sprintf("req%d", len(m.invocations)), nil
+}
+
+func newTestTransactionStream(t *testing.T, invoker *mockInvoker, rules ...*InvocationRule) (*subscriptionMGR, *eventStream) {
+	sm := newTestSubscriptionManager()
+	sm.registrar = invoker
+	spec, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type:        "transaction",
+		Transaction: &transactionActionInfo{Rules: rules},
+	})
+	assert.NoError(t, err)
+	return sm, sm.streams[spec.ID]
+}
+
+func testTransferEvent(dedupKey, to, value string) *eventData {
+	return &eventData{
+		Address:   "0x3924d1d6423f88148a4fcc0417a33b27a61d595f",
+		Signature: "Transfer(address,address,uint256)",
+		DedupKey:  dedupKey,
+		Data: map[string]interface{}{
+			"to":    to,
+			"value": value,
+		},
+	}
+}
+
+func TestTransactionStreamInvokesRules(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker,
+		&InvocationRule{
+			Name:     "credit",
+			Event:    "Transfer",
+			Contract: "ledger",
+			Method:   "credit",
+			From:     "treasury",
+			Params:   map[string]string{"account": "data.to", "amount": "data.value", "token": "address"},
+			Values:   map[string]interface{}{"memo": "auto"},
+		},
+		&InvocationRule{
+			Event:    "Approval(address,address,uint256)",
+			Contract: "audit",
+			Method:   "record",
+			From:     "treasury",
+		},
+	)
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{
+		testTransferEvent("k1", "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", "1000"),
+	})
+	assert.NoError(err)
+	assert.Len(invoker.invocations, 1)
+	invocation := invoker.invocations[0]
+	assert.Equal("ledger", invocation.contract)
+	assert.Equal("credit", invocation.method)
+	assert.Equal("treasury", invocation.from)
+	assert.Equal(map[string]interface{}{
+		"account": "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c",
+		"amount":  "1000",
+		"token":   "0x3924d1d6423f88148a4fcc0417a33b27a61d595f",
+		"memo":    "auto",
+	}, invocation.params)
+}
+
+func TestTransactionStreamNumbersKeepPrecision(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+		Params:   map[string]string{"amount": "data.value"},
+	})
+	defer sm.Close()
+
+	event := testTransferEvent("k1", "", "")
+	event.Data["value"] = json.Number("123456789012345678901234567890")
+	err := stream.action.attemptBatch(1, 1, []*eventData{event})
+	assert.NoError(err)
+	assert.Equal(json.Number("123456789012345678901234567890"), invoker.invocations[0].params["amount"])
+}
+
+func TestTransactionStreamRetryDoesNotResubmit(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{errs: []error{nil, fmt.Errorf("pop")}}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+		Params:   map[string]string{"amount": "data.value"},
+	})
+	defer sm.Close()
+
+	events := []*eventData{
+		testTransferEvent("k1", "", "1"),
+		testTransferEvent("k2", "", "2"),
+	}
+	err := stream.action.attemptBatch(1, 1, events)
+	assert.EqualError(err, "Invocation rule '0' failed: pop")
+	assert.Len(invoker.invocations, 1)
+
+	err = stream.action.attemptBatch(1, 2, events)
+	assert.NoError(err)
+	assert.Len(invoker.invocations, 2)
+	assert.Equal("2", invoker.invocations[1].params["amount"])
+	assert.Empty(stream.action.(*transactionAction).sent)
+}
+
+func TestTransactionStreamParamNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Name:     "credit",
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+		Params:   map[string]string{"amount": "data.missing"},
+	})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "", "1")})
+	assert.EqualError(err, "Invocation rule 'credit' failed: Field 'data.missing' for parameter 'amount' is not in the event")
+	assert.Empty(invoker.invocations)
+}
+
+func TestTransactionStreamUpdateRules(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+	})
+	defer sm.Close()
+
+	_, err := sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Transaction: &transactionActionInfo{},
+	})
+	assert.EqualError(err, "Must specify transaction.rules for action type 'transaction'")
+
+	_, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Transaction: &transactionActionInfo{Rules: []*InvocationRule{
+			{Contract: "ledger", Method: "debit", From: "treasury"},
+		}},
+	})
+	assert.NoError(err)
+	err = stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "", "1")})
+	assert.NoError(err)
+	assert.Equal("debit", invoker.invocations[0].method)
+}
+
+func TestTransactionStreamUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newEventStream(newTestSubscriptionManager(), &StreamInfo{
+		ID:   "123",
+		Type: "transaction",
+		Transaction: &transactionActionInfo{Rules: []*InvocationRule{
+			{Contract: "ledger", Method: "credit", From: "treasury"},
+		}},
+	}, nil)
+	assert.EqualError(err, "Event streams of type 'transaction' are not available without the contract gateway")
+}
+
+func TestTransactionStreamInvalidRules(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := newTestSubscriptionManager()
+	sm.registrar = &mockInvoker{}
+
+	_, err := newEventStream(sm, &StreamInfo{ID: "123", Type: "transaction"}, nil)
+	assert.EqualError(err, "Must specify transaction.rules for action type 'transaction'")
+
+	_, err = newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "transaction",
+		Transaction: &transactionActionInfo{Rules: []*InvocationRule{
+			{Contract: "ledger", Method: "credit", From: "treasury"},
+			{Contract: "ledger", From: "treasury"},
+		}},
+	}, nil)
+	assert.EqualError(err, "Invocation rule 1 must specify a 'contract', 'method' and 'from'")
+
+	_, err = newEventStream(sm, &StreamInfo{
+		ID:   "123",
+		Type: "transaction",
+		Transaction: &transactionActionInfo{Rules: []*InvocationRule{
+			{Contract: "ledger", Method: "credit", From: "treasury", Params: map[string]string{"amount": ""}},
+		}},
+	}, nil)
+	assert.EqualError(err, "Invalid parameter mapping from 'amount' to ''. Both the input name and event field are required")
+}
+
+func TestTransactionStreamNotAuthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+	})
+	defer sm.Close()
+
+	invoker.authErr = fmt.Errorf("pop")
+	_, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type: "transaction",
+		Transaction: &transactionActionInfo{Rules: []*InvocationRule{
+			{Name: "credit", Contract: "ledger", Method: "credit", From: "treasury"},
+		}},
+	})
+	assert.EqualError(err, "Not authorized to send transactions from 'treasury' for invocation rule 'credit': pop")
+
+	_, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Transaction: &transactionActionInfo{Rules: []*InvocationRule{
+			{Contract: "ledger", Method: "debit", From: "other"},
+		}},
+	})
+	assert.EqualError(err, "Not authorized to send transactions from 'other' for invocation rule '0': pop")
+	assert.Equal("credit", stream.spec.Transaction.Rules[0].Method)
+}
+
+func TestTransactionStreamRetryWithoutDedupKey(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{errs: []error{nil, fmt.Errorf("pop")}}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+		Params:   map[string]string{"amount": "data.value"},
+	})
+	defer sm.Close()
+
+	events := []*eventData{
+		testTransferEvent("", "", "1"),
+		testTransferEvent("", "", "2"),
+	}
+	events[0].BlockNumber, events[0].LogIndex = "10", "0"
+	events[1].BlockNumber, events[1].LogIndex = "10", "1"
+	err := stream.action.attemptBatch(1, 1, events)
+	assert.EqualError(err, "Invocation rule '0' failed: pop")
+	assert.Len(invoker.invocations, 1)
+
+	err = stream.action.attemptBatch(1, 2, events)
+	assert.NoError(err)
+	assert.Len(invoker.invocations, 2)
+	assert.Equal("2", invoker.invocations[1].params["amount"])
+	assert.Empty(stream.action.(*transactionAction).sent)
+}
+
+func TestTransactionStreamSentExpires(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+	})
+	defer sm.Close()
+
+	action := stream.action.(*transactionAction)
+	action.sent["abandoned/0"] = time.Now().Add(-2 * invocationSentTTL)
+	action.sent["recent/0"] = time.Now()
+	err := action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "", "1")})
+	assert.NoError(err)
+	assert.Equal([]string{"recent/0"}, func() []string {
+		keys := []string{}
+		for key := range action.sent {
+			keys = append(keys, key)
+		}
+		return keys
+	}())
+}
+
+func TestTransactionStreamStopCancels(t *testing.T) {
+	assert := assert.New(t)
+
+	invoker := &mockInvoker{}
+	sm, stream := newTestTransactionStream(t, invoker, &InvocationRule{
+		Contract: "ledger",
+		Method:   "credit",
+		From:     "treasury",
+	})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "", "1")})
+	assert.NoError(err)
+	assert.NoError(invoker.ctx.Err())
+
+	err = sm.DeleteStream(context.Background(), stream.spec.ID)
+	assert.NoError(err)
+	assert.Equal(context.Canceled, invoker.ctx.Err())
+}
@@ -19,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/errors"
@@ -29,9 +30,11 @@ import (
 
 type logEntry struct {
 	Address          ethbinding.Address   `json:"address"`
+	BlockHash        ethbinding.Hash      `json:"blockHash"`
 	BlockNumber      ethbinding.HexBigInt `json:"blockNumber"`
 	TransactionIndex ethbinding.HexUint   `json:"transactionIndex"`
 	TransactionHash  ethbinding.Hash      `json:"transactionHash"`
+	LogIndex         logIndexValue        `json:"logIndex"`
 	Data             string               `json:"data"`
 	Topics           []*ethbinding.Hash   `json:"topics"`
 	Timestamp        uint64               `json:"timestamp,omitempty"`
@@ -46,25 +49,64 @@ type eventData struct {
 	SubID            string                 `json:"subId"`
 	Signature        string                 `json:"signature"`
 	LogIndex         string                 `json:"logIndex"`
+	DedupKey         string                 `json:"dedupKey,omitempty"`
 	Timestamp        string                 `json:"timestamp,omitempty"`
+	Truncated        *truncatedData         `json:"truncated,omitempty"`
 	// Used for callback handling
 	batchComplete func(*eventData)
+	purged        func() bool
 }
 
 type logProcessor struct {
-	subID    string
-	event    *ethbinding.ABIEvent
-	stream   *eventStream
-	blockHWM big.Int
-	hwnSync  sync.Mutex
+	subID            string
+	event            *ethbinding.ABIEvent
+	inferIndexed     bool
+	stream           *eventStream
+	blockHWM         big.Int
+	capturedHWM      big.Int // the block after the newest event passed to the stream
+	purgeEvents      bool
+	matchedBlock     big.Int // the newest block with a log that matched the filter
+	lastDelivered    time.Time
+	lastPolled       time.Time
+	pollError        string
+	decodeFailures   uint64
+	lastDecodeError  string
+	hwnSync          sync.Mutex
+	autoRegisterSpec *AutoRegisterSpec
+	registrar        ContractRegistrar
 }
 
 func newLogProcessor(subID string, event *ethbinding.ABIEvent, stream *eventStream) *logProcessor {
-	return &logProcessor{
+	lp := &logProcessor{
 		subID:  subID,
 		event:  event,
 		stream: stream,
 	}
+	// An event built from a signature, without any indexed parameters marked, has the
+	// indexed parameters inferred from the topics of each log
+	if event != nil && !event.Anonymous {
+		lp.inferIndexed = true
+		for _, input := range event.Inputs {
+			if input.Indexed {
+				lp.inferIndexed = false
+			}
+		}
+	}
+	return lp
+}
+
+// logInputs returns the inputs of the event for a log. If the indexed parameters need to be
+// inferred, the first parameters are treated as indexed - one for each topic after the first
+func (lp *logProcessor) logInputs(entry *logEntry) ethbinding.ABIArguments {
+	if !lp.inferIndexed || len(entry.Topics) <= 1 {
+		return lp.event.Inputs
+	}
+	inputs := make(ethbinding.ABIArguments, len(lp.event.Inputs))
+	copy(inputs, lp.event.Inputs)
+	for i := 0; i < len(inputs) && i < len(entry.Topics)-1; i++ {
+		inputs[i].Indexed = true
+	}
+	return inputs
 }
 
 func (lp *logProcessor) batchComplete(newestEvent *eventData) {
@@ -75,10 +117,71 @@ func (lp *logProcessor) batchComplete(newestEvent *eventData) {
 	if i.Cmp(&lp.blockHWM) > 0 {
 		lp.blockHWM.Set(i)
 	}
+	lp.lastDelivered = time.Now().UTC()
 	lp.hwnSync.Unlock()
 	log.Debugf("%s: HWM: %s", lp.subID, lp.blockHWM.String())
 }
 
+// markCaptured records an event has been passed to the stream, so a drain knows to wait for it
+func (lp *logProcessor) markCaptured(event *eventData) {
+	lp.hwnSync.Lock()
+	i := new(big.Int)
+	i.SetString(event.BlockNumber, 10)
+	i.Add(i, big.NewInt(1))
+	if i.Cmp(&lp.capturedHWM) > 0 {
+		lp.capturedHWM.Set(i)
+	}
+	lp.hwnSync.Unlock()
+}
+
+// markPolled records the outcome of a poll for new logs, for the status of the subscription
+func (lp *logProcessor) markPolled(err error) {
+	lp.hwnSync.Lock()
+	lp.lastPolled = time.Now().UTC()
+	lp.pollError = ""
+	if err != nil {
+		lp.pollError = err.Error()
+	}
+	lp.hwnSync.Unlock()
+}
+
+// markMatched records a log returned by the filter, whether or not it can be decoded
+func (lp *logProcessor) markMatched(entry *logEntry) {
+	lp.hwnSync.Lock()
+	if entry.BlockNumber.ToInt().Cmp(&lp.matchedBlock) > 0 {
+		lp.matchedBlock.Set(entry.BlockNumber.ToInt())
+	}
+	lp.hwnSync.Unlock()
+}
+
+// markDecodeFailure records a log that could not be decoded, so was not passed to the stream
+func (lp *logProcessor) markDecodeFailure(err error) {
+	lp.hwnSync.Lock()
+	lp.decodeFailures++
+	lp.lastDecodeError = err.Error()
+	lp.hwnSync.Unlock()
+}
+
+// drained is true once every event passed to the stream has been acknowledged
+func (lp *logProcessor) drained() bool {
+	lp.hwnSync.Lock()
+	defer lp.hwnSync.Unlock()
+	return lp.blockHWM.Cmp(&lp.capturedHWM) >= 0
+}
+
+// purge discards any events that have been passed to the stream, but not yet delivered
+func (lp *logProcessor) purge() {
+	lp.hwnSync.Lock()
+	lp.purgeEvents = true
+	lp.hwnSync.Unlock()
+}
+
+func (lp *logProcessor) purged() bool {
+	lp.hwnSync.Lock()
+	defer lp.hwnSync.Unlock()
+	return lp.purgeEvents
+}
+
 func (lp *logProcessor) getBlockHWM() big.Int {
 	lp.hwnSync.Lock()
 	v := lp.blockHWM
@@ -111,7 +214,9 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 		Data:             make(map[string]interface{}),
 		SubID:            lp.subID,
 		LogIndex:         strconv.Itoa(idx),
+		DedupKey:         eventDedupKey(lp.subID, entry.BlockHash, entry.TransactionIndex, entry.LogIndex),
 		batchComplete:    lp.batchComplete,
+		purged:           lp.purged,
 	}
 	if lp.stream.spec.Timestamps {
 		result.Timestamp = strconv.FormatUint(entry.Timestamp, 10)
@@ -124,7 +229,7 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 	// We need split out the indexed args that we parse out of the topic, from the data args
 	var dataArgs ethbinding.ABIArguments
 	dataArgs = make([]ethbinding.ABIArgument, 0, len(lp.event.Inputs))
-	for idx, input := range lp.event.Inputs {
+	for idx, input := range lp.logInputs(entry) {
 		var val interface{}
 		if input.Indexed {
 			if topicIdx >= len(entry.Topics) {
@@ -133,7 +238,7 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 			topic := entry.Topics[topicIdx]
 			topicIdx++
 			if topic != nil {
-				val = topicToValue(topic, &input)
+				val = eth.TopicToValue(topic, &input)
 			} else {
 				val = nil
 			}
@@ -151,34 +256,13 @@ func (lp *logProcessor) processLogEntry(subInfo string, entry *logEntry, idx int
 		}
 	}
 
+	if lp.autoRegisterSpec != nil && lp.registrar != nil {
+		lp.autoRegister(subInfo, result)
+	}
+
 	// Ok, now we have the full event in a friendly map output. Pass it down to the event processor
 	log.Infof("%s: Dispatching event. Address=%s BlockNumber=%s TxIndex=%s", subInfo, result.Address, result.BlockNumber, result.TransactionIndex)
+	lp.markCaptured(result)
 	lp.stream.handleEvent(result)
 	return nil
 }
-
-func topicToValue(topic *ethbinding.Hash, input *ethbinding.ABIArgument) interface{} {
-	switch input.Type.T {
-	case ethbinding.IntTy, ethbinding.UintTy, ethbinding.BoolTy:
-		h := ethbinding.HexBigInt{}
-		h.UnmarshalText([]byte(topic.Hex()))
-		bI, _ := ethbind.API.ParseBig256(topic.Hex())
-		if input.Type.T == ethbinding.IntTy {
-			// It will be a two's complement number, so needs to be interpretted
-			bI = ethbind.API.S256(bI)
-			return bI.String()
-		} else if input.Type.T == ethbinding.BoolTy {
-			return (bI.Uint64() != 0)
-		}
-		return bI.String()
-	case ethbinding.AddressTy:
-		topicBytes := topic.Bytes()
-		addrBytes := topicBytes[len(topicBytes)-20:]
-		return ethbind.API.BytesToAddress(addrBytes)
-	default:
-		// For all other types it is just a hash of the output for indexing, so we can only
-		// logically return it as a hex string. The Solidity developer has to include
-		// the same data a second type non-indexed to get the real value.
-		return topic.String()
-	}
-}
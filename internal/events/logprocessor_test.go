@@ -57,35 +57,6 @@ const sampleEventABIAllIndexedNoData = `
 }
 `
 
-func TestTopicToValue(t *testing.T) {
-	assert := assert.New(t)
-
-	h := ethbind.API.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffcfc7")
-	v := topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("int64")})
-	assert.Equal("-12345", v)
-
-	h = ethbind.API.HexToHash("0x000000000000000000000000000000000000000001d2d490d572353317a01f8d")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("uint256")})
-	assert.Equal("564363245346346345353453453", v)
-
-	h = ethbind.API.HexToHash("0x0000000000000000000000003924d1d6423f88148a4fcc0417a33b27a61d595f")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("address")})
-	assert.Equal(ethbind.API.HexToAddress("0x3924d1D6423F88148A4fcc0417A33B27a61d595f"), v)
-
-	h = ethbind.API.HexToHash("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("string")})
-	assert.Equal("0xdc47fb175244491f21a29733a67d2e07647d59d2f36f2603d339299587182f19", v)
-
-	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000000")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
-	assert.Equal(false, v)
-
-	h = ethbind.API.HexToHash("0x0000000000000000000000000000000000000000000000000000000000000001")
-	v = topicToValue(&h, &ethbinding.ABIArgument{Type: ethbind.API.ABITypeKnown("bool")})
-	assert.Equal(true, v)
-
-}
-
 func TestProcessLogEntryNillAndTooFewFields(t *testing.T) {
 	assert := assert.New(t)
 
@@ -182,4 +153,59 @@ func TestProcessLogSampleEvent(t *testing.T) {
 		"data1": "0x51b201b016025d42c9a0718b75aacc12b1e9c7f16e4bd2c6618aa944ca399156",
 		"data2": "1000",
 	}, ev.Data)
+	assert.Equal("0xb6d8a38a89ac35a04ee6ebd5789a4a805dfa26c1b753c311db523ec9bf204384-0-1-", ev.DedupKey)
+}
+
+func TestProcessLogInferIndexedFromTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &StreamInfo{
+		Timestamps: false,
+	}
+	stream := &eventStream{
+		spec:        spec,
+		eventStream: make(chan *eventData, 2),
+	}
+	marshaling, err := ParseEventSignature("Transfer(address,address,uint256)")
+	assert.NoError(err)
+	event, _ := ethbind.API.ABIElementMarshalingToABIEvent(marshaling)
+	lp := newLogProcessor("sub1", event, stream)
+	assert.True(lp.inferIndexed)
+
+	topic0 := ethbind.API.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	from := ethbind.API.HexToHash("0x000000000000000000000000aa983ad2a0e0ed8ac639277f37be42f2a5d2618c")
+	to := ethbind.API.HexToHash("0x0000000000000000000000002b8c0ecc76d0759a8f50b2e14a6881367d805832")
+	value := ethbind.API.HexToHash("0x00000000000000000000000000000000000000000000000000000000000003e8")
+
+	// ERC20 style - value in the data
+	err = lp.processLogEntry(t.Name(), &logEntry{
+		Topics: []*ethbinding.Hash{&topic0, &from, &to},
+		Data:   value.Hex(),
+	}, 0)
+	assert.NoError(err)
+	// ERC721 style - all indexed
+	err = lp.processLogEntry(t.Name(), &logEntry{
+		Topics: []*ethbinding.Hash{&topic0, &from, &to, &value},
+		Data:   "0x",
+	}, 1)
+	assert.NoError(err)
+
+	expected := `{"input":"0xaa983ad2a0e0ed8ac639277f37be42f2a5d2618c","input1":"0x2b8c0ecc76d0759a8f50b2e14a6881367d805832","input2":"1000"}`
+	ev := <-stream.eventStream
+	b, _ := json.Marshal(ev.Data)
+	assert.JSONEq(expected, string(b))
+	ev = <-stream.eventStream
+	b, _ = json.Marshal(ev.Data)
+	assert.JSONEq(expected, string(b))
+	assert.False(event.Inputs[0].Indexed)
+}
+
+func TestNewLogProcessorNoInferWithIndexed(t *testing.T) {
+	assert := assert.New(t)
+
+	var marshaling ethbinding.ABIElementMarshaling
+	json.Unmarshal([]byte(sampleEventABIAllIndexedNoData), &marshaling)
+	event, _ := ethbind.API.ABIElementMarshalingToABIEvent(&marshaling)
+	lp := newLogProcessor("sub1", event, &eventStream{})
+	assert.False(lp.inferIndexed)
 }
@@ -0,0 +1,188 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MigrationPath is the path to import an event stream exported from another instance
+	MigrationPath = "/eventstreammigrations"
+	// DefaultExportTimeout is how long an export waits for the batches being delivered to complete
+	DefaultExportTimeout = 60 * time.Second
+)
+
+// StreamMigration is an event stream with its subscriptions and checkpoint, exported from
+// one instance to be imported on another. Unlike the definitions used for bootstrap, the IDs
+// are retained, so the stream carries on from exactly where it stopped
+type StreamMigration struct {
+	Stream        *StreamInfo         `json:"stream"`
+	Subscriptions []*SubscriptionInfo `json:"subscriptions"`
+	Checkpoint    map[string]*big.Int `json:"checkpoint"`
+}
+
+// ExportStream suspends a stream, and waits for any batches it is delivering to complete, before
+// returning it with its subscriptions and checkpoint. The checkpoint is taken from the events that
+// were acknowledged, so nothing is missed or delivered twice once it is resumed on the new instance.
+// The stream is left suspended on this instance, and should be deleted once the import is complete
+func (s *subscriptionMGR) ExportStream(ctx context.Context, id string, timeout time.Duration) (*StreamMigration, error) {
+	stream, err := s.streamByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.SuspendStream(ctx, id); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultExportTimeout
+	}
+	log.Infof("%s: Waiting for event stream to stop for export", id)
+	deadline := time.Now().Add(timeout)
+	for !stream.isStopped() {
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf(errors.EventStreamsMigrateExportTimeout, timeout, id)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(drainCheckInterval):
+		}
+	}
+
+	checkpoint, err := s.loadCheckpoint(id)
+	if err != nil {
+		return nil, err
+	}
+	m := &StreamMigration{
+		Stream:        &StreamInfo{},
+		Subscriptions: []*SubscriptionInfo{},
+		Checkpoint:    checkpoint,
+	}
+	b, _ := json.Marshal(stream.spec)
+	json.Unmarshal(b, m.Stream)
+	for _, sub := range s.subscriptionsForStream(id) {
+		// Batches can complete after the poller last stored the checkpoint
+		hwm := sub.blockHWM()
+		if hwm.Sign() > 0 {
+			checkpoint[sub.info.ID] = new(big.Int).Set(&hwm)
+		}
+		var info SubscriptionInfo
+		b, _ := json.Marshal(sub.info)
+		json.Unmarshal(b, &info)
+		m.Subscriptions = append(m.Subscriptions, &info)
+	}
+	sort.Slice(m.Subscriptions, func(i, j int) bool {
+		return m.Subscriptions[i].ID < m.Subscriptions[j].ID
+	})
+	if err = s.storeCheckpoint(id, checkpoint); err != nil {
+		return nil, err
+	}
+	log.Infof("%s: Exported event stream with %d subscriptions", id, len(m.Subscriptions))
+	return m, nil
+}
+
+// ImportStream creates a stream exported from another instance, with the same IDs and checkpoint.
+// The stream is always created suspended, so it can be resumed once the export has completed.
+// Nothing is created unless the stream and all of its subscriptions can be
+func (s *subscriptionMGR) ImportStream(ctx context.Context, m *StreamMigration) (*StreamInfo, error) {
+	if m.Stream == nil || m.Stream.ID == "" {
+		return nil, errors.Errorf(errors.EventStreamsNoID)
+	}
+	if _, err := s.streamByID(m.Stream.ID); err == nil {
+		return nil, errors.Errorf(errors.EventStreamsMigrateExists, "event stream", m.Stream.ID)
+	}
+	for _, info := range m.Subscriptions {
+		if info.ID == "" || info.Stream != m.Stream.ID {
+			return nil, errors.Errorf(errors.EventStreamsMigrateSubscriptionStream, info.ID, m.Stream.ID)
+		}
+		if _, err := s.subscriptionByID(info.ID); err == nil {
+			return nil, errors.Errorf(errors.EventStreamsMigrateExists, "subscription", info.ID)
+		}
+	}
+
+	spec := m.Stream
+	spec.Suspended = true
+	spec.AutoResume = nil
+	stream, err := newEventStream(s, spec, s.wsChannels)
+	if err != nil {
+		return nil, err
+	}
+	// The stream must be registered before its subscriptions can be restored
+	s.mux.Lock()
+	s.streams[spec.ID] = stream
+	s.mux.Unlock()
+	subs := make([]*subscription, 0, len(m.Subscriptions))
+	for _, info := range m.Subscriptions {
+		var sub *subscription
+		if sub, err = restoreSubscription(s, s.rpc, info); err != nil {
+			break
+		}
+		subs = append(subs, sub)
+	}
+	if err == nil {
+		err = s.storeImportedStream(spec, subs, m.Checkpoint)
+	}
+	if err != nil {
+		s.mux.Lock()
+		delete(s.streams, spec.ID)
+		s.mux.Unlock()
+		stream.stop()
+		return nil, err
+	}
+
+	s.mux.Lock()
+	for _, sub := range subs {
+		s.subscriptions[sub.info.ID] = sub
+	}
+	s.mux.Unlock()
+	log.Infof("%s: Imported event stream with %d subscriptions", spec.ID, len(subs))
+	return spec, nil
+}
+
+// storeImportedStream writes the stream, subscriptions and checkpoint - removing
+// anything already written if one of them fails
+func (s *subscriptionMGR) storeImportedStream(spec *StreamInfo, subs []*subscription, checkpoint map[string]*big.Int) (err error) {
+	written := []string{}
+	defer func() {
+		if err != nil {
+			for _, key := range written {
+				s.db.Delete(key)
+			}
+		}
+	}()
+	if checkpoint == nil {
+		checkpoint = make(map[string]*big.Int)
+	}
+	if err = s.storeCheckpoint(spec.ID, checkpoint); err != nil {
+		return err
+	}
+	written = append(written, checkpointIDPrefix+spec.ID)
+	for _, sub := range subs {
+		if _, err = s.storeSubscription(sub.info); err != nil {
+			return err
+		}
+		written = append(written, sub.info.ID)
+	}
+	_, err = s.storeStream(spec)
+	return err
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportStream(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	// A batch acknowledged after the last checkpoint is included in the export
+	sm.subscriptions[sub.ID].lp.initBlockHWM(big.NewInt(42))
+
+	m, err := sm.ExportStream(ctx, stream.ID, time.Second)
+	assert.NoError(err)
+	assert.True(sm.streams[stream.ID].spec.Suspended)
+	assert.Equal(stream.ID, m.Stream.ID)
+	assert.Len(m.Subscriptions, 1)
+	assert.Equal(sub.ID, m.Subscriptions[0].ID)
+	assert.Equal(int64(42), m.Checkpoint[sub.ID].Int64())
+
+	sm2 := newTestSubscriptionManager()
+	defer sm2.Close()
+	m.Stream.Suspended = false
+	imported, err := sm2.ImportStream(ctx, m)
+	assert.NoError(err)
+	assert.Equal(stream.ID, imported.ID)
+	assert.True(imported.Suspended)
+	assert.Equal("sub1", sm2.subscriptions[sub.ID].info.Name)
+	checkpoint, err := sm2.loadCheckpoint(stream.ID)
+	assert.NoError(err)
+	assert.Equal(int64(42), checkpoint[sub.ID].Int64())
+
+	// Wait for the suspended stream to settle, before resuming it
+	for !sm2.streams[stream.ID].isStopped() {
+		time.Sleep(time.Millisecond)
+	}
+	err = sm2.ResumeStream(ctx, stream.ID)
+	assert.NoError(err)
+
+	_, err = sm2.ImportStream(ctx, m)
+	assert.Regexp("Cannot import event stream .* as it already exists", err)
+}
+
+func TestExportStreamNotFound(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+
+	_, err := sm.ExportStream(context.Background(), "badid", 0)
+	assert.EqualError(err, "Stream with ID 'badid' not found")
+}
+
+func TestImportStreamInvalid(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	_, err := sm.ImportStream(ctx, &StreamMigration{})
+	assert.EqualError(err, "No ID")
+
+	_, err = sm.ImportStream(ctx, &StreamMigration{
+		Stream:        &StreamInfo{ID: "es-new", Type: "websocket"},
+		Subscriptions: []*SubscriptionInfo{{ID: "sb-new", Stream: "es-other"}},
+	})
+	assert.Regexp("Subscription 'sb-new' is not on the imported event stream 'es-new'", err)
+
+	_, err = sm.ImportStream(ctx, &StreamMigration{
+		Stream:        &StreamInfo{ID: "es-new", Type: "websocket"},
+		Subscriptions: []*SubscriptionInfo{{ID: sub.ID, Stream: "es-new"}},
+	})
+	assert.Regexp("Cannot import subscription .* as it already exists", err)
+
+	// A subscription that cannot be restored means nothing is created
+	badEvent := &ethbinding.ABIElementMarshaling{
+		Inputs: []ethbinding.ABIArgumentMarshaling{
+			{Name: "badness", Type: "-1"},
+		},
+	}
+	_, err = sm.ImportStream(ctx, &StreamMigration{
+		Stream:        &StreamInfo{ID: "es-new", Type: "websocket"},
+		Subscriptions: []*SubscriptionInfo{{ID: "sb-new", Stream: "es-new", Event: badEvent}},
+	})
+	assert.EqualError(err, "invalid type '-1'")
+	_, err = sm.StreamByID(ctx, "es-new")
+	assert.Error(err)
+	assert.Len(sm.streams, 1)
+	_, err = sm.StreamByID(ctx, stream.ID)
+	assert.NoError(err)
+}
+
+func TestImportStreamStoreFail(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+	sm.db = kvstore.NewMockKV(fmt.Errorf("pop"))
+
+	_, err := sm.ImportStream(context.Background(), &StreamMigration{
+		Stream: &StreamInfo{ID: "es-new", Type: "websocket"},
+	})
+	assert.EqualError(err, "pop")
+	assert.Empty(sm.streams)
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultPauseAfterFailures is the number of times delivery of a batch fails, with
+	// ErrorHandlingPause, before the stream is paused
+	DefaultPauseAfterFailures = 3
+	// DefaultProbeIntervalSec is the interval at which the receiver of a paused stream is probed
+	DefaultProbeIntervalSec = 30
+)
+
+// eventStreamProbe is implemented by the actions that can check their receiver is available
+// without delivering events to it. A paused stream with any other action is resumed after
+// each probe interval, and the next batch it delivers is the probe
+type eventStreamProbe interface {
+	probe() error
+}
+
+// normalizeErrorHandling returns the error handling of a stream spec, which is skip unless
+// block or pause is set
+func normalizeErrorHandling(errorHandling string) string {
+	switch strings.ToLower(errorHandling) {
+	case ErrorHandlingBlock:
+		return ErrorHandlingBlock
+	case ErrorHandlingPause:
+		return ErrorHandlingPause
+	default:
+		return ErrorHandlingSkip
+	}
+}
+
+// pauseOnError suspends a stream that has failed to deliver a batch too many times, until
+// a probe of the receiver succeeds. The batch is not acknowledged, so is delivered again from
+// the checkpoint of the stream when it resumes
+func (a *eventStream) pauseOnError(batchNumber uint64, attempts int) {
+	log.Warnf("%s: Pausing after batch %d failed %d times. Probing the receiver every %ds", a.spec.ID, batchNumber, attempts, a.spec.ProbeIntervalSec)
+	a.suspendUntil(&AutoResumeSpec{Probe: true})
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	a.lastProbe = time.Now()
+	// Persist the state change, so the stream is still paused after a restart
+	if _, err := a.sm.storeStream(a.spec); err != nil {
+		log.Errorf("%s: Failed to store paused stream: %s", a.spec.ID, err)
+	}
+}
+
+// probeDue returns true if the probe interval has passed since the last probe of the receiver,
+// and no probe is in progress. If so it records the start of the next one, which must be
+// ended with probeDone
+func (a *eventStream) probeDue(now time.Time) bool {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.probing || now.Sub(a.lastProbe) < time.Duration(a.spec.ProbeIntervalSec)*time.Second {
+		return false
+	}
+	a.lastProbe = now
+	a.probing = true
+	return true
+}
+
+// probeDone records the end of a probe of the receiver
+func (a *eventStream) probeDone() {
+	a.batchCond.L.Lock()
+	a.probing = false
+	a.batchCond.L.Unlock()
+}
+
+// probeReceiver checks the receiver of a paused stream is available again
+func (a *eventStream) probeReceiver() error {
+	if p, ok := a.action.(eventStreamProbe); ok {
+		return p.probe()
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPausingStream(t *testing.T, handler http.HandlerFunc) (*subscriptionMGR, *eventStream, *httptest.Server) {
+	svr := httptest.NewServer(handler)
+	sm := newTestSubscriptionManager()
+	sm.config().WebhooksAllowPrivateIPs = true
+	sm.config().EventPollingIntervalSec = 0
+	spec, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type:                 "webhook",
+		Webhook:              &webhookActionInfo{URL: svr.URL},
+		ErrorHandling:        "Pause",
+		PauseAfterFailures:   1,
+		BlockedRetryDelaySec: 1,
+	})
+	assert.NoError(t, err)
+	return sm, sm.streams[spec.ID], svr
+}
+
+func TestNormalizeErrorHandling(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(ErrorHandlingBlock, normalizeErrorHandling("BLOCK"))
+	assert.Equal(ErrorHandlingPause, normalizeErrorHandling("pause"))
+	assert.Equal(ErrorHandlingSkip, normalizeErrorHandling(""))
+	assert.Equal(ErrorHandlingSkip, normalizeErrorHandling("unknown"))
+}
+
+func TestPauseOnErrorDefaults(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+	spec, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type:          "webhook",
+		Webhook:       &webhookActionInfo{URL: "http://test.invalid"},
+		ErrorHandling: ErrorHandlingPause,
+	})
+	assert.NoError(err)
+	assert.Equal(uint64(DefaultPauseAfterFailures), spec.PauseAfterFailures)
+	assert.Equal(uint64(DefaultProbeIntervalSec), spec.ProbeIntervalSec)
+
+	_, err = sm.AddStream(context.Background(), &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid", ProbeURL: ":badurl"},
+	})
+	assert.Regexp("Invalid probeURL in webhook action", err)
+}
+
+func TestPauseOnErrorProbeResume(t *testing.T) {
+	assert := assert.New(t)
+	probeStatus := 503
+	sm, stream, svr := newTestPausingStream(t, func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			res.WriteHeader(probeStatus)
+			return
+		}
+		res.WriteHeader(500)
+	})
+	defer svr.Close()
+	defer sm.Close()
+
+	complete := false
+	stream.handleEvent(&eventData{
+		SubID:         "sub1",
+		batchComplete: func(*eventData) { complete = true },
+	})
+	for stream.autoResumeState() == nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.True(stream.autoResumeState().Probe)
+	for !stream.isStopped() {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.False(complete)
+	stored, err := sm.db.Get(stream.spec.ID)
+	assert.NoError(err)
+	assert.Contains(string(stored), `"probe": true`)
+
+	// Not due until the probe interval has passed
+	sm.resumeDueStreams(context.Background())
+	sm.probesWG.Wait()
+	assert.True(stream.spec.Suspended)
+
+	// The receiver is still unavailable
+	stream.lastProbe = time.Time{}
+	sm.resumeDueStreams(context.Background())
+	sm.probesWG.Wait()
+	assert.True(stream.spec.Suspended)
+
+	// A 405 to the HEAD shows the receiver is back
+	probeStatus = 405
+	stream.lastProbe = time.Time{}
+	sm.resumeDueStreams(context.Background())
+	sm.probesWG.Wait()
+	assert.False(stream.spec.Suspended)
+	assert.Nil(stream.spec.AutoResume)
+}
+
+func TestPauseOnErrorProbeAsync(t *testing.T) {
+	assert := assert.New(t)
+	probing := make(chan struct{}, 2)
+	release := make(chan struct{})
+	sm, stream, svr := newTestPausingStream(t, func(res http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			probing <- struct{}{}
+			<-release
+			res.WriteHeader(503)
+			return
+		}
+		res.WriteHeader(500)
+	})
+	defer svr.Close()
+	defer sm.Close()
+
+	stream.handleEvent(&eventData{SubID: "sub1", batchComplete: func(*eventData) {}})
+	for !stream.isStopped() || stream.autoResumeState() == nil {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// The loop does not wait for the slow receiver, and does not start a second probe of it
+	stream.lastProbe = time.Time{}
+	sm.resumeDueStreams(context.Background())
+	<-probing
+	stream.batchCond.L.Lock()
+	stream.lastProbe = time.Time{}
+	stream.batchCond.L.Unlock()
+	sm.resumeDueStreams(context.Background())
+	close(release)
+	sm.probesWG.Wait()
+	assert.Equal(0, len(probing))
+	assert.True(stream.spec.Suspended)
+	assert.False(stream.probing)
+}
+
+func TestWebhookProbeURL(t *testing.T) {
+	assert := assert.New(t)
+	healthStatus := 404
+	sm, stream, svr := newTestPausingStream(t, func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(http.MethodGet, req.Method)
+		assert.Equal("/health", req.URL.Path)
+		assert.Equal("my-value", req.Header.Get("x-my-header"))
+		res.WriteHeader(healthStatus)
+	})
+	defer svr.Close()
+	defer sm.Close()
+
+	w := stream.action.(*webhookAction)
+	w.spec.ProbeURL = svr.URL + "/health"
+	w.spec.Headers = map[string]string{"x-my-header": "my-value"}
+	assert.Regexp("Probe failed with status=404", w.probe())
+
+	healthStatus = 204
+	assert.NoError(w.probe())
+}
+
+func TestWebhookProbeProhibitedAddress(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, svr := newTestPausingStream(t, func(res http.ResponseWriter, req *http.Request) {})
+	defer svr.Close()
+	defer sm.Close()
+
+	stream.allowPrivateIPs = false
+	assert.Regexp("Cannot send Webhook POST to address", stream.probeReceiver())
+}
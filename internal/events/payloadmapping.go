@@ -0,0 +1,152 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+// DefaultPayloadSeparator joins the names of nested fields when a payload is flattened
+const DefaultPayloadSeparator = "."
+
+// PayloadMapping reshapes the events delivered on a stream, to match the contract of an
+// existing consumer. Fields are addressed by their dotted path in the event, such as
+// data.amount. The steps are applied in order: include, drop, rename, then flatten
+type PayloadMapping struct {
+	Include   []string          `json:"include,omitempty"`   // only keep these fields, if set
+	Drop      []string          `json:"drop,omitempty"`      // remove these fields
+	Rename    map[string]string `json:"rename,omitempty"`    // move a field to a new top level name
+	Flatten   bool              `json:"flatten,omitempty"`   // nested objects become top level fields, like data.amount
+	Separator string            `json:"separator,omitempty"` // joins the names of flattened fields (default ".")
+}
+
+func validatePayloadMapping(m *PayloadMapping) error {
+	if m == nil {
+		return nil
+	}
+	for from, to := range m.Rename {
+		if from == "" || to == "" {
+			return errors.Errorf(errors.EventStreamsPayloadRenameInvalid, from, to)
+		}
+	}
+	return nil
+}
+
+func (m *PayloadMapping) isEmpty() bool {
+	return m == nil || (len(m.Include) == 0 && len(m.Drop) == 0 && len(m.Rename) == 0 && !m.Flatten)
+}
+
+// payload returns what is delivered for a batch of events - the events themselves, the events
+// in the format of another system, or generic maps reshaped by the payload mapping of the stream
+func (a *eventStream) payload(events []*eventData) interface{} {
+	if a.spec.Format == FormatFireFly {
+		return fireflyPayload(events)
+	}
+	m := a.spec.Payload
+	if m.isEmpty() {
+		return events
+	}
+	mapped := make([]map[string]interface{}, len(events))
+	for i, event := range events {
+		mapped[i] = m.apply(event)
+	}
+	return mapped
+}
+
+func (m *PayloadMapping) apply(event *eventData) map[string]interface{} {
+	var fields map[string]interface{}
+	b, _ := json.Marshal(event)
+	json.Unmarshal(b, &fields)
+
+	if len(m.Include) > 0 {
+		included := make(map[string]interface{})
+		for _, path := range m.Include {
+			if v, ok := getPath(fields, path); ok {
+				setPath(included, path, v)
+			}
+		}
+		fields = included
+	}
+	for _, path := range m.Drop {
+		deletePath(fields, path)
+	}
+	for from, to := range m.Rename {
+		if v, ok := getPath(fields, from); ok {
+			deletePath(fields, from)
+			fields[to] = v
+		}
+	}
+	if m.Flatten {
+		sep := m.Separator
+		if sep == "" {
+			sep = DefaultPayloadSeparator
+		}
+		flattened := make(map[string]interface{})
+		flattenInto(flattened, "", sep, fields)
+		fields = flattened
+	}
+	return fields
+}
+
+func getPath(fields map[string]interface{}, path string) (interface{}, bool) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := fields[segment].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		fields = nested
+	}
+	v, ok := fields[segments[len(segments)-1]]
+	return v, ok
+}
+
+func setPath(fields map[string]interface{}, path string, v interface{}) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := fields[segment].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			fields[segment] = nested
+		}
+		fields = nested
+	}
+	fields[segments[len(segments)-1]] = v
+}
+
+func deletePath(fields map[string]interface{}, path string) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		nested, ok := fields[segment].(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields = nested
+	}
+	delete(fields, segments[len(segments)-1])
+}
+
+func flattenInto(flattened map[string]interface{}, prefix, sep string, fields map[string]interface{}) {
+	for k, v := range fields {
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenInto(flattened, prefix+k+sep, sep, nested)
+		} else {
+			flattened[prefix+k] = v
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMappedEvent() *eventData {
+	return &eventData{
+		Address:     "0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca",
+		BlockNumber: "150665",
+		Signature:   "Changed(address,(uint256,string))",
+		SubID:       "sub1",
+		Data: map[string]interface{}{
+			"from":  "0x7ad4d5e7c1c1ec5bb3ad30dcbc9d6c6e1f9e2b8a",
+			"order": map[string]interface{}{"amount": "100", "ref": "abc"},
+		},
+	}
+}
+
+func TestPayloadMappingRenameDropFlatten(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &PayloadMapping{
+		Drop:      []string{"signature", "subId", "logIndex", "transactionIndex", "transactionHash", "data.order.ref"},
+		Rename:    map[string]string{"data.from": "sender", "blockNumber": "block"},
+		Flatten:   true,
+		Separator: "_",
+	}
+	assert.Equal(map[string]interface{}{
+		"address":           "0x167f57a13a9c35ff92f0649d2be0e52b4f8ac3ca",
+		"block":             "150665",
+		"sender":            "0x7ad4d5e7c1c1ec5bb3ad30dcbc9d6c6e1f9e2b8a",
+		"data_order_amount": "100",
+	}, m.apply(testMappedEvent()))
+}
+
+func TestPayloadMappingInclude(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &PayloadMapping{
+		Include: []string{"blockNumber", "data.order.amount", "data.missing"},
+		Rename:  map[string]string{"data.order.amount": "amount"},
+	}
+	assert.Equal(map[string]interface{}{
+		"blockNumber": "150665",
+		"amount":      "100",
+		"data":        map[string]interface{}{"order": map[string]interface{}{}},
+	}, m.apply(testMappedEvent()))
+}
+
+func TestPayloadMappingWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	_, stream, svr, _ := newTestStreamForBatching(&StreamInfo{Webhook: &webhookActionInfo{}}, nil, 200)
+	defer svr.Close()
+	stream.spec.Payload = &PayloadMapping{Flatten: true, Include: []string{"data"}}
+
+	received := make(chan []map[string]interface{}, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var payload []map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&payload)
+		received <- payload
+	}))
+	defer receiver.Close()
+
+	w, err := newWebhookAction(stream, &webhookActionInfo{URL: receiver.URL})
+	assert.NoError(err)
+	err = w.attemptBatch(0, 0, []*eventData{testMappedEvent()})
+	assert.NoError(err)
+	assert.Equal([]map[string]interface{}{{
+		"data.from":         "0x7ad4d5e7c1c1ec5bb3ad30dcbc9d6c6e1f9e2b8a",
+		"data.order.amount": "100",
+		"data.order.ref":    "abc",
+	}}, <-received)
+}
+
+func TestPayloadMappingUpdateStream(t *testing.T) {
+	assert := assert.New(t)
+
+	sm, stream, svr, _ := newTestStreamForBatching(&StreamInfo{Webhook: &webhookActionInfo{}}, nil, 200)
+	defer svr.Close()
+	defer stream.stop()
+
+	_, err := sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Payload: &PayloadMapping{Rename: map[string]string{"blockNumber": ""}},
+	})
+	assert.Regexp("Invalid payload rename from 'blockNumber' to ''", err)
+
+	updated, err := sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Payload: &PayloadMapping{Drop: []string{"subId"}},
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"subId"}, updated.Payload.Drop)
+
+	updated, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Webhook: &webhookActionInfo{URL: svr.URL},
+		Payload: &PayloadMapping{},
+	})
+	assert.NoError(err)
+	assert.Nil(updated.Payload)
+	assert.Equal([]*eventData{}, stream.payload([]*eventData{}))
+}
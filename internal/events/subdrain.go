@@ -0,0 +1,88 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultDrainTimeout is how long a delete waits for a subscription to drain, if no timeout is supplied
+	DefaultDrainTimeout = 60 * time.Second
+	drainCheckInterval  = 100 * time.Millisecond
+)
+
+// SubscriptionDeleteOpts controls what happens to the events a subscription has captured, but
+// not yet delivered, when it is deleted. By default they are still delivered by the stream after
+// the delete returns. Drain waits for them to be delivered before deleting, and purge discards them
+type SubscriptionDeleteOpts struct {
+	Drain        bool
+	Purge        bool
+	DrainTimeout time.Duration
+}
+
+// DeleteSubscriptionWithOpts deletes a subscription, draining or purging the events it has captured
+func (s *subscriptionMGR) DeleteSubscriptionWithOpts(ctx context.Context, id string, opts *SubscriptionDeleteOpts) error {
+	if opts.Drain && opts.Purge {
+		return errors.Errorf(errors.EventStreamsSubscriptionDeleteDrainAndPurge)
+	}
+	sub, err := s.subscriptionByID(id)
+	if err != nil {
+		return err
+	}
+	if opts.Drain && sub.lp.stream.spec.Suspended {
+		return errors.Errorf(errors.EventStreamsSubscriptionDrainSuspended, id, sub.info.Stream)
+	}
+	return s.deleteSubscriptionWithOpts(ctx, sub, opts)
+}
+
+// drainSubscription waits for the stream to acknowledge every event the subscription captured
+// before it stopped polling. If that does not happen in time, the subscription is restored, so
+// it carries on from its checkpoint as if the delete had not been requested
+func (s *subscriptionMGR) drainSubscription(ctx context.Context, sub *subscription, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	log.Infof("%s: Draining captured events before deleting", sub.logName)
+	deadline := time.Now().Add(timeout)
+	for !sub.lp.drained() {
+		if time.Now().After(deadline) {
+			s.restoreSubscription(sub)
+			return errors.Errorf(errors.EventStreamsSubscriptionDrainTimeout, timeout, sub.info.ID)
+		}
+		select {
+		case <-ctx.Done():
+			s.restoreSubscription(sub)
+			return ctx.Err()
+		case <-time.After(drainCheckInterval):
+		}
+	}
+	log.Infof("%s: Drained", sub.logName)
+	return nil
+}
+
+// restoreSubscription puts back a subscription that could not be drained. It is already
+// marked stale, so the stream restarts its filter from the checkpoint on the next poll
+func (s *subscriptionMGR) restoreSubscription(sub *subscription) {
+	log.Warnf("%s: Restoring subscription that did not drain", sub.logName)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	sub.deleting = false
+	s.subscriptions[sub.info.ID] = sub
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteSubscriptionDrainAndPurge(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+
+	err := sm.DeleteSubscriptionWithOpts(context.Background(), sub.ID, &SubscriptionDeleteOpts{Drain: true, Purge: true})
+	assert.EqualError(err, "Only one of drain or purge can be requested when deleting a subscription")
+
+	err = sm.DeleteSubscriptionWithOpts(context.Background(), "badid", &SubscriptionDeleteOpts{Drain: true})
+	assert.EqualError(err, "Subscription with ID 'badid' not found")
+}
+
+func TestDeleteSubscriptionDrainSuspended(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	err := sm.SuspendStream(ctx, stream.ID)
+	assert.NoError(err)
+
+	err = sm.DeleteSubscriptionWithOpts(ctx, sub.ID, &SubscriptionDeleteOpts{Drain: true})
+	assert.Regexp("Cannot drain subscription .* as event stream .* is suspended", err)
+	assert.Len(sm.subscriptions, 1)
+}
+
+func TestDeleteSubscriptionDrained(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+
+	// Once the events captured up to block 10 are acknowledged, the delete completes
+	lp := sm.subscriptions[sub.ID].lp
+	lp.markCaptured(&eventData{BlockNumber: "10"})
+	assert.False(lp.drained())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lp.batchComplete(&eventData{BlockNumber: "10"})
+	}()
+
+	err := sm.DeleteSubscriptionWithOpts(context.Background(), sub.ID, &SubscriptionDeleteOpts{Drain: true})
+	assert.NoError(err)
+	assert.Empty(sm.subscriptions)
+}
+
+func TestDeleteSubscriptionDrainTimeout(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+
+	s := sm.subscriptions[sub.ID]
+	s.lp.initBlockHWM(big.NewInt(5))
+	s.lp.markCaptured(&eventData{BlockNumber: "10"})
+
+	err := sm.DeleteSubscriptionWithOpts(context.Background(), sub.ID, &SubscriptionDeleteOpts{Drain: true, DrainTimeout: time.Millisecond})
+	assert.Regexp("Timed out after 1ms waiting for subscription .* The subscription has not been deleted", err)
+
+	// The subscription is restored, and restarts from its checkpoint
+	assert.Equal(s, sm.subscriptions[sub.ID])
+	assert.False(s.deleting)
+	assert.True(s.filterStale)
+	_, err = sm.db.Get(sub.ID)
+	assert.NoError(err)
+}
+
+func TestDeleteSubscriptionDrainCancelled(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+
+	sm.subscriptions[sub.ID].lp.markCaptured(&eventData{BlockNumber: "10"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := sm.DeleteSubscriptionWithOpts(ctx, sub.ID, &SubscriptionDeleteOpts{Drain: true})
+	assert.Equal(context.Canceled, err)
+	assert.Len(sm.subscriptions, 1)
+}
+
+func TestDeleteSubscriptionPurge(t *testing.T) {
+	assert := assert.New(t)
+	sm, _, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+
+	lp := sm.subscriptions[sub.ID].lp
+	assert.False(lp.purged())
+
+	err := sm.DeleteSubscriptionWithOpts(context.Background(), sub.ID, &SubscriptionDeleteOpts{Purge: true})
+	assert.NoError(err)
+	assert.Empty(sm.subscriptions)
+	assert.True(lp.purged())
+}
+
+func TestProcessBatchDropsPurgedEvents(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling: ErrorHandlingBlock,
+			Webhook:       &webhookActionInfo{},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	var completed []string
+	newEvent := func(subID string, purged bool) *eventData {
+		return &eventData{
+			SubID:         subID,
+			batchComplete: func(*eventData) { completed = append(completed, subID) },
+			purged:        func() bool { return purged },
+		}
+	}
+	stream.batchCond.L.Lock()
+	stream.inFlight = 4
+	stream.batchCond.L.Unlock()
+
+	// A batch with only purged events is acked without being delivered
+	stream.updateWG.Add(1)
+	stream.processBatch(1, []*eventData{newEvent("sub1", true), newEvent("sub1", true)})
+	assert.Empty(completed)
+	assert.Equal(uint64(2), stream.inFlight)
+	assert.Equal(uint64(2), stream.nextAck)
+
+	// Only the events that were not purged are delivered
+	stream.updateWG.Add(1)
+	go func() {
+		stream.processBatch(2, []*eventData{newEvent("sub1", true), newEvent("sub2", false)})
+	}()
+	delivered := <-eventStream
+	assert.Len(delivered, 1)
+	assert.Equal("sub2", delivered[0].SubID)
+	for stream.nextAck != 3 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal([]string{"sub2"}, completed)
+	assert.Equal(uint64(0), stream.inFlight)
+}
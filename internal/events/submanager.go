@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"math/big"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -38,7 +39,9 @@ const (
 	// SubPathPrefix is the path prefix for subscriptions
 	SubPathPrefix = "/subscriptions"
 	// StreamPathPrefix is the path prefix for event streams
-	StreamPathPrefix   = "/eventstreams"
+	StreamPathPrefix = "/eventstreams"
+	// DefinitionsPath is the path to export and import stream and subscription definitions
+	DefinitionsPath    = "/eventdefinitions"
 	subIDPrefix        = "sb-"
 	streamIDPrefix     = "es-"
 	checkpointIDPrefix = "cp-"
@@ -52,30 +55,58 @@ type SubscriptionManager interface {
 	StreamByID(ctx context.Context, id string) (*StreamInfo, error)
 	UpdateStream(ctx context.Context, id string, spec *StreamInfo) (*StreamInfo, error)
 	SuspendStream(ctx context.Context, id string) error
+	SuspendStreamUntil(ctx context.Context, id string, until *AutoResumeSpec) error
 	ResumeStream(ctx context.Context, id string) error
 	DeleteStream(ctx context.Context, id string) error
-	AddSubscription(ctx context.Context, addr *ethbinding.Address, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string) (*SubscriptionInfo, error)
+	AddSubscription(ctx context.Context, addr *ethbinding.Address, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string, autoRegister *AutoRegisterSpec) (*SubscriptionInfo, error)
 	Subscriptions(ctx context.Context) []*SubscriptionInfo
 	SubscriptionByID(ctx context.Context, id string) (*SubscriptionInfo, error)
+	SubscriptionStatus(ctx context.Context, id string) (*SubscriptionStatus, error)
 	ResetSubscription(ctx context.Context, id, initialBlock string) error
 	DeleteSubscription(ctx context.Context, id string) error
+	DeleteSubscriptionWithOpts(ctx context.Context, id string, opts *SubscriptionDeleteOpts) error
+	ExportDefinitions(ctx context.Context, includeHeaders bool) *BootstrapConf
+	ImportDefinitions(ctx context.Context, defs *BootstrapConf) error
+	ExportStream(ctx context.Context, id string, timeout time.Duration) (*StreamMigration, error)
+	ImportStream(ctx context.Context, m *StreamMigration) (*StreamInfo, error)
+	IdleSubscriptions(ctx context.Context, idleTimeout time.Duration) ([]*IdleSubscriptionInfo, error)
+	DeadLetters(ctx context.Context, streamID string) ([]*DeadLetter, error)
+	ReplayDeadLetter(ctx context.Context, streamID, id string) (*DeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, streamID, id string) error
+	OversizedEvent(ctx context.Context, streamID, id string) (*OversizedEvent, error)
+	DeleteOversizedEvent(ctx context.Context, streamID, id string) error
+	WebhookSLA(ctx context.Context) []*WebhookSLA
 	Close()
 }
 
 type subscriptionManager interface {
 	config() *SubscriptionManagerConf
 	streamByID(string) (*eventStream, error)
+	contractRegistrar() ContractRegistrar
+	contractRegistrations() ContractRegistrar
+	blockTimestamps() *eth.BlockTimestampCache
 	subscriptionByID(string) (*subscription, error)
 	subscriptionsForStream(string) []*subscription
 	loadCheckpoint(string) (map[string]*big.Int, error)
 	storeCheckpoint(string, map[string]*big.Int) error
+	storeDeadLetter(string, []*eventData, error)
+	storeOversizedEvent(string, string, int, *eventData) error
+	recordWebhookDelivery(string, string, time.Duration, int, error)
+	storeStream(*StreamInfo) (*StreamInfo, error)
 }
 
 // SubscriptionManagerConf configuration
 type SubscriptionManagerConf struct {
-	EventLevelDBPath        string `json:"eventsDB"`
-	EventPollingIntervalSec uint64 `json:"eventPollingIntervalSec,omitempty"`
-	WebhooksAllowPrivateIPs bool   `json:"webhooksAllowPrivateIPs,omitempty"`
+	EventLevelDBPath        string                  `json:"eventsDB"`
+	EventsInMemory          bool                    `json:"eventsInMemory,omitempty"`
+	EventPollingIntervalSec uint64                  `json:"eventPollingIntervalSec,omitempty"`
+	WebhooksAllowPrivateIPs bool                    `json:"webhooksAllowPrivateIPs,omitempty"`
+	Bootstrap               *BootstrapConf          `json:"bootstrap,omitempty"`
+	BootstrapFile           string                  `json:"bootstrapFile,omitempty"`
+	IdleSubscriptionGC      *IdleSubscriptionGCConf `json:"idleSubscriptionGC,omitempty"`
+	Alerts                  *AlertConf              `json:"alerts,omitempty"`
+	WebhookClient           *WebhookClientConf      `json:"webhookClient,omitempty"`
+	WebhookSLA              *WebhookSLAConf         `json:"webhookSLA,omitempty"`
 }
 
 type subscriptionMGR struct {
@@ -83,21 +114,69 @@ type subscriptionMGR struct {
 	rpcConf       *eth.RPCConnOpts
 	db            kvstore.KVStore
 	rpc           eth.RPCClient
+	mux           sync.RWMutex
 	subscriptions map[string]*subscription
 	streams       map[string]*eventStream
 	closed        bool
 	wsChannels    ws.WebSocketChannels
+	registrar     ContractRegistrar
+	registrations *registrationQueue
+	idleGCStop    chan struct{}
+	idleGCDone    chan struct{}
+	resumeStop    chan struct{}
+	resumeDone    chan struct{}
+	probesWG      sync.WaitGroup // probes of the receivers of paused streams in progress
+	alertStop     chan struct{}
+	alertDone     chan struct{}
+	alertsFiring  map[string]bool
+	timestamps    *eth.BlockTimestampCache
+	webhookSLA    *webhookSLATracker
 }
 
 // CobraInitSubscriptionManager standard naming for cobra command params
 func CobraInitSubscriptionManager(cmd *cobra.Command, conf *SubscriptionManagerConf) {
 	cmd.Flags().StringVarP(&conf.EventLevelDBPath, "events-db", "E", "", "Level DB location for subscription management")
+	cmd.Flags().BoolVar(&conf.EventsInMemory, "events-memory", false, "Store event streams, subscriptions and checkpoints in memory instead of the events-db, for ephemeral test environments")
 	cmd.Flags().Uint64VarP(&conf.EventPollingIntervalSec, "events-polling-int", "j", 10, "Event polling interval (ms)")
 	cmd.Flags().BoolVarP(&conf.WebhooksAllowPrivateIPs, "events-privips", "J", false, "Allow private IPs in Webhooks")
+	cmd.Flags().StringVar(&conf.BootstrapFile, "events-bootstrap", "", "YAML or JSON file of event streams and subscriptions to create or update at startup")
+	conf.IdleSubscriptionGC = &IdleSubscriptionGCConf{}
+	cmd.Flags().Uint64Var(&conf.IdleSubscriptionGC.IdleTimeoutSec, "events-idle-timeout", 0, "Flag subscriptions on streams suspended or unreachable for longer than this (seconds)")
+	cmd.Flags().BoolVar(&conf.IdleSubscriptionGC.Delete, "events-idle-delete", false, "Delete subscriptions flagged by events-idle-timeout")
+	conf.Alerts = &AlertConf{}
+	cmd.Flags().StringVar(&conf.Alerts.URL, "events-alert-url", "", "Webhook to notify when a stream exceeds the alert thresholds")
+	cmd.Flags().Float64Var(&conf.Alerts.ErrorRateThreshold, "events-alert-error-rate", 0, "Alert when more than this proportion of deliveries on a stream fail (0-1)")
+	cmd.Flags().Uint64Var(&conf.Alerts.LagThreshold, "events-alert-lag", 0, "Alert when a stream is more than this many blocks behind the chain")
+	conf.WebhookClient = &WebhookClientConf{}
+	cmd.Flags().IntVar(&conf.WebhookClient.MaxIdleConns, "events-webhook-max-idle-conns", DefaultWebhookMaxIdleConns, "Maximum idle connections kept open by each webhook stream")
+	cmd.Flags().IntVar(&conf.WebhookClient.MaxIdleConnsPerHost, "events-webhook-max-idle-conns-per-host", DefaultWebhookMaxIdleConnsPerHost, "Maximum idle connections kept open by each webhook stream to a single host")
+	cmd.Flags().IntVar(&conf.WebhookClient.MaxConnsPerHost, "events-webhook-max-conns-per-host", 0, "Maximum connections from each webhook stream to a single host (0 for no limit)")
+	cmd.Flags().Uint64Var(&conf.WebhookClient.IdleConnTimeoutSec, "events-webhook-idle-timeout", DefaultWebhookIdleConnTimeoutSec, "Time an idle webhook connection is kept open (seconds)")
+	cmd.Flags().Uint64Var(&conf.WebhookClient.KeepAliveSec, "events-webhook-keepalive", DefaultWebhookKeepAliveSec, "Interval of TCP keep-alive probes on webhook connections (seconds)")
+	cmd.Flags().BoolVar(&conf.WebhookClient.DisableKeepAlives, "events-webhook-no-keepalive", false, "Open a new connection for every webhook delivery")
+	cmd.Flags().Uint64Var(&conf.WebhookClient.ConnectTimeoutSec, "events-webhook-connect-timeout", DefaultWebhookConnectTimeoutSec, "Timeout to connect to a webhook (seconds)")
+	cmd.Flags().Uint64Var(&conf.WebhookClient.TLSHandshakeTimeoutSec, "events-webhook-tls-timeout", DefaultWebhookTLSHandshakeTimeoutSec, "Timeout of the TLS handshake with a webhook (seconds)")
+	cmd.Flags().BoolVar(&conf.WebhookClient.HTTP2, "events-webhook-http2", false, "Attempt HTTP/2 for webhook deliveries over TLS")
+	conf.WebhookSLA = &WebhookSLAConf{}
+	cmd.Flags().IntSliceVar(&conf.WebhookSLA.WindowsSec, "events-webhook-sla-windows", DefaultWebhookSLAWindowsSec, "Time windows over which the success rate and latency of each webhook receiver are reported (seconds)")
+	cmd.Flags().IntVar(&conf.WebhookSLA.Count, "events-webhook-sla-count", DefaultWebhookSLACount, "Number of most recent deliveries to each webhook receiver in the count-based window")
+}
+
+// SubscriptionManagerOption configures optional behavior of the subscription manager
+type SubscriptionManagerOption func(sm *subscriptionMGR)
+
+// WithContractRegistrar enables subscriptions that register the contract instances announced
+// by factory events, and event streams that invoke contracts. Registrations are made on a
+// worker queue, which is stopped when the subscription manager is closed
+func WithContractRegistrar(registrar ContractRegistrar) SubscriptionManagerOption {
+	return func(sm *subscriptionMGR) {
+		sm.registrar = registrar
+		sm.registrations = newRegistrationQueue(registrar)
+	}
 }
 
 // NewSubscriptionManager constructor
-func NewSubscriptionManager(conf *SubscriptionManagerConf, rpc eth.RPCClient, wsChannels ws.WebSocketChannels) SubscriptionManager {
+func NewSubscriptionManager(conf *SubscriptionManagerConf, rpc eth.RPCClient, wsChannels ws.WebSocketChannels, opts ...SubscriptionManagerOption) SubscriptionManager {
 	sm := &subscriptionMGR{
 		conf:          conf,
 		rpc:           rpc,
@@ -105,9 +184,14 @@ func NewSubscriptionManager(conf *SubscriptionManagerConf, rpc eth.RPCClient, ws
 		streams:       make(map[string]*eventStream),
 		wsChannels:    wsChannels,
 	}
+	for _, opt := range opts {
+		opt(sm)
+	}
 	if conf.EventPollingIntervalSec <= 0 {
 		conf.EventPollingIntervalSec = 1
 	}
+	sm.timestamps, _ = eth.BlockTimestampCacheFor(rpc, DefaultTimestampCacheSize)
+	sm.webhookSLA = newWebhookSLATracker(conf.WebhookSLA)
 	return sm
 }
 
@@ -122,6 +206,8 @@ func (s *subscriptionMGR) SubscriptionByID(ctx context.Context, id string) (*Sub
 
 // Subscriptions used externally to get list subscriptions
 func (s *subscriptionMGR) Subscriptions(ctx context.Context) []*SubscriptionInfo {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
 	l := make([]*SubscriptionInfo, 0, len(s.subscriptions))
 	for _, sub := range s.subscriptions {
 		l = append(l, sub.info)
@@ -144,14 +230,15 @@ func (s *subscriptionMGR) setInitialBlock(i *SubscriptionInfo, initialBlock stri
 }
 
 // AddSubscription adds a new subscription
-func (s *subscriptionMGR) AddSubscription(ctx context.Context, addr *ethbinding.Address, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string) (*SubscriptionInfo, error) {
+func (s *subscriptionMGR) AddSubscription(ctx context.Context, addr *ethbinding.Address, event *ethbinding.ABIElementMarshaling, streamID, initialBlock, name string, autoRegister *AutoRegisterSpec) (*SubscriptionInfo, error) {
 	i := &SubscriptionInfo{
 		TimeSorted: messages.TimeSorted{
 			CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
 		},
-		ID:     subIDPrefix + utils.UUIDv4(),
-		Event:  event,
-		Stream: streamID,
+		ID:           subIDPrefix + utils.UUIDv4(),
+		Event:        event,
+		Stream:       streamID,
+		AutoRegister: autoRegister,
 	}
 	i.Path = SubPathPrefix + "/" + i.ID
 	// Set any user supplied a name for the subscription
@@ -167,7 +254,9 @@ func (s *subscriptionMGR) AddSubscription(ctx context.Context, addr *ethbinding.
 	if err != nil {
 		return nil, err
 	}
+	s.mux.Lock()
 	s.subscriptions[sub.info.ID] = sub
+	s.mux.Unlock()
 	return s.storeSubscription(sub.info)
 }
 
@@ -175,6 +264,22 @@ func (s *subscriptionMGR) config() *SubscriptionManagerConf {
 	return s.conf
 }
 
+func (s *subscriptionMGR) contractRegistrar() ContractRegistrar {
+	return s.registrar
+}
+
+// contractRegistrations returns the worker queue that auto-registration requests are made on
+func (s *subscriptionMGR) contractRegistrations() ContractRegistrar {
+	if s.registrations == nil {
+		return s.registrar
+	}
+	return s.registrations
+}
+
+func (s *subscriptionMGR) blockTimestamps() *eth.BlockTimestampCache {
+	return s.timestamps
+}
+
 // ResetSubscription restarts the steam from the specified block
 func (s *subscriptionMGR) ResetSubscription(ctx context.Context, id, initialBlock string) error {
 	sub, err := s.subscriptionByID(id)
@@ -207,8 +312,27 @@ func (s *subscriptionMGR) DeleteSubscription(ctx context.Context, id string) err
 }
 
 func (s *subscriptionMGR) deleteSubscription(ctx context.Context, sub *subscription) error {
+	return s.deleteSubscriptionWithOpts(ctx, sub, &SubscriptionDeleteOpts{})
+}
+
+func (s *subscriptionMGR) deleteSubscriptionWithOpts(ctx context.Context, sub *subscription, opts *SubscriptionDeleteOpts) error {
+	// Check and remove atomically, as the idle GC can race with a delete over the API
+	s.mux.Lock()
+	if _, exists := s.subscriptions[sub.info.ID]; !exists {
+		s.mux.Unlock()
+		return errors.Errorf(errors.EventStreamsSubscriptionNotFound, sub.info.ID)
+	}
 	delete(s.subscriptions, sub.info.ID)
+	s.mux.Unlock()
 	sub.unsubscribe(ctx, true)
+	if opts.Purge {
+		sub.lp.purge()
+	}
+	if opts.Drain {
+		if err := s.drainSubscription(ctx, sub, opts.DrainTimeout); err != nil {
+			return err
+		}
+	}
 	if err := s.db.Delete(sub.info.ID); err != nil {
 		return err
 	}
@@ -229,14 +353,26 @@ func (s *subscriptionMGR) StreamByID(ctx context.Context, id string) (*StreamInf
 	if err != nil {
 		return nil, err
 	}
-	return stream.spec, nil
+	return stream.spec.redacted(), nil
 }
 
 // Streams used externally to get list streams
 func (s *subscriptionMGR) Streams(ctx context.Context) []*StreamInfo {
-	l := make([]*StreamInfo, 0, len(s.subscriptions))
+	streams := s.allStreams()
+	l := make([]*StreamInfo, 0, len(streams))
+	for _, stream := range streams {
+		l = append(l, stream.spec.redacted())
+	}
+	return l
+}
+
+// allStreams takes a copy of the streams, so callers can iterate without holding the lock
+func (s *subscriptionMGR) allStreams() []*eventStream {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	l := make([]*eventStream, 0, len(s.streams))
 	for _, stream := range s.streams {
-		l = append(l, stream.spec)
+		l = append(l, stream)
 	}
 	return l
 }
@@ -246,12 +382,22 @@ func (s *subscriptionMGR) AddStream(ctx context.Context, spec *StreamInfo) (*Str
 	spec.ID = streamIDPrefix + utils.UUIDv4()
 	spec.CreatedISO8601 = time.Now().UTC().Format(time.RFC3339)
 	spec.Path = StreamPathPrefix + "/" + spec.ID
+	if strings.EqualFold(spec.Type, "transaction") {
+		if err := s.authorizeInvocationRules(ctx, spec.Transaction); err != nil {
+			return nil, err
+		}
+	}
 	stream, err := newEventStream(s, spec, s.wsChannels)
 	if err != nil {
 		return nil, err
 	}
+	s.mux.Lock()
 	s.streams[stream.spec.ID] = stream
-	return s.storeStream(stream.spec)
+	s.mux.Unlock()
+	if _, err := s.storeStream(stream.spec); err != nil {
+		return nil, err
+	}
+	return stream.spec.redacted(), nil
 }
 
 // UpdateStream updates an existing stream
@@ -260,11 +406,19 @@ func (s *subscriptionMGR) UpdateStream(ctx context.Context, id string, spec *Str
 	if err != nil {
 		return nil, err
 	}
+	if stream.spec.Type == "transaction" {
+		if err := s.authorizeInvocationRules(ctx, spec.Transaction); err != nil {
+			return nil, err
+		}
+	}
 	updatedSpec, err := stream.update(spec)
 	if err != nil {
 		return nil, err
 	}
-	return s.storeStream(updatedSpec)
+	if _, err := s.storeStream(updatedSpec); err != nil {
+		return nil, err
+	}
+	return updatedSpec.redacted(), nil
 }
 
 func (s *subscriptionMGR) storeStream(spec *StreamInfo) (*StreamInfo, error) {
@@ -282,21 +436,28 @@ func (s *subscriptionMGR) DeleteStream(ctx context.Context, id string) error {
 		return err
 	}
 	// We have to clean up all the associated subs
-	for _, sub := range s.subscriptions {
-		if sub.info.Stream == stream.spec.ID {
-			s.deleteSubscription(ctx, sub)
-		}
+	for _, sub := range s.subscriptionsForStream(stream.spec.ID) {
+		s.deleteSubscription(ctx, sub)
 	}
+	s.mux.Lock()
 	delete(s.streams, stream.spec.ID)
+	s.mux.Unlock()
 	stream.stop()
 	if err = s.db.Delete(stream.spec.ID); err != nil {
 		return err
 	}
 	s.deleteCheckpoint(stream.spec.ID)
+	if stream.spec.DeadLetter || stream.spec.OversizedEvents == OversizedEventsDeadLetter {
+		s.deleteDeadLetters(stream.spec.ID)
+	}
+	s.deleteOversizedEvents(stream.spec.ID)
+	s.webhookSLA.removeStream(stream.spec.ID)
 	return nil
 }
 
 func (s *subscriptionMGR) subscriptionsForStream(id string) []*subscription {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
 	subIDs := make([]*subscription, 0)
 	for _, sub := range s.subscriptions {
 		if sub.info.Stream == id {
@@ -334,6 +495,8 @@ func (s *subscriptionMGR) ResumeStream(ctx context.Context, id string) error {
 
 // subscriptionByID used internally to lookup full objects
 func (s *subscriptionMGR) subscriptionByID(id string) (*subscription, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
 	sub, exists := s.subscriptions[id]
 	if !exists {
 		return nil, errors.Errorf(errors.EventStreamsSubscriptionNotFound, id)
@@ -343,6 +506,8 @@ func (s *subscriptionMGR) subscriptionByID(id string) (*subscription, error) {
 
 // streamByID used internally to lookup full objects
 func (s *subscriptionMGR) streamByID(id string) (*eventStream, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
 	stream, exists := s.streams[id]
 	if !exists {
 		return nil, errors.Errorf(errors.EventStreamsStreamNotFound, id)
@@ -380,12 +545,20 @@ func (s *subscriptionMGR) deleteCheckpoint(streamID string) {
 }
 
 func (s *subscriptionMGR) Init() (err error) {
-	if s.db, err = kvstore.NewLDBKeyValueStore(s.conf.EventLevelDBPath); err != nil {
+	if s.conf.EventsInMemory && s.conf.EventLevelDBPath == "" {
+		log.Warnf("Event streams and subscriptions are stored in memory, and will be lost on restart")
+		s.db = kvstore.NewMemoryKeyValueStore()
+	} else if s.db, err = kvstore.NewLDBKeyValueStore(s.conf.EventLevelDBPath); err != nil {
 		return errors.Errorf(errors.EventStreamsDBLoad, s.conf.EventLevelDBPath, err)
 	}
 	s.recoverStreams()
 	s.recoverSubscriptions()
-	return nil
+	if err = s.bootstrap(context.Background()); err != nil {
+		return err
+	}
+	s.startIdleSubscriptionGC()
+	s.startAutoResume()
+	return s.startAlerts()
 }
 
 func (s *subscriptionMGR) recoverStreams() {
@@ -405,7 +578,9 @@ func (s *subscriptionMGR) recoverStreams() {
 			if err != nil {
 				log.Errorf("Failed to recover stream '%s': %s", streamInfo.ID, err)
 			} else {
+				s.mux.Lock()
 				s.streams[streamInfo.ID] = stream
+				s.mux.Unlock()
 			}
 		}
 	}
@@ -428,7 +603,9 @@ func (s *subscriptionMGR) recoverSubscriptions() {
 			if err != nil {
 				log.Errorf("Failed to recover subscription '%s': %s", subInfo.ID, err)
 			} else {
+				s.mux.Lock()
 				s.subscriptions[subInfo.ID] = sub
+				s.mux.Unlock()
 			}
 		}
 	}
@@ -436,9 +613,26 @@ func (s *subscriptionMGR) recoverSubscriptions() {
 
 func (s *subscriptionMGR) Close() {
 	log.Infof("Event stream subscription manager shutting down")
-	for _, stream := range s.streams {
+	if s.idleGCStop != nil && !s.closed {
+		close(s.idleGCStop)
+		// Wait for any in-progress collection, before we close the DB
+		<-s.idleGCDone
+	}
+	if s.resumeStop != nil && !s.closed {
+		close(s.resumeStop)
+		<-s.resumeDone
+	}
+	s.probesWG.Wait()
+	if s.alertStop != nil && !s.closed {
+		close(s.alertStop)
+		<-s.alertDone
+	}
+	for _, stream := range s.allStreams() {
 		stream.stop()
 	}
+	if s.registrations != nil && !s.closed {
+		s.registrations.close()
+	}
 	if !s.closed && s.db != nil {
 		s.db.Close()
 	}
@@ -93,6 +93,25 @@ func newTestSubscriptionManager() *subscriptionMGR {
 	return sm
 }
 
+func TestStreamsShareBlockTimestampCache(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+	ctx := context.Background()
+
+	stream1, err := sm.AddStream(ctx, &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "t1"}})
+	assert.NoError(err)
+	stream2, err := sm.AddStream(ctx, &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "t2"}})
+	assert.NoError(err)
+	stream3, err := sm.AddStream(ctx, &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "t3"}, TimestampCacheSize: 10})
+	assert.NoError(err)
+
+	assert.NotNil(sm.timestamps)
+	assert.True(sm.timestamps == sm.streams[stream1.ID].blockTimestampCache)
+	assert.True(sm.timestamps == sm.streams[stream2.ID].blockTimestampCache)
+	assert.False(sm.timestamps == sm.streams[stream3.ID].blockTimestampCache)
+}
+
 func TestCobraInitSubscriptionManager(t *testing.T) {
 	assert := assert.New(t)
 	cmd := cobra.Command{}
@@ -117,6 +136,20 @@ func TestInitLevelDBSuccess(t *testing.T) {
 	sm.Close()
 }
 
+func TestInitInMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := newTestSubscriptionManager()
+	sm.config().EventsInMemory = true
+	err := sm.Init()
+	assert.NoError(err)
+	_, isMock := sm.db.(*kvstore.MockKV)
+	assert.False(isMock)
+	err = sm.db.Put("key1", []byte("val1"))
+	assert.NoError(err)
+	sm.Close()
+}
+
 func TestInitLevelDBFail(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -149,7 +182,7 @@ func TestActionAndSubscriptionLifecyle(t *testing.T) {
 	})
 	assert.NoError(err)
 
-	sub, err := sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "", subscriptionName)
+	sub, err := sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "", subscriptionName, nil)
 	assert.NoError(err)
 	assert.Equal(stream.ID, sub.Stream)
 
@@ -224,7 +257,7 @@ func TestActionChildCleanup(t *testing.T) {
 	})
 	assert.NoError(err)
 
-	sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "12345", "")
+	sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "12345", "", nil)
 	err = sm.DeleteStream(ctx, stream.ID)
 	assert.NoError(err)
 
@@ -253,7 +286,7 @@ func TestStreamAndSubscriptionErrors(t *testing.T) {
 	})
 	assert.NoError(err)
 
-	sub, err := sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "", subscriptionName)
+	sub, err := sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "ping"}, stream.ID, "", subscriptionName, nil)
 	assert.NoError(err)
 
 	err = sm.ResetSubscription(ctx, sub.ID, "badness")
@@ -293,13 +326,13 @@ func TestResetSubscriptionErrors(t *testing.T) {
 	err = sm.DeleteStream(ctx, "teststream")
 	assert.EqualError(err, "pop")
 
-	_, err = sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "nope", "", "")
+	_, err = sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "nope", "", "", nil)
 	assert.EqualError(err, "Stream with ID 'nope' not found")
-	_, err = sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "teststream", "", "test")
+	_, err = sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "teststream", "", "test", nil)
 	assert.EqualError(err, "Failed to store subscription: pop")
-	_, err = sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "teststream", "!bad integer", "")
+	_, err = sm.AddSubscription(ctx, nil, &ethbinding.ABIElementMarshaling{Name: "any"}, "teststream", "!bad integer", "", nil)
 	assert.EqualError(err, "FromBlock cannot be parsed as a BigInt")
-	sm.subscriptions["testsub"] = &subscription{info: &SubscriptionInfo{}, rpc: sm.rpc}
+	sm.subscriptions["testsub"] = &subscription{info: &SubscriptionInfo{ID: "testsub"}, rpc: sm.rpc}
 	err = sm.ResetSubscription(ctx, "nope", "0")
 	assert.EqualError(err, "Subscription with ID 'nope' not found")
 	err = sm.DeleteSubscription(ctx, "nope")
@@ -44,14 +44,15 @@ type ethFilter struct {
 // SubscriptionInfo is the persisted data for the subscription
 type SubscriptionInfo struct {
 	messages.TimeSorted
-	ID        string                           `json:"id,omitempty"`
-	Path      string                           `json:"path"`
-	Summary   string                           `json:"-"`    // System generated name for the subscription
-	Name      string                           `json:"name"` // User provided name for the subscription, set to Summary if missing
-	Stream    string                           `json:"stream"`
-	Filter    persistedFilter                  `json:"filter"`
-	Event     *ethbinding.ABIElementMarshaling `json:"event"`
-	FromBlock string                           `json:"fromBlock,omitempty"`
+	ID           string                           `json:"id,omitempty"`
+	Path         string                           `json:"path"`
+	Summary      string                           `json:"-"`    // System generated name for the subscription
+	Name         string                           `json:"name"` // User provided name for the subscription, set to Summary if missing
+	Stream       string                           `json:"stream"`
+	Filter       persistedFilter                  `json:"filter"`
+	Event        *ethbinding.ABIElementMarshaling `json:"event"`
+	FromBlock    string                           `json:"fromBlock,omitempty"`
+	AutoRegister *AutoRegisterSpec                `json:"autoRegister,omitempty"`
 }
 
 // subscription is the runtime that manages the subscription
@@ -98,6 +99,13 @@ func newSubscription(sm subscriptionManager, rpc eth.RPCClient, addr *ethbinding
 	if event == nil || event.Name == "" {
 		return nil, errors.Errorf(errors.EventStreamsSubscribeNoEvent)
 	}
+	if i.AutoRegister != nil {
+		if err := validateAutoRegister(i.AutoRegister, event, sm.contractRegistrar()); err != nil {
+			return nil, err
+		}
+		s.lp.autoRegisterSpec = i.AutoRegister
+		s.lp.registrar = sm.contractRegistrations()
+	}
 	// For now we only support filtering on the event type
 	f.Topics = [][]ethbinding.Hash{{event.ID}}
 	log.Infof("Created subscription ID:%s name:%s topic:%s", i.ID, i.Name, event.ID)
@@ -128,6 +136,10 @@ func restoreSubscription(sm subscriptionManager, rpc eth.RPCClient, i *Subscript
 		logName:     i.ID + ":" + ethbind.API.ABIEventSignature(event),
 		filterStale: true,
 	}
+	if i.AutoRegister != nil {
+		s.lp.autoRegisterSpec = i.AutoRegister
+		s.lp.registrar = sm.contractRegistrations()
+	}
 	return s, nil
 }
 
@@ -179,27 +191,15 @@ func (s *subscription) restartFilter(ctx context.Context, since *big.Int) error
 // and falls back to querying the node if we don't have timestamp in the cache (at which point it gets
 // added to the cache)
 func (s *subscription) getEventTimestamp(ctx context.Context, l *logEntry) {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
 	// the key in the cache is the block number represented as a string
 	blockNumber := l.BlockNumber.String()
-	if ts, ok := s.lp.stream.blockTimestampCache.Get(blockNumber); ok {
-		// we found the timestamp for the block in our local cache, assert it's type and return, no need to query the chain
-		l.Timestamp = ts.(uint64)
-		return
-	}
-	// we didn't find the timestamp in our cache, query the node for the block header where we can find the timestamp
-	rpcMethod := "eth_getBlockByNumber"
-
-	var hdr ethbinding.Header
-	// 2nd parameter (false) indicates it is sufficient to retrieve only hashes of tx objects
-	if err := s.rpc.CallContext(ctx, &hdr, rpcMethod, blockNumber, false); err != nil {
+	ts, err := s.lp.stream.blockTimestampCache.GetBlockTimestamp(ctx, s.rpc, blockNumber)
+	if err != nil {
 		log.Errorf("Unable to retrieve block[%s] timestamp: %s", blockNumber, err)
 		l.Timestamp = 0 // set to 0, we were not able to retrieve the timestamp.
 		return
 	}
-	l.Timestamp = hdr.Time
-	s.lp.stream.blockTimestampCache.Add(blockNumber, l.Timestamp)
+	l.Timestamp = ts
 }
 
 func (s *subscription) processNewEvents(ctx context.Context) error {
@@ -211,11 +211,13 @@ func (s *subscription) processNewEvents(ctx context.Context) error {
 		rpcMethod = "eth_getFilterChanges"
 	}
 	if err := s.rpc.CallContext(ctx, &logs, rpcMethod, s.filterID); err != nil {
+		s.lp.markPolled(err)
 		if strings.Contains(err.Error(), "filter not found") {
 			s.markFilterStale(ctx, true)
 		}
 		return err
 	}
+	s.lp.markPolled(nil)
 	if len(logs) > 0 {
 		// Only log if we received at least one event
 		log.Debugf("%s: received %d events (%s)", s.logName, len(logs), rpcMethod)
@@ -224,8 +226,10 @@ func (s *subscription) processNewEvents(ctx context.Context) error {
 		if s.lp.stream.spec.Timestamps {
 			s.getEventTimestamp(context.Background(), logEntry)
 		}
+		s.lp.markMatched(logEntry)
 		if err := s.lp.processLogEntry(s.logName, logEntry, idx); err != nil {
 			log.Errorf("Failed to process event: %s", err)
+			s.lp.markDecodeFailure(err)
 		}
 	}
 	s.filteredOnce = true
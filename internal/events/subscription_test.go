@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"math/big"
 	"testing"
+	"time"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/eth"
@@ -33,6 +34,7 @@ type mockSubMgr struct {
 	subscription  *subscription
 	err           error
 	subscriptions []*subscription
+	registrar     ContractRegistrar
 }
 
 func (m *mockSubMgr) config() *SubscriptionManagerConf {
@@ -43,6 +45,16 @@ func (m *mockSubMgr) streamByID(string) (*eventStream, error) {
 	return m.stream, m.err
 }
 
+func (m *mockSubMgr) blockTimestamps() *eth.BlockTimestampCache { return nil }
+
+func (m *mockSubMgr) contractRegistrar() ContractRegistrar {
+	return m.registrar
+}
+
+func (m *mockSubMgr) contractRegistrations() ContractRegistrar {
+	return m.registrar
+}
+
 func (m *mockSubMgr) subscriptionByID(string) (*subscription, error) {
 	return m.subscription, m.err
 }
@@ -55,6 +67,14 @@ func (m *mockSubMgr) loadCheckpoint(string) (map[string]*big.Int, error) { retur
 
 func (m *mockSubMgr) storeCheckpoint(string, map[string]*big.Int) error { return nil }
 
+func (m *mockSubMgr) storeDeadLetter(string, []*eventData, error) {}
+
+func (m *mockSubMgr) storeOversizedEvent(string, string, int, *eventData) error { return m.err }
+
+func (m *mockSubMgr) recordWebhookDelivery(string, string, time.Duration, int, error) {}
+
+func (m *mockSubMgr) storeStream(spec *StreamInfo) (*StreamInfo, error) { return spec, nil }
+
 func newTestStream() *eventStream {
 	a, _ := newEventStream(newTestSubscriptionManager(), &StreamInfo{
 		ID:   "123",
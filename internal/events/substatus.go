@@ -0,0 +1,76 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// SubscriptionStatus reports the progress of a subscription, so a subscription that has not
+// seen any events can be told apart from one that is failing. Apart from the checkpoint, the
+// status is held in memory since the subscription was created or recovered
+type SubscriptionStatus struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Stream             string `json:"stream"`
+	StreamSuspended    bool   `json:"streamSuspended"`
+	Checkpoint         string `json:"checkpoint"`
+	LatestMatchedBlock string `json:"latestMatchedBlock,omitempty"`
+	LastDelivered      string `json:"lastDelivered,omitempty"`
+	LastPolled         string `json:"lastPolled,omitempty"`
+	PollError          string `json:"pollError,omitempty"`
+	DecodeFailures     uint64 `json:"decodeFailures"`
+	LastDecodeError    string `json:"lastDecodeError,omitempty"`
+}
+
+// SubscriptionStatus returns the status of a subscription
+func (s *subscriptionMGR) SubscriptionStatus(ctx context.Context, id string) (*SubscriptionStatus, error) {
+	sub, err := s.subscriptionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return sub.status(), nil
+}
+
+func (s *subscription) status() *SubscriptionStatus {
+	lp := s.lp
+	lp.stream.batchCond.L.Lock()
+	suspended := lp.stream.spec.Suspended
+	lp.stream.batchCond.L.Unlock()
+
+	lp.hwnSync.Lock()
+	defer lp.hwnSync.Unlock()
+	status := &SubscriptionStatus{
+		ID:              s.info.ID,
+		Name:            s.info.Name,
+		Stream:          s.info.Stream,
+		StreamSuspended: suspended,
+		Checkpoint:      lp.blockHWM.String(),
+		PollError:       lp.pollError,
+		DecodeFailures:  lp.decodeFailures,
+		LastDecodeError: lp.lastDecodeError,
+	}
+	if lp.matchedBlock.Sign() > 0 {
+		status.LatestMatchedBlock = lp.matchedBlock.String()
+	}
+	if !lp.lastDelivered.IsZero() {
+		status.LastDelivered = lp.lastDelivered.Format(time.RFC3339Nano)
+	}
+	if !lp.lastPolled.IsZero() {
+		status.LastPolled = lp.lastPolled.Format(time.RFC3339Nano)
+	}
+	return status
+}
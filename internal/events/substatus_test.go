@@ -0,0 +1,78 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionStatus(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, sub := newTestIdleSubscriptionManager(t)
+	defer sm.Close()
+	ctx := context.Background()
+
+	status, err := sm.SubscriptionStatus(ctx, sub.ID)
+	assert.NoError(err)
+	assert.Equal(sub.ID, status.ID)
+	assert.Equal("sub1", status.Name)
+	assert.Equal(stream.ID, status.Stream)
+	assert.Empty(status.LatestMatchedBlock)
+	assert.Empty(status.LastDelivered)
+	assert.Zero(status.DecodeFailures)
+	assert.False(status.StreamSuspended)
+
+	// Stop the stream polling, so only the updates below are recorded
+	sm.SuspendStream(ctx, stream.ID)
+	for !sm.streams[stream.ID].isStopped() {
+		time.Sleep(time.Millisecond)
+	}
+
+	lp := sm.subscriptions[sub.ID].lp
+	lp.markPolled(fmt.Errorf("pop"))
+	status, _ = sm.SubscriptionStatus(ctx, sub.ID)
+	assert.NotEmpty(status.LastPolled)
+	assert.Equal("pop", status.PollError)
+
+	lp.markPolled(nil)
+	lp.markMatched(&logEntry{BlockNumber: ethbinding.HexBigInt(*big.NewInt(12))})
+	lp.markMatched(&logEntry{BlockNumber: ethbinding.HexBigInt(*big.NewInt(10))})
+	lp.markDecodeFailure(fmt.Errorf("bad data"))
+	lp.batchComplete(&eventData{BlockNumber: "10"})
+	status, _ = sm.SubscriptionStatus(ctx, sub.ID)
+	assert.Empty(status.PollError)
+	assert.Equal("12", status.LatestMatchedBlock)
+	assert.Equal("11", status.Checkpoint)
+	assert.NotEmpty(status.LastDelivered)
+	assert.Equal(uint64(1), status.DecodeFailures)
+	assert.Equal("bad data", status.LastDecodeError)
+	assert.True(status.StreamSuspended)
+}
+
+func TestSubscriptionStatusNotFound(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+
+	_, err := sm.SubscriptionStatus(context.Background(), "badid")
+	assert.EqualError(err, "Subscription with ID 'badid' not found")
+}
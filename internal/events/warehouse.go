@@ -0,0 +1,396 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// WarehouseWriterBigQuery loads events into a BigQuery table, with streaming inserts
+	WarehouseWriterBigQuery = "bigquery"
+
+	defaultBigQueryURL = "https://bigquery.googleapis.com/bigquery/v2"
+
+	// redactedSecret replaces the secrets of a stream in the responses of the API
+	redactedSecret = "******"
+)
+
+// WarehouseActionInfo configures a stream that loads each batch of events into a table of a
+// data warehouse. Writer selects how the rows are loaded, which is BigQuery by default, and
+// Options are passed to writers registered with RegisterWarehouseWriter. BigQuery authenticates
+// with ServiceAccount, or the Application Default Credentials of the gateway, while Auth is for
+// the writers of other warehouses
+type WarehouseActionInfo struct {
+	Writer            string                   `json:"writer,omitempty"`
+	URL               string                   `json:"url,omitempty"` // API endpoint, such as an emulator (default is the public endpoint of the writer)
+	Project           string                   `json:"project,omitempty"`
+	Dataset           string                   `json:"dataset,omitempty"`
+	Table             string                   `json:"table"`
+	Auth              *webhookAuthInfo         `json:"auth,omitempty"`
+	ServiceAccount    *googleServiceAccountKey `json:"serviceAccount,omitempty"`
+	ProxyURL          string                   `json:"proxyURL,omitempty"`
+	TLSkipHostVerify  bool                     `json:"tlsSkipHostVerify,omitempty"`
+	RequestTimeoutSec uint32                   `json:"requestTimeoutSec,omitempty"`
+	Options           map[string]string        `json:"options,omitempty"`
+}
+
+// WarehouseRow is an event flattened into the columns of a warehouse table. The decoded
+// parameters differ between the events of a stream, so are a single JSON column. InsertID
+// identifies the event, so a warehouse that de-duplicates inserts drops a redelivery
+type WarehouseRow struct {
+	InsertID         string `json:"-"`
+	SubID            string `json:"sub_id"`
+	Signature        string `json:"signature"`
+	Address          string `json:"address"`
+	BlockNumber      string `json:"block_number"`
+	TransactionHash  string `json:"transaction_hash"`
+	TransactionIndex string `json:"transaction_index"`
+	LogIndex         string `json:"log_index"`
+	Timestamp        string `json:"timestamp,omitempty"`
+	Data             string `json:"data"`
+}
+
+// WarehouseWriter loads the rows of a batch into the warehouse. An error fails the batch,
+// which is retried or skipped according to the error handling of the stream
+type WarehouseWriter interface {
+	WriteRows(ctx context.Context, rows []*WarehouseRow) error
+}
+
+// WarehouseRequestFunc sends an HTTP request to the warehouse, using the proxy, TLS, timeout
+// and authentication settings of the stream
+type WarehouseRequestFunc func(req *http.Request) (*http.Response, error)
+
+// WarehouseWriterFactory builds the writer for the warehouse settings of a stream
+type WarehouseWriterFactory func(spec *WarehouseActionInfo, do WarehouseRequestFunc) (WarehouseWriter, error)
+
+var warehouseWriters = struct {
+	sync.RWMutex
+	factories map[string]WarehouseWriterFactory
+}{
+	factories: map[string]WarehouseWriterFactory{
+		WarehouseWriterBigQuery: newBigQueryWriter,
+	},
+}
+
+// RegisterWarehouseWriter adds a writer, for loading events into another data warehouse
+func RegisterWarehouseWriter(name string, factory WarehouseWriterFactory) {
+	warehouseWriters.Lock()
+	defer warehouseWriters.Unlock()
+	warehouseWriters.factories[strings.ToLower(name)] = factory
+}
+
+func (spec *WarehouseActionInfo) writerName() string {
+	if spec.Writer == "" {
+		return WarehouseWriterBigQuery
+	}
+	return strings.ToLower(spec.Writer)
+}
+
+func warehouseWriterFactory(spec *WarehouseActionInfo) (WarehouseWriterFactory, error) {
+	name := spec.writerName()
+	warehouseWriters.RLock()
+	defer warehouseWriters.RUnlock()
+	factory, ok := warehouseWriters.factories[name]
+	if !ok {
+		return nil, errors.Errorf(errors.EventStreamsWarehouseUnknownWriter, spec.Writer)
+	}
+	return factory, nil
+}
+
+func validateWarehouse(spec *WarehouseActionInfo) error {
+	if spec == nil || spec.Table == "" {
+		return errors.Errorf(errors.EventStreamsWarehouseNoTable)
+	}
+	if _, err := warehouseWriterFactory(spec); err != nil {
+		return err
+	}
+	if spec.URL != "" {
+		if u, err := url.Parse(spec.URL); err != nil || !u.IsAbs() {
+			return errors.Errorf(errors.EventStreamsWarehouseInvalidURL, spec.URL)
+		}
+	}
+	if _, err := utils.ProxyFunc(spec.ProxyURL); err != nil {
+		return err
+	}
+	if spec.writerName() == WarehouseWriterBigQuery {
+		// BigQuery only accepts Google access tokens, so a static token or another OAuth2 server
+		// cannot be used, and would be sent to Google if configured
+		if spec.Auth != nil {
+			return errors.Errorf(errors.EventStreamsWarehouseBigQueryAuth)
+		}
+		if spec.ServiceAccount != nil {
+			return spec.ServiceAccount.validate()
+		}
+		return nil
+	}
+	return validateWebhookAuth(spec.Auth)
+}
+
+// redacted returns a copy of the settings with the secrets masked, for the responses of the API
+func (spec *WarehouseActionInfo) redacted() *WarehouseActionInfo {
+	r := *spec
+	r.Auth = spec.Auth.redacted()
+	if spec.ServiceAccount != nil && spec.ServiceAccount.PrivateKey != "" {
+		sa := *spec.ServiceAccount
+		sa.PrivateKey = redactedSecret
+		r.ServiceAccount = &sa
+	}
+	return &r
+}
+
+// keepRedactedSecrets restores the current secrets into an update that has them masked, so
+// settings read from the API can be written back without re-entering the credentials
+func (spec *WarehouseActionInfo) keepRedactedSecrets(current *WarehouseActionInfo) {
+	spec.Auth.keepRedactedSecrets(current.Auth)
+	if spec.ServiceAccount != nil && spec.ServiceAccount.PrivateKey == redactedSecret && current.ServiceAccount != nil {
+		spec.ServiceAccount.PrivateKey = current.ServiceAccount.PrivateKey
+	}
+}
+
+type warehouseAction struct {
+	es     *eventStream
+	ctx    context.Context
+	cancel func()
+	mux    sync.Mutex
+	// The HTTP client and authentication of webhooks are re-used, to send requests to the warehouse
+	transport webhookAction
+	writer    WarehouseWriter
+	writerFor WarehouseActionInfo
+}
+
+func newWarehouseAction(es *eventStream, spec *WarehouseActionInfo) (*warehouseAction, error) {
+	if err := validateWarehouse(spec); err != nil {
+		return nil, err
+	}
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = 120
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &warehouseAction{
+		es:        es,
+		ctx:       ctx,
+		cancel:    cancel,
+		transport: webhookAction{es: es},
+	}, nil
+}
+
+// stop cancels any insert in progress, as the stream has stopped
+func (w *warehouseAction) stop() {
+	w.cancel()
+}
+
+// currentWriter returns the writer for the current spec of the stream, building a new one
+// when the warehouse settings have been updated
+func (w *warehouseAction) currentWriter() (WarehouseWriter, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	spec := w.es.spec.Warehouse
+	if w.writer != nil && reflect.DeepEqual(w.writerFor, *spec) {
+		return w.writer, nil
+	}
+	factory, err := warehouseWriterFactory(spec)
+	if err != nil {
+		return nil, err
+	}
+	if w.writer, err = factory(spec, w.do); err != nil {
+		return nil, err
+	}
+	w.writerFor = *spec
+	return w.writer, nil
+}
+
+// do sends a request to the warehouse, excluding private IP address ranges as for webhooks
+func (w *warehouseAction) do(req *http.Request) (*http.Response, error) {
+	addr, err := net.ResolveIPAddr("ip4", req.URL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	if w.es.isAddressUnsafe(addr) {
+		return nil, errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, req.URL.Hostname())
+	}
+	w.mux.Lock()
+	spec := w.es.spec.Warehouse
+	w.transport.spec = &webhookActionInfo{
+		URL:               req.URL.String(),
+		Auth:              spec.Auth,
+		ProxyURL:          spec.ProxyURL,
+		TLSkipHostVerify:  spec.TLSkipHostVerify,
+		RequestTimeoutSec: spec.RequestTimeoutSec,
+	}
+	client := w.transport.httpClient()
+	authorization, err := w.transport.authorization(client)
+	w.mux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res, err := client.Do(req)
+	if err == nil && res.StatusCode == http.StatusUnauthorized {
+		// The token might have been revoked, so the retry gets a new one
+		w.transport.tokens.invalidate()
+	}
+	return res, err
+}
+
+func warehouseRows(events []*eventData) []*WarehouseRow {
+	rows := make([]*WarehouseRow, len(events))
+	for i, event := range events {
+		data, _ := json.Marshal(event.Data)
+		rows[i] = &WarehouseRow{
+			InsertID:         event.DedupKey,
+			SubID:            event.SubID,
+			Signature:        event.Signature,
+			Address:          event.Address,
+			BlockNumber:      event.BlockNumber,
+			TransactionHash:  event.TransactionHash,
+			TransactionIndex: event.TransactionIndex,
+			LogIndex:         event.LogIndex,
+			Timestamp:        event.Timestamp,
+			Data:             string(data),
+		}
+	}
+	return rows
+}
+
+// attemptBatch loads the batch into the warehouse table as one insert
+func (w *warehouseAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
+	esID := w.es.spec.ID
+	table := w.es.spec.Warehouse.Table
+	writer, err := w.currentWriter()
+	if err == nil {
+		log.Infof("%s: Loading %d events into warehouse table '%s' (batch=%d attempt=%d)", esID, len(events), table, batchNumber, attempt)
+		err = writer.WriteRows(w.ctx, warehouseRows(events))
+	}
+	if err != nil {
+		err = errors.Errorf(errors.EventStreamsWarehouseWriteFailed, esID, len(events), table, err)
+		log.Errorf(err.Error())
+	}
+	return err
+}
+
+type bigQueryWriter struct {
+	url string
+	do  WarehouseRequestFunc
+	// tokens is nil for a custom endpoint without a service account, such as an emulator
+	tokens *googleTokenSource
+}
+
+type bigQueryInsertRow struct {
+	InsertID string        `json:"insertId,omitempty"`
+	JSON     *WarehouseRow `json:"json"`
+}
+
+type bigQueryInsertAll struct {
+	Rows []*bigQueryInsertRow `json:"rows"`
+}
+
+type bigQueryInsertAllResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+func newBigQueryWriter(spec *WarehouseActionInfo, do WarehouseRequestFunc) (WarehouseWriter, error) {
+	if spec.Project == "" || spec.Dataset == "" {
+		return nil, errors.Errorf(errors.EventStreamsWarehouseBigQueryIncomplete)
+	}
+	baseURL := spec.URL
+	var tokens *googleTokenSource
+	switch {
+	case spec.ServiceAccount != nil:
+		tokens = &googleTokenSource{key: spec.ServiceAccount, scope: bigQueryScope}
+	case baseURL == "":
+		// The credentials of the gateway are only used for the public endpoint, so they cannot
+		// be sent to another server by setting the URL of a stream
+		tokens = &googleTokenSource{scope: bigQueryScope}
+	}
+	if baseURL == "" {
+		baseURL = defaultBigQueryURL
+	}
+	return &bigQueryWriter{
+		url: fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s/insertAll", strings.TrimSuffix(baseURL, "/"),
+			url.PathEscape(spec.Project), url.PathEscape(spec.Dataset), url.PathEscape(spec.Table)),
+		do:     do,
+		tokens: tokens,
+	}, nil
+}
+
+// WriteRows streams the rows into the table with tabledata.insertAll. BigQuery accepts the
+// valid rows of a request even if others are rejected, so any rejection fails the batch and
+// the retry relies on the insert IDs to avoid duplicating the rows already accepted
+func (b *bigQueryWriter) WriteRows(ctx context.Context, rows []*WarehouseRow) error {
+	insert := &bigQueryInsertAll{Rows: make([]*bigQueryInsertRow, len(rows))}
+	for i, row := range rows {
+		insert.Rows[i] = &bigQueryInsertRow{InsertID: row.InsertID, JSON: row}
+	}
+	reqBytes, _ := json.Marshal(insert)
+	req, err := http.NewRequestWithContext(ctx, "POST", b.url, bytes.NewReader(reqBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.tokens != nil {
+		token, err := b.tokens.accessToken(ctx, b.do)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := b.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized && b.tokens != nil {
+		b.tokens.invalidate()
+	}
+	resBytes, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.EventStreamsWarehouseHTTPStatus, res.StatusCode, string(resBytes))
+	}
+	var insertRes bigQueryInsertAllResponse
+	if err := json.Unmarshal(resBytes, &insertRes); err != nil {
+		return errors.Errorf(errors.EventStreamsWarehouseBadResponse, err)
+	}
+	if len(insertRes.InsertErrors) > 0 {
+		detail := ""
+		if first := insertRes.InsertErrors[0]; len(first.Errors) > 0 {
+			detail = fmt.Sprintf("row %d: %s", first.Index, first.Errors[0].Message)
+		}
+		return errors.Errorf(errors.EventStreamsWarehouseRowsRejected, len(insertRes.InsertErrors), len(rows), detail)
+	}
+	return nil
+}
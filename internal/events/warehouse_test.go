@@ -0,0 +1,329 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bigQueryRequest struct {
+	path          string
+	authorization string
+	body          bigQueryInsertAll
+}
+
+func newTestBigQueryServer(status int, response string) (*httptest.Server, chan *bigQueryRequest) {
+	requests := make(chan *bigQueryRequest, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		r := &bigQueryRequest{path: req.URL.Path, authorization: req.Header.Get("Authorization")}
+		b, _ := ioutil.ReadAll(req.Body)
+		json.Unmarshal(b, &r.body)
+		requests <- r
+		res.WriteHeader(status)
+		res.Write([]byte(response))
+	}))
+	return ts, requests
+}
+
+func newTestWarehouseStream(t *testing.T, spec *WarehouseActionInfo) (*subscriptionMGR, *eventStream) {
+	sm := newTestSubscriptionManager()
+	stream, err := sm.AddStream(context.Background(), &StreamInfo{
+		Type:      "warehouse",
+		Warehouse: spec,
+	})
+	assert.NoError(t, err)
+	return sm, sm.streams[stream.ID]
+}
+
+func TestWarehouseStreamBigQueryInsert(t *testing.T) {
+	assert := assert.New(t)
+
+	ts, requests := newTestBigQueryServer(200, `{"kind":"bigquery#tableDataInsertAllResponse"}`)
+	defer ts.Close()
+	key, tokenServer, issued := newTestServiceAccount(t)
+	defer tokenServer.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{
+		URL:            ts.URL + "/bigquery/v2/",
+		Project:        "analytics",
+		Dataset:        "chain",
+		Table:          "transfers",
+		ServiceAccount: key,
+	})
+	defer sm.Close()
+
+	event := testTransferEvent("k1", "0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", "1000")
+	event.BlockNumber = "12345"
+	err := stream.action.attemptBatch(1, 1, []*eventData{event})
+	assert.NoError(err)
+
+	req := <-requests
+	assert.Equal("/bigquery/v2/projects/analytics/datasets/chain/tables/transfers/insertAll", req.path)
+	assert.Equal("Bearer sa-token", req.authorization)
+	assert.Len(req.body.Rows, 1)
+	assert.Equal("k1", req.body.Rows[0].InsertID)
+	row := req.body.Rows[0].JSON
+	assert.Equal("Transfer(address,address,uint256)", row.Signature)
+	assert.Equal("12345", row.BlockNumber)
+	assert.JSONEq(`{"to":"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c","value":"1000"}`, row.Data)
+
+	// The token is cached for the next batch
+	err = stream.action.attemptBatch(2, 1, []*eventData{event})
+	assert.NoError(err)
+	assert.Equal("Bearer sa-token", (<-requests).authorization)
+	assert.Equal(1, *issued)
+}
+
+func TestWarehouseStreamBigQueryTokenRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	ts, requests := newTestBigQueryServer(401, `{"error":"invalid token"}`)
+	defer ts.Close()
+	key, tokenServer, issued := newTestServiceAccount(t)
+	defer tokenServer.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t", ServiceAccount: key})
+	defer sm.Close()
+
+	for i := 0; i < 2; i++ {
+		err := stream.action.attemptBatch(1, uint64(i+1), []*eventData{testTransferEvent("k1", "0x00", "1")})
+		assert.Regexp("Warehouse returned status 401", err)
+		<-requests
+	}
+	// The rejected token is not re-used
+	assert.Equal(2, *issued)
+}
+
+func TestWarehouseStreamBigQueryTokenFailure(t *testing.T) {
+	ts, _ := newTestBigQueryServer(200, `{}`)
+	defer ts.Close()
+	key, tokenServer, _ := newTestServiceAccount(t)
+	tokenServer.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t", ServiceAccount: key})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.Regexp(t, "Failed to get a Google Cloud access token", err)
+}
+
+func TestBigQueryWriterDefaultCredentials(t *testing.T) {
+	assert := assert.New(t)
+
+	// The credentials of the gateway are used for the public endpoint only
+	w, err := newBigQueryWriter(&WarehouseActionInfo{Project: "p", Dataset: "d", Table: "t"}, nil)
+	assert.NoError(err)
+	assert.NotNil(w.(*bigQueryWriter).tokens)
+	assert.Nil(w.(*bigQueryWriter).tokens.key)
+	w, err = newBigQueryWriter(&WarehouseActionInfo{URL: "http://localhost:9050", Project: "p", Dataset: "d", Table: "t"}, nil)
+	assert.NoError(err)
+	assert.Nil(w.(*bigQueryWriter).tokens)
+}
+
+func TestWarehouseStreamSecretsRedacted(t *testing.T) {
+	assert := assert.New(t)
+
+	ts, requests := newTestBigQueryServer(200, `{}`)
+	defer ts.Close()
+	key, tokenServer, _ := newTestServiceAccount(t)
+	defer tokenServer.Close()
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+	ctx := context.Background()
+	created, err := sm.AddStream(ctx, &StreamInfo{
+		Type:      "warehouse",
+		Warehouse: &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t1", ServiceAccount: key},
+	})
+	assert.NoError(err)
+	assert.Equal("******", created.Warehouse.ServiceAccount.PrivateKey)
+	assert.Equal(key.ClientEmail, created.Warehouse.ServiceAccount.ClientEmail)
+	read, err := sm.StreamByID(ctx, created.ID)
+	assert.NoError(err)
+	assert.Equal("******", read.Warehouse.ServiceAccount.PrivateKey)
+	assert.Equal("******", sm.Streams(ctx)[0].Warehouse.ServiceAccount.PrivateKey)
+
+	// Writing back the settings as read keeps the key
+	read.Warehouse.Table = "t2"
+	updated, err := sm.UpdateStream(ctx, created.ID, read)
+	assert.NoError(err)
+	assert.Equal("******", updated.Warehouse.ServiceAccount.PrivateKey)
+	stream := sm.streams[created.ID]
+	assert.Equal(key.PrivateKey, stream.spec.Warehouse.ServiceAccount.PrivateKey)
+	err = stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.NoError(err)
+	req := <-requests
+	assert.Equal("/projects/p/datasets/d/tables/t2/insertAll", req.path)
+	assert.Equal("Bearer sa-token", req.authorization)
+}
+
+func TestWarehouseAuthRedacted(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &WarehouseActionInfo{
+		Writer: "other",
+		Auth: &webhookAuthInfo{
+			BearerToken: "t0ken",
+			OAuth2:      &webhookOAuth2Info{ClientID: "c1", ClientSecret: "s3cret"},
+		},
+	}
+	redacted := spec.redacted()
+	assert.Equal("******", redacted.Auth.BearerToken)
+	assert.Equal("******", redacted.Auth.OAuth2.ClientSecret)
+	assert.Equal("c1", redacted.Auth.OAuth2.ClientID)
+	assert.Equal("t0ken", spec.Auth.BearerToken)
+	assert.Equal("s3cret", spec.Auth.OAuth2.ClientSecret)
+
+	redacted.keepRedactedSecrets(spec)
+	assert.Equal(spec, redacted)
+}
+
+func TestWarehouseStreamStopCancelsInsert(t *testing.T) {
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: "http://localhost:9050", Project: "p", Dataset: "d", Table: "t"})
+	defer sm.Close()
+
+	stream.action.(*warehouseAction).stop()
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.Regexp(t, "context canceled", err)
+}
+
+func TestWarehouseStreamRowsRejected(t *testing.T) {
+	ts, _ := newTestBigQueryServer(200, `{"insertErrors":[{"index":0,"errors":[{"reason":"invalid","message":"no such field: sub_id"}]}]}`)
+	defer ts.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t"})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.Regexp(t, "Warehouse rejected 1 of 1 rows. First error row 0: no such field: sub_id", err)
+}
+
+func TestWarehouseStreamHTTPFailure(t *testing.T) {
+	ts, _ := newTestBigQueryServer(403, `{"error":"denied"}`)
+	defer ts.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t"})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.Regexp(t, "Loading 1 events into warehouse table 't' failed: Warehouse returned status 403", err)
+}
+
+func TestWarehouseStreamBadResponse(t *testing.T) {
+	ts, _ := newTestBigQueryServer(200, `!json`)
+	defer ts.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t"})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.Regexp(t, "Invalid response from warehouse", err)
+}
+
+func TestWarehouseStreamPrivateAddress(t *testing.T) {
+	ts, _ := newTestBigQueryServer(200, `{}`)
+	defer ts.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t"})
+	defer sm.Close()
+	stream.allowPrivateIPs = false
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.Regexp(t, "Cannot send Webhook POST to address", err)
+}
+
+type mockWarehouseWriter struct {
+	options map[string]string
+	rows    []*WarehouseRow
+}
+
+func (m *mockWarehouseWriter) WriteRows(ctx context.Context, rows []*WarehouseRow) error {
+	m.rows = append(m.rows, rows...)
+	return nil
+}
+
+func TestWarehouseStreamRegisteredWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	writer := &mockWarehouseWriter{}
+	RegisterWarehouseWriter("Mock", func(spec *WarehouseActionInfo, do WarehouseRequestFunc) (WarehouseWriter, error) {
+		writer.options = spec.Options
+		return writer, nil
+	})
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{
+		Writer:  "mock",
+		Table:   "events",
+		Options: map[string]string{"warehouse": "snowflake"},
+	})
+	defer sm.Close()
+
+	err := stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1"), testTransferEvent("k2", "0x00", "2")})
+	assert.NoError(err)
+	assert.Len(writer.rows, 2)
+	assert.Equal("k2", writer.rows[1].InsertID)
+	assert.Equal(map[string]string{"warehouse": "snowflake"}, writer.options)
+}
+
+func TestWarehouseStreamValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	RegisterWarehouseWriter("validation", func(spec *WarehouseActionInfo, do WarehouseRequestFunc) (WarehouseWriter, error) {
+		return &mockWarehouseWriter{}, nil
+	})
+	sm := newTestSubscriptionManager()
+	defer sm.Close()
+	for spec, msg := range map[*WarehouseActionInfo]string{
+		nil:                              "Must specify warehouse.table",
+		{Table: "t", Writer: "unknown"}:  "Unknown warehouse writer 'unknown'",
+		{Table: "t", URL: "not a url"}:   "Invalid warehouse URL",
+		{Table: "t", ProxyURL: "://bad"}: "Invalid proxy URL",
+		{Table: "t", Project: "p"}:       "Must specify warehouse.project and warehouse.dataset",
+		{Table: "t", Writer: "validation", Auth: &webhookAuthInfo{BearerToken: "a", OAuth2: &webhookOAuth2Info{}}}: "Specify only one of",
+		{Table: "t", Auth: &webhookAuthInfo{BearerToken: "a"}}:                                                     "The bigquery writer does not support warehouse.auth",
+		{Table: "t", ServiceAccount: &googleServiceAccountKey{}}:                                                   "Invalid warehouse.serviceAccount key: client_email is required",
+		{Table: "t", ServiceAccount: &googleServiceAccountKey{ClientEmail: "a@b", PrivateKey: "nope"}}:             "Invalid warehouse.serviceAccount key: private_key is not PEM encoded",
+		{Table: "t", ServiceAccount: &googleServiceAccountKey{ClientEmail: "a@b", TokenURI: "/token"}}:             "token_uri is not an absolute URL",
+	} {
+		stream, err := sm.AddStream(context.Background(), &StreamInfo{Type: "warehouse", Warehouse: spec})
+		if err == nil {
+			// The BigQuery settings are checked when the first batch is loaded
+			err = sm.streams[stream.ID].action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+		}
+		assert.Regexp(msg, err)
+	}
+}
+
+func TestWarehouseStreamUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	ts, requests := newTestBigQueryServer(200, `{}`)
+	defer ts.Close()
+	sm, stream := newTestWarehouseStream(t, &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t1"})
+	defer sm.Close()
+
+	_, err := sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Warehouse: &WarehouseActionInfo{Project: "p", Dataset: "d"},
+	})
+	assert.Regexp("Must specify warehouse.table", err)
+
+	_, err = sm.UpdateStream(context.Background(), stream.spec.ID, &StreamInfo{
+		Warehouse: &WarehouseActionInfo{URL: ts.URL, Project: "p", Dataset: "d", Table: "t2"},
+	})
+	assert.NoError(err)
+	assert.Equal(uint32(120), stream.spec.Warehouse.RequestTimeoutSec)
+
+	err = stream.action.attemptBatch(1, 1, []*eventData{testTransferEvent("k1", "0x00", "1")})
+	assert.NoError(err)
+	assert.Equal("/projects/p/datasets/d/tables/t2/insertAll", (<-requests).path)
+}
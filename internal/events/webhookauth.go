@@ -0,0 +1,203 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// oauth2ExpiryMargin is how long before it expires that an access token is refreshed,
+// so a token does not expire while a batch is in flight
+const oauth2ExpiryMargin = 30 * time.Second
+
+// webhookAuthInfo authenticates the deliveries of a webhook stream to a protected receiver,
+// with either a static bearer token or an OAuth2 client credentials grant
+type webhookAuthInfo struct {
+	BearerToken string             `json:"bearerToken,omitempty"`
+	OAuth2      *webhookOAuth2Info `json:"oauth2,omitempty"`
+}
+
+type webhookOAuth2Info struct {
+	TokenURL     string   `json:"tokenURL,omitempty"`
+	ClientID     string   `json:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+	Audience     string   `json:"audience,omitempty"`
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// webhookTokenCache holds the access token for the OAuth2 configuration of a stream,
+// until it expires or the receiver rejects it
+type webhookTokenCache struct {
+	lock      sync.Mutex
+	tokenFor  webhookOAuth2Info
+	token     string
+	expiresAt time.Time
+}
+
+// redacted returns a copy of the settings with the secrets masked, for the responses of the API
+func (auth *webhookAuthInfo) redacted() *webhookAuthInfo {
+	if auth == nil {
+		return nil
+	}
+	r := *auth
+	if r.BearerToken != "" {
+		r.BearerToken = redactedSecret
+	}
+	if auth.OAuth2 != nil && auth.OAuth2.ClientSecret != "" {
+		oauth2 := *auth.OAuth2
+		oauth2.ClientSecret = redactedSecret
+		r.OAuth2 = &oauth2
+	}
+	return &r
+}
+
+// keepRedactedSecrets restores the current secrets into an update that has them masked
+func (auth *webhookAuthInfo) keepRedactedSecrets(current *webhookAuthInfo) {
+	if auth == nil || current == nil {
+		return
+	}
+	if auth.BearerToken == redactedSecret {
+		auth.BearerToken = current.BearerToken
+	}
+	if auth.OAuth2 != nil && auth.OAuth2.ClientSecret == redactedSecret && current.OAuth2 != nil {
+		auth.OAuth2.ClientSecret = current.OAuth2.ClientSecret
+	}
+}
+
+func validateWebhookAuth(auth *webhookAuthInfo) error {
+	if auth == nil {
+		return nil
+	}
+	if auth.BearerToken != "" && auth.OAuth2 != nil {
+		return errors.Errorf(errors.EventStreamsWebhookAuthConflict)
+	}
+	if auth.OAuth2 != nil {
+		u, err := url.Parse(auth.OAuth2.TokenURL)
+		if err != nil || !u.IsAbs() || auth.OAuth2.ClientID == "" {
+			return errors.Errorf(errors.EventStreamsWebhookOAuth2Invalid)
+		}
+	}
+	return nil
+}
+
+// authorization returns the Authorization header for a delivery, or an empty string if the
+// stream does not authenticate its deliveries
+func (w *webhookAction) authorization(client *http.Client) (string, error) {
+	auth := w.spec.Auth
+	switch {
+	case auth == nil:
+		return "", nil
+	case auth.OAuth2 != nil:
+		token, err := w.tokens.accessToken(w.es, client, auth.OAuth2)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	case auth.BearerToken != "":
+		return "Bearer " + auth.BearerToken, nil
+	default:
+		return "", nil
+	}
+}
+
+// invalidate discards the cached token, so the next delivery gets a new one
+func (c *webhookTokenCache) invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.token = ""
+}
+
+func (c *webhookTokenCache) accessToken(es *eventStream, client *http.Client, conf *webhookOAuth2Info) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.token != "" && reflect.DeepEqual(c.tokenFor, *conf) && (c.expiresAt.IsZero() || time.Now().Before(c.expiresAt)) {
+		return c.token, nil
+	}
+
+	esID := es.spec.ID
+	tokenErr := func(err interface{}) error {
+		return errors.Errorf(errors.EventStreamsWebhookOAuth2TokenFailed, esID, utils.RedactURL(conf.TokenURL), utils.RedactText(fmt.Sprint(err)))
+	}
+	// The token endpoint is subject to the same address restrictions as the webhook itself
+	u, _ := url.Parse(conf.TokenURL)
+	addr, err := net.ResolveIPAddr("ip4", u.Hostname())
+	if err != nil {
+		return "", tokenErr(err)
+	}
+	if es.isAddressUnsafe(addr) {
+		return "", errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, u.Hostname())
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(conf.Scopes) > 0 {
+		form.Set("scope", strings.Join(conf.Scopes, " "))
+	}
+	if conf.Audience != "" {
+		form.Set("audience", conf.Audience)
+	}
+	req, err := http.NewRequest("POST", conf.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", tokenErr(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(conf.ClientID), url.QueryEscape(conf.ClientSecret))
+	log.Infof("%s: POST --> %s [%s] (oauth2 token)", esID, utils.RedactURL(conf.TokenURL), addr.String())
+	res, err := client.Do(req)
+	if err != nil {
+		return "", tokenErr(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	log.Infof("%s: POST <-- %s [%d] (oauth2 token)", esID, utils.RedactURL(conf.TokenURL), res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", tokenErr(fmt.Sprintf("status=%d", res.StatusCode))
+	}
+	var tokenRes oauth2TokenResponse
+	if err := json.Unmarshal(body, &tokenRes); err != nil {
+		return "", tokenErr(err)
+	}
+	if tokenRes.AccessToken == "" {
+		return "", tokenErr("no access_token in response")
+	}
+
+	c.tokenFor = *conf
+	c.token = tokenRes.AccessToken
+	c.expiresAt = time.Time{}
+	if tokenRes.ExpiresIn > 0 {
+		c.expiresAt = time.Now().Add(time.Duration(tokenRes.ExpiresIn)*time.Second - oauth2ExpiryMargin)
+	}
+	return c.token, nil
+}
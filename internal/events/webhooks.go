@@ -18,20 +18,59 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
+	"github.com/kaleido-io/ethconnect/internal/chaos"
 	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// DefaultWebhookMaxIdleConns is the default maximum number of idle connections kept open across all webhook targets of a stream
+	DefaultWebhookMaxIdleConns = 100
+	// DefaultWebhookMaxIdleConnsPerHost is the default maximum number of idle connections kept open to each webhook target
+	DefaultWebhookMaxIdleConnsPerHost = 100
+	// DefaultWebhookIdleConnTimeoutSec is the default time an idle connection is kept open
+	DefaultWebhookIdleConnTimeoutSec = 90
+	// DefaultWebhookKeepAliveSec is the default interval of TCP keep-alive probes on webhook connections
+	DefaultWebhookKeepAliveSec = 30
+	// DefaultWebhookConnectTimeoutSec is the default timeout to establish a TCP connection to a webhook target
+	DefaultWebhookConnectTimeoutSec = 30
+	// DefaultWebhookTLSHandshakeTimeoutSec is the default timeout of the TLS handshake with a webhook target
+	DefaultWebhookTLSHandshakeTimeoutSec = 10
+)
+
+// WebhookClientConf tunes the HTTP client that delivers events to webhooks. Each stream keeps
+// its connections open between batches, so at high delivery rates the pool must be large enough
+// to avoid opening a new connection (and using a new ephemeral port) for every batch
+type WebhookClientConf struct {
+	MaxIdleConns           int    `json:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost    int    `json:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost        int    `json:"maxConnsPerHost,omitempty"` // 0 for no limit
+	IdleConnTimeoutSec     uint64 `json:"idleConnTimeoutSec,omitempty"`
+	KeepAliveSec           uint64 `json:"keepAliveSec,omitempty"`
+	DisableKeepAlives      bool   `json:"disableKeepAlives,omitempty"`
+	ConnectTimeoutSec      uint64 `json:"connectTimeoutSec,omitempty"`
+	TLSHandshakeTimeoutSec uint64 `json:"tlsHandshakeTimeoutSec,omitempty"`
+	HTTP2                  bool   `json:"http2,omitempty"`
+}
+
 type webhookAction struct {
 	es   *eventStream
 	spec *webhookActionInfo
+	// The client is re-used across batches, and re-built if the spec of the stream is updated
+	clientLock sync.Mutex
+	client     *http.Client
+	clientFor  webhookActionInfo
+	tokens     webhookTokenCache
 }
 
 func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction, error) {
@@ -41,6 +80,15 @@ func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction,
 	if _, err := url.Parse(spec.URL); err != nil {
 		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidURL)
 	}
+	if _, err := url.Parse(spec.ProbeURL); err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidProbeURL)
+	}
+	if _, err := utils.ProxyFunc(spec.ProxyURL); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookAuth(spec.Auth); err != nil {
+		return nil, err
+	}
 	if spec.RequestTimeoutSec == 0 {
 		spec.RequestTimeoutSec = 120
 	}
@@ -50,6 +98,59 @@ func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction,
 	}, nil
 }
 
+// redacted returns a copy of the settings with the secrets masked, for the responses of the API.
+// The secrets are the auth settings, the headers with credential names, and the credentials
+// in the URLs
+func (spec *webhookActionInfo) redacted() *webhookActionInfo {
+	r := *spec
+	r.URL = redactWebhookURL(spec.URL)
+	r.ProbeURL = redactWebhookURL(spec.ProbeURL)
+	r.ProxyURL = redactWebhookURL(spec.ProxyURL)
+	r.Auth = spec.Auth.redacted()
+	if len(spec.Headers) > 0 {
+		r.Headers = make(map[string]string, len(spec.Headers))
+		for name, value := range spec.Headers {
+			if utils.IsCredentialName(name) {
+				value = redactedSecret
+			}
+			r.Headers[name] = value
+		}
+	}
+	return &r
+}
+
+// keepRedactedSecrets restores the current secrets into an update that has them masked
+func (spec *webhookActionInfo) keepRedactedSecrets(current *webhookActionInfo) {
+	if current == nil {
+		return
+	}
+	spec.URL = keepRedactedURL(spec.URL, current.URL)
+	spec.ProbeURL = keepRedactedURL(spec.ProbeURL, current.ProbeURL)
+	spec.ProxyURL = keepRedactedURL(spec.ProxyURL, current.ProxyURL)
+	spec.Auth.keepRedactedSecrets(current.Auth)
+	for name, value := range spec.Headers {
+		if value == redactedSecret {
+			if currentValue, exists := current.Headers[name]; exists {
+				spec.Headers[name] = currentValue
+			}
+		}
+	}
+}
+
+func redactWebhookURL(rawURL string) string {
+	if rawURL == "" {
+		return rawURL
+	}
+	return utils.RedactURL(rawURL)
+}
+
+func keepRedactedURL(updated, current string) string {
+	if current != "" && updated != current && updated == utils.RedactURL(current) {
+		return current
+	}
+	return updated
+}
+
 // attemptWebhookAction performs a single attempt of a webhook action
 func (w *webhookAction) attemptBatch(batchNumber, attempt uint64, events []*eventData) error {
 	// We perform DNS resolution before each attempt, to exclude private IP address ranges from the target
@@ -64,53 +165,174 @@ func (w *webhookAction) attemptBatch(batchNumber, attempt uint64, events []*even
 		log.Errorf(err.Error())
 		return err
 	}
-	// Set the timeout
-	var transport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-	transport.TLSClientConfig = &tls.Config{
-		InsecureSkipVerify: w.spec.TLSkipHostVerify,
-	}
-	netClient := &http.Client{
-		Timeout:   time.Duration(w.spec.RequestTimeoutSec) * time.Second,
-		Transport: transport,
+	if err := chaos.DropWebhook(utils.RedactURL(u.String())); err != nil {
+		return err
 	}
-	log.Infof("%s: POST --> %s [%s] (attempt=%d)", esID, u.String(), addr.String(), attempt)
-	reqBytes, err := json.Marshal(&events)
+	netClient := w.httpClient()
+	log.Infof("%s: POST --> %s [%s] (attempt=%d)", esID, utils.RedactURL(u.String()), addr.String(), attempt)
+	reqBytes, err := json.Marshal(w.es.payload(events))
 	var req *http.Request
 	if err == nil {
 		req, err = http.NewRequest("POST", u.String(), bytes.NewReader(reqBytes))
 	}
 	if err == nil {
-		var res *http.Response
 		req.Header.Set("Content-Type", "application/json")
 		for h, v := range w.spec.Headers {
 			req.Header.Set(h, v)
 		}
+		var authorization string
+		if authorization, err = w.authorization(netClient); err == nil && authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+	}
+	if err == nil {
+		var res *http.Response
+		started := time.Now()
 		res, err = netClient.Do(req)
+		status := 0
 		if err == nil {
+			status = res.StatusCode
+			defer res.Body.Close()
 			ok := (res.StatusCode >= 200 && res.StatusCode < 300)
-			log.Infof("%s: POST <-- %s [%d] ok=%t", esID, u.String(), res.StatusCode, ok)
+			log.Infof("%s: POST <-- %s [%d] ok=%t", esID, utils.RedactURL(u.String()), res.StatusCode, ok)
 			if !ok || log.IsLevelEnabled(log.DebugLevel) {
 				bodyBytes, _ := ioutil.ReadAll(res.Body)
 				log.Infof("%s: Response body: %s", esID, string(bodyBytes))
+			} else {
+				// The body must be read to the end for the connection to be re-used
+				io.Copy(ioutil.Discard, res.Body)
 			}
 			if !ok {
 				err = errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, esID, res.StatusCode)
 			}
+			if res.StatusCode == http.StatusUnauthorized {
+				// The token might have been revoked, so the retry gets a new one
+				w.tokens.invalidate()
+			}
 		}
+		w.es.sm.recordWebhookDelivery(esID, w.spec.URL, time.Since(started), status, err)
 	}
 	if err != nil {
-		log.Errorf("%s: POST %s failed (attempt=%d): %s", esID, u.String(), attempt, err)
+		log.Errorf("%s: POST %s failed (attempt=%d): %s", esID, utils.RedactURL(u.String()), attempt, utils.RedactText(err.Error()))
 	}
 	return err
 }
+
+// probe checks the receiver of a paused stream is available, without delivering events. The
+// probeURL of the webhook gets a GET, which must succeed. Otherwise the URL gets a HEAD, and
+// any response other than a server error shows the receiver is up, as it might only accept POST
+func (w *webhookAction) probe() error {
+	esID := w.es.spec.ID
+	method, probeURL := http.MethodHead, w.spec.URL
+	if w.spec.ProbeURL != "" {
+		method, probeURL = http.MethodGet, w.spec.ProbeURL
+	}
+	u, _ := url.Parse(probeURL)
+	addr, err := net.ResolveIPAddr("ip4", u.Hostname())
+	if err != nil {
+		return err
+	}
+	if w.es.isAddressUnsafe(addr) {
+		return errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, u.Hostname())
+	}
+	netClient := w.httpClient()
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	for h, v := range w.spec.Headers {
+		req.Header.Set(h, v)
+	}
+	authorization, err := w.authorization(netClient)
+	if err != nil {
+		return err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	log.Infof("%s: %s --> %s [%s] (probe)", esID, method, utils.RedactURL(u.String()), addr.String())
+	res, err := netClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	log.Infof("%s: %s <-- %s [%d] (probe)", esID, method, utils.RedactURL(u.String()), res.StatusCode)
+	ok := res.StatusCode >= 200 && res.StatusCode < 300
+	if method == http.MethodHead {
+		ok = res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests
+	}
+	if !ok {
+		return errors.Errorf(errors.EventStreamsWebhookProbeFailedHTTPStatus, esID, res.StatusCode)
+	}
+	return nil
+}
+
+// httpClient returns the client for the current spec of the stream, building a new one
+// when the proxy, TLS or timeout settings of the webhook have been updated
+func (w *webhookAction) httpClient() *http.Client {
+	w.clientLock.Lock()
+	defer w.clientLock.Unlock()
+	if w.client != nil &&
+		w.clientFor.ProxyURL == w.spec.ProxyURL &&
+		w.clientFor.TLSkipHostVerify == w.spec.TLSkipHostVerify &&
+		w.clientFor.RequestTimeoutSec == w.spec.RequestTimeoutSec {
+		return w.client
+	}
+	if w.client != nil {
+		w.client.CloseIdleConnections()
+	}
+	var conf WebhookClientConf
+	if w.es.sm.config().WebhookClient != nil {
+		conf = *w.es.sm.config().WebhookClient
+	}
+	w.client = newWebhookClient(&conf, w.spec)
+	w.clientFor = *w.spec
+	return w.client
+}
+
+func newWebhookClient(conf *WebhookClientConf, spec *webhookActionInfo) *http.Client {
+	if conf.MaxIdleConns == 0 {
+		conf.MaxIdleConns = DefaultWebhookMaxIdleConns
+	}
+	if conf.MaxIdleConnsPerHost == 0 {
+		conf.MaxIdleConnsPerHost = DefaultWebhookMaxIdleConnsPerHost
+	}
+	if conf.IdleConnTimeoutSec == 0 {
+		conf.IdleConnTimeoutSec = DefaultWebhookIdleConnTimeoutSec
+	}
+	if conf.KeepAliveSec == 0 {
+		conf.KeepAliveSec = DefaultWebhookKeepAliveSec
+	}
+	if conf.ConnectTimeoutSec == 0 {
+		conf.ConnectTimeoutSec = DefaultWebhookConnectTimeoutSec
+	}
+	if conf.TLSHandshakeTimeoutSec == 0 {
+		conf.TLSHandshakeTimeoutSec = DefaultWebhookTLSHandshakeTimeoutSec
+	}
+	proxy, _ := utils.ProxyFunc(spec.ProxyURL)
+	var transport = &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   time.Duration(conf.ConnectTimeoutSec) * time.Second,
+			KeepAlive: time.Duration(conf.KeepAliveSec) * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          conf.MaxIdleConns,
+		MaxIdleConnsPerHost:   conf.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       conf.MaxConnsPerHost,
+		IdleConnTimeout:       time.Duration(conf.IdleConnTimeoutSec) * time.Second,
+		DisableKeepAlives:     conf.DisableKeepAlives,
+		TLSHandshakeTimeout:   time.Duration(conf.TLSHandshakeTimeoutSec) * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// HTTP/2 is only negotiated with a custom TLS config and dialer if forced
+		ForceAttemptHTTP2: conf.HTTP2,
+	}
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: spec.TLSkipHostVerify,
+	}
+	return &http.Client{
+		Timeout:   time.Duration(spec.RequestTimeoutSec) * time.Second,
+		Transport: transport,
+	}
+}
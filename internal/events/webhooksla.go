@@ -0,0 +1,252 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+const (
+	// WebhookStatusPath is the path to report the delivery SLA of each webhook receiver
+	WebhookStatusPath = "/status/webhooks"
+	// DefaultWebhookSLACount is the number of most recent deliveries in the count-based window
+	DefaultWebhookSLACount = 100
+	// maxWebhookSLASamples bounds the memory used for each receiver, when it is busy enough
+	// to exceed this within the longest window
+	maxWebhookSLASamples = 10000
+)
+
+// DefaultWebhookSLAWindowsSec are the time windows reported, when none are configured
+var DefaultWebhookSLAWindowsSec = []int{300, 3600}
+
+// WebhookSLAConf configures the sliding windows over which the delivery success rate and
+// latency of each webhook receiver are reported
+type WebhookSLAConf struct {
+	WindowsSec []int `json:"windowsSec,omitempty"`
+	Count      int   `json:"count,omitempty"`
+}
+
+// WebhookSLAWindow is the delivery record of a receiver over one window. Failures are split
+// between those where the receiver responded with an error status, and those where no
+// response was received at all, such as a refused connection or a timeout
+type WebhookSLAWindow struct {
+	Window           string  `json:"window"`
+	Deliveries       int     `json:"deliveries"`
+	Succeeded        int     `json:"succeeded"`
+	ReceiverErrors   int     `json:"receiverErrors"`
+	ConnectionErrors int     `json:"connectionErrors"`
+	SuccessRate      float64 `json:"successRate"`
+	P95LatencyMS     int64   `json:"p95LatencyMS"`
+}
+
+// WebhookSLA reports the deliveries to a webhook receiver, from all the streams that use it
+type WebhookSLA struct {
+	URL          string              `json:"url"`
+	Streams      []string            `json:"streams"`
+	LastDelivery string              `json:"lastDelivery,omitempty"`
+	LastError    string              `json:"lastError,omitempty"`
+	Windows      []*WebhookSLAWindow `json:"windows"`
+}
+
+type webhookDelivery struct {
+	at       time.Time
+	latency  time.Duration
+	status   int // zero when no response was received
+	complete bool
+}
+
+type webhookReceiver struct {
+	streams    map[string]bool
+	deliveries []*webhookDelivery
+	lastError  string
+}
+
+// webhookSLATracker holds the recent deliveries to each receiver in memory, so the SLA
+// restarts when ethconnect does
+type webhookSLATracker struct {
+	mux       sync.Mutex
+	conf      *WebhookSLAConf
+	receivers map[string]*webhookReceiver
+}
+
+func newWebhookSLATracker(conf *WebhookSLAConf) *webhookSLATracker {
+	if conf == nil {
+		conf = &WebhookSLAConf{}
+	}
+	if len(conf.WindowsSec) == 0 {
+		conf.WindowsSec = DefaultWebhookSLAWindowsSec
+	}
+	if conf.Count <= 0 {
+		conf.Count = DefaultWebhookSLACount
+	}
+	return &webhookSLATracker{
+		conf:      conf,
+		receivers: make(map[string]*webhookReceiver),
+	}
+}
+
+// webhookReceiverKey identifies a receiver by its URL, without the credentials or query
+// string that might hold secrets
+func webhookReceiverKey(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return webhookURL
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+func (t *webhookSLATracker) maxWindow() time.Duration {
+	var max int
+	for _, w := range t.conf.WindowsSec {
+		if w > max {
+			max = w
+		}
+	}
+	return time.Duration(max) * time.Second
+}
+
+// record adds a delivery attempt, and trims those that have fallen out of all the windows
+func (t *webhookSLATracker) record(streamID, webhookURL string, latency time.Duration, status int, err error) {
+	key := webhookReceiverKey(webhookURL)
+	now := time.Now().UTC()
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	r, exists := t.receivers[key]
+	if !exists {
+		r = &webhookReceiver{streams: make(map[string]bool)}
+		t.receivers[key] = r
+	}
+	r.streams[streamID] = true
+	r.deliveries = append(r.deliveries, &webhookDelivery{
+		at:       now,
+		latency:  latency,
+		status:   status,
+		complete: err == nil,
+	})
+	if err != nil {
+		// Errors from the HTTP client quote the URL of the request, which can carry credentials
+		r.lastError = utils.RedactText(err.Error())
+	}
+	cutoff := now.Add(-t.maxWindow())
+	trim := 0
+	for trim < len(r.deliveries)-t.conf.Count && r.deliveries[trim].at.Before(cutoff) {
+		trim++
+	}
+	if len(r.deliveries)-trim > maxWebhookSLASamples {
+		trim = len(r.deliveries) - maxWebhookSLASamples
+	}
+	r.deliveries = r.deliveries[trim:]
+}
+
+// removeStream stops reporting a deleted stream against its receivers, and drops the
+// receivers no stream delivers to any more
+func (t *webhookSLATracker) removeStream(streamID string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	for key, r := range t.receivers {
+		delete(r.streams, streamID)
+		if len(r.streams) == 0 {
+			delete(t.receivers, key)
+		}
+	}
+}
+
+func (t *webhookSLATracker) report() []*WebhookSLA {
+	now := time.Now().UTC()
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	reports := make([]*WebhookSLA, 0, len(t.receivers))
+	for key, r := range t.receivers {
+		report := &WebhookSLA{
+			URL:       key,
+			Streams:   make([]string, 0, len(r.streams)),
+			LastError: r.lastError,
+		}
+		for streamID := range r.streams {
+			report.Streams = append(report.Streams, streamID)
+		}
+		sort.Strings(report.Streams)
+		if len(r.deliveries) > 0 {
+			report.LastDelivery = r.deliveries[len(r.deliveries)-1].at.Format(time.RFC3339Nano)
+		}
+		for _, windowSec := range t.conf.WindowsSec {
+			window := time.Duration(windowSec) * time.Second
+			cutoff := now.Add(-window)
+			start := sort.Search(len(r.deliveries), func(i int) bool { return !r.deliveries[i].at.Before(cutoff) })
+			report.Windows = append(report.Windows, slaWindow(window.String(), r.deliveries[start:]))
+		}
+		start := len(r.deliveries) - t.conf.Count
+		if start < 0 {
+			start = 0
+		}
+		report.Windows = append(report.Windows, slaWindow("last"+strconv.Itoa(t.conf.Count), r.deliveries[start:]))
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].URL < reports[j].URL })
+	return reports
+}
+
+// slaWindow summarizes the deliveries in a window. The latency percentile only includes the
+// deliveries that received a response, as the others measure the configured timeouts
+func slaWindow(name string, deliveries []*webhookDelivery) *WebhookSLAWindow {
+	w := &WebhookSLAWindow{
+		Window:     name,
+		Deliveries: len(deliveries),
+	}
+	latencies := make([]time.Duration, 0, len(deliveries))
+	for _, d := range deliveries {
+		switch {
+		case d.complete:
+			w.Succeeded++
+		case d.status > 0:
+			w.ReceiverErrors++
+		default:
+			w.ConnectionErrors++
+		}
+		if d.status > 0 {
+			latencies = append(latencies, d.latency)
+		}
+	}
+	if w.Deliveries > 0 {
+		w.SuccessRate = float64(w.Succeeded) / float64(w.Deliveries)
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		// Nearest-rank percentile
+		idx := (95*len(latencies)+99)/100 - 1
+		w.P95LatencyMS = latencies[idx].Milliseconds()
+	}
+	return w
+}
+
+// recordWebhookDelivery tracks each attempt to deliver a batch to a webhook
+func (s *subscriptionMGR) recordWebhookDelivery(streamID, webhookURL string, latency time.Duration, status int, err error) {
+	s.webhookSLA.record(streamID, webhookURL, latency, status, err)
+}
+
+// WebhookSLA reports the delivery success rate and latency of each webhook receiver
+func (s *subscriptionMGR) WebhookSLA(ctx context.Context) []*WebhookSLA {
+	return s.webhookSLA.report()
+}
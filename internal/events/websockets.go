@@ -16,6 +16,7 @@ package events
 
 import (
 	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/ws"
 )
 
 type webSocketAction struct {
@@ -46,17 +47,28 @@ func (w *webSocketAction) attemptBatch(batchNumber, attempt uint64, events []*ev
 	// Get a blocking channel to send and receive on our chosen namespace
 	sender, broadcaster, receiver, closing := w.es.wsChannels.GetChannels(topic)
 
+	// Batches sent to a single client carry their batch number, and are acknowledged individually,
+	// so several can be awaiting acknowledgement when the stream delivers batches concurrently
 	var channel chan<- interface{}
+	var message interface{}
+	var ack chan error
 	switch w.spec.DistributionMode {
 	case DistributionModeBroadcast:
 		channel = broadcaster
+		message = w.es.payload(events)
 	default:
 		channel = sender
+		ack = make(chan error, 1)
+		message = &ws.WebSocketBatch{
+			BatchNumber: batchNumber,
+			Batch:       w.es.payload(events),
+			Ack:         ack,
+		}
 	}
 
 	// Sent the batch of events
 	select {
-	case channel <- events:
+	case channel <- message:
 		break
 	case <-w.es.updateInterrupt:
 		return errors.Errorf(errors.EventStreamsWebSocketInterruptedSend)
@@ -68,6 +80,8 @@ func (w *webSocketAction) attemptBatch(batchNumber, attempt uint64, events []*ev
 	if w.spec.DistributionMode != DistributionModeBroadcast {
 		// Wait for the next ack or exception
 		select {
+		case err = <-ack:
+			break
 		case err = <-receiver:
 			break
 		case <-w.es.updateInterrupt:
@@ -18,15 +18,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/contracts"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/kvstore"
 	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/recorder"
 	"github.com/kaleido-io/ethconnect/internal/tx"
 	"github.com/kaleido-io/ethconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
@@ -35,8 +40,12 @@ import (
 
 // KafkaBridgeConf defines the YAML config structure for a Kafka bridge instance
 type KafkaBridgeConf struct {
-	Kafka       KafkaCommonConf `json:"kafka"`
-	MaxInFlight int             `json:"maxInFlight"`
+	Kafka             KafkaCommonConf `json:"kafka"`
+	MaxInFlight       int             `json:"maxInFlight"`
+	DedupDBPath       string          `json:"dedupDBPath,omitempty"`
+	DedupRetentionSec int             `json:"dedupRetentionSec,omitempty"`
+	ReplyOmitFields   []string        `json:"replyOmitFields,omitempty"`
+	MethodFilterStore string          `json:"methodFilterStore,omitempty"`
 	tx.TxnProcessorConf
 	eth.RPCConf
 }
@@ -50,6 +59,27 @@ type KafkaBridge struct {
 	processor    tx.TxnProcessor
 	inFlight     map[string]*msgContext
 	inFlightCond *sync.Cond
+	dedup        kvstore.KVStore
+	dedupActive  map[string]bool // IDs reserved by a request being processed, guarded by inFlightCond
+	lanes        map[string]*orderingLane
+	lanesLock    sync.Mutex
+	lanesWG      sync.WaitGroup
+}
+
+// orderingLane holds the messages waiting to be processed for one ordering key. Each lane
+// with messages has a single goroutine working through them in the order they were consumed,
+// so messages for different keys are processed in parallel
+type orderingLane struct {
+	queue []*msgContext
+}
+
+// dedupRecord is stored against the ID of each request when it is dispatched for submission,
+// and updated with the reply when processing completes. So a request re-delivered after a
+// consumer group rebalance, or a restart, is never submitted twice
+type dedupRecord struct {
+	Status    string          `json:"status,omitempty"`
+	Processed time.Time       `json:"processed"`
+	Reply     json.RawMessage `json:"reply,omitempty"`
 }
 
 // Conf gets the config for this bridge
@@ -76,7 +106,10 @@ func (k *KafkaBridge) ValidateConf() (err error) {
 	if k.conf.MaxInFlight <= 0 {
 		k.conf.MaxInFlight = 10
 	}
-	return
+	if k.conf.DedupRetentionSec <= 0 {
+		k.conf.DedupRetentionSec = defaultDedupRetentionSec
+	}
+	return k.conf.TxnProcessorConf.ValidateConf()
 }
 
 // CobraInit retruns a cobra command to configure this KafkaBridge
@@ -101,9 +134,23 @@ func (k *KafkaBridge) CobraInit() (cmd *cobra.Command) {
 	eth.CobraInitRPC(cmd, &k.conf.RPCConf)
 	tx.CobraInitTxnProcessor(cmd, &k.conf.TxnProcessorConf)
 	cmd.Flags().IntVarP(&k.conf.MaxInFlight, "maxinflight", "m", utils.DefInt("KAFKA_MAX_INFLIGHT", 0), "Maximum messages to hold in-flight")
+	cmd.Flags().StringVar(&k.conf.DedupDBPath, "dedup-db", os.Getenv("KAFKA_DEDUP_DB"), "Level DB location for tracking processed request IDs, to skip duplicates")
+	defReplyOmit := strings.Split(os.Getenv("KAFKA_REPLY_OMIT"), ",")
+	if len(defReplyOmit) == 1 && defReplyOmit[0] == "" {
+		defReplyOmit = []string{}
+	}
+	cmd.Flags().StringArrayVar(&k.conf.ReplyOmitFields, "reply-omit", defReplyOmit, "Fields to omit from replies, and from the request payload of error replies (such as requestPayload, abi, compiled)")
+	cmd.Flags().StringVar(&k.conf.MethodFilterStore, "method-filter-store", os.Getenv("KAFKA_METHOD_FILTER_STORE"), "Storage path of a REST gateway, whose contract method allow and deny lists, and signer policies, are applied to the transactions the bridge sends")
+	cmd.Flags().IntVar(&k.conf.DedupRetentionSec, "dedup-retention", utils.DefInt("KAFKA_DEDUP_RETENTION_SEC", defaultDedupRetentionSec), "Time to retain processed request IDs for duplicate detection (seconds)")
 	return
 }
 
+const (
+	defaultDedupRetentionSec = 86400
+	dedupStatusSubmitted     = "submitted"
+	dedupStatusComplete      = "complete"
+)
+
 type msgContext struct {
 	timeReceived   time.Time
 	ctx            context.Context
@@ -112,6 +159,7 @@ type msgContext struct {
 	reqOffset      string
 	saramaMsg      *sarama.ConsumerMessage
 	key            string
+	orderingKey    string
 	bridge         *KafkaBridge
 	complete       bool
 	replyType      string
@@ -119,6 +167,9 @@ type msgContext struct {
 	replyBytes     []byte
 	replyPartition int32
 	replyOffset    int64
+	dedupable      bool
+	dedupReserved  bool
+	dedupPrevious  *dedupRecord
 }
 
 // addInflightMsg creates a msgContext wrapper around a message with all the
@@ -151,10 +202,16 @@ func (k *KafkaBridge) addInflightMsg(msg *sarama.ConsumerMessage, producer Kafka
 	// which could fail. In which case we still have a msgContext inflight
 	// that needs Reply (and offset commit). So our caller must
 	// send a generic error reply (after dropping the lock).
-	if err = json.Unmarshal(msg.Value, &ctx.requestCommon); err != nil {
+	var request struct {
+		messages.RequestCommon
+		From string `json:"from"`
+	}
+	if err = json.Unmarshal(msg.Value, &request); err != nil {
 		log.Errorf("Failed to unmarshal message headers: %s - Message=%s", err, string(msg.Value))
 		return
 	}
+	ctx.requestCommon = request.RequestCommon
+	ctx.orderingKey = orderingKeyFor(msg, request.From)
 	headers := &ctx.requestCommon.Headers
 	accessToken := ""
 	for _, header := range msg.Headers {
@@ -171,6 +228,10 @@ func (k *KafkaBridge) addInflightMsg(msg *sarama.ConsumerMessage, producer Kafka
 	ctx.ctx = authCtx
 	if headers.ID == "" {
 		headers.ID = utils.UUIDv4()
+	} else if k.dedup != nil {
+		// Only IDs supplied by the producer can be re-delivered
+		ctx.dedupable = true
+		ctx.dedupPrevious, ctx.dedupReserved = k.reserveDedupID(headers.ID)
 	}
 	// Use the account as the partitioning key, or fallback to the ID, which we ensure is non-null
 	if headers.Account != "" {
@@ -181,6 +242,18 @@ func (k *KafkaBridge) addInflightMsg(msg *sarama.ConsumerMessage, producer Kafka
 	return
 }
 
+// orderingKeyFor returns the key that determines the order messages are processed in.
+// Messages from the same sender are processed in order, as are messages with the same
+// Kafka key where there is no sender. Anything else is ordered within its partition
+func orderingKeyFor(msg *sarama.ConsumerMessage, from string) string {
+	if from != "" {
+		return "from:" + strings.TrimPrefix(strings.ToLower(from), "0x")
+	} else if len(msg.Key) > 0 {
+		return "key:" + string(msg.Key)
+	}
+	return fmt.Sprintf("partition:%s:%d", msg.Topic, msg.Partition)
+}
+
 type ctxByOffset []*msgContext
 
 func (a ctxByOffset) Len() int {
@@ -246,7 +319,7 @@ func (c *msgContext) Headers() *messages.CommonHeaders {
 }
 
 func (c *msgContext) Unmarshal(msg interface{}) (err error) {
-	if err = json.Unmarshal(c.saramaMsg.Value, msg); err != nil {
+	if err = utils.UnmarshalJSONNumbers(c.saramaMsg.Value, msg); err != nil {
 		log.Errorf("Failed to parse message: %s - Message=%s", err, string(c.saramaMsg.Value))
 	}
 	return
@@ -279,12 +352,105 @@ func (c *msgContext) Reply(replyMessage messages.ReplyWithHeaders) {
 	replyHeaders.ID = utils.UUIDv4()
 	replyHeaders.Context = c.requestCommon.Headers.Context
 	replyHeaders.ReqID = c.requestCommon.Headers.ID
+	replyHeaders.SchemaVersion = messages.ReplySchemaVersion
 	replyHeaders.ReqOffset = c.reqOffset
 	replyHeaders.ReqOffset = c.reqOffset
 	replyHeaders.Received = c.timeReceived.UTC().Format(time.RFC3339Nano)
 	c.replyTime = time.Now().UTC()
 	replyHeaders.Elapsed = c.replyTime.Sub(c.timeReceived).Seconds()
 	c.replyBytes, _ = json.Marshal(replyMessage)
+	c.replyBytes = c.bridge.trimReply(c.replyBytes)
+	if c.dedupable {
+		if errReply, ok := replyMessage.(*messages.ErrorReply); ok && errReply.TXHash == "" {
+			// Nothing was submitted to the node, so a re-delivery should be processed again
+			c.bridge.deleteDedupRecord(c.requestCommon.Headers.ID)
+		} else {
+			c.bridge.putDedupRecord(c.requestCommon.Headers.ID, dedupStatusComplete, c.replyBytes)
+		}
+	}
+	if c.dedupReserved {
+		c.bridge.releaseDedupID(c.requestCommon.Headers.ID)
+		c.dedupReserved = false
+	}
+	c.sendReply()
+}
+
+// ReplyConfirmed sends a follow-up reply for a request that has already been replied
+// to and committed. It is not tracked as in-flight, and is not recorded for de-duplication
+func (c *msgContext) ReplyConfirmed(replyMessage messages.ReplyWithHeaders) {
+	replyHeaders := replyMessage.ReplyHeaders()
+	replyHeaders.ID = utils.UUIDv4()
+	replyHeaders.Context = c.requestCommon.Headers.Context
+	replyHeaders.ReqID = c.requestCommon.Headers.ID
+	replyHeaders.SchemaVersion = messages.ReplySchemaVersion
+	replyHeaders.ReqOffset = c.reqOffset
+	replyHeaders.Received = c.timeReceived.UTC().Format(time.RFC3339Nano)
+	replyHeaders.Elapsed = time.Now().UTC().Sub(c.timeReceived).Seconds()
+	replyBytes, _ := json.Marshal(replyMessage)
+	replyBytes = c.bridge.trimReply(replyBytes)
+	log.Infof("Sending follow-up reply %s: %s", replyHeaders.MsgType, c)
+	c.producer.Input() <- &sarama.ProducerMessage{
+		Topic: c.bridge.kafka.Conf().TopicOut,
+		Key:   sarama.StringEncoder(c.key),
+		Value: sarama.ByteEncoder(replyBytes),
+	}
+}
+
+// ReplyProgress sends a progress message for a request that is still in-flight. As with
+// follow-up replies, it is not recorded for de-duplication, and does not commit the request
+func (c *msgContext) ReplyProgress(progressMessage messages.ReplyWithHeaders) {
+	c.ReplyConfirmed(progressMessage)
+}
+
+// replyDuplicate acknowledges a request with the same ID as one already submitted, without
+// submitting it again. The original reply is re-sent if one was recorded. Otherwise the
+// original was interrupted after submission, so the outcome must be checked via its receipt
+func (c *msgContext) replyDuplicate() {
+	if c.dedupPrevious.Reply == nil {
+		c.dedupable = false
+		c.SendErrorReply(409, errors.Errorf(errors.KafkaBridgeDuplicateNoReply, c.requestCommon.Headers.ID))
+		return
+	}
+	var original messages.ReplyCommon
+	json.Unmarshal(c.dedupPrevious.Reply, &original)
+	c.replyType = original.Headers.MsgType
+	c.replyTime = time.Now().UTC()
+	c.replyBytes = c.dedupPrevious.Reply
+	log.Infof("Duplicate request %s - replaying original reply %s", c.requestCommon.Headers.ID, original.Headers.ID)
+	c.sendReply()
+}
+
+// trimReply removes the configured fields from a reply, to keep bulky content such as
+// the ABI and compiled bytecode of a contract deployment off the reply topic.
+// The fields are removed from the top level of the reply, and from the original request
+// payload included in error replies - which can be removed entirely with "requestPayload"
+func (k *KafkaBridge) trimReply(replyBytes []byte) []byte {
+	if len(k.conf.ReplyOmitFields) == 0 {
+		return replyBytes
+	}
+	// Numbers are kept as json.Number, so large integers are passed through exactly
+	var reply map[string]interface{}
+	if err := utils.UnmarshalJSONNumbers(replyBytes, &reply); err != nil {
+		return replyBytes
+	}
+	for _, field := range k.conf.ReplyOmitFields {
+		delete(reply, field)
+	}
+	if reqPayload, ok := reply["requestPayload"].(string); ok {
+		var req map[string]interface{}
+		if err := utils.UnmarshalJSONNumbers([]byte(reqPayload), &req); err == nil {
+			for _, field := range k.conf.ReplyOmitFields {
+				delete(req, field)
+			}
+			reqBytes, _ := json.Marshal(req)
+			reply["requestPayload"] = string(reqBytes)
+		}
+	}
+	trimmed, _ := json.Marshal(reply)
+	return trimmed
+}
+
+func (c *msgContext) sendReply() {
 	log.Infof("Sending reply: %s", c)
 	c.producer.Input() <- &sarama.ProducerMessage{
 		Topic:    c.bridge.kafka.Conf().TopicOut,
@@ -292,7 +458,6 @@ func (c *msgContext) Reply(replyMessage messages.ReplyWithHeaders) {
 		Metadata: c.reqOffset,
 		Value:    c,
 	}
-	return
 }
 
 func (c *msgContext) String() string {
@@ -323,6 +488,8 @@ func NewKafkaBridge(printYAML *bool) *KafkaBridge {
 		printYAML:    printYAML,
 		inFlight:     make(map[string]*msgContext),
 		inFlightCond: sync.NewCond(&sync.Mutex{}),
+		dedupActive:  make(map[string]bool),
+		lanes:        make(map[string]*orderingLane),
 	}
 	k.processor = tx.NewTxnProcessor(&k.conf.TxnProcessorConf, &k.conf.RPCConf)
 	k.kafka = NewKafkaCommon(&SaramaKafkaFactory{}, &k.conf.Kafka, k)
@@ -335,6 +502,7 @@ func (k *KafkaBridge) ConsumerMessagesLoop(consumer KafkaConsumer, producer Kafk
 	for msg := range consumer.Messages() {
 		k.inFlightCond.L.Lock()
 		log.Infof("Kafka consumer received message: Partition=%d Offset=%d", msg.Partition, msg.Offset)
+		recorder.RecordKafka(msg.Topic, msg.Key, msg.Value)
 
 		// We cannot build up an infinite number of messages in memory
 		for len(k.inFlight) >= k.conf.MaxInFlight {
@@ -349,17 +517,67 @@ func (k *KafkaBridge) ConsumerMessagesLoop(consumer KafkaConsumer, producer Kafk
 		if msgCtx == nil {
 			// This was a dup
 		} else if err == nil {
-			// Dispatch for processing if we parsed the message successfully
-			k.processor.OnMessage(msgCtx)
+			// Processing happens on the lane for the sender, so we can move on to the next message
+			k.dispatchInOrder(msgCtx)
 		} else {
 			// Dispatch a generic 'bad data' reply
 			errMsg := messages.NewErrorReply(err, msg.Value)
 			msgCtx.Reply(errMsg)
 		}
 	}
+	// Finish the messages already dispatched to lanes before reporting the loop is done
+	k.lanesWG.Wait()
 	wg.Done()
 }
 
+// dispatchInOrder queues a message on the lane for its ordering key, starting a goroutine
+// for the lane if it is not already being processed
+func (k *KafkaBridge) dispatchInOrder(msgCtx *msgContext) {
+	k.lanesLock.Lock()
+	lane, exists := k.lanes[msgCtx.orderingKey]
+	if !exists {
+		lane = &orderingLane{}
+		k.lanes[msgCtx.orderingKey] = lane
+	}
+	lane.queue = append(lane.queue, msgCtx)
+	k.lanesLock.Unlock()
+	if !exists {
+		k.lanesWG.Add(1)
+		go k.processLane(msgCtx.orderingKey, lane)
+	}
+}
+
+// processLane works through the messages on a lane one at a time, and removes the lane
+// once it is empty
+func (k *KafkaBridge) processLane(orderingKey string, lane *orderingLane) {
+	defer k.lanesWG.Done()
+	for {
+		k.lanesLock.Lock()
+		if len(lane.queue) == 0 {
+			delete(k.lanes, orderingKey)
+			k.lanesLock.Unlock()
+			return
+		}
+		msgCtx := lane.queue[0]
+		lane.queue = lane.queue[1:]
+		k.lanesLock.Unlock()
+		k.processMsg(msgCtx)
+	}
+}
+
+func (k *KafkaBridge) processMsg(msgCtx *msgContext) {
+	if msgCtx.dedupPrevious != nil {
+		// We have already submitted a request with this ID
+		msgCtx.replyDuplicate()
+		return
+	}
+	// Record the ID before dispatch, as we might stop after the submission but before the reply
+	if msgCtx.dedupable {
+		k.putDedupRecord(msgCtx.requestCommon.Headers.ID, dedupStatusSubmitted, nil)
+	}
+	k.processor.OnMessage(msgCtx)
+}
+
 // ProducerErrorLoop - goroutine to process producer errors
 func (k *KafkaBridge) ProducerErrorLoop(consumer KafkaConsumer, producer KafkaProducer, wg *sync.WaitGroup) {
 	log.Debugf("Kafka producer error loop started")
@@ -372,7 +590,13 @@ func (k *KafkaBridge) ProducerErrorLoop(consumer KafkaConsumer, producer KafkaPr
 		// to drive retry logic. In the future we might consider recreating the
 		// producer and attempting to resend the message a number of times -
 		// keeping a retry counter on the msgContext object
-		reqOffset := err.Msg.Metadata.(string)
+		reqOffset, ok := err.Msg.Metadata.(string)
+		if !ok {
+			// Follow-up replies are sent after the request is committed, so there is nothing to retry
+			log.Errorf("Kafka producer failed for follow-up reply: %s", err)
+			k.inFlightCond.L.Unlock()
+			continue
+		}
 		ctx := k.inFlight[reqOffset]
 		log.Errorf("Kafka producer failed for reply %s to reqOffset %s: %s", ctx, reqOffset, err)
 		panic(err)
@@ -386,8 +610,10 @@ func (k *KafkaBridge) ProducerSuccessLoop(consumer KafkaConsumer, producer Kafka
 	defer wg.Done()
 	for msg := range producer.Successes() {
 		k.inFlightCond.L.Lock()
-		reqOffset := msg.Metadata.(string)
-		if ctx, ok := k.inFlight[reqOffset]; ok {
+		reqOffset, isRequest := msg.Metadata.(string)
+		if !isRequest {
+			log.Infof("Follow-up reply sent to partition=%d offset=%d", msg.Partition, msg.Offset)
+		} else if ctx, ok := k.inFlight[reqOffset]; ok {
 			log.Infof("Reply sent: %s", ctx)
 			// While still holding the lock, add this to the completed list
 			k.setInFlightComplete(ctx, consumer)
@@ -402,6 +628,105 @@ func (k *KafkaBridge) ProducerSuccessLoop(consumer KafkaConsumer, producer Kafka
 	}
 }
 
+// reserveDedupID checks for a previous request with the same ID, and if there is none reserves the
+// ID for this request until it is replied to. The check and the reservation are made in one step
+// at consume time, so a re-delivery consumed before the original is processed, such as on another
+// ordering lane, is treated as a duplicate rather than submitted again. A request that is still
+// being processed has no reply to replay yet.
+// * Caller holds the inFlightCond mutex *
+func (k *KafkaBridge) reserveDedupID(id string) (previous *dedupRecord, reserved bool) {
+	if k.dedupActive[id] {
+		return &dedupRecord{Status: dedupStatusSubmitted, Processed: time.Now().UTC()}, false
+	}
+	if previous = k.getDedupRecord(id); previous != nil {
+		return previous, false
+	}
+	k.dedupActive[id] = true
+	return nil, true
+}
+
+// releaseDedupID removes the reservation of an ID, once the record of the request is updated
+func (k *KafkaBridge) releaseDedupID(id string) {
+	k.inFlightCond.L.Lock()
+	delete(k.dedupActive, id)
+	k.inFlightCond.L.Unlock()
+}
+
+// getDedupRecord returns the record of a previous request with the same ID, if one was
+// submitted within the retention period
+func (k *KafkaBridge) getDedupRecord(id string) *dedupRecord {
+	b, err := k.dedup.Get(id)
+	if err != nil {
+		return nil
+	}
+	var rec dedupRecord
+	if err = json.Unmarshal(b, &rec); err != nil {
+		log.Warnf("Invalid dedup record for request %s: %s", id, err)
+		return nil
+	}
+	if k.dedupExpired(&rec) {
+		k.dedup.Delete(id)
+		return nil
+	}
+	return &rec
+}
+
+func (k *KafkaBridge) putDedupRecord(id, status string, replyBytes []byte) {
+	b, _ := json.Marshal(&dedupRecord{
+		Status:    status,
+		Processed: time.Now().UTC(),
+		Reply:     replyBytes,
+	})
+	if err := k.dedup.Put(id, b); err != nil {
+		log.Errorf("Failed to record request %s for duplicate detection: %s", id, err)
+	}
+}
+
+func (k *KafkaBridge) deleteDedupRecord(id string) {
+	if err := k.dedup.Delete(id); err != nil {
+		log.Errorf("Failed to remove request %s from duplicate detection: %s", id, err)
+	}
+}
+
+func (k *KafkaBridge) dedupExpired(rec *dedupRecord) bool {
+	return time.Since(rec.Processed) > time.Duration(k.conf.DedupRetentionSec)*time.Second
+}
+
+// dedupPurgeLoop removes expired records once per retention period, to bound the DB size.
+// Expired records are also ignored on lookup, so the timing does not need to be precise
+func (k *KafkaBridge) dedupPurgeLoop(stop chan struct{}) {
+	ticker := time.NewTicker(time.Duration(k.conf.DedupRetentionSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			k.purgeDedupRecords()
+		}
+	}
+}
+
+// purgeDedupRecords removes records older than the retention period
+func (k *KafkaBridge) purgeDedupRecords() {
+	it := k.dedup.NewIterator()
+	if it == nil {
+		return
+	}
+	defer it.Release()
+	var expired []string
+	for it.Next() {
+		var rec dedupRecord
+		if err := json.Unmarshal(it.Value(), &rec); err != nil || k.dedupExpired(&rec) {
+			expired = append(expired, it.Key())
+		}
+	}
+	for _, id := range expired {
+		k.dedup.Delete(id)
+	}
+	log.Infof("Purged %d expired dedup records", len(expired))
+}
+
 func (k *KafkaBridge) connect() (err error) {
 	// Connect the client
 	if k.rpc, err = eth.RPCConnect(&k.conf.RPC); err != nil {
@@ -424,6 +749,32 @@ func (k *KafkaBridge) Start() (err error) {
 	if err = k.connect(); err != nil {
 		return
 	}
+	defer k.processor.Close()
+
+	// Apply the method lists and signer policies of the contracts registered with a gateway,
+	// as the messages the bridge consumes might not have been checked by that gateway
+	if k.conf.MethodFilterStore != "" {
+		checker, err := contracts.NewStoredMethodChecker(k.conf.MethodFilterStore)
+		if err != nil {
+			return err
+		}
+		k.processor.SetMethodChecker(checker)
+		if policy, ok := checker.(tx.SignerPolicy); ok {
+			k.processor.SetSignerPolicy(policy)
+		}
+	}
+
+	// Open the DB of processed request IDs, if duplicate detection is enabled
+	if k.conf.DedupDBPath != "" {
+		if k.dedup, err = kvstore.NewLDBKeyValueStore(k.conf.DedupDBPath); err != nil {
+			return
+		}
+		defer k.dedup.Close()
+		k.purgeDedupRecords()
+		stopPurge := make(chan struct{})
+		defer close(stopPurge)
+		go k.dedupPurgeLoop(stopPurge)
+	}
 
 	// Defer to KafkaCommon processing
 	err = k.kafka.Start()
@@ -15,18 +15,22 @@
 package kafka
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/Shopify/sarama"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/auth"
 	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
 	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/kvstore"
 	"github.com/kaleido-io/ethconnect/internal/messages"
 	"github.com/kaleido-io/ethconnect/internal/tx"
 	log "github.com/sirupsen/logrus"
@@ -83,6 +87,21 @@ func (p *testKafkaMsgProcessor) ResolveAddress(from string) (resolvedFrom string
 	return from, nil
 }
 
+func (p *testKafkaMsgProcessor) InFlightStatus() map[string][]*tx.InFlightTxnStatus {
+	return nil
+}
+
+func (p *testKafkaMsgProcessor) NonceReport(ctx context.Context, addresses []string) ([]*tx.NonceReport, error) {
+	return nil, nil
+}
+
+func (p *testKafkaMsgProcessor) ResumeTransaction(txnContext tx.TxnContext, txHash string, nonce int64) {
+}
+func (p *testKafkaMsgProcessor) SetAddressNameResolver(resolver tx.AddressNameResolver) {}
+func (p *testKafkaMsgProcessor) SetMethodChecker(checker tx.MethodChecker)              {}
+func (p *testKafkaMsgProcessor) SetSignerPolicy(policy tx.SignerPolicy)                 {}
+func (p *testKafkaMsgProcessor) Close()                                                 {}
+
 func (p *testKafkaMsgProcessor) Init(rpc eth.RPCClient) {
 	p.rpc = rpc
 }
@@ -147,6 +166,16 @@ func TestExecuteBridgeWithIncompleteKafkaArgs(t *testing.T) {
 	assert.Equal(err.Error(), "pop")
 }
 
+func TestValidateConfInvalidProxyURL(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.conf.RPC.URL = "http://localhost:8545"
+	k.conf.AddressBookConf.ProxyURL = "://bad"
+	err := k.ValidateConf()
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+}
+
 func TestDefIntWithBadEnvVar(t *testing.T) {
 	assert := assert.New(t)
 
@@ -281,6 +310,7 @@ func TestSingleMessageWithReply(t *testing.T) {
 	assert.Equal(msgContext1.Headers().ID, replySent.Headers.ReqID)
 	assert.Equal("in-topic:5:500", replySent.Headers.ReqOffset)
 	assert.Equal("data", replySent.Headers.Context["some"])
+	assert.Equal(messages.ReplySchemaVersion, replySent.Headers.SchemaVersion)
 
 	// Shut down
 	mockProducer.AsyncClose()
@@ -370,6 +400,61 @@ func TestSingleMessageWithErrorReply(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSingleMessageWithTrimmedErrorReply(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks()
+	k.conf.ReplyOmitFields = []string{"abi", "compiled"}
+
+	msg1 := messages.DeployContract{}
+	msg1.Headers.MsgType = messages.MsgTypeDeployContract
+	msg1.ABI = ethbinding.ABIMarshaling{{Type: "constructor"}}
+	msg1.Compiled = []byte("bytecode")
+	msg1.ContractName = "mycontract"
+	msg1bytes, _ := json.Marshal(&msg1)
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{Value: msg1bytes}
+
+	msgContext1 := <-processor.messages
+	go func() {
+		msgContext1.SendErrorReply(400, fmt.Errorf("bang"))
+	}()
+
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+	replyBytes, _ := replyKafkaMsg.Value.Encode()
+	var errorReply messages.ErrorReply
+	json.Unmarshal(replyBytes, &errorReply)
+	assert.Equal("bang", errorReply.ErrorMessage)
+	var reqPayload map[string]interface{}
+	json.Unmarshal([]byte(errorReply.OriginalMessage), &reqPayload)
+	assert.Equal("mycontract", reqPayload["contractName"])
+	assert.NotContains(reqPayload, "abi")
+	assert.NotContains(reqPayload, "compiled")
+
+	// Shut down
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestTrimReply(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	assert.Equal(`{"a":1}`, string(k.trimReply([]byte(`{"a":1}`))))
+
+	k.conf.ReplyOmitFields = []string{"requestPayload", "openapi"}
+	assert.JSONEq(`{"errorMessage":"bang"}`, string(k.trimReply([]byte(`{"errorMessage":"bang","requestPayload":"{}","openapi":"url"}`))))
+
+	k.conf.ReplyOmitFields = []string{"abi"}
+	assert.JSONEq(`{"requestPayload":"not json"}`, string(k.trimReply([]byte(`{"requestPayload":"not json"}`))))
+	assert.Equal(`!json`, string(k.trimReply([]byte(`!json`))))
+
+	// Large integers are not rounded through a float64
+	assert.Equal(`{"gasUsed":123456789012345678901,"requestPayload":"{\"value\":98765432109876543210}"}`,
+		string(k.trimReply([]byte(`{"gasUsed":123456789012345678901,"requestPayload":"{\"value\":98765432109876543210}","abi":[]}`))))
+}
+
 func TestSingleMessageWithErrorReplyWithGapFillDetail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -486,6 +571,105 @@ func TestMoreMessagesThanMaxInFlight(t *testing.T) {
 
 }
 
+func TestMessagesOrderedPerSender(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks()
+
+	// Two messages for one sender, and one for another
+	for i, from := range []string{"0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c", "aa983ad2a0e0ed8ac639277f37be42f2a5d2618c", "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"} {
+		msgBytes, _ := json.Marshal(map[string]interface{}{
+			"headers": map[string]interface{}{"type": "TestMessagesOrderedPerSender", "id": fmt.Sprintf("msg%d", i)},
+			"from":    from,
+		})
+		mockConsumer.MockMessages <- &sarama.ConsumerMessage{Value: msgBytes, Partition: 0, Offset: int64(i)}
+	}
+
+	// The first message for each sender is blocked in the processor, and the second
+	// message for the first sender waits behind it
+	for {
+		k.lanesLock.Lock()
+		lane := k.lanes["from:aa983ad2a0e0ed8ac639277f37be42f2a5d2618c"]
+		queued := lane != nil && len(lane.queue) == 1 && len(k.lanes) == 2
+		k.lanesLock.Unlock()
+		if queued {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		msgContext := <-processor.messages
+		ids = append(ids, msgContext.Headers().ID)
+		go msgContext.Reply(&messages.ReplyCommon{})
+		mockProducer.MockSuccesses <- <-mockProducer.MockInput
+	}
+	assert.ElementsMatch([]string{"msg0", "msg1", "msg2"}, ids)
+	for i, id := range ids {
+		if id == "msg1" {
+			assert.Contains(ids[:i], "msg0")
+		}
+	}
+
+	// Shut down
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+
+	assert.Equal(int64(2), mockConsumer.OffsetsByPartition[0])
+}
+
+func TestConsumerLoopWaitsForLanes(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.conf.MaxInFlight = 10
+	f := NewMockKafkaFactory()
+	mockConsumer, _ := f.NewConsumer(k.kafka)
+	mockProducer, _ := f.NewProducer(k.kafka)
+	processor := k.processor.(*testKafkaMsgProcessor)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	loopDone := make(chan struct{})
+	go func() {
+		k.ConsumerMessagesLoop(mockConsumer, mockProducer, wg)
+		close(loopDone)
+	}()
+
+	msgBytes, _ := json.Marshal(map[string]interface{}{
+		"headers": map[string]interface{}{"type": "TestConsumerLoopWaitsForLanes", "id": "msg0"},
+		"from":    "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c",
+	})
+	mockConsumer.(*MockKafkaConsumer).MockMessages <- &sarama.ConsumerMessage{Value: msgBytes}
+	mockConsumer.Close()
+
+	// The lane is blocked handing the message to the processor, so the loop cannot finish
+	select {
+	case <-loopDone:
+		assert.Fail("Consumer loop finished before its lanes")
+	default:
+	}
+	msgContext := <-processor.messages
+	assert.Equal("msg0", msgContext.Headers().ID)
+	<-loopDone
+
+	k.lanesLock.Lock()
+	assert.Empty(k.lanes)
+	k.lanesLock.Unlock()
+}
+
+func TestOrderingKeyFor(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := &sarama.ConsumerMessage{Topic: "test", Partition: 3, Key: []byte("key1")}
+	assert.Equal("from:aa983ad2a0e0ed8ac639277f37be42f2a5d2618c", orderingKeyFor(msg, "0xAA983AD2a0e0eD8ac639277F37be42F2A5d2618c"))
+	assert.Equal("from:hd-wallet1-path1-3", orderingKeyFor(msg, "HD-wallet1-path1-3"))
+	assert.Equal("key:key1", orderingKeyFor(msg, ""))
+	msg.Key = nil
+	assert.Equal("partition:test:3", orderingKeyFor(msg, ""))
+}
+
 func TestAddInflightDuplicateMessage(t *testing.T) {
 	assert := assert.New(t)
 
@@ -561,7 +745,9 @@ func TestProducerErrorLoopPanics(t *testing.T) {
 	go func() {
 		mockProducer.MockErrors <- &sarama.ProducerError{
 			Err: fmt.Errorf("pop"),
-			Msg: &sarama.ProducerMessage{},
+			Msg: &sarama.ProducerMessage{
+				Metadata: "in-topic:1:1",
+			},
 		}
 		wg.Done()
 	}()
@@ -576,6 +762,75 @@ func TestProducerErrorLoopPanics(t *testing.T) {
 
 }
 
+func TestProducerErrorLoopFollowUpReply(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _, mockConsumer, mockProducer, wg := setupMocks()
+
+	wg.Add(2)
+	go func() {
+		mockProducer.MockErrors <- &sarama.ProducerError{
+			Err: fmt.Errorf("pop"),
+			Msg: &sarama.ProducerMessage{},
+		}
+		mockProducer.AsyncClose()
+		wg.Done()
+	}()
+
+	assert.NotPanics(func() {
+		k.ProducerErrorLoop(nil, mockProducer, wg)
+	})
+
+	mockConsumer.Close()
+	wg.Wait()
+
+}
+
+func TestSingleMessageWithConfirmedReply(t *testing.T) {
+	assert := assert.New(t)
+
+	_, processor, mockConsumer, mockProducer, wg := setupMocks()
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestSingleMessageWithConfirmedReply"
+	msg1bytes, _ := json.Marshal(&msg1)
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+	msgContext1 := <-processor.messages
+
+	go func() {
+		reply1 := messages.ReplyCommon{}
+		reply1.Headers.MsgType = messages.MsgTypeTransactionSuccess
+		msgContext1.Reply(&reply1)
+	}()
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+
+	// The follow-up is sent once the original reply has completed, and is not tracked in-flight
+	go func() {
+		reply2 := messages.ReplyCommon{}
+		reply2.Headers.MsgType = messages.MsgTypeTransactionConfirmed
+		msgContext1.(tx.TxnConfirmationContext).ReplyConfirmed(&reply2)
+	}()
+	confirmedKafkaMsg := <-mockProducer.MockInput
+	assert.Nil(confirmedKafkaMsg.Metadata)
+	mockProducer.MockSuccesses <- confirmedKafkaMsg
+	replyBytes, _ := confirmedKafkaMsg.Value.Encode()
+	var replySent messages.ReplyCommon
+	json.Unmarshal(replyBytes, &replySent)
+	assert.Equal(messages.MsgTypeTransactionConfirmed, replySent.Headers.MsgType)
+	assert.Equal(msgContext1.Headers().ID, replySent.Headers.ReqID)
+	assert.Equal("in-topic:5:500", replySent.Headers.ReqOffset)
+
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
 func TestProducerSuccessLoopPanicsMsgNotInflight(t *testing.T) {
 	assert := assert.New(t)
 
@@ -598,3 +853,275 @@ func TestProducerSuccessLoopPanicsMsgNotInflight(t *testing.T) {
 	wg.Wait()
 
 }
+
+func TestDuplicateRequestReplaysOriginalReply(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks()
+	k.conf.DedupRetentionSec = 60
+	k.dedup = kvstore.NewMockKV(nil)
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestDuplicateRequest"
+	msg1.Headers.ID = "request1"
+	msg1bytes, _ := json.Marshal(&msg1)
+
+	// First delivery is processed, and the reply recorded
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+	msgContext1 := <-processor.messages
+	assert.Equal(dedupStatusSubmitted, k.getDedupRecord("request1").Status)
+	go func() {
+		reply1 := messages.ReplyCommon{}
+		reply1.Headers.MsgType = "TestReply"
+		msgContext1.Reply(&reply1)
+	}()
+	replyKafkaMsg1 := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg1
+	replyBytes1, _ := replyKafkaMsg1.Value.Encode()
+	for mockConsumer.OffsetsByPartition[5] != 500 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// Re-delivery at a new offset is not processed, but acked with the original reply
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    501,
+		Value:     msg1bytes,
+	}
+	replyKafkaMsg2 := <-mockProducer.MockInput
+	assert.Equal("in-topic:5:501", replyKafkaMsg2.Metadata)
+	mockProducer.MockSuccesses <- replyKafkaMsg2
+	replyBytes2, _ := replyKafkaMsg2.Value.Encode()
+	assert.Equal(replyBytes1, replyBytes2)
+	for mockConsumer.OffsetsByPartition[5] != 501 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(processor.messages)
+
+	// Shut down
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestDuplicateRequestConsumedBeforeProcessing(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _, mockConsumer, mockProducer, wg := setupMocks()
+	k.conf.DedupRetentionSec = 60
+	k.dedup = kvstore.NewMockKV(nil)
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestDuplicateRequest"
+	msg1.Headers.ID = "request1"
+	msg1bytes, _ := json.Marshal(&msg1)
+
+	// Both deliveries are consumed, on different ordering lanes, before either is processed
+	k.inFlightCond.L.Lock()
+	msgContext1, err := k.addInflightMsg(&sarama.ConsumerMessage{Topic: "in-topic", Partition: 5, Offset: 500, Value: msg1bytes}, mockProducer)
+	assert.NoError(err)
+	msgContext2, err := k.addInflightMsg(&sarama.ConsumerMessage{Topic: "in-topic", Partition: 6, Offset: 600, Value: msg1bytes}, mockProducer)
+	assert.NoError(err)
+	k.inFlightCond.L.Unlock()
+	assert.NotEqual(msgContext1.orderingKey, msgContext2.orderingKey)
+	assert.Nil(msgContext1.dedupPrevious)
+	assert.True(msgContext1.dedupReserved)
+	assert.NotNil(msgContext2.dedupPrevious)
+	assert.False(msgContext2.dedupReserved)
+
+	// The reservation is released once the first is replied to, leaving the stored record
+	go func() {
+		reply1 := messages.ReplyCommon{}
+		reply1.Headers.MsgType = "TestReply"
+		msgContext1.Reply(&reply1)
+	}()
+	replyKafkaMsg1 := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg1
+	k.inFlightCond.L.Lock()
+	assert.Empty(k.dedupActive)
+	k.inFlightCond.L.Unlock()
+	assert.Equal(dedupStatusComplete, k.getDedupRecord("request1").Status)
+
+	// Shut down
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestDuplicateRequestExpired(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newTestKafkaBridge()
+	k.conf.DedupRetentionSec = 60
+	mockKV := kvstore.NewMockKV(nil)
+	k.dedup = mockKV
+
+	old, _ := json.Marshal(&dedupRecord{
+		Processed: time.Now().Add(-2 * time.Minute),
+		Reply:     []byte(`{}`),
+	})
+	mockKV.KVS["request1"] = old
+	mockKV.KVS["request2"] = []byte("!json")
+	k.putDedupRecord("request3", dedupStatusComplete, []byte(`{"headers":{}}`))
+
+	assert.Nil(k.getDedupRecord("request1"))
+	assert.NotContains(mockKV.KVS, "request1")
+	assert.Nil(k.getDedupRecord("request2"))
+	assert.Nil(k.getDedupRecord("request4"))
+	assert.Equal(`{"headers":{}}`, string(k.getDedupRecord("request3").Reply))
+}
+
+func TestDuplicateRequestPurge(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkadedup")
+	defer os.RemoveAll(dir)
+	db, err := kvstore.NewLDBKeyValueStore(dir)
+	assert.NoError(err)
+	defer db.Close()
+
+	k, _ := newTestKafkaBridge()
+	k.conf.DedupRetentionSec = 60
+	k.dedup = db
+	old, _ := json.Marshal(&dedupRecord{
+		Processed: time.Now().Add(-2 * time.Minute),
+		Reply:     []byte(`{}`),
+	})
+	db.Put("request1", old)
+	k.putDedupRecord("request2", dedupStatusComplete, []byte(`{}`))
+
+	k.purgeDedupRecords()
+
+	_, err = db.Get("request1")
+	assert.Error(err)
+	_, err = db.Get("request2")
+	assert.NoError(err)
+}
+
+func TestDuplicateRequestSubmittedNoReply(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks()
+	k.conf.DedupRetentionSec = 60
+	k.dedup = kvstore.NewMockKV(nil)
+	k.putDedupRecord("request1", dedupStatusSubmitted, nil)
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestDuplicateRequest"
+	msg1.Headers.ID = "request1"
+	msg1bytes, _ := json.Marshal(&msg1)
+
+	// The original was interrupted after submission, so we must not submit again
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+	replyKafkaMsg := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg
+	replyBytes, _ := replyKafkaMsg.Value.Encode()
+	var errReply messages.ErrorReply
+	json.Unmarshal(replyBytes, &errReply)
+	assert.Equal(messages.MsgTypeError, errReply.Headers.MsgType)
+	assert.Regexp("already been submitted", errReply.ErrorMessage)
+	for mockConsumer.OffsetsByPartition[5] != 500 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(processor.messages)
+	assert.Equal(dedupStatusSubmitted, k.getDedupRecord("request1").Status)
+
+	// Shut down
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestDuplicateRequestTransientErrorNotRecorded(t *testing.T) {
+	assert := assert.New(t)
+
+	k, processor, mockConsumer, mockProducer, wg := setupMocks()
+	k.conf.DedupRetentionSec = 60
+	k.dedup = kvstore.NewMockKV(nil)
+
+	msg1 := messages.RequestCommon{}
+	msg1.Headers.MsgType = "TestDuplicateRequest"
+	msg1.Headers.ID = "request1"
+	msg1bytes, _ := json.Marshal(&msg1)
+
+	// An error before submission removes the record, so a re-delivery is processed again
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    500,
+		Value:     msg1bytes,
+	}
+	msgContext1 := <-processor.messages
+	go msgContext1.SendErrorReply(500, fmt.Errorf("pop"))
+	replyKafkaMsg1 := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg1
+	for mockConsumer.OffsetsByPartition[5] != 500 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Nil(k.getDedupRecord("request1"))
+
+	// An error after submission is the outcome of the request, so is recorded
+	mockConsumer.MockMessages <- &sarama.ConsumerMessage{
+		Topic:     "in-topic",
+		Partition: 5,
+		Offset:    501,
+		Value:     msg1bytes,
+	}
+	msgContext2 := <-processor.messages
+	go msgContext2.SendErrorReplyWithTX(500, fmt.Errorf("pop"), "0x12345")
+	replyKafkaMsg2 := <-mockProducer.MockInput
+	mockProducer.MockSuccesses <- replyKafkaMsg2
+	for mockConsumer.OffsetsByPartition[5] != 501 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Equal(dedupStatusComplete, k.getDedupRecord("request1").Status)
+
+	// Shut down
+	mockProducer.AsyncClose()
+	mockConsumer.Close()
+	wg.Wait()
+}
+
+func TestDuplicateRequestPurgeLoop(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkadedup")
+	defer os.RemoveAll(dir)
+	db, err := kvstore.NewLDBKeyValueStore(dir)
+	assert.NoError(err)
+	defer db.Close()
+
+	k, _ := newTestKafkaBridge()
+	k.conf.DedupRetentionSec = 1
+	k.dedup = db
+	old, _ := json.Marshal(&dedupRecord{
+		Processed: time.Now().Add(-2 * time.Second),
+	})
+	db.Put("request1", old)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		k.dedupPurgeLoop(stop)
+		close(done)
+	}()
+	for {
+		if _, err = db.Get("request1"); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+}
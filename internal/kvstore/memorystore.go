@@ -0,0 +1,107 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// memoryKeyValueStore holds the keys in memory, for ephemeral environments where
+// nothing should outlive the process. Missing keys return the same error as LevelDB
+type memoryKeyValueStore struct {
+	mux sync.RWMutex
+	kvs map[string][]byte
+}
+
+func (m *memoryKeyValueStore) Put(key string, val []byte) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.kvs[key] = append([]byte{}, val...)
+	return nil
+}
+
+func (m *memoryKeyValueStore) Get(key string) ([]byte, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	v, exists := m.kvs[key]
+	if !exists {
+		return nil, leveldb.ErrNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (m *memoryKeyValueStore) Delete(key string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.kvs, key)
+	return nil
+}
+
+// NewIterator iterates a snapshot of the store in key order, as LevelDB does
+func (m *memoryKeyValueStore) NewIterator() KVIterator {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	it := &memoryKeyIterator{
+		keys: make([]string, 0, len(m.kvs)),
+		vals: make(map[string][]byte, len(m.kvs)),
+		pos:  -1,
+	}
+	for k, v := range m.kvs {
+		it.keys = append(it.keys, k)
+		it.vals[k] = v
+	}
+	sort.Strings(it.keys)
+	return it
+}
+
+func (m *memoryKeyValueStore) Close() {}
+
+type memoryKeyIterator struct {
+	keys []string
+	vals map[string][]byte
+	pos  int
+}
+
+func (k *memoryKeyIterator) Key() string {
+	if k.pos < 0 || k.pos >= len(k.keys) {
+		return ""
+	}
+	return k.keys[k.pos]
+}
+
+func (k *memoryKeyIterator) Value() []byte {
+	return k.vals[k.Key()]
+}
+
+func (k *memoryKeyIterator) Next() bool {
+	if k.pos < len(k.keys) {
+		k.pos++
+	}
+	return k.pos < len(k.keys)
+}
+
+func (k *memoryKeyIterator) Release() {
+	k.pos = len(k.keys)
+}
+
+// NewMemoryKeyValueStore construct a new in-memory instance of a KV store
+func NewMemoryKeyValueStore() KVStore {
+	return &memoryKeyValueStore{
+		kvs: make(map[string][]byte),
+	}
+}
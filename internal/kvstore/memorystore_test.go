@@ -0,0 +1,50 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryKeyValueStore(t *testing.T) {
+	assert := assert.New(t)
+
+	kv := NewMemoryKeyValueStore()
+	defer kv.Close()
+	kv.Put("key2", []byte("val2"))
+	kv.Put("key1", []byte("val1"))
+	kv.Put("key3", []byte("val3"))
+	v, err := kv.Get("key1")
+	assert.NoError(err)
+	assert.Equal("val1", string(v))
+
+	err = kv.Delete("key3")
+	assert.NoError(err)
+	_, err = kv.Get("key3")
+	assert.EqualError(err, "leveldb: not found")
+
+	it := kv.NewIterator()
+	kv.Put("key4", []byte("val4"))
+	keys := []string{}
+	for it.Next() {
+		keys = append(keys, it.Key()+"="+string(it.Value()))
+	}
+	it.Release()
+	assert.Equal([]string{"key1=val1", "key2=val2"}, keys)
+	assert.False(it.Next())
+	assert.Equal("", it.Key())
+}
@@ -19,6 +19,7 @@ import (
 	"reflect"
 
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
 )
 
 const (
@@ -32,10 +33,33 @@ const (
 	MsgTypeTransactionSuccess = "TransactionSuccess"
 	// MsgTypeTransactionFailure - a transaction receipt where status is 0
 	MsgTypeTransactionFailure = "TransactionFailure"
+	// MsgTypeTransactionConfirmed - a follow-up receipt, once the configured number of blocks have been mined on top of the transaction
+	MsgTypeTransactionConfirmed = "TransactionConfirmed"
+	// MsgTypeTransactionProgress - an intermediate status update for an async deployment, before its receipt
+	MsgTypeTransactionProgress = "TransactionProgress"
+	// MsgTypeDeployContractDryRun - the transaction a deployment would submit, for a deployment made with dryRun set
+	MsgTypeDeployContractDryRun = "DeployContractDryRun"
+	// MsgTypeRPCCall - invoke an allow-listed JSON/RPC method on the node
+	MsgTypeRPCCall = "RPCCall"
+	// MsgTypeRPCCallResult - the raw result of an RPCCall
+	MsgTypeRPCCallResult = "RPCCallResult"
 	// RecordHeaderAccessToken - record header name for passing JWT token over messaging
 	RecordHeaderAccessToken = "fly-accesstoken"
 )
 
+const (
+	// ProgressStageCompiled - the bytecode and constructor parameters have been packed into a transaction
+	ProgressStageCompiled = "compiled"
+	// ProgressStageSigned - the transaction has been signed by ethconnect, rather than the node
+	ProgressStageSigned = "signed"
+	// ProgressStageSubmitted - the node has accepted the transaction, and returned its hash
+	ProgressStageSubmitted = "submitted"
+	// ProgressStageMined - the transaction has been mined, and the receipt follows
+	ProgressStageMined = "mined"
+	// ProgressStageRegistered - the deployed contract has been registered in the REST gateway
+	ProgressStageRegistered = "registered"
+)
+
 // AsyncSentMsg is a standard response for async requests
 type AsyncSentMsg struct {
 	Sent    bool   `json:"sent"`
@@ -68,6 +92,8 @@ type ReplyHeaders struct {
 	Elapsed   float64 `json:"timeElapsed"`
 	ReqOffset string  `json:"requestOffset"`
 	ReqID     string  `json:"requestId"`
+	// SchemaVersion is the ReplySchemaVersion the reply was generated with
+	SchemaVersion int `json:"schemaVersion,omitempty"`
 }
 
 // ReplyWithHeaders gives common access the reply headers
@@ -106,11 +132,13 @@ type TransactionCommon struct {
 	From           string        `json:"from"`
 	Value          json.Number   `json:"value"`
 	Gas            json.Number   `json:"gas"`
+	MaxGas         json.Number   `json:"maxGas,omitempty"`
 	GasPrice       json.Number   `json:"gasPrice"`
 	Parameters     []interface{} `json:"params"`
 	PrivateFrom    string        `json:"privateFrom,omitempty"`
 	PrivateFor     []string      `json:"privateFor,omitempty"`
 	PrivacyGroupID string        `json:"privacyGroupId,omitempty"`
+	Signer         string        `json:"signer,omitempty"`
 }
 
 // SendTransaction message instructs the bridge to install a contract
@@ -119,20 +147,73 @@ type SendTransaction struct {
 	To         string                           `json:"to"`
 	Method     *ethbinding.ABIElementMarshaling `json:"method,omitempty"`
 	MethodName string                           `json:"methodName,omitempty"`
+	Data       string                           `json:"data,omitempty"`
+	Errors     ethbinding.ABIMarshaling         `json:"errors,omitempty"`
+	// EIP-4844 fields, for a type 3 transaction carrying blobs already supplied to the node
+	BlobVersionedHashes []string    `json:"blobVersionedHashes,omitempty"`
+	MaxFeePerBlobGas    json.Number `json:"maxFeePerBlobGas,omitempty"`
 }
 
 // DeployContract message instructs the bridge to install a contract
 type DeployContract struct {
 	TransactionCommon
-	Solidity        string                   `json:"solidity,omitempty"`
-	CompilerVersion string                   `json:"compilerVersion,omitempty"`
-	EVMVersion      string                   `json:"evmVersion,omitempty"`
-	ABI             ethbinding.ABIMarshaling `json:"abi,omitempty"`
-	DevDoc          string                   `json:"devDocs,omitempty"`
-	Compiled        []byte                   `json:"compiled,omitempty"`
-	ContractName    string                   `json:"contractName,omitempty"`
-	Description     string                   `json:"description,omitempty"`
-	RegisterAs      string                   `json:"registerAs,omitempty"`
+	Solidity         string                   `json:"solidity,omitempty"`
+	Git              *GitSource               `json:"git,omitempty"`
+	CompilerVersion  string                   `json:"compilerVersion,omitempty"`
+	EVMVersion       string                   `json:"evmVersion,omitempty"`
+	ABI              ethbinding.ABIMarshaling `json:"abi,omitempty"`
+	DevDoc           string                   `json:"devDocs,omitempty"`
+	UserDoc          string                   `json:"userDocs,omitempty"`
+	Compiled         []byte                   `json:"compiled,omitempty"`
+	CompiledRuntime  []byte                   `json:"compiledRuntime,omitempty"`
+	ContractName     string                   `json:"contractName,omitempty"`
+	Description      string                   `json:"description,omitempty"`
+	RegisterAs       string                   `json:"registerAs,omitempty"`
+	CompilerWarnings []string                 `json:"compilerWarnings,omitempty"`
+	DryRun           bool                     `json:"dryRun,omitempty"`
+	// SingletonFactory deploys the contract through the ERC-2470 singleton factory, at an address
+	// that only depends on the code, constructor arguments and Salt
+	SingletonFactory bool   `json:"singletonFactory,omitempty"`
+	Salt             string `json:"salt,omitempty"`
+}
+
+// GitSource is the git repository, ref and path of the Solidity to compile for a deployment, as an
+// alternative to supplying the source. Commit is set to the commit the ref resolved to when compiled
+type GitSource struct {
+	URL    string `json:"url"`
+	Ref    string `json:"ref"`
+	Path   string `json:"path"`
+	Commit string `json:"commit,omitempty"`
+}
+
+// DeployContractDryRun is the reply to a deployment with dryRun set. It describes the unsigned
+// transaction that would have been submitted, after compiling and estimating gas, without signing or broadcasting it
+type DeployContractDryRun struct {
+	ReplyCommon
+	From               string                 `json:"from"`
+	NonceStr           string                 `json:"nonce"`
+	ContractAddress    *ethbinding.Address    `json:"contractAddress"`
+	Data               string                 `json:"data"`
+	GasStr             string                 `json:"gas"`
+	GasPriceStr        string                 `json:"gasPrice"`
+	EstimatedCostStr   string                 `json:"estimatedCost"`
+	EstimatedCostEther string                 `json:"estimatedCostEther"`
+	StageTimes         *TransactionStageTimes `json:"stageTimes,omitempty"`
+}
+
+// RPCCall message instructs the bridge to invoke a JSON/RPC method on the node, for occasional
+// admin and diagnostic needs. Only the methods in the allow list of the bridge can be invoked
+type RPCCall struct {
+	RequestCommon
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// RPCCallResult is the reply to an RPCCall, containing the result exactly as returned by the node
+type RPCCallResult struct {
+	ReplyCommon
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
 }
 
 // TransactionReceipt is sent when a transaction has been successfully mined
@@ -140,32 +221,82 @@ type DeployContract struct {
 // ethereum hex encoding version
 type TransactionReceipt struct {
 	ReplyCommon
-	BlockHash            *ethbinding.Hash      `json:"blockHash"`
-	BlockNumberStr       string                `json:"blockNumber"`
-	BlockNumberHex       *ethbinding.HexBigInt `json:"blockNumberHex,omitempty"`
-	ContractSwagger      string                `json:"openapi,omitempty"`
-	ContractUI           string                `json:"apiexerciser,omitempty"`
-	ContractAddress      *ethbinding.Address   `json:"contractAddress,omitempty"`
-	CumulativeGasUsedStr string                `json:"cumulativeGasUsed"`
-	CumulativeGasUsedHex *ethbinding.HexBigInt `json:"cumulativeGasUsedHex,omitempty"`
-	From                 *ethbinding.Address   `json:"from"`
-	GasUsedStr           string                `json:"gasUsed"`
-	GasUsedHex           *ethbinding.HexBigInt `json:"gasUsedHex,omitempty"`
-	NonceStr             string                `json:"nonce"`
-	NonceHex             *ethbinding.HexUint64 `json:"nonceHex,omitempty"`
-	StatusStr            string                `json:"status"`
-	StatusHex            *ethbinding.HexBigInt `json:"statusHex,omitempty"`
-	To                   *ethbinding.Address   `json:"to"`
-	TransactionHash      *ethbinding.Hash      `json:"transactionHash"`
-	TransactionIndexStr  string                `json:"transactionIndex"`
-	TransactionIndexHex  *ethbinding.HexUint   `json:"transactionIndexHex,omitempty"`
-	RegisterAs           string                `json:"registerAs,omitempty"`
+	BlockHash            *ethbinding.Hash       `json:"blockHash"`
+	BlockNumberStr       string                 `json:"blockNumber"`
+	BlockNumberHex       *ethbinding.HexBigInt  `json:"blockNumberHex,omitempty"`
+	BlockTimestamp       string                 `json:"blockTimestamp,omitempty"`
+	ConfirmationsStr     string                 `json:"confirmations,omitempty"`
+	ContractSwagger      string                 `json:"openapi,omitempty"`
+	ContractUI           string                 `json:"apiexerciser,omitempty"`
+	ContractAddress      *ethbinding.Address    `json:"contractAddress,omitempty"`
+	CumulativeGasUsedStr string                 `json:"cumulativeGasUsed"`
+	CumulativeGasUsedHex *ethbinding.HexBigInt  `json:"cumulativeGasUsedHex,omitempty"`
+	EffectiveGasPriceStr string                 `json:"effectiveGasPrice,omitempty"`
+	EffectiveGasPriceHex *ethbinding.HexBigInt  `json:"effectiveGasPriceHex,omitempty"`
+	FeeStr               string                 `json:"fee,omitempty"`
+	FeeHex               *ethbinding.HexBigInt  `json:"feeHex,omitempty"`
+	FeeEther             string                 `json:"feeEther,omitempty"`
+	From                 *ethbinding.Address    `json:"from"`
+	GasUsedStr           string                 `json:"gasUsed"`
+	GasUsedHex           *ethbinding.HexBigInt  `json:"gasUsedHex,omitempty"`
+	NonceStr             string                 `json:"nonce"`
+	NonceHex             *ethbinding.HexUint64  `json:"nonceHex,omitempty"`
+	StatusStr            string                 `json:"status"`
+	StatusHex            *ethbinding.HexBigInt  `json:"statusHex,omitempty"`
+	To                   *ethbinding.Address    `json:"to"`
+	TransactionHash      *ethbinding.Hash       `json:"transactionHash"`
+	TransactionIndexStr  string                 `json:"transactionIndex"`
+	TransactionIndexHex  *ethbinding.HexUint    `json:"transactionIndexHex,omitempty"`
+	RegisterAs           string                 `json:"registerAs,omitempty"`
+	RevertReason         string                 `json:"revertReason,omitempty"`
+	AlreadyDeployed      bool                   `json:"alreadyDeployed,omitempty"`
+	Events               []*ReceiptEvent        `json:"events,omitempty"`
+	StageTimes           *TransactionStageTimes `json:"stageTimes,omitempty"`
+}
+
+// ReceiptEvent is an event emitted by a transaction, decoded using the ABI of the contract.
+// Deployment receipts include the events emitted by the constructor
+type ReceiptEvent struct {
+	Address   string                 `json:"address"`
+	Signature string                 `json:"signature"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// TransactionStageTimes are the seconds spent in each stage of processing a transaction,
+// for diagnosing where the latency of a transaction comes from
+type TransactionStageTimes struct {
+	Compile     float64 `json:"compile,omitempty"`
+	GasEstimate float64 `json:"gasEstimate,omitempty"`
+	Sign        float64 `json:"sign,omitempty"`
+	Submit      float64 `json:"submit,omitempty"`
+	Receipt     float64 `json:"receipt,omitempty"`
+}
+
+// TransactionProgress is sent as an async deployment passes through each stage, so long running
+// deployments can be observed rather than waiting for the receipt
+type TransactionProgress struct {
+	ReplyCommon
+	Stage           string `json:"stage"`
+	TransactionHash string `json:"transactionHash,omitempty"`
+	NonceStr        string `json:"nonce,omitempty"`
+	BlockNumberStr  string `json:"blockNumber,omitempty"`
+	ContractAddress string `json:"contractAddress,omitempty"`
+}
+
+// NewTransactionProgress is a helper to construct a progress message for a stage
+func NewTransactionProgress(stage string) *TransactionProgress {
+	var progress TransactionProgress
+	progress.Headers.MsgType = MsgTypeTransactionProgress
+	progress.Stage = stage
+	return &progress
 }
 
 // ErrorReply is
 type ErrorReply struct {
 	ReplyCommon
 	ErrorMessage     string `json:"errorMessage,omitempty"`
+	Retryable        bool   `json:"retryable"`
+	AlreadySubmitted bool   `json:"alreadySubmitted,omitempty"`
 	OriginalMessage  string `json:"requestPayload,omitempty"`
 	TXHash           string `json:"transactionHash,omitempty"`
 	GapFillTxHash    string `json:"gapFillTxHash,omitempty"`
@@ -178,6 +309,8 @@ func NewErrorReply(err error, origMsg interface{}) *ErrorReply {
 	errMsg.Headers.MsgType = MsgTypeError
 	if err != nil {
 		errMsg.ErrorMessage = err.Error()
+		errMsg.Retryable = errors.IsRetryable(err)
+		errMsg.AlreadySubmitted = errors.IsAlreadySubmitted(err)
 	}
 	if reflect.TypeOf(origMsg).Kind() == reflect.Slice {
 		errMsg.OriginalMessage = string(origMsg.([]byte))
@@ -64,6 +64,7 @@ func TestJSONEncodingAssumptions(t *testing.T) {
 	json.Unmarshal(marshaledErrMsg, &unmarshaledErrMsg)
 	assert.Equal(MsgTypeError, unmarshaledErrMsg.ReplyHeaders().MsgType)
 	assert.Equal("pop", unmarshaledErrMsg.ErrorMessage)
+	assert.False(unmarshaledErrMsg.Retryable)
 	assert.NotEmpty(unmarshaledErrMsg.OriginalMessage)
 
 }
@@ -90,6 +91,25 @@ func TestErrorMessageForUnparsableBinaryData(t *testing.T) {
 	assert.Equal("\u0000\ufffd\ufffd\ufffd\ufffd", unmarshaledErrMsg.OriginalMessage)
 }
 
+func TestErrorMessageRetryable(t *testing.T) {
+	assert := assert.New(t)
+
+	exampleErrMsg := NewErrorReply(fmt.Errorf("replacement transaction underpriced"), []byte{})
+	marshaledErrMsg, _ := json.Marshal(&exampleErrMsg)
+	var unmarshaledErrMsg map[string]interface{}
+	json.Unmarshal(marshaledErrMsg, &unmarshaledErrMsg)
+	assert.Equal(true, unmarshaledErrMsg["retryable"])
+	assert.Nil(unmarshaledErrMsg["alreadySubmitted"])
+}
+
+func TestErrorMessageAlreadySubmitted(t *testing.T) {
+	assert := assert.New(t)
+
+	exampleErrMsg := NewErrorReply(fmt.Errorf("nonce too low"), []byte{})
+	assert.False(exampleErrMsg.Retryable)
+	assert.True(exampleErrMsg.AlreadySubmitted)
+}
+
 func TestIsReceiptForReceipt(t *testing.T) {
 	assert := assert.New(t)
 	var m ReplyWithHeaders
@@ -0,0 +1,120 @@
+// Copyright 2018, 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+const (
+	// ReplySchemaVersion is the version of the schema of the replies generated by this build, which
+	// is set in the schemaVersion header of each reply. Adding an optional field does not change the
+	// version. Removing, renaming or changing the format of a field does, and comes with a shim
+	// that translates replies back to the previous version
+	ReplySchemaVersion = 2
+	// MinReplySchemaVersion is the oldest version that replies can be translated to
+	MinReplySchemaVersion = 1
+)
+
+// replySchemaShims translate a reply to the version of their key, from the version after it
+var replySchemaShims = map[int]func(reply map[string]interface{}){
+	1: replySchemaV1,
+}
+
+// replyFieldsAddedAfterV1 are the fields of each type of reply that were added by the receipt
+// enrichment after version 1, which did not have a schemaVersion header
+var replyFieldsAddedAfterV1 = map[string][]string{
+	MsgTypeTransactionSuccess: {"blockTimestamp", "confirmations", "effectiveGasPrice", "effectiveGasPriceHex", "fee", "feeHex", "feeEther", "revertReason", "alreadyDeployed", "events", "stageTimes"},
+	MsgTypeTransactionFailure: {"blockTimestamp", "confirmations", "effectiveGasPrice", "effectiveGasPriceHex", "fee", "feeHex", "feeEther", "revertReason", "alreadyDeployed", "events", "stageTimes"},
+	MsgTypeError:              {"retryable"},
+}
+
+func replySchemaV1(reply map[string]interface{}) {
+	headers, _ := reply["headers"].(map[string]interface{})
+	msgType, _ := headers["type"].(string)
+	for _, field := range replyFieldsAddedAfterV1[msgType] {
+		delete(reply, field)
+	}
+	delete(headers, "schemaVersion")
+}
+
+// ParseReplySchemaVersion checks a requested schema version is one replies can be translated to
+func ParseReplySchemaVersion(s string) (int, error) {
+	version, err := strconv.Atoi(s)
+	if err != nil || version < MinReplySchemaVersion || version > ReplySchemaVersion {
+		return 0, errors.Errorf(errors.ReplySchemaVersionUnsupported, s, MinReplySchemaVersion, ReplySchemaVersion)
+	}
+	return version, nil
+}
+
+// storedSchemaVersion returns the schema version a reply was stored in, and false if the headers
+// of the reply cannot be read without a copy of it
+func storedSchemaVersion(reply map[string]interface{}) (int, bool) {
+	headers, ok := reply["headers"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	switch v := headers["schemaVersion"].(type) {
+	case nil:
+		return ReplySchemaVersion, true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return int(n), err == nil
+	default:
+		return 0, false
+	}
+}
+
+// TranslateReply returns a copy of a stored reply in an older version of the schema. Replies
+// stored without a schemaVersion header were generated before it was added, and only hold fields
+// of the current version. Replies are never translated to a newer version than they were stored in,
+// so a reply already in the requested version, or an older one, is returned unchanged
+func TranslateReply(reply map[string]interface{}, version int) map[string]interface{} {
+	if from, ok := storedSchemaVersion(reply); ok && from <= version {
+		return reply
+	}
+	// The copy is made through JSON, so values decoded by any receipt store have the same types.
+	// Numbers are kept as json.Number, so large integers do not lose precision in a float64
+	b, _ := json.Marshal(reply)
+	var translated map[string]interface{}
+	utils.UnmarshalJSONNumbers(b, &translated)
+	headers, ok := translated["headers"].(map[string]interface{})
+	if !ok {
+		return translated
+	}
+	from := ReplySchemaVersion
+	if stored, ok := headers["schemaVersion"].(json.Number); ok {
+		if v, err := stored.Int64(); err == nil {
+			from = int(v)
+		}
+	}
+	for v := from - 1; v >= version; v-- {
+		headers["schemaVersion"] = v
+		if shim, ok := replySchemaShims[v]; ok {
+			shim(translated)
+		}
+	}
+	return translated
+}
@@ -0,0 +1,144 @@
+// Copyright 2018, 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranslateReplyReceiptToV1(t *testing.T) {
+	assert := assert.New(t)
+
+	reply := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type":          MsgTypeTransactionSuccess,
+			"schemaVersion": ReplySchemaVersion,
+		},
+		"blockNumber": "5",
+		"fee":         "21000",
+		"events":      []interface{}{},
+	}
+	translated := TranslateReply(reply, 1)
+	assert.Equal("5", translated["blockNumber"])
+	assert.NotContains(translated, "fee")
+	assert.NotContains(translated, "events")
+	assert.NotContains(translated["headers"], "schemaVersion")
+	assert.Equal(MsgTypeTransactionSuccess, translated["headers"].(map[string]interface{})["type"])
+
+	// The original is not modified
+	assert.Equal("21000", reply["fee"])
+	assert.Equal(ReplySchemaVersion, reply["headers"].(map[string]interface{})["schemaVersion"])
+}
+
+func TestTranslateReplyErrorToV1(t *testing.T) {
+	assert := assert.New(t)
+
+	reply := map[string]interface{}{
+		"headers":      map[string]interface{}{"type": MsgTypeError},
+		"errorMessage": "pop",
+		"retryable":    true,
+	}
+	translated := TranslateReply(reply, 1)
+	assert.Equal("pop", translated["errorMessage"])
+	assert.NotContains(translated, "retryable")
+}
+
+func TestTranslateReplyCurrentVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	reply := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type":          MsgTypeTransactionSuccess,
+			"schemaVersion": ReplySchemaVersion,
+		},
+		"fee": "21000",
+	}
+	translated := TranslateReply(reply, ReplySchemaVersion)
+	assert.Equal("21000", translated["fee"])
+	assert.Equal(ReplySchemaVersion, translated["headers"].(map[string]interface{})["schemaVersion"])
+
+	// Returned unchanged, without a copy through JSON
+	reply["gasUsed"] = uint64(18446744073709551615)
+	translated = TranslateReply(reply, ReplySchemaVersion)
+	assert.Equal(uint64(18446744073709551615), translated["gasUsed"])
+
+	// Replies stored without a version are in the current version
+	reply = map[string]interface{}{
+		"headers": map[string]interface{}{"type": MsgTypeTransactionSuccess},
+		"fee":     "21000",
+	}
+	translated = TranslateReply(reply, ReplySchemaVersion)
+	assert.NotContains(translated["headers"], "schemaVersion")
+	assert.Equal("21000", translated["fee"])
+}
+
+func TestTranslateReplyKeepsLargeNumbers(t *testing.T) {
+	assert := assert.New(t)
+
+	reply := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type":          MsgTypeTransactionSuccess,
+			"schemaVersion": ReplySchemaVersion,
+		},
+		"gasUsed": json.Number("123456789012345678901"),
+	}
+	translated := TranslateReply(reply, 1)
+	assert.Equal(json.Number("123456789012345678901"), translated["gasUsed"])
+}
+
+func TestTranslateReplyStoredAtV1(t *testing.T) {
+	assert := assert.New(t)
+
+	reply := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type":          MsgTypeError,
+			"schemaVersion": 1,
+		},
+		"retryable": true,
+	}
+	translated := TranslateReply(reply, 1)
+	assert.Equal(true, translated["retryable"])
+
+	reply["headers"].(map[string]interface{})["schemaVersion"] = json.Number("1")
+	translated = TranslateReply(reply, 1)
+	assert.Equal(true, translated["retryable"])
+}
+
+func TestTranslateReplyNoHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	translated := TranslateReply(map[string]interface{}{"fee": "21000"}, 1)
+	assert.Equal("21000", translated["fee"])
+}
+
+func TestParseReplySchemaVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := ParseReplySchemaVersion("1")
+	assert.NoError(err)
+	assert.Equal(1, v)
+
+	_, err = ParseReplySchemaVersion("0")
+	assert.Regexp("Unsupported reply schema version '0'", err)
+
+	_, err = ParseReplySchemaVersion("3")
+	assert.Regexp("Unsupported reply schema version '3'", err)
+
+	_, err = ParseReplySchemaVersion("latest")
+	assert.Regexp("Unsupported reply schema version 'latest'", err)
+}
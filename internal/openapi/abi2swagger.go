@@ -33,6 +33,7 @@ type ABI2SwaggerConf struct {
 	ExternalSchemes  []string
 	ExternalRootPath string
 	BasicAuth        bool
+	BearerAuth       bool // the security module of the gateway verifies a bearer token on each request
 	OrionPrivateAPI  bool
 }
 
@@ -43,6 +44,7 @@ type ABI2Swagger struct {
 
 const (
 	fireflyAppCredential   = "FireflyAppCredential"
+	bearerTokenCredential  = "BearerToken"
 	inputSchemaNameSuffix  = "_inputs"
 	outputSchemaNameSuffix = "_outputs"
 )
@@ -87,7 +89,7 @@ func (c *ABI2Swagger) convert(basePath, name string, abi *ethbinding.ABI, devdoc
 				InfoProps: spec.InfoProps{
 					Version:     "1.0",
 					Title:       name,
-					Description: devdocs.Get("details").String(),
+					Description: docDescription(devdocs),
 				},
 			},
 			Host:        c.conf.ExternalHost,
@@ -98,16 +100,49 @@ func (c *ABI2Swagger) convert(basePath, name string, abi *ethbinding.ABI, devdoc
 			Parameters:  parameters,
 		},
 	}
+	swagger.SwaggerProps.SecurityDefinitions = c.securityDefinitions()
+	return swagger
+}
+
+// securityDefinitions describes how requests are authenticated, so generated clients and
+// Try-It-Out UIs send credentials. Basic auth is for app credentials checked in front of the
+// gateway, and the bearer token for the access tokens verified by its security module
+func (c *ABI2Swagger) securityDefinitions() map[string]*spec.SecurityScheme {
+	if !c.conf.BasicAuth && !c.conf.BearerAuth {
+		return nil
+	}
+	definitions := make(map[string]*spec.SecurityScheme)
 	if c.conf.BasicAuth {
-		swagger.SwaggerProps.SecurityDefinitions = map[string]*spec.SecurityScheme{
-			fireflyAppCredential: {
-				SecuritySchemeProps: spec.SecuritySchemeProps{
-					Type: "basic",
-				},
+		definitions[fireflyAppCredential] = &spec.SecurityScheme{
+			SecuritySchemeProps: spec.SecuritySchemeProps{
+				Type: "basic",
 			},
 		}
 	}
-	return swagger
+	if c.conf.BearerAuth {
+		definitions[bearerTokenCredential] = &spec.SecurityScheme{
+			SecuritySchemeProps: spec.SecuritySchemeProps{
+				Type:        "apiKey",
+				In:          "header",
+				Name:        "Authorization",
+				Description: "An access token for the security module of the gateway, supplied as 'Bearer <token>'",
+			},
+		}
+	}
+	return definitions
+}
+
+// securityRequirements are the security requirements of an operation. Each defined scheme is
+// an alternative, as only one credential can be supplied in the Authorization header
+func (c *ABI2Swagger) securityRequirements() []map[string][]string {
+	var requirements []map[string][]string
+	if c.conf.BasicAuth {
+		requirements = append(requirements, map[string][]string{fireflyAppCredential: {}})
+	}
+	if c.conf.BearerAuth {
+		requirements = append(requirements, map[string][]string{bearerTokenCredential: {}})
+	}
+	return requirements
 }
 
 func (c *ABI2Swagger) buildDefinitionsAndPaths(inst, factoryOnly, externalRegistry bool, abi *ethbinding.ABI, defs map[string]spec.Schema, paths map[string]spec.PathItem, devdocs gjson.Result) {
@@ -122,6 +157,12 @@ func (c *ABI2Swagger) buildDefinitionsAndPaths(inst, factoryOnly, externalRegist
 		for _, method := range abi.Methods {
 			c.buildMethodDefinitionsAndPath(inst, defs, paths, method.Name, method, methodsDocs)
 		}
+		if abi.HasReceive() {
+			c.buildFallbackDefinitionsAndPath(inst, defs, paths, "receive", abi.Receive, methodsDocs)
+		}
+		if abi.HasFallback() {
+			c.buildFallbackDefinitionsAndPath(inst, defs, paths, "fallback", abi.Fallback, methodsDocs)
+		}
 		for _, event := range abi.Events {
 			c.buildEventDefinitionsAndPath(inst, defs, paths, event.Name, event, devdocs.Get("events"))
 			if !inst {
@@ -191,12 +232,42 @@ func (c *ABI2Swagger) buildMethodDefinitionsAndPath(inst bool, defs map[string]s
 	return
 }
 
+// buildFallbackDefinitionsAndPath adds a POST only path for the receive or fallback function.
+// Both only accept ether, apart from the fallback function which can also be passed raw calldata
+func (c *ABI2Swagger) buildFallbackDefinitionsAndPath(inst bool, defs map[string]spec.Schema, paths map[string]spec.PathItem, name string, method ethbinding.ABIMethod, devdocs gjson.Result) {
+	_, methodSig, path, methodDocs := c.getDeclaredIDDetails(inst, name, method.Inputs, devdocs)
+	if method.IsPayable() {
+		methodSig += " [payable]"
+	}
+
+	inputSchema := name + inputSchemaNameSuffix
+	outputSchema := name + outputSchemaNameSuffix
+	c.buildArgumentsDefinition(defs, outputSchema, method.Outputs, methodDocs)
+	c.buildArgumentsDefinition(defs, inputSchema, method.Inputs, methodDocs)
+	if name == "fallback" {
+		defs[inputSchema].Properties["data"] = spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Hex encoded calldata to pass to the fallback function",
+				Type:        []string{"string"},
+				Pattern:     "^(0x)?[a-fA-F0-9]*$",
+			},
+		}
+	}
+	paths[path] = spec.PathItem{
+		PathItemProps: spec.PathItemProps{
+			Post: c.buildPOSTPath(inputSchema, outputSchema, inst, false, name, method, methodSig, methodDocs),
+		},
+	}
+}
+
 func (c *ABI2Swagger) addRegisterPath(paths map[string]spec.PathItem) {
 	pathItem := spec.PathItem{}
 	registerParam, _ := spec.NewRef("#/parameters/registerParam")
+	verifyParam, _ := spec.NewRef("#/parameters/verifyParam")
 	pathItem.Post = &spec.Operation{
 		OperationProps: spec.OperationProps{
 			ID:          "registerAddress",
+			Security:    c.securityRequirements(),
 			Summary:     "Register an existing contract address",
 			Description: "Add a friendly path for an instance of this contract already deployed to the chain",
 			Consumes:    []string{"application/json", "application/x-yaml"},
@@ -219,6 +290,11 @@ func (c *ABI2Swagger) addRegisterPath(paths map[string]spec.PathItem) {
 						Ref: registerParam,
 					},
 				},
+				{
+					Refable: spec.Refable{
+						Ref: verifyParam,
+					},
+				},
 				{
 					ParamProps: spec.ParamProps{
 						Name:     "body",
@@ -360,6 +436,18 @@ func (c *ABI2Swagger) getCommonParameters() map[string]spec.Parameter {
 			Type: "string",
 		},
 	}
+	params["dryrunParam"] = spec.Parameter{
+		ParamProps: spec.ParamProps{
+			Description:     fmt.Sprintf("Compile, estimate gas and sign the deployment, and return the transaction with its predicted contract address, without broadcasting it (header: x-%s-dryrun)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Name:            fmt.Sprintf("%s-dryrun", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
+			In:              "query",
+			Required:        false,
+			AllowEmptyValue: true,
+		},
+		SimpleSchema: spec.SimpleSchema{
+			Type: "boolean",
+		},
+	}
 	params["registerParam"] = spec.Parameter{
 		ParamProps: spec.ParamProps{
 			Description:     fmt.Sprintf("Register the installed contract on a friendly path (overwrites existing) (header: x-%s-register)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
@@ -372,9 +460,21 @@ func (c *ABI2Swagger) getCommonParameters() map[string]spec.Parameter {
 			Type: "string",
 		},
 	}
+	params["verifyParam"] = spec.Parameter{
+		ParamProps: spec.ParamProps{
+			Description:     fmt.Sprintf("Verify contract code exists at the address before registering. Set to 'bytecode' to also check it matches the compiled contract (header: x-%s-verify)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Name:            fmt.Sprintf("%s-verify", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
+			In:              "query",
+			Required:        false,
+			AllowEmptyValue: true,
+		},
+		SimpleSchema: spec.SimpleSchema{
+			Type: "string",
+		},
+	}
 	params["blocknumberParam"] = spec.Parameter{
 		ParamProps: spec.ParamProps{
-			Description:     fmt.Sprintf("The target block number for eth_call requests. One of 'earliest/latest/pending', a number or a hex string (header: x-%s-blocknumber)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
+			Description:     fmt.Sprintf("The target block number for eth_call requests. One of 'earliest/latest/pending', a number, a hex string, or an RFC3339 timestamp or date to read the state as of that time (header: x-%s-blocknumber)", utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")),
 			Name:            fmt.Sprintf("%s-blocknumber", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")),
 			In:              "query",
 			Required:        false,
@@ -389,9 +489,7 @@ func (c *ABI2Swagger) getCommonParameters() map[string]spec.Parameter {
 
 func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstructor bool) {
 
-	if c.conf.BasicAuth {
-		op.Security = append(op.Security, map[string][]string{fireflyAppCredential: {}})
-	}
+	op.Security = append(op.Security, c.securityRequirements()...)
 
 	fromParam, _ := spec.NewRef("#/parameters/fromParam")
 	valueParam, _ := spec.NewRef("#/parameters/valueParam")
@@ -403,6 +501,7 @@ func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstru
 	privateForParam, _ := spec.NewRef("#/parameters/privateForParam")
 	privacyGroupIDParam, _ := spec.NewRef("#/parameters/privacyGroupIdParam")
 	registerParam, _ := spec.NewRef("#/parameters/registerParam")
+	dryrunParam, _ := spec.NewRef("#/parameters/dryrunParam")
 	blocknumberParam, _ := spec.NewRef("#/parameters/blocknumberParam")
 	op.Parameters = append(op.Parameters, spec.Parameter{
 		Refable: spec.Refable{
@@ -464,6 +563,11 @@ func (c *ABI2Swagger) addCommonParams(op *spec.Operation, isPOST bool, isConstru
 				Ref: registerParam,
 			},
 		})
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			Refable: spec.Refable{
+				Ref: dryrunParam,
+			},
+		})
 	}
 }
 
@@ -516,7 +620,7 @@ func (c *ABI2Swagger) buildGETPath(outputSchema string, inst bool, name string,
 		OperationProps: spec.OperationProps{
 			ID:          name + "_get",
 			Summary:     methodSig,
-			Description: devdocs.Get("details").String(),
+			Description: docDescription(devdocs),
 			Produces:    []string{"application/json"},
 			Responses:   c.buildResponses(outputSchema, devdocs),
 			Parameters:  parameters,
@@ -560,7 +664,7 @@ func (c *ABI2Swagger) buildPOSTPath(inputSchema, outputSchema string, inst, cons
 		OperationProps: spec.OperationProps{
 			ID:          name + "_post",
 			Summary:     methodSig,
-			Description: devdocs.Get("details").String(),
+			Description: docDescription(devdocs),
 			Consumes:    []string{"application/json", "application/x-yaml"},
 			Produces:    []string{"application/json"},
 			Responses:   c.buildResponses(outputSchema, devdocs),
@@ -619,11 +723,12 @@ func (c *ABI2Swagger) buildEventPOSTPath(eventSchema string, inst bool, event et
 		OperationProps: spec.OperationProps{
 			ID:          id,
 			Summary:     eventSig,
-			Description: devdocs.Get("details").String(),
+			Description: docDescription(devdocs),
 			Consumes:    []string{"application/json", "application/x-yaml"},
 			Produces:    []string{"application/json"},
 			Responses:   c.buildResponses(eventSchema, devdocs),
 			Parameters:  parameters,
+			Security:    c.securityRequirements(),
 		},
 	}
 	return op
@@ -148,3 +148,67 @@ func TestABI2SwaggerUnnamedInputsABI(t *testing.T) {
 	assert.NotNil(swagger.SecurityDefinitions)
 	return
 }
+
+func TestABI2SwaggerFallbackReceive(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{
+		ExternalHost:     "localhost",
+		ExternalRootPath: "/contracts",
+	})
+	abi, err := ethbind.API.JSON(strings.NewReader(`[{"type":"fallback","stateMutability":"payable"},{"type":"receive","stateMutability":"payable"}]`))
+	assert.NoError(err)
+	swagger := c.Gen4Instance("/0x0123456789abcdef0123456789abcdef0123456", "fallback", &abi, "")
+
+	fallback := swagger.Paths.Paths["/fallback"]
+	assert.Nil(fallback.Get)
+	assert.Equal("fallback_post", fallback.Post.ID)
+	assert.Equal("fallback() [payable]", fallback.Post.Summary)
+	assert.Equal("#/definitions/fallback_inputs", fallback.Post.Parameters[0].Schema.Ref.String())
+	assert.Contains(swagger.Definitions["fallback_inputs"].Properties, "data")
+
+	receive := swagger.Paths.Paths["/receive"]
+	assert.Nil(receive.Get)
+	assert.Equal("receive_post", receive.Post.ID)
+	assert.Empty(swagger.Definitions["receive_inputs"].Properties)
+}
+
+func TestABI2SwaggerBearerAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{
+		ExternalHost:     "localhost:80",
+		ExternalRootPath: "/contracts",
+		BasicAuth:        true,
+		BearerAuth:       true,
+	})
+	abi, err := ethbind.API.JSON(strings.NewReader(erc20ABI))
+	assert.NoError(err)
+	swagger := c.Gen4Factory("/erc20", "erc20", false, false, &abi, erc20DevDocs)
+
+	bearer := swagger.SecurityDefinitions[bearerTokenCredential]
+	assert.Equal("apiKey", bearer.Type)
+	assert.Equal("header", bearer.In)
+	assert.Equal("Authorization", bearer.Name)
+	assert.Equal("basic", swagger.SecurityDefinitions[fireflyAppCredential].Type)
+
+	alternatives := []map[string][]string{{fireflyAppCredential: {}}, {bearerTokenCredential: {}}}
+	assert.Equal(alternatives, swagger.Paths.Paths["/"].Post.Security)
+	assert.Equal(alternatives, swagger.Paths.Paths["/{address}"].Post.Security)
+	assert.Equal(alternatives, swagger.Paths.Paths["/{address}/transfer"].Post.Security)
+	assert.Equal(alternatives, swagger.Paths.Paths["/{address}/balanceOf"].Get.Security)
+	assert.Equal(alternatives, swagger.Paths.Paths["/{address}/Transfer/subscribe"].Post.Security)
+}
+
+func TestABI2SwaggerBearerAuthOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{BearerAuth: true})
+	abi, err := ethbind.API.JSON(strings.NewReader(erc20ABI))
+	assert.NoError(err)
+	swagger := c.Gen4Instance("/erc20", "erc20", &abi, erc20DevDocs)
+
+	assert.Len(swagger.SecurityDefinitions, 1)
+	assert.Equal([]map[string][]string{{bearerTokenCredential: {}}}, swagger.Paths.Paths["/transfer"].Post.Security)
+	assert.Equal([]map[string][]string{{bearerTokenCredential: {}}}, swagger.Paths.Paths["/Transfer/subscribe"].Post.Security)
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"encoding/json"
+
+	"github.com/tidwall/gjson"
+)
+
+// MergeUserDoc adds the @notice comments of the NatSpec userdoc output by solc into the devdoc,
+// so both can be passed to the generator as one document. Notices are added for the contract,
+// and for each method and event, alongside the @dev details of the devdoc
+func MergeUserDoc(devdocJSON, userdocJSON string) string {
+	userdoc := gjson.Parse(userdocJSON)
+	if !userdoc.IsObject() {
+		return devdocJSON
+	}
+	var devdoc map[string]interface{}
+	if err := json.Unmarshal([]byte(devdocJSON), &devdoc); err != nil || devdoc == nil {
+		devdoc = make(map[string]interface{})
+	}
+	if notice := noticeOf(userdoc); notice != "" {
+		devdoc["notice"] = notice
+	}
+	for _, section := range []string{"methods", "events"} {
+		userdoc.Get(section).ForEach(func(sig, docs gjson.Result) bool {
+			notice := noticeOf(docs)
+			if notice == "" {
+				return true
+			}
+			sectionDocs, ok := devdoc[section].(map[string]interface{})
+			if !ok {
+				sectionDocs = make(map[string]interface{})
+				devdoc[section] = sectionDocs
+			}
+			sigDocs, ok := sectionDocs[sig.String()].(map[string]interface{})
+			if !ok {
+				sigDocs = make(map[string]interface{})
+				sectionDocs[sig.String()] = sigDocs
+			}
+			sigDocs["notice"] = notice
+			return true
+		})
+	}
+	merged, _ := json.Marshal(devdoc)
+	return string(merged)
+}
+
+// noticeOf returns the notice of a userdoc entry, which older versions of solc output as a
+// plain string rather than an object
+func noticeOf(docs gjson.Result) string {
+	if docs.Type == gjson.String {
+		return docs.String()
+	}
+	return docs.Get("notice").String()
+}
+
+// docDescription is the description of a contract, method or event. The notice written for
+// users comes first, followed by the details written for developers
+func docDescription(docs gjson.Result) string {
+	notice := docs.Get("notice").String()
+	details := docs.Get("details").String()
+	switch {
+	case notice == "":
+		return details
+	case details == "":
+		return notice
+	default:
+		return notice + "\n\n" + details
+	}
+}
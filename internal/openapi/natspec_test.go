@@ -0,0 +1,59 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+const erc20UserDocs = `{
+	"kind": "user",
+	"notice": "A token that can be transferred between accounts",
+	"methods": {
+		"transfer(address,uint256)": {"notice": "Sends tokens from your account to another"},
+		"totalSupply()": "The number of tokens that exist"
+	},
+	"events": {
+		"Transfer(address,address,uint256)": {"notice": "Emitted when tokens move between accounts"}
+	}
+}`
+
+func TestGenWithUserDocNotices(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{})
+	abi, err := ethbind.API.JSON(strings.NewReader(erc20ABI))
+	assert.NoError(err)
+	swagger := c.Gen4Factory("/erc20", "erc20", false, false, &abi, MergeUserDoc(erc20DevDocs, erc20UserDocs))
+
+	assert.Regexp("^A token that can be transferred between accounts\n\nImplementation of the basic standard token", swagger.Info.Description)
+	assert.Equal("Sends tokens from your account to another\n\nTransfer token to a specified address.", swagger.Paths.Paths["/{address}/transfer"].Post.Description)
+	assert.Equal("The number of tokens that exist\n\nTotal number of tokens in existence.", swagger.Paths.Paths["/{address}/totalSupply"].Get.Description)
+	assert.Equal("Emitted when tokens move between accounts", swagger.Paths.Paths["/{address}/Transfer/subscribe"].Post.Description)
+	assert.Equal("Approve the passed address to spend the specified amount of tokens on behalf of msg.sender. Beware that changing an allowance with this method brings the risk that someone may use both the old and the new allowance by unfortunate transaction ordering. One possible solution to mitigate this race condition is to first reduce the spender's allowance to 0 and set the desired value afterwards: https://github.com/ethereum/EIPs/issues/20#issuecomment-263524729", swagger.Paths.Paths["/{address}/approve"].Post.Description)
+}
+
+func TestMergeUserDocNoDevDoc(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.JSONEq(`{"notice":"Contract notice","methods":{"set(uint256)":{"notice":"Sets the value"}}}`,
+		MergeUserDoc("", `{"notice":"Contract notice","methods":{"set(uint256)":{"notice":"Sets the value"},"get()":{}}}`))
+	assert.Equal(erc20DevDocs, MergeUserDoc(erc20DevDocs, ""))
+	assert.Equal(erc20DevDocs, MergeUserDoc(erc20DevDocs, "null"))
+}
@@ -0,0 +1,357 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+)
+
+const (
+	// PostmanCollectionSchema is the schema of the collections returned by GenPostman
+	PostmanCollectionSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+	postmanBaseURLVar = "baseUrl"
+	sampleAddress     = "0x0000000000000000000000000000000000000000"
+)
+
+// PostmanCollection is a Postman v2.1 collection, with a request for each operation of an API
+type PostmanCollection struct {
+	Info     PostmanInfo        `json:"info"`
+	Item     []*PostmanItem     `json:"item"`
+	Variable []*PostmanVariable `json:"variable"`
+	Auth     *PostmanAuth       `json:"auth,omitempty"`
+}
+
+// PostmanInfo describes the collection
+type PostmanInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Schema      string `json:"schema"`
+}
+
+// PostmanItem is a named request in a collection
+type PostmanItem struct {
+	Name    string          `json:"name"`
+	Request *PostmanRequest `json:"request"`
+}
+
+// PostmanRequest is the method, URL, headers and body of a request
+type PostmanRequest struct {
+	Method      string       `json:"method"`
+	Description string       `json:"description,omitempty"`
+	Header      []*PostmanKV `json:"header"`
+	URL         *PostmanURL  `json:"url"`
+	Body        *PostmanBody `json:"body,omitempty"`
+}
+
+// PostmanURL is the URL of a request, with its path variables and query parameters
+type PostmanURL struct {
+	Raw      string       `json:"raw"`
+	Host     []string     `json:"host"`
+	Path     []string     `json:"path"`
+	Query    []*PostmanKV `json:"query,omitempty"`
+	Variable []*PostmanKV `json:"variable,omitempty"`
+}
+
+// PostmanKV is a header, query parameter or path variable
+type PostmanKV struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+}
+
+// PostmanBody is the raw JSON body of a request
+type PostmanBody struct {
+	Mode    string                 `json:"mode"`
+	Raw     string                 `json:"raw"`
+	Options map[string]interface{} `json:"options,omitempty"`
+}
+
+// PostmanVariable is a variable of the collection, such as the base URL of the API
+type PostmanVariable struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// PostmanAuth is the authentication used for the requests of the collection
+type PostmanAuth struct {
+	Type   string       `json:"type"`
+	Basic  []*PostmanKV `json:"basic,omitempty"`
+	Bearer []*PostmanKV `json:"bearer,omitempty"`
+}
+
+// GenPostman generates a Postman collection from the OpenAPI generated for a contract, with
+// a request for each operation. The bodies of the requests are pre-filled with sample values
+// for the inputs of the method in the ABI, so only the values need to be changed
+func GenPostman(swagger *spec.Swagger, abi *ethbinding.ABI) *PostmanCollection {
+	scheme := "http"
+	if len(swagger.Schemes) > 0 {
+		scheme = swagger.Schemes[0]
+	}
+	collection := &PostmanCollection{
+		Info: PostmanInfo{
+			Schema: PostmanCollectionSchema,
+		},
+		Item: []*PostmanItem{},
+		Variable: []*PostmanVariable{
+			{Key: postmanBaseURLVar, Value: scheme + "://" + swagger.Host + swagger.BasePath},
+		},
+	}
+	if swagger.Info != nil {
+		collection.Info.Name = swagger.Info.Title
+		collection.Info.Description = swagger.Info.Description
+	}
+	if _, exists := swagger.SecurityDefinitions[fireflyAppCredential]; exists {
+		collection.Auth = &PostmanAuth{
+			Type: "basic",
+			Basic: []*PostmanKV{
+				{Key: "username", Value: "{{username}}"},
+				{Key: "password", Value: "{{password}}"},
+			},
+		}
+		collection.Variable = append(collection.Variable,
+			&PostmanVariable{Key: "username"},
+			&PostmanVariable{Key: "password"},
+		)
+	} else if _, exists := swagger.SecurityDefinitions[bearerTokenCredential]; exists {
+		collection.Auth = &PostmanAuth{
+			Type: "bearer",
+			Bearer: []*PostmanKV{
+				{Key: "token", Value: "{{accessToken}}"},
+			},
+		}
+		collection.Variable = append(collection.Variable, &PostmanVariable{Key: "accessToken"})
+	}
+
+	paths := make([]string, 0, len(swagger.Paths.Paths))
+	for path := range swagger.Paths.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		pathItem := swagger.Paths.Paths[path]
+		if pathItem.Get != nil {
+			collection.Item = append(collection.Item, postmanItem(swagger, abi, "GET", path, pathItem.Get))
+		}
+		if pathItem.Post != nil {
+			collection.Item = append(collection.Item, postmanItem(swagger, abi, "POST", path, pathItem.Post))
+		}
+	}
+	return collection
+}
+
+func postmanItem(swagger *spec.Swagger, abi *ethbinding.ABI, method, path string, op *spec.Operation) *PostmanItem {
+	name := op.Summary
+	if name == "" {
+		name = op.ID
+	}
+	req := &PostmanRequest{
+		Method:      method,
+		Description: op.Description,
+		Header:      []*PostmanKV{},
+		URL: &PostmanURL{
+			Host: []string{"{{" + postmanBaseURLVar + "}}"},
+			Path: []string{},
+		},
+	}
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		// Postman marks path variables with a colon, rather than braces
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segment = ":" + strings.Trim(segment, "{}")
+		}
+		req.URL.Path = append(req.URL.Path, segment)
+	}
+
+	query := url.Values{}
+	for _, param := range op.Parameters {
+		if param.Ref.String() != "" {
+			if refParam, exists := swagger.Parameters[strings.TrimPrefix(param.Ref.String(), "#/parameters/")]; exists {
+				param = refParam
+			}
+		}
+		value := ""
+		if param.Default != nil {
+			value = jsonSampleString(param.Default)
+		}
+		switch param.In {
+		case "path":
+			req.URL.Variable = append(req.URL.Variable, &PostmanKV{Key: param.Name, Value: value, Description: param.Description})
+		case "query":
+			// Optional parameters are included, but disabled, so they can be found and enabled in Postman
+			req.URL.Query = append(req.URL.Query, &PostmanKV{Key: param.Name, Value: value, Description: param.Description, Disabled: !param.Required})
+			if param.Required {
+				query.Add(param.Name, value)
+			}
+		case "body":
+			req.Header = append(req.Header, &PostmanKV{Key: "Content-Type", Value: "application/json"})
+			var sample interface{}
+			if inputs := abiBodySample(abi, op.ID); inputs != nil {
+				sample = inputs
+			} else {
+				sample = schemaSample(swagger, param.Schema, 0)
+			}
+			raw, _ := json.MarshalIndent(sample, "", "  ")
+			req.Body = &PostmanBody{
+				Mode:    "raw",
+				Raw:     string(raw),
+				Options: map[string]interface{}{"raw": map[string]string{"language": "json"}},
+			}
+		}
+	}
+
+	req.URL.Raw = "{{" + postmanBaseURLVar + "}}/" + strings.Join(req.URL.Path, "/")
+	if len(query) > 0 {
+		req.URL.Raw += "?" + query.Encode()
+	}
+	return &PostmanItem{
+		Name:    method + " " + name,
+		Request: req,
+	}
+}
+
+func jsonSampleString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// abiBodySample returns a sample of the inputs of the constructor or method invoked by a POST
+// operation, or nil if the operation is not one that invokes the ABI
+func abiBodySample(abi *ethbinding.ABI, opID string) map[string]interface{} {
+	if abi == nil || !strings.HasSuffix(opID, "_post") {
+		return nil
+	}
+	name := strings.TrimSuffix(opID, "_post")
+	var method ethbinding.ABIMethod
+	switch name {
+	case "constructor":
+		method = abi.Constructor
+	case "receive":
+		method = abi.Receive
+	case "fallback":
+		method = abi.Fallback
+	default:
+		var exists bool
+		if method, exists = abi.Methods[name]; !exists {
+			return nil
+		}
+	}
+	sample := make(map[string]interface{})
+	for idx, input := range method.Inputs {
+		// Un-named inputs are named in the same way as in the OpenAPI definitions
+		argName := input.Name
+		if argName == "" {
+			argName = "input"
+			if idx != 0 {
+				argName += strconv.Itoa(idx)
+			}
+		}
+		sample[argName] = abiTypeSample(&input.Type)
+	}
+	if name == "fallback" {
+		sample["data"] = "0x"
+	}
+	return sample
+}
+
+// abiTypeSample returns a sample value of an ABI type, in the form the gateway accepts it
+func abiTypeSample(t *ethbinding.ABIType) interface{} {
+	switch t.T {
+	case ethbinding.IntTy, ethbinding.UintTy:
+		return "0"
+	case ethbinding.BoolTy:
+		return false
+	case ethbinding.AddressTy:
+		return sampleAddress
+	case ethbinding.BytesTy:
+		return "0x"
+	case ethbinding.FixedBytesTy:
+		return "0x" + strings.Repeat("00", t.Size)
+	case ethbinding.SliceTy:
+		return []interface{}{abiTypeSample(t.Elem)}
+	case ethbinding.ArrayTy:
+		items := make([]interface{}, t.Size)
+		for i := range items {
+			items[i] = abiTypeSample(t.Elem)
+		}
+		return items
+	case ethbinding.TupleTy:
+		sample := make(map[string]interface{})
+		for i, name := range t.TupleRawNames {
+			if name == "" {
+				name = t.TupleType.Field(i).Name
+			}
+			sample[name] = abiTypeSample(t.TupleElems[i])
+		}
+		return sample
+	default:
+		return ""
+	}
+}
+
+// schemaSample returns a sample value for a schema, for bodies that do not invoke the ABI -
+// such as subscribing to an event
+func schemaSample(swagger *spec.Swagger, s *spec.Schema, depth int) interface{} {
+	if s == nil || depth > 10 {
+		return nil
+	}
+	if ref := s.Ref.String(); ref != "" {
+		def, exists := swagger.Definitions[strings.TrimPrefix(ref, "#/definitions/")]
+		if !exists {
+			return nil
+		}
+		s = &def
+	}
+	if s.Default != nil {
+		return s.Default
+	}
+	typ := ""
+	if len(s.Type) > 0 {
+		typ = s.Type[0]
+	}
+	switch {
+	case typ == "boolean":
+		return false
+	case typ == "integer" || typ == "number":
+		return 0
+	case typ == "array":
+		if s.Items != nil && s.Items.Schema != nil {
+			return []interface{}{schemaSample(swagger, s.Items.Schema, depth+1)}
+		}
+		return []interface{}{}
+	case typ == "object" || len(s.Properties) > 0:
+		sample := make(map[string]interface{})
+		for name, prop := range s.Properties {
+			prop := prop
+			sample[name] = schemaSample(swagger, &prop, depth+1)
+		}
+		return sample
+	default:
+		return ""
+	}
+}
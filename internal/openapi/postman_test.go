@@ -0,0 +1,136 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+func postmanItemNamed(collection *PostmanCollection, name string) *PostmanItem {
+	for _, item := range collection.Item {
+		if item.Name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+func TestGenPostmanERC20Factory(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{
+		ExternalHost:     "localhost:8080",
+		ExternalRootPath: "/api/v1",
+		ExternalSchemes:  []string{"https"},
+		BasicAuth:        true,
+	})
+	abi, err := ethbind.API.JSON(strings.NewReader(erc20ABI))
+	assert.NoError(err)
+	collection := GenPostman(c.Gen4Factory("/abis/erc20", "erc20", false, false, &abi, erc20DevDocs), &abi)
+
+	assert.Equal("erc20", collection.Info.Name)
+	assert.Equal(PostmanCollectionSchema, collection.Info.Schema)
+	assert.Equal("baseUrl", collection.Variable[0].Key)
+	assert.Equal("https://localhost:8080/api/v1/abis/erc20", collection.Variable[0].Value)
+	assert.Equal("basic", collection.Auth.Type)
+
+	transfer := postmanItemNamed(collection, "POST transfer(address,uint256)")
+	assert.NotNil(transfer)
+	assert.Equal("POST", transfer.Request.Method)
+	assert.Equal([]string{":address", "transfer"}, transfer.Request.URL.Path)
+	assert.Equal("{{baseUrl}}/:address/transfer", transfer.Request.URL.Raw)
+	assert.Equal("address", transfer.Request.URL.Variable[0].Key)
+	var body map[string]interface{}
+	err = json.Unmarshal([]byte(transfer.Request.Body.Raw), &body)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"to":    "0x0000000000000000000000000000000000000000",
+		"value": "0",
+	}, body)
+	for _, q := range transfer.Request.URL.Query {
+		assert.True(q.Disabled)
+	}
+
+	balanceOf := postmanItemNamed(collection, "GET balanceOf(address) [read only]")
+	assert.NotNil(balanceOf)
+	assert.Nil(balanceOf.Request.Body)
+	assert.Equal("{{baseUrl}}/:address/balanceOf?owner=", balanceOf.Request.URL.Raw)
+
+	constructor := postmanItemNamed(collection, "POST constructor()")
+	assert.NotNil(constructor)
+	assert.Equal("{{baseUrl}}/", constructor.Request.URL.Raw)
+	assert.Equal("{}", constructor.Request.Body.Raw)
+
+	subscribe := postmanItemNamed(collection, "POST Transfer(address,address,uint256) [event]")
+	assert.NotNil(subscribe)
+	body = nil
+	err = json.Unmarshal([]byte(subscribe.Request.Body.Raw), &body)
+	assert.NoError(err)
+	assert.Equal("latest", body["fromBlock"])
+}
+
+func TestGenPostmanTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{
+		ExternalHost: "localhost",
+	})
+	abi, err := ethbind.API.JSON(strings.NewReader(`[
+		{"type":"function","name":"setAll","stateMutability":"nonpayable","inputs":[
+			{"name":"","type":"bool[2]"},
+			{"name":"b","type":"bytes4"},
+			{"name":"t","type":"tuple","components":[{"name":"id","type":"uint8"},{"name":"tags","type":"string[]"}]}
+		],"outputs":[]},
+		{"type":"fallback","stateMutability":"payable"}
+	]`))
+	assert.NoError(err)
+	collection := GenPostman(c.Gen4Instance("/contracts/types", "types", &abi, ""), &abi)
+	assert.Nil(collection.Auth)
+
+	var body map[string]interface{}
+	err = json.Unmarshal([]byte(postmanItemNamed(collection, "POST setAll(bool[2],bytes4,(uint8,string[]))").Request.Body.Raw), &body)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{
+		"input": []interface{}{false, false},
+		"b":     "0x00000000",
+		"t": map[string]interface{}{
+			"id":   "0",
+			"tags": []interface{}{""},
+		},
+	}, body)
+
+	body = nil
+	err = json.Unmarshal([]byte(postmanItemNamed(collection, "POST fallback() [payable]").Request.Body.Raw), &body)
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{"data": "0x"}, body)
+}
+
+func TestGenPostmanBearerAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{BearerAuth: true})
+	abi, err := ethbind.API.JSON(strings.NewReader(erc20ABI))
+	assert.NoError(err)
+	collection := GenPostman(c.Gen4Instance("/contracts/erc20", "erc20", &abi, ""), &abi)
+
+	assert.Equal("bearer", collection.Auth.Type)
+	assert.Equal("{{accessToken}}", collection.Auth.Bearer[0].Value)
+	assert.Equal("accessToken", collection.Variable[len(collection.Variable)-1].Key)
+}
@@ -0,0 +1,542 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/go-openapi/jsonreference"
+	"github.com/go-openapi/spec"
+	"github.com/kaleido-io/ethconnect/internal/events"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+// systemAPIParam is a query parameter of a system API route
+type systemAPIParam struct {
+	name string
+	typ  string
+	desc string
+}
+
+// systemAPIFlyParam is a query parameter that is named with the configured short prefix,
+// and can also be supplied as a header named with the long prefix
+type systemAPIFlyParam struct {
+	name string
+	typ  string
+	desc string
+	enum []interface{}
+}
+
+// systemAPIRoute describes one of the built-in (non-contract) REST APIs
+type systemAPIRoute struct {
+	method      string
+	path        string
+	id          string
+	tag         string
+	summary     string
+	query       []systemAPIParam
+	flyQuery    []systemAPIFlyParam
+	body        string
+	result      string
+	resultArray bool
+	status      int
+	produces    string
+}
+
+var systemAPIPathParamRegex = regexp.MustCompile(`{([^}]+)}`)
+
+var systemAPIRoutes = []systemAPIRoute{
+	{method: "GET", path: "/status", id: "getStatus", tag: "status", summary: "Check the gateway is running", result: "object"},
+	{method: "GET", path: "/status/transactions", id: "getInflightTransactions", tag: "status", summary: "List the transactions currently in-flight with the node", result: "object"},
+	{method: "POST", path: "/admin/auth/reload", id: "reloadAuth", tag: "status", summary: "Reload the configuration of the security module plugin, such as its keys and role mappings, without a restart", result: "object"},
+	{method: "GET", path: "/admin/support-bundle", id: "getSupportBundle", tag: "status", summary: "Download a zip archive of the redacted configuration, versions, recent errors, event streams and in-flight transactions, for a support case", produces: "application/zip"},
+
+	{method: "GET", path: "/abis", id: "listABIs", tag: "abis", summary: "List the stored ABIs", result: "abi", resultArray: true},
+	{method: "POST", path: "/abis", id: "addABI", tag: "abis", summary: "Store an ABI, or compile and store Solidity source, as a multi-part form upload. A JSON body stores the abi, and optional bytecode, of a contract compiled elsewhere such as a Truffle or Hardhat artifact", result: "abi", status: 200},
+	{method: "GET", path: "/abis/{abi}", id: "getABI", tag: "abis", summary: "Get a stored ABI. Use ?swagger for the generated OpenAPI, or ?abi for the ABI itself", result: "abi"},
+	{method: "POST", path: "/abis/{abi}/{address}", id: "registerContract", tag: "abis", summary: "Register an existing contract address against a stored ABI",
+		flyQuery: []systemAPIFlyParam{{"register", "string", "Friendly name to register the contract instance under", nil}, {"verify", "string", "Verify there is contract code at the address, or that it matches the compiled bytecode", []interface{}{"true", "false", "bytecode"}},
+			{"allowmethods", "string", "Comma-separated list of the only methods that can be invoked on the contract instance", nil}, {"denymethods", "string", "Comma-separated list of methods that cannot be invoked on the contract instance", nil}},
+		result: "contract", status: 201},
+	{method: "PUT", path: "/abis/{abi}/policy", id: "setABIPolicy", tag: "abis", summary: "Set the default and maximum gas, gas price and value for transactions using a stored ABI. An empty policy removes it",
+		body: "txPolicy", result: "abi"},
+	{method: "PUT", path: "/abis/{abi}/regenerate", id: "regenerateABI", tag: "abis", summary: "Regenerate the stored details of the OpenAPI definition for an ABI using the current configuration, such as after the base URL changes",
+		result: "abi"},
+
+	{method: "GET", path: "/contracts", id: "listContracts", tag: "contracts", summary: "List the registered contract instances",
+		query: []systemAPIParam{{"prefix", "string", "Only return the contracts registered under this hierarchical name prefix, such as payments/"}}, result: "contract", resultArray: true},
+	{method: "GET", path: "/contracts/{address}", id: "getContract", tag: "contracts", summary: "Get a contract instance by address or registered name. Use ?swagger for the generated OpenAPI", result: "contract"},
+	{method: "PATCH", path: "/contracts/{address}", id: "updateContractName", tag: "contracts", summary: "Change or remove the registered name of a contract instance",
+		flyQuery: []systemAPIFlyParam{{"force", "boolean", "Take the name from another contract instance that is already registered with it", nil}},
+		body:     "contractNameUpdate", result: "contract"},
+	{method: "PUT", path: "/contracts/{address}/policy", id: "setContractPolicy", tag: "contracts", summary: "Set the default and maximum gas, gas price and value for transactions to a contract instance, overriding the policy of its ABI. An empty policy removes it",
+		body: "txPolicy", result: "contract"},
+	{method: "PUT", path: "/contracts/{address}/methods", id: "setContractMethods", tag: "contracts", summary: "Set the allow list, or deny list, of the methods that can be invoked on a contract instance. Empty lists remove the restriction",
+		body: "methodFilter", result: "contract"},
+	{method: "PUT", path: "/contracts/{address}/regenerate", id: "regenerateContract", tag: "contracts", summary: "Regenerate the stored details of the OpenAPI definition for a contract instance and its ABI using the current configuration",
+		result: "contract"},
+	{method: "PUT", path: "/contracts/{address}/upgrade", id: "upgradeContract", tag: "contracts", summary: "Upgrade an ERC-1967 proxy contract by deploying a new implementation from a stored ABI, invoking the upgrade function of the proxy, verifying the implementation slot, and binding the proxy to the new ABI",
+		flyQuery: []systemAPIFlyParam{{"from", "string", "Address, HD wallet reference or signer alias to deploy the implementation and upgrade the proxy from (required)", nil}, {"gas", "string", "Gas limit of the upgrade transaction", nil},
+			{"gasprice", "string", "Gas price of the transactions", nil}, {"ethvalue", "string", "Value to send with the upgrade transaction, when data is supplied", nil}, {"signer", "string", "Signer backend of the transactions", []interface{}{"node", "hdwallet"}}},
+		body: "contractUpgrade", result: "contract"},
+	{method: "GET", path: "/contracts/{address}/{event}/schema", id: "getEventSchema", tag: "contracts", summary: "Get the JSON schema of the payload delivered on event streams for an event of a contract instance",
+		result: "object"},
+	{method: "POST", path: "/bulk/{method}", id: "bulkCall", tag: "contracts", summary: "Call the same view method on many registered contract instances, returning the result for each",
+		body: "bulkCall", result: "object"},
+	{method: "GET", path: "/storage/{address}/{slot}", id: "getStorageAt", tag: "contracts", summary: "Read the raw value of a storage slot of a contract, by address or registered name",
+		flyQuery: []systemAPIFlyParam{{"blocknumber", "string", "Block number, latest/earliest/pending, or an RFC3339 timestamp or date, to read the slot at", nil}, {"rpctimeout", "string", "Timeout for the JSON/RPC call to the node, in seconds or as a duration", nil}},
+		result:   "storage"},
+	{method: "GET", path: "/logs", id: "queryLogs", tag: "contracts", summary: "Query the historical logs over a range of blocks, in pages. Pass the cursor from a page to get the next page",
+		flyQuery: []systemAPIFlyParam{
+			{"address", "string", "Only return logs emitted by this contract address, or registered name", nil},
+			{"topic", "string", "Comma separated list of topics to filter by position. An empty entry matches any topic", nil},
+			{"fromblock", "string", "First block of the range (default 0)", nil},
+			{"toblock", "string", "Last block of the range (default latest, resolved on the first page)", nil},
+			{"chunksize", "integer", "Number of blocks to query from the node in each call, which is reduced automatically if the node rejects the range as too large", nil},
+			{"limit", "integer", "Number of logs after which the page is returned. Pages end on a chunk boundary, so can contain more", nil},
+			{"cursor", "string", "Cursor from a previous page, to get the next page. All other query parameters are ignored", nil},
+			{"rpctimeout", "string", "Timeout for the JSON/RPC calls to the node, in seconds or as a duration", nil},
+		},
+		result: "logsPage"},
+	{method: "GET", path: "/safes/{safe}/transactions/{safetxhash}", id: "getSafeTransaction", tag: "contracts", summary: "Check whether a transaction proposed to a Safe multisig has been executed, from the ExecutionSuccess and ExecutionFailure events of the Safe",
+		flyQuery: []systemAPIFlyParam{
+			{"fromblock", "string", "Block to search from, such as the blockNumber returned when the transaction was proposed (required)", nil},
+			{"chunksize", "integer", "Number of blocks to query from the node in each call, which is reduced automatically if the node rejects the range as too large", nil},
+			{"rpctimeout", "string", "Timeout for the JSON/RPC calls to the node, in seconds or as a duration", nil},
+		},
+		result: "safeTransaction"},
+	{method: "POST", path: "/decode", id: "decodeCalldata", tag: "contracts", summary: "Decode calldata into the method it invokes and its arguments, using the ABI of a contract address or name, a stored ABI, or a search of all stored ABIs",
+		body: "decodeRequest", result: "decodedCall"},
+	{method: "POST", path: "/signatures/verify", id: "verifySignature", tag: "signers", summary: "Recover the signer of a personal_sign message or EIP-712 typed data, and check it against an expected address",
+		body: "verifySignatureRequest", result: "verifySignatureReply"},
+	{method: "GET", path: "/signers", id: "listSignerAliases", tag: "signers", summary: "List the signer aliases that can be used as the from address of requests", result: "signer", resultArray: true},
+	{method: "POST", path: "/signers", id: "storeSignerAlias", tag: "signers", summary: "Create a signer alias for an address or HD wallet reference, or re-point an existing one", body: "signer", result: "signer"},
+	{method: "GET", path: "/signers/{alias}", id: "getSignerAlias", tag: "signers", summary: "Get a signer alias", result: "signer"},
+	{method: "DELETE", path: "/signers/{alias}", id: "deleteSignerAlias", tag: "signers", summary: "Delete a signer alias", status: 204},
+	{method: "GET", path: "/accounts", id: "listAccounts", tag: "signers", summary: "List the accounts managed by the node, and the targets of signer aliases, with their balances",
+		flyQuery: []systemAPIFlyParam{{"balance", "boolean", "Look up the balance of each address", nil}},
+		result:   "account", resultArray: true},
+	{method: "POST", path: "/gateways/{gateway}/{address}", id: "registerGatewayInstance", tag: "contracts", summary: "Register an existing contract address against a gateway in the remote registry",
+		flyQuery: []systemAPIFlyParam{{"register", "string", "Friendly name to register the contract instance under", nil}, {"verify", "string", "Verify there is contract code at the address, or that it matches the compiled bytecode", []interface{}{"true", "false", "bytecode"}}},
+		result:   "contract", status: 201},
+
+	{method: "GET", path: events.StreamPathPrefix, id: "listStreams", tag: "eventstreams", summary: "List the event streams", result: "stream", resultArray: true},
+	{method: "POST", path: events.StreamPathPrefix, id: "createStream", tag: "eventstreams", summary: "Create an event stream", body: "stream", result: "stream"},
+	{method: "GET", path: events.StreamPathPrefix + "/{id}", id: "getStream", tag: "eventstreams", summary: "Get an event stream", result: "stream"},
+	{method: "PATCH", path: events.StreamPathPrefix + "/{id}", id: "updateStream", tag: "eventstreams", summary: "Update an event stream", body: "stream", result: "stream"},
+	{method: "DELETE", path: events.StreamPathPrefix + "/{id}", id: "deleteStream", tag: "eventstreams", summary: "Delete an event stream, and all its subscriptions", status: 204},
+	{method: "POST", path: events.StreamPathPrefix + "/{id}/suspend", id: "suspendStream", tag: "eventstreams", summary: "Suspend delivery of events on a stream, optionally until a block or time when it resumes automatically",
+		query:  []systemAPIParam{{"untilBlock", "string", "Resume the stream automatically once this block number is reached"}, {"untilTime", "string", "Resume the stream automatically at this time (RFC3339)"}},
+		status: 204},
+	{method: "POST", path: events.StreamPathPrefix + "/{id}/resume", id: "resumeStream", tag: "eventstreams", summary: "Resume delivery of events on a suspended stream", status: 204},
+	{method: "POST", path: events.StreamPathPrefix + "/{id}/export", id: "exportStream", tag: "eventstreams", summary: "Suspend an event stream, and export it with its subscriptions and checkpoint for migration to another instance",
+		query:  []systemAPIParam{{"timeoutSec", "integer", "How long to wait for the batches being delivered to complete"}},
+		result: "object"},
+	{method: "GET", path: events.StreamPathPrefix + "/{id}/deadletters", id: "listDeadLetters", tag: "eventstreams", summary: "List the batches of events skipped by a stream that stores dead letters, oldest first", result: "object", resultArray: true},
+	{method: "POST", path: events.StreamPathPrefix + "/{id}/deadletters/{letter}/replay", id: "replayDeadLetter", tag: "eventstreams", summary: "Deliver the events of a dead letter again, and remove it", result: "object"},
+	{method: "DELETE", path: events.StreamPathPrefix + "/{id}/deadletters/{letter}", id: "deleteDeadLetter", tag: "eventstreams", summary: "Discard a dead letter without replaying it", status: 204},
+	{method: "POST", path: events.MigrationPath, id: "importStream", tag: "eventstreams", summary: "Import an event stream exported from another instance, in the suspended state", body: "object", result: "stream"},
+
+	{method: "GET", path: events.SubPathPrefix, id: "listSubscriptions", tag: "subscriptions", summary: "List the event subscriptions",
+		query:  []systemAPIParam{{"stream", "string", "Only return subscriptions on this event stream"}, {"address", "string", "Only return subscriptions for this contract address"}, {"name", "string", "Only return subscriptions with this name"}},
+		result: "subscription", resultArray: true},
+	{method: "POST", path: events.SubPathPrefix, id: "createSubscription", tag: "subscriptions", summary: "Subscribe to an event by its signature, for contracts without a registered ABI",
+		body: "signatureSubscription", result: "subscription"},
+	{method: "GET", path: events.SubPathPrefix + "/{id}", id: "getSubscription", tag: "subscriptions", summary: "Get an event subscription by ID or name",
+		query:  []systemAPIParam{{"stream", "string", "The event stream, where a name is used on more than one stream"}},
+		result: "subscription"},
+	{method: "DELETE", path: events.SubPathPrefix + "/{id}", id: "deleteSubscription", tag: "subscriptions", summary: "Delete an event subscription. Events it has already captured are still delivered, unless drained or purged",
+		query:  []systemAPIParam{{"drain", "boolean", "Wait for the events the subscription has captured to be delivered before deleting it"}, {"purge", "boolean", "Discard the events the subscription has captured that have not yet been delivered"}, {"drainTimeoutSec", "integer", "How long to wait for the subscription to drain, after which it is not deleted"}},
+		status: 204},
+	{method: "GET", path: events.SubPathPrefix + "/{id}/status", id: "getSubscriptionStatus", tag: "subscriptions", summary: "Get the latest matched block, last delivery and decode failures of an event subscription",
+		query:  []systemAPIParam{{"stream", "string", "The event stream, where a name is used on more than one stream"}},
+		result: "object"},
+	{method: "GET", path: events.SubPathPrefix + "/name/{name}", id: "getSubscriptionByName", tag: "subscriptions", summary: "Get an event subscription by name",
+		query:  []systemAPIParam{{"stream", "string", "The event stream, where the name is used on more than one stream"}},
+		result: "subscription"},
+	{method: "POST", path: events.SubPathPrefix + "/{id}/reset", id: "resetSubscription", tag: "subscriptions", summary: "Reset the checkpoint of a subscription to a block", body: "subscriptionReset", status: 204},
+	{method: "GET", path: events.IdleSubscriptionsPath, id: "listIdleSubscriptions", tag: "subscriptions", summary: "List subscriptions on streams that are suspended, or failing to deliver events",
+		query:  []systemAPIParam{{"idleTimeoutSec", "integer", "How long a stream must be idle, defaulting to the configured timeout"}},
+		result: "object", resultArray: true},
+	{method: "GET", path: events.WebhookStatusPath, id: "getWebhookSLA", tag: "status", summary: "Report the delivery success rate and p95 latency of each webhook receiver, over sliding time and count windows", result: "object", resultArray: true},
+	{method: "GET", path: events.DefinitionsPath, id: "exportDefinitions", tag: "eventstreams", summary: "Export the event stream and subscription definitions", result: "object"},
+	{method: "POST", path: events.DefinitionsPath, id: "importDefinitions", tag: "eventstreams", summary: "Import event stream and subscription definitions, creating or updating by name", body: "object", result: "object"},
+
+	{method: "GET", path: "/replies", id: "listReplies", tag: "replies", summary: "List the stored transaction receipts, most recent first",
+		query: []systemAPIParam{{"id", "string", "Only return the receipts for these request IDs"}, {"limit", "integer", "Maximum number of receipts to return"}, {"skip", "integer", "Number of receipts to skip"},
+			{"since", "string", "Only return receipts received after this time (RFC3339 or milliseconds since epoch)"}, {"from", "string", "Only return receipts for transactions from this address"}, {"to", "string", "Only return receipts for transactions to this address"}},
+		result: "object", resultArray: true},
+	{method: "GET", path: "/replies/{id}", id: "getReply", tag: "replies", summary: "Get the stored transaction receipt for a request ID", result: "object"},
+	{method: "GET", path: "/reports/fees", id: "getFeeReport", tag: "replies", summary: "Report the gas and fees spent by the stored transaction receipts",
+		query: []systemAPIParam{{"groupBy", "string", "Group the spend by day (default), from or contract"}, {"since", "string", "Only include receipts received at or after this time (RFC3339 or milliseconds since epoch)"},
+			{"until", "string", "Only include receipts received before this time (RFC3339 or milliseconds since epoch)"}, {"from", "string", "Only include transactions from this address"}, {"contract", "string", "Only include transactions to, or deploying, this contract"}},
+		result: "object"},
+	{method: "GET", path: "/reports/nonces", id: "getNonceReport", tag: "status", summary: "Reconcile the nonces of in-flight transactions with the transaction counts of the node, and suggest remediation for any discrepancies",
+		query:  []systemAPIParam{{"from", "string", "Also report on these addresses, which need not have transactions in-flight"}},
+		result: "object"},
+}
+
+// systemAPISchemas are the definitions for the objects used by the system APIs. Only the
+// most commonly used fields are described, and additional fields are allowed
+var systemAPISchemas = map[string]map[string]string{
+	"abi": {
+		"id":               "string",
+		"name":             "string",
+		"description":      "string",
+		"deployable":       "boolean",
+		"compilerVersion":  "string",
+		"compilerWarnings": "array",
+		"git":              "object",
+		"path":             "string",
+		"openapi":          "string",
+		"policy":           "object",
+		"created":          "string",
+	},
+	"contract": {
+		"address":         "string",
+		"abi":             "string",
+		"path":            "string",
+		"openapi":         "string",
+		"registeredAs":    "string",
+		"policy":          "object",
+		"allowMethods":    "array",
+		"denyMethods":     "array",
+		"constructorArgs": "array",
+		"constructorData": "string",
+		"upgrades":        "array",
+		"created":         "string",
+	},
+	"contractUpgrade": {
+		"abi":    "string",
+		"params": "object",
+		"data":   "string",
+	},
+	"contractNameUpdate": {
+		"registeredAs": "string",
+	},
+	"methodFilter": {
+		"allowMethods": "array",
+		"denyMethods":  "array",
+	},
+	"txPolicy": {
+		"defaultGas":      "string",
+		"maxGas":          "string",
+		"defaultGasPrice": "string",
+		"maxGasPrice":     "string",
+		"defaultValue":    "string",
+		"maxValue":        "string",
+		"numbers":         "string",
+		"safe":            "string",
+		"signers":         "array",
+	},
+	"stream": {
+		"id":                 "string",
+		"name":               "string",
+		"type":               "string",
+		"batchSize":          "integer",
+		"batchTimeoutMS":     "integer",
+		"maxInFlightBatches": "integer",
+		"errorHandling":      "string",
+		"pauseAfterFailures": "integer",
+		"probeIntervalSec":   "integer",
+		"deadLetter":         "boolean",
+		"suspended":          "boolean",
+		"autoResume":         "object",
+		"timestamps":         "boolean",
+		"webhook":            "object",
+		"websocket":          "object",
+		"transaction":        "object",
+		"warehouse":          "object",
+		"created":            "string",
+	},
+	"subscription": {
+		"id":        "string",
+		"name":      "string",
+		"stream":    "string",
+		"event":     "object",
+		"filter":    "object",
+		"fromBlock": "string",
+		"created":   "string",
+	},
+	"bulkCall": {
+		"addresses": "array",
+		"params":    "object",
+	},
+	"storage": {
+		"address":     "string",
+		"slot":        "string",
+		"blockNumber": "string",
+		"value":       "string",
+	},
+	"logsPage": {
+		"fromBlock": "string",
+		"toBlock":   "string",
+		"logs":      "array",
+		"cursor":    "string",
+	},
+	"safeTransaction": {
+		"safe":            "string",
+		"safeTxHash":      "string",
+		"status":          "string",
+		"transactionHash": "string",
+		"blockNumber":     "string",
+	},
+	"decodeRequest": {
+		"data":    "string",
+		"address": "string",
+		"abi":     "string",
+	},
+	"decodedCall": {
+		"abi":      "string",
+		"address":  "string",
+		"method":   "string",
+		"selector": "string",
+		"inputs":   "object",
+	},
+	"verifySignatureRequest": {
+		"message":   "string",
+		"data":      "string",
+		"typedData": "object",
+		"signature": "string",
+		"address":   "string",
+	},
+	"verifySignatureReply": {
+		"type":    "string",
+		"signer":  "string",
+		"address": "string",
+		"valid":   "boolean",
+	},
+	"signer": {
+		"alias":   "string",
+		"from":    "string",
+		"created": "string",
+	},
+	"account": {
+		"from":    "string",
+		"managed": "boolean",
+		"aliases": "array",
+		"balance": "string",
+	},
+	"signatureSubscription": {
+		"stream":    "string",
+		"signature": "string",
+		"address":   "string",
+		"fromBlock": "string",
+		"name":      "string",
+	},
+	"subscriptionReset": {
+		"fromBlock": "string",
+	},
+	"object": {},
+}
+
+// GenSystemAPI generates OpenAPI for the built-in admin, event stream and receipt APIs of the gateway
+func (c *ABI2Swagger) GenSystemAPI() *spec.Swagger {
+	paths := &spec.Paths{
+		Paths: make(map[string]spec.PathItem),
+	}
+	for _, route := range systemAPIRoutes {
+		pathItem := paths.Paths[route.path]
+		op := c.buildSystemAPIOperation(route)
+		switch route.method {
+		case "GET":
+			pathItem.Get = op
+		case "POST":
+			pathItem.Post = op
+		case "PUT":
+			pathItem.Put = op
+		case "PATCH":
+			pathItem.Patch = op
+		case "DELETE":
+			pathItem.Delete = op
+		}
+		paths.Paths[route.path] = pathItem
+	}
+
+	definitions := make(map[string]spec.Schema)
+	for name, props := range systemAPISchemas {
+		schema := spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type:       []string{"object"},
+				Properties: make(map[string]spec.Schema),
+			},
+		}
+		for propName, propType := range props {
+			prop := spec.Schema{
+				SchemaProps: spec.SchemaProps{
+					Type: []string{propType},
+				},
+			}
+			if propType == "array" {
+				prop.Items = &spec.SchemaOrArray{
+					Schema: spec.StringProperty(),
+				}
+			}
+			schema.Properties[propName] = prop
+		}
+		definitions[name] = schema
+	}
+	definitions["error"] = spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Type: []string{"object"},
+			Properties: map[string]spec.Schema{
+				"error": {
+					SchemaProps: spec.SchemaProps{
+						Description: "Error message",
+						Type:        []string{"string"},
+					},
+				},
+			},
+		},
+	}
+
+	swagger := &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger: "2.0",
+			Info: &spec.Info{
+				InfoProps: spec.InfoProps{
+					Version:     "1.0",
+					Title:       "Ethconnect",
+					Description: "Admin, event stream and receipt APIs of the Ethconnect REST Gateway",
+				},
+			},
+			Host:        c.conf.ExternalHost,
+			Schemes:     c.conf.ExternalSchemes,
+			BasePath:    c.conf.ExternalRootPath + "/",
+			Paths:       paths,
+			Definitions: definitions,
+		},
+	}
+	swagger.SwaggerProps.SecurityDefinitions = c.securityDefinitions()
+	return swagger
+}
+
+func (c *ABI2Swagger) buildSystemAPIOperation(route systemAPIRoute) *spec.Operation {
+	produces := route.produces
+	if produces == "" {
+		produces = "application/json"
+	}
+	op := &spec.Operation{
+		OperationProps: spec.OperationProps{
+			ID:       route.id,
+			Summary:  route.summary,
+			Tags:     []string{route.tag},
+			Produces: []string{produces},
+		},
+	}
+	for _, match := range systemAPIPathParamRegex.FindAllStringSubmatch(route.path, -1) {
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			ParamProps: spec.ParamProps{
+				Name:     match[1],
+				In:       "path",
+				Required: true,
+			},
+			SimpleSchema: spec.SimpleSchema{
+				Type: "string",
+			},
+		})
+	}
+	for _, q := range route.query {
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			ParamProps: spec.ParamProps{
+				Name:            q.name,
+				Description:     q.desc,
+				In:              "query",
+				AllowEmptyValue: q.typ == "boolean",
+			},
+			SimpleSchema: spec.SimpleSchema{
+				Type: q.typ,
+			},
+		})
+	}
+	for _, q := range route.flyQuery {
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			ParamProps: spec.ParamProps{
+				Name:            fmt.Sprintf("%s-%s", utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly"), q.name),
+				Description:     fmt.Sprintf("%s (header: x-%s-%s)", q.desc, utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly"), q.name),
+				In:              "query",
+				AllowEmptyValue: q.typ == "boolean" || q.enum != nil,
+			},
+			SimpleSchema: spec.SimpleSchema{
+				Type: q.typ,
+			},
+			CommonValidations: spec.CommonValidations{
+				Enum: q.enum,
+			},
+		})
+	}
+	if route.body != "" {
+		op.Consumes = []string{"application/json"}
+		op.Parameters = append(op.Parameters, spec.Parameter{
+			ParamProps: spec.ParamProps{
+				Name:     "body",
+				In:       "body",
+				Required: true,
+				Schema:   systemAPISchemaRef(route.body, false),
+			},
+		})
+	}
+	op.Security = c.securityRequirements()
+
+	status := route.status
+	if status == 0 {
+		status = 200
+	}
+	success := spec.Response{
+		ResponseProps: spec.ResponseProps{
+			Description: "successful response",
+		},
+	}
+	if route.result != "" {
+		success.Schema = systemAPISchemaRef(route.result, route.resultArray)
+	}
+	op.Responses = &spec.Responses{
+		ResponsesProps: spec.ResponsesProps{
+			StatusCodeResponses: map[int]spec.Response{
+				status: success,
+			},
+			Default: &spec.Response{
+				ResponseProps: spec.ResponseProps{
+					Description: "error",
+					Schema:      systemAPISchemaRef("error", false),
+				},
+			},
+		},
+	}
+	return op
+}
+
+func systemAPISchemaRef(name string, array bool) *spec.Schema {
+	ref, _ := jsonreference.New("#/definitions/" + name)
+	schema := &spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Ref: spec.Ref{
+				Ref: ref,
+			},
+		},
+	}
+	if array {
+		return &spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Type: []string{"array"},
+				Items: &spec.SchemaOrArray{
+					Schema: schema,
+				},
+			},
+		}
+	}
+	return schema
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenSystemAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{
+		ExternalHost:     "localhost:8080",
+		ExternalRootPath: "/api/v1",
+		ExternalSchemes:  []string{"https"},
+		BasicAuth:        true,
+	})
+	swagger := c.GenSystemAPI()
+
+	assert.Equal("localhost:8080", swagger.Host)
+	assert.Equal("/api/v1/", swagger.BasePath)
+	assert.Equal([]string{"https"}, swagger.Schemes)
+	assert.NotNil(swagger.SecurityDefinitions)
+
+	for _, route := range systemAPIRoutes {
+		assert.Contains(swagger.Paths.Paths, route.path)
+	}
+	streams := swagger.Paths.Paths["/eventstreams/{id}"]
+	assert.Equal("getStream", streams.Get.ID)
+	assert.Equal("updateStream", streams.Patch.ID)
+	assert.Equal("deleteStream", streams.Delete.ID)
+	assert.Equal("id", streams.Delete.Parameters[0].Name)
+	assert.Equal("path", streams.Delete.Parameters[0].In)
+	assert.Contains(streams.Delete.Responses.StatusCodeResponses, 204)
+	assert.NotEmpty(streams.Get.Security)
+
+	deleteSub := swagger.Paths.Paths["/subscriptions/{id}"].Delete
+	assert.Equal("drain", deleteSub.Parameters[1].Name)
+	assert.Equal("boolean", deleteSub.Parameters[1].Type)
+
+	replies := swagger.Paths.Paths["/replies"].Get
+	assert.Equal("array", replies.Responses.StatusCodeResponses[200].Schema.Type[0])
+	assert.Len(replies.Parameters, 6)
+
+	rename := swagger.Paths.Paths["/contracts/{address}"].Patch
+	assert.Equal("body", rename.Parameters[2].In)
+	assert.Equal("#/definitions/contractNameUpdate", rename.Parameters[2].Schema.Ref.String())
+	assert.Contains(swagger.Definitions["contractNameUpdate"].Properties, "registeredAs")
+	assert.Equal("fly-force", rename.Parameters[1].Name)
+	assert.Equal("boolean", rename.Parameters[1].Type)
+	assert.Contains(rename.Parameters[1].Description, "(header: x-firefly-force)")
+
+	policy := swagger.Paths.Paths["/contracts/{address}/policy"].Put
+	assert.Equal("setContractPolicy", policy.ID)
+	assert.Equal("#/definitions/txPolicy", policy.Parameters[1].Schema.Ref.String())
+	assert.NotNil(swagger.Paths.Paths["/abis/{abi}/policy"].Put)
+	assert.Contains(swagger.Definitions["txPolicy"].Properties, "maxGas")
+	assert.Contains(swagger.Definitions["contract"].Properties, "policy")
+
+	methods := swagger.Paths.Paths["/contracts/{address}/methods"].Put
+	assert.Equal("#/definitions/methodFilter", methods.Parameters[1].Schema.Ref.String())
+	assert.Contains(swagger.Definitions["methodFilter"].Properties, "denyMethods")
+
+	register := swagger.Paths.Paths["/abis/{abi}/{address}"].Post
+	assert.Equal("fly-register", register.Parameters[2].Name)
+	assert.Equal("fly-verify", register.Parameters[3].Name)
+	assert.Equal("string", register.Parameters[3].Type)
+	assert.Equal([]interface{}{"true", "false", "bytecode"}, register.Parameters[3].Enum)
+	assert.True(register.Parameters[3].AllowEmptyValue)
+	assert.Equal("fly-allowmethods", register.Parameters[4].Name)
+	assert.Equal("fly-denymethods", register.Parameters[5].Name)
+
+	assert.Contains(swagger.Paths.Paths, "/eventdefinitions")
+	assert.NotContains(swagger.Paths.Paths, "/definitions")
+	createStream := swagger.Paths.Paths["/eventstreams"].Post
+	assert.Equal([]string{"application/json"}, createStream.Consumes)
+
+	bulk := swagger.Paths.Paths["/bulk/{method}"].Post
+	assert.Equal("bulkCall", bulk.ID)
+	assert.Equal("method", bulk.Parameters[0].Name)
+	assert.Equal("#/definitions/bulkCall", bulk.Parameters[1].Schema.Ref.String())
+	assert.Equal("string", swagger.Definitions["bulkCall"].Properties["addresses"].Items.Schema.Type[0])
+
+	storage := swagger.Paths.Paths["/storage/{address}/{slot}"].Get
+	assert.Equal("getStorageAt", storage.ID)
+	assert.Equal("slot", storage.Parameters[1].Name)
+	assert.Equal("fly-blocknumber", storage.Parameters[2].Name)
+	assert.Contains(swagger.Definitions["storage"].Properties, "value")
+
+	decode := swagger.Paths.Paths["/decode"].Post
+	assert.Equal("decodeCalldata", decode.ID)
+	assert.Equal("#/definitions/decodeRequest", decode.Parameters[0].Schema.Ref.String())
+	assert.Contains(swagger.Definitions["decodedCall"].Properties, "inputs")
+
+	createSub := swagger.Paths.Paths["/subscriptions"].Post
+	assert.Equal("createSubscription", createSub.ID)
+	assert.Equal("#/definitions/signatureSubscription", createSub.Parameters[0].Schema.Ref.String())
+
+	signer := swagger.Paths.Paths["/signers/{alias}"].Delete
+	assert.Equal("deleteSignerAlias", signer.ID)
+	assert.Equal("alias", signer.Parameters[0].Name)
+	assert.Contains(swagger.Definitions["signer"].Properties, "from")
+
+	accounts := swagger.Paths.Paths["/accounts"].Get
+	assert.Equal("listAccounts", accounts.ID)
+	assert.Contains(swagger.Definitions["account"].Properties, "balance")
+
+	_, err := json.Marshal(swagger)
+	assert.NoError(err)
+}
+
+func TestGenSystemAPIPrefixes(t *testing.T) {
+	assert := assert.New(t)
+
+	os.Setenv("PREFIX_SHORT", "ut")
+	os.Setenv("PREFIX_LONG", "unittest")
+	defer os.Unsetenv("PREFIX_SHORT")
+	defer os.Unsetenv("PREFIX_LONG")
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{})
+	swagger := c.GenSystemAPI()
+
+	register := swagger.Paths.Paths["/gateways/{gateway}/{address}"].Post
+	assert.Equal("ut-register", register.Parameters[2].Name)
+	assert.Contains(register.Parameters[2].Description, "(header: x-unittest-register)")
+	assert.Equal("ut-verify", register.Parameters[3].Name)
+}
+
+func TestGenSystemAPINoAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{})
+	swagger := c.GenSystemAPI()
+
+	assert.Equal("/", swagger.BasePath)
+	assert.Equal([]string{"http", "https"}, swagger.Schemes)
+	assert.Nil(swagger.SecurityDefinitions)
+	assert.Empty(swagger.Paths.Paths["/status"].Get.Security)
+}
+
+func TestGenSystemAPIBearerAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	c := NewABI2Swagger(&ABI2SwaggerConf{BearerAuth: true})
+	swagger := c.GenSystemAPI()
+
+	assert.Contains(swagger.SecurityDefinitions, bearerTokenCredential)
+	assert.NotContains(swagger.SecurityDefinitions, fireflyAppCredential)
+	assert.Equal([]map[string][]string{{bearerTokenCredential: {}}}, swagger.Paths.Paths["/status"].Get.Security)
+}
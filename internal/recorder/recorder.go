@@ -0,0 +1,291 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RecordTypeREST is a request received by a REST gateway, and the response sent
+	RecordTypeREST = "rest"
+	// RecordTypeKafka is a message received by a Kafka bridge
+	RecordTypeKafka = "kafka"
+	// RecordTypeRPC is a JSON/RPC call made to the node, and the result returned
+	RecordTypeRPC = "rpc"
+
+	// maxRecordLineSize is the largest record that can be read back from a recording
+	maxRecordLineSize = 64 * 1024 * 1024
+)
+
+// RecorderConf configures recording of the requests and messages received, and of the
+// JSON/RPC calls made to the node as a result, to a file of one JSON record per line.
+// The recording can be replayed against a gateway using a replay:// RPC URL, for
+// regression testing with production-shaped traffic
+type RecorderConf struct {
+	File string `json:"file,omitempty"`
+}
+
+// Record is a single request, message or JSON/RPC exchange in a recording. Method is the
+// HTTP method of a REST request, or the JSON/RPC method of a call to the node
+type Record struct {
+	Seq       uint64            `json:"seq"`
+	Time      string            `json:"time"`
+	Type      string            `json:"type"`
+	Method    string            `json:"method,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Topic     string            `json:"topic,omitempty"`
+	Key       string            `json:"key,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Status    int               `json:"status,omitempty"`
+	Response  string            `json:"response,omitempty"`
+	Params    json.RawMessage   `json:"params,omitempty"`
+	Result    json.RawMessage   `json:"result,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	ErrorCode int               `json:"errorCode,omitempty"`
+}
+
+// redactedHeaders are never written to a recording, as they carry credentials
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+}
+
+// redactedRPCPrefix is the prefix of the JSON/RPC methods that take the passphrase of an
+// account on the node, such as personal_unlockAccount and personal_sign, so every param of
+// those calls is redacted
+const redactedRPCPrefix = "personal_"
+
+type recorder struct {
+	mux  sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+}
+
+// active is the recorder for the process, as the requests of every gateway and bridge, and
+// the JSON/RPC calls of every connection, are written to the same recording in order
+var active struct {
+	sync.RWMutex
+	r *recorder
+}
+
+// Start starts recording to the configured file, appending to any existing recording.
+// It replaces any recording already in progress
+func Start(conf *RecorderConf) error {
+	file, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err == nil {
+		// An existing recording being appended to might have been created readable by others
+		if err = file.Chmod(0600); err != nil {
+			file.Close()
+		}
+	}
+	if err != nil {
+		return errors.Errorf(errors.RecorderOpenFailed, conf.File, err)
+	}
+	Stop()
+	active.Lock()
+	defer active.Unlock()
+	active.r = &recorder{path: conf.File, file: file}
+	log.Warnf("Recording requests and JSON/RPC calls to '%s'. Request and response bodies are recorded in full", conf.File)
+	return nil
+}
+
+// Stop stops any recording in progress
+func Stop() {
+	active.Lock()
+	defer active.Unlock()
+	if active.r != nil {
+		active.r.file.Close()
+		active.r = nil
+	}
+}
+
+// Enabled returns true if a recording is in progress
+func Enabled() bool {
+	active.RLock()
+	defer active.RUnlock()
+	return active.r != nil
+}
+
+func write(record *Record) {
+	active.RLock()
+	defer active.RUnlock()
+	r := active.r
+	if r == nil {
+		return
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.seq++
+	record.Seq = r.seq
+	record.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	b, err := json.Marshal(record)
+	if err == nil {
+		_, err = r.file.Write(append(b, '\n'))
+	}
+	if err != nil {
+		log.Errorf("Failed to write record %d to '%s': %s", record.Seq, r.path, err)
+	}
+}
+
+// RedactRPCParams returns the params of a JSON/RPC call as they are recorded, with those of
+// any call that carries an account passphrase redacted. The replay applies the same redaction
+// to look up the recorded response of a call
+func RedactRPCParams(method string, args []interface{}) []interface{} {
+	if args == nil {
+		return []interface{}{}
+	}
+	if !strings.HasPrefix(method, redactedRPCPrefix) {
+		return args
+	}
+	redacted := make([]interface{}, len(args))
+	for i := range args {
+		redacted[i] = utils.RedactedValue
+	}
+	return redacted
+}
+
+type errorWithCode interface {
+	ErrorCode() int
+}
+
+// RecordRPC records a JSON/RPC call made to the node, with the result or error it returned
+func RecordRPC(method string, args []interface{}, result interface{}, callErr error) {
+	if !Enabled() {
+		return
+	}
+	params, err := json.Marshal(RedactRPCParams(method, args))
+	if err != nil {
+		log.Debugf("JSON/RPC call %s not recorded, as the params could not be serialized: %s", method, err)
+		return
+	}
+	record := &Record{Type: RecordTypeRPC, Method: method, Params: params}
+	if callErr != nil {
+		record.Error = callErr.Error()
+		if withCode, ok := callErr.(errorWithCode); ok {
+			record.ErrorCode = withCode.ErrorCode()
+		}
+	} else if record.Result, err = json.Marshal(result); err != nil {
+		log.Debugf("JSON/RPC call %s not recorded, as the result could not be serialized: %s", method, err)
+		return
+	}
+	write(record)
+}
+
+// RecordKafka records a message received from Kafka
+func RecordKafka(topic string, key, value []byte) {
+	if !Enabled() {
+		return
+	}
+	write(&Record{Type: RecordTypeKafka, Topic: topic, Key: string(key), Body: string(value)})
+}
+
+// responseRecorder captures the status and body of a response, as it is written to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// NewHTTPHandler records each request handled by the parent, with the response. WebSocket
+// connections are not recorded, as they are long-lived rather than a request and response
+func NewHTTPHandler(parent http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !Enabled() || req.Header.Get("Upgrade") != "" {
+			parent.ServeHTTP(res, req)
+			return
+		}
+		var body []byte
+		if req.Body != nil {
+			body, _ = ioutil.ReadAll(req.Body)
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		headers := make(map[string]string)
+		for name := range req.Header {
+			if !redactedHeaders[http.CanonicalHeaderKey(name)] {
+				headers[name] = strings.Join(req.Header.Values(name), ", ")
+			}
+		}
+		rr := &responseRecorder{ResponseWriter: res, status: 200}
+		parent.ServeHTTP(rr, req)
+		write(&Record{
+			Type:     RecordTypeREST,
+			Method:   req.Method,
+			Path:     utils.StripCredentials(req.URL.RequestURI()),
+			Headers:  headers,
+			Body:     string(body),
+			Status:   rr.status,
+			Response: rr.body.String(),
+		})
+	})
+}
+
+// ReadRecords reads all the records from a recording, in order
+func ReadRecords(file string) ([]*Record, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Errorf(errors.RecorderReadFailed, file, err)
+	}
+	defer f.Close()
+	records := []*Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, errors.Errorf(errors.RecorderReadFailed, file, err)
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Errorf(errors.RecorderReadFailed, file, err)
+	}
+	return records, nil
+}
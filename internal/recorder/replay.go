@@ -0,0 +1,190 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultReplayIgnore are the fields of JSON responses that are generated for each request,
+// so are expected to differ between the recording and the replay
+var DefaultReplayIgnore = []string{
+	"id",
+	"created",
+	"receivedAt",
+	"headers.id",
+	"headers.requestId",
+	"headers.requestOffset",
+	"headers.timeReceived",
+	"headers.timeElapsed",
+}
+
+// replaySkipHeaders are recorded headers that describe the original connection, rather than
+// the request, so are left for the HTTP client to set on the replay
+var replaySkipHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+}
+
+// ReplayConf configures the replay of the requests in a recording against a running gateway.
+// Headers are added to every request, such as credentials that are never recorded. Ignore
+// are the dot separated paths of fields that are not compared in JSON responses
+type ReplayConf struct {
+	URL     string
+	Headers map[string]string
+	Ignore  []string
+	Client  *http.Client
+}
+
+// ReplayMismatch is a request where the response of the replay differed from the recording
+type ReplayMismatch struct {
+	Seq            uint64 `json:"seq"`
+	Method         string `json:"method"`
+	Path           string `json:"path"`
+	RecordedStatus int    `json:"recordedStatus"`
+	Status         int    `json:"status"`
+	Recorded       string `json:"recorded"`
+	Response       string `json:"response"`
+}
+
+// ReplayReport summarizes a replay. Messages recorded from Kafka are submitted to the webhooks
+// endpoint of the gateway, and only compared on being accepted, as the reply is asynchronous
+type ReplayReport struct {
+	Replayed   int               `json:"replayed"`
+	Matched    int               `json:"matched"`
+	Mismatched int               `json:"mismatched"`
+	Mismatches []*ReplayMismatch `json:"mismatches,omitempty"`
+}
+
+// Replay sends the REST requests and Kafka messages of a recording to a gateway in order,
+// and compares each response with the one recorded. JSON/RPC records are skipped, as they
+// are replayed by the gateway itself when configured with a replay:// RPC URL
+func Replay(records []*Record, conf *ReplayConf) (*ReplayReport, error) {
+	client := conf.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	ignore := make([][]string, 0, len(conf.Ignore))
+	for _, path := range conf.Ignore {
+		ignore = append(ignore, strings.Split(path, "."))
+	}
+	baseURL := strings.TrimSuffix(conf.URL, "/")
+	report := &ReplayReport{Mismatches: []*ReplayMismatch{}}
+	for _, record := range records {
+		var req *http.Request
+		var err error
+		switch record.Type {
+		case RecordTypeREST:
+			req, err = http.NewRequest(record.Method, baseURL+record.Path, strings.NewReader(record.Body))
+			if err == nil {
+				for name, value := range record.Headers {
+					if !replaySkipHeaders[http.CanonicalHeaderKey(name)] {
+						req.Header.Set(name, value)
+					}
+				}
+			}
+		case RecordTypeKafka:
+			req, err = http.NewRequest("POST", baseURL+"/", strings.NewReader(record.Body))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return report, errors.Errorf(errors.ReplayRequestFailed, record.Seq, utils.StripCredentials(conf.URL), err)
+		}
+		for name, value := range conf.Headers {
+			req.Header.Set(name, value)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			if urlErr, ok := err.(*url.Error); ok {
+				urlErr.URL = utils.StripCredentials(urlErr.URL)
+			}
+			return report, errors.Errorf(errors.ReplayRequestFailed, record.Seq, utils.StripCredentials(conf.URL), err)
+		}
+		resBody, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		report.Replayed++
+
+		var matched bool
+		if record.Type == RecordTypeKafka {
+			matched = res.StatusCode < 300
+		} else {
+			matched = res.StatusCode == record.Status && responsesMatch([]byte(record.Response), resBody, ignore)
+		}
+		if matched {
+			report.Matched++
+			continue
+		}
+		report.Mismatched++
+		mismatch := &ReplayMismatch{
+			Seq:            record.Seq,
+			Method:         req.Method,
+			Path:           utils.StripCredentials(req.URL.RequestURI()),
+			RecordedStatus: record.Status,
+			Status:         res.StatusCode,
+			Recorded:       record.Response,
+			Response:       string(resBody),
+		}
+		log.Warnf("Replay mismatch for record %d %s %s: status=%d recorded=%d", mismatch.Seq, mismatch.Method, mismatch.Path, mismatch.Status, mismatch.RecordedStatus)
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	return report, nil
+}
+
+// responsesMatch compares JSON responses ignoring the order of keys, and the ignored fields.
+// Anything else must match exactly
+func responsesMatch(recorded, replayed []byte, ignore [][]string) bool {
+	var recordedJSON, replayedJSON interface{}
+	if json.Unmarshal(recorded, &recordedJSON) != nil || json.Unmarshal(replayed, &replayedJSON) != nil {
+		return bytes.Equal(bytes.TrimSpace(recorded), bytes.TrimSpace(replayed))
+	}
+	for _, path := range ignore {
+		removePath(recordedJSON, path)
+		removePath(replayedJSON, path)
+	}
+	recordedBytes, _ := json.Marshal(recordedJSON)
+	replayedBytes, _ := json.Marshal(replayedJSON)
+	return bytes.Equal(recordedBytes, replayedBytes)
+}
+
+// removePath removes a field from a JSON object, or from every object in a JSON array
+func removePath(v interface{}, path []string) {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			delete(vt, path[0])
+		} else {
+			removePath(vt[path[0]], path[1:])
+		}
+	case []interface{}:
+		for _, elem := range vt {
+			removePath(elem, path)
+		}
+	}
+}
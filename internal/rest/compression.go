@@ -0,0 +1,147 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCompressionMinSize = 1024
+)
+
+// CompressionConf configures gzip compression, and ETag support, for the responses to GET
+// requests - such as OpenAPI documents, ABI listings and log queries that UIs poll
+type CompressionConf struct {
+	Enabled bool `json:"enabled"`
+	MinSize int  `json:"minSize"`
+}
+
+// bufferedResponse holds the response of a handler, so it can be hashed and compressed
+// before it is sent
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// responseETag is a strong ETag derived from the content of the response, so it changes
+// whenever the content does, without the handlers tracking versions. The gzip encoded
+// representation has its own ETag, as its bytes differ from the uncompressed response
+func responseETag(body []byte, gzipped bool) string {
+	hash := sha256.Sum256(body)
+	if gzipped {
+		return `"` + hex.EncodeToString(hash[0:16]) + `-gzip"`
+	}
+	return `"` + hex.EncodeToString(hash[0:16]) + `"`
+}
+
+// etagMatches checks an If-None-Match header, which can be a list of ETags, or *
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(req *http.Request) bool {
+	for _, encoding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.Split(encoding, ";")[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// newCompressionHandler buffers the successful responses to GET requests, to set an ETag,
+// reply 304 Not Modified when it matches If-None-Match, and gzip compress bodies over the
+// minimum size for clients that accept it. WebSocket upgrades are passed straight through
+func newCompressionHandler(conf *CompressionConf, parent http.Handler) http.Handler {
+	minSize := conf.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet || req.Header.Get("Upgrade") != "" {
+			parent.ServeHTTP(res, req)
+			return
+		}
+		buffered := &bufferedResponse{header: res.Header()}
+		parent.ServeHTTP(buffered, req)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+		body := buffered.body.Bytes()
+		if buffered.status != http.StatusOK {
+			res.WriteHeader(buffered.status)
+			res.Write(body)
+			return
+		}
+
+		gzipped := len(body) >= minSize && acceptsGzip(req) && res.Header().Get("Content-Encoding") == ""
+		etag := responseETag(body, gzipped)
+		res.Header().Set("ETag", etag)
+		res.Header().Add("Vary", "Accept-Encoding")
+		if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+			log.Debugf("<-- %s %s [%d]", req.Method, req.URL, http.StatusNotModified)
+			res.Header().Del("Content-Type")
+			res.Header().Del("Content-Length")
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if !gzipped {
+			res.WriteHeader(http.StatusOK)
+			res.Write(body)
+			return
+		}
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(body)
+		gz.Close()
+		res.Header().Set("Content-Encoding", "gzip")
+		res.Header().Set("Content-Length", strconv.Itoa(compressed.Len()))
+		res.WriteHeader(http.StatusOK)
+		res.Write(compressed.Bytes())
+	})
+}
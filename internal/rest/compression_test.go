@@ -0,0 +1,114 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCompressionHandler(status int, body string) http.Handler {
+	return newCompressionHandler(&CompressionConf{Enabled: true, MinSize: 10}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(status)
+		res.Write([]byte(body))
+	}))
+}
+
+func TestCompressionGzipAndETag(t *testing.T) {
+	assert := assert.New(t)
+
+	body := `{"abis":["` + strings.Repeat("a", 100) + `"]}`
+	handler := newTestCompressionHandler(200, body)
+
+	req := httptest.NewRequest("GET", "/abis", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.9")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(200, res.Code)
+	assert.Equal("gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal("application/json", res.Header().Get("Content-Type"))
+	etag := res.Header().Get("ETag")
+	assert.Regexp(`^"[0-9a-f]{32}-gzip"$`, etag)
+	gz, err := gzip.NewReader(res.Body)
+	assert.NoError(err)
+	uncompressed, _ := ioutil.ReadAll(gz)
+	assert.Equal(body, string(uncompressed))
+
+	req = httptest.NewRequest("GET", "/abis", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(304, res.Code)
+	assert.Empty(res.Body.Bytes())
+
+	// The uncompressed representation has a different ETag, so the gzip one does not match it
+	req = httptest.NewRequest("GET", "/abis", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Empty(res.Header().Get("Content-Encoding"))
+	assert.Equal(body, res.Body.String())
+	identityETag := res.Header().Get("ETag")
+	assert.Regexp(`^"[0-9a-f]{32}"$`, identityETag)
+	assert.Equal(strings.TrimSuffix(etag, `-gzip"`)+`"`, identityETag)
+
+	req = httptest.NewRequest("GET", "/abis", nil)
+	req.Header.Set("If-None-Match", identityETag)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(304, res.Code)
+}
+
+func TestCompressionSmallBody(t *testing.T) {
+	handler := newTestCompressionHandler(200, `{}`)
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, 200, res.Code)
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, `{}`, res.Body.String())
+}
+
+func TestCompressionSkipsErrorsAndPosts(t *testing.T) {
+	assert := assert.New(t)
+
+	body := strings.Repeat("e", 100)
+	req := httptest.NewRequest("GET", "/abis/missing", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	newTestCompressionHandler(404, body).ServeHTTP(res, req)
+	assert.Equal(404, res.Code)
+	assert.Empty(res.Header().Get("ETag"))
+	assert.Equal(body, res.Body.String())
+
+	req = httptest.NewRequest("POST", "/abis", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res = httptest.NewRecorder()
+	newTestCompressionHandler(200, body).ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Empty(res.Header().Get("ETag"))
+	assert.Equal(body, res.Body.String())
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	// Embeds the page of the console
+	_ "embed"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ConsolePath is the path of the web console
+	ConsolePath = "/admin/console"
+)
+
+// ConsoleConf enables the web console, which lets operators browse registered contracts,
+// call their read methods, inspect receipts and monitor event streams from a browser
+type ConsoleConf struct {
+	Enabled bool `json:"enabled"`
+}
+
+//go:embed console.html
+var consoleHTML []byte
+
+// consoleHandler serves the page of the console. The page calls the REST APIs of the gateway
+// from the browser, with the access token it was loaded with, so each view is authorized
+// in the same way as the API it uses
+func (g *RESTGateway) consoleHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	// The access token can be passed on the query, so it is dropped before anything is logged
+	req.URL.RawQuery = ""
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error serving console: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	if err := auth.AuthEventStreams(req.Context()); err != nil {
+		log.Errorf("Error serving console: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	status := 200
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.Header().Set("X-Frame-Options", "DENY")
+	res.WriteHeader(status)
+	res.Write(consoleHTML)
+}
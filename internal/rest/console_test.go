@@ -0,0 +1,79 @@
+// Copyright 2018, 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", ConsolePath, nil)
+	res := httptest.NewRecorder()
+	g.consoleHandler(res, req, nil)
+
+	assert.Equal(200, res.Code)
+	assert.Equal("text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Equal("no-store", res.Header().Get("Cache-Control"))
+	assert.Contains(res.Body.String(), "<title>Ethconnect Console</title>")
+}
+
+func TestConsoleHandlerAccessTokenQueryParam(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	router := httprouter.New()
+	router.GET(ConsolePath, g.consoleHandler)
+	handler := g.newAccessTokenContextHandler(router)
+
+	req := httptest.NewRequest("GET", ConsolePath+"?access_token=testat", nil)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+
+	req = httptest.NewRequest("GET", ConsolePath+"?access_token=wrong", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(401, res.Code)
+}
+
+func TestConsoleHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", ConsolePath, nil)
+	res := httptest.NewRecorder()
+	g.consoleHandler(res, req, nil)
+	assert.Equal(401, res.Code)
+}
@@ -0,0 +1,261 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// FeeReportPath is the path of the report of the gas and fees spent by stored receipts
+	FeeReportPath = "/reports/fees"
+
+	feeReportPageSize = 500
+	feeReportByDay    = "day"
+	feeReportByFrom   = "from"
+	feeReportByTarget = "contract"
+)
+
+// feeReceiptTypes are the types of the receipts of mined transactions, which have spent gas
+var feeReceiptTypes = []string{
+	messages.MsgTypeTransactionSuccess,
+	messages.MsgTypeTransactionFailure,
+	messages.MsgTypeTransactionConfirmed,
+}
+
+// feeReceiptFilter selects the receipts a fee report adds up. The addresses are lower case
+type feeReceiptFilter struct {
+	sinceEpochMS int64 // inclusive
+	untilEpochMS int64 // exclusive
+	from         string
+	contract     string
+}
+
+// feeReceiptQuerier is implemented by persistence layers that can apply the filter of a fee
+// report in the store query, returning only the matching receipts newest first
+type feeReceiptQuerier interface {
+	GetFeeReceipts(skip, limit int, filter *feeReceiptFilter) (*[]map[string]interface{}, error)
+}
+
+// feeReceiptContract returns the contract a receipt is accounted to, which for a deployment
+// is the contract it created
+func feeReceiptContract(receipt map[string]interface{}) string {
+	contract := strings.ToLower(utils.GetMapString(receipt, "to"))
+	if contract == "" {
+		contract = strings.ToLower(utils.GetMapString(receipt, "contractAddress"))
+	}
+	return contract
+}
+
+// matches checks a receipt against the filter, for persistence layers that cannot filter
+func (f *feeReceiptFilter) matches(receipt map[string]interface{}) bool {
+	receivedAt := receivedAtMS(receipt)
+	if (f.sinceEpochMS > 0 && receivedAt < f.sinceEpochMS) || (f.untilEpochMS > 0 && receivedAt >= f.untilEpochMS) {
+		return false
+	}
+	headers, _ := receipt["headers"].(map[string]interface{})
+	msgType := utils.GetMapString(headers, "type")
+	isFeeType := false
+	for _, t := range feeReceiptTypes {
+		if msgType == t {
+			isFeeType = true
+		}
+	}
+	if !isFeeType {
+		return false
+	}
+	if f.from != "" && strings.ToLower(utils.GetMapString(receipt, "from")) != f.from {
+		return false
+	}
+	return f.contract == "" || feeReceiptContract(receipt) == f.contract
+}
+
+// feeReportGroup is the spend of the transactions that share a day, from address or contract
+type feeReportGroup struct {
+	Key          string `json:"key,omitempty"`
+	Transactions int    `json:"transactions"`
+	GasUsed      string `json:"gasUsed"`
+	Fee          string `json:"fee"`
+	gasUsed      *big.Int
+	fee          *big.Int
+}
+
+// feeReport is the reply to a request for the spend of stored receipts
+type feeReport struct {
+	GroupBy string            `json:"groupBy"`
+	Groups  []*feeReportGroup `json:"groups"`
+	Total   *feeReportGroup   `json:"total"`
+}
+
+func newFeeReportGroup(key string) *feeReportGroup {
+	return &feeReportGroup{
+		Key:     key,
+		GasUsed: "0",
+		Fee:     "0",
+		gasUsed: new(big.Int),
+		fee:     new(big.Int),
+	}
+}
+
+func (g *feeReportGroup) add(gasUsed, fee *big.Int) {
+	g.Transactions++
+	g.gasUsed.Add(g.gasUsed, gasUsed)
+	g.fee.Add(g.fee, fee)
+	g.GasUsed = g.gasUsed.Text(10)
+	g.Fee = g.fee.Text(10)
+}
+
+// parseTimeParam parses a query parameter as an RFC3339 time, or a millisecond timestamp
+func parseTimeParam(s string) (int64, bool) {
+	if isoTime, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return isoTime.UnixNano() / int64(time.Millisecond), true
+	}
+	epochMS, err := strconv.ParseInt(s, 10, 64)
+	return epochMS, err == nil
+}
+
+// receivedAtMS returns the time a receipt was stored, which is a number of milliseconds
+// since the epoch in whichever numeric type the persistence layer returns it as
+func receivedAtMS(receipt map[string]interface{}) int64 {
+	switch v := receipt["receivedAt"].(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// getFeeReport handles a HTTP request for the gas and fees spent by the transactions in the
+// receipt store, grouped by day, by from address, or by contract
+func (r *receiptStore) getFeeReport(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error querying fee report: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	if r.persistence == nil {
+		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreDisabled), 405)
+		return
+	}
+
+	groupBy := req.FormValue("groupBy")
+	switch groupBy {
+	case "":
+		groupBy = feeReportByDay
+	case feeReportByDay, feeReportByFrom, feeReportByTarget:
+	default:
+		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreInvalidFeeReportGroupBy, groupBy), 400)
+		return
+	}
+	filter := &feeReceiptFilter{
+		from:     strings.ToLower(req.FormValue("from")),
+		contract: strings.ToLower(req.FormValue("contract")),
+	}
+	var ok bool
+	if since := req.FormValue("since"); since != "" {
+		if filter.sinceEpochMS, ok = parseTimeParam(since); !ok {
+			sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreInvalidRequestBadSince), 400)
+			return
+		}
+	}
+	if until := req.FormValue("until"); until != "" {
+		if filter.untilEpochMS, ok = parseTimeParam(until); !ok {
+			sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreInvalidRequestBadUntil), 400)
+			return
+		}
+	}
+	report := &feeReport{
+		GroupBy: groupBy,
+		Groups:  []*feeReportGroup{},
+		Total:   newFeeReportGroup(""),
+	}
+	groups := make(map[string]*feeReportGroup)
+
+	// Where the store can filter, we only page over the receipts in the report. Otherwise
+	// receipts are returned newest first, so paging stops at the first one before the report
+	querier, storeFiltered := r.persistence.(feeReceiptQuerier)
+	for skip, done := 0, false; !done; skip += feeReportPageSize {
+		var page *[]map[string]interface{}
+		var err error
+		if storeFiltered {
+			page, err = querier.GetFeeReceipts(skip, feeReportPageSize, filter)
+		} else {
+			page, err = r.persistence.GetReceipts(skip, feeReportPageSize, nil, 0, "", "")
+		}
+		if err != nil {
+			log.Errorf("Error querying fee report: %s", err)
+			sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreFailedQuery, err), 500)
+			return
+		}
+		done = len(*page) < feeReportPageSize
+		for _, receipt := range *page {
+			receivedAt := receivedAtMS(receipt)
+			if !storeFiltered {
+				if filter.sinceEpochMS > 0 && receivedAt < filter.sinceEpochMS {
+					done = true
+					break
+				}
+				if !filter.matches(receipt) {
+					continue
+				}
+			}
+			gasUsed, _ := new(big.Int).SetString(utils.GetMapString(receipt, "gasUsed"), 10)
+			if gasUsed == nil {
+				gasUsed = new(big.Int)
+			}
+			fee, _ := new(big.Int).SetString(utils.GetMapString(receipt, "fee"), 10)
+			if fee == nil {
+				fee = new(big.Int)
+			}
+
+			var key string
+			switch groupBy {
+			case feeReportByDay:
+				key = time.Unix(0, receivedAt*int64(time.Millisecond)).UTC().Format("2006-01-02")
+			case feeReportByFrom:
+				key = strings.ToLower(utils.GetMapString(receipt, "from"))
+			default:
+				key = feeReceiptContract(receipt)
+			}
+			group, exists := groups[key]
+			if !exists {
+				group = newFeeReportGroup(key)
+				groups[key] = group
+				report.Groups = append(report.Groups, group)
+			}
+			group.add(gasUsed, fee)
+			report.Total.add(gasUsed, fee)
+		}
+	}
+	sort.Slice(report.Groups, func(i, j int) bool { return report.Groups[i].Key < report.Groups[j].Key })
+	r.marshalAndReply(res, req, report)
+}
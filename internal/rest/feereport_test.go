@@ -0,0 +1,179 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func addTestFeeReceipt(r *receiptStore, msgType, from, to, contractAddress, gasUsed, fee string) {
+	replyMsg := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type":      msgType,
+			"requestId": utils.UUIDv4(),
+		},
+		"from":    from,
+		"gasUsed": gasUsed,
+		"fee":     fee,
+	}
+	if to != "" {
+		replyMsg["to"] = to
+	}
+	if contractAddress != "" {
+		replyMsg["contractAddress"] = contractAddress
+	}
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+	r.processReply(replyMsgBytes)
+}
+
+func getTestFeeReport(t *testing.T, url string) (int, *feeReport) {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	var report feeReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	return resp.StatusCode, &report
+}
+
+func TestFeeReportGroupBy(t *testing.T) {
+	assert := assert.New(t)
+
+	r, _, ts := newReceiptsTestServer()
+	defer ts.Close()
+
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xAAAA", "", "0xcccc", "1000", "20000")
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xaaaa", "0xcccc", "", "500", "10000")
+	addTestFeeReceipt(r, messages.MsgTypeTransactionFailure, "0xbbbb", "0xdddd", "", "300", "6000")
+	addTestFeeReceipt(r, messages.MsgTypeError, "0xbbbb", "0xdddd", "", "", "")
+
+	status, report := getTestFeeReport(t, ts.URL+"/reports/fees?groupBy=from")
+	assert.Equal(200, status)
+	assert.Equal("from", report.GroupBy)
+	assert.Equal([]*feeReportGroup{
+		{Key: "0xaaaa", Transactions: 2, GasUsed: "1500", Fee: "30000"},
+		{Key: "0xbbbb", Transactions: 1, GasUsed: "300", Fee: "6000"},
+	}, report.Groups)
+	assert.Equal(&feeReportGroup{Transactions: 3, GasUsed: "1800", Fee: "36000"}, report.Total)
+
+	status, report = getTestFeeReport(t, ts.URL+"/reports/fees?groupBy=contract&from=0xAAAA")
+	assert.Equal(200, status)
+	assert.Equal([]*feeReportGroup{
+		{Key: "0xcccc", Transactions: 2, GasUsed: "1500", Fee: "30000"},
+	}, report.Groups)
+
+	status, report = getTestFeeReport(t, ts.URL+"/reports/fees")
+	assert.Equal(200, status)
+	assert.Equal("day", report.GroupBy)
+	assert.Len(report.Groups, 1)
+	assert.Equal(time.Now().UTC().Format("2006-01-02"), report.Groups[0].Key)
+	assert.Equal(3, report.Groups[0].Transactions)
+}
+
+func TestFeeReportSinceUntil(t *testing.T) {
+	assert := assert.New(t)
+
+	r, _, ts := newReceiptsTestServer()
+	defer ts.Close()
+
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xaaaa", "0xcccc", "", "1000", "20000")
+	future := time.Now().Add(1 * time.Hour).UTC().Format(time.RFC3339)
+
+	status, report := getTestFeeReport(t, fmt.Sprintf("%s/reports/fees?since=%s", ts.URL, future))
+	assert.Equal(200, status)
+	assert.Empty(report.Groups)
+	assert.Equal(&feeReportGroup{GasUsed: "0", Fee: "0"}, report.Total)
+
+	status, report = getTestFeeReport(t, fmt.Sprintf("%s/reports/fees?since=0&until=%s", ts.URL, future))
+	assert.Equal(200, status)
+	assert.Equal(1, report.Total.Transactions)
+}
+
+func TestFeeReportBadParams(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, ts := newReceiptsTestServer()
+	defer ts.Close()
+
+	resp, _ := http.Get(ts.URL + "/reports/fees?groupBy=week")
+	assert.Equal(400, resp.StatusCode)
+	resp, _ = http.Get(ts.URL + "/reports/fees?since=yesterday")
+	assert.Equal(400, resp.StatusCode)
+	resp, _ = http.Get(ts.URL + "/reports/fees?until=tomorrow")
+	assert.Equal(400, resp.StatusCode)
+}
+
+func TestFeeReportQueryError(t *testing.T) {
+	_, ts := newReceiptsErrTestServer(fmt.Errorf("pop"))
+	defer ts.Close()
+
+	resp, _ := http.Get(ts.URL + "/reports/fees")
+	assert.Equal(t, 500, resp.StatusCode)
+}
+
+// unfilteredReceipts hides the fee report query of the persistence it wraps
+type unfilteredReceipts struct {
+	ReceiptStorePersistence
+}
+
+func TestFeeReportStoreWithoutFiltering(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p, ts := newReceiptsTestServer()
+	defer ts.Close()
+	r.persistence = &unfilteredReceipts{p}
+
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xAAAA", "", "0xcccc", "1000", "20000")
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xaaaa", "0xcccc", "", "500", "10000")
+	addTestFeeReceipt(r, messages.MsgTypeTransactionFailure, "0xbbbb", "0xdddd", "", "300", "6000")
+	addTestFeeReceipt(r, messages.MsgTypeError, "0xbbbb", "0xdddd", "", "", "")
+
+	status, report := getTestFeeReport(t, ts.URL+"/reports/fees?groupBy=from&contract=0xCCCC")
+	assert.Equal(200, status)
+	assert.Equal([]*feeReportGroup{
+		{Key: "0xaaaa", Transactions: 2, GasUsed: "1500", Fee: "30000"},
+	}, report.Groups)
+
+	future := time.Now().Add(1 * time.Hour).UTC().Format(time.RFC3339)
+	status, report = getTestFeeReport(t, fmt.Sprintf("%s/reports/fees?since=%s", ts.URL, future))
+	assert.Equal(200, status)
+	assert.Empty(report.Groups)
+}
+
+func TestMemoryReceiptsGetFeeReceipts(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newReceiptsTestStore(nil)
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xaaaa", "0xcccc", "", "1", "1")
+	addTestFeeReceipt(r, messages.MsgTypeError, "0xaaaa", "0xcccc", "", "", "")
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xaaaa", "0xcccc", "", "2", "2")
+	addTestFeeReceipt(r, messages.MsgTypeTransactionSuccess, "0xbbbb", "0xcccc", "", "3", "3")
+
+	// Newest first, skipping and limiting over the matching receipts only
+	page, err := p.GetFeeReceipts(0, 10, &feeReceiptFilter{from: "0xaaaa"})
+	assert.NoError(err)
+	assert.Len(*page, 2)
+	assert.Equal("2", (*page)[0]["gasUsed"])
+	page, err = p.GetFeeReceipts(1, 1, &feeReceiptFilter{contract: "0xcccc"})
+	assert.NoError(err)
+	assert.Len(*page, 1)
+	assert.Equal("2", (*page)[0]["gasUsed"])
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/kvstore"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKafkaQueueMaxMessages = 1000
+	defaultKafkaQueueRetrySec    = 5
+)
+
+// KafkaQueueConf is the configuration of the local persistent queue, that holds async
+// submissions accepted while the Kafka brokers are unavailable until they can be sent
+type KafkaQueueConf struct {
+	Path             string `json:"path"`
+	MaxMessages      int    `json:"maxMessages"`
+	RetryIntervalSec int    `json:"retryIntervalSec"`
+}
+
+// kafkaQueuedMsg is a message waiting in the queue to be sent to Kafka. The access token
+// of the caller is never written to disk
+type kafkaQueuedMsg struct {
+	ID          string          `json:"id"`
+	Key         string          `json:"key"`
+	Value       json.RawMessage `json:"value"`
+	AccessToken string          `json:"-"`
+	Queued      time.Time       `json:"queued"`
+}
+
+// kafkaQueue is a bounded FIFO of messages in a LevelDB. Each message is stored against
+// a sequence number, and messages are only removed from the head of the queue, so the
+// messages in the queue are always those from head up to (not including) next.
+// The access tokens of the messages are only held in memory, so messages left in the
+// queue by a previous run are sent without one
+type kafkaQueue struct {
+	conf   *KafkaQueueConf
+	store  kvstore.KVStore
+	lock   sync.Mutex
+	head   uint64
+	next   uint64
+	tokens map[uint64]string
+}
+
+func kafkaQueueKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// newKafkaQueue opens the queue, continuing from any messages left in it by a previous run
+func newKafkaQueue(conf *KafkaQueueConf) (*kafkaQueue, error) {
+	store, err := kvstore.NewLDBKeyValueStore(conf.Path)
+	if err != nil {
+		return nil, err
+	}
+	q := &kafkaQueue{
+		conf:   conf,
+		store:  store,
+		tokens: make(map[uint64]string),
+	}
+	first := true
+	it := store.NewIterator()
+	for it.Next() {
+		seq, err := strconv.ParseUint(it.Key(), 10, 64)
+		if err != nil {
+			log.Warnf("Ignoring invalid key '%s' in Kafka queue", it.Key())
+			continue
+		}
+		if first {
+			q.head = seq
+			first = false
+		}
+		q.next = seq + 1
+	}
+	it.Release()
+	if q.next > q.head {
+		log.Warnf("Kafka queue %s has %d messages waiting to be sent, without the access tokens of their callers", conf.Path, q.next-q.head)
+	}
+	return q, nil
+}
+
+func (q *kafkaQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return int(q.next - q.head)
+}
+
+// push adds a message to the tail of the queue, unless the queue is full
+func (q *kafkaQueue) push(msg *kafkaQueuedMsg) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if int(q.next-q.head) >= q.conf.MaxMessages {
+		return errors.Errorf(errors.WebhooksKafkaQueueFull, q.conf.MaxMessages)
+	}
+	b, _ := json.Marshal(msg)
+	if err := q.store.Put(kafkaQueueKey(q.next), b); err != nil {
+		return errors.Errorf(errors.WebhooksKafkaQueueWrite, err)
+	}
+	if msg.AccessToken != "" {
+		q.tokens[q.next] = msg.AccessToken
+	}
+	q.next++
+	log.Infof("Queued message %s for Kafka (%d queued)", msg.ID, q.next-q.head)
+	return nil
+}
+
+// peek returns the message at the head of the queue, or nil if the queue is empty.
+// A message that cannot be read is discarded
+func (q *kafkaQueue) peek() *kafkaQueuedMsg {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for q.head < q.next {
+		b, err := q.store.Get(kafkaQueueKey(q.head))
+		if err == nil {
+			var msg kafkaQueuedMsg
+			if err = json.Unmarshal(b, &msg); err == nil {
+				msg.AccessToken = q.tokens[q.head]
+				return &msg
+			}
+		}
+		log.Errorf("Discarding unreadable message %d from Kafka queue: %s", q.head, err)
+		q.store.Delete(kafkaQueueKey(q.head))
+		delete(q.tokens, q.head)
+		q.head++
+	}
+	return nil
+}
+
+// pop removes the message at the head of the queue, once it has been sent
+func (q *kafkaQueue) pop() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.head < q.next {
+		q.store.Delete(kafkaQueueKey(q.head))
+		delete(q.tokens, q.head)
+		q.head++
+	}
+}
+
+func (q *kafkaQueue) close() {
+	q.store.Close()
+}
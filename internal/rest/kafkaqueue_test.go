@@ -0,0 +1,118 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKafkaQueuePushPeekPop(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+
+	q, err := newKafkaQueue(&KafkaQueueConf{Path: path.Join(dir, "queue"), MaxMessages: 2})
+	assert.NoError(err)
+	assert.Nil(q.peek())
+
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg1", Key: "key1", Value: []byte(`{"a":1}`)}))
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg2", Key: "key2", Value: []byte(`{"a":2}`)}))
+	assert.EqualError(q.push(&kafkaQueuedMsg{ID: "msg3"}), "Kafka is unavailable, and the local queue is full with 2 messages")
+	assert.Equal(2, q.len())
+
+	msg := q.peek()
+	assert.Equal("msg1", msg.ID)
+	assert.Equal("key1", msg.Key)
+	assert.JSONEq(`{"a":1}`, string(msg.Value))
+	q.pop()
+	assert.Equal("msg2", q.peek().ID)
+	q.close()
+
+	// The queue continues from where it left off
+	q, err = newKafkaQueue(&KafkaQueueConf{Path: path.Join(dir, "queue"), MaxMessages: 2})
+	assert.NoError(err)
+	assert.Equal(1, q.len())
+	assert.Equal("msg2", q.peek().ID)
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg3"}))
+	q.pop()
+	assert.Equal("msg3", q.peek().ID)
+	q.pop()
+	assert.Nil(q.peek())
+	assert.Equal(0, q.len())
+	q.pop()
+	q.close()
+}
+
+func TestKafkaQueueAccessTokenNotStored(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+
+	q, err := newKafkaQueue(&KafkaQueueConf{Path: dir, MaxMessages: 10})
+	assert.NoError(err)
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg1", AccessToken: "s3cret"}))
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg2", AccessToken: "other"}))
+	stored, err := q.store.Get(kafkaQueueKey(0))
+	assert.NoError(err)
+	assert.NotContains(string(stored), "s3cret")
+	assert.Equal("s3cret", q.peek().AccessToken)
+	q.pop()
+	assert.Equal("other", q.peek().AccessToken)
+	assert.Len(q.tokens, 1)
+	q.close()
+
+	// The token does not survive a restart
+	q, err = newKafkaQueue(&KafkaQueueConf{Path: dir, MaxMessages: 10})
+	assert.NoError(err)
+	defer q.close()
+	msg := q.peek()
+	assert.Equal("msg2", msg.ID)
+	assert.Empty(msg.AccessToken)
+}
+
+func TestKafkaQueueDiscardsUnreadable(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+
+	q, err := newKafkaQueue(&KafkaQueueConf{Path: dir, MaxMessages: 10})
+	assert.NoError(err)
+	defer q.close()
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg1"}))
+	assert.NoError(q.push(&kafkaQueuedMsg{ID: "msg2"}))
+	q.store.Put(kafkaQueueKey(0), []byte("!json"))
+
+	assert.Equal("msg2", q.peek().ID)
+	assert.Equal(1, q.len())
+}
+
+func TestKafkaQueueBadPath(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, "file"), []byte{}, 0644)
+
+	_, err := newKafkaQueue(&KafkaQueueConf{Path: path.Join(dir, "file")})
+	assert.Regexp("Failed to open DB", err)
+}
@@ -19,6 +19,7 @@ import (
 	"sync"
 
 	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -57,6 +58,26 @@ func (m *memoryReceipts) GetReceipts(skip, limit int, ids []string, sinceEpochMS
 	return &results, nil
 }
 
+// GetFeeReceipts returns the receipts of mined transactions that match the filter of a fee report
+func (m *memoryReceipts) GetFeeReceipts(skip, limit int, f *feeReceiptFilter) (*[]map[string]interface{}, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	results := make([]map[string]interface{}, 0, limit)
+	for curElem := m.receipts.Front(); curElem != nil && len(results) < limit; curElem = curElem.Next() {
+		receipt := *curElem.Value.(*map[string]interface{})
+		if !f.matches(receipt) {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		results = append(results, receipt)
+	}
+	return &results, nil
+}
+
 func (m *memoryReceipts) GetReceipt(requestID string) (*map[string]interface{}, error) {
 	m.mux.Lock()
 	defer m.mux.Unlock()
@@ -84,3 +105,27 @@ func (m *memoryReceipts) AddReceipt(requestID string, receipt *map[string]interf
 	m.receipts.PushFront(receipt)
 	return nil
 }
+
+// AddReceipts adds a batch of receipts, in order
+func (m *memoryReceipts) AddReceipts(receipts []*map[string]interface{}) error {
+	for _, receipt := range receipts {
+		if err := m.AddReceipt(utils.GetMapString(*receipt, "_id"), receipt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateReceipt replaces the receipt with the same ID in place, or adds it if none exists
+func (m *memoryReceipts) UpdateReceipt(requestID string, receipt *map[string]interface{}) error {
+	m.mux.Lock()
+	for curElem := m.receipts.Front(); curElem != nil; curElem = curElem.Next() {
+		if id, exists := (*curElem.Value.(*map[string]interface{}))["_id"]; exists && id == requestID {
+			curElem.Value = receipt
+			m.mux.Unlock()
+			return nil
+		}
+	}
+	m.mux.Unlock()
+	return m.AddReceipt(requestID, receipt)
+}
@@ -45,6 +45,27 @@ func TestMemReceiptsWrapping(t *testing.T) {
 	}
 }
 
+func TestMemReceiptsUpdateReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newMemoryReceipts(&ReceiptStoreConf{
+		MaxDocs: 50,
+	})
+
+	r.AddReceipt("id1", &map[string]interface{}{"_id": "id1", "value": "a"})
+	r.AddReceipt("id2", &map[string]interface{}{"_id": "id2", "value": "b"})
+
+	r.UpdateReceipt("id1", &map[string]interface{}{"_id": "id1", "value": "c"})
+	assert.Equal(2, r.receipts.Len())
+	receipt, _ := r.GetReceipt("id1")
+	assert.Equal("c", (*receipt)["value"])
+
+	r.UpdateReceipt("id3", &map[string]interface{}{"_id": "id3", "value": "d"})
+	assert.Equal(3, r.receipts.Len())
+	receipt, _ = r.GetReceipt("id3")
+	assert.Equal("d", (*receipt)["value"])
+}
+
 func TestMemReceiptsNoIDFilterImpl(t *testing.T) {
 	assert := assert.New(t)
 
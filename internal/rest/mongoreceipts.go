@@ -15,6 +15,10 @@
 package rest
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/globalsign/mgo"
@@ -26,12 +30,19 @@ import (
 const (
 	mongoConnectTimeout = 10 * 1000
 	backoffFactor       = 1.1
+	partitionDaily      = "daily"
+	partitionWeekly     = "weekly"
 )
 
 type mongoReceipts struct {
 	conf       *MongoDBReceiptStoreConf
 	mgo        MongoDatabase
 	collection MongoCollection
+	// When partitioned by time, receipts are added to the collection of the current day or week,
+	// and queries fan out across the partitions from newest to oldest
+	partitionLock sync.Mutex
+	partition     string
+	partitions    []string
 }
 
 func newMongoReceipts(conf *MongoDBReceiptStoreConf) *mongoReceipts {
@@ -50,12 +61,24 @@ func (m *mongoReceipts) connect() (err error) {
 		err = errors.Errorf(errors.ReceiptStoreMongoDBConnect, err)
 		return
 	}
-	m.collection = m.mgo.GetCollection(m.conf.Database, m.conf.Collection)
-	if collErr := m.collection.Create(&mgo.CollectionInfo{
+	if m.conf.Partition != "" {
+		if err = m.loadPartitions(); err != nil {
+			return
+		}
+		_, err = m.currentCollection()
+		return
+	}
+	m.collection, err = m.openCollection(m.conf.Collection)
+	return
+}
+
+func (m *mongoReceipts) openCollection(name string) (MongoCollection, error) {
+	collection := m.mgo.GetCollection(m.conf.Database, name)
+	if collErr := collection.Create(&mgo.CollectionInfo{
 		Capped:  (m.conf.MaxDocs > 0),
 		MaxDocs: m.conf.MaxDocs,
 	}); collErr != nil {
-		log.Infof("MongoDB collection exists: %s", err)
+		log.Infof("MongoDB collection exists: %s", collErr)
 	}
 
 	index := mgo.Index{
@@ -65,19 +88,150 @@ func (m *mongoReceipts) connect() (err error) {
 		Background: true,
 		Sparse:     true,
 	}
-	if err = m.collection.EnsureIndex(index); err != nil {
-		err = errors.Errorf(errors.ReceiptStoreMongoDBIndex, err)
+	if err := collection.EnsureIndex(index); err != nil {
+		return nil, errors.Errorf(errors.ReceiptStoreMongoDBIndex, err)
+	}
+	if m.conf.Integrity != "" {
+		// Finds the newest record of each integrity chain on restart
+		chainIndex := mgo.Index{
+			Key:        []string{receiptChainField, receiptSeqField},
+			Background: true,
+		}
+		if err := collection.EnsureIndex(chainIndex); err != nil {
+			return nil, errors.Errorf(errors.ReceiptStoreMongoDBIndex, err)
+		}
+	}
+
+	log.Infof("Connected to MongoDB on %s DB=%s Collection=%s", m.conf.URL, m.conf.Database, name)
+	return collection, nil
+}
+
+// partitionName returns the name of the collection for receipts received at a time
+func (m *mongoReceipts) partitionName(t time.Time) string {
+	t = t.UTC()
+	if m.conf.Partition == partitionWeekly {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%s_%dw%02d", m.conf.Collection, year, week)
+	}
+	return fmt.Sprintf("%s_%s", m.conf.Collection, t.Format("20060102"))
+}
+
+// loadPartitions finds the existing partitions of the collection. The names sort by time
+func (m *mongoReceipts) loadPartitions() error {
+	names, err := m.mgo.CollectionNames(m.conf.Database)
+	if err != nil {
+		return errors.Errorf(errors.ReceiptStoreMongoDBPartitions, err)
+	}
+	suffix := `\d{8}`
+	if m.conf.Partition == partitionWeekly {
+		suffix = `\d{4}w\d{2}`
+	}
+	partitionCheck := regexp.MustCompile("^" + regexp.QuoteMeta(m.conf.Collection) + "_" + suffix + "$")
+	m.partitions = []string{}
+	for _, name := range names {
+		if partitionCheck.MatchString(name) {
+			m.partitions = append(m.partitions, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(m.partitions)))
+	log.Infof("Receipt store partitions: %v", m.partitions)
+	return nil
+}
+
+// currentCollection returns the collection to add new receipts to, rolling over
+// to a new partition at the start of each day or week
+func (m *mongoReceipts) currentCollection() (MongoCollection, error) {
+	if m.conf.Partition == "" {
+		return m.collection, nil
+	}
+	m.partitionLock.Lock()
+	defer m.partitionLock.Unlock()
+	partition := m.partitionName(time.Now())
+	if partition != m.partition {
+		collection, err := m.openCollection(partition)
+		if err != nil {
+			return nil, err
+		}
+		m.collection = collection
+		m.partition = partition
+		if len(m.partitions) == 0 || m.partitions[0] != partition {
+			m.partitions = append([]string{partition}, m.partitions...)
+		}
+		m.dropExpiredPartitions()
+	}
+	return m.collection, nil
+}
+
+// dropExpiredPartitions drops the oldest partitions beyond the number to retain
+func (m *mongoReceipts) dropExpiredPartitions() {
+	if m.conf.RetainPartitions <= 0 || len(m.partitions) <= m.conf.RetainPartitions {
 		return
 	}
+	for _, name := range m.partitions[m.conf.RetainPartitions:] {
+		if err := m.mgo.GetCollection(m.conf.Database, name).DropCollection(); err != nil {
+			log.Errorf("Failed to drop expired receipt store partition %s: %s", name, err)
+		} else {
+			log.Infof("Dropped expired receipt store partition %s", name)
+		}
+	}
+	m.partitions = m.partitions[:m.conf.RetainPartitions]
+}
 
-	log.Infof("Connected to MongoDB on %s DB=%s Collection=%s", m.conf.URL, m.conf.Database, m.conf.Collection)
-	return
+// readCollections returns the collections to query, newest first
+func (m *mongoReceipts) readCollections() []MongoCollection {
+	if m.conf.Partition == "" {
+		return []MongoCollection{m.collection}
+	}
+	m.partitionLock.Lock()
+	defer m.partitionLock.Unlock()
+	collections := make([]MongoCollection, len(m.partitions))
+	for i, name := range m.partitions {
+		collections[i] = m.mgo.GetCollection(m.conf.Database, name)
+	}
+	return collections
 }
 
 // AddReceipt processes an individual reply message, and contains all errors
 // To account for any transitory failures writing to mongoDB, it retries adding receipt with a backoff
 func (m *mongoReceipts) AddReceipt(requestID string, receipt *map[string]interface{}) (err error) {
-	return m.collection.Insert(*receipt)
+	collection, err := m.currentCollection()
+	if err != nil {
+		return err
+	}
+	return collection.Insert(*receipt)
+}
+
+// AddReceipts inserts a batch of receipts into the current collection in a single write
+func (m *mongoReceipts) AddReceipts(receipts []*map[string]interface{}) (err error) {
+	collection, err := m.currentCollection()
+	if err != nil {
+		return err
+	}
+	docs := make([]interface{}, len(receipts))
+	for i, receipt := range receipts {
+		docs[i] = *receipt
+	}
+	return collection.Insert(docs...)
+}
+
+// UpdateReceipt replaces the receipt with the same ID, or inserts it if none exists.
+// When partitioned, the receipt is replaced in the partition it was originally added to
+func (m *mongoReceipts) UpdateReceipt(requestID string, receipt *map[string]interface{}) (err error) {
+	collection, err := m.currentCollection()
+	if err != nil {
+		return err
+	}
+	if m.conf.Partition != "" {
+		for _, partition := range m.readCollections() {
+			existing := make(map[string]interface{})
+			if err := partition.Find(bson.M{"_id": requestID}).One(&existing); err == nil {
+				collection = partition
+				break
+			}
+		}
+	}
+	_, err = collection.UpsertId(requestID, *receipt)
+	return err
 }
 
 // GetReceipts Returns recent receipts with skip & limit
@@ -99,7 +253,50 @@ func (m *mongoReceipts) GetReceipts(skip, limit int, ids []string, sinceEpochMS
 	if to != "" {
 		filter["to"] = to
 	}
-	query := m.collection.Find(filter)
+	return m.findReceipts(filter, skip, limit)
+}
+
+// GetFeeReceipts returns the receipts of mined transactions that match the filter of a fee
+// report, newest first, so the report only pages over the receipts it adds up
+func (m *mongoReceipts) GetFeeReceipts(skip, limit int, f *feeReceiptFilter) (*[]map[string]interface{}, error) {
+	filter := bson.M{
+		"headers.type": bson.M{"$in": feeReceiptTypes},
+	}
+	receivedAt := bson.M{}
+	if f.sinceEpochMS > 0 {
+		receivedAt["$gte"] = f.sinceEpochMS
+	}
+	if f.untilEpochMS > 0 {
+		receivedAt["$lt"] = f.untilEpochMS
+	}
+	if len(receivedAt) > 0 {
+		filter["receivedAt"] = receivedAt
+	}
+	// Addresses are matched without case, as receipts store them as the node returned them
+	if f.from != "" {
+		filter["from"] = mongoMatchIgnoreCase(f.from)
+	}
+	if f.contract != "" {
+		// Deployments are accounted to the contract they created
+		filter["$or"] = []bson.M{
+			{"to": mongoMatchIgnoreCase(f.contract)},
+			{"to": bson.M{"$in": []interface{}{nil, ""}}, "contractAddress": mongoMatchIgnoreCase(f.contract)},
+		}
+	}
+	return m.findReceipts(filter, skip, limit)
+}
+
+func mongoMatchIgnoreCase(s string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(s) + "$", "$options": "i"}
+}
+
+// findReceipts runs a query across the partitions, newest first
+func (m *mongoReceipts) findReceipts(filter bson.M, skip, limit int) (*[]map[string]interface{}, error) {
+	collections := m.readCollections()
+	if len(collections) != 1 {
+		return m.getPartitionedReceipts(collections, filter, skip, limit)
+	}
+	query := collections[0].Find(filter)
 	query.Sort("-receivedAt")
 	if limit > 0 {
 		query.Limit(limit)
@@ -116,15 +313,71 @@ func (m *mongoReceipts) GetReceipts(skip, limit int, ids []string, sinceEpochMS
 	return &results, nil
 }
 
+// getPartitionedReceipts fans out a query across the partitions, newest first. As the partitions
+// cover consecutive periods, appending the results of each keeps them sorted newest first
+func (m *mongoReceipts) getPartitionedReceipts(collections []MongoCollection, filter bson.M, skip, limit int) (*[]map[string]interface{}, error) {
+	results := make([]map[string]interface{}, 0, limit)
+	for _, collection := range collections {
+		query := collection.Find(filter)
+		query.Sort("-receivedAt")
+		if limit > 0 {
+			query.Limit(skip + limit - len(results))
+		}
+		partitionResults := make([]map[string]interface{}, 0)
+		if err := query.All(&partitionResults); err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+		results = append(results, partitionResults...)
+		if limit > 0 && len(results) >= skip+limit {
+			results = results[:skip+limit]
+			break
+		}
+	}
+	if skip >= len(results) {
+		results = results[:0]
+	} else {
+		results = results[skip:]
+	}
+	return &results, nil
+}
+
 // getReply handles a HTTP request for an individual reply
 func (m *mongoReceipts) GetReceipt(requestID string) (*map[string]interface{}, error) {
-	query := m.collection.Find(bson.M{"_id": requestID})
-	result := make(map[string]interface{})
-	if err := query.One(&result); err == mgo.ErrNotFound {
-		return nil, nil
-	} else if err != nil {
-		return nil, err
+	for _, collection := range m.readCollections() {
+		query := collection.Find(bson.M{"_id": requestID})
+		result := make(map[string]interface{})
+		if err := query.One(&result); err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		} else {
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetLatestChainedReceipt returns the newest receipt of an integrity chain, or nil if the chain
+// has no receipts. Partitions are searched newest first
+func (m *mongoReceipts) GetLatestChainedReceipt(chain string) (*map[string]interface{}, error) {
+	filter := bson.M{
+		receiptHashField: bson.M{"$exists": true},
+	}
+	if chain != "" {
+		filter[receiptChainField] = chain
 	} else {
+		filter[receiptChainField] = bson.M{"$exists": false}
+	}
+	for _, collection := range m.readCollections() {
+		query := collection.Find(filter)
+		query.Sort("-" + receiptSeqField)
+		result := make(map[string]interface{})
+		if err := query.One(&result); err == mgo.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
 		return &result, nil
 	}
+	return nil, nil
 }
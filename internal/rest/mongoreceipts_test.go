@@ -30,6 +30,9 @@ type mockMongo struct {
 	url            string
 	databaseName   string
 	collectionName string
+	names          []string
+	namesErr       error
+	partitions     map[string]*mockCollection
 }
 
 func (m *mockMongo) Connect(url string, timeout time.Duration) (err error) {
@@ -40,24 +43,48 @@ func (m *mockMongo) Connect(url string, timeout time.Duration) (err error) {
 func (m *mockMongo) GetCollection(database string, collection string) MongoCollection {
 	m.databaseName = database
 	m.collectionName = collection
+	if m.partitions != nil {
+		partition, exists := m.partitions[collection]
+		if !exists {
+			partition = &mockCollection{}
+			m.partitions[collection] = partition
+		}
+		return partition
+	}
 	return &m.collection
 }
 
+func (m *mockMongo) CollectionNames(database string) ([]string, error) {
+	return m.names, m.namesErr
+}
+
 type mockCollection struct {
 	inserted       map[string]interface{}
+	insertedCount  int
 	insertErr      error
+	upsertedID     interface{}
+	upserted       map[string]interface{}
+	upsertErr      error
 	collInfo       *mgo.CollectionInfo
 	collErr        error
 	ensureIndexErr error
 	mockQuery      mockQuery
 	captureQuery   interface{}
+	dropped        bool
 }
 
 func (m *mockCollection) Insert(payloads ...interface{}) error {
 	m.inserted = payloads[0].(map[string]interface{})
+	m.insertedCount = len(payloads)
 	return m.insertErr
 }
 
+func (m *mockCollection) UpsertId(id interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	m.upsertedID = id
+	m.upserted = update.(map[string]interface{})
+	return &mgo.ChangeInfo{}, m.upsertErr
+}
+
 func (m *mockCollection) Create(info *mgo.CollectionInfo) error {
 	m.collInfo = info
 	return m.collErr
@@ -72,6 +99,11 @@ func (m *mockCollection) EnsureIndex(index mgo.Index) error {
 	return m.ensureIndexErr
 }
 
+func (m *mockCollection) DropCollection() error {
+	m.dropped = true
+	return nil
+}
+
 type mockQuery struct {
 	allErr        error
 	oneErr        error
@@ -212,6 +244,61 @@ func TestMongoReceiptsAddReceiptFailed(t *testing.T) {
 	assert.EqualError(err, "pop")
 }
 
+func TestMongoReceiptsAddReceiptsOK(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{},
+		mgo:  mgoMock,
+	}
+
+	r.connect()
+	receipt1 := map[string]interface{}{"_id": "key1"}
+	receipt2 := map[string]interface{}{"_id": "key2"}
+	err := r.AddReceipts([]*map[string]interface{}{&receipt1, &receipt2})
+	assert.NoError(err)
+	assert.Equal(2, mgoMock.collection.insertedCount)
+	assert.Equal("key1", mgoMock.collection.inserted["_id"])
+}
+
+func TestMongoReceiptsAddReceiptsFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{}
+	mgoMock.collection.insertErr = fmt.Errorf("pop")
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{},
+		mgo:  mgoMock,
+	}
+
+	r.connect()
+	receipt := make(map[string]interface{})
+	err := r.AddReceipts([]*map[string]interface{}{&receipt})
+	assert.EqualError(err, "pop")
+}
+
+func TestMongoReceiptsUpdateReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{},
+		mgo:  mgoMock,
+	}
+
+	r.connect()
+	receipt := map[string]interface{}{"_id": "key"}
+	err := r.UpdateReceipt("key", &receipt)
+	assert.NoError(err)
+	assert.Equal("key", mgoMock.collection.upsertedID)
+	assert.Equal(receipt, mgoMock.collection.upserted)
+
+	mgoMock.collection.upsertErr = fmt.Errorf("pop")
+	err = r.UpdateReceipt("key", &receipt)
+	assert.EqualError(err, "pop")
+}
+
 func TestMongoReceiptsGetReceiptsOK(t *testing.T) {
 	assert := assert.New(t)
 
@@ -274,6 +361,40 @@ func TestMongoReceiptsFilter(t *testing.T) {
 	assert.Equal("value2", (*results)[1]["key2"])
 }
 
+func TestMongoReceiptsGetFeeReceipts(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{},
+		mgo:  mgoMock,
+	}
+	r.connect()
+
+	_, err := r.GetFeeReceipts(500, 500, &feeReceiptFilter{
+		sinceEpochMS: 1000,
+		untilEpochMS: 2000,
+		from:         "0xaaaa",
+		contract:     "0xcccc",
+	})
+	assert.NoError(err)
+	queryBSON := mgoMock.collection.captureQuery.(bson.M)
+	assert.Equal(feeReceiptTypes, queryBSON["headers.type"].(bson.M)["$in"])
+	assert.Equal(bson.M{"$gte": int64(1000), "$lt": int64(2000)}, queryBSON["receivedAt"])
+	assert.Equal(bson.M{"$regex": "^0xaaaa$", "$options": "i"}, queryBSON["from"])
+	or := queryBSON["$or"].([]bson.M)
+	assert.Equal(bson.M{"$regex": "^0xcccc$", "$options": "i"}, or[0]["to"])
+	assert.Equal(bson.M{"$regex": "^0xcccc$", "$options": "i"}, or[1]["contractAddress"])
+	assert.Equal(500, mgoMock.collection.mockQuery.skip)
+	assert.Equal(500, mgoMock.collection.mockQuery.limit)
+	assert.Equal([]string{"-receivedAt"}, mgoMock.collection.mockQuery.sort)
+
+	_, err = r.GetFeeReceipts(0, 500, &feeReceiptFilter{})
+	assert.NoError(err)
+	queryBSON = mgoMock.collection.captureQuery.(bson.M)
+	assert.Len(queryBSON, 1)
+}
+
 func TestMongoReceiptsGetReceiptsNotFound(t *testing.T) {
 	assert := assert.New(t)
 
@@ -363,3 +484,143 @@ func TestMongoReceiptsGetReceiptError(t *testing.T) {
 	_, err := r.GetReceipt("receipt1")
 	assert.EqualError(err, "pop")
 }
+
+func newTestPartitionedReceipts(partitions map[string]*mockCollection) (*mongoReceipts, *mockMongo) {
+	mgoMock := &mockMongo{partitions: partitions}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{
+			Collection: "receipts",
+			Partition:  partitionDaily,
+		},
+		mgo:        mgoMock,
+		partitions: []string{"receipts_20210102", "receipts_20210101"},
+	}
+	return r, mgoMock
+}
+
+func TestMongoReceiptsPartitionName(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &mongoReceipts{conf: &MongoDBReceiptStoreConf{Collection: "receipts", Partition: partitionDaily}}
+	assert.Equal("receipts_20210104", r.partitionName(time.Date(2021, 1, 4, 23, 0, 0, 0, time.UTC)))
+	r.conf.Partition = partitionWeekly
+	assert.Equal("receipts_2021w01", r.partitionName(time.Date(2021, 1, 4, 23, 0, 0, 0, time.UTC)))
+	assert.Equal("receipts_2020w53", r.partitionName(time.Date(2021, 1, 3, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestMongoReceiptsPartitionedConnectRollover(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{
+		names:      []string{"receipts_20210101", "other", "receipts_2021w01", "receipts_20210102"},
+		partitions: map[string]*mockCollection{},
+	}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{
+			Collection:       "receipts",
+			Partition:        partitionDaily,
+			RetainPartitions: 2,
+		},
+		mgo: mgoMock,
+	}
+
+	err := r.connect()
+	assert.NoError(err)
+	today := r.partitionName(time.Now())
+	assert.Equal(today, r.partition)
+	assert.Equal([]string{today, "receipts_20210102"}, r.partitions)
+	assert.True(mgoMock.partitions["receipts_20210101"].dropped)
+	assert.False(mgoMock.partitions["receipts_20210102"].dropped)
+
+	receipt := map[string]interface{}{"_id": "key"}
+	err = r.AddReceipt("key", &receipt)
+	assert.NoError(err)
+	assert.Equal(receipt, mgoMock.partitions[today].inserted)
+}
+
+func TestMongoReceiptsPartitionedConnectFail(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{namesErr: fmt.Errorf("pop")}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{Collection: "receipts", Partition: partitionWeekly},
+		mgo:  mgoMock,
+	}
+	err := r.connect()
+	assert.EqualError(err, "Unable to list the receipt store partitions: pop")
+
+	mgoMock = &mockMongo{}
+	mgoMock.collection.ensureIndexErr = fmt.Errorf("pop")
+	r.mgo = mgoMock
+	err = r.connect()
+	assert.EqualError(err, "Unable to create index: pop")
+	err = r.AddReceipt("key", &map[string]interface{}{})
+	assert.EqualError(err, "Unable to create index: pop")
+}
+
+func TestMongoReceiptsPartitionedGetReceipts(t *testing.T) {
+	assert := assert.New(t)
+
+	twoResults := func(prefix string) func(result interface{}) {
+		return func(result interface{}) {
+			resArray := result.(*[]map[string]interface{})
+			*resArray = append(*resArray, map[string]interface{}{"_id": prefix + "1"}, map[string]interface{}{"_id": prefix + "2"})
+		}
+	}
+	newer := &mockCollection{mockQuery: mockQuery{resultWranger: twoResults("b")}}
+	older := &mockCollection{mockQuery: mockQuery{resultWranger: twoResults("a")}}
+	r, _ := newTestPartitionedReceipts(map[string]*mockCollection{
+		"receipts_20210102": newer,
+		"receipts_20210101": older,
+	})
+
+	results, err := r.GetReceipts(1, 2, nil, 0, "", "")
+	assert.NoError(err)
+	assert.Equal(3, newer.mockQuery.limit)
+	assert.Equal(1, older.mockQuery.limit)
+	assert.Len(*results, 2)
+	assert.Equal("b2", (*results)[0]["_id"])
+	assert.Equal("a1", (*results)[1]["_id"])
+
+	results, err = r.GetReceipts(5, 0, nil, 0, "", "")
+	assert.NoError(err)
+	assert.Len(*results, 0)
+
+	older.mockQuery.allErr = fmt.Errorf("pop")
+	_, err = r.GetReceipts(0, 10, nil, 0, "", "")
+	assert.EqualError(err, "pop")
+}
+
+func TestMongoReceiptsPartitionedGetAndUpdateReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	newer := &mockCollection{mockQuery: mockQuery{oneErr: mgo.ErrNotFound}}
+	older := &mockCollection{mockQuery: mockQuery{resultWranger: func(result interface{}) {
+		*(result.(*map[string]interface{})) = map[string]interface{}{"_id": "key"}
+	}}}
+	r, mgoMock := newTestPartitionedReceipts(map[string]*mockCollection{
+		"receipts_20210102": newer,
+		"receipts_20210101": older,
+	})
+	mgoMock.partitions[r.partitionName(time.Now())] = &mockCollection{mockQuery: mockQuery{oneErr: mgo.ErrNotFound}}
+
+	result, err := r.GetReceipt("key")
+	assert.NoError(err)
+	assert.Equal("key", (*result)["_id"])
+
+	receipt := map[string]interface{}{"_id": "key", "confirmations": "12"}
+	err = r.UpdateReceipt("key", &receipt)
+	assert.NoError(err)
+	assert.Equal("key", older.upsertedID)
+	assert.Nil(mgoMock.partitions[r.partition].upserted)
+
+	older.mockQuery.oneErr = mgo.ErrNotFound
+	older.mockQuery.resultWranger = nil
+	result, err = r.GetReceipt("key")
+	assert.NoError(err)
+	assert.Nil(result)
+
+	err = r.UpdateReceipt("key", &receipt)
+	assert.NoError(err)
+	assert.Equal(receipt, mgoMock.partitions[r.partition].upserted)
+}
@@ -30,14 +30,17 @@ import (
 type MongoDatabase interface {
 	Connect(url string, timeout time.Duration) error
 	GetCollection(database string, collection string) MongoCollection
+	CollectionNames(database string) ([]string, error)
 }
 
 // MongoCollection is the subset of mgo that we use, allowing stubbing
 type MongoCollection interface {
 	Insert(...interface{}) error
+	UpsertId(id interface{}, update interface{}) (*mgo.ChangeInfo, error)
 	Create(info *mgo.CollectionInfo) error
 	EnsureIndex(index mgo.Index) error
 	Find(query interface{}) MongoQuery
+	DropCollection() error
 }
 
 type mgoWrapper struct {
@@ -53,6 +56,10 @@ func (m *mgoWrapper) GetCollection(database string, collection string) MongoColl
 	return &collWrapper{coll: m.session.DB(database).C(collection)}
 }
 
+func (m *mgoWrapper) CollectionNames(database string) ([]string, error) {
+	return m.session.DB(database).CollectionNames()
+}
+
 type collWrapper struct {
 	coll *mgo.Collection
 }
@@ -61,6 +68,10 @@ func (m *collWrapper) Insert(docs ...interface{}) error {
 	return m.coll.Insert(docs...)
 }
 
+func (m *collWrapper) UpsertId(id interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	return m.coll.UpsertId(id, update)
+}
+
 func (m *collWrapper) Create(info *mgo.CollectionInfo) error {
 	return m.coll.Create(info)
 }
@@ -73,6 +84,10 @@ func (m *collWrapper) Find(query interface{}) MongoQuery {
 	return m.coll.Find(query)
 }
 
+func (m *collWrapper) DropCollection() error {
+	return m.coll.DropCollection()
+}
+
 // MongoQuery is the subset of mgo that we use, allowing stubbing
 type MongoQuery interface {
 	Limit(n int) *mgo.Query
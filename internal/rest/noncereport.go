@@ -0,0 +1,83 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// NonceReportPath is the path of the report reconciling the nonces of in-flight transactions with the node
+const NonceReportPath = "/reports/nonces"
+
+// nonceReport is the reply to a request for the nonce report, with a count of the discrepancies found
+type nonceReport struct {
+	Discrepancies int               `json:"discrepancies"`
+	Addresses     []*tx.NonceReport `json:"addresses"`
+}
+
+// nonceReportHandler reports the nonce state of every address with transactions in-flight, and of
+// the addresses in any from query parameters, against the transaction counts of the node
+func (g *RESTGateway) nonceReportHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error querying nonce report: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	if g.processor == nil {
+		sendRESTError(res, req, errors.Errorf(errors.TransactionNonceReportUnavailable), 405)
+		return
+	}
+
+	req.ParseForm()
+	addresses := []string{}
+	for _, from := range req.Form["from"] {
+		for _, addr := range strings.Split(from, ",") {
+			if addr = strings.TrimSpace(addr); addr == "" {
+				continue
+			}
+			if _, err := utils.StrToAddress("from", addr); err != nil {
+				sendRESTError(res, req, err, 400)
+				return
+			}
+			addresses = append(addresses, addr)
+		}
+	}
+
+	reports, err := g.processor.NonceReport(req.Context(), addresses)
+	if err != nil {
+		sendRESTError(res, req, err, 500)
+		return
+	}
+	report := &nonceReport{Addresses: reports}
+	for _, addrReport := range reports {
+		report.Discrepancies += len(addrReport.Discrepancies)
+	}
+	reply, _ := json.MarshalIndent(report, "", "  ")
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	res.Write(reply)
+}
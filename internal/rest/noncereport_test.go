@@ -0,0 +1,112 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/tx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNonceReportHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	processor := &mockProcessor{
+		nonceReports: []*tx.NonceReport{
+			{From: "0x12345", Discrepancies: []*tx.NonceDiscrepancy{{Type: tx.NonceDiscrepancyGap}, {Type: tx.NonceDiscrepancyStale}}},
+			{From: "0x67890", Discrepancies: []*tx.NonceDiscrepancy{}},
+		},
+	}
+	g.processor = processor
+
+	req := httptest.NewRequest("GET", NonceReportPath+"?from=0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c,0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1&from=", nil)
+	res := httptest.NewRecorder()
+	g.nonceReportHandler(res, req, nil)
+
+	assert.Equal(200, res.Code)
+	var report nonceReport
+	json.NewDecoder(res.Body).Decode(&report)
+	assert.Equal(2, report.Discrepancies)
+	assert.Len(report.Addresses, 2)
+	assert.Equal([]string{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"}, processor.nonceAddrs)
+}
+
+func TestNonceReportHandlerBadAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.processor = &mockProcessor{}
+
+	req := httptest.NewRequest("GET", NonceReportPath+"?from=badness", nil)
+	res := httptest.NewRecorder()
+	g.nonceReportHandler(res, req, nil)
+
+	assert.Equal(400, res.Code)
+}
+
+func TestNonceReportHandlerFail(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.processor = &mockProcessor{nonceErr: fmt.Errorf("pop")}
+
+	req := httptest.NewRequest("GET", NonceReportPath, nil)
+	res := httptest.NewRecorder()
+	g.nonceReportHandler(res, req, nil)
+
+	assert.Equal(500, res.Code)
+	var resBody restError
+	json.NewDecoder(res.Body).Decode(&resBody)
+	assert.Equal("pop", resBody.Message)
+}
+
+func TestNonceReportHandlerNoProcessor(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", NonceReportPath, nil)
+	res := httptest.NewRecorder()
+	g.nonceReportHandler(res, req, nil)
+
+	assert.Equal(405, res.Code)
+}
+
+func TestNonceReportHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", NonceReportPath, nil)
+	res := httptest.NewRecorder()
+	g.nonceReportHandler(res, req, nil)
+
+	assert.Equal(401, res.Code)
+}
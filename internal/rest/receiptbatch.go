@@ -0,0 +1,141 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchTimeout = 100
+)
+
+// receiptBatchWriter is implemented by persistence layers that can add many receipts in a single write
+type receiptBatchWriter interface {
+	AddReceipts(receipts []*map[string]interface{}) error
+}
+
+type pendingReceipt struct {
+	requestID string
+	receipt   map[string]interface{}
+}
+
+// receiptBatcher collects new receipts and adds them to the store together, when the batch is
+// full or the flush interval expires. Writes that update an existing record, and receipts chained
+// for integrity, are written individually after flushing any pending batch, so the store sees
+// every write for a request in the order they were received. The acknowledgement of each reply,
+// such as marking its Kafka offset, is held until the receipts before it are stored
+type receiptBatcher struct {
+	r         *receiptStore
+	writer    receiptBatchWriter
+	size      int
+	timeout   time.Duration
+	lock      sync.Mutex
+	writeLock sync.Mutex
+	pending   []*pendingReceipt
+	acks      []func()
+	timer     *time.Timer
+}
+
+func newReceiptBatcher(r *receiptStore, writer receiptBatchWriter) *receiptBatcher {
+	if r.conf.BatchTimeoutMS <= 0 {
+		r.conf.BatchTimeoutMS = defaultBatchTimeout
+	}
+	return &receiptBatcher{
+		r:       r,
+		writer:  writer,
+		size:    r.conf.BatchSize,
+		timeout: time.Duration(r.conf.BatchTimeoutMS) * time.Millisecond,
+	}
+}
+
+// add queues a new receipt, writing the batch if it is now full
+func (b *receiptBatcher) add(requestID string, receipt map[string]interface{}) {
+	b.lock.Lock()
+	b.pending = append(b.pending, &pendingReceipt{requestID: requestID, receipt: receipt})
+	full := len(b.pending) >= b.size
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.timeout, b.flush)
+	}
+	b.lock.Unlock()
+	if full {
+		b.flush()
+	}
+}
+
+// afterPending calls ack once every receipt already pending is stored, immediately if there
+// are none. Acknowledgements are made in the order they are queued
+func (b *receiptBatcher) afterPending(ack func()) {
+	b.writeLock.Lock()
+	defer b.writeLock.Unlock()
+
+	b.lock.Lock()
+	if len(b.pending) > 0 {
+		b.acks = append(b.acks, ack)
+		b.lock.Unlock()
+		return
+	}
+	b.lock.Unlock()
+	ack()
+}
+
+// flush writes any pending receipts, returning once they are stored. Batches are taken from
+// the queue while holding the write lock, so a flush waits for any batch already being written.
+// The acknowledgements queued behind the batch are only made once it is stored
+func (b *receiptBatcher) flush() {
+	b.writeLock.Lock()
+	defer b.writeLock.Unlock()
+
+	b.lock.Lock()
+	batch, acks := b.pending, b.acks
+	b.pending, b.acks = nil, nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.lock.Unlock()
+
+	if len(batch) > 0 {
+		b.write(batch)
+	}
+	for _, ack := range acks {
+		ack()
+	}
+}
+
+func (b *receiptBatcher) write(batch []*pendingReceipt) {
+	receipts := make([]*map[string]interface{}, len(batch))
+	for i, p := range batch {
+		receipts[i] = &p.receipt
+	}
+	if err := b.writer.AddReceipts(receipts); err != nil {
+		// Part of the batch might have been stored, so each receipt is written individually
+		// with the usual retry, and handling of receipts that already exist
+		log.Warnf("Failed to add batch of %d receipts, writing individually: %s", len(batch), err)
+		for _, p := range batch {
+			b.r.writeReceipt(p.requestID, p.receipt, false)
+		}
+		return
+	}
+	log.Infof("Inserted batch of %d receipts into receipt store", len(batch))
+	if b.r.smartContractGW != nil {
+		for _, p := range batch {
+			b.r.smartContractGW.SendReply(p.receipt)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockBatchReceipts struct {
+	*memoryReceipts
+	batches  int
+	batchErr error
+}
+
+func (m *mockBatchReceipts) AddReceipts(receipts []*map[string]interface{}) error {
+	m.batches++
+	if m.batchErr != nil {
+		return m.batchErr
+	}
+	return m.memoryReceipts.AddReceipts(receipts)
+}
+
+func newBatchTestStore(conf *ReceiptStoreConf, replyCallback func(message interface{})) (*receiptStore, *mockBatchReceipts) {
+	conf.MaxDocs = 50
+	p := &mockBatchReceipts{memoryReceipts: newMemoryReceipts(conf)}
+	r := newReceiptStore(conf, p, &mockContractGW{replyCallback: replyCallback})
+	return r, p
+}
+
+func TestReceiptBatchWrittenWhenFull(t *testing.T) {
+	assert := assert.New(t)
+
+	replies := 0
+	r, p := newBatchTestStore(&ReceiptStoreConf{BatchSize: 3, BatchTimeoutMS: 60000}, func(message interface{}) {
+		replies++
+	})
+	assert.NotNil(r.batcher)
+
+	r.storeReceipt("id1", map[string]interface{}{"_id": "id1"}, false)
+	r.storeReceipt("id2", map[string]interface{}{"_id": "id2"}, false)
+	assert.Equal(0, p.receipts.Len())
+	assert.Equal(0, replies)
+
+	r.storeReceipt("id3", map[string]interface{}{"_id": "id3"}, false)
+	assert.Equal(1, p.batches)
+	assert.Equal(3, p.receipts.Len())
+	assert.Equal(3, replies)
+	assert.Nil(r.batcher.timer)
+}
+
+func TestReceiptBatchWrittenAfterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	replied := make(chan interface{}, 1)
+	r, p := newBatchTestStore(&ReceiptStoreConf{BatchSize: 10, BatchTimeoutMS: 1}, func(message interface{}) {
+		replied <- message
+	})
+
+	r.storeReceipt("id1", map[string]interface{}{"_id": "id1"}, false)
+	reply := <-replied
+	assert.Equal("id1", reply.(map[string]interface{})["_id"])
+	assert.Equal(1, p.batches)
+	assert.Equal(1, p.receipts.Len())
+}
+
+func TestReceiptBatchFlushedBeforeUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newBatchTestStore(&ReceiptStoreConf{BatchSize: 10, BatchTimeoutMS: 60000}, nil)
+
+	r.storeReceipt("id1", map[string]interface{}{"_id": "id1", "stage": "mined"}, false)
+	r.storeReceipt("id1", map[string]interface{}{"_id": "id1", "stage": "confirmed"}, true)
+	assert.Equal(1, p.batches)
+	assert.Equal(1, p.receipts.Len())
+	stored, _ := p.GetReceipt("id1")
+	assert.Equal("confirmed", (*stored)["stage"])
+}
+
+func TestReceiptBatchFailureWritesIndividually(t *testing.T) {
+	assert := assert.New(t)
+
+	replies := 0
+	r, p := newBatchTestStore(&ReceiptStoreConf{BatchSize: 2, BatchTimeoutMS: 60000}, func(message interface{}) {
+		replies++
+	})
+	p.batchErr = fmt.Errorf("pop")
+
+	r.storeReceipt("id1", map[string]interface{}{"_id": "id1"}, false)
+	r.storeReceipt("id2", map[string]interface{}{"_id": "id2"}, false)
+	assert.Equal(1, p.batches)
+	assert.Equal(2, p.receipts.Len())
+	assert.Equal(2, replies)
+}
+
+func TestReceiptBatchAcksAfterWrite(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newBatchTestStore(&ReceiptStoreConf{BatchSize: 10, BatchTimeoutMS: 60000}, nil)
+
+	var acked []string
+	r.processReplyWithAck([]byte(`{"headers":{"requestId":"id1","type":"TransactionSuccess"}}`), func() { acked = append(acked, "id1") })
+	r.processReplyWithAck([]byte(`!json`), func() { acked = append(acked, "bad") })
+	r.processReplyWithAck([]byte(`{"headers":{"requestId":"id2","type":"TransactionSuccess"}}`), func() { acked = append(acked, "id2") })
+	assert.Empty(acked)
+	assert.Equal(0, p.receipts.Len())
+
+	r.close()
+	assert.Equal(2, p.receipts.Len())
+	assert.Equal([]string{"id1", "bad", "id2"}, acked)
+
+	// Nothing is pending, so the next ack is immediate
+	r.processReplyWithAck([]byte(`!json`), func() { acked = append(acked, "bad2") })
+	assert.Equal([]string{"id1", "bad", "id2", "bad2"}, acked)
+}
+
+func TestReceiptBatchClose(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newBatchTestStore(&ReceiptStoreConf{BatchSize: 10, BatchTimeoutMS: 60000}, nil)
+
+	r.storeReceipt("id1", map[string]interface{}{"_id": "id1"}, false)
+	r.close()
+	assert.Equal(1, p.receipts.Len())
+	assert.Nil(r.batcher.timer)
+
+	r.close()
+	assert.Equal(1, p.batches)
+}
+
+func TestReceiptBatchDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	r, _ := newBatchTestStore(&ReceiptStoreConf{BatchSize: 1}, nil)
+	assert.Nil(r.batcher)
+
+	r, _ = newBatchTestStore(&ReceiptStoreConf{BatchSize: 10, Integrity: ReceiptIntegrityGlobal}, nil)
+	assert.Nil(r.batcher)
+
+	r = newReceiptStore(&ReceiptStoreConf{BatchSize: 10}, &mockReceiptErrs{}, nil)
+	assert.Nil(r.batcher)
+	r.close()
+
+	r, _ = newBatchTestStore(&ReceiptStoreConf{BatchSize: 10}, nil)
+	assert.Equal(defaultBatchTimeout, r.conf.BatchTimeoutMS)
+}
@@ -0,0 +1,340 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ReceiptIntegrityGlobal chains every receipt to the one stored before it
+	ReceiptIntegrityGlobal = "global"
+	// ReceiptIntegrityAddress chains each receipt to the one stored before it for the same from address
+	ReceiptIntegrityAddress = "address"
+
+	receiptChainField       = "_chain"
+	receiptSeqField         = "_seq"
+	receiptPrevIDField      = "_prevId"
+	receiptPrevHashField    = "_prevHash"
+	receiptHashField        = "_hash"
+	receiptPriorHashesField = "_priorHashes"
+)
+
+// receiptChainHeads is implemented by persistence layers that keep receipts across restarts,
+// so the chains can continue from the newest record stored in each
+type receiptChainHeads interface {
+	GetLatestChainedReceipt(chain string) (*map[string]interface{}, error)
+}
+
+type receiptChainHead struct {
+	id   string
+	seq  int64
+	hash string
+}
+
+// receiptChain links each receipt written to the store to the previous one with a hash, so
+// changes to stored receipts, or receipts removed from the middle of the chain, can be detected.
+// A receipt that replaces an earlier record for the same request (a progress message replaced by
+// the receipt, or a receipt replaced by its confirmation) keeps the position of that record in the
+// chain, and keeps the hashes of the versions it replaced so the next record still links to it
+type receiptChain struct {
+	mode        string
+	persistence ReceiptStorePersistence
+	lock        sync.Mutex
+	heads       map[string]*receiptChainHead
+}
+
+// receiptVerification is the result of checking one record of a chain
+type receiptVerification struct {
+	ID           string `json:"id"`
+	Seq          int64  `json:"seq"`
+	Hash         string `json:"hash"`
+	ComputedHash string `json:"computedHash,omitempty"`
+	PrevID       string `json:"prevId,omitempty"`
+	PrevHash     string `json:"prevHash,omitempty"`
+	Valid        bool   `json:"valid"`
+	Error        string `json:"error,omitempty"`
+}
+
+// receiptChainVerification is the result of walking back along a chain from a receipt
+type receiptChainVerification struct {
+	Valid   bool                   `json:"valid"`
+	Chain   string                 `json:"chain,omitempty"`
+	Records []*receiptVerification `json:"records"`
+}
+
+func newReceiptChain(mode string, persistence ReceiptStorePersistence) *receiptChain {
+	return &receiptChain{
+		mode:        mode,
+		persistence: persistence,
+		heads:       make(map[string]*receiptChainHead),
+	}
+}
+
+// receiptHash is the hex SHA-256 of the JSON of a receipt, without its own hash
+func receiptHash(receipt map[string]interface{}) (string, error) {
+	hashed := make(map[string]interface{}, len(receipt))
+	for k, v := range receipt {
+		if k != receiptHashField {
+			hashed[k] = v
+		}
+	}
+	b, err := json.Marshal(hashed)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// receiptSeq reads the sequence of a record, which is decoded as a different type depending on the store
+func receiptSeq(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+// priorHashes returns the hashes of the earlier versions of a record
+func priorHashes(receipt map[string]interface{}) []string {
+	var hashes []string
+	switch prior := receipt[receiptPriorHashesField].(type) {
+	case []string:
+		hashes = append(hashes, prior...)
+	case []interface{}:
+		for _, h := range prior {
+			if s, ok := h.(string); ok {
+				hashes = append(hashes, s)
+			}
+		}
+	}
+	return hashes
+}
+
+// chainOf returns the name of the chain a new receipt is added to
+func (c *receiptChain) chainOf(receipt map[string]interface{}) string {
+	if c.mode == ReceiptIntegrityAddress {
+		return strings.ToLower(utils.GetMapString(receipt, "from"))
+	}
+	return ""
+}
+
+func isProgressRecord(receipt map[string]interface{}) bool {
+	headers, _ := receipt["headers"].(map[string]interface{})
+	return utils.GetMapString(headers, "type") == messages.MsgTypeTransactionProgress
+}
+
+// head returns the newest record of a chain, loading it from the store the first time the
+// chain is used. Nil is returned for a new chain
+func (c *receiptChain) head(chain string) (*receiptChainHead, error) {
+	if head, exists := c.heads[chain]; exists {
+		return head, nil
+	}
+	var head *receiptChainHead
+	if heads, ok := c.persistence.(receiptChainHeads); ok {
+		latest, err := heads.GetLatestChainedReceipt(chain)
+		if err != nil {
+			return nil, errors.Errorf(errors.ReceiptStoreIntegrityChainHead, err)
+		}
+		if latest != nil {
+			head = &receiptChainHead{
+				id:   utils.GetMapString(*latest, "_id"),
+				seq:  receiptSeq((*latest)[receiptSeqField]),
+				hash: utils.GetMapString(*latest, receiptHashField),
+			}
+			log.Infof("Receipt chain '%s' continues from %s (seq=%d)", chain, head.id, head.seq)
+		}
+	}
+	c.heads[chain] = head
+	return head, nil
+}
+
+// write links a receipt into its chain and persists it. The lock is held until the write
+// completes, so the next receipt links to the one actually stored before it
+func (c *receiptChain) write(requestID string, receipt map[string]interface{}, update bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var existing *map[string]interface{}
+	if update {
+		var err error
+		if existing, err = c.persistence.GetReceipt(requestID); err != nil {
+			return err
+		}
+	}
+
+	var chain string
+	var newHead *receiptChainHead
+	if existing != nil && utils.GetMapString(*existing, receiptHashField) != "" {
+		// Keep the position of the record being replaced
+		for _, field := range []string{receiptChainField, receiptSeqField, receiptPrevIDField, receiptPrevHashField} {
+			if v, exists := (*existing)[field]; exists {
+				receipt[field] = v
+			} else {
+				delete(receipt, field)
+			}
+		}
+		receipt[receiptPriorHashesField] = append(priorHashes(*existing), utils.GetMapString(*existing, receiptHashField))
+		chain = utils.GetMapString(*existing, receiptChainField)
+	} else if chain = c.chainOf(receipt); chain == "" && c.mode == ReceiptIntegrityAddress && isProgressRecord(receipt) {
+		// A progress record has no from address, so is not chained, and the receipt that
+		// replaces it is added to the chain of its from address
+		log.Debugf("%s: Storing progress record outside the receipt chains", requestID)
+		return c.store(requestID, receipt, update)
+	} else {
+		head, err := c.head(chain)
+		if err != nil {
+			return err
+		}
+		for _, field := range []string{receiptChainField, receiptPrevIDField, receiptPrevHashField, receiptPriorHashesField} {
+			delete(receipt, field)
+		}
+		newHead = &receiptChainHead{id: requestID, seq: 1}
+		if head != nil {
+			newHead.seq = head.seq + 1
+			receipt[receiptPrevIDField] = head.id
+			receipt[receiptPrevHashField] = head.hash
+		}
+		if chain != "" {
+			receipt[receiptChainField] = chain
+		}
+		receipt[receiptSeqField] = newHead.seq
+	}
+
+	hash, err := receiptHash(receipt)
+	if err != nil {
+		return err
+	}
+	receipt[receiptHashField] = hash
+	if err := c.store(requestID, receipt, update); err != nil {
+		return err
+	}
+
+	if newHead != nil {
+		newHead.hash = hash
+		c.heads[chain] = newHead
+	} else if head := c.heads[chain]; head != nil && head.id == requestID {
+		head.hash = hash
+	}
+	return nil
+}
+
+func (c *receiptChain) store(requestID string, receipt map[string]interface{}, update bool) error {
+	if update {
+		return c.persistence.UpdateReceipt(requestID, &receipt)
+	}
+	return c.persistence.AddReceipt(requestID, &receipt)
+}
+
+// verifyRecord checks the hash of a stored receipt matches its content
+func verifyRecord(requestID string, receipt map[string]interface{}) *receiptVerification {
+	v := &receiptVerification{
+		ID:       requestID,
+		Seq:      receiptSeq(receipt[receiptSeqField]),
+		Hash:     utils.GetMapString(receipt, receiptHashField),
+		PrevID:   utils.GetMapString(receipt, receiptPrevIDField),
+		PrevHash: utils.GetMapString(receipt, receiptPrevHashField),
+	}
+	if v.Hash == "" {
+		v.Error = errors.Errorf(errors.ReceiptStoreIntegrityUnchained).Error()
+		return v
+	}
+	computed, err := receiptHash(receipt)
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	v.ComputedHash = computed
+	if computed != v.Hash {
+		v.Error = errors.Errorf(errors.ReceiptStoreIntegrityHashMismatch).Error()
+		return v
+	}
+	v.Valid = true
+	return v
+}
+
+// linksTo checks a record links to the current or an earlier version of the record before it
+func linksTo(v *receiptVerification, prev map[string]interface{}) bool {
+	if receiptSeq(prev[receiptSeqField]) != v.Seq-1 {
+		return false
+	}
+	if utils.GetMapString(prev, receiptHashField) == v.PrevHash {
+		return true
+	}
+	for _, h := range priorHashes(prev) {
+		if h == v.PrevHash {
+			return true
+		}
+	}
+	return false
+}
+
+// verify walks back along the chain from a receipt, checking up to depth records and the link of each
+// to the record before it. Nil is returned if the receipt is not in the store
+func (c *receiptChain) verify(requestID string, depth int) (*receiptChainVerification, error) {
+	receipt, err := c.persistence.GetReceipt(requestID)
+	if err != nil || receipt == nil {
+		return nil, err
+	}
+	result := &receiptChainVerification{
+		Valid:   true,
+		Chain:   utils.GetMapString(*receipt, receiptChainField),
+		Records: []*receiptVerification{},
+	}
+	id := requestID
+	for i := 0; i < depth; i++ {
+		v := verifyRecord(id, *receipt)
+		result.Records = append(result.Records, v)
+		if !v.Valid || v.PrevID == "" {
+			break
+		}
+		prev, err := c.persistence.GetReceipt(v.PrevID)
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil {
+			v.Valid = false
+			v.Error = errors.Errorf(errors.ReceiptStoreIntegrityMissingPrev, v.PrevID).Error()
+			break
+		}
+		if !linksTo(v, *prev) {
+			v.Valid = false
+			v.Error = errors.Errorf(errors.ReceiptStoreIntegrityBrokenLink, v.PrevID).Error()
+			break
+		}
+		id, receipt = v.PrevID, prev
+	}
+	for _, v := range result.Records {
+		result.Valid = result.Valid && v.Valid
+	}
+	return result, nil
+}
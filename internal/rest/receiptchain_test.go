@@ -0,0 +1,365 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newChainedReceiptsTestServer(integrity string) (*receiptStore, *memoryReceipts, *httptest.Server) {
+	conf := &ReceiptStoreConf{
+		MaxDocs:    50,
+		QueryLimit: 50,
+		Integrity:  integrity,
+	}
+	p := newMemoryReceipts(conf)
+	r := newReceiptStore(conf, p, &mockContractGW{})
+	router := &httprouter.Router{}
+	r.addRoutes(router)
+	return r, p, httptest.NewServer(router)
+}
+
+func testChainedReceipt(reqID, msgType, from string) []byte {
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = msgType
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = reqID
+	txHash := ethbind.API.HexToHash("0x02587104e9879911bea3d5bf6ccd7e1a6cb9a03145b8a1141804cebd6aa67c5c")
+	replyMsg.TransactionHash = &txHash
+	fromAddr := ethbind.API.HexToAddress(from)
+	replyMsg.From = &fromAddr
+	b, _ := json.Marshal(&replyMsg)
+	return b
+}
+
+func testVerifyReceipt(assert *assert.Assertions, ts *httptest.Server, path string) *receiptChainVerification {
+	status, respJSON, err := testGETObject(ts, path)
+	assert.NoError(err)
+	assert.Equal(200, status)
+	b, _ := json.Marshal(respJSON)
+	var result receiptChainVerification
+	json.Unmarshal(b, &result)
+	return &result
+}
+
+func TestReceiptChainGlobal(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x2222222222222222222222222222222222222222"))
+	r.processReply(testChainedReceipt("req3", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+
+	req1, _ := p.GetReceipt("req1")
+	req3, _ := p.GetReceipt("req3")
+	assert.Equal(int64(1), (*req1)[receiptSeqField])
+	assert.NotContains(*req1, receiptPrevIDField)
+	assert.Equal(int64(3), (*req3)[receiptSeqField])
+	assert.Equal("req2", (*req3)[receiptPrevIDField])
+
+	result := testVerifyReceipt(assert, ts, "/replies/req3/verify?depth=5")
+	assert.True(result.Valid)
+	assert.Len(result.Records, 3)
+	assert.Equal("req1", result.Records[2].ID)
+	assert.Equal(result.Records[2].Hash, result.Records[1].PrevHash)
+
+	result = testVerifyReceipt(assert, ts, "/replies/req3/verify")
+	assert.True(result.Valid)
+	assert.Len(result.Records, 1)
+}
+
+func TestReceiptChainConfirmationKeepsPosition(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	req1, _ := p.GetReceipt("req1")
+	minedHash := (*req1)[receiptHashField]
+
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionConfirmed, "0x1111111111111111111111111111111111111111"))
+	req1, _ = p.GetReceipt("req1")
+	assert.Equal(int64(1), (*req1)[receiptSeqField])
+	assert.Equal([]string{minedHash.(string)}, (*req1)[receiptPriorHashesField])
+	assert.NotEqual(minedHash, (*req1)[receiptHashField])
+
+	result := testVerifyReceipt(assert, ts, "/replies/req2/verify?depth=2")
+	assert.True(result.Valid)
+	assert.Len(result.Records, 2)
+
+	// The next receipt links to the head of the chain, not the replaced record
+	r.processReply(testChainedReceipt("req3", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	req3, _ := p.GetReceipt("req3")
+	assert.Equal("req2", (*req3)[receiptPrevIDField])
+	assert.Equal(int64(3), (*req3)[receiptSeqField])
+}
+
+func TestReceiptChainReplaceHead(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+
+	progress := messages.NewTransactionProgress(messages.ProgressStageSubmitted)
+	progress.Headers.ID = utils.UUIDv4()
+	progress.Headers.ReqID = "req1"
+	progressBytes, _ := json.Marshal(progress)
+	r.processReply(progressBytes)
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+
+	req1, _ := p.GetReceipt("req1")
+	req2, _ := p.GetReceipt("req2")
+	assert.Equal((*req1)[receiptHashField], (*req2)[receiptPrevHashField])
+
+	result := testVerifyReceipt(assert, ts, "/replies/req2/verify?depth=2")
+	assert.True(result.Valid)
+}
+
+func TestReceiptChainTampered(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+
+	req1, _ := p.GetReceipt("req1")
+	(*req1)["transactionHash"] = "0x0000000000000000000000000000000000000000000000000000000000000000"
+	result := testVerifyReceipt(assert, ts, "/replies/req1/verify")
+	assert.False(result.Valid)
+	assert.Equal("Receipt content does not match its integrity hash", result.Records[0].Error)
+
+	// Re-hashing the changed record breaks the link from the next one
+	(*req1)[receiptHashField], _ = receiptHash(*req1)
+	result = testVerifyReceipt(assert, ts, "/replies/req2/verify?depth=2")
+	assert.False(result.Valid)
+	assert.Len(result.Records, 1)
+	assert.Equal("Previous receipt 'req1' does not match the hash and sequence recorded for it", result.Records[0].Error)
+}
+
+func TestReceiptChainMissingPrevious(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	p.receipts.Remove(p.receipts.Back())
+
+	result := testVerifyReceipt(assert, ts, "/replies/req2/verify?depth=2")
+	assert.False(result.Valid)
+	assert.Equal("Previous receipt 'req1' in the chain is not available", result.Records[0].Error)
+}
+
+func TestReceiptChainUnchainedRecord(t *testing.T) {
+	assert := assert.New(t)
+	_, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+
+	p.AddReceipt("req1", &map[string]interface{}{"_id": "req1"})
+	result := testVerifyReceipt(assert, ts, "/replies/req1/verify")
+	assert.False(result.Valid)
+	assert.Equal("Receipt was not stored with an integrity hash", result.Records[0].Error)
+}
+
+func TestReceiptChainPerAddress(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityAddress)
+	defer ts.Close()
+
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x2222222222222222222222222222222222222222"))
+	r.processReply(testChainedReceipt("req3", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+
+	req2, _ := p.GetReceipt("req2")
+	req3, _ := p.GetReceipt("req3")
+	assert.Equal(int64(1), (*req2)[receiptSeqField])
+	assert.Equal("0x2222222222222222222222222222222222222222", (*req2)[receiptChainField])
+	assert.Equal(int64(2), (*req3)[receiptSeqField])
+	assert.Equal("req1", (*req3)[receiptPrevIDField])
+
+	result := testVerifyReceipt(assert, ts, "/replies/req3/verify?depth=5")
+	assert.True(result.Valid)
+	assert.Equal("0x1111111111111111111111111111111111111111", result.Chain)
+	assert.Len(result.Records, 2)
+}
+
+func TestReceiptChainPerAddressSkipsProgress(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newChainedReceiptsTestServer(ReceiptIntegrityAddress)
+	defer ts.Close()
+
+	progress := messages.NewTransactionProgress(messages.ProgressStageSubmitted)
+	progress.Headers.ID = utils.UUIDv4()
+	progress.Headers.ReqID = "req1"
+	progressBytes, _ := json.Marshal(progress)
+	r.processReply(progressBytes)
+
+	// The progress record has no from address, so is not chained
+	req1, _ := p.GetReceipt("req1")
+	assert.Nil((*req1)[receiptHashField])
+	assert.Nil(r.chain.heads[""])
+
+	// The receipt that replaces it joins the chain of its from address
+	r.processReply(testChainedReceipt("req1", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	r.processReply(testChainedReceipt("req2", messages.MsgTypeTransactionSuccess, "0x1111111111111111111111111111111111111111"))
+	req1, _ = p.GetReceipt("req1")
+	req2, _ := p.GetReceipt("req2")
+	assert.Equal("0x1111111111111111111111111111111111111111", (*req1)[receiptChainField])
+	assert.Equal(int64(1), (*req1)[receiptSeqField])
+	assert.Nil((*req1)[receiptPriorHashesField])
+	assert.Equal("req1", (*req2)[receiptPrevIDField])
+	_, exists := r.chain.heads[""]
+	assert.False(exists)
+
+	result := testVerifyReceipt(assert, ts, "/replies/req2/verify?depth=5")
+	assert.True(result.Valid)
+	assert.Len(result.Records, 2)
+}
+
+type mockChainHeads struct {
+	*memoryReceipts
+	latest    *map[string]interface{}
+	latestErr error
+	chain     string
+}
+
+func (m *mockChainHeads) GetLatestChainedReceipt(chain string) (*map[string]interface{}, error) {
+	m.chain = chain
+	return m.latest, m.latestErr
+}
+
+func TestReceiptChainContinuesAfterRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &mockChainHeads{
+		memoryReceipts: newMemoryReceipts(&ReceiptStoreConf{MaxDocs: 10}),
+		latest: &map[string]interface{}{
+			"_id":            "req41",
+			receiptSeqField:  float64(41),
+			receiptHashField: "abcd",
+		},
+	}
+	c := newReceiptChain(ReceiptIntegrityGlobal, p)
+	receipt := map[string]interface{}{"_id": "req42"}
+	err := c.write("req42", receipt, false)
+	assert.NoError(err)
+	assert.Equal(int64(42), receipt[receiptSeqField])
+	assert.Equal("req41", receipt[receiptPrevIDField])
+	assert.Equal("abcd", receipt[receiptPrevHashField])
+	assert.Equal("", p.chain)
+}
+
+func TestReceiptChainHeadLoadFails(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &mockChainHeads{
+		memoryReceipts: newMemoryReceipts(&ReceiptStoreConf{MaxDocs: 10}),
+		latestErr:      fmt.Errorf("pop"),
+	}
+	c := newReceiptChain(ReceiptIntegrityAddress, p)
+	err := c.write("req1", map[string]interface{}{"_id": "req1", "from": "0xAAAA"}, false)
+	assert.EqualError(err, "Failed to load the newest receipt of the integrity chain: pop")
+	assert.Equal("0xaaaa", p.chain)
+	assert.Equal(0, p.receipts.Len())
+}
+
+func TestReceiptChainUpdateLookupFails(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newReceiptChain(ReceiptIntegrityGlobal, &mockReceiptErrs{getReceiptErr: fmt.Errorf("pop")})
+	err := c.write("req1", map[string]interface{}{"_id": "req1"}, true)
+	assert.EqualError(err, "pop")
+}
+
+func TestVerifyReplyErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, ts := newReceiptsTestServer()
+	status, respJSON, err := testGETObject(ts, "/replies/req1/verify")
+	ts.Close()
+	assert.NoError(err)
+	assert.Equal(405, status)
+	assert.Equal("Receipt integrity chaining is not enabled", respJSON["error"])
+
+	_, _, ts = newChainedReceiptsTestServer(ReceiptIntegrityGlobal)
+	defer ts.Close()
+	status, respJSON, err = testGETObject(ts, "/replies/req1/verify?depth=51")
+	assert.NoError(err)
+	assert.Equal(400, status)
+	assert.Equal("Invalid 'depth' query parameter. Must be between 1 and 50", respJSON["error"])
+
+	status, respJSON, err = testGETObject(ts, "/replies/req1/verify")
+	assert.NoError(err)
+	assert.Equal(404, status)
+	assert.Equal("Receipt not available", respJSON["error"])
+
+	r := newReceiptStore(&ReceiptStoreConf{Integrity: ReceiptIntegrityGlobal}, &mockReceiptErrs{getReceiptErr: fmt.Errorf("pop")}, nil)
+	router := &httprouter.Router{}
+	r.addRoutes(router)
+	errServer := httptest.NewServer(router)
+	defer errServer.Close()
+	status, respJSON, err = testGETObject(errServer, "/replies/req1/verify")
+	assert.NoError(err)
+	assert.Equal(500, status)
+	assert.Equal("Error querying reply: pop", respJSON["error"])
+}
+
+func TestMongoReceiptsGetLatestChainedReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	mgoMock := &mockMongo{}
+	r := &mongoReceipts{
+		conf: &MongoDBReceiptStoreConf{ReceiptStoreConf: ReceiptStoreConf{Integrity: ReceiptIntegrityAddress}},
+		mgo:  mgoMock,
+	}
+	mgoMock.collection.mockQuery.resultWranger = func(result interface{}) {
+		(*result.(*map[string]interface{}))["_id"] = "req1"
+	}
+
+	err := r.connect()
+	assert.NoError(err)
+	result, err := r.GetLatestChainedReceipt("0xaaaa")
+	assert.NoError(err)
+	assert.Equal("req1", (*result)["_id"])
+	assert.Equal([]string{"-_seq"}, mgoMock.collection.mockQuery.sort)
+	assert.Equal(bson.M{"_hash": bson.M{"$exists": true}, "_chain": "0xaaaa"}, mgoMock.collection.captureQuery)
+
+	_, err = r.GetLatestChainedReceipt("")
+	assert.NoError(err)
+	assert.Equal(bson.M{"_hash": bson.M{"$exists": true}, "_chain": bson.M{"$exists": false}}, mgoMock.collection.captureQuery)
+
+	mgoMock.collection.mockQuery.oneErr = mgo.ErrNotFound
+	result, err = r.GetLatestChainedReceipt("")
+	assert.NoError(err)
+	assert.Nil(result)
+
+	mgoMock.collection.mockQuery.oneErr = fmt.Errorf("pop")
+	_, err = r.GetLatestChainedReceipt("")
+	assert.EqualError(err, "pop")
+}
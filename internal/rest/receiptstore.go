@@ -19,6 +19,7 @@ import (
 	"net/http"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
@@ -43,12 +44,18 @@ type ReceiptStorePersistence interface {
 	GetReceipts(skip, limit int, ids []string, sinceEpochMS int64, from, to string) (*[]map[string]interface{}, error)
 	GetReceipt(requestID string) (*map[string]interface{}, error)
 	AddReceipt(requestID string, receipt *map[string]interface{}) error
+	UpdateReceipt(requestID string, receipt *map[string]interface{}) error
 }
 
 type receiptStore struct {
 	conf            *ReceiptStoreConf
 	persistence     ReceiptStorePersistence
 	smartContractGW contracts.SmartContractGateway
+	progressLock    sync.Mutex
+	progress        map[string]bool // requests with a progress message stored in place of the receipt
+	chain           *receiptChain
+	batcher         *receiptBatcher
+	syncReplies     *syncReplies // set when sync requests can wait for their reply
 }
 
 func newReceiptStore(conf *ReceiptStoreConf, persistence ReceiptStorePersistence, smartContractGW contracts.SmartContractGateway) *receiptStore {
@@ -58,17 +65,34 @@ func newReceiptStore(conf *ReceiptStoreConf, persistence ReceiptStorePersistence
 	if conf.RetryInitialDelayMS <= 0 {
 		conf.RetryInitialDelayMS = defaultRetryInitialDelay
 	}
-	return &receiptStore{
+	r := &receiptStore{
 		conf:            conf,
 		persistence:     persistence,
 		smartContractGW: smartContractGW,
+		progress:        make(map[string]bool),
+	}
+	if conf.Integrity != "" && persistence != nil {
+		r.chain = newReceiptChain(conf.Integrity, persistence)
+	}
+	if writer, ok := persistence.(receiptBatchWriter); ok && conf.BatchSize > 1 && r.chain == nil {
+		r.batcher = newReceiptBatcher(r, writer)
+	}
+	return r
+}
+
+// close writes any receipts waiting to be added in a batch
+func (r *receiptStore) close() {
+	if r.batcher != nil {
+		r.batcher.flush()
 	}
 }
 
 func (r *receiptStore) addRoutes(router *httprouter.Router) {
 	router.GET("/replies", r.getReplies)
 	router.GET("/replies/:id", r.getReply)
+	router.GET("/replies/:id/verify", r.verifyReply)
 	router.GET("/reply/:id", r.getReply)
+	router.GET(FeeReportPath, r.getFeeReport)
 }
 
 func (r *receiptStore) extractHeaders(parsedMsg map[string]interface{}) map[string]interface{} {
@@ -81,6 +105,16 @@ func (r *receiptStore) extractHeaders(parsedMsg map[string]interface{}) map[stri
 }
 
 func (r *receiptStore) processReply(msgBytes []byte) {
+	r.processReplyWithAck(msgBytes, nil)
+}
+
+// processReplyWithAck processes a reply, then calls ack once it no longer needs to be redelivered.
+// When receipts are batched, that is after the batch holding the receipt (or any receipts before
+// it, for a reply that is not stored) has been written
+func (r *receiptStore) processReplyWithAck(msgBytes []byte, ack func()) {
+	if ack != nil {
+		defer r.ackInOrder(ack)
+	}
 
 	// Parse the reply as JSON
 	var parsedMsg map[string]interface{}
@@ -113,11 +147,24 @@ func (r *receiptStore) processReply(msgBytes []byte) {
 	}
 	log.Infof("Received reply message. requestId='%s' reqOffset='%s' type='%s': %s", requestID, reqOffset, msgType, result)
 
+	// The final reply to a sync request is passed to the replica waiting for it, which might be a peer
+	syncPeer := takeSyncPeer(headers)
+	if r.syncReplies != nil && msgType != messages.MsgTypeTransactionProgress && msgType != messages.MsgTypeTransactionConfirmed {
+		replyBytes, _ := json.Marshal(parsedMsg)
+		r.syncReplies.processReply(requestID, syncPeer, replyBytes)
+	}
+
+	// Progress messages are stored in place of the receipt until it arrives, then replaced by it
+	progressReported := r.trackProgress(requestID, msgType == messages.MsgTypeTransactionProgress)
+
+	registered := false
 	if r.smartContractGW != nil && msgType == messages.MsgTypeTransactionSuccess && contractAddr != "" {
 		var receipt messages.TransactionReceipt
 		if err := json.Unmarshal(msgBytes, &receipt); err == nil {
 			if err = r.smartContractGW.PostDeploy(&receipt); err != nil {
 				log.Errorf("Failed to process receipt in smart contract gateway: %s", err)
+			} else {
+				registered = true
 			}
 		} else {
 			log.Errorf("Failed to parse message as transaction receipt: %s", err)
@@ -127,14 +174,62 @@ func (r *receiptStore) processReply(msgBytes []byte) {
 	parsedMsg["receivedAt"] = time.Now().UnixNano() / int64(time.Millisecond)
 	parsedMsg["_id"] = requestID
 
-	// Insert the receipt into persistence - captures errors
+	// Insert the receipt into persistence - captures errors.
+	// A confirmation replaces the receipt stored when the transaction was mined
 	if requestID != "" && r.persistence != nil {
-		r.writeReceipt(requestID, parsedMsg)
+		r.storeReceipt(requestID, parsedMsg, msgType == messages.MsgTypeTransactionConfirmed || progressReported)
+	}
+
+	// The final stage of a deployment is only sent to listeners, as the receipt remains stored
+	if registered && progressReported {
+		progress := messages.NewTransactionProgress(messages.ProgressStageRegistered)
+		progress.Headers.ReqID = requestID
+		progress.Headers.SchemaVersion = messages.ReplySchemaVersion
+		progress.Headers.ID = utils.UUIDv4()
+		progress.TransactionHash = utils.GetMapString(parsedMsg, "transactionHash")
+		progress.ContractAddress = contractAddr
+		r.smartContractGW.SendReply(progress)
 	}
 
 }
 
-func (r *receiptStore) writeReceipt(requestID string, receipt map[string]interface{}) {
+// trackProgress records whether a progress message is stored for a request, returning true
+// if the message should update the stored record rather than being added
+func (r *receiptStore) trackProgress(requestID string, isProgress bool) bool {
+	r.progressLock.Lock()
+	defer r.progressLock.Unlock()
+	reported := r.progress[requestID]
+	if isProgress {
+		r.progress[requestID] = true
+		return true
+	}
+	delete(r.progress, requestID)
+	return reported
+}
+
+// ackInOrder acknowledges a reply once the receipts before it are stored
+func (r *receiptStore) ackInOrder(ack func()) {
+	if r.batcher != nil {
+		r.batcher.afterPending(ack)
+		return
+	}
+	ack()
+}
+
+// storeReceipt adds new receipts to the pending batch when batching is enabled, otherwise writes
+// the receipt once any pending batch is stored
+func (r *receiptStore) storeReceipt(requestID string, receipt map[string]interface{}, update bool) {
+	if r.batcher != nil {
+		if !update {
+			r.batcher.add(requestID, receipt)
+			return
+		}
+		r.batcher.flush()
+	}
+	r.writeReceipt(requestID, receipt, update)
+}
+
+func (r *receiptStore) writeReceipt(requestID string, receipt map[string]interface{}, update bool) {
 	startTime := time.Now()
 	delay := time.Duration(r.conf.RetryInitialDelayMS) * time.Millisecond
 	attempt := 0
@@ -147,20 +242,35 @@ func (r *receiptStore) writeReceipt(requestID string, receipt map[string]interfa
 			delay = time.Duration(float64(delay) * backoffFactor)
 		}
 		attempt++
-		err := r.persistence.AddReceipt(requestID, &receipt)
+		var err error
+		if r.chain != nil {
+			err = r.chain.write(requestID, receipt, update)
+		} else if update {
+			err = r.persistence.UpdateReceipt(requestID, &receipt)
+		} else {
+			err = r.persistence.AddReceipt(requestID, &receipt)
+		}
 		if err == nil {
-			log.Infof("%s: Inserted receipt into receipt store", receipt["_id"])
+			log.Infof("%s: Inserted receipt into receipt store (update=%t)", receipt["_id"], update)
 			break
 		}
 
 		log.Errorf("%s: addReceipt attempt: %d failed, err: %s", requestID, attempt, err)
 
-		// Check if the reason is that there is a receipt already
-		existing, qErr := r.persistence.GetReceipt(requestID)
-		if qErr == nil && existing != nil {
-			log.Warnf("%s: exiting   receipt: %+v", requestID, *existing)
-			log.Warnf("%s: duplicate receipt: %+v", requestID, receipt)
-			break
+		// Check if the reason is that there is a receipt already (updates replace any existing receipt)
+		if !update {
+			existing, qErr := r.persistence.GetReceipt(requestID)
+			if qErr == nil && existing != nil && utils.GetMapString(r.extractHeaders(*existing), "type") == messages.MsgTypeTransactionProgress {
+				// Progress stored before a restart is replaced by the receipt
+				log.Infof("%s: replacing progress with receipt", requestID)
+				update, attempt = true, 0
+				continue
+			}
+			if qErr == nil && existing != nil {
+				log.Warnf("%s: exiting   receipt: %+v", requestID, *existing)
+				log.Warnf("%s: duplicate receipt: %+v", requestID, receipt)
+				break
+			}
 		}
 
 		timeRetrying := time.Since(startTime)
@@ -182,6 +292,10 @@ func (r *receiptStore) marshalAndReply(res http.ResponseWriter, req *http.Reques
 		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreSerializeResponse), 500)
 		return
 	}
+	if r.conf.MaxResponseSize > 0 && len(resBytes) > r.conf.MaxResponseSize {
+		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreResponseTooLarge, len(resBytes), r.conf.MaxResponseSize), 400)
+		return
+	}
 	status := 200
 	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
 	res.Header().Set("Content-Type", "application/json")
@@ -254,21 +368,24 @@ func (r *receiptStore) getReplies(res http.ResponseWriter, req *http.Request, pa
 
 	// Verify since - if specified
 	var sinceEpochMS int64
-	since := req.FormValue("since")
-	if since != "" {
-		if isoTime, err := time.Parse(time.RFC3339Nano, since); err == nil {
-			sinceEpochMS = isoTime.UnixNano() / int64(time.Millisecond)
-		} else {
-			if sinceEpochMS, err = strconv.ParseInt(since, 10, 64); err != nil {
-				log.Errorf("since '%s' cannot be parsed as RFC3339 or millisecond timestamp: %s", since, err)
-				sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreInvalidRequestBadSince), 400)
-			}
+	if since := req.FormValue("since"); since != "" {
+		var ok bool
+		if sinceEpochMS, ok = parseTimeParam(since); !ok {
+			log.Errorf("since '%s' cannot be parsed as RFC3339 or millisecond timestamp", since)
+			sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreInvalidRequestBadSince), 400)
+			return
 		}
 	}
 
 	from := req.FormValue("from")
 	to := req.FormValue("to")
 
+	schemaVersion, err := replySchemaVersion(req)
+	if err != nil {
+		sendRESTError(res, req, err, 400)
+		return
+	}
+
 	// Call the persistence tier - which must return an empty array when no results (not an error)
 	results, err := r.persistence.GetReceipts(skip, limit, ids, sinceEpochMS, from, to)
 	if err != nil {
@@ -277,6 +394,13 @@ func (r *receiptStore) getReplies(res http.ResponseWriter, req *http.Request, pa
 		return
 	}
 	log.Debugf("Replies query: skip=%d limit=%d replies=%d", skip, limit, len(*results))
+	if schemaVersion > 0 {
+		translated := make([]map[string]interface{}, len(*results))
+		for i, result := range *results {
+			translated[i] = messages.TranslateReply(result, schemaVersion)
+		}
+		results = &translated
+	}
 	r.marshalAndReply(res, req, results)
 
 }
@@ -293,6 +417,11 @@ func (r *receiptStore) getReply(res http.ResponseWriter, req *http.Request, para
 	}
 
 	requestID := params.ByName("id")
+	schemaVersion, err := replySchemaVersion(req)
+	if err != nil {
+		sendRESTError(res, req, err, 400)
+		return
+	}
 	// Call the persistence tier - which must return an empty array when no results (not an error)
 	result, err := r.persistence.GetReceipt(requestID)
 	if err != nil {
@@ -305,5 +434,61 @@ func (r *receiptStore) getReply(res http.ResponseWriter, req *http.Request, para
 		return
 	}
 	log.Infof("Reply found")
+	if schemaVersion > 0 {
+		translated := messages.TranslateReply(*result, schemaVersion)
+		result = &translated
+	}
+	r.marshalAndReply(res, req, result)
+}
+
+// replySchemaVersion returns the schema version requested for the replies, or zero to return
+// them as stored
+func replySchemaVersion(req *http.Request) (int, error) {
+	if v := req.FormValue("schemaversion"); v != "" {
+		return messages.ParseReplySchemaVersion(v)
+	}
+	return 0, nil
+}
+
+// verifyReply handles a HTTP request to check the integrity hash of a reply, and of the
+// records before it in the chain up to the requested depth
+func (r *receiptStore) verifyReply(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	err := auth.AuthReadAsyncReplyByUUID(req.Context())
+	if err != nil {
+		log.Errorf("Error verifying reply: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	if r.chain == nil {
+		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreIntegrityDisabled), 405)
+		return
+	}
+
+	depth := 1
+	if depthStr := req.FormValue("depth"); depthStr != "" {
+		maxDepth := r.conf.QueryLimit
+		if maxDepth < 1 {
+			maxDepth = defaultReceiptLimit
+		}
+		customDepth, err := strconv.Atoi(depthStr)
+		if err != nil || customDepth < 1 || customDepth > maxDepth {
+			sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreIntegrityBadDepth, maxDepth), 400)
+			return
+		}
+		depth = customDepth
+	}
+
+	result, err := r.chain.verify(params.ByName("id"), depth)
+	if err != nil {
+		log.Errorf("Error verifying reply: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreFailedQuerySingle, err), 500)
+		return
+	} else if result == nil {
+		sendRESTError(res, req, errors.Errorf(errors.ReceiptStoreFailedNotFound), 404)
+		return
+	}
 	r.marshalAndReply(res, req, result)
 }
@@ -38,6 +38,8 @@ type mockReceiptErrs struct {
 	getReceiptErr    error
 	addReceiptCalled bool
 	addReceiptErr    error
+	updateCalled     bool
+	updateReceiptErr error
 }
 
 func (m *mockReceiptErrs) GetReceipts(skip, limit int, ids []string, sinceEpochMS int64, from, to string) (*[]map[string]interface{}, error) {
@@ -53,6 +55,11 @@ func (m *mockReceiptErrs) AddReceipt(requestID string, receipt *map[string]inter
 	return m.addReceiptErr
 }
 
+func (m *mockReceiptErrs) UpdateReceipt(requestID string, receipt *map[string]interface{}) error {
+	m.updateCalled = true
+	return m.updateReceiptErr
+}
+
 func newReceiptsErrTestServer(err error) (*receiptStore, *httptest.Server) {
 	r := newReceiptStore(&ReceiptStoreConf{
 		RetryTimeoutMS:      1,
@@ -109,6 +116,126 @@ func TestReplyProcessorWithValidReply(t *testing.T) {
 
 }
 
+func TestReplyProcessorConfirmedReplacesReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newReceiptsTestStore(nil)
+
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = utils.UUIDv4()
+	txHash := ethbind.API.HexToHash("0x02587104e9879911bea3d5bf6ccd7e1a6cb9a03145b8a1141804cebd6aa67c5c")
+	replyMsg.TransactionHash = &txHash
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+	r.processReply(replyMsgBytes)
+
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionConfirmed
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.ConfirmationsStr = "12"
+	replyMsgBytes, _ = json.Marshal(&replyMsg)
+	r.processReply(replyMsgBytes)
+
+	assert.Equal(1, p.receipts.Len())
+	stored, err := p.GetReceipt(replyMsg.Headers.ReqID)
+	assert.NoError(err)
+	assert.Equal(messages.MsgTypeTransactionConfirmed, (*stored)["headers"].(map[string]interface{})["type"])
+	assert.Equal("12", (*stored)["confirmations"])
+}
+
+func TestReplyProcessorProgressReplacedByReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	var sent []interface{}
+	r, p := newReceiptsTestStore(func(message interface{}) {
+		sent = append(sent, message)
+	})
+	reqID := utils.UUIDv4()
+
+	for _, stage := range []string{messages.ProgressStageCompiled, messages.ProgressStageSubmitted} {
+		progress := messages.NewTransactionProgress(stage)
+		progress.Headers.ID = utils.UUIDv4()
+		progress.Headers.ReqID = reqID
+		progressBytes, _ := json.Marshal(progress)
+		r.processReply(progressBytes)
+	}
+	assert.Equal(1, p.receipts.Len())
+	stored, err := p.GetReceipt(reqID)
+	assert.NoError(err)
+	assert.Equal(messages.ProgressStageSubmitted, (*stored)["stage"])
+
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = reqID
+	txHash := ethbind.API.HexToHash("0x02587104e9879911bea3d5bf6ccd7e1a6cb9a03145b8a1141804cebd6aa67c5c")
+	replyMsg.TransactionHash = &txHash
+	addr := ethbind.API.HexToAddress("0x0123456789AbcdeF0123456789abCdef0123456")
+	replyMsg.ContractAddress = &addr
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+	r.processReply(replyMsgBytes)
+
+	assert.Equal(1, p.receipts.Len())
+	stored, err = p.GetReceipt(reqID)
+	assert.NoError(err)
+	assert.Equal(messages.MsgTypeTransactionSuccess, (*stored)["headers"].(map[string]interface{})["type"])
+	assert.Empty(r.progress)
+
+	// The registered stage follows the receipt to listeners
+	assert.Len(sent, 4)
+	registered := sent[3].(*messages.TransactionProgress)
+	assert.Equal(messages.ProgressStageRegistered, registered.Stage)
+	assert.Equal(reqID, registered.Headers.ReqID)
+	assert.Equal("0x00123456789abcdef0123456789abcdef0123456", registered.ContractAddress)
+}
+
+func TestReplyProcessorProgressReplacedAfterRestart(t *testing.T) {
+	existing := map[string]interface{}{"headers": map[string]interface{}{"type": messages.MsgTypeTransactionProgress}}
+	mr := &mockReceiptErrs{
+		addReceiptErr: fmt.Errorf("pop"),
+		getReceiptVal: &existing,
+	}
+	r := newReceiptStore(&ReceiptStoreConf{
+		RetryTimeoutMS:      1,
+		RetryInitialDelayMS: 1,
+	}, mr, nil)
+
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = utils.UUIDv4()
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+	r.processReply(replyMsgBytes)
+
+	assert.True(t, mr.addReceiptCalled)
+	assert.True(t, mr.updateCalled)
+}
+
+func TestReplyProcessorConfirmedUpdateErrorPanics(t *testing.T) {
+	mr := &mockReceiptErrs{
+		updateReceiptErr: fmt.Errorf("pop"),
+		getReceiptVal:    &map[string]interface{}{"some": "existing"},
+	}
+	r := newReceiptStore(&ReceiptStoreConf{
+		RetryTimeoutMS:      1,
+		RetryInitialDelayMS: 1,
+	}, mr, nil)
+
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionConfirmed
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = utils.UUIDv4()
+	txHash := ethbind.API.HexToHash("0x02587104e9879911bea3d5bf6ccd7e1a6cb9a03145b8a1141804cebd6aa67c5c")
+	replyMsg.TransactionHash = &txHash
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+
+	assert.Panics(t, func() {
+		r.processReply(replyMsgBytes)
+	})
+	assert.True(t, mr.updateCalled)
+	assert.False(t, mr.addReceiptCalled)
+}
+
 func TestReplyProcessorWithContractGWSuccess(t *testing.T) {
 	assert := assert.New(t)
 
@@ -376,6 +503,39 @@ func TestGetReplyBadData(t *testing.T) {
 	assert.Equal("Error serializing response", respJSON["error"])
 }
 
+func TestGetReplySchemaVersion(t *testing.T) {
+	assert := assert.New(t)
+	_, p, ts := newReceiptsTestServer()
+	defer ts.Close()
+
+	fakeReply := map[string]interface{}{
+		"_id":         "ABCDEFG",
+		"headers":     map[string]interface{}{"type": messages.MsgTypeTransactionSuccess, "schemaVersion": messages.ReplySchemaVersion},
+		"blockNumber": "5",
+		"fee":         "21000",
+	}
+	p.AddReceipt("_id", &fakeReply)
+
+	status, respJSON, httpErr := testGETObject(ts, "/reply/ABCDEFG?schemaversion=1")
+	assert.NoError(httpErr)
+	assert.Equal(200, status)
+	assert.Equal("5", respJSON["blockNumber"])
+	assert.Nil(respJSON["fee"])
+	assert.Nil(respJSON["headers"].(map[string]interface{})["schemaVersion"])
+
+	// The stored receipt is not modified
+	status, respJSON, httpErr = testGETObject(ts, "/reply/ABCDEFG")
+	assert.NoError(httpErr)
+	assert.Equal(200, status)
+	assert.Equal("21000", respJSON["fee"])
+	assert.Equal(float64(messages.ReplySchemaVersion), respJSON["headers"].(map[string]interface{})["schemaVersion"])
+
+	status, respJSON, httpErr = testGETObject(ts, "/reply/ABCDEFG?schemaversion=99")
+	assert.NoError(httpErr)
+	assert.Equal(400, status)
+	assert.Regexp("Unsupported reply schema version '99'", respJSON["error"])
+}
+
 func TestGetRepliesNoStore(t *testing.T) {
 	assert := assert.New(t)
 	r, _, ts := newReceiptsTestServer()
@@ -441,6 +601,52 @@ func TestGetRepliesDefaultLimit(t *testing.T) {
 	}
 }
 
+func TestGetRepliesSchemaVersion(t *testing.T) {
+	assert := assert.New(t)
+	_, p, ts := newReceiptsTestServer()
+	defer ts.Close()
+
+	fakeReply := map[string]interface{}{
+		"_id":       "reply1",
+		"headers":   map[string]interface{}{"type": messages.MsgTypeError},
+		"retryable": true,
+	}
+	p.AddReceipt("_id", &fakeReply)
+
+	status, respArr, httpErr := testGETArray(ts, "/replies?schemaversion=1")
+	assert.NoError(httpErr)
+	assert.Equal(200, status)
+	assert.Len(respArr, 1)
+	assert.Nil(respArr[0]["retryable"])
+
+	status, _, httpErr = testGETArray(ts, "/replies?schemaversion=0")
+	assert.NoError(httpErr)
+	assert.Equal(400, status)
+}
+
+func TestGetRepliesMaxResponseSize(t *testing.T) {
+	assert := assert.New(t)
+	r, p, ts := newReceiptsTestServer()
+	defer ts.Close()
+
+	for i := 0; i < 20; i++ {
+		fakeReply := make(map[string]interface{})
+		fakeReply["_id"] = fmt.Sprintf("reply%d", i)
+		p.AddReceipt("_id", &fakeReply)
+	}
+	r.conf.MaxResponseSize = 100
+
+	status, respJSON, httpErr := testGETObject(ts, "/replies")
+	assert.NoError(httpErr)
+	assert.Equal(400, status)
+	assert.Regexp("Response of \\d+ bytes exceeds the maximum size of 100 bytes", respJSON["error"])
+
+	status, respArr, httpErr := testGETArray(ts, "/replies?limit=2")
+	assert.NoError(httpErr)
+	assert.Equal(200, status)
+	assert.Len(respArr, 2)
+}
+
 func TestGetRepliesCustomSkipLimit(t *testing.T) {
 	assert := assert.New(t)
 	_, p, ts := newReceiptsTestServer()
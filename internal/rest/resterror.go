@@ -18,15 +18,22 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/kaleido-io/ethconnect/internal/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 type restError struct {
-	Message string `json:"error"`
+	Message          string `json:"error"`
+	Retryable        bool   `json:"retryable"`
+	AlreadySubmitted bool   `json:"alreadySubmitted,omitempty"`
 }
 
 func sendRESTError(res http.ResponseWriter, req *http.Request, err error, status int) {
-	reply, _ := json.Marshal(&restError{Message: err.Error()})
+	reply, _ := json.Marshal(&restError{
+		Message:          err.Error(),
+		Retryable:        errors.IsRetryableHTTP(err, status),
+		AlreadySubmitted: errors.IsAlreadySubmitted(err),
+	})
 	log.Errorf("<-- %s %s [%d]: %s", req.Method, req.URL, status, err)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(status)
@@ -15,9 +15,12 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
@@ -32,11 +35,13 @@ import (
 	"github.com/kaleido-io/ethconnect/internal/eth"
 	"github.com/kaleido-io/ethconnect/internal/kafka"
 	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/recorder"
 	"github.com/kaleido-io/ethconnect/internal/tx"
 	"github.com/kaleido-io/ethconnect/internal/utils"
 	"github.com/kaleido-io/ethconnect/internal/ws"
 
 	"github.com/Shopify/sarama"
+	"github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -45,14 +50,20 @@ import (
 const (
 	// MaxHeaderSize max size of content
 	MaxHeaderSize = 16 * 1024
+	// defaultMaxUploadSize matches the memory used to parse multipart uploads to /abis
+	defaultMaxUploadSize = 32 * 1024 * 1024
 )
 
 // ReceiptStoreConf is the common configuration for all receipt stores
 type ReceiptStoreConf struct {
-	MaxDocs             int `json:"maxDocs"`
-	QueryLimit          int `json:"queryLimit"`
-	RetryInitialDelayMS int `json:"retryInitialDelay"`
-	RetryTimeoutMS      int `json:"retryTimeout"`
+	MaxDocs             int    `json:"maxDocs"`
+	QueryLimit          int    `json:"queryLimit"`
+	RetryInitialDelayMS int    `json:"retryInitialDelay"`
+	RetryTimeoutMS      int    `json:"retryTimeout"`
+	MaxResponseSize     int    `json:"maxResponseSize"`
+	Integrity           string `json:"integrity"`
+	BatchSize           int    `json:"batchSize"`
+	BatchTimeoutMS      int    `json:"batchTimeout"`
 }
 
 // MongoDBReceiptStoreConf is the configuration for a MongoDB receipt store
@@ -62,19 +73,29 @@ type MongoDBReceiptStoreConf struct {
 	Database         string `json:"database"`
 	Collection       string `json:"collection"`
 	ConnectTimeoutMS int    `json:"connectTimeout"`
+	Partition        string `json:"partition"`
+	RetainPartitions int    `json:"retainPartitions"`
 }
 
 // RESTGatewayConf defines the YAML config structure for a webhooks bridge instance
 type RESTGatewayConf struct {
-	Kafka    kafka.KafkaCommonConf              `json:"kafka"`
-	MongoDB  MongoDBReceiptStoreConf            `json:"mongodb"`
-	MemStore ReceiptStoreConf                   `json:"memstore"`
-	OpenAPI  contracts.SmartContractGatewayConf `json:"openapi"`
-	HTTP     struct {
-		LocalAddr string          `json:"localAddr"`
-		Port      int             `json:"port"`
-		TLS       utils.TLSConfig `json:"tls"`
+	Kafka      kafka.KafkaCommonConf              `json:"kafka"`
+	KafkaQueue KafkaQueueConf                     `json:"kafkaQueue"`
+	MongoDB    MongoDBReceiptStoreConf            `json:"mongodb"`
+	MemStore   ReceiptStoreConf                   `json:"memstore"`
+	OpenAPI    contracts.SmartContractGatewayConf `json:"openapi"`
+	HTTP       struct {
+		LocalAddr     string          `json:"localAddr"`
+		Port          int             `json:"port"`
+		TLS           utils.TLSConfig `json:"tls"`
+		MaxBodySize   int             `json:"maxBodySize"`
+		MaxUploadSize int             `json:"maxUploadSize"`
+		Compression   CompressionConf `json:"compression"`
 	} `json:"http"`
+	WebSocket ws.WebSocketServerConf `json:"ws"`
+	RPCProxy  RPCProxyConf           `json:"rpcProxy"`
+	Sync      SyncConf               `json:"sync"`
+	Console   ConsoleConf            `json:"console"`
 	WebhooksDirectConf
 }
 
@@ -92,6 +113,7 @@ type RESTGateway struct {
 	webhooks        *webhooks
 	smartContractGW contracts.SmartContractGateway
 	ws              ws.WebSocketServer
+	processor       tx.TxnProcessor
 }
 
 // Conf gets the config for this bridge
@@ -113,10 +135,47 @@ func (g *RESTGateway) ValidateConf() (err error) {
 	if g.conf.MongoDB.QueryLimit < 1 {
 		g.conf.MongoDB.QueryLimit = 100
 	}
-	if g.conf.OpenAPI.StoragePath != "" && g.conf.RPC.URL == "" {
+	if g.conf.MongoDB.Partition != "" && g.conf.MongoDB.Partition != partitionDaily && g.conf.MongoDB.Partition != partitionWeekly {
+		err = errors.Errorf(errors.ConfigRESTGatewayReceiptStorePartition, g.conf.MongoDB.Partition)
+		return
+	}
+	for _, integrity := range []string{g.conf.MongoDB.Integrity, g.conf.MemStore.Integrity} {
+		if integrity != "" && integrity != ReceiptIntegrityGlobal && integrity != ReceiptIntegrityAddress {
+			err = errors.Errorf(errors.ConfigRESTGatewayReceiptStoreIntegrity, integrity)
+			return
+		}
+	}
+	if g.conf.KafkaQueue.MaxMessages < 1 {
+		g.conf.KafkaQueue.MaxMessages = defaultKafkaQueueMaxMessages
+	}
+	if g.conf.KafkaQueue.RetryIntervalSec < 1 {
+		g.conf.KafkaQueue.RetryIntervalSec = defaultKafkaQueueRetrySec
+	}
+	if g.conf.HTTP.MaxBodySize < 1 {
+		g.conf.HTTP.MaxBodySize = utils.MaxPayloadSize
+	}
+	if g.conf.HTTP.MaxUploadSize < 1 {
+		g.conf.HTTP.MaxUploadSize = defaultMaxUploadSize
+	}
+	if g.conf.OpenAPI.Enabled() && g.conf.RPC.URL == "" {
 		err = errors.Errorf(errors.ConfigRESTGatewayRequiredRPC)
 		return
 	}
+	if g.conf.RPCProxy.Enabled && g.conf.RPC.URL == "" {
+		err = errors.Errorf(errors.ConfigRESTGatewayRPCProxyRequiresRPC)
+		return
+	}
+	if g.conf.Sync.TimeoutSec < 1 {
+		g.conf.Sync.TimeoutSec = defaultSyncTimeoutSec
+	}
+	if (g.conf.Sync.Self != "" || len(g.conf.Sync.Peers) > 0) && strings.TrimSpace(g.conf.Sync.PeerSecret) == "" {
+		err = errors.Errorf(errors.ConfigRESTGatewayPeersRequireSecret)
+		return
+	}
+	if err = g.conf.TxnProcessorConf.ValidateConf(); err != nil {
+		return
+	}
+	err = g.conf.OpenAPI.RemoteRegistry.HTTPRequesterConf.ValidateConf()
 	return
 }
 
@@ -128,8 +187,8 @@ func NewRESTGateway(printYAML *bool) (g *RESTGateway) {
 		pendingMsgs: make(map[string]bool),
 		successMsgs: make(map[string]*sarama.ProducerMessage),
 		failedMsgs:  make(map[string]error),
-		ws:          ws.NewWebSocketServer(),
 	}
+	g.ws = ws.NewWebSocketServer(&g.conf.WebSocket)
 	return
 }
 
@@ -169,13 +228,38 @@ func (g *RESTGateway) CobraInit(cmdName string) (cmd *cobra.Command) {
 	cmd.Flags().IntVarP(&g.conf.MaxInFlight, "maxinflight", "m", utils.DefInt("WEBHOOKS_MAX_INFLIGHT", 0), "Maximum messages to hold in-flight")
 	cmd.Flags().StringVarP(&g.conf.HTTP.LocalAddr, "listen-addr", "L", os.Getenv("WEBHOOKS_LISTEN_ADDR"), "Local address to listen on")
 	cmd.Flags().IntVarP(&g.conf.HTTP.Port, "listen-port", "l", utils.DefInt("WEBHOOKS_LISTEN_PORT", 8080), "Port to listen on")
+	cmd.Flags().StringVar(&g.conf.KafkaQueue.Path, "kafka-queue-db", os.Getenv("WEBHOOKS_KAFKA_QUEUE_DB"), "Level DB location to queue async requests while Kafka is unavailable (disabled if not set)")
+	cmd.Flags().IntVar(&g.conf.KafkaQueue.MaxMessages, "kafka-queue-max", utils.DefInt("WEBHOOKS_KAFKA_QUEUE_MAX", defaultKafkaQueueMaxMessages), "Maximum async requests to queue while Kafka is unavailable")
+	cmd.Flags().IntVar(&g.conf.KafkaQueue.RetryIntervalSec, "kafka-queue-retry", utils.DefInt("WEBHOOKS_KAFKA_QUEUE_RETRY_SEC", defaultKafkaQueueRetrySec), "Interval in seconds to retry sending queued async requests to Kafka")
 	cmd.Flags().StringVarP(&g.conf.MongoDB.URL, "mongodb-url", "M", os.Getenv("MONGODB_URL"), "MongoDB URL for a receipt store")
 	cmd.Flags().StringVarP(&g.conf.MongoDB.Database, "mongodb-database", "D", os.Getenv("MONGODB_DATABASE"), "MongoDB receipt store database")
 	cmd.Flags().StringVarP(&g.conf.MongoDB.Collection, "mongodb-receipt-collection", "R", os.Getenv("MONGODB_COLLECTION"), "MongoDB receipt store collection")
 	cmd.Flags().IntVarP(&g.conf.MongoDB.MaxDocs, "mongodb-receipt-maxdocs", "X", utils.DefInt("MONGODB_MAXDOCS", 0), "Receipt store capped size (new collections only)")
+	cmd.Flags().StringVar(&g.conf.MongoDB.Partition, "mongodb-receipt-partition", os.Getenv("MONGODB_PARTITION"), "Partition the receipt store into a collection per day or week (daily/weekly)")
+	cmd.Flags().IntVar(&g.conf.MongoDB.RetainPartitions, "mongodb-receipt-retain-partitions", utils.DefInt("MONGODB_RETAIN_PARTITIONS", 0), "Number of receipt store partitions to keep, dropping older ones on rollover (0 to keep all)")
 	cmd.Flags().IntVarP(&g.conf.MongoDB.QueryLimit, "mongodb-query-limit", "Q", utils.DefInt("MONGODB_QUERYLIM", 0), "Maximum docs to return on a rest call (cap on limit)")
 	cmd.Flags().IntVarP(&g.conf.MemStore.MaxDocs, "memstore-receipt-maxdocs", "v", utils.DefInt("MEMSTORE_MAXDOCS", 10), "In-memory receipt store capped size")
 	cmd.Flags().IntVarP(&g.conf.MemStore.QueryLimit, "memstore-query-limit", "V", utils.DefInt("MEMSTORE_QUERYLIM", 0), "In-memory maximum docs to return on a rest call")
+	cmd.Flags().IntVar(&g.conf.MongoDB.MaxResponseSize, "mongodb-max-response-size", utils.DefInt("MONGODB_MAX_RESPONSE_SIZE", 0), "Maximum size in bytes of the receipts returned on a rest call (0 for no limit)")
+	cmd.Flags().IntVar(&g.conf.MemStore.MaxResponseSize, "memstore-max-response-size", utils.DefInt("MEMSTORE_MAX_RESPONSE_SIZE", 0), "In-memory maximum size in bytes of the receipts returned on a rest call (0 for no limit)")
+	cmd.Flags().StringVar(&g.conf.MongoDB.Integrity, "mongodb-receipt-integrity", os.Getenv("MONGODB_INTEGRITY"), "Chain each receipt to the previous one with a hash, across all receipts or per from address (global/address)")
+	cmd.Flags().IntVar(&g.conf.MongoDB.BatchSize, "mongodb-receipt-batch-size", utils.DefInt("MONGODB_BATCH_SIZE", 0), "Maximum number of receipts added to the receipt store in a single write (0 or 1 to write each receipt individually)")
+	cmd.Flags().IntVar(&g.conf.MongoDB.BatchTimeoutMS, "mongodb-receipt-batch-timeout", utils.DefInt("MONGODB_BATCH_TIMEOUT", 0), "Maximum time in milliseconds a receipt waits to be written in a batch (default 100)")
+	cmd.Flags().StringVar(&g.conf.MemStore.Integrity, "memstore-receipt-integrity", os.Getenv("MEMSTORE_INTEGRITY"), "In-memory chaining of each receipt to the previous one with a hash (global/address)")
+	cmd.Flags().IntVar(&g.conf.HTTP.MaxBodySize, "max-body-size", utils.DefInt("MAX_BODY_SIZE", utils.MaxPayloadSize), "Maximum size in bytes of the body of a request")
+	cmd.Flags().IntVar(&g.conf.HTTP.MaxUploadSize, "max-upload-size", utils.DefInt("MAX_UPLOAD_SIZE", defaultMaxUploadSize), "Maximum size in bytes of the body of a request uploading Solidity or ABIs to /abis")
+	cmd.Flags().BoolVar(&g.conf.HTTP.Compression.Enabled, "http-compression", false, "Gzip compress, and set ETags on, the responses to GET requests")
+	cmd.Flags().IntVar(&g.conf.HTTP.Compression.MinSize, "http-compression-min-size", utils.DefInt("HTTP_COMPRESSION_MIN_SIZE", defaultCompressionMinSize), "Minimum size in bytes of a response body to gzip compress")
+	cmd.Flags().BoolVar(&g.conf.RPCProxy.Enabled, "rpc-proxy", false, "Enable the WebSocket JSON/RPC proxy to the node on /rpc")
+	cmd.Flags().StringSliceVar(&g.conf.RPCProxy.AllowMethods, "rpc-proxy-methods", []string{}, "Methods allowed through the JSON/RPC proxy, with a trailing * to match a prefix (default read-only methods)")
+	cmd.Flags().Float64Var(&g.conf.RPCProxy.RateLimit, "rpc-proxy-rate", 0, "Maximum JSON/RPC proxy requests per second from each caller, across all its connections (0 for no limit)")
+	cmd.Flags().IntVar(&g.conf.RPCProxy.RateBurst, "rpc-proxy-burst", utils.DefInt("RPC_PROXY_BURST", 10), "Burst of JSON/RPC proxy requests allowed above the rate limit from each caller")
+	cmd.Flags().IntVar(&g.conf.Sync.TimeoutSec, "sync-timeout", utils.DefInt("WEBHOOKS_SYNC_TIMEOUT", defaultSyncTimeoutSec), "Maximum time in seconds a webhooks request with fly-sync waits for its reply")
+	cmd.Flags().StringVar(&g.conf.Sync.Self, "peer-self", os.Getenv("WEBHOOKS_PEER_SELF"), "URL that peer replicas reach this gateway on, to forward the replies of sync requests waiting here")
+	cmd.Flags().StringSliceVar(&g.conf.Sync.Peers, "peers", utils.DefStringArray("WEBHOOKS_PEERS"), "URLs of the peer replicas sharing the Kafka consumer group for replies")
+	cmd.Flags().StringVar(&g.conf.Sync.PeerSecret, "peer-secret", os.Getenv("WEBHOOKS_PEER_SECRET"), "Secret shared by the peer replicas to authenticate forwarded replies")
+	cmd.Flags().BoolVar(&g.conf.Console.Enabled, "console", false, "Serve the web console for operators on "+ConsolePath)
+	cmd.Flags().IntVar(&g.conf.WebSocket.AuthRevalidateSec, "ws-auth-revalidate", utils.DefInt("WS_AUTH_REVALIDATE_SEC", 300), "Interval in seconds to re-validate the access token of WebSocket connections (0 to disable)")
 	return
 }
 
@@ -183,6 +267,19 @@ type statusMsg struct {
 	OK bool `json:"ok"`
 }
 
+type inflightStatusMsg struct {
+	Count        int                                `json:"count"`
+	Transactions map[string][]*tx.InFlightTxnStatus `json:"transactions"`
+}
+
+type rpcShadowStatusMsg struct {
+	Shadows []*eth.RPCShadowStats `json:"shadows"`
+}
+
+type rpcEndpointStatusMsg struct {
+	Endpoints []*eth.RPCEndpointStats `json:"endpoints"`
+}
+
 type errMsg struct {
 	Message string `json:"error"`
 }
@@ -195,6 +292,88 @@ func (g *RESTGateway) statusHandler(res http.ResponseWriter, req *http.Request,
 	return
 }
 
+func (g *RESTGateway) inflightStatusHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error querying in-flight transactions: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	status := &inflightStatusMsg{
+		Transactions: make(map[string][]*tx.InFlightTxnStatus),
+	}
+	if g.processor != nil {
+		status.Transactions = g.processor.InFlightStatus()
+	}
+	for _, txns := range status.Transactions {
+		status.Count += len(txns)
+	}
+	reply, _ := json.MarshalIndent(status, "", "  ")
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	res.Write(reply)
+}
+
+// rpcShadowStatusHandler reports how the read-only calls mirrored to each shadow node compared
+// with the primary, when shadow mode is enabled
+func (g *RESTGateway) rpcShadowStatusHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error querying JSON/RPC shadow status: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	reply, _ := json.MarshalIndent(&rpcShadowStatusMsg{Shadows: eth.RPCShadowStatus()}, "", "  ")
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	res.Write(reply)
+}
+
+// rpcEndpointStatusHandler reports the health of each JSON/RPC endpoint, when traffic
+// is weighted across more than one
+func (g *RESTGateway) rpcEndpointStatusHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error querying JSON/RPC endpoints: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	reply, _ := json.MarshalIndent(&rpcEndpointStatusMsg{Endpoints: eth.RPCEndpointStatus()}, "", "  ")
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	res.Write(reply)
+}
+
+func (g *RESTGateway) reloadAuthHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthReloadConfig(req.Context()); err != nil {
+		log.Errorf("Error reloading security module: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	if err := auth.ReloadSecurityModule(); err != nil {
+		log.Errorf("Error reloading security module: %s", err)
+		status := 500
+		if err.Error() == errors.SecurityModuleNotRegistered || err.Error() == errors.SecurityModuleNotReloadable {
+			status = 405
+		}
+		sendRESTError(res, req, err, status)
+		return
+	}
+
+	log.Infof("Reloaded security module configuration")
+	reply, _ := json.Marshal(&statusMsg{OK: true})
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	res.Write(reply)
+}
+
 func (g *RESTGateway) sendError(res http.ResponseWriter, msg string, code int) {
 	reply, _ := json.Marshal(&errMsg{Message: msg})
 	res.Header().Set("Content-Type", "application/json")
@@ -205,19 +384,43 @@ func (g *RESTGateway) sendError(res http.ResponseWriter, msg string, code int) {
 
 // DispatchMsgAsync is the rest2eth interface method for async dispatching of messages (via our webhook logic)
 func (g *RESTGateway) DispatchMsgAsync(ctx context.Context, msg map[string]interface{}, ack bool) (*messages.AsyncSentMsg, error) {
-	reply, _, err := g.webhooks.processMsg(ctx, msg, ack)
+	var msgID string
+	if headers, ok := msg["headers"].(map[string]interface{}); ok {
+		msgID, _ = headers["id"].(string)
+	}
+	reply, _, err := g.webhooks.processMsg(ctx, msg, msgID, ack)
 	return reply, err
 }
 
 func (g *RESTGateway) newAccessTokenContextHandler(parent http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 
+		// A token on the query is dropped from the URL, so the handlers do not log it
+		queryToken := ""
+		if query := req.URL.Query(); query.Get("access_token") != "" {
+			queryToken = query.Get("access_token")
+			query.Del("access_token")
+			req.URL.RawQuery = query.Encode()
+		}
+
 		// Extract an access token from bearer token (only - no support for query params)
 		accessToken := ""
 		hSplit := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
 		if len(hSplit) == 2 && strings.ToLower(hSplit[0]) == "bearer" {
 			accessToken = hSplit[1]
+		} else if websocket.IsWebSocketUpgrade(req) || req.URL.Path == ConsolePath {
+			// Browser WebSocket clients cannot set headers on the handshake, and a browser
+			// cannot set them when opening the console, so we make an exception and accept
+			// the token as a query param
+			accessToken = queryToken
 		}
+		// Replies forwarded by a peer replica are authenticated by the peer secret, as the peer
+		// has no access token of its own to send
+		if req.URL.Path == PeerRepliesPath {
+			parent.ServeHTTP(res, req)
+			return
+		}
+
 		authCtx, err := auth.WithAuthContext(req.Context(), accessToken)
 		if err != nil {
 			log.Errorf("Error getting auth context: %s", err)
@@ -229,6 +432,40 @@ func (g *RESTGateway) newAccessTokenContextHandler(parent http.Handler) http.Han
 	})
 }
 
+// maxBodySize returns the limit for the body of a request. Uploads of Solidity and ABIs
+// to /abis can be much larger than the JSON sent to the other routes
+func (g *RESTGateway) maxBodySize(req *http.Request) int64 {
+	if req.Method == http.MethodPost && strings.TrimSuffix(req.URL.Path, "/") == "/abis" {
+		return int64(g.conf.HTTP.MaxUploadSize)
+	}
+	return int64(g.conf.HTTP.MaxBodySize)
+}
+
+// newMaxBodySizeHandler rejects requests with a body larger than the maximum for the route,
+// before any handler reads them into memory. Bodies without a content length are buffered
+// up to the limit, so handlers never see a truncated body
+func (g *RESTGateway) newMaxBodySizeHandler(parent http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		maxBodySize := g.maxBodySize(req)
+		tooLarge := req.ContentLength > maxBodySize
+		if req.ContentLength < 0 {
+			body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+			if err != nil {
+				sendRESTError(res, req, errors.Errorf(errors.HelperYAMLorJSONPayloadReadFailed, err), 400)
+				return
+			}
+			tooLarge = int64(len(body)) > maxBodySize
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+		}
+		if tooLarge {
+			sendRESTError(res, req, errors.Errorf(errors.RESTGatewayRequestTooLarge, maxBodySize), 413)
+			return
+		}
+		parent.ServeHTTP(res, req)
+	})
+}
+
 // Start kicks off the HTTP listener and router
 func (g *RESTGateway) Start() (err error) {
 
@@ -247,7 +484,7 @@ func (g *RESTGateway) Start() (err error) {
 
 	var processor tx.TxnProcessor
 	var rpcClient eth.RPCClient
-	if g.conf.RPC.URL != "" || g.conf.OpenAPI.StoragePath != "" {
+	if g.conf.RPC.URL != "" || g.conf.OpenAPI.Enabled() {
 		rpcClient, err = eth.RPCConnect(&g.conf.RPC)
 		if err != nil {
 			return err
@@ -255,10 +492,18 @@ func (g *RESTGateway) Start() (err error) {
 		processor = tx.NewTxnProcessor(&g.conf.TxnProcessorConf, &g.conf.RPCConf)
 		processor.Init(rpcClient)
 	}
+	g.processor = processor
 
 	g.ws.AddRoutes(router)
+	if g.conf.RPCProxy.Enabled {
+		newRPCProxy(&g.conf.RPCProxy, rpcClient, g.conf.HTTP.MaxBodySize, g.conf.WebSocket.AuthRevalidateSec).addRoutes(router)
+	}
 
-	if g.conf.OpenAPI.StoragePath != "" {
+	if g.conf.OpenAPI.Enabled() {
+		if g.conf.OpenAPI.ReadPool.RPC.URL == "" {
+			// Read-only calls use separate connections to the same node, unless a replica is configured
+			g.conf.OpenAPI.ReadPool.RPC = g.conf.RPC
+		}
 		g.smartContractGW, err = contracts.NewSmartContractGateway(&g.conf.OpenAPI, &g.conf.TxnProcessorConf, rpcClient, processor, g, g.ws)
 		if err != nil {
 			return err
@@ -282,21 +527,49 @@ func (g *RESTGateway) Start() (err error) {
 	}
 
 	router.GET("/status", g.statusHandler)
+	router.GET("/status/transactions", g.inflightStatusHandler)
+	router.GET("/status/rpc-shadow", g.rpcShadowStatusHandler)
+	router.GET("/status/rpc-endpoints", g.rpcEndpointStatusHandler)
+	router.POST("/admin/auth/reload", g.reloadAuthHandler)
+	router.GET(SupportBundlePath, g.supportBundleHandler)
+	router.GET(NonceReportPath, g.nonceReportHandler)
+	router.POST(VerifySignaturePath, g.verifySignatureHandler)
+	if g.conf.Console.Enabled {
+		router.GET(ConsolePath, g.consoleHandler)
+	}
 	g.receipts = newReceiptStore(receiptStoreConf, receiptStorePersistence, g.smartContractGW)
+	g.receipts.syncReplies = newSyncReplies(&g.conf.Sync)
 	g.receipts.addRoutes(router)
+	if g.conf.Sync.Self != "" {
+		router.POST(PeerRepliesPath, g.receipts.syncReplies.peerReplyHandler)
+	}
 	if len(g.conf.Kafka.Brokers) > 0 {
-		wk := newWebhooksKafka(&g.conf.Kafka, g.receipts)
+		wk, err := newWebhooksKafka(&g.conf.Kafka, &g.conf.KafkaQueue, g.receipts)
+		if err != nil {
+			return err
+		}
 		g.webhooks = newWebhooks(wk, g.smartContractGW)
 	} else {
 		wd := newWebhooksDirect(&g.conf.WebhooksDirectConf, processor, g.receipts)
 		g.webhooks = newWebhooks(wd, g.smartContractGW)
 	}
+	g.webhooks.syncReplies = g.receipts.syncReplies
 	g.webhooks.addRoutes(router)
 
+	var handler http.Handler = router
+	if g.smartContractGW != nil {
+		handler = g.smartContractGW.WithHierarchicalNames(router)
+	}
+	if recorder.Enabled() {
+		handler = recorder.NewHTTPHandler(handler)
+	}
+	if g.conf.HTTP.Compression.Enabled {
+		handler = newCompressionHandler(&g.conf.HTTP.Compression, handler)
+	}
 	g.srv = &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", g.conf.HTTP.LocalAddr, g.conf.HTTP.Port),
 		TLSConfig:      tlsConfig,
-		Handler:        g.newAccessTokenContextHandler(router),
+		Handler:        g.newAccessTokenContextHandler(g.newMaxBodySizeHandler(handler)),
 		MaxHeaderBytes: MaxHeaderSize,
 	}
 
@@ -346,6 +619,10 @@ func (g *RESTGateway) Start() (err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	g.srv.Shutdown(ctx)
 	defer cancel()
+	if g.processor != nil {
+		g.processor.Close()
+	}
+	g.receipts.close()
 
 	return
 }
@@ -15,9 +15,11 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -28,6 +30,8 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/kaleido-io/ethconnect/internal/auth"
 	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/kaleido-io/ethconnect/internal/tx"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,6 +56,24 @@ func TestValidateConfInvalidArgs(t *testing.T) {
 	assert.EqualError(err, "MongoDB URL, Database and Collection name must be specified to enable the receipt store")
 }
 
+func TestValidateConfInvalidReceiptPartition(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.MongoDB.Partition = "hourly"
+	err := g.ValidateConf()
+	assert.EqualError(err, "Invalid receipt store partition 'hourly'. Must be daily or weekly")
+}
+
+func TestValidateConfInvalidReceiptIntegrity(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.MemStore.Integrity = "signer"
+	err := g.ValidateConf()
+	assert.EqualError(err, "Invalid receipt store integrity 'signer'. Must be global or address")
+}
+
 func TestValidateConfInvalidOpenAPIArgs(t *testing.T) {
 	assert := assert.New(t)
 	var printYAML = false
@@ -61,6 +83,20 @@ func TestValidateConfInvalidOpenAPIArgs(t *testing.T) {
 	assert.EqualError(err, "RPC URL and Storage Path must be supplied to enable the Open API REST Gateway")
 }
 
+func TestValidateConfInvalidProxyURL(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.HDWalletConf.ProxyURL = "://bad"
+	err := g.ValidateConf()
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+
+	g.conf.HDWalletConf.ProxyURL = ""
+	g.conf.OpenAPI.RemoteRegistry.ProxyURL = "://bad"
+	err = g.ValidateConf()
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+}
+
 func TestStartStatusStopNoKafkaWebhooksAccessToken(t *testing.T) {
 	assert := assert.New(t)
 
@@ -112,6 +148,212 @@ func TestStartStatusStopNoKafkaWebhooksAccessToken(t *testing.T) {
 
 }
 
+func TestInflightStatusHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.processor = &mockProcessor{
+		inflightStatus: map[string][]*tx.InFlightTxnStatus{
+			"0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8": {
+				{RequestID: "req1", Nonce: "10", TransactionHash: "0x12345", AgeSeconds: 1.5, ReceiptChecks: 2},
+				{RequestID: "req2", Nonce: "11"},
+			},
+		},
+	}
+
+	req := httptest.NewRequest("GET", "/status/transactions", nil)
+	res := httptest.NewRecorder()
+	g.inflightStatusHandler(res, req, nil)
+
+	assert.Equal(200, res.Code)
+	var status inflightStatusMsg
+	err := json.NewDecoder(res.Body).Decode(&status)
+	assert.NoError(err)
+	assert.Equal(2, status.Count)
+	txns := status.Transactions["0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8"]
+	assert.Equal("req1", txns[0].RequestID)
+	assert.Equal("10", txns[0].Nonce)
+	assert.Equal("0x12345", txns[0].TransactionHash)
+	assert.Equal(2, txns[0].ReceiptChecks)
+}
+
+func TestInflightStatusHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.processor = &mockProcessor{}
+
+	req := httptest.NewRequest("GET", "/status/transactions", nil)
+	res := httptest.NewRecorder()
+	g.inflightStatusHandler(res, req, nil)
+
+	assert.Equal(401, res.Code)
+	var errReply restError
+	err := json.NewDecoder(res.Body).Decode(&errReply)
+	assert.NoError(err)
+	assert.Equal("Unauthorized", errReply.Message)
+}
+
+func TestInflightStatusHandlerNoProcessor(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", "/status/transactions", nil)
+	res := httptest.NewRecorder()
+	g.inflightStatusHandler(res, req, nil)
+
+	assert.Equal(200, res.Code)
+	var status inflightStatusMsg
+	err := json.NewDecoder(res.Body).Decode(&status)
+	assert.NoError(err)
+	assert.Equal(0, status.Count)
+	assert.Empty(status.Transactions)
+}
+
+func TestRPCShadowStatusHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", "/status/rpc-shadow", nil)
+	res := httptest.NewRecorder()
+	g.rpcShadowStatusHandler(res, req, nil)
+
+	assert.Equal(200, res.Code)
+	var status map[string]interface{}
+	err := json.NewDecoder(res.Body).Decode(&status)
+	assert.NoError(err)
+	assert.NotNil(status["shadows"])
+}
+
+func TestRPCShadowStatusHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", "/status/rpc-shadow", nil)
+	res := httptest.NewRecorder()
+	g.rpcShadowStatusHandler(res, req, nil)
+
+	assert.Equal(401, res.Code)
+}
+
+func TestRPCEndpointStatusHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", "/status/rpc-endpoints", nil)
+	res := httptest.NewRecorder()
+	g.rpcEndpointStatusHandler(res, req, nil)
+
+	assert.Equal(200, res.Code)
+	var status map[string]interface{}
+	err := json.NewDecoder(res.Body).Decode(&status)
+	assert.NoError(err)
+	assert.NotNil(status["endpoints"])
+}
+
+func TestRPCEndpointStatusHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("GET", "/status/rpc-endpoints", nil)
+	res := httptest.NewRecorder()
+	g.rpcEndpointStatusHandler(res, req, nil)
+
+	assert.Equal(401, res.Code)
+}
+
+func TestReloadAuthHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	sm := &authtest.TestReloadableSecurityModule{}
+	auth.RegisterSecurityModule(sm)
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("POST", "/admin/auth/reload", nil)
+	ctx, _ := auth.WithAuthContext(req.Context(), "testat")
+	res := httptest.NewRecorder()
+	g.reloadAuthHandler(res, req.WithContext(ctx), nil)
+
+	assert.Equal(200, res.Code)
+	var status statusMsg
+	err := json.NewDecoder(res.Body).Decode(&status)
+	assert.NoError(err)
+	assert.True(status.OK)
+	assert.Equal(1, sm.Reloads)
+
+	sm.ReloadErr = fmt.Errorf("pop")
+	res = httptest.NewRecorder()
+	g.reloadAuthHandler(res, req.WithContext(ctx), nil)
+	assert.Equal(500, res.Code)
+	var errReply restError
+	err = json.NewDecoder(res.Body).Decode(&errReply)
+	assert.NoError(err)
+	assert.Equal("Failed to reload the security module configuration: pop", errReply.Message)
+}
+
+func TestReloadAuthHandlerUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestReloadableSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("POST", "/admin/auth/reload", nil)
+	res := httptest.NewRecorder()
+	g.reloadAuthHandler(res, req, nil)
+
+	assert.Equal(401, res.Code)
+}
+
+func TestReloadAuthHandlerNotReloadable(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+
+	req := httptest.NewRequest("POST", "/admin/auth/reload", nil)
+	res := httptest.NewRecorder()
+	g.reloadAuthHandler(res, req, nil)
+	assert.Equal(405, res.Code)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	ctx, _ := auth.WithAuthContext(req.Context(), "testat")
+	res = httptest.NewRecorder()
+	g.reloadAuthHandler(res, req.WithContext(ctx), nil)
+	assert.Equal(405, res.Code)
+	var errReply restError
+	err := json.NewDecoder(res.Body).Decode(&errReply)
+	assert.NoError(err)
+	assert.Equal("The security module does not support reloading its configuration", errReply.Message)
+}
+
 func TestStartStatusStopNoKafkaWebhooksMissingToken(t *testing.T) {
 	assert := assert.New(t)
 
@@ -329,3 +571,164 @@ func TestDispatchMsgAsyncPassesThroughToWebhooks(t *testing.T) {
 	_, err := g.DispatchMsgAsync(context.Background(), fakeMsg, true)
 	assert.EqualError(err, "Invalid message - missing 'headers' (or not an object)")
 }
+
+func TestAccessTokenContextHandlerWebSocketQueryParam(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	var accessToken, requestURI string
+	handler := g.newAccessTokenContextHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		accessToken = auth.GetAccessToken(req.Context())
+		requestURI = req.URL.RequestURI()
+	}))
+
+	// Accepted on a WebSocket upgrade, and removed from the URL so it is not logged
+	req := httptest.NewRequest("GET", "/ws?access_token=testat&topic=t1", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("testat", accessToken)
+	assert.Equal("/ws?topic=t1", requestURI)
+
+	// Ignored on other requests
+	req = httptest.NewRequest("GET", "/status?access_token=testat", nil)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(401, res.Code)
+}
+
+type errReader int
+
+func (errReader) Read(p []byte) (n int, err error) {
+	return 0, fmt.Errorf("pop")
+}
+
+func TestMaxBodySizeHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.HTTP.MaxBodySize = 10
+	var body []byte
+	handler := g.newMaxBodySizeHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ = ioutil.ReadAll(req.Body)
+	}))
+
+	req := httptest.NewRequest("POST", "/hook", bytes.NewReader([]byte("0123456789")))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("0123456789", string(body))
+
+	req = httptest.NewRequest("POST", "/hook", bytes.NewReader([]byte("0123456789A")))
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(413, res.Code)
+	var errReply restError
+	json.NewDecoder(res.Body).Decode(&errReply)
+	assert.Equal("Request body exceeds the maximum size of 10 bytes", errReply.Message)
+
+	// Without a content length, the body is buffered up to the limit
+	req = httptest.NewRequest("POST", "/hook", bytes.NewReader([]byte("012345678")))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+	assert.Equal("012345678", string(body))
+	assert.Equal(int64(9), req.ContentLength)
+
+	req = httptest.NewRequest("POST", "/hook", bytes.NewReader([]byte("0123456789A")))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(413, res.Code)
+
+	req = httptest.NewRequest("POST", "/hook", errReader(0))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(400, res.Code)
+}
+
+func TestMaxBodySizeHandlerUploads(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.HTTP.MaxBodySize = 10
+	g.conf.HTTP.MaxUploadSize = 20
+	handler := g.newMaxBodySizeHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+
+	req := httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte("0123456789ABCDEFGHIJ")))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(200, res.Code)
+
+	req = httptest.NewRequest("POST", "/abis", bytes.NewReader([]byte("0123456789ABCDEFGHIJK")))
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(413, res.Code)
+
+	// Other routes under /abis keep the smaller limit
+	req = httptest.NewRequest("POST", "/abis/abi1/0x0123456789abcdef0123456789abcdef01234567", bytes.NewReader([]byte("0123456789A")))
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(413, res.Code)
+}
+
+func TestValidateConfDefaultMaxBodySize(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	err := g.ValidateConf()
+	assert.NoError(err)
+	assert.Equal(1024*1024, g.conf.HTTP.MaxBodySize)
+	assert.Equal(32*1024*1024, g.conf.HTTP.MaxUploadSize)
+}
+
+func TestDispatchMsgAsyncKeepsSuppliedID(t *testing.T) {
+	assert := assert.New(t)
+
+	var printYAML = true
+	g := NewRESTGateway(&printYAML)
+	fakeHandler := &mockHandler{}
+	g.webhooks = newWebhooks(fakeHandler, nil)
+
+	msg := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type": messages.MsgTypeSendTransaction,
+			"id":   "client-id-1",
+		},
+		"from": "0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8",
+	}
+	reply, err := g.DispatchMsgAsync(context.Background(), msg, true)
+	assert.NoError(err)
+	assert.Equal("client-id-1", reply.Request)
+}
+
+func TestValidateConfPeersRequireSecret(t *testing.T) {
+	assert := assert.New(t)
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.Sync.Self = "http://replica1:8080"
+	err := g.ValidateConf()
+	assert.EqualError(err, "A peer secret must be supplied to forward replies between peers")
+
+	g.conf.Sync.Self = ""
+	g.conf.Sync.Peers = []string{"http://replica2:8080"}
+	g.conf.Sync.PeerSecret = "  "
+	err = g.ValidateConf()
+	assert.EqualError(err, "A peer secret must be supplied to forward replies between peers")
+
+	g.conf.Sync.PeerSecret = "s3cret"
+	err = g.ValidateConf()
+	assert.NoError(err)
+	assert.Equal(defaultSyncTimeoutSec, g.conf.Sync.TimeoutSec)
+}
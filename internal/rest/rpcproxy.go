@@ -0,0 +1,358 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RPCProxyPath is the path of the WebSocket JSON/RPC proxy to the node
+	RPCProxyPath = "/rpc"
+
+	rpcErrParse          = -32700
+	rpcErrInvalidRequest = -32600
+	rpcErrMethodNotFound = -32601
+	rpcErrInternal       = -32603
+	rpcErrLimitExceeded  = -32005
+)
+
+// defaultRPCProxyMethods are the read-only methods allowed when no allow list is configured
+var defaultRPCProxyMethods = []string{
+	"eth_blockNumber", "eth_call", "eth_chainId", "eth_estimateGas", "eth_gasPrice", "eth_getBalance",
+	"eth_getBlockByHash", "eth_getBlockByNumber", "eth_getCode", "eth_getLogs", "eth_getStorageAt",
+	"eth_getTransactionByHash", "eth_getTransactionCount", "eth_getTransactionReceipt",
+	"net_version", "web3_clientVersion",
+}
+
+// RPCProxyConf configures the proxy, which gives low-level tooling access to the node through
+// the authentication and audit logging of the gateway, rather than direct access to the node
+type RPCProxyConf struct {
+	Enabled      bool     `json:"enabled"`
+	AllowMethods []string `json:"allowMethods,omitempty"`
+	RateLimit    float64  `json:"rateLimit,omitempty"`
+	RateBurst    int      `json:"rateBurst,omitempty"`
+}
+
+type rpcProxyRequest struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcProxyError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type rpcProxyResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcProxyError  `json:"error,omitempty"`
+}
+
+// rpcErrorWithCode is implemented by the errors returned by the node
+type rpcErrorWithCode interface {
+	ErrorCode() int
+}
+
+// rpcErrorWithData is implemented by node errors that carry data, such as revert data
+type rpcErrorWithData interface {
+	ErrorData() interface{}
+}
+
+type rpcProxy struct {
+	conf           *RPCProxyConf
+	rpc            eth.RPCClient
+	maxMsgSize     int64
+	upgrader       *websocket.Upgrader
+	allowed        *eth.RPCMethodAllowList
+	authRevalidate time.Duration
+	limiterMux     sync.Mutex
+	limiters       map[string]*rateLimiter
+}
+
+// rateLimiter is a token bucket, refilled at the rate limit up to the burst
+type rateLimiter struct {
+	mux    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRPCProxy(conf *RPCProxyConf, rpc eth.RPCClient, maxMsgSize, authRevalidateSec int) *rpcProxy {
+	p := &rpcProxy{
+		conf:           conf,
+		rpc:            rpc,
+		maxMsgSize:     int64(maxMsgSize),
+		authRevalidate: time.Duration(authRevalidateSec) * time.Second,
+		limiters:       make(map[string]*rateLimiter),
+		upgrader: &websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+		},
+	}
+	allowMethods := conf.AllowMethods
+	if len(allowMethods) == 0 {
+		allowMethods = defaultRPCProxyMethods
+	}
+	p.allowed = eth.NewRPCMethodAllowList(allowMethods)
+	return p
+}
+
+func (p *rpcProxy) addRoutes(router *httprouter.Router) {
+	router.GET(RPCProxyPath, p.handler)
+}
+
+func (p *rpcProxy) newRateLimiter() *rateLimiter {
+	if p.conf.RateLimit <= 0 {
+		return nil
+	}
+	burst := float64(p.conf.RateBurst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: p.conf.RateLimit, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// rpcProxyCaller identifies the caller of a connection by its access token, or by its IP
+// address when there is no security module
+func rpcProxyCaller(req *http.Request) string {
+	if token := auth.GetAccessToken(req.Context()); token != "" {
+		h := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(h[:])
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// limiterFor returns the rate limiter shared by all the connections of a caller, so a caller
+// cannot raise its rate by opening more connections. Limiters whose bucket has refilled are
+// removed, as a new one would be the same
+func (p *rpcProxy) limiterFor(caller string) *rateLimiter {
+	if p.conf.RateLimit <= 0 {
+		return nil
+	}
+	p.limiterMux.Lock()
+	defer p.limiterMux.Unlock()
+	now := time.Now()
+	for key, l := range p.limiters {
+		if key != caller && l.refilled(now) {
+			delete(p.limiters, key)
+		}
+	}
+	l, ok := p.limiters[caller]
+	if !ok {
+		l = p.newRateLimiter()
+		p.limiters[caller] = l
+	}
+	return l
+}
+
+// refilled returns true if the bucket would be full at the supplied time
+func (l *rateLimiter) refilled(now time.Time) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return l.tokens+now.Sub(l.last).Seconds()*l.rate >= l.burst
+}
+
+// allow takes a token from the bucket if one is available
+func (l *rateLimiter) allow() bool {
+	if l == nil {
+		return true
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (p *rpcProxy) methodAllowed(method string) bool {
+	return p.allowed.Allowed(method)
+}
+
+// handler upgrades the connection, then proxies each JSON/RPC request (or batch) received
+// on it to the node in turn. Each call is authorized by the security module as it is made
+func (p *rpcProxy) handler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	conn, err := p.upgrader.Upgrade(res, req, nil)
+	if err != nil {
+		log.Errorf("RPC proxy WebSocket upgrade failed: %s", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(p.maxMsgSize)
+	connID := utils.UUIDv4()
+	limiter := p.limiterFor(rpcProxyCaller(req))
+	log.Infof("RPC proxy connection %s opened from %s", connID, req.RemoteAddr)
+	if p.authRevalidate > 0 && auth.SecurityModuleEnabled() {
+		closing := make(chan struct{})
+		revalidateDone := make(chan struct{})
+		go func() {
+			defer close(revalidateDone)
+			p.revalidateAuth(conn, connID, auth.GetAccessToken(req.Context()), closing)
+		}()
+		defer func() {
+			close(closing)
+			<-revalidateDone
+		}()
+	}
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			log.Infof("RPC proxy connection %s closed: %s", connID, err)
+			return
+		}
+		reply := p.processMessage(req.Context(), connID, limiter, msg)
+		if err := conn.WriteMessage(websocket.TextMessage, reply); err != nil {
+			log.Errorf("RPC proxy connection %s write failed: %s", connID, err)
+			return
+		}
+	}
+}
+
+// revalidateAuth periodically re-checks the access token used to open the connection, closing
+// the connection once the token is no longer valid, the same as for event stream WebSockets
+func (p *rpcProxy) revalidateAuth(conn *websocket.Conn, connID, accessToken string, closing chan struct{}) {
+	ticker := time.NewTicker(p.authRevalidate)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closing:
+			return
+		case <-ticker.C:
+			if _, err := auth.WithAuthContext(context.Background(), accessToken); err != nil {
+				log.Errorf("RPC proxy connection %s authorization revoked: %s", connID, err)
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "Unauthorized"), time.Now().Add(time.Second))
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// processMessage handles a single request, or a batch of requests
+func (p *rpcProxy) processMessage(ctx context.Context, connID string, limiter *rateLimiter, msg []byte) []byte {
+	trimmed := bytes.TrimSpace(msg)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil || len(batch) == 0 {
+			return p.marshalResponse(p.errorResponse(nil, rpcErrParse, errors.Errorf(errors.RPCProxyParseFailed)))
+		}
+		responses := make([]*rpcProxyResponse, len(batch))
+		for i, reqBytes := range batch {
+			responses[i] = p.processRequest(ctx, connID, limiter, reqBytes)
+		}
+		return p.marshalResponse(responses)
+	}
+	return p.marshalResponse(p.processRequest(ctx, connID, limiter, trimmed))
+}
+
+func (p *rpcProxy) processRequest(ctx context.Context, connID string, limiter *rateLimiter, reqBytes []byte) *rpcProxyResponse {
+	var rpcReq rpcProxyRequest
+	if err := json.Unmarshal(reqBytes, &rpcReq); err != nil {
+		return p.errorResponse(nil, rpcErrParse, errors.Errorf(errors.RPCProxyParseFailed))
+	}
+	if rpcReq.Method == "" {
+		return p.errorResponse(rpcReq.ID, rpcErrInvalidRequest, errors.Errorf(errors.RPCProxyInvalidRequest))
+	}
+	if !p.methodAllowed(rpcReq.Method) {
+		log.Warnf("RPC proxy [%s] %s id=%s: method not allowed", connID, rpcReq.Method, rpcReq.ID)
+		return p.errorResponse(rpcReq.ID, rpcErrMethodNotFound, errors.Errorf(errors.RPCProxyMethodNotAllowed, rpcReq.Method))
+	}
+	if !limiter.allow() {
+		log.Warnf("RPC proxy [%s] %s id=%s: rate limit exceeded", connID, rpcReq.Method, rpcReq.ID)
+		return p.errorResponse(rpcReq.ID, rpcErrLimitExceeded, errors.Errorf(errors.RPCProxyRateLimited))
+	}
+
+	args := make([]interface{}, len(rpcReq.Params))
+	for i, param := range rpcReq.Params {
+		args[i] = param
+	}
+	start := time.Now()
+	var result json.RawMessage
+	err := p.rpc.CallContext(ctx, &result, rpcReq.Method, args...)
+	callTime := time.Since(start).Seconds()
+	if err != nil {
+		log.Infof("RPC proxy [%s] %s id=%s failed: %s [%.2fs]", connID, rpcReq.Method, rpcReq.ID, err, callTime)
+		code := rpcErrInternal
+		if codeErr, ok := err.(rpcErrorWithCode); ok {
+			code = codeErr.ErrorCode()
+		}
+		errResponse := p.errorResponse(rpcReq.ID, code, err)
+		if dataErr, ok := err.(rpcErrorWithData); ok {
+			errResponse.Error.Data = dataErr.ErrorData()
+		}
+		return errResponse
+	}
+	log.Infof("RPC proxy [%s] %s id=%s OK [%.2fs]", connID, rpcReq.Method, rpcReq.ID, callTime)
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return &rpcProxyResponse{JSONRPC: "2.0", ID: p.responseID(rpcReq.ID), Result: result}
+}
+
+func (p *rpcProxy) responseID(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (p *rpcProxy) errorResponse(id json.RawMessage, code int, err error) *rpcProxyResponse {
+	return &rpcProxyResponse{
+		JSONRPC: "2.0",
+		ID:      p.responseID(id),
+		Error:   &rpcProxyError{Code: code, Message: err.Error()},
+	}
+}
+
+func (p *rpcProxy) marshalResponse(response interface{}) []byte {
+	b, _ := json.Marshal(response)
+	return b
+}
@@ -0,0 +1,296 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+type testRPCCodeError struct {
+	code int
+	data interface{}
+}
+
+func (e *testRPCCodeError) Error() string          { return "execution reverted" }
+func (e *testRPCCodeError) ErrorCode() int         { return e.code }
+func (e *testRPCCodeError) ErrorData() interface{} { return e.data }
+
+func newTestRPCProxy(t *testing.T, conf *RPCProxyConf, rpc eth.RPCClient) (*websocket.Conn, func()) {
+	router := httprouter.New()
+	newRPCProxy(conf, rpc, 1024, 0).addRoutes(router)
+	svr := httptest.NewServer(router)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(svr.URL, "http")+RPCProxyPath, nil)
+	assert.NoError(t, err)
+	return conn, func() {
+		conn.Close()
+		svr.Close()
+	}
+}
+
+func dialTestRPCProxy(t *testing.T, svr *httptest.Server) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(svr.URL, "http")+RPCProxyPath, nil)
+	assert.NoError(t, err)
+	return conn
+}
+
+func testRPCProxyCall(t *testing.T, conn *websocket.Conn, req string, reply interface{}) {
+	assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(req)))
+	_, msg, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg, reply))
+}
+
+func TestRPCProxyCallOK(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		*(res.(*json.RawMessage)) = json.RawMessage(`"0x1234"`)
+	})
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true}, rpc)
+	defer done()
+
+	var reply rpcProxyResponse
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0x66c5fe653e7a9ebb628a6d40f0452d1e358baee8","latest"]}`, &reply)
+	assert.Nil(reply.Error)
+	assert.Equal(`1`, string(reply.ID))
+	assert.Equal(`"0x1234"`, string(reply.Result))
+	assert.Equal("eth_getBalance", rpc.MethodCapture)
+	assert.Len(rpc.ArgsCapture, 2)
+	assert.Equal(json.RawMessage(`"latest"`), rpc.ArgsCapture[1])
+}
+
+func TestRPCProxyBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		*(res.(*json.RawMessage)) = json.RawMessage(`"0x10"`)
+	})
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true}, rpc)
+	defer done()
+
+	var replies []rpcProxyResponse
+	testRPCProxyCall(t, conn, `[{"jsonrpc":"2.0","id":"a","method":"eth_blockNumber"},{"jsonrpc":"2.0","id":"b","method":"eth_sendTransaction","params":[{}]}]`, &replies)
+	assert.Len(replies, 2)
+	assert.Equal(`"0x10"`, string(replies[0].Result))
+	assert.Equal(`"b"`, string(replies[1].ID))
+	assert.Equal(rpcErrMethodNotFound, replies[1].Error.Code)
+	assert.Equal("Method 'eth_sendTransaction' is not allowed by the proxy", replies[1].Error.Message)
+	assert.Equal("eth_blockNumber", rpc.MethodCapture)
+}
+
+func TestRPCProxyAllowPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(nil, nil)
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true, AllowMethods: []string{"debug_*"}}, rpc)
+	defer done()
+
+	var reply rpcProxyResponse
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"debug_traceTransaction","params":["0x12345"]}`, &reply)
+	assert.Nil(reply.Error)
+	assert.Equal("null", string(reply.Result))
+
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"}`, &reply)
+	assert.Equal(rpcErrMethodNotFound, reply.Error.Code)
+}
+
+func TestRPCProxyRateLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(nil, nil)
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true, RateLimit: 0.001, RateBurst: 2}, rpc)
+	defer done()
+
+	var reply rpcProxyResponse
+	for i := 0; i < 2; i++ {
+		testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, &reply)
+		assert.Nil(reply.Error)
+	}
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, &reply)
+	assert.Equal(rpcErrLimitExceeded, reply.Error.Code)
+	assert.Equal("Rate limit exceeded", reply.Error.Message)
+}
+
+func TestRPCProxyRateLimitPerCaller(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(nil, nil)
+	router := httprouter.New()
+	p := newRPCProxy(&RPCProxyConf{Enabled: true, RateLimit: 0.001, RateBurst: 2}, rpc, 1024, 0)
+	p.addRoutes(router)
+	svr := httptest.NewServer(router)
+	defer svr.Close()
+
+	// A second connection from the same caller shares the limit of the first
+	conn1 := dialTestRPCProxy(t, svr)
+	defer conn1.Close()
+	conn2 := dialTestRPCProxy(t, svr)
+	defer conn2.Close()
+
+	var reply rpcProxyResponse
+	testRPCProxyCall(t, conn1, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, &reply)
+	assert.Nil(reply.Error)
+	testRPCProxyCall(t, conn2, `{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"}`, &reply)
+	assert.Nil(reply.Error)
+	testRPCProxyCall(t, conn2, `{"jsonrpc":"2.0","id":3,"method":"eth_blockNumber"}`, &reply)
+	assert.Equal(rpcErrLimitExceeded, reply.Error.Code)
+	assert.Len(p.limiters, 1)
+}
+
+func TestRPCProxyLimiters(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newRPCProxy(&RPCProxyConf{RateLimit: 1000, RateBurst: 1}, nil, 1024, 0)
+	l1 := p.limiterFor("token:abc")
+	assert.True(l1.allow())
+	assert.False(l1.allow())
+	assert.Equal(l1, p.limiterFor("token:abc"))
+
+	// The bucket of the first caller refills, so it is removed when another caller connects
+	time.Sleep(5 * time.Millisecond)
+	p.limiterFor("ip:127.0.0.1")
+	assert.Len(p.limiters, 1)
+	assert.NotNil(p.limiters["ip:127.0.0.1"])
+
+	p = newRPCProxy(&RPCProxyConf{}, nil, 1024, 0)
+	assert.Nil(p.limiterFor("token:abc"))
+	assert.Empty(p.limiters)
+}
+
+func TestRPCProxyCaller(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest(http.MethodGet, RPCProxyPath, nil)
+	req.RemoteAddr = "10.0.0.1:12345"
+	assert.Equal("ip:10.0.0.1", rpcProxyCaller(req))
+	req.RemoteAddr = "pipe"
+	assert.Equal("ip:pipe", rpcProxyCaller(req))
+
+	req = req.WithContext(context.WithValue(req.Context(), auth.ContextKeyAccessToken, "testat"))
+	caller := rpcProxyCaller(req)
+	assert.Regexp("^token:[0-9a-f]{64}$", caller)
+	assert.NotContains(caller, "testat")
+}
+
+func TestRPCProxyNeverAllowsSendOrSign(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(nil, nil)
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true, AllowMethods: []string{"eth_*", "personal_*"}}, rpc)
+	defer done()
+
+	var reply rpcProxyResponse
+	for _, method := range []string{"eth_sendTransaction", "eth_sendRawTransaction", "eth_sign", "eth_signTypedData_v4", "personal_sign", "personal_unlockAccount"} {
+		testRPCProxyCall(t, conn, fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"%s"}`, method), &reply)
+		assert.Equal(rpcErrMethodNotFound, reply.Error.Code, method)
+	}
+	assert.Empty(rpc.MethodCapture)
+
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, &reply)
+	assert.Nil(reply.Error)
+}
+
+func TestRPCProxyRevalidateAuth(t *testing.T) {
+	assert := assert.New(t)
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	router := httprouter.New()
+	p := newRPCProxy(&RPCProxyConf{Enabled: true}, eth.NewMockRPCClientForSync(nil, nil), 1024, 0)
+	p.authRevalidate = 1 * time.Millisecond
+	p.addRoutes(router)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get("token")
+		router.ServeHTTP(res, req.WithContext(context.WithValue(req.Context(), auth.ContextKeyAccessToken, token)))
+	}))
+	defer svr.Close()
+	wsURL := "ws" + strings.TrimPrefix(svr.URL, "http") + RPCProxyPath
+
+	// A valid token keeps the connection open
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token=testat", nil)
+	assert.NoError(err)
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(conn.WriteMessage(websocket.TextMessage, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+	_, _, err = conn.ReadMessage()
+	assert.NoError(err)
+	conn.Close()
+
+	// A revoked token closes the connection
+	conn, _, err = websocket.DefaultDialer.Dial(wsURL+"?token=revoked", nil)
+	assert.NoError(err)
+	defer conn.Close()
+	_, _, err = conn.ReadMessage()
+	assert.True(websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+}
+
+func TestRPCProxyNodeErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	rpc := eth.NewMockRPCClientForSync(&testRPCCodeError{code: 3, data: "0x08c379a0"}, nil)
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true}, rpc)
+	defer done()
+
+	var reply rpcProxyResponse
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{}]}`, &reply)
+	assert.Equal(3, reply.Error.Code)
+	assert.Equal("execution reverted", reply.Error.Message)
+	assert.Equal("0x08c379a0", reply.Error.Data)
+
+	conn2, done2 := newTestRPCProxy(t, &RPCProxyConf{Enabled: true}, eth.NewMockRPCClientForSync(fmt.Errorf("pop"), nil))
+	defer done2()
+	testRPCProxyCall(t, conn2, `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{}]}`, &reply)
+	assert.Equal(rpcErrInternal, reply.Error.Code)
+	assert.Equal("pop", reply.Error.Message)
+}
+
+func TestRPCProxyBadRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, done := newTestRPCProxy(t, &RPCProxyConf{Enabled: true}, eth.NewMockRPCClientForSync(nil, nil))
+	defer done()
+
+	var reply rpcProxyResponse
+	testRPCProxyCall(t, conn, `!json`, &reply)
+	assert.Equal(rpcErrParse, reply.Error.Code)
+	assert.Equal("null", string(reply.ID))
+
+	testRPCProxyCall(t, conn, `[]`, &reply)
+	assert.Equal(rpcErrParse, reply.Error.Code)
+
+	testRPCProxyCall(t, conn, `{"jsonrpc":"2.0","id":5}`, &reply)
+	assert.Equal(rpcErrInvalidRequest, reply.Error.Code)
+	assert.Equal("5", string(reply.ID))
+}
+
+func TestRPCProxyRequiresRPC(t *testing.T) {
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	g.conf.RPCProxy.Enabled = true
+	assert.EqualError(t, g.ValidateConf(), "RPC URL must be supplied to enable the JSON/RPC proxy")
+}
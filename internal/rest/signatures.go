@@ -0,0 +1,133 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// VerifySignaturePath is the path to recover the signer of a signature supplied by a client
+	VerifySignaturePath = "/signatures/verify"
+
+	signatureTypePersonal = "personal_sign"
+	signatureTypeEIP712   = "eip712"
+)
+
+// verifySignatureRequest is a signature of a personal_sign message, supplied as text or as
+// hex data, or of EIP-712 typed data. The address is optional, and is the expected signer
+type verifySignatureRequest struct {
+	Message   *string        `json:"message,omitempty"`
+	Data      string         `json:"data,omitempty"`
+	TypedData *eth.TypedData `json:"typedData,omitempty"`
+	Signature string         `json:"signature"`
+	Address   string         `json:"address,omitempty"`
+}
+
+type verifySignatureReply struct {
+	Type    string `json:"type"`
+	Signer  string `json:"signer"`
+	Address string `json:"address,omitempty"`
+	Valid   *bool  `json:"valid,omitempty"`
+}
+
+// hash returns the hash that was signed, and the type of the signature
+func (v *verifySignatureRequest) hash() ([]byte, string, error) {
+	supplied := 0
+	for _, isSet := range []bool{v.Message != nil, v.Data != "", v.TypedData != nil} {
+		if isSet {
+			supplied++
+		}
+	}
+	if supplied != 1 {
+		return nil, "", errors.Errorf(errors.SignatureVerifyMissingMessage)
+	}
+	switch {
+	case v.TypedData != nil:
+		hash, err := eth.HashTypedData(v.TypedData)
+		return hash, signatureTypeEIP712, err
+	case v.Message != nil:
+		return eth.HashPersonalMessage([]byte(*v.Message)), signatureTypePersonal, nil
+	default:
+		data, err := ethbind.API.HexDecode(v.Data)
+		if err != nil {
+			return nil, "", errors.Errorf(errors.SignatureVerifyBadData)
+		}
+		return eth.HashPersonalMessage(data), signatureTypePersonal, nil
+	}
+}
+
+// verifySignatureHandler recovers the address that signed a personal_sign message or
+// EIP-712 typed data, and checks it against the expected address when one is supplied
+func (g *RESTGateway) verifySignatureHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error verifying signature: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	var verifyReq verifySignatureRequest
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&verifyReq); err != nil {
+		sendRESTError(res, req, errors.Errorf(errors.SignatureVerifyBadRequest, err), 400)
+		return
+	}
+	if verifyReq.Address != "" && !ethbind.API.IsHexAddress(verifyReq.Address) {
+		sendRESTError(res, req, errors.Errorf(errors.SignatureVerifyBadAddress, verifyReq.Address), 400)
+		return
+	}
+	signature, err := ethbind.API.HexDecode(verifyReq.Signature)
+	if err != nil {
+		sendRESTError(res, req, errors.Errorf(errors.SignatureVerifyBadSignature), 400)
+		return
+	}
+	hash, sigType, err := verifyReq.hash()
+	if err != nil {
+		sendRESTError(res, req, err, 400)
+		return
+	}
+	signer, err := eth.RecoverAddress(hash, signature)
+	if err != nil {
+		sendRESTError(res, req, err, 400)
+		return
+	}
+
+	reply := &verifySignatureReply{
+		Type:   sigType,
+		Signer: signer,
+	}
+	if verifyReq.Address != "" {
+		valid := strings.EqualFold(signer, verifyReq.Address)
+		reply.Address = verifyReq.Address
+		reply.Valid = &valid
+	}
+	replyBytes, _ := json.Marshal(reply)
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	res.Write(replyBytes)
+}
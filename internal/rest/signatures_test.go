@@ -0,0 +1,127 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// Signed with the key keccak256("cow"), as in the example of EIP-712
+const (
+	testSignerAddress = "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"
+	testPersonalSig   = "0x08f4f37e2d8f74e18c1b8fde2374d5f28402fb8ab7fd1cc5b786aa40851a70cb1d9761561a39554190cad60eecd319507488fc189cfd9dc1634cb0c87cd30a251b"
+	testTypedDataSig  = "0x5ad2703f5b4f4b9dea4c28fa30d86d3781d28e09dd51aae1208de80bb6155bee2922d299a8e24c66079e7b9cf8bca9d02543952617567ba14a619bb091c2ec1f1b"
+	testTypedData     = `{"types":{"Person":[{"name":"name","type":"string"},{"name":"wallet","type":"address"}],"Mail":[{"name":"from","type":"Person"},{"name":"to","type":"Person"},{"name":"contents","type":"string"}]},"primaryType":"Mail","domain":{"name":"Ether Mail","version":"1","chainId":1,"verifyingContract":"0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"},"message":{"from":{"name":"Cow","wallet":"0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},"to":{"name":"Bob","wallet":"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},"contents":"Hello, Bob!"}}`
+)
+
+func testVerifySignature(t *testing.T, body string) (int, *verifySignatureReply, string) {
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	req := httptest.NewRequest("POST", VerifySignaturePath, strings.NewReader(body))
+	res := httptest.NewRecorder()
+	g.verifySignatureHandler(res, req, nil)
+	var reply verifySignatureReply
+	if res.Code == 200 {
+		json.NewDecoder(res.Body).Decode(&reply)
+		return res.Code, &reply, ""
+	}
+	var restErr restError
+	json.NewDecoder(res.Body).Decode(&restErr)
+	return res.Code, nil, restErr.Message
+}
+
+func TestVerifySignaturePersonalMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	status, reply, _ := testVerifySignature(t, `{"message":"hello world","signature":"`+testPersonalSig+`","address":"`+strings.ToLower(testSignerAddress)+`"}`)
+	assert.Equal(200, status)
+	assert.Equal("personal_sign", reply.Type)
+	assert.Equal(testSignerAddress, reply.Signer)
+	assert.True(*reply.Valid)
+
+	// The same message supplied as hex data
+	status, reply, _ = testVerifySignature(t, `{"data":"0x68656c6c6f20776f726c64","signature":"`+testPersonalSig+`"}`)
+	assert.Equal(200, status)
+	assert.Equal(testSignerAddress, reply.Signer)
+	assert.Nil(reply.Valid)
+
+	status, reply, _ = testVerifySignature(t, `{"message":"hello world","signature":"`+testPersonalSig+`","address":"0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"}`)
+	assert.Equal(200, status)
+	assert.False(*reply.Valid)
+}
+
+func TestVerifySignatureTypedData(t *testing.T) {
+	assert := assert.New(t)
+
+	status, reply, _ := testVerifySignature(t, `{"typedData":`+testTypedData+`,"signature":"`+testTypedDataSig+`","address":"`+testSignerAddress+`"}`)
+	assert.Equal(200, status)
+	assert.Equal("eip712", reply.Type)
+	assert.Equal(testSignerAddress, reply.Signer)
+	assert.True(*reply.Valid)
+}
+
+func TestVerifySignatureUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	status, _, msg := testVerifySignature(t, `{"message":"hello world","signature":"`+testPersonalSig+`"}`)
+	assert.Equal(401, status)
+	assert.Equal("Unauthorized", msg)
+}
+
+func TestVerifySignatureBadRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	status, _, msg := testVerifySignature(t, `!json`)
+	assert.Equal(400, status)
+	assert.Regexp("Unable to parse signature verification request", msg)
+
+	status, _, msg = testVerifySignature(t, `{"signature":"`+testPersonalSig+`"}`)
+	assert.Equal(400, status)
+	assert.Equal("Exactly one of 'message', 'data' or 'typedData' must be supplied", msg)
+
+	status, _, msg = testVerifySignature(t, `{"message":"hello world","data":"0x00","signature":"`+testPersonalSig+`"}`)
+	assert.Equal(400, status)
+	assert.Equal("Exactly one of 'message', 'data' or 'typedData' must be supplied", msg)
+
+	status, _, msg = testVerifySignature(t, `{"data":"hello","signature":"`+testPersonalSig+`"}`)
+	assert.Equal(400, status)
+	assert.Equal("Data must be a 0x prefixed hex string", msg)
+
+	status, _, msg = testVerifySignature(t, `{"message":"hello world","signature":"nothex"}`)
+	assert.Equal(400, status)
+	assert.Equal("Signature must be a 0x prefixed hex string", msg)
+
+	status, _, msg = testVerifySignature(t, `{"message":"hello world","signature":"0x1234"}`)
+	assert.Equal(400, status)
+	assert.Regexp("Signature is 2 bytes", msg)
+
+	status, _, msg = testVerifySignature(t, `{"message":"hello world","signature":"`+testPersonalSig+`","address":"bob"}`)
+	assert.Equal(400, status)
+	assert.Equal("Invalid address 'bob'", msg)
+
+	status, _, msg = testVerifySignature(t, `{"typedData":{"types":{},"primaryType":"Mail"},"signature":"`+testTypedDataSig+`"}`)
+	assert.Equal(400, status)
+	assert.Equal("Type 'Mail' is not defined in the typed data", msg)
+}
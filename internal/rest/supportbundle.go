@@ -0,0 +1,219 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/events"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SupportBundlePath is the path to download a support bundle
+	SupportBundlePath = "/admin/support-bundle"
+)
+
+// sensitiveConfigKey returns true for the configuration fields that hold credentials, and for
+// the headers sent to other services, which frequently do
+func sensitiveConfigKey(key string) bool {
+	return utils.IsCredentialName(key) || strings.Contains(strings.ToLower(key), "headers")
+}
+
+// supportBundleStreams is the part of the subscription manager summarized in a support bundle
+type supportBundleStreams interface {
+	Streams(ctx context.Context) []*events.StreamInfo
+	Subscriptions(ctx context.Context) []*events.SubscriptionInfo
+}
+
+type supportStreamSummary struct {
+	ID            string `json:"id"`
+	Name          string `json:"name,omitempty"`
+	Type          string `json:"type,omitempty"`
+	Suspended     bool   `json:"suspended"`
+	ErrorHandling string `json:"errorHandling,omitempty"`
+	BatchSize     uint64 `json:"batchSize,omitempty"`
+	Subscriptions int    `json:"subscriptions"`
+}
+
+type supportSubscriptionSummary struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Stream    string `json:"stream"`
+	Event     string `json:"event,omitempty"`
+	FromBlock string `json:"fromBlock,omitempty"`
+}
+
+type supportInflightSummary struct {
+	Count     int            `json:"count"`
+	ByAddress map[string]int `json:"byAddress"`
+}
+
+// redactConfig returns a copy of a configuration structure as generic JSON, with credentials
+// replaced, and any password or credential query parameter masked in URLs
+func redactConfig(conf interface{}) interface{} {
+	b, _ := json.Marshal(conf)
+	var generic interface{}
+	json.Unmarshal(b, &generic)
+	return redactValue("", generic)
+}
+
+func redactValue(key string, v interface{}) interface{} {
+	switch tv := v.(type) {
+	case map[string]interface{}:
+		for k, child := range tv {
+			if sensitiveConfigKey(key) {
+				// Everything inside a sensitive field is redacted
+				tv[k] = redactValue(key, child)
+			} else {
+				tv[k] = redactValue(k, child)
+			}
+		}
+		return tv
+	case []interface{}:
+		for i, child := range tv {
+			tv[i] = redactValue(key, child)
+		}
+		return tv
+	case string:
+		if tv == "" {
+			return tv
+		}
+		if sensitiveConfigKey(key) {
+			return utils.RedactedValue
+		}
+		return utils.RedactText(tv)
+	default:
+		if v != nil && sensitiveConfigKey(key) {
+			return utils.RedactedValue
+		}
+		return v
+	}
+}
+
+// writeSupportBundle writes a zip archive of the diagnostic information for a support case
+func (g *RESTGateway) writeSupportBundle(ctx context.Context, out io.Writer, streams supportBundleStreams) error {
+	zw := zip.NewWriter(out)
+	add := func(name string, content interface{}) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if lines, ok := content.([]string); ok {
+			_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+			return err
+		}
+		b, _ := json.MarshalIndent(content, "", "  ")
+		_, err = w.Write(b)
+		return err
+	}
+
+	inflight := &supportInflightSummary{ByAddress: make(map[string]int)}
+	if g.processor != nil {
+		for from, txns := range g.processor.InFlightStatus() {
+			inflight.ByAddress[from] = len(txns)
+			inflight.Count += len(txns)
+		}
+	}
+
+	streamSummaries := []*supportStreamSummary{}
+	subSummaries := []*supportSubscriptionSummary{}
+	if streams != nil {
+		subsPerStream := make(map[string]int)
+		for _, sub := range streams.Subscriptions(ctx) {
+			summary := &supportSubscriptionSummary{
+				ID:        sub.ID,
+				Name:      sub.Name,
+				Stream:    sub.Stream,
+				FromBlock: sub.FromBlock,
+			}
+			if sub.Event != nil {
+				summary.Event = sub.Event.Name
+			}
+			subSummaries = append(subSummaries, summary)
+			subsPerStream[sub.Stream]++
+		}
+		for _, stream := range streams.Streams(ctx) {
+			streamSummaries = append(streamSummaries, &supportStreamSummary{
+				ID:            stream.ID,
+				Name:          stream.Name,
+				Type:          stream.Type,
+				Suspended:     stream.Suspended,
+				ErrorHandling: stream.ErrorHandling,
+				BatchSize:     stream.BatchSize,
+				Subscriptions: subsPerStream[stream.ID],
+			})
+		}
+	}
+
+	for _, file := range []struct {
+		name    string
+		content interface{}
+	}{
+		{"version.json", utils.GetBuildInfo()},
+		{"config.json", redactConfig(&g.conf)},
+		{"errors.log", utils.RecentLogs()},
+		{"streams.json", streamSummaries},
+		{"subscriptions.json", subSummaries},
+		{"inflight.json", inflight},
+	} {
+		if err := add(file.name, file.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func (g *RESTGateway) supportBundleHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if err := auth.AuthListAsyncReplies(req.Context()); err != nil {
+		log.Errorf("Error building support bundle: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	if err := auth.AuthEventStreams(req.Context()); err != nil {
+		log.Errorf("Error building support bundle: %s", err)
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+
+	var streams supportBundleStreams
+	if g.smartContractGW != nil {
+		if sm := g.smartContractGW.SubscriptionManager(); sm != nil {
+			streams = sm
+		}
+	}
+
+	filename := fmt.Sprintf("ethconnect-support-%s.zip", time.Now().UTC().Format("20060102T150405Z"))
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+	res.Header().Set("Content-Type", "application/zip")
+	res.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	res.WriteHeader(200)
+	if err := g.writeSupportBundle(req.Context(), res, streams); err != nil {
+		log.Errorf("Failed writing support bundle: %s", err)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PeerRepliesPath is the path a replica forwards the reply of a sync request to, when it
+	// consumed the reply from Kafka but the request is waiting on another replica
+	PeerRepliesPath = "/admin/peers/replies"
+
+	peerSecretHeader      = "X-Ethconnect-Peer-Secret"
+	peerForwardTimeout    = 10 * time.Second
+	peerForwardAttempts   = 5
+	peerForwardRetryDelay = 500 * time.Millisecond
+	defaultSyncTimeoutSec = 120
+
+	// syncPeerCtxKey is set in the ctx of the headers of a sync request, to the URL of the replica
+	// waiting for the reply. The ctx of a request is returned in the headers of its reply
+	syncPeerCtxKey = "ethconnectSyncPeer"
+)
+
+// SyncConf configures requests to the webhooks endpoints that wait for their reply, with fly-sync.
+// When replicas share a Kafka consumer group for replies, any one of them might consume the reply.
+// Self is the URL the peers reach this replica on, and Peers the URLs of the other replicas, so the
+// reply to a sync request is forwarded to the replica waiting for it rather than timing out
+type SyncConf struct {
+	TimeoutSec int      `json:"timeoutSec"`
+	Self       string   `json:"self,omitempty"`
+	Peers      []string `json:"peers,omitempty"`
+	PeerSecret string   `json:"peerSecret,omitempty"`
+}
+
+// syncReplies tracks the sync requests waiting for their reply, and forwards the replies of sync
+// requests waiting on a peer
+type syncReplies struct {
+	conf       *SyncConf
+	self       string
+	peers      map[string]bool
+	client     *http.Client
+	retryDelay time.Duration
+	mux        sync.Mutex
+	waiters    map[string]chan []byte
+}
+
+func newSyncReplies(conf *SyncConf) *syncReplies {
+	s := &syncReplies{
+		conf:       conf,
+		self:       normalizePeerURL(conf.Self),
+		peers:      make(map[string]bool),
+		client:     &http.Client{Timeout: peerForwardTimeout},
+		retryDelay: peerForwardRetryDelay,
+		waiters:    make(map[string]chan []byte),
+	}
+	for _, peer := range conf.Peers {
+		s.peers[normalizePeerURL(peer)] = true
+	}
+	return s
+}
+
+func normalizePeerURL(peerURL string) string {
+	return strings.TrimSuffix(strings.TrimSpace(peerURL), "/")
+}
+
+// isSyncRequest checks for fly-sync in the query, or x-firefly-sync in the headers, of a webhooks request
+func isSyncRequest(req *http.Request) bool {
+	if vs, exists := req.URL.Query()[utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")+"-sync"]; exists {
+		return vs[0] == "" || strings.ToLower(vs[0]) == "true"
+	}
+	return strings.ToLower(req.Header.Get("x-"+utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")+"-sync")) == "true"
+}
+
+func (s *syncReplies) timeout() time.Duration {
+	return time.Duration(s.conf.TimeoutSec) * time.Second
+}
+
+// register adds a waiter for the reply to a request, which must be removed once the request completes
+func (s *syncReplies) register(requestID string) chan []byte {
+	waiter := make(chan []byte, 1)
+	s.mux.Lock()
+	s.waiters[requestID] = waiter
+	s.mux.Unlock()
+	return waiter
+}
+
+func (s *syncReplies) remove(requestID string) {
+	s.mux.Lock()
+	delete(s.waiters, requestID)
+	s.mux.Unlock()
+}
+
+// deliver passes a reply to the sync request waiting for it on this replica, if there is one
+func (s *syncReplies) deliver(requestID string, reply []byte) bool {
+	s.mux.Lock()
+	waiter, exists := s.waiters[requestID]
+	delete(s.waiters, requestID)
+	s.mux.Unlock()
+	if exists {
+		waiter <- reply
+	}
+	return exists
+}
+
+// markRequest records this replica in the headers of a sync request, when it has peers that might
+// consume the reply
+func (s *syncReplies) markRequest(msg map[string]interface{}) {
+	if s.self == "" {
+		return
+	}
+	headers, ok := msg["headers"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	ctx, ok := headers["ctx"].(map[string]interface{})
+	if !ok {
+		ctx = make(map[string]interface{})
+		headers["ctx"] = ctx
+	}
+	ctx[syncPeerCtxKey] = s.self
+}
+
+// takeSyncPeer removes the replica waiting for a reply from its headers, so it is not stored or
+// returned to the client, and returns it
+func takeSyncPeer(headers map[string]interface{}) string {
+	ctx, ok := headers["ctx"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	peer, _ := ctx[syncPeerCtxKey].(string)
+	delete(ctx, syncPeerCtxKey)
+	if len(ctx) == 0 {
+		delete(headers, "ctx")
+	}
+	return peer
+}
+
+// processReply passes the final reply to a sync request to the waiter on this replica, or forwards
+// it to the peer it is waiting on. Only configured peers are forwarded to
+func (s *syncReplies) processReply(requestID, peer string, reply []byte) {
+	if s.deliver(requestID, reply) || peer == "" {
+		return
+	}
+	peer = normalizePeerURL(peer)
+	if peer == s.self {
+		log.Infof("Sync request %s is no longer waiting for its reply", requestID)
+		return
+	}
+	if !s.peers[peer] {
+		log.Warnf("Reply to sync request %s is for '%s', which is not a configured peer", requestID, peer)
+		return
+	}
+	go s.forward(peer, requestID, reply)
+}
+
+// forward posts a reply to the peer waiting for it. Only a 2xx means the peer delivered the reply.
+// A 4xx means it never will, such as when the request is no longer waiting, so is not retried.
+// Failures to reach the peer, and other errors from it, are retried with a backoff while the
+// request could still be waiting for its reply
+func (s *syncReplies) forward(peer, requestID string, reply []byte) {
+	deadline := time.Now().Add(s.timeout())
+	delay := s.retryDelay
+	for attempt := 1; ; attempt++ {
+		req, _ := http.NewRequest("POST", peer+PeerRepliesPath, bytes.NewReader(reply))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(peerSecretHeader, s.conf.PeerSecret)
+		res, err := s.client.Do(req)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode >= 200 && res.StatusCode < 300 {
+				log.Infof("Forwarded reply to sync request %s to peer %s [%d]", requestID, peer, res.StatusCode)
+				return
+			}
+			if res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != 429 {
+				log.Errorf("Peer %s rejected reply to sync request %s [%d]", peer, requestID, res.StatusCode)
+				return
+			}
+			log.Warnf("Peer %s failed to accept reply to sync request %s [%d]", peer, requestID, res.StatusCode)
+		} else {
+			log.Warnf("Failed to forward reply to sync request %s to peer %s: %s", requestID, peer, err)
+		}
+		if attempt >= peerForwardAttempts || time.Now().Add(delay).After(deadline) {
+			log.Errorf("Gave up forwarding reply to sync request %s to peer %s after %d attempts", requestID, peer, attempt)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// peerReplyHandler receives the reply to a sync request waiting on this replica, from the peer that
+// consumed it
+func (s *syncReplies) peerReplyHandler(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+
+	if s.conf.PeerSecret == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get(peerSecretHeader)), []byte(s.conf.PeerSecret)) != 1 {
+		sendRESTError(res, req, errors.Errorf(errors.Unauthorized), 401)
+		return
+	}
+	var reply struct {
+		Headers struct {
+			ReqID string `json:"requestId"`
+		} `json:"headers"`
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &reply)
+	}
+	if err != nil {
+		sendRESTError(res, req, errors.Errorf(errors.WebhooksPeerBadReply, err), 400)
+		return
+	}
+	if !s.deliver(reply.Headers.ReqID, body) {
+		sendRESTError(res, req, errors.Errorf(errors.WebhooksPeerNoWaiter, reply.Headers.ReqID), 404)
+		return
+	}
+
+	status := 204
+	log.Infof("<-- %s %s [%d]", req.Method, req.URL, status)
+	res.WriteHeader(status)
+}
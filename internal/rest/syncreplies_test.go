@@ -0,0 +1,325 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSyncReply(requestID, msgType string) []byte {
+	return []byte(`{"headers":{"requestId":"` + requestID + `","type":"` + msgType + `"}}`)
+}
+
+func TestSyncRepliesDeliver(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSyncReplies(&SyncConf{})
+	waiter := s.register("req1")
+	assert.False(s.deliver("req2", []byte("{}")))
+	assert.True(s.deliver("req1", []byte("{}")))
+	assert.Equal("{}", string(<-waiter))
+	assert.False(s.deliver("req1", []byte("{}")))
+}
+
+func TestTakeSyncPeer(t *testing.T) {
+	assert := assert.New(t)
+
+	headers := map[string]interface{}{
+		"ctx": map[string]interface{}{syncPeerCtxKey: "http://peer1"},
+	}
+	assert.Equal("http://peer1", takeSyncPeer(headers))
+	assert.NotContains(headers, "ctx")
+
+	headers = map[string]interface{}{
+		"ctx": map[string]interface{}{syncPeerCtxKey: "http://peer1", "app": "data"},
+	}
+	assert.Equal("http://peer1", takeSyncPeer(headers))
+	assert.Equal(map[string]interface{}{"app": "data"}, headers["ctx"])
+
+	assert.Equal("", takeSyncPeer(map[string]interface{}{}))
+}
+
+func TestSyncRepliesMarkRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := map[string]interface{}{"headers": map[string]interface{}{}}
+	newSyncReplies(&SyncConf{}).markRequest(msg)
+	assert.NotContains(msg["headers"], "ctx")
+
+	newSyncReplies(&SyncConf{Self: "http://self/"}).markRequest(msg)
+	assert.Equal("http://self", takeSyncPeer(msg["headers"].(map[string]interface{})))
+
+	msg = map[string]interface{}{}
+	newSyncReplies(&SyncConf{Self: "http://self"}).markRequest(msg)
+	assert.NotContains(msg, "headers")
+}
+
+func TestSyncRepliesForwardToPeer(t *testing.T) {
+	assert := assert.New(t)
+
+	peer := newSyncReplies(&SyncConf{Self: "http://peer", PeerSecret: "s3cret"})
+	waiter := peer.register("req1")
+	router := &httprouter.Router{}
+	router.POST(PeerRepliesPath, peer.peerReplyHandler)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	s := newSyncReplies(&SyncConf{Self: "http://self", Peers: []string{ts.URL + "/"}, PeerSecret: "s3cret"})
+	s.processReply("req1", ts.URL, testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+
+	select {
+	case reply := <-waiter:
+		assert.Equal(string(testSyncReply("req1", messages.MsgTypeTransactionSuccess)), string(reply))
+	case <-time.After(5 * time.Second):
+		assert.Fail("reply not forwarded")
+	}
+}
+
+func TestSyncRepliesForwardToPeerWithSecurityModule(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	var printYAML = false
+	g := NewRESTGateway(&printYAML)
+	peer := newSyncReplies(&SyncConf{Self: "http://peer", PeerSecret: "s3cret"})
+	waiter := peer.register("req1")
+	router := &httprouter.Router{}
+	router.POST(PeerRepliesPath, peer.peerReplyHandler)
+	router.GET("/status", func(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {})
+	ts := httptest.NewServer(g.newAccessTokenContextHandler(router))
+	defer ts.Close()
+
+	// The forwarded reply has no access token, as it is authenticated by the peer secret
+	s := newSyncReplies(&SyncConf{Self: "http://self", Peers: []string{ts.URL}, PeerSecret: "s3cret"})
+	s.forward(ts.URL, "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	select {
+	case reply := <-waiter:
+		assert.Equal(string(testSyncReply("req1", messages.MsgTypeTransactionSuccess)), string(reply))
+	default:
+		assert.Fail("reply not forwarded")
+	}
+
+	// Other routes still require an access token
+	res, err := http.Get(ts.URL + "/status")
+	assert.NoError(err)
+	res.Body.Close()
+	assert.Equal(401, res.StatusCode)
+}
+
+func TestSyncRepliesNotForwardedToUnknownPeer(t *testing.T) {
+	forwarded := false
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		forwarded = true
+	}))
+	defer ts.Close()
+
+	s := newSyncReplies(&SyncConf{Self: "http://self", PeerSecret: "s3cret"})
+	s.processReply("req1", ts.URL, testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	s.processReply("req1", "http://self", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	s.processReply("req1", "", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	assert.False(t, forwarded)
+}
+
+func TestSyncRepliesForwardFails(t *testing.T) {
+	s := newSyncReplies(&SyncConf{Self: "http://self", PeerSecret: "s3cret"})
+	s.forward("http://localhost:0", "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+}
+
+func TestSyncRepliesForwardRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	attempts, failures, status := 0, 2, 204
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		attempts++
+		if attempts <= failures {
+			res.WriteHeader(503)
+			return
+		}
+		res.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	s := newSyncReplies(&SyncConf{Self: "http://self", PeerSecret: "s3cret", TimeoutSec: 1})
+	s.retryDelay = 1 * time.Millisecond
+	s.forward(ts.URL, "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	assert.Equal(3, attempts)
+
+	// The peer is no longer waiting, so there is no retry
+	attempts, failures, status = 0, 0, 404
+	s.forward(ts.URL, "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	assert.Equal(1, attempts)
+
+	// Any other 4xx is not retried either, and a 3xx is not a delivery
+	attempts, status = 0, 401
+	s.forward(ts.URL, "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	assert.Equal(1, attempts)
+	attempts, status = 0, 304
+	s.forward(ts.URL, "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	assert.Equal(peerForwardAttempts, attempts)
+
+	// Retries stop after the maximum attempts
+	attempts, failures = 0, peerForwardAttempts+1
+	s.forward(ts.URL, "req1", testSyncReply("req1", messages.MsgTypeTransactionSuccess))
+	assert.Equal(peerForwardAttempts, attempts)
+}
+
+func TestPeerReplyHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSyncReplies(&SyncConf{Self: "http://self", PeerSecret: "s3cret"})
+	router := &httprouter.Router{}
+	router.POST(PeerRepliesPath, s.peerReplyHandler)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(secret, body string) int {
+		req, _ := http.NewRequest("POST", ts.URL+PeerRepliesPath, strings.NewReader(body))
+		req.Header.Set(peerSecretHeader, secret)
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	waiter := s.register("req1")
+	assert.Equal(401, post("wrong", string(testSyncReply("req1", messages.MsgTypeTransactionSuccess))))
+	assert.Equal(400, post("s3cret", "!json"))
+	assert.Equal(404, post("s3cret", string(testSyncReply("req2", messages.MsgTypeTransactionSuccess))))
+	assert.Equal(204, post("s3cret", string(testSyncReply("req1", messages.MsgTypeTransactionSuccess))))
+	assert.Equal(string(testSyncReply("req1", messages.MsgTypeTransactionSuccess)), string(<-waiter))
+
+	// No reply is accepted without a secret
+	s.conf.PeerSecret = ""
+	s.register("req3")
+	assert.Equal(401, post("", string(testSyncReply("req3", messages.MsgTypeTransactionSuccess))))
+}
+
+func TestReplyProcessorDeliversSyncReply(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newReceiptsTestStore(nil)
+	r.syncReplies = newSyncReplies(&SyncConf{Self: "http://self", PeerSecret: "s3cret"})
+	waiter := r.syncReplies.register("req1")
+
+	r.processReply([]byte(`{"headers":{"requestId":"req1","type":"TransactionProgress","ctx":{"ethconnectSyncPeer":"http://self"}}}`))
+	assert.Equal(0, len(waiter))
+	r.processReply([]byte(`{"headers":{"requestId":"req1","type":"TransactionSuccess","ctx":{"ethconnectSyncPeer":"http://self"}}}`))
+
+	var reply map[string]interface{}
+	json.Unmarshal(<-waiter, &reply)
+	assert.Equal(map[string]interface{}{"requestId": "req1", "type": "TransactionSuccess"}, reply["headers"])
+	front := *p.receipts.Front().Value.(*map[string]interface{})
+	assert.NotContains(front["headers"], "ctx")
+}
+
+type syncMockHandler struct {
+	mockHandler
+	replies *syncReplies
+	reply   string
+	ack     bool
+}
+
+func (m *syncMockHandler) sendWebhookMsg(ctx context.Context, key, msgID string, msg map[string]interface{}, ack bool) (msgAck string, statusCode int, err error) {
+	m.ack = ack
+	if m.reply != "" {
+		m.replies.processReply(msgID, takeSyncPeer(msg["headers"].(map[string]interface{})), testSyncReply(msgID, m.reply))
+	}
+	return "", 200, nil
+}
+
+func testSyncWebhook(replyType string, timeoutSec int) *http.Response {
+	res, _ := testSyncWebhookAck(replyType, timeoutSec, true)
+	return res
+}
+
+func testSyncWebhookAck(replyType string, timeoutSec int, ack bool) (*http.Response, *syncMockHandler) {
+	s := newSyncReplies(&SyncConf{TimeoutSec: timeoutSec})
+	handler := &syncMockHandler{replies: s, reply: replyType}
+	w := &webhooks{
+		handler:     handler,
+		syncReplies: s,
+	}
+	msgBytes, _ := json.Marshal(map[string]interface{}{
+		"headers": map[string]interface{}{"type": messages.MsgTypeSendTransaction},
+		"from":    "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
+	})
+	req, _ := http.NewRequest("POST", "/?fly-sync", bytes.NewReader(msgBytes))
+	rec := httptest.NewRecorder()
+	w.webhookHandler(rec, req, ack)
+	return rec.Result(), handler
+}
+
+func TestWebhookSyncSuccess(t *testing.T) {
+	assert := assert.New(t)
+
+	res := testSyncWebhook(messages.MsgTypeTransactionSuccess, 1)
+	assert.Equal(200, res.StatusCode)
+	var reply messages.TransactionReceipt
+	body, _ := ioutil.ReadAll(res.Body)
+	json.Unmarshal(body, &reply)
+	assert.Equal(messages.MsgTypeTransactionSuccess, reply.Headers.MsgType)
+	assert.NotEmpty(reply.Headers.ReqID)
+}
+
+func TestWebhookSyncHonoursAck(t *testing.T) {
+	assert := assert.New(t)
+
+	res, handler := testSyncWebhookAck(messages.MsgTypeTransactionSuccess, 1, false)
+	assert.Equal(200, res.StatusCode)
+	assert.False(handler.ack)
+
+	res, handler = testSyncWebhookAck(messages.MsgTypeTransactionSuccess, 1, true)
+	assert.Equal(200, res.StatusCode)
+	assert.True(handler.ack)
+}
+
+func TestWebhookSyncErrorReply(t *testing.T) {
+	res := testSyncWebhook(messages.MsgTypeError, 1)
+	assert.Equal(t, 500, res.StatusCode)
+}
+
+func TestWebhookSyncTimeout(t *testing.T) {
+	res := testSyncWebhook("", 1)
+	assert.Equal(t, 504, res.StatusCode)
+}
+
+func TestIsSyncRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	req, _ := http.NewRequest("POST", "/?fly-sync=false", nil)
+	assert.False(isSyncRequest(req))
+	req, _ = http.NewRequest("POST", "/?fly-sync=true", nil)
+	assert.True(isSyncRequest(req))
+	req, _ = http.NewRequest("POST", "/", nil)
+	assert.False(isSyncRequest(req))
+	req.Header.Set("x-firefly-sync", "true")
+	assert.True(isSyncRequest(req))
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"reflect"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/kaleido-io/ethconnect/internal/contracts"
@@ -38,6 +39,7 @@ type webhooksHandler interface {
 type webhooks struct {
 	smartContractGW contracts.SmartContractGateway
 	handler         webhooksHandler
+	syncReplies     *syncReplies // set when sync requests can wait for their reply
 }
 
 func newWebhooks(handler webhooksHandler, smartContractGW contracts.SmartContractGateway) *webhooks {
@@ -94,7 +96,12 @@ func (w *webhooks) webhookHandler(res http.ResponseWriter, req *http.Request, ac
 		return
 	}
 
-	reply, statusCode, err := w.processMsg(req.Context(), msg, ack)
+	if w.syncReplies != nil && isSyncRequest(req) {
+		w.webhookSyncHandler(res, req, msg, ack)
+		return
+	}
+
+	reply, statusCode, err := w.processMsg(req.Context(), msg, "", ack)
 	if err != nil {
 		w.hookErrReply(res, req, err, statusCode)
 		return
@@ -102,7 +109,45 @@ func (w *webhooks) webhookHandler(res http.ResponseWriter, req *http.Request, ac
 	w.msgSentReply(res, req, reply)
 }
 
-func (w *webhooks) processMsg(ctx context.Context, msg map[string]interface{}, ack bool) (*messages.AsyncSentMsg, int, error) {
+// webhookSyncHandler sends a message, then waits for the reply and returns it in the response.
+// Replies of type Error are returned with a 500 status
+func (w *webhooks) webhookSyncHandler(res http.ResponseWriter, req *http.Request, msg map[string]interface{}, ack bool) {
+	msgID := utils.UUIDv4()
+	waiter := w.syncReplies.register(msgID)
+	defer w.syncReplies.remove(msgID)
+	w.syncReplies.markRequest(msg)
+
+	if _, statusCode, err := w.processMsg(req.Context(), msg, msgID, ack); err != nil {
+		w.hookErrReply(res, req, err, statusCode)
+		return
+	}
+
+	var reply []byte
+	select {
+	case reply = <-waiter:
+	case <-time.After(w.syncReplies.timeout()):
+		w.hookErrReply(res, req, errors.Errorf(errors.WebhooksSyncTimeout, msgID), 504)
+		return
+	case <-req.Context().Done():
+		w.hookErrReply(res, req, errors.Errorf(errors.WebhooksSyncTimeout, msgID), 504)
+		return
+	}
+
+	var replyHeaders struct {
+		Headers messages.ReplyHeaders `json:"headers"`
+	}
+	json.Unmarshal(reply, &replyHeaders)
+	status := 200
+	if replyHeaders.Headers.MsgType == messages.MsgTypeError {
+		status = 500
+	}
+	log.Infof("<-- %s %s [%d]: Webhook RequestID=%s", req.Method, req.URL, status, msgID)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(reply)
+}
+
+func (w *webhooks) processMsg(ctx context.Context, msg map[string]interface{}, msgID string, ack bool) (*messages.AsyncSentMsg, int, error) {
 	// Check we understand the type, and can get the key.
 	// The rest of the validation is performed by the bridge listening to Kafka
 	headers, exists := msg["headers"]
@@ -122,12 +167,22 @@ func (w *webhooks) processMsg(ctx context.Context, msg map[string]interface{}, a
 		}
 		key = from.(string)
 		break
+	case messages.MsgTypeRPCCall:
+		method, exists := msg["method"]
+		if !exists || reflect.TypeOf(method).Kind() != reflect.String {
+			return nil, 400, errors.Errorf(errors.WebhooksInvalidMsgMethodMissing)
+		}
+		key = method.(string)
+		break
 	default:
 		return nil, 400, errors.Errorf(errors.WebhooksInvalidMsgType, msgType)
 	}
 
-	// We always generate the ID. It cannot be set by the user
-	msgID := utils.UUIDv4()
+	// We generate the ID, unless the REST gateway passed one supplied by the client with fly-id.
+	// It cannot be set in the headers of a webhook payload
+	if msgID == "" {
+		msgID = utils.UUIDv4()
+	}
 	headers.(map[string]interface{})["id"] = msgID
 
 	if w.smartContractGW != nil && msgType == messages.MsgTypeDeployContract {
@@ -136,6 +191,11 @@ func (w *webhooks) processMsg(ctx context.Context, msg map[string]interface{}, a
 			return nil, 500, err
 		}
 	}
+	if w.smartContractGW != nil && msgType == messages.MsgTypeSendTransaction {
+		if err := w.checkMethod(msg); err != nil {
+			return nil, 403, err
+		}
+	}
 
 	// Pass to the handler
 	log.Infof("Webhook accepted message. MsgID: %s Type: %s", msgID, msgType)
@@ -155,7 +215,7 @@ func (w *webhooks) contractGWHandler(msg map[string]interface{}) (map[string]int
 	// where we are performing OpenAPI gateway processing
 	msgBytes, _ := json.Marshal(&msg)
 	var deployMsg messages.DeployContract
-	if err := json.Unmarshal(msgBytes, &deployMsg); err != nil {
+	if err := utils.UnmarshalJSONNumbers(msgBytes, &deployMsg); err != nil {
 		return nil, err
 	}
 
@@ -167,10 +227,21 @@ func (w *webhooks) contractGWHandler(msg map[string]interface{}) (map[string]int
 	// Now send the message back to a generic map
 	msgBytes, _ = json.Marshal(&deployMsg)
 	var newMsg map[string]interface{}
-	json.Unmarshal(msgBytes, &newMsg)
+	utils.UnmarshalJSONNumbers(msgBytes, &newMsg)
 	return newMsg, nil
 }
 
+// checkMethod applies the method lists of the contract a SendTransaction is sent to, before
+// it is dispatched to a bridge that might not have access to them
+func (w *webhooks) checkMethod(msg map[string]interface{}) error {
+	msgBytes, _ := json.Marshal(&msg)
+	var sendMsg messages.SendTransaction
+	if err := utils.UnmarshalJSONNumbers(msgBytes, &sendMsg); err != nil {
+		return nil // invalid messages are rejected by the bridge
+	}
+	return w.smartContractGW.CheckSendTransaction(&sendMsg)
+}
+
 func (w *webhooks) run() error {
 	return w.handler.run()
 }
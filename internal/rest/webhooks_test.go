@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/events"
 	"github.com/kaleido-io/ethconnect/internal/messages"
 	"github.com/stretchr/testify/assert"
 )
@@ -35,10 +36,11 @@ func (r *popReader) Read(b []byte) (n int, err error) {
 }
 
 type mockContractGW struct {
-	preDeployErr  error
-	postDeployErr error
-	testValue     interface{}
-	replyCallback func(message interface{})
+	preDeployErr   error
+	postDeployErr  error
+	checkMethodErr error
+	testValue      interface{}
+	replyCallback  func(message interface{})
 }
 
 func (m *mockContractGW) PreDeploy(*messages.DeployContract) error { return m.preDeployErr }
@@ -47,12 +49,22 @@ func (m *mockContractGW) PostDeploy(*messages.TransactionReceipt) error { return
 
 func (m *mockContractGW) AddRoutes(*httprouter.Router) {}
 
+func (m *mockContractGW) WithHierarchicalNames(parent http.Handler) http.Handler { return parent }
+
 func (m *mockContractGW) SendReply(message interface{}) {
 	if m.replyCallback != nil {
 		m.replyCallback(message)
 	}
 }
 
+func (m *mockContractGW) SubscriptionManager() events.SubscriptionManager { return nil }
+
+func (m *mockContractGW) CheckMethod(to string, data []byte) error { return m.checkMethodErr }
+
+func (m *mockContractGW) CheckSendTransaction(msg *messages.SendTransaction) error {
+	return m.checkMethodErr
+}
+
 func (m *mockContractGW) Shutdown() {}
 
 type mockHandler struct{}
@@ -131,6 +143,35 @@ func TestWebhookHandlerContractGWFail(t *testing.T) {
 	assert.Equal(500, rec.Result().StatusCode)
 }
 
+func TestWebhookHandlerSendTransactionMethodNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	sendMsg := messages.SendTransaction{
+		TransactionCommon: messages.TransactionCommon{
+			RequestCommon: messages.RequestCommon{
+				Headers: messages.RequestHeaders{
+					CommonHeaders: messages.CommonHeaders{
+						MsgType: messages.MsgTypeSendTransaction,
+					},
+				},
+			},
+		},
+		To:   "0x0123456789abcdef0123456789abcdef01234567",
+		Data: "0x41c0e1b5",
+	}
+	sendMsgBytes, _ := json.Marshal(&sendMsg)
+	req, _ := http.NewRequest("POST", "/any", bytes.NewReader(sendMsgBytes))
+	w := &webhooks{
+		smartContractGW: &mockContractGW{
+			checkMethodErr: fmt.Errorf("pop"),
+		},
+		handler: &mockHandler{},
+	}
+	rec := httptest.NewRecorder()
+	w.webhookHandler(rec, req, false)
+	assert.Equal(403, rec.Result().StatusCode)
+}
+
 func TestContractGWHandlerUnmarshalFail(t *testing.T) {
 	assert := assert.New(t)
 
@@ -18,6 +18,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
@@ -29,6 +30,10 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	recoverInFlightPageSize = 100
+)
+
 // WebhooksDirectConf defines the YAML structore for a Webhooks direct to RPC bridge
 type WebhooksDirectConf struct {
 	MaxInFlight int `json:"maxInFlight"`
@@ -80,7 +85,7 @@ func (t *msgContext) Unmarshal(msg interface{}) error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(msgBytes, msg)
+	return utils.UnmarshalJSONNumbers(msgBytes, msg)
 }
 
 func (t *msgContext) SendErrorReply(status int, err error) {
@@ -103,16 +108,31 @@ func (t *msgContext) Reply(replyMessage messages.ReplyWithHeaders) {
 	t.w.inFlightMutex.Lock()
 	defer t.w.inFlightMutex.Unlock()
 
+	t.processReply(replyMessage)
+	delete(t.w.inFlight, t.msgID)
+}
+
+// ReplyProgress sends a progress message to the receipt store, leaving the request in-flight
+func (t *msgContext) ReplyProgress(progressMessage messages.ReplyWithHeaders) {
+	t.processReply(progressMessage)
+}
+
+func (t *msgContext) processReply(replyMessage messages.ReplyWithHeaders) {
 	replyHeaders := replyMessage.ReplyHeaders()
 	replyHeaders.ID = utils.UUIDv4()
 	replyHeaders.Context = t.headers.Context
 	replyHeaders.ReqID = t.headers.ID
+	replyHeaders.SchemaVersion = messages.ReplySchemaVersion
 	replyHeaders.Received = t.timeReceived.UTC().Format(time.RFC3339Nano)
 	replyTime := time.Now().UTC()
 	replyHeaders.Elapsed = replyTime.Sub(t.timeReceived).Seconds()
 	msgBytes, _ := json.Marshal(&replyMessage)
 	t.w.receipts.processReply(msgBytes)
-	delete(t.w.inFlight, t.msgID)
+}
+
+// ReplyConfirmed sends a follow-up reply to the receipt store, after the original reply
+func (t *msgContext) ReplyConfirmed(replyMessage messages.ReplyWithHeaders) {
+	t.Reply(replyMessage)
 }
 
 func (t *msgContext) String() string {
@@ -173,7 +193,76 @@ func validateWebhooksDirectConf(conf *WebhooksDirectConf) error {
 	return nil
 }
 
+// recoverInFlight resumes polling for the receipts of transactions that were submitted, but
+// not mined, when the gateway last stopped. These have the progress message recorded when
+// they were submitted stored in place of a receipt
+func (w *webhooksDirect) recoverInFlight() {
+	if !w.conf.RecoverInFlight || w.receipts == nil || w.receipts.persistence == nil {
+		return
+	}
+	window := w.conf.RecoverWindowSec
+	if window <= 0 {
+		window = tx.DefaultRecoverInFlightWindowSec
+	}
+	sinceEpochMS := time.Now().Add(-time.Duration(window)*time.Second).UnixNano() / int64(time.Millisecond)
+	resumed := 0
+	// Records are returned newest first, so paging stops at the first one before the window
+	for skip, done := 0, false; !done; skip += recoverInFlightPageSize {
+		page, err := w.receipts.persistence.GetReceipts(skip, recoverInFlightPageSize, nil, 0, "", "")
+		if err != nil {
+			log.Errorf("Failed to query the receipt store for in-flight transactions: %s", err)
+			return
+		}
+		done = len(*page) < recoverInFlightPageSize
+		for _, record := range *page {
+			if receivedAtMS(record) < sinceEpochMS {
+				done = true
+				break
+			}
+			if w.resumeInFlight(record) {
+				resumed++
+			}
+		}
+	}
+	log.Infof("Resumed polling for the receipts of %d in-flight transactions", resumed)
+}
+
+// resumeInFlight resumes polling for the receipt of a stored record, if it is the progress
+// of a transaction that has been submitted
+func (w *webhooksDirect) resumeInFlight(record map[string]interface{}) bool {
+	replyHeaders := w.receipts.extractHeaders(record)
+	if utils.GetMapString(replyHeaders, "type") != messages.MsgTypeTransactionProgress {
+		return false
+	}
+	requestID := utils.GetMapString(replyHeaders, "requestId")
+	txHash := utils.GetMapString(record, "transactionHash")
+	if requestID == "" || txHash == "" {
+		return false
+	}
+	headers := &messages.CommonHeaders{ID: requestID}
+	if ctx, ok := replyHeaders["ctx"].(map[string]interface{}); ok {
+		headers.Context = ctx
+	}
+	timeReceived, err := time.Parse(time.RFC3339Nano, utils.GetMapString(replyHeaders, "timeReceived"))
+	if err != nil {
+		timeReceived = time.Now().UTC()
+	}
+	nonce, _ := strconv.ParseInt(utils.GetMapString(record, "nonce"), 10, 64)
+	msgContext := &msgContext{
+		ctx:          context.Background(),
+		w:            w,
+		timeReceived: timeReceived,
+		msgID:        requestID,
+		msg:          map[string]interface{}{"headers": headers},
+		headers:      headers,
+	}
+	log.Infof("Resuming polling for receipt of %s: %s", requestID, txHash)
+	w.processor.ResumeTransaction(msgContext, txHash, nonce)
+	return true
+}
+
 func (w *webhooksDirect) run() error {
+	w.recoverInFlight()
 	w.initialized = true
 	return <-w.stopChan
 }
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/kaleido-io/ethconnect/internal/eth"
@@ -33,14 +34,39 @@ import (
 )
 
 type mockProcessor struct {
-	capturedCtx *msgContext
+	capturedCtx    *msgContext
+	inflightStatus map[string][]*tx.InFlightTxnStatus
+	resumed        []*resumedTxn
+	nonceReports   []*tx.NonceReport
+	nonceErr       error
+	nonceAddrs     []string
+}
+
+type resumedTxn struct {
+	ctx    *msgContext
+	txHash string
+	nonce  int64
 }
 
 func (p *mockProcessor) ResolveAddress(from string) (string, error) { return "", nil }
+func (p *mockProcessor) InFlightStatus() map[string][]*tx.InFlightTxnStatus {
+	return p.inflightStatus
+}
+func (p *mockProcessor) NonceReport(ctx context.Context, addresses []string) ([]*tx.NonceReport, error) {
+	p.nonceAddrs = addresses
+	return p.nonceReports, p.nonceErr
+}
 func (p *mockProcessor) OnMessage(ctx tx.TxnContext) {
 	p.capturedCtx = ctx.(*msgContext)
 }
 func (p *mockProcessor) Init(eth.RPCClient) {}
+func (p *mockProcessor) ResumeTransaction(ctx tx.TxnContext, txHash string, nonce int64) {
+	p.resumed = append(p.resumed, &resumedTxn{ctx.(*msgContext), txHash, nonce})
+}
+func (p *mockProcessor) SetAddressNameResolver(resolver tx.AddressNameResolver) {}
+func (p *mockProcessor) SetMethodChecker(checker tx.MethodChecker)              {}
+func (p *mockProcessor) SetSignerPolicy(policy tx.SignerPolicy)                 {}
+func (p *mockProcessor) Close()                                                 {}
 
 func newTestWebhooksDirect(maxMsgs int) (*webhooksDirect, *memoryReceipts, *mockProcessor) {
 	rsc := &ReceiptStoreConf{}
@@ -154,6 +180,28 @@ func TestWebhooksDirectMsgLimit(t *testing.T) {
 
 }
 
+func TestWebhooksDirectProgressLeavesInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	wd, ts, r, p := newTestWebhooksDirectServer(1)
+	defer ts.Close()
+
+	msg := newTestMsg()
+	msgBytes, _ := json.Marshal(&msg)
+	resp, err := http.Post(fmt.Sprintf("%s/hook", ts.URL), "application/json", bytes.NewReader(msgBytes))
+	assert.NoError(err)
+	assert.Equal(200, resp.StatusCode)
+
+	p.capturedCtx.ReplyProgress(messages.NewTransactionProgress(messages.ProgressStageSubmitted))
+	assert.Len(wd.inFlight, 1)
+	stored, _ := r.GetReceipt(p.capturedCtx.msgID)
+	assert.Equal(messages.ProgressStageSubmitted, (*stored)["stage"])
+
+	p.capturedCtx.SendErrorReply(500, fmt.Errorf("pop"))
+	assert.Empty(wd.inFlight)
+	assert.Equal(1, r.receipts.Len())
+}
+
 func TestWebhooksDirectSendWebhooksMsgBadHeaders(t *testing.T) {
 	assert := assert.New(t)
 	wd, _, _ := newTestWebhooksDirect(1)
@@ -172,3 +220,66 @@ func TestWebhooksDirectUnmarshalBadMsg(t *testing.T) {
 	err := ctx.Unmarshal(nil)
 	assert.EqualError(err, "json: unsupported type: map[bool]string")
 }
+
+func addTestProgressRecord(wd *webhooksDirect, requestID, txHash, nonce string) {
+	record := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"type":         messages.MsgTypeTransactionProgress,
+			"requestId":    requestID,
+			"timeReceived": "2021-05-01T00:00:00Z",
+			"ctx":          map[string]interface{}{"some": "context"},
+		},
+		"stage": messages.ProgressStageSubmitted,
+		"nonce": nonce,
+	}
+	if txHash != "" {
+		record["transactionHash"] = txHash
+	}
+	recordBytes, _ := json.Marshal(&record)
+	wd.receipts.processReply(recordBytes)
+}
+
+func TestWebhooksDirectRecoverInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	wd, r, p := newTestWebhooksDirect(10)
+	wd.conf.RecoverInFlight = true
+
+	// Outside the recovery window
+	r.AddReceipt("old", &map[string]interface{}{
+		"_id":             "old",
+		"headers":         map[string]interface{}{"type": messages.MsgTypeTransactionProgress, "requestId": "old"},
+		"transactionHash": "0xold",
+		"receivedAt":      time.Now().Add(-48*time.Hour).UnixNano() / int64(time.Millisecond),
+	})
+	addTestProgressRecord(wd, "pending", "0xe2215336b09f9b5b82e36e1144ed64f40a42e61b68fdaca82549fd98b8531a89", "5")
+	addTestProgressRecord(wd, "nohash", "", "")
+	addTestFeeReceipt(wd.receipts, messages.MsgTypeTransactionSuccess, "0xaaaa", "0xcccc", "", "1000", "20000")
+
+	wd.recoverInFlight()
+	assert.Len(p.resumed, 1)
+	resumed := p.resumed[0]
+	assert.Equal("0xe2215336b09f9b5b82e36e1144ed64f40a42e61b68fdaca82549fd98b8531a89", resumed.txHash)
+	assert.Equal(int64(5), resumed.nonce)
+	assert.Equal("pending", resumed.ctx.Headers().ID)
+	assert.Equal("context", resumed.ctx.Headers().Context["some"])
+	assert.Equal(2021, resumed.ctx.timeReceived.Year())
+
+	resumed.ctx.Reply(&messages.TransactionReceipt{
+		ReplyCommon: messages.ReplyCommon{
+			Headers: messages.ReplyHeaders{
+				CommonHeaders: messages.CommonHeaders{MsgType: messages.MsgTypeTransactionSuccess},
+			},
+		},
+	})
+	stored, _ := r.GetReceipt("pending")
+	assert.Equal(messages.MsgTypeTransactionSuccess, (*stored)["headers"].(map[string]interface{})["type"])
+	assert.Equal(float64(messages.ReplySchemaVersion), (*stored)["headers"].(map[string]interface{})["schemaVersion"])
+}
+
+func TestWebhooksDirectRecoverInFlightDisabled(t *testing.T) {
+	wd, _, p := newTestWebhooksDirect(10)
+	addTestProgressRecord(wd, "pending", "0x12345", "5")
+	wd.recoverInFlight()
+	assert.Empty(t, p.resumed)
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/kaleido-io/ethconnect/internal/auth"
@@ -28,6 +29,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// kafkaQueuedAck is returned in place of the Kafka offset for a message that has been queued
+const kafkaQueuedAck = "queued"
+
 // webhooksKafka provides the HTTP -> Kafka bridge functionality for ethconnect
 type webhooksKafka struct {
 	kafka       kafka.KafkaCommon
@@ -37,23 +41,37 @@ type webhooksKafka struct {
 	successMsgs map[string]*sarama.ProducerMessage
 	failedMsgs  map[string]error
 	finished    bool
+	queue       *kafkaQueue
+	queueConf   *KafkaQueueConf
+	// With a queue, one message for each key is in flight at a time, and the keys of the
+	// messages sent without waiting for the result are released by the producer loops
+	keysInFlight map[string]bool
+	noAckKeys    map[string]string
 }
 
 func newWebhooksKafkaBase(receipts *receiptStore) *webhooksKafka {
 	return &webhooksKafka{
-		receipts:    receipts,
-		sendCond:    sync.NewCond(&sync.Mutex{}),
-		pendingMsgs: make(map[string]bool),
-		successMsgs: make(map[string]*sarama.ProducerMessage),
-		failedMsgs:  make(map[string]error),
+		receipts:     receipts,
+		sendCond:     sync.NewCond(&sync.Mutex{}),
+		pendingMsgs:  make(map[string]bool),
+		successMsgs:  make(map[string]*sarama.ProducerMessage),
+		failedMsgs:   make(map[string]error),
+		keysInFlight: make(map[string]bool),
+		noAckKeys:    make(map[string]string),
 	}
 }
 
 // newWebhooksKafka constructor
-func newWebhooksKafka(kconf *kafka.KafkaCommonConf, receipts *receiptStore) (w *webhooksKafka) {
+func newWebhooksKafka(kconf *kafka.KafkaCommonConf, qconf *KafkaQueueConf, receipts *receiptStore) (w *webhooksKafka, err error) {
 	w = newWebhooksKafkaBase(receipts)
 	kf := &kafka.SaramaKafkaFactory{}
 	w.kafka = kafka.NewKafkaCommon(kf, kconf, w)
+	if qconf.Path != "" {
+		w.queueConf = qconf
+		if w.queue, err = newKafkaQueue(qconf); err != nil {
+			return nil, err
+		}
+	}
 	return
 }
 
@@ -63,6 +81,36 @@ func (w *webhooksKafka) setMsgPending(msgID string) {
 	w.sendCond.L.Unlock()
 }
 
+// acquireKey waits until no other message with the key is in flight, so a message that fails
+// and is queued cannot be overtaken by a later message for the same key
+func (w *webhooksKafka) acquireKey(key string) {
+	w.sendCond.L.Lock()
+	for w.keysInFlight[key] {
+		w.sendCond.Wait()
+	}
+	w.keysInFlight[key] = true
+	w.sendCond.L.Unlock()
+}
+
+func (w *webhooksKafka) releaseKey(key string) {
+	w.sendCond.L.Lock()
+	delete(w.keysInFlight, key)
+	w.sendCond.Broadcast()
+	w.sendCond.L.Unlock()
+}
+
+// releaseNoAckKey releases the key of a message sent without waiting for the result, once the
+// result is known and a failed message has been queued
+func (w *webhooksKafka) releaseNoAckKey(msgID string) {
+	w.sendCond.L.Lock()
+	if key, found := w.noAckKeys[msgID]; found {
+		delete(w.noAckKeys, msgID)
+		delete(w.keysInFlight, key)
+		w.sendCond.Broadcast()
+	}
+	w.sendCond.L.Unlock()
+}
+
 func (w *webhooksKafka) waitForSend(msgID string) (msg *sarama.ProducerMessage, err error) {
 	w.sendCond.L.Lock()
 	for msg == nil && err == nil {
@@ -82,10 +130,12 @@ func (w *webhooksKafka) waitForSend(msgID string) (msg *sarama.ProducerMessage,
 // ConsumerMessagesLoop - consume replies
 func (w *webhooksKafka) ConsumerMessagesLoop(consumer kafka.KafkaConsumer, producer kafka.KafkaProducer, wg *sync.WaitGroup) {
 	for msg := range consumer.Messages() {
-		w.receipts.processReply(msg.Value)
-
-		// Regardless of outcome, we ack
-		consumer.MarkOffset(msg, "")
+		msg := msg
+		// Regardless of outcome, we ack. When receipts are batched, the offset is only marked
+		// once the batch holding the receipt is stored, so a crash cannot lose it
+		w.receipts.processReplyWithAck(msg.Value, func() {
+			consumer.MarkOffset(msg, "")
+		})
 	}
 	wg.Done()
 }
@@ -101,12 +151,20 @@ func (w *webhooksKafka) ProducerErrorLoop(consumer kafka.KafkaConsumer, producer
 		}
 		msgID := err.Msg.Metadata.(string)
 		w.sendCond.L.Lock()
-		if _, found := w.pendingMsgs[msgID]; found {
+		_, found := w.pendingMsgs[msgID]
+		if found {
 			delete(w.pendingMsgs, msgID)
 			w.failedMsgs[msgID] = err
 			w.sendCond.Broadcast()
 		}
 		w.sendCond.L.Unlock()
+		if !found && w.queue != nil {
+			// Nobody is waiting for the result, so queue it to send again
+			if qerr := w.queueProducerMsg(err.Msg); qerr != nil {
+				log.Errorf("Message %s lost: %s", msgID, qerr)
+			}
+			w.releaseNoAckKey(msgID)
+		}
 	}
 	wg.Done()
 }
@@ -128,6 +186,7 @@ func (w *webhooksKafka) ProducerSuccessLoop(consumer kafka.KafkaConsumer, produc
 			w.sendCond.Broadcast()
 		}
 		w.sendCond.L.Unlock()
+		w.releaseNoAckKey(msgID)
 	}
 	wg.Done()
 }
@@ -139,37 +198,134 @@ func (w *webhooksKafka) sendWebhookMsg(ctx context.Context, key, msgID string, m
 	if err != nil {
 		return "", 500, errors.Errorf(errors.WebhooksKafkaYAMLtoJSON, err)
 	}
+	log.Debugf("Message payload: %s", payloadToForward)
+	queuedMsg := &kafkaQueuedMsg{
+		ID:          msgID,
+		Key:         key,
+		Value:       payloadToForward,
+		AccessToken: auth.GetAccessToken(ctx),
+	}
+
+	if w.queue != nil {
+		w.acquireKey(key)
+		// Messages join the back of the queue while it is being flushed, so they are sent in order
+		if w.queue.len() > 0 {
+			defer w.releaseKey(key)
+			return w.queueMsg(queuedMsg)
+		}
+		if ack {
+			// Released once the message is sent, or queued after failing
+			defer w.releaseKey(key)
+		} else {
+			w.sendCond.L.Lock()
+			w.noAckKeys[msgID] = key
+			w.sendCond.L.Unlock()
+		}
+	}
+
 	if ack {
 		w.setMsgPending(msgID)
 	}
+	w.kafka.Producer().Input() <- w.newProducerMsg(queuedMsg)
 
-	log.Debugf("Message payload: %s", payloadToForward)
+	msgAck := ""
+	if ack {
+		successMsg, err := w.waitForSend(msgID)
+		if err != nil {
+			if w.queue != nil {
+				log.Warnf("Queueing message %s after failure sending to Kafka: %s", msgID, err)
+				return w.queueMsg(queuedMsg)
+			}
+			return "", 502, errors.Errorf(errors.WebhooksKafkaErr, err)
+		}
+		msgAck = fmt.Sprintf("%s:%d:%d", successMsg.Topic, successMsg.Partition, successMsg.Offset)
+	}
+	return msgAck, 200, nil
+}
+
+func (w *webhooksKafka) newProducerMsg(msg *kafkaQueuedMsg) *sarama.ProducerMessage {
 	sentMsg := &sarama.ProducerMessage{
 		Topic:    w.kafka.Conf().TopicOut,
-		Key:      sarama.StringEncoder(key),
-		Value:    sarama.ByteEncoder(payloadToForward),
-		Metadata: msgID,
+		Key:      sarama.StringEncoder(msg.Key),
+		Value:    sarama.ByteEncoder(msg.Value),
+		Metadata: msg.ID,
 	}
-	accessToken := auth.GetAccessToken(ctx)
-	if accessToken != "" {
+	if msg.AccessToken != "" {
 		sentMsg.Headers = []sarama.RecordHeader{
 			{
 				Key:   []byte(messages.RecordHeaderAccessToken),
-				Value: []byte(accessToken),
+				Value: []byte(msg.AccessToken),
 			},
 		}
 	}
-	w.kafka.Producer().Input() <- sentMsg
+	return sentMsg
+}
+
+// queueMsg stores a message in the local queue, to be sent once Kafka is available
+func (w *webhooksKafka) queueMsg(msg *kafkaQueuedMsg) (string, int, error) {
+	msg.Queued = time.Now().UTC()
+	if err := w.queue.push(msg); err != nil {
+		return "", 503, err
+	}
+	return kafkaQueuedAck, 200, nil
+}
 
-	msgAck := ""
-	if ack {
-		successMsg, err := w.waitForSend(msgID)
-		if err != nil {
-			return "", 502, errors.Errorf(errors.WebhooksKafkaErr, err)
+// queueProducerMsg queues a message that failed to send, that was sent without waiting for the result
+func (w *webhooksKafka) queueProducerMsg(sentMsg *sarama.ProducerMessage) error {
+	msg := &kafkaQueuedMsg{
+		ID:     sentMsg.Metadata.(string),
+		Queued: time.Now().UTC(),
+	}
+	if sentMsg.Key != nil {
+		key, _ := sentMsg.Key.Encode()
+		msg.Key = string(key)
+	}
+	if sentMsg.Value != nil {
+		msg.Value, _ = sentMsg.Value.Encode()
+	}
+	for _, h := range sentMsg.Headers {
+		if string(h.Key) == messages.RecordHeaderAccessToken {
+			msg.AccessToken = string(h.Value)
+		}
+	}
+	return w.queue.push(msg)
+}
+
+// flushQueue sends the queued messages to Kafka in order, waiting for each to be delivered.
+// It stops at the first failure, leaving that message at the head of the queue to retry
+func (w *webhooksKafka) flushQueue() {
+	producer := w.kafka.Producer()
+	if producer == nil {
+		return
+	}
+	sent := 0
+	for msg := w.queue.peek(); msg != nil; msg = w.queue.peek() {
+		w.setMsgPending(msg.ID)
+		producer.Input() <- w.newProducerMsg(msg)
+		if _, err := w.waitForSend(msg.ID); err != nil {
+			log.Warnf("Failed to send queued message %s to Kafka (%d queued): %s", msg.ID, w.queue.len(), err)
+			break
+		}
+		w.queue.pop()
+		sent++
+	}
+	if sent > 0 {
+		log.Infof("Sent %d queued messages to Kafka (%d queued)", sent, w.queue.len())
+	}
+}
+
+func (w *webhooksKafka) flushQueueLoop(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(time.Duration(w.queueConf.RetryIntervalSec) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.flushQueue()
 		}
-		msgAck = fmt.Sprintf("%s:%d:%d", successMsg.Topic, successMsg.Partition, successMsg.Offset)
 	}
-	return msgAck, 200, nil
 }
 
 func (w *webhooksKafka) validateConf() error {
@@ -177,6 +333,17 @@ func (w *webhooksKafka) validateConf() error {
 }
 
 func (w *webhooksKafka) run() error {
+	if w.queue != nil {
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go w.flushQueueLoop(stop, done)
+		defer func() {
+			// A flush in progress completes before the queue is closed
+			close(stop)
+			<-done
+			w.queue.close()
+		}()
+	}
 	err := w.kafka.Start()
 	w.finished = true
 	return err
@@ -25,6 +25,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -297,6 +298,148 @@ func TestWebhookHandlerJSONSendFailedToKafkaNoAck(t *testing.T) {
 	assert.Equal(messages.MsgTypeSendTransaction, forwardedMessage.Headers.MsgType)
 }
 
+// startTestQueuedWebhooks runs a webhooks Kafka bridge with a local queue, against a producer
+// that fails the first sends. The IDs of the messages the producer is given are recorded
+func startTestQueuedWebhooks(assert *assert.Assertions, dir string, failures int) (*webhooksKafka, *testKafkaCommon, *[]string, func()) {
+	_, wk, k, ts := newTestWebhooks()
+	go k.Start()
+
+	var err error
+	wk.queueConf = &KafkaQueueConf{Path: dir, MaxMessages: 10, RetryIntervalSec: 1}
+	wk.queue, err = newKafkaQueue(wk.queueConf)
+	assert.NoError(err)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+	var sent []string
+	go func() {
+		for msg := range k.kafkaFactory.Producer.MockInput {
+			sent = append(sent, msg.Metadata.(string))
+			k.kafkaFactory.Producer.CloseSync.Lock()
+			if !k.kafkaFactory.Producer.Closed {
+				if failures > 0 {
+					failures--
+					k.kafkaFactory.Producer.MockErrors <- &sarama.ProducerError{Msg: msg, Err: fmt.Errorf("pop")}
+				} else {
+					k.kafkaFactory.Producer.MockSuccesses <- msg
+				}
+			}
+			k.kafkaFactory.Producer.CloseSync.Unlock()
+		}
+		wg.Done()
+	}()
+	go wk.ProducerSuccessLoop(k.kafkaFactory.Consumer, k.kafkaFactory.Producer, wg)
+	go wk.ProducerErrorLoop(k.kafkaFactory.Consumer, k.kafkaFactory.Producer, wg)
+
+	return wk, k, &sent, func() {
+		k.stop <- true
+		wg.Wait()
+		wk.queue.close()
+		ts.Close()
+	}
+}
+
+func TestWebhookHandlerQueuesWhenKafkaUnavailable(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+	wk, _, sent, stop := startTestQueuedWebhooks(assert, dir, 2)
+
+	ctx, _ := auth.WithAuthContext(context.Background(), "testat")
+	msgAck, status, err := wk.sendWebhookMsg(ctx, "key1", "msg1", map[string]interface{}{"a": 1}, true)
+	assert.NoError(err)
+	assert.Equal(200, status)
+	assert.Equal("queued", msgAck)
+
+	// Joins the back of the queue, without trying Kafka
+	msgAck, status, err = wk.sendWebhookMsg(ctx, "key2", "msg2", map[string]interface{}{"a": 2}, true)
+	assert.NoError(err)
+	assert.Equal(200, status)
+	assert.Equal("queued", msgAck)
+	assert.Equal(2, wk.queue.len())
+	assert.Equal("testat", wk.queue.peek().AccessToken)
+
+	// Still failing
+	wk.flushQueue()
+	assert.Equal(2, wk.queue.len())
+
+	wk.flushQueue()
+	assert.Equal(0, wk.queue.len())
+
+	stop()
+	assert.Equal([]string{"msg1", "msg1", "msg1", "msg2"}, *sent)
+}
+
+func TestWebhookHandlerQueuesWhenKafkaUnavailableNoAck(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+	wk, _, sent, stop := startTestQueuedWebhooks(assert, dir, 1)
+
+	msgAck, status, err := wk.sendWebhookMsg(context.Background(), "key1", "msg1", map[string]interface{}{"a": 1}, false)
+	assert.NoError(err)
+	assert.Equal(200, status)
+	assert.Equal("", msgAck)
+	for wk.queue.len() == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	msg := wk.queue.peek()
+	assert.Equal("msg1", msg.ID)
+	assert.Equal("key1", msg.Key)
+	assert.JSONEq(`{"a":1}`, string(msg.Value))
+
+	wk.flushQueue()
+	assert.Equal(0, wk.queue.len())
+
+	stop()
+	assert.Equal([]string{"msg1", "msg1"}, *sent)
+}
+
+func TestWebhookHandlerQueuePreservesKeyOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+	wk, _, sent, stop := startTestQueuedWebhooks(assert, dir, 1)
+
+	// The second message waits for the first to fail and be queued, rather than overtaking it
+	_, _, err := wk.sendWebhookMsg(context.Background(), "key1", "msg1", map[string]interface{}{"a": 1}, false)
+	assert.NoError(err)
+	msgAck, _, err := wk.sendWebhookMsg(context.Background(), "key1", "msg2", map[string]interface{}{"a": 2}, false)
+	assert.NoError(err)
+	assert.Equal("queued", msgAck)
+	assert.Equal(2, wk.queue.len())
+	assert.Equal("msg1", wk.queue.peek().ID)
+
+	wk.flushQueue()
+	assert.Equal(0, wk.queue.len())
+
+	// Once the queue is empty, messages for the key are sent directly again
+	msgAck, _, err = wk.sendWebhookMsg(context.Background(), "key1", "msg3", map[string]interface{}{"a": 3}, true)
+	assert.NoError(err)
+	assert.NotEqual("queued", msgAck)
+
+	stop()
+	assert.Equal([]string{"msg1", "msg1", "msg2", "msg3"}, *sent)
+	assert.Empty(wk.keysInFlight)
+}
+
+func TestWebhookHandlerQueueFull(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "kafkaqueue")
+	defer os.RemoveAll(dir)
+	wk, _, _, stop := startTestQueuedWebhooks(assert, dir, 1)
+	defer stop()
+	wk.queueConf.MaxMessages = 0
+
+	_, status, err := wk.sendWebhookMsg(context.Background(), "key1", "msg1", map[string]interface{}{"a": 1}, true)
+	assert.Equal(503, status)
+	assert.EqualError(err, "Kafka is unavailable, and the local queue is full with 0 messages")
+}
+
 func TestProducerErrorLoopPanicsOnBadErrStructure(t *testing.T) {
 	assert := assert.New(t)
 
@@ -402,6 +545,38 @@ func TestWebhookHandlerYAMLDeployContract(t *testing.T) {
 	assert.Equal(messages.MsgTypeDeployContract, forwardedMessage.Headers.MsgType)
 }
 
+func TestWebhookHandlerJSONRPCCall(t *testing.T) {
+
+	assert := assert.New(t)
+
+	msg := messages.RPCCall{}
+	msg.Headers.MsgType = messages.MsgTypeRPCCall
+	msg.Method = "admin_peers"
+	msgBytes, _ := json.Marshal(&msg)
+	resp, replyMsgs := sendTestTransaction(assert, msgBytes, "application/json", nil, true)
+	assertSentResp(assert, resp, true)
+	assert.Equal(1, len(replyMsgs))
+
+	forwardedMessage := messages.RPCCall{}
+	json.Unmarshal(replyMsgs[0], &forwardedMessage)
+	assert.Equal(messages.MsgTypeRPCCall, forwardedMessage.Headers.MsgType)
+	assert.Equal("admin_peers", forwardedMessage.Method)
+}
+
+func TestWebhookHandlerYAMLRPCCallMissingMethod(t *testing.T) {
+
+	assert := assert.New(t)
+
+	msg := "" +
+		"headers:\n" +
+		"  type: RPCCall\n" +
+		"\n"
+
+	resp, replyMsgs := sendTestTransaction(assert, []byte(msg), "application/x-yaml", nil, true)
+	assertErrResp(assert, resp, 400, "Invalid message - missing 'method' \\(or not a string\\)")
+	assert.Equal(0, len(replyMsgs))
+}
+
 func TestWebhookHandlerYAMLBadHeaders(t *testing.T) {
 
 	assert := assert.New(t)
@@ -0,0 +1,174 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var addressPolicyAddrCheck = regexp.MustCompile("^(0x)?[0-9a-f]{40}$")
+
+// AddressPolicyConf configures the from and to addresses that transactions may be sent with.
+// Each entry is an address, a wildcard pattern such as 0x1234*, or a name that is resolved
+// to an address - such as the name a contract is registered as, or a signer alias.
+// A transaction matching a deny list is rejected. When an allow list is set, a transaction
+// must match one of its entries
+type AddressPolicyConf struct {
+	AllowFrom []string `json:"allowFrom,omitempty"`
+	DenyFrom  []string `json:"denyFrom,omitempty"`
+	AllowTo   []string `json:"allowTo,omitempty"`
+	DenyTo    []string `json:"denyTo,omitempty"`
+}
+
+// AddressNameResolver resolves a name in the address policy to the address, or HD wallet
+// reference, it is currently registered as
+type AddressNameResolver interface {
+	ResolveAddressName(name string) (string, bool)
+}
+
+// enabled returns true if any of the lists are set
+func (conf *AddressPolicyConf) enabled() bool {
+	return len(conf.AllowFrom) > 0 || len(conf.DenyFrom) > 0 || len(conf.AllowTo) > 0 || len(conf.DenyTo) > 0
+}
+
+// validate checks each wildcard entry is a valid pattern
+func (conf *AddressPolicyConf) validate() error {
+	for _, list := range [][]string{conf.AllowFrom, conf.DenyFrom, conf.AllowTo, conf.DenyTo} {
+		for _, entry := range list {
+			if _, err := path.Match(strings.ToLower(entry), ""); err != nil {
+				return errors.Errorf(errors.TransactionSendAddressPolicyBadPattern, entry, err)
+			}
+		}
+	}
+	return nil
+}
+
+// addressPolicy enforces the allow and deny lists, resolving any names in them each time
+// they are checked, so a name that is re-registered applies to its new address
+type addressPolicy struct {
+	conf          *AddressPolicyConf
+	resolver      AddressNameResolver
+	signerAddress func(from string) (string, error)
+}
+
+// checkFrom checks the from address of a transaction, as supplied and as resolved to the
+// address of its signer
+func (a *addressPolicy) checkFrom(from, resolvedFrom string) error {
+	return a.check("from", a.conf.AllowFrom, a.conf.DenyFrom, from, resolvedFrom)
+}
+
+// checkTo checks the to address of a transaction. Deployments have no to address, so are
+// only checked against the from lists
+func (a *addressPolicy) checkTo(to string) error {
+	return a.check("to", a.conf.AllowTo, a.conf.DenyTo, to)
+}
+
+func (a *addressPolicy) check(field string, allow, deny []string, values ...string) error {
+	if a == nil {
+		return nil
+	}
+	candidates := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			candidates = append(candidates, normalizePolicyValue(v))
+		}
+	}
+	if a.matches(deny, candidates) {
+		return errors.Errorf(errors.TransactionSendAddressDenied, field, values[0])
+	}
+	if len(allow) > 0 && !a.matches(allow, candidates) {
+		return errors.Errorf(errors.TransactionSendAddressNotAllowed, field, values[0])
+	}
+	return nil
+}
+
+// matches returns true if any of the candidate values matches an entry in the list
+func (a *addressPolicy) matches(list, candidates []string) bool {
+	for _, entry := range list {
+		pattern := normalizePolicyValue(entry)
+		if strings.ContainsAny(pattern, "*?[") {
+			for _, c := range candidates {
+				if matched, _ := path.Match(pattern, c); matched {
+					return true
+				}
+			}
+			continue
+		}
+		if addressPolicyAddrCheck.MatchString(pattern) {
+			if matchesPolicyValue(pattern, candidates) {
+				return true
+			}
+			continue
+		}
+		// Anything other than an address is a name, which is resolved before it is matched
+		for _, value := range a.resolveEntry(entry) {
+			if matchesPolicyValue(value, candidates) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolveEntry returns the values a name in the lists stands for. A signer alias or contract
+// name resolves to what it is registered as, and an HD wallet reference - named directly, or
+// by an alias - to the address of its signer, so a transaction sent from that address is matched
+func (a *addressPolicy) resolveEntry(entry string) []string {
+	names := []string{entry}
+	if a.resolver != nil {
+		if resolved, ok := a.resolver.ResolveAddressName(entry); ok {
+			log.Debugf("Address policy entry '%s' -> %s", entry, resolved)
+			names = append(names, resolved)
+		}
+	}
+	values := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		values = append(values, normalizePolicyValue(name))
+		if a.signerAddress == nil || IsHDWalletRequest(name) == nil {
+			continue
+		}
+		addr, err := a.signerAddress(name)
+		if err != nil {
+			log.Warnf("Failed to resolve the address of '%s' in the address policy: %s", name, err)
+			continue
+		}
+		log.Debugf("Address policy entry '%s' -> %s", name, addr)
+		values = append(values, normalizePolicyValue(addr))
+	}
+	return values
+}
+
+// normalizePolicyValue lower cases a value, and adds the 0x prefix if it is an address without one
+func normalizePolicyValue(v string) string {
+	v = strings.ToLower(v)
+	if addressPolicyAddrCheck.MatchString(v) && !strings.HasPrefix(v, "0x") {
+		v = "0x" + v
+	}
+	return v
+}
+
+func matchesPolicyValue(value string, candidates []string) bool {
+	for _, c := range candidates {
+		if c == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+type testAddressNameResolver map[string]string
+
+func (r testAddressNameResolver) ResolveAddressName(name string) (string, bool) {
+	addr, ok := r[name]
+	return addr, ok
+}
+
+func TestAddressPolicyDenyWins(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &addressPolicy{conf: &AddressPolicyConf{
+		AllowFrom: []string{"0x83dbc8e3*"},
+		DenyFrom:  []string{"83DBC8E329B38CBA0FC4ED99B1CE9C2A390ABDC1"},
+	}}
+	assert.Regexp("The from address '0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1' is denied by the address policy", a.checkFrom(testFromAddr, ""))
+	assert.NoError(a.checkFrom("0x83dbc8e300000000000000000000000000000000", ""))
+	assert.Regexp("The from address '0x0000000000000000000000000000000000000000' is not allowed by the address policy", a.checkFrom("0x0000000000000000000000000000000000000000", ""))
+	// No lists for the to address
+	assert.NoError(a.checkTo("0x0000000000000000000000000000000000000000"))
+}
+
+func TestAddressPolicyNames(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &addressPolicy{
+		conf: &AddressPolicyConf{
+			AllowFrom: []string{"hd-compliance-*", "treasury"},
+			AllowTo:   []string{"mytoken"},
+			DenyTo:    []string{"retired"},
+		},
+		resolver: testAddressNameResolver{
+			"treasury": testFromAddr,
+			"mytoken":  "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832",
+			"retired":  "2b8c0ecc76d0759a8f50b2e14a6881367d805832",
+		},
+	}
+	assert.NoError(a.checkFrom("hd-compliance-0", "0x1111111111111111111111111111111111111111"))
+	assert.NoError(a.checkFrom("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"))
+	assert.Regexp("not allowed", a.checkFrom("hd-other-0", "0x1111111111111111111111111111111111111111"))
+	assert.Regexp("The to address '0x2b8c0ecc76d0759a8f50b2e14a6881367d805832' is denied", a.checkTo("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832"))
+
+	a.resolver = testAddressNameResolver{"mytoken": "0x2b8c0ECc76d0759a8F50b2E14A6881367D805832"}
+	assert.NoError(a.checkTo("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832"))
+	assert.Regexp("not allowed", a.checkTo("0x1111111111111111111111111111111111111111"))
+}
+
+func TestAddressPolicyResolvesAliasesToSigners(t *testing.T) {
+	assert := assert.New(t)
+
+	a := &addressPolicy{
+		conf: &AddressPolicyConf{
+			DenyFrom: []string{"treasury", "HD-wallet1-path1-7"},
+		},
+		resolver: testAddressNameResolver{"treasury": "hd-wallet1-path1-3"},
+		signerAddress: func(from string) (string, error) {
+			switch from {
+			case "hd-wallet1-path1-3":
+				return testFromAddr, nil
+			case "HD-wallet1-path1-7":
+				return "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", nil
+			}
+			return "", fmt.Errorf("pop")
+		},
+	}
+	// Sending from the address of a denied alias, or HD wallet reference, does not get around the policy
+	assert.Regexp("is denied", a.checkFrom(testFromAddr, testFromAddr))
+	assert.Regexp("is denied", a.checkFrom("hd-wallet1-path1-3", testFromAddr))
+	assert.Regexp("is denied", a.checkFrom("0x2b8c0ecc76d0759a8f50b2e14a6881367d805832", "0x2b8c0ecc76d0759a8f50b2e14a6881367d805832"))
+	assert.NoError(a.checkFrom("0x1111111111111111111111111111111111111111", "0x1111111111111111111111111111111111111111"))
+
+	a.resolver = testAddressNameResolver{"treasury": "hd-wallet1-path1-4"}
+	assert.NoError(a.checkFrom(testFromAddr, testFromAddr))
+}
+
+func TestAddressPolicyDisabled(t *testing.T) {
+	var a *addressPolicy
+	assert.NoError(t, a.checkFrom(testFromAddr, testFromAddr))
+	assert.NoError(t, a.checkTo(""))
+}
+
+func TestAddressPolicyBadPattern(t *testing.T) {
+	conf := &TxnProcessorConf{
+		AddressPolicy: AddressPolicyConf{DenyTo: []string{"0x[12*"}},
+	}
+	assert.Regexp(t, "Invalid address policy entry '0x\\[12\\*'", conf.ValidateConf())
+}
+
+func TestOnSendTransactionMessageAddressPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		AddressPolicy: AddressPolicyConf{DenyFrom: []string{"signer"}},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.SetAddressNameResolver(testAddressNameResolver{"signer": testFromAddr})
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.Regexp("The from address .* is denied by the address policy", testTxnContext.errorReplies[0].err.Error())
+	assert.Empty(testRPC.calls)
+}
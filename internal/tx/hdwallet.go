@@ -159,3 +159,8 @@ func (s *hdwalletSigner) Sign(tx *ethbinding.Transaction) ([]byte, error) {
 	signedTX.EncodeRLP(signedRLP)
 	return signedRLP.Bytes(), nil
 }
+
+// SignPrivate signs a Quorum private transaction, whose payload is already stored with Tessera
+func (s *hdwalletSigner) SignPrivate(tx *ethbinding.Transaction) ([]byte, error) {
+	return eth.SignQuorumPrivateTX(tx, s.key)
+}
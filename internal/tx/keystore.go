@@ -0,0 +1,226 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+// KeystoreConf configuration of signing with the keys in a directory of encrypted (V3) keystore
+// files, such as those written by geth, all unlocked with the password in a file
+type KeystoreConf struct {
+	Path         string `json:"path"`
+	PasswordFile string `json:"passwordFile"`
+	ChainID      string `json:"chainID"`
+}
+
+// Keystore interface
+type Keystore interface {
+	SignerFor(from string) (eth.TXSigner, error)
+}
+
+type keystore struct {
+	conf    *KeystoreConf
+	chainID big.Int
+	mux     sync.Mutex
+	keys    map[string]*ecdsa.PrivateKey
+}
+
+// keystoreFile is a V3 keystore file
+type keystoreFile struct {
+	Address string         `json:"address"`
+	Crypto  keystoreCrypto `json:"crypto"`
+}
+
+type keystoreCrypto struct {
+	Cipher       string `json:"cipher"`
+	CipherText   string `json:"ciphertext"`
+	CipherParams struct {
+		IV string `json:"iv"`
+	} `json:"cipherparams"`
+	KDF       string                 `json:"kdf"`
+	KDFParams map[string]interface{} `json:"kdfparams"`
+	MAC       string                 `json:"mac"`
+}
+
+type keystoreSigner struct {
+	hdwalletSigner
+}
+
+// newKeystore constructor
+func newKeystore(conf *KeystoreConf) Keystore {
+	ks := &keystore{
+		conf: conf,
+		keys: make(map[string]*ecdsa.PrivateKey),
+	}
+	ks.chainID.SetString(conf.ChainID, 0)
+	return ks
+}
+
+// SignerFor returns a signer for an address with a key file in the keystore. Keys are decrypted
+// the first time they are used, and kept in memory for the life of the process
+func (ks *keystore) SignerFor(from string) (eth.TXSigner, error) {
+	address := strings.ToLower(strings.TrimPrefix(from, "0x"))
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	key, exists := ks.keys[address]
+	if !exists {
+		var err error
+		if key, err = ks.loadKey(address); err != nil {
+			return nil, err
+		}
+		ks.keys[address] = key
+	}
+	return &keystoreSigner{
+		hdwalletSigner: hdwalletSigner{
+			address: ethbind.API.PubkeyToAddress(key.PublicKey),
+			key:     key,
+			chainID: &ks.chainID,
+		},
+	}, nil
+}
+
+// loadKey finds the key file for an address in the keystore directory, and decrypts it
+func (ks *keystore) loadKey(address string) (*ecdsa.PrivateKey, error) {
+	files, err := ioutil.ReadDir(ks.conf.Path)
+	if err != nil {
+		return nil, errors.Errorf(errors.KeystoreLoadFailed, address, err)
+	}
+	for _, fi := range files {
+		if fi.IsDir() {
+			continue
+		}
+		fileBytes, err := ioutil.ReadFile(path.Join(ks.conf.Path, fi.Name()))
+		if err != nil {
+			return nil, errors.Errorf(errors.KeystoreLoadFailed, address, err)
+		}
+		var file keystoreFile
+		if err := json.Unmarshal(fileBytes, &file); err != nil || strings.ToLower(strings.TrimPrefix(file.Address, "0x")) != address {
+			continue
+		}
+		log.Infof("Loading key for %s from keystore file %s", address, fi.Name())
+		password, err := ioutil.ReadFile(ks.conf.PasswordFile)
+		if err != nil {
+			return nil, errors.Errorf(errors.KeystoreLoadFailed, address, err)
+		}
+		keyBytes, err := decryptKeystoreKey(&file.Crypto, strings.TrimRight(string(password), "\r\n"))
+		if err != nil {
+			return nil, errors.Errorf(errors.KeystoreLoadFailed, address, err)
+		}
+		key, err := ethbind.API.HexToECDSA(hex.EncodeToString(keyBytes))
+		if err != nil {
+			return nil, errors.Errorf(errors.KeystoreLoadFailed, address, err)
+		}
+		if strings.ToLower(strings.TrimPrefix(ethbind.API.PubkeyToAddress(key.PublicKey).Hex(), "0x")) != address {
+			return nil, errors.Errorf(errors.KeystoreLoadFailed, address, "key does not match the address of the file")
+		}
+		return key, nil
+	}
+	return nil, errors.Errorf(errors.KeystoreNoKey, address)
+}
+
+// decryptKeystoreKey derives the key that encrypts a V3 keystore file from the password, with
+// scrypt or PBKDF2, checks it against the MAC of the file, and decrypts the private key
+func decryptKeystoreKey(c *keystoreCrypto, password string) ([]byte, error) {
+	if c.Cipher != "aes-128-ctr" {
+		return nil, errors.Errorf(errors.KeystoreUnsupported, "cipher", c.Cipher)
+	}
+	cipherText, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(c.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.Errorf(errors.KeystoreUnsupported, "iv", c.CipherParams.IV)
+	}
+	mac, err := hex.DecodeString(c.MAC)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := hex.DecodeString(kdfParamString(c.KDFParams, "salt"))
+	if err != nil {
+		return nil, err
+	}
+	dkLen := kdfParamInt(c.KDFParams, "dklen")
+	var derivedKey []byte
+	switch c.KDF {
+	case "scrypt":
+		n, r, p := kdfParamInt(c.KDFParams, "n"), kdfParamInt(c.KDFParams, "r"), kdfParamInt(c.KDFParams, "p")
+		if derivedKey, err = scrypt.Key([]byte(password), salt, n, r, p, dkLen); err != nil {
+			return nil, err
+		}
+	case "pbkdf2":
+		if prf := kdfParamString(c.KDFParams, "prf"); prf != "hmac-sha256" {
+			return nil, errors.Errorf(errors.KeystoreUnsupported, "prf", prf)
+		}
+		derivedKey = pbkdf2.Key([]byte(password), salt, kdfParamInt(c.KDFParams, "c"), dkLen, sha256.New)
+	default:
+		return nil, errors.Errorf(errors.KeystoreUnsupported, "kdf", c.KDF)
+	}
+	if len(derivedKey) < 32 {
+		return nil, errors.Errorf(errors.KeystoreUnsupported, "dklen", strconv.Itoa(dkLen))
+	}
+
+	h := sha3.NewLegacyKeccak256()
+	h.Write(derivedKey[16:32])
+	h.Write(cipherText)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return nil, errors.Errorf(errors.KeystoreBadPassword)
+	}
+	block, err := aes.NewCipher(derivedKey[:16])
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, len(cipherText))
+	cipher.NewCTR(block, iv).XORKeyStream(key, cipherText)
+	return key, nil
+}
+
+func kdfParamString(params map[string]interface{}, name string) string {
+	s, _ := params[name].(string)
+	return s
+}
+
+func kdfParamInt(params map[string]interface{}, name string) int {
+	f, _ := params[name].(float64)
+	return int(f)
+}
+
+func (s *keystoreSigner) Type() string {
+	return "Keystore"
+}
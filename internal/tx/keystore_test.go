@@ -0,0 +1,264 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+// The test vectors of the Web3 Secret Storage definition, with the scrypt cost lowered
+const (
+	testKeystoreAddress = "0x008aeeda4d805471df9b2a5b0f38a0c3bcba786b"
+	testKeystoreKey     = "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"
+	testKeystorePBKDF2  = `{
+		"address": "008aeeda4d805471df9b2a5b0f38a0c3bcba786b",
+		"crypto" : {
+			"cipher" : "aes-128-ctr",
+			"cipherparams" : {"iv" : "6087dab2f9fdbbfaddc31a909735c1e6"},
+			"ciphertext" : "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+			"kdf" : "pbkdf2",
+			"kdfparams" : {"c" : 262144, "dklen" : 32, "prf" : "hmac-sha256", "salt" : "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},
+			"mac" : "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+		},
+		"id" : "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version" : 3
+	}`
+	testKeystoreScrypt = `{
+		"address": "008aeeda4d805471df9b2a5b0f38a0c3bcba786b",
+		"crypto" : {
+			"cipher" : "aes-128-ctr",
+			"cipherparams" : {"iv" : "83dbcc02d8ccb40e466191a123791e0e"},
+			"ciphertext" : "a21cd77670fac3c35e6a9a6c8092cb73b9ea3157abf5c7165f2efd64a495adbb",
+			"kdf" : "scrypt",
+			"kdfparams" : {"dklen" : 32, "n" : 2, "p" : 1, "r" : 8, "salt" : "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"},
+			"mac" : "1716d2cc4b63a11efba7c66d527de6c0fce7e15803436b70feef7003aa805fc6"
+		},
+		"id" : "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version" : 3
+	}`
+)
+
+func testKeystoreCrypto(t *testing.T, file string) *keystoreCrypto {
+	var f keystoreFile
+	err := json.Unmarshal([]byte(file), &f)
+	assert.NoError(t, err)
+	return &f.Crypto
+}
+
+func newTestKeystoreDir(t *testing.T, files map[string]string) (string, string) {
+	dir, _ := ioutil.TempDir("", "keystore")
+	for name, content := range files {
+		ioutil.WriteFile(path.Join(dir, name), []byte(content), 0600)
+	}
+	os.Mkdir(path.Join(dir, "subdir"), 0700)
+	passwordFile := path.Join(dir, "password")
+	ioutil.WriteFile(passwordFile, []byte("testpassword\n"), 0600)
+	return dir, passwordFile
+}
+
+func TestDecryptKeystoreKey(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, file := range []string{testKeystorePBKDF2, testKeystoreScrypt} {
+		key, err := decryptKeystoreKey(testKeystoreCrypto(t, file), "testpassword")
+		assert.NoError(err)
+		assert.Equal(testKeystoreKey, hex.EncodeToString(key))
+
+		_, err = decryptKeystoreKey(testKeystoreCrypto(t, file), "wrongpassword")
+		assert.EqualError(err, "Could not decrypt the key with the keystore password")
+	}
+}
+
+func TestDecryptKeystoreKeyUnsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	c := testKeystoreCrypto(t, testKeystoreScrypt)
+	c.Cipher = "aes-128-cbc"
+	_, err := decryptKeystoreKey(c, "testpassword")
+	assert.EqualError(err, "Unsupported keystore cipher 'aes-128-cbc'")
+
+	c = testKeystoreCrypto(t, testKeystoreScrypt)
+	c.KDF = "argon2"
+	_, err = decryptKeystoreKey(c, "testpassword")
+	assert.EqualError(err, "Unsupported keystore kdf 'argon2'")
+
+	c = testKeystoreCrypto(t, testKeystorePBKDF2)
+	c.KDFParams["prf"] = "hmac-sha512"
+	_, err = decryptKeystoreKey(c, "testpassword")
+	assert.EqualError(err, "Unsupported keystore prf 'hmac-sha512'")
+
+	c = testKeystoreCrypto(t, testKeystoreScrypt)
+	c.KDFParams["dklen"] = float64(16)
+	_, err = decryptKeystoreKey(c, "testpassword")
+	assert.EqualError(err, "Unsupported keystore dklen '16'")
+
+	c = testKeystoreCrypto(t, testKeystoreScrypt)
+	c.CipherParams.IV = "83dbcc02"
+	_, err = decryptKeystoreKey(c, "testpassword")
+	assert.EqualError(err, "Unsupported keystore iv '83dbcc02'")
+
+	c = testKeystoreCrypto(t, testKeystoreScrypt)
+	c.KDFParams["n"] = float64(3)
+	_, err = decryptKeystoreKey(c, "testpassword")
+	assert.Error(err)
+
+	for _, corrupt := range []func(c *keystoreCrypto){
+		func(c *keystoreCrypto) { c.CipherText = "not hex" },
+		func(c *keystoreCrypto) { c.CipherParams.IV = "not hex" },
+		func(c *keystoreCrypto) { c.MAC = "not hex" },
+		func(c *keystoreCrypto) { c.KDFParams["salt"] = "not hex" },
+	} {
+		c = testKeystoreCrypto(t, testKeystoreScrypt)
+		corrupt(c)
+		_, err = decryptKeystoreKey(c, "testpassword")
+		assert.Error(err)
+	}
+}
+
+func TestKeystoreSignOK(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, passwordFile := newTestKeystoreDir(t, map[string]string{
+		"UTC--2021-01-01T00-00-00.000000000Z--008aeeda4d805471df9b2a5b0f38a0c3bcba786b": testKeystoreScrypt,
+		"README": "not a keystore file",
+	})
+	defer os.RemoveAll(dir)
+
+	ks := newKeystore(&KeystoreConf{
+		Path:         dir,
+		PasswordFile: passwordFile,
+		ChainID:      "12345",
+	}).(*keystore)
+
+	s, err := ks.SignerFor(testKeystoreAddress)
+	assert.NoError(err)
+	assert.Equal("Keystore", s.Type())
+	addr := ethbind.API.HexToAddress(testKeystoreAddress)
+	assert.Equal(addr.String(), s.Address())
+	assert.Len(ks.keys, 1)
+
+	tx := ethbind.API.NewContractCreation(12345, big.NewInt(0), 0, big.NewInt(0), []byte("hello world"))
+	signed, err := s.Sign(tx)
+	assert.NoError(err)
+
+	eip155 := ethbind.API.NewEIP155Signer(big.NewInt(12345))
+	tx2 := &ethbinding.Transaction{}
+	err = tx2.DecodeRLP(ethbind.API.NewStream(bytes.NewReader(signed), 0))
+	assert.NoError(err)
+	sender, err := eip155.Sender(tx2)
+	assert.NoError(err)
+	assert.Equal(addr, sender)
+
+	// The key is cached, so the files are not read again
+	os.RemoveAll(dir)
+	_, err = ks.SignerFor(addr.String())
+	assert.NoError(err)
+}
+
+func TestKeystoreSignerForNoKey(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, passwordFile := newTestKeystoreDir(t, map[string]string{
+		"key1": testKeystoreScrypt,
+	})
+	defer os.RemoveAll(dir)
+
+	ks := newKeystore(&KeystoreConf{
+		Path:         dir,
+		PasswordFile: passwordFile,
+	})
+
+	_, err := ks.SignerFor(testFromAddr)
+	assert.EqualError(err, "No key for address '83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1' in the keystore")
+}
+
+func TestKeystoreSignerForBadPassword(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, passwordFile := newTestKeystoreDir(t, map[string]string{
+		"key1": testKeystoreScrypt,
+	})
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(passwordFile, []byte("wrongpassword"), 0600)
+
+	ks := newKeystore(&KeystoreConf{
+		Path:         dir,
+		PasswordFile: passwordFile,
+	})
+
+	_, err := ks.SignerFor(testKeystoreAddress)
+	assert.EqualError(err, "Failed to load key for address '008aeeda4d805471df9b2a5b0f38a0c3bcba786b' from the keystore: Could not decrypt the key with the keystore password")
+}
+
+func TestKeystoreSignerForMissingPasswordFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := newTestKeystoreDir(t, map[string]string{
+		"key1": testKeystoreScrypt,
+	})
+	defer os.RemoveAll(dir)
+
+	ks := newKeystore(&KeystoreConf{
+		Path:         dir,
+		PasswordFile: path.Join(dir, "missing"),
+	})
+
+	_, err := ks.SignerFor(testKeystoreAddress)
+	assert.Regexp("Failed to load key for address '008aeeda4d805471df9b2a5b0f38a0c3bcba786b' from the keystore", err)
+}
+
+func TestKeystoreSignerForAddressMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	// A file that claims an address its key does not have
+	var file map[string]interface{}
+	json.Unmarshal([]byte(testKeystoreScrypt), &file)
+	file["address"] = "83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	fileBytes, _ := json.Marshal(file)
+	dir, passwordFile := newTestKeystoreDir(t, map[string]string{
+		"key1": string(fileBytes),
+	})
+	defer os.RemoveAll(dir)
+
+	ks := newKeystore(&KeystoreConf{
+		Path:         dir,
+		PasswordFile: passwordFile,
+	})
+
+	_, err := ks.SignerFor(testFromAddr)
+	assert.EqualError(err, "Failed to load key for address '83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1' from the keystore: key does not match the address of the file")
+}
+
+func TestKeystoreSignerForMissingDir(t *testing.T) {
+	assert := assert.New(t)
+
+	ks := newKeystore(&KeystoreConf{
+		Path: "/does/not/exist",
+	})
+
+	_, err := ks.SignerFor(testKeystoreAddress)
+	assert.Regexp("Failed to load key for address '008aeeda4d805471df9b2a5b0f38a0c3bcba786b' from the keystore", err)
+}
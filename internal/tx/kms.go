@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/alecthomas/template"
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKMSDigestProp    = "digest"
+	defaultKMSSignatureProp = "signature"
+)
+
+// KMSConf configuration of signing with keys held by a key management service. The service
+// signs the hash of each transaction, so the private keys never leave it
+type KMSConf struct {
+	utils.HTTPRequesterConf
+	// URLTemplate is a go template such as: "https://kms.example.com/api/v1/keys/{{.KeyID}}/sign"
+	URLTemplate string `json:"urlTemplate"`
+	ChainID     string `json:"chainID"`
+	// Keys maps each from address the KMS signs for to the ID of its key
+	Keys      map[string]string `json:"keys"`
+	PropNames KMSConfPropNames  `json:"propNames"`
+}
+
+// KMSConfPropNames prop names of the JSON requests and responses of the KMS
+type KMSConfPropNames struct {
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
+// KMSRequest is the input to the URL template of the KMS
+type KMSRequest struct {
+	Address string
+	KeyID   string
+}
+
+// KMS interface
+type KMS interface {
+	SignerFor(from string) (eth.TXSigner, error)
+}
+
+type kms struct {
+	conf        *KMSConf
+	urlTemplate *template.Template
+	chainID     big.Int
+	keys        map[string]string
+	hr          *utils.HTTPRequester
+}
+
+type kmsSigner struct {
+	kms     *kms
+	address ethbinding.Address
+	keyID   string
+}
+
+// validate checks the URL template and chain ID of the configuration
+func (conf *KMSConf) validate() error {
+	if conf.URLTemplate == "" {
+		return nil
+	}
+	if _, err := template.New("urlTemplate").Parse(conf.URLTemplate); err != nil {
+		return errors.Errorf(errors.KMSBadURLTemplate, err)
+	}
+	if _, ok := new(big.Int).SetString(conf.ChainID, 0); conf.ChainID != "" && !ok {
+		return errors.Errorf(errors.KMSBadChainID, conf.ChainID)
+	}
+	return nil
+}
+
+// newKMS constructor
+func newKMS(conf *KMSConf) (KMS, error) {
+	urlTemplate, err := template.New("urlTemplate").Parse(conf.URLTemplate)
+	if err != nil {
+		return nil, errors.Errorf(errors.KMSBadURLTemplate, err)
+	}
+	k := &kms{
+		conf:        conf,
+		urlTemplate: urlTemplate,
+		keys:        make(map[string]string),
+		hr:          utils.NewHTTPRequester("KMS", &conf.HTTPRequesterConf),
+	}
+	propNames := &conf.PropNames
+	if propNames.Digest == "" {
+		propNames.Digest = defaultKMSDigestProp
+	}
+	if propNames.Signature == "" {
+		propNames.Signature = defaultKMSSignatureProp
+	}
+	for address, keyID := range conf.Keys {
+		k.keys[strings.ToLower(strings.TrimPrefix(address, "0x"))] = keyID
+	}
+	if _, ok := k.chainID.SetString(conf.ChainID, 0); conf.ChainID != "" && !ok {
+		return nil, errors.Errorf(errors.KMSBadChainID, conf.ChainID)
+	}
+	return k, nil
+}
+
+func (k *kms) SignerFor(from string) (eth.TXSigner, error) {
+	keyID, exists := k.keys[strings.ToLower(strings.TrimPrefix(from, "0x"))]
+	if !exists {
+		return nil, errors.Errorf(errors.KMSSigningNoKey, from)
+	}
+	return &kmsSigner{
+		kms:     k,
+		address: ethbind.API.HexToAddress(from),
+		keyID:   keyID,
+	}, nil
+}
+
+// signHash asks the KMS to sign the hash of a transaction with the key of the signer
+func (s *kmsSigner) signHash(ctx context.Context, hash []byte) ([]byte, error) {
+	k := s.kms
+	urlStr := &strings.Builder{}
+	err := k.urlTemplate.Execute(urlStr, &KMSRequest{
+		Address: s.Address(),
+		KeyID:   s.keyID,
+	})
+	if err != nil {
+		log.Errorf("Failed to build KMS URL for key '%s': %s", s.keyID, err)
+		return nil, errors.Errorf(errors.KMSSigningFailed)
+	}
+
+	result, err := k.hr.DoRequestContext(ctx, "POST", urlStr.String(), map[string]interface{}{
+		k.conf.PropNames.Digest: "0x" + hex.EncodeToString(hash),
+	})
+	if err != nil {
+		log.Errorf("KMS request failed: %s", err)
+		return nil, errors.Errorf(errors.KMSSigningFailed)
+	}
+	sigStr, err := k.hr.GetResponseString(result, k.conf.PropNames.Signature, false)
+	if err != nil {
+		log.Errorf("Missing signature in response: %s", err)
+		return nil, errors.Errorf(errors.KMSSigningBadData)
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(sigStr, "0x"))
+	if err != nil {
+		log.Errorf("Bad hex value in response '%s': %s", sigStr, err)
+		return nil, errors.Errorf(errors.KMSSigningBadData)
+	}
+	return sig, nil
+}
+
+func (s *kmsSigner) Type() string {
+	return "KMS"
+}
+
+func (s *kmsSigner) Address() string {
+	return s.address.String()
+}
+
+func (s *kmsSigner) Sign(tx *ethbinding.Transaction) ([]byte, error) {
+	return s.SignContext(context.Background(), tx)
+}
+
+// SignContext signs the transaction, abandoning the request to the KMS if the context is cancelled
+func (s *kmsSigner) SignContext(ctx context.Context, tx *ethbinding.Transaction) ([]byte, error) {
+	return eth.SignEIP155TX(tx, &s.kms.chainID, s.Address(), func(hash []byte) ([]byte, error) {
+		return s.signHash(ctx, hash)
+	})
+}
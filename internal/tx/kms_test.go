@@ -0,0 +1,293 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestKMS returns a KMS that signs with the key, formatting each signature with the function
+func newTestKMS(t *testing.T, key *ecdsa.PrivateKey, format func(compact []byte) []byte) (*httptest.Server, KMS) {
+	addr := ethbind.API.PubkeyToAddress(key.PublicKey)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, "/keys/key1/sign", req.URL.Path)
+		var body map[string]string
+		json.NewDecoder(req.Body).Decode(&body)
+		digest, _ := hex.DecodeString(strings.TrimPrefix(body["hash"], "0x"))
+		compact := signCompact(t, key, digest)
+		res.WriteHeader(200)
+		json.NewEncoder(res).Encode(map[string]string{
+			"sig": "0x" + hex.EncodeToString(format(compact)),
+		})
+	}))
+	signers, err := newKMS(&KMSConf{
+		URLTemplate: svr.URL + "/keys/{{.KeyID}}/sign",
+		ChainID:     "12345",
+		Keys:        map[string]string{strings.ToLower(addr.Hex()): "key1"},
+		PropNames: KMSConfPropNames{
+			Digest:    "hash",
+			Signature: "sig",
+		},
+	})
+	assert.NoError(t, err)
+	return svr, signers
+}
+
+// signCompact signs a digest, returning the recovery ID plus 27 followed by R and the low S value
+func signCompact(t *testing.T, key *ecdsa.PrivateKey, digest []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	assert.NoError(t, err)
+	n := key.Curve.Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	compact := make([]byte, 65)
+	r.FillBytes(compact[1:33])
+	s.FillBytes(compact[33:65])
+	addr := ethbind.API.PubkeyToAddress(key.PublicKey)
+	for id := byte(0); id < 2; id++ {
+		pubKey, err := ethbind.API.SigToPub(digest, append(append([]byte{}, compact[1:65]...), id))
+		if err == nil && ethbind.API.PubkeyToAddress(*pubKey) == addr {
+			compact[0] = 27 + id
+			return compact
+		}
+	}
+	assert.Fail(t, "Signature does not recover to the key")
+	return compact
+}
+
+func assertKMSSigned(t *testing.T, kms KMS, addr ethbinding.Address) {
+	assert := assert.New(t)
+
+	s, err := kms.SignerFor(addr.Hex())
+	assert.NoError(err)
+	assert.Equal("KMS", s.Type())
+	assert.Equal(addr.String(), s.Address())
+
+	tx := ethbind.API.NewTransaction(10, ethbind.API.HexToAddress(testFromAddr), big.NewInt(100), 21000, big.NewInt(1000000000), []byte("hello world"))
+	signed, err := s.Sign(tx)
+	assert.NoError(err)
+
+	eip155 := ethbind.API.NewEIP155Signer(big.NewInt(12345))
+	tx2 := &ethbinding.Transaction{}
+	err = tx2.DecodeRLP(ethbind.API.NewStream(bytes.NewReader(signed), 0))
+	assert.NoError(err)
+	sender, err := eip155.Sender(tx2)
+	assert.NoError(err)
+	assert.Equal(addr, sender)
+	assert.Equal(uint64(10), tx2.Nonce())
+	assert.Equal([]byte("hello world"), tx2.Data())
+}
+
+func TestKMSDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	signers, err := newKMS(&KMSConf{})
+	assert.NoError(err)
+	k := signers.(*kms)
+
+	assert.Equal(defaultKMSDigestProp, k.conf.PropNames.Digest)
+	assert.Equal(defaultKMSSignatureProp, k.conf.PropNames.Signature)
+}
+
+func TestKMSSignOK(t *testing.T) {
+	key, _ := ethbind.API.GenerateKey()
+	svr, kms := newTestKMS(t, key, func(compact []byte) []byte {
+		// R, S and a V of 27 or 28
+		return append(compact[1:65], compact[0])
+	})
+	defer svr.Close()
+
+	assertKMSSigned(t, kms, ethbind.API.PubkeyToAddress(key.PublicKey))
+}
+
+func TestKMSSignNoRecoveryIDHighS(t *testing.T) {
+	key, _ := ethbind.API.GenerateKey()
+	svr, kms := newTestKMS(t, key, func(compact []byte) []byte {
+		// R and the high S value, without V, as some key management services return
+		s := new(big.Int).SetBytes(compact[33:65])
+		s.Sub(key.Curve.Params().N, s)
+		return append(compact[1:33], s.FillBytes(make([]byte, 32))...)
+	})
+	defer svr.Close()
+
+	assertKMSSigned(t, kms, ethbind.API.PubkeyToAddress(key.PublicKey))
+}
+
+func TestKMSSignWrongKey(t *testing.T) {
+	assert := assert.New(t)
+
+	key, _ := ethbind.API.GenerateKey()
+	otherKey, _ := ethbind.API.GenerateKey()
+	svr, signers := newTestKMS(t, otherKey, func(compact []byte) []byte {
+		return compact[1:65]
+	})
+	defer svr.Close()
+	addr := ethbind.API.PubkeyToAddress(key.PublicKey)
+	signers.(*kms).keys = map[string]string{
+		strings.ToLower(strings.TrimPrefix(addr.Hex(), "0x")): "key1",
+	}
+
+	s, err := signers.SignerFor(addr.Hex())
+	assert.NoError(err)
+	_, err = s.Sign(ethbind.API.NewContractCreation(0, big.NewInt(0), 0, big.NewInt(0), []byte("hello world")))
+	assert.EqualError(err, "Signature returned by the remote signer does not recover to address '"+addr.String()+"'")
+}
+
+func TestKMSSignBadSignatureLength(t *testing.T) {
+	assert := assert.New(t)
+
+	key, _ := ethbind.API.GenerateKey()
+	svr, kms := newTestKMS(t, key, func(compact []byte) []byte {
+		return compact[1:33]
+	})
+	defer svr.Close()
+
+	s, err := kms.SignerFor(ethbind.API.PubkeyToAddress(key.PublicKey).Hex())
+	assert.NoError(err)
+	_, err = s.Sign(ethbind.API.NewContractCreation(0, big.NewInt(0), 0, big.NewInt(0), []byte("hello world")))
+	assert.EqualError(err, "Signature of 32 bytes returned by the remote signer. Must be 64 or 65 bytes")
+}
+
+func TestKMSBadConf(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &KMSConf{URLTemplate: "http://localhost/{{.KeyID"}
+	_, err := newKMS(conf)
+	assert.Regexp("Invalid KMS URL template", err)
+	assert.Regexp("Invalid KMS URL template", conf.validate())
+
+	conf = &KMSConf{URLTemplate: "http://localhost/{{.KeyID}}", ChainID: "not a number"}
+	_, err = newKMS(conf)
+	assert.EqualError(err, "Invalid KMS chain ID 'not a number'. Must be a decimal or 0x prefixed hex integer")
+	assert.EqualError(conf.validate(), "Invalid KMS chain ID 'not a number'. Must be a decimal or 0x prefixed hex integer")
+
+	conf = &KMSConf{URLTemplate: "http://localhost/{{.KeyID}}", ChainID: "0x3039"}
+	assert.NoError(conf.validate())
+	assert.NoError((&KMSConf{}).validate())
+}
+
+func TestKMSSignBadURLTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	kms, err := newKMS(&KMSConf{
+		URLTemplate: "http://localhost/{{.Unknown}}",
+		ChainID:     "12345",
+		Keys:        map[string]string{testFromAddr: "key1"},
+	})
+	assert.NoError(err)
+
+	s, err := kms.SignerFor(testFromAddr)
+	assert.NoError(err)
+	_, err = s.Sign(ethbind.API.NewContractCreation(0, big.NewInt(0), 0, big.NewInt(0), []byte("hello world")))
+	assert.EqualError(err, "KMS signing failed")
+}
+
+func TestKMSSignerForNoKey(t *testing.T) {
+	assert := assert.New(t)
+
+	kms, err := newKMS(&KMSConf{
+		URLTemplate: "http://localhost/{{.KeyID}}",
+		Keys:        map[string]string{"0xAA": "key1"},
+	})
+
+	assert.NoError(err)
+
+	_, err = kms.SignerFor(testFromAddr)
+	assert.EqualError(err, "No KMS key is configured for address '"+testFromAddr+"'")
+}
+
+func TestKMSSignRequestFail(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer svr.Close()
+
+	kms, err := newKMS(&KMSConf{
+		URLTemplate: svr.URL,
+		ChainID:     "12345",
+		Keys:        map[string]string{testFromAddr: "key1"},
+	})
+	assert.NoError(err)
+
+	s, err := kms.SignerFor(testFromAddr)
+	assert.NoError(err)
+	_, err = s.Sign(ethbind.API.NewContractCreation(0, big.NewInt(0), 0, big.NewInt(0), []byte("hello world")))
+	assert.EqualError(err, "KMS signing failed")
+}
+
+func TestKMSSignContextCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer svr.Close()
+
+	kms, err := newKMS(&KMSConf{
+		URLTemplate: svr.URL,
+		ChainID:     "12345",
+		Keys:        map[string]string{testFromAddr: "key1"},
+	})
+	assert.NoError(err)
+
+	s, err := kms.SignerFor(testFromAddr)
+	assert.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.(eth.ContextSigner).SignContext(ctx, ethbind.API.NewContractCreation(0, big.NewInt(0), 0, big.NewInt(0), []byte("hello world")))
+	assert.EqualError(err, "KMS signing failed")
+}
+
+func TestKMSSignBadResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, body := range []string{`{}`, `{"signature": 12345}`, `{"signature": "0xnothex"}`} {
+		svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(200)
+			res.Write([]byte(body))
+		}))
+
+		kms, err := newKMS(&KMSConf{
+			URLTemplate: svr.URL,
+			ChainID:     "12345",
+			Keys:        map[string]string{testFromAddr: "key1"},
+		})
+		assert.NoError(err)
+
+		s, err := kms.SignerFor(testFromAddr)
+		assert.NoError(err)
+		_, err = s.Sign(ethbind.API.NewContractCreation(0, big.NewInt(0), 0, big.NewInt(0), []byte("hello world")))
+		assert.EqualError(err, "Unexpected response from KMS", body)
+		svr.Close()
+	}
+}
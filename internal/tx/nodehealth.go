@@ -0,0 +1,114 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultNodeHealthCacheSec = 5
+	nodeHealthPollInterval    = 1 * time.Second
+)
+
+// NodeHealthConf configures the check that the node is in sync with the chain, and connected
+// to peers, before transactions are dispatched to it. A node that is syncing, or isolated,
+// accepts transactions but gives misleading results for nonces, gas estimates and receipts
+type NodeHealthConf struct {
+	Enabled  bool `json:"enabled"`
+	MinPeers int  `json:"minPeers"`
+	WaitSec  int  `json:"waitSec"`
+	CacheSec int  `json:"cacheSec"` // JSON only config - no commandline
+}
+
+// nodeHealth remembers a healthy result for a short time, so every transaction does not
+// need to make the calls. Unhealthy results are always re-checked
+type nodeHealth struct {
+	conf        *NodeHealthConf
+	rpc         eth.RPCClient
+	mux         sync.Mutex
+	healthyTill time.Time
+}
+
+func newNodeHealth(conf *NodeHealthConf, rpc eth.RPCClient) *nodeHealth {
+	return &nodeHealth{
+		conf: conf,
+		rpc:  rpc,
+	}
+}
+
+func (n *nodeHealth) cacheDuration() time.Duration {
+	if n.conf.CacheSec > 0 {
+		return time.Duration(n.conf.CacheSec) * time.Second
+	}
+	return defaultNodeHealthCacheSec * time.Second
+}
+
+// check returns an error if the node is syncing, or has fewer than the minimum peers
+func (n *nodeHealth) check(ctx context.Context) error {
+	n.mux.Lock()
+	defer n.mux.Unlock()
+	if time.Now().Before(n.healthyTill) {
+		return nil
+	}
+
+	var syncing interface{}
+	if err := n.rpc.CallContext(ctx, &syncing, "eth_syncing"); err != nil {
+		return errors.Errorf(errors.TransactionSendNodeHealthCheckFailed, err)
+	}
+	// The node returns false when it is not syncing, or the progress of the sync
+	if progress, isSyncing := syncing.(map[string]interface{}); isSyncing {
+		return errors.Errorf(errors.TransactionSendNodeSyncing, progress["currentBlock"], progress["highestBlock"])
+	}
+
+	if n.conf.MinPeers > 0 {
+		var peers ethbinding.HexUint64
+		if err := n.rpc.CallContext(ctx, &peers, "net_peerCount"); err != nil {
+			return errors.Errorf(errors.TransactionSendNodeHealthCheckFailed, err)
+		}
+		if uint64(peers) < uint64(n.conf.MinPeers) {
+			return errors.Errorf(errors.TransactionSendNodeIsolated, uint64(peers), n.conf.MinPeers)
+		}
+	}
+
+	n.healthyTill = time.Now().Add(n.cacheDuration())
+	return nil
+}
+
+// waitUntilHealthy holds a transaction until the node is healthy, for up to the configured
+// wait. Holding the transaction, rather than rejecting it, keeps the order of the transactions
+// in the stream for a node that is catching up after a restart
+func (n *nodeHealth) waitUntilHealthy(ctx context.Context) error {
+	deadline := time.Now().Add(time.Duration(n.conf.WaitSec) * time.Second)
+	for {
+		err := n.check(ctx)
+		if err == nil || !time.Now().Before(deadline) {
+			return err
+		}
+		log.Warnf("Holding transaction until the node is ready: %s", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(nodeHealthPollInterval):
+		}
+	}
+}
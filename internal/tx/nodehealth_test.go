@@ -0,0 +1,105 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNodeHealthRPC(syncing interface{}, peers uint64, calls *int) *eth.MockRPCClient {
+	return eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		*calls++
+		switch method {
+		case "eth_syncing":
+			*(res.(*interface{})) = syncing
+		case "net_peerCount":
+			*(res.(*ethbinding.HexUint64)) = ethbinding.HexUint64(peers)
+		}
+	})
+}
+
+func TestNodeHealthSyncing(t *testing.T) {
+	calls := 0
+	rpc := newTestNodeHealthRPC(map[string]interface{}{
+		"currentBlock": "0x10",
+		"highestBlock": "0x20",
+	}, 5, &calls)
+	n := newNodeHealth(&NodeHealthConf{Enabled: true, MinPeers: 1}, rpc)
+	err := n.check(context.Background())
+	assert.Regexp(t, "Node is syncing with the chain \\(block 0x10 of 0x20\\)", err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNodeHealthIsolated(t *testing.T) {
+	calls := 0
+	rpc := newTestNodeHealthRPC(false, 0, &calls)
+	n := newNodeHealth(&NodeHealthConf{Enabled: true, MinPeers: 2}, rpc)
+	err := n.check(context.Background())
+	assert.Regexp(t, "Node has 0 peers. At least 2 are required", err)
+}
+
+func TestNodeHealthHealthyIsCached(t *testing.T) {
+	assert := assert.New(t)
+	calls := 0
+	rpc := newTestNodeHealthRPC(false, 3, &calls)
+	n := newNodeHealth(&NodeHealthConf{Enabled: true, MinPeers: 1}, rpc)
+	assert.NoError(n.check(context.Background()))
+	assert.Equal(2, calls)
+	assert.NoError(n.waitUntilHealthy(context.Background()))
+	assert.Equal(2, calls)
+}
+
+func TestNodeHealthPeersNotChecked(t *testing.T) {
+	calls := 0
+	rpc := newTestNodeHealthRPC(false, 0, &calls)
+	n := newNodeHealth(&NodeHealthConf{Enabled: true}, rpc)
+	assert.NoError(t, n.check(context.Background()))
+	assert.Equal(t, "eth_syncing", rpc.MethodCapture)
+}
+
+func TestNodeHealthRPCError(t *testing.T) {
+	rpc := eth.NewMockRPCClientForSync(fmt.Errorf("pop"), nil)
+	n := newNodeHealth(&NodeHealthConf{Enabled: true, MinPeers: 1}, rpc)
+	assert.Regexp(t, "Failed to check the node is ready for transactions: pop", n.check(context.Background()))
+}
+
+func TestOnMessageNodeSyncing(t *testing.T) {
+	assert := assert.New(t)
+
+	calls := 0
+	rpc := newTestNodeHealthRPC(map[string]interface{}{}, 1, &calls)
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		NodeHealth: NodeHealthConf{Enabled: true, MinPeers: 1},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.Init(rpc)
+
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1\"" +
+		"}"
+	txnProcessor.OnMessage(testTxnContext)
+
+	assert.Empty(testTxnContext.replies)
+	assert.Len(testTxnContext.errorReplies, 1)
+	assert.Equal(503, testTxnContext.errorReplies[0].status)
+	assert.Regexp("Node is syncing", testTxnContext.errorReplies[0].err)
+}
@@ -0,0 +1,207 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+const (
+	// NonceDiscrepancyGap is a nonce below one in-flight, that is neither in-flight nor known to the node,
+	// so the transactions with higher nonces cannot be mined
+	NonceDiscrepancyGap = "gap"
+	// NonceDiscrepancyStale is a next nonce to assign that the node has already seen a transaction for,
+	// because another submitter is using the address
+	NonceDiscrepancyStale = "stale"
+	// NonceDiscrepancyMined is an in-flight nonce that has been mined, without a receipt being received
+	NonceDiscrepancyMined = "mined"
+	// NonceDiscrepancyDropped is an in-flight nonce the node does not have a pending transaction for,
+	// such as after a node restart dropped its pending transactions
+	NonceDiscrepancyDropped = "dropped"
+
+	// NonceRemediationGapFill is to submit a transaction for each missing nonce
+	NonceRemediationGapFill = "gapfill"
+	// NonceRemediationResync is to query the next nonce from the node again
+	NonceRemediationResync = "resync"
+	// NonceRemediationWait is to wait for the receipt, or for the transaction to time out
+	NonceRemediationWait = "wait"
+	// NonceRemediationResubmit is to submit the transaction again with the same nonce
+	NonceRemediationResubmit = "resubmit"
+)
+
+// NonceReport compares the nonces assigned to the transactions in-flight for an address, with the
+// transaction counts of the node. NextNonce is only set while the nonces of the address are managed
+// by ethconnect, rather than assigned by the node
+type NonceReport struct {
+	From                    string               `json:"from"`
+	LatestTransactionCount  int64                `json:"latestTransactionCount"`
+	PendingTransactionCount int64                `json:"pendingTransactionCount"`
+	NextNonce               *int64               `json:"nextNonce,omitempty"`
+	InFlight                []*InFlightTxnStatus `json:"inFlight"`
+	Discrepancies           []*NonceDiscrepancy  `json:"discrepancies"`
+}
+
+// NonceDiscrepancy is a difference between the nonce state of ethconnect and the node, with the
+// remediation suggested to recover from it
+type NonceDiscrepancy struct {
+	Type        string  `json:"type"`
+	Nonces      []int64 `json:"nonces,omitempty"`
+	Detail      string  `json:"detail"`
+	Remediation string  `json:"remediation"`
+}
+
+// nonceSnapshot is the state of the nonces of an address, copied under the in-flight lock
+type nonceSnapshot struct {
+	from          string
+	managedNonces []int64
+	nextNonce     *int64
+	inFlight      []*InFlightTxnStatus
+}
+
+// NonceReport reconciles the nonces of every address with transactions in-flight, and of any other
+// addresses requested, with the latest and pending transaction counts of the node. Nonces assigned by
+// the node, and those of private transactions, are listed but not reconciled
+func (p *txnProcessor) NonceReport(ctx context.Context, addresses []string) ([]*NonceReport, error) {
+	snapshots := make(map[string]*nonceSnapshot)
+	for _, addr := range addresses {
+		from, err := utils.StrToAddress("from", addr)
+		if err != nil {
+			return nil, err
+		}
+		normalized := strings.ToLower(from.Hex())
+		snapshots[normalized] = &nonceSnapshot{from: normalized, inFlight: []*InFlightTxnStatus{}}
+	}
+
+	inFlightStatus := p.InFlightStatus()
+	p.inflightTxnsLock.Lock()
+	for from, inflightForAddr := range p.inflightTxns {
+		snapshot := &nonceSnapshot{from: from, inFlight: inFlightStatus[from]}
+		for _, inflight := range inflightForAddr.txnsInFlight {
+			if !inflight.nodeAssignNonce && inflight.privacyGroupID == "" {
+				snapshot.managedNonces = append(snapshot.managedNonces, inflight.nonce)
+			}
+		}
+		if len(snapshot.managedNonces) > 0 {
+			nextNonce := inflightForAddr.highestNonce + 1
+			snapshot.nextNonce = &nextNonce
+		}
+		snapshots[from] = snapshot
+	}
+	p.inflightTxnsLock.Unlock()
+
+	reports := make([]*NonceReport, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.inFlight == nil {
+			snapshot.inFlight = []*InFlightTxnStatus{}
+		}
+		report := &NonceReport{
+			From:          snapshot.from,
+			NextNonce:     snapshot.nextNonce,
+			InFlight:      snapshot.inFlight,
+			Discrepancies: []*NonceDiscrepancy{},
+		}
+		addr, _ := utils.StrToAddress("from", snapshot.from)
+		var err error
+		if report.LatestTransactionCount, err = eth.GetTransactionCount(ctx, p.rpc, &addr, "latest"); err != nil {
+			return nil, err
+		}
+		if report.PendingTransactionCount, err = eth.GetTransactionCount(ctx, p.rpc, &addr, "pending"); err != nil {
+			return nil, err
+		}
+		report.reconcile(snapshot.managedNonces)
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].From < reports[j].From })
+	return reports, nil
+}
+
+// reconcile compares the managed nonces in-flight with the transaction counts of the node
+func (r *NonceReport) reconcile(managedNonces []int64) {
+	sort.Slice(managedNonces, func(i, j int) bool { return managedNonces[i] < managedNonces[j] })
+	inFlight := make(map[int64]bool, len(managedNonces))
+	for _, nonce := range managedNonces {
+		inFlight[nonce] = true
+	}
+
+	// A nonce below the latest transaction count has been mined, so the transaction in-flight has
+	// either yet to see its receipt, or has been replaced by another with the same nonce
+	mined := []int64{}
+	for _, nonce := range managedNonces {
+		if nonce < r.LatestTransactionCount {
+			mined = append(mined, nonce)
+		}
+	}
+	if len(mined) > 0 {
+		r.Discrepancies = append(r.Discrepancies, &NonceDiscrepancy{
+			Type:        NonceDiscrepancyMined,
+			Nonces:      mined,
+			Detail:      fmt.Sprintf("%d nonces in-flight are below the latest transaction count %d of the node. Each transaction is either waiting for its receipt, or was replaced by another transaction with the same nonce and will fail when it times out", len(mined), r.LatestTransactionCount),
+			Remediation: NonceRemediationWait,
+		})
+	}
+
+	// The node does not have a transaction for any nonce from its pending transaction count upwards,
+	// so each one below the highest in-flight that is not itself in-flight is a gap
+	gaps := []int64{}
+	if len(managedNonces) > 0 {
+		for nonce := r.PendingTransactionCount; nonce < managedNonces[len(managedNonces)-1]; nonce++ {
+			if !inFlight[nonce] {
+				gaps = append(gaps, nonce)
+			}
+		}
+	}
+	if len(gaps) > 0 {
+		r.Discrepancies = append(r.Discrepancies, &NonceDiscrepancy{
+			Type:        NonceDiscrepancyGap,
+			Nonces:      gaps,
+			Detail:      fmt.Sprintf("%d nonces below the highest in-flight nonce %d are not in-flight, and not pending on the node. Submit a transaction for each, such as a zero value transfer from the address to itself, or enable attemptGapFill so they are filled when a submission fails", len(gaps), managedNonces[len(managedNonces)-1]),
+			Remediation: NonceRemediationGapFill,
+		})
+	}
+
+	// The node does not have a pending transaction for any in-flight nonce from its pending transaction
+	// count upwards, so the transaction was dropped by the node (or its submission is still under way)
+	dropped := []int64{}
+	for _, nonce := range managedNonces {
+		if nonce >= r.PendingTransactionCount {
+			dropped = append(dropped, nonce)
+		}
+	}
+	if len(dropped) > 0 {
+		r.Discrepancies = append(r.Discrepancies, &NonceDiscrepancy{
+			Type:        NonceDiscrepancyDropped,
+			Nonces:      dropped,
+			Detail:      fmt.Sprintf("%d nonces in-flight are at or above the pending transaction count %d of the node, so the node does not have the transactions. Unless they are still being submitted, they were dropped by the node, and must be submitted again with the same nonces", len(dropped), r.PendingTransactionCount),
+			Remediation: NonceRemediationResubmit,
+		})
+	}
+
+	// If the node has seen more transactions than ethconnect assigned nonces for, the next nonce
+	// assigned would replace, or be rejected as a duplicate of, another submitter's transaction
+	if r.NextNonce != nil && *r.NextNonce < r.PendingTransactionCount {
+		r.Discrepancies = append(r.Discrepancies, &NonceDiscrepancy{
+			Type:        NonceDiscrepancyStale,
+			Nonces:      []int64{*r.NextNonce},
+			Detail:      fmt.Sprintf("The next nonce %d to be assigned is below the pending transaction count %d of the node, so another submitter is using the address. Stop the other submitter. The next nonce is queried from the node again once the transactions in-flight for the address complete", *r.NextNonce, r.PendingTransactionCount),
+			Remediation: NonceRemediationResync,
+		})
+	}
+}
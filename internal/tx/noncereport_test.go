@@ -0,0 +1,182 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	ethbinding "github.com/kaleido-io/ethbinding/pkg"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockNonceRPC struct {
+	latest  map[string]int64
+	pending map[string]int64
+	err     error
+}
+
+func (m *mockNonceRPC) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if m.err != nil {
+		return m.err
+	}
+	addr := fmt.Sprintf("0x%x", args[0].(*ethbinding.Address).Bytes())
+	count := m.latest[addr]
+	if args[1] == "pending" {
+		count = m.pending[addr]
+	}
+	*(result.(*ethbinding.HexUint64)) = ethbinding.HexUint64(count)
+	return nil
+}
+
+func newTestNonceReportProcessor(rpc eth.RPCClient) *txnProcessor {
+	p := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	p.Init(rpc)
+	return p
+}
+
+func TestNonceReportNoDiscrepancies(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	p := newTestNonceReportProcessor(&mockNonceRPC{
+		latest:  map[string]int64{addr: 10},
+		pending: map[string]int64{addr: 13},
+	})
+	p.inflightTxns[addr] = &inflightTxnState{
+		highestNonce: 12,
+		txnsInFlight: []*inflightTxn{{nonce: 10}, {nonce: 11}, {nonce: 12}},
+	}
+
+	reports, err := p.NonceReport(context.Background(), []string{})
+	assert.NoError(err)
+	assert.Len(reports, 1)
+	assert.Equal(addr, reports[0].From)
+	assert.Equal(int64(10), reports[0].LatestTransactionCount)
+	assert.Equal(int64(13), reports[0].PendingTransactionCount)
+	assert.Equal(int64(13), *reports[0].NextNonce)
+	assert.Len(reports[0].InFlight, 3)
+	assert.Empty(reports[0].Discrepancies)
+}
+
+func TestNonceReportDiscrepancies(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	p := newTestNonceReportProcessor(&mockNonceRPC{
+		latest:  map[string]int64{addr: 10},
+		pending: map[string]int64{addr: 11},
+	})
+	p.inflightTxns[addr] = &inflightTxnState{
+		highestNonce: 14,
+		txnsInFlight: []*inflightTxn{{nonce: 9}, {nonce: 14}, {nonce: 12}, {nodeAssignNonce: true}},
+	}
+
+	reports, err := p.NonceReport(context.Background(), nil)
+	assert.NoError(err)
+	assert.Len(reports, 1)
+	assert.Equal(int64(15), *reports[0].NextNonce)
+	discrepancies := reports[0].Discrepancies
+	assert.Len(discrepancies, 3)
+	assert.Equal(NonceDiscrepancyMined, discrepancies[0].Type)
+	assert.Equal([]int64{9}, discrepancies[0].Nonces)
+	assert.Equal(NonceRemediationWait, discrepancies[0].Remediation)
+	assert.Equal(NonceDiscrepancyGap, discrepancies[1].Type)
+	assert.Equal([]int64{11, 13}, discrepancies[1].Nonces)
+	assert.Equal(NonceRemediationGapFill, discrepancies[1].Remediation)
+	assert.Equal(NonceDiscrepancyDropped, discrepancies[2].Type)
+	assert.Equal([]int64{12, 14}, discrepancies[2].Nonces)
+	assert.Equal(NonceRemediationResubmit, discrepancies[2].Remediation)
+}
+
+func TestNonceReportStale(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	p := newTestNonceReportProcessor(&mockNonceRPC{
+		latest:  map[string]int64{addr: 10},
+		pending: map[string]int64{addr: 15},
+	})
+	p.inflightTxns[addr] = &inflightTxnState{
+		highestNonce: 12,
+		txnsInFlight: []*inflightTxn{{nonce: 12}},
+	}
+
+	reports, err := p.NonceReport(context.Background(), nil)
+	assert.NoError(err)
+	discrepancies := reports[0].Discrepancies
+	assert.Len(discrepancies, 1)
+	assert.Equal(NonceDiscrepancyStale, discrepancies[0].Type)
+	assert.Equal([]int64{13}, discrepancies[0].Nonces)
+	assert.Equal(NonceRemediationResync, discrepancies[0].Remediation)
+}
+
+func TestNonceReportNodeAssignedOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	addr := "0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"
+	p := newTestNonceReportProcessor(&mockNonceRPC{
+		latest:  map[string]int64{addr: 10},
+		pending: map[string]int64{addr: 11},
+	})
+	p.inflightTxns[addr] = &inflightTxnState{
+		txnsInFlight: []*inflightTxn{{nodeAssignNonce: true}, {privacyGroupID: "pg1", nonce: 2}},
+	}
+
+	reports, err := p.NonceReport(context.Background(), nil)
+	assert.NoError(err)
+	assert.Nil(reports[0].NextNonce)
+	assert.Empty(reports[0].Discrepancies)
+}
+
+func TestNonceReportRequestedAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestNonceReportProcessor(&mockNonceRPC{
+		latest:  map[string]int64{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c": 5},
+		pending: map[string]int64{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c": 7},
+	})
+	p.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{
+		txnsInFlight: []*inflightTxn{{nodeAssignNonce: true}},
+	}
+
+	reports, err := p.NonceReport(context.Background(), []string{"0xD50ce736021D9F7B0B2566a3D2FA7FA3136C003C"})
+	assert.NoError(err)
+	assert.Len(reports, 2)
+	assert.Equal("0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1", reports[0].From)
+	assert.Equal("0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c", reports[1].From)
+	assert.Equal(int64(5), reports[1].LatestTransactionCount)
+	assert.Equal(int64(7), reports[1].PendingTransactionCount)
+	assert.Empty(reports[1].InFlight)
+	assert.Empty(reports[1].Discrepancies)
+}
+
+func TestNonceReportBadAddress(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestNonceReportProcessor(&mockNonceRPC{})
+	_, err := p.NonceReport(context.Background(), []string{"badness"})
+	assert.Regexp("Supplied value for 'from' is not a valid hex address", err)
+}
+
+func TestNonceReportRPCFail(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestNonceReportProcessor(&mockNonceRPC{err: fmt.Errorf("pop")})
+	_, err := p.NonceReport(context.Background(), []string{"0xd50ce736021d9f7b0b2566a3d2fa7fa3136c003c"})
+	assert.EqualError(err, "eth_getTransactionCount returned: pop")
+}
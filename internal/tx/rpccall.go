@@ -0,0 +1,62 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+// OnRPCCallMessage invokes the JSON/RPC method of the message on the node, and replies with
+// the raw result. The method must be in the rpc-call-methods allow list, which is empty by default,
+// and methods that send transactions or sign are never allowed
+func (p *txnProcessor) OnRPCCallMessage(txnContext TxnContext, msg *messages.RPCCall) {
+
+	if msg.Method == "" {
+		txnContext.SendErrorReply(400, errors.Errorf(errors.TransactionRPCCallMissingMethod))
+		return
+	}
+	if !p.rpcCallMethods.Allowed(msg.Method) {
+		log.Warnf("RPCCall %s rejected for %s: method not allowed", msg.Method, txnContext)
+		txnContext.SendErrorReply(403, errors.Errorf(errors.TransactionRPCCallMethodNotAllowed, msg.Method))
+		return
+	}
+
+	args := make([]interface{}, len(msg.Params))
+	for i, param := range msg.Params {
+		args[i] = param
+	}
+	start := time.Now()
+	var result json.RawMessage
+	if err := p.rpc.CallContext(txnContext.Context(), &result, msg.Method, args...); err != nil {
+		log.Infof("RPCCall %s failed for %s: %s [%.2fs]", msg.Method, txnContext, err, time.Since(start).Seconds())
+		txnContext.SendErrorReply(500, errors.Errorf(errors.TransactionRPCCallFailed, msg.Method, err))
+		return
+	}
+	log.Infof("RPCCall %s OK for %s [%.2fs]", msg.Method, txnContext, time.Since(start).Seconds())
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+
+	reply := &messages.RPCCallResult{}
+	reply.Headers.MsgType = messages.MsgTypeRPCCallResult
+	reply.Method = msg.Method
+	reply.Result = result
+	txnContext.Reply(reply)
+}
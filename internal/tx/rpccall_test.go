@@ -0,0 +1,147 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnRPCCallMessageOK(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		RPCCallMethods: []string{"admin_*"},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"RPCCall\"}," +
+		"  \"method\":\"admin_peers\"," +
+		"  \"params\":[12345678901234567890,\"0x1\"]" +
+		"}"
+	testRPC := &testRPC{
+		adminResult: json.RawMessage(`[{"id":"abc"}]`),
+	}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.errorReplies)
+	assert.Len(testTxnContext.replies, 1)
+	reply := testTxnContext.replies[0].(*messages.RPCCallResult)
+	assert.Equal(messages.MsgTypeRPCCallResult, reply.Headers.MsgType)
+	assert.Equal("admin_peers", reply.Method)
+	assert.JSONEq(`[{"id":"abc"}]`, string(reply.Result))
+	assert.Equal([]interface{}{
+		json.RawMessage("12345678901234567890"),
+		json.RawMessage(`"0x1"`),
+	}, testRPC.params[0])
+}
+
+func TestOnRPCCallMessageNullResult(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		RPCCallMethods: []string{"admin_addPeer"},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"RPCCall\"}," +
+		"  \"method\":\"admin_addPeer\"" +
+		"}"
+	txnProcessor.Init(&testRPC{})
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Len(testTxnContext.replies, 1)
+	assert.Equal("null", string(testTxnContext.replies[0].(*messages.RPCCallResult).Result))
+}
+
+func TestOnRPCCallMessageNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"RPCCall\"}," +
+		"  \"method\":\"admin_peers\"" +
+		"}"
+	testRPC := &testRPC{}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(403, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "JSON/RPC method 'admin_peers' is not allowed for RPCCall messages")
+	assert.Empty(testRPC.calls)
+}
+
+func TestOnRPCCallMessageSendNeverAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		RPCCallMethods: []string{"eth_*", "personal_*"},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testRPC := &testRPC{}
+	txnProcessor.Init(testRPC)
+	for _, method := range []string{"eth_sendRawTransaction", "eth_signTransaction", "personal_unlockAccount"} {
+		testTxnContext := &testTxnContext{}
+		testTxnContext.jsonMsg = "{" +
+			"  \"headers\":{\"type\": \"RPCCall\"}," +
+			"  \"method\":\"" + method + "\"" +
+			"}"
+		txnProcessor.OnMessage(testTxnContext)
+		assert.Empty(testTxnContext.replies)
+		assert.Equal(403, testTxnContext.errorReplies[0].status)
+	}
+	assert.Empty(testRPC.calls)
+}
+
+func TestOnRPCCallMessageMissingMethod(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"RPCCall\"}" +
+		"}"
+	txnProcessor.Init(&testRPC{})
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.Regexp("must have a 'method'", testTxnContext.errorReplies[0].err)
+}
+
+func TestOnRPCCallMessageFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		RPCCallMethods: []string{"admin_peers"},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"RPCCall\"}," +
+		"  \"method\":\"admin_peers\"" +
+		"}"
+	txnProcessor.Init(&testRPC{adminErr: fmt.Errorf("pop")})
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(500, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "JSON/RPC method 'admin_peers' failed: pop")
+}
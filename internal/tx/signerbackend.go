@@ -0,0 +1,87 @@
+// Copyright 2019 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+)
+
+const (
+	// SignerNode signs with the accounts managed by the node, or the node the address book
+	// resolves for the from address
+	SignerNode = "node"
+	// SignerHDWallet signs with a key derived by the HD wallet, for from addresses of the
+	// form hd-instance-wallet-index
+	SignerHDWallet = "hdwallet"
+	// SignerKMS signs with a key held by a key management service, which is mapped to the from address
+	SignerKMS = "kms"
+	// SignerKeystore signs with the key of the from address in a directory of keystore files
+	SignerKeystore = "keystore"
+)
+
+// SignerBackends are the signer backends a transaction can select, so applications with
+// different custody models can share a gateway without using each other's keys
+var SignerBackends = []string{SignerNode, SignerHDWallet, SignerKMS, SignerKeystore}
+
+// SignerPolicy selects the signer backend of a transaction sent to a contract, and checks the one
+// it selected is allowed, so the policies of contracts apply to transactions that did not pass
+// through the gateway, such as those consumed from Kafka
+type SignerPolicy interface {
+	CheckSigner(to, signer string) (string, error)
+}
+
+// IsSignerBackend returns true if the name is one of the signer backends
+func IsSignerBackend(name string) bool {
+	for _, backend := range SignerBackends {
+		if name == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignerBackend checks the signer backend selected by a transaction is configured, and
+// can sign for its from address. Transactions that do not select one use the backend implied
+// by the from address, as before
+func (p *txnProcessor) checkSignerBackend(backend, from string) error {
+	isHDWallet := IsHDWalletRequest(from) != nil
+	switch backend {
+	case "":
+		return nil
+	case SignerNode:
+		if isHDWallet {
+			return errors.Errorf(errors.SignerBackendFromMismatch, backend, from)
+		}
+	case SignerHDWallet:
+		if p.hdwallet == nil {
+			return errors.Errorf(errors.SignerBackendNotConfigured, backend)
+		}
+		if !isHDWallet {
+			return errors.Errorf(errors.SignerBackendFromMismatch, backend, from)
+		}
+	case SignerKMS, SignerKeystore:
+		if (backend == SignerKMS && p.kms == nil) || (backend == SignerKeystore && p.keystore == nil) {
+			return errors.Errorf(errors.SignerBackendNotConfigured, backend)
+		}
+		if isHDWallet {
+			return errors.Errorf(errors.SignerBackendFromMismatch, backend, from)
+		}
+	default:
+		return errors.Errorf(errors.SignerBackendUnknown, backend, strings.Join(SignerBackends, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSignerBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &txnProcessor{}
+	hdFrom := "hd-testinst-testwallet-1234"
+
+	assert.NoError(p.checkSignerBackend("", testFromAddr))
+	assert.NoError(p.checkSignerBackend("", hdFrom))
+	assert.NoError(p.checkSignerBackend(SignerNode, testFromAddr))
+
+	err := p.checkSignerBackend(SignerNode, hdFrom)
+	assert.EqualError(err, "The 'node' signer cannot sign for from address 'hd-testinst-testwallet-1234'")
+
+	err = p.checkSignerBackend(SignerHDWallet, hdFrom)
+	assert.EqualError(err, "The 'hdwallet' signer is not configured")
+
+	p.hdwallet = newHDWallet(&HDWalletConf{URLTemplate: "http://hdwallet/{{.InstanceID}}/{{.WalletID}}/{{.Index}}"})
+	assert.NoError(p.checkSignerBackend(SignerHDWallet, hdFrom))
+
+	err = p.checkSignerBackend(SignerHDWallet, testFromAddr)
+	assert.EqualError(err, "The 'hdwallet' signer cannot sign for from address '"+testFromAddr+"'")
+
+	for _, backend := range []string{SignerKMS, SignerKeystore} {
+		err = p.checkSignerBackend(backend, testFromAddr)
+		assert.EqualError(err, "The '"+backend+"' signer is not configured")
+	}
+
+	p.kms, err = newKMS(&KMSConf{URLTemplate: "http://kms/{{.KeyID}}"})
+	assert.NoError(err)
+	p.keystore = newKeystore(&KeystoreConf{Path: "/keystore"})
+	for _, backend := range []string{SignerKMS, SignerKeystore} {
+		assert.NoError(p.checkSignerBackend(backend, testFromAddr))
+		err = p.checkSignerBackend(backend, hdFrom)
+		assert.EqualError(err, "The '"+backend+"' signer cannot sign for from address '"+hdFrom+"'")
+	}
+
+	err = p.checkSignerBackend("vault", testFromAddr)
+	assert.EqualError(err, "Unknown signer 'vault'. Must be one of: node, hdwallet, kms, keystore")
+}
+
+func TestResolveSignerBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	kms, err := newKMS(&KMSConf{
+		URLTemplate: "http://kms/{{.KeyID}}",
+		Keys:        map[string]string{testFromAddr: "key1"},
+	})
+	assert.NoError(err)
+	p := &txnProcessor{
+		kms:      kms,
+		keystore: newKeystore(&KeystoreConf{Path: "/does/not/exist"}),
+	}
+
+	signer, err := p.resolveSigner(SignerKMS, testFromAddr)
+	assert.NoError(err)
+	assert.Equal("KMS", signer.Type())
+
+	_, err = p.resolveSigner(SignerKeystore, testFromAddr)
+	assert.Regexp("Failed to load key", err)
+
+	signer, err = p.resolveSigner("", testFromAddr)
+	assert.NoError(err)
+	assert.Nil(signer)
+}
+
+func TestIsSignerBackend(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(IsSignerBackend("node"))
+	assert.True(IsSignerBackend("hdwallet"))
+	assert.True(IsSignerBackend("kms"))
+	assert.True(IsSignerBackend("keystore"))
+	assert.False(IsSignerBackend("Node"))
+	assert.False(IsSignerBackend(""))
+}
+
+func TestOnDeployContractMessageSignerMismatch(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"DeployContract\"}," +
+		"  \"solidity\":\"pragma solidity >=0.4.22 <=0.7; contract t {constructor() public {}}\"," +
+		"  \"from\":\"hd-testinst-testwallet-1234\"," +
+		"  \"signer\":\"node\"," +
+		"  \"nonce\":\"123\"," +
+		"  \"gas\":\"123\"" +
+		"}"
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.EqualError(testTxnContext.errorReplies[0].err, "The 'node' signer cannot sign for from address 'hd-testinst-testwallet-1234'")
+}
+
+type testSignerPolicy struct {
+	to     string
+	signer string
+	result string
+	err    error
+}
+
+func (c *testSignerPolicy) CheckSigner(to, signer string) (string, error) {
+	c.to = to
+	c.signer = signer
+	return c.result, c.err
+}
+
+func TestOnSendTransactionMessageSignerNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	policy := &testSignerPolicy{err: fmt.Errorf("pop")}
+	txnProcessor.SetSignerPolicy(policy)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1\"," +
+		"  \"to\":\"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832\"," +
+		"  \"signer\":\"hdwallet\"," +
+		"  \"nonce\":\"123\"," +
+		"  \"data\":\"0x41c0e1b5\"" +
+		"}"
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "pop")
+	assert.Equal("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", policy.to)
+	assert.Equal("hdwallet", policy.signer)
+}
+
+func TestOnSendTransactionMessageSignerFromPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	policy := &testSignerPolicy{result: SignerKMS}
+	txnProcessor.SetSignerPolicy(policy)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1\"," +
+		"  \"to\":\"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832\"," +
+		"  \"nonce\":\"123\"," +
+		"  \"data\":\"0x41c0e1b5\"" +
+		"}"
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// The policy selected the KMS, which is not configured
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "The 'kms' signer is not configured")
+	assert.Equal("", policy.signer)
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"math/big"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultSpendLimitWindowSec is the rolling window the spend limits apply over, when not configured
+const DefaultSpendLimitWindowSec = 3600
+
+// SpendLimitsConf configures limits on the value transferred, and the gas spent, by the transactions
+// from each signing address over a rolling window - a guardrail for hot signing keys, such as those of
+// a HD wallet. The default limits apply to every signer without an entry in Signers. Each entry is an
+// address, a wildcard pattern, or a name resolved to an address as in the address policy, and the
+// first entry to match a transaction replaces the default limits for it
+type SpendLimitsConf struct {
+	WindowSec int `json:"windowSec"`
+	SpendLimit
+	Signers []*SignerSpendLimit `json:"signers,omitempty"`
+}
+
+// SpendLimit is the value in wei, and the gas, a signer can spend in the window. Zero is unlimited
+type SpendLimit struct {
+	MaxValue string `json:"maxValue,omitempty"`
+	MaxGas   int    `json:"maxGas,omitempty"`
+}
+
+// SignerSpendLimit is the spend limit of the signers that match an entry
+type SignerSpendLimit struct {
+	Signer string `json:"signer"`
+	SpendLimit
+}
+
+// enabled returns true if any limits are set
+func (conf *SpendLimitsConf) enabled() bool {
+	return conf.MaxValue != "" || conf.MaxGas > 0 || len(conf.Signers) > 0
+}
+
+// validate checks each value limit is an integer, and each signer entry a valid pattern
+func (conf *SpendLimitsConf) validate() error {
+	limits := []*SpendLimit{&conf.SpendLimit}
+	for _, entry := range conf.Signers {
+		if _, err := path.Match(strings.ToLower(entry.Signer), ""); entry.Signer == "" || err != nil {
+			return errors.Errorf(errors.TransactionSendSpendLimitBadSigner, entry.Signer)
+		}
+		limits = append(limits, &entry.SpendLimit)
+	}
+	for _, limit := range limits {
+		if _, err := limit.maxValue(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maxValue parses the value limit, returning nil when the value is unlimited
+func (l *SpendLimit) maxValue() (*big.Int, error) {
+	if l.MaxValue == "" {
+		return nil, nil
+	}
+	maxValue, ok := new(big.Int).SetString(l.MaxValue, 10)
+	if !ok || maxValue.Sign() < 0 {
+		return nil, errors.Errorf(errors.TransactionSendSpendLimitBadValue, l.MaxValue)
+	}
+	if maxValue.Sign() == 0 {
+		return nil, nil
+	}
+	return maxValue, nil
+}
+
+// spendRecord is what one submitted transaction spent
+type spendRecord struct {
+	from  string
+	time  time.Time
+	value *big.Int
+	gas   uint64
+}
+
+// spendLimiter tracks what each signing address has spent in the window. The gas of a transaction
+// counts at its gas limit when it is submitted, and is reduced to the gas it used once it is mined.
+// The spend of a transaction that fails to submit is released
+type spendLimiter struct {
+	conf     *SpendLimitsConf
+	window   time.Duration
+	resolver AddressNameResolver
+	mux      sync.Mutex
+	spent    map[string][]*spendRecord
+}
+
+func newSpendLimiter(conf *SpendLimitsConf) *spendLimiter {
+	windowSec := conf.WindowSec
+	if windowSec <= 0 {
+		windowSec = DefaultSpendLimitWindowSec
+	}
+	return &spendLimiter{
+		conf:   conf,
+		window: time.Duration(windowSec) * time.Second,
+		spent:  make(map[string][]*spendRecord),
+	}
+}
+
+// limitFor returns the limit of the first signer entry that matches the from address of a transaction,
+// as supplied and as resolved to the address of its signer, or the default limit
+func (s *spendLimiter) limitFor(from, resolvedFrom string) *SpendLimit {
+	names := &addressPolicy{resolver: s.resolver}
+	candidates := []string{normalizePolicyValue(resolvedFrom)}
+	if from != "" {
+		candidates = append(candidates, normalizePolicyValue(from))
+	}
+	for _, entry := range s.conf.Signers {
+		if names.matches([]string{entry.Signer}, candidates) {
+			return &entry.SpendLimit
+		}
+	}
+	return &s.conf.SpendLimit
+}
+
+// reserve records the spend of a transaction that is about to be submitted, unless it would take
+// its signer over the limit for the window
+func (s *spendLimiter) reserve(from, resolvedFrom string, value *big.Int, gas uint64) (*spendRecord, error) {
+	if s == nil {
+		return nil, nil
+	}
+	limit := s.limitFor(from, resolvedFrom)
+	maxValue, err := limit.maxValue()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := time.Now().UTC()
+	records := s.prune(resolvedFrom, now)
+	spentValue := new(big.Int)
+	var spentGas uint64
+	for _, r := range records {
+		spentValue.Add(spentValue, r.value)
+		spentGas += r.gas
+	}
+	if maxValue != nil && new(big.Int).Add(spentValue, value).Cmp(maxValue) > 0 {
+		return nil, errors.Errorf(errors.TransactionSendSpendLimitValueExceeded, value.Text(10), resolvedFrom, maxValue.Text(10), s.window, spentValue.Text(10))
+	}
+	if limit.MaxGas > 0 && spentGas+gas > uint64(limit.MaxGas) {
+		return nil, errors.Errorf(errors.TransactionSendSpendLimitGasExceeded, gas, resolvedFrom, limit.MaxGas, s.window, spentGas)
+	}
+	record := &spendRecord{
+		from:  resolvedFrom,
+		time:  now,
+		value: value,
+		gas:   gas,
+	}
+	s.spent[resolvedFrom] = append(records, record)
+	log.Debugf("Spend by %s in window: value=%s gas=%d", resolvedFrom, spentValue.Add(spentValue, value).Text(10), spentGas+gas)
+	return record, nil
+}
+
+// release removes the spend of a transaction that was not submitted
+func (s *spendLimiter) release(record *spendRecord) {
+	if record == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	records := s.spent[record.from]
+	for i, r := range records {
+		if r == record {
+			s.spent[record.from] = append(records[0:i], records[i+1:]...)
+			break
+		}
+	}
+}
+
+// settle reduces the gas of a mined transaction from its gas limit, to the gas it used
+func (s *spendLimiter) settle(record *spendRecord, gasUsed uint64) {
+	if record == nil {
+		return
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if gasUsed < record.gas {
+		record.gas = gasUsed
+	}
+}
+
+// prune drops the spend of an address from before the window. Must be called holding the lock
+func (s *spendLimiter) prune(from string, now time.Time) []*spendRecord {
+	records := s.spent[from]
+	i := 0
+	for i < len(records) && now.Sub(records[i].time) >= s.window {
+		i++
+	}
+	records = records[i:]
+	if len(records) == 0 {
+		delete(s.spent, from)
+	} else {
+		s.spent[from] = records
+	}
+	return records
+}
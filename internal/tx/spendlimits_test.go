@@ -0,0 +1,169 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendLimitsValueAndGas(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSpendLimiter(&SpendLimitsConf{
+		SpendLimit: SpendLimit{MaxValue: "1000", MaxGas: 50000},
+	})
+	from := strings.ToLower(testFromAddr)
+	_, err := s.reserve(testFromAddr, from, big.NewInt(600), 21000)
+	assert.NoError(err)
+	_, err = s.reserve(testFromAddr, from, big.NewInt(500), 21000)
+	assert.Regexp("Transaction value of 500 wei from 0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1 exceeds the spend limit of 1000 wei per 1h0m0s \\(600 wei already transferred\\)", err)
+	record, err := s.reserve(testFromAddr, from, big.NewInt(400), 21000)
+	assert.NoError(err)
+	_, err = s.reserve(testFromAddr, from, big.NewInt(0), 21000)
+	assert.Regexp("Transaction gas of 21000 from .* exceeds the spend limit of 50000 gas per 1h0m0s \\(42000 gas already spent\\)", err)
+
+	// The gas used once mined replaces the gas limit
+	s.settle(record, 5000)
+	_, err = s.reserve(testFromAddr, from, big.NewInt(0), 21000)
+	assert.NoError(err)
+
+	// Other signers have their own spend
+	_, err = s.reserve("", "0x1111111111111111111111111111111111111111", big.NewInt(1000), 50000)
+	assert.NoError(err)
+}
+
+func TestSpendLimitsWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSpendLimiter(&SpendLimitsConf{
+		WindowSec:  60,
+		SpendLimit: SpendLimit{MaxValue: "1000"},
+	})
+	from := strings.ToLower(testFromAddr)
+	record, err := s.reserve("", from, big.NewInt(1000), 21000)
+	assert.NoError(err)
+	_, err = s.reserve("", from, big.NewInt(1), 21000)
+	assert.Regexp("exceeds the spend limit of 1000 wei per 1m0s", err)
+
+	record.time = record.time.Add(-61 * time.Second)
+	_, err = s.reserve("", from, big.NewInt(1000), 21000)
+	assert.NoError(err)
+	assert.Len(s.spent[from], 1)
+}
+
+func TestSpendLimitsRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSpendLimiter(&SpendLimitsConf{
+		SpendLimit: SpendLimit{MaxValue: "1000"},
+	})
+	from := strings.ToLower(testFromAddr)
+	record, err := s.reserve("", from, big.NewInt(1000), 21000)
+	assert.NoError(err)
+	s.release(record)
+	_, err = s.reserve("", from, big.NewInt(1000), 21000)
+	assert.NoError(err)
+
+	var disabled *spendLimiter
+	record, err = disabled.reserve("", from, big.NewInt(1000), 21000)
+	assert.NoError(err)
+	assert.Nil(record)
+	disabled.release(record)
+	disabled.settle(record, 0)
+}
+
+func TestSpendLimitsSigners(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newSpendLimiter(&SpendLimitsConf{
+		SpendLimit: SpendLimit{MaxValue: "10"},
+		Signers: []*SignerSpendLimit{
+			{Signer: "hd-treasury-*", SpendLimit: SpendLimit{MaxValue: "1000"}},
+			{Signer: "payroll", SpendLimit: SpendLimit{MaxGas: 21000}},
+		},
+	})
+	s.resolver = testAddressNameResolver{"payroll": testFromAddr}
+
+	_, err := s.reserve("hd-treasury-0", "0x1111111111111111111111111111111111111111", big.NewInt(1000), 21000)
+	assert.NoError(err)
+	_, err = s.reserve("0x2222222222222222222222222222222222222222", "0x2222222222222222222222222222222222222222", big.NewInt(11), 21000)
+	assert.Regexp("exceeds the spend limit of 10 wei", err)
+
+	// The entry replaces the default limits, so the value is unlimited
+	from := strings.ToLower(testFromAddr)
+	_, err = s.reserve(testFromAddr, from, big.NewInt(1000000), 21000)
+	assert.NoError(err)
+	_, err = s.reserve(testFromAddr, from, big.NewInt(0), 1)
+	assert.Regexp("exceeds the spend limit of 21000 gas", err)
+}
+
+func TestSpendLimitsBadConf(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &TxnProcessorConf{
+		SpendLimits: SpendLimitsConf{SpendLimit: SpendLimit{MaxValue: "1 ether"}},
+	}
+	assert.Regexp("Invalid spend limit maxValue '1 ether'", conf.ValidateConf())
+
+	conf = &TxnProcessorConf{
+		SpendLimits: SpendLimitsConf{Signers: []*SignerSpendLimit{
+			{Signer: "hd-*", SpendLimit: SpendLimit{MaxValue: "-1"}},
+		}},
+	}
+	assert.Regexp("Invalid spend limit maxValue '-1'", conf.ValidateConf())
+
+	conf = &TxnProcessorConf{
+		SpendLimits: SpendLimitsConf{Signers: []*SignerSpendLimit{
+			{Signer: "0x[12*"},
+		}},
+	}
+	assert.Regexp("Invalid spend limit signer '0x\\[12\\*'", conf.ValidateConf())
+}
+
+func TestOnSendTransactionMessageSpendLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		SpendLimits:   SpendLimitsConf{SpendLimit: SpendLimit{MaxGas: 200}},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	first := &testTxnContext{}
+	first.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(first)
+	for len(first.replies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(first.errorReplies)
+
+	second := &testTxnContext{}
+	second.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(second)
+	for len(second.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Empty(second.replies)
+	assert.Equal(400, second.errorReplies[0].status)
+	assert.Regexp("Transaction gas of 123 from .* exceeds the spend limit of 200 gas per 1h0m0s \\(123 gas already spent\\)", second.errorReplies[0].err.Error())
+	assert.Equal([]string{"eth_sendTransaction", "eth_getTransactionReceipt"}, testRPC.calls)
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/utils"
+)
+
+// TesseraConf configures the third-party API of Tessera, used to store the payloads of private
+// transactions before they are signed, for Quorum nodes that do not accept privateFor
+// on eth_sendTransaction
+type TesseraConf struct {
+	utils.HTTPRequesterConf
+	URL string `json:"url"`
+}
+
+type tesseraStore struct {
+	conf *TesseraConf
+	hr   *utils.HTTPRequester
+}
+
+func newTesseraStore(conf *TesseraConf) eth.PrivatePayloadStore {
+	return &tesseraStore{
+		conf: conf,
+		hr:   utils.NewHTTPRequester("Tessera", &conf.HTTPRequesterConf),
+	}
+}
+
+// StoreRaw stores the payload with Tessera, which returns the hash the transaction carries
+// in place of the payload
+func (t *tesseraStore) StoreRaw(payload []byte, privateFrom string) ([]byte, error) {
+	body := map[string]interface{}{
+		"payload": base64.StdEncoding.EncodeToString(payload),
+	}
+	if privateFrom != "" {
+		body["from"] = privateFrom
+	}
+	res, err := t.hr.DoRequest("POST", strings.TrimSuffix(t.conf.URL, "/")+"/storeraw", body)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.Errorf(errors.TesseraStoreRawFailed, "404")
+	}
+	key, err := t.hr.GetResponseString(res, "key", false)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.Errorf(errors.TesseraStoreRawFailed, err)
+	}
+	return hash, nil
+}
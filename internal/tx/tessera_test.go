@@ -0,0 +1,73 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTesseraStoreRawOK(t *testing.T) {
+	assert := assert.New(t)
+
+	var body map[string]interface{}
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("POST", req.Method)
+		assert.Equal("/storeraw", req.URL.Path)
+		json.NewDecoder(req.Body).Decode(&body)
+		res.Header().Set("Content-Type", "application/json")
+		res.Write([]byte(`{"key":"aGFzaA=="}`))
+	}))
+	defer svr.Close()
+
+	store := newTesseraStore(&TesseraConf{URL: svr.URL + "/"})
+	hash, err := store.StoreRaw([]byte("payload"), "sender=")
+	assert.NoError(err)
+	assert.Equal([]byte("hash"), hash)
+	assert.Equal("cGF5bG9hZA==", body["payload"])
+	assert.Equal("sender=", body["from"])
+}
+
+func TestTesseraStoreRawErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	reply := `{"key":"!!!"}`
+	status := 200
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+		res.Write([]byte(reply))
+	}))
+	defer svr.Close()
+
+	store := newTesseraStore(&TesseraConf{URL: svr.URL})
+	_, err := store.StoreRaw([]byte("payload"), "")
+	assert.Regexp("Failed to store private payload with Tessera", err)
+
+	reply = `{}`
+	_, err = store.StoreRaw([]byte("payload"), "")
+	assert.Regexp("key", err)
+
+	status = 404
+	_, err = store.StoreRaw([]byte("payload"), "")
+	assert.Regexp("Failed to store private payload with Tessera: 404", err)
+
+	status = 500
+	_, err = store.StoreRaw([]byte("payload"), "")
+	assert.Error(err)
+}
@@ -40,3 +40,21 @@ type TxnContext interface {
 	// Get a string summary
 	String() string
 }
+
+// TxnConfirmationContext is implemented by contexts that can deliver a follow-up reply,
+// after the original reply has been sent. Only these contexts have confirmations tracked
+type TxnConfirmationContext interface {
+	TxnContext
+	// Send a follow-up reply for a request that has already been replied to.
+	// Sets all the common headers on behalf of the caller, based on the request context
+	ReplyConfirmed(replyMsg messages.ReplyWithHeaders)
+}
+
+// TxnProgressContext is implemented by contexts that can deliver intermediate status messages,
+// before the reply is sent. Only these contexts have the progress of deployments reported
+type TxnProgressContext interface {
+	TxnContext
+	// Send a progress message for a request that has not yet been replied to.
+	// Sets all the common headers on behalf of the caller, based on the request context
+	ReplyProgress(progressMsg messages.ReplyWithHeaders)
+}
@@ -15,8 +15,12 @@
 package tx
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"math/big"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -27,6 +31,7 @@ import (
 	ethbinding "github.com/kaleido-io/ethbinding/pkg"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/eth"
+	"github.com/kaleido-io/ethconnect/internal/ethbind"
 	"github.com/kaleido-io/ethconnect/internal/messages"
 	"github.com/kaleido-io/ethconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
@@ -34,6 +39,12 @@ import (
 
 const (
 	defaultSendConcurrency = 1
+	defaultNonceShards     = 16
+	nonceShardQueueLength  = 10
+	// DefaultRecoverInFlightWindowSec is how far back the receipt store is searched at startup
+	// for transactions that were submitted, but not mined
+	DefaultRecoverInFlightWindowSec = 86400
+	defaultConfirmationPollInterval = 5 * time.Second
 )
 
 // TxnProcessor interface is called for each message, as is responsible
@@ -42,6 +53,28 @@ type TxnProcessor interface {
 	OnMessage(TxnContext)
 	Init(eth.RPCClient)
 	ResolveAddress(from string) (resolvedFrom string, err error)
+	InFlightStatus() map[string][]*InFlightTxnStatus
+	NonceReport(ctx context.Context, addresses []string) ([]*NonceReport, error)
+	ResumeTransaction(txnContext TxnContext, txHash string, nonce int64)
+	SetAddressNameResolver(resolver AddressNameResolver)
+	SetMethodChecker(checker MethodChecker)
+	SetSignerPolicy(policy SignerPolicy)
+	Close()
+}
+
+// MethodChecker checks a transaction is allowed to invoke the function its calldata selects
+// on the contract it is sent to, such as by the method lists of a registered contract
+type MethodChecker interface {
+	CheckMethod(to string, data []byte) error
+}
+
+// InFlightTxnStatus is a point-in-time view of a transaction that has not yet completed
+type InFlightTxnStatus struct {
+	RequestID       string  `json:"requestId"`
+	Nonce           string  `json:"nonce"`
+	TransactionHash string  `json:"transactionHash,omitempty"`
+	AgeSeconds      float64 `json:"ageSeconds"`
+	ReceiptChecks   int     `json:"receiptChecks"`
 }
 
 var highestID = 1000000
@@ -57,16 +90,38 @@ type inflightTxn struct {
 	tx               *eth.Txn
 	wg               sync.WaitGroup
 	registerAs       string // passed from request to reply
+	errorABI         ethbinding.ABIMarshaling
+	revertReason     string
 	rpc              eth.RPCClient
 	signer           eth.TXSigner
 	gapFillSucceeded bool
 	gapFillTxHash    string
+	timeReceived     time.Time
+	receiptChecks    int
+	progress         TxnProgressContext // set when the progress of a deployment is reported
+	maxGas           uint64
+	suppliedFrom     string       // the from address, or signer, before it was resolved
+	spend            *spendRecord // set when spend limits are enforced
 }
 
 func (i *inflightTxn) nonceNumber() json.Number {
 	return json.Number(strconv.FormatInt(i.nonce, 10))
 }
 
+// reportProgress sends a progress message, if enabled for the request
+func (i *inflightTxn) reportProgress(progress *messages.TransactionProgress) {
+	if i.progress != nil {
+		log.Infof("Deployment reached stage '%s': %s", progress.Stage, i)
+		i.progress.ReplyProgress(progress)
+	}
+}
+
+// rpcContext returns the context of the request, with an affinity for the from address. So where
+// traffic is spread across a pool of nodes, the nonce, send and receipt of a transaction use one node
+func (i *inflightTxn) rpcContext() context.Context {
+	return eth.WithRPCAffinity(i.txnContext.Context(), i.from)
+}
+
 func (i *inflightTxn) String() string {
 	txHash := ""
 	if i.tx != nil {
@@ -77,14 +132,63 @@ func (i *inflightTxn) String() string {
 
 // TxnProcessorConf configuration for the message processor
 type TxnProcessorConf struct {
-	AlwaysManageNonce  bool            `json:"alwaysManageNonce"`
-	AttemptGapFill     bool            `json:"attemptGapFill"`
-	MaxTXWaitTime      int             `json:"maxTXWaitTime"`
-	SendConcurrency    int             `json:"sendConcurrency"`
-	OrionPrivateAPIS   bool            `json:"orionPrivateAPIs"`
-	HexValuesInReceipt bool            `json:"hexValuesInReceipt"`
-	AddressBookConf    AddressBookConf `json:"addressBook"`
-	HDWalletConf       HDWalletConf    `json:"hdWallet"`
+	AlwaysManageNonce  bool              `json:"alwaysManageNonce"`
+	AttemptGapFill     bool              `json:"attemptGapFill"`
+	MaxTXWaitTime      int               `json:"maxTXWaitTime"`
+	StageTimeouts      StageTimeoutsConf `json:"stageTimeouts"`
+	SendConcurrency    int               `json:"sendConcurrency"`
+	NonceShards        int               `json:"nonceShards"`
+	OrionPrivateAPIS   bool              `json:"orionPrivateAPIs"`
+	HexValuesInReceipt bool              `json:"hexValuesInReceipt"`
+	ReceiptTimestamps  bool              `json:"receiptTimestamps"`
+	RevertReasons      bool              `json:"revertReasons"`
+	ConfirmationBlocks int               `json:"confirmationBlocks"`
+	DeployProgress     bool              `json:"deployProgress"`
+	RecoverInFlight    bool              `json:"recoverInFlight"`
+	RecoverWindowSec   int               `json:"recoverInFlightWindowSec"`
+	MaxGas             int               `json:"maxGas"`
+	AddressPolicy      AddressPolicyConf `json:"addressPolicy"`
+	SpendLimits        SpendLimitsConf   `json:"spendLimits"`
+	NodeHealth         NodeHealthConf    `json:"nodeHealth"`
+	Tessera            TesseraConf       `json:"tessera"`
+	StrictAddresses    bool              `json:"strictAddresses"`
+	AddressBookConf    AddressBookConf   `json:"addressBook"`
+	HDWalletConf       HDWalletConf      `json:"hdWallet"`
+	KMSConf            KMSConf           `json:"kms"`
+	KeystoreConf       KeystoreConf      `json:"keystore"`
+	RPCCallMethods     []string          `json:"rpcCallMethods,omitempty"`
+}
+
+// StageTimeoutsConf limits the time spent in each stage of processing a transaction
+type StageTimeoutsConf struct {
+	CompileSec     int `json:"compileSec"`     // 0=unlimited
+	GasEstimateSec int `json:"gasEstimateSec"` // 0=30s
+	SignSec        int `json:"signSec"`        // 0=30s
+	SubmitSec      int `json:"submitSec"`      // 0=30s
+	ReceiptSec     int `json:"receiptSec"`     // 0=maxTXWaitTime
+}
+
+// ValidateConf checks the configuration of the HTTP clients used by the processor
+func (conf *TxnProcessorConf) ValidateConf() error {
+	if err := conf.AddressBookConf.HTTPRequesterConf.ValidateConf(); err != nil {
+		return err
+	}
+	if err := conf.Tessera.HTTPRequesterConf.ValidateConf(); err != nil {
+		return err
+	}
+	if err := conf.AddressPolicy.validate(); err != nil {
+		return err
+	}
+	if err := conf.SpendLimits.validate(); err != nil {
+		return err
+	}
+	if err := conf.KMSConf.HTTPRequesterConf.ValidateConf(); err != nil {
+		return err
+	}
+	if err := conf.KMSConf.validate(); err != nil {
+		return err
+	}
+	return conf.HDWalletConf.HTTPRequesterConf.ValidateConf()
 }
 
 type inflightTxnState struct {
@@ -100,9 +204,23 @@ type txnProcessor struct {
 	rpc                eth.RPCClient
 	addressBook        AddressBook
 	hdwallet           HDWallet
+	kms                KMS
+	keystore           Keystore
 	conf               *TxnProcessorConf
 	rpcConf            *eth.RPCConf
 	concurrencySlots   chan bool
+	nonceShards        []*sync.Mutex
+	nonceShardQueues   []chan func()
+	shardQueuesLock    sync.RWMutex
+	blockTimestamps    *eth.BlockTimestampCache
+	confirmationPoll   time.Duration
+	nodeHealth         *nodeHealth
+	tessera            eth.PrivatePayloadStore
+	addressPolicy      *addressPolicy
+	spendLimits        *spendLimiter
+	rpcCallMethods     *eth.RPCMethodAllowList
+	methodChecker      MethodChecker
+	signerPolicy       SignerPolicy
 }
 
 // NewTxnProcessor constructor for message procss
@@ -110,6 +228,9 @@ func NewTxnProcessor(conf *TxnProcessorConf, rpcConf *eth.RPCConf) TxnProcessor
 	if conf.SendConcurrency == 0 {
 		conf.SendConcurrency = defaultSendConcurrency
 	}
+	if conf.NonceShards <= 0 {
+		conf.NonceShards = defaultNonceShards
+	}
 	p := &txnProcessor{
 		inflightTxnsLock:   &sync.Mutex{},
 		inflightTxns:       make(map[string]*inflightTxnState),
@@ -117,6 +238,18 @@ func NewTxnProcessor(conf *TxnProcessorConf, rpcConf *eth.RPCConf) TxnProcessor
 		conf:               conf,
 		rpcConf:            rpcConf,
 		concurrencySlots:   make(chan bool, conf.SendConcurrency),
+		confirmationPoll:   defaultConfirmationPollInterval,
+		nonceShards:        make([]*sync.Mutex, conf.NonceShards),
+		rpcCallMethods:     eth.NewRPCMethodAllowList(conf.RPCCallMethods),
+	}
+	for i := range p.nonceShards {
+		p.nonceShards[i] = &sync.Mutex{}
+	}
+	if conf.AddressPolicy.enabled() {
+		p.addressPolicy = &addressPolicy{conf: &conf.AddressPolicy, signerAddress: p.ResolveAddress}
+	}
+	if conf.SpendLimits.enabled() {
+		p.spendLimits = newSpendLimiter(&conf.SpendLimits)
 	}
 	return p
 }
@@ -130,14 +263,69 @@ func (p *txnProcessor) Init(rpc eth.RPCClient) {
 	if p.conf.HDWalletConf.URLTemplate != "" {
 		p.hdwallet = newHDWallet(&p.conf.HDWalletConf)
 	}
+	if p.conf.KMSConf.URLTemplate != "" {
+		var err error
+		if p.kms, err = newKMS(&p.conf.KMSConf); err != nil {
+			// ValidateConf rejects this configuration at startup, so the KMS is left unconfigured
+			log.Errorf("Invalid KMS configuration: %s", err)
+		}
+	}
+	if p.conf.KeystoreConf.Path != "" {
+		p.keystore = newKeystore(&p.conf.KeystoreConf)
+	}
+	if p.conf.ReceiptTimestamps {
+		p.blockTimestamps, _ = eth.BlockTimestampCacheFor(rpc, eth.DefaultBlockTimestampCacheSize)
+	}
+	if p.conf.Tessera.URL != "" {
+		p.tessera = newTesseraStore(&p.conf.Tessera)
+	}
+	if p.conf.NodeHealth.Enabled {
+		p.nodeHealth = newNodeHealth(&p.conf.NodeHealth, rpc)
+	}
+	p.shardQueuesLock.Lock()
+	defer p.shardQueuesLock.Unlock()
+	if p.conf.SendConcurrency > 1 && p.nonceShardQueues == nil {
+		// Each shard processes the messages for its addresses on its own worker, until the processor is closed
+		p.nonceShardQueues = make([]chan func(), len(p.nonceShards))
+		for i := range p.nonceShardQueues {
+			p.nonceShardQueues[i] = make(chan func(), nonceShardQueueLength)
+			go p.nonceShardWorker(p.nonceShardQueues[i])
+		}
+	}
 }
 
 // CobraInitTxnProcessor sets the standard command-line parameters for the txnprocessor
 func CobraInitTxnProcessor(cmd *cobra.Command, txconf *TxnProcessorConf) {
 	cmd.Flags().IntVarP(&txconf.MaxTXWaitTime, "tx-timeout", "x", utils.DefInt("ETH_TX_TIMEOUT", 0), "Maximum wait time for an individual transaction (seconds)")
+	cmd.Flags().IntVar(&txconf.StageTimeouts.CompileSec, "compile-timeout", utils.DefInt("ETH_COMPILE_TIMEOUT", 0), "Maximum time to compile the Solidity source of a deployment (seconds, 0=unlimited)")
+	cmd.Flags().IntVar(&txconf.StageTimeouts.GasEstimateSec, "gas-estimate-timeout", utils.DefInt("ETH_GAS_ESTIMATE_TIMEOUT", 0), "Maximum time to estimate the gas of a transaction (seconds, 0=30)")
+	cmd.Flags().IntVar(&txconf.StageTimeouts.SignSec, "sign-timeout", utils.DefInt("ETH_SIGN_TIMEOUT", 0), "Maximum time to sign a transaction with a remote signer, such as a KMS (seconds, 0=30)")
+	cmd.Flags().IntVar(&txconf.StageTimeouts.SubmitSec, "submit-timeout", utils.DefInt("ETH_SUBMIT_TIMEOUT", 0), "Maximum time to submit a transaction to the node (seconds, 0=30)")
+	cmd.Flags().IntVar(&txconf.StageTimeouts.ReceiptSec, "receipt-timeout", utils.DefInt("ETH_RECEIPT_TIMEOUT", 0), "Maximum time to poll for the receipt of a submitted transaction (seconds, 0=tx-timeout)")
 	cmd.Flags().BoolVarP(&txconf.HexValuesInReceipt, "hex-values", "H", false, "Include hex values for large numbers in receipts (as well as numeric strings)")
 	cmd.Flags().BoolVarP(&txconf.AlwaysManageNonce, "predict-nonces", "P", false, "Predict the next nonce before sending (default=false for node-signed txns)")
 	cmd.Flags().BoolVarP(&txconf.OrionPrivateAPIS, "orion-privapi", "G", false, "Use Orion JSON/RPC API semantics for private transactions")
+	cmd.Flags().BoolVar(&txconf.StrictAddresses, "strict-addresses", false, "Validate the EIP-55 checksum of mixed-case address parameters")
+	cmd.Flags().BoolVar(&txconf.ReceiptTimestamps, "receipt-timestamps", false, "Include the block timestamp in receipts")
+	cmd.Flags().BoolVar(&txconf.RevertReasons, "revert-reasons", false, "Replay failed transactions with eth_call to include the decoded revert reason in receipts")
+	cmd.Flags().IntVar(&txconf.ConfirmationBlocks, "confirmations", utils.DefInt("ETH_CONFIRMATIONS", 0), "Blocks to wait after a transaction is mined before sending a TransactionConfirmed follow-up (0=disabled)")
+	cmd.Flags().IntVar(&txconf.NonceShards, "nonce-shards", utils.DefInt("ETH_NONCE_SHARDS", defaultNonceShards), "Number of shards that from addresses are hashed across, so nonces are assigned to different addresses concurrently")
+	cmd.Flags().IntVar(&txconf.MaxGas, "max-gas", utils.DefInt("ETH_MAX_GAS", 0), "Maximum gas limit of a transaction, supplied or estimated (0=unlimited)")
+	cmd.Flags().StringVar(&txconf.Tessera.URL, "tessera-url", os.Getenv("TESSERA_URL"), "Tessera third-party API URL, to store the payloads of private transactions signed by a HD wallet (storeraw)")
+	cmd.Flags().BoolVar(&txconf.NodeHealth.Enabled, "node-health-check", false, "Check the node is not syncing, and has peers, before dispatching transactions to it")
+	cmd.Flags().IntVar(&txconf.NodeHealth.MinPeers, "node-min-peers", utils.DefInt("ETH_NODE_MIN_PEERS", 1), "Minimum peers of the node for transactions to be dispatched, when checking node health (0=not checked)")
+	cmd.Flags().IntVar(&txconf.NodeHealth.WaitSec, "node-health-wait", utils.DefInt("ETH_NODE_HEALTH_WAIT", 0), "Seconds to hold transactions waiting for an unhealthy node before rejecting them (0=reject immediately)")
+	cmd.Flags().BoolVar(&txconf.DeployProgress, "deploy-progress", false, "Send TransactionProgress messages as async deployments are compiled, signed, submitted and mined")
+	cmd.Flags().BoolVar(&txconf.RecoverInFlight, "recover-inflight", false, "Record each transaction as it is submitted, and resume polling for the receipts of those still pending at startup")
+	cmd.Flags().IntVar(&txconf.RecoverWindowSec, "recover-inflight-window", DefaultRecoverInFlightWindowSec, "How far back to search the receipt store for pending transactions at startup (seconds)")
+	cmd.Flags().StringArrayVar(&txconf.AddressPolicy.AllowFrom, "allow-from", utils.DefStringArray("ETH_ALLOW_FROM"), "Address, wildcard pattern or name that transactions may be sent from. When set, all others are rejected")
+	cmd.Flags().StringArrayVar(&txconf.AddressPolicy.DenyFrom, "deny-from", utils.DefStringArray("ETH_DENY_FROM"), "Address, wildcard pattern or name that transactions must not be sent from")
+	cmd.Flags().StringArrayVar(&txconf.AddressPolicy.AllowTo, "allow-to", utils.DefStringArray("ETH_ALLOW_TO"), "Address, wildcard pattern or registered contract name that transactions may be sent to. When set, all others are rejected")
+	cmd.Flags().StringArrayVar(&txconf.AddressPolicy.DenyTo, "deny-to", utils.DefStringArray("ETH_DENY_TO"), "Address, wildcard pattern or registered contract name that transactions must not be sent to")
+	cmd.Flags().IntVar(&txconf.SpendLimits.WindowSec, "spend-window", utils.DefInt("ETH_SPEND_WINDOW", DefaultSpendLimitWindowSec), "Rolling window the spend limits of each signer apply over (seconds)")
+	cmd.Flags().StringVar(&txconf.SpendLimits.MaxValue, "spend-max-value", os.Getenv("ETH_SPEND_MAX_VALUE"), "Maximum value in wei that each signer can transfer in the spend window (default unlimited)")
+	cmd.Flags().IntVar(&txconf.SpendLimits.MaxGas, "spend-max-gas", utils.DefInt("ETH_SPEND_MAX_GAS", 0), "Maximum gas that each signer can spend in the spend window (0=unlimited)")
+	cmd.Flags().StringArrayVar(&txconf.RPCCallMethods, "rpc-call-methods", utils.DefStringArray("ETH_RPC_CALL_METHODS"), "JSON/RPC method that RPCCall messages may invoke, with a trailing * to match a prefix (default none)")
 	return
 }
 
@@ -150,20 +338,38 @@ func (p *txnProcessor) OnMessage(txnContext TxnContext) {
 	var unmarshalErr error
 	headers := txnContext.Headers()
 	log.Debugf("Processing %+v", headers)
+	// RPCCall messages are not held for an unhealthy node, as they are used to diagnose it
+	if p.nodeHealth != nil && headers.MsgType != messages.MsgTypeRPCCall {
+		if err := p.nodeHealth.waitUntilHealthy(txnContext.Context()); err != nil {
+			txnContext.SendErrorReply(503, err)
+			return
+		}
+	}
 	switch headers.MsgType {
 	case messages.MsgTypeDeployContract:
 		var deployContractMsg messages.DeployContract
 		if unmarshalErr = txnContext.Unmarshal(&deployContractMsg); unmarshalErr != nil {
 			break
 		}
-		p.OnDeployContractMessage(txnContext, &deployContractMsg)
+		p.dispatchForAddress(&deployContractMsg.TransactionCommon, func() {
+			p.OnDeployContractMessage(txnContext, &deployContractMsg)
+		})
 		break
 	case messages.MsgTypeSendTransaction:
 		var sendTransactionMsg messages.SendTransaction
 		if unmarshalErr = txnContext.Unmarshal(&sendTransactionMsg); unmarshalErr != nil {
 			break
 		}
-		p.OnSendTransactionMessage(txnContext, &sendTransactionMsg)
+		p.dispatchForAddress(&sendTransactionMsg.TransactionCommon, func() {
+			p.OnSendTransactionMessage(txnContext, &sendTransactionMsg)
+		})
+		break
+	case messages.MsgTypeRPCCall:
+		var rpcCallMsg messages.RPCCall
+		if unmarshalErr = txnContext.Unmarshal(&rpcCallMsg); unmarshalErr != nil {
+			break
+		}
+		p.OnRPCCallMessage(txnContext, &rpcCallMsg)
 		break
 	default:
 		unmarshalErr = errors.Errorf(errors.TransactionSendMsgTypeUnknown, headers.MsgType)
@@ -175,8 +381,30 @@ func (p *txnProcessor) OnMessage(txnContext TxnContext) {
 
 }
 
+// SetAddressNameResolver sets the resolver for the names in the address policy and spend
+// limits, such as those of the contracts registered with the REST gateway
+func (p *txnProcessor) SetAddressNameResolver(resolver AddressNameResolver) {
+	if p.addressPolicy != nil {
+		p.addressPolicy.resolver = resolver
+	}
+	if p.spendLimits != nil {
+		p.spendLimits.resolver = resolver
+	}
+}
+
+// SetMethodChecker sets the check applied to the calldata of every transaction sent to a contract
+func (p *txnProcessor) SetMethodChecker(checker MethodChecker) {
+	p.methodChecker = checker
+}
+
+// SetSignerPolicy sets the policy that selects and checks the signer backend of every transaction
+// sent to a contract
+func (p *txnProcessor) SetSignerPolicy(policy SignerPolicy) {
+	p.signerPolicy = policy
+}
+
 func (p *txnProcessor) ResolveAddress(from string) (resolvedFrom string, err error) {
-	signer, err := p.resolveSigner(from)
+	signer, err := p.resolveSigner("", from)
 	if signer != nil {
 		resolvedFrom = signer.Address()
 	} else if err == nil {
@@ -185,7 +413,15 @@ func (p *txnProcessor) ResolveAddress(from string) (resolvedFrom string, err err
 	return
 }
 
-func (p *txnProcessor) resolveSigner(from string) (signer eth.TXSigner, err error) {
+// resolveSigner returns the signer of a transaction signed by the gateway, rather than the node.
+// The KMS and keystore sign only for transactions that select them
+func (p *txnProcessor) resolveSigner(backend, from string) (signer eth.TXSigner, err error) {
+	switch backend {
+	case SignerKMS:
+		return p.kms.SignerFor(from)
+	case SignerKeystore:
+		return p.keystore.SignerFor(from)
+	}
 	if hdWalletRequest := IsHDWalletRequest(from); hdWalletRequest != nil {
 		if p.hdwallet == nil {
 			err = errors.Errorf(errors.HDWalletSigningNoConfig)
@@ -203,18 +439,28 @@ func (p *txnProcessor) resolveSigner(from string) (signer eth.TXSigner, err erro
 // nonce for the transaction.
 // Builds a new wrapper containing this information, that can be added to
 // the inflight list if the transaction is submitted
-func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.TransactionCommon) (inflight *inflightTxn, err error) {
+// newInflightTxn resolves the signer, JSON/RPC connection and from address of a transaction,
+// before it is assigned a nonce
+func (p *txnProcessor) newInflightTxn(txnContext TxnContext, msg *messages.TransactionCommon) (inflight *inflightTxn, from ethbinding.Address, err error) {
 
 	inflight = &inflightTxn{
-		txnContext: txnContext,
+		txnContext:   txnContext,
+		timeReceived: time.Now().UTC(),
+	}
+	if inflight.maxGas, err = p.maxGasFor(msg); err != nil {
+		return nil, from, err
 	}
 
 	// Use the correct RPC for sending transactions
 	inflight.rpc = p.rpc
-	if inflight.signer, err = p.resolveSigner(msg.From); inflight.signer != nil {
+	inflight.suppliedFrom = msg.From
+	if err = p.checkSignerBackend(msg.Signer, msg.From); err != nil {
+		return nil, from, err
+	}
+	if inflight.signer, err = p.resolveSigner(msg.Signer, msg.From); inflight.signer != nil {
 		msg.From = inflight.signer.Address()
 	} else if err != nil {
-		return nil, err
+		return nil, from, err
 	} else if p.addressBook != nil {
 		if inflight.rpc, err = p.addressBook.lookup(txnContext.Context(), msg.From); err != nil {
 			return
@@ -222,11 +468,20 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 	}
 
 	// Validate the from address, and normalize to lower case with 0x prefix
-	from, err := utils.StrToAddress("from", msg.From)
-	if err != nil {
+	if from, err = utils.StrToAddress("from", msg.From); err != nil {
 		return
 	}
 	inflight.from = strings.ToLower(from.Hex())
+	err = p.addressPolicy.checkFrom(inflight.suppliedFrom, inflight.from)
+	return
+}
+
+func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.TransactionCommon) (inflight *inflightTxn, err error) {
+
+	inflight, from, err := p.newInflightTxn(txnContext, msg)
+	if err != nil {
+		return nil, err
+	}
 
 	// Need to resolve privateFrom/privateFor to a privacyGroupID for Orion
 	if p.conf.OrionPrivateAPIS {
@@ -244,9 +499,14 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 
 	nodeAssignNonce := inflight.signer == nil && !p.conf.AlwaysManageNonce
 
-	// Hold the lock just while we're adding it to the map and dealing with nonce checking.
-	p.inflightTxnsLock.Lock()
+	// Nonces are assigned to one address at a time, holding the lock of its shard for the
+	// duration - including any query to the node. Other addresses in other shards are not
+	// held up by the query, as the lock on the in-flight map is only held to update it.
+	shard := p.nonceShard(inflight.from)
+	shard.Lock()
+	defer shard.Unlock()
 
+	p.inflightTxnsLock.Lock()
 	// The user can supply a nonce and manage them externally, using their own
 	// application-side list of transactions, to prevent the possibility of
 	// duplication that exists when dynamically calculating the nonce
@@ -254,27 +514,21 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 	highestID++
 	var highestNonce int64 = -1
 	suppliedNonce := msg.Nonce
-	inflightForAddr, exists := p.inflightTxns[inflight.from]
-	// Add the inflight transaction to our tracking structure
-	if !exists {
-		p.inflightTxns[inflight.from] = &inflightTxnState{}
-		inflightForAddr = p.inflightTxns[inflight.from]
-		inflightForAddr.txnsInFlight = []*inflightTxn{}
-	}
-
 	if !nodeAssignNonce && suppliedNonce == "" {
 		// Check the currently inflight txns to see if we have a high nonce to use without
 		// needing to query the node to find the highest nonce.
-		if exists {
+		if inflightForAddr, exists := p.inflightTxns[inflight.from]; exists {
 			highestNonce = inflightForAddr.highestNonce
 		}
 	}
+	p.inflightTxnsLock.Unlock()
 
 	// We want to submit this transaction with the next nonce in the chain.
 	// If this is a node-signed transaction, then we can ask the node
 	// to simply use the next available nonce.
 	// We provide an override to force the Go code to always assign the nonce.
 	fromNode := false
+	updateHighest := false
 	if suppliedNonce != "" {
 		if inflight.nonce, err = suppliedNonce.Int64(); err != nil {
 			err = errors.Errorf(errors.TransactionSendBadNonce, err)
@@ -286,14 +540,13 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 		// Note: We do not have highestNonce calculation for in-flight private transactions,
 		//       so attempting to submit more than one per block currently will FAIL
 		if inflight.nonce, err = eth.GetOrionTXCount(txnContext.Context(), p.rpc, &from, inflight.privacyGroupID); err != nil {
-			p.inflightTxnsLock.Unlock()
 			return
 		}
 		fromNode = true
 	} else if highestNonce >= 0 {
 		// If we found a nonce in-flight in memory, store & return one higher.
 		inflight.nonce = highestNonce + 1
-		inflightForAddr.highestNonce = inflight.nonce
+		updateHighest = true
 	} else if nodeAssignNonce {
 		// We've been asked to defer to the node for signing, and are not performing HD Wallet signing
 		inflight.nodeAssignNonce = true
@@ -304,14 +557,26 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 		// we need to accept the possibility of 'replacement transaction underpriced'
 		// (or if gas price is being varied by the submitter the potential of
 		// overwriting a transaction)
-		if inflight.nonce, err = eth.GetTransactionCount(txnContext.Context(), p.rpc, &from, "pending"); err != nil {
-			p.inflightTxnsLock.Unlock()
+		if inflight.nonce, err = eth.GetTransactionCount(inflight.rpcContext(), p.rpc, &from, "pending"); err != nil {
 			return
 		}
-		inflightForAddr.highestNonce = inflight.nonce // store the nonce in our inflight txns state
+		updateHighest = true // store the nonce in our inflight txns state
 		fromNode = true
 	}
 
+	// Hold the lock just while we're adding it to the map
+	p.inflightTxnsLock.Lock()
+	inflightForAddr, exists := p.inflightTxns[inflight.from]
+	// Add the inflight transaction to our tracking structure
+	if !exists {
+		inflightForAddr = &inflightTxnState{
+			txnsInFlight: []*inflightTxn{},
+		}
+		p.inflightTxns[inflight.from] = inflightForAddr
+	}
+	if updateHighest {
+		inflightForAddr.highestNonce = inflight.nonce
+	}
 	before := len(inflightForAddr.txnsInFlight)
 	inflightForAddr.txnsInFlight = append(inflightForAddr.txnsInFlight, inflight)
 	inflight.initialWaitDelay = p.inflightTxnDelayer.GetInitialDelay() // Must call under lock
@@ -324,9 +589,108 @@ func (p *txnProcessor) addInflightWrapper(txnContext TxnContext, msg *messages.T
 	return
 }
 
+// InFlightStatus returns a snapshot of all the transactions currently in-flight, keyed by from address
+func (p *txnProcessor) InFlightStatus() map[string][]*InFlightTxnStatus {
+	p.inflightTxnsLock.Lock()
+	defer p.inflightTxnsLock.Unlock()
+
+	now := time.Now().UTC()
+	status := make(map[string][]*InFlightTxnStatus, len(p.inflightTxns))
+	for from, inflightForAddr := range p.inflightTxns {
+		txnsStatus := make([]*InFlightTxnStatus, 0, len(inflightForAddr.txnsInFlight))
+		for _, inflight := range inflightForAddr.txnsInFlight {
+			txnStatus := &InFlightTxnStatus{
+				Nonce:         strconv.FormatInt(inflight.nonce, 10),
+				AgeSeconds:    now.Sub(inflight.timeReceived).Seconds(),
+				ReceiptChecks: inflight.receiptChecks,
+			}
+			if inflight.txnContext != nil && inflight.txnContext.Headers() != nil {
+				txnStatus.RequestID = inflight.txnContext.Headers().ID
+			}
+			if inflight.tx != nil {
+				txnStatus.TransactionHash = inflight.tx.Hash
+			}
+			txnsStatus = append(txnsStatus, txnStatus)
+		}
+		status[from] = txnsStatus
+	}
+	return status
+}
+
+// nonceShardIndex hashes an address to a shard, so it is always assigned the same shard
+func (p *txnProcessor) nonceShardIndex(from string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(from))
+	return h.Sum32() % uint32(len(p.nonceShards))
+}
+
+// nonceShard returns the lock that serializes the assignment of nonces for an address
+func (p *txnProcessor) nonceShard(from string) *sync.Mutex {
+	return p.nonceShards[p.nonceShardIndex(from)]
+}
+
+// dispatchForAddress processes a transaction message on the worker of the shard of its from
+// address, when sends are concurrent. So a slow query for the nonce of one address does not
+// hold up the messages for addresses in other shards, while the messages for each address are
+// processed in the order they arrived. With a send concurrency of 1, or once the processor is
+// closed, the message is processed synchronously
+func (p *txnProcessor) dispatchForAddress(msg *messages.TransactionCommon, process func()) {
+	queued := false
+	if p.conf.SendConcurrency > 1 {
+		shard := p.nonceShardIndex(p.shardAddress(msg))
+		p.shardQueuesLock.RLock()
+		if p.nonceShardQueues != nil {
+			p.nonceShardQueues[shard] <- process
+			queued = true
+		}
+		p.shardQueuesLock.RUnlock()
+	}
+	if !queued {
+		process()
+	}
+}
+
+// shardAddress returns the address a message is sent from, resolving an HD wallet reference to
+// the address of its signer and normalizing it to lower case with a 0x prefix, as the in-flight
+// transactions are keyed. So every message for an address is processed by the same shard, however
+// its from is written. A from that cannot be resolved is rejected when the message is processed
+func (p *txnProcessor) shardAddress(msg *messages.TransactionCommon) string {
+	from := msg.From
+	if p.checkSignerBackend(msg.Signer, from) == nil {
+		if signer, err := p.resolveSigner(msg.Signer, from); signer != nil && err == nil {
+			from = signer.Address()
+		}
+	}
+	if addr, err := utils.StrToAddress("from", from); err == nil {
+		return strings.ToLower(addr.Hex())
+	}
+	return strings.ToLower(from)
+}
+
+// Close stops the shard workers started by Init, once they have processed the messages
+// already queued for them
+func (p *txnProcessor) Close() {
+	p.shardQueuesLock.Lock()
+	defer p.shardQueuesLock.Unlock()
+	for _, queue := range p.nonceShardQueues {
+		close(queue)
+	}
+	p.nonceShardQueues = nil
+}
+
+func (p *txnProcessor) nonceShardWorker(queue chan func()) {
+	for process := range queue {
+		process()
+	}
+}
+
 func (p *txnProcessor) cancelInFlight(inflight *inflightTxn, submitted bool) {
 	var before, after int
 	var highestNonce int64 = -1
+	// The shard is held while the in-flight list is updated, so a nonce being assigned
+	// to the same address concurrently is not lost from the check for a gap
+	shard := p.nonceShard(inflight.from)
+	shard.Lock()
 	p.inflightTxnsLock.Lock()
 	if inflightForAddr, exists := p.inflightTxns[inflight.from]; exists {
 		// Remove from the in-flight list
@@ -359,6 +723,7 @@ func (p *txnProcessor) cancelInFlight(inflight *inflightTxn, submitted bool) {
 		}
 	}
 	p.inflightTxnsLock.Unlock()
+	shard.Unlock()
 
 	log.Infof("In-flight %d complete. nonce=%d addr=%s nan=%t sub=%t before=%d after=%d highest=%d", inflight.id, inflight.nonce, inflight.from, inflight.nodeAssignNonce, submitted, before, after, highestNonce)
 
@@ -377,7 +742,7 @@ func (p *txnProcessor) submitGapFillTX(inflight *inflightTxn) {
 		tx, err := eth.NewNilTX(inflight.from, inflight.nonce, inflight.signer)
 		if err == nil {
 			inflight.gapFillTxHash = tx.EthTX.Hash().String()
-			err = tx.Send(inflight.txnContext.Context(), inflight.rpc)
+			err = tx.Send(inflight.rpcContext(), inflight.rpc)
 			if err != nil {
 				inflight.gapFillSucceeded = false
 				log.Warnf("Submission of gap-fill TX '%s' failed: %s", tx.Hash, err)
@@ -389,6 +754,15 @@ func (p *txnProcessor) submitGapFillTX(inflight *inflightTxn) {
 	}
 }
 
+// receiptWaitTime is how long to poll for the receipt of a submitted transaction,
+// which is the overall transaction timeout unless configured separately
+func (p *txnProcessor) receiptWaitTime() time.Duration {
+	if p.conf.StageTimeouts.ReceiptSec > 0 {
+		return time.Duration(p.conf.StageTimeouts.ReceiptSec) * time.Second
+	}
+	return p.maxTXWaitTime
+}
+
 // waitForCompletion is the goroutine to track a transaction through
 // to completion and send the result
 func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay time.Duration) {
@@ -398,6 +772,7 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 	// both latency beyond the block period, and avoiding spamming the node
 	// with REST calls for long block periods, or when there is a backlog
 	replyWaitStart := time.Now().UTC()
+	receiptWaitTime := p.receiptWaitTime()
 	time.Sleep(initialWaitDelay)
 
 	var isMined, timedOut bool
@@ -406,14 +781,18 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 	var elapsed time.Duration
 	for !isMined && !timedOut {
 
-		if isMined, err = inflight.tx.GetTXReceipt(inflight.txnContext.Context(), p.rpc); err != nil {
+		p.inflightTxnsLock.Lock()
+		inflight.receiptChecks++
+		p.inflightTxnsLock.Unlock()
+
+		if isMined, err = inflight.tx.GetTXReceipt(inflight.rpcContext(), p.rpc); err != nil {
 			// We wait even on connectivity errors, as we've submitted the transaction and
 			// we want to provide a receipt if connectivity resumes within the timeout
 			log.Infof("Failed to get receipt for %s (retries=%d): %s", inflight, retries, err)
 		}
 
 		elapsed = time.Now().UTC().Sub(replyWaitStart)
-		timedOut = elapsed > p.maxTXWaitTime
+		timedOut = elapsed > receiptWaitTime
 		if !isMined && !timedOut {
 			// Need to have the inflight lock to calculate the delay, but not
 			// while we're waiting
@@ -438,66 +817,222 @@ func (p *txnProcessor) waitForCompletion(inflight *inflightTxn, initialWaitDelay
 		p.inflightTxnsLock.Lock()
 		p.inflightTxnDelayer.ReportSuccess(elapsed)
 		p.inflightTxnsLock.Unlock()
+		if inflight.tx.Receipt.GasUsed != nil {
+			p.spendLimits.settle(inflight.spend, inflight.tx.Receipt.GasUsed.ToInt().Uint64())
+		}
 
-		receipt := inflight.tx.Receipt
-		isSuccess := (receipt.Status != nil && receipt.Status.ToInt().Int64() > 0)
+		reply, isSuccess := p.buildReceiptReply(inflight)
 		log.Infof("Receipt for %s obtained after %.2fs Success=%t", inflight.tx.Hash, elapsed.Seconds(), isSuccess)
-
-		// Build our reply
-		var reply messages.TransactionReceipt
-		if isSuccess {
-			reply.Headers.MsgType = messages.MsgTypeTransactionSuccess
-		} else {
-			reply.Headers.MsgType = messages.MsgTypeTransactionFailure
+		stageTimes := inflight.tx.StageTimes
+		stageTimes.Receipt = elapsed.Seconds()
+		reply.StageTimes = &stageTimes
+		mined := messages.NewTransactionProgress(messages.ProgressStageMined)
+		mined.TransactionHash = inflight.tx.Hash
+		mined.BlockNumberStr = reply.BlockNumberStr
+		if reply.ContractAddress != nil {
+			mined.ContractAddress = strings.ToLower(reply.ContractAddress.Hex())
 		}
-		reply.BlockHash = receipt.BlockHash
-		if p.conf.HexValuesInReceipt {
-			reply.BlockNumberHex = receipt.BlockNumber
-		}
-		if receipt.BlockNumber != nil {
-			reply.BlockNumberStr = receipt.BlockNumber.ToInt().Text(10)
-		}
-		reply.ContractAddress = receipt.ContractAddress
-		reply.RegisterAs = inflight.registerAs
-		if p.conf.HexValuesInReceipt {
-			reply.CumulativeGasUsedHex = receipt.CumulativeGasUsed
+		inflight.reportProgress(mined)
+		inflight.txnContext.Reply(reply)
+
+		// Continue tracking the transaction until it has enough blocks on top of it, if configured
+		if confirmer, ok := inflight.txnContext.(TxnConfirmationContext); ok && p.conf.ConfirmationBlocks > 0 && inflight.tx.Receipt.BlockNumber != nil {
+			inflight.wg.Add(1)
+			go p.waitForConfirmations(inflight, confirmer)
 		}
-		if receipt.CumulativeGasUsed != nil {
-			reply.CumulativeGasUsedStr = receipt.CumulativeGasUsed.ToInt().Text(10)
+	}
+
+	// We've submitted the transaction, even if we didn't get a receipt within our timeout.
+	p.cancelInFlight(inflight, true)
+	inflight.wg.Done()
+}
+
+// buildReceiptReply builds the reply for the receipt currently stored on the transaction
+func (p *txnProcessor) buildReceiptReply(inflight *inflightTxn) (reply *messages.TransactionReceipt, isSuccess bool) {
+	receipt := inflight.tx.Receipt
+	isSuccess = (receipt.Status != nil && receipt.Status.ToInt().Int64() > 0)
+	reply = &messages.TransactionReceipt{}
+	reply.ContractAddress = receipt.ContractAddress
+	if inflight.tx.FactoryDeployAddress != nil {
+		reply.ContractAddress = inflight.tx.FactoryDeployAddress
+		if isSuccess {
+			reply.RevertReason = p.factoryDeployFailure(inflight)
+			isSuccess = reply.RevertReason == ""
 		}
-		reply.From = receipt.From
-		if p.conf.HexValuesInReceipt {
-			reply.GasUsedHex = receipt.GasUsed
+	}
+	if isSuccess {
+		reply.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	} else {
+		reply.Headers.MsgType = messages.MsgTypeTransactionFailure
+	}
+	reply.BlockHash = receipt.BlockHash
+	if p.conf.HexValuesInReceipt {
+		reply.BlockNumberHex = receipt.BlockNumber
+	}
+	if receipt.BlockNumber != nil {
+		reply.BlockNumberStr = receipt.BlockNumber.ToInt().Text(10)
+		p.addBlockTimestampToReply(inflight.txnContext.Context(), reply, receipt.BlockNumber)
+	}
+	reply.RegisterAs = inflight.registerAs
+	if p.conf.HexValuesInReceipt {
+		reply.CumulativeGasUsedHex = receipt.CumulativeGasUsed
+	}
+	if receipt.CumulativeGasUsed != nil {
+		reply.CumulativeGasUsedStr = receipt.CumulativeGasUsed.ToInt().Text(10)
+	}
+	reply.From = receipt.From
+	if p.conf.HexValuesInReceipt {
+		reply.GasUsedHex = receipt.GasUsed
+	}
+	if receipt.GasUsed != nil {
+		reply.GasUsedStr = receipt.GasUsed.ToInt().Text(10)
+	}
+	p.addFeeToReply(reply, inflight.tx)
+	nonceHex := ethbinding.HexUint64(inflight.nonce)
+	if p.conf.HexValuesInReceipt {
+		reply.NonceHex = &nonceHex
+	}
+	reply.NonceStr = strconv.FormatInt(inflight.nonce, 10)
+	if p.conf.HexValuesInReceipt {
+		reply.StatusHex = receipt.Status
+	}
+	if receipt.Status != nil {
+		reply.StatusStr = receipt.Status.ToInt().Text(10)
+	}
+	reply.To = receipt.To
+	reply.TransactionHash = receipt.TransactionHash
+	if p.conf.HexValuesInReceipt {
+		reply.TransactionIndexHex = receipt.TransactionIndex
+	}
+	if receipt.TransactionIndex != nil {
+		reply.TransactionIndexStr = strconv.FormatUint(uint64(*receipt.TransactionIndex), 10)
+	}
+	if isSuccess && inflight.tx.ABI != nil {
+		reply.Events = eth.DecodeReceiptEvents(inflight.tx.ABI, reply.ContractAddress, receipt.Logs)
+	}
+	if !isSuccess && receipt.RevertReason != "" {
+		reply.RevertReason = eth.DecodeRevertReason(receipt.RevertReason, inflight.errorABI)
+	} else if !isSuccess && reply.RevertReason == "" {
+		reply.RevertReason = p.replayRevertReason(inflight)
+	}
+	return reply, isSuccess
+}
+
+// replayRevertReason obtains the revert reason of a failed transaction whose receipt does
+// not include one, by replaying it at the block it was mined in, if configured. The reason
+// is kept, so it is only obtained once for the receipt and any confirmation that follows
+func (p *txnProcessor) replayRevertReason(inflight *inflightTxn) string {
+	if !p.conf.RevertReasons || inflight.tx.Receipt.BlockNumber == nil {
+		return ""
+	}
+	if inflight.revertReason == "" {
+		inflight.revertReason = inflight.tx.GetRevertReason(inflight.txnContext.Context(), inflight.rpc, inflight.tx.Receipt.BlockNumber, inflight.errorABI)
+	}
+	return inflight.revertReason
+}
+
+// waitForConfirmations polls the block height after a transaction has been mined, until
+// the configured number of blocks have been mined on top of it. The receipt is checked
+// again at that point, as a re-org might have removed the transaction, or moved it to
+// a different block. Then a follow-up reply is sent with the final receipt
+func (p *txnProcessor) waitForConfirmations(inflight *inflightTxn, confirmer TxnConfirmationContext) {
+	defer inflight.wg.Done()
+
+	ctx := inflight.txnContext.Context()
+	confirmations := big.NewInt(int64(p.conf.ConfirmationBlocks))
+	minedIn := inflight.tx.Receipt.BlockHash
+	target := new(big.Int).Add(inflight.tx.Receipt.BlockNumber.ToInt(), confirmations)
+	waitStart := time.Now().UTC()
+	for time.Now().UTC().Sub(waitStart) <= p.maxTXWaitTime {
+		time.Sleep(p.confirmationPoll)
+
+		var blockNumber ethbinding.HexBigInt
+		if err := p.rpc.CallContext(ctx, &blockNumber, "eth_blockNumber"); err != nil {
+			log.Infof("Failed to get block number while confirming %s: %s", inflight, err)
+			continue
 		}
-		if receipt.GasUsed != nil {
-			reply.GasUsedStr = receipt.GasUsed.ToInt().Text(10)
+		if target != nil && blockNumber.ToInt().Cmp(target) < 0 {
+			log.Debugf("Waiting for block %s to confirm %s (current=%s)", target.Text(10), inflight, blockNumber.ToInt().Text(10))
+			continue
 		}
-		nonceHex := ethbinding.HexUint64(inflight.nonce)
-		if p.conf.HexValuesInReceipt {
-			reply.NonceHex = &nonceHex
+
+		// Clear the receipt first, as a null result leaves it unchanged
+		inflight.tx.Receipt = eth.TxnReceipt{}
+		isMined, err := inflight.tx.GetTXReceipt(ctx, p.rpc)
+		if err != nil {
+			log.Infof("Failed to get receipt while confirming %s: %s", inflight, err)
+			continue
 		}
-		reply.NonceStr = strconv.FormatInt(inflight.nonce, 10)
-		if p.conf.HexValuesInReceipt {
-			reply.StatusHex = receipt.Status
+		receipt := &inflight.tx.Receipt
+		if !isMined || receipt.BlockNumber == nil {
+			log.Warnf("Receipt for %s no longer available after a re-org. Waiting for it to be mined again", inflight)
+			target = nil
+			continue
 		}
-		if receipt.Status != nil {
-			reply.StatusStr = receipt.Status.ToInt().Text(10)
+		if target == nil || minedIn == nil || receipt.BlockHash == nil || *receipt.BlockHash != *minedIn {
+			log.Warnf("%s mined again in block %s after a re-org", inflight, receipt.BlockNumber.ToInt().Text(10))
+			minedIn = receipt.BlockHash
+			target = new(big.Int).Add(receipt.BlockNumber.ToInt(), confirmations)
+			continue
 		}
-		reply.To = receipt.To
-		reply.TransactionHash = receipt.TransactionHash
+
+		reply, isSuccess := p.buildReceiptReply(inflight)
+		reply.Headers.MsgType = messages.MsgTypeTransactionConfirmed
+		reply.ConfirmationsStr = new(big.Int).Sub(blockNumber.ToInt(), receipt.BlockNumber.ToInt()).Text(10)
+		log.Infof("Receipt for %s confirmed after %s blocks Success=%t", inflight.tx.Hash, reply.ConfirmationsStr, isSuccess)
+		confirmer.ReplyConfirmed(reply)
+		return
+	}
+
+	errReply := messages.NewErrorReply(errors.Errorf(errors.TransactionConfirmationTimeout, p.conf.ConfirmationBlocks), []byte{})
+	errReply.TXHash = inflight.tx.Hash
+	confirmer.ReplyConfirmed(errReply)
+}
+
+// addBlockTimestampToReply adds the timestamp of the block, if configured. Failure to
+// look up the block does not prevent the receipt being sent
+func (p *txnProcessor) addBlockTimestampToReply(ctx context.Context, reply *messages.TransactionReceipt, blockNumber *ethbinding.HexBigInt) {
+	if p.blockTimestamps == nil {
+		return
+	}
+	ts, err := p.blockTimestamps.GetBlockTimestamp(ctx, p.rpc, blockNumber.String())
+	if err != nil {
+		log.Errorf("Unable to retrieve block[%s] timestamp for receipt: %s", blockNumber.String(), err)
+		return
+	}
+	reply.BlockTimestamp = strconv.FormatUint(ts, 10)
+}
+
+// addFeeToReply adds the effective gas price, and the total fee paid, to the reply.
+// Nodes that pre-date EIP-1559 do not return effectiveGasPrice in the receipt,
+// so we fall back to the gas price we submitted in the transaction
+func (p *txnProcessor) addFeeToReply(reply *messages.TransactionReceipt, tx *eth.Txn) {
+	receipt := &tx.Receipt
+	effectiveGasPrice := receipt.EffectiveGasPrice
+	if effectiveGasPrice == nil && tx.EthTX != nil && tx.EthTX.GasPrice() != nil {
+		effectiveGasPrice = (*ethbinding.HexBigInt)(tx.EthTX.GasPrice())
+	}
+	if effectiveGasPrice == nil {
+		return
+	}
+	if p.conf.HexValuesInReceipt {
+		reply.EffectiveGasPriceHex = effectiveGasPrice
+	}
+	reply.EffectiveGasPriceStr = effectiveGasPrice.ToInt().Text(10)
+	if receipt.GasUsed != nil {
+		fee := new(big.Int).Mul(receipt.GasUsed.ToInt(), effectiveGasPrice.ToInt())
 		if p.conf.HexValuesInReceipt {
-			reply.TransactionIndexHex = receipt.TransactionIndex
+			reply.FeeHex = (*ethbinding.HexBigInt)(fee)
 		}
-		if receipt.TransactionIndex != nil {
-			reply.TransactionIndexStr = strconv.FormatUint(uint64(*receipt.TransactionIndex), 10)
-		}
-
-		inflight.txnContext.Reply(&reply)
+		reply.FeeStr = fee.Text(10)
+		reply.FeeEther = weiToEther(fee)
 	}
+}
 
-	// We've submitted the transaction, even if we didn't get a receipt within our timeout.
-	p.cancelInFlight(inflight, true)
-	inflight.wg.Done()
+// weiToEther formats an amount in wei as a decimal string in ether, without trailing zeros
+func weiToEther(wei *big.Int) string {
+	ether := new(big.Rat).SetFrac(wei, big.NewInt(1000000000000000000)).FloatString(18)
+	return strings.TrimSuffix(strings.TrimRight(ether, "0"), ".")
 }
 
 // addInflight adds a transaction to the inflight list, and kick off
@@ -513,47 +1048,264 @@ func (p *txnProcessor) trackMining(inflight *inflightTxn, tx *eth.Txn) {
 
 func (p *txnProcessor) OnDeployContractMessage(txnContext TxnContext, msg *messages.DeployContract) {
 
+	if msg.DryRun {
+		p.dryRunDeployContract(txnContext, msg)
+		return
+	}
+
 	inflight, err := p.addInflightWrapper(txnContext, &msg.TransactionCommon)
 	if err != nil {
 		txnContext.SendErrorReply(400, err)
 		return
 	}
 	inflight.registerAs = msg.RegisterAs
+	inflight.errorABI = eth.ErrorEntries(msg.ABI)
+	if progress, ok := txnContext.(TxnProgressContext); ok && p.conf.DeployProgress {
+		inflight.progress = progress
+	}
 	msg.Nonce = inflight.nonceNumber()
 
-	tx, err := eth.NewContractDeployTxn(msg, inflight.signer)
+	tx, err := p.newDeployTxn(inflight, msg)
 	if err != nil {
 		p.cancelInFlight(inflight, false /* not yet submitted */)
 		txnContext.SendErrorReply(400, err)
 		return
 	}
+	if tx.FactoryDeployAddress != nil && !tx.IsPrivate() {
+		// eth_getCode only queries public state, so a private deployment goes ahead without these checks
+		existing, status, err := p.existingFactoryDeployment(txnContext.Context(), inflight, tx)
+		if err != nil || existing != nil {
+			p.cancelInFlight(inflight, false /* not submitted */)
+			if err != nil {
+				txnContext.SendErrorReply(status, err)
+			} else {
+				txnContext.Reply(existing)
+			}
+			return
+		}
+	}
+	inflight.reportProgress(messages.NewTransactionProgress(messages.ProgressStageCompiled))
+	if inflight.progress != nil {
+		tx.Signed = func() {
+			inflight.reportProgress(messages.NewTransactionProgress(messages.ProgressStageSigned))
+		}
+	}
 
 	p.sendTransactionCommon(txnContext, inflight, tx)
 }
 
 func (p *txnProcessor) OnSendTransactionMessage(txnContext TxnContext, msg *messages.SendTransaction) {
 
+	if err := p.addressPolicy.checkTo(msg.To); err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+	if p.signerPolicy != nil {
+		signer, err := p.signerPolicy.CheckSigner(msg.To, msg.Signer)
+		if err != nil {
+			txnContext.SendErrorReply(400, err)
+			return
+		}
+		msg.Signer = signer
+	}
 	inflight, err := p.addInflightWrapper(txnContext, &msg.TransactionCommon)
 	if err != nil {
 		txnContext.SendErrorReply(400, err)
 		return
 	}
+	inflight.errorABI = eth.ErrorEntries(msg.Errors)
 	msg.Nonce = inflight.nonceNumber()
 
-	tx, err := eth.NewSendTxn(msg, inflight.signer)
+	tx, err := eth.NewSendTxn(msg, inflight.signer, p.conf.StrictAddresses)
 	if err != nil {
 		p.cancelInFlight(inflight, false /* not yet submitted */)
 		txnContext.SendErrorReply(400, err)
 		return
 	}
+	if p.methodChecker != nil {
+		if err := p.methodChecker.CheckMethod(msg.To, tx.EthTX.Data()); err != nil {
+			p.cancelInFlight(inflight, false /* not yet submitted */)
+			txnContext.SendErrorReply(403, err)
+			return
+		}
+	}
 
 	p.sendTransactionCommon(txnContext, inflight, tx)
 }
 
-func (p *txnProcessor) sendTransactionCommon(txnContext TxnContext, inflight *inflightTxn, tx *eth.Txn) {
+// newDeployTxn builds the transaction for a deployment, which calls the singleton factory when requested
+func (p *txnProcessor) newDeployTxn(inflight *inflightTxn, msg *messages.DeployContract) (*eth.Txn, error) {
+	compileTimeout := time.Duration(p.conf.StageTimeouts.CompileSec) * time.Second
+	if msg.SingletonFactory {
+		return eth.NewSingletonFactoryDeployTxn(msg, inflight.signer, p.conf.StrictAddresses, compileTimeout)
+	}
+	return eth.NewContractDeployTxn(msg, inflight.signer, p.conf.StrictAddresses, compileTimeout)
+}
+
+// existingFactoryDeployment checks the singleton factory is deployed on the chain, then checks for a
+// contract already at the address the factory would create it at. As the address only depends on the
+// code and salt, a receipt for the existing contract is returned in place of deploying it again.
+// Nil is returned when there is no contract there yet
+func (p *txnProcessor) existingFactoryDeployment(ctx context.Context, inflight *inflightTxn, tx *eth.Txn) (*messages.TransactionReceipt, int, error) {
+	factory := ethbind.API.HexToAddress(eth.SingletonFactoryAddress)
+	code, err := eth.GetCode(ctx, inflight.rpc, &factory, "latest")
+	if err != nil {
+		return nil, 500, errors.Errorf(errors.DeploySingletonFactoryCodeCheckFailed, eth.SingletonFactoryAddress, err)
+	}
+	if len(code) == 0 {
+		return nil, 400, errors.Errorf(errors.DeploySingletonFactoryMissing, eth.SingletonFactoryAddress)
+	}
+	code, err = eth.GetCode(ctx, inflight.rpc, tx.FactoryDeployAddress, "latest")
+	if err != nil {
+		return nil, 500, errors.Errorf(errors.DeploySingletonFactoryCodeCheckFailed, tx.FactoryDeployAddress.Hex(), err)
+	}
+	if len(code) == 0 {
+		return nil, 0, nil
+	}
+	log.Infof("Skipping deployment through the singleton factory, as a contract already exists at %s", tx.FactoryDeployAddress.Hex())
+	reply := &messages.TransactionReceipt{}
+	reply.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	reply.ContractAddress = tx.FactoryDeployAddress
+	reply.RegisterAs = inflight.registerAs
+	from := tx.From
+	reply.From = &from
+	reply.To = tx.EthTX.To()
+	reply.AlreadyDeployed = true
+	return reply, 200, nil
+}
+
+// factoryDeployFailure returns the reason a transaction to the singleton factory succeeded without creating
+// the contract. The factory does not revert when CREATE2 fails, for example when it runs out of gas
+func (p *txnProcessor) factoryDeployFailure(inflight *inflightTxn) string {
+	if inflight.tx.IsPrivate() {
+		return "" // the contract is in private state, which cannot be checked
+	}
+	code, err := eth.GetCode(inflight.txnContext.Context(), inflight.rpc, inflight.tx.FactoryDeployAddress, "latest")
+	if err != nil {
+		log.Warnf("Unable to check the singleton factory created %s: %s", inflight.tx.FactoryDeployAddress.Hex(), err)
+		return ""
+	}
+	if len(code) == 0 {
+		return errors.Errorf(errors.DeploySingletonFactoryNotCreated, inflight.tx.FactoryDeployAddress.Hex()).Error()
+	}
+	return ""
+}
+
+// maxGasFor returns the cap on the gas limit of a transaction, which is the lower of the configured
+// maximum and any maximum on the message - such as that set by the transaction policy of a contract
+func (p *txnProcessor) maxGasFor(msg *messages.TransactionCommon) (uint64, error) {
+	maxGas := uint64(p.conf.MaxGas)
+	if msg.MaxGas != "" {
+		msgMaxGas, err := strconv.ParseUint(msg.MaxGas.String(), 10, 64)
+		if err != nil {
+			return 0, errors.Errorf(errors.TransactionSendBadMaxGas, msg.MaxGas)
+		}
+		if maxGas == 0 || (msgMaxGas > 0 && msgMaxGas < maxGas) {
+			maxGas = msgMaxGas
+		}
+	}
+	return maxGas, nil
+}
+
+// dryRunDeployContract prepares the transaction for a deployment exactly as it would be submitted,
+// but replies with what would have been submitted rather than broadcasting it. The nonce is
+// predicted rather than assigned, so the dry run does not affect the transactions in-flight
+func (p *txnProcessor) dryRunDeployContract(txnContext TxnContext, msg *messages.DeployContract) {
+
+	inflight, from, err := p.newInflightTxn(txnContext, &msg.TransactionCommon)
+	if err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+	if inflight.nonce, err = p.predictNonce(txnContext.Context(), inflight, from, msg.Nonce); err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+	msg.Nonce = inflight.nonceNumber()
+
+	tx, err := p.newDeployTxn(inflight, msg)
+	if err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+	p.configureTxn(inflight, tx)
+	result, err := tx.DryRun(txnContext.Context(), inflight.rpc)
+	if err != nil {
+		txnContext.SendErrorReply(400, err)
+		return
+	}
+
+	reply := &messages.DeployContractDryRun{}
+	reply.Headers.MsgType = messages.MsgTypeDeployContractDryRun
+	reply.From = inflight.from
+	reply.NonceStr = strconv.FormatInt(inflight.nonce, 10)
+	contractAddress := eth.ContractAddress(from, uint64(inflight.nonce))
+	if tx.FactoryDeployAddress != nil {
+		contractAddress = *tx.FactoryDeployAddress
+	}
+	reply.ContractAddress = &contractAddress
+	reply.Data = ethbinding.HexBytes(result.Data).String()
+	reply.GasStr = strconv.FormatUint(result.Gas, 10)
+	gasPrice := result.GasPrice
+	if gasPrice == nil {
+		gasPrice = big.NewInt(0)
+	}
+	reply.GasPriceStr = gasPrice.Text(10)
+	cost := new(big.Int).Mul(new(big.Int).SetUint64(result.Gas), gasPrice)
+	reply.EstimatedCostStr = cost.Text(10)
+	reply.EstimatedCostEther = weiToEther(cost)
+	stageTimes := tx.StageTimes
+	reply.StageTimes = &stageTimes
+	log.Infof("Dry run of deployment from %s nonce=%d would deploy %s", inflight.from, inflight.nonce, contractAddress.Hex())
+	txnContext.Reply(reply)
+}
+
+// predictNonce returns the nonce a transaction from the address would be assigned, without
+// reserving it. The nonce a node would assign is predicted from its pending transaction count
+func (p *txnProcessor) predictNonce(ctx context.Context, inflight *inflightTxn, from ethbinding.Address, suppliedNonce json.Number) (int64, error) {
+	if suppliedNonce != "" {
+		nonce, err := suppliedNonce.Int64()
+		if err != nil {
+			return -1, errors.Errorf(errors.TransactionSendBadNonce, err)
+		}
+		return nonce, nil
+	}
+	nodeAssignNonce := inflight.signer == nil && !p.conf.AlwaysManageNonce
+	if !nodeAssignNonce {
+		p.inflightTxnsLock.Lock()
+		inflightForAddr, exists := p.inflightTxns[inflight.from]
+		p.inflightTxnsLock.Unlock()
+		if exists {
+			return inflightForAddr.highestNonce + 1, nil
+		}
+	}
+	return eth.GetTransactionCount(eth.WithRPCAffinity(ctx, inflight.from), inflight.rpc, &from, "pending")
+}
+
+// configureTxn applies the processor configuration, and the details resolved for the in-flight transaction, to a transaction
+func (p *txnProcessor) configureTxn(inflight *inflightTxn, tx *eth.Txn) {
 	tx.OrionPrivateAPIS = p.conf.OrionPrivateAPIS
+	tx.MaxGas = inflight.maxGas
 	tx.PrivacyGroupID = inflight.privacyGroupID
 	tx.NodeAssignNonce = inflight.nodeAssignNonce
+	tx.Timeouts = eth.TxnTimeouts{
+		GasEstimate: time.Duration(p.conf.StageTimeouts.GasEstimateSec) * time.Second,
+		Sign:        time.Duration(p.conf.StageTimeouts.SignSec) * time.Second,
+		Submit:      time.Duration(p.conf.StageTimeouts.SubmitSec) * time.Second,
+	}
+	if p.tessera != nil {
+		tx.PrivatePayloadStore = p.tessera
+	}
+	if p.spendLimits != nil {
+		tx.Approve = func() (err error) {
+			inflight.spend, err = p.spendLimits.reserve(inflight.suppliedFrom, inflight.from, tx.EthTX.Value(), tx.EthTX.Gas())
+			return err
+		}
+	}
+}
+
+func (p *txnProcessor) sendTransactionCommon(txnContext TxnContext, inflight *inflightTxn, tx *eth.Txn) {
+	p.configureTxn(inflight, tx)
 
 	if p.conf.SendConcurrency > 1 {
 		// The above must happen synchronously for each partition in Kafka - as it is where we assign the nonce.
@@ -567,15 +1319,47 @@ func (p *txnProcessor) sendTransactionCommon(txnContext TxnContext, inflight *in
 }
 
 func (p *txnProcessor) sendAndTrackMining(txnContext TxnContext, inflight *inflightTxn, tx *eth.Txn) {
-	err := tx.Send(txnContext.Context(), inflight.rpc)
+	err := tx.Send(inflight.rpcContext(), inflight.rpc)
 	if p.conf.SendConcurrency > 1 {
 		<-p.concurrencySlots // return our slot as soon as send is complete, to let an awaiting send go
 	}
 	if err != nil {
+		p.spendLimits.release(inflight.spend)
 		p.cancelInFlight(inflight, false /* not confirmed as submitted, as send failed */)
 		txnContext.SendErrorReplyWithGapFill(400, err, inflight.gapFillTxHash, inflight.gapFillSucceeded)
 		return
 	}
+	submitted := messages.NewTransactionProgress(messages.ProgressStageSubmitted)
+	submitted.TransactionHash = tx.Hash
+	if !inflight.nodeAssignNonce {
+		submitted.NonceStr = inflight.nonceNumber().String()
+	}
+	if inflight.progress != nil {
+		inflight.reportProgress(submitted)
+	} else if progress, ok := txnContext.(TxnProgressContext); ok && p.conf.RecoverInFlight {
+		// Recorded so polling for the receipt can resume, if we restart before it is mined
+		progress.ReplyProgress(submitted)
+	}
 
 	p.trackMining(inflight, tx)
 }
+
+// ResumeTransaction polls for the receipt of a transaction that was submitted before a
+// restart, and replies with it as if the transaction had been submitted by this process.
+// The nonce is only used in the reply, as the transaction is not re-sent
+func (p *txnProcessor) ResumeTransaction(txnContext TxnContext, txHash string, nonce int64) {
+	inflight := &inflightTxn{
+		txnContext:   txnContext,
+		timeReceived: time.Now().UTC(),
+		nonce:        nonce,
+		rpc:          p.rpc,
+	}
+	p.inflightTxnsLock.Lock()
+	inflight.id = highestID
+	highestID++
+	inflight.initialWaitDelay = p.inflightTxnDelayer.GetInitialDelay() // Must call under lock
+	p.inflightTxnsLock.Unlock()
+
+	log.Infof("In-flight %d resumed. nonce=%d tx=%s", inflight.id, nonce, txHash)
+	p.trackMining(inflight, &eth.Txn{Hash: txHash})
+}
@@ -66,10 +66,22 @@ type testRPC struct {
 	ethGetTransactionCountErr      error
 	ethGetTransactionReceiptResult eth.TxnReceipt
 	ethGetTransactionReceiptErr    error
+	ethGetTransactionReceipts      []eth.TxnReceipt
+	ethBlockNumberResults          []int64
+	ethBlockNumberErr              error
 	privFindPrivacyGroupResult     []eth.OrionPrivacyGroup
 	privFindPrivacyGroupErr        error
 	ethEstimateGasResult           ethbinding.HexUint64
 	ethEstimateGasErr              error
+	ethGetBlockByNumberTime        uint64
+	ethGetBlockByNumberErr         error
+	ethCallResult                  string
+	ethCallErr                     error
+	ethGetCodeResult               ethbinding.HexBytes
+	ethGetCodeResults              []ethbinding.HexBytes
+	ethGetCodeErr                  error
+	adminResult                    json.RawMessage
+	adminErr                       error
 	condLock                       sync.Mutex
 	calls                          []string
 	params                         [][]interface{}
@@ -148,13 +160,44 @@ func (r *testRPC) CallContext(ctx context.Context, result interface{}, method st
 		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.privFindPrivacyGroupResult))
 		return r.privFindPrivacyGroupErr
 	} else if method == "eth_getTransactionReceipt" {
+		if len(r.ethGetTransactionReceipts) > 0 {
+			r.ethGetTransactionReceiptResult = r.ethGetTransactionReceipts[0]
+			r.ethGetTransactionReceipts = r.ethGetTransactionReceipts[1:]
+		}
 		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethGetTransactionReceiptResult))
 		return r.ethGetTransactionReceiptErr
+	} else if method == "priv_getTransactionReceipt" {
+		return nil
+	} else if method == "eth_blockNumber" {
+		if r.ethBlockNumberErr != nil || len(r.ethBlockNumberResults) == 0 {
+			err := r.ethBlockNumberErr
+			r.ethBlockNumberErr = nil
+			return err
+		}
+		result.(*ethbinding.HexBigInt).ToInt().SetInt64(r.ethBlockNumberResults[0])
+		if len(r.ethBlockNumberResults) > 1 {
+			r.ethBlockNumberResults = r.ethBlockNumberResults[1:]
+		}
+		return nil
 	} else if method == "eth_estimateGas" {
 		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(&r.ethEstimateGasResult))
 		return r.ethEstimateGasErr
 	} else if method == "eth_call" {
-		return nil
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethCallResult))
+		return r.ethCallErr
+	} else if method == "eth_getCode" {
+		if len(r.ethGetCodeResults) > 0 {
+			r.ethGetCodeResult = r.ethGetCodeResults[0]
+			r.ethGetCodeResults = r.ethGetCodeResults[1:]
+		}
+		reflect.ValueOf(result).Elem().Set(reflect.ValueOf(r.ethGetCodeResult))
+		return r.ethGetCodeErr
+	} else if method == "eth_getBlockByNumber" {
+		result.(*ethbinding.Header).Time = r.ethGetBlockByNumberTime
+		return r.ethGetBlockByNumberErr
+	} else if strings.HasPrefix(method, "admin_") {
+		*result.(*json.RawMessage) = r.adminResult
+		return r.adminErr
 	}
 	panic(fmt.Errorf("method unknown to test: %s", method))
 }
@@ -211,6 +254,26 @@ func (c *testTxnContext) Reply(replyMsg messages.ReplyWithHeaders) {
 	c.replies = append(c.replies, replyMsg)
 }
 
+type testConfirmationContext struct {
+	testTxnContext
+	confirmed []messages.ReplyWithHeaders
+}
+
+func (c *testConfirmationContext) ReplyConfirmed(replyMsg messages.ReplyWithHeaders) {
+	log.Infof("Sending confirmed reply: %s", replyMsg.ReplyHeaders().MsgType)
+	c.confirmed = append(c.confirmed, replyMsg)
+}
+
+type testProgressContext struct {
+	testTxnContext
+	progress []*messages.TransactionProgress
+}
+
+func (c *testProgressContext) ReplyProgress(progressMsg messages.ReplyWithHeaders) {
+	log.Infof("Sending progress: %s", progressMsg.ReplyHeaders().MsgType)
+	c.progress = append(c.progress, progressMsg.(*messages.TransactionProgress))
+}
+
 func TestOnMessageBadMessage(t *testing.T) {
 	assert := assert.New(t)
 
@@ -294,6 +357,7 @@ func goodMessageRPC() *testRPC {
 	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
 	contractAddr := ethbind.API.HexToAddress("0x28a62Cb478a3c3d4DAAD84F1148ea16cd1A66F37")
 	cumulativeGasUsed := ethbinding.HexBigInt(*big.NewInt(23456))
+	effectiveGasPrice := ethbinding.HexBigInt(*big.NewInt(20000000000))
 	fromAddr := ethbind.API.HexToAddress("0xBa25be62a5C55d4ad1d5520268806A8730A4DE5E")
 	gasUsed := ethbinding.HexBigInt(*big.NewInt(345678))
 	status := ethbinding.HexBigInt(*big.NewInt(1))
@@ -307,6 +371,7 @@ func goodMessageRPC() *testRPC {
 			BlockNumber:       &blockNumber,
 			ContractAddress:   &contractAddr,
 			CumulativeGasUsed: &cumulativeGasUsed,
+			EffectiveGasPrice: &effectiveGasPrice,
 			From:              &fromAddr,
 			GasUsed:           &gasUsed,
 			Status:            &status,
@@ -358,6 +423,9 @@ func TestOnDeployContractMessageGoodTxnMined(t *testing.T) {
 	assert.Equal("12345", replyMsgMap["blockNumber"])
 	assert.Equal("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37", replyMsgMap["contractAddress"])
 	assert.Equal("23456", replyMsgMap["cumulativeGasUsed"])
+	assert.Equal("20000000000", replyMsgMap["effectiveGasPrice"])
+	assert.Equal("6913560000000000", replyMsgMap["fee"])
+	assert.Equal("0.00691356", replyMsgMap["feeEther"])
 	assert.Equal("0xba25be62a5c55d4ad1d5520268806a8730a4de5e", replyMsgMap["from"])
 	assert.Equal("345678", replyMsgMap["gasUsed"])
 	assert.Equal("123", replyMsgMap["nonce"])
@@ -366,6 +434,309 @@ func TestOnDeployContractMessageGoodTxnMined(t *testing.T) {
 	assert.Equal("456789", replyMsgMap["transactionIndex"])
 }
 
+func TestOnDeployContractMessageStageTimes(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		StageTimeouts: StageTimeoutsConf{
+			GasEstimateSec: 5,
+			SignSec:        5,
+			SubmitSec:      5,
+		},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+	assert.Equal(0, len(testTxnContext.errorReplies))
+
+	replyMsg := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.NotNil(replyMsg.StageTimes)
+	assert.Greater(replyMsg.StageTimes.Submit, float64(0))
+	assert.Greater(replyMsg.StageTimes.Receipt, float64(0))
+}
+
+func TestReceiptWaitTime(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 60,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.Init(&testRPC{})
+	assert.Equal(60*time.Second, txnProcessor.receiptWaitTime())
+
+	txnProcessor.conf.StageTimeouts.ReceiptSec = 300
+	assert.Equal(300*time.Second, txnProcessor.receiptWaitTime())
+}
+
+func TestOnDeployContractMessageDryRun(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"DeployContract\"}," +
+		"  \"compiled\":\"YIA=\"," +
+		"  \"abi\":[]," +
+		"  \"from\":\"" + testFromAddr + "\"," +
+		"  \"gasPrice\":\"1000000000\"," +
+		"  \"dryRun\":true" +
+		"}"
+	testRPC := &testRPC{
+		ethGetTransactionCountResult: 5,
+		ethEstimateGasResult:         100000,
+	}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.errorReplies)
+	assert.Equal([]string{"eth_getTransactionCount", "eth_estimateGas"}, testRPC.calls)
+	assert.Empty(txnProcessor.inflightTxns)
+
+	reply := testTxnContext.replies[0].(*messages.DeployContractDryRun)
+	assert.Equal(messages.MsgTypeDeployContractDryRun, reply.Headers.MsgType)
+	assert.Equal(strings.ToLower(testFromAddr), reply.From)
+	assert.Equal("5", reply.NonceStr)
+	assert.Equal("0x6080", reply.Data)
+	assert.Equal("120000", reply.GasStr)
+	assert.Equal("1000000000", reply.GasPriceStr)
+	assert.Equal("120000000000000", reply.EstimatedCostStr)
+	assert.Equal("0.00012", reply.EstimatedCostEther)
+	assert.Equal(eth.ContractAddress(ethbind.API.HexToAddress(testFromAddr), 5), *reply.ContractAddress)
+	assert.Greater(reply.StageTimes.GasEstimate, float64(0))
+}
+
+var goodSingletonFactoryDeployTxnJSON = "{" +
+	"  \"headers\":{\"type\": \"DeployContract\"}," +
+	"  \"compiled\":\"YIA=\"," +
+	"  \"abi\":[]," +
+	"  \"from\":\"" + testFromAddr + "\"," +
+	"  \"nonce\":\"123\"," +
+	"  \"gas\":\"123\"," +
+	"  \"singletonFactory\":true" +
+	"}"
+
+func singletonFactoryTestAddress() ethbinding.Address {
+	var salt [32]byte
+	return eth.Create2Address(ethbind.API.HexToAddress(eth.SingletonFactoryAddress), salt, []byte{0x60, 0x80})
+}
+
+func TestOnDeployContractMessageSingletonFactory(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSingletonFactoryDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetCodeResults = []ethbinding.HexBytes{{0x60}, {}, {0x60, 0x80}}
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+	assert.Empty(testTxnContext.errorReplies)
+
+	assert.Equal([]string{"eth_getCode", "eth_getCode", "eth_sendTransaction", "eth_getTransactionReceipt", "eth_getCode"}, testRPC.calls)
+	assert.Equal(eth.SingletonFactoryAddress, testRPC.params[2][0].(*eth.SendTXArgs).To)
+
+	reply := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionSuccess, reply.Headers.MsgType)
+	assert.Equal(singletonFactoryTestAddress(), *reply.ContractAddress)
+	assert.False(reply.AlreadyDeployed)
+}
+
+func TestOnDeployContractMessageSingletonFactoryAlreadyDeployed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSingletonFactoryDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetCodeResult = ethbinding.HexBytes{0x60, 0x80}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.errorReplies)
+	assert.Equal([]string{"eth_getCode", "eth_getCode"}, testRPC.calls)
+	assert.Empty(txnProcessor.inflightTxns)
+
+	reply := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionSuccess, reply.Headers.MsgType)
+	assert.Equal(singletonFactoryTestAddress(), *reply.ContractAddress)
+	assert.True(reply.AlreadyDeployed)
+	assert.Nil(reply.TransactionHash)
+}
+
+func TestOnDeployContractMessageSingletonFactoryCodeCheckFails(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSingletonFactoryDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetCodeErr = fmt.Errorf("pop")
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(500, testTxnContext.errorReplies[0].status)
+	assert.Regexp("Failed to check for an existing contract at .*: eth_getCode returned: pop", testTxnContext.errorReplies[0].err)
+	assert.Empty(txnProcessor.inflightTxns)
+}
+
+func TestOnDeployContractMessageSingletonFactoryNotCreated(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSingletonFactoryDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetCodeResults = []ethbinding.HexBytes{{0x60}, {}, {}}
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+
+	reply := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionFailure, reply.Headers.MsgType)
+	assert.Equal("The singleton factory did not create a contract at "+singletonFactoryTestAddress().Hex(), reply.RevertReason)
+}
+
+func TestOnDeployContractMessageSingletonFactoryMissing(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSingletonFactoryDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "The ERC-2470 singleton factory is not deployed at "+eth.SingletonFactoryAddress+" on this chain")
+	assert.Equal([]string{"eth_getCode"}, testRPC.calls)
+	assert.Empty(txnProcessor.inflightTxns)
+}
+
+func TestOnDeployContractMessageSingletonFactoryPrivateSkipsCodeChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = strings.Replace(goodSingletonFactoryDeployTxnJSON, `"singletonFactory":true`,
+		`"singletonFactory":true, "privateFor":["s6a3mQ8IvrI2ZgHqHZlJaELiJs10HxlZNIwNd669FH4="]`, 1)
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+	txnWG.Wait()
+	assert.Empty(testTxnContext.errorReplies)
+
+	assert.Equal([]string{"eth_sendTransaction", "eth_getTransactionReceipt"}, testRPC.calls)
+	reply := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionSuccess, reply.Headers.MsgType)
+	assert.Equal(singletonFactoryTestAddress(), *reply.ContractAddress)
+}
+
+func TestOnDeployContractMessageDryRunPredictsInflightNonce(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		AlwaysManageNonce: true,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] = &inflightTxnState{highestNonce: 10}
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"DeployContract\"}," +
+		"  \"compiled\":\"YIA=\"," +
+		"  \"abi\":[]," +
+		"  \"from\":\"" + testFromAddr + "\"," +
+		"  \"gas\":\"50000\"," +
+		"  \"dryRun\":true" +
+		"}"
+	testRPC := &testRPC{}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.errorReplies)
+	assert.Empty(testRPC.calls)
+	reply := testTxnContext.replies[0].(*messages.DeployContractDryRun)
+	assert.Equal("11", reply.NonceStr)
+	assert.Equal("50000", reply.GasStr)
+	assert.Equal(int64(10), txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].highestNonce)
+}
+
+func TestOnDeployContractMessageDryRunGasEstimateFails(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"DeployContract\"}," +
+		"  \"compiled\":\"YIA=\"," +
+		"  \"abi\":[]," +
+		"  \"from\":\"" + testFromAddr + "\"," +
+		"  \"nonce\":\"3\"," +
+		"  \"dryRun\":true" +
+		"}"
+	testRPC := &testRPC{
+		ethEstimateGasErr: fmt.Errorf("pop"),
+		ethCallErr:        fmt.Errorf("reverted"),
+	}
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(400, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "reverted")
+	assert.NotContains(testRPC.calls, "eth_sendTransaction")
+}
+
 func TestOnDeployContractMessageGoodTxnMinedHDWallet(t *testing.T) {
 	assert := assert.New(t)
 
@@ -511,6 +882,8 @@ func TestOnDeployContractMessageGoodTxnMinedWithHex(t *testing.T) {
 	assert.Equal("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37", replyMsgMap["contractAddress"])
 	assert.Equal("23456", replyMsgMap["cumulativeGasUsed"])
 	assert.Equal("0x5ba0", replyMsgMap["cumulativeGasUsedHex"])
+	assert.Equal("0x4a817c800", replyMsgMap["effectiveGasPriceHex"])
+	assert.Equal("0x188fd89feef000", replyMsgMap["feeHex"])
 	assert.Equal("0xba25be62a5c55d4ad1d5520268806a8730a4de5e", replyMsgMap["from"])
 	assert.Equal("345678", replyMsgMap["gasUsed"])
 	assert.Equal("0x5464e", replyMsgMap["gasUsedHex"])
@@ -549,6 +922,70 @@ func TestOnDeployContractMessageFailedTxnMined(t *testing.T) {
 	assert.Equal("TransactionFailure", replyMsg.ReplyHeaders().MsgType)
 }
 
+func TestOnSendTransactionMessageFailedTxnMinedRevertReason(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	failStatus := ethbinding.HexBigInt(*big.NewInt(0))
+	testRPC.ethGetTransactionReceiptResult.Status = &failStatus
+	testRPC.ethGetTransactionReceiptResult.RevertReason = "0x4e487b710000000000000000000000000000000000000000000000000000000000000001"
+	txnProcessor.Init(testRPC)                          // configured in seconds for real world
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond // ... but fail asap for this test
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	replyMsg := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal("TransactionFailure", replyMsg.ReplyHeaders().MsgType)
+	assert.Equal("EVM panic (code 0x1): Assertion failed", replyMsg.RevertReason)
+}
+
+func TestOnSendTransactionMessageFailedTxnMinedReplayRevertReason(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+		RevertReasons: true,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"" + testFromAddr + "\"," +
+		"  \"gas\":\"123\"," +
+		"  \"method\":{\"name\":\"test\"}," +
+		"  \"errors\":[{\"type\":\"error\",\"name\":\"Unauthorized\",\"inputs\":[{\"name\":\"caller\",\"type\":\"address\"}]}]" +
+		"}"
+
+	testRPC := goodMessageRPC()
+	failStatus := ethbinding.HexBigInt(*big.NewInt(0))
+	testRPC.ethGetTransactionReceiptResult.Status = &failStatus
+	testRPC.ethCallResult = "0x8e4a23d6000000000000000000000000" + strings.ToLower(testFromAddr[2:])
+	txnProcessor.Init(testRPC)                          // configured in seconds for real world
+	txnProcessor.maxTXWaitTime = 250 * time.Millisecond // ... but fail asap for this test
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	replyMsg := testTxnContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal("TransactionFailure", replyMsg.ReplyHeaders().MsgType)
+	assert.Equal(`Custom error Unauthorized: {"caller":"`+strings.ToLower(testFromAddr)+`"}`, replyMsg.RevertReason)
+	assert.Contains(testRPC.calls, "eth_call")
+}
+
 func TestOnDeployContractMessageFailedTxn(t *testing.T) {
 	assert := assert.New(t)
 
@@ -638,7 +1075,67 @@ func TestOnSendTransactionMessageBadNonce(t *testing.T) {
 
 }
 
-func TestOnSendTransactionMessageBadMsg(t *testing.T) {
+func TestOnSendTransactionMessageGasExceedsMax(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxGas: 100,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Empty(testTxnContext.replies)
+	assert.Regexp("Gas 123 exceeds the maximum of 100", testTxnContext.errorReplies[0].err.Error())
+	assert.NotContains(testRPC.calls, "eth_sendTransaction")
+}
+
+func TestOnSendTransactionMessageBadMaxGas(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1\"," +
+		"  \"maxGas\":\"lots\"" +
+		"}"
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Empty(testTxnContext.replies)
+	assert.Regexp("Invalid maxGas 'lots'", testTxnContext.errorReplies[0].err.Error())
+}
+
+func TestMaxGasForLowestWins(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{MaxGas: 1000}, &eth.RPCConf{}).(*txnProcessor)
+	maxGas, err := txnProcessor.maxGasFor(&messages.TransactionCommon{})
+	assert.NoError(err)
+	assert.Equal(uint64(1000), maxGas)
+	maxGas, err = txnProcessor.maxGasFor(&messages.TransactionCommon{MaxGas: "500"})
+	assert.NoError(err)
+	assert.Equal(uint64(500), maxGas)
+	maxGas, err = txnProcessor.maxGasFor(&messages.TransactionCommon{MaxGas: "2000"})
+	assert.NoError(err)
+	assert.Equal(uint64(1000), maxGas)
+
+	txnProcessor.conf.MaxGas = 0
+	maxGas, err = txnProcessor.maxGasFor(&messages.TransactionCommon{MaxGas: "2000"})
+	assert.NoError(err)
+	assert.Equal(uint64(2000), maxGas)
+}
+
+func TestOnSendTransactionMessageBadMsg(t *testing.T) {
 	assert := assert.New(t)
 
 	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
@@ -661,6 +1158,44 @@ func TestOnSendTransactionMessageBadMsg(t *testing.T) {
 
 }
 
+type testMethodChecker struct {
+	to   string
+	data []byte
+	err  error
+}
+
+func (c *testMethodChecker) CheckMethod(to string, data []byte) error {
+	c.to = to
+	c.data = data
+	return c.err
+}
+
+func TestOnSendTransactionMessageMethodNotAllowed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	checker := &testMethodChecker{err: fmt.Errorf("pop")}
+	txnProcessor.SetMethodChecker(checker)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = "{" +
+		"  \"headers\":{\"type\": \"SendTransaction\"}," +
+		"  \"from\":\"0x83dBC8e329b38cBA0Fc4ed99b1Ce9c2a390ABdC1\"," +
+		"  \"to\":\"0x2b8c0ECc76d0759a8F50b2E14A6881367D805832\"," +
+		"  \"nonce\":\"123\"," +
+		"  \"data\":\"0x41c0e1b5\"" +
+		"}"
+	txnProcessor.OnMessage(testTxnContext)
+	for len(testTxnContext.errorReplies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Empty(testTxnContext.replies)
+	assert.Equal(403, testTxnContext.errorReplies[0].status)
+	assert.EqualError(testTxnContext.errorReplies[0].err, "pop")
+	assert.Equal("0x2b8c0ECc76d0759a8F50b2E14A6881367D805832", checker.to)
+	assert.Equal([]byte{0x41, 0xc0, 0xe1, 0xb5}, checker.data)
+}
+
 func TestOnSendTransactionMessageBadJSON(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1117,6 +1652,76 @@ func TestOnSendTransactionMessageOrionPrivacyGroupId(t *testing.T) {
 	assert.EqualValues([]string{"priv_getTransactionCount", "eea_sendTransaction"}, testRPC.calls)
 }
 
+func TestAddFeeToReplyFallbackToTXGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	gasUsed := ethbinding.HexBigInt(*big.NewInt(21000))
+	tx := &eth.Txn{
+		EthTX: ethbind.API.NewTransaction(0, ethbind.API.HexToAddress(testFromAddr), big.NewInt(0), 21000, big.NewInt(1000000000), []byte{}),
+		Receipt: eth.TxnReceipt{
+			GasUsed: &gasUsed,
+		},
+	}
+	var reply messages.TransactionReceipt
+	p.addFeeToReply(&reply, tx)
+	assert.Equal("1000000000", reply.EffectiveGasPriceStr)
+	assert.Equal("21000000000000", reply.FeeStr)
+	assert.Equal("0.000021", reply.FeeEther)
+	assert.Nil(reply.FeeHex)
+}
+
+func TestAddFeeToReplyNoGasPrice(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	var reply messages.TransactionReceipt
+	p.addFeeToReply(&reply, &eth.Txn{})
+	assert.Empty(reply.EffectiveGasPriceStr)
+	assert.Empty(reply.FeeStr)
+}
+
+func TestWeiToEther(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("0", weiToEther(big.NewInt(0)))
+	assert.Equal("1", weiToEther(big.NewInt(1000000000000000000)))
+	assert.Equal("0.000000000000000001", weiToEther(big.NewInt(1)))
+	assert.Equal("12.5", weiToEther(new(big.Int).Mul(big.NewInt(125), big.NewInt(100000000000000000))))
+}
+
+func TestInFlightStatus(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+	txnProcessor.inflightTxns["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"] = &inflightTxnState{
+		txnsInFlight: []*inflightTxn{
+			{
+				nonce:         100,
+				txnContext:    testTxnContext,
+				timeReceived:  time.Now().UTC().Add(-10 * time.Second),
+				receiptChecks: 3,
+				tx:            &eth.Txn{Hash: "0x12345"},
+			},
+			{
+				nonce:        101,
+				timeReceived: time.Now().UTC(),
+			},
+		},
+	}
+
+	status := txnProcessor.InFlightStatus()
+	txns := status["0x83dbc8e329b38cba0fc4ed99b1ce9c2a390abdc1"]
+	assert.Equal(2, len(txns))
+	assert.Equal("100", txns[0].Nonce)
+	assert.Equal("0x12345", txns[0].TransactionHash)
+	assert.Equal(3, txns[0].ReceiptChecks)
+	assert.True(txns[0].AgeSeconds >= 10)
+	assert.Equal("101", txns[1].Nonce)
+	assert.Empty(txns[1].TransactionHash)
+}
+
 func TestCobraInitTxnProcessor(t *testing.T) {
 	assert := assert.New(t)
 	txconf := &TxnProcessorConf{}
@@ -1125,9 +1730,11 @@ func TestCobraInitTxnProcessor(t *testing.T) {
 	cmd.ParseFlags([]string{
 		"-x", "10",
 		"-P",
+		"--strict-addresses",
 	})
 	assert.Equal(10, txconf.MaxTXWaitTime)
 	assert.Equal(true, txconf.AlwaysManageNonce)
+	assert.Equal(true, txconf.StrictAddresses)
 }
 
 func TestOnSendTransactionAddressBook(t *testing.T) {
@@ -1300,3 +1907,508 @@ func TestResolveAddressHDWalletFail(t *testing.T) {
 	_, err := txnProcessor.ResolveAddress("hd-testinst-testwallet-1234")
 	assert.EqualError(err, "No HD Wallet Configuration")
 }
+
+func TestAddBlockTimestampToReply(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		ReceiptTimestamps: true,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testRPC := &testRPC{ethGetBlockByNumberTime: 1620000000}
+	txnProcessor.Init(testRPC)
+
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	var reply1, reply2 messages.TransactionReceipt
+	txnProcessor.addBlockTimestampToReply(context.Background(), &reply1, &blockNumber)
+	txnProcessor.addBlockTimestampToReply(context.Background(), &reply2, &blockNumber)
+	assert.Equal("1620000000", reply1.BlockTimestamp)
+	assert.Equal("1620000000", reply2.BlockTimestamp)
+	// Second lookup is served from the cache
+	assert.Equal([]string{"eth_getBlockByNumber"}, testRPC.calls)
+	assert.Equal("0x3039", testRPC.params[0][0])
+}
+
+func TestAddBlockTimestampToReplyFail(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		ReceiptTimestamps: true,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.Init(&testRPC{ethGetBlockByNumberErr: fmt.Errorf("pop")})
+
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	var reply messages.TransactionReceipt
+	txnProcessor.addBlockTimestampToReply(context.Background(), &reply, &blockNumber)
+	assert.Empty(reply.BlockTimestamp)
+}
+
+func TestAddBlockTimestampToReplyDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	testRPC := &testRPC{}
+	txnProcessor.Init(testRPC)
+
+	blockNumber := ethbinding.HexBigInt(*big.NewInt(12345))
+	var reply messages.TransactionReceipt
+	txnProcessor.addBlockTimestampToReply(context.Background(), &reply, &blockNumber)
+	assert.Empty(reply.BlockTimestamp)
+	assert.Empty(testRPC.calls)
+}
+
+func TestOnSendTransactionMessageConfirmed(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:      1,
+		ConfirmationBlocks: 3,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testConfirmationContext{}
+	testContext.jsonMsg = goodSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethBlockNumberResults = []int64{12346, 12347, 12349}
+	txnProcessor.Init(testRPC)
+	txnProcessor.confirmationPoll = 1 * time.Millisecond
+
+	txnProcessor.OnMessage(testContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	assert.Empty(testContext.errorReplies)
+	assert.Len(testContext.replies, 1)
+	assert.Equal(messages.MsgTypeTransactionSuccess, testContext.replies[0].ReplyHeaders().MsgType)
+	assert.Len(testContext.confirmed, 1)
+	confirmed := testContext.confirmed[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionConfirmed, confirmed.Headers.MsgType)
+	assert.Equal("4", confirmed.ConfirmationsStr)
+	assert.Equal("12345", confirmed.BlockNumberStr)
+	assert.Equal("1", confirmed.StatusStr)
+}
+
+func TestOnSendTransactionMessageConfirmationsUnsupportedContext(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:      1,
+		ConfirmationBlocks: 3,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testTxnContext := &testTxnContext{}
+	testTxnContext.jsonMsg = goodSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testTxnContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	assert.Len(testTxnContext.replies, 1)
+	assert.NotContains(testRPC.calls, "eth_blockNumber")
+}
+
+func TestWaitForConfirmationsReorg(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:      1,
+		ConfirmationBlocks: 2,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testConfirmationContext{}
+
+	testRPC := goodMessageRPC()
+	originalReceipt := testRPC.ethGetTransactionReceiptResult
+	newBlockHash := ethbind.API.HexToHash("0x9a3c8c2b1b1f9f6ad3a5e2d9ec41a5b4a8e1c1e1b4d2d1c3a7f6e5d4c3b2a190")
+	newBlockNumber := ethbinding.HexBigInt(*big.NewInt(12346))
+	remined := originalReceipt
+	remined.BlockHash = &newBlockHash
+	remined.BlockNumber = &newBlockNumber
+	testRPC.ethGetTransactionReceipts = []eth.TxnReceipt{{}, remined, remined}
+	testRPC.ethBlockNumberErr = fmt.Errorf("pop")
+	testRPC.ethBlockNumberResults = []int64{12347, 12347, 12347, 12348}
+	txnProcessor.Init(testRPC)
+	txnProcessor.confirmationPoll = 1 * time.Millisecond
+
+	inflight := &inflightTxn{
+		txnContext: testContext,
+		tx:         &eth.Txn{Hash: originalReceipt.TransactionHash.String(), Receipt: originalReceipt},
+	}
+	inflight.wg.Add(1)
+	txnProcessor.waitForConfirmations(inflight, testContext)
+
+	assert.Len(testContext.confirmed, 1)
+	confirmed := testContext.confirmed[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionConfirmed, confirmed.Headers.MsgType)
+	assert.Equal("12346", confirmed.BlockNumberStr)
+	assert.Equal(newBlockHash.String(), confirmed.BlockHash.String())
+	assert.Equal("2", confirmed.ConfirmationsStr)
+}
+
+func TestWaitForConfirmationsTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		ConfirmationBlocks: 5,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testConfirmationContext{}
+
+	testRPC := goodMessageRPC()
+	testRPC.ethBlockNumberResults = []int64{12346}
+	txnProcessor.Init(testRPC)
+	txnProcessor.maxTXWaitTime = 10 * time.Millisecond
+	txnProcessor.confirmationPoll = 1 * time.Millisecond
+
+	receipt := testRPC.ethGetTransactionReceiptResult
+	inflight := &inflightTxn{
+		txnContext: testContext,
+		tx:         &eth.Txn{Hash: receipt.TransactionHash.String(), Receipt: receipt},
+	}
+	inflight.wg.Add(1)
+	txnProcessor.waitForConfirmations(inflight, testContext)
+
+	assert.Len(testContext.confirmed, 1)
+	errReply := testContext.confirmed[0].(*messages.ErrorReply)
+	assert.Equal(messages.MsgTypeError, errReply.Headers.MsgType)
+	assert.Regexp("Timed out waiting for 5 confirmations", errReply.ErrorMessage)
+	assert.Equal(receipt.TransactionHash.String(), errReply.TXHash)
+	assert.NotContains(testRPC.calls, "eth_getTransactionReceipt")
+}
+
+func TestOnDeployContractMessageProgress(t *testing.T) {
+	assert := assert.New(t)
+
+	key, _ := ethbind.API.GenerateKey()
+	addr := ethbind.API.PubkeyToAddress(key.PublicKey)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		res.Write([]byte(`
+    {
+      "address": "` + addr.String() + `",
+      "privateKey": "` + hex.EncodeToString(ethbind.API.FromECDSA(key)) + `"
+    }`))
+	}))
+	defer svr.Close()
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:  1,
+		DeployProgress: true,
+		HDWalletConf: HDWalletConf{
+			URLTemplate: svr.URL,
+		},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testProgressContext{}
+	testContext.jsonMsg = goodHDWalletDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(addr.String())] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(addr.String())].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	assert.Empty(testContext.errorReplies)
+	assert.Len(testContext.replies, 1)
+	stages := []string{}
+	for _, progress := range testContext.progress {
+		assert.Equal(messages.MsgTypeTransactionProgress, progress.Headers.MsgType)
+		stages = append(stages, progress.Stage)
+	}
+	assert.Equal([]string{"compiled", "signed", "submitted", "mined"}, stages)
+	assert.NotEmpty(testContext.progress[2].TransactionHash)
+	assert.Equal("12345", testContext.progress[3].BlockNumberStr)
+	assert.Equal("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37", testContext.progress[3].ContractAddress)
+}
+
+func TestOnDeployContractMessageProgressDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testProgressContext{}
+	testContext.jsonMsg = goodDeployTxnJSON
+
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	assert.Len(testContext.replies, 1)
+	assert.Empty(testContext.progress)
+}
+
+func TestNonceShardConsistent(t *testing.T) {
+	assert := assert.New(t)
+
+	tp := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	assert.Len(tp.nonceShards, defaultNonceShards)
+	from := strings.ToLower(testFromAddr)
+	assert.True(tp.nonceShard(from) == tp.nonceShard(from))
+
+	single := NewTxnProcessor(&TxnProcessorConf{NonceShards: 1}, &eth.RPCConf{}).(*txnProcessor)
+	assert.True(single.nonceShard(from) == single.nonceShard("0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"))
+}
+
+func TestNonceQueryDoesNotBlockOtherShards(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		AlwaysManageNonce: true,
+		NonceShards:       2,
+	}, &eth.RPCConf{}).(*txnProcessor)
+
+	// Find a second address that hashes to the other shard
+	slowAddr := strings.ToLower(testFromAddr)
+	var fastAddr string
+	for i := 0; fastAddr == ""; i++ {
+		candidate := fmt.Sprintf("0x%040x", i)
+		if txnProcessor.nonceShard(candidate) != txnProcessor.nonceShard(slowAddr) {
+			fastAddr = candidate
+		}
+	}
+
+	queried := make(chan struct{})
+	release := make(chan struct{})
+	txnProcessor.Init(eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		if strings.ToLower(args[0].(*ethbinding.Address).Hex()) == slowAddr {
+			close(queried)
+			<-release
+			*(res.(*ethbinding.HexUint64)) = 5
+		} else {
+			*(res.(*ethbinding.HexUint64)) = 10
+		}
+	}))
+
+	slowDone := make(chan *inflightTxn)
+	go func() {
+		inflight, err := txnProcessor.addInflightWrapper(&testTxnContext{}, &messages.TransactionCommon{From: testFromAddr})
+		assert.NoError(err)
+		slowDone <- inflight
+	}()
+
+	// The query for the slow address is still blocked, but the other address is assigned its nonce
+	<-queried
+	inflight, err := txnProcessor.addInflightWrapper(&testTxnContext{}, &messages.TransactionCommon{From: fastAddr})
+	assert.NoError(err)
+	assert.Equal(int64(10), inflight.nonce)
+
+	close(release)
+	inflight = <-slowDone
+	assert.Equal(int64(5), inflight.nonce)
+	assert.Equal(int64(5), txnProcessor.inflightTxns[slowAddr].highestNonce)
+}
+
+func TestNonceShardsDispatchOnTheirOwnWorkers(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:     1,
+		AlwaysManageNonce: true,
+		SendConcurrency:   10,
+		NonceShards:       2,
+	}, &eth.RPCConf{}).(*txnProcessor)
+
+	slowAddr := strings.ToLower(testFromAddr)
+	var fastAddr string
+	for i := 0; fastAddr == ""; i++ {
+		candidate := fmt.Sprintf("0x%040x", i)
+		if txnProcessor.nonceShardIndex(candidate) != txnProcessor.nonceShardIndex(slowAddr) {
+			fastAddr = candidate
+		}
+	}
+
+	queried := make(chan struct{})
+	release := make(chan struct{})
+	sent := make(chan string, 3)
+	txnProcessor.Init(eth.NewMockRPCClientForSync(nil, func(method string, res interface{}, args ...interface{}) {
+		switch method {
+		case "eth_getTransactionCount":
+			if strings.ToLower(args[0].(*ethbinding.Address).Hex()) == slowAddr {
+				close(queried)
+				<-release
+			}
+		case "eth_sendTransaction":
+			sent <- strings.ToLower(args[0].(*eth.SendTXArgs).From)
+		}
+	}))
+	assert.Len(txnProcessor.nonceShardQueues, 2)
+
+	// OnMessage returns straight away, while the nonce query for the slow address is blocked
+	txnProcessor.OnMessage(&testTxnContext{jsonMsg: goodSendTxnJSON})
+	txnProcessor.OnMessage(&testTxnContext{jsonMsg: goodSendTxnJSON})
+	<-queried
+	txnProcessor.OnMessage(&testTxnContext{jsonMsg: strings.Replace(goodSendTxnJSON, testFromAddr, fastAddr, 1)})
+	assert.Equal(fastAddr, <-sent)
+
+	// The messages for the slow address then go in order, after its nonce query completes
+	close(release)
+	assert.Equal(slowAddr, <-sent)
+	assert.Equal(slowAddr, <-sent)
+}
+
+func TestNonceShardsSynchronousWithoutSendConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.Init(eth.NewMockRPCClientForSync(nil, nil))
+	assert.Nil(txnProcessor.nonceShardQueues)
+
+	processed := false
+	txnProcessor.dispatchForAddress(&messages.TransactionCommon{From: testFromAddr}, func() { processed = true })
+	assert.True(processed)
+}
+
+func TestNonceShardsResolveFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	key, _ := ethbind.API.GenerateKey()
+	addr := ethbind.API.PubkeyToAddress(key.PublicKey)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+		res.Write([]byte(`
+    {
+      "address": "` + addr.String() + `",
+      "privateKey": "` + hex.EncodeToString(ethbind.API.FromECDSA(key)) + `"
+    }`))
+	}))
+	defer svr.Close()
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		SendConcurrency: 10,
+		HDWalletConf: HDWalletConf{
+			URLTemplate: svr.URL,
+		},
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.Init(eth.NewMockRPCClientForSync(nil, nil))
+	defer txnProcessor.Close()
+
+	// The case and 0x prefix of an address, or an HD wallet reference to it, do not change its shard
+	lowerAddr := strings.ToLower(addr.Hex())
+	for _, from := range []string{addr.Hex(), lowerAddr, strings.TrimPrefix(lowerAddr, "0x"), strings.ToUpper(lowerAddr[2:]), "hd-testinst-testwallet-1234"} {
+		assert.Equal(lowerAddr, txnProcessor.shardAddress(&messages.TransactionCommon{From: from}), from)
+	}
+	assert.Equal("hd-testinst-testwallet-1234", txnProcessor.shardAddress(&messages.TransactionCommon{From: "HD-testinst-testwallet-1234", Signer: SignerKMS}))
+}
+
+func TestNonceShardsClose(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		SendConcurrency: 10,
+		NonceShards:     2,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	txnProcessor.Init(eth.NewMockRPCClientForSync(nil, nil))
+	assert.Len(txnProcessor.nonceShardQueues, 2)
+
+	queued := make(chan bool)
+	txnProcessor.dispatchForAddress(&messages.TransactionCommon{From: testFromAddr}, func() { queued <- true })
+	assert.True(<-queued)
+
+	// Once closed, messages are processed synchronously
+	txnProcessor.Close()
+	assert.Nil(txnProcessor.nonceShardQueues)
+	processed := false
+	txnProcessor.dispatchForAddress(&messages.TransactionCommon{From: testFromAddr}, func() { processed = true })
+	assert.True(processed)
+}
+
+func TestOnSendTransactionMessageRecoverInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime:     1,
+		AlwaysManageNonce: true,
+		RecoverInFlight:   true,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testProgressContext{}
+	testContext.jsonMsg = goodSendTxnJSON
+
+	testRPC := goodMessageRPC()
+	testRPC.ethGetTransactionCountResult = 10
+	txnProcessor.Init(testRPC)
+
+	txnProcessor.OnMessage(testContext)
+	for inMap := false; !inMap; _, inMap = txnProcessor.inflightTxns[strings.ToLower(testFromAddr)] {
+		time.Sleep(1 * time.Millisecond)
+	}
+	txnWG := &txnProcessor.inflightTxns[strings.ToLower(testFromAddr)].txnsInFlight[0].wg
+
+	txnWG.Wait()
+	assert.Len(testContext.replies, 1)
+	// Only the submission is recorded, as deployment progress is not enabled
+	assert.Len(testContext.progress, 1)
+	assert.Equal("submitted", testContext.progress[0].Stage)
+	assert.Equal(testRPC.ethSendTransactionResult, testContext.progress[0].TransactionHash)
+	assert.Equal("10", testContext.progress[0].NonceStr)
+}
+
+func TestResumeTransaction(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{
+		MaxTXWaitTime: 1,
+	}, &eth.RPCConf{}).(*txnProcessor)
+	testContext := &testTxnContext{}
+	testRPC := goodMessageRPC()
+	txnProcessor.Init(testRPC)
+
+	txHash := "0xe2215336b09f9b5b82e36e1144ed64f40a42e61b68fdaca82549fd98b8531a89"
+	txnProcessor.ResumeTransaction(testContext, txHash, 42)
+	for len(testContext.replies) == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	assert.Empty(testContext.errorReplies)
+	assert.Equal([]string{"eth_getTransactionReceipt"}, testRPC.calls)
+	reply := testContext.replies[0].(*messages.TransactionReceipt)
+	assert.Equal(messages.MsgTypeTransactionSuccess, reply.Headers.MsgType)
+	assert.Equal(txHash, reply.TransactionHash.String())
+	assert.Equal("42", reply.NonceStr)
+	assert.Equal("12345", reply.BlockNumberStr)
+}
+
+func TestBuildReceiptReplyConstructorEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	txnProcessor := NewTxnProcessor(&TxnProcessorConf{}, &eth.RPCConf{}).(*txnProcessor)
+	var abi ethbinding.ABIMarshaling
+	json.Unmarshal([]byte(`[{"type":"event","name":"Initialized","inputs":[{"name":"value","type":"uint256"}]}]`), &abi)
+	runtimeABI, _ := eth.RuntimeABI(abi)
+	eventTopic := runtimeABI.Events["Initialized"].ID
+	contractAddress := ethbind.API.HexToAddress("0x28a62cb478a3c3d4daad84f1148ea16cd1a66f37")
+	status := ethbinding.HexBigInt(*big.NewInt(1))
+
+	inflight := &inflightTxn{txnContext: &testTxnContext{}, tx: &eth.Txn{ABI: abi}}
+	inflight.tx.Receipt = eth.TxnReceipt{
+		ContractAddress: &contractAddress,
+		Status:          &status,
+		Logs: []*eth.TxnLog{{
+			Address: &contractAddress,
+			Data:    "0x000000000000000000000000000000000000000000000000000000000000002a",
+			Topics:  []*ethbinding.Hash{&eventTopic},
+		}},
+	}
+	reply, isSuccess := txnProcessor.buildReceiptReply(inflight)
+	assert.True(isSuccess)
+	assert.Equal(1, len(reply.Events))
+	assert.Equal("Initialized(uint256)", reply.Events[0].Signature)
+	assert.Equal("42", reply.Events[0].Data["value"])
+
+	inflight.tx.ABI = nil
+	reply, _ = txnProcessor.buildReceiptReply(inflight)
+	assert.Nil(reply.Events)
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var buildVersion, buildDate string
+
+// BuildInfo describes the build of the running binary
+type BuildInfo struct {
+	Version   string            `json:"version"`
+	BuildDate string            `json:"buildDate"`
+	GoVersion string            `json:"goVersion"`
+	Platform  string            `json:"platform"`
+	Modules   map[string]string `json:"modules,omitempty"`
+}
+
+// SetBuildInfo records the version and date set at build time
+func SetBuildInfo(version, date string) {
+	buildVersion = version
+	buildDate = date
+}
+
+// GetBuildInfo returns the build details of the running binary, including the versions
+// of the modules it was built with
+func GetBuildInfo() *BuildInfo {
+	info := &BuildInfo{
+		Version:   buildVersion,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Modules = make(map[string]string)
+		for _, dep := range bi.Deps {
+			info.Modules[dep.Path] = dep.Version
+		}
+	}
+	return info
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
@@ -52,6 +53,17 @@ func DefInt(envVarName string, defValue int) int {
 	return int(parsedInt)
 }
 
+// DefStringArray defaults a string array to the comma separated values in an Env var
+func DefStringArray(envVarName string) []string {
+	values := []string{}
+	for _, v := range strings.Split(os.Getenv(envVarName), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 // MarshalToYAML marshals a JSON annotated structure into YAML, by first going to JSON
 func MarshalToYAML(conf interface{}) (yamlBytes []byte, err error) {
 	var jsonBytes []byte
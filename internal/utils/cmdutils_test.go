@@ -52,6 +52,19 @@ func TestDefInt(t *testing.T) {
 
 }
 
+func TestDefStringArray(t *testing.T) {
+
+	assert := assert.New(t)
+
+	os.Unsetenv("SOME_ENV_VAR")
+	assert.Equal([]string{}, DefStringArray("SOME_ENV_VAR"))
+
+	os.Setenv("SOME_ENV_VAR", "a=b, c=d,")
+	assert.Equal([]string{"a=b", "c=d"}, DefStringArray("SOME_ENV_VAR"))
+	os.Unsetenv("SOME_ENV_VAR")
+
+}
+
 func TestMarshalToYAML(t *testing.T) {
 	assert := assert.New(t)
 
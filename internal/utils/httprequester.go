@@ -16,10 +16,13 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	log "github.com/sirupsen/logrus"
@@ -30,28 +33,153 @@ type HTTPRequester struct {
 	name   string
 	client *http.Client
 	conf   *HTTPRequesterConf
+	limits HTTPRequesterLimits
+	slots  chan struct{}
+}
+
+// HTTPRequesterLimits bounds each request, so a slow or misbehaving server cannot stall its
+// callers. Timeout covers waiting for one of the MaxConcurrent slots, as well as the request
+// and reading the response. Zero values are unlimited
+type HTTPRequesterLimits struct {
+	Timeout          time.Duration
+	MaxResponseBytes int64
+	MaxConcurrent    int
 }
 
 // HTTPRequesterConf configuration for making HTTP reuqests
 type HTTPRequesterConf struct {
-	Headers map[string][]string `json:"headers"`
+	Headers  HTTPHeaders `json:"headers"`
+	ProxyURL string      `json:"proxyURL,omitempty"`
+}
+
+// HTTPHeaders are static headers added to every request, such as API keys or tenant IDs.
+// Each header can be configured as a single string, or an array of values
+type HTTPHeaders map[string][]string
+
+// UnmarshalJSON accepts either a string or an array of strings for each header
+func (h *HTTPHeaders) UnmarshalJSON(b []byte) error {
+	var generic map[string]interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return err
+	}
+	headers := make(HTTPHeaders, len(generic))
+	for name, v := range generic {
+		switch vt := v.(type) {
+		case string:
+			headers[name] = []string{vt}
+		case []interface{}:
+			for _, iv := range vt {
+				sv, ok := iv.(string)
+				if !ok {
+					return errors.Errorf(errors.HTTPRequesterInvalidHeader, name)
+				}
+				headers[name] = append(headers[name], sv)
+			}
+		default:
+			return errors.Errorf(errors.HTTPRequesterInvalidHeader, name)
+		}
+	}
+	*h = headers
+	return nil
 }
 
-// NewHTTPRequester constructor
+// ValidateConf checks the configuration, so that problems are reported at startup
+// rather than on every request
+func (conf *HTTPRequesterConf) ValidateConf() error {
+	_, err := ProxyFunc(conf.ProxyURL)
+	return err
+}
+
+// NewHTTPRequester constructor. The configuration should have been checked with ValidateConf
 func NewHTTPRequester(name string, conf *HTTPRequesterConf) *HTTPRequester {
+	proxy, err := ProxyFunc(conf.ProxyURL)
+	if err != nil {
+		log.Errorf("%s: %s", name, err)
+	}
 	return &HTTPRequester{
 		name: name,
 		conf: conf,
 		client: &http.Client{
 			Transport: &http.Transport{
+				Proxy:        proxy,
 				MaxIdleConns: 1,
 			},
 		},
 	}
 }
 
+// ProxyFunc returns the proxy selection function for an HTTP transport. An explicitly configured
+// proxy URL is used for all requests, otherwise HTTP_PROXY/HTTPS_PROXY/NO_PROXY are honored.
+// If the configured URL is invalid, the returned function fails every request with the error
+func ProxyFunc(proxyURL string) (func(*http.Request) (*url.URL, error), error) {
+	if proxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		err = errors.Errorf(errors.HTTPRequesterInvalidProxyURL, proxyURL)
+		return func(*http.Request) (*url.URL, error) { return nil, err }, err
+	}
+	return http.ProxyURL(u), nil
+}
+
+// NewHTTPRequesterWithLimits constructs a requester that applies limits to every request
+func NewHTTPRequesterWithLimits(name string, conf *HTTPRequesterConf, limits HTTPRequesterLimits) *HTTPRequester {
+	hr := NewHTTPRequester(name, conf)
+	hr.limits = limits
+	if limits.MaxConcurrent > 0 {
+		hr.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return hr
+}
+
+// acquire waits for a free slot when concurrent requests are limited, returning the function
+// to release it
+func (hr *HTTPRequester) acquire(ctx context.Context) (func(), error) {
+	if hr.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case hr.slots <- struct{}{}:
+		return func() { <-hr.slots }, nil
+	case <-ctx.Done():
+		return nil, errors.Errorf(errors.HTTPRequesterBusy, hr.name, hr.limits.MaxConcurrent)
+	}
+}
+
+// readBody reads the response, failing if it is larger than the limit
+func (hr *HTTPRequester) readBody(res *http.Response) ([]byte, error) {
+	if hr.limits.MaxResponseBytes <= 0 {
+		return ioutil.ReadAll(res.Body)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, hr.limits.MaxResponseBytes+1))
+	if err == nil && int64(len(b)) > hr.limits.MaxResponseBytes {
+		err = errors.Errorf(errors.HTTPRequesterResponseTooLarge, hr.name, hr.limits.MaxResponseBytes)
+	}
+	return b, err
+}
+
 // DoRequest performs a single HTTP request processing the response as JSON
 func (hr *HTTPRequester) DoRequest(method, url string, bodyMap map[string]interface{}) (map[string]interface{}, error) {
+	return hr.DoRequestContext(context.Background(), method, url, bodyMap)
+}
+
+// DoRequestContext performs a single HTTP request processing the response as JSON, which is
+// abandoned if the context is cancelled
+func (hr *HTTPRequester) DoRequestContext(parent context.Context, method, url string, bodyMap map[string]interface{}) (map[string]interface{}, error) {
+	ctx := parent
+	if hr.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hr.limits.Timeout)
+		defer cancel()
+	}
+	release, err := hr.acquire(ctx)
+	if err != nil {
+		log.Errorf("%s %s <-- !Failed: %s", method, url, err)
+		return nil, err
+	}
+	defer release()
+
 	log.Infof("%s %s -->", method, url)
 	var body io.Reader
 	if bodyMap != nil {
@@ -61,17 +189,29 @@ func (hr *HTTPRequester) DoRequest(method, url string, bodyMap map[string]interf
 		}
 		body = bytes.NewReader(bodyBytes)
 	}
-	req, _ := http.NewRequest(method, url, body)
+	req, _ := http.NewRequestWithContext(ctx, method, url, body)
+	// Copy the configured headers, as the request must not modify the shared config
 	req.Header = http.Header{}
-	if hr.conf.Headers != nil {
-		req.Header = hr.conf.Headers
+	for name, values := range hr.conf.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if req.Header.Get("content-type") == "" {
+		req.Header.Set("content-type", "application/json")
 	}
-	req.Header.Add("content-type", "application/json")
 	res, ehr := hr.client.Do(req)
 	if ehr != nil {
 		log.Errorf("%s %s <-- !Failed: %s", method, url, ehr)
+		if parent.Err() != nil {
+			return nil, parent.Err()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.Errorf(errors.HTTPRequesterTimeout, hr.name, hr.limits.Timeout)
+		}
 		return nil, errors.Errorf(errors.HTTPRequesterNonStatusError, hr.name)
 	}
+	defer res.Body.Close()
 	log.Infof("%s %s <-- [%d]", method, url, res.StatusCode)
 	if res.StatusCode == 404 {
 		return nil, nil
@@ -80,7 +220,14 @@ func (hr *HTTPRequester) DoRequest(method, url string, bodyMap map[string]interf
 	if res.StatusCode == 204 {
 		jsonBody = make(map[string]interface{})
 	} else {
-		resBody, _ := ioutil.ReadAll(res.Body)
+		resBody, err := hr.readBody(res)
+		if err != nil {
+			log.Errorf("%s %s <-- [%d] !Failed to read body: %s", method, url, res.StatusCode, err)
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, errors.Errorf(errors.HTTPRequesterTimeout, hr.name, hr.limits.Timeout)
+			}
+			return nil, err
+		}
 		if err := json.Unmarshal(resBody, &jsonBody); err != nil {
 			log.Errorf("%s %s <-- [%d] !Failed to read body: %s", method, url, res.StatusCode, ehr)
 			return nil, errors.Errorf(errors.HTTPRequesterStatusErrorNoData, hr.name, res.StatusCode)
@@ -18,7 +18,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
@@ -187,3 +189,185 @@ func TestHTTPRequesterGetResponseStringVariants(t *testing.T) {
 	assert.EqualError(err, "'nil-value' empty (or null) in unit test response")
 
 }
+
+func TestHTTPRequesterProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		proxied = req.URL.String()
+		res.Write([]byte("{\"some\":\"data\"}"))
+	}))
+	defer proxy.Close()
+
+	hr := NewHTTPRequester("unit test", &HTTPRequesterConf{ProxyURL: proxy.URL})
+
+	body, err := hr.DoRequest("GET", "http://127.0.0.1:1/some/path", nil)
+	assert.NoError(err)
+	assert.Equal("data", body["some"])
+	assert.Equal("http://127.0.0.1:1/some/path", proxied)
+}
+
+func TestHTTPRequesterBadProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	hr := NewHTTPRequester("unit test", &HTTPRequesterConf{ProxyURL: "not a url"})
+
+	_, err := hr.DoRequest("GET", "http://localhost", nil)
+	assert.EqualError(err, "Error querying unit test")
+}
+
+func TestProxyFunc(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy, err := ProxyFunc("")
+	assert.NoError(err)
+	assert.NotNil(proxy)
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	proxy, err = ProxyFunc("http://proxy.example.com:3128")
+	assert.NoError(err)
+	u, err := proxy(req)
+	assert.NoError(err)
+	assert.Equal("proxy.example.com:3128", u.Host)
+
+	proxy, err = ProxyFunc("://bad")
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+	_, err = proxy(req)
+	assert.EqualError(err, "Invalid proxy URL '://bad'")
+}
+
+func TestHTTPRequesterHeadersNotModified(t *testing.T) {
+	assert := assert.New(t)
+
+	router := &httprouter.Router{}
+	router.GET("/", func(res http.ResponseWriter, req *http.Request, parms httprouter.Params) {
+		assert.Equal([]string{"application/json"}, req.Header["Content-Type"])
+		assert.Equal("abc123", req.Header.Get("X-Api-Key"))
+		assert.Equal([]string{"t1", "t2"}, req.Header["X-Tenant"])
+		res.Write([]byte("{}"))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var conf HTTPRequesterConf
+	err := json.Unmarshal([]byte(`{"headers":{"x-api-key":"abc123","x-tenant":["t1","t2"]}}`), &conf)
+	assert.NoError(err)
+	hr := NewHTTPRequester("unit test", &conf)
+
+	for i := 0; i < 2; i++ {
+		_, err = hr.DoRequest("GET", server.URL, nil)
+		assert.NoError(err)
+	}
+	assert.Len(conf.Headers, 2)
+	assert.Equal([]string{"abc123"}, conf.Headers["x-api-key"])
+}
+
+func TestHTTPRequesterHeadersContentTypeOverride(t *testing.T) {
+	assert := assert.New(t)
+
+	router := &httprouter.Router{}
+	router.POST("/", func(res http.ResponseWriter, req *http.Request, parms httprouter.Params) {
+		assert.Equal("application/vnd.custom+json", req.Header.Get("Content-Type"))
+		res.Write([]byte("{}"))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	hr := NewHTTPRequester("unit test", &HTTPRequesterConf{
+		Headers: HTTPHeaders{
+			"Content-Type": {"application/vnd.custom+json"},
+		},
+	})
+	_, err := hr.DoRequest("POST", server.URL, map[string]interface{}{})
+	assert.NoError(err)
+}
+
+func TestHTTPHeadersUnmarshalBad(t *testing.T) {
+	assert := assert.New(t)
+
+	var headers HTTPHeaders
+	err := json.Unmarshal([]byte(`{"x-api-key":12345}`), &headers)
+	assert.EqualError(err, "Header 'x-api-key' must be a string, or an array of strings")
+	err = json.Unmarshal([]byte(`{"x-api-key":[12345]}`), &headers)
+	assert.EqualError(err, "Header 'x-api-key' must be a string, or an array of strings")
+	err = json.Unmarshal([]byte(`[]`), &headers)
+	assert.Error(err)
+}
+
+func TestHTTPRequesterValidateConf(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&HTTPRequesterConf{}).ValidateConf())
+	assert.NoError((&HTTPRequesterConf{ProxyURL: "http://proxy.example.com:3128"}).ValidateConf())
+	assert.EqualError((&HTTPRequesterConf{ProxyURL: "://bad"}).ValidateConf(), "Invalid proxy URL '://bad'")
+}
+
+func TestHTTPRequesterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	hr := NewHTTPRequesterWithLimits("unit test", &HTTPRequesterConf{}, HTTPRequesterLimits{Timeout: 50 * time.Millisecond})
+
+	_, err := hr.DoRequest("GET", server.URL, nil)
+	assert.EqualError(err, "unit test did not respond within 50ms")
+}
+
+func TestHTTPRequesterResponseTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte(`{"some":"` + strings.Repeat("a", 100) + `"}`))
+	}))
+	defer server.Close()
+
+	hr := NewHTTPRequesterWithLimits("unit test", &HTTPRequesterConf{}, HTTPRequesterLimits{MaxResponseBytes: 50})
+	_, err := hr.DoRequest("GET", server.URL, nil)
+	assert.EqualError(err, "unit test response exceeded the maximum size of 50 bytes")
+
+	hr = NewHTTPRequesterWithLimits("unit test", &HTTPRequesterConf{}, HTTPRequesterLimits{MaxResponseBytes: 200})
+	resBody, err := hr.DoRequest("GET", server.URL, nil)
+	assert.NoError(err)
+	assert.Len(resBody["some"], 100)
+}
+
+func TestHTTPRequesterMaxConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	started := make(chan struct{}, 2)
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-done
+		res.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	hr := NewHTTPRequesterWithLimits("unit test", &HTTPRequesterConf{}, HTTPRequesterLimits{
+		Timeout:       200 * time.Millisecond,
+		MaxConcurrent: 1,
+	})
+
+	firstErr := make(chan error)
+	go func() {
+		_, err := hr.DoRequest("GET", server.URL, nil)
+		firstErr <- err
+	}()
+	<-started
+
+	// The only slot is held by the first request, so the second times out waiting for it
+	_, err := hr.DoRequest("GET", server.URL, nil)
+	assert.EqualError(err, "Timed out waiting for one of the 1 concurrent requests to unit test to complete")
+
+	// Once the first request completes its slot is free for the next
+	close(done)
+	<-firstErr
+	_, err = hr.DoRequest("GET", server.URL, nil)
+	assert.NoError(err)
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RecentLogSize is the number of warning and error log entries kept for support bundles
+const RecentLogSize = 500
+
+// logRing is a logrus hook that keeps the most recent warning and error entries
+type logRing struct {
+	lock    sync.Mutex
+	entries []string
+	next    int
+	full    bool
+}
+
+var recentLogs = &logRing{entries: make([]string, RecentLogSize)}
+var recentLogsOnce sync.Once
+
+// CaptureRecentLogs starts keeping the most recent warning and error log entries in memory
+func CaptureRecentLogs() {
+	recentLogsOnce.Do(func() {
+		log.AddHook(recentLogs)
+	})
+}
+
+// RecentLogs returns the recent warning and error log entries, oldest first
+func RecentLogs() []string {
+	return recentLogs.get()
+}
+
+func (r *logRing) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel}
+}
+
+func (r *logRing) Fire(entry *log.Entry) error {
+	line := fmt.Sprintf("%s [%s] %s", entry.Time.UTC().Format("2006-01-02T15:04:05.000Z"), strings.ToUpper(entry.Level.String()), entry.Message)
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		line += fmt.Sprintf(" %s=%v", k, entry.Data[k])
+	}
+	r.lock.Lock()
+	r.entries[r.next] = line
+	r.next = (r.next + 1) % len(r.entries)
+	r.full = r.full || r.next == 0
+	r.lock.Unlock()
+	return nil
+}
+
+func (r *logRing) get() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return append([]string{}, r.entries[:r.next]...)
+	}
+	return append(append([]string{}, r.entries[r.next:]...), r.entries[:r.next]...)
+}
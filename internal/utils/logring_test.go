@@ -0,0 +1,62 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRing(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &logRing{entries: make([]string, 3)}
+	assert.Empty(r.get())
+
+	for i := 0; i < 2; i++ {
+		r.Fire(&log.Entry{
+			Time:    time.Date(2021, 6, 1, 0, 0, i, 0, time.UTC),
+			Level:   log.ErrorLevel,
+			Message: fmt.Sprintf("error %d", i),
+			Data:    log.Fields{"b": 2, "a": 1},
+		})
+	}
+	assert.Equal([]string{
+		"2021-06-01T00:00:00.000Z [ERROR] error 0 a=1 b=2",
+		"2021-06-01T00:00:01.000Z [ERROR] error 1 a=1 b=2",
+	}, r.get())
+
+	for i := 2; i < 5; i++ {
+		r.Fire(&log.Entry{Level: log.WarnLevel, Message: fmt.Sprintf("warn %d", i)})
+	}
+	entries := r.get()
+	assert.Len(entries, 3)
+	assert.Regexp(`\[WARNING\] warn 2$`, entries[0])
+	assert.Regexp(`\[WARNING\] warn 4$`, entries[2])
+}
+
+func TestCaptureRecentLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	CaptureRecentLogs()
+	CaptureRecentLogs()
+	log.Errorf("captured for support")
+	logs := RecentLogs()
+	assert.Regexp(`\[ERROR\] captured for support$`, logs[len(logs)-1])
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/kaleido-io/ethconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogSamplingConf configures the sampling of log entries, so the diagnostics of one busy module
+// do not flood the logs at production throughput. The first rule that matches an entry applies
+type LogSamplingConf struct {
+	Rules []*LogSamplingRule `json:"rules,omitempty"`
+}
+
+// LogSamplingRule keeps 1 in every Every of the log entries that match it, or none of them if Every
+// is zero. Module is the package the entry is logged from, such as "eth" or "events", and Match a
+// regular expression the message must match. Only entries at MaxLevel or below are sampled, which
+// is "debug" by default, so warnings and errors are never dropped unless a rule asks for it
+type LogSamplingRule struct {
+	Module   string `json:"module,omitempty"`
+	Match    string `json:"match,omitempty"`
+	MaxLevel string `json:"maxLevel,omitempty"`
+	Every    int    `json:"every"`
+}
+
+type logSamplingRule struct {
+	module   string
+	match    *regexp.Regexp
+	maxLevel log.Level
+	every    uint64
+	count    uint64
+}
+
+// samplingFormatter wraps the log formatter, and formats entries that are dropped by a sampling
+// rule as nothing - so they are not written to the log, but are still passed to any hooks
+type samplingFormatter struct {
+	log.Formatter
+	rules []*logSamplingRule
+}
+
+// ParseLogSamplingRule parses a rule from the command line, in the format module[:match]=every
+func ParseLogSamplingRule(s string) (*LogSamplingRule, error) {
+	eq := strings.LastIndex(s, "=")
+	if eq < 0 {
+		return nil, errors.Errorf(errors.ConfigLogSamplingBadRule, s)
+	}
+	every, err := strconv.Atoi(s[eq+1:])
+	if err != nil {
+		return nil, errors.Errorf(errors.ConfigLogSamplingBadRule, s)
+	}
+	rule := &LogSamplingRule{Module: s[0:eq], Every: every}
+	if colon := strings.Index(rule.Module, ":"); colon >= 0 {
+		rule.Match = rule.Module[colon+1:]
+		rule.Module = rule.Module[0:colon]
+	}
+	return rule, nil
+}
+
+// SetLogSampling applies the sampling rules to the log formatter, replacing any applied before.
+// The module of each entry is only looked up when a rule needs it, as it costs a stack walk
+func SetLogSampling(conf *LogSamplingConf) error {
+	rules := make([]*logSamplingRule, 0, len(conf.Rules))
+	reportCaller := false
+	for _, r := range conf.Rules {
+		rule, err := r.compile()
+		if err != nil {
+			return err
+		}
+		reportCaller = reportCaller || rule.module != ""
+		rules = append(rules, rule)
+	}
+
+	formatter := log.StandardLogger().Formatter
+	if sf, ok := formatter.(*samplingFormatter); ok {
+		formatter = sf.Formatter
+	}
+	if len(rules) == 0 {
+		log.SetFormatter(formatter)
+		log.SetReportCaller(false)
+		return nil
+	}
+	log.SetFormatter(&samplingFormatter{Formatter: formatter, rules: rules})
+	log.SetReportCaller(reportCaller)
+	log.Infof("Log sampling enabled with %d rules", len(rules))
+	return nil
+}
+
+func (r *LogSamplingRule) compile() (*logSamplingRule, error) {
+	if (r.Module == "" && r.Match == "") || r.Every < 0 {
+		return nil, errors.Errorf(errors.ConfigLogSamplingBadRule, r.String())
+	}
+	rule := &logSamplingRule{
+		module:   r.Module,
+		maxLevel: log.DebugLevel,
+		every:    uint64(r.Every),
+	}
+	if r.Match != "" {
+		match, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, errors.Errorf(errors.ConfigLogSamplingBadRule, r.String())
+		}
+		rule.match = match
+	}
+	if r.MaxLevel != "" {
+		maxLevel, err := log.ParseLevel(r.MaxLevel)
+		if err != nil {
+			return nil, errors.Errorf(errors.ConfigLogSamplingBadRule, r.String())
+		}
+		rule.maxLevel = maxLevel
+	}
+	return rule, nil
+}
+
+func (r *LogSamplingRule) String() string {
+	s := r.Module
+	if r.Match != "" {
+		s += ":" + r.Match
+	}
+	return s + "=" + strconv.Itoa(r.Every)
+}
+
+// callerModule returns the last element of the package an entry was logged from
+func callerModule(entry *log.Entry) string {
+	if entry.Caller == nil {
+		return ""
+	}
+	pkg := entry.Caller.Function
+	if slash := strings.LastIndex(pkg, "/"); slash >= 0 {
+		pkg = pkg[slash+1:]
+	}
+	if dot := strings.Index(pkg, "."); dot >= 0 {
+		pkg = pkg[0:dot]
+	}
+	return pkg
+}
+
+func (r *logSamplingRule) matches(entry *log.Entry) bool {
+	if entry.Level < r.maxLevel {
+		return false
+	}
+	if r.module != "" && r.module != callerModule(entry) {
+		return false
+	}
+	return r.match == nil || r.match.MatchString(entry.Message)
+}
+
+// Format drops the entries a rule does not keep. The entries that are kept are marked with the
+// rate they are sampled at, so it is clear from the log that others like them were dropped
+func (f *samplingFormatter) Format(entry *log.Entry) ([]byte, error) {
+	for _, rule := range f.rules {
+		if !rule.matches(entry) {
+			continue
+		}
+		if rule.every == 0 || (atomic.AddUint64(&rule.count, 1)-1)%rule.every != 0 {
+			return nil, nil
+		}
+		if rule.every > 1 {
+			entry.Data["sampled"] = "1/" + strconv.FormatUint(rule.every, 10)
+		}
+		break
+	}
+	return f.Formatter.Format(entry)
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureLogs(level log.Level) (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	formatter := log.StandardLogger().Formatter
+	prevLevel := log.GetLevel()
+	log.SetOutput(buf)
+	log.SetFormatter(&log.TextFormatter{DisableTimestamp: true})
+	log.SetLevel(level)
+	return buf, func() {
+		SetLogSampling(&LogSamplingConf{})
+		log.SetOutput(os.Stderr)
+		log.SetFormatter(formatter)
+		log.SetLevel(prevLevel)
+	}
+}
+
+func TestLogSamplingEvery(t *testing.T) {
+	assert := assert.New(t)
+	buf, restore := captureLogs(log.DebugLevel)
+	defer restore()
+
+	err := SetLogSampling(&LogSamplingConf{Rules: []*LogSamplingRule{
+		{Module: "utils", Match: "^poll", Every: 3},
+		{Match: "noisy", Every: 0},
+	}})
+	assert.NoError(err)
+	assert.True(log.StandardLogger().ReportCaller)
+	buf.Reset()
+
+	for i := 0; i < 7; i++ {
+		log.Debugf("poll %d", i)
+		log.Debugf("noisy %d", i)
+	}
+	log.Debugf("other")
+	log.Warnf("poll warning")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(lines, 5)
+	assert.Regexp("poll 0.*sampled=1/3", lines[0])
+	assert.Regexp("poll 3", lines[1])
+	assert.Regexp("poll 6", lines[2])
+	assert.Regexp("other", lines[3])
+	assert.Regexp("poll warning", lines[4])
+}
+
+func TestLogSamplingOtherModule(t *testing.T) {
+	assert := assert.New(t)
+	buf, restore := captureLogs(log.DebugLevel)
+	defer restore()
+
+	err := SetLogSampling(&LogSamplingConf{Rules: []*LogSamplingRule{
+		{Module: "eth", MaxLevel: "warning", Every: 0},
+	}})
+	assert.NoError(err)
+	buf.Reset()
+	log.Warnf("not from eth")
+	assert.Regexp("not from eth", buf.String())
+
+	// Clearing the rules restores the formatter
+	SetLogSampling(&LogSamplingConf{})
+	_, sampling := log.StandardLogger().Formatter.(*samplingFormatter)
+	assert.False(sampling)
+	assert.False(log.StandardLogger().ReportCaller)
+}
+
+func TestLogSamplingBadRules(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParseLogSamplingRule("eth")
+	assert.Regexp("Invalid log sampling rule 'eth'", err)
+	_, err = ParseLogSamplingRule("eth=lots")
+	assert.Regexp("Invalid log sampling rule 'eth=lots'", err)
+	rule, err := ParseLogSamplingRule("eth:a=b=100")
+	assert.NoError(err)
+	assert.Equal(&LogSamplingRule{Module: "eth", Match: "a=b", Every: 100}, rule)
+
+	err = SetLogSampling(&LogSamplingConf{Rules: []*LogSamplingRule{{Every: 10}}})
+	assert.Regexp("Invalid log sampling rule '=10'", err)
+	err = SetLogSampling(&LogSamplingConf{Rules: []*LogSamplingRule{{Module: "eth", Every: -1}}})
+	assert.Regexp("Invalid log sampling rule 'eth=-1'", err)
+	err = SetLogSampling(&LogSamplingConf{Rules: []*LogSamplingRule{{Match: "[", Every: 10}}})
+	assert.Regexp("Invalid log sampling rule ':\\[=10'", err)
+	err = SetLogSampling(&LogSamplingConf{Rules: []*LogSamplingRule{{Module: "eth", MaxLevel: "loud"}}})
+	assert.Regexp("Invalid log sampling rule 'eth=0'", err)
+}
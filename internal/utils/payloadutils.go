@@ -15,7 +15,9 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -56,7 +58,7 @@ func YAMLorJSONPayload(req *http.Request) (map[string]interface{}, error) {
 	// Unless explicitly declared as YAML, try JSON first
 	var unmarshalledAsJSON = false
 	if contentType != "application/x-yaml" && contentType != "text/yaml" {
-		err := json.Unmarshal(originalPayload, &msg)
+		err := UnmarshalJSONNumbers(originalPayload, &msg)
 		if err != nil {
 			log.Debugf("Payload is not valid JSON - trying YAML: %s", err)
 		} else {
@@ -74,3 +76,18 @@ func YAMLorJSONPayload(req *http.Request) (map[string]interface{}, error) {
 	}
 	return msg, nil
 }
+
+// UnmarshalJSONNumbers parses JSON in the same way as json.Unmarshal, except that numbers
+// in generic interface{} values are kept as json.Number. This avoids integers larger than
+// 2^53 losing precision in a float64, before they are parsed against the ABI
+func UnmarshalJSONNumbers(b []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.Errorf(errors.HelperJSONTrailingData)
+	}
+	return nil
+}
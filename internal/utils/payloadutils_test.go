@@ -16,6 +16,7 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"net/http/httptest"
 	"testing"
@@ -76,3 +77,29 @@ func TestYAMLorJSONPayloadReadError(t *testing.T) {
 	_, err := YAMLorJSONPayload(req)
 	assert.Regexp("Unable to read input data", err.Error())
 }
+
+func TestYAMLorJSONPayloadLargeInteger(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("POST", "/anything", bytes.NewReader([]byte(`{"big":12345678901234567890,"neg":-9007199254740993}`)))
+
+	v, err := YAMLorJSONPayload(req)
+	assert.NoError(err)
+	assert.Equal(json.Number("12345678901234567890"), v["big"])
+	assert.Equal(json.Number("-9007199254740993"), v["neg"])
+}
+
+func TestUnmarshalJSONNumbersTrailingData(t *testing.T) {
+	assert := assert.New(t)
+
+	var v map[string]interface{}
+	err := UnmarshalJSONNumbers([]byte(`{"a":1} {"b":2}`), &v)
+	assert.Regexp("unexpected data after the end of the value", err)
+
+	err = UnmarshalJSONNumbers([]byte(`{"a":`), &v)
+	assert.Error(err)
+
+	err = UnmarshalJSONNumbers([]byte(" {\"a\":1}\n"), &v)
+	assert.NoError(err)
+	assert.Equal(json.Number("1"), v["a"])
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// RedactedValue replaces credentials in logs, errors and diagnostics
+const RedactedValue = "***"
+
+// credentialName matches the names of configuration fields and query parameters that hold
+// credentials, such as the access_token of a WebSocket or console request
+var credentialName = regexp.MustCompile(`(?i)(password|secret|token|apikey|api_key|privatekey|credential|authorization|signature)`)
+
+// urlInText matches the URLs quoted in a message, such as an error from an HTTP client
+var urlInText = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s"'<>]+`)
+
+// IsCredentialName returns true if a field, header or query parameter of this name holds a credential
+func IsCredentialName(name string) bool {
+	return credentialName.MatchString(name)
+}
+
+// RedactURL masks the user info of a URL, keeping the username when there is a password,
+// and masks the values of the query parameters that carry credentials. An invalid URL
+// returns an empty string
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	userInfo := ""
+	if u.User != nil {
+		// Built by hand, as the URL would escape the mask
+		if _, hasPassword := u.User.Password(); hasPassword {
+			userInfo = url.User(u.User.Username()).String() + ":" + RedactedValue + "@"
+		} else {
+			userInfo = RedactedValue + "@"
+		}
+		u.User = nil
+	}
+	u.RawQuery = redactQuery(u.RawQuery, true)
+	redacted := u.String()
+	if i := strings.Index(redacted, "//"); userInfo != "" && i >= 0 {
+		redacted = redacted[:i+2] + userInfo + redacted[i+2:]
+	}
+	return redacted
+}
+
+// StripCredentials removes the user info, and the query parameters that carry credentials,
+// from a URL or request URI. An invalid URL returns an empty string
+func StripCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	u.RawQuery = redactQuery(u.RawQuery, false)
+	return u.String()
+}
+
+// RedactText redacts every URL in a message, such as an error that quotes the URL of a failed request
+func RedactText(text string) string {
+	return urlInText.ReplaceAllStringFunc(text, func(rawURL string) string {
+		if redacted := RedactURL(rawURL); redacted != "" {
+			return redacted
+		}
+		return RedactedValue
+	})
+}
+
+// redactQuery masks or removes the credential parameters of a raw query, keeping the order
+// and encoding of the others
+func redactQuery(rawQuery string, mask bool) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	kept := make([]string, 0, len(params))
+	for _, param := range params {
+		name := strings.SplitN(param, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		switch {
+		case !IsCredentialName(name):
+			kept = append(kept, param)
+		case mask:
+			kept = append(kept, strings.SplitN(param, "=", 2)[0]+"="+RedactedValue)
+		}
+	}
+	return strings.Join(kept, "&")
+}
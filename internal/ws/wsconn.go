@@ -15,6 +15,7 @@
 package ws
 
 import (
+	"context"
 	"reflect"
 	"strings"
 	"sync"
@@ -23,45 +24,93 @@ import (
 	ws "github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/kaleido-io/ethconnect/internal/auth"
 	"github.com/kaleido-io/ethconnect/internal/errors"
 	"github.com/kaleido-io/ethconnect/internal/utils"
 )
 
 type webSocketConnection struct {
-	id        string
-	server    *webSocketServer
-	conn      *ws.Conn
-	mux       sync.Mutex
-	closed    bool
-	topics    map[string]*webSocketTopic
-	broadcast chan interface{}
-	newTopic  chan bool
-	receive   chan error
-	closing   chan struct{}
+	id          string
+	server      *webSocketServer
+	conn        *ws.Conn
+	accessToken string
+	mux         sync.Mutex
+	closed      bool
+	multiplexed bool
+	topics      map[string]*webSocketTopic
+	windows     map[string]int
+	unacked     map[string][]*WebSocketBatch
+	broadcast   chan interface{}
+	newTopic    chan bool
+	receive     chan error
+	closing     chan struct{}
 }
 
 type webSocketCommandMessage struct {
-	Type    string `json:"type,omitempty"`
-	Topic   string `json:"topic,omitempty"`
-	Message string `json:"message,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Topic        string   `json:"topic,omitempty"`
+	Topics       []string `json:"topics,omitempty"`
+	Message      string   `json:"message,omitempty"`
+	Window       int      `json:"window,omitempty"`
+	BatchNumber  uint64   `json:"batchNumber,omitempty"`
+	BatchNumbers []uint64 `json:"batchNumbers,omitempty"`
 }
 
-func newConnection(server *webSocketServer, conn *ws.Conn) *webSocketConnection {
+// webSocketTopicMessage is sent to connections that listen on multiple topics, so the
+// client knows which topic each batch arrived on, and which topic to acknowledge.
+// Connections that advertised a window are also sent the number of each batch
+type webSocketTopicMessage struct {
+	Topic       string      `json:"topic"`
+	BatchNumber uint64      `json:"batchNumber,omitempty"`
+	Batch       interface{} `json:"batch"`
+}
+
+func newConnection(server *webSocketServer, conn *ws.Conn, accessToken string) *webSocketConnection {
 	wsc := &webSocketConnection{
-		id:        utils.UUIDv4(),
-		server:    server,
-		conn:      conn,
-		newTopic:  make(chan bool),
-		topics:    make(map[string]*webSocketTopic),
-		broadcast: make(chan interface{}),
-		receive:   make(chan error),
-		closing:   make(chan struct{}),
+		id:          utils.UUIDv4(),
+		server:      server,
+		conn:        conn,
+		accessToken: accessToken,
+		newTopic:    make(chan bool),
+		topics:      make(map[string]*webSocketTopic),
+		windows:     make(map[string]int),
+		unacked:     make(map[string][]*WebSocketBatch),
+		broadcast:   make(chan interface{}),
+		receive:     make(chan error),
+		closing:     make(chan struct{}),
 	}
 	go wsc.listen()
 	go wsc.sender()
+	if interval := server.authRevalidateInterval(); interval > 0 {
+		go wsc.revalidateAuth(interval)
+	}
 	return wsc
 }
 
+// revalidateAuth periodically re-checks the access token used to establish the connection,
+// so that a long-lived connection is closed once its credentials have been revoked
+func (c *webSocketConnection) revalidateAuth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closing:
+			return
+		case <-ticker.C:
+			authCtx, err := auth.WithAuthContext(context.Background(), c.accessToken)
+			if err == nil {
+				err = auth.AuthEventStreams(authCtx)
+			}
+			if err != nil {
+				log.Errorf("WS/%s: Authorization revoked: %s", c.id, err)
+				c.conn.WriteControl(ws.CloseMessage, ws.FormatCloseMessage(ws.ClosePolicyViolation, "Unauthorized"), time.Now().Add(time.Second))
+				c.close()
+				return
+			}
+		}
+	}
+}
+
 func (c *webSocketConnection) close() {
 	c.mux.Lock()
 	if !c.closed {
@@ -80,20 +129,25 @@ func (c *webSocketConnection) close() {
 
 func (c *webSocketConnection) sender() {
 	defer c.close()
+	var topics []string
 	buildCases := func() []reflect.SelectCase {
 		c.mux.Lock()
 		defer c.mux.Unlock()
-		cases := make([]reflect.SelectCase, len(c.topics)+3)
-		i := 0
+		topics = make([]string, 0, len(c.topics))
+		cases := make([]reflect.SelectCase, 0, len(c.topics)+3)
 		for _, t := range c.topics {
-			cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(t.senderChannel)}
-			i++
+			// We do not take batches from topics the client has no credit left on, so they stay
+			// with the sender (or go to another connection) until the client acknowledges
+			if c.hasCredit(t.topic) {
+				cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(t.senderChannel)})
+				topics = append(topics, t.topic)
+			}
 		}
-		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.broadcast)}
-		i++
-		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.closing)}
-		i++
-		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.newTopic)}
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.broadcast)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.closing)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.newTopic)},
+		)
 		return cases
 	}
 	cases := buildCases()
@@ -105,18 +159,32 @@ func (c *webSocketConnection) sender() {
 		}
 
 		if chosen == len(cases)-1 {
-			// Addition of a new topic
+			// Addition or removal of a topic
 			cases = buildCases()
-		} else {
+		} else if chosen < len(topics) {
 			// Message from one of the existing topics
+			msg, exhausted := c.batchMessage(topics[chosen], value.Interface())
+			c.conn.WriteJSON(msg)
+			if exhausted {
+				cases = buildCases()
+			}
+		} else {
+			// Broadcasts and replies are wrapped before they reach us
 			c.conn.WriteJSON(value.Interface())
 		}
 	}
 }
 
-func (c *webSocketConnection) listenTopic(t *webSocketTopic) {
+// listenTopic starts delivery of a topic to this connection. A window greater than zero limits
+// the batches awaiting acknowledgement from the client on the topic
+func (c *webSocketConnection) listenTopic(t *webSocketTopic, window int) {
 	c.mux.Lock()
 	c.topics[t.topic] = t
+	if window > 0 {
+		c.windows[t.topic] = window
+	} else {
+		delete(c.windows, t.topic)
+	}
 	c.server.ListenOnTopic(c, t.topic)
 	c.mux.Unlock()
 	select {
@@ -125,6 +193,103 @@ func (c *webSocketConnection) listenTopic(t *webSocketTopic) {
 	}
 }
 
+// unlistenTopic stops delivery of a topic to this connection. Anyone waiting for an
+// acknowledgement on the topic is woken, as they would be if the connection closed
+func (c *webSocketConnection) unlistenTopic(t *webSocketTopic) {
+	c.mux.Lock()
+	_, listening := c.topics[t.topic]
+	delete(c.topics, t.topic)
+	delete(c.windows, t.topic)
+	delete(c.unacked, t.topic)
+	c.mux.Unlock()
+	if !listening {
+		return
+	}
+	c.server.stopListeningOnTopic(c, t.topic)
+	c.server.cycleTopic(t)
+	select {
+	case c.newTopic <- true:
+	case <-c.closing:
+	}
+}
+
+// topicMessage wraps a message with its topic, if the connection is listening on multiple topics
+func (c *webSocketConnection) topicMessage(topic string, message interface{}) interface{} {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if !c.multiplexed {
+		return message
+	}
+	return &webSocketTopicMessage{Topic: topic, Batch: message}
+}
+
+// hasCredit returns true if the client can be sent another batch on a topic. Caller must hold the lock
+func (c *webSocketConnection) hasCredit(topic string) bool {
+	window := c.windows[topic]
+	return window <= 0 || len(c.unacked[topic]) < window
+}
+
+// batchMessage tracks a batch sent on a topic until the client acknowledges it, and returns the
+// message to send - including the batch number if the client advertised a window on the topic.
+// Returns true if the client has no credit left on the topic
+func (c *webSocketConnection) batchMessage(topic string, message interface{}) (interface{}, bool) {
+	batch, ok := message.(*WebSocketBatch)
+	if !ok {
+		return c.topicMessage(topic, message), false
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.unacked[topic] = append(c.unacked[topic], batch)
+	if c.windows[topic] > 0 {
+		return &webSocketTopicMessage{Topic: topic, BatchNumber: batch.BatchNumber, Batch: batch.Batch}, !c.hasCredit(topic)
+	}
+	if c.multiplexed {
+		return &webSocketTopicMessage{Topic: topic, Batch: batch.Batch}, false
+	}
+	return batch.Batch, false
+}
+
+// ackBatches removes the batches a response applies to from those awaiting acknowledgement on a
+// topic - the listed batch numbers, or the oldest batch if none are listed. Returns true if this
+// gave back credit to a client that had run out
+func (c *webSocketConnection) ackBatches(topic string, batchNumbers []uint64) (acked []*WebSocketBatch, credited bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	exhausted := !c.hasCredit(topic)
+	unacked := c.unacked[topic]
+	if len(batchNumbers) == 0 {
+		if len(unacked) > 0 {
+			acked = unacked[0:1]
+			unacked = unacked[1:]
+		}
+	} else {
+		remaining := make([]*WebSocketBatch, 0, len(unacked))
+		for _, batch := range unacked {
+			if containsBatchNumber(batchNumbers, batch.BatchNumber) {
+				acked = append(acked, batch)
+			} else {
+				remaining = append(remaining, batch)
+			}
+		}
+		unacked = remaining
+	}
+	if len(unacked) == 0 {
+		delete(c.unacked, topic)
+	} else {
+		c.unacked[topic] = unacked
+	}
+	return acked, exhausted && c.hasCredit(topic)
+}
+
+func containsBatchNumber(batchNumbers []uint64, batchNumber uint64) bool {
+	for _, n := range batchNumbers {
+		if n == batchNumber {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *webSocketConnection) listenReplies() {
 	c.server.ListenForReplies(c)
 }
@@ -141,24 +306,76 @@ func (c *webSocketConnection) listen() {
 		}
 		log.Debugf("WS/%s: Received: %+v", c.id, msg)
 
+		if len(msg.Topics) > 0 {
+			c.handleMultiTopic(&msg)
+			continue
+		}
+
 		t := c.server.getTopic(msg.Topic)
 		switch strings.ToLower(msg.Type) {
 		case "listen":
-			c.listenTopic(t)
+			c.listenTopic(t, msg.Window)
+		case "unlisten":
+			c.unlistenTopic(t)
 		case "listenreplies":
 			c.listenReplies()
 		case "ack":
-			c.handleAckOrError(t, nil)
+			c.handleAckOrError(t, &msg, nil)
 		case "error":
-			c.handleAckOrError(t, errors.Errorf(errors.EventStreamsWebSocketErrorFromClient, msg.Message))
+			c.handleAckOrError(t, &msg, errors.Errorf(errors.EventStreamsWebSocketErrorFromClient, msg.Message))
 		default:
 			log.Errorf("WS/%s: Unexpected message type: %+v", c.id, msg)
 		}
 	}
 }
 
-func (c *webSocketConnection) handleAckOrError(t *webSocketTopic, err error) {
+// handleMultiTopic listens on, or stops listening on, a list of topics. Listening with a
+// list switches the connection to wrapping each batch with its topic, and each batch must
+// then be acknowledged with the topic it arrived on
+func (c *webSocketConnection) handleMultiTopic(msg *webSocketCommandMessage) {
+	switch strings.ToLower(msg.Type) {
+	case "listen":
+		c.mux.Lock()
+		c.multiplexed = true
+		c.mux.Unlock()
+		for _, topic := range msg.Topics {
+			c.listenTopic(c.server.getTopic(topic), msg.Window)
+		}
+	case "unlisten":
+		for _, topic := range msg.Topics {
+			c.unlistenTopic(c.server.getTopic(topic))
+		}
+	default:
+		log.Errorf("WS/%s: Unexpected message type with multiple topics: %+v", c.id, msg)
+	}
+}
+
+// handleAckOrError passes a response from the client to whoever is waiting for it. Responses to
+// batches this connection is tracking go to each batch, and a response with batch numbers can
+// acknowledge several batches at once. Anything else goes to the receiver channel of the topic
+func (c *webSocketConnection) handleAckOrError(t *webSocketTopic, msg *webSocketCommandMessage, err error) {
 	isError := err != nil
+	batchNumbers := msg.BatchNumbers
+	if msg.BatchNumber > 0 {
+		batchNumbers = append(batchNumbers, msg.BatchNumber)
+	}
+	acked, credited := c.ackBatches(t.topic, batchNumbers)
+	if len(acked) > 0 || len(batchNumbers) > 0 {
+		if len(acked) == 0 {
+			log.Warnf("WS/%s: response (error='%t') on topic '%s' for batches %v that are not awaiting acknowledgement", c.id, isError, t.topic, batchNumbers)
+		}
+		for _, batch := range acked {
+			batch.Ack <- err
+		}
+		log.Debugf("WS/%s: response (error='%t') on topic '%s' passed on for %d batches", c.id, isError, t.topic, len(acked))
+		if credited {
+			select {
+			case c.newTopic <- true:
+			case <-c.closing:
+			}
+		}
+		return
+	}
 	select {
 	case <-time.After(c.server.processingTimeout):
 		log.Errorf("WS/%s: response (error='%t') on topic '%s'. We were not available to process it after %.2f seconds. Closing connection", c.id, isError, t.topic, c.server.processingTimeout.Seconds())
@@ -15,6 +15,7 @@
 package ws
 
 import (
+	"encoding/json"
 	"net/http"
 	"reflect"
 	"sync"
@@ -22,9 +23,15 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
 	log "github.com/sirupsen/logrus"
 )
 
+// WebSocketServerConf is the configuration for the WebSocket server
+type WebSocketServerConf struct {
+	AuthRevalidateSec int `json:"authRevalidateSec"`
+}
+
 // WebSocketChannels is provided to allow us to do a blocking send to a namespace that will complete once a client connects on it
 // We also provide a channel to listen on for closing of the connection, to allow a select to wake on a blocking send
 type WebSocketChannels interface {
@@ -32,6 +39,17 @@ type WebSocketChannels interface {
 	SendReply(message interface{})
 }
 
+// WebSocketBatch is a batch sent on the sender channel of a topic, that is tracked by the connection
+// it is delivered to until the client acknowledges it. Clients that advertise a window when they
+// listen are sent the batch number with each batch, can have up to the window of batches awaiting
+// acknowledgement, and can acknowledge several batches at once. The acknowledgement, or the error
+// from the client, is delivered to Ack - which must be buffered
+type WebSocketBatch struct {
+	BatchNumber uint64
+	Batch       interface{}
+	Ack         chan error
+}
+
 // WebSocketServer is the full server interface with the init call
 type WebSocketServer interface {
 	WebSocketChannels
@@ -40,6 +58,7 @@ type WebSocketServer interface {
 }
 
 type webSocketServer struct {
+	conf              *WebSocketServerConf
 	processingTimeout time.Duration
 	mux               sync.Mutex
 	topics            map[string]*webSocketTopic
@@ -59,9 +78,12 @@ type webSocketTopic struct {
 	closingChannel   chan struct{}
 }
 
-// NewWebSocketServer create a new server with a simplified interface
-func NewWebSocketServer() WebSocketServer {
+// NewWebSocketServer create a new server with a simplified interface.
+// The configuration is read as each connection is established, so can be
+// populated after construction
+func NewWebSocketServer(conf *WebSocketServerConf) WebSocketServer {
 	s := &webSocketServer{
+		conf:              conf,
 		connections:       make(map[string]*webSocketConnection),
 		topics:            make(map[string]*webSocketTopic),
 		topicMap:          make(map[string]map[string]*webSocketConnection),
@@ -80,6 +102,16 @@ func NewWebSocketServer() WebSocketServer {
 }
 
 func (s *webSocketServer) handler(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// The access token has been verified by the security module before we are called,
+	// but we need to check the connection is authorized to receive events
+	if err := auth.AuthEventStreams(r.Context()); err != nil {
+		log.Errorf("WebSocket connection unauthorized: %s", err)
+		reply, _ := json.Marshal(map[string]string{"error": "Unauthorized"})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(401)
+		w.Write(reply)
+		return
+	}
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Errorf("WebSocket upgrade failed: %s", err)
@@ -87,10 +119,17 @@ func (s *webSocketServer) handler(w http.ResponseWriter, r *http.Request, p http
 	}
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	c := newConnection(s, conn)
+	c := newConnection(s, conn, auth.GetAccessToken(r.Context()))
 	s.connections[c.id] = c
 }
 
+func (s *webSocketServer) authRevalidateInterval() time.Duration {
+	if s.conf == nil || s.conf.AuthRevalidateSec <= 0 {
+		return 0
+	}
+	return time.Duration(s.conf.AuthRevalidateSec) * time.Second
+}
+
 func (s *webSocketServer) cycleTopic(t *webSocketTopic) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
@@ -151,6 +190,12 @@ func (s *webSocketServer) ListenOnTopic(c *webSocketConnection, topic string) {
 	s.topicMap[topic][c.id] = c
 }
 
+func (s *webSocketServer) stopListeningOnTopic(c *webSocketConnection, topic string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.topicMap[topic], c.id)
+}
+
 func (s *webSocketServer) ListenForReplies(c *webSocketConnection) {
 	s.replyMap[c.id] = c
 }
@@ -188,7 +233,9 @@ func (s *webSocketServer) processBroadcasts() {
 			// Message on one of the existing topics
 			// Gather all connections interested in this topic and send to them
 			topic := topics[chosen]
-			s.broadcastToConnections(s.topicMap[topic], value.Interface())
+			for _, c := range s.topicMap[topic] {
+				c.broadcast <- c.topicMessage(topic, value.Interface())
+			}
 		}
 	}
 }
@@ -15,6 +15,7 @@
 package ws
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -24,12 +25,14 @@ import (
 
 	ws "github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
+	"github.com/kaleido-io/ethconnect/internal/auth"
+	"github.com/kaleido-io/ethconnect/internal/auth/authtest"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func newTestWebSocketServer() (*webSocketServer, *httptest.Server) {
-	s := NewWebSocketServer().(*webSocketServer)
+	s := NewWebSocketServer(&WebSocketServerConf{}).(*webSocketServer)
 	r := &httprouter.Router{}
 	s.AddRoutes(r)
 	ts := httptest.NewServer(r)
@@ -350,3 +353,341 @@ func TestSendReply(t *testing.T) {
 	c.ReadJSON(&val)
 	assert.Equal("Hello World", val)
 }
+
+func newTestAuthWebSocketServer(token string) (*webSocketServer, *httptest.Server) {
+	s := NewWebSocketServer(&WebSocketServerConf{}).(*webSocketServer)
+	r := &httprouter.Router{}
+	s.AddRoutes(r)
+	ts := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		ctx, err := auth.WithAuthContext(req.Context(), token)
+		if err != nil {
+			ctx = context.Background()
+		}
+		r.ServeHTTP(res, req.WithContext(ctx))
+	}))
+	return s, ts
+}
+
+func TestConnectUnauthorized(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	w, ts := newTestAuthWebSocketServer("badtoken")
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	_, res, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.Error(err)
+	assert.Equal(401, res.StatusCode)
+	assert.Empty(w.connections)
+}
+
+func TestConnectAuthorizedThenRevoked(t *testing.T) {
+	assert := assert.New(t)
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	w, ts := newTestAuthWebSocketServer("testat")
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	var wsc *webSocketConnection
+	for wsc == nil {
+		time.Sleep(10 * time.Millisecond)
+		w.mux.Lock()
+		for _, conn := range w.connections {
+			wsc = conn
+		}
+		w.mux.Unlock()
+	}
+	assert.Equal("testat", wsc.accessToken)
+
+	// Simulate the token being revoked, and check the connection is closed
+	wsc.accessToken = "revoked"
+	go wsc.revalidateAuth(1 * time.Millisecond)
+
+	var val interface{}
+	err = c.ReadJSON(&val)
+	assert.True(ws.IsCloseError(err, ws.ClosePolicyViolation))
+}
+
+func TestRevalidateAuthStopsOnClose(t *testing.T) {
+	w := NewWebSocketServer(&WebSocketServerConf{AuthRevalidateSec: 1}).(*webSocketServer)
+	assert.Equal(t, 1*time.Second, w.authRevalidateInterval())
+
+	c := &webSocketConnection{closing: make(chan struct{})}
+	close(c.closing)
+	c.revalidateAuth(1 * time.Millisecond)
+}
+
+func TestConnectMultipleTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:   "listen",
+		Topics: []string{"topic1", "topic2"},
+	})
+
+	s1, _, r1, _ := w.GetChannels("topic1")
+	s2, _, r2, _ := w.GetChannels("topic2")
+
+	// Both topics deliver on the one connection, before either is acknowledged
+	s1 <- "Hello Number 1"
+	var val webSocketTopicMessage
+	c.ReadJSON(&val)
+	assert.Equal("topic1", val.Topic)
+	assert.Equal("Hello Number 1", val.Batch)
+
+	s2 <- "Hello Number 2"
+	c.ReadJSON(&val)
+	assert.Equal("topic2", val.Topic)
+	assert.Equal("Hello Number 2", val.Batch)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:    "error",
+		Topic:   "topic2",
+		Message: "Panic!",
+	})
+	err = <-r2
+	assert.EqualError(err, "Error received from WebSocket client: Panic!")
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:  "ack",
+		Topic: "topic1",
+	})
+	err = <-r1
+	assert.NoError(err)
+
+	w.Close()
+}
+
+func TestBroadcastMultipleTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:   "listen",
+		Topics: []string{"apple", "banana"},
+	})
+
+	// Wait until the client has subscribed to the topics before proceeding
+	for len(w.topicMap["banana"]) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, b, _, _ := w.GetChannels("banana")
+	b <- "Hello World"
+
+	var val webSocketTopicMessage
+	c.ReadJSON(&val)
+	assert.Equal("banana", val.Topic)
+	assert.Equal("Hello World", val.Batch)
+
+	w.Close()
+}
+
+func TestUnlistenTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:   "listen",
+		Topics: []string{"topic1", "topic2"},
+	})
+	for len(w.topicMap["topic2"]) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _, _, closing := w.GetChannels("topic1")
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:   "unlisten",
+		Topics: []string{"topic1"},
+	})
+
+	// Anyone waiting for an ack on the topic is woken
+	<-closing
+	for len(w.topicMap["topic1"]) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(w.topicMap["topic2"], 1)
+
+	// The remaining topic is still delivered
+	s2, _, r2, _ := w.GetChannels("topic2")
+	s2 <- "Still here"
+	var val webSocketTopicMessage
+	c.ReadJSON(&val)
+	assert.Equal("topic2", val.Topic)
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:  "ack",
+		Topic: "topic2",
+	})
+	assert.NoError(<-r2)
+
+	// Unlistening on a topic that is not being listened to, or with a bad type, is ignored
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:  "unlisten",
+		Topic: "topic3",
+	})
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:   "ack",
+		Topics: []string{"topic2"},
+	})
+
+	w.Close()
+}
+
+func TestFlowControlWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:   "listen",
+		Topic:  "flow",
+		Window: 2,
+	})
+
+	s, _, _, _ := w.GetChannels("flow")
+	batches := make([]*WebSocketBatch, 3)
+	for i := range batches {
+		batches[i] = &WebSocketBatch{BatchNumber: uint64(i + 1), Batch: "Batch", Ack: make(chan error, 1)}
+	}
+
+	// The client is sent up to its window, with the number of each batch
+	s <- batches[0]
+	s <- batches[1]
+	var val webSocketTopicMessage
+	c.ReadJSON(&val)
+	assert.Equal("flow", val.Topic)
+	assert.Equal(uint64(1), val.BatchNumber)
+	assert.Equal("Batch", val.Batch)
+	c.ReadJSON(&val)
+	assert.Equal(uint64(2), val.BatchNumber)
+
+	// Then no more, until it acknowledges
+	select {
+	case s <- batches[2]:
+		assert.Fail("sent beyond the window")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:         "ack",
+		Topic:        "flow",
+		BatchNumbers: []uint64{2},
+	})
+	assert.NoError(<-batches[1].Ack)
+	s <- batches[2]
+	c.ReadJSON(&val)
+	assert.Equal(uint64(3), val.BatchNumber)
+
+	// An ack without batch numbers is for the oldest batch
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:  "ack",
+		Topic: "flow",
+	})
+	assert.NoError(<-batches[0].Ack)
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:        "error",
+		Topic:       "flow",
+		BatchNumber: 3,
+		Message:     "Panic!",
+	})
+	assert.EqualError(<-batches[2].Ack, "Error received from WebSocket client: Panic!")
+
+	w.Close()
+}
+
+func TestFlowControlNoWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&webSocketCommandMessage{
+		Type: "listen",
+	})
+
+	s, _, r, _ := w.GetChannels("")
+	batch1 := &WebSocketBatch{BatchNumber: 1, Batch: "Hello", Ack: make(chan error, 1)}
+	batch2 := &WebSocketBatch{BatchNumber: 2, Batch: "World", Ack: make(chan error, 1)}
+	s <- batch1
+	s <- batch2
+
+	// Batches are delivered unwrapped, and acknowledged in the order they were sent
+	var val string
+	c.ReadJSON(&val)
+	assert.Equal("Hello", val)
+	c.ReadJSON(&val)
+	assert.Equal("World", val)
+
+	// Batch numbers that are not awaiting acknowledgement are ignored
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:        "ack",
+		BatchNumber: 99,
+	})
+	c.WriteJSON(&webSocketCommandMessage{
+		Type: "ack",
+	})
+	assert.NoError(<-batch1.Ack)
+	c.WriteJSON(&webSocketCommandMessage{
+		Type:    "error",
+		Message: "Panic!",
+	})
+	assert.EqualError(<-batch2.Ack, "Error received from WebSocket client: Panic!")
+
+	// Once nothing is awaiting acknowledgement, responses go to the receiver
+	c.WriteJSON(&webSocketCommandMessage{
+		Type: "ack",
+	})
+	assert.NoError(<-r)
+
+	w.Close()
+}
@@ -19,6 +19,7 @@ import (
 	"os"
 
 	"github.com/kaleido-io/ethconnect/cmd"
+	"github.com/kaleido-io/ethconnect/internal/utils"
 )
 
 var buildDate, buildVersion string // Set by ldflags
@@ -27,6 +28,7 @@ func main() {
 	print("Copyright (C) 2018,2021 Kaleido\n" +
 		"Licensed under the Apache License, Version 2.0\n")
 	print(fmt.Sprintf("Version: %s (Build Date: %s)\n\n", buildVersion, buildDate))
+	utils.SetBuildInfo(buildVersion, buildDate)
 	exitVal := cmd.Execute()
 	os.Exit(exitVal)
 }
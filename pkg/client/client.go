@@ -0,0 +1,184 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package client is a Go client for the REST and websocket APIs of ethconnect, for services
+// that submit transactions, query contracts, read receipts, manage event streams or use the
+// contract registry of an ethconnect server
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout = 2 * time.Minute
+	// fly is the default short prefix of the ethconnect query parameters, such as fly-from
+	flyPrefix = "fly-"
+)
+
+// Config is the configuration of a Client
+type Config struct {
+	// URL is the base URL of the ethconnect REST API, such as http://localhost:8080
+	URL string
+	// Headers are added to every request, such as an Authorization header for the security module
+	Headers http.Header
+	// Username and Password are sent with basic authentication, if set
+	Username string
+	Password string
+	// Timeout of each request. Defaults to 2 minutes, and is ignored if HTTPClient is set
+	Timeout time.Duration
+	// HTTPClient is used for requests instead of a client created with the Timeout
+	HTTPClient *http.Client
+}
+
+// Client calls the REST API of an ethconnect server. It is safe for concurrent use
+type Client struct {
+	conf       Config
+	baseURL    *url.URL
+	httpClient *http.Client
+}
+
+// Error is returned for a request that ethconnect rejected or failed, with the status code
+// and message of the response
+type Error struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"error"`
+	Retryable  bool   `json:"retryable"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ethconnect returned [%d]: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if the error is a 404 from ethconnect
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// New creates a client for the ethconnect server at the configured URL
+func New(conf Config) (*Client, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(conf.URL, "/"))
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return nil, fmt.Errorf("invalid ethconnect URL '%s'", conf.URL)
+	}
+	httpClient := conf.HTTPClient
+	if httpClient == nil {
+		timeout := conf.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		httpClient = &http.Client{Timeout: timeout}
+	}
+	return &Client{
+		conf:       conf,
+		baseURL:    baseURL,
+		httpClient: httpClient,
+	}, nil
+}
+
+// url builds the URL of a request from path segments, each of which is escaped
+func (c *Client) url(query url.Values, segments ...string) string {
+	u := *c.baseURL
+	rawPath := u.EscapedPath()
+	for _, segment := range segments {
+		u.Path += "/" + segment
+		rawPath += "/" + url.PathEscape(segment)
+	}
+	u.RawPath = rawPath
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func (c *Client) newRequest(ctx context.Context, method, u string, body interface{}) (*http.Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range c.conf.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if c.conf.Username != "" || c.conf.Password != "" {
+		req.SetBasicAuth(c.conf.Username, c.conf.Password)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// send performs a request and returns the status and body of the response, or an *Error if
+// the status was not a 2xx
+func (c *Client) send(req *http.Request) (int, []byte, error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		restErr := &Error{StatusCode: res.StatusCode}
+		if json.Unmarshal(resBody, restErr) != nil || restErr.Message == "" {
+			restErr.Message = strings.TrimSpace(string(resBody))
+		}
+		if restErr.Message == "" {
+			restErr.Message = http.StatusText(res.StatusCode)
+		}
+		return res.StatusCode, resBody, restErr
+	}
+	return res.StatusCode, resBody, nil
+}
+
+// do performs a request with an optional JSON body, parsing the JSON response into result
+func (c *Client) do(ctx context.Context, method, u string, body, result interface{}) error {
+	req, err := c.newRequest(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	_, resBody, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	if result != nil && len(resBody) > 0 {
+		if err := json.Unmarshal(resBody, result); err != nil {
+			return fmt.Errorf("invalid response from ethconnect for %s %s: %s", method, req.URL.Path, err)
+		}
+	}
+	return nil
+}
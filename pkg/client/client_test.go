@@ -0,0 +1,179 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type capturedRequest struct {
+	method string
+	path   string
+	query  map[string][]string
+	header http.Header
+	body   map[string]interface{}
+}
+
+// newTestClient starts a server that records each request, and replies with the status and body
+func newTestClient(t *testing.T, status int, reply string) (*Client, *[]*capturedRequest, func()) {
+	captured := []*capturedRequest{}
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		c := &capturedRequest{
+			method: req.Method,
+			path:   req.URL.EscapedPath(),
+			query:  req.URL.Query(),
+			header: req.Header,
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		if len(b) > 0 {
+			json.Unmarshal(b, &c.body)
+		}
+		captured = append(captured, c)
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(status)
+		res.Write([]byte(reply))
+	}))
+	c, err := New(Config{URL: svr.URL + "/", Headers: http.Header{"Authorization": []string{"Bearer token1"}}})
+	assert.NoError(t, err)
+	return c, &captured, svr.Close
+}
+
+func TestNewInvalidURL(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New(Config{URL: "not a url"})
+	assert.EqualError(err, "invalid ethconnect URL 'not a url'")
+
+	_, err = New(Config{URL: "ftp://localhost"})
+	assert.Error(err)
+}
+
+func TestNewDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := New(Config{URL: "http://localhost:8080"})
+	assert.NoError(err)
+	assert.Equal(defaultTimeout, c.httpClient.Timeout)
+
+	httpClient := &http.Client{}
+	c, err = New(Config{URL: "https://localhost", HTTPClient: httpClient, Timeout: time.Second})
+	assert.NoError(err)
+	assert.Equal(httpClient, c.httpClient)
+}
+
+func TestURLEscapesSegments(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _ := New(Config{URL: "http://localhost:8080/api/"})
+	assert.Equal("http://localhost:8080/api/contracts/my%20contract/set%2Fvalue", c.url(nil, "contracts", "my contract", "set/value"))
+	assert.Equal("http://localhost:8080/api/abis?x=1", c.url(map[string][]string{"x": {"1"}}, "abis"))
+}
+
+func TestRequestHeaders(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `[]`)
+	defer done()
+
+	_, err := c.ListContracts(context.Background())
+	assert.NoError(err)
+	req := (*captured)[0]
+	assert.Equal("Bearer token1", req.header.Get("Authorization"))
+	assert.Equal("application/json", req.header.Get("Accept"))
+}
+
+func TestRequestBasicAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `[]`)
+	defer done()
+	c.conf.Headers = nil
+	c.conf.Username = "user1"
+	c.conf.Password = "pass1"
+
+	_, err := c.ListContracts(context.Background())
+	assert.NoError(err)
+	user, pass, ok := (&http.Request{Header: (*captured)[0].header}).BasicAuth()
+	assert.True(ok)
+	assert.Equal("user1", user)
+	assert.Equal("pass1", pass)
+}
+
+func TestErrorResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 404, `{"error":"not found","retryable":false}`)
+	defer done()
+
+	_, err := c.GetContract(context.Background(), "0x123")
+	assert.EqualError(err, "ethconnect returned [404]: not found")
+	assert.True(IsNotFound(err))
+	assert.False(IsNotFound(fmt.Errorf("pop")))
+}
+
+func TestErrorResponseNotJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 502, `bad gateway`)
+	defer done()
+
+	_, err := c.ListABIs(context.Background())
+	assert.EqualError(err, "ethconnect returned [502]: bad gateway")
+
+	c, _, done2 := newTestClient(t, 503, ``)
+	defer done2()
+	_, err = c.ListABIs(context.Background())
+	assert.EqualError(err, "ethconnect returned [503]: Service Unavailable")
+}
+
+func TestRetryableError(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 429, `{"error":"too many requests","retryable":true}`)
+	defer done()
+
+	_, err := c.ListStreams(context.Background())
+	assert.True(err.(*Error).Retryable)
+	assert.Equal(429, err.(*Error).StatusCode)
+}
+
+func TestInvalidResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 200, `{!`)
+	defer done()
+
+	_, err := c.GetStream(context.Background(), "es1")
+	assert.Regexp("invalid response from ethconnect for GET /eventstreams/es1", err)
+}
+
+func TestConnectionFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 200, `{}`)
+	done()
+
+	_, err := c.GetABI(context.Background(), "abi1")
+	assert.Error(err)
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// ReplyTypeSuccess is the type of the receipt of a successful transaction
+	ReplyTypeSuccess = "TransactionSuccess"
+	// ReplyTypeFailure is the type of the receipt of a transaction that was mined, but reverted
+	ReplyTypeFailure = "TransactionFailure"
+	// ReplyTypeError is the type of a reply for a transaction that could not be submitted
+	ReplyTypeError = "Error"
+	// ReplyTypeConfirmed replaces the receipt of a transaction once it has enough confirmations
+	ReplyTypeConfirmed = "TransactionConfirmed"
+	// ReplyTypeProgress is stored for a transaction until its receipt arrives
+	ReplyTypeProgress = "TransactionProgress"
+	// ReplyTypeDryRun is the reply to a deployment made with the dry run option
+	ReplyTypeDryRun = "DeployContractDryRun"
+
+	defaultReceiptPollInterval = time.Second
+)
+
+// ReplyHeaders are the headers of a receipt or error reply
+type ReplyHeaders struct {
+	ID            string                 `json:"id,omitempty"`
+	Type          string                 `json:"type"`
+	Context       map[string]interface{} `json:"ctx,omitempty"`
+	RequestID     string                 `json:"requestId"`
+	RequestOffset string                 `json:"requestOffset"`
+	TimeReceived  string                 `json:"timeReceived"`
+	TimeElapsed   float64                `json:"timeElapsed"`
+}
+
+// ReceiptEvent is an event emitted by a transaction, decoded with the ABI of the contract
+type ReceiptEvent struct {
+	Address   string                 `json:"address"`
+	Signature string                 `json:"signature"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Receipt is the reply to a transaction - the receipt once mined, or an error reply if the
+// transaction could not be submitted. Numbers are decimal strings
+type Receipt struct {
+	Headers           ReplyHeaders    `json:"headers"`
+	BlockHash         string          `json:"blockHash,omitempty"`
+	BlockNumber       string          `json:"blockNumber,omitempty"`
+	BlockTimestamp    string          `json:"blockTimestamp,omitempty"`
+	Confirmations     string          `json:"confirmations,omitempty"`
+	ContractAddress   string          `json:"contractAddress,omitempty"`
+	OpenAPI           string          `json:"openapi,omitempty"`
+	CumulativeGasUsed string          `json:"cumulativeGasUsed,omitempty"`
+	EffectiveGasPrice string          `json:"effectiveGasPrice,omitempty"`
+	Fee               string          `json:"fee,omitempty"`
+	From              string          `json:"from,omitempty"`
+	GasUsed           string          `json:"gasUsed,omitempty"`
+	Nonce             string          `json:"nonce,omitempty"`
+	Status            string          `json:"status,omitempty"`
+	To                string          `json:"to,omitempty"`
+	TransactionHash   string          `json:"transactionHash,omitempty"`
+	TransactionIndex  string          `json:"transactionIndex,omitempty"`
+	RegisterAs        string          `json:"registerAs,omitempty"`
+	RevertReason      string          `json:"revertReason,omitempty"`
+	ErrorMessage      string          `json:"errorMessage,omitempty"`
+	Retryable         bool            `json:"retryable,omitempty"`
+	Events            []*ReceiptEvent `json:"events,omitempty"`
+	ReceivedAt        int64           `json:"receivedAt,omitempty"`
+}
+
+// IsSuccess returns true if the transaction was mined successfully
+func (r *Receipt) IsSuccess() bool {
+	return r.Headers.Type == ReplyTypeSuccess || r.Headers.Type == ReplyTypeConfirmed || r.Headers.Type == ReplyTypeDryRun
+}
+
+// IsFinal returns true if the reply is the outcome of the transaction, rather than progress
+func (r *Receipt) IsFinal() bool {
+	return r.Headers.Type != "" && r.Headers.Type != ReplyTypeProgress
+}
+
+// failure returns a message describing why a transaction failed
+func (r *Receipt) failure() string {
+	switch {
+	case r.ErrorMessage != "":
+		return r.ErrorMessage
+	case r.RevertReason != "":
+		return r.RevertReason
+	default:
+		return r.Headers.Type
+	}
+}
+
+// ReceiptQuery filters a list of receipts. Zero values are not sent
+type ReceiptQuery struct {
+	IDs   []string
+	Limit int
+	Skip  int
+	Since time.Time
+	From  string
+	To    string
+}
+
+// GetReceipt returns the receipt stored for a request. Returns an error for which
+// IsNotFound is true if no reply has been stored yet
+func (c *Client) GetReceipt(ctx context.Context, requestID string) (*Receipt, error) {
+	var receipt Receipt
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "replies", requestID), nil, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// ListReceipts returns the most recent receipts matching a query
+func (c *Client) ListReceipts(ctx context.Context, query *ReceiptQuery) ([]*Receipt, error) {
+	q := url.Values{}
+	if query != nil {
+		q["id"] = query.IDs
+		if query.Limit > 0 {
+			q.Set("limit", strconv.Itoa(query.Limit))
+		}
+		if query.Skip > 0 {
+			q.Set("skip", strconv.Itoa(query.Skip))
+		}
+		if !query.Since.IsZero() {
+			q.Set("since", query.Since.UTC().Format(time.RFC3339Nano))
+		}
+		if query.From != "" {
+			q.Set("from", query.From)
+		}
+		if query.To != "" {
+			q.Set("to", query.To)
+		}
+	}
+	var receipts []*Receipt
+	if err := c.do(ctx, http.MethodGet, c.url(q, "replies"), nil, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// WaitForReceipt polls the receipt store until the outcome of a request is stored, or the
+// context ends. Polls every second if pollInterval is zero
+func (c *Client) WaitForReceipt(ctx context.Context, requestID string, pollInterval time.Duration) (*Receipt, error) {
+	if pollInterval <= 0 {
+		pollInterval = defaultReceiptPollInterval
+	}
+	for {
+		receipt, err := c.GetReceipt(ctx, requestID)
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		if receipt != nil && receipt.IsFinal() {
+			return receipt, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{"headers":{"type":"Error","requestId":"req1"},"errorMessage":"nonce too low"}`)
+	defer done()
+
+	receipt, err := c.GetReceipt(context.Background(), "req1")
+	assert.NoError(err)
+	assert.Equal("/replies/req1", (*captured)[0].path)
+	assert.True(receipt.IsFinal())
+	assert.False(receipt.IsSuccess())
+	assert.Equal("nonce too low", receipt.failure())
+}
+
+func TestGetReceiptNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 404, `{"error":"Not found"}`)
+	defer done()
+
+	_, err := c.GetReceipt(context.Background(), "req1")
+	assert.True(IsNotFound(err))
+}
+
+func TestListReceipts(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `[{"headers":{"type":"TransactionSuccess","requestId":"req1"}}]`)
+	defer done()
+
+	since := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	receipts, err := c.ListReceipts(context.Background(), &ReceiptQuery{
+		IDs:   []string{"req1", "req2"},
+		Limit: 5,
+		Skip:  10,
+		Since: since,
+		From:  "0xabcd",
+		To:    "0x1234",
+	})
+	assert.NoError(err)
+	assert.Len(receipts, 1)
+	req := (*captured)[0]
+	assert.Equal("/replies", req.path)
+	assert.Equal([]string{"req1", "req2"}, req.query["id"])
+	assert.Equal("5", req.query["limit"][0])
+	assert.Equal("10", req.query["skip"][0])
+	assert.Equal("2021-06-01T12:00:00Z", req.query["since"][0])
+	assert.Equal("0xabcd", req.query["from"][0])
+	assert.Equal("0x1234", req.query["to"][0])
+
+	_, err = c.ListReceipts(context.Background(), nil)
+	assert.NoError(err)
+	assert.Empty((*captured)[1].query)
+}
+
+func TestWaitForReceipt(t *testing.T) {
+	assert := assert.New(t)
+
+	replies := []string{
+		``,
+		`{"headers":{"type":"TransactionProgress","requestId":"req1"}}`,
+		`{"headers":{"type":"TransactionSuccess","requestId":"req1"},"transactionHash":"0xfeed"}`,
+	}
+	calls := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		reply := replies[calls]
+		calls++
+		if reply == "" {
+			res.WriteHeader(404)
+			res.Write([]byte(`{"error":"Not found"}`))
+			return
+		}
+		res.Write([]byte(reply))
+	}))
+	defer svr.Close()
+	c, _ := New(Config{URL: svr.URL})
+
+	receipt, err := c.WaitForReceipt(context.Background(), "req1", time.Millisecond)
+	assert.NoError(err)
+	assert.Equal("0xfeed", receipt.TransactionHash)
+	assert.Equal(3, calls)
+}
+
+func TestWaitForReceiptError(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 500, `{"error":"query failed"}`)
+	defer done()
+
+	_, err := c.WaitForReceipt(context.Background(), "req1", 0)
+	assert.EqualError(err, "ethconnect returned [500]: query failed")
+}
+
+func TestWaitForReceiptContextEnds(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 404, `{"error":"Not found"}`)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := c.WaitForReceipt(ctx, "req1", time.Millisecond)
+	assert.Error(err)
+}
+
+func TestReceiptFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("reverted", (&Receipt{RevertReason: "reverted"}).failure())
+	assert.Equal(ReplyTypeFailure, (&Receipt{Headers: ReplyHeaders{Type: ReplyTypeFailure}}).failure())
+	assert.False((&Receipt{}).IsFinal())
+	assert.True((&Receipt{Headers: ReplyHeaders{Type: ReplyTypeConfirmed}}).IsSuccess())
+}
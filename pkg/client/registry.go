@@ -0,0 +1,139 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// ContractInfo is a contract instance in the registry of ethconnect
+type ContractInfo struct {
+	Created         string            `json:"created,omitempty"`
+	Address         string            `json:"address"`
+	Path            string            `json:"path"`
+	ABI             string            `json:"abi"`
+	OpenAPI         string            `json:"openapi"`
+	RegisteredAs    string            `json:"registeredAs"`
+	Policy          json.RawMessage   `json:"policy,omitempty"`
+	ConstructorArgs []interface{}     `json:"constructorArgs,omitempty"`
+	ConstructorData string            `json:"constructorData,omitempty"`
+	Upgrades        []json.RawMessage `json:"upgrades,omitempty"`
+	AllowMethods    []string          `json:"allowMethods,omitempty"`
+	DenyMethods     []string          `json:"denyMethods,omitempty"`
+}
+
+// ABIInfo is an ABI stored in ethconnect, which instances can be deployed from or registered against
+type ABIInfo struct {
+	Created          string          `json:"created,omitempty"`
+	ID               string          `json:"id"`
+	Name             string          `json:"name"`
+	Description      string          `json:"description"`
+	Path             string          `json:"path"`
+	Deployable       bool            `json:"deployable"`
+	OpenAPI          string          `json:"openapi"`
+	CompilerVersion  string          `json:"compilerVersion"`
+	Policy           json.RawMessage `json:"policy,omitempty"`
+	CompilerWarnings []string        `json:"compilerWarnings,omitempty"`
+}
+
+// ABIUpload is an ABI, and optional bytecode, compiled outside of ethconnect. The fields match
+// the artifacts written by Truffle and Hardhat. Without bytecode the ABI cannot be deployed, but
+// can be registered against existing contracts
+type ABIUpload struct {
+	ContractName     string          `json:"contractName,omitempty"`
+	ABI              json.RawMessage `json:"abi"`
+	Bytecode         string          `json:"bytecode,omitempty"`
+	DeployedBytecode string          `json:"deployedBytecode,omitempty"`
+	DevDoc           json.RawMessage `json:"devdoc,omitempty"`
+	UserDoc          json.RawMessage `json:"userdoc,omitempty"`
+	CompilerVersion  string          `json:"compilerVersion,omitempty"`
+}
+
+// ListContracts returns the registered contract instances
+func (c *Client) ListContracts(ctx context.Context) ([]*ContractInfo, error) {
+	var contracts []*ContractInfo
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "contracts"), nil, &contracts); err != nil {
+		return nil, err
+	}
+	return contracts, nil
+}
+
+// GetContract returns a contract instance by address or registered name
+func (c *Client) GetContract(ctx context.Context, address string) (*ContractInfo, error) {
+	var info ContractInfo
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "contracts", address), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetContractABI returns the JSON ABI of a contract instance, by address or registered name
+func (c *Client) GetContractABI(ctx context.Context, address string) (json.RawMessage, error) {
+	var abi json.RawMessage
+	if err := c.do(ctx, http.MethodGet, c.url(url.Values{"abi": []string{""}}, "contracts", address), nil, &abi); err != nil {
+		return nil, err
+	}
+	return abi, nil
+}
+
+// RegisterContract registers an existing contract against a stored ABI, optionally with a name
+func (c *Client) RegisterContract(ctx context.Context, abiID, address, registerAs string) (*ContractInfo, error) {
+	q := url.Values{}
+	setFlyParam(q, "register", registerAs)
+	var info ContractInfo
+	if err := c.do(ctx, http.MethodPost, c.url(q, "abis", abiID, address), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ListABIs returns the stored ABIs
+func (c *Client) ListABIs(ctx context.Context) ([]*ABIInfo, error) {
+	var abis []*ABIInfo
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "abis"), nil, &abis); err != nil {
+		return nil, err
+	}
+	return abis, nil
+}
+
+// GetABI returns a stored ABI by ID
+func (c *Client) GetABI(ctx context.Context, abiID string) (*ABIInfo, error) {
+	var info ABIInfo
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "abis", abiID), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// UploadABI stores an ABI compiled outside of ethconnect
+func (c *Client) UploadABI(ctx context.Context, upload *ABIUpload) (*ABIInfo, error) {
+	var info ABIInfo
+	if err := c.do(ctx, http.MethodPost, c.url(nil, "abis"), upload, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// GetInstanceABI returns the JSON ABI of a contract instance looked up in the remote registry
+func (c *Client) GetInstanceABI(ctx context.Context, lookup string) (json.RawMessage, error) {
+	var abi json.RawMessage
+	if err := c.do(ctx, http.MethodGet, c.url(url.Values{"abi": []string{""}}, "instances", lookup), nil, &abi); err != nil {
+		return nil, err
+	}
+	return abi, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListContracts(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 200, `[{"address":"12345","abi":"abi1","registeredAs":"mycontract","allowMethods":["set"]}]`)
+	defer done()
+
+	contracts, err := c.ListContracts(context.Background())
+	assert.NoError(err)
+	assert.Equal("mycontract", contracts[0].RegisteredAs)
+	assert.Equal([]string{"set"}, contracts[0].AllowMethods)
+}
+
+func TestGetContractAndABI(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `[{"type":"function","name":"set"}]`)
+	defer done()
+
+	abi, err := c.GetContractABI(context.Background(), "mycontract")
+	assert.NoError(err)
+	assert.JSONEq(`[{"type":"function","name":"set"}]`, string(abi))
+	req := (*captured)[0]
+	assert.Equal("/contracts/mycontract", req.path)
+	assert.Contains(req.query, "abi")
+
+	_, err = c.GetInstanceABI(context.Background(), "instance1")
+	assert.NoError(err)
+	assert.Equal("/instances/instance1", (*captured)[1].path)
+	assert.Contains((*captured)[1].query, "abi")
+}
+
+func TestRegisterContract(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 201, `{"address":"12345","abi":"abi1","registeredAs":"mycontract"}`)
+	defer done()
+
+	info, err := c.RegisterContract(context.Background(), "abi1", "0x12345", "mycontract")
+	assert.NoError(err)
+	assert.Equal("abi1", info.ABI)
+	req := (*captured)[0]
+	assert.Equal("POST /abis/abi1/0x12345", req.method+" "+req.path)
+	assert.Equal("mycontract", req.query["fly-register"][0])
+}
+
+func TestABIs(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{"id":"abi1","name":"SimpleStorage","deployable":true}`)
+	defer done()
+	ctx := context.Background()
+
+	info, err := c.UploadABI(ctx, &ABIUpload{
+		ContractName: "SimpleStorage",
+		ABI:          json.RawMessage(`[]`),
+		Bytecode:     "0x6080",
+	})
+	assert.NoError(err)
+	assert.True(info.Deployable)
+	req := (*captured)[0]
+	assert.Equal("POST /abis", req.method+" "+req.path)
+	assert.Equal("application/json", req.header.Get("Content-Type"))
+	assert.Equal("0x6080", req.body["bytecode"])
+
+	_, err = c.GetABI(ctx, "abi1")
+	assert.NoError(err)
+	assert.Equal("GET /abis/abi1", (*captured)[1].method+" "+(*captured)[1].path)
+
+	_, err = c.ListABIs(ctx)
+	assert.Error(err, "object returned for the list")
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	// StreamTypeWebhook streams deliver events with a POST to a URL
+	StreamTypeWebhook = "webhook"
+	// StreamTypeWebSocket streams deliver events to websocket clients listening on a topic
+	StreamTypeWebSocket = "websocket"
+)
+
+// StreamWebhook is the webhook configuration of an event stream
+type StreamWebhook struct {
+	URL               string            `json:"url,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+	TLSkipHostVerify  bool              `json:"tlsSkipHostVerify,omitempty"`
+	RequestTimeoutSec uint32            `json:"requestTimeoutSec,omitempty"`
+	ProxyURL          string            `json:"proxyURL,omitempty"`
+	Auth              json.RawMessage   `json:"auth,omitempty"`
+	ProbeURL          string            `json:"probeURL,omitempty"`
+}
+
+// StreamWebSocket is the websocket configuration of an event stream
+type StreamWebSocket struct {
+	Topic            string `json:"topic,omitempty"`
+	DistributionMode string `json:"distributionMode,omitempty"`
+}
+
+// Stream is an event stream, which delivers the events of its subscriptions in batches.
+// Less common options are passed through as raw JSON
+type Stream struct {
+	ID                   string           `json:"id,omitempty"`
+	Created              string           `json:"created,omitempty"`
+	Name                 string           `json:"name,omitempty"`
+	Path                 string           `json:"path,omitempty"`
+	Suspended            bool             `json:"suspended,omitempty"`
+	Type                 string           `json:"type,omitempty"`
+	BatchSize            uint64           `json:"batchSize,omitempty"`
+	BatchTimeoutMS       uint64           `json:"batchTimeoutMS,omitempty"`
+	MaxInFlightBatches   uint64           `json:"maxInFlightBatches,omitempty"`
+	ErrorHandling        string           `json:"errorHandling,omitempty"`
+	RetryTimeoutSec      uint64           `json:"retryTimeoutSec,omitempty"`
+	BlockedRetryDelaySec uint64           `json:"blockedReryDelaySec,omitempty"`
+	PauseAfterFailures   uint64           `json:"pauseAfterFailures,omitempty"`
+	ProbeIntervalSec     uint64           `json:"probeIntervalSec,omitempty"`
+	Webhook              *StreamWebhook   `json:"webhook,omitempty"`
+	WebSocket            *StreamWebSocket `json:"websocket,omitempty"`
+	Transaction          json.RawMessage  `json:"transaction,omitempty"`
+	Warehouse            json.RawMessage  `json:"warehouse,omitempty"`
+	Timestamps           bool             `json:"timestamps,omitempty"`
+	TimestampCacheSize   int              `json:"timestampCacheSize,omitempty"`
+	AutoResume           json.RawMessage  `json:"autoResume,omitempty"`
+	Payload              json.RawMessage  `json:"payload,omitempty"`
+	Format               string           `json:"format,omitempty"`
+	DeadLetter           bool             `json:"deadLetter,omitempty"`
+	DedupWindowSec       uint64           `json:"dedupWindowSec,omitempty"`
+}
+
+// Subscription delivers the events matching a filter to an event stream
+type Subscription struct {
+	ID        string          `json:"id,omitempty"`
+	Created   string          `json:"created,omitempty"`
+	Path      string          `json:"path,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Stream    string          `json:"stream"`
+	Filter    json.RawMessage `json:"filter,omitempty"`
+	Event     json.RawMessage `json:"event,omitempty"`
+	FromBlock string          `json:"fromBlock,omitempty"`
+}
+
+// SubscriptionRequest subscribes a stream to an event by its signature, such as
+// "Transfer(address indexed,address indexed,uint256)", from one contract or from any
+type SubscriptionRequest struct {
+	Stream    string `json:"stream"`
+	Signature string `json:"signature"`
+	Address   string `json:"address,omitempty"`
+	FromBlock string `json:"fromBlock,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Event is an event delivered by a stream
+type Event struct {
+	Address          string                 `json:"address"`
+	BlockNumber      string                 `json:"blockNumber"`
+	TransactionIndex string                 `json:"transactionIndex"`
+	TransactionHash  string                 `json:"transactionHash"`
+	Data             map[string]interface{} `json:"data"`
+	SubID            string                 `json:"subId"`
+	Signature        string                 `json:"signature"`
+	LogIndex         string                 `json:"logIndex"`
+	DedupKey         string                 `json:"dedupKey,omitempty"`
+	Timestamp        string                 `json:"timestamp,omitempty"`
+}
+
+// CreateStream creates an event stream
+func (c *Client) CreateStream(ctx context.Context, stream *Stream) (*Stream, error) {
+	var created Stream
+	if err := c.do(ctx, http.MethodPost, c.url(nil, "eventstreams"), stream, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateStream updates the options of an event stream that are set in the update
+func (c *Client) UpdateStream(ctx context.Context, id string, update *Stream) (*Stream, error) {
+	var updated Stream
+	if err := c.do(ctx, http.MethodPatch, c.url(nil, "eventstreams", id), update, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// GetStream returns an event stream by ID
+func (c *Client) GetStream(ctx context.Context, id string) (*Stream, error) {
+	var stream Stream
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "eventstreams", id), nil, &stream); err != nil {
+		return nil, err
+	}
+	return &stream, nil
+}
+
+// ListStreams returns all the event streams
+func (c *Client) ListStreams(ctx context.Context) ([]*Stream, error) {
+	var streams []*Stream
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "eventstreams"), nil, &streams); err != nil {
+		return nil, err
+	}
+	return streams, nil
+}
+
+// DeleteStream deletes an event stream, and its subscriptions
+func (c *Client) DeleteStream(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.url(nil, "eventstreams", id), nil, nil)
+}
+
+// SuspendStream stops delivery of events by a stream, until it is resumed
+func (c *Client) SuspendStream(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, c.url(nil, "eventstreams", id, "suspend"), nil, nil)
+}
+
+// ResumeStream restarts delivery of events by a suspended stream
+func (c *Client) ResumeStream(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, c.url(nil, "eventstreams", id, "resume"), nil, nil)
+}
+
+// CreateSubscription subscribes a stream to an event by its signature
+func (c *Client) CreateSubscription(ctx context.Context, sub *SubscriptionRequest) (*Subscription, error) {
+	var created Subscription
+	if err := c.do(ctx, http.MethodPost, c.url(nil, "subscriptions"), sub, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetSubscription returns a subscription by ID
+func (c *Client) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	var sub Subscription
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "subscriptions", id), nil, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// ListSubscriptions returns all the subscriptions
+func (c *Client) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	var subs []*Subscription
+	if err := c.do(ctx, http.MethodGet, c.url(nil, "subscriptions"), nil, &subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// DeleteSubscription deletes a subscription
+func (c *Client) DeleteSubscription(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.url(nil, "subscriptions", id), nil, nil)
+}
+
+// ResetSubscription restarts a subscription from a block number, or "latest"
+func (c *Client) ResetSubscription(ctx context.Context, id, fromBlock string) error {
+	body := map[string]string{"fromBlock": fromBlock}
+	return c.do(ctx, http.MethodPost, c.url(nil, "subscriptions", id, "reset"), body, nil)
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateStream(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{"id":"es1","name":"stream1","type":"webhook","webhook":{"url":"http://example.com"},"payload":{"fields":{}}}`)
+	defer done()
+
+	stream, err := c.CreateStream(context.Background(), &Stream{
+		Name:      "stream1",
+		Type:      StreamTypeWebhook,
+		BatchSize: 10,
+		Webhook:   &StreamWebhook{URL: "http://example.com"},
+	})
+	assert.NoError(err)
+	assert.Equal("es1", stream.ID)
+	assert.Equal("http://example.com", stream.Webhook.URL)
+	assert.JSONEq(`{"fields":{}}`, string(stream.Payload))
+
+	req := (*captured)[0]
+	assert.Equal("POST", req.method)
+	assert.Equal("/eventstreams", req.path)
+	assert.Equal("webhook", req.body["type"])
+	assert.Equal(float64(10), req.body["batchSize"])
+	assert.NotContains(req.body, "websocket")
+}
+
+func TestStreamOperations(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{"id":"es1"}`)
+	defer done()
+	ctx := context.Background()
+
+	_, err := c.UpdateStream(ctx, "es1", &Stream{BatchSize: 5})
+	assert.NoError(err)
+	_, err = c.GetStream(ctx, "es1")
+	assert.NoError(err)
+	assert.NoError(c.SuspendStream(ctx, "es1"))
+	assert.NoError(c.ResumeStream(ctx, "es1"))
+	assert.NoError(c.DeleteStream(ctx, "es1"))
+
+	reqs := *captured
+	assert.Equal("PATCH /eventstreams/es1", reqs[0].method+" "+reqs[0].path)
+	assert.Equal("GET /eventstreams/es1", reqs[1].method+" "+reqs[1].path)
+	assert.Equal("POST /eventstreams/es1/suspend", reqs[2].method+" "+reqs[2].path)
+	assert.Equal("POST /eventstreams/es1/resume", reqs[3].method+" "+reqs[3].path)
+	assert.Equal("DELETE /eventstreams/es1", reqs[4].method+" "+reqs[4].path)
+}
+
+func TestListStreams(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 200, `[{"id":"es1"},{"id":"es2","websocket":{"topic":"topic1"}}]`)
+	defer done()
+
+	streams, err := c.ListStreams(context.Background())
+	assert.NoError(err)
+	assert.Len(streams, 2)
+	assert.Equal("topic1", streams[1].WebSocket.Topic)
+}
+
+func TestCreateSubscription(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{"id":"sb1","stream":"es1","name":"Changed"}`)
+	defer done()
+
+	sub, err := c.CreateSubscription(context.Background(), &SubscriptionRequest{
+		Stream:    "es1",
+		Signature: "Changed(address indexed,uint256)",
+		FromBlock: "0",
+	})
+	assert.NoError(err)
+	assert.Equal("sb1", sub.ID)
+	req := (*captured)[0]
+	assert.Equal("/subscriptions", req.path)
+	assert.Equal("Changed(address indexed,uint256)", req.body["signature"])
+	assert.NotContains(req.body, "address")
+}
+
+func TestSubscriptionOperations(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `[{"id":"sb1"}]`)
+	defer done()
+	ctx := context.Background()
+
+	subs, err := c.ListSubscriptions(ctx)
+	assert.NoError(err)
+	assert.Equal("sb1", subs[0].ID)
+	assert.NoError(c.ResetSubscription(ctx, "sb1", "latest"))
+	assert.NoError(c.DeleteSubscription(ctx, "sb1"))
+
+	reqs := *captured
+	assert.Equal("GET /subscriptions", reqs[0].method+" "+reqs[0].path)
+	assert.Equal("POST /subscriptions/sb1/reset", reqs[1].method+" "+reqs[1].path)
+	assert.Equal("latest", reqs[1].body["fromBlock"])
+	assert.Equal("DELETE /subscriptions/sb1", reqs[2].method+" "+reqs[2].path)
+}
+
+func TestGetSubscriptionNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 404, `{"error":"Subscription with ID 'sb1' not found"}`)
+	defer done()
+
+	_, err := c.GetSubscription(context.Background(), "sb1")
+	assert.True(IsNotFound(err))
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// TxOptions are the options of a transaction, sent as fly-* query parameters. Only From is required
+type TxOptions struct {
+	// From is the address or signer alias that signs the transaction
+	From string
+	// ID is the request ID of the transaction, generated by ethconnect if empty
+	ID string
+	// Sync waits for the receipt, rather than returning once the transaction is accepted
+	Sync bool
+	// Gas, GasPrice and Value (in wei) are decimal strings
+	Gas      string
+	GasPrice string
+	Value    string
+	// Signer selects the signer backend, such as node or hdwallet
+	Signer string
+	// PrivateFrom, PrivateFor and PrivacyGroupID are for private transactions
+	PrivateFrom    string
+	PrivateFor     []string
+	PrivacyGroupID string
+	// Register is the name a deployed contract is registered under
+	Register string
+	// Query holds any other fly-* parameters, without the prefix
+	Query url.Values
+}
+
+// CallOptions are the options of a call to a contract method, that does not submit a transaction
+type CallOptions struct {
+	From        string
+	BlockNumber string
+	// Numbers is the format of the integer outputs, such as string or number
+	Numbers string
+	// Query holds any other fly-* parameters, without the prefix
+	Query url.Values
+}
+
+// AsyncResponse is returned when a transaction has been accepted for submission. The receipt
+// is stored under the request ID once the transaction is mined
+type AsyncResponse struct {
+	Sent bool   `json:"sent"`
+	ID   string `json:"id"`
+	Msg  string `json:"msg,omitempty"`
+}
+
+// TxResponse is the result of submitting a transaction. Async is set unless the transaction
+// was sent with TxOptions.Sync, in which case Receipt is set
+type TxResponse struct {
+	Async   *AsyncResponse
+	Receipt *Receipt
+}
+
+func flyParams(extra url.Values) url.Values {
+	q := url.Values{}
+	for k, vs := range extra {
+		q[flyPrefix+k] = vs
+	}
+	return q
+}
+
+func setFlyParam(q url.Values, name, value string) {
+	if value != "" {
+		q.Set(flyPrefix+name, value)
+	}
+}
+
+func (o *TxOptions) query() url.Values {
+	if o == nil {
+		return url.Values{}
+	}
+	q := flyParams(o.Query)
+	setFlyParam(q, "from", o.From)
+	setFlyParam(q, "id", o.ID)
+	if o.Sync {
+		q.Set(flyPrefix+"sync", "true")
+	}
+	setFlyParam(q, "gas", o.Gas)
+	setFlyParam(q, "gasprice", o.GasPrice)
+	setFlyParam(q, "ethvalue", o.Value)
+	setFlyParam(q, "signer", o.Signer)
+	setFlyParam(q, "privatefrom", o.PrivateFrom)
+	for _, p := range o.PrivateFor {
+		q.Add(flyPrefix+"privatefor", p)
+	}
+	setFlyParam(q, "privacygroupid", o.PrivacyGroupID)
+	setFlyParam(q, "register", o.Register)
+	return q
+}
+
+func (o *CallOptions) query() url.Values {
+	if o == nil {
+		return url.Values{flyPrefix + "call": []string{"true"}}
+	}
+	q := flyParams(o.Query)
+	q.Set(flyPrefix+"call", "true")
+	setFlyParam(q, "from", o.From)
+	setFlyParam(q, "blocknumber", o.BlockNumber)
+	setFlyParam(q, "numbers", o.Numbers)
+	return q
+}
+
+// SendTransaction invokes a method of a contract instance, by address or registered name.
+// For a sync transaction that fails, the receipt is returned along with the error
+func (c *Client) SendTransaction(ctx context.Context, address, method string, params map[string]interface{}, opts *TxOptions) (*TxResponse, error) {
+	return c.submit(ctx, c.url(opts.query(), "contracts", address, method), params)
+}
+
+// Deploy deploys a new instance of an ABI stored in ethconnect, with the constructor params.
+// For a sync deployment that fails, the receipt is returned along with the error
+func (c *Client) Deploy(ctx context.Context, abiID string, params map[string]interface{}, opts *TxOptions) (*TxResponse, error) {
+	return c.submit(ctx, c.url(opts.query(), "abis", abiID), params)
+}
+
+// Call calls a method of a contract instance without submitting a transaction, returning
+// the outputs by name (output, output1... for unnamed outputs)
+func (c *Client) Call(ctx context.Context, address, method string, params map[string]interface{}, opts *CallOptions) (map[string]interface{}, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	result := make(map[string]interface{})
+	if err := c.do(ctx, http.MethodPost, c.url(opts.query(), "contracts", address, method), params, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (c *Client) submit(ctx context.Context, u string, params map[string]interface{}) (*TxResponse, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, u, params)
+	if err != nil {
+		return nil, err
+	}
+	_, resBody, err := c.send(req)
+	if err != nil {
+		// A sync transaction that fails is returned with its receipt
+		if restErr, ok := err.(*Error); ok {
+			var receipt Receipt
+			if json.Unmarshal(resBody, &receipt) == nil && receipt.Headers.Type != "" {
+				restErr.Message = receipt.failure()
+				return &TxResponse{Receipt: &receipt}, restErr
+			}
+		}
+		return nil, err
+	}
+	var reply struct {
+		AsyncResponse
+		Headers *ReplyHeaders `json:"headers"`
+	}
+	if err := json.Unmarshal(resBody, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Headers == nil {
+		return &TxResponse{Async: &reply.AsyncResponse}, nil
+	}
+	var receipt Receipt
+	if err := json.Unmarshal(resBody, &receipt); err != nil {
+		return nil, err
+	}
+	return &TxResponse{Receipt: &receipt}, nil
+}
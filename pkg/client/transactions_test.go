@@ -0,0 +1,160 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendTransactionAsync(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 202, `{"sent":true,"id":"req1"}`)
+	defer done()
+
+	res, err := c.SendTransaction(context.Background(), "0x12345", "set", map[string]interface{}{"x": "1"}, &TxOptions{
+		From:       "0xabcd",
+		ID:         "req1",
+		Gas:        "100000",
+		GasPrice:   "10",
+		Value:      "5",
+		Signer:     "hdwallet",
+		PrivateFor: []string{"key1", "key2"},
+		Query:      url.Values{"nonce": []string{"3"}},
+	})
+	assert.NoError(err)
+	assert.Nil(res.Receipt)
+	assert.Equal(&AsyncResponse{Sent: true, ID: "req1"}, res.Async)
+
+	req := (*captured)[0]
+	assert.Equal("POST", req.method)
+	assert.Equal("/contracts/0x12345/set", req.path)
+	assert.Equal("1", req.body["x"])
+	assert.Equal("0xabcd", req.query["fly-from"][0])
+	assert.Equal("req1", req.query["fly-id"][0])
+	assert.Equal("100000", req.query["fly-gas"][0])
+	assert.Equal("10", req.query["fly-gasprice"][0])
+	assert.Equal("5", req.query["fly-ethvalue"][0])
+	assert.Equal("hdwallet", req.query["fly-signer"][0])
+	assert.Equal([]string{"key1", "key2"}, req.query["fly-privatefor"])
+	assert.Equal("3", req.query["fly-nonce"][0])
+	assert.Empty(req.query["fly-sync"])
+}
+
+func TestSendTransactionSync(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{
+		"headers": {"type": "TransactionSuccess", "requestId": "req1"},
+		"transactionHash": "0xfeed",
+		"blockNumber": "10",
+		"status": "1"
+	}`)
+	defer done()
+
+	res, err := c.SendTransaction(context.Background(), "mycontract", "set", nil, &TxOptions{From: "0xabcd", Sync: true})
+	assert.NoError(err)
+	assert.Nil(res.Async)
+	assert.True(res.Receipt.IsSuccess())
+	assert.Equal("req1", res.Receipt.Headers.RequestID)
+	assert.Equal("0xfeed", res.Receipt.TransactionHash)
+	assert.Equal("10", res.Receipt.BlockNumber)
+	assert.Equal("true", (*captured)[0].query["fly-sync"][0])
+	assert.NotNil((*captured)[0].body)
+}
+
+func TestSendTransactionSyncFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 500, `{
+		"headers": {"type": "TransactionFailure", "requestId": "req1"},
+		"transactionHash": "0xfeed",
+		"revertReason": "not allowed"
+	}`)
+	defer done()
+
+	res, err := c.SendTransaction(context.Background(), "0x12345", "set", nil, &TxOptions{From: "0xabcd", Sync: true})
+	assert.EqualError(err, "ethconnect returned [500]: not allowed")
+	assert.False(res.Receipt.IsSuccess())
+	assert.Equal("0xfeed", res.Receipt.TransactionHash)
+}
+
+func TestSendTransactionRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 400, `{"error":"missing from"}`)
+	defer done()
+
+	res, err := c.SendTransaction(context.Background(), "0x12345", "set", nil, nil)
+	assert.EqualError(err, "ethconnect returned [400]: missing from")
+	assert.Nil(res)
+}
+
+func TestSendTransactionBadResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, done := newTestClient(t, 200, `[]`)
+	defer done()
+
+	_, err := c.SendTransaction(context.Background(), "0x12345", "set", nil, nil)
+	assert.Error(err)
+}
+
+func TestDeploy(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 202, `{"sent":true,"id":"req2"}`)
+	defer done()
+
+	res, err := c.Deploy(context.Background(), "abi1", map[string]interface{}{"initial": 5}, &TxOptions{From: "0xabcd", Register: "mycontract"})
+	assert.NoError(err)
+	assert.Equal("req2", res.Async.ID)
+	req := (*captured)[0]
+	assert.Equal("/abis/abi1", req.path)
+	assert.Equal("mycontract", req.query["fly-register"][0])
+	assert.Equal(float64(5), req.body["initial"])
+}
+
+func TestCall(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 200, `{"output":"42"}`)
+	defer done()
+
+	res, err := c.Call(context.Background(), "0x12345", "get", nil, &CallOptions{From: "0xabcd", BlockNumber: "latest", Numbers: "string"})
+	assert.NoError(err)
+	assert.Equal("42", res["output"])
+	req := (*captured)[0]
+	assert.Equal("POST", req.method)
+	assert.Equal("/contracts/0x12345/get", req.path)
+	assert.Equal("true", req.query["fly-call"][0])
+	assert.Equal("latest", req.query["fly-blocknumber"][0])
+	assert.Equal("string", req.query["fly-numbers"][0])
+}
+
+func TestCallNoOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	c, captured, done := newTestClient(t, 500, `{"error":"call failed"}`)
+	defer done()
+
+	_, err := c.Call(context.Background(), "0x12345", "get", nil, nil)
+	assert.EqualError(err, "ethconnect returned [500]: call failed")
+	assert.Equal("true", (*captured)[0].query["fly-call"][0])
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket is a connection to the websocket API of ethconnect, which delivers the event
+// batches of websocket event streams, and the replies to transactions
+type WebSocket struct {
+	conn      *websocket.Conn
+	writeLock sync.Mutex
+}
+
+// WebSocketMessage is a message received on a websocket. Batches of events have the topic of
+// their stream set, and must be acknowledged with Ack or Nack before the next batch on the topic
+// is delivered. Replies to transactions have Reply set
+type WebSocketMessage struct {
+	Topic       string
+	BatchNumber uint64
+	// Batch is the JSON of a batch of events, and Events the batch decoded in the default format.
+	// Events is nil for streams that reshape their payload, or use another format
+	Batch  json.RawMessage
+	Events []*Event
+	Reply  *Receipt
+	// Raw is the JSON of the whole message
+	Raw json.RawMessage
+}
+
+type webSocketCommand struct {
+	Type        string   `json:"type"`
+	Topic       string   `json:"topic,omitempty"`
+	Topics      []string `json:"topics,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	BatchNumber uint64   `json:"batchNumber,omitempty"`
+}
+
+// ConnectWebSocket opens a websocket to the ethconnect server, with the headers and
+// credentials of the client
+func (c *Client) ConnectWebSocket(ctx context.Context) (*WebSocket, error) {
+	u := *c.baseURL
+	u.Scheme = strings.Replace(u.Scheme, "http", "ws", 1)
+	u.Path += "/ws"
+	header := http.Header{}
+	for name, values := range c.conf.Headers {
+		header[name] = values
+	}
+	if c.conf.Username != "" || c.conf.Password != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.conf.Username+":"+c.conf.Password)))
+	}
+	conn, res, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if res != nil && res.StatusCode >= 300 {
+			return nil, &Error{StatusCode: res.StatusCode, Message: err.Error()}
+		}
+		return nil, err
+	}
+	return &WebSocket{conn: conn}, nil
+}
+
+func (w *WebSocket) send(cmd *webSocketCommand) error {
+	w.writeLock.Lock()
+	defer w.writeLock.Unlock()
+	return w.conn.WriteJSON(cmd)
+}
+
+// Listen starts delivery of the event batches of the streams with these topics
+func (w *WebSocket) Listen(topics ...string) error {
+	return w.send(&webSocketCommand{Type: "listen", Topics: topics})
+}
+
+// ListenReplies starts delivery of the replies to all transactions
+func (w *WebSocket) ListenReplies() error {
+	return w.send(&webSocketCommand{Type: "listenreplies"})
+}
+
+// Ack acknowledges the oldest batch received on a topic, so the stream moves on
+func (w *WebSocket) Ack(topic string) error {
+	return w.send(&webSocketCommand{Type: "ack", Topic: topic})
+}
+
+// Nack rejects the oldest batch received on a topic, so the stream handles the failure
+// with its errorHandling option
+func (w *WebSocket) Nack(topic, message string) error {
+	return w.send(&webSocketCommand{Type: "error", Topic: topic, Message: message})
+}
+
+// Receive waits for the next message on the websocket
+func (w *WebSocket) Receive() (*WebSocketMessage, error) {
+	_, data, err := w.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var parsed struct {
+		Topic       string          `json:"topic"`
+		BatchNumber uint64          `json:"batchNumber"`
+		Batch       json.RawMessage `json:"batch"`
+		Headers     *ReplyHeaders   `json:"headers"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, err
+	}
+	msg := &WebSocketMessage{
+		Topic:       parsed.Topic,
+		BatchNumber: parsed.BatchNumber,
+		Batch:       parsed.Batch,
+		Raw:         data,
+	}
+	if len(msg.Batch) > 0 {
+		var events []*Event
+		if json.Unmarshal(msg.Batch, &events) == nil {
+			msg.Events = events
+		}
+	} else if parsed.Headers != nil {
+		var reply Receipt
+		if err := json.Unmarshal(data, &reply); err != nil {
+			return nil, err
+		}
+		msg.Reply = &reply
+	}
+	return msg, nil
+}
+
+// Close closes the websocket
+func (w *WebSocket) Close() error {
+	return w.conn.Close()
+}
@@ -0,0 +1,179 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestWebSocketServer starts a websocket server that passes the commands it receives to
+// the test, and sends the messages the test passes to it
+func newTestWebSocketServer(t *testing.T) (*Client, chan *webSocketCommand, chan string, chan http.Header, func()) {
+	commands := make(chan *webSocketCommand, 10)
+	toSend := make(chan string, 10)
+	headers := make(chan http.Header, 1)
+	upgrader := &websocket.Upgrader{}
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/ws" {
+			res.WriteHeader(404)
+			return
+		}
+		headers <- req.Header
+		conn, err := upgrader.Upgrade(res, req, nil)
+		assert.NoError(t, err)
+		go func() {
+			for msg := range toSend {
+				conn.WriteMessage(websocket.TextMessage, []byte(msg))
+			}
+		}()
+		for {
+			var cmd webSocketCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			commands <- &cmd
+		}
+	}))
+	c, err := New(Config{URL: svr.URL, Username: "user1", Password: "pass1"})
+	assert.NoError(t, err)
+	return c, commands, toSend, headers, func() {
+		close(toSend)
+		svr.Close()
+	}
+}
+
+func TestWebSocketEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	c, commands, toSend, headers, done := newTestWebSocketServer(t)
+	defer done()
+
+	w, err := c.ConnectWebSocket(context.Background())
+	assert.NoError(err)
+	defer w.Close()
+	user, _, ok := (&http.Request{Header: <-headers}).BasicAuth()
+	assert.True(ok)
+	assert.Equal("user1", user)
+
+	assert.NoError(w.Listen("topic1", "topic2"))
+	cmd := <-commands
+	assert.Equal("listen", cmd.Type)
+	assert.Equal([]string{"topic1", "topic2"}, cmd.Topics)
+
+	toSend <- `{"topic":"topic1","batch":[{"address":"0x12345","blockNumber":"10","data":{"x":"1"},"signature":"Changed(uint256)"}]}`
+	msg, err := w.Receive()
+	assert.NoError(err)
+	assert.Equal("topic1", msg.Topic)
+	assert.Nil(msg.Reply)
+	assert.Len(msg.Events, 1)
+	assert.Equal("10", msg.Events[0].BlockNumber)
+	assert.Equal("1", msg.Events[0].Data["x"])
+
+	assert.NoError(w.Ack("topic1"))
+	cmd = <-commands
+	assert.Equal("ack", cmd.Type)
+	assert.Equal("topic1", cmd.Topic)
+
+	assert.NoError(w.Nack("topic2", "failed"))
+	cmd = <-commands
+	assert.Equal("error", cmd.Type)
+	assert.Equal("topic2", cmd.Topic)
+	assert.Equal("failed", cmd.Message)
+}
+
+func TestWebSocketReshapedEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, toSend, _, done := newTestWebSocketServer(t)
+	defer done()
+
+	w, err := c.ConnectWebSocket(context.Background())
+	assert.NoError(err)
+	defer w.Close()
+
+	toSend <- `{"topic":"topic1","batchNumber":3,"batch":{"events":"reshaped"}}`
+	msg, err := w.Receive()
+	assert.NoError(err)
+	assert.Equal(uint64(3), msg.BatchNumber)
+	assert.Nil(msg.Events)
+	assert.JSONEq(`{"events":"reshaped"}`, string(msg.Batch))
+}
+
+func TestWebSocketReplies(t *testing.T) {
+	assert := assert.New(t)
+
+	c, commands, toSend, _, done := newTestWebSocketServer(t)
+	defer done()
+
+	w, err := c.ConnectWebSocket(context.Background())
+	assert.NoError(err)
+	defer w.Close()
+
+	assert.NoError(w.ListenReplies())
+	assert.Equal("listenreplies", (<-commands).Type)
+
+	toSend <- `{"headers":{"type":"TransactionSuccess","requestId":"req1"},"transactionHash":"0xfeed"}`
+	msg, err := w.Receive()
+	assert.NoError(err)
+	assert.Equal("req1", msg.Reply.Headers.RequestID)
+	assert.Equal("0xfeed", msg.Reply.TransactionHash)
+	assert.Empty(msg.Topic)
+
+	toSend <- `{"other":true}`
+	msg, err = w.Receive()
+	assert.NoError(err)
+	assert.Nil(msg.Reply)
+	assert.JSONEq(`{"other":true}`, string(msg.Raw))
+
+	toSend <- `not json`
+	_, err = w.Receive()
+	assert.Error(err)
+}
+
+func TestWebSocketConnectFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(401)
+	}))
+	defer svr.Close()
+	c, _ := New(Config{URL: svr.URL})
+
+	_, err := c.ConnectWebSocket(context.Background())
+	assert.Equal(401, err.(*Error).StatusCode)
+
+	svr.Close()
+	_, err = c.ConnectWebSocket(context.Background())
+	assert.Error(err)
+}
+
+func TestWebSocketReceiveClosed(t *testing.T) {
+	assert := assert.New(t)
+
+	c, _, _, _, done := newTestWebSocketServer(t)
+	defer done()
+
+	w, err := c.ConnectWebSocket(context.Background())
+	assert.NoError(err)
+	w.Close()
+	_, err = w.Receive()
+	assert.Error(err)
+}
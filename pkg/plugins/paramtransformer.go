@@ -0,0 +1,38 @@
+// Copyright 2021 Kaleido
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugins
+
+// ParamTransformRequest describes a REST request to invoke a method, or deploy a contract,
+// before its parameters are encoded. The same structure is POSTed as JSON to transform webhooks
+type ParamTransformRequest struct {
+	// Address of the contract instance, empty for a deployment
+	Address string `json:"address,omitempty"`
+	// Method name, "constructor" for a deployment, or "fallback"/"receive"
+	Method string `json:"method"`
+	// Params are the named input parameters from the body, and the query string
+	Params map[string]interface{} `json:"params"`
+	// Headers are the HTTP headers of the request, including the x-firefly-* options
+	Headers map[string][]string `json:"headers"`
+}
+
+// ParamTransformer is a code plug-point that can be implemented using a go plugin module.
+// Build your plugin with a "ParamTransformer" export that implements this interface,
+// and configure the dynamic load path of your module in the configuration.
+type ParamTransformer interface {
+
+	// TransformParams - rewrites the Params and/or Headers of the request in place, such as converting units,
+	// or looking up an ID. Returning an error rejects the request with a 400
+	TransformParams(req *ParamTransformRequest) error
+}
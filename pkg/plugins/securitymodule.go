@@ -36,3 +36,15 @@ type SecurityModule interface {
 	// AuthReadAsyncReplyByUUID - Authorization plugpoint for getting an individual reply by UUID (containing an individual receipt/error)
 	AuthReadAsyncReplyByUUID(authCtx interface{}) error
 }
+
+// ReloadableSecurityModule is optionally implemented by a SecurityModule that can refresh its
+// configuration (keys, token endpoints, role mappings) while the gateway is running, for example
+// to pick up a key rotation without restarting the gateway
+type ReloadableSecurityModule interface {
+	SecurityModule
+
+	// AuthReloadConfig - Authorization plugpoint for reloading the configuration of the module
+	AuthReloadConfig(authCtx interface{}) error
+	// ReloadConfig - Re-reads the configuration of the module. On error the previous configuration must remain in use
+	ReloadConfig() error
+}